@@ -5,21 +5,74 @@ These dependencies resolve tenant databases and create tenant-scoped service ins
 per request.
 """
 
-from typing import Optional
+from typing import Awaitable, Callable, Optional
 from fastapi import Depends, HTTPException, status
 
+from app.blobs import BlobStore
+from app.config import (
+    AttachmentConfig,
+    BiViewsConfig,
+    ExportStorageConfig,
+    NodeTypeCatalogConfig,
+    QueryCacheConfig,
+    ValidatorCacheConfig,
+)
 from app.db.database import Database
+from app.db.rls import enter_tenant
 from app.db.tenant_db_manager import TenantDatabaseManager
+from app.encryption import current_kms
+from app.lake.storage import ObjectStore
 from app.repository import (
+    DataKeyRepository,
+    FailedPreconditionError,
+    NotFoundError,
     NodeRepository,
     NodeTypeRepository,
     RelationshipRepository,
+    WebhookRepository,
+    IntakeFormRepository,
+    EmailInboxRepository,
+    AttachmentRepository,
+    NodeLockRepository,
+    TransferRepository,
+    OutboxRepository,
+    BiViewRepository,
+    NodeMigrationRepository,
+    RetentionPolicyRepository,
+    BulkJobRepository,
+    DeadLetterRepository,
+    SubscriptionRepository,
+    TenantRepository,
 )
 from app.service import (
     NodeService,
     NodeTypeService,
     RelationshipService,
+    WebhookService,
+    IntakeFormService,
+    EmailInboxService,
+    AttachmentService,
+    NodeLockService,
+    TransferService,
+    QueryCache,
+    QueryCacheService,
+    BiViewService,
+    NodeMigrationService,
+    RetentionService,
+    NodeMigrationOperations,
+    OperationService,
+    BulkJobService,
+    DeadLetterService,
+    CloneService,
+    SubscriptionService,
+    ChangeFeedService,
+    StorageExportService,
 )
+from app.service.encryption import FieldEncryption
+from app.service.node_type_catalog import CatalogNodeTypeRepository, NodeTypeCatalog
+from app.service.validator_cache import ValidatorCache
+from app.service.operation_service import NODE_MIGRATIONS, bulk_job_operations
+from app.service.tenant_check import TenantCheck
 
 
 # Global tenant database manager (set by main.py)
@@ -32,6 +85,115 @@ def set_tenant_db_manager(manager: TenantDatabaseManager) -> None:
     _tenant_db_manager = manager
 
 
+# Builds the services of a tenant in place of create_tenant_services, such as
+# the in-memory ones of embedded mode (see app/embedded)
+_tenant_services_factory: Optional[Callable[[str], Awaitable[dict]]] = None
+
+
+def set_tenant_services_factory(factory: Optional[Callable[[str], Awaitable[dict]]]) -> None:
+    """Resolve tenant services with factory instead of the tenant databases (None restores them)."""
+    global _tenant_services_factory
+    _tenant_services_factory = factory
+
+
+# Query result cache shared by all tenants (None disables caching)
+_query_cache: Optional[QueryCache] = None
+
+
+def configure_query_cache(cfg: QueryCacheConfig) -> None:
+    """Enable or disable the query result cache."""
+    global _query_cache
+    _query_cache = QueryCache(cfg.max_entries, cfg.ttl) if cfg.enabled else None
+
+
+def current_query_cache() -> Optional[QueryCache]:
+    """Return the query result cache, or None if caching is disabled."""
+    return _query_cache
+
+
+# Node types of recently used tenants, consulted by node writes (None disables it)
+_node_type_catalog: Optional[NodeTypeCatalog] = None
+
+
+def configure_node_type_catalog(cfg: NodeTypeCatalogConfig) -> None:
+    """Enable or disable the node type catalog."""
+    global _node_type_catalog
+    _node_type_catalog = (
+        NodeTypeCatalog(cfg.refresh_interval, cfg.ttl, cfg.max_tenants) if cfg.enabled else None
+    )
+
+
+def current_node_type_catalog() -> Optional[NodeTypeCatalog]:
+    """Return the node type catalog, or None if it is disabled."""
+    return _node_type_catalog
+
+
+# Compiled schema validators shared by all tenants (None compiles them per write)
+_validator_cache: Optional[ValidatorCache] = None
+
+
+def configure_validator_cache(cfg: ValidatorCacheConfig) -> Optional[ValidatorCache]:
+    """Enable or disable the schema validator cache; returns it if enabled."""
+    global _validator_cache
+    _validator_cache = ValidatorCache(cfg.max_entries) if cfg.max_entries > 0 else None
+    return _validator_cache
+
+
+def current_validator_cache() -> Optional[ValidatorCache]:
+    """Return the schema validator cache, or None if it is disabled."""
+    return _validator_cache
+
+
+# Generated BI views (regenerated on node type changes when enabled)
+_bi_views_cfg = BiViewsConfig()
+
+
+def configure_bi_views(cfg: BiViewsConfig) -> None:
+    """Set the BI view configuration."""
+    global _bi_views_cfg
+    _bi_views_cfg = cfg
+
+
+# Blob store of node attachments and its key prefix (None disables attachments)
+_blob_store: Optional[BlobStore] = None
+_blob_prefix = ""
+_attachment_cfg = AttachmentConfig()
+
+
+def configure_attachments(cfg: AttachmentConfig, store: Optional[BlobStore], prefix: str = "") -> None:
+    """Set the attachment configuration and the blob store holding attachment bytes."""
+    global _attachment_cfg, _blob_store, _blob_prefix
+    _attachment_cfg = cfg
+    _blob_store = store
+    _blob_prefix = prefix
+
+
+# Object store of tenant exports and its key prefix (None disables exports to object storage)
+_export_store: Optional[ObjectStore] = None
+_export_prefix = ""
+_export_storage_cfg = ExportStorageConfig()
+
+
+def configure_export_storage(cfg: ExportStorageConfig, store: Optional[ObjectStore], prefix: str = "") -> None:
+    """Set the export storage configuration and the object store exports are written to."""
+    global _export_storage_cfg, _export_store, _export_prefix
+    _export_storage_cfg = cfg
+    _export_store = store
+    _export_prefix = prefix
+
+
+def create_storage_export_service(
+    transfer: TransferService,
+    jobs: BulkJobService,
+    tenant_id: str
+) -> StorageExportService:
+    """Create the service exporting a tenant to the configured object store."""
+    return StorageExportService(
+        transfer, jobs, tenant_id, _export_store, _export_prefix,
+        _export_storage_cfg.part_size, _export_storage_cfg.stale_seconds
+    )
+
+
 async def get_tenant_db(tenant_id: str) -> Database:
     """
     Get tenant database connection for a tenant.
@@ -58,30 +220,92 @@ async def get_tenant_db(tenant_id: str) -> Database:
         )
 
 
-def create_tenant_services(tenant_db: Database):
+def create_tenant_services(tenant_db: Database, tenant_id: str, tenant_repo: Optional[TenantRepository] = None):
     """
     Create tenant-scoped service instances.
     
     Args:
         tenant_db: Tenant database connection
+        tenant_id: ID of the tenant, whose key encryption key wraps its data keys
+        tenant_repo: Control database tenants, checked before node type, node
+            and relationship writes (see app/service/tenant_check.py)
         
     Returns:
-        Tuple of (NodeTypeService, NodeService, RelationshipService)
+        Dict of NodeTypeService, NodeService, NodeLockService, RelationshipService, CloneService, WebhookService,
+        SubscriptionService, ChangeFeedService, IntakeFormService, EmailInboxService, AttachmentService,
+        TransferService, StorageExportService,
+        QueryCacheService, BiViewService (None unless BI views are enabled), NodeMigrationService, RetentionService,
+        BulkJobService, OperationService and DeadLetterService
     """
     # Create tenant-scoped repositories
     node_type_repo = NodeTypeRepository(tenant_db)
     node_repo = NodeRepository(tenant_db)
     relationship_repo = RelationshipRepository(tenant_db)
+    webhook_repo = WebhookRepository(tenant_db)
+    intake_repo = IntakeFormRepository(tenant_db)
+    inbox_repo = EmailInboxRepository(tenant_db)
+    transfer_repo = TransferRepository(tenant_db)
+    encryption = FieldEncryption(current_kms(), DataKeyRepository(tenant_db), tenant_id)
+    tenant_check = TenantCheck(tenant_repo, tenant_id) if tenant_repo else None
     
     # Create tenant-scoped services
-    node_type_svc = NodeTypeService(node_type_repo)
-    node_svc = NodeService(node_repo, node_type_repo)
-    relationship_svc = RelationshipService(relationship_repo, node_repo)
+    bi_view_svc = None
+    if _bi_views_cfg.enabled:
+        bi_view_svc = BiViewService(BiViewRepository(tenant_db, _bi_views_cfg.reader_role), node_type_repo)
+    node_type_svc = NodeTypeService(node_type_repo, bi_view_svc, tenant_check)
+    node_write_types = node_type_repo
+    if _node_type_catalog:
+        catalog = _node_type_catalog
+        node_type_svc.on_change = lambda: catalog.invalidate(tenant_id)
+        node_write_types = CatalogNodeTypeRepository(node_type_repo, catalog, tenant_id)
+    node_lock_svc = NodeLockService(NodeLockRepository(tenant_db), tenant_check)
+    node_svc = NodeService(node_repo, node_write_types, encryption, tenant_check, _validator_cache, node_lock_svc)
+    relationship_svc = RelationshipService(relationship_repo, node_repo, tenant_check)
+    clone_svc = CloneService(node_repo, node_type_repo, relationship_repo, transfer_repo, encryption)
+    webhook_svc = WebhookService(webhook_repo)
+    subscription_svc = SubscriptionService(SubscriptionRepository(tenant_db))
+    change_feed_svc = ChangeFeedService(OutboxRepository(tenant_db))
+    intake_svc = IntakeFormService(intake_repo, node_type_repo, node_svc)
+    inbox_svc = EmailInboxService(inbox_repo, node_type_repo, node_svc)
+    attachment_svc = AttachmentService(
+        AttachmentRepository(tenant_db), node_repo, tenant_id, _blob_store, _blob_prefix,
+        _attachment_cfg.max_bytes, tenant_check
+    )
+    transfer_svc = TransferService(transfer_repo, node_type_repo, bi_view_svc)
+    query_cache_svc = QueryCacheService(_query_cache, OutboxRepository(tenant_db))
+    node_migration_svc = NodeMigrationService(
+        NodeMigrationRepository(tenant_db), node_type_repo, node_repo, encryption
+    )
+    retention_svc = RetentionService(RetentionPolicyRepository(tenant_db), node_type_repo, node_repo, tenant_check)
+    bulk_job_svc = BulkJobService(BulkJobRepository(tenant_db))
+    storage_export_svc = create_storage_export_service(transfer_svc, bulk_job_svc, tenant_id)
+    operation_svc = OperationService({
+        NODE_MIGRATIONS: NodeMigrationOperations(node_migration_svc),
+        **bulk_job_operations(bulk_job_svc),
+    })
+    dead_letter_svc = DeadLetterService(DeadLetterRepository(tenant_db), webhook_repo, node_migration_svc)
     
     return {
         "node_type": node_type_svc,
         "node": node_svc,
+        "node_locks": node_lock_svc,
         "relationship": relationship_svc,
+        "clone": clone_svc,
+        "webhook": webhook_svc,
+        "subscriptions": subscription_svc,
+        "changes": change_feed_svc,
+        "intake": intake_svc,
+        "inbox": inbox_svc,
+        "attachments": attachment_svc,
+        "transfer": transfer_svc,
+        "storage_exports": storage_export_svc,
+        "query_cache": query_cache_svc,
+        "bi_views": bi_view_svc,
+        "node_migration": node_migration_svc,
+        "retention": retention_svc,
+        "bulk_jobs": bulk_job_svc,
+        "operations": operation_svc,
+        "dead_letters": dead_letter_svc,
     }
 
 
@@ -90,8 +314,31 @@ async def resolve_tenant_services(tenant_id: str) -> dict:
     """
     Resolve tenant services for a given tenant_id.
     
-    This is used by route handlers to get tenant-scoped services.
+    This is used by route handlers to get tenant-scoped services. The rest of
+    the request acts on behalf of the tenant, unless it already acts on behalf
+    of another one (see app/db/rls.py). Unknown tenants are rejected with
+    NotFoundError and suspended ones with FailedPreconditionError.
     """
+    enter_tenant(tenant_id)
+    await check_tenant_available(tenant_id)
+    if _tenant_services_factory:
+        return await _tenant_services_factory(tenant_id)
     tenant_db = await get_tenant_db(tenant_id)
-    return create_tenant_services(tenant_db)
+    tenant_repo = TenantRepository(_tenant_db_manager.control_db) if _tenant_db_manager.control_db else None
+    return create_tenant_services(tenant_db, tenant_id, tenant_repo)
+
+
+async def check_tenant_available(tenant_id: str) -> None:
+    """
+    Raise NotFoundError if the tenant doesn't exist and FailedPreconditionError
+    if it is suspended or being deleted (see app/service/tenant_service.py).
+    """
+    if not _tenant_db_manager:
+        return
+    try:
+        status = await _tenant_db_manager.tenant_status(tenant_id)
+    except ValueError:
+        raise NotFoundError(f"tenant not found: {tenant_id}") from None
+    if status in ("suspended", "deleting"):
+        raise FailedPreconditionError(f"tenant {tenant_id} is {status}")
 
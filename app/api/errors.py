@@ -2,16 +2,28 @@
 Error handling utilities for REST API.
 """
 
+from typing import Optional
+
 from fastapi import HTTPException
-from app.repository.errors import NotFoundError
+
+from app.repository.errors import ConflictError, FailedPreconditionError, NotFoundError
 
 
 def handle_service_error(err: Exception) -> HTTPException:
     """Convert service exception to HTTP exception."""
     if isinstance(err, NotFoundError):
         return HTTPException(status_code=404, detail=str(err))
+    elif isinstance(err, (ConflictError, FailedPreconditionError)):
+        return HTTPException(status_code=409, detail=str(err))
     elif isinstance(err, ValueError):
         return HTTPException(status_code=400, detail=str(err))
     else:
         return HTTPException(status_code=500, detail=str(err))
 
+
+def handle_conditional_error(err: Exception, if_match: Optional[str]) -> HTTPException:
+    """Convert a service exception to HTTP, with 412 for a stale If-Match."""
+    if if_match and isinstance(err, ConflictError):
+        return HTTPException(status_code=412, detail=str(err))
+    return handle_service_error(err)
+
@@ -144,6 +144,7 @@ class NodeTypeBase(BaseModel):
     name: str = Field(..., min_length=1, description="Node type name")
     description: Optional[str] = Field(default="", description="Node type description")
     json_schema: Optional[str] = Field(default="", alias="schema", description="JSON schema for node data validation")
+    display: Optional[str] = Field(default="", description="UI display metadata as JSON string")
 
 
 class NodeTypeCreate(NodeTypeBase):
@@ -156,6 +157,8 @@ class NodeTypeUpdate(BaseModel):
     name: Optional[str] = Field(default=None, description="New node type name")
     description: Optional[str] = Field(default=None, description="New node type description")
     json_schema: Optional[str] = Field(default=None, alias="schema", description="New JSON schema")
+    display: Optional[str] = Field(default=None, description="New UI display metadata as JSON string")
+    expected_version: Optional[int] = Field(default=None, ge=1, description="Fail with 409 unless the current version matches")
 
 
 class NodeType(BaseModel):
@@ -165,8 +168,11 @@ class NodeType(BaseModel):
     name: str = Field(..., description="Node type name")
     description: str = Field(..., description="Node type description")
     json_schema: str = Field(..., alias="schema", description="JSON schema")
+    display: str = Field(..., description="UI display metadata as JSON string")
     created_at: str = Field(..., description="Creation timestamp")
     updated_at: str = Field(..., description="Last update timestamp")
+    version: int = Field(..., description="Version, incremented on every update")
+    etag: str = Field(..., description="Entity tag of this version, for If-Match")
 
 
 class NodeTypeResponse(BaseModel):
@@ -198,6 +204,7 @@ class NodeCreate(NodeBase):
 class NodeUpdate(BaseModel):
     """Request model for updating a node."""
     data: Optional[str] = Field(default=None, description="New node data as JSON string")
+    expected_version: Optional[int] = Field(default=None, ge=1, description="Fail with 409 unless the current version matches")
 
 
 class Node(BaseModel):
@@ -208,6 +215,8 @@ class Node(BaseModel):
     data: str = Field(..., description="Node data as JSON string")
     created_at: str = Field(..., description="Creation timestamp")
     updated_at: str = Field(..., description="Last update timestamp")
+    version: int = Field(..., description="Version, incremented on every update")
+    etag: str = Field(..., description="Entity tag of this version, for If-Match")
 
 
 class NodeResponse(BaseModel):
@@ -242,6 +251,7 @@ class RelationshipUpdate(BaseModel):
     """Request model for updating a relationship."""
     relationship_type: Optional[str] = Field(default=None, description="New relationship type")
     data: Optional[str] = Field(default=None, description="New relationship data as JSON string")
+    expected_version: Optional[int] = Field(default=None, ge=1, description="Fail with 409 unless the current version matches")
 
 
 class Relationship(BaseModel):
@@ -254,6 +264,8 @@ class Relationship(BaseModel):
     data: str = Field(..., description="Relationship data as JSON string")
     created_at: str = Field(..., description="Creation timestamp")
     updated_at: str = Field(..., description="Last update timestamp")
+    version: int = Field(..., description="Version, incremented on every update")
+    etag: str = Field(..., description="Entity tag of this version, for If-Match")
 
 
 class RelationshipResponse(BaseModel):
@@ -2,7 +2,9 @@
 NodeType REST API router.
 """
 
-from fastapi import APIRouter, Query
+from typing import Optional
+
+from fastapi import APIRouter, Header, Query, Response
 
 from app.api.models import (
     NodeTypeCreate,
@@ -11,7 +13,7 @@ from app.api.models import (
     NodeTypeListResponse,
     ErrorResponse,
 )
-from app.api.errors import handle_service_error
+from app.api.errors import handle_conditional_error, handle_service_error
 from app.api.dependencies import resolve_tenant_services
 
 
@@ -38,7 +40,8 @@ async def create_node_type(tenant_id: str, node_type: NodeTypeCreate):
         node_type_obj = await services["node_type"].create(
             node_type.name,
             node_type.description or "",
-            node_type.json_schema or ""
+            node_type.json_schema or "",
+            node_type.display or ""
         )
         return NodeTypeResponse(node_type=node_type_obj.to_dict())
     except Exception as e:
@@ -56,11 +59,12 @@ async def create_node_type(tenant_id: str, node_type: NodeTypeCreate):
         500: {"description": "Internal server error", "model": ErrorResponse},
     },
 )
-async def get_node_type(tenant_id: str, node_type_id: str):
+async def get_node_type(tenant_id: str, node_type_id: str, response: Response):
     """Get a node type by ID."""
     try:
         services = await resolve_tenant_services(tenant_id)
         node_type_obj = await services["node_type"].get_by_id(node_type_id)
+        response.headers["ETag"] = node_type_obj.etag
         return NodeTypeResponse(node_type=node_type_obj.to_dict())
     except Exception as e:
         raise handle_service_error(e)
@@ -70,15 +74,26 @@ async def get_node_type(tenant_id: str, node_type_id: str):
     "/{node_type_id}",
     response_model=NodeTypeResponse,
     summary="Update a node type",
-    description="Update an existing node type. Only provided fields will be updated.",
+    description=(
+        "Update an existing node type. Only provided fields will be updated. "
+        "With If-Match, only updates the node type while its ETag matches."
+    ),
     responses={
         200: {"description": "Node type updated successfully"},
         400: {"description": "Invalid parameters", "model": ErrorResponse},
         404: {"description": "Node type or tenant not found", "model": ErrorResponse},
+        409: {"description": "Version conflict", "model": ErrorResponse},
+        412: {"description": "If-Match does not match the current ETag", "model": ErrorResponse},
         500: {"description": "Internal server error", "model": ErrorResponse},
     },
 )
-async def update_node_type(tenant_id: str, node_type_id: str, node_type: NodeTypeUpdate):
+async def update_node_type(
+    tenant_id: str,
+    node_type_id: str,
+    node_type: NodeTypeUpdate,
+    response: Response,
+    if_match: Optional[str] = Header(default=None),
+):
     """Update an existing node type."""
     try:
         services = await resolve_tenant_services(tenant_id)
@@ -86,31 +101,37 @@ async def update_node_type(tenant_id: str, node_type_id: str, node_type: NodeTyp
         name = node_type.name or ""
         description = node_type.description or ""
         schema = node_type.json_schema or ""
-        node_type_obj = await services["node_type"].update(node_type_id, name, description, schema)
+        display = node_type.display or ""
+        node_type_obj = await services["node_type"].update(
+            node_type_id, name, description, schema, node_type.expected_version, display, if_match or ""
+        )
+        response.headers["ETag"] = node_type_obj.etag
         return NodeTypeResponse(node_type=node_type_obj.to_dict())
     except Exception as e:
-        raise handle_service_error(e)
+        raise handle_conditional_error(e, if_match)
 
 
 @router.delete(
     "/{node_type_id}",
     status_code=204,
     summary="Delete a node type",
-    description="Delete a node type by its ID.",
+    description="Delete a node type by its ID. With If-Match, only deletes it while its ETag matches.",
     responses={
         204: {"description": "Node type deleted successfully"},
+        400: {"description": "Invalid If-Match", "model": ErrorResponse},
         404: {"description": "Node type or tenant not found", "model": ErrorResponse},
+        412: {"description": "If-Match does not match the current ETag", "model": ErrorResponse},
         500: {"description": "Internal server error", "model": ErrorResponse},
     },
 )
-async def delete_node_type(tenant_id: str, node_type_id: str):
+async def delete_node_type(tenant_id: str, node_type_id: str, if_match: Optional[str] = Header(default=None)):
     """Delete a node type."""
     try:
         services = await resolve_tenant_services(tenant_id)
-        await services["node_type"].delete(node_type_id)
+        await services["node_type"].delete(node_type_id, if_match=if_match or "")
         return None
     except Exception as e:
-        raise handle_service_error(e)
+        raise handle_conditional_error(e, if_match)
 
 
 @router.get(
@@ -128,11 +149,15 @@ async def list_node_types(
     tenant_id: str,
     page_size: int = Query(default=10, ge=1, le=100, description="Number of items per page"),
     page_token: str = Query(default="", description="Token for the next page"),
+    order_by: str = Query(default="", description="Sort field: created_at, updated_at or name"),
+    direction: str = Query(default="asc", description="Sort direction: asc or desc"),
 ):
     """List node types for a tenant."""
     try:
         services = await resolve_tenant_services(tenant_id)
-        node_types, pagination = await services["node_type"].list(page_size, page_token)
+        node_types, pagination = await services["node_type"].list(
+            page_size, page_token, {"field": order_by, "direction": direction} if order_by else None
+        )
         return NodeTypeListResponse(
             node_types=[nt.to_dict() for nt in node_types],
             pagination=pagination.to_dict()
@@ -2,7 +2,7 @@
 Node REST API router.
 """
 
-from fastapi import APIRouter, Query
+from fastapi import APIRouter, Header, Query, Response
 from typing import Optional
 
 from app.api.models import (
@@ -12,7 +12,7 @@ from app.api.models import (
     NodeListResponse,
     ErrorResponse,
 )
-from app.api.errors import handle_service_error
+from app.api.errors import handle_conditional_error, handle_service_error
 from app.api.dependencies import resolve_tenant_services
 
 
@@ -32,11 +32,12 @@ router = APIRouter(prefix="/tenants/{tenant_id}/nodes", tags=["Nodes"])
         500: {"description": "Internal server error", "model": ErrorResponse},
     },
 )
-async def create_node(tenant_id: str, node: NodeCreate):
+async def create_node(tenant_id: str, node: NodeCreate, response: Response):
     """Create a new node."""
     try:
         services = await resolve_tenant_services(tenant_id)
         node_obj = await services["node"].create(node.node_type_id, node.data or "{}")
+        response.headers["ETag"] = node_obj.etag
         return NodeResponse(node=node_obj.to_dict())
     except Exception as e:
         raise handle_service_error(e)
@@ -49,15 +50,22 @@ async def create_node(tenant_id: str, node: NodeCreate):
     description="Get a node by its ID within a tenant.",
     responses={
         200: {"description": "Node found"},
+        400: {"description": "Invalid locale", "model": ErrorResponse},
         404: {"description": "Node or tenant not found", "model": ErrorResponse},
         500: {"description": "Internal server error", "model": ErrorResponse},
     },
 )
-async def get_node(tenant_id: str, node_id: str):
+async def get_node(
+    tenant_id: str,
+    node_id: str,
+    response: Response,
+    locale: str = Query(default="", description="Preferred locales for localized fields, e.g. fr-CA,fr,en"),
+):
     """Get a node by ID."""
     try:
         services = await resolve_tenant_services(tenant_id)
-        node_obj = await services["node"].get_by_id(node_id)
+        node_obj = await services["node"].get_by_id(node_id, locale)
+        response.headers["ETag"] = node_obj.etag
         return NodeResponse(node=node_obj.to_dict())
     except Exception as e:
         raise handle_service_error(e)
@@ -67,45 +75,72 @@ async def get_node(tenant_id: str, node_id: str):
     "/{node_id}",
     response_model=NodeResponse,
     summary="Update a node",
-    description="Update an existing node. Only provided fields will be updated.",
+    description=(
+        "Update an existing node. Only provided fields will be updated. "
+        "With If-Match, only updates the node while its ETag matches, "
+        "with X-Lock-Token, while the token holds the node's lock."
+    ),
     responses={
         200: {"description": "Node updated successfully"},
         400: {"description": "Invalid parameters", "model": ErrorResponse},
         404: {"description": "Node or tenant not found", "model": ErrorResponse},
+        409: {"description": "Version conflict, or the node is locked", "model": ErrorResponse},
+        412: {"description": "If-Match does not match the current ETag", "model": ErrorResponse},
         500: {"description": "Internal server error", "model": ErrorResponse},
     },
 )
-async def update_node(tenant_id: str, node_id: str, node: NodeUpdate):
+async def update_node(
+    tenant_id: str,
+    node_id: str,
+    node: NodeUpdate,
+    response: Response,
+    if_match: Optional[str] = Header(default=None),
+    lock_token: Optional[str] = Header(default=None, alias="X-Lock-Token"),
+):
     """Update an existing node."""
     try:
         services = await resolve_tenant_services(tenant_id)
         # Only pass non-None values to service (service layer handles empty strings)
         data = node.data or ""
-        node_obj = await services["node"].update(node_id, data)
+        node_obj = await services["node"].update(
+            node_id, data, node.expected_version, if_match or "", lock_token=lock_token or ""
+        )
+        response.headers["ETag"] = node_obj.etag
         return NodeResponse(node=node_obj.to_dict())
     except Exception as e:
-        raise handle_service_error(e)
+        raise handle_conditional_error(e, if_match)
 
 
 @router.delete(
     "/{node_id}",
     status_code=204,
     summary="Delete a node",
-    description="Delete a node by its ID.",
+    description=(
+        "Delete a node by its ID. With If-Match, only deletes it while its ETag matches, "
+        "with X-Lock-Token, while the token holds the node's lock."
+    ),
     responses={
         204: {"description": "Node deleted successfully"},
+        400: {"description": "Invalid If-Match", "model": ErrorResponse},
         404: {"description": "Node or tenant not found", "model": ErrorResponse},
+        409: {"description": "The node is locked", "model": ErrorResponse},
+        412: {"description": "If-Match does not match the current ETag", "model": ErrorResponse},
         500: {"description": "Internal server error", "model": ErrorResponse},
     },
 )
-async def delete_node(tenant_id: str, node_id: str):
+async def delete_node(
+    tenant_id: str,
+    node_id: str,
+    if_match: Optional[str] = Header(default=None),
+    lock_token: Optional[str] = Header(default=None, alias="X-Lock-Token"),
+):
     """Delete a node."""
     try:
         services = await resolve_tenant_services(tenant_id)
-        await services["node"].delete(node_id)
+        await services["node"].delete(node_id, if_match=if_match or "", lock_token=lock_token or "")
         return None
     except Exception as e:
-        raise handle_service_error(e)
+        raise handle_conditional_error(e, if_match)
 
 
 @router.get(
@@ -124,11 +159,18 @@ async def list_nodes(
     node_type_id: Optional[str] = Query(default=None, description="Filter by node type ID"),
     page_size: int = Query(default=10, ge=1, le=100, description="Number of items per page"),
     page_token: str = Query(default="", description="Token for the next page"),
+    locale: str = Query(default="", description="Preferred locales for localized fields, e.g. fr-CA,fr,en"),
+    order_by: str = Query(default="", description="Sort field: created_at, updated_at or an indexed data path such as data.price"),
+    direction: str = Query(default="asc", description="Sort direction: asc or desc"),
+    as_of: str = Query(default="", description="List nodes as they were at this ISO 8601 time"),
 ):
     """List nodes for a tenant."""
     try:
         services = await resolve_tenant_services(tenant_id)
-        nodes, pagination = await services["node"].list(node_type_id or None, page_size, page_token)
+        nodes, pagination = await services["node"].list(
+            node_type_id or None, page_size, page_token, locale=locale,
+            order_by={"field": order_by, "direction": direction} if order_by else None, as_of=as_of
+        )
         return NodeListResponse(
             nodes=[n.to_dict() for n in nodes],
             pagination=pagination.to_dict()
@@ -2,8 +2,8 @@
 Relationship REST API router.
 """
 
-from fastapi import APIRouter, Query
-from typing import Optional
+from fastapi import APIRouter, Header, Query, Response
+from typing import List, Optional
 
 from app.api.models import (
     RelationshipCreate,
@@ -12,7 +12,7 @@ from app.api.models import (
     RelationshipListResponse,
     ErrorResponse,
 )
-from app.api.errors import handle_service_error
+from app.api.errors import handle_conditional_error, handle_service_error
 from app.api.dependencies import resolve_tenant_services
 
 
@@ -32,7 +32,7 @@ router = APIRouter(prefix="/tenants/{tenant_id}/relationships", tags=["Relations
         500: {"description": "Internal server error", "model": ErrorResponse},
     },
 )
-async def create_relationship(tenant_id: str, relationship: RelationshipCreate):
+async def create_relationship(tenant_id: str, relationship: RelationshipCreate, response: Response):
     """Create a new relationship."""
     try:
         services = await resolve_tenant_services(tenant_id)
@@ -42,6 +42,7 @@ async def create_relationship(tenant_id: str, relationship: RelationshipCreate):
             relationship.relationship_type,
             relationship.data or "{}"
         )
+        response.headers["ETag"] = rel_obj.etag
         return RelationshipResponse(relationship=rel_obj.to_dict())
     except Exception as e:
         raise handle_service_error(e)
@@ -58,11 +59,12 @@ async def create_relationship(tenant_id: str, relationship: RelationshipCreate):
         500: {"description": "Internal server error", "model": ErrorResponse},
     },
 )
-async def get_relationship(tenant_id: str, relationship_id: str):
+async def get_relationship(tenant_id: str, relationship_id: str, response: Response):
     """Get a relationship by ID."""
     try:
         services = await resolve_tenant_services(tenant_id)
         rel_obj = await services["relationship"].get_by_id(relationship_id)
+        response.headers["ETag"] = rel_obj.etag
         return RelationshipResponse(relationship=rel_obj.to_dict())
     except Exception as e:
         raise handle_service_error(e)
@@ -72,46 +74,64 @@ async def get_relationship(tenant_id: str, relationship_id: str):
     "/{relationship_id}",
     response_model=RelationshipResponse,
     summary="Update a relationship",
-    description="Update an existing relationship. Only provided fields will be updated.",
+    description=(
+        "Update an existing relationship. Only provided fields will be updated. "
+        "With If-Match, only updates the relationship while its ETag matches."
+    ),
     responses={
         200: {"description": "Relationship updated successfully"},
         400: {"description": "Invalid parameters", "model": ErrorResponse},
         404: {"description": "Relationship or tenant not found", "model": ErrorResponse},
+        409: {"description": "Version conflict", "model": ErrorResponse},
+        412: {"description": "If-Match does not match the current ETag", "model": ErrorResponse},
         500: {"description": "Internal server error", "model": ErrorResponse},
     },
 )
-async def update_relationship(tenant_id: str, relationship_id: str, relationship: RelationshipUpdate):
+async def update_relationship(
+    tenant_id: str,
+    relationship_id: str,
+    relationship: RelationshipUpdate,
+    response: Response,
+    if_match: Optional[str] = Header(default=None),
+):
     """Update an existing relationship."""
     try:
         services = await resolve_tenant_services(tenant_id)
         # Only pass non-None values to service (service layer handles empty strings)
         rel_type = relationship.relationship_type or ""
         data = relationship.data or ""
-        rel_obj = await services["relationship"].update(relationship_id, rel_type, data)
+        rel_obj = await services["relationship"].update(
+            relationship_id, rel_type, data, relationship.expected_version, if_match or ""
+        )
+        response.headers["ETag"] = rel_obj.etag
         return RelationshipResponse(relationship=rel_obj.to_dict())
     except Exception as e:
-        raise handle_service_error(e)
+        raise handle_conditional_error(e, if_match)
 
 
 @router.delete(
     "/{relationship_id}",
     status_code=204,
     summary="Delete a relationship",
-    description="Delete a relationship by its ID.",
+    description="Delete a relationship by its ID. With If-Match, only deletes it while its ETag matches.",
     responses={
         204: {"description": "Relationship deleted successfully"},
+        400: {"description": "Invalid If-Match", "model": ErrorResponse},
         404: {"description": "Relationship or tenant not found", "model": ErrorResponse},
+        412: {"description": "If-Match does not match the current ETag", "model": ErrorResponse},
         500: {"description": "Internal server error", "model": ErrorResponse},
     },
 )
-async def delete_relationship(tenant_id: str, relationship_id: str):
+async def delete_relationship(
+    tenant_id: str, relationship_id: str, if_match: Optional[str] = Header(default=None)
+):
     """Delete a relationship."""
     try:
         services = await resolve_tenant_services(tenant_id)
-        await services["relationship"].delete(relationship_id)
+        await services["relationship"].delete(relationship_id, if_match=if_match or "")
         return None
     except Exception as e:
-        raise handle_service_error(e)
+        raise handle_conditional_error(e, if_match)
 
 
 @router.get(
@@ -127,11 +147,19 @@ async def delete_relationship(tenant_id: str, relationship_id: str):
 )
 async def list_relationships(
     tenant_id: str,
-    source_node_id: Optional[str] = Query(default=None, description="Filter by source node ID"),
-    target_node_id: Optional[str] = Query(default=None, description="Filter by target node ID"),
-    relationship_type: Optional[str] = Query(default=None, description="Filter by relationship type"),
+    source_node_id: Optional[List[str]] = Query(
+        default=None, description="Filter by source node ID (repeat for any of several)"
+    ),
+    target_node_id: Optional[List[str]] = Query(
+        default=None, description="Filter by target node ID (repeat for any of several)"
+    ),
+    relationship_type: Optional[List[str]] = Query(
+        default=None, description="Filter by relationship type (repeat for any of several)"
+    ),
     page_size: int = Query(default=10, ge=1, le=100, description="Number of items per page"),
     page_token: str = Query(default="", description="Token for the next page"),
+    order_by: str = Query(default="", description="Sort field: created_at or updated_at"),
+    direction: str = Query(default="asc", description="Sort direction: asc or desc"),
 ):
     """List relationships for a tenant."""
     try:
@@ -141,7 +169,8 @@ async def list_relationships(
             target_node_id,
             relationship_type,
             page_size,
-            page_token
+            page_token,
+            {"field": order_by, "direction": direction} if order_by else None
         )
         return RelationshipListResponse(
             relationships=[r.to_dict() for r in rels],
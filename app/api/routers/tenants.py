@@ -3,6 +3,7 @@ Tenant REST API router.
 """
 
 from fastapi import APIRouter, Query
+from fastapi.responses import JSONResponse
 
 from app.api.models import (
     TenantCreate,
@@ -102,8 +103,9 @@ async def update_tenant(tenant_id: str, tenant: TenantUpdate):
     "/{tenant_id}",
     status_code=204,
     summary="Delete a tenant",
-    description="Delete a tenant by its ID.",
+    description="Delete a tenant by its ID, in the background where the backend supports it.",
     responses={
+        202: {"description": "Tenant deletion started; the body is its status"},
         204: {"description": "Tenant deleted successfully"},
         404: {"description": "Tenant not found", "model": ErrorResponse},
         500: {"description": "Internal server error", "model": ErrorResponse},
@@ -114,7 +116,9 @@ async def delete_tenant(tenant_id: str):
     try:
         if _tenant_service is None:
             raise RuntimeError("Tenant service not initialized")
-        await _tenant_service.delete(tenant_id)
+        deletion = await _tenant_service.delete(tenant_id)
+        if deletion:
+            return JSONResponse(status_code=202, content=deletion.to_dict())
         return None
     except Exception as e:
         raise handle_service_error(e)
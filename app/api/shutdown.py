@@ -0,0 +1,116 @@
+"""
+Graceful shutdown of the API server.
+
+On SIGTERM (or the first SIGINT) the server shuts down in stages, so rolling
+deploys don't drop requests:
+
+1. /health reports NOT_SERVING (status 503) for SHUTDOWN_DRAIN_DELAY seconds
+   while requests are still served, so load balancers take the instance out
+   of rotation before it stops accepting connections.
+2. The server stops accepting connections and waits for in-flight requests.
+3. The lifespan drains the outbox, delivering and publishing the events the
+   last requests wrote, and stops the background jobs.
+4. Whatever hasn't finished SHUTDOWN_TIMEOUT seconds after the drain delay is
+   cancelled, and the server exits.
+
+A second signal skips the rest of the drain delay; a second SIGINT forces the
+server to exit at once.
+"""
+
+import asyncio
+import logging
+import time
+from typing import Any, Awaitable, Callable, Optional
+
+import uvicorn
+
+from app.config import ShutdownConfig, shutdown_config_from_env
+
+logger = logging.getLogger(__name__)
+
+NOT_SERVING = "NOT_SERVING"
+
+
+class ShutdownCoordinator:
+    """Serving state and the shutdown deadline shared by /health, the server and the lifespan."""
+
+    def __init__(self, cfg: ShutdownConfig, clock: Callable[[], float] = time.monotonic):
+        self.cfg = cfg
+        self.clock = clock
+        self.serving = True
+        self._deadline: Optional[float] = None
+
+    def begin(self) -> None:
+        """Stop serving: /health reports NOT_SERVING from now on, and the shutdown deadline is set."""
+        if self.serving:
+            self.serving = False
+            self._deadline = self.clock() + self.cfg.drain_delay + self.cfg.timeout
+
+    def remaining(self) -> float:
+        """Return the seconds left until the deadline, after which shutdown steps are cancelled."""
+        if self._deadline is None:
+            return self.cfg.timeout
+        return max(0.0, self._deadline - self.clock())
+
+    async def stop(self, name: str, stop: Callable[[], Awaitable[Any]]) -> bool:
+        """
+        Run a shutdown step, e.g. a background job's stop(), within the time
+        left, cancelling it, and the work it waits for, once the deadline
+        passed. Returns whether it finished; failures are logged.
+        """
+        self.begin()
+        task = asyncio.ensure_future(stop())
+        # asyncio.wait always lets the step start, so cancelling it also
+        # cancels the job loop it is waiting for
+        done, _ = await asyncio.wait({task}, timeout=self.remaining())
+        if not done:
+            logger.warning(f"Shutdown timeout reached, cancelling {name}")
+            task.cancel()
+            try:
+                await task
+            except asyncio.CancelledError:
+                pass
+            except Exception:
+                logger.exception(f"Stopping {name} failed")
+            return False
+        if task.exception():
+            logger.error(f"Stopping {name} failed", exc_info=task.exception())
+        return True
+
+
+_coordinator: Optional[ShutdownCoordinator] = None
+
+
+def configure_shutdown(cfg: ShutdownConfig) -> ShutdownCoordinator:
+    """Replace the shutdown coordinator, serving again, and return it."""
+    global _coordinator
+    _coordinator = ShutdownCoordinator(cfg)
+    return _coordinator
+
+
+def shutdown_coordinator() -> ShutdownCoordinator:
+    """Return the shutdown coordinator, configured from the environment unless configure_shutdown() was called."""
+    if _coordinator is None:
+        return configure_shutdown(shutdown_config_from_env())
+    return _coordinator
+
+
+class GracefulServer(uvicorn.Server):
+    """uvicorn server that reports NOT_SERVING for the drain delay before it stops accepting connections."""
+
+    def __init__(self, config: uvicorn.Config, coordinator: ShutdownCoordinator):
+        super().__init__(config)
+        self.coordinator = coordinator
+
+    def handle_exit(self, sig: int, frame: Any) -> None:
+        if not self.coordinator.serving or self.coordinator.cfg.drain_delay <= 0:
+            self.coordinator.begin()
+            super().handle_exit(sig, frame)
+            return
+        self.coordinator.begin()
+        logger.info(
+            f"Reporting {NOT_SERVING} for {self.coordinator.cfg.drain_delay:g}s before closing connections"
+        )
+        asyncio.get_running_loop().call_later(
+            self.coordinator.cfg.drain_delay, super().handle_exit, sig, frame
+        )
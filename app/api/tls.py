@@ -0,0 +1,61 @@
+"""
+TLS and mutual TLS for the API server.
+
+With TLS_CERT_FILE and TLS_KEY_FILE set, the server only accepts HTTPS. With
+TLS_CLIENT_CA_FILE also set, the TLS handshake fails unless the client
+presents a certificate signed by one of its CAs (mutual TLS), before any
+request reaches authentication; API keys are still checked on top.
+"""
+
+import os
+import ssl
+from typing import Any, Dict
+
+from app.config import TlsConfig
+
+
+def tls_enabled(cfg: TlsConfig) -> bool:
+    """Return whether the server serves HTTPS."""
+    return bool(cfg.cert_file or cfg.key_file)
+
+
+def server_context(cfg: TlsConfig) -> ssl.SSLContext:
+    """
+    Return the SSL context of the server, loading the certificate, key and
+    client CAs so mistakes are reported at startup. Raises ValueError if the
+    configuration is incomplete, ssl.SSLError or OSError if a file is invalid.
+    """
+    if not cfg.cert_file or not cfg.key_file:
+        raise ValueError("TLS_CERT_FILE and TLS_KEY_FILE must be set together")
+    for name, path in (
+        ("TLS_CERT_FILE", cfg.cert_file), ("TLS_KEY_FILE", cfg.key_file), ("TLS_CLIENT_CA_FILE", cfg.client_ca_file)
+    ):
+        if path and not os.path.isfile(path):
+            raise ValueError(f"{name} does not exist: {path}")
+
+    context = ssl.create_default_context(ssl.Purpose.CLIENT_AUTH)
+    context.minimum_version = ssl.TLSVersion.TLSv1_2
+    context.load_cert_chain(cfg.cert_file, cfg.key_file, cfg.key_password or None)
+    if cfg.client_ca_file:
+        context.load_verify_locations(cfg.client_ca_file)
+        context.verify_mode = ssl.CERT_REQUIRED
+    return context
+
+
+def uvicorn_options(cfg: TlsConfig) -> Dict[str, Any]:
+    """Return the uvicorn.run() TLS options of the server, after checking them with server_context()."""
+    if not tls_enabled(cfg):
+        if cfg.client_ca_file:
+            raise ValueError("TLS_CLIENT_CA_FILE requires TLS_CERT_FILE and TLS_KEY_FILE")
+        return {}
+    server_context(cfg)
+    options: Dict[str, Any] = {
+        "ssl_certfile": cfg.cert_file,
+        "ssl_keyfile": cfg.key_file,
+    }
+    if cfg.key_password:
+        options["ssl_keyfile_password"] = cfg.key_password
+    if cfg.client_ca_file:
+        options["ssl_ca_certs"] = cfg.client_ca_file
+        options["ssl_cert_reqs"] = ssl.CERT_REQUIRED
+    return options
@@ -0,0 +1,51 @@
+"""
+Authentication principals, API key scopes and authorization of API methods.
+"""
+
+from app.auth.scopes import (
+    SCOPES,
+    NODE_SCOPES,
+    ROLE_SCOPES,
+    METHOD_PERMISSIONS,
+    grants,
+    required_permission,
+    validate_scopes,
+)
+from app.auth.authorization import (
+    PERMISSION_DENIED_CODE,
+    ANONYMOUS,
+    ADMIN_KEY,
+    API_KEY,
+    USER,
+    Principal,
+    PermissionDeniedError,
+    authorize,
+    check_access,
+    current_principal,
+    node_type_restriction,
+    set_principal,
+    visible_relationships,
+)
+
+__all__ = [
+    "SCOPES",
+    "NODE_SCOPES",
+    "ROLE_SCOPES",
+    "METHOD_PERMISSIONS",
+    "grants",
+    "required_permission",
+    "validate_scopes",
+    "PERMISSION_DENIED_CODE",
+    "ANONYMOUS",
+    "ADMIN_KEY",
+    "API_KEY",
+    "USER",
+    "Principal",
+    "PermissionDeniedError",
+    "authorize",
+    "check_access",
+    "current_principal",
+    "node_type_restriction",
+    "set_principal",
+    "visible_relationships",
+]
@@ -0,0 +1,329 @@
+"""
+Authorization of JSON-RPC methods and streaming endpoints.
+
+The server authenticates each request and sets its Principal (see
+app/jsonrpc/server.py). Every JSON-RPC method is wrapped by authorize(), which
+checks the principal's access before calling it:
+
+- anonymous callers (when AUTH_REQUIRED is off) and the admin key have full access
+- API keys only reach their own tenant, only with a scope granting the
+  method's permission (see app/auth/scopes.py), and, if restricted to node
+  types, only nodes, relationships and node types of those types; listed
+  relationships are filtered with visible_relationships
+- users with a login token only reach the tenants they are members of, with
+  the scopes of their role in each (ROLE_SCOPES)
+
+Denied calls fail with error code PERMISSION_DENIED_CODE.
+"""
+
+import functools
+import inspect
+from contextvars import ContextVar
+from dataclasses import dataclass, field
+from typing import Any, Awaitable, Callable, Dict, List, Optional
+
+from jsonrpcserver import Error
+
+from app.auth.scopes import CONTROL, PUBLIC, ROLE_SCOPES, grants, required_permission
+from app.repository import ApiKey, FailedPreconditionError, NotFoundError, Relationship
+from app.repository.actor import set_actor
+
+PERMISSION_DENIED_CODE = -32004
+
+ANONYMOUS = "anonymous"
+ADMIN_KEY = "admin"
+API_KEY = "api_key"
+USER = "user"
+
+
+@dataclass
+class Principal:
+    """The authenticated caller of a request."""
+    kind: str = ANONYMOUS  # anonymous | admin | api_key | user
+    api_key: Optional[ApiKey] = None
+    # Logged-in user and their role in each tenant they are a member of, from their token
+    user_id: str = ""
+    roles: Dict[str, str] = field(default_factory=dict)
+
+    @property
+    def actor(self) -> str:
+        """The actor node revisions record for changes by this principal (see app/repository/actor.py)."""
+        if self.kind == API_KEY and self.api_key:
+            return f"{API_KEY}:{self.api_key.id}"
+        if self.kind == USER:
+            return f"{USER}:{self.user_id}"
+        return self.kind
+
+
+class PermissionDeniedError(Exception):
+    """The caller may not perform the request."""
+    reason = "PERMISSION_DENIED"
+
+
+_principal: ContextVar[Principal] = ContextVar("flexdb_principal", default=Principal())
+
+
+def current_principal() -> Principal:
+    """Return the principal of the current request."""
+    return _principal.get()
+
+
+def set_principal(principal: Principal) -> None:
+    """Set the principal of the current request, and the actor its changes are attributed to."""
+    _principal.set(principal)
+    set_actor(principal.actor)
+
+
+async def check_access(principal: Principal, method: str, params: Dict[str, Any]) -> None:
+    """Raise PermissionDeniedError unless the principal may call method with params."""
+    if principal.kind not in (API_KEY, USER):
+        return
+    permission = required_permission(method)
+    if permission == PUBLIC:
+        return
+    if permission == CONTROL:
+        raise PermissionDeniedError(f"{method} requires the admin key")
+    if principal.kind == USER:
+        _check_role(principal, method, permission, params)
+        return
+
+    key = principal.api_key
+    if params.get("tenant_id") != key.tenant_id:
+        raise PermissionDeniedError("API key does not belong to this tenant")
+    if not grants(key.scopes, permission):
+        raise PermissionDeniedError(f"API key lacks a scope granting {permission}, required by {method}")
+    if key.node_type_ids:
+        await _check_node_types(method, params, key)
+
+
+def _check_role(principal: Principal, method: str, permission: str, params: Dict[str, Any]) -> None:
+    role = principal.roles.get(params.get("tenant_id"))
+    if role is None:
+        raise PermissionDeniedError("user is not a member of this tenant")
+    if not grants(ROLE_SCOPES.get(role, []), permission):
+        raise PermissionDeniedError(f"role {role} does not grant {permission}, required by {method}")
+
+
+async def _check_node_types(method: str, params: Dict[str, Any], key: ApiKey) -> None:
+    resolve = _NODE_TYPE_RESOLVERS.get(method)
+    if resolve is None:
+        raise PermissionDeniedError(f"{method} is not available to API keys restricted to node types")
+
+    for node_type_id in await resolve(key.tenant_id, params):
+        if node_type_id not in key.node_type_ids:
+            raise PermissionDeniedError(f"API key may not access node type {node_type_id}")
+
+
+def node_type_restriction() -> List[str]:
+    """Return the node types the current principal is restricted to, empty if it isn't."""
+    principal = current_principal()
+    if principal.kind != API_KEY or not principal.api_key:
+        return []
+    return principal.api_key.node_type_ids
+
+
+async def visible_relationships(tenant_id: str, relationships: List[Relationship]) -> List[Relationship]:
+    """
+    Return the relationships the current principal may see: for API keys
+    restricted to node types, those whose nodes are both of those types, as
+    listing a node's edges would otherwise reveal the nodes they link to.
+    """
+    node_type_ids = node_type_restriction()
+    if not node_type_ids or not relationships:
+        return relationships
+    node_ids = list({id for r in relationships for id in (r.source_node_id, r.target_node_id)})
+    nodes, _ = await (await _services(tenant_id))["node"].batch_get(node_ids)
+    visible = {node.id for node in nodes if node.node_type_id in node_type_ids}
+    return [r for r in relationships if r.source_node_id in visible and r.target_node_id in visible]
+
+
+def authorize(methods: Dict[str, Callable], prefix: str = "") -> Dict[str, Callable]:
+    """
+    Wrap JSON-RPC methods so every call is authorized first.
+
+    prefix is stripped from method names to find their permission, e.g. for
+    the analytics methods.
+    """
+    return {name: _authorized(name[len(prefix):] if prefix else name, func) for name, func in methods.items()}
+
+
+def _authorized(method: str, func: Callable) -> Callable:
+    signature = inspect.signature(func)
+
+    # functools.wraps keeps the signature visible to jsonrpcserver's params validation
+    @functools.wraps(func)
+    async def wrapper(*args, **kwargs):
+        principal = current_principal()
+        if principal.kind in (API_KEY, USER):
+            params = signature.bind(*args, **kwargs).arguments
+            try:
+                await check_access(principal, method, params)
+            except PermissionDeniedError as e:
+                return Error(PERMISSION_DENIED_CODE, str(e))
+        return await func(*args, **kwargs)
+
+    return wrapper
+
+
+# Node types accessed by a call, for keys restricted to node types. Node and
+# relationship IDs that don't exist resolve to nothing, so the method itself
+# reports them as not found.
+
+async def _services(tenant_id: str) -> dict:
+    # Imported here: the services import app.auth for scope validation
+    from app.api.dependencies import resolve_tenant_services
+    return await resolve_tenant_services(tenant_id)
+
+
+async def _node_type_of(tenant_id: str, node_id: str) -> List[str]:
+    try:
+        node = await (await _services(tenant_id))["node"].get_by_id(node_id)
+    except (NotFoundError, FailedPreconditionError, ValueError):
+        return []
+    return [node.node_type_id]
+
+
+def _required(params: Dict[str, Any], name: str) -> str:
+    value = params.get(name)
+    if not value:
+        raise PermissionDeniedError(f"{name} is required for API keys restricted to node types")
+    return value
+
+
+async def _node_type_param(tenant_id: str, params: Dict[str, Any]) -> List[str]:
+    return [_required(params, "node_type_id")]
+
+
+async def _node_type_id(tenant_id: str, params: Dict[str, Any]) -> List[str]:
+    return [_required(params, "id")]
+
+
+async def _node(tenant_id: str, params: Dict[str, Any]) -> List[str]:
+    return await _node_type_of(tenant_id, params.get("id") or "")
+
+
+async def _node_type_ids(tenant_id: str, params: Dict[str, Any]) -> List[str]:
+    ids = params.get("ids")
+    if not ids or not isinstance(ids, list):
+        raise PermissionDeniedError("ids is required for API keys restricted to node types")
+    return ids
+
+
+async def _nodes(tenant_id: str, params: Dict[str, Any]) -> List[str]:
+    try:
+        nodes, _ = await (await _services(tenant_id))["node"].batch_get(params.get("ids"))
+    except (NotFoundError, FailedPreconditionError, ValueError):
+        return []
+    return [node.node_type_id for node in nodes]
+
+
+async def _cloned_node(tenant_id: str, params: Dict[str, Any]) -> List[str]:
+    # Copied relationships would link to nodes of other types
+    if params.get("include_relationships"):
+        raise PermissionDeniedError("include_relationships is not available to API keys restricted to node types")
+    return await _node(tenant_id, params)
+
+
+async def _node_revisions(tenant_id: str, params: Dict[str, Any]) -> List[str]:
+    # Also covers deleted nodes, whose history remains readable
+    try:
+        revisions, _ = await (await _services(tenant_id))["node"].list_revisions(params.get("id") or "", 1, "")
+    except (NotFoundError, FailedPreconditionError, ValueError):
+        return []
+    return [revisions[0].node_type_id]
+
+
+async def _attachment_node(tenant_id: str, params: Dict[str, Any]) -> List[str]:
+    return await _node_type_of(tenant_id, _required(params, "node_id"))
+
+
+async def _attachment(tenant_id: str, params: Dict[str, Any]) -> List[str]:
+    try:
+        attachment = await (await _services(tenant_id))["attachments"].get(params.get("id") or "")
+    except (NotFoundError, FailedPreconditionError, ValueError):
+        return []
+    return await _node_type_of(tenant_id, attachment.node_id)
+
+
+async def _locked_node(tenant_id: str, params: Dict[str, Any]) -> List[str]:
+    return await _node_type_of(tenant_id, _required(params, "node_id"))
+
+
+async def _relationship_nodes(tenant_id: str, params: Dict[str, Any]) -> List[str]:
+    source = params.get("source_node_id") or ""
+    target = params.get("target_node_id") or ""
+    if not source and not target:
+        raise PermissionDeniedError(
+            "source_node_id or target_node_id is required for API keys restricted to node types"
+        )
+    node_type_ids = []
+    for node_id in (source, target):
+        if node_id:
+            node_type_ids += await _node_type_of(tenant_id, node_id)
+    return node_type_ids
+
+
+async def _listed_relationship_nodes(tenant_id: str, params: Dict[str, Any]) -> List[str]:
+    node_type_ids = []
+    listed = False
+    for side in ("source", "target"):
+        ids = params.get(f"{side}_node_ids") or []
+        if not isinstance(ids, list):
+            raise PermissionDeniedError(f"{side}_node_ids must be a list")
+        ids = ([params[f"{side}_node_id"]] if params.get(f"{side}_node_id") else []) + ids
+        if ids:
+            listed = True
+            try:
+                nodes, _ = await (await _services(tenant_id))["node"].batch_get(ids)
+            except (NotFoundError, FailedPreconditionError, ValueError):
+                continue
+            node_type_ids += [node.node_type_id for node in nodes]
+    if not listed:
+        raise PermissionDeniedError(
+            "source_node_id(s) or target_node_id(s) is required for API keys restricted to node types"
+        )
+    return node_type_ids
+
+
+async def _relationship(tenant_id: str, params: Dict[str, Any]) -> List[str]:
+    try:
+        rel = await (await _services(tenant_id))["relationship"].get_by_id(params.get("id") or "")
+    except (NotFoundError, FailedPreconditionError, ValueError):
+        return []
+    return await _node_type_of(tenant_id, rel.source_node_id) + await _node_type_of(tenant_id, rel.target_node_id)
+
+
+_NODE_TYPE_RESOLVERS: Dict[str, Callable[[str, Dict[str, Any]], Awaitable[List[str]]]] = {
+    "get_node_type": _node_type_id,
+    "batch_get_node_types": _node_type_ids,
+    "create_node": _node_type_param,
+    "list_nodes": _node_type_param,
+    "count_nodes": _node_type_param,
+    "aggregate_nodes": _node_type_param,
+    "stream.nodes": _node_type_param,
+    "get_node": _node,
+    "batch_get_nodes": _nodes,
+    "update_node": _node,
+    "delete_node": _node,
+    "delete_nodes": _node_type_param,
+    "clone_node": _cloned_node,
+    "list_node_revisions": _node_revisions,
+    "get_node_at": _node_revisions,
+    "diff_node_revisions": _node_revisions,
+    "get_node_field_history": _node_revisions,
+    "list_email_attachments": _attachment_node,
+    "list_attachments": _attachment_node,
+    "stream.upload_attachment": _attachment_node,
+    "get_attachment": _attachment,
+    "stream.download_attachment": _attachment,
+    "delete_attachment": _attachment,
+    "acquire_node_lock": _locked_node,
+    "get_node_lock": _locked_node,
+    "release_node_lock": _locked_node,
+    "create_relationship": _relationship_nodes,
+    "list_relationships": _listed_relationship_nodes,
+    "get_relationship": _relationship,
+    "update_relationship": _relationship,
+    "delete_relationship": _relationship,
+    "delete_relationships": _relationship_nodes,
+}
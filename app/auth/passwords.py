@@ -0,0 +1,48 @@
+"""
+Password hashing of user credentials with argon2id.
+
+Hashes are PHC strings ($argon2id$v=19$m=...,t=...,p=...$salt$hash) carrying
+their own salt and cost parameters, so the parameters can be raised later:
+hashes made with older parameters still verify, and needs_rehash tells when to
+replace them after a successful login.
+"""
+
+from argon2 import PasswordHasher, Type
+from argon2.exceptions import InvalidHashError, VerificationError
+
+from app.repository.errors import ValidationError
+
+# Longest accepted password; hashing cost doesn't grow with it, but requests shouldn't either
+MAX_PASSWORD_LENGTH = 1024
+
+# RFC 9106's second recommended option, for memory-constrained environments
+_hasher = PasswordHasher(time_cost=3, memory_cost=64 * 1024, parallelism=4, type=Type.ID)
+
+# Verified when a login names an unknown user, so it takes as long as one with a wrong password
+_DUMMY_HASH = _hasher.hash("flexdb-dummy-password")
+
+
+def validate_password(password: str, min_length: int) -> None:
+    """Raise ValueError unless password is long enough and not too long."""
+    if len(password) < min_length:
+        raise ValidationError("password", f"must be at least {min_length} characters")
+    if len(password) > MAX_PASSWORD_LENGTH:
+        raise ValidationError("password", f"must be at most {MAX_PASSWORD_LENGTH} characters")
+
+
+def hash_password(password: str) -> str:
+    """Hash a password with a random salt."""
+    return _hasher.hash(password)
+
+
+def verify_password(password_hash: str, password: str) -> bool:
+    """Return whether password matches the hash; an empty hash matches nothing."""
+    try:
+        return _hasher.verify(password_hash or _DUMMY_HASH, password) and bool(password_hash)
+    except (VerificationError, InvalidHashError):
+        return False
+
+
+def needs_rehash(password_hash: str) -> bool:
+    """Return whether a hash was made with other parameters than new hashes."""
+    return _hasher.check_needs_rehash(password_hash)
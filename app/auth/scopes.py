@@ -0,0 +1,150 @@
+"""
+API key scopes and the permissions JSON-RPC methods require.
+
+An API key belongs to one tenant and carries one or more scopes:
+
+    admin        everything in the tenant, including API keys, webhooks,
+                 intake forms, email inboxes and node type changes
+    read         read-only access to everything in the tenant except secrets
+                 (intake form and inbox tokens, API keys)
+    nodes:read   read nodes and relationships, and the node types' schemas
+    nodes:write  nodes:read plus creating, updating and deleting nodes and
+                 relationships
+
+Keys with only nodes:read and nodes:write scopes can be restricted to specific
+node types. Tenant and user management (control methods) is reserved for the
+admin key configured with AUTH_ADMIN_KEY.
+
+Logged-in users (see app/auth/tokens.py) reach the tenants they are members
+of, with the scopes of their role in each:
+
+    owner, admin   admin
+    member         nodes:write
+    viewer         read
+
+Other roles grant nothing.
+"""
+
+from typing import Dict, List, Set
+
+from app.repository.errors import ValidationError
+
+ADMIN = "admin"
+READ = "read"
+NODES_READ = "nodes:read"
+NODES_WRITE = "nodes:write"
+
+SCOPES = (ADMIN, READ, NODES_READ, NODES_WRITE)
+# Scopes of keys that may be restricted to specific node types
+NODE_SCOPES = (NODES_READ, NODES_WRITE)
+
+# Scopes of the tenant roles of users
+ROLE_SCOPES: Dict[str, List[str]] = {
+    "owner": [ADMIN],
+    "admin": [ADMIN],
+    "member": [NODES_WRITE],
+    "viewer": [READ],
+}
+
+# Permissions and the scopes granting them
+CONTROL = "control"
+PUBLIC = "public"
+PERMISSION_SCOPES: Dict[str, Set[str]] = {
+    "schema:read": {ADMIN, READ, NODES_READ, NODES_WRITE},
+    "schema:write": {ADMIN},
+    "nodes:read": {ADMIN, READ, NODES_READ, NODES_WRITE},
+    "nodes:write": {ADMIN, NODES_WRITE},
+    "config:read": {ADMIN, READ},
+    "admin": {ADMIN},
+}
+
+
+def _methods(permission: str, *names: str) -> Dict[str, str]:
+    return {name: permission for name in names}
+
+
+# Permission required by every JSON-RPC method and streaming endpoint. Methods
+# missing here are only available to the admin key (see required_permission).
+METHOD_PERMISSIONS: Dict[str, str] = {
+    **_methods(
+        CONTROL,
+        "create_tenant", "get_tenant", "update_tenant", "delete_tenant", "list_tenants",
+        "get_tenant_by_slug", "rename_tenant_slug", "list_tenant_slug_changes",
+        "get_tenant_deletion_status",
+        "suspend_tenant", "archive_tenant", "reactivate_tenant", "get_tenant_quota", "set_tenant_quota",
+        "list_tenant_templates", "get_tenant_template", "bootstrap_tenant",
+        "create_user", "get_user", "update_user", "delete_user", "list_users",
+        "add_user_to_tenant", "remove_user_from_tenant", "list_tenant_users", "set_user_password",
+        "get_cluster_status", "explain_query",
+    ),
+    # batch authorizes each of its requests on its own (see app/jsonrpc/batch.py)
+    **_methods(PUBLIC, "rpc_discover", "batch", "list_event_schemas", "get_event_schema", "login"),
+    **_methods(
+        "schema:read",
+        "get_node_type", "batch_get_node_types", "list_node_types", "describe_tenant_schema", "list_node_type_indexes",
+    ),
+    **_methods(
+        "schema:write", "create_node_type", "update_node_type", "delete_node_type", "refresh_bi_views",
+        "create_node_type_index", "drop_node_type_index",
+    ),
+    **_methods(
+        "nodes:read",
+        "get_node", "batch_get_nodes", "list_nodes", "count_nodes", "aggregate_nodes",
+        "get_relationship", "list_relationships",
+        "list_node_revisions", "get_node_at", "diff_node_revisions", "get_node_field_history",
+        "pull_events", "ack_events", "nack_events", "list_changes", "get_change_token",
+        "list_email_attachments", "get_email_attachment", "stream.nodes", "stream.export",
+        "list_attachments", "get_attachment", "stream.download_attachment", "get_node_lock",
+    ),
+    **_methods(
+        "nodes:write",
+        "create_node", "update_node", "delete_node", "delete_nodes", "clone_node", "clone_subgraph",
+        "create_relationship", "update_relationship", "delete_relationship", "delete_relationships",
+        "stream.upload_attachment", "delete_attachment", "acquire_node_lock", "release_node_lock",
+    ),
+    **_methods(
+        "config:read",
+        "get_webhook_endpoint", "list_webhook_endpoints", "get_webhook_delivery", "list_webhook_deliveries",
+        "get_subscription", "list_subscriptions",
+        "validate_existing_nodes", "get_node_migration", "list_node_migrations",
+        "get_retention_policy", "list_retention_policies", "preview_retention",
+        "get_operation", "list_operations", "list_dead_letters", "get_dead_letter",
+    ),
+    **_methods(
+        "admin",
+        "create_webhook_endpoint", "update_webhook_endpoint", "delete_webhook_endpoint", "send_test_webhook_event",
+        "create_subscription", "update_subscription", "delete_subscription",
+        "create_intake_form", "get_intake_form", "update_intake_form", "delete_intake_form", "list_intake_forms",
+        "create_email_inbox", "get_email_inbox", "update_email_inbox", "delete_email_inbox", "list_email_inboxes",
+        "start_node_migration", "cancel_node_migration", "cancel_operation",
+        "set_retention_policy", "delete_retention_policy",
+        "replay_dead_letter", "replay_dead_letters", "discard_dead_letter",
+        "create_api_key", "get_api_key", "list_api_keys", "revoke_api_key", "rotate_api_key",
+        "list_audit_events",
+        "stream.import", "export_tenant_to_storage",
+    ),
+}
+
+
+def required_permission(method: str) -> str:
+    """Return the permission a method requires; unknown methods require the admin key."""
+    return METHOD_PERMISSIONS.get(method, CONTROL)
+
+
+def grants(scopes: List[str], permission: str) -> bool:
+    """Return whether any of the scopes grants a tenant permission."""
+    allowed = PERMISSION_SCOPES.get(permission, set())
+    return any(scope in allowed for scope in scopes)
+
+
+def validate_scopes(scopes: List[str], node_type_ids: List[str]) -> None:
+    """Validate the scopes and node type restriction of a new API key."""
+    if not scopes:
+        raise ValidationError("scopes", "is required")
+    for scope in scopes:
+        if scope not in SCOPES:
+            raise ValueError(f"unknown scope: {scope} (expected one of {', '.join(SCOPES)})")
+    if node_type_ids and any(scope not in NODE_SCOPES for scope in scopes):
+        raise ValidationError("node_type_ids", f"can only restrict keys with {' and '.join(NODE_SCOPES)} scopes")
+    if any(not node_type_id for node_type_id in node_type_ids):
+        raise ValidationError("node_type_ids", "must not contain empty IDs")
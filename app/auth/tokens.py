@@ -0,0 +1,95 @@
+"""
+Signed access tokens of logged-in users.
+
+login returns a JSON Web Token signed with HS256 (HMAC-SHA256) and the
+AUTH_JWT_SECRET shared by every server instance. Its claims:
+
+    iss       AUTH_JWT_ISSUER
+    sub       the user ID
+    email     the user's email address
+    iat, exp  issue and expiry time (Unix seconds), AUTH_JWT_TTL apart
+    tenants   the user's active tenant memberships: [{"tenant_id", "role"}]
+
+Clients send it like an API key ("Authorization: Bearer <token>") and the
+server verifies the signature, issuer and expiry before trusting the claims.
+Memberships are read at login, so role changes apply to tokens issued after
+them; keep AUTH_JWT_TTL short.
+"""
+
+import base64
+import hashlib
+import hmac
+import json
+import time
+from typing import Any, Dict, List, Optional, Tuple
+
+from app.repository import TenantUser, User
+
+ALGORITHM = "HS256"
+
+# Seconds of clock difference between instances tolerated when checking expiry
+LEEWAY = 30
+
+
+class InvalidTokenError(Exception):
+    """A token is malformed, not signed with the secret, or expired."""
+
+
+def _b64encode(data: bytes) -> str:
+    return base64.urlsafe_b64encode(data).rstrip(b"=").decode("ascii")
+
+
+def _b64decode(data: str) -> bytes:
+    return base64.urlsafe_b64decode(data + "=" * (-len(data) % 4))
+
+
+def looks_like_token(credential: str) -> bool:
+    """Return whether a presented credential is a JWT rather than an API key."""
+    return credential.startswith("eyJ") and credential.count(".") == 2
+
+
+class TokenSigner:
+    """Issues and verifies the access tokens of users."""
+
+    def __init__(self, secret: str, ttl: float, issuer: str):
+        self.secret = secret.encode("utf-8")
+        self.ttl = ttl
+        self.issuer = issuer
+
+    def issue(self, user: User, memberships: List[TenantUser], now: Optional[float] = None) -> Tuple[str, int]:
+        """Return a token for the user with their memberships, and its expiry time."""
+        issued_at = int(now if now is not None else time.time())
+        expires_at = issued_at + int(self.ttl)
+        claims = {
+            "iss": self.issuer,
+            "sub": user.id,
+            "email": user.email,
+            "iat": issued_at,
+            "exp": expires_at,
+            "tenants": [{"tenant_id": m.tenant_id, "role": m.role} for m in memberships],
+        }
+        header = _b64encode(json.dumps({"alg": ALGORITHM, "typ": "JWT"}, separators=(",", ":")).encode())
+        payload = _b64encode(json.dumps(claims, separators=(",", ":")).encode())
+        return f"{header}.{payload}.{self._sign(header, payload)}", expires_at
+
+    def verify(self, token: str, now: Optional[float] = None) -> Dict[str, Any]:
+        """Return the claims of a token; raises InvalidTokenError if it can't be trusted."""
+        try:
+            header, payload, signature = token.split(".")
+            algorithm = json.loads(_b64decode(header)).get("alg")
+            claims = json.loads(_b64decode(payload))
+        except (ValueError, AttributeError):
+            raise InvalidTokenError("malformed token") from None
+        # The algorithm is fixed: "none" or an asymmetric one named by the token are never accepted
+        expected = self._sign(header, payload).encode("ascii")
+        if algorithm != ALGORITHM or not hmac.compare_digest(signature.encode("utf-8"), expected):
+            raise InvalidTokenError("invalid token signature")
+        if not isinstance(claims, dict) or claims.get("iss") != self.issuer or not claims.get("sub"):
+            raise InvalidTokenError("token not issued by this server")
+        current = now if now is not None else time.time()
+        if not isinstance(claims.get("exp"), int) or claims["exp"] + LEEWAY < current:
+            raise InvalidTokenError("token expired")
+        return claims
+
+    def _sign(self, header: str, payload: str) -> str:
+        return _b64encode(hmac.new(self.secret, f"{header}.{payload}".encode("utf-8"), hashlib.sha256).digest())
@@ -0,0 +1,12 @@
+"""
+Blob storage of node attachments.
+"""
+
+from app.blobs.store import BlobStore, FilesystemBlobStore, S3BlobStore, blob_store_from_config
+
+__all__ = [
+    "BlobStore",
+    "FilesystemBlobStore",
+    "S3BlobStore",
+    "blob_store_from_config",
+]
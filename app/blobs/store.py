@@ -0,0 +1,176 @@
+"""
+Blob storage of node attachment bytes.
+
+A BlobStore keeps blobs under keys, streamed in and out in chunks so large
+attachments don't have to fit in memory: FilesystemBlobStore below a local
+directory, and S3BlobStore in S3, in Google Cloud Storage through its
+S3-compatible XML API, or in another S3-compatible store such as MinIO. Other
+stores can implement the same three methods.
+"""
+
+import asyncio
+import hashlib
+import os
+from typing import AsyncIterator
+from urllib.parse import quote
+
+import httpx
+
+from app.config import AttachmentConfig
+from app.lake.storage import GCS_ENDPOINT, sign_request, split_url
+from app.repository.errors import NotFoundError
+
+# Bytes read from a blob at a time
+CHUNK_SIZE = 64 * 1024
+
+
+class BlobStore:
+    """Writes, reads and deletes blobs by key."""
+
+    async def write(self, key: str, chunks: AsyncIterator[bytes], content_type: str) -> None:
+        """Store the chunks as the blob under key, replacing any existing blob."""
+        raise NotImplementedError
+
+    def read(self, key: str) -> AsyncIterator[bytes]:
+        """Yield the chunks of the blob under key; raises NotFoundError if there is none."""
+        raise NotImplementedError
+
+    async def delete(self, key: str) -> None:
+        """Remove the blob under key, if there is one."""
+        raise NotImplementedError
+
+    async def close(self) -> None:
+        """Release resources held by the store."""
+
+
+class FilesystemBlobStore(BlobStore):
+    """Stores blobs as files below a root directory."""
+
+    def __init__(self, root: str):
+        self.root = root
+
+    async def write(self, key: str, chunks: AsyncIterator[bytes], content_type: str) -> None:
+        """Write the file, replacing an existing one only once it is complete."""
+        path = os.path.join(self.root, key)
+        await asyncio.to_thread(os.makedirs, os.path.dirname(path), exist_ok=True)
+        tmp = path + ".tmp"
+        f = await asyncio.to_thread(open, tmp, "wb")
+        try:
+            async for chunk in chunks:
+                await asyncio.to_thread(f.write, chunk)
+        except BaseException:
+            f.close()
+            await asyncio.to_thread(os.remove, tmp)
+            raise
+        f.close()
+        await asyncio.to_thread(os.replace, tmp, path)
+
+    async def read(self, key: str) -> AsyncIterator[bytes]:
+        """Read the file in chunks."""
+        try:
+            f = await asyncio.to_thread(open, os.path.join(self.root, key), "rb")
+        except FileNotFoundError:
+            raise NotFoundError(f"blob not found: {key}") from None
+        try:
+            while chunk := await asyncio.to_thread(f.read, CHUNK_SIZE):
+                yield chunk
+        finally:
+            f.close()
+
+    async def delete(self, key: str) -> None:
+        """Remove the file."""
+        try:
+            await asyncio.to_thread(os.remove, os.path.join(self.root, key))
+        except FileNotFoundError:
+            pass
+
+
+class S3BlobStore(BlobStore):
+    """Stores blobs in an S3-compatible bucket."""
+
+    def __init__(
+        self,
+        bucket: str,
+        endpoint: str,
+        region: str,
+        access_key_id: str,
+        secret_access_key: str,
+        client: httpx.AsyncClient
+    ):
+        self.bucket = bucket
+        self.endpoint = endpoint.rstrip("/")
+        self.region = region
+        self.access_key_id = access_key_id
+        self.secret_access_key = secret_access_key
+        self._client = client
+
+    async def write(self, key: str, chunks: AsyncIterator[bytes], content_type: str) -> None:
+        """Upload the blob with a signed PUT request."""
+        # S3 needs the length and hash of a body before it is sent, so the
+        # chunks are collected first (AttachmentConfig.max_bytes bounds them)
+        body = bytearray()
+        async for chunk in chunks:
+            body += chunk
+        url = self._request_url(key)
+        headers = self._sign("PUT", url, {"Content-Type": content_type}, hashlib.sha256(body).hexdigest())
+        response = await self._client.put(url, content=bytes(body), headers=headers)
+        if response.status_code // 100 != 2:
+            raise RuntimeError(f"upload of {key} failed with status {response.status_code}: {response.text[:200]}")
+
+    async def read(self, key: str) -> AsyncIterator[bytes]:
+        """Download the blob with a signed GET request, as it arrives."""
+        url = self._request_url(key)
+        headers = self._sign("GET", url, {}, hashlib.sha256(b"").hexdigest())
+        async with self._client.stream("GET", url, headers=headers) as response:
+            if response.status_code == 404:
+                raise NotFoundError(f"blob not found: {key}")
+            if response.status_code // 100 != 2:
+                await response.aread()
+                raise RuntimeError(
+                    f"download of {key} failed with status {response.status_code}: {response.text[:200]}"
+                )
+            async for chunk in response.aiter_bytes(CHUNK_SIZE):
+                yield chunk
+
+    async def delete(self, key: str) -> None:
+        """Remove the blob with a signed DELETE request."""
+        url = self._request_url(key)
+        headers = self._sign("DELETE", url, {}, hashlib.sha256(b"").hexdigest())
+        response = await self._client.delete(url, headers=headers)
+        if response.status_code // 100 != 2 and response.status_code != 404:
+            raise RuntimeError(f"delete of {key} failed with status {response.status_code}: {response.text[:200]}")
+
+    async def close(self) -> None:
+        """Close the HTTP client."""
+        await self._client.aclose()
+
+    def _sign(self, method: str, url: str, headers: dict, payload_hash: str) -> dict:
+        return sign_request(
+            method, url, headers, payload_hash, self.access_key_id, self.secret_access_key, self.region
+        )
+
+    def _request_url(self, key: str) -> str:
+        if self.endpoint:
+            # Path-style addressing works with GCS, MinIO and other S3-compatible stores
+            return f"{self.endpoint}/{self.bucket}/{quote(key)}"
+        return f"https://{self.bucket}.s3.{self.region}.amazonaws.com/{quote(key)}"
+
+
+def blob_store_from_config(cfg: AttachmentConfig) -> tuple:
+    """Create the blob store for the configured URL; returns (store, key prefix)."""
+    scheme, bucket, prefix = split_url(cfg.url)
+    if scheme == "file":
+        return FilesystemBlobStore(prefix), ""
+
+    endpoint = cfg.endpoint
+    region = cfg.region
+    if scheme == "gs" and not endpoint:
+        endpoint = GCS_ENDPOINT
+        region = "auto"
+    if not cfg.access_key_id or not cfg.secret_access_key:
+        raise ValueError("ATTACHMENTS_ACCESS_KEY_ID and ATTACHMENTS_SECRET_ACCESS_KEY are required")
+
+    store = S3BlobStore(
+        bucket, endpoint, region, cfg.access_key_id, cfg.secret_access_key, httpx.AsyncClient(timeout=cfg.timeout)
+    )
+    return store, prefix
@@ -0,0 +1,39 @@
+"""
+Coordination between the server instances sharing a control database.
+"""
+
+from app.cluster.capabilities import (
+    FEATURES,
+    configure_cluster,
+    default_instance_id,
+    feature_enabled,
+    feature_version,
+    negotiate,
+    require_feature,
+)
+from app.cluster.membership import (
+    API_KEY_POLICY,
+    AUDIT_EXPORT,
+    BACKUP_VERIFY,
+    LAKE_EXPORT,
+    RETENTION,
+    ROLES,
+    ClusterMembership,
+)
+
+__all__ = [
+    "FEATURES",
+    "API_KEY_POLICY",
+    "AUDIT_EXPORT",
+    "BACKUP_VERIFY",
+    "LAKE_EXPORT",
+    "RETENTION",
+    "ROLES",
+    "ClusterMembership",
+    "configure_cluster",
+    "default_instance_id",
+    "feature_enabled",
+    "feature_version",
+    "negotiate",
+    "require_feature",
+]
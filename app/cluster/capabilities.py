@@ -0,0 +1,93 @@
+"""
+Feature negotiation between server instances, for rolling upgrades.
+
+During a rolling upgrade, servers of the old and the new release run side by
+side. A feature that writes data older releases don't understand, such as a
+tenant status they don't enforce, must not be used until every instance
+supports it. Each instance advertises the versions of the features it
+supports, FEATURES, in its server_instances row, refreshed by a heartbeat
+every CLUSTER_HEARTBEAT_INTERVAL seconds (see app/cluster/membership.py). The version of a feature usable
+cluster-wide is the lowest one advertised by the instances with a heartbeat in
+the last CLUSTER_INSTANCE_TTL seconds (0 if one of them lacks the feature):
+
+    if feature_enabled("tenant_lifecycle"):
+        ...  # write the new columns
+
+require_feature() raises FailedPreconditionError instead, for calls that can't
+fall back to the old behavior. To add a feature, name it in FEATURES; to change
+what a feature writes, bump its version.
+
+A feature becomes usable once the last old instance stopped and its heartbeat
+expired, and unusable again if an instance of an older release joins, such as
+after rolling back; data written meanwhile is kept.
+"""
+
+import os
+import socket
+from typing import TYPE_CHECKING, Dict, Iterable, Optional
+
+from app.repository import FailedPreconditionError, ServerInstance
+
+if TYPE_CHECKING:
+    from app.cluster.membership import ClusterMembership
+
+# Versions of the features this release supports
+FEATURES: Dict[str, int] = {
+    # suspended and archived tenant statuses (suspend_tenant, archive_tenant)
+    "tenant_lifecycle": 1,
+    # deleting tenant status (delete_tenant deleting in the background)
+    "tenant_deletion": 1,
+}
+
+
+def default_instance_id() -> str:
+    """Return <hostname>-<pid>, unique among the instances of a deployment."""
+    return f"{socket.gethostname()}-{os.getpid()}"
+
+
+def negotiate(instances: Iterable[ServerInstance]) -> Dict[str, int]:
+    """Return the version of each feature supported by all instances, omitting those some lack."""
+    negotiated: Optional[Dict[str, int]] = None
+    for instance in instances:
+        if negotiated is None:
+            negotiated = dict(instance.features)
+            continue
+        negotiated = {
+            name: min(version, instance.features[name])
+            for name, version in negotiated.items()
+            if name in instance.features
+        }
+    return {name: version for name, version in (negotiated or {}).items() if version > 0}
+
+
+def describe_features(features: Dict[str, int]) -> str:
+    """Format feature versions for logs, e.g. "tenant_lifecycle v1"."""
+    return ", ".join(f"{name} v{version}" for name, version in sorted(features.items())) or "none"
+
+
+_membership: Optional["ClusterMembership"] = None
+
+
+def configure_cluster(membership: Optional["ClusterMembership"]) -> None:
+    """Set the membership feature checks consult; without one, FEATURES are all usable."""
+    global _membership
+    _membership = membership
+
+
+def feature_version(name: str) -> int:
+    """Return the version of a feature usable cluster-wide, 0 if it is not."""
+    features = _membership.features if _membership else FEATURES
+    return features.get(name, 0)
+
+
+def feature_enabled(name: str, version: int = 1) -> bool:
+    """Return whether every instance supports at least the given version of a feature."""
+    return feature_version(name) >= version
+
+
+def require_feature(name: str, version: int = 1) -> None:
+    """Raise FailedPreconditionError unless every instance supports the feature."""
+    if not feature_enabled(name, version):
+        raise FailedPreconditionError(
+            f"{name} is not supported by every server instance yet; retry once the rolling upgrade completed"
+        )
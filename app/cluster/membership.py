@@ -0,0 +1,148 @@
+"""
+Server instance registration, heartbeats and leader roles.
+
+Every server instance registers in the control database's server_instances
+table at startup and sends a heartbeat every CLUSTER_HEARTBEAT_INTERVAL
+seconds, which also negotiates the features usable cluster-wide (see
+app/cluster/capabilities.py). Instances unregister on shutdown; one without a
+heartbeat for CLUSTER_INSTANCE_TTL seconds is considered gone, and is removed
+after a day.
+
+Background jobs that must not run on several instances at once are leader
+roles, ROLES. Each heartbeat takes or renews a lease of CLUSTER_INSTANCE_TTL
+seconds in cluster_leases on every role the instance runs a job for; a role
+stays with its holder while it keeps renewing, and moves to another instance
+once the lease expired. Jobs check leads(role) before each run. An instance
+that can't renew its leases stops leading when they expire, so a role is
+never held twice as long as clocks advance at the same rate.
+"""
+
+import asyncio
+import logging
+import time
+from datetime import datetime
+from typing import Dict, Iterable, Optional, Set
+
+from app import __version__
+from app.cluster.capabilities import FEATURES, default_instance_id, describe_features, negotiate
+from app.config import ClusterConfig
+from app.repository import ServerInstance, ServerInstanceRepository
+
+logger = logging.getLogger(__name__)
+
+# Leader roles, by the background job holding them
+API_KEY_POLICY = "api_key_policy"
+AUDIT_EXPORT = "audit_export"
+BACKUP_VERIFY = "backup_verify"
+LAKE_EXPORT = "lake_export"
+RETENTION = "retention"
+ROLES = (API_KEY_POLICY, AUDIT_EXPORT, BACKUP_VERIFY, LAKE_EXPORT, RETENTION)
+
+# Instances that crashed are listed as stale by get_cluster_status for a day, then forgotten
+STALE_INSTANCE_RETENTION = 86400.0
+
+
+class ClusterMembership:
+    """Registers this instance, keeps track of the features usable cluster-wide and holds leader roles."""
+
+    def __init__(
+        self,
+        repo: ServerInstanceRepository,
+        cfg: ClusterConfig,
+        release: str = __version__,
+        features: Optional[Dict[str, int]] = None,
+        roles: Iterable[str] = (),
+    ):
+        self.repo = repo
+        self.cfg = cfg
+        self.instance = ServerInstance(
+            instance_id=cfg.instance_id or default_instance_id(),
+            release=release,
+            features=dict(FEATURES if features is None else features),
+            started_at=datetime.now().astimezone(),
+        )
+        # Until the first heartbeat, only this instance is known
+        self.features: Dict[str, int] = dict(self.instance.features)
+        # Roles to campaign for, those held and until when (time.monotonic())
+        self.roles: Set[str] = set(roles)
+        self.held: Set[str] = set()
+        self._leases_until = 0.0
+        self._task: Optional[asyncio.Task] = None
+        self._stopping = asyncio.Event()
+
+    async def start(self) -> None:
+        """Register this instance, then refresh the negotiated features in the background."""
+        if self._task:
+            return
+        await self.refresh()
+        self._stopping.clear()
+        self._task = asyncio.create_task(self._run())
+
+    async def stop(self) -> None:
+        """
+        Stop the heartbeats and unregister this instance, so its features stop
+        counting and its roles can be taken over at once.
+        """
+        if self._task:
+            self._stopping.set()
+            await self._task
+            self._task = None
+        self.held = set()
+        try:
+            await self.repo.remove(self.instance.instance_id)
+        except Exception:
+            logger.exception(f"Failed to unregister server instance {self.instance.instance_id}")
+
+    async def _run(self) -> None:
+        while not self._stopping.is_set():
+            try:
+                await asyncio.wait_for(self._stopping.wait(), timeout=self.cfg.heartbeat_interval)
+            except asyncio.TimeoutError:
+                pass
+            if self._stopping.is_set():
+                break
+            try:
+                await self.refresh()
+            except Exception:
+                # Keep the last negotiated features until the control database answers again
+                logger.exception("Server instance heartbeat failed")
+
+    def campaign(self, role: str) -> None:
+        """Take the role from the next heartbeat on, whenever no other instance holds it."""
+        self.roles.add(role)
+
+    def leads(self, role: str) -> bool:
+        """Return whether this instance holds a role, with a lease that has not expired."""
+        return role in self.held and time.monotonic() < self._leases_until
+
+    async def refresh(self) -> Dict[str, int]:
+        """Send a heartbeat, renew or take leader roles and negotiate the features with the live instances."""
+        started = time.monotonic()
+        await self.repo.heartbeat(self.instance)
+        await self._renew_leases(started)
+        await self.repo.remove_stale(max(STALE_INSTANCE_RETENTION, self.cfg.instance_ttl))
+        instances = await self.repo.list_live(self.cfg.instance_ttl)
+        if not any(i.instance_id == self.instance.instance_id for i in instances):
+            instances.append(self.instance)
+        features = negotiate(instances)
+        if features != self.features:
+            releases = sorted({i.release for i in instances})
+            logger.info(
+                f"Features usable cluster-wide: {describe_features(features)} "
+                f"({len(instances)} instances, releases {', '.join(releases)})"
+            )
+        self.features = features
+        return features
+
+    async def _renew_leases(self, started: float) -> None:
+        held = set()
+        for role in sorted(self.roles):
+            if await self.repo.acquire_lease(role, self.instance.instance_id, self.cfg.instance_ttl):
+                held.add(role)
+        for role in sorted(held - self.held):
+            logger.info(f"Server instance {self.instance.instance_id} now leads {role}")
+        for role in sorted(self.held - held):
+            logger.info(f"Server instance {self.instance.instance_id} lost the lead of {role}")
+        self.held = held
+        # Leases were renewed after started, so they last at least until then
+        self._leases_until = started + self.cfg.instance_ttl
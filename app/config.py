@@ -4,7 +4,7 @@ Database configuration module.
 
 import os
 from dataclasses import dataclass
-from typing import Optional
+from typing import List, Optional, Tuple
 
 
 @dataclass
@@ -21,6 +21,25 @@ class Config:
     # Legacy: kept for backward compatibility during migration
     db_name: str = "dbaas"
     ssl_mode: str = "disable"
+    # Enforce tenant isolation with row-level security (see app/db/rls.py)
+    rls_enabled: bool = False
+    # Storage backend: postgres or sqlite (see app/storage)
+    storage_backend: str = "postgres"
+    # Directory of the SQLite files of the sqlite backend
+    sqlite_dir: str = "data"
+    # Read replicas as "host" or "host:port", serving the read-only queries of read methods (see app/db/replicas.py)
+    replica_hosts: Tuple[str, ...] = ()
+    # Connections per database on each replica
+    replica_pool_max_size: int = 10
+    # Connections kept open and opened at most per database pool
+    pool_min_size: int = 1
+    pool_max_size: int = 10
+    # Seconds after which a connection is replaced when released (0 keeps connections indefinitely)
+    pool_max_lifetime: float = 3600.0
+    # Seconds after which an idle connection is closed (0 keeps idle connections)
+    pool_max_idle_time: float = 300.0
+    # Connections idle for this many seconds are checked before use (0 never checks)
+    pool_health_check_period: float = 60.0
 
     def connection_string(self, database: Optional[str] = None) -> str:
         """Return PostgreSQL connection string."""
@@ -33,6 +52,15 @@ class Config:
         db = database or self.control_db_name
         return f"postgresql://{self.user}:{self.password}@{self.host}:{self.port}/{db}"
     
+    def replica_addresses(self) -> List[Tuple[str, int]]:
+        """Return the host and port of each read replica; the port defaults to the primary's."""
+        addresses = []
+        for replica in self.replica_hosts:
+            host, _, port = replica.strip().partition(":")
+            if host:
+                addresses.append((host, int(port) if port else self.port))
+        return addresses
+
     def tenant_db_name(self, tenant_slug: str) -> str:
         """Generate tenant database name from slug."""
         # Sanitize slug: lowercase, replace non-alphanumeric with underscore
@@ -40,6 +68,489 @@ class Config:
         return f"{self.tenant_db_prefix}{sanitized}"
 
 
+@dataclass
+class WebhookConfig:
+    """Outbox dispatcher and webhook delivery configuration."""
+    enabled: bool = True
+    # Seconds between dispatcher polls of tenant outboxes
+    poll_interval: float = 2.0
+    # Maximum events fanned out / deliveries attempted per tenant per poll
+    batch_size: int = 100
+    # Deliveries are marked failed after this many attempts
+    max_attempts: int = 8
+    # Retry backoff: backoff_base * 2^(attempts - 1), capped at backoff_max seconds
+    backoff_base: float = 5.0
+    backoff_max: float = 3600.0
+    # HTTP timeout per delivery attempt in seconds
+    timeout: float = 10.0
+
+
+@dataclass
+class IntakeConfig:
+    """Public intake form endpoint configuration."""
+    # Submissions accepted per client IP per minute across all forms (per server instance)
+    ip_rate_limit_per_minute: int = 30
+    # Largest accepted submission body in bytes
+    max_body_bytes: int = 65536
+    # Largest accepted inbound email webhook body in bytes (attachments included)
+    max_email_bytes: int = 26214400
+    # Captcha siteverify endpoint (hCaptcha, reCAPTCHA and Turnstile share the protocol)
+    captcha_verify_url: str = "https://hcaptcha.com/siteverify"
+    captcha_secret: str = ""
+    # Use the first X-Forwarded-For address as client IP (only behind a trusted proxy)
+    trust_forwarded_for: bool = False
+    # HTTP timeout for captcha verification in seconds
+    captcha_timeout: float = 5.0
+    # Seconds a signed request's timestamp may differ from the server clock (0 disables the check)
+    signature_tolerance: int = 300
+
+
+@dataclass
+class MetricsConfig:
+    """Prometheus metrics and SLO configuration."""
+    enabled: bool = True
+    # Share of requests per method that must not fail with a server error
+    availability_objective: float = 0.999
+    # Share of requests per method that must complete within latency_threshold seconds
+    latency_objective: float = 0.99
+    latency_threshold: float = 0.5
+    # Tenants labelled individually on per-tenant metrics; the rest are "other" (0 disables)
+    tenant_label_top_n: int = 10
+    # Set flexdb.tenant_id on the current OpenTelemetry span (if opentelemetry is installed)
+    tenant_trace_attributes: bool = False
+    # Return the database time, rows and bytes of each JSON-RPC request in the X-FlexDB-Cost header
+    cost_header: bool = True
+
+
+@dataclass
+class LoggingConfig:
+    """Log level and format configuration."""
+    level: str = "INFO"
+    # "text" for humans or "json" for log pipelines
+    format: str = "text"
+    # Log every JSON-RPC call with its method, tenant, request ID, latency and result code
+    log_calls: bool = True
+
+
+@dataclass
+class QueryCacheConfig:
+    """List and aggregate query result cache configuration."""
+    enabled: bool = False
+    # Cached results kept per server instance, least recently used evicted first
+    max_entries: int = 1000
+    # Upper bound in seconds on how long a result is reused while the tenant's change feed is unchanged
+    ttl: float = 30.0
+
+
+@dataclass
+class NodeTypeCatalogConfig:
+    """In-memory node type catalog consulted by node writes (see app/service/node_type_catalog.py)."""
+    enabled: bool = True
+    # Seconds between checks of a tenant's node type generation
+    refresh_interval: float = 1.0
+    # Upper bound in seconds on how long a tenant's node types are reused without reloading them
+    ttl: float = 60.0
+    # Tenants whose node types are kept per server instance, least recently used evicted first
+    max_tenants: int = 1000
+
+
+@dataclass
+class ValidatorCacheConfig:
+    """Cache of compiled node type schema validators (see app/service/validator_cache.py)."""
+    # Validators kept per server instance, least recently used evicted first (0 disables the cache)
+    max_entries: int = 1000
+
+
+@dataclass
+class EncryptionConfig:
+    """Encryption at rest of sensitive node data fields (see app/encryption)."""
+    # Base64 of a 32-byte master key from which the local KMS derives a key encryption key per tenant
+    master_key: str = ""
+    # Recorded with every wrapped data key, so master keys can be told apart after a change
+    key_id: str = "local"
+
+
+@dataclass
+class AnalyticsConfig:
+    """Read-only analytics endpoint served from read replicas."""
+    enabled: bool = False
+    # Replica server holding copies of the tenant databases (required when enabled)
+    host: str = ""
+    port: int = 5432
+    # Credentials default to the primary's when empty
+    user: str = ""
+    password: str = ""
+    # Largest page returned by analytics list methods
+    max_page_size: int = 10000
+    # Per-statement timeout on replica connections in seconds
+    statement_timeout: float = 300.0
+    # Connections per tenant replica pool, so extracts cannot pile up on a replica
+    pool_max_size: int = 4
+
+
+@dataclass
+class BiViewsConfig:
+    """Generated read-only BI views per node type."""
+    enabled: bool = False
+    # Database role granted SELECT on the views (empty grants nothing)
+    reader_role: str = ""
+
+
+@dataclass
+class LakeExportConfig:
+    """Scheduled Parquet export of tenant nodes to object storage."""
+    enabled: bool = False
+    # Destination: s3://bucket/prefix, gs://bucket/prefix or file:///path (required when enabled)
+    url: str = ""
+    # Seconds between exports of a tenant
+    interval: float = 86400.0
+    # Seconds between checks for tenants that are due
+    poll_interval: float = 300.0
+    # Nodes per Parquet file; larger date partitions are split into several files
+    rows_per_file: int = 100000
+    # Nodes fetched per database round trip
+    batch_size: int = 1000
+    # S3-compatible endpoint; empty uses AWS S3 for s3:// and storage.googleapis.com for gs://
+    endpoint: str = ""
+    region: str = "us-east-1"
+    # S3 access keys or GCS HMAC keys
+    access_key_id: str = ""
+    secret_access_key: str = ""
+    # HTTP timeout per upload in seconds
+    timeout: float = 60.0
+
+
+@dataclass
+class AttachmentConfig:
+    """Blob storage of node attachments."""
+    # Where attachment bytes are kept: s3://bucket/prefix, gs://bucket/prefix or
+    # file:///path; empty disables attachments
+    url: str = ""
+    # Largest accepted attachment in bytes
+    max_bytes: int = 100 * 1024 * 1024
+    # S3-compatible endpoint; empty uses AWS S3 for s3:// and storage.googleapis.com for gs://
+    endpoint: str = ""
+    region: str = "us-east-1"
+    # S3 access keys or GCS HMAC keys
+    access_key_id: str = ""
+    secret_access_key: str = ""
+    # HTTP timeout per upload or download in seconds
+    timeout: float = 300.0
+
+
+@dataclass
+class AuditExportConfig:
+    """Scheduled export of the audit log to write-once object storage."""
+    enabled: bool = False
+    # Destination: s3://bucket/prefix, gs://bucket/prefix or file:///path (required when enabled)
+    url: str = ""
+    # Seconds between exports
+    interval: float = 3600.0
+    # Events per exported batch at most
+    batch_size: int = 10000
+    # Seconds an event must be old before it is exported, so events committed
+    # out of ID order aren't skipped
+    settle_seconds: float = 60.0
+    # Days batches are retained under S3 Object Lock (0 uploads without Object Lock)
+    retention_days: int = 0
+    # S3-compatible endpoint; empty uses AWS S3 for s3:// and storage.googleapis.com for gs://
+    endpoint: str = ""
+    region: str = "us-east-1"
+    # S3 access keys or GCS HMAC keys
+    access_key_id: str = ""
+    secret_access_key: str = ""
+    # HTTP timeout per upload in seconds
+    timeout: float = 60.0
+
+
+@dataclass
+class ExportStorageConfig:
+    """Tenant exports written to object storage by export_tenant_to_storage."""
+    # Destination: s3://bucket/prefix, gs://bucket/prefix or file:///path; empty disables them
+    url: str = ""
+    # Compressed bytes per uploaded part (S3 requires at least 5 MiB)
+    part_size: int = 8 * 1024 * 1024
+    # Seconds without progress after which a running export counts as interrupted and can be resumed
+    stale_seconds: float = 900.0
+    # S3-compatible endpoint; empty uses AWS S3 for s3:// and storage.googleapis.com for gs://
+    endpoint: str = ""
+    region: str = "us-east-1"
+    # S3 access keys or GCS HMAC keys
+    access_key_id: str = ""
+    secret_access_key: str = ""
+    # HTTP timeout per part upload in seconds
+    timeout: float = 300.0
+
+
+@dataclass
+class BackupVerifyConfig:
+    """Scheduled restore drills of the latest backup (see app/jobs/backups.py)."""
+    enabled: bool = False
+    # Glob of backup files, the newest of which is restored (required when enabled):
+    # pg_dump custom or tar format archives, or plain .sql scripts
+    path: str = ""
+    # Seconds between drills
+    interval: float = 86400.0
+    # Scratch database the backup is restored into; dropped before and after every drill
+    scratch_database: str = "flexdb_restore_drill"
+    # Seconds a restore may take
+    timeout: float = 3600.0
+    # Fail the drill if the newest backup is older than this many hours (0 for no limit)
+    max_age_hours: float = 0.0
+    # Nodes or tenants read back by the sample queries
+    sample_size: int = 100
+
+
+@dataclass
+class ProbeConfig:
+    """Synthetic probes of the node API in a canary tenant (see app/jobs/probes.py)."""
+    enabled: bool = False
+    # Tenant the probes create, read, update and delete a node in (required when enabled);
+    # it should be dedicated to probing
+    tenant_id: str = ""
+    # Seconds between probes
+    interval: float = 60.0
+    # Seconds each step of a probe may take
+    timeout: float = 10.0
+
+
+@dataclass
+class FailoverConfig:
+    """Standby promotion and primary routing (see app/db/failover.py)."""
+    # Standby promoted by --promote-standby (required to promote)
+    standby_host: str = ""
+    standby_port: int = 5432
+    # Routing file naming the current primary, read at startup in place of DB_HOST and DB_PORT;
+    # it must be shared by all servers, e.g. on a mounted volume (required to promote)
+    routing_file: str = ""
+    # Seconds to wait for the standby to finish promotion and for the old primary to answer
+    timeout: float = 60.0
+
+
+@dataclass
+class ClusterConfig:
+    """Server instance heartbeats and feature negotiation (see app/cluster/capabilities.py)."""
+    # Name of this instance in server_instances (default: <hostname>-<pid>)
+    instance_id: str = ""
+    # Seconds between heartbeats, which also refresh the features usable cluster-wide
+    heartbeat_interval: float = 10.0
+    # Instances without a heartbeat for this many seconds are considered gone
+    instance_ttl: float = 60.0
+
+
+@dataclass
+class TlsConfig:
+    """TLS of the API server, and client certificate authentication (see app/api/tls.py)."""
+    # PEM certificate chain and private key; TLS is off unless both are set
+    cert_file: str = ""
+    key_file: str = ""
+    # Password of an encrypted private key
+    key_password: str = ""
+    # PEM CA certificates of client certificates; setting it requires clients
+    # to present a certificate signed by one of them (mutual TLS)
+    client_ca_file: str = ""
+
+
+@dataclass
+class ShutdownConfig:
+    """Graceful shutdown of the API server (see app/api/shutdown.py)."""
+    # Seconds /health reports NOT_SERVING before the server stops accepting connections,
+    # so load balancers take the instance out of rotation first
+    drain_delay: float = 5.0
+    # Seconds in-flight requests, the outbox drain and background jobs get to finish
+    # after that, before they are cancelled
+    timeout: float = 30.0
+
+
+@dataclass
+class PluginConfig:
+    """Plugin modules registering interceptors (see app/plugins/hooks.py)."""
+    # Importable module names, e.g. ("mycompany.flexdb_auth",)
+    modules: Tuple[str, ...] = ()
+
+
+@dataclass
+class TenantTemplateConfig:
+    """Tenant templates (see app/service/tenant_template_service.py)."""
+    # Directory of <name>.json or <name>.yaml template files (none if empty)
+    directory: str = ""
+
+
+@dataclass
+class RateLimitConfig:
+    """Request rate limits per tenant and per API key (see app/quotas/)."""
+    enabled: bool = False
+    # Defaults for tenants without a quota: token bucket refill rate in
+    # requests per second (0 for unlimited) and bucket size
+    tenant_requests_per_second: float = 100.0
+    tenant_burst: int = 200
+    api_key_requests_per_second: float = 50.0
+    api_key_burst: int = 100
+    # Seconds a tenant's quota is cached before it is read again
+    quota_ttl: float = 30.0
+
+
+@dataclass
+class LoadShedConfig:
+    """Shedding of low-priority calls while the database is saturated (see app/quotas/shedding.py)."""
+    enabled: bool = False
+    # Methods shed while saturated; "prefix.*" matches methods starting with "prefix."
+    methods: Tuple[str, ...] = ("analytics.*", "stream.export", "stream.import")
+    # Seconds of pool waits and call latencies considered
+    window: float = 10.0
+    # Saturated while the 95th percentile wait for a pooled connection exceeds this many seconds
+    pool_wait_threshold: float = 0.1
+    # Saturated while interactive calls slower than the SLO latency threshold
+    # burn its error budget this many times faster than sustainable (0 disables)
+    burn_rate_threshold: float = 10.0
+    # Fewest interactive calls in the window before their latency is considered
+    min_calls: int = 20
+    # Seconds shed calls are asked to wait before retrying
+    retry_after: float = 5.0
+
+
+@dataclass
+class ConcurrencyLimitConfig:
+    """Adaptive concurrency limits per JSON-RPC method (see app/quotas/concurrency.py)."""
+    enabled: bool = False
+    # Calls of each method in flight at once, to start with and at least and at most
+    initial_limit: int = 20
+    min_limit: int = 4
+    max_limit: int = 200
+    # Share of each new limit estimate taken into the limit (0 to 1)
+    smoothing: float = 0.2
+    # How many times its long-term latency a method may take before its limit shrinks
+    tolerance: float = 1.5
+    # Calls the long-term latency of a method averages over
+    long_window: int = 600
+    # Seconds rejected calls are asked to wait before retrying
+    retry_after: float = 1.0
+
+
+@dataclass
+class ComplianceConfig:
+    """Compliance evidence bundles (see app/jobs/compliance.py)."""
+    # HMAC-SHA256 key signing bundles (required to generate or verify one)
+    signing_key: str = ""
+    # Days of the audit log summarized in a bundle
+    period_days: int = 90
+
+
+@dataclass
+class CdcConfig:
+    """Change data capture publishing of outbox events to Kafka or NATS."""
+    enabled: bool = False
+    # Broker to publish to: kafka or nats
+    broker: str = "kafka"
+    # Message format: debezium (JSON) or protobuf
+    format: str = "debezium"
+    # Comma-separated Kafka bootstrap servers (required for kafka)
+    bootstrap_servers: str = ""
+    # Comma-separated NATS server URLs (required for nats)
+    nats_servers: str = ""
+    # Topics are <topic_prefix>.<tenant_id>.<table>, like Debezium's <prefix>.<schema>.<table>
+    topic_prefix: str = "flexdb"
+    # Seconds between polls of tenant outboxes
+    poll_interval: float = 1.0
+    # Events published per tenant per transaction
+    batch_size: int = 500
+    # Follow delete events with a null-value tombstone so compacted topics drop the key
+    tombstones: bool = True
+
+
+@dataclass
+class NodeMigrationConfig:
+    """Background worker running node schema migrations."""
+    enabled: bool = True
+    # Seconds between polls for pending migrations
+    poll_interval: float = 5.0
+
+
+@dataclass
+class RetentionConfig:
+    """Background sweeper expiring nodes by their node type's retention policy."""
+    enabled: bool = True
+    # Seconds between sweeps
+    poll_interval: float = 3600.0
+    # Nodes deleted per transaction
+    batch_size: int = 1000
+    # Count and log expired nodes without deleting them
+    dry_run: bool = False
+
+
+@dataclass
+class TenantDeletionConfig:
+    """Background worker deleting tenants step by step."""
+    enabled: bool = True
+    # Seconds between polls for queued deletions
+    poll_interval: float = 5.0
+    # Rows deleted per transaction
+    batch_size: int = 1000
+
+
+@dataclass
+class TenantSlugConfig:
+    """Whether tenant slugs change after creation (see app/service/tenant_service.py)."""
+    # mutable: update_tenant and rename_tenant_slug change them; rename: only
+    # rename_tenant_slug does; immutable: nothing does
+    policy: str = "mutable"
+
+
+@dataclass
+class JobSchedulerConfig:
+    """Worker pools running background jobs by priority class (see app/jobs/scheduler.py)."""
+    # Jobs run at once in each class: webhook deliveries and CDC publishing,
+    # node migrations, and lake exports, retention sweeps and tenant deletions
+    interactive_workers: int = 8
+    default_workers: int = 4
+    background_workers: int = 2
+
+
+@dataclass
+class AuthConfig:
+    """Authentication of API requests."""
+    # Reject requests without an API key; when off, they get full access
+    required: bool = False
+    # Key with full access, including tenant and user management
+    admin_key: str = ""
+    # Take the client IP from X-Forwarded-For (only behind a trusted proxy)
+    trust_forwarded_for: bool = False
+    # Failed authentications per client IP or key prefix within lockout_window
+    # that lock it out; 0 disables lockouts
+    lockout_max_failures: int = 10
+    lockout_window: float = 300.0
+    # First lockout in seconds, doubling with each further lockout up to lockout_max
+    lockout_seconds: float = 60.0
+    lockout_max: float = 3600.0
+    # Report API keys used from a client IP they weren't used from before
+    new_ip_alerts: bool = True
+    # Report API keys whose requests in a minute exceed this factor times their
+    # average per minute, and at least volume_alert_min; 0 disables
+    volume_alert_factor: float = 10.0
+    volume_alert_min: int = 600
+    # Secret signing the login tokens of users (see app/auth/tokens.py); login is disabled without it
+    jwt_secret: str = ""
+    # Seconds a login token is valid
+    jwt_ttl: float = 3600.0
+    jwt_issuer: str = "flexdb"
+    # Shortest accepted user password
+    password_min_length: int = 12
+
+
+@dataclass
+class ApiKeyPolicyConfig:
+    """API key expiry and unused key policies."""
+    enabled: bool = True
+    # Seconds between policy checks
+    poll_interval: float = 3600.0
+    # Longest lifetime of new and rotated keys in days (0 for unlimited)
+    max_lifetime_days: int = 0
+    # Revoke keys unused for this many days (0 to keep them)
+    disable_unused_days: int = 0
+    # Warn tenants this many days before a key expires or is revoked as unused
+    warning_days: int = 7
+
+
 def default_config() -> Config:
     """Return default database configuration."""
     return Config()
@@ -56,4 +567,387 @@ def config_from_env() -> Config:
         tenant_db_prefix=os.getenv("DB_TENANT_PREFIX", "dbaas_tenant_"),
         db_name=os.getenv("DB_NAME", "dbaas"),  # Legacy, kept for compatibility
         ssl_mode=os.getenv("DB_SSL_MODE", "disable"),
+        rls_enabled=os.getenv("DB_RLS_ENABLED", "false").lower() == "true",
+        storage_backend=os.getenv("STORAGE_BACKEND", "postgres").lower(),
+        sqlite_dir=os.getenv("SQLITE_DIR", "data"),
+        replica_hosts=tuple(host for host in os.getenv("DB_REPLICA_HOSTS", "").split(",") if host.strip()),
+        replica_pool_max_size=int(os.getenv("DB_REPLICA_POOL_MAX_SIZE", "10")),
+        pool_min_size=int(os.getenv("DB_POOL_MIN_SIZE", "1")),
+        pool_max_size=int(os.getenv("DB_POOL_MAX_SIZE", "10")),
+        pool_max_lifetime=float(os.getenv("DB_POOL_MAX_LIFETIME", "3600")),
+        pool_max_idle_time=float(os.getenv("DB_POOL_MAX_IDLE_TIME", "300")),
+        pool_health_check_period=float(os.getenv("DB_POOL_HEALTH_CHECK_PERIOD", "60")),
+    )
+
+
+def webhook_config_from_env() -> WebhookConfig:
+    """Load webhook delivery configuration from environment variables."""
+    return WebhookConfig(
+        enabled=os.getenv("WEBHOOK_DISPATCHER_ENABLED", "true").lower() == "true",
+        poll_interval=float(os.getenv("WEBHOOK_POLL_INTERVAL", "2.0")),
+        batch_size=int(os.getenv("WEBHOOK_BATCH_SIZE", "100")),
+        max_attempts=int(os.getenv("WEBHOOK_MAX_ATTEMPTS", "8")),
+        backoff_base=float(os.getenv("WEBHOOK_BACKOFF_BASE", "5.0")),
+        backoff_max=float(os.getenv("WEBHOOK_BACKOFF_MAX", "3600.0")),
+        timeout=float(os.getenv("WEBHOOK_TIMEOUT", "10.0")),
+    )
+
+
+def intake_config_from_env() -> IntakeConfig:
+    """Load public intake form configuration from environment variables."""
+    return IntakeConfig(
+        ip_rate_limit_per_minute=int(os.getenv("INTAKE_IP_RATE_LIMIT", "30")),
+        max_body_bytes=int(os.getenv("INTAKE_MAX_BODY_BYTES", "65536")),
+        max_email_bytes=int(os.getenv("INTAKE_MAX_EMAIL_BYTES", "26214400")),
+        captcha_verify_url=os.getenv("INTAKE_CAPTCHA_VERIFY_URL", "https://hcaptcha.com/siteverify"),
+        captcha_secret=os.getenv("INTAKE_CAPTCHA_SECRET", ""),
+        trust_forwarded_for=os.getenv("INTAKE_TRUST_FORWARDED_FOR", "false").lower() == "true",
+        captcha_timeout=float(os.getenv("INTAKE_CAPTCHA_TIMEOUT", "5.0")),
+        signature_tolerance=int(os.getenv("INTAKE_SIGNATURE_TOLERANCE", "300")),
+    )
+
+
+def metrics_config_from_env() -> MetricsConfig:
+    """Load metrics and SLO configuration from environment variables."""
+    return MetricsConfig(
+        enabled=os.getenv("METRICS_ENABLED", "true").lower() == "true",
+        availability_objective=float(os.getenv("SLO_AVAILABILITY_OBJECTIVE", "0.999")),
+        latency_objective=float(os.getenv("SLO_LATENCY_OBJECTIVE", "0.99")),
+        latency_threshold=float(os.getenv("SLO_LATENCY_THRESHOLD", "0.5")),
+        tenant_label_top_n=int(os.getenv("METRICS_TENANT_TOP_N", "10")),
+        tenant_trace_attributes=os.getenv("METRICS_TENANT_TRACE_ATTRIBUTES", "false").lower() == "true",
+        cost_header=os.getenv("METRICS_COST_HEADER", "true").lower() == "true",
+    )
+
+
+def logging_config_from_env() -> LoggingConfig:
+    """Load logging configuration from environment variables."""
+    return LoggingConfig(
+        level=os.getenv("LOG_LEVEL", "INFO"),
+        format=os.getenv("LOG_FORMAT", "text").lower(),
+        log_calls=os.getenv("LOG_CALLS", "true").lower() == "true",
+    )
+
+
+def query_cache_config_from_env() -> QueryCacheConfig:
+    """Load query result cache configuration from environment variables."""
+    return QueryCacheConfig(
+        enabled=os.getenv("QUERY_CACHE_ENABLED", "false").lower() == "true",
+        max_entries=int(os.getenv("QUERY_CACHE_MAX_ENTRIES", "1000")),
+        ttl=float(os.getenv("QUERY_CACHE_TTL", "30.0")),
+    )
+
+
+def node_type_catalog_config_from_env() -> NodeTypeCatalogConfig:
+    """Load node type catalog configuration from environment variables."""
+    return NodeTypeCatalogConfig(
+        enabled=os.getenv("NODE_TYPE_CATALOG_ENABLED", "true").lower() == "true",
+        refresh_interval=float(os.getenv("NODE_TYPE_CATALOG_REFRESH_INTERVAL", "1.0")),
+        ttl=float(os.getenv("NODE_TYPE_CATALOG_TTL", "60.0")),
+        max_tenants=int(os.getenv("NODE_TYPE_CATALOG_MAX_TENANTS", "1000")),
+    )
+
+
+def validator_cache_config_from_env() -> ValidatorCacheConfig:
+    """Load schema validator cache configuration from environment variables."""
+    return ValidatorCacheConfig(
+        max_entries=int(os.getenv("SCHEMA_VALIDATOR_CACHE_SIZE", "1000")),
+    )
+
+
+def encryption_config_from_env() -> EncryptionConfig:
+    """Load field encryption configuration from environment variables."""
+    return EncryptionConfig(
+        master_key=os.getenv("ENCRYPTION_MASTER_KEY", ""),
+        key_id=os.getenv("ENCRYPTION_KEY_ID", "local"),
+    )
+
+
+def analytics_config_from_env() -> AnalyticsConfig:
+    """Load analytics replica configuration from environment variables."""
+    return AnalyticsConfig(
+        enabled=os.getenv("ANALYTICS_ENABLED", "false").lower() == "true",
+        host=os.getenv("ANALYTICS_DB_HOST", ""),
+        port=int(os.getenv("ANALYTICS_DB_PORT", "5432")),
+        user=os.getenv("ANALYTICS_DB_USER", ""),
+        password=os.getenv("ANALYTICS_DB_PASSWORD", ""),
+        max_page_size=int(os.getenv("ANALYTICS_MAX_PAGE_SIZE", "10000")),
+        statement_timeout=float(os.getenv("ANALYTICS_STATEMENT_TIMEOUT", "300.0")),
+        pool_max_size=int(os.getenv("ANALYTICS_POOL_MAX_SIZE", "4")),
+    )
+
+
+def bi_views_config_from_env() -> BiViewsConfig:
+    """Load BI view configuration from environment variables."""
+    return BiViewsConfig(
+        enabled=os.getenv("BI_VIEWS_ENABLED", "false").lower() == "true",
+        reader_role=os.getenv("BI_VIEWS_READER_ROLE", ""),
+    )
+
+
+def lake_export_config_from_env() -> LakeExportConfig:
+    """Load Parquet export configuration from environment variables."""
+    return LakeExportConfig(
+        enabled=os.getenv("LAKE_EXPORT_ENABLED", "false").lower() == "true",
+        url=os.getenv("LAKE_EXPORT_URL", ""),
+        interval=float(os.getenv("LAKE_EXPORT_INTERVAL", "86400.0")),
+        poll_interval=float(os.getenv("LAKE_EXPORT_POLL_INTERVAL", "300.0")),
+        rows_per_file=int(os.getenv("LAKE_EXPORT_ROWS_PER_FILE", "100000")),
+        batch_size=int(os.getenv("LAKE_EXPORT_BATCH_SIZE", "1000")),
+        endpoint=os.getenv("LAKE_EXPORT_ENDPOINT", ""),
+        region=os.getenv("LAKE_EXPORT_REGION", "us-east-1"),
+        access_key_id=os.getenv("LAKE_EXPORT_ACCESS_KEY_ID", ""),
+        secret_access_key=os.getenv("LAKE_EXPORT_SECRET_ACCESS_KEY", ""),
+        timeout=float(os.getenv("LAKE_EXPORT_TIMEOUT", "60.0")),
+    )
+
+
+def attachment_config_from_env() -> AttachmentConfig:
+    """Load attachment blob storage configuration from environment variables."""
+    return AttachmentConfig(
+        url=os.getenv("ATTACHMENTS_URL", ""),
+        max_bytes=int(os.getenv("ATTACHMENTS_MAX_BYTES", str(100 * 1024 * 1024))),
+        endpoint=os.getenv("ATTACHMENTS_ENDPOINT", ""),
+        region=os.getenv("ATTACHMENTS_REGION", "us-east-1"),
+        access_key_id=os.getenv("ATTACHMENTS_ACCESS_KEY_ID", ""),
+        secret_access_key=os.getenv("ATTACHMENTS_SECRET_ACCESS_KEY", ""),
+        timeout=float(os.getenv("ATTACHMENTS_TIMEOUT", "300.0")),
+    )
+
+
+def audit_export_config_from_env() -> AuditExportConfig:
+    """Load audit log export configuration from environment variables."""
+    return AuditExportConfig(
+        enabled=os.getenv("AUDIT_EXPORT_ENABLED", "false").lower() == "true",
+        url=os.getenv("AUDIT_EXPORT_URL", ""),
+        interval=float(os.getenv("AUDIT_EXPORT_INTERVAL", "3600.0")),
+        batch_size=int(os.getenv("AUDIT_EXPORT_BATCH_SIZE", "10000")),
+        settle_seconds=float(os.getenv("AUDIT_EXPORT_SETTLE_SECONDS", "60.0")),
+        retention_days=int(os.getenv("AUDIT_EXPORT_RETENTION_DAYS", "0")),
+        endpoint=os.getenv("AUDIT_EXPORT_ENDPOINT", ""),
+        region=os.getenv("AUDIT_EXPORT_REGION", "us-east-1"),
+        access_key_id=os.getenv("AUDIT_EXPORT_ACCESS_KEY_ID", ""),
+        secret_access_key=os.getenv("AUDIT_EXPORT_SECRET_ACCESS_KEY", ""),
+        timeout=float(os.getenv("AUDIT_EXPORT_TIMEOUT", "60.0")),
+    )
+
+
+def export_storage_config_from_env() -> ExportStorageConfig:
+    """Load the object storage configuration of tenant exports from environment variables."""
+    return ExportStorageConfig(
+        url=os.getenv("EXPORT_STORAGE_URL", ""),
+        part_size=int(os.getenv("EXPORT_STORAGE_PART_SIZE", str(8 * 1024 * 1024))),
+        stale_seconds=float(os.getenv("EXPORT_STORAGE_STALE_SECONDS", "900.0")),
+        endpoint=os.getenv("EXPORT_STORAGE_ENDPOINT", ""),
+        region=os.getenv("EXPORT_STORAGE_REGION", "us-east-1"),
+        access_key_id=os.getenv("EXPORT_STORAGE_ACCESS_KEY_ID", ""),
+        secret_access_key=os.getenv("EXPORT_STORAGE_SECRET_ACCESS_KEY", ""),
+        timeout=float(os.getenv("EXPORT_STORAGE_TIMEOUT", "300.0")),
+    )
+
+
+def backup_verify_config_from_env() -> BackupVerifyConfig:
+    """Load restore drill configuration from environment variables."""
+    return BackupVerifyConfig(
+        enabled=os.getenv("BACKUP_VERIFY_ENABLED", "false").lower() == "true",
+        path=os.getenv("BACKUP_VERIFY_PATH", ""),
+        interval=float(os.getenv("BACKUP_VERIFY_INTERVAL", "86400.0")),
+        scratch_database=os.getenv("BACKUP_VERIFY_SCRATCH_DATABASE", "flexdb_restore_drill"),
+        timeout=float(os.getenv("BACKUP_VERIFY_TIMEOUT", "3600.0")),
+        max_age_hours=float(os.getenv("BACKUP_VERIFY_MAX_AGE_HOURS", "0")),
+        sample_size=int(os.getenv("BACKUP_VERIFY_SAMPLE_SIZE", "100")),
+    )
+
+
+def probe_config_from_env() -> ProbeConfig:
+    """Load synthetic probe configuration from environment variables."""
+    return ProbeConfig(
+        enabled=os.getenv("PROBE_ENABLED", "false").lower() == "true",
+        tenant_id=os.getenv("PROBE_TENANT_ID", ""),
+        interval=float(os.getenv("PROBE_INTERVAL", "60.0")),
+        timeout=float(os.getenv("PROBE_TIMEOUT", "10.0")),
+    )
+
+
+def failover_config_from_env() -> FailoverConfig:
+    """Load standby promotion and routing configuration from environment variables."""
+    return FailoverConfig(
+        standby_host=os.getenv("FAILOVER_STANDBY_HOST", ""),
+        standby_port=int(os.getenv("FAILOVER_STANDBY_PORT", "5432")),
+        routing_file=os.getenv("FAILOVER_ROUTING_FILE", ""),
+        timeout=float(os.getenv("FAILOVER_TIMEOUT", "60.0")),
+    )
+
+
+def cluster_config_from_env() -> ClusterConfig:
+    """Load server instance heartbeat configuration from environment variables."""
+    return ClusterConfig(
+        instance_id=os.getenv("CLUSTER_INSTANCE_ID", ""),
+        heartbeat_interval=float(os.getenv("CLUSTER_HEARTBEAT_INTERVAL", "10.0")),
+        instance_ttl=float(os.getenv("CLUSTER_INSTANCE_TTL", "60.0")),
+    )
+
+
+def tls_config_from_env() -> TlsConfig:
+    """Load API server TLS configuration from environment variables."""
+    return TlsConfig(
+        cert_file=os.getenv("TLS_CERT_FILE", ""),
+        key_file=os.getenv("TLS_KEY_FILE", ""),
+        key_password=os.getenv("TLS_KEY_PASSWORD", ""),
+        client_ca_file=os.getenv("TLS_CLIENT_CA_FILE", ""),
+    )
+
+
+def shutdown_config_from_env() -> ShutdownConfig:
+    """Load graceful shutdown configuration from environment variables."""
+    return ShutdownConfig(
+        drain_delay=float(os.getenv("SHUTDOWN_DRAIN_DELAY", "5.0")),
+        timeout=float(os.getenv("SHUTDOWN_TIMEOUT", "30.0")),
+    )
+
+
+def plugin_config_from_env() -> PluginConfig:
+    """Load plugin modules from the comma-separated PLUGINS environment variable."""
+    return PluginConfig(
+        modules=tuple(m.strip() for m in os.getenv("PLUGINS", "").split(",") if m.strip()),
+    )
+
+
+def tenant_template_config_from_env() -> TenantTemplateConfig:
+    """Load tenant template configuration from environment variables."""
+    return TenantTemplateConfig(directory=os.getenv("TENANT_TEMPLATES_DIR", ""))
+
+
+def rate_limit_config_from_env() -> RateLimitConfig:
+    """Load rate limit configuration from environment variables."""
+    return RateLimitConfig(
+        enabled=os.getenv("RATE_LIMIT_ENABLED", "false").lower() == "true",
+        tenant_requests_per_second=float(os.getenv("RATE_LIMIT_TENANT_RPS", "100.0")),
+        tenant_burst=int(os.getenv("RATE_LIMIT_TENANT_BURST", "200")),
+        api_key_requests_per_second=float(os.getenv("RATE_LIMIT_API_KEY_RPS", "50.0")),
+        api_key_burst=int(os.getenv("RATE_LIMIT_API_KEY_BURST", "100")),
+        quota_ttl=float(os.getenv("RATE_LIMIT_QUOTA_TTL", "30.0")),
+    )
+
+
+def load_shed_config_from_env() -> LoadShedConfig:
+    """Load load shedding configuration from environment variables."""
+    methods = os.getenv("SHED_METHODS", "analytics.*,stream.export,stream.import")
+    return LoadShedConfig(
+        enabled=os.getenv("SHED_ENABLED", "false").lower() == "true",
+        methods=tuple(m.strip() for m in methods.split(",") if m.strip()),
+        window=float(os.getenv("SHED_WINDOW", "10.0")),
+        pool_wait_threshold=float(os.getenv("SHED_POOL_WAIT_THRESHOLD", "0.1")),
+        burn_rate_threshold=float(os.getenv("SHED_BURN_RATE_THRESHOLD", "10.0")),
+        min_calls=int(os.getenv("SHED_MIN_CALLS", "20")),
+        retry_after=float(os.getenv("SHED_RETRY_AFTER", "5.0")),
+    )
+
+
+def concurrency_limit_config_from_env() -> ConcurrencyLimitConfig:
+    """Load adaptive concurrency limit configuration from environment variables."""
+    return ConcurrencyLimitConfig(
+        enabled=os.getenv("CONCURRENCY_LIMIT_ENABLED", "false").lower() == "true",
+        initial_limit=int(os.getenv("CONCURRENCY_LIMIT_INITIAL", "20")),
+        min_limit=int(os.getenv("CONCURRENCY_LIMIT_MIN", "4")),
+        max_limit=int(os.getenv("CONCURRENCY_LIMIT_MAX", "200")),
+        smoothing=float(os.getenv("CONCURRENCY_LIMIT_SMOOTHING", "0.2")),
+        tolerance=float(os.getenv("CONCURRENCY_LIMIT_TOLERANCE", "1.5")),
+        long_window=int(os.getenv("CONCURRENCY_LIMIT_LONG_WINDOW", "600")),
+        retry_after=float(os.getenv("CONCURRENCY_LIMIT_RETRY_AFTER", "1.0")),
+    )
+
+
+def compliance_config_from_env() -> ComplianceConfig:
+    """Load compliance evidence bundle configuration from environment variables."""
+    return ComplianceConfig(
+        signing_key=os.getenv("COMPLIANCE_SIGNING_KEY", ""),
+        period_days=int(os.getenv("COMPLIANCE_PERIOD_DAYS", "90")),
+    )
+
+
+def cdc_config_from_env() -> CdcConfig:
+    """Load change data capture configuration from environment variables."""
+    return CdcConfig(
+        enabled=os.getenv("CDC_ENABLED", "false").lower() == "true",
+        broker=os.getenv("CDC_BROKER", "kafka").lower(),
+        format=os.getenv("CDC_FORMAT", "debezium").lower(),
+        bootstrap_servers=os.getenv("CDC_KAFKA_BOOTSTRAP_SERVERS", ""),
+        nats_servers=os.getenv("CDC_NATS_SERVERS", ""),
+        topic_prefix=os.getenv("CDC_TOPIC_PREFIX", "flexdb"),
+        poll_interval=float(os.getenv("CDC_POLL_INTERVAL", "1.0")),
+        batch_size=int(os.getenv("CDC_BATCH_SIZE", "500")),
+        tombstones=os.getenv("CDC_TOMBSTONES", "true").lower() == "true",
+    )
+
+
+def node_migration_config_from_env() -> NodeMigrationConfig:
+    """Load node migration worker configuration from environment variables."""
+    return NodeMigrationConfig(
+        enabled=os.getenv("NODE_MIGRATIONS_ENABLED", "true").lower() == "true",
+        poll_interval=float(os.getenv("NODE_MIGRATIONS_POLL_INTERVAL", "5.0")),
+    )
+
+
+def retention_config_from_env() -> RetentionConfig:
+    """Load retention sweeper configuration from environment variables."""
+    return RetentionConfig(
+        enabled=os.getenv("RETENTION_ENABLED", "true").lower() == "true",
+        poll_interval=float(os.getenv("RETENTION_POLL_INTERVAL", "3600.0")),
+        batch_size=int(os.getenv("RETENTION_BATCH_SIZE", "1000")),
+        dry_run=os.getenv("RETENTION_DRY_RUN", "false").lower() == "true",
+    )
+
+
+def tenant_deletion_config_from_env() -> TenantDeletionConfig:
+    """Load tenant deletion worker configuration from environment variables."""
+    return TenantDeletionConfig(
+        enabled=os.getenv("TENANT_DELETION_ENABLED", "true").lower() == "true",
+        poll_interval=float(os.getenv("TENANT_DELETION_POLL_INTERVAL", "5.0")),
+        batch_size=int(os.getenv("TENANT_DELETION_BATCH_SIZE", "1000")),
+    )
+
+
+def tenant_slug_config_from_env() -> TenantSlugConfig:
+    """Load the tenant slug policy from environment variables."""
+    return TenantSlugConfig(policy=os.getenv("TENANT_SLUG_POLICY", "mutable").lower())
+
+
+def job_scheduler_config_from_env() -> JobSchedulerConfig:
+    """Load background job worker pool configuration from environment variables."""
+    return JobSchedulerConfig(
+        interactive_workers=int(os.getenv("JOBS_INTERACTIVE_WORKERS", "8")),
+        default_workers=int(os.getenv("JOBS_DEFAULT_WORKERS", "4")),
+        background_workers=int(os.getenv("JOBS_BACKGROUND_WORKERS", "2")),
+    )
+
+
+def auth_config_from_env() -> AuthConfig:
+    """Load authentication configuration from environment variables."""
+    return AuthConfig(
+        required=os.getenv("AUTH_REQUIRED", "false").lower() == "true",
+        admin_key=os.getenv("AUTH_ADMIN_KEY", ""),
+        trust_forwarded_for=os.getenv("AUTH_TRUST_FORWARDED_FOR", "false").lower() == "true",
+        lockout_max_failures=int(os.getenv("AUTH_LOCKOUT_MAX_FAILURES", "10")),
+        lockout_window=float(os.getenv("AUTH_LOCKOUT_WINDOW", "300.0")),
+        lockout_seconds=float(os.getenv("AUTH_LOCKOUT_SECONDS", "60.0")),
+        lockout_max=float(os.getenv("AUTH_LOCKOUT_MAX_SECONDS", "3600.0")),
+        new_ip_alerts=os.getenv("AUTH_NEW_IP_ALERTS", "true").lower() == "true",
+        volume_alert_factor=float(os.getenv("AUTH_VOLUME_ALERT_FACTOR", "10.0")),
+        volume_alert_min=int(os.getenv("AUTH_VOLUME_ALERT_MIN", "600")),
+        jwt_secret=os.getenv("AUTH_JWT_SECRET", ""),
+        jwt_ttl=float(os.getenv("AUTH_JWT_TTL", "3600.0")),
+        jwt_issuer=os.getenv("AUTH_JWT_ISSUER", "flexdb"),
+        password_min_length=int(os.getenv("AUTH_PASSWORD_MIN_LENGTH", "12")),
+    )
+
+
+def api_key_policy_config_from_env() -> ApiKeyPolicyConfig:
+    """Load API key policy configuration from environment variables."""
+    return ApiKeyPolicyConfig(
+        enabled=os.getenv("API_KEY_POLICY_ENABLED", "true").lower() == "true",
+        poll_interval=float(os.getenv("API_KEY_POLICY_POLL_INTERVAL", "3600.0")),
+        max_lifetime_days=int(os.getenv("API_KEY_MAX_LIFETIME_DAYS", "0")),
+        disable_unused_days=int(os.getenv("API_KEY_DISABLE_UNUSED_DAYS", "0")),
+        warning_days=int(os.getenv("API_KEY_WARNING_DAYS", "7")),
     )
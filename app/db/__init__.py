@@ -2,20 +2,53 @@
 Database module initialization.
 """
 
-from app.db.database import Database, connect, run_migrations
+from app.db.database import Database, connect, create_pool, migrate_down, pool_metric_lines, run_migrations
 from app.db.control_database import (
     connect_control_db,
     run_control_migrations,
+    migrate_control_down,
     ensure_control_database_exists,
+    migration_history,
 )
+from app.db import backfills  # noqa: F401  (registers the backfills)
+from app.db.expand_contract import (
+    BACKFILLS,
+    Backfill,
+    dual_write_enabled,
+    end_dual_write,
+    register_backfill,
+    run_backfill,
+)
+from app.db.failover import apply_routing, promote_standby
+from app.db.migrator import version_number
 from app.db.tenant_db_manager import TenantDatabaseManager
+from app.db.replica_manager import ReplicaDatabaseManager
+from app.db.rls import current_tenant, tenant_scope, check_role
 
 __all__ = [
     "Database",
     "connect",
+    "create_pool",
+    "pool_metric_lines",
     "run_migrations",
+    "migrate_down",
     "connect_control_db",
     "run_control_migrations",
+    "migrate_control_down",
+    "BACKFILLS",
+    "Backfill",
+    "dual_write_enabled",
+    "end_dual_write",
+    "register_backfill",
+    "run_backfill",
+    "apply_routing",
+    "promote_standby",
+    "version_number",
     "ensure_control_database_exists",
+    "migration_history",
     "TenantDatabaseManager",
+    "ReplicaDatabaseManager",
+    "current_tenant",
+    "tenant_scope",
+    "check_role",
 ]
@@ -0,0 +1,15 @@
+"""
+Backfills of expand/contract schema changes (see app/db/expand_contract.py).
+
+Register the backfill of a change in the release shipping its expand
+migration, and remove it with the contract migration's release:
+
+    register_backfill(Backfill(
+        change="nodes_title",
+        table="nodes",
+        set_sql="title = data->>'title'",
+        where_sql="title IS NULL AND data ? 'title'",
+    ))
+"""
+
+from app.db.expand_contract import Backfill, register_backfill  # noqa: F401
@@ -6,15 +6,16 @@ Each tenant has its own isolated database for tenant-specific data.
 """
 
 import logging
-import os
 import ssl
 from pathlib import Path
-from typing import Optional
+from typing import Any, Dict, List, Optional
 
 import asyncpg
 
 from app.config import Config
-from app.db.database import Database
+from app.db.database import Database, create_pool
+from app.db.rls import pool_setup
+from app.db.migrator import applied_versions, ensure_migrations_table, migrate_down, migrate_up
 
 logger = logging.getLogger(__name__)
 
@@ -30,25 +31,15 @@ async def connect_control_db(cfg: Config) -> Database:
     - Tenant-User memberships
     """
     try:
-        # Map SSL mode to asyncpg ssl parameter
-        ssl_context = None
-        if cfg.ssl_mode == "require":
-            ssl_context = "require"
-        elif cfg.ssl_mode == "prefer":
-            ssl_context = "prefer"
-        elif cfg.ssl_mode == "verify-ca" or cfg.ssl_mode == "verify-full":
-            ssl_context = ssl.create_default_context()
-        # "disable" is the default (ssl_context = None)
-
-        pool = await asyncpg.create_pool(
+        pool = await create_pool(
+            cfg,
+            "control",
             host=cfg.host,
             port=cfg.port,
             user=cfg.user,
             password=cfg.password,
             database=cfg.control_db_name,
-            min_size=1,
-            max_size=10,
-            ssl=ssl_context,
+            setup=pool_setup(cfg),
         )
         
         # Test the connection
@@ -61,47 +52,61 @@ async def connect_control_db(cfg: Config) -> Database:
         raise Exception(f"Failed to connect to control database: {e}") from e
 
 
-async def run_control_migrations(db: Database) -> None:
-    """Apply all control database migrations."""
+CONTROL_MIGRATIONS_DIR = Path(__file__).parent / "control_migrations"
+
+
+async def run_control_migrations(
+    db: Database,
+    target_version: Optional[int] = None,
+    contract: bool = False
+) -> None:
+    """
+    Apply all control database migrations, or those up to target_version,
+    including contract migrations if contract is set.
+    """
+    if not CONTROL_MIGRATIONS_DIR.exists():
+        logger.warning(f"Control migrations directory not found: {CONTROL_MIGRATIONS_DIR}")
+        return
+
     async with db.pool.acquire() as conn:
-        # Create migrations tracking table
-        await conn.execute("""
-            CREATE TABLE IF NOT EXISTS schema_migrations (
-                version TEXT PRIMARY KEY,
-                applied_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
-            )
-        """)
+        await ensure_migrations_table(conn)
+        applied = await applied_versions(conn)
+        await migrate_up(
+            conn, CONTROL_MIGRATIONS_DIR, applied, target_version, label="control migration", contract=contract
+        )
 
-        # Get already applied migrations
-        rows = await conn.fetch("SELECT version FROM schema_migrations")
-        applied = {row["version"] for row in rows}
+    logger.info("Control database migrations completed")
 
-        # Read and apply migrations
-        migrations_dir = Path(__file__).parent / "control_migrations"
-        if not migrations_dir.exists():
-            logger.warning(f"Control migrations directory not found: {migrations_dir}")
-            return
-        
-        up_files = sorted([f for f in os.listdir(migrations_dir) if f.endswith(".up.sql")])
 
-        for filename in up_files:
-            version = filename.replace(".up.sql", "")
-            if version in applied:
-                logger.info(f"Control migration {version} already applied, skipping")
-                continue
+async def migrate_control_down(db: Database, target_version: int) -> List[str]:
+    """Roll back control database migrations newer than target_version."""
+    async with db.pool.acquire() as conn:
+        await ensure_migrations_table(conn)
+        return await migrate_down(conn, CONTROL_MIGRATIONS_DIR, target_version, label="control migration")
 
-            logger.info(f"Applying control migration {version}")
-            content = (migrations_dir / filename).read_text()
-            
-            # Execute the migration in a transaction
-            async with conn.transaction():
-                await conn.execute(content)
-                await conn.execute(
-                    "INSERT INTO schema_migrations (version) VALUES ($1)",
-                    version
-                )
-        
-        logger.info("Control database migrations completed")
+
+async def migration_history(db: Database) -> Dict[str, Any]:
+    """
+    Return the migrations applied to the control database and to each tenant
+    database, oldest first, as {"control": [...], "tenants": {tenant_id: [...]}}
+    with a version and applied_at per migration.
+    """
+    async with db.pool.acquire() as conn:
+        await ensure_migrations_table(conn)
+        control = await conn.fetch("SELECT version, applied_at FROM schema_migrations ORDER BY applied_at, version")
+        tenant = await conn.fetch(
+            "SELECT tenant_id, version, applied_at FROM tenant_migrations ORDER BY tenant_id, applied_at, version"
+        )
+
+    tenants: Dict[str, List[Dict[str, str]]] = {}
+    for row in tenant:
+        tenants.setdefault(str(row["tenant_id"]), []).append(
+            {"version": row["version"], "applied_at": row["applied_at"].isoformat()}
+        )
+    return {
+        "control": [{"version": row["version"], "applied_at": row["applied_at"].isoformat()} for row in control],
+        "tenants": tenants,
+    }
 
 
 async def ensure_control_database_exists(cfg: Config) -> None:
@@ -0,0 +1,8 @@
+-- Migration: 001_create_control_tables.down.sql
+-- Drop control database tables. Tenant databases are not dropped.
+
+DROP TABLE IF EXISTS tenant_migrations;
+DROP TABLE IF EXISTS tenant_users;
+DROP TABLE IF EXISTS users;
+DROP TABLE IF EXISTS tenant_databases;
+DROP TABLE IF EXISTS tenants;
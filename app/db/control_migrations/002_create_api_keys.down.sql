@@ -0,0 +1,3 @@
+-- Migration: 002_create_api_keys.down.sql
+
+DROP TABLE IF EXISTS api_keys;
@@ -0,0 +1,18 @@
+-- Migration: 002_create_api_keys.up.sql
+-- Tenant API keys with scopes (see app/auth/). Only a SHA-256 hash of each key is stored.
+
+CREATE TABLE IF NOT EXISTS api_keys (
+    id            UUID PRIMARY KEY,
+    tenant_id     UUID NOT NULL REFERENCES tenants(id) ON DELETE CASCADE,
+    name          TEXT NOT NULL,
+    -- First characters of the key, to tell keys apart without revealing them
+    key_prefix    TEXT NOT NULL,
+    key_hash      TEXT NOT NULL UNIQUE,
+    scopes        TEXT[] NOT NULL,
+    -- Node types the key is restricted to; empty for all node types
+    node_type_ids TEXT[] NOT NULL DEFAULT '{}',
+    created_at    TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    revoked_at    TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS idx_api_keys_tenant_id ON api_keys(tenant_id, created_at);
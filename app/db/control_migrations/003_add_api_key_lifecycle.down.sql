@@ -0,0 +1,8 @@
+-- Migration: 003_add_api_key_lifecycle.down.sql
+
+DROP INDEX IF EXISTS idx_api_keys_active_expires_at;
+ALTER TABLE api_keys DROP COLUMN IF EXISTS warned_at;
+ALTER TABLE api_keys DROP COLUMN IF EXISTS rotated_from_id;
+ALTER TABLE api_keys DROP COLUMN IF EXISTS revoke_reason;
+ALTER TABLE api_keys DROP COLUMN IF EXISTS last_used_at;
+ALTER TABLE api_keys DROP COLUMN IF EXISTS expires_at;
@@ -0,0 +1,15 @@
+-- Migration: 003_add_api_key_lifecycle.up.sql
+-- API key expiry, last-used tracking and rotation (see app/jobs/api_keys.py)
+
+ALTER TABLE api_keys ADD COLUMN IF NOT EXISTS expires_at TIMESTAMPTZ;
+-- Updated at most once a minute while the key is used
+ALTER TABLE api_keys ADD COLUMN IF NOT EXISTS last_used_at TIMESTAMPTZ;
+-- Why the key was revoked: revoked, rotated or unused
+ALTER TABLE api_keys ADD COLUMN IF NOT EXISTS revoke_reason TEXT;
+-- The key this one replaced through rotate_api_key
+ALTER TABLE api_keys ADD COLUMN IF NOT EXISTS rotated_from_id UUID;
+-- When the tenant was last warned about the key expiring or being unused;
+-- cleared when the key is used
+ALTER TABLE api_keys ADD COLUMN IF NOT EXISTS warned_at TIMESTAMPTZ;
+
+CREATE INDEX IF NOT EXISTS idx_api_keys_active_expires_at ON api_keys(expires_at) WHERE revoked_at IS NULL;
@@ -0,0 +1,11 @@
+-- Migration: 004_add_row_level_security.down.sql
+
+DROP POLICY IF EXISTS tenant_isolation ON tenant_users;
+ALTER TABLE tenant_users NO FORCE ROW LEVEL SECURITY;
+ALTER TABLE tenant_users DISABLE ROW LEVEL SECURITY;
+
+DROP POLICY IF EXISTS tenant_isolation ON api_keys;
+ALTER TABLE api_keys NO FORCE ROW LEVEL SECURITY;
+ALTER TABLE api_keys DISABLE ROW LEVEL SECURITY;
+
+DROP FUNCTION IF EXISTS flexdb_tenant_visible(UUID);
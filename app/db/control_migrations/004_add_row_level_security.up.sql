@@ -0,0 +1,18 @@
+-- Migration: 004_add_row_level_security.up.sql
+-- Row-level security on tenant-scoped control tables (see app/db/rls.py).
+-- Rows are visible when app.current_tenant is empty or names their tenant.
+
+CREATE OR REPLACE FUNCTION flexdb_tenant_visible(row_tenant_id UUID) RETURNS boolean
+LANGUAGE sql STABLE AS $$
+    SELECT COALESCE(current_setting('app.current_tenant', true), '') IN ('', row_tenant_id::text)
+$$;
+
+ALTER TABLE api_keys ENABLE ROW LEVEL SECURITY;
+ALTER TABLE api_keys FORCE ROW LEVEL SECURITY;
+DROP POLICY IF EXISTS tenant_isolation ON api_keys;
+CREATE POLICY tenant_isolation ON api_keys USING (flexdb_tenant_visible(tenant_id));
+
+ALTER TABLE tenant_users ENABLE ROW LEVEL SECURITY;
+ALTER TABLE tenant_users FORCE ROW LEVEL SECURITY;
+DROP POLICY IF EXISTS tenant_isolation ON tenant_users;
+CREATE POLICY tenant_isolation ON tenant_users USING (flexdb_tenant_visible(tenant_id));
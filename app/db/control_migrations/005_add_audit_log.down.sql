@@ -0,0 +1,4 @@
+-- Migration: 005_add_audit_log.down.sql
+
+DROP TABLE IF EXISTS api_key_ips;
+DROP TABLE IF EXISTS audit_events;
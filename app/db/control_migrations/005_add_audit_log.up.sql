@@ -0,0 +1,31 @@
+-- Migration: 005_add_audit_log.up.sql
+-- Security audit log (see app/auth/guard.py) and the client IPs each API key
+-- was used from, to detect use from new IPs. Audit events outlive their
+-- tenant and key, so they reference neither.
+
+CREATE TABLE IF NOT EXISTS audit_events (
+    id          BIGSERIAL PRIMARY KEY,
+    -- NULL for events not attributable to a tenant, such as IP lockouts
+    tenant_id   UUID,
+    event_type  TEXT NOT NULL,
+    api_key_id  UUID,
+    client_ip   TEXT NOT NULL DEFAULT '',
+    details     JSONB NOT NULL DEFAULT '{}',
+    created_at  TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_audit_events_tenant_id ON audit_events(tenant_id, id);
+CREATE INDEX IF NOT EXISTS idx_audit_events_event_type ON audit_events(event_type, id);
+
+ALTER TABLE audit_events ENABLE ROW LEVEL SECURITY;
+ALTER TABLE audit_events FORCE ROW LEVEL SECURITY;
+DROP POLICY IF EXISTS tenant_isolation ON audit_events;
+CREATE POLICY tenant_isolation ON audit_events USING (flexdb_tenant_visible(tenant_id));
+
+CREATE TABLE IF NOT EXISTS api_key_ips (
+    api_key_id     UUID NOT NULL REFERENCES api_keys(id) ON DELETE CASCADE,
+    client_ip      TEXT NOT NULL,
+    first_seen_at  TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    last_seen_at   TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (api_key_id, client_ip)
+);
@@ -0,0 +1,3 @@
+-- Migration: 006_create_audit_exports.down.sql
+
+DROP TABLE IF EXISTS audit_exports;
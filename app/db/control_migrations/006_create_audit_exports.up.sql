@@ -0,0 +1,16 @@
+-- Migration: 006_create_audit_exports.up.sql
+-- Batches of the audit log exported to write-once storage (see
+-- app/jobs/audit_export.py). Each batch records the hash of its object, which
+-- the next batch includes, so the exported history forms a hash chain.
+
+CREATE TABLE IF NOT EXISTS audit_exports (
+    sequence        BIGINT PRIMARY KEY,
+    first_event_id  BIGINT NOT NULL,
+    last_event_id   BIGINT NOT NULL,
+    event_count     INTEGER NOT NULL,
+    object_key      TEXT NOT NULL,
+    -- hex SHA-256 of the batch object and of the previous batch object
+    hash            TEXT NOT NULL,
+    prev_hash       TEXT NOT NULL,
+    exported_at     TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
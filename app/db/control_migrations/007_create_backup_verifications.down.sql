@@ -0,0 +1,3 @@
+-- Migration: 007_create_backup_verifications.down.sql
+
+DROP TABLE IF EXISTS backup_verifications;
@@ -0,0 +1,20 @@
+-- Migration: 007_create_backup_verifications.up.sql
+-- Results of restore drills: the latest backup restored into a scratch
+-- database and checked (see app/jobs/backups.py).
+
+CREATE TABLE IF NOT EXISTS backup_verifications (
+    id                BIGSERIAL PRIMARY KEY,
+    backup            TEXT NOT NULL,
+    backup_taken_at   TIMESTAMPTZ,
+    -- control or tenant, as detected after restoring; empty if the restore failed
+    database_kind     TEXT NOT NULL DEFAULT '',
+    status            TEXT NOT NULL CHECK (status IN ('succeeded', 'failed')),
+    -- [{"name": ..., "ok": ..., "detail": ...}]
+    checks            JSONB NOT NULL DEFAULT '[]',
+    error             TEXT NOT NULL DEFAULT '',
+    duration_seconds  DOUBLE PRECISION NOT NULL DEFAULT 0,
+    started_at        TIMESTAMPTZ NOT NULL,
+    finished_at       TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_backup_verifications_started_at ON backup_verifications(started_at);
@@ -0,0 +1,6 @@
+-- Migration: 008_add_tenant_lifecycle.down.sql
+
+ALTER TABLE tenants DROP COLUMN IF EXISTS archive_database;
+ALTER TABLE tenants DROP COLUMN IF EXISTS status_changed_at;
+ALTER TABLE tenants DROP COLUMN IF EXISTS status_reason;
+ALTER TABLE tenants DROP CONSTRAINT IF EXISTS tenants_status_check;
@@ -0,0 +1,14 @@
+-- Migration: 008_add_tenant_lifecycle.up.sql
+-- Tenant lifecycle: active, suspended or archived, changed through
+-- suspend_tenant, archive_tenant and reactivate_tenant (see
+-- app/service/tenant_service.py). Tenants with other statuses were set
+-- through update_tenant and are suspended.
+
+UPDATE tenants SET status = 'suspended' WHERE status NOT IN ('active', 'suspended', 'archived');
+
+ALTER TABLE tenants ADD CONSTRAINT tenants_status_check CHECK (status IN ('active', 'suspended', 'archived'));
+-- Why and when the status last changed
+ALTER TABLE tenants ADD COLUMN IF NOT EXISTS status_reason TEXT NOT NULL DEFAULT '';
+ALTER TABLE tenants ADD COLUMN IF NOT EXISTS status_changed_at TIMESTAMPTZ;
+-- Snapshot of the tenant database taken when the tenant was last archived
+ALTER TABLE tenants ADD COLUMN IF NOT EXISTS archive_database TEXT NOT NULL DEFAULT '';
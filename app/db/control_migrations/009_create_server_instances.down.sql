@@ -0,0 +1,3 @@
+-- Migration: 009_create_server_instances.down.sql
+
+DROP TABLE IF EXISTS server_instances;
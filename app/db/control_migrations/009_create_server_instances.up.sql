@@ -0,0 +1,15 @@
+-- Migration: 009_create_server_instances.up.sql
+-- Running server instances and the feature versions each supports, refreshed
+-- by heartbeats; features are only used once every live instance supports
+-- them (see app/cluster/capabilities.py).
+
+CREATE TABLE IF NOT EXISTS server_instances (
+    instance_id   TEXT PRIMARY KEY,
+    release       TEXT NOT NULL,
+    -- {"feature": version, ...}
+    features      JSONB NOT NULL DEFAULT '{}',
+    started_at    TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    heartbeat_at  TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_server_instances_heartbeat_at ON server_instances(heartbeat_at);
@@ -0,0 +1,3 @@
+-- Migration: 010_create_cluster_leases.down.sql
+
+DROP TABLE IF EXISTS cluster_leases;
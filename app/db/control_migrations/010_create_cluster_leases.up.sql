@@ -0,0 +1,11 @@
+-- Migration: 010_create_cluster_leases.up.sql
+-- Leader roles: background jobs run by one server instance at a time. The
+-- holder renews its lease with every heartbeat; an expired lease can be taken
+-- over by any instance (see app/cluster/membership.py).
+
+CREATE TABLE IF NOT EXISTS cluster_leases (
+    role          TEXT PRIMARY KEY,
+    instance_id   TEXT NOT NULL,
+    acquired_at   TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    expires_at    TIMESTAMPTZ NOT NULL
+);
@@ -0,0 +1,3 @@
+-- Migration: 011_create_tenant_quotas.down.sql
+
+DROP TABLE IF EXISTS tenant_quotas;
@@ -0,0 +1,18 @@
+-- Migration: 011_create_tenant_quotas.up.sql
+-- Request rate quotas per tenant, enforced by the rate limiting interceptor
+-- (see app/quotas/). A NULL limit falls back to the RATE_LIMIT_* default;
+-- a requests per second limit of 0 is unlimited.
+
+CREATE TABLE IF NOT EXISTS tenant_quotas (
+    tenant_id                     UUID PRIMARY KEY REFERENCES tenants(id) ON DELETE CASCADE,
+    requests_per_second           DOUBLE PRECISION CHECK (requests_per_second >= 0),
+    burst                         INTEGER CHECK (burst >= 1),
+    api_key_requests_per_second   DOUBLE PRECISION CHECK (api_key_requests_per_second >= 0),
+    api_key_burst                 INTEGER CHECK (api_key_burst >= 1),
+    updated_at                    TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+ALTER TABLE tenant_quotas ENABLE ROW LEVEL SECURITY;
+ALTER TABLE tenant_quotas FORCE ROW LEVEL SECURITY;
+DROP POLICY IF EXISTS tenant_isolation ON tenant_quotas;
+CREATE POLICY tenant_isolation ON tenant_quotas USING (flexdb_tenant_visible(tenant_id));
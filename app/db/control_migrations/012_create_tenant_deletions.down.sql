@@ -0,0 +1,6 @@
+-- Migration: 012_create_tenant_deletions.down.sql
+
+DROP TABLE IF EXISTS tenant_deletions;
+UPDATE tenants SET status = 'suspended' WHERE status = 'deleting';
+ALTER TABLE tenants DROP CONSTRAINT IF EXISTS tenants_status_check;
+ALTER TABLE tenants ADD CONSTRAINT tenants_status_check CHECK (status IN ('active', 'suspended', 'archived'));
@@ -0,0 +1,33 @@
+-- Migration: 012_create_tenant_deletions.up.sql
+-- Tenant deletions run in the background, step by step (see
+-- app/jobs/tenant_deletions.py); the tenant is deleting meanwhile. A deletion
+-- outlives its tenant, so it reports progress until the end and afterwards.
+
+ALTER TABLE tenants DROP CONSTRAINT IF EXISTS tenants_status_check;
+ALTER TABLE tenants ADD CONSTRAINT tenants_status_check
+    CHECK (status IN ('active', 'suspended', 'archived', 'deleting'));
+
+CREATE TABLE IF NOT EXISTS tenant_deletions (
+    tenant_id         UUID PRIMARY KEY,
+    slug              TEXT NOT NULL,
+    database_name     TEXT NOT NULL DEFAULT '',
+    archive_database  TEXT NOT NULL DEFAULT '',
+    status            TEXT NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'running', 'succeeded', 'failed')),
+    step              TEXT NOT NULL DEFAULT '',
+    -- Rows deleted so far by step
+    progress          JSONB NOT NULL DEFAULT '{}',
+    error             TEXT,
+    -- A running deletion not heard from since is resumed by another server instance
+    lease_until       TIMESTAMPTZ,
+    created_at        TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at        TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    finished_at       TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS idx_tenant_deletions_pending ON tenant_deletions(created_at)
+    WHERE status IN ('pending', 'running');
+
+ALTER TABLE tenant_deletions ENABLE ROW LEVEL SECURITY;
+ALTER TABLE tenant_deletions FORCE ROW LEVEL SECURITY;
+DROP POLICY IF EXISTS tenant_isolation ON tenant_deletions;
+CREATE POLICY tenant_isolation ON tenant_deletions USING (flexdb_tenant_visible(tenant_id));
@@ -0,0 +1,3 @@
+-- Migration: 013_create_user_credentials.down.sql
+
+DROP TABLE IF EXISTS user_credentials;
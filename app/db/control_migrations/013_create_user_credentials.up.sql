@@ -0,0 +1,11 @@
+-- Migration: 013_create_user_credentials.up.sql
+-- Password hashes of users who log in with email and password (see
+-- app/auth/passwords.py), apart from the users table so user reads never
+-- carry them. Users without a row can't log in.
+
+CREATE TABLE IF NOT EXISTS user_credentials (
+    user_id        UUID PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    -- argon2id PHC string, with its salt and cost parameters
+    password_hash  TEXT NOT NULL,
+    updated_at     TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
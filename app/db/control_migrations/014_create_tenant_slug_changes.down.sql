@@ -0,0 +1,3 @@
+-- Migration: 014_create_tenant_slug_changes.down.sql
+
+DROP TABLE IF EXISTS tenant_slug_changes;
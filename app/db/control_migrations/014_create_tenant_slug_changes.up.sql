@@ -0,0 +1,20 @@
+-- Migration: 014_create_tenant_slug_changes.up.sql
+-- History of tenant slug renames (see app/service/tenant_service.py), so
+-- get_tenant_by_slug still resolves the slugs clients knew a tenant by.
+
+CREATE TABLE IF NOT EXISTS tenant_slug_changes (
+    id          BIGSERIAL PRIMARY KEY,
+    tenant_id   UUID NOT NULL REFERENCES tenants(id) ON DELETE CASCADE,
+    old_slug    TEXT NOT NULL,
+    new_slug    TEXT NOT NULL,
+    actor       TEXT NOT NULL DEFAULT '',
+    changed_at  TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_tenant_slug_changes_tenant ON tenant_slug_changes(tenant_id, changed_at);
+CREATE INDEX IF NOT EXISTS idx_tenant_slug_changes_old_slug ON tenant_slug_changes(old_slug, changed_at);
+
+ALTER TABLE tenant_slug_changes ENABLE ROW LEVEL SECURITY;
+ALTER TABLE tenant_slug_changes FORCE ROW LEVEL SECURITY;
+DROP POLICY IF EXISTS tenant_isolation ON tenant_slug_changes;
+CREATE POLICY tenant_isolation ON tenant_slug_changes USING (flexdb_tenant_visible(tenant_id));
@@ -4,93 +4,464 @@ Database connection and migrations module.
 
 import asyncio
 import logging
-import os
+import math
+import random
 import ssl
+import time
+import weakref
+from collections import deque
+from dataclasses import dataclass
 from pathlib import Path
-from typing import Optional
+from typing import Callable, Deque, Dict, List, Optional, Tuple
 
 import asyncpg
 
 from app.config import Config
+from app.metrics.costs import RequestCost, current_cost
+from app.metrics.registry import metric_family
+from app.db.explain import ExplainingConnection, current_plan_capture
+from app.db.replicas import reads_use_replicas
+from app.db.migrator import applied_versions, ensure_migrations_table, migrate_up
+from app.db.migrator import migrate_down as revert_migrations
 
 logger = logging.getLogger(__name__)
 
 
+class Samples:
+    """Values observed in the last window seconds, such as waits for pooled connections."""
+
+    def __init__(self, window: float = 10.0, max_samples: int = 10000, clock: Callable[[], float] = time.monotonic):
+        self.window = window
+        self._clock = clock
+        # (observed at, value), oldest first; the oldest are dropped beyond max_samples
+        self._samples: Deque[Tuple[float, float]] = deque(maxlen=max_samples)
+
+    def add(self, value: float) -> None:
+        """Record a value observed now."""
+        self._samples.append((self._clock(), value))
+
+    def values(self) -> List[float]:
+        """Return the values observed within the window."""
+        cutoff = self._clock() - self.window
+        while self._samples and self._samples[0][0] < cutoff:
+            self._samples.popleft()
+        return [value for _, value in self._samples]
+
+    def quantile(self, q: float) -> float:
+        """Return the q-quantile (0 to 1) of the values within the window, or 0 if there are none."""
+        values = sorted(self.values())
+        if not values:
+            return 0.0
+        return values[min(len(values) - 1, int(q * len(values)))]
+
+
+# Seconds each acquire() waited for a connection, across all pools of this
+# server; load shedding reads them (see app/quotas/shedding.py)
+pool_waits = Samples()
+
+
+class _MeteredConnection:
+    """A pooled connection adding the duration and rows of its queries to a request's cost."""
+
+    def __init__(self, conn: asyncpg.Connection, cost: RequestCost):
+        self._conn = conn
+        self._cost = cost
+
+    async def fetch(self, *args, **kwargs) -> List[asyncpg.Record]:
+        rows = await self._timed(self._conn.fetch(*args, **kwargs))
+        self._cost.rows += len(rows)
+        return rows
+
+    async def fetchrow(self, *args, **kwargs) -> Optional[asyncpg.Record]:
+        row = await self._timed(self._conn.fetchrow(*args, **kwargs))
+        self._cost.rows += row is not None
+        return row
+
+    async def fetchval(self, *args, **kwargs):
+        value = await self._timed(self._conn.fetchval(*args, **kwargs))
+        self._cost.rows += value is not None
+        return value
+
+    async def execute(self, *args, **kwargs) -> str:
+        status = await self._timed(self._conn.execute(*args, **kwargs))
+        # e.g. "INSERT 0 3" or "UPDATE 2"; statuses without a count, such as "SET", don't add rows
+        count = status.rsplit(" ", 1)[-1] if isinstance(status, str) else ""
+        self._cost.rows += int(count) if count.isdigit() else 0
+        return status
+
+    async def executemany(self, *args, **kwargs) -> None:
+        await self._timed(self._conn.executemany(*args, **kwargs))
+
+    async def _timed(self, query):
+        started = time.perf_counter()
+        try:
+            return await query
+        finally:
+            self._cost.db_seconds += time.perf_counter() - started
+
+    def __getattr__(self, name: str):
+        return getattr(self._conn, name)
+
+
+# Seconds a connection's health check or closing may take
+HEALTH_CHECK_TIMEOUT = 5.0
+# Connection lifetimes are shortened by up to this fraction at random, so the
+# connections a pool opened together aren't all replaced at once
+LIFETIME_JITTER = 0.1
+
+# Connection errors after which a connection is replaced, or a replica read
+# falls back to the primary
+_CONNECTION_ERRORS = (OSError, asyncio.TimeoutError, asyncpg.PostgresConnectionError, asyncpg.InterfaceError)
+
+
+@dataclass
+class _ConnectionState:
+    # When the connection is closed on release (monotonic)
+    retire_at: float
+    # When it was last returned to the pool (monotonic)
+    released_at: float
+
+
+class _TimedAcquire:
+    def __init__(self, pool: "TimedPool", timeout: Optional[float]):
+        self._pool = pool
+        self._timeout = timeout
+        self._acquire = None
+        self._conn: Optional[asyncpg.Connection] = None
+
+    async def __aenter__(self) -> asyncpg.Connection:
+        started = time.perf_counter()
+        self._acquire = self._pool._pool.acquire(timeout=self._timeout)
+        conn = await self._acquire.__aenter__()
+        if not await self._pool._check(conn):
+            # The pool replaces the broken connection, which was closed
+            await self._acquire.__aexit__(None, None, None)
+            self._acquire = self._pool._pool.acquire(timeout=self._timeout)
+            conn = await self._acquire.__aenter__()
+        self._conn = conn
+        wait = time.perf_counter() - started
+        pool_waits.add(wait)
+        self._pool.acquires += 1
+        self._pool.wait_seconds += wait
+        capture = current_plan_capture()
+        if capture:
+            conn = ExplainingConnection(conn, capture)
+        cost = current_cost()
+        return _MeteredConnection(conn, cost) if cost else conn
+
+    async def __aexit__(self, *exc_info) -> None:
+        await self._pool._release(self._conn)
+        await self._acquire.__aexit__(*exc_info)
+
+
+class TimedPool:
+    """
+    An asyncpg pool recording in pool_waits how long "async with acquire()"
+    waits for a connection; during metered requests, the connection it yields
+    adds its queries to the request's cost (see app/metrics/costs.py), and
+    during plan captures it explains them (see app/db/explain.py).
+
+    With a max_lifetime, connections are closed when released after living
+    that long (less a random LIFETIME_JITTER), so the server sees new ones
+    gradually rather than all at once. With a health_check_period, connections
+    idle for that long are checked with "SELECT 1" when acquired, and broken
+    ones are replaced.
+    """
+
+    def __init__(
+        self,
+        pool: asyncpg.Pool,
+        role: str = "",
+        max_lifetime: float = 0.0,
+        health_check_period: float = 0.0,
+        max_idle_time: float = 0.0,
+        clock: Callable[[], float] = time.monotonic,
+    ):
+        self._pool = pool
+        # Kind of database the pool connects to, as labeled in pool metrics
+        self.role = role
+        self.max_lifetime = max_lifetime
+        self.health_check_period = health_check_period
+        # Seconds after which asyncpg closes idle connections
+        self.max_idle_time = max_idle_time
+        self._clock = clock
+        # Server process ID of each connection seen -> its state
+        self._connections: Dict[int, _ConnectionState] = {}
+        self.acquires = 0
+        self.wait_seconds = 0.0
+        # Connections closed by this pool, by reason
+        self.retired: Dict[str, int] = {"lifetime": 0, "health_check": 0}
+
+    def acquire(self, *, timeout: Optional[float] = None) -> _TimedAcquire:
+        return _TimedAcquire(self, timeout)
+
+    async def _check(self, conn: asyncpg.Connection) -> bool:
+        """Return whether an acquired connection is usable; closes it if it is broken."""
+        if not self.max_lifetime and not self.health_check_period:
+            return True
+        now = self._clock()
+        pid = conn.get_server_pid()
+        state = self._connections.get(pid)
+        if state is None:
+            self._forget_idle(now)
+            lifetime = self.max_lifetime * (1 - random.random() * LIFETIME_JITTER) if self.max_lifetime else math.inf
+            self._connections[pid] = _ConnectionState(retire_at=now + lifetime, released_at=now)
+            return True
+        if not self.health_check_period or now - state.released_at < self.health_check_period:
+            return True
+        try:
+            await conn.execute("SELECT 1", timeout=HEALTH_CHECK_TIMEOUT)
+            return True
+        except _CONNECTION_ERRORS as e:
+            logger.warning(f"Replacing broken {self.role or 'database'} connection: {e}")
+            del self._connections[pid]
+            self.retired["health_check"] += 1
+            conn.terminate()
+            return False
+
+    async def _release(self, conn: asyncpg.Connection) -> None:
+        """Record a connection's release, closing it if it outlived max_lifetime."""
+        if not self.max_lifetime and not self.health_check_period:
+            return
+        pid = conn.get_server_pid()
+        state = self._connections.get(pid)
+        if state is None or conn.is_closed():
+            self._connections.pop(pid, None)
+            return
+        now = self._clock()
+        if now < state.retire_at:
+            state.released_at = now
+            return
+        del self._connections[pid]
+        self.retired["lifetime"] += 1
+        try:
+            await conn.close(timeout=HEALTH_CHECK_TIMEOUT)
+        except Exception:
+            conn.terminate()
+
+    def _forget_idle(self, now: float) -> None:
+        # Connections idle beyond max_idle_time were closed by asyncpg
+        if self.max_idle_time:
+            for pid, state in list(self._connections.items()):
+                if now - state.released_at > self.max_idle_time:
+                    del self._connections[pid]
+
+    def __getattr__(self, name: str):
+        return getattr(self._pool, name)
+
+
+class _ReplicaAcquire:
+    def __init__(self, replica: TimedPool, primary: TimedPool, timeout: Optional[float]):
+        self._replica = replica
+        self._primary = primary
+        self._timeout = timeout
+        self._acquire: Optional[_TimedAcquire] = None
+
+    async def __aenter__(self) -> asyncpg.Connection:
+        self._acquire = self._replica.acquire(timeout=self._timeout)
+        try:
+            return await self._acquire.__aenter__()
+        except _CONNECTION_ERRORS as e:
+            logger.warning(f"Read replica unavailable, reading from the primary: {e}")
+            self._acquire = self._primary.acquire(timeout=self._timeout)
+            return await self._acquire.__aenter__()
+
+    async def __aexit__(self, *exc_info) -> None:
+        await self._acquire.__aexit__(*exc_info)
+
+
+class ReplicaPool:
+    """A replica's pool, falling back to the primary's when no replica connection can be had."""
+
+    def __init__(self, replica: TimedPool, primary: TimedPool):
+        self.replica = replica
+        self.primary = primary
+
+    def acquire(self, *, timeout: Optional[float] = None) -> _ReplicaAcquire:
+        return _ReplicaAcquire(self.replica, self.primary, timeout)
+
+
 class Database:
-    """Database connection pool wrapper."""
+    """Database connection pool wrapper, with pools on its read replicas if any."""
+
+    def __init__(self, pool: asyncpg.Pool, replicas: Optional[List[asyncpg.Pool]] = None):
+        self.pool = pool if isinstance(pool, TimedPool) else TimedPool(pool)
+        self.replicas = [
+            replica if isinstance(replica, TimedPool) else TimedPool(replica) for replica in replicas or []
+        ]
+        self._next_replica = 0
+        self._extensions: Dict[str, bool] = {}
 
-    def __init__(self, pool: asyncpg.Pool):
-        self.pool = pool
+    @property
+    def read_pool(self):
+        """
+        Pool of read-only queries: within replica reads (see app/db/replicas.py)
+        the next replica's in turn, otherwise the primary's.
+        """
+        if not self.replicas or not reads_use_replicas():
+            return self.pool
+        replica = self.replicas[self._next_replica % len(self.replicas)]
+        self._next_replica += 1
+        return ReplicaPool(replica, self.pool)
+
+    async def has_extension(self, name: str) -> bool:
+        """Check whether a PostgreSQL extension is installed (cached per pool)."""
+        if name not in self._extensions:
+            async with self.pool.acquire() as conn:
+                installed = await conn.fetchval(
+                    "SELECT 1 FROM pg_extension WHERE extname = $1",
+                    name
+                )
+            self._extensions[name] = bool(installed)
+        return self._extensions[name]
 
     async def close(self):
-        """Close the database connection pool."""
+        """Close the database connection pools."""
+        for replica in self.replicas:
+            await replica.close()
         await self.pool.close()
 
 
+def ssl_param(cfg: Config):
+    """Map the SSL mode to asyncpg's ssl parameter ("disable" is None)."""
+    if cfg.ssl_mode in ("require", "prefer"):
+        return cfg.ssl_mode
+    if cfg.ssl_mode in ("verify-ca", "verify-full"):
+        return ssl.create_default_context()
+    return None
+
+
+# Pools opened with create_pool, whose statistics pool_metric_lines renders
+_pools: "weakref.WeakSet[TimedPool]" = weakref.WeakSet()
+
+
+async def create_pool(cfg: Config, role: str, max_size: int = 0, **kwargs) -> TimedPool:
+    """
+    Open a pool with the pool settings and SSL mode of cfg; kwargs are those
+    of asyncpg.create_pool (host, database, setup, ...). Its statistics are
+    exported labeled with role.
+    """
+    max_size = max_size or cfg.pool_max_size
+    pool = await asyncpg.create_pool(
+        min_size=min(cfg.pool_min_size, max_size),
+        max_size=max_size,
+        max_inactive_connection_lifetime=cfg.pool_max_idle_time,
+        ssl=ssl_param(cfg),
+        **kwargs,
+    )
+    timed = TimedPool(pool, role, cfg.pool_max_lifetime, cfg.pool_health_check_period, cfg.pool_max_idle_time)
+    _pools.add(timed)
+    return timed
+
+
+def pool_metric_lines(openmetrics: bool = False) -> List[str]:
+    """Render the statistics of the open pools, summed per role, in the Prometheus or OpenMetrics text format."""
+    def family(name: str, metric_type: str, help_text: str) -> List[str]:
+        return metric_family(name, metric_type, help_text, openmetrics)
+
+    pools: Dict[str, List[TimedPool]] = {}
+    for pool in list(_pools):
+        if not pool.is_closing():
+            pools.setdefault(pool.role, []).append(pool)
+    roles = sorted(pools)
+
+    lines = family("flexdb_db_pools", "gauge", "Open connection pools.")
+    lines += [f'flexdb_db_pools{{role="{role}"}} {len(pools[role])}' for role in roles]
+    lines += family("flexdb_db_pool_connections", "gauge", "Pooled connections, idle or in use.")
+    for role in roles:
+        size = sum(pool.get_size() for pool in pools[role])
+        idle = sum(pool.get_idle_size() for pool in pools[role])
+        lines.append(f'flexdb_db_pool_connections{{role="{role}",state="idle"}} {idle}')
+        lines.append(f'flexdb_db_pool_connections{{role="{role}",state="in_use"}} {size - idle}')
+    lines += family("flexdb_db_pool_max_connections", "gauge", "Connections the pools may open.")
+    lines += [
+        f'flexdb_db_pool_max_connections{{role="{role}"}} {sum(pool.get_max_size() for pool in pools[role])}'
+        for role in roles
+    ]
+    lines += family("flexdb_db_pool_acquires_total", "counter", "Connections acquired from the pools.")
+    lines += [
+        f'flexdb_db_pool_acquires_total{{role="{role}"}} {sum(pool.acquires for pool in pools[role])}'
+        for role in roles
+    ]
+    lines += family("flexdb_db_pool_wait_seconds_total", "counter", "Seconds spent waiting for pooled connections.")
+    lines += [
+        f'flexdb_db_pool_wait_seconds_total{{role="{role}"}} {sum(pool.wait_seconds for pool in pools[role])!r}'
+        for role in roles
+    ]
+    lines += family(
+        "flexdb_db_pool_connections_retired_total", "counter", "Connections closed by the pools, by reason."
+    )
+    for role in roles:
+        for reason in ("lifetime", "health_check"):
+            retired = sum(pool.retired[reason] for pool in pools[role])
+            lines.append(f'flexdb_db_pool_connections_retired_total{{role="{role}",reason="{reason}"}} {retired}')
+    return lines
+
+
+async def connect_replicas(cfg: Config, database: str, setup=None) -> List[TimedPool]:
+    """
+    Connect to a database on each read replica of DB_REPLICA_HOSTS, in
+    read-only sessions. Replicas that can't be reached are left out.
+    """
+    replicas = []
+    for host, port in cfg.replica_addresses():
+        try:
+            pool = await create_pool(
+                cfg,
+                "replica",
+                max_size=cfg.replica_pool_max_size,
+                host=host,
+                port=port,
+                user=cfg.user,
+                password=cfg.password,
+                database=database,
+                setup=setup,
+                server_settings={
+                    "application_name": "flexdb-replica",
+                    "default_transaction_read_only": "on",
+                },
+            )
+        except Exception as e:
+            logger.warning(f"Failed to connect to database {database} on replica {host}:{port}: {e}")
+            continue
+        replicas.append(pool)
+    return replicas
+
+
 async def connect(cfg: Config) -> Database:
     """Create a new database connection pool."""
     try:
-        # Map SSL mode to asyncpg ssl parameter
-        ssl_context = None
-        if cfg.ssl_mode == "require":
-            ssl_context = "require"
-        elif cfg.ssl_mode == "prefer":
-            ssl_context = "prefer"
-        elif cfg.ssl_mode == "verify-ca" or cfg.ssl_mode == "verify-full":
-            ssl_context = ssl.create_default_context()
-        # "disable" is the default (ssl_context = None)
-
-        pool = await asyncpg.create_pool(
+        pool = await create_pool(
+            cfg,
+            "legacy",
             host=cfg.host,
             port=cfg.port,
             user=cfg.user,
             password=cfg.password,
             database=cfg.db_name,
-            min_size=1,
-            max_size=10,
-            ssl=ssl_context,
         )
         # Test the connection
         async with pool.acquire() as conn:
             await conn.execute("SELECT 1")
         
-        return Database(pool)
+        return Database(pool, await connect_replicas(cfg, cfg.db_name))
     except Exception as e:
         raise Exception(f"Failed to connect to database: {e}") from e
 
 
-async def run_migrations(db: Database) -> None:
-    """Apply all SQL migrations."""
+MIGRATIONS_DIR = Path(__file__).parent / "migrations"
+
+
+async def run_migrations(db: Database, target_version: Optional[int] = None) -> None:
+    """Apply all SQL migrations, or those up to target_version."""
     async with db.pool.acquire() as conn:
-        # Create migrations tracking table
-        await conn.execute("""
-            CREATE TABLE IF NOT EXISTS schema_migrations (
-                version TEXT PRIMARY KEY,
-                applied_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
-            )
-        """)
-
-        # Get already applied migrations
-        rows = await conn.fetch("SELECT version FROM schema_migrations")
-        applied = {row["version"] for row in rows}
-
-        # Read and apply migrations
-        migrations_dir = Path(__file__).parent / "migrations"
-        up_files = sorted([f for f in os.listdir(migrations_dir) if f.endswith(".up.sql")])
-
-        for filename in up_files:
-            version = filename.replace(".up.sql", "")
-            if version in applied:
-                logger.info(f"Migration {version} already applied, skipping")
-                continue
-
-            logger.info(f"Applying migration {version}")
-            content = (migrations_dir / filename).read_text()
-            
-            # Execute the migration in a transaction
-            async with conn.transaction():
-                await conn.execute(content)
-                await conn.execute(
-                    "INSERT INTO schema_migrations (version) VALUES ($1)",
-                    version
-                )
+        await ensure_migrations_table(conn)
+        applied = await applied_versions(conn)
+        await migrate_up(conn, MIGRATIONS_DIR, applied, target_version)
+
+
+async def migrate_down(db: Database, target_version: int) -> List[str]:
+    """Roll back SQL migrations newer than target_version using their down scripts."""
+    async with db.pool.acquire() as conn:
+        await ensure_migrations_table(conn)
+        return await revert_migrations(conn, MIGRATIONS_DIR, target_version)
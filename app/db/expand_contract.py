@@ -0,0 +1,232 @@
+"""
+Expand/contract schema changes, for rolling out migrations without downtime.
+
+During a blue/green or rolling deployment, servers of the old and the new
+release share the same databases, so a breaking change such as renaming a
+column is split into steps that each keep both releases working:
+
+1. Expand: a migration adds the new structure next to the old one and names
+   the change in a directive at the top of the up file:
+
+       -- flexdb:expand nodes_title
+
+   Applying it opens the change's dual-write window: the new release writes
+   both the old and the new structure while dual_write_enabled() is true, so
+   servers of the old release keep seeing complete data.
+
+2. Backfill: a Backfill registered for the change copies existing rows in
+   batches (`python main.py --backfill nodes_title`).
+
+3. Once no server of the old release runs, the window is closed
+   (`python main.py --end-dual-write nodes_title`) and the new release only
+   writes the new structure.
+
+4. Contract: a migration of a later release removes the old structure:
+
+       -- flexdb:contract nodes_title
+
+   Contract migrations are not applied at startup, only with
+   `python main.py --contract`, and only once the change was backfilled (if it
+   has a registered backfill) and its dual-write window is closed.
+
+The state of every change is kept in the schema_changes table of each
+database, next to schema_migrations.
+"""
+
+import logging
+from dataclasses import dataclass
+from pathlib import Path
+from typing import Awaitable, Callable, Dict, Optional, Tuple
+
+import asyncpg
+
+logger = logging.getLogger(__name__)
+
+DIRECTIVE_PREFIX = "-- flexdb:"
+EXPAND = "expand"
+CONTRACT = "contract"
+
+CONTROL = "control"
+TENANT = "tenant"
+
+
+@dataclass
+class Backfill:
+    """
+    A batched UPDATE copying existing rows into an expanded structure.
+
+    where_sql must stop matching a row once it was backfilled, so the job can
+    be interrupted and resumed and ends when no row matches.
+    """
+    change: str
+    table: str
+    # SET clause, e.g. "title = data->>'title'"
+    set_sql: str
+    # Rows still to backfill, e.g. "title IS NULL AND data ? 'title'"
+    where_sql: str
+    # Databases holding the table: "tenant" or "control"
+    database: str = TENANT
+    key: str = "id"
+
+
+# Backfills by change name, registered by the modules whose expand migrations need one
+BACKFILLS: Dict[str, Backfill] = {}
+
+
+def register_backfill(backfill: Backfill) -> Backfill:
+    """Register the backfill of an expand/contract change."""
+    if backfill.database not in (CONTROL, TENANT):
+        raise ValueError(f"backfill database must be {CONTROL} or {TENANT}: {backfill.database}")
+    BACKFILLS[backfill.change] = backfill
+    return backfill
+
+
+def parse_directives(path: Path) -> Tuple[str, str]:
+    """
+    Return the changes a migration expands and contracts, from the
+    "-- flexdb:expand NAME" and "-- flexdb:contract NAME" directives in the
+    comment lines at the top of its up file ("" if none).
+    """
+    directives = {EXPAND: "", CONTRACT: ""}
+    with open(path) as f:
+        for line in f:
+            line = line.strip()
+            if not line:
+                continue
+            if not line.startswith("--"):
+                break
+            if not line.startswith(DIRECTIVE_PREFIX):
+                continue
+            kind, _, name = line[len(DIRECTIVE_PREFIX):].partition(" ")
+            if kind not in directives or not name.strip():
+                raise ValueError(f"invalid migration directive in {path.name}: {line}")
+            directives[kind] = name.strip()
+    if directives[EXPAND] and directives[CONTRACT]:
+        raise ValueError(f"migration {path.name} can't both expand and contract")
+    return directives[EXPAND], directives[CONTRACT]
+
+
+async def ensure_changes_table(conn: asyncpg.Connection) -> None:
+    """Create the schema_changes tracking table if it does not exist."""
+    await conn.execute("""
+        CREATE TABLE IF NOT EXISTS schema_changes (
+            name TEXT PRIMARY KEY,
+            dual_write BOOLEAN NOT NULL DEFAULT TRUE,
+            backfilled_rows BIGINT NOT NULL DEFAULT 0,
+            backfilled_at TIMESTAMPTZ,
+            contracted_at TIMESTAMPTZ,
+            updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+        )
+    """)
+
+
+async def open_change(conn: asyncpg.Connection, name: str) -> None:
+    """Record an expanded change with its dual-write window open."""
+    await conn.execute(
+        "INSERT INTO schema_changes (name) VALUES ($1) ON CONFLICT (name) DO NOTHING", name
+    )
+
+
+async def check_contract_ready(conn: asyncpg.Connection, name: str) -> None:
+    """Raise ValueError unless the change was expanded, backfilled if it has a backfill, and its window closed."""
+    row = await conn.fetchrow("SELECT dual_write, backfilled_at FROM schema_changes WHERE name = $1", name)
+    if row is None:
+        raise ValueError(f"change {name} was never expanded")
+    if name in BACKFILLS and row["backfilled_at"] is None:
+        raise ValueError(f"change {name} is not backfilled yet (run --backfill {name})")
+    if row["dual_write"]:
+        raise ValueError(f"change {name} is still dual-writing (run --end-dual-write {name})")
+
+
+async def contract_change(conn: asyncpg.Connection, name: str) -> None:
+    """Record a change as contracted."""
+    await conn.execute(
+        "UPDATE schema_changes SET contracted_at = NOW(), updated_at = NOW() WHERE name = $1", name
+    )
+
+
+async def revert_change(conn: asyncpg.Connection, expands: str, contracts: str) -> None:
+    """Undo the record of a migration's directives when it is reverted."""
+    if expands:
+        await conn.execute("DELETE FROM schema_changes WHERE name = $1", expands)
+    if contracts:
+        await conn.execute(
+            "UPDATE schema_changes SET contracted_at = NULL, updated_at = NOW() WHERE name = $1", contracts
+        )
+
+
+async def dual_write_enabled(conn: asyncpg.Connection, name: str) -> bool:
+    """
+    Return whether writes must keep the old structure of a change up to date.
+
+    True until the window is closed, and also while the expand migration is
+    not applied yet, so a new release never stops writing too early.
+    """
+    enabled = await conn.fetchval("SELECT dual_write FROM schema_changes WHERE name = $1", name)
+    return enabled is None or enabled
+
+
+async def end_dual_write(conn: asyncpg.Connection, name: str) -> bool:
+    """Close the dual-write window of a change; returns False if it was not expanded in this database."""
+    result = await conn.execute(
+        "UPDATE schema_changes SET dual_write = FALSE, updated_at = NOW() WHERE name = $1", name
+    )
+    return result != "UPDATE 0"
+
+
+async def run_backfill(
+    conn: asyncpg.Connection,
+    backfill: Backfill,
+    batch_size: int = 1000,
+    on_batch: Optional[Callable[[int, Optional[int]], Awaitable[bool]]] = None
+) -> int:
+    """
+    Run a backfill to completion, batch_size rows per transaction, and mark
+    the change backfilled. Returns the number of rows updated.
+
+    on_batch follows the progress like a BatchHook (see
+    app/repository/models.py) and may stop the backfill between batches;
+    the change is then not marked backfilled, and running the backfill again
+    resumes it.
+    """
+    if await conn.fetchval("SELECT 1 FROM schema_changes WHERE name = $1", backfill.change) is None:
+        raise ValueError(f"change {backfill.change} was never expanded")
+
+    remaining = 0
+    if on_batch:
+        remaining = await conn.fetchval(f"SELECT COUNT(*) FROM {backfill.table} WHERE {backfill.where_sql}")
+        if not await on_batch(0, remaining):
+            return 0
+
+    query = f"""
+        UPDATE {backfill.table} SET {backfill.set_sql}
+        WHERE {backfill.key} IN (
+            SELECT {backfill.key} FROM {backfill.table} WHERE {backfill.where_sql}
+            LIMIT $1
+            FOR UPDATE
+        )
+    """
+
+    total = 0
+    while True:
+        async with conn.transaction():
+            result = await conn.execute(query, batch_size)
+            count = int(result.split()[-1])
+            await conn.execute(
+                "UPDATE schema_changes SET backfilled_rows = backfilled_rows + $2, updated_at = NOW() WHERE name = $1",
+                backfill.change, count
+            )
+        total += count
+        if count < batch_size:
+            if on_batch:
+                await on_batch(total, max(remaining, total))
+            break
+        if on_batch and not await on_batch(total, max(remaining, total)):
+            logger.info(f"Backfill of {backfill.table} for change {backfill.change} stopped after {total} rows")
+            return total
+
+    await conn.execute(
+        "UPDATE schema_changes SET backfilled_at = NOW(), updated_at = NOW() WHERE name = $1", backfill.change
+    )
+    logger.info(f"Backfilled {total} rows of {backfill.table} for change {backfill.change}")
+    return total
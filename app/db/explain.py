@@ -0,0 +1,113 @@
+"""
+Query plans of the SELECT statements a call runs, for explain_query.
+
+Within plan_capture, connections acquired from a TimedPool (see
+app/db/database.py) explain every SELECT they fetch before running it as
+usual: EXPLAIN (ANALYZE, BUFFERS, FORMAT JSON) runs in a savepoint that is
+rolled back, with statement_timeout set to the capture's timeout, so a slow
+plan fails on its own instead of holding the connection. At most MAX_PLANS
+statements are explained per capture. With analyze off, plans are estimated
+without running the statement.
+
+The statement itself still runs afterwards, so a captured call returns its
+result as usual and takes about twice as long.
+"""
+
+import json
+from contextlib import contextmanager
+from contextvars import ContextVar
+from dataclasses import dataclass, field
+from typing import Any, Dict, Iterator, List, Optional
+
+import asyncpg
+
+# Statements explained per capture
+MAX_PLANS = 20
+
+
+@dataclass
+class QueryPlan:
+    """The plan of one statement, or why it couldn't be explained."""
+    query: str
+    plan: Any = None  # the JSON plan Postgres returned
+    error: str = ""
+
+    def to_dict(self) -> Dict[str, Any]:
+        result: Dict[str, Any] = {"query": self.query, "plan": self.plan}
+        if self.error:
+            result["error"] = self.error
+        return result
+
+
+@dataclass
+class PlanCapture:
+    """Plans of the statements run while the capture is active."""
+    analyze: bool = True
+    timeout: float = 5.0
+    plans: List[QueryPlan] = field(default_factory=list)
+    # Whether statements beyond MAX_PLANS went unexplained
+    truncated: bool = False
+
+
+_capture: ContextVar[Optional[PlanCapture]] = ContextVar("flexdb_plan_capture", default=None)
+
+
+@contextmanager
+def plan_capture(analyze: bool = True, timeout: float = 5.0) -> Iterator[PlanCapture]:
+    """Explain the statements run in the current context within the with block."""
+    capture = PlanCapture(analyze=analyze, timeout=timeout)
+    token = _capture.set(capture)
+    try:
+        yield capture
+    finally:
+        _capture.reset(token)
+
+
+def current_plan_capture() -> Optional[PlanCapture]:
+    """Return the active plan capture, or None."""
+    return _capture.get()
+
+
+class ExplainingConnection:
+    """A pooled connection explaining the SELECT statements it fetches into a plan capture."""
+
+    def __init__(self, conn: asyncpg.Connection, capture: PlanCapture):
+        self._conn = conn
+        self._capture = capture
+
+    async def fetch(self, query: str, *args, **kwargs) -> List[asyncpg.Record]:
+        await self._explain(query, args)
+        return await self._conn.fetch(query, *args, **kwargs)
+
+    async def fetchrow(self, query: str, *args, **kwargs) -> Optional[asyncpg.Record]:
+        await self._explain(query, args)
+        return await self._conn.fetchrow(query, *args, **kwargs)
+
+    async def fetchval(self, query: str, *args, **kwargs):
+        await self._explain(query, args)
+        return await self._conn.fetchval(query, *args, **kwargs)
+
+    async def _explain(self, query: str, args: tuple) -> None:
+        # Only reads are explained: EXPLAIN ANALYZE runs the statement
+        if not query.lstrip().upper().startswith("SELECT"):
+            return
+        if len(self._capture.plans) >= MAX_PLANS:
+            self._capture.truncated = True
+            return
+
+        options = "ANALYZE, BUFFERS, FORMAT JSON" if self._capture.analyze else "FORMAT JSON"
+        plan = QueryPlan(query=" ".join(query.split()))
+        savepoint = self._conn.transaction()
+        await savepoint.start()
+        try:
+            await self._conn.execute(f"SET LOCAL statement_timeout = {max(1, int(self._capture.timeout * 1000))}")
+            explained = await self._conn.fetchval(f"EXPLAIN ({options}) {query}", *args)
+            plan.plan = json.loads(explained) if isinstance(explained, str) else explained
+        except asyncpg.PostgresError as e:
+            plan.error = str(e)
+        finally:
+            await savepoint.rollback()
+        self._capture.plans.append(plan)
+
+    def __getattr__(self, name: str):
+        return getattr(self._conn, name)
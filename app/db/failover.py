@@ -0,0 +1,199 @@
+"""
+Failover: promote the standby to primary in one command.
+
+`python main.py --promote-standby --reason "..."`:
+
+1. promotes the standby at FAILOVER_STANDBY_HOST with pg_promote(), unless
+   it already left recovery (so an interrupted failover can be rerun),
+2. fences the old primary: if it still answers, ALTER SYSTEM sets
+   default_transaction_read_only so it rejects writes from clients that still
+   reach it, and it is listed as fenced in the routing file either way,
+3. writes the routing file FAILOVER_ROUTING_FILE naming the new primary,
+4. records a cluster.failover event in the promoted control database's audit log.
+
+Servers read the routing file at startup in place of DB_HOST and DB_PORT and
+refuse to start against a fenced primary, so they have to be restarted after
+a failover. A fenced server is only used again once it was rebuilt as a
+standby and promoted back. Fencing takes a superuser (or a role granted
+ALTER SYSTEM on default_transaction_read_only), and so does pg_promote()
+unless it was granted EXECUTE on it.
+"""
+
+import asyncio
+import json
+import logging
+import os
+import ssl
+import tempfile
+from dataclasses import replace
+from datetime import datetime
+from typing import Any, Dict, Optional
+
+import asyncpg
+
+from app.config import Config, FailoverConfig
+
+logger = logging.getLogger(__name__)
+
+FENCED = "fenced"
+UNREACHABLE = "unreachable"
+
+
+def _server(host: str, port: int) -> Dict[str, Any]:
+    return {"host": host, "port": port}
+
+
+def read_routing(path: str) -> Optional[Dict[str, Any]]:
+    """Return the contents of the routing file, or None if there is none."""
+    if not path or not os.path.exists(path):
+        return None
+    with open(path) as f:
+        routing = json.load(f)
+    if not isinstance(routing, dict) or not isinstance(routing.get("primary"), dict):
+        raise ValueError(f"routing file {path} does not name a primary")
+    return routing
+
+
+def apply_routing(cfg: Config, failover_cfg: FailoverConfig) -> Config:
+    """
+    Return cfg pointing at the primary named by the routing file, if there is
+    one. Raises ValueError if the resulting primary is fenced.
+    """
+    routing = read_routing(failover_cfg.routing_file)
+    if routing is None:
+        return cfg
+
+    primary = routing["primary"]
+    routed = replace(cfg, host=primary["host"], port=int(primary.get("port", 5432)))
+    if _server(routed.host, routed.port) in routing.get("fenced", []):
+        raise ValueError(f"primary {routed.host}:{routed.port} is fenced in {failover_cfg.routing_file}")
+    if (routed.host, routed.port) != (cfg.host, cfg.port):
+        logger.info(f"Routing to primary {routed.host}:{routed.port} from {failover_cfg.routing_file}")
+    return routed
+
+
+def next_routing(
+    previous: Optional[Dict[str, Any]],
+    old_primary: Dict[str, Any],
+    new_primary: Dict[str, Any],
+    reason: str,
+    promoted_at: datetime,
+) -> Dict[str, Any]:
+    """Return the routing after promoting new_primary: old_primary joins the fenced servers, new_primary leaves them."""
+    fenced = [server for server in (previous or {}).get("fenced", []) if server != new_primary]
+    if old_primary not in fenced:
+        fenced.append(old_primary)
+    return {
+        "primary": new_primary,
+        "fenced": fenced,
+        "previous_primary": old_primary,
+        "promoted_at": promoted_at.isoformat(),
+        "reason": reason,
+    }
+
+
+def write_routing(path: str, routing: Dict[str, Any]) -> None:
+    """Replace the routing file atomically, so servers starting meanwhile read either version."""
+    directory = os.path.dirname(os.path.abspath(path))
+    fd, tmp = tempfile.mkstemp(dir=directory, prefix=".routing-")
+    try:
+        with os.fdopen(fd, "w") as f:
+            json.dump(routing, f, indent=2)
+            f.flush()
+            os.fsync(f.fileno())
+        os.replace(tmp, path)
+    except BaseException:
+        os.unlink(tmp)
+        raise
+
+
+def _ssl_context(ssl_mode: str):
+    if ssl_mode in ("require", "prefer"):
+        return ssl_mode
+    if ssl_mode in ("verify-ca", "verify-full"):
+        return ssl.create_default_context()
+    return None
+
+
+async def _connect(cfg: Config, host: str, port: int, timeout: float) -> asyncpg.Connection:
+    return await asyncpg.connect(
+        host=host,
+        port=port,
+        user=cfg.user,
+        password=cfg.password,
+        database="postgres",
+        ssl=_ssl_context(cfg.ssl_mode),
+        timeout=timeout,
+    )
+
+
+async def promote(cfg: Config, failover_cfg: FailoverConfig) -> bool:
+    """Promote the standby; returns False if it already was a primary."""
+    conn = await _connect(cfg, failover_cfg.standby_host, failover_cfg.standby_port, failover_cfg.timeout)
+    try:
+        if not await conn.fetchval("SELECT pg_is_in_recovery()"):
+            return False
+        if not await conn.fetchval(
+            "SELECT pg_promote(wait => true, wait_seconds => $1)", max(1, int(failover_cfg.timeout))
+        ):
+            raise RuntimeError(f"standby did not finish promotion within {failover_cfg.timeout:g} seconds")
+        return True
+    finally:
+        await conn.close()
+
+
+async def fence(cfg: Config, host: str, port: int, timeout: float) -> str:
+    """
+    Make the old primary reject writes; returns "fenced", or "unreachable:
+    <error>" if it can't be reached, which is expected when it failed.
+    """
+    try:
+        conn = await _connect(cfg, host, port, timeout)
+    except (OSError, asyncio.TimeoutError, asyncpg.PostgresError) as e:
+        return f"{UNREACHABLE}: {e}"
+    try:
+        await conn.execute("ALTER SYSTEM SET default_transaction_read_only = on")
+        await conn.execute("SELECT pg_reload_conf()")
+        # Sessions inside a transaction keep writing until it ends; end them
+        await conn.execute(
+            "SELECT pg_terminate_backend(pid) FROM pg_stat_activity "
+            "WHERE backend_type = 'client backend' AND pid <> pg_backend_pid()"
+        )
+    finally:
+        await conn.close()
+    return FENCED
+
+
+async def promote_standby(cfg: Config, failover_cfg: FailoverConfig, reason: str, now: datetime) -> Dict[str, Any]:
+    """
+    Promote the standby, fence the current primary and route to the standby
+    (see the module docstring); returns the new routing with the outcome of
+    each step. cfg is the configuration before routing is applied.
+    """
+    if not failover_cfg.standby_host:
+        raise ValueError("FAILOVER_STANDBY_HOST is required")
+    if not failover_cfg.routing_file:
+        raise ValueError("FAILOVER_ROUTING_FILE is required")
+    if not reason:
+        raise ValueError("a reason is required")
+
+    previous = read_routing(failover_cfg.routing_file)
+    current = previous["primary"] if previous else _server(cfg.host, cfg.port)
+    old_primary = _server(current["host"], int(current.get("port", 5432)))
+    new_primary = _server(failover_cfg.standby_host, failover_cfg.standby_port)
+    if old_primary == new_primary:
+        raise ValueError(f"standby {new_primary['host']}:{new_primary['port']} already is the primary")
+
+    promoted = await promote(cfg, failover_cfg)
+    logger.info(
+        f"Standby {new_primary['host']}:{new_primary['port']} "
+        f"{'promoted' if promoted else 'already was promoted'}"
+    )
+    fencing = await fence(cfg, old_primary["host"], old_primary["port"], failover_cfg.timeout)
+    logger.info(f"Old primary {old_primary['host']}:{old_primary['port']}: {fencing}")
+
+    routing = next_routing(previous, old_primary, new_primary, reason, now)
+    write_routing(failover_cfg.routing_file, routing)
+    logger.info(f"Routing file {failover_cfg.routing_file} now names {new_primary['host']}:{new_primary['port']}")
+
+    return {**routing, "promoted": promoted, "fencing": fencing}
@@ -0,0 +1,4 @@
+-- Migration: 001_create_tenants.down.sql
+-- Drop tenants table
+
+DROP TABLE IF EXISTS tenants;
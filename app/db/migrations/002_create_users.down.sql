@@ -0,0 +1,5 @@
+-- Migration: 002_create_users.down.sql
+-- Drop tenant_users and users tables
+
+DROP TABLE IF EXISTS tenant_users;
+DROP TABLE IF EXISTS users;
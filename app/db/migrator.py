@@ -0,0 +1,167 @@
+"""
+Migration runner shared by the control, tenant and legacy databases.
+
+Migrations are NNN_name.up.sql files applied in version order and recorded in
+the database's schema_migrations table. A migration can be rolled back if a
+matching NNN_name.down.sql file exists; migrate_down reverts newest first.
+Contract migrations of expand/contract changes are only applied when asked
+for (see app/db/expand_contract.py).
+"""
+
+import logging
+import os
+from dataclasses import dataclass
+from pathlib import Path
+from typing import Iterable, List, Optional
+
+import asyncpg
+
+from app.db.expand_contract import (
+    check_contract_ready,
+    contract_change,
+    ensure_changes_table,
+    open_change,
+    parse_directives,
+    revert_change,
+)
+
+logger = logging.getLogger(__name__)
+
+
+@dataclass
+class Migration:
+    """A migration file pair."""
+    version: str  # file name without suffix, e.g. 007_add_node_type_display
+    number: int
+    up_path: Path
+    down_path: Optional[Path] = None
+    # Expand/contract change the migration expands or contracts, if any
+    expands: str = ""
+    contracts: str = ""
+
+
+def list_migrations(migrations_dir: Path) -> List[Migration]:
+    """List migrations in a directory, in version order."""
+    migrations = []
+    for filename in sorted(os.listdir(migrations_dir)):
+        if not filename.endswith(".up.sql"):
+            continue
+        version = filename[:-len(".up.sql")]
+        down_path = migrations_dir / f"{version}.down.sql"
+        expands, contracts = parse_directives(migrations_dir / filename)
+        migrations.append(Migration(
+            version=version,
+            number=version_number(version),
+            up_path=migrations_dir / filename,
+            down_path=down_path if down_path.exists() else None,
+            expands=expands,
+            contracts=contracts,
+        ))
+    return migrations
+
+
+def version_number(version: str) -> int:
+    """Return the numeric prefix of a migration version such as "007_add_node_type_display"."""
+    prefix = version.split("_", 1)[0]
+    if not prefix.isdigit():
+        raise ValueError(f"migration version must start with a number: {version}")
+    return int(prefix)
+
+
+async def ensure_migrations_table(conn: asyncpg.Connection) -> None:
+    """Create the schema_migrations and schema_changes tracking tables if they do not exist."""
+    await conn.execute("""
+        CREATE TABLE IF NOT EXISTS schema_migrations (
+            version TEXT PRIMARY KEY,
+            applied_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+        )
+    """)
+    await ensure_changes_table(conn)
+
+
+async def applied_versions(conn: asyncpg.Connection) -> set:
+    """Return the versions recorded in schema_migrations."""
+    rows = await conn.fetch("SELECT version FROM schema_migrations")
+    return {row["version"] for row in rows}
+
+
+async def migrate_up(
+    conn: asyncpg.Connection,
+    migrations_dir: Path,
+    applied: Iterable[str],
+    target_version: Optional[int] = None,
+    label: str = "migration",
+    contract: bool = False
+) -> List[str]:
+    """
+    Apply migrations not in applied, up to and including target_version if given.
+
+    Contract migrations are skipped unless contract is set, and then raise
+    ValueError if their change is not ready to be contracted. Each migration
+    runs in its own transaction together with its schema_migrations record.
+    Returns the applied versions.
+    """
+    applied = set(applied)
+    new_versions = []
+    for migration in list_migrations(migrations_dir):
+        if target_version is not None and migration.number > target_version:
+            break
+        if migration.version in applied:
+            logger.debug(f"{label} {migration.version} already applied, skipping")
+            continue
+        if migration.contracts:
+            if not contract:
+                logger.info(f"Deferring contract {label} {migration.version} (apply with --contract)")
+                continue
+            await check_contract_ready(conn, migration.contracts)
+
+        logger.info(f"Applying {label} {migration.version}")
+        async with conn.transaction():
+            await conn.execute(migration.up_path.read_text())
+            await conn.execute(
+                "INSERT INTO schema_migrations (version) VALUES ($1) ON CONFLICT (version) DO NOTHING",
+                migration.version
+            )
+            if migration.expands:
+                await open_change(conn, migration.expands)
+            if migration.contracts:
+                await contract_change(conn, migration.contracts)
+        new_versions.append(migration.version)
+    return new_versions
+
+
+async def migrate_down(
+    conn: asyncpg.Connection,
+    migrations_dir: Path,
+    target_version: int,
+    label: str = "migration"
+) -> List[str]:
+    """
+    Revert applied migrations newer than target_version, newest first.
+
+    Nothing is reverted if any of them has no down file or is unknown (e.g.
+    applied by a newer release), so run rollbacks with the release that
+    applied the migrations. Each migration is reverted in its own
+    transaction. Returns the reverted versions.
+    """
+    known = {m.version: m for m in list_migrations(migrations_dir)}
+    pending = sorted(
+        (v for v in await applied_versions(conn) if version_number(v) > target_version),
+        key=version_number,
+        reverse=True,
+    )
+
+    unknown = [v for v in pending if v not in known]
+    if unknown:
+        raise ValueError(f"cannot revert {label}s not found in {migrations_dir}: {', '.join(unknown)}")
+    irreversible = [v for v in pending if known[v].down_path is None]
+    if irreversible:
+        raise ValueError(f"{label}s have no down script: {', '.join(irreversible)}")
+
+    for version in pending:
+        logger.info(f"Reverting {label} {version}")
+        async with conn.transaction():
+            await conn.execute(known[version].down_path.read_text())
+            await conn.execute("DELETE FROM schema_migrations WHERE version = $1", version)
+            await revert_change(conn, known[version].expands, known[version].contracts)
+    return pending
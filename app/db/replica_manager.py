@@ -0,0 +1,103 @@
+"""
+Read replica database manager for the analytics endpoint.
+
+Connects to the copies of tenant databases on a read replica. Unlike
+TenantDatabaseManager it never creates or migrates databases and never
+falls back to the primary: analytics queries only ever run on the replica,
+in read-only sessions with their own statement timeout and small per-tenant
+pools.
+"""
+
+import logging
+from typing import Dict
+
+from app.config import AnalyticsConfig, Config
+from app.db.database import Database, create_pool
+from app.db.rls import pool_setup
+
+logger = logging.getLogger(__name__)
+
+
+class ReplicaDatabaseManager:
+    """Routes tenants to their database on the analytics read replica."""
+
+    def __init__(self, cfg: Config, analytics_cfg: AnalyticsConfig, control_db: Database):
+        """
+        Initialize the replica database manager.
+
+        Args:
+            cfg: Primary database configuration (SSL mode and default credentials)
+            analytics_cfg: Replica host, limits and pool size
+            control_db: Control database used to look up tenant database names
+        """
+        if not analytics_cfg.host:
+            raise ValueError("ANALYTICS_DB_HOST is required when the analytics endpoint is enabled")
+        self.cfg = cfg
+        self.analytics_cfg = analytics_cfg
+        self.control_db = control_db
+        self._replica_pools: Dict[str, Database] = {}  # tenant_id -> Database pool
+
+    async def get_tenant_db(self, tenant_id: str) -> Database:
+        """Get or create the replica connection pool for a tenant database."""
+        if tenant_id in self._replica_pools:
+            return self._replica_pools[tenant_id]
+
+        async with self.control_db.pool.acquire() as conn:
+            db_name = await conn.fetchval(
+                "SELECT database_name FROM tenant_databases WHERE tenant_id = $1 AND status = 'active'",
+                tenant_id
+            )
+        if not db_name:
+            raise ValueError(f"Tenant not found: {tenant_id}")
+
+        replica_db = await self._connect_replica_database(db_name)
+        self._replica_pools[tenant_id] = replica_db
+        logger.info(f"Cached replica connection pool for tenant {tenant_id} (database: {db_name})")
+        return replica_db
+
+    async def _connect_replica_database(self, db_name: str) -> Database:
+        """Connect to a tenant database on the replica in read-only sessions."""
+        try:
+            pool = await create_pool(
+                self.cfg,
+                "analytics",
+                max_size=self.analytics_cfg.pool_max_size,
+                host=self.analytics_cfg.host,
+                port=self.analytics_cfg.port,
+                user=self.analytics_cfg.user or self.cfg.user,
+                password=self.analytics_cfg.password or self.cfg.password,
+                database=db_name,
+                setup=pool_setup(self.cfg),
+                server_settings={
+                    "application_name": "flexdb-analytics",
+                    "default_transaction_read_only": "on",
+                    "statement_timeout": str(int(self.analytics_cfg.statement_timeout * 1000)),
+                },
+            )
+
+            # Test the connection
+            async with pool.acquire() as conn:
+                await conn.execute("SELECT 1")
+
+            return Database(pool)
+        except Exception as e:
+            raise Exception(f"Failed to connect to replica database {db_name}: {e}") from e
+
+    async def close_all_pools(self) -> None:
+        """Close all cached replica connection pools."""
+        logger.info(f"Closing {len(self._replica_pools)} replica database pools")
+        for tenant_id, db in self._replica_pools.items():
+            try:
+                await db.close()
+            except Exception as e:
+                logger.error(f"Error closing replica pool for tenant {tenant_id}: {e}")
+        self._replica_pools.clear()
+
+    async def evict_tenant_pool(self, tenant_id: str) -> None:
+        """Evict a specific tenant's replica connection pool from cache."""
+        db = self._replica_pools.pop(tenant_id, None)
+        if db is not None:
+            try:
+                await db.close()
+            except Exception as e:
+                logger.error(f"Error closing replica pool for tenant {tenant_id}: {e}")
@@ -0,0 +1,95 @@
+"""
+Routing of read-only queries to read replicas.
+
+With DB_REPLICA_HOSTS set, every tenant database has a pool on each replica
+next to its primary pool (see Database.read_pool). Repositories run their
+get, list and count queries on read_pool, which picks a replica only within
+replica_reads: the JSON-RPC read methods (see replica_routed) run in it,
+everything else, writes and the reads they depend on, background workers
+included, reads the primary.
+
+Replicas lag behind the primary, so a read on a replica may miss a write
+that just committed. To read its own writes, a request:
+
+- sends "X-FlexDB-Consistency: strong" (see start_read_session), or
+- sends them in one JSON-RPC batch: once a call of a method that isn't a
+  read method returned, the request's later calls read the primary.
+"""
+
+import functools
+from contextlib import contextmanager
+from contextvars import ContextVar
+from dataclasses import dataclass
+from typing import Callable, Collection, Dict, Iterator, Optional
+
+CONSISTENCY_HEADER = "X-FlexDB-Consistency"
+# Consistency read from the primary; other values allow replica reads
+STRONG = "strong"
+
+
+@dataclass
+class ReadSession:
+    """Where the reads of one request go."""
+    # Whether the rest of the request reads the primary
+    primary: bool = False
+
+
+_session: ContextVar[Optional[ReadSession]] = ContextVar("flexdb_read_session", default=None)
+_replica_reads: ContextVar[bool] = ContextVar("flexdb_replica_reads", default=False)
+
+
+def start_read_session(consistency: str = "") -> ReadSession:
+    """Start the read session of the current request, reading the primary for strong consistency."""
+    session = ReadSession(primary=consistency.strip().lower() == STRONG)
+    _session.set(session)
+    return session
+
+
+def reads_use_replicas() -> bool:
+    """Return whether read-only queries run now may read a replica."""
+    session = _session.get()
+    return _replica_reads.get() and not (session and session.primary)
+
+
+@contextmanager
+def replica_reads() -> Iterator[None]:
+    """Let read-only queries of the enclosed code read replicas."""
+    token = _replica_reads.set(True)
+    try:
+        yield
+    finally:
+        _replica_reads.reset(token)
+
+
+@contextmanager
+def primary_reads() -> Iterator[None]:
+    """Read the primary in the enclosed code, within replica_reads too."""
+    token = _replica_reads.set(False)
+    try:
+        yield
+    finally:
+        _replica_reads.reset(token)
+
+
+def replica_routed(methods: Dict[str, Callable], read_methods: Collection[str]) -> Dict[str, Callable]:
+    """
+    Wrap JSON-RPC methods so read_methods read replicas, and once any other
+    method returned, the rest of its request reads the primary.
+    """
+    return {name: _replica_routed(func, name in read_methods) for name, func in methods.items()}
+
+
+def _replica_routed(func: Callable, read_only: bool) -> Callable:
+    @functools.wraps(func)
+    async def wrapper(*args, **kwargs):
+        if not read_only:
+            try:
+                return await func(*args, **kwargs)
+            finally:
+                session = _session.get()
+                if session:
+                    session.primary = True
+        with replica_reads():
+            return await func(*args, **kwargs)
+
+    return wrapper
@@ -0,0 +1,99 @@
+"""
+Row-level security (RLS) tenant isolation.
+
+Tenant data lives in one database per tenant, and the control database's
+tenant-scoped tables (api_keys, tenant_users) carry a tenant_id. Migrations
+put an RLS policy on all of these tables that only shows rows of the tenant
+named by the app.current_tenant setting:
+
+- in the control database, rows whose tenant_id matches
+- in a tenant database, all rows if the database belongs to that tenant
+  (recorded in tenant_identity), none otherwise
+
+When app.current_tenant is empty every row is visible, so background jobs and
+control methods working across tenants are unaffected.
+
+With DB_RLS_ENABLED=true, every connection checked out of a pool sets
+app.current_tenant to the tenant of the current request (see tenant_scope),
+so a repository query missing its tenant predicate, or a request reaching
+another tenant's database, returns no rows and writes fail. Superusers and
+roles with BYPASSRLS skip policies, so the server must then connect as an
+ordinary role that owns the tables; check_role() verifies this at startup.
+"""
+
+import functools
+import inspect
+from contextlib import contextmanager
+from contextvars import ContextVar
+from typing import Awaitable, Callable, Dict, Iterator, Optional
+
+import asyncpg
+
+from app.config import Config
+
+_current_tenant: ContextVar[str] = ContextVar("flexdb_current_tenant", default="")
+
+
+def current_tenant() -> str:
+    """Return the tenant of the current request, or "" outside of tenant requests."""
+    return _current_tenant.get()
+
+
+@contextmanager
+def tenant_scope(tenant_id: str) -> Iterator[None]:
+    """Run the enclosed code on behalf of a tenant."""
+    token = _current_tenant.set(tenant_id or "")
+    try:
+        yield
+    finally:
+        _current_tenant.reset(token)
+
+
+def enter_tenant(tenant_id: str) -> None:
+    """
+    Act on behalf of a tenant for the rest of the current request, unless the
+    request already belongs to a tenant: requests never switch tenants.
+    """
+    if not _current_tenant.get():
+        _current_tenant.set(tenant_id or "")
+
+
+async def _set_current_tenant(conn: asyncpg.Connection) -> None:
+    # Session-level: pools reset session settings when connections are released
+    await conn.execute("SELECT set_config('app.current_tenant', $1, false)", _current_tenant.get())
+
+
+def pool_setup(cfg: Config) -> Optional[Callable[[asyncpg.Connection], Awaitable[None]]]:
+    """Return the connection setup for asyncpg.create_pool(setup=...), if RLS is enabled."""
+    return _set_current_tenant if cfg.rls_enabled else None
+
+
+async def check_role(conn: asyncpg.Connection) -> None:
+    """Raise RuntimeError if the connected role bypasses row-level security."""
+    bypasses = await conn.fetchval(
+        "SELECT rolsuper OR rolbypassrls FROM pg_roles WHERE rolname = current_user"
+    )
+    if bypasses:
+        raise RuntimeError(
+            "DB_RLS_ENABLED requires a database role without SUPERUSER or BYPASSRLS; "
+            "row-level security policies do not apply to this role"
+        )
+
+
+def tenant_scoped(methods: Dict[str, Callable]) -> Dict[str, Callable]:
+    """Wrap JSON-RPC methods with a tenant_id parameter to run in that tenant's scope."""
+    return {name: _tenant_scoped(func) for name, func in methods.items()}
+
+
+def _tenant_scoped(func: Callable) -> Callable:
+    signature = inspect.signature(func)
+    if "tenant_id" not in signature.parameters:
+        return func
+
+    @functools.wraps(func)
+    async def wrapper(*args, **kwargs):
+        tenant_id = signature.bind(*args, **kwargs).arguments.get("tenant_id")
+        with tenant_scope(str(tenant_id or "")):
+            return await func(*args, **kwargs)
+
+    return wrapper
@@ -6,19 +6,29 @@ database creation and migrations on-demand.
 """
 
 import logging
-import os
 import ssl
+import time
 from pathlib import Path
-from typing import Dict, Optional
+from typing import Dict, List, Optional, Tuple
 
 import asyncpg
 
 from app.config import Config
-from app.db.database import Database
+from app.db.database import Database, connect_replicas, create_pool
+from app.db.rls import pool_setup
 from app.db.control_database import connect_control_db
+from app.db.migrator import applied_versions, ensure_migrations_table, migrate_down, migrate_up
 
 logger = logging.getLogger(__name__)
 
+TENANT_MIGRATIONS_DIR = Path(__file__).parent / "tenant_migrations"
+
+# Seconds a tenant's status is cached, so other servers notice a suspension within this time
+STATUS_CACHE_TTL = 5.0
+
+# Longest PostgreSQL identifier
+MAX_IDENTIFIER_LENGTH = 63
+
 
 class TenantDatabaseManager:
     """
@@ -43,6 +53,7 @@ class TenantDatabaseManager:
         self.cfg = cfg
         self.control_db = control_db
         self._tenant_pools: Dict[str, Database] = {}  # tenant_id -> Database pool
+        self._statuses: Dict[str, Tuple[str, float]] = {}  # tenant_id -> (status, monotonic expiry)
         self._pool_lock = None  # Will use asyncio.Lock if needed for thread safety
 
     async def get_tenant_db(self, tenant_id: str) -> Database:
@@ -75,7 +86,7 @@ class TenantDatabaseManager:
         async with control_db.pool.acquire() as conn:
             # First, get tenant slug to determine database name
             tenant_row = await conn.fetchrow(
-                "SELECT slug FROM tenants WHERE id = $1",
+                "SELECT slug, status FROM tenants WHERE id = $1",
                 tenant_id
             )
             if not tenant_row:
@@ -93,6 +104,9 @@ class TenantDatabaseManager:
             if db_mapping and db_mapping["status"] == "active":
                 # Database mapping exists, connect to it
                 db_name = db_mapping["database_name"]
+            elif tenant_row["status"] == "deleting":
+                # Its database was dropped; don't bring it back
+                raise ValueError(f"Tenant not found: {tenant_id}")
             else:
                 # Need to create tenant database
                 await self._create_tenant_database(tenant_id, slug, db_name, control_db, conn)
@@ -227,39 +241,37 @@ class TenantDatabaseManager:
             raise
 
     async def _connect_tenant_database(self, db_name: str) -> Database:
-        """Connect to a tenant database and return Database wrapper."""
+        """Connect to a tenant database, and its copies on the read replicas, and return Database wrapper."""
         try:
-            # Map SSL mode to asyncpg ssl parameter
-            ssl_context = None
-            if self.cfg.ssl_mode == "require":
-                ssl_context = "require"
-            elif self.cfg.ssl_mode == "prefer":
-                ssl_context = "prefer"
-            elif self.cfg.ssl_mode == "verify-ca" or self.cfg.ssl_mode == "verify-full":
-                ssl_context = ssl.create_default_context()
-
-            pool = await asyncpg.create_pool(
+            pool = await create_pool(
+                self.cfg,
+                "tenant",
                 host=self.cfg.host,
                 port=self.cfg.port,
                 user=self.cfg.user,
                 password=self.cfg.password,
                 database=db_name,
-                min_size=1,
-                max_size=10,
-                ssl=ssl_context,
+                setup=pool_setup(self.cfg),
             )
 
             # Test the connection
             async with pool.acquire() as conn:
                 await conn.execute("SELECT 1")
 
-            return Database(pool)
+            return Database(pool, await connect_replicas(self.cfg, db_name, pool_setup(self.cfg)))
         except Exception as e:
             raise Exception(f"Failed to connect to tenant database {db_name}: {e}") from e
 
-    async def _run_tenant_migrations(self, tenant_id: str, tenant_db: Database) -> None:
+    async def _run_tenant_migrations(
+        self,
+        tenant_id: str,
+        tenant_db: Database,
+        target_version: Optional[int] = None,
+        contract: bool = False
+    ) -> None:
         """
-        Run migrations on a tenant database.
+        Run migrations on a tenant database, optionally only up to target_version,
+        including contract migrations if contract is set.
         
         Tracks which migrations have been applied to which tenant database
         in the control database's tenant_migrations table.
@@ -277,53 +289,21 @@ class TenantDatabaseManager:
             )
             applied = {row["version"] for row in applied_rows}
 
+        if not TENANT_MIGRATIONS_DIR.exists():
+            logger.warning(f"Tenant migrations directory not found: {TENANT_MIGRATIONS_DIR}")
+            return
+
         async with tenant_db.pool.acquire() as conn:
-            # Create migrations tracking table in tenant database
-            await conn.execute("""
-                CREATE TABLE IF NOT EXISTS schema_migrations (
-                    version TEXT PRIMARY KEY,
-                    applied_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
-                )
-            """)
-            
-            # Also check tenant database's schema_migrations table
-            tenant_applied_rows = await conn.fetch(
-                "SELECT version FROM schema_migrations"
-            )
-            tenant_applied = {row["version"] for row in tenant_applied_rows}
-            
+            await ensure_migrations_table(conn)
+
             # Combine both sources to determine what's already applied
-            all_applied = applied | tenant_applied
-
-            # Read and apply migrations
-            migrations_dir = Path(__file__).parent / "tenant_migrations"
-            if not migrations_dir.exists():
-                logger.warning(f"Tenant migrations directory not found: {migrations_dir}")
-                return
-
-            up_files = sorted([f for f in os.listdir(migrations_dir) if f.endswith(".up.sql")])
-
-            # Collect migrations to record in control DB
-            new_migrations = []
-
-            for filename in up_files:
-                version = filename.replace(".up.sql", "")
-                if version in all_applied:
-                    logger.debug(f"Tenant {tenant_id} migration {version} already applied, skipping")
-                    continue
-
-                logger.info(f"Applying tenant migration {version} to tenant {tenant_id}")
-                content = (migrations_dir / filename).read_text()
-
-                # Execute the migration in a transaction
-                async with conn.transaction():
-                    await conn.execute(content)
-                    # Record in tenant database (use ON CONFLICT to handle race conditions)
-                    await conn.execute(
-                        "INSERT INTO schema_migrations (version) VALUES ($1) ON CONFLICT (version) DO NOTHING",
-                        version
-                    )
-                    new_migrations.append(version)
+            all_applied = applied | await applied_versions(conn)
+
+            new_migrations = await migrate_up(
+                conn, TENANT_MIGRATIONS_DIR, all_applied, target_version,
+                label=f"tenant {tenant_id} migration", contract=contract
+            )
+            await self._record_identity(tenant_id, conn)
 
             # Record new migrations in control database (batch insert)
             if new_migrations:
@@ -337,6 +317,215 @@ class TenantDatabaseManager:
 
             logger.info(f"Tenant migrations completed for tenant {tenant_id}")
 
+    async def _record_identity(self, tenant_id: str, conn) -> None:
+        """
+        Record the tenant owning a database for its row-level security
+        policies (see app/db/rls.py), and refuse databases of other tenants.
+        """
+        if not await conn.fetchval("SELECT to_regclass('tenant_identity') IS NOT NULL"):
+            return
+        owner = await conn.fetchval(
+            """
+            INSERT INTO tenant_identity (tenant_id) VALUES ($1)
+            ON CONFLICT (singleton) DO UPDATE SET tenant_id = tenant_identity.tenant_id
+            RETURNING tenant_id
+            """,
+            tenant_id
+        )
+        if str(owner) != tenant_id:
+            raise ValueError(f"Tenant database of tenant {tenant_id} belongs to tenant {owner}")
+
+    async def migrate_tenant_to(self, tenant_id: str, target_version: int) -> List[str]:
+        """
+        Migrate a tenant database up or down to target_version.
+
+        Missing migrations up to the target are applied, newer ones are
+        reverted with their down scripts. Unlike get_tenant_db this does not
+        apply all pending migrations first. Returns the reverted versions.
+        """
+        control_db = self.control_db
+        if not control_db:
+            control_db = await connect_control_db(self.cfg)
+
+        tenant_db = await self._tenant_db_for_migration(tenant_id, control_db)
+        await self._run_tenant_migrations(tenant_id, tenant_db, target_version)
+
+        async with tenant_db.pool.acquire() as conn:
+            reverted = await migrate_down(
+                conn, TENANT_MIGRATIONS_DIR, target_version, label=f"tenant {tenant_id} migration"
+            )
+
+        if reverted:
+            async with control_db.pool.acquire() as control_conn:
+                await control_conn.execute(
+                    "DELETE FROM tenant_migrations WHERE tenant_id = $1 AND version = ANY($2::text[])",
+                    tenant_id,
+                    reverted
+                )
+        return reverted
+
+    async def apply_contract_migrations(self, tenant_id: str) -> None:
+        """Apply pending migrations of a tenant database, contract migrations included (see app/db/expand_contract.py)."""
+        control_db = self.control_db
+        if not control_db:
+            control_db = await connect_control_db(self.cfg)
+
+        tenant_db = await self._tenant_db_for_migration(tenant_id, control_db)
+        await self._run_tenant_migrations(tenant_id, tenant_db, contract=True)
+
+    async def _tenant_db_for_migration(self, tenant_id: str, control_db: Database) -> Database:
+        """Connect to a tenant database without applying its pending migrations."""
+        tenant_db = self._tenant_pools.get(tenant_id)
+        if tenant_db is None:
+            async with control_db.pool.acquire() as conn:
+                db_name = await conn.fetchval(
+                    "SELECT database_name FROM tenant_databases WHERE tenant_id = $1 AND status = 'active'",
+                    tenant_id
+                )
+            if not db_name:
+                raise ValueError(f"Tenant database not found: {tenant_id}")
+            tenant_db = await self._connect_tenant_database(db_name)
+            self._tenant_pools[tenant_id] = tenant_db
+        return tenant_db
+
+    async def tenant_status(self, tenant_id: str) -> str:
+        """Return a tenant's lifecycle status, cached for STATUS_CACHE_TTL seconds."""
+        cached = self._statuses.get(tenant_id)
+        if cached and cached[1] > time.monotonic():
+            return cached[0]
+
+        control_db = self.control_db
+        if not control_db:
+            control_db = await connect_control_db(self.cfg)
+        async with control_db.pool.acquire() as conn:
+            status = await conn.fetchval("SELECT status FROM tenants WHERE id = $1", tenant_id)
+        if status is None:
+            raise ValueError(f"Tenant not found: {tenant_id}")
+
+        self._statuses[tenant_id] = (status, time.monotonic() + STATUS_CACHE_TTL)
+        return status
+
+    def forget_tenant_status(self, tenant_id: str) -> None:
+        """Drop a tenant's cached status after changing it."""
+        self._statuses.pop(tenant_id, None)
+
+    async def archive_tenant_database(self, tenant_id: str, suffix: str) -> str:
+        """
+        Snapshot a tenant database into a read-only copy named after it and
+        suffix, then make the tenant database read-only. Connections are
+        refused meanwhile, so nothing is written between the two. Returns the
+        snapshot's name.
+        """
+        db_name = await self._active_database_name(tenant_id)
+        snapshot = f"{db_name[:MAX_IDENTIFIER_LENGTH - len(suffix) - 9]}_archive_{suffix}"
+
+        await self.evict_tenant_pool(tenant_id)
+        admin_conn = await self._connect_admin()
+        try:
+            await admin_conn.execute(f'ALTER DATABASE "{db_name}" WITH ALLOW_CONNECTIONS false')
+            try:
+                await self._terminate_connections(admin_conn, db_name)
+                await admin_conn.execute(f'CREATE DATABASE "{snapshot}" TEMPLATE "{db_name}"')
+                await admin_conn.execute(f'ALTER DATABASE "{snapshot}" SET default_transaction_read_only = on')
+                await admin_conn.execute(f'ALTER DATABASE "{db_name}" SET default_transaction_read_only = on')
+            finally:
+                await admin_conn.execute(f'ALTER DATABASE "{db_name}" WITH ALLOW_CONNECTIONS true')
+        finally:
+            await admin_conn.close()
+
+        logger.info(f"Archived tenant database {db_name} of tenant {tenant_id} to {snapshot}")
+        return snapshot
+
+    async def set_tenant_read_only(self, tenant_id: str, read_only: bool) -> None:
+        """Make a tenant database read-only or writable again, ending sessions started with the old setting."""
+        db_name = await self._active_database_name(tenant_id)
+        setting = "SET default_transaction_read_only = on" if read_only else "RESET default_transaction_read_only"
+
+        await self.evict_tenant_pool(tenant_id)
+        admin_conn = await self._connect_admin()
+        try:
+            await admin_conn.execute(f'ALTER DATABASE "{db_name}" {setting}')
+            await self._terminate_connections(admin_conn, db_name)
+        finally:
+            await admin_conn.close()
+
+    async def drop_tenant_databases(self, tenant_id: str, db_names: List[str]) -> None:
+        """
+        Drop a tenant's database and archive snapshot, ending their sessions
+        first, and remove its database mapping. Names already dropped are skipped.
+        """
+        await self.evict_tenant_pool(tenant_id)
+        admin_conn = await self._connect_admin()
+        try:
+            for db_name in db_names:
+                if db_name:
+                    await admin_conn.execute(f'DROP DATABASE IF EXISTS "{db_name}" WITH (FORCE)')
+                    logger.info(f"Dropped tenant database {db_name} of tenant {tenant_id}")
+        finally:
+            await admin_conn.close()
+
+        control_db = self.control_db
+        if not control_db:
+            control_db = await connect_control_db(self.cfg)
+        async with control_db.pool.acquire() as conn:
+            await conn.execute("DELETE FROM tenant_databases WHERE tenant_id = $1", tenant_id)
+
+    async def _active_database_name(self, tenant_id: str) -> str:
+        control_db = self.control_db
+        if not control_db:
+            control_db = await connect_control_db(self.cfg)
+        async with control_db.pool.acquire() as conn:
+            db_name = await conn.fetchval(
+                "SELECT database_name FROM tenant_databases WHERE tenant_id = $1 AND status = 'active'",
+                tenant_id
+            )
+        if not db_name:
+            raise ValueError(f"Tenant database not found: {tenant_id}")
+        return db_name
+
+    async def _connect_admin(self) -> asyncpg.Connection:
+        """Connect to the server's default postgres database, for statements on whole databases."""
+        ssl_context = None
+        if self.cfg.ssl_mode == "require":
+            ssl_context = "require"
+        elif self.cfg.ssl_mode == "prefer":
+            ssl_context = "prefer"
+        elif self.cfg.ssl_mode == "verify-ca" or self.cfg.ssl_mode == "verify-full":
+            ssl_context = ssl.create_default_context()
+
+        return await asyncpg.connect(
+            host=self.cfg.host,
+            port=self.cfg.port,
+            user=self.cfg.user,
+            password=self.cfg.password,
+            database="postgres",
+            ssl=ssl_context,
+        )
+
+    async def _terminate_connections(self, admin_conn: asyncpg.Connection, db_name: str) -> None:
+        """End all sessions of a database, including other servers' pooled connections."""
+        await admin_conn.execute(
+            "SELECT pg_terminate_backend(pid) FROM pg_stat_activity WHERE datname = $1 AND pid <> pg_backend_pid()",
+            db_name
+        )
+
+    async def list_active_tenant_ids(self) -> List[str]:
+        """List IDs of tenants with an active tenant database, except those being deleted."""
+        control_db = self.control_db
+        if not control_db:
+            control_db = await connect_control_db(self.cfg)
+
+        async with control_db.pool.acquire() as conn:
+            rows = await conn.fetch(
+                """
+                SELECT d.tenant_id FROM tenant_databases d JOIN tenants t ON t.id = d.tenant_id
+                WHERE d.status = 'active' AND t.status <> 'deleting'
+                ORDER BY d.tenant_id
+                """
+            )
+
+        return [str(row["tenant_id"]) for row in rows]
+
     async def close_all_pools(self) -> None:
         """Close all cached tenant database connection pools."""
         logger.info(f"Closing {len(self._tenant_pools)} tenant database pools")
@@ -0,0 +1,4 @@
+-- Migration: 001_create_node_types.down.sql
+-- Drop node_types table
+
+DROP TABLE IF EXISTS node_types;
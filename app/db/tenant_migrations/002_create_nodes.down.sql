@@ -0,0 +1,4 @@
+-- Migration: 002_create_nodes.down.sql
+-- Drop nodes table
+
+DROP TABLE IF EXISTS nodes;
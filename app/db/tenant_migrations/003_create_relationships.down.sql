@@ -0,0 +1,4 @@
+-- Migration: 003_create_relationships.down.sql
+-- Drop relationships table
+
+DROP TABLE IF EXISTS relationships;
@@ -0,0 +1,5 @@
+-- Migration: 004_enable_postgis.down.sql
+-- Drop PostGIS if the up migration installed it. No tenant tables use PostGIS
+-- types; geo queries fall back to plain SQL math without it.
+
+DROP EXTENSION IF EXISTS postgis;
@@ -0,0 +1,15 @@
+-- Migration: 004_enable_postgis.up.sql
+-- Enable PostGIS for geo_point/geo_shape queries when the server provides it.
+-- PostGIS is optional: without it, geo_point queries fall back to plain SQL
+-- math and geo_shape queries are rejected.
+
+DO $$
+BEGIN
+    IF EXISTS (SELECT 1 FROM pg_available_extensions WHERE name = 'postgis') THEN
+        CREATE EXTENSION IF NOT EXISTS postgis;
+    END IF;
+EXCEPTION
+    WHEN insufficient_privilege THEN
+        RAISE NOTICE 'Skipping PostGIS: insufficient privilege to create extension';
+END
+$$;
@@ -0,0 +1,6 @@
+-- Migration: 005_create_outbox_and_webhooks.down.sql
+-- Drop the change event outbox and webhook tables
+
+DROP TABLE IF EXISTS webhook_deliveries;
+DROP TABLE IF EXISTS webhook_endpoints;
+DROP TABLE IF EXISTS outbox_events;
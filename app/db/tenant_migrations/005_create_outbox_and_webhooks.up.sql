@@ -0,0 +1,48 @@
+-- Migration: 005_create_outbox_and_webhooks.up.sql
+-- Transactional outbox for change events and per-tenant webhook delivery
+
+-- Change events written in the same transaction as the mutation they describe
+CREATE TABLE IF NOT EXISTS outbox_events (
+    id            BIGSERIAL PRIMARY KEY,
+    event_id      UUID NOT NULL UNIQUE,
+    event_type    TEXT NOT NULL,
+    entity_type   TEXT NOT NULL,
+    entity_id     UUID NOT NULL,
+    payload       JSONB NOT NULL DEFAULT '{}',
+    created_at    TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    dispatched_at TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS idx_outbox_events_pending ON outbox_events(id) WHERE dispatched_at IS NULL;
+
+-- Webhook endpoints registered by the tenant
+CREATE TABLE IF NOT EXISTS webhook_endpoints (
+    id          UUID PRIMARY KEY,
+    url         TEXT NOT NULL,
+    secret      TEXT NOT NULL,
+    event_types TEXT[] NOT NULL DEFAULT '{}',
+    description TEXT,
+    status      TEXT NOT NULL DEFAULT 'active',
+    created_at  TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at  TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- One delivery per (endpoint, event), retried until it succeeds or runs out of attempts
+CREATE TABLE IF NOT EXISTS webhook_deliveries (
+    id               UUID PRIMARY KEY,
+    endpoint_id      UUID NOT NULL REFERENCES webhook_endpoints(id) ON DELETE CASCADE,
+    event_id         UUID NOT NULL,
+    event_type       TEXT NOT NULL,
+    payload          JSONB NOT NULL DEFAULT '{}',
+    status           TEXT NOT NULL DEFAULT 'pending',
+    attempts         INTEGER NOT NULL DEFAULT 0,
+    next_attempt_at  TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    last_status_code INTEGER,
+    last_error       TEXT,
+    created_at       TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at       TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    UNIQUE (endpoint_id, event_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_pending ON webhook_deliveries(next_attempt_at) WHERE status = 'pending';
+CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_endpoint_id ON webhook_deliveries(endpoint_id);
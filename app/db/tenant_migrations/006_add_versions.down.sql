@@ -0,0 +1,6 @@
+-- Migration: 006_add_versions.down.sql
+-- Drop optimistic concurrency version columns
+
+ALTER TABLE relationships DROP COLUMN IF EXISTS version;
+ALTER TABLE nodes DROP COLUMN IF EXISTS version;
+ALTER TABLE node_types DROP COLUMN IF EXISTS version;
@@ -0,0 +1,7 @@
+-- Migration: 006_add_versions.up.sql
+-- Add version columns for optimistic concurrency control
+-- Every update increments version; updates may require an expected version
+
+ALTER TABLE node_types ADD COLUMN IF NOT EXISTS version BIGINT NOT NULL DEFAULT 1;
+ALTER TABLE nodes ADD COLUMN IF NOT EXISTS version BIGINT NOT NULL DEFAULT 1;
+ALTER TABLE relationships ADD COLUMN IF NOT EXISTS version BIGINT NOT NULL DEFAULT 1;
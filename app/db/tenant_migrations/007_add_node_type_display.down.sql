@@ -0,0 +1,4 @@
+-- Migration: 007_add_node_type_display.down.sql
+-- Drop node type display metadata
+
+ALTER TABLE node_types DROP COLUMN IF EXISTS display;
@@ -0,0 +1,4 @@
+-- Migration: 007_add_node_type_display.up.sql
+-- Add UI display metadata (default sort, column order, display name template) to node types
+
+ALTER TABLE node_types ADD COLUMN IF NOT EXISTS display JSONB NOT NULL DEFAULT '{}';
@@ -0,0 +1,4 @@
+-- Migration: 008_create_intake_forms.down.sql
+-- Drop public intake forms (nodes created from submissions are kept)
+
+DROP TABLE IF EXISTS intake_forms;
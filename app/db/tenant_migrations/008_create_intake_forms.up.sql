@@ -0,0 +1,17 @@
+-- Migration: 008_create_intake_forms.up.sql
+-- Public intake forms that create nodes from anonymous website submissions
+
+CREATE TABLE IF NOT EXISTS intake_forms (
+    id                    UUID PRIMARY KEY,
+    token                 TEXT NOT NULL UNIQUE,
+    node_type_id          UUID NOT NULL REFERENCES node_types(id) ON DELETE CASCADE,
+    name                  TEXT NOT NULL,
+    fields                TEXT[] NOT NULL DEFAULT '{}',
+    require_captcha       BOOLEAN NOT NULL DEFAULT FALSE,
+    rate_limit_per_minute INTEGER NOT NULL DEFAULT 10,
+    status                TEXT NOT NULL DEFAULT 'active',
+    created_at            TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at            TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_intake_forms_node_type_id ON intake_forms(node_type_id);
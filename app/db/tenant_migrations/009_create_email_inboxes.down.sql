@@ -0,0 +1,6 @@
+-- Migration: 009_create_email_inboxes.down.sql
+-- Drop email inboxes, received message IDs and attachments (nodes created from emails are kept)
+
+DROP TABLE IF EXISTS email_attachments;
+DROP TABLE IF EXISTS inbound_emails;
+DROP TABLE IF EXISTS email_inboxes;
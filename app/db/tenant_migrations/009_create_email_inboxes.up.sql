@@ -0,0 +1,38 @@
+-- Migration: 009_create_email_inboxes.up.sql
+-- Inbound email inboxes that turn received emails into nodes
+
+CREATE TABLE IF NOT EXISTS email_inboxes (
+    id            UUID PRIMARY KEY,
+    token         TEXT NOT NULL UNIQUE,
+    node_type_id  UUID NOT NULL REFERENCES node_types(id) ON DELETE CASCADE,
+    name          TEXT NOT NULL,
+    field_mapping JSONB NOT NULL DEFAULT '{}',
+    status        TEXT NOT NULL DEFAULT 'active',
+    created_at    TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at    TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_email_inboxes_node_type_id ON email_inboxes(node_type_id);
+
+-- Received messages, so provider retries of the same Message-ID do not create duplicate nodes
+CREATE TABLE IF NOT EXISTS inbound_emails (
+    id          UUID PRIMARY KEY,
+    inbox_id    UUID NOT NULL REFERENCES email_inboxes(id) ON DELETE CASCADE,
+    message_id  TEXT NOT NULL,
+    node_id     UUID NOT NULL REFERENCES nodes(id) ON DELETE CASCADE,
+    received_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    UNIQUE (inbox_id, message_id)
+);
+
+-- Files attached to emails, stored with the node they were ingested into
+CREATE TABLE IF NOT EXISTS email_attachments (
+    id           UUID PRIMARY KEY,
+    node_id      UUID NOT NULL REFERENCES nodes(id) ON DELETE CASCADE,
+    filename     TEXT NOT NULL,
+    content_type TEXT NOT NULL,
+    size_bytes   INTEGER NOT NULL,
+    content      BYTEA NOT NULL,
+    created_at   TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_email_attachments_node_id ON email_attachments(node_id);
@@ -0,0 +1,8 @@
+-- Migration: 010_add_webhook_sinks.down.sql
+-- Drop chat sink and node type filter columns. Slack/Teams endpoints would
+-- otherwise receive signed JSON webhooks, so they are removed.
+
+DELETE FROM webhook_endpoints WHERE kind <> 'webhook';
+ALTER TABLE webhook_endpoints DROP COLUMN IF EXISTS node_type_ids;
+ALTER TABLE webhook_endpoints DROP COLUMN IF EXISTS template;
+ALTER TABLE webhook_endpoints DROP COLUMN IF EXISTS kind;
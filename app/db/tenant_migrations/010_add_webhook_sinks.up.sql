@@ -0,0 +1,6 @@
+-- Migration: 010_add_webhook_sinks.up.sql
+-- Slack/Teams chat sinks and node type filters for webhook endpoints
+
+ALTER TABLE webhook_endpoints ADD COLUMN IF NOT EXISTS kind TEXT NOT NULL DEFAULT 'webhook';
+ALTER TABLE webhook_endpoints ADD COLUMN IF NOT EXISTS template TEXT NOT NULL DEFAULT '';
+ALTER TABLE webhook_endpoints ADD COLUMN IF NOT EXISTS node_type_ids TEXT[] NOT NULL DEFAULT '{}';
@@ -0,0 +1,3 @@
+-- Migration: 011_create_bi_schema.down.sql
+
+DROP SCHEMA IF EXISTS bi CASCADE;
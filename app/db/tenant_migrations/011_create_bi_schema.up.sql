@@ -0,0 +1,6 @@
+-- Migration: 011_create_bi_schema.up.sql
+-- Schema for the generated read-only BI views (one per node type, see
+-- app/repository/bi_view_repo.py). Views are created by the application
+-- when BI views are enabled; nothing else belongs in this schema.
+
+CREATE SCHEMA IF NOT EXISTS bi;
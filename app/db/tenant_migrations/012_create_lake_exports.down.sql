@@ -0,0 +1,3 @@
+-- Migration: 012_create_lake_exports.down.sql
+
+DROP TABLE IF EXISTS lake_exports;
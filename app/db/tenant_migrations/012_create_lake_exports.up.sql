@@ -0,0 +1,17 @@
+-- Migration: 012_create_lake_exports.up.sql
+-- Runs of the scheduled Parquet export to object storage (see app/lake/)
+
+CREATE TABLE IF NOT EXISTS lake_exports (
+    id           UUID PRIMARY KEY,
+    status       TEXT NOT NULL DEFAULT 'running',
+    started_at   TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    -- A running export whose lease expired was abandoned and may be retried
+    lease_until  TIMESTAMPTZ NOT NULL,
+    finished_at  TIMESTAMPTZ,
+    manifest_key TEXT NOT NULL DEFAULT '',
+    file_count   INTEGER NOT NULL DEFAULT 0,
+    node_count   BIGINT NOT NULL DEFAULT 0,
+    error        TEXT
+);
+
+CREATE INDEX IF NOT EXISTS idx_lake_exports_started_at ON lake_exports(started_at);
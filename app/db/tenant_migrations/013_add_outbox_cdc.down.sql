@@ -0,0 +1,4 @@
+-- Migration: 013_add_outbox_cdc.down.sql
+
+DROP INDEX IF EXISTS idx_outbox_events_cdc_pending;
+ALTER TABLE outbox_events DROP COLUMN IF EXISTS cdc_published_at;
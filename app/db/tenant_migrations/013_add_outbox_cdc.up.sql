@@ -0,0 +1,9 @@
+-- Migration: 013_add_outbox_cdc.up.sql
+-- Track which outbox events were published to the CDC topics, separately
+-- from webhook dispatch. Events written before this migration are not
+-- published.
+
+ALTER TABLE outbox_events ADD COLUMN IF NOT EXISTS cdc_published_at TIMESTAMPTZ;
+UPDATE outbox_events SET cdc_published_at = NOW() WHERE cdc_published_at IS NULL;
+
+CREATE INDEX IF NOT EXISTS idx_outbox_events_cdc_pending ON outbox_events(id) WHERE cdc_published_at IS NULL;
@@ -0,0 +1,6 @@
+-- Migration: 014_add_schema_versions.down.sql
+
+DROP TABLE IF EXISTS node_migrations;
+DROP INDEX IF EXISTS idx_nodes_type_schema_version;
+ALTER TABLE nodes DROP COLUMN IF EXISTS schema_version;
+ALTER TABLE node_types DROP COLUMN IF EXISTS schema_version;
@@ -0,0 +1,35 @@
+-- Migration: 014_add_schema_versions.up.sql
+-- Schema versions of node types and of the data of their nodes, and the jobs
+-- that migrate old nodes to a node type's current schema (see app/jobs/)
+
+-- Incremented whenever a node type's schema changes
+ALTER TABLE node_types ADD COLUMN IF NOT EXISTS schema_version INTEGER NOT NULL DEFAULT 1;
+-- The node type schema version a node's data was last validated against
+ALTER TABLE nodes ADD COLUMN IF NOT EXISTS schema_version INTEGER NOT NULL DEFAULT 1;
+
+CREATE INDEX IF NOT EXISTS idx_nodes_type_schema_version ON nodes(node_type_id, schema_version, id);
+
+CREATE TABLE IF NOT EXISTS node_migrations (
+    id                    UUID PRIMARY KEY,
+    node_type_id          UUID NOT NULL REFERENCES node_types(id) ON DELETE CASCADE,
+    target_schema_version INTEGER NOT NULL,
+    transform             JSONB NOT NULL DEFAULT '[]',
+    status                TEXT NOT NULL DEFAULT 'pending',
+    batch_size            INTEGER NOT NULL,
+    -- Nodes are migrated in ID order; the last ID processed
+    last_node_id          UUID,
+    migrated_count        BIGINT NOT NULL DEFAULT 0,
+    failed_count          BIGINT NOT NULL DEFAULT 0,
+    failures              JSONB NOT NULL DEFAULT '[]',
+    error                 TEXT,
+    -- A running migration whose lease expired was abandoned and may be resumed
+    lease_until           TIMESTAMPTZ,
+    created_at            TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at            TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    finished_at           TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS idx_node_migrations_node_type_id ON node_migrations(node_type_id, created_at);
+-- At most one active migration per node type
+CREATE UNIQUE INDEX IF NOT EXISTS idx_node_migrations_active ON node_migrations(node_type_id)
+    WHERE status IN ('pending', 'running');
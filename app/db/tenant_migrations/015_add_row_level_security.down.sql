@@ -0,0 +1,52 @@
+-- Migration: 015_add_row_level_security.down.sql
+
+DROP POLICY IF EXISTS tenant_isolation ON node_migrations;
+ALTER TABLE node_migrations NO FORCE ROW LEVEL SECURITY;
+ALTER TABLE node_migrations DISABLE ROW LEVEL SECURITY;
+
+DROP POLICY IF EXISTS tenant_isolation ON lake_exports;
+ALTER TABLE lake_exports NO FORCE ROW LEVEL SECURITY;
+ALTER TABLE lake_exports DISABLE ROW LEVEL SECURITY;
+
+DROP POLICY IF EXISTS tenant_isolation ON email_attachments;
+ALTER TABLE email_attachments NO FORCE ROW LEVEL SECURITY;
+ALTER TABLE email_attachments DISABLE ROW LEVEL SECURITY;
+
+DROP POLICY IF EXISTS tenant_isolation ON inbound_emails;
+ALTER TABLE inbound_emails NO FORCE ROW LEVEL SECURITY;
+ALTER TABLE inbound_emails DISABLE ROW LEVEL SECURITY;
+
+DROP POLICY IF EXISTS tenant_isolation ON email_inboxes;
+ALTER TABLE email_inboxes NO FORCE ROW LEVEL SECURITY;
+ALTER TABLE email_inboxes DISABLE ROW LEVEL SECURITY;
+
+DROP POLICY IF EXISTS tenant_isolation ON intake_forms;
+ALTER TABLE intake_forms NO FORCE ROW LEVEL SECURITY;
+ALTER TABLE intake_forms DISABLE ROW LEVEL SECURITY;
+
+DROP POLICY IF EXISTS tenant_isolation ON webhook_deliveries;
+ALTER TABLE webhook_deliveries NO FORCE ROW LEVEL SECURITY;
+ALTER TABLE webhook_deliveries DISABLE ROW LEVEL SECURITY;
+
+DROP POLICY IF EXISTS tenant_isolation ON webhook_endpoints;
+ALTER TABLE webhook_endpoints NO FORCE ROW LEVEL SECURITY;
+ALTER TABLE webhook_endpoints DISABLE ROW LEVEL SECURITY;
+
+DROP POLICY IF EXISTS tenant_isolation ON outbox_events;
+ALTER TABLE outbox_events NO FORCE ROW LEVEL SECURITY;
+ALTER TABLE outbox_events DISABLE ROW LEVEL SECURITY;
+
+DROP POLICY IF EXISTS tenant_isolation ON relationships;
+ALTER TABLE relationships NO FORCE ROW LEVEL SECURITY;
+ALTER TABLE relationships DISABLE ROW LEVEL SECURITY;
+
+DROP POLICY IF EXISTS tenant_isolation ON nodes;
+ALTER TABLE nodes NO FORCE ROW LEVEL SECURITY;
+ALTER TABLE nodes DISABLE ROW LEVEL SECURITY;
+
+DROP POLICY IF EXISTS tenant_isolation ON node_types;
+ALTER TABLE node_types NO FORCE ROW LEVEL SECURITY;
+ALTER TABLE node_types DISABLE ROW LEVEL SECURITY;
+
+DROP FUNCTION IF EXISTS flexdb_tenant_visible();
+DROP TABLE IF EXISTS tenant_identity;
@@ -0,0 +1,75 @@
+-- Migration: 015_add_row_level_security.up.sql
+-- Row-level security on all tenant tables (see app/db/rls.py). The tenant
+-- owning this database is recorded in tenant_identity by the server; rows are
+-- visible when app.current_tenant is empty or names that tenant.
+
+CREATE TABLE IF NOT EXISTS tenant_identity (
+    singleton  BOOLEAN PRIMARY KEY DEFAULT TRUE CHECK (singleton),
+    tenant_id  UUID NOT NULL
+);
+
+CREATE OR REPLACE FUNCTION flexdb_tenant_visible() RETURNS boolean
+LANGUAGE sql STABLE AS $$
+    SELECT COALESCE(current_setting('app.current_tenant', true), '') IN ('', (SELECT tenant_id::text FROM tenant_identity))
+$$;
+
+ALTER TABLE node_types ENABLE ROW LEVEL SECURITY;
+ALTER TABLE node_types FORCE ROW LEVEL SECURITY;
+DROP POLICY IF EXISTS tenant_isolation ON node_types;
+-- The subquery evaluates the check once per statement rather than per row
+CREATE POLICY tenant_isolation ON node_types USING ((SELECT flexdb_tenant_visible()));
+
+ALTER TABLE nodes ENABLE ROW LEVEL SECURITY;
+ALTER TABLE nodes FORCE ROW LEVEL SECURITY;
+DROP POLICY IF EXISTS tenant_isolation ON nodes;
+CREATE POLICY tenant_isolation ON nodes USING ((SELECT flexdb_tenant_visible()));
+
+ALTER TABLE relationships ENABLE ROW LEVEL SECURITY;
+ALTER TABLE relationships FORCE ROW LEVEL SECURITY;
+DROP POLICY IF EXISTS tenant_isolation ON relationships;
+CREATE POLICY tenant_isolation ON relationships USING ((SELECT flexdb_tenant_visible()));
+
+ALTER TABLE outbox_events ENABLE ROW LEVEL SECURITY;
+ALTER TABLE outbox_events FORCE ROW LEVEL SECURITY;
+DROP POLICY IF EXISTS tenant_isolation ON outbox_events;
+CREATE POLICY tenant_isolation ON outbox_events USING ((SELECT flexdb_tenant_visible()));
+
+ALTER TABLE webhook_endpoints ENABLE ROW LEVEL SECURITY;
+ALTER TABLE webhook_endpoints FORCE ROW LEVEL SECURITY;
+DROP POLICY IF EXISTS tenant_isolation ON webhook_endpoints;
+CREATE POLICY tenant_isolation ON webhook_endpoints USING ((SELECT flexdb_tenant_visible()));
+
+ALTER TABLE webhook_deliveries ENABLE ROW LEVEL SECURITY;
+ALTER TABLE webhook_deliveries FORCE ROW LEVEL SECURITY;
+DROP POLICY IF EXISTS tenant_isolation ON webhook_deliveries;
+CREATE POLICY tenant_isolation ON webhook_deliveries USING ((SELECT flexdb_tenant_visible()));
+
+ALTER TABLE intake_forms ENABLE ROW LEVEL SECURITY;
+ALTER TABLE intake_forms FORCE ROW LEVEL SECURITY;
+DROP POLICY IF EXISTS tenant_isolation ON intake_forms;
+CREATE POLICY tenant_isolation ON intake_forms USING ((SELECT flexdb_tenant_visible()));
+
+ALTER TABLE email_inboxes ENABLE ROW LEVEL SECURITY;
+ALTER TABLE email_inboxes FORCE ROW LEVEL SECURITY;
+DROP POLICY IF EXISTS tenant_isolation ON email_inboxes;
+CREATE POLICY tenant_isolation ON email_inboxes USING ((SELECT flexdb_tenant_visible()));
+
+ALTER TABLE inbound_emails ENABLE ROW LEVEL SECURITY;
+ALTER TABLE inbound_emails FORCE ROW LEVEL SECURITY;
+DROP POLICY IF EXISTS tenant_isolation ON inbound_emails;
+CREATE POLICY tenant_isolation ON inbound_emails USING ((SELECT flexdb_tenant_visible()));
+
+ALTER TABLE email_attachments ENABLE ROW LEVEL SECURITY;
+ALTER TABLE email_attachments FORCE ROW LEVEL SECURITY;
+DROP POLICY IF EXISTS tenant_isolation ON email_attachments;
+CREATE POLICY tenant_isolation ON email_attachments USING ((SELECT flexdb_tenant_visible()));
+
+ALTER TABLE lake_exports ENABLE ROW LEVEL SECURITY;
+ALTER TABLE lake_exports FORCE ROW LEVEL SECURITY;
+DROP POLICY IF EXISTS tenant_isolation ON lake_exports;
+CREATE POLICY tenant_isolation ON lake_exports USING ((SELECT flexdb_tenant_visible()));
+
+ALTER TABLE node_migrations ENABLE ROW LEVEL SECURITY;
+ALTER TABLE node_migrations FORCE ROW LEVEL SECURITY;
+DROP POLICY IF EXISTS tenant_isolation ON node_migrations;
+CREATE POLICY tenant_isolation ON node_migrations USING ((SELECT flexdb_tenant_visible()));
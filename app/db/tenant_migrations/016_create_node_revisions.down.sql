@@ -0,0 +1,3 @@
+-- Migration: 016_create_node_revisions.down.sql
+
+DROP TABLE IF EXISTS node_revisions;
@@ -0,0 +1,32 @@
+-- Migration: 016_create_node_revisions.up.sql
+-- Immutable history of nodes: a revision is written with every create,
+-- update and delete, valid from revised_at until the node's next revision.
+-- Revisions outlive their node, so they don't reference it.
+
+CREATE TABLE IF NOT EXISTS node_revisions (
+    id              BIGSERIAL PRIMARY KEY,
+    node_id         UUID NOT NULL,
+    node_type_id    UUID NOT NULL,
+    -- The node's version; a deleted revision keeps the last version
+    version         BIGINT NOT NULL,
+    op              TEXT NOT NULL CHECK (op IN ('created', 'updated', 'deleted')),
+    data            JSONB NOT NULL,
+    schema_version  INTEGER NOT NULL,
+    -- When the node was created, to return it as of a revision
+    node_created_at TIMESTAMPTZ NOT NULL,
+    revised_at      TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_node_revisions_node_id ON node_revisions(node_id, revised_at, id);
+
+-- Nodes created before revisions were recorded start with their current state
+INSERT INTO node_revisions (node_id, node_type_id, version, op, data, schema_version, node_created_at, revised_at)
+SELECT id, node_type_id, version, CASE WHEN version > 1 THEN 'updated' ELSE 'created' END,
+       data, schema_version, created_at, updated_at
+FROM nodes
+WHERE NOT EXISTS (SELECT 1 FROM node_revisions r WHERE r.node_id = nodes.id);
+
+ALTER TABLE node_revisions ENABLE ROW LEVEL SECURITY;
+ALTER TABLE node_revisions FORCE ROW LEVEL SECURITY;
+DROP POLICY IF EXISTS tenant_isolation ON node_revisions;
+CREATE POLICY tenant_isolation ON node_revisions USING ((SELECT flexdb_tenant_visible()));
@@ -0,0 +1,4 @@
+-- Migration: 017_add_public_endpoint_signing.down.sql
+
+ALTER TABLE email_inboxes DROP COLUMN IF EXISTS signing_secret;
+ALTER TABLE intake_forms DROP COLUMN IF EXISTS signing_secret;
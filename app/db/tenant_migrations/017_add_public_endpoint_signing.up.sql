@@ -0,0 +1,6 @@
+-- Migration: 017_add_public_endpoint_signing.up.sql
+-- Optional HMAC signing secrets of the public intake form and email inbox
+-- endpoints (see app/events/signing.py); empty when requests need no signature
+
+ALTER TABLE intake_forms ADD COLUMN IF NOT EXISTS signing_secret TEXT NOT NULL DEFAULT '';
+ALTER TABLE email_inboxes ADD COLUMN IF NOT EXISTS signing_secret TEXT NOT NULL DEFAULT '';
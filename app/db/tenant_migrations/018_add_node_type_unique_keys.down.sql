@@ -0,0 +1,14 @@
+-- Migration: 018_add_node_type_unique_keys.down.sql
+
+DO $$
+DECLARE
+    index_name TEXT;
+BEGIN
+    FOR index_name IN
+        SELECT indexname FROM pg_indexes WHERE tablename = 'nodes' AND indexname LIKE 'nodes\_unique\_%'
+    LOOP
+        EXECUTE format('DROP INDEX IF EXISTS %I', index_name);
+    END LOOP;
+END $$;
+
+ALTER TABLE node_types DROP COLUMN IF EXISTS unique_keys;
@@ -0,0 +1,6 @@
+-- Migration: 018_add_node_type_unique_keys.up.sql
+-- Unique keys of a node type: lists of data fields whose values must be
+-- unique among its nodes, e.g. [["email"]]. Each key is enforced by a partial
+-- unique expression index on nodes (see app/repository/unique_keys.py).
+
+ALTER TABLE node_types ADD COLUMN IF NOT EXISTS unique_keys JSONB NOT NULL DEFAULT '[]';
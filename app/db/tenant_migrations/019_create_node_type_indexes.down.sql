@@ -0,0 +1,14 @@
+-- Migration: 019_create_node_type_indexes.down.sql
+
+DO $$
+DECLARE
+    index_name TEXT;
+BEGIN
+    FOR index_name IN
+        SELECT indexname FROM pg_indexes WHERE tablename = 'nodes' AND indexname LIKE 'nodes\_idx\_%'
+    LOOP
+        EXECUTE format('DROP INDEX IF EXISTS %I', index_name);
+    END LOOP;
+END $$;
+
+DROP TABLE IF EXISTS node_type_indexes;
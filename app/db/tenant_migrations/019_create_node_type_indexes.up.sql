@@ -0,0 +1,22 @@
+-- Migration: 019_create_node_type_indexes.up.sql
+-- Secondary indexes on node data paths, declared per node type. Each is a
+-- partial btree or GIN expression index on nodes named nodes_idx_<id>
+-- (see app/repository/node_indexes.py). An index stays 'building' until
+-- CREATE INDEX CONCURRENTLY finished.
+
+CREATE TABLE IF NOT EXISTS node_type_indexes (
+    id            UUID PRIMARY KEY,
+    node_type_id  UUID NOT NULL REFERENCES node_types(id) ON DELETE CASCADE,
+    name          TEXT NOT NULL,
+    method        TEXT NOT NULL CHECK (method IN ('btree', 'gin')),
+    -- Data paths, each an array of keys, e.g. [["address", "city"]]
+    paths         JSONB NOT NULL,
+    status        TEXT NOT NULL DEFAULT 'building' CHECK (status IN ('building', 'ready')),
+    created_at    TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    UNIQUE (node_type_id, name)
+);
+
+ALTER TABLE node_type_indexes ENABLE ROW LEVEL SECURITY;
+ALTER TABLE node_type_indexes FORCE ROW LEVEL SECURITY;
+DROP POLICY IF EXISTS tenant_isolation ON node_type_indexes;
+CREATE POLICY tenant_isolation ON node_type_indexes USING ((SELECT flexdb_tenant_visible()));
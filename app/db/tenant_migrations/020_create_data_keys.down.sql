@@ -0,0 +1,4 @@
+-- Migration: 020_create_data_keys.down.sql
+-- Values encrypted with these keys can no longer be decrypted afterwards.
+
+DROP TABLE IF EXISTS data_keys;
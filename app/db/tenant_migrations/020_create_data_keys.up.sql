@@ -0,0 +1,16 @@
+-- Migration: 020_create_data_keys.up.sql
+-- Keys encrypting the sensitive data fields of the tenant's nodes, wrapped by
+-- the key encryption key of the tenant in the KMS (see app/encryption). New
+-- values are encrypted with the latest version; encrypted values name theirs.
+
+CREATE TABLE IF NOT EXISTS data_keys (
+    version      INTEGER PRIMARY KEY,
+    kms_key_id   TEXT NOT NULL,
+    wrapped_key  BYTEA NOT NULL,
+    created_at   TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+ALTER TABLE data_keys ENABLE ROW LEVEL SECURITY;
+ALTER TABLE data_keys FORCE ROW LEVEL SECURITY;
+DROP POLICY IF EXISTS tenant_isolation ON data_keys;
+CREATE POLICY tenant_isolation ON data_keys USING ((SELECT flexdb_tenant_visible()));
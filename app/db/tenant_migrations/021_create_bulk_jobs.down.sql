@@ -0,0 +1,3 @@
+-- Migration: 021_create_bulk_jobs.down.sql
+
+DROP TABLE IF EXISTS bulk_jobs;
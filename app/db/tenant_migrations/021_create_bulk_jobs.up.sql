@@ -0,0 +1,27 @@
+-- Migration: 021_create_bulk_jobs.up.sql
+-- Imports, bulk deletes and backfills, recorded while they run so their
+-- progress can be read and they can be cancelled (see
+-- app/service/bulk_job_service.py). A job stops after its current batch once
+-- its status is no longer running.
+
+CREATE TABLE IF NOT EXISTS bulk_jobs (
+    id           UUID PRIMARY KEY,
+    kind         TEXT NOT NULL,
+    status       TEXT NOT NULL DEFAULT 'running',
+    params       JSONB NOT NULL DEFAULT '{}',
+    processed    BIGINT NOT NULL DEFAULT 0,
+    total        BIGINT,
+    unit         TEXT NOT NULL,
+    progress     JSONB NOT NULL DEFAULT '{}',
+    error        TEXT,
+    created_at   TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at   TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    finished_at  TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS idx_bulk_jobs_kind ON bulk_jobs(kind, created_at);
+
+ALTER TABLE bulk_jobs ENABLE ROW LEVEL SECURITY;
+ALTER TABLE bulk_jobs FORCE ROW LEVEL SECURITY;
+DROP POLICY IF EXISTS tenant_isolation ON bulk_jobs;
+CREATE POLICY tenant_isolation ON bulk_jobs USING ((SELECT flexdb_tenant_visible()));
@@ -0,0 +1,3 @@
+-- Migration: 022_create_dead_letters.down.sql
+
+DROP TABLE IF EXISTS dead_letters;
@@ -0,0 +1,27 @@
+-- Migration: 022_create_dead_letters.up.sql
+-- Dead letters: webhook deliveries that ran out of attempts and failed node
+-- migrations, with their error and what replaying them needs (see
+-- app/service/dead_letter_service.py). They are added in the transaction
+-- recording the failure.
+
+CREATE TABLE IF NOT EXISTS dead_letters (
+    id            UUID PRIMARY KEY,
+    kind          TEXT NOT NULL,
+    source_id     UUID NOT NULL,
+    payload       JSONB NOT NULL DEFAULT '{}',
+    error         TEXT,
+    attempts      INTEGER NOT NULL DEFAULT 0,
+    status        TEXT NOT NULL DEFAULT 'dead',
+    replay_count  INTEGER NOT NULL DEFAULT 0,
+    replay_result JSONB NOT NULL DEFAULT '{}',
+    created_at    TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at    TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    replayed_at   TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS idx_dead_letters_status ON dead_letters(status, kind, created_at);
+
+ALTER TABLE dead_letters ENABLE ROW LEVEL SECURITY;
+ALTER TABLE dead_letters FORCE ROW LEVEL SECURITY;
+DROP POLICY IF EXISTS tenant_isolation ON dead_letters;
+CREATE POLICY tenant_isolation ON dead_letters USING ((SELECT flexdb_tenant_visible()));
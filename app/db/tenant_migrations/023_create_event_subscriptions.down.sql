@@ -0,0 +1,4 @@
+-- Migration: 023_create_event_subscriptions.down.sql
+
+DROP TABLE IF EXISTS subscription_messages;
+DROP TABLE IF EXISTS event_subscriptions;
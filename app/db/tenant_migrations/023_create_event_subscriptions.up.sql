@@ -0,0 +1,42 @@
+-- Migration: 023_create_event_subscriptions.up.sql
+-- Pull subscriptions: consumers fetch a subscription's change events in
+-- batches and acknowledge them, instead of receiving webhooks (see
+-- app/service/subscription_service.py). Events are queued per subscription
+-- when the dispatcher fans out the outbox, next to webhook deliveries.
+
+CREATE TABLE IF NOT EXISTS event_subscriptions (
+    id                   UUID PRIMARY KEY,
+    name                 TEXT NOT NULL UNIQUE,
+    event_types          TEXT[] NOT NULL DEFAULT '{}',
+    node_type_ids        TEXT[] NOT NULL DEFAULT '{}',
+    ack_deadline_seconds INTEGER NOT NULL DEFAULT 60,
+    status               TEXT NOT NULL DEFAULT 'active',
+    created_at           TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at           TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- Events not yet acknowledged, in outbox order; pulled events are leased
+-- until their ack deadline and offered again if not acknowledged by then
+CREATE TABLE IF NOT EXISTS subscription_messages (
+    id              BIGSERIAL PRIMARY KEY,
+    subscription_id UUID NOT NULL REFERENCES event_subscriptions(id) ON DELETE CASCADE,
+    event_id        UUID NOT NULL,
+    event_type      TEXT NOT NULL,
+    payload         JSONB NOT NULL DEFAULT '{}',
+    delivery_count  INTEGER NOT NULL DEFAULT 0,
+    leased_until    TIMESTAMPTZ,
+    created_at      TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    UNIQUE (subscription_id, event_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_subscription_messages_subscription ON subscription_messages(subscription_id, id);
+
+ALTER TABLE event_subscriptions ENABLE ROW LEVEL SECURITY;
+ALTER TABLE event_subscriptions FORCE ROW LEVEL SECURITY;
+DROP POLICY IF EXISTS tenant_isolation ON event_subscriptions;
+CREATE POLICY tenant_isolation ON event_subscriptions USING ((SELECT flexdb_tenant_visible()));
+
+ALTER TABLE subscription_messages ENABLE ROW LEVEL SECURITY;
+ALTER TABLE subscription_messages FORCE ROW LEVEL SECURITY;
+DROP POLICY IF EXISTS tenant_isolation ON subscription_messages;
+CREATE POLICY tenant_isolation ON subscription_messages USING ((SELECT flexdb_tenant_visible()));
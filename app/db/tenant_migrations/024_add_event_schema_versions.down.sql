@@ -0,0 +1,6 @@
+-- Migration: 024_add_event_schema_versions.down.sql
+-- Drop event schema version columns
+
+ALTER TABLE subscription_messages DROP COLUMN IF EXISTS schema_version;
+ALTER TABLE webhook_deliveries DROP COLUMN IF EXISTS schema_version;
+ALTER TABLE outbox_events DROP COLUMN IF EXISTS schema_version;
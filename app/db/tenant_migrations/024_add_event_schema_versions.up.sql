@@ -0,0 +1,8 @@
+-- Migration: 024_add_event_schema_versions.up.sql
+-- Version of the event schema (see app/events/schemas.py) each event's payload
+-- was written with, carried from the outbox to webhook deliveries and
+-- subscription messages. Events recorded before this are all version 1.
+
+ALTER TABLE outbox_events ADD COLUMN IF NOT EXISTS schema_version INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE webhook_deliveries ADD COLUMN IF NOT EXISTS schema_version INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE subscription_messages ADD COLUMN IF NOT EXISTS schema_version INTEGER NOT NULL DEFAULT 1;
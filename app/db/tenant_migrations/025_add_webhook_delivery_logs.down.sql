@@ -0,0 +1,7 @@
+-- Migration: 025_add_webhook_delivery_logs.down.sql
+-- Drop webhook delivery log columns
+
+DROP INDEX IF EXISTS idx_webhook_deliveries_endpoint_created;
+ALTER TABLE webhook_deliveries DROP COLUMN IF EXISTS test;
+ALTER TABLE webhook_deliveries DROP COLUMN IF EXISTS last_latency_ms;
+ALTER TABLE webhook_deliveries DROP COLUMN IF EXISTS last_attempt_at;
@@ -0,0 +1,10 @@
+-- Migration: 025_add_webhook_delivery_logs.up.sql
+-- Delivery logs of webhook endpoints: when the last attempt of a delivery was
+-- made and how long the endpoint took to respond, and whether the delivery
+-- is a test event sent on request rather than a change event.
+
+ALTER TABLE webhook_deliveries ADD COLUMN IF NOT EXISTS last_attempt_at TIMESTAMPTZ;
+ALTER TABLE webhook_deliveries ADD COLUMN IF NOT EXISTS last_latency_ms INTEGER;
+ALTER TABLE webhook_deliveries ADD COLUMN IF NOT EXISTS test BOOLEAN NOT NULL DEFAULT FALSE;
+
+CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_endpoint_created ON webhook_deliveries(endpoint_id, created_at DESC);
@@ -0,0 +1,4 @@
+-- Migration: 026_add_node_revision_actors.down.sql
+-- Drop node revision actors
+
+ALTER TABLE node_revisions DROP COLUMN IF EXISTS actor;
@@ -0,0 +1,6 @@
+-- Migration: 026_add_node_revision_actors.up.sql
+-- Who made each node revision: "api_key:<API key ID>", "admin" or
+-- "anonymous" for changes made by requests, empty for changes made by
+-- background jobs and for revisions written before actors were recorded.
+
+ALTER TABLE node_revisions ADD COLUMN IF NOT EXISTS actor TEXT NOT NULL DEFAULT '';
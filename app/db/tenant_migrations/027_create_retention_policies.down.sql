@@ -0,0 +1,3 @@
+-- Migration: 027_create_retention_policies.down.sql
+
+DROP TABLE IF EXISTS retention_policies;
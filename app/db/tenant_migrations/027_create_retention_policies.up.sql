@@ -0,0 +1,23 @@
+-- Migration: 027_create_retention_policies.up.sql
+-- Retention policies: nodes of a node type expire ttl_seconds after their
+-- created_at, updated_at or a timestamp data field, and are deleted or purged
+-- by the retention sweeper (see app/jobs/retention.py)
+
+CREATE TABLE IF NOT EXISTS retention_policies (
+    node_type_id       UUID PRIMARY KEY REFERENCES node_types(id) ON DELETE CASCADE,
+    -- created_at, updated_at or data.<path> of an ISO-8601 timestamp
+    timestamp_field    TEXT NOT NULL DEFAULT 'created_at',
+    ttl_seconds        BIGINT NOT NULL CHECK (ttl_seconds > 0),
+    -- delete keeps the revisions of expired nodes, purge removes them too
+    action             TEXT NOT NULL DEFAULT 'delete' CHECK (action IN ('delete', 'purge')),
+    created_at         TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at         TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    last_swept_at      TIMESTAMPTZ,
+    -- Nodes expired by the last sweep, or with a dry run, that would have been
+    last_expired_count BIGINT NOT NULL DEFAULT 0
+);
+
+ALTER TABLE retention_policies ENABLE ROW LEVEL SECURITY;
+ALTER TABLE retention_policies FORCE ROW LEVEL SECURITY;
+DROP POLICY IF EXISTS tenant_isolation ON retention_policies;
+CREATE POLICY tenant_isolation ON retention_policies USING ((SELECT flexdb_tenant_visible()));
@@ -0,0 +1,5 @@
+-- Migration: 028_add_outbox_event_xids.down.sql
+-- Drop outbox event transaction IDs
+
+DROP INDEX IF EXISTS idx_outbox_events_xid;
+ALTER TABLE outbox_events DROP COLUMN IF EXISTS xid;
@@ -0,0 +1,9 @@
+-- Migration: 028_add_outbox_event_xids.up.sql
+-- ID of the transaction that wrote each outbox event, so the change feed can
+-- list exactly the events not visible in a snapshot, such as an export's (see
+-- list_changes). Events recorded before this get the migration's transaction
+-- ID, as if they were committed by it.
+
+ALTER TABLE outbox_events ADD COLUMN IF NOT EXISTS xid xid8 NOT NULL DEFAULT pg_current_xact_id();
+
+CREATE INDEX IF NOT EXISTS idx_outbox_events_xid ON outbox_events(xid);
@@ -0,0 +1,3 @@
+-- Migration: 029_create_attachments.down.sql
+
+DROP TABLE IF EXISTS attachments;
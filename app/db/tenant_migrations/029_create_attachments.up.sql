@@ -0,0 +1,21 @@
+-- Migration: 029_create_attachments.up.sql
+-- Files attached to nodes. Only their metadata is stored here; the bytes are
+-- kept in the blob store under blob_key (see app/blobs).
+
+CREATE TABLE IF NOT EXISTS attachments (
+    id           UUID PRIMARY KEY,
+    node_id      UUID NOT NULL REFERENCES nodes(id) ON DELETE CASCADE,
+    filename     TEXT NOT NULL,
+    content_type TEXT NOT NULL,
+    size_bytes   BIGINT NOT NULL,
+    sha256       TEXT NOT NULL,
+    blob_key     TEXT NOT NULL,
+    created_at   TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_attachments_node_id ON attachments(node_id);
+
+ALTER TABLE attachments ENABLE ROW LEVEL SECURITY;
+ALTER TABLE attachments FORCE ROW LEVEL SECURITY;
+DROP POLICY IF EXISTS tenant_isolation ON attachments;
+CREATE POLICY tenant_isolation ON attachments USING ((SELECT flexdb_tenant_visible()));
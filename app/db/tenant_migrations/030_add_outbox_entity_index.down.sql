@@ -0,0 +1,4 @@
+-- Migration: 030_add_outbox_entity_index.down.sql
+-- Drop the outbox event entity type index
+
+DROP INDEX IF EXISTS idx_outbox_events_entity_type;
@@ -0,0 +1,5 @@
+-- Migration: 030_add_outbox_entity_index.up.sql
+-- Index outbox events by entity type, so the node type catalog can read the
+-- newest node type event (its generation) without scanning the outbox.
+
+CREATE INDEX IF NOT EXISTS idx_outbox_events_entity_type ON outbox_events(entity_type, id);
@@ -0,0 +1,3 @@
+-- Migration: 031_create_node_locks.down.sql
+
+DROP TABLE IF EXISTS node_locks;
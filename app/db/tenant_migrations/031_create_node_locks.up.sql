@@ -0,0 +1,18 @@
+-- Migration: 031_create_node_locks.up.sql
+-- Leases editors take on nodes to keep others from changing them at the same
+-- time (see app/service/node_lock_service.py). A node has at most one lock;
+-- expired locks stay until they are taken over or released.
+
+CREATE TABLE IF NOT EXISTS node_locks (
+    node_id     UUID PRIMARY KEY REFERENCES nodes(id) ON DELETE CASCADE,
+    holder      TEXT NOT NULL,
+    token       TEXT NOT NULL,
+    enforced    BOOLEAN NOT NULL DEFAULT FALSE,
+    acquired_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    expires_at  TIMESTAMPTZ NOT NULL
+);
+
+ALTER TABLE node_locks ENABLE ROW LEVEL SECURITY;
+ALTER TABLE node_locks FORCE ROW LEVEL SECURITY;
+DROP POLICY IF EXISTS tenant_isolation ON node_locks;
+CREATE POLICY tenant_isolation ON node_locks USING ((SELECT flexdb_tenant_visible()));
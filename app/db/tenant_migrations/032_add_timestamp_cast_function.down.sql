@@ -0,0 +1,3 @@
+-- Migration: 032_add_timestamp_cast_function.down.sql
+
+DROP FUNCTION IF EXISTS flexdb_try_timestamptz(TEXT);
@@ -0,0 +1,13 @@
+-- Migration: 032_add_timestamp_cast_function.up.sql
+-- Casts text to a timestamp, NULL instead of an error when it isn't a valid
+-- one (e.g. 2024-02-30). Date histograms read timestamps out of node data with
+-- it, so one bad value leaves that node out rather than failing the aggregate.
+
+CREATE OR REPLACE FUNCTION flexdb_try_timestamptz(value TEXT) RETURNS TIMESTAMPTZ
+LANGUAGE plpgsql STABLE AS $$
+BEGIN
+    RETURN value::timestamptz;
+EXCEPTION WHEN invalid_datetime_format OR datetime_field_overflow THEN
+    RETURN NULL;
+END
+$$;
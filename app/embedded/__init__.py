@@ -0,0 +1,37 @@
+"""
+Embedded mode: flexy-db as a library, without running the server.
+
+    db = await open_embedded(backend=MEMORY)
+    tenant = (await db.call("create_tenant", {"slug": "acme", "name": "Acme"}))["tenant"]
+    node_type = (await db.call("create_node_type", {"tenant_id": tenant["id"], "name": "Task"}))["node_type"]
+    ...
+    await db.close()
+
+open_embedded wires the repositories and services like the server does at
+startup, and call() dispatches JSON-RPC methods in-process through the same
+method chain as POST /jsonrpc (plugins, logging, metrics, authorization), so
+results and errors match the server's without a network round trip. Hot
+paths can call the services directly instead, through the stable interfaces
+of app/embedded/interfaces.py:
+
+    async with db.tenant(tenant["id"]) as t:
+        task = await t.nodes.create(node_type["id"], '{"title": "A"}')
+"""
+
+from app.embedded.interfaces import NodeTypes, Nodes, Relationships, TenantServices, Tenants, Users
+from app.embedded.library import MEMORY, POSTGRES, SQLITE, Embedded, EmbeddedError, open_embedded
+
+__all__ = [
+    "MEMORY",
+    "POSTGRES",
+    "SQLITE",
+    "Embedded",
+    "EmbeddedError",
+    "open_embedded",
+    "Tenants",
+    "Users",
+    "NodeTypes",
+    "Nodes",
+    "Relationships",
+    "TenantServices",
+]
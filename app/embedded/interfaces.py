@@ -0,0 +1,193 @@
+"""
+Stable interfaces of the service layer, for applications calling it directly.
+
+Embedded (see app/embedded/library.py) hands out services typed with these
+protocols rather than the service classes, so applications only depend on
+the methods listed here: they keep their signatures across releases, while
+the classes behind them, their constructors and other methods may change.
+Arguments and results are the models of app.repository; errors are the
+exceptions of app.repository.errors and ValueError for invalid arguments,
+as raised by the services.
+"""
+
+from dataclasses import dataclass
+from typing import Any, AsyncIterator, Dict, List, Optional, Protocol, Tuple, runtime_checkable
+
+from app.repository import (
+    AggregationBucket,
+    FilterValues,
+    ListResult,
+    Node,
+    NodeRevision,
+    NodeType,
+    NodeTypeIndex,
+    Relationship,
+    Tenant,
+    TenantDeletion,
+    TenantUser,
+    User,
+)
+from app.service.field_history import FieldChange
+
+
+@runtime_checkable
+class Tenants(Protocol):
+    """Tenants and their lifecycle (control plane)."""
+
+    async def create(self, slug: str, name: str) -> Tenant: ...
+    async def get_by_id(self, id: str) -> Tenant: ...
+    async def update(self, id: str, slug: str, name: str, status: str) -> Tenant: ...
+    async def suspend(self, id: str, reason: str = "") -> Tenant: ...
+    async def archive(self, id: str, reason: str = "") -> Tenant: ...
+    async def reactivate(self, id: str, reason: str = "") -> Tenant: ...
+    async def delete(self, id: str) -> Optional[TenantDeletion]: ...
+    async def deletion_status(self, id: str) -> TenantDeletion: ...
+    async def list(self, page_size: int, page_token: str) -> Tuple[List[Tenant], ListResult]: ...
+
+
+@runtime_checkable
+class Users(Protocol):
+    """Users and their tenant memberships (control plane)."""
+
+    async def create(self, email: str, display_name: str) -> User: ...
+    async def get_by_id(self, id: str) -> User: ...
+    async def update(self, id: str, email: str, display_name: str) -> User: ...
+    async def delete(self, id: str) -> None: ...
+    async def list(self, page_size: int, page_token: str) -> Tuple[List[User], ListResult]: ...
+    async def add_to_tenant(self, tenant_id: str, user_id: str, role: str) -> TenantUser: ...
+    async def remove_from_tenant(self, tenant_id: str, user_id: str) -> None: ...
+    async def list_tenant_users(
+        self, tenant_id: str, page_size: int, page_token: str
+    ) -> Tuple[List[TenantUser], ListResult]: ...
+
+
+@runtime_checkable
+class NodeTypes(Protocol):
+    """A tenant's node types and their indexes."""
+
+    async def create(
+        self,
+        name: str,
+        description: str,
+        schema: str,
+        display: str = "",
+        unique_keys: Optional[List[Any]] = None,
+        dry_run: bool = False
+    ) -> NodeType: ...
+    async def get_by_id(self, id: str) -> NodeType: ...
+    async def batch_get(self, ids: List[str]) -> Tuple[List[NodeType], List[str]]: ...
+    async def update(
+        self,
+        id: str,
+        name: str,
+        description: str,
+        schema: str,
+        expected_version: Optional[int] = None,
+        display: str = "",
+        if_match: str = "",
+        dry_run: bool = False
+    ) -> NodeType: ...
+    async def delete(
+        self, id: str, expected_version: Optional[int] = None, if_match: str = "", dry_run: bool = False
+    ) -> None: ...
+    async def list(
+        self, page_size: int, page_token: str, order_by: Any = None
+    ) -> Tuple[List[NodeType], ListResult]: ...
+    async def describe(self) -> List[NodeType]: ...
+    async def create_index(self, node_type_id: str, name: str, method: str, paths: Any) -> NodeTypeIndex: ...
+    async def list_indexes(self, node_type_id: str) -> List[NodeTypeIndex]: ...
+    async def drop_index(self, node_type_id: str, name: str) -> NodeTypeIndex: ...
+
+
+@runtime_checkable
+class Nodes(Protocol):
+    """A tenant's nodes, their revisions and aggregations."""
+
+    async def create(self, node_type_id: str, data: str, dry_run: bool = False) -> Node: ...
+    async def get_by_id(self, id: str, locale: str = "") -> Node: ...
+    async def batch_get(self, ids: List[str], locale: str = "") -> Tuple[List[Node], List[str]]: ...
+    async def update(
+        self, id: str, data: str, expected_version: Optional[int] = None, if_match: str = "", dry_run: bool = False
+    ) -> Node: ...
+    async def delete(
+        self, id: str, expected_version: Optional[int] = None, if_match: str = "", dry_run: bool = False
+    ) -> None: ...
+    async def delete_many(self, node_type_id: Optional[str], data_filter: Any, dry_run: bool = False) -> int: ...
+    async def list_revisions(
+        self, id: str, page_size: int, page_token: str
+    ) -> Tuple[List[NodeRevision], ListResult]: ...
+    async def diff_revisions(
+        self, id: str, from_revision_id: str, to_revision_id: str = ""
+    ) -> Tuple[NodeRevision, NodeRevision, Dict[str, List[Dict[str, Any]]]]: ...
+    async def field_history(
+        self, id: str, path: str, page_size: int, page_token: str
+    ) -> Tuple[List[FieldChange], ListResult]: ...
+    async def get_at(self, id: str, timestamp: str, locale: str = "") -> Node: ...
+    async def list(
+        self,
+        node_type_id: Optional[str],
+        page_size: int,
+        page_token: str,
+        geo: Optional[Dict[str, Any]] = None,
+        locale: str = "",
+        data_filter: Any = None,
+        contains: Any = None,
+        order_by: Any = None,
+        as_of: str = ""
+    ) -> Tuple[List[Node], ListResult]: ...
+    def stream(self, node_type_id: Optional[str], batch_size: int = ...) -> AsyncIterator[Node]: ...
+    async def count(self, node_type_id: Optional[str], data_filter: Any = None, contains: Any = None) -> int: ...
+    async def aggregate(
+        self,
+        node_type_id: Optional[str],
+        aggregation: Dict[str, Any],
+        data_filter: Any = None,
+        contains: Any = None
+    ) -> List[AggregationBucket]: ...
+
+
+@runtime_checkable
+class Relationships(Protocol):
+    """A tenant's relationships between nodes."""
+
+    async def create(
+        self, source_node_id: str, target_node_id: str, rel_type: str, data: str, dry_run: bool = False
+    ) -> Relationship: ...
+    async def get_by_id(self, id: str) -> Relationship: ...
+    async def update(
+        self,
+        id: str,
+        rel_type: str,
+        data: str,
+        expected_version: Optional[int] = None,
+        if_match: str = "",
+        dry_run: bool = False
+    ) -> Relationship: ...
+    async def delete(
+        self, id: str, expected_version: Optional[int] = None, if_match: str = "", dry_run: bool = False
+    ) -> None: ...
+    async def delete_many(
+        self,
+        source_node_id: Optional[str],
+        target_node_id: Optional[str],
+        rel_type: Optional[str],
+        dry_run: bool = False
+    ) -> int: ...
+    async def list(
+        self,
+        source_node_id: FilterValues,
+        target_node_id: FilterValues,
+        rel_type: FilterValues,
+        page_size: int,
+        page_token: str,
+        order_by: Any = None
+    ) -> Tuple[List[Relationship], ListResult]: ...
+
+
+@dataclass(frozen=True)
+class TenantServices:
+    """The data plane services of one tenant; see Embedded.tenant."""
+    tenant_id: str
+    node_types: NodeTypes
+    nodes: Nodes
+    relationships: Relationships
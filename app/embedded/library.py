@@ -0,0 +1,245 @@
+"""
+Wiring of embedded mode (see app/embedded/__init__.py).
+
+Backends:
+
+- postgres: the control and tenant databases of a Config (config_from_env()
+  by default), migrated when opened like at server startup; tenant databases
+  are created with their tenants.
+- sqlite: SQLite files in the cfg.sqlite_dir directory (see
+  app/repository/sqlite.py), for local development and edge deployments.
+- memory: the in-memory repositories of app/repository/memory.py, for tests
+  of applications built on flexy-db. Nothing is persisted.
+
+On sqlite and memory, webhooks, intake forms, email inboxes, node migrations
+and BI views, which need PostgreSQL, fail with invalid params (-32602), as do
+exports and imports on sqlite. Sensitive node data fields need a KMS,
+installed with app.encryption.configure_kms (see app/encryption/kms.py).
+
+Calls act with full access, like the admin key, unless made with an API key.
+Applications on the same host can skip JSON-RPC and call the services
+directly through the interfaces of app/embedded/interfaces.py:
+
+    async with db.tenant(tenant_id) as t:
+        node = await t.nodes.create(node_type_id, '{"title": "A"}')
+
+These calls aren't authorized, logged or instrumented, and plugin
+interceptors don't see them.
+The JSON-RPC methods' services are process-wide, so a process embeds at most
+one instance at a time, and not next to a running server. Background workers
+(webhook delivery, exports, CDC) are not started.
+"""
+
+import json
+import logging
+from contextlib import asynccontextmanager
+from dataclasses import dataclass, field
+from typing import Any, AsyncIterator, Dict, Optional
+
+from app.api.dependencies import (
+    check_tenant_available,
+    create_tenant_services,
+    set_tenant_db_manager,
+    set_tenant_services_factory,
+)
+from app.auth import ADMIN_KEY, API_KEY, PERMISSION_DENIED_CODE, Principal
+from app.config import AuthConfig, Config, config_from_env, tenant_slug_config_from_env
+from app.db import (
+    Database,
+    TenantDatabaseManager,
+    connect_control_db,
+    ensure_control_database_exists,
+    run_control_migrations,
+    tenant_scope,
+)
+from app.embedded.interfaces import TenantServices, Tenants, Users
+from app.jsonrpc import register_methods
+from app.jsonrpc.server import configure_auth, dispatch_local
+from app.repository import ApiKeyRepository, AuditRepository, NotFoundError, TenantRepository
+from app.service import ApiKeyService, AuditService, TenantService, UserService
+from app.storage import (
+    MEMORY,
+    POSTGRES,
+    SQLITE,
+    LocalTenantServices,
+    MemoryStorage,
+    PostgresStorage,
+    SqliteStorage,
+    Storage,
+)
+
+logger = logging.getLogger(__name__)
+
+BACKENDS = (POSTGRES, SQLITE, MEMORY)
+
+# The open instance; the JSON-RPC methods' services are process-wide
+_open: Optional["Embedded"] = None
+
+
+@dataclass
+class EmbeddedError(Exception):
+    """A JSON-RPC error returned by an embedded call, with the server's error code."""
+    code: int
+    message: str
+    data: Any = None
+
+    def __str__(self) -> str:
+        return f"{self.message} ({self.code})"
+
+
+@dataclass
+class Embedded:
+    """An embedded flexy-db instance; see open_embedded."""
+    backend: str
+    tenants: Tenants
+    users: Users
+    api_keys: Optional[ApiKeyService] = None
+    control_db: Optional[Database] = None
+    tenant_db_manager: Optional[TenantDatabaseManager] = None
+    storage: Optional[Storage] = None
+    local: Optional[LocalTenantServices] = None
+    _next_id: int = field(default=0, repr=False)
+
+    async def tenant_services(self, tenant_id: str) -> dict:
+        """
+        Return the services of a tenant by name, as the JSON-RPC methods use
+        them. Prefer tenant(), whose services have stable interfaces.
+        """
+        if self.local:
+            return await self.local.services(tenant_id)
+        await check_tenant_available(tenant_id)
+        try:
+            tenant_db = await self.tenant_db_manager.get_tenant_db(tenant_id)
+        except ValueError:
+            raise NotFoundError(f"tenant not found: {tenant_id}") from None
+        return create_tenant_services(tenant_db, tenant_id, TenantRepository(self.control_db))
+
+    @asynccontextmanager
+    async def tenant(self, tenant_id: str) -> AsyncIterator[TenantServices]:
+        """
+        Act on behalf of a tenant within the block, with its services. Raises
+        NotFoundError for unknown tenants and FailedPreconditionError for
+        suspended ones, like calls do.
+        """
+        with tenant_scope(tenant_id):
+            services = await self.tenant_services(tenant_id)
+            yield TenantServices(
+                tenant_id=tenant_id,
+                node_types=services["node_type"],
+                nodes=services["node"],
+                relationships=services["relationship"],
+            )
+
+    async def dispatch(self, body: str, api_key: str = "") -> Optional[str]:
+        """
+        Dispatch a JSON-RPC request body (a single request or a batch) and
+        return the response body, or None for notifications.
+        """
+        return await dispatch_local(body, await self._principal(api_key))
+
+    async def call(self, method: str, params: Optional[Dict[str, Any]] = None, api_key: str = "") -> Any:
+        """Call a JSON-RPC method and return its result; raises EmbeddedError with its error."""
+        self._next_id += 1
+        request = {"jsonrpc": "2.0", "method": method, "params": params or {}, "id": self._next_id}
+        response = json.loads(await self.dispatch(json.dumps(request), api_key))
+        if "error" in response:
+            error = response["error"]
+            raise EmbeddedError(error["code"], error["message"], error.get("data"))
+        return response["result"]
+
+    async def close(self) -> None:
+        """Close the database connections and release the JSON-RPC methods' services."""
+        global _open
+        if _open is not self:
+            return
+        _open = None
+        set_tenant_services_factory(None)
+        set_tenant_db_manager(None)
+        if self.storage:
+            await self.storage.close()
+
+    async def _principal(self, api_key: str) -> Principal:
+        if not api_key:
+            return Principal(kind=ADMIN_KEY)
+        key = await self.api_keys.authenticate(api_key) if self.api_keys else None
+        if key is None:
+            raise EmbeddedError(PERMISSION_DENIED_CODE, "invalid API key")
+        return Principal(kind=API_KEY, api_key=key)
+
+    async def __aenter__(self) -> "Embedded":
+        return self
+
+    async def __aexit__(self, *exc: Any) -> None:
+        await self.close()
+
+
+async def _open_postgres(cfg: Config) -> Embedded:
+    await ensure_control_database_exists(cfg)
+    control_db = await connect_control_db(cfg)
+    try:
+        await run_control_migrations(control_db)
+        manager = TenantDatabaseManager(cfg, control_db)
+    except BaseException:
+        await control_db.close()
+        raise
+    set_tenant_db_manager(manager)
+
+    storage = PostgresStorage(control_db, manager)
+    control = storage.control()
+    api_keys = ApiKeyService(ApiKeyRepository(control_db))
+    db = Embedded(
+        backend=POSTGRES,
+        tenants=TenantService(
+            control.tenants, manager, control.tenant_quotas, control.tenant_deletions,
+            slug_policy=tenant_slug_config_from_env().policy,
+        ),
+        users=UserService(control.users),
+        api_keys=api_keys,
+        control_db=control_db,
+        tenant_db_manager=manager,
+        storage=storage,
+    )
+    register_methods(db.tenants, db.users, api_keys, AuditService(AuditRepository(control_db)))
+    return db
+
+
+def _open_local(storage: Storage) -> Embedded:
+    control = storage.control()
+    local = LocalTenantServices(storage)
+    set_tenant_services_factory(local.services)
+    db = Embedded(
+        backend=storage.backend,
+        tenants=TenantService(
+            control.tenants, quota_repo=control.tenant_quotas, slug_policy=tenant_slug_config_from_env().policy
+        ),
+        users=UserService(control.users),
+        storage=storage,
+        local=local,
+    )
+    register_methods(db.tenants, db.users)
+    return db
+
+
+async def open_embedded(backend: str = POSTGRES, cfg: Optional[Config] = None) -> Embedded:
+    """
+    Open an embedded instance on the postgres, sqlite or memory backend (see
+    the module docstring). cfg configures the postgres and sqlite backends; by
+    default it is read from the environment like the server's.
+    """
+    global _open
+    if backend not in BACKENDS:
+        raise ValueError(f"backend must be one of {', '.join(BACKENDS)}: {backend}")
+    if _open is not None:
+        raise RuntimeError("an embedded instance is already open in this process")
+
+    if backend == POSTGRES:
+        db = await _open_postgres(cfg or config_from_env())
+    elif backend == SQLITE:
+        db = _open_local(SqliteStorage((cfg or config_from_env()).sqlite_dir))
+    else:
+        db = _open_local(MemoryStorage())
+    # Authorizes calls made with API keys and applies the rest of the method chain
+    configure_auth(AuthConfig(), db.api_keys)
+    _open = db
+    logger.info(f"Embedded flexy-db opened ({backend} backend)")
+    return db
@@ -0,0 +1,73 @@
+"""
+flexy-emulator: a FlexDB server for the tests of consumer apps, without PostgreSQL.
+
+    scripts/flexy-emulator                          # in memory, on http://127.0.0.1:8085
+    scripts/flexy-emulator --backend sqlite --data-dir .flexdb
+    scripts/flexy-emulator --deterministic-ids --seed 42
+
+The emulator serves the same JSON-RPC API as the server (python -m
+app.emulator runs it too), from the memory or sqlite storage backend: the
+control plane, node types, nodes, relationships, revisions and the change
+feed, and in memory exports and imports too. Methods that need PostgreSQL (API keys, the audit log,
+webhooks, subscriptions, node migrations and retention policies) fail.
+Authentication is off, and the memory backend starts empty on every run.
+
+With --deterministic-ids, the IDs of created records are derived from --seed
+instead of random, so tests that create the same records in the same order
+get the same IDs on every run (see app/repository/ids.py). CI jobs can wait
+for GET /health to answer before running the tests.
+"""
+
+import argparse
+import os
+import sys
+from typing import List, Optional
+
+from app.repository.ids import use_deterministic_ids
+from app.storage import MEMORY, SQLITE
+
+DEFAULT_HOST = "127.0.0.1"
+DEFAULT_PORT = 8085
+DEFAULT_DATA_DIR = ".flexy-emulator"
+
+
+def parse_args(argv: Optional[List[str]] = None) -> argparse.Namespace:
+    """Parse flexy-emulator's command line."""
+    parser = argparse.ArgumentParser(
+        prog="flexy-emulator", description="Run a FlexDB server for tests, in memory or on SQLite."
+    )
+    parser.add_argument("--backend", choices=[MEMORY, SQLITE], default=MEMORY, help="storage backend")
+    parser.add_argument(
+        "--data-dir", default=DEFAULT_DATA_DIR, help=f"directory of the sqlite databases (default: {DEFAULT_DATA_DIR})"
+    )
+    parser.add_argument("--host", default=DEFAULT_HOST, help=f"address to listen on (default: {DEFAULT_HOST})")
+    parser.add_argument("--port", type=int, default=DEFAULT_PORT, help=f"port to listen on (default: {DEFAULT_PORT})")
+    parser.add_argument(
+        "--deterministic-ids", action="store_true", help="derive the IDs of created records from --seed"
+    )
+    parser.add_argument("--seed", type=int, default=0, help="seed of deterministic IDs (default: 0)")
+    return parser.parse_args(argv)
+
+
+def configure(args: argparse.Namespace) -> None:
+    """Point the server at the emulator's storage backend, without authentication."""
+    os.environ["STORAGE_BACKEND"] = args.backend
+    os.environ["SQLITE_DIR"] = args.data_dir
+    os.environ["AUTH_REQUIRED"] = "false"
+    use_deterministic_ids(args.seed if args.deterministic_ids else None)
+
+
+def main(argv: Optional[List[str]] = None) -> int:
+    """Run the emulator until it is stopped; returns the exit status."""
+    args = parse_args(argv)
+    configure(args)
+
+    import uvicorn
+
+    print(f"flexy-emulator ({args.backend}) serving http://{args.host}:{args.port}/jsonrpc", flush=True)
+    uvicorn.run("main:app", host=args.host, port=args.port, log_level="warning")
+    return 0
+
+
+if __name__ == "__main__":
+    sys.exit(main())
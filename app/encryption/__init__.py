@@ -0,0 +1,19 @@
+"""
+Encryption at rest of sensitive node data fields.
+"""
+
+from app.encryption.kms import (
+    KeyManagementService,
+    LocalKms,
+    configure_kms,
+    current_kms,
+    local_kms_from_config,
+)
+
+__all__ = [
+    "KeyManagementService",
+    "LocalKms",
+    "configure_kms",
+    "current_kms",
+    "local_kms_from_config",
+]
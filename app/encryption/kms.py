@@ -0,0 +1,97 @@
+"""
+Key management: key encryption keys (KEKs) that wrap the data keys of tenants.
+
+Sensitive node data fields are encrypted with a data key per tenant (envelope
+encryption, see app/service/encryption.py). Data keys are only stored
+wrapped, in the tenant's database, by a KeyManagementService holding the
+tenant's key encryption key.
+
+LocalKms derives every tenant's KEK from one master key (ENCRYPTION_MASTER_KEY).
+Deployments keeping keys in a cloud KMS or an HSM implement
+KeyManagementService and install it with configure_kms, for instance from a
+plugin module (see app/plugins), which is loaded after the local KMS is set up.
+"""
+
+import base64
+import binascii
+import hashlib
+import hmac
+import os
+from typing import Optional, Protocol, runtime_checkable
+
+from cryptography.exceptions import InvalidTag
+from cryptography.hazmat.primitives.ciphers.aead import AESGCM
+
+from app.config import EncryptionConfig
+
+MASTER_KEY_BYTES = 32
+NONCE_BYTES = 12
+
+
+@runtime_checkable
+class KeyManagementService(Protocol):
+    """Wraps and unwraps data keys with the key encryption key of a tenant."""
+
+    # The KEK new data keys are wrapped with; recorded next to each wrapped key
+    key_id: str
+
+    async def wrap_key(self, tenant_id: str, data_key: bytes) -> bytes:
+        """Encrypt a data key of a tenant with the tenant's current KEK."""
+        ...
+
+    async def unwrap_key(self, tenant_id: str, key_id: str, wrapped_key: bytes) -> bytes:
+        """Decrypt a data key of a tenant wrapped with the KEK key_id; raises ValueError if it fails."""
+        ...
+
+
+class LocalKms:
+    """Derives a KEK per tenant from a master key with HMAC-SHA256 and wraps with AES-256-GCM."""
+
+    def __init__(self, master_key: bytes, key_id: str = "local"):
+        if len(master_key) != MASTER_KEY_BYTES:
+            raise ValueError(f"the encryption master key must be {MASTER_KEY_BYTES} bytes")
+        self._master_key = master_key
+        self.key_id = key_id
+
+    async def wrap_key(self, tenant_id: str, data_key: bytes) -> bytes:
+        nonce = os.urandom(NONCE_BYTES)
+        return nonce + AESGCM(self._kek(tenant_id)).encrypt(nonce, data_key, tenant_id.encode())
+
+    async def unwrap_key(self, tenant_id: str, key_id: str, wrapped_key: bytes) -> bytes:
+        if key_id != self.key_id:
+            raise ValueError(f"data key of tenant {tenant_id} is wrapped with unknown KMS key {key_id}")
+        try:
+            return AESGCM(self._kek(tenant_id)).decrypt(
+                wrapped_key[:NONCE_BYTES], wrapped_key[NONCE_BYTES:], tenant_id.encode()
+            )
+        except InvalidTag:
+            raise ValueError(f"data key of tenant {tenant_id} does not unwrap with KMS key {key_id}") from None
+
+    def _kek(self, tenant_id: str) -> bytes:
+        return hmac.new(self._master_key, b"flexy-db tenant kek:" + tenant_id.encode(), hashlib.sha256).digest()
+
+
+def local_kms_from_config(cfg: EncryptionConfig) -> Optional[LocalKms]:
+    """Return the local KMS of the configured master key, or None if there is none."""
+    if not cfg.master_key:
+        return None
+    try:
+        master_key = base64.b64decode(cfg.master_key, validate=True)
+    except (binascii.Error, ValueError):
+        raise ValueError("ENCRYPTION_MASTER_KEY must be base64") from None
+    return LocalKms(master_key, cfg.key_id)
+
+
+# The KMS of this process (None disables sensitive fields)
+_kms: Optional[KeyManagementService] = None
+
+
+def configure_kms(kms: Optional[KeyManagementService]) -> None:
+    """Set the KMS wrapping tenant data keys (None disables sensitive fields)."""
+    global _kms
+    _kms = kms
+
+
+def current_kms() -> Optional[KeyManagementService]:
+    """Return the configured KMS, or None."""
+    return _kms
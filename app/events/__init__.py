@@ -0,0 +1,39 @@
+"""
+Change events and webhook delivery.
+"""
+
+from app.events.types import EVENT_TYPES, TEST_EVENT_TYPE
+from app.events.schemas import EventSchema, event_schema_version, get_event_schema, list_event_schemas
+from app.events.signing import SIGNATURE_HEADER, sign_payload, verify_signature
+from app.events.sinks import WEBHOOK_KINDS, build_message, render_template
+from app.events.dispatcher import WebhookDispatcher
+from app.events.brokers import Broker, KafkaBroker, Message, NatsBroker, broker_from_config
+from app.events.protobuf import ChangeEvent, decode_change_event, encode_change_event
+from app.events.cdc import CdcPublisher, debezium_messages, protobuf_messages
+
+__all__ = [
+    "EVENT_TYPES",
+    "TEST_EVENT_TYPE",
+    "EventSchema",
+    "event_schema_version",
+    "get_event_schema",
+    "list_event_schemas",
+    "SIGNATURE_HEADER",
+    "sign_payload",
+    "verify_signature",
+    "WEBHOOK_KINDS",
+    "build_message",
+    "render_template",
+    "WebhookDispatcher",
+    "Broker",
+    "KafkaBroker",
+    "NatsBroker",
+    "Message",
+    "broker_from_config",
+    "ChangeEvent",
+    "decode_change_event",
+    "encode_change_event",
+    "CdcPublisher",
+    "debezium_messages",
+    "protobuf_messages",
+]
@@ -0,0 +1,138 @@
+"""
+Message broker clients for change data capture.
+
+aiokafka (Kafka) or nats-py (NATS) is only required when CDC publishing to
+that broker is enabled.
+"""
+
+import asyncio
+from dataclasses import dataclass
+from typing import List, Optional
+
+from app.config import CdcConfig
+
+try:
+    from aiokafka import AIOKafkaProducer
+except ImportError:  # only required for CDC publishing
+    AIOKafkaProducer = None
+
+try:
+    import nats
+except ImportError:  # only required for CDC publishing to NATS
+    nats = None
+
+BROKERS = ("kafka", "nats")
+
+
+@dataclass
+class Message:
+    """A message to publish; value None is a tombstone."""
+    topic: str
+    key: bytes
+    value: Optional[bytes]
+    # Unique ID of the change, for brokers that deduplicate redeliveries
+    id: str = ""
+
+
+class Broker:
+    """Publishes batches of messages."""
+
+    async def start(self) -> None:
+        """Connect to the broker."""
+
+    async def publish(self, messages: List[Message]) -> None:
+        """Publish messages in order; returns once the broker acknowledged all of them."""
+        raise NotImplementedError
+
+    async def stop(self) -> None:
+        """Flush and disconnect."""
+
+
+class KafkaBroker(Broker):
+    """Kafka producer with idempotence, so retries keep per-partition order."""
+
+    def __init__(self, bootstrap_servers: str, client_id: str = "flex-db-cdc"):
+        self.bootstrap_servers = bootstrap_servers
+        self.client_id = client_id
+        self._producer = None
+
+    async def start(self) -> None:
+        """Connect the producer."""
+        if AIOKafkaProducer is None:
+            raise RuntimeError("CDC publishing to Kafka requires the aiokafka package")
+        self._producer = AIOKafkaProducer(
+            bootstrap_servers=self.bootstrap_servers,
+            client_id=self.client_id,
+            acks="all",
+            enable_idempotence=True,
+        )
+        await self._producer.start()
+
+    async def publish(self, messages: List[Message]) -> None:
+        """Send all messages, then wait for every acknowledgement."""
+        pending = [
+            await self._producer.send(m.topic, value=m.value, key=m.key)
+            for m in messages
+        ]
+        await asyncio.gather(*pending)
+
+    async def stop(self) -> None:
+        """Flush pending messages and close the producer."""
+        if self._producer is not None:
+            await self._producer.stop()
+            self._producer = None
+
+
+class NatsBroker(Broker):
+    """
+    NATS JetStream publisher; topics are used as subjects.
+
+    A JetStream stream must capture the subjects, e.g. "flexdb.>". Message IDs
+    are sent as Nats-Msg-Id, so the stream drops redeliveries within its
+    duplicate window. NATS has no log compaction, so tombstones are not sent.
+    """
+
+    KEY_HEADER = "Flexdb-Key"
+
+    def __init__(self, servers: str, name: str = "flex-db-cdc"):
+        self.servers = [s.strip() for s in servers.split(",") if s.strip()]
+        self.name = name
+        self._nc = None
+        self._js = None
+
+    async def start(self) -> None:
+        """Connect to the NATS servers."""
+        if nats is None:
+            raise RuntimeError("CDC publishing to NATS requires the nats-py package")
+        self._nc = await nats.connect(servers=self.servers, name=self.name)
+        self._js = self._nc.jetstream()
+
+    async def publish(self, messages: List[Message]) -> None:
+        """Publish messages one at a time, waiting for each acknowledgement to keep order."""
+        for m in messages:
+            if m.value is None:
+                continue
+            headers = {self.KEY_HEADER: m.key.decode("utf-8")}
+            if m.id:
+                headers["Nats-Msg-Id"] = m.id
+            await self._js.publish(m.topic, m.value, headers=headers)
+
+    async def stop(self) -> None:
+        """Flush pending messages and close the connection."""
+        if self._nc is not None:
+            await self._nc.drain()
+            self._nc = None
+            self._js = None
+
+
+def broker_from_config(cfg: CdcConfig) -> Broker:
+    """Create the broker client selected by the CDC configuration."""
+    if cfg.broker == "kafka":
+        if not cfg.bootstrap_servers:
+            raise ValueError("CDC_KAFKA_BOOTSTRAP_SERVERS is required for the kafka broker")
+        return KafkaBroker(cfg.bootstrap_servers)
+    if cfg.broker == "nats":
+        if not cfg.nats_servers:
+            raise ValueError("CDC_NATS_SERVERS is required for the nats broker")
+        return NatsBroker(cfg.nats_servers)
+    raise ValueError(f"CDC_BROKER must be one of: {', '.join(BROKERS)}")
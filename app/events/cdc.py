@@ -0,0 +1,235 @@
+"""
+Change data capture in the Debezium or protobuf format.
+
+The publisher reads each tenant's outbox (see OutboxRepository) and publishes
+every change to Kafka or NATS, one topic (subject) per tenant and table:
+
+    <topic_prefix>.<tenant_id>.node_types
+    <topic_prefix>.<tenant_id>.nodes
+    <topic_prefix>.<tenant_id>.relationships
+
+Messages look like those of the Debezium PostgreSQL connector with the JSON
+converter and schemas disabled, so existing Debezium consumers and sink
+connectors can read them. The key is {"id": ...} and the value
+
+    {"before": ..., "after": ..., "op": "c" | "u" | "d", "ts_ms": ...,
+     "source": {"connector": "flexdb", "db": <tenant_id>, "table": ..., ...}}
+
+As with Debezium's default replica identity, "before" is only set for
+deletes. Deletes are followed by a tombstone unless disabled.
+
+With the protobuf format, the key is the entity ID and the value a
+ChangeEvent (see change_event.proto) carrying the entity as JSON.
+
+Events are published in outbox order under a per-tenant lock and marked
+published only after the broker acknowledged them, so every change is
+delivered at least once and changes to one entity arrive in order.
+Tenants are published a batch at a time as interactive jobs (see
+app/jobs/scheduler.py), taking turns with each other.
+"""
+
+import asyncio
+import json
+import logging
+import time
+from typing import Any, Dict, List, Optional
+
+from app import __version__
+from app.config import CdcConfig, JobSchedulerConfig
+from app.db.database import Database
+from app.db.tenant_db_manager import TenantDatabaseManager
+from app.events.brokers import Broker, Message
+from app.events.protobuf import OP_CREATE, OP_DELETE, OP_UPDATE, ChangeEvent, encode_change_event
+from app.jobs.scheduler import INTERACTIVE, JobScheduler
+from app.repository import OutboxEvent, OutboxRepository
+
+logger = logging.getLogger(__name__)
+
+CONNECTOR = "flexdb"
+
+# Entity type -> table name used in topics and the source block
+TABLES = {
+    "node_type": "node_types",
+    "node": "nodes",
+    "relationship": "relationships",
+}
+
+_OPS = {"created": "c", "updated": "u", "deleted": "d"}
+_PROTOBUF_OPS = {"created": OP_CREATE, "updated": OP_UPDATE, "deleted": OP_DELETE}
+
+FORMATS = ("debezium", "protobuf")
+
+
+def topic_name(topic_prefix: str, tenant_id: str, entity_type: str) -> str:
+    """Return the topic an entity type's changes are published to."""
+    return f"{topic_prefix}.{tenant_id}.{TABLES[entity_type]}"
+
+
+def debezium_messages(
+    tenant_id: str,
+    event: OutboxEvent,
+    topic_prefix: str,
+    tombstones: bool = True,
+    now_ms: Optional[int] = None
+) -> List[Message]:
+    """Convert an outbox event into its Debezium change message (and tombstone)."""
+    if event.entity_type not in TABLES:
+        raise ValueError(f"unsupported entity type: {event.entity_type}")
+    op = _OPS[event.event_type.rsplit(".", 1)[1]]
+    row = _row(json.loads(event.payload).get(event.entity_type) or {})
+
+    value = {
+        "before": row if op == "d" else None,
+        "after": None if op == "d" else row,
+        "source": {
+            "version": __version__,
+            "connector": CONNECTOR,
+            "name": topic_prefix,
+            "ts_ms": int(event.created_at.timestamp() * 1000),
+            "snapshot": "false",
+            "db": tenant_id,
+            "schema": "public",
+            "table": TABLES[event.entity_type],
+            "sequence": str(event.id),
+            "event_id": event.event_id,
+            "schema_version": event.schema_version,
+        },
+        "op": op,
+        "ts_ms": now_ms if now_ms is not None else int(time.time() * 1000),
+        "transaction": None,
+    }
+
+    topic = topic_name(topic_prefix, tenant_id, event.entity_type)
+    key = json.dumps({"id": event.entity_id}).encode()
+    messages = [Message(topic, key, json.dumps(value).encode(), event.event_id)]
+    if op == "d" and tombstones:
+        messages.append(Message(topic, key, None))
+    return messages
+
+
+def protobuf_messages(
+    tenant_id: str,
+    event: OutboxEvent,
+    topic_prefix: str,
+    tombstones: bool = True
+) -> List[Message]:
+    """Convert an outbox event into its protobuf ChangeEvent message (and tombstone)."""
+    if event.entity_type not in TABLES:
+        raise ValueError(f"unsupported entity type: {event.entity_type}")
+    change = event.event_type.rsplit(".", 1)[1]
+    entity = _row(json.loads(event.payload).get(event.entity_type) or {})
+
+    value = ChangeEvent(
+        event_id=event.event_id,
+        sequence=event.id,
+        tenant_id=tenant_id,
+        entity_type=event.entity_type,
+        entity_id=event.entity_id,
+        op=_PROTOBUF_OPS[change],
+        payload=json.dumps(entity),
+        ts_ms=int(event.created_at.timestamp() * 1000),
+        node_type_id=entity.get("node_type_id", "") if event.entity_type == "node" else "",
+        schema_version=event.schema_version,
+    )
+
+    topic = topic_name(topic_prefix, tenant_id, event.entity_type)
+    key = event.entity_id.encode()
+    messages = [Message(topic, key, encode_change_event(value), event.event_id)]
+    if change == "deleted" and tombstones:
+        messages.append(Message(topic, key, None))
+    return messages
+
+
+def _row(entity: Dict[str, Any]) -> Dict[str, Any]:
+    # tenant_id is not a column of the tenant database tables
+    return {name: value for name, value in entity.items() if name != "tenant_id"}
+
+
+class CdcPublisher:
+    """Publishes outbox events of all tenants to a message broker."""
+
+    def __init__(
+        self,
+        tenant_db_manager: TenantDatabaseManager,
+        cfg: CdcConfig,
+        broker: Broker,
+        scheduler: Optional[JobScheduler] = None
+    ):
+        if cfg.format not in FORMATS:
+            raise ValueError(f"CDC_FORMAT must be one of: {', '.join(FORMATS)}")
+        self.tenant_db_manager = tenant_db_manager
+        self.cfg = cfg
+        self.broker = broker
+        self.scheduler = scheduler or JobScheduler(JobSchedulerConfig())
+        self._messages = protobuf_messages if cfg.format == "protobuf" else debezium_messages
+        self._task: Optional[asyncio.Task] = None
+        self._stopping = asyncio.Event()
+
+    async def start(self) -> None:
+        """Connect to the broker and start the publish loop in the background."""
+        if self._task:
+            return
+        await self.broker.start()
+        self._stopping.clear()
+        self._task = asyncio.create_task(self._run())
+
+    async def stop(self) -> None:
+        """Stop the publish loop and disconnect from the broker."""
+        if self._task:
+            self._stopping.set()
+            await self._task
+            self._task = None
+        await self.broker.stop()
+
+    async def drain(self) -> None:
+        """
+        Stop the publish loop after publishing all pending events, including
+        those written by the last requests before shutdown; then disconnect.
+        """
+        if self._task:
+            self._stopping.set()
+            await self._task
+            self._task = None
+            # Tenants are published a batch at a time while stopping
+            self._stopping.clear()
+            await self.run_once()
+        await self.stop()
+
+    async def _run(self) -> None:
+        while not self._stopping.is_set():
+            try:
+                await self.run_once()
+            except Exception:
+                logger.exception("CDC publisher poll failed")
+            try:
+                await asyncio.wait_for(self._stopping.wait(), timeout=self.cfg.poll_interval)
+            except asyncio.TimeoutError:
+                pass
+
+    async def run_once(self) -> None:
+        """Run a single poll over all active tenants."""
+        tenant_ids = await self.tenant_db_manager.list_active_tenant_ids()
+        await asyncio.gather(*(self._publish(tenant_id) for tenant_id in tenant_ids))
+
+    async def _publish(self, tenant_id: str) -> None:
+        try:
+            tenant_db = await self.tenant_db_manager.get_tenant_db(tenant_id)
+            await self.scheduler.run(INTERACTIVE, tenant_id, lambda: self.publish_tenant(tenant_id, tenant_db))
+        except Exception:
+            logger.exception(f"CDC publishing failed for tenant {tenant_id}")
+
+    async def publish_tenant(self, tenant_id: str, tenant_db: Database) -> bool:
+        """Publish a batch of pending events of one tenant; returns whether more may be pending."""
+        outbox_repo = OutboxRepository(tenant_db)
+
+        async def publish(events: List[OutboxEvent]) -> None:
+            messages = []
+            for event in events:
+                if event.entity_type not in TABLES:
+                    # Notifications, e.g. about API keys, are not table changes
+                    continue
+                messages.extend(self._messages(tenant_id, event, self.cfg.topic_prefix, self.cfg.tombstones))
+            await self.broker.publish(messages)
+
+        published = await outbox_repo.publish_pending_cdc(self.cfg.batch_size, publish)
+        return published == self.cfg.batch_size and not self._stopping.is_set()
@@ -0,0 +1,219 @@
+"""
+Background webhook dispatcher.
+
+Every poll, for each active tenant the dispatcher:
+
+1. Fans out undispatched outbox events into per-endpoint webhook deliveries.
+2. Claims deliveries that are due and POSTs them to their endpoint URL with an
+   HMAC signature header.
+3. Records the outcome and response time: succeeded on a 2xx response,
+   otherwise rescheduled with exponential backoff until max_attempts is
+   reached, then failed. Test events are attempted once, even to disabled
+   endpoints.
+
+Deliveries are claimed with FOR UPDATE SKIP LOCKED and a lease, so several
+server instances can run the dispatcher against the same tenants.
+
+Tenants are dispatched a batch at a time as interactive jobs (see
+app/jobs/scheduler.py), taking turns, so a tenant with a backlog of events
+doesn't delay everyone else's deliveries.
+"""
+
+import asyncio
+import json
+import logging
+import time
+from typing import Dict, Optional
+
+import httpx
+
+from app.config import JobSchedulerConfig, WebhookConfig
+from app.db.database import Database
+from app.db.tenant_db_manager import TenantDatabaseManager
+from app.events.signing import SIGNATURE_HEADER, sign_payload
+from app.events.sinks import WEBHOOK_KIND, build_message
+from app.jobs.scheduler import INTERACTIVE, JobScheduler
+from app.repository import (
+    OutboxRepository,
+    WebhookRepository,
+    WebhookDelivery,
+    WebhookEndpoint,
+    NotFoundError,
+)
+
+logger = logging.getLogger(__name__)
+
+USER_AGENT = "flex-db-webhooks/1.0"
+
+
+class WebhookDispatcher:
+    """Delivers outbox events to tenant webhook endpoints."""
+
+    def __init__(
+        self,
+        tenant_db_manager: TenantDatabaseManager,
+        cfg: WebhookConfig,
+        client: Optional[httpx.AsyncClient] = None,
+        scheduler: Optional[JobScheduler] = None
+    ):
+        self.tenant_db_manager = tenant_db_manager
+        self.cfg = cfg
+        self.scheduler = scheduler or JobScheduler(JobSchedulerConfig())
+        self._client = client
+        self._owns_client = client is None
+        self._task: Optional[asyncio.Task] = None
+        self._stopping = asyncio.Event()
+
+    def start(self) -> None:
+        """Start the dispatcher loop in the background."""
+        if self._task:
+            return
+        if self._client is None:
+            self._client = httpx.AsyncClient(timeout=self.cfg.timeout)
+        self._stopping.clear()
+        self._task = asyncio.create_task(self._run())
+
+    async def stop(self) -> None:
+        """Stop the dispatcher loop and release the HTTP client."""
+        if self._task:
+            self._stopping.set()
+            await self._task
+            self._task = None
+        if self._client is not None and self._owns_client:
+            await self._client.aclose()
+            self._client = None
+
+    async def drain(self) -> None:
+        """
+        Stop the dispatcher loop after a last poll, so events written by the
+        last requests before shutdown are delivered now rather than by
+        another instance's next poll; then release the HTTP client.
+        """
+        if self._task:
+            self._stopping.set()
+            await self._task
+            self._task = None
+            # Tenants are dispatched a batch at a time while stopping
+            self._stopping.clear()
+            await self.run_once()
+        await self.stop()
+
+    async def _run(self) -> None:
+        while not self._stopping.is_set():
+            try:
+                await self.run_once()
+            except Exception:
+                logger.exception("Webhook dispatcher poll failed")
+            try:
+                await asyncio.wait_for(self._stopping.wait(), timeout=self.cfg.poll_interval)
+            except asyncio.TimeoutError:
+                pass
+
+    async def run_once(self) -> None:
+        """Run a single poll over all active tenants."""
+        tenant_ids = await self.tenant_db_manager.list_active_tenant_ids()
+        await asyncio.gather(*(self._dispatch(tenant_id) for tenant_id in tenant_ids))
+
+    async def _dispatch(self, tenant_id: str) -> None:
+        try:
+            tenant_db = await self.tenant_db_manager.get_tenant_db(tenant_id)
+            await self.scheduler.run(INTERACTIVE, tenant_id, lambda: self.dispatch_tenant(tenant_id, tenant_db))
+        except Exception:
+            logger.exception(f"Webhook dispatch failed for tenant {tenant_id}")
+
+    async def dispatch_tenant(self, tenant_id: str, tenant_db: Database) -> bool:
+        """
+        Fan out a batch of pending events for one tenant and deliver a batch
+        of due deliveries; returns whether either batch was full, so more
+        may be pending.
+        """
+        outbox_repo = OutboxRepository(tenant_db)
+        webhook_repo = WebhookRepository(tenant_db)
+
+        fanned_out = await outbox_repo.fan_out_to_webhooks(self.cfg.batch_size)
+
+        deliveries = await webhook_repo.claim_due_deliveries(
+            self.cfg.batch_size, self.cfg.timeout * 2
+        )
+        endpoints: Dict[str, Optional[WebhookEndpoint]] = {}
+        for delivery in deliveries:
+            if delivery.endpoint_id not in endpoints:
+                try:
+                    endpoints[delivery.endpoint_id] = await webhook_repo.get_by_id(delivery.endpoint_id)
+                except NotFoundError:
+                    endpoints[delivery.endpoint_id] = None
+            endpoint = endpoints[delivery.endpoint_id]
+            if endpoint is None:
+                continue
+            await self._deliver(tenant_id, webhook_repo, endpoint, delivery)
+
+        full = fanned_out == self.cfg.batch_size or len(deliveries) == self.cfg.batch_size
+        return full and not self._stopping.is_set()
+
+    async def _deliver(
+        self,
+        tenant_id: str,
+        webhook_repo: WebhookRepository,
+        endpoint: WebhookEndpoint,
+        delivery: WebhookDelivery
+    ) -> None:
+        attempt = delivery.attempts + 1
+
+        if endpoint.status != "active" and not delivery.test:
+            await webhook_repo.record_attempt(delivery.id, "failed", None, "endpoint is not active")
+            return
+
+        envelope = {
+            "id": delivery.event_id,
+            "type": delivery.event_type,
+            "schema_version": delivery.schema_version,
+            "tenant_id": tenant_id,
+            "created_at": delivery.created_at.isoformat(),
+            "data": json.loads(delivery.payload),
+        }
+        if endpoint.kind == WEBHOOK_KIND:
+            body = json.dumps(envelope).encode()
+            headers = {
+                "Content-Type": "application/json",
+                "User-Agent": USER_AGENT,
+                "X-FlexDB-Event": delivery.event_type,
+                "X-FlexDB-Event-Id": delivery.event_id,
+                "X-FlexDB-Event-Schema": f"{delivery.event_type}/v{delivery.schema_version}",
+                "X-FlexDB-Delivery": delivery.id,
+                SIGNATURE_HEADER: sign_payload(endpoint.secret, int(time.time()), body),
+            }
+        else:
+            # Slack/Teams incoming webhooks take a chat message, not our envelope
+            body = json.dumps(build_message(endpoint.kind, endpoint.template, envelope)).encode()
+            headers = {"Content-Type": "application/json", "User-Agent": USER_AGENT}
+
+        status_code: Optional[int] = None
+        error = ""
+        started = time.monotonic()
+        try:
+            response = await self._client.post(endpoint.url, content=body, headers=headers)
+            status_code = response.status_code
+            if not 200 <= status_code < 300:
+                error = f"unexpected status {status_code}"
+        except httpx.HTTPError as e:
+            error = str(e) or e.__class__.__name__
+        latency_ms = round((time.monotonic() - started) * 1000)
+
+        if not error:
+            await webhook_repo.record_attempt(delivery.id, "succeeded", status_code, "", latency_ms=latency_ms)
+            return
+
+        if attempt >= self.cfg.max_attempts or delivery.test:
+            if not delivery.test:
+                logger.warning(f"Webhook delivery {delivery.id} failed after {attempt} attempts: {error}")
+            await webhook_repo.record_attempt(delivery.id, "failed", status_code, error, latency_ms=latency_ms)
+            return
+
+        await webhook_repo.record_attempt(
+            delivery.id, "pending", status_code, error,
+            retry_in_seconds=self.backoff(attempt), latency_ms=latency_ms
+        )
+
+    def backoff(self, attempt: int) -> float:
+        """Seconds to wait before retrying after the given attempt number."""
+        return min(self.cfg.backoff_base * (2 ** (attempt - 1)), self.cfg.backoff_max)
@@ -0,0 +1,127 @@
+"""
+Protobuf encoding of change events (see change_event.proto).
+
+The message is small and flat, so it is encoded by hand rather than with
+generated code; consumers generate their own classes from the .proto file.
+"""
+
+import json
+from dataclasses import dataclass
+from typing import Any, Dict, Tuple
+
+# ChangeEvent.Op values
+OP_UNSPECIFIED = 0
+OP_CREATE = 1
+OP_UPDATE = 2
+OP_DELETE = 3
+
+_VARINT = 0
+_LEN = 2
+
+
+@dataclass
+class ChangeEvent:
+    """A change to a tenant entity, as published with CDC_FORMAT=protobuf."""
+    event_id: str = ""
+    sequence: int = 0
+    tenant_id: str = ""
+    entity_type: str = ""
+    entity_id: str = ""
+    op: int = OP_UNSPECIFIED
+    payload: str = ""  # JSON of the entity
+    ts_ms: int = 0
+    node_type_id: str = ""
+    schema_version: int = 0
+
+    def entity(self) -> Dict[str, Any]:
+        """Return the decoded payload."""
+        return json.loads(self.payload) if self.payload else {}
+
+
+# (field number, attribute, wire type) in field number order
+_FIELDS = (
+    (1, "event_id", _LEN),
+    (2, "sequence", _VARINT),
+    (3, "tenant_id", _LEN),
+    (4, "entity_type", _LEN),
+    (5, "entity_id", _LEN),
+    (6, "op", _VARINT),
+    (7, "payload", _LEN),
+    (8, "ts_ms", _VARINT),
+    (9, "node_type_id", _LEN),
+    (10, "schema_version", _VARINT),
+)
+_FIELDS_BY_NUMBER = {number: (name, wire_type) for number, name, wire_type in _FIELDS}
+
+
+def _varint(value: int) -> bytes:
+    # int64 fields encode negative values as their 64-bit two's complement
+    value &= (1 << 64) - 1
+    out = bytearray()
+    while value > 0x7F:
+        out.append((value & 0x7F) | 0x80)
+        value >>= 7
+    out.append(value)
+    return bytes(out)
+
+
+def encode_change_event(event: ChangeEvent) -> bytes:
+    """Serialize a change event; default values are omitted as in proto3."""
+    out = bytearray()
+    for number, name, wire_type in _FIELDS:
+        value = getattr(event, name)
+        if not value:
+            continue
+        out += _varint(number << 3 | wire_type)
+        if wire_type == _VARINT:
+            out += _varint(value)
+        else:
+            data = value.encode("utf-8")
+            out += _varint(len(data)) + data
+    return bytes(out)
+
+
+def _read_varint(data: bytes, pos: int) -> Tuple[int, int]:
+    value = shift = 0
+    while True:
+        if pos >= len(data):
+            raise ValueError("truncated varint")
+        byte = data[pos]
+        pos += 1
+        value |= (byte & 0x7F) << shift
+        if not byte & 0x80:
+            return value, pos
+        shift += 7
+
+
+def decode_change_event(data: bytes) -> ChangeEvent:
+    """Parse a serialized change event, skipping unknown fields."""
+    event = ChangeEvent()
+    pos = 0
+    while pos < len(data):
+        tag, pos = _read_varint(data, pos)
+        number, wire_type = tag >> 3, tag & 0x7
+        if wire_type == _VARINT:
+            value, pos = _read_varint(data, pos)
+        elif wire_type == _LEN:
+            length, pos = _read_varint(data, pos)
+            if pos + length > len(data):
+                raise ValueError("truncated field")
+            value, pos = data[pos:pos + length], pos + length
+        elif wire_type == 1:
+            value, pos = None, pos + 8
+        elif wire_type == 5:
+            value, pos = None, pos + 4
+        else:
+            raise ValueError(f"unsupported wire type: {wire_type}")
+
+        known = _FIELDS_BY_NUMBER.get(number)
+        if known is None or known[1] != wire_type:
+            continue
+        name = known[0]
+        if wire_type == _LEN:
+            value = value.decode("utf-8")
+        elif name == "ts_ms" and value >= 1 << 63:
+            value -= 1 << 64
+        setattr(event, name, value)
+    return event
@@ -0,0 +1,52 @@
+"""
+Redaction of event payloads shown in webhook delivery logs.
+
+Delivery logs let integration authors see what was sent to their endpoints,
+but are readable by more keys than the data itself (config:read), so payload
+snapshots leave out values that look like credentials, by field name, and
+encrypted values of sensitive node fields. Node and relationship data is JSON
+text in payloads and is redacted inside.
+"""
+
+import json
+from typing import Any, Collection
+
+from app.service.encryption import ENCRYPTED_PREFIX
+
+REDACTED = "[REDACTED]"
+
+# Field names containing one of these, case-insensitively, are redacted
+SECRET_FIELD_MARKERS = ("password", "secret", "token", "authorization", "credential", "private_key")
+
+
+def redact_payload(payload: Any, keep: Collection[str] = ()) -> Any:
+    """
+    Return a copy of a parsed event payload with secret-looking values
+    redacted, except for the fields named in keep.
+    """
+    if isinstance(payload, dict):
+        return {
+            key: REDACTED if key not in keep and _is_secret_field(key) else _redact_value(key, value, keep)
+            for key, value in payload.items()
+        }
+    if isinstance(payload, list):
+        return [redact_payload(item, keep) for item in payload]
+    if isinstance(payload, str) and payload.startswith(ENCRYPTED_PREFIX):
+        return REDACTED
+    return payload
+
+
+def _redact_value(key: str, value: Any, keep: Collection[str]) -> Any:
+    if key == "data" and isinstance(value, str):
+        try:
+            data = json.loads(value)
+        except ValueError:
+            return value
+        if isinstance(data, dict):
+            return json.dumps(redact_payload(data, keep))
+    return redact_payload(value, keep)
+
+
+def _is_secret_field(key: str) -> bool:
+    key = key.lower()
+    return any(marker in key for marker in SECRET_FIELD_MARKERS)
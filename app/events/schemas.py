@@ -0,0 +1,195 @@
+"""
+Event schema registry.
+
+Every event type has versioned JSON Schemas (draft 2020-12) describing the
+payload ("data") of its events. Events carry the version of the schema their
+payload was written with, recorded in the outbox with the event, so consumers
+can tell payload shapes apart across server upgrades.
+
+Adding fields is compatible and keeps the version: consumers must ignore
+fields they don't know. Removing, renaming or retyping a field adds a new
+version of the event type's schema; new events are written with the newest
+one, and the older versions stay in the registry for events written before.
+"""
+
+from dataclasses import dataclass
+from typing import Any, Dict, List
+
+from app.events.types import EVENT_TYPES, TEST_EVENT_TYPE
+from app.repository import NotFoundError
+
+JSON_SCHEMA_DIALECT = "https://json-schema.org/draft/2020-12/schema"
+
+
+@dataclass(frozen=True)
+class EventSchema:
+    """A version of the schema of an event type's payload."""
+    event_type: str
+    version: int
+    schema: Dict[str, Any]
+
+    @property
+    def id(self) -> str:
+        """Schema ID, e.g. node.created/v1."""
+        return f"{self.event_type}/v{self.version}"
+
+    def to_dict(self) -> Dict[str, Any]:
+        return {
+            "id": self.id,
+            "event_type": self.event_type,
+            "version": self.version,
+            "schema": self.schema,
+        }
+
+
+def _object(properties: Dict[str, Any], required: List[str]) -> Dict[str, Any]:
+    return {"type": "object", "properties": properties, "required": required}
+
+
+_STRING = {"type": "string"}
+_INTEGER = {"type": "integer"}
+_TIMESTAMP = {"type": "string", "format": "date-time"}
+_OPTIONAL_TIMESTAMP = {"type": ["string", "null"], "format": "date-time"}
+# Node and relationship data is JSON text, as returned by the API
+_JSON_TEXT = {"type": "string", "contentMediaType": "application/json"}
+
+_NODE_TYPE = _object({
+    "id": _STRING,
+    "tenant_id": _STRING,
+    "name": _STRING,
+    "description": _STRING,
+    "schema": _JSON_TEXT,
+    "display": _JSON_TEXT,
+    "created_at": _TIMESTAMP,
+    "updated_at": _TIMESTAMP,
+    "version": _INTEGER,
+    "etag": _STRING,
+    "schema_version": _INTEGER,
+    "unique_keys": {"type": "array", "items": {"type": "array", "items": _STRING}},
+}, ["id", "name", "schema", "version", "schema_version"])
+
+_NODE = _object({
+    "id": _STRING,
+    "tenant_id": _STRING,
+    "node_type_id": _STRING,
+    "data": _JSON_TEXT,
+    "created_at": _TIMESTAMP,
+    "updated_at": _TIMESTAMP,
+    "version": _INTEGER,
+    "etag": _STRING,
+    "schema_version": _INTEGER,
+}, ["id", "node_type_id", "data", "version"])
+
+_RELATIONSHIP = _object({
+    "id": _STRING,
+    "tenant_id": _STRING,
+    "source_node_id": _STRING,
+    "target_node_id": _STRING,
+    "relationship_type": _STRING,
+    "data": _JSON_TEXT,
+    "created_at": _TIMESTAMP,
+    "updated_at": _TIMESTAMP,
+    "version": _INTEGER,
+    "etag": _STRING,
+}, ["id", "source_node_id", "target_node_id", "relationship_type", "version"])
+
+_API_KEY = _object({
+    "id": _STRING,
+    "tenant_id": _STRING,
+    "name": _STRING,
+    "key_prefix": _STRING,
+    "scopes": {"type": "array", "items": _STRING},
+    "node_type_ids": {"type": "array", "items": _STRING},
+    "created_at": _TIMESTAMP,
+    "revoked_at": _OPTIONAL_TIMESTAMP,
+    "revoke_reason": {"type": ["string", "null"]},
+    "expires_at": _OPTIONAL_TIMESTAMP,
+    "last_used_at": _OPTIONAL_TIMESTAMP,
+    "rotated_from_id": {"type": ["string", "null"]},
+}, ["id", "name", "key_prefix"])
+
+
+def _entity_event(entity: str, schema: Dict[str, Any]) -> Dict[str, Any]:
+    """Payload of a change event: the entity after the change, or before it for deletes."""
+    return _object({entity: schema}, [entity])
+
+
+def _api_key_event(properties: Dict[str, Any], required: List[str]) -> Dict[str, Any]:
+    return _object({"api_key": _API_KEY, **properties}, ["api_key", *required])
+
+
+def _security_event(properties: Dict[str, Any]) -> Dict[str, Any]:
+    return _api_key_event({"client_ip": _STRING, **properties}, ["client_ip"])
+
+
+_V1 = {
+    "node_type.created": _entity_event("node_type", _NODE_TYPE),
+    "node_type.updated": _entity_event("node_type", _NODE_TYPE),
+    "node_type.deleted": _entity_event("node_type", _NODE_TYPE),
+    "node.created": _entity_event("node", _NODE),
+    "node.updated": _entity_event("node", _NODE),
+    "node.deleted": _entity_event("node", _NODE),
+    "relationship.created": _entity_event("relationship", _RELATIONSHIP),
+    "relationship.updated": _entity_event("relationship", _RELATIONSHIP),
+    "relationship.deleted": _entity_event("relationship", _RELATIONSHIP),
+    "api_key.expiring": _api_key_event({"expires_at": _TIMESTAMP}, ["expires_at"]),
+    "api_key.unused": _api_key_event({"disables_at": _TIMESTAMP}, ["disables_at"]),
+    "api_key.disabled": _api_key_event({"reason": _STRING}, ["reason"]),
+    "security.lockout": _security_event({
+        "scope": {"enum": ["key_prefix"]},
+        "key_prefix": _STRING,
+        "duration": {"type": "number"},
+    }),
+    "security.new_ip": _security_event({}),
+    "security.unusual_volume": _security_event({
+        "requests_per_minute": _INTEGER,
+        "average_per_minute": {"type": "number"},
+    }),
+    TEST_EVENT_TYPE: _object({
+        "webhook_endpoint_id": _STRING,
+        "message": _STRING,
+    }, ["webhook_endpoint_id", "message"]),
+}
+
+# Every version of every event type's schema, oldest first
+EVENT_SCHEMAS: Dict[str, List[EventSchema]] = {
+    event_type: [
+        EventSchema(event_type, 1, {
+            "$schema": JSON_SCHEMA_DIALECT,
+            "$id": f"flexdb:events/{event_type}/v1",
+            "title": f"{event_type} v1",
+            **_V1[event_type],
+        }),
+    ]
+    for event_type in (*EVENT_TYPES, TEST_EVENT_TYPE)
+}
+
+
+def event_schema_version(event_type: str) -> int:
+    """Return the schema version events of a type are written with: the newest one."""
+    schemas = EVENT_SCHEMAS.get(event_type)
+    if not schemas:
+        raise ValueError(f"unknown event type: {event_type}")
+    return schemas[-1].version
+
+
+def get_event_schema(event_type: str, version: int = 0) -> EventSchema:
+    """Retrieve a version of an event type's schema, by default the newest one."""
+    if event_type not in EVENT_SCHEMAS:
+        raise ValueError(f"unknown event type: {event_type}")
+    schemas = EVENT_SCHEMAS[event_type]
+    if not version:
+        return schemas[-1]
+    for schema in schemas:
+        if schema.version == version:
+            return schema
+    raise NotFoundError(f"event schema not found: {event_type}/v{version}")
+
+
+def list_event_schemas(event_type: str = "") -> List[EventSchema]:
+    """Retrieve every version of every event type's schema, or of one event type's."""
+    if event_type:
+        if event_type not in EVENT_SCHEMAS:
+            raise ValueError(f"unknown event type: {event_type}")
+        return list(EVENT_SCHEMAS[event_type])
+    return [schema for schemas in EVENT_SCHEMAS.values() for schema in schemas]
@@ -0,0 +1,91 @@
+"""
+HMAC signatures for webhook payloads and signed requests to public endpoints.
+
+Each delivery carries a header of the form
+
+    X-FlexDB-Signature: t=<unix timestamp>,v1=<hex HMAC-SHA256>
+
+where the HMAC is computed with the endpoint secret over "<timestamp>.<body>".
+Receivers recompute the HMAC and compare it in constant time, and reject
+timestamps more than a tolerance away from their clock so captured requests
+can't be replayed later. A header may carry several v1 signatures, e.g. with
+an old and a new secret while rotating.
+
+The same scheme signs requests to intake forms and email inboxes that require
+signatures; flexdb_client.signing has the client side.
+"""
+
+import hashlib
+import hmac
+import secrets
+import time
+from typing import List, Optional
+
+SIGNATURE_HEADER = "X-FlexDB-Signature"
+
+# Seconds a signature's timestamp may differ from the receiver's clock
+DEFAULT_TOLERANCE = 300
+
+
+def new_secret() -> str:
+    """Generate a signing secret."""
+    return secrets.token_hex(32)
+
+
+def updated_secret(secret: str, require_signature: Optional[bool], rotate: bool) -> str:
+    """
+    Return the signing secret of an endpoint after an update: none when
+    signatures are no longer required, a new one when they become required or
+    on rotation, else the current one.
+    """
+    required = bool(secret) if require_signature is None else require_signature
+    if rotate and not required:
+        raise ValueError("rotate_signing_secret requires require_signature")
+    if not required:
+        return ""
+    return new_secret() if rotate or not secret else secret
+
+
+def compute_signature(secret: str, timestamp: int, body: bytes) -> str:
+    """Compute the hex HMAC-SHA256 signature for a payload."""
+    message = f"{timestamp}.".encode() + body
+    return hmac.new(secret.encode(), message, hashlib.sha256).hexdigest()
+
+
+def sign_payload(secret: str, timestamp: int, body: bytes) -> str:
+    """Build the signature header value for a payload."""
+    return f"t={timestamp},v1={compute_signature(secret, timestamp, body)}"
+
+
+def verify_signature(
+    secret: str,
+    header: str,
+    body: bytes,
+    tolerance: float = DEFAULT_TOLERANCE,
+    now: Optional[float] = None
+) -> bool:
+    """
+    Verify a signature header value against a payload. Timestamps more than
+    tolerance seconds from now are rejected; a tolerance of 0 accepts any.
+    """
+    timestamp: Optional[int] = None
+    signatures: List[str] = []
+    for item in header.split(","):
+        key, sep, value = item.strip().partition("=")
+        if not sep:
+            continue
+        if key == "t":
+            try:
+                timestamp = int(value)
+            except ValueError:
+                return False
+        elif key == "v1":
+            signatures.append(value)
+
+    if timestamp is None:
+        return False
+    if tolerance > 0 and abs((time.time() if now is None else now) - timestamp) > tolerance:
+        return False
+
+    expected = compute_signature(secret, timestamp, body)
+    return any(hmac.compare_digest(expected, signature) for signature in signatures)
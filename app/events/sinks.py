@@ -0,0 +1,114 @@
+"""
+Chat notification sinks.
+
+Besides signed JSON webhooks, a webhook endpoint can post change events to a
+Slack or Microsoft Teams incoming webhook as a chat message. The message text
+comes from the endpoint's template, where {{path}} placeholders are replaced
+with values from the event:
+
+    {{type}}          node.updated
+    {{action}}        updated
+    {{entity_type}}   node
+    {{entity.id}}     the changed entity's ID
+    {{entity.data.title}}  a node data field (JSON strings are looked into)
+    {{tenant_id}}, {{id}}, {{created_at}}, {{data...}}
+
+Unknown paths render as an empty string.
+"""
+
+import json
+import re
+from typing import Any, Dict
+
+from app.repository.errors import ValidationError
+
+WEBHOOK_KIND = "webhook"
+SLACK_KIND = "slack"
+TEAMS_KIND = "teams"
+WEBHOOK_KINDS = (WEBHOOK_KIND, SLACK_KIND, TEAMS_KIND)
+
+DEFAULT_TEMPLATE = "{{type}}: {{entity_type}} {{entity.id}} (tenant {{tenant_id}})"
+MAX_TEMPLATE_LENGTH = 2000
+
+_PLACEHOLDER = re.compile(r"\{\{\s*([^{}]*?)\s*\}\}")
+_PATH = re.compile(r"^[A-Za-z_][A-Za-z0-9_]*(\.[A-Za-z0-9_-]+)*$")
+
+
+def validate_template(template: str) -> None:
+    """Validate a message template's placeholders."""
+    if len(template) > MAX_TEMPLATE_LENGTH:
+        raise ValidationError("template", f"must be at most {MAX_TEMPLATE_LENGTH} characters")
+    for path in _PLACEHOLDER.findall(template):
+        if not _PATH.match(path):
+            raise ValueError(f"template has invalid placeholder: {{{{{path}}}}}")
+
+
+def template_context(envelope: Dict[str, Any]) -> Dict[str, Any]:
+    """Build the template context for an event envelope."""
+    entity_type, _, action = envelope.get("type", "").partition(".")
+    data = envelope.get("data") or {}
+    return dict(
+        envelope,
+        action=action,
+        entity_type=entity_type,
+        entity=data.get(entity_type) if isinstance(data, dict) else None,
+    )
+
+
+def render_template(template: str, context: Dict[str, Any], escape=None) -> str:
+    """Replace {{path}} placeholders with values from context."""
+    def replace(match: "re.Match[str]") -> str:
+        value = _lookup(context, match.group(1))
+        if value is None:
+            return ""
+        text = value if isinstance(value, str) else json.dumps(value)
+        return escape(text) if escape else text
+
+    return _PLACEHOLDER.sub(replace, template or DEFAULT_TEMPLATE)
+
+
+def build_message(kind: str, template: str, envelope: Dict[str, Any]) -> Dict[str, Any]:
+    """Build the chat message payload for a sink kind."""
+    context = template_context(envelope)
+
+    if kind == SLACK_KIND:
+        return {"text": render_template(template, context, escape=_slack_escape)}
+
+    if kind == TEAMS_KIND:
+        # Adaptive Card envelope accepted by Teams incoming webhooks and Workflows
+        return {
+            "type": "message",
+            "attachments": [{
+                "contentType": "application/vnd.microsoft.card.adaptive",
+                "content": {
+                    "$schema": "http://adaptivecards.io/schemas/adaptive-card.json",
+                    "type": "AdaptiveCard",
+                    "version": "1.4",
+                    "body": [{"type": "TextBlock", "text": render_template(template, context), "wrap": True}],
+                },
+            }],
+        }
+
+    raise ValueError(f"unknown sink kind: {kind}")
+
+
+def _lookup(context: Dict[str, Any], path: str) -> Any:
+    value: Any = context
+    for key in path.split("."):
+        if isinstance(value, str):
+            # Node and relationship data are JSON strings
+            try:
+                value = json.loads(value)
+            except json.JSONDecodeError:
+                return None
+        if isinstance(value, dict):
+            value = value.get(key)
+        elif isinstance(value, list) and key.isdigit() and int(key) < len(value):
+            value = value[int(key)]
+        else:
+            return None
+    return value
+
+
+def _slack_escape(text: str) -> str:
+    return text.replace("&", "&amp;").replace("<", "&lt;").replace(">", "&gt;")
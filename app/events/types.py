@@ -0,0 +1,27 @@
+"""
+Change event types written to the tenant outbox.
+"""
+
+EVENT_TYPES = (
+    "node_type.created",
+    "node_type.updated",
+    "node_type.deleted",
+    "node.created",
+    "node.updated",
+    "node.deleted",
+    "relationship.created",
+    "relationship.updated",
+    "relationship.deleted",
+    # Notifications about the tenant's API keys (not published to CDC)
+    "api_key.expiring",
+    "api_key.unused",
+    "api_key.disabled",
+    # Security events concerning the tenant's API keys (see app/service/auth_guard.py)
+    "security.lockout",
+    "security.new_ip",
+    "security.unusual_volume",
+)
+
+# Sample event sent to a webhook endpoint on request to test it; not written
+# to the outbox, so endpoint filters and subscriptions don't apply
+TEST_EVENT_TYPE = "webhook.test"
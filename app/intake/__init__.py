@@ -0,0 +1,30 @@
+"""
+Public intake: form submissions and inbound email.
+"""
+
+from app.intake.ratelimit import RateLimiter
+from app.intake.captcha import CAPTCHA_FIELDS, CaptchaVerifier
+from app.intake.mail import (
+    EMAIL_PROVIDERS,
+    SNS_MESSAGE_TYPE_HEADER,
+    InboundAttachment,
+    InboundEmail,
+    confirm_sns_subscription,
+    parse_mime,
+    parse_sendgrid,
+    parse_ses_notification,
+)
+
+__all__ = [
+    "RateLimiter",
+    "CAPTCHA_FIELDS",
+    "CaptchaVerifier",
+    "EMAIL_PROVIDERS",
+    "SNS_MESSAGE_TYPE_HEADER",
+    "InboundAttachment",
+    "InboundEmail",
+    "confirm_sns_subscription",
+    "parse_mime",
+    "parse_sendgrid",
+    "parse_ses_notification",
+]
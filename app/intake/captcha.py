@@ -0,0 +1,53 @@
+"""
+Captcha verification for public form submissions.
+
+hCaptcha, reCAPTCHA and Cloudflare Turnstile all verify a client response
+token by POSTing secret/response/remoteip to a siteverify URL that answers
+with {"success": true|false}.
+"""
+
+import logging
+from typing import Optional
+
+import httpx
+
+from app.config import IntakeConfig
+
+logger = logging.getLogger(__name__)
+
+# Submission fields that may carry the captcha response token
+CAPTCHA_FIELDS = ("captcha_token", "h-captcha-response", "g-recaptcha-response", "cf-turnstile-response")
+
+
+class CaptchaVerifier:
+    """Verifies captcha response tokens against the configured provider."""
+
+    def __init__(self, cfg: IntakeConfig, client: Optional[httpx.AsyncClient] = None):
+        self.cfg = cfg
+        self._client = client
+
+    async def verify(self, response_token: str, remote_ip: str = "") -> bool:
+        """Return whether the captcha response token is valid. Fails closed."""
+        if not self.cfg.captcha_secret:
+            logger.warning("Captcha required but INTAKE_CAPTCHA_SECRET is not configured")
+            return False
+        if not response_token:
+            return False
+
+        form = {"secret": self.cfg.captcha_secret, "response": response_token}
+        if remote_ip:
+            form["remoteip"] = remote_ip
+
+        try:
+            if self._client:
+                response = await self._client.post(self.cfg.captcha_verify_url, data=form)
+            else:
+                async with httpx.AsyncClient(timeout=self.cfg.captcha_timeout) as client:
+                    response = await client.post(self.cfg.captcha_verify_url, data=form)
+            if response.status_code != 200:
+                return False
+            body = response.json()
+            return isinstance(body, dict) and body.get("success") is True
+        except (httpx.HTTPError, ValueError) as e:
+            logger.warning(f"Captcha verification failed: {e}")
+            return False
@@ -0,0 +1,211 @@
+"""
+Inbound email parsing.
+
+Emails reach an inbox from a mail provider's inbound webhook:
+
+- "sendgrid": SendGrid Inbound Parse, a multipart/form-data post with from,
+  to, cc, subject, text, html, headers and attachmentN files (or a single
+  "email" field holding the raw message when "Send Raw" is enabled).
+- "ses": Amazon SES receipt rule publishing to an SNS topic with an HTTPS
+  subscription; the notification carries the raw message in "content".
+- "raw": the request body is the raw RFC 5322 message (e.g. piped from an MTA).
+
+Every provider is normalized to an InboundEmail.
+"""
+
+import base64
+import binascii
+import json
+from dataclasses import dataclass, field
+from email import policy
+from email.message import EmailMessage
+from email.parser import BytesParser
+from email.utils import getaddresses, parseaddr
+from typing import Dict, List, Optional, Tuple
+from urllib.parse import urlparse
+
+import httpx
+
+EMAIL_PROVIDERS = ("sendgrid", "ses", "raw")
+
+SNS_MESSAGE_TYPE_HEADER = "x-amz-sns-message-type"
+
+
+@dataclass
+class InboundAttachment:
+    """A file attached to an inbound email."""
+    filename: str = ""
+    content_type: str = "application/octet-stream"
+    content: bytes = b""
+
+
+@dataclass
+class InboundEmail:
+    """Provider-independent inbound email."""
+    from_address: str = ""
+    from_name: str = ""
+    to: List[str] = field(default_factory=list)
+    cc: List[str] = field(default_factory=list)
+    subject: str = ""
+    text: str = ""
+    html: str = ""
+    message_id: str = ""
+    attachments: List[InboundAttachment] = field(default_factory=list)
+
+
+def parse_mime(raw: bytes) -> InboundEmail:
+    """Parse a raw RFC 5322 message."""
+    msg = BytesParser(policy=policy.default).parsebytes(raw)
+
+    email = InboundEmail(
+        subject=str(msg.get("subject", "") or ""),
+        message_id=str(msg.get("message-id", "") or "").strip(),
+        to=_addresses(msg.get_all("to", [])),
+        cc=_addresses(msg.get_all("cc", [])),
+    )
+    email.from_name, email.from_address = parseaddr(str(msg.get("from", "") or ""))
+
+    text_part = msg.get_body(preferencelist=("plain",))
+    if text_part is not None:
+        email.text = text_part.get_content()
+    html_part = msg.get_body(preferencelist=("html",))
+    if html_part is not None:
+        email.html = html_part.get_content()
+
+    for part in msg.iter_attachments():
+        email.attachments.append(InboundAttachment(
+            filename=part.get_filename() or "attachment",
+            content_type=part.get_content_type(),
+            content=part.get_payload(decode=True) or b"",
+        ))
+
+    return email
+
+
+def parse_sendgrid(content_type: str, body: bytes) -> InboundEmail:
+    """Parse a SendGrid Inbound Parse webhook post."""
+    fields, files = parse_form_data(content_type, body)
+
+    # "Send Raw" mode posts the full MIME message
+    if "email" in fields:
+        return parse_mime(fields["email"].encode("utf-8"))
+
+    email = InboundEmail(
+        subject=fields.get("subject", ""),
+        text=fields.get("text", ""),
+        html=fields.get("html", ""),
+        to=_addresses([fields.get("to", "")]),
+        cc=_addresses([fields.get("cc", "")]),
+    )
+    email.from_name, email.from_address = parseaddr(fields.get("from", ""))
+
+    headers = BytesParser(policy=policy.default).parsebytes(
+        fields.get("headers", "").encode("utf-8"), headersonly=True
+    )
+    email.message_id = str(headers.get("message-id", "") or "").strip()
+
+    try:
+        info = json.loads(fields.get("attachment-info") or "{}")
+    except json.JSONDecodeError:
+        info = {}
+    for name in sorted(files):
+        filename, file_type, content = files[name]
+        meta = info.get(name) if isinstance(info, dict) else None
+        meta = meta if isinstance(meta, dict) else {}
+        email.attachments.append(InboundAttachment(
+            filename=meta.get("filename") or filename or name,
+            content_type=meta.get("type") or file_type,
+            content=content,
+        ))
+
+    return email
+
+
+def parse_ses_notification(body: bytes) -> Tuple[str, Optional[InboundEmail]]:
+    """
+    Parse an SNS message carrying an SES receipt notification.
+
+    Returns the SNS message type and, for notifications, the email.
+    SubscriptionConfirmation messages carry no email.
+    """
+    try:
+        envelope = json.loads(body)
+    except json.JSONDecodeError as e:
+        raise ValueError(f"SNS message must be valid JSON: {e}") from e
+    if not isinstance(envelope, dict):
+        raise ValueError("SNS message must be a JSON object")
+
+    message_type = envelope.get("Type", "")
+    if message_type != "Notification":
+        return message_type, None
+
+    try:
+        notification = json.loads(envelope.get("Message") or "")
+    except json.JSONDecodeError as e:
+        raise ValueError(f"SES notification must be valid JSON: {e}") from e
+
+    content = notification.get("content") if isinstance(notification, dict) else None
+    if not isinstance(content, str) or not content:
+        raise ValueError("SES notification has no message content; enable the SNS action's message content")
+
+    action = (notification.get("receipt") or {}).get("action") or {}
+    if str(action.get("encoding", "")).upper() == "BASE64":
+        try:
+            return message_type, parse_mime(base64.b64decode(content, validate=True))
+        except binascii.Error as e:
+            raise ValueError(f"SES message content is not valid base64: {e}") from e
+    return message_type, parse_mime(content.encode("utf-8"))
+
+
+async def confirm_sns_subscription(body: bytes, client: Optional[httpx.AsyncClient] = None) -> None:
+    """Confirm an SNS subscription by visiting its SubscribeURL."""
+    envelope = json.loads(body)
+    url = envelope.get("SubscribeURL", "")
+    parsed = urlparse(url)
+    # Only ever call back into SNS itself
+    if parsed.scheme != "https" or not parsed.hostname or not parsed.hostname.endswith(".amazonaws.com"):
+        raise ValueError("SubscribeURL must be an https amazonaws.com URL")
+
+    if client:
+        response = await client.get(url)
+    else:
+        async with httpx.AsyncClient(timeout=10.0) as owned:
+            response = await owned.get(url)
+    if response.status_code != 200:
+        raise ValueError(f"SNS subscription confirmation failed with status {response.status_code}")
+
+
+def parse_form_data(content_type: str, body: bytes) -> Tuple[Dict[str, str], Dict[str, Tuple[str, str, bytes]]]:
+    """
+    Parse a multipart/form-data body.
+
+    Returns text fields by name and files by name as (filename, content type, content).
+    """
+    if not content_type.startswith("multipart/form-data"):
+        raise ValueError("expected a multipart/form-data body")
+
+    msg = BytesParser(policy=policy.HTTP).parsebytes(
+        b"Content-Type: " + content_type.encode("latin-1") + b"\r\n\r\n" + body
+    )
+    if not isinstance(msg, EmailMessage) or not msg.is_multipart():
+        raise ValueError("malformed multipart/form-data body")
+
+    fields: Dict[str, str] = {}
+    files: Dict[str, Tuple[str, str, bytes]] = {}
+    for part in msg.iter_parts():
+        name = part.get_param("name", header="content-disposition")
+        if not name:
+            continue
+        payload = part.get_payload(decode=True) or b""
+        filename = part.get_filename()
+        if filename is not None:
+            files[name] = (filename, part.get_content_type(), payload)
+        else:
+            charset = part.get_content_charset() or "utf-8"
+            fields[name] = payload.decode(charset, errors="replace")
+
+    return fields, files
+
+
+def _addresses(values: List[str]) -> List[str]:
+    return [address for _, address in getaddresses([str(v) for v in values if v]) if address]
@@ -0,0 +1,55 @@
+"""
+In-memory sliding window rate limiter.
+
+Limits are tracked per server instance; with several instances behind a load
+balancer the effective limit is multiplied by the instance count.
+"""
+
+import time
+from collections import deque
+from typing import Callable, Deque, Dict
+
+# Forget idle keys once this many are tracked
+MAX_TRACKED_KEYS = 100000
+
+
+class RateLimiter:
+    """Allows at most `limit` hits per key within a sliding window."""
+
+    def __init__(self, window: float = 60.0, clock: Callable[[], float] = time.monotonic):
+        self.window = window
+        self._clock = clock
+        self._hits: Dict[str, Deque[float]] = {}
+
+    def allow(self, key: str, limit: int) -> bool:
+        """Record a hit for key and return whether it is within the limit."""
+        now = self._clock()
+        hits = self._hits.get(key)
+        if hits is None:
+            if len(self._hits) >= MAX_TRACKED_KEYS:
+                self._prune(now)
+            hits = self._hits[key] = deque()
+
+        self._expire(hits, now)
+        if len(hits) >= limit:
+            return False
+
+        hits.append(now)
+        return True
+
+    def retry_after(self, key: str) -> float:
+        """Seconds until key may be hit again."""
+        hits = self._hits.get(key)
+        if not hits:
+            return 0.0
+        return max(0.0, hits[0] + self.window - self._clock())
+
+    def _expire(self, hits: Deque[float], now: float) -> None:
+        while hits and hits[0] <= now - self.window:
+            hits.popleft()
+
+    def _prune(self, now: float) -> None:
+        for key in list(self._hits):
+            self._expire(self._hits[key], now)
+            if not self._hits[key]:
+                del self._hits[key]
@@ -0,0 +1,32 @@
+"""
+Background jobs run by the server on behalf of tenants.
+"""
+
+from app.jobs.node_migrations import NodeMigrationWorker
+from app.jobs.api_keys import ApiKeyPolicyWorker
+from app.jobs.audit_export import AuditExporter, verify_audit_exports
+from app.jobs.backups import BackupVerifier
+from app.jobs.probes import CanaryProber
+from app.jobs.retention import RetentionSweeper
+from app.jobs.tenant_deletions import TenantDeletionWorker
+from app.jobs.compliance import build_bundle, collect_evidence, verify_bundle
+from app.jobs.scheduler import BACKGROUND, DEFAULT, INTERACTIVE, PRIORITIES, JobScheduler
+
+__all__ = [
+    "NodeMigrationWorker",
+    "ApiKeyPolicyWorker",
+    "AuditExporter",
+    "verify_audit_exports",
+    "BackupVerifier",
+    "CanaryProber",
+    "RetentionSweeper",
+    "TenantDeletionWorker",
+    "build_bundle",
+    "collect_evidence",
+    "verify_bundle",
+    "BACKGROUND",
+    "DEFAULT",
+    "INTERACTIVE",
+    "PRIORITIES",
+    "JobScheduler",
+]
@@ -0,0 +1,102 @@
+"""
+API key expiry warnings and revocation of unused keys.
+
+Every poll, the worker revokes keys unused for API_KEY_DISABLE_UNUSED_DAYS and
+warns tenants about keys expiring, or about to be revoked as unused, within
+API_KEY_WARNING_DAYS. Notifications are written to the tenant's outbox as
+api_key.* events, so they reach the tenant's webhooks and chat sinks like any
+other event. A tenant is warned once per key (again after an unused key was
+used); a crash between notifying and recording the warning may repeat it.
+"""
+
+import asyncio
+import logging
+from datetime import timedelta
+from typing import Any, Callable, Dict, Optional
+
+from app.config import ApiKeyPolicyConfig
+from app.db.tenant_db_manager import TenantDatabaseManager
+from app.repository import ApiKey, ApiKeyRepository, OutboxRepository
+
+logger = logging.getLogger(__name__)
+
+DAY = 86400.0
+
+
+class ApiKeyPolicyWorker:
+    """Applies the API key policies to the keys of all tenants."""
+
+    def __init__(
+        self,
+        repo: ApiKeyRepository,
+        tenant_db_manager: TenantDatabaseManager,
+        cfg: ApiKeyPolicyConfig,
+        leader: Optional[Callable[[], bool]] = None,
+    ):
+        self.repo = repo
+        self.tenant_db_manager = tenant_db_manager
+        self.cfg = cfg
+        # Checks only run while this returns True, e.g. while holding a leader role
+        self.leader = leader
+        self._task: Optional[asyncio.Task] = None
+        self._stopping = asyncio.Event()
+
+    def start(self) -> None:
+        """Start the worker loop in the background."""
+        if self._task:
+            return
+        self._stopping.clear()
+        self._task = asyncio.create_task(self._run())
+
+    async def stop(self) -> None:
+        """Stop the worker loop."""
+        if self._task:
+            self._stopping.set()
+            await self._task
+            self._task = None
+
+    async def _run(self) -> None:
+        while not self._stopping.is_set():
+            try:
+                if self.leader is None or self.leader():
+                    await self.run_once()
+            except Exception:
+                logger.exception("API key policy check failed")
+            try:
+                await asyncio.wait_for(self._stopping.wait(), timeout=self.cfg.poll_interval)
+            except asyncio.TimeoutError:
+                pass
+
+    async def run_once(self) -> None:
+        """Revoke unused keys and send due warnings."""
+        idle = self.cfg.disable_unused_days * DAY
+        warning = self.cfg.warning_days * DAY
+
+        if idle > 0:
+            for api_key in await self.repo.disable_unused(idle):
+                logger.info(f"Revoked API key {api_key.id} of tenant {api_key.tenant_id}: unused")
+                await self._notify(api_key, "api_key.disabled", {"reason": "unused"})
+
+        if warning <= 0:
+            return
+        for api_key in await self.repo.list_expiring(warning):
+            if await self._notify(api_key, "api_key.expiring", {"expires_at": api_key.expires_at.isoformat()}):
+                await self.repo.mark_warned(api_key.id)
+        if idle > 0:
+            for api_key in await self.repo.list_unused(max(idle - warning, 0.0)):
+                last_used = api_key.last_used_at or api_key.created_at
+                disables_at = last_used + timedelta(seconds=idle)
+                if await self._notify(api_key, "api_key.unused", {"disables_at": disables_at.isoformat()}):
+                    await self.repo.mark_warned(api_key.id)
+
+    async def _notify(self, api_key: ApiKey, event_type: str, details: Dict[str, Any]) -> bool:
+        """Write a notification to the tenant's outbox; returns False if that failed."""
+        try:
+            tenant_db = await self.tenant_db_manager.get_tenant_db(api_key.tenant_id)
+            await OutboxRepository(tenant_db).record(
+                event_type, "api_key", api_key.id, {"api_key": api_key.to_dict(), **details}
+            )
+        except Exception:
+            logger.exception(f"Failed to notify tenant {api_key.tenant_id} of {event_type} for API key {api_key.id}")
+            return False
+        return True
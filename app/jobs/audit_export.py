@@ -0,0 +1,246 @@
+"""
+Export of the audit log to write-once object storage, with hash chaining.
+
+Every AUDIT_EXPORT_INTERVAL seconds, audit events not yet exported are written
+in batches of up to AUDIT_EXPORT_BATCH_SIZE as
+
+    <prefix>/audit/<sequence, 12 digits>.json
+
+Each batch is a JSON object with its sequence number (from 1), its events and
+the hex SHA-256 of the previous batch object (prev_hash, 64 zeros for the
+first batch). Rewriting an exported event changes its batch's hash and breaks
+the chain at the next batch, so history can't be changed without rewriting
+every later batch, which Object Lock (AUDIT_EXPORT_RETENTION_DAYS) prevents.
+Batches are also recorded in the control database's audit_exports table.
+
+Batch objects are deterministic: an export retried after a failure writes the
+same bytes again. Events are only exported once AUDIT_EXPORT_SETTLE_SECONDS
+old, so events committed out of ID order aren't skipped.
+
+verify_audit_exports walks the chain in storage and, given the repository,
+compares it with the recorded batches and the events in the database; run it
+with `python main.py --verify-audit-log`. Events deleted with their tenant
+(see app/jobs/tenant_deletions.py) stay in storage and aren't reported missing.
+"""
+
+import asyncio
+import hashlib
+import json
+import logging
+import posixpath
+from dataclasses import dataclass, field
+from datetime import datetime, timedelta, timezone
+from typing import Any, Callable, Dict, List, Optional
+
+from app.config import AuditExportConfig
+from app.lake.storage import ObjectStore
+from app.repository import AuditEvent, AuditExport, AuditRepository
+
+logger = logging.getLogger(__name__)
+
+BATCH_FORMAT = "flexdb.audit"
+BATCH_FORMAT_VERSION = 1
+GENESIS_HASH = "0" * 64
+
+JSON_CONTENT_TYPE = "application/json"
+
+
+def batch_key(prefix: str, sequence: int) -> str:
+    """Return the object key of a batch."""
+    return posixpath.join(prefix, "audit", f"{sequence:012d}.json")
+
+
+def _event_dict(event: AuditEvent) -> Dict[str, Any]:
+    # Normalized the way it reads back from a batch
+    return json.loads(json.dumps(event.to_dict(), sort_keys=True))
+
+
+def encode_batch(sequence: int, prev_hash: str, events: List[AuditEvent]) -> bytes:
+    """Encode a batch of events; the same arguments always give the same bytes."""
+    batch = {
+        "format": BATCH_FORMAT,
+        "format_version": BATCH_FORMAT_VERSION,
+        "sequence": sequence,
+        "prev_hash": prev_hash,
+        "first_event_id": int(events[0].id),
+        "last_event_id": int(events[-1].id),
+        "event_count": len(events),
+        "events": [_event_dict(event) for event in events],
+    }
+    return json.dumps(batch, sort_keys=True, separators=(",", ":")).encode()
+
+
+class AuditExporter:
+    """Periodically exports the audit log as hash-chained batches."""
+
+    def __init__(
+        self,
+        repo: AuditRepository,
+        cfg: AuditExportConfig,
+        store: ObjectStore,
+        prefix: str = "",
+        leader: Optional[Callable[[], bool]] = None,
+    ):
+        self.repo = repo
+        self.cfg = cfg
+        self.store = store
+        # Exports only run while this returns True, e.g. while holding a leader role
+        self.leader = leader
+        self.prefix = prefix
+        self._task: Optional[asyncio.Task] = None
+        self._stopping = asyncio.Event()
+
+    def start(self) -> None:
+        """Start the export loop in the background."""
+        if self._task:
+            return
+        self._stopping.clear()
+        self._task = asyncio.create_task(self._run())
+
+    async def stop(self) -> None:
+        """Stop the export loop and release the object store."""
+        if self._task:
+            self._stopping.set()
+            await self._task
+            self._task = None
+        await self.store.close()
+
+    async def _run(self) -> None:
+        while not self._stopping.is_set():
+            try:
+                if self.leader is None or self.leader():
+                    await self.run_once()
+            except Exception:
+                logger.exception("Audit log export failed")
+            try:
+                await asyncio.wait_for(self._stopping.wait(), timeout=self.cfg.interval)
+            except asyncio.TimeoutError:
+                pass
+
+    async def run_once(self) -> int:
+        """Export batches until no settled events are left; returns the number of batches."""
+        exported = 0
+        while not self._stopping.is_set():
+            batch = await self.repo.export_next(self.cfg.batch_size, self.cfg.settle_seconds, self._write)
+            if batch is None:
+                break
+            exported += 1
+            logger.info(
+                f"Exported audit log batch {batch.sequence} (events {batch.first_event_id}-"
+                f"{batch.last_event_id}, sha256 {batch.hash})"
+            )
+        return exported
+
+    async def _write(self, last: Optional[AuditExport], events: List[AuditEvent]) -> AuditExport:
+        sequence = last.sequence + 1 if last else 1
+        prev_hash = last.hash if last else GENESIS_HASH
+        body = encode_batch(sequence, prev_hash, events)
+        key = batch_key(self.prefix, sequence)
+
+        retain_until = None
+        if self.cfg.retention_days > 0:
+            retain_until = datetime.now(timezone.utc) + timedelta(days=self.cfg.retention_days)
+        await self.store.put(key, body, JSON_CONTENT_TYPE, retain_until)
+
+        return AuditExport(
+            sequence=sequence,
+            first_event_id=int(events[0].id),
+            last_event_id=int(events[-1].id),
+            event_count=len(events),
+            object_key=key,
+            hash=hashlib.sha256(body).hexdigest(),
+            prev_hash=prev_hash,
+        )
+
+
+@dataclass
+class AuditVerification:
+    """Outcome of verifying the exported audit log."""
+    batches: int = 0
+    events: int = 0
+    head_hash: str = GENESIS_HASH  # hash of the last batch
+    problems: List[str] = field(default_factory=list)
+
+    @property
+    def ok(self) -> bool:
+        """Whether no problems were found."""
+        return not self.problems
+
+
+async def verify_audit_exports(
+    store: ObjectStore,
+    prefix: str = "",
+    repo: Optional[AuditRepository] = None
+) -> AuditVerification:
+    """
+    Verify the hash chain of the exported batches in storage. With repo, also
+    check that every recorded batch is in storage unchanged and that the
+    exported events still match the audit log in the database.
+    """
+    result = AuditVerification()
+    recorded = {batch.sequence: batch for batch in await repo.list_exports()} if repo else {}
+    erased = await repo.list_erased_tenant_ids() if repo else set()
+    last_event_id = 0
+
+    sequence = 1
+    while True:
+        body = await store.get(batch_key(prefix, sequence))
+        if body is None:
+            break
+        digest = hashlib.sha256(body).hexdigest()
+        try:
+            batch = json.loads(body)
+            events = batch["events"]
+            ids = [event["id"] for event in events]
+            batch_first, batch_last = batch["first_event_id"], batch["last_event_id"]
+        except (ValueError, KeyError, TypeError) as e:
+            result.problems.append(f"batch {sequence} is malformed: {e}")
+            result.head_hash = digest
+            sequence += 1
+            continue
+
+        if batch.get("sequence") != sequence:
+            result.problems.append(f"batch {sequence} has sequence number {batch.get('sequence')}")
+        if batch.get("prev_hash") != result.head_hash:
+            result.problems.append(f"batch {sequence} does not chain to the previous batch")
+        if (
+            batch.get("event_count") != len(events)
+            or not ids
+            or [int(id) for id in ids] != sorted(set(int(id) for id in ids))
+            or int(ids[0]) != batch_first
+            or int(ids[-1]) != batch_last
+            or batch_first <= last_event_id
+        ):
+            result.problems.append(f"batch {sequence} has inconsistent event IDs")
+
+        if repo:
+            exported = recorded.get(sequence)
+            if exported is None:
+                result.problems.append(f"batch {sequence} is not recorded in the database")
+            elif exported.hash != digest:
+                result.problems.append(f"batch {sequence} differs from the batch exported (sha256 {exported.hash})")
+
+            stored = {event["id"]: event for event in events}
+            current = {
+                event.id: _event_dict(event)
+                for event in await repo.list_range(last_event_id + 1, batch_last)
+            }
+            for id in sorted(stored.keys() | current.keys(), key=int):
+                if id not in current:
+                    if stored[id].get("tenant_id") in erased:
+                        continue
+                    result.problems.append(f"event {id} was deleted from the audit log")
+                elif id not in stored:
+                    result.problems.append(f"event {id} was added to the audit log after its batch")
+                elif stored[id] != current[id]:
+                    result.problems.append(f"event {id} was modified in the audit log")
+
+        result.batches += 1
+        result.events += len(events)
+        result.head_hash = digest
+        last_event_id = max(last_event_id, batch_last)
+        sequence += 1
+
+    for missing in sorted(s for s in recorded if s >= sequence):
+        result.problems.append(f"batch {missing} is missing from storage")
+    return result
@@ -0,0 +1,390 @@
+"""
+Restore drills: scheduled verification that backups can be restored.
+
+Every BACKUP_VERIFY_INTERVAL seconds, the newest file matching
+BACKUP_VERIFY_PATH (by modification time) is restored into the scratch
+database BACKUP_VERIFY_SCRATCH_DATABASE, with pg_restore for pg_dump custom
+and tar format archives and psql for plain .sql scripts. The restored database
+is recognized as a control or tenant database and checked:
+
+    schema_migrations      migrations were recorded
+    control databases      tenant databases and API keys belong to existing
+                           tenants; tenants and the audit log can be read
+    tenant databases       nodes belong to existing node types, relationships
+                           to existing nodes, every node has a revision; node
+                           types and nodes can be read and their JSON parsed
+
+The drill fails if the restore fails or times out, any check fails or, with
+BACKUP_VERIFY_MAX_AGE_HOURS, the backup is too old. Results are recorded in the
+control database's backup_verifications table, included in compliance
+evidence bundles and exported as flexdb_backup_verification_* metrics. The
+scratch database is dropped before and after every drill, so it must not be
+used for anything else.
+
+pg_restore and psql must be installed (postgresql-client) and should be the
+same major version as the server the backups were taken from, or newer.
+"""
+
+import asyncio
+import glob
+import json
+import logging
+import os
+import ssl
+import time
+from datetime import datetime, timedelta, timezone
+from typing import Any, Awaitable, Callable, Dict, List, Optional, Tuple
+
+import asyncpg
+
+from app.config import BackupVerifyConfig, Config
+from app.metrics.registry import metric_family
+from app.repository import BackupVerification, BackupVerificationRepository
+
+logger = logging.getLogger(__name__)
+
+SUCCEEDED = "succeeded"
+FAILED = "failed"
+
+CONTROL = "control"
+TENANT = "tenant"
+
+# Check: (connection, sample size) -> (ok, detail)
+Check = Callable[[asyncpg.Connection, int], Awaitable[Tuple[bool, str]]]
+
+
+def latest_backup(pattern: str) -> Optional[Tuple[str, datetime]]:
+    """Return the path and modification time of the newest file matching pattern, or None."""
+    paths = [path for path in glob.glob(pattern) if os.path.isfile(path)]
+    if not paths:
+        return None
+    path = max(paths, key=os.path.getmtime)
+    return path, datetime.fromtimestamp(os.path.getmtime(path), timezone.utc)
+
+
+def restore_command(path: str, database: str) -> List[str]:
+    """Return the command restoring a backup file into database."""
+    if path.endswith(".sql"):
+        return ["psql", "--quiet", "--no-psqlrc", "--set", "ON_ERROR_STOP=1", "--dbname", database, "--file", path]
+    return ["pg_restore", "--no-owner", "--no-privileges", "--exit-on-error", "--dbname", database, path]
+
+
+def _ssl_context(ssl_mode: str):
+    if ssl_mode in ("require", "prefer"):
+        return ssl_mode
+    if ssl_mode in ("verify-ca", "verify-full"):
+        return ssl.create_default_context()
+    return None
+
+
+def _result(name: str, ok: bool, detail: str) -> Dict[str, Any]:
+    return {"name": name, "ok": ok, "detail": detail}
+
+
+async def _table_exists(conn: asyncpg.Connection, table: str) -> bool:
+    return await conn.fetchval("SELECT to_regclass($1) IS NOT NULL", table)
+
+
+async def _orphans(conn: asyncpg.Connection, query: str, what: str) -> Tuple[bool, str]:
+    count = await conn.fetchval(query)
+    return count == 0, f"{count} {what}"
+
+
+async def check_migrations(conn: asyncpg.Connection, sample_size: int) -> Tuple[bool, str]:
+    if not await _table_exists(conn, "schema_migrations"):
+        return False, "schema_migrations table is missing"
+    count, latest = await conn.fetchrow("SELECT COUNT(*), MAX(version) FROM schema_migrations")
+    return count > 0, f"{count} migrations, latest {latest}"
+
+
+async def check_tenant_databases(conn: asyncpg.Connection, sample_size: int) -> Tuple[bool, str]:
+    return await _orphans(
+        conn,
+        "SELECT COUNT(*) FROM tenant_databases d WHERE NOT EXISTS (SELECT 1 FROM tenants t WHERE t.id = d.tenant_id)",
+        "tenant databases without a tenant",
+    )
+
+
+async def check_api_keys(conn: asyncpg.Connection, sample_size: int) -> Tuple[bool, str]:
+    if not await _table_exists(conn, "api_keys"):
+        return True, "api_keys table not in this backup"
+    return await _orphans(
+        conn,
+        "SELECT COUNT(*) FROM api_keys k WHERE NOT EXISTS (SELECT 1 FROM tenants t WHERE t.id = k.tenant_id)",
+        "API keys without a tenant",
+    )
+
+
+async def sample_tenants(conn: asyncpg.Connection, sample_size: int) -> Tuple[bool, str]:
+    rows = await conn.fetch("SELECT id, slug FROM tenants ORDER BY created_at DESC LIMIT $1", sample_size)
+    total = await conn.fetchval("SELECT COUNT(*) FROM tenants")
+    return True, f"read {len(rows)} of {total} tenants"
+
+
+async def sample_audit_log(conn: asyncpg.Connection, sample_size: int) -> Tuple[bool, str]:
+    if not await _table_exists(conn, "audit_events"):
+        return True, "audit_events table not in this backup"
+    count, latest = await conn.fetchrow("SELECT COUNT(*), MAX(created_at) FROM audit_events")
+    await conn.fetch("SELECT details::text FROM audit_events ORDER BY id DESC LIMIT $1", sample_size)
+    return True, f"{count} audit events, latest {latest.isoformat() if latest else 'none'}"
+
+
+async def check_nodes(conn: asyncpg.Connection, sample_size: int) -> Tuple[bool, str]:
+    return await _orphans(
+        conn,
+        "SELECT COUNT(*) FROM nodes n WHERE NOT EXISTS (SELECT 1 FROM node_types t WHERE t.id = n.node_type_id)",
+        "nodes without a node type",
+    )
+
+
+async def check_relationships(conn: asyncpg.Connection, sample_size: int) -> Tuple[bool, str]:
+    return await _orphans(
+        conn,
+        """
+        SELECT COUNT(*) FROM relationships r
+        WHERE NOT EXISTS (SELECT 1 FROM nodes n WHERE n.id = r.source_node_id)
+           OR NOT EXISTS (SELECT 1 FROM nodes n WHERE n.id = r.target_node_id)
+        """,
+        "relationships with a missing node",
+    )
+
+
+async def check_revisions(conn: asyncpg.Connection, sample_size: int) -> Tuple[bool, str]:
+    if not await _table_exists(conn, "node_revisions"):
+        return True, "node_revisions table not in this backup"
+    return await _orphans(
+        conn,
+        "SELECT COUNT(*) FROM nodes n WHERE NOT EXISTS (SELECT 1 FROM node_revisions r WHERE r.node_id = n.id)",
+        "nodes without a revision",
+    )
+
+
+async def sample_nodes(conn: asyncpg.Connection, sample_size: int) -> Tuple[bool, str]:
+    schemas = await conn.fetch("SELECT schema::text FROM node_types")
+    rows = await conn.fetch(
+        "SELECT data::text FROM nodes ORDER BY created_at DESC LIMIT $1", sample_size
+    )
+    for row in list(schemas) + list(rows):
+        json.loads(row[0] or "null")
+    total = await conn.fetchval("SELECT COUNT(*) FROM nodes")
+    return True, f"read {len(schemas)} node types and {len(rows)} of {total} nodes"
+
+
+CHECKS: Dict[str, List[Tuple[str, Check]]] = {
+    CONTROL: [
+        ("schema_migrations", check_migrations),
+        ("tenant_databases_have_tenants", check_tenant_databases),
+        ("api_keys_have_tenants", check_api_keys),
+        ("sample_tenants", sample_tenants),
+        ("sample_audit_log", sample_audit_log),
+    ],
+    TENANT: [
+        ("schema_migrations", check_migrations),
+        ("nodes_have_node_types", check_nodes),
+        ("relationships_have_nodes", check_relationships),
+        ("nodes_have_revisions", check_revisions),
+        ("sample_nodes", sample_nodes),
+    ],
+}
+
+
+class BackupVerifier:
+    """Periodically restores the latest backup into a scratch database and checks it."""
+
+    def __init__(
+        self,
+        repo: BackupVerificationRepository,
+        cfg: BackupVerifyConfig,
+        db_cfg: Config,
+        leader: Optional[Callable[[], bool]] = None,
+    ):
+        self.repo = repo
+        self.cfg = cfg
+        self.db_cfg = db_cfg
+        # Drills only run while this returns True, e.g. while holding a leader role
+        self.leader = leader
+        self._task: Optional[asyncio.Task] = None
+        self._stopping = asyncio.Event()
+        # Metrics, kept per server instance
+        self.runs: Dict[str, int] = {SUCCEEDED: 0, FAILED: 0}
+        self.last: Optional[BackupVerification] = None
+        self.last_success_at: Optional[datetime] = None
+
+    def start(self) -> None:
+        """Start the drill loop in the background."""
+        if self._task:
+            return
+        self._stopping.clear()
+        self._task = asyncio.create_task(self._run())
+
+    async def stop(self) -> None:
+        """Stop the drill loop, abandoning a drill in progress."""
+        if self._task:
+            self._stopping.set()
+            self._task.cancel()
+            try:
+                await self._task
+            except asyncio.CancelledError:
+                pass
+            self._task = None
+
+    async def _run(self) -> None:
+        while not self._stopping.is_set():
+            try:
+                if self.leader is None or self.leader():
+                    await self.run_once()
+            except Exception:
+                logger.exception("Backup verification failed")
+            try:
+                await asyncio.wait_for(self._stopping.wait(), timeout=self.cfg.interval)
+            except asyncio.TimeoutError:
+                pass
+
+    async def run_once(self) -> BackupVerification:
+        """Run a restore drill of the newest backup and record its result."""
+        started = time.perf_counter()
+        verification = BackupVerification(started_at=datetime.now(timezone.utc))
+        try:
+            found = latest_backup(self.cfg.path)
+            if found is None:
+                raise RuntimeError(f"no backup matches {self.cfg.path}")
+            verification.backup, verification.backup_taken_at = found
+
+            if self.cfg.max_age_hours > 0:
+                age = verification.started_at - verification.backup_taken_at
+                verification.checks.append(_result(
+                    "backup_age", age <= timedelta(hours=self.cfg.max_age_hours),
+                    f"taken {age.total_seconds() / 3600:.1f} hours ago (limit {self.cfg.max_age_hours:g})"
+                ))
+
+            await self._drop_scratch()
+            await self._admin_execute(f'CREATE DATABASE "{self.cfg.scratch_database}"')
+            try:
+                await self._restore(verification.backup)
+                verification.database_kind, checks = await self._check()
+                verification.checks += checks
+            finally:
+                await self._drop_scratch()
+
+            failed = [check["name"] for check in verification.checks if not check["ok"]]
+            if failed:
+                verification.error = f"checks failed: {', '.join(failed)}"
+        except Exception as e:
+            verification.error = str(e) or type(e).__name__
+
+        verification.status = FAILED if verification.error else SUCCEEDED
+        verification.duration_seconds = time.perf_counter() - started
+        verification.finished_at = datetime.now(timezone.utc)
+        self._observe(verification)
+
+        if verification.status == SUCCEEDED:
+            logger.info(
+                f"Backup {verification.backup} restored and verified as a {verification.database_kind} database "
+                f"in {verification.duration_seconds:.1f}s"
+            )
+        else:
+            logger.error(f"Backup verification of {verification.backup or self.cfg.path} failed: {verification.error}")
+        return await self.repo.record(verification)
+
+    def _observe(self, verification: BackupVerification) -> None:
+        self.runs[verification.status] += 1
+        self.last = verification
+        if verification.status == SUCCEEDED:
+            self.last_success_at = verification.finished_at
+
+    async def _admin_execute(self, statement: str) -> None:
+        # CREATE and DROP DATABASE run outside the scratch database
+        conn = await asyncpg.connect(self.db_cfg.dsn("postgres"), ssl=_ssl_context(self.db_cfg.ssl_mode))
+        try:
+            await conn.execute(statement)
+        finally:
+            await conn.close()
+
+    async def _drop_scratch(self) -> None:
+        await self._admin_execute(f'DROP DATABASE IF EXISTS "{self.cfg.scratch_database}" WITH (FORCE)')
+
+    async def _restore(self, path: str) -> None:
+        env = dict(
+            os.environ,
+            PGHOST=self.db_cfg.host,
+            PGPORT=str(self.db_cfg.port),
+            PGUSER=self.db_cfg.user,
+            PGPASSWORD=self.db_cfg.password,
+            PGSSLMODE=self.db_cfg.ssl_mode,
+        )
+        command = restore_command(path, self.cfg.scratch_database)
+        process = await asyncio.create_subprocess_exec(
+            *command, env=env, stdout=asyncio.subprocess.DEVNULL, stderr=asyncio.subprocess.PIPE
+        )
+        try:
+            _, stderr = await asyncio.wait_for(process.communicate(), timeout=self.cfg.timeout)
+        except (asyncio.TimeoutError, asyncio.CancelledError) as e:
+            process.kill()
+            await process.wait()
+            if isinstance(e, asyncio.CancelledError):
+                raise
+            raise RuntimeError(f"restore timed out after {self.cfg.timeout:g} seconds") from None
+        if process.returncode != 0:
+            message = stderr.decode(errors="replace").strip().splitlines()
+            raise RuntimeError(
+                f"{command[0]} exited with status {process.returncode}: {message[-1] if message else 'no output'}"
+            )
+
+    async def _check(self) -> Tuple[str, List[Dict[str, Any]]]:
+        conn = await asyncpg.connect(
+            self.db_cfg.dsn(self.cfg.scratch_database), ssl=_ssl_context(self.db_cfg.ssl_mode)
+        )
+        try:
+            if await _table_exists(conn, "tenants"):
+                kind = CONTROL
+            elif await _table_exists(conn, "nodes"):
+                kind = TENANT
+            else:
+                return "", [_result("database_kind", False, "neither a control nor a tenant database")]
+
+            results = []
+            for name, check in CHECKS[kind]:
+                try:
+                    ok, detail = await check(conn, self.cfg.sample_size)
+                except (asyncpg.PostgresError, ValueError) as e:
+                    ok, detail = False, str(e)
+                results.append(_result(name, ok, detail))
+            return kind, results
+        finally:
+            await conn.close()
+
+    def metric_lines(self, openmetrics: bool = False) -> List[str]:
+        """Render the drill metrics in the Prometheus or OpenMetrics text format."""
+        def family(name: str, metric_type: str, help_text: str) -> List[str]:
+            return metric_family(name, metric_type, help_text, openmetrics)
+
+        lines = family("flexdb_backup_verifications_total", "counter", "Restore drills by result.")
+        for result, value in sorted(self.runs.items()):
+            lines.append(f'flexdb_backup_verifications_total{{result="{result}"}} {value}')
+
+        lines += family(
+            "flexdb_backup_verification_last_success_timestamp_seconds", "gauge",
+            "Unix time the last successful restore drill finished."
+        )
+        success = self.last_success_at.timestamp() if self.last_success_at else 0
+        lines.append(f"flexdb_backup_verification_last_success_timestamp_seconds {success!r}")
+
+        if self.last:
+            lines += family(
+                "flexdb_backup_verification_last_status", "gauge",
+                "Whether the last restore drill succeeded (1) or failed (0)."
+            )
+            lines.append(f"flexdb_backup_verification_last_status {int(self.last.status == SUCCEEDED)}")
+            lines += family(
+                "flexdb_backup_verification_last_duration_seconds", "gauge", "Duration of the last restore drill."
+            )
+            lines.append(f"flexdb_backup_verification_last_duration_seconds {self.last.duration_seconds!r}")
+            if self.last.backup_taken_at:
+                lines += family(
+                    "flexdb_backup_verification_backup_timestamp_seconds", "gauge",
+                    "Unix time the backup restored by the last drill was taken."
+                )
+                lines.append(
+                    f"flexdb_backup_verification_backup_timestamp_seconds {self.last.backup_taken_at.timestamp()!r}"
+                )
+        return lines
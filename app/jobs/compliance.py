@@ -0,0 +1,237 @@
+"""
+Compliance evidence bundles, for SOC 2 and similar reviews.
+
+`python main.py --compliance-report bundle.tar.gz` collects evidence from the
+control database into a gzipped tar archive:
+
+    access_log_summary.json   audit events of the last COMPLIANCE_PERIOD_DAYS by type
+    key_rotation.json         every API key with its rotation status under the key policy
+    backup_verification.json  restore drills of the period (see app/jobs/backups.py)
+    migration_history.json    migrations applied to the control and tenant databases
+    audit_log_verification.json  hash chain verification of the exported audit log
+    manifest.json             the hex SHA-256 of every artifact and the generation time
+    manifest.sig              HMAC-SHA256 of manifest.json, keyed with COMPLIANCE_SIGNING_KEY
+
+Artifacts that can't be produced in a deployment, such as the audit log
+verification without AUDIT_EXPORT_URL or restore drills when none ran in the
+period, have the status "not_configured".
+`python main.py --verify-compliance-report bundle.tar.gz` checks the signature
+and every artifact against the manifest.
+"""
+
+import hashlib
+import hmac
+import io
+import json
+import tarfile
+from datetime import datetime, timedelta
+from typing import Any, Dict, List, Optional
+
+from app.config import ApiKeyPolicyConfig
+from app.db import Database, migration_history
+from app.db.control_database import CONTROL_MIGRATIONS_DIR
+from app.db.migrator import list_migrations
+from app.db.tenant_db_manager import TENANT_MIGRATIONS_DIR
+from app.jobs.audit_export import AuditVerification
+from app.repository import (
+    ApiKey,
+    ApiKeyRepository,
+    AuditRepository,
+    BackupVerification,
+    BackupVerificationRepository,
+)
+
+BUNDLE_FORMAT = "flexdb.compliance"
+BUNDLE_FORMAT_VERSION = 1
+
+MANIFEST = "manifest.json"
+SIGNATURE = "manifest.sig"
+SIGNATURE_SCHEME = "v1"
+
+NOT_CONFIGURED = {"status": "not_configured"}
+
+
+def _aware(value: datetime) -> datetime:
+    # Naive times are local, like the defaults of the models
+    return value if value.tzinfo else value.astimezone()
+
+
+def key_rotation_status(keys: List[ApiKey], policy: ApiKeyPolicyConfig, now: datetime) -> Dict[str, Any]:
+    """
+    Classify API keys as revoked, expired, expiring (within the policy's
+    warning days), overdue (older than its maximum lifetime without expiring,
+    such as keys created before the policy) or active, with counts by status.
+    """
+    entries = []
+    counts: Dict[str, int] = {}
+    for key in keys:
+        created = _aware(key.created_at)
+        expires = _aware(key.expires_at) if key.expires_at else None
+        if key.revoked_at:
+            status = "revoked"
+        elif expires and expires <= now:
+            status = "expired"
+        elif expires and expires <= now + timedelta(days=policy.warning_days):
+            status = "expiring"
+        elif policy.max_lifetime_days and created + timedelta(days=policy.max_lifetime_days) <= now:
+            status = "overdue"
+        else:
+            status = "active"
+
+        counts[status] = counts.get(status, 0) + 1
+        entry = key.to_dict()
+        entry["status"] = status
+        entry["age_days"] = (now - created).days
+        entries.append(entry)
+
+    return {
+        "policy": {
+            "max_lifetime_days": policy.max_lifetime_days,
+            "disable_unused_days": policy.disable_unused_days,
+            "warning_days": policy.warning_days,
+        },
+        "counts": counts,
+        "keys": entries,
+    }
+
+
+def pending_migrations(history: Dict[str, Any]) -> Dict[str, Any]:
+    """Return the migrations in this release not yet applied to the control database or each tenant database."""
+    control = {m["version"] for m in history["control"]}
+    tenant_versions = [m.version for m in list_migrations(TENANT_MIGRATIONS_DIR)]
+    return {
+        "control": [m.version for m in list_migrations(CONTROL_MIGRATIONS_DIR) if m.version not in control],
+        "tenants": {
+            tenant_id: missing
+            for tenant_id, applied in history["tenants"].items()
+            if (missing := [v for v in tenant_versions if v not in {m["version"] for m in applied}])
+        },
+    }
+
+
+def backup_verification_report(drills: List[BackupVerification]) -> Dict[str, Any]:
+    """Summarize the restore drills of the period, oldest first, as an artifact."""
+    if not drills:
+        return NOT_CONFIGURED
+    succeeded = sum(1 for drill in drills if drill.status == "succeeded")
+    return {
+        "status": drills[-1].status,
+        "drills": len(drills),
+        "succeeded": succeeded,
+        "failed": len(drills) - succeeded,
+        "latest": drills[-1].to_dict(),
+        "history": [drill.to_dict() for drill in drills],
+    }
+
+
+def audit_verification_report(result: AuditVerification) -> Dict[str, Any]:
+    """Return the outcome of verify_audit_exports as an artifact."""
+    return {
+        "status": "intact" if result.ok else "problems",
+        "batches": result.batches,
+        "events": result.events,
+        "head_hash": result.head_hash,
+        "problems": list(result.problems),
+    }
+
+
+async def collect_evidence(
+    control_db: Database,
+    policy: ApiKeyPolicyConfig,
+    period_days: int,
+    now: datetime,
+    audit_verification: Optional[AuditVerification] = None,
+) -> Dict[str, Any]:
+    """Collect the evidence artifacts from the control database, by file name."""
+    since = now - timedelta(days=period_days)
+    counts = await AuditRepository(control_db).count_by_type(since, now)
+    history = await migration_history(control_db)
+    history["pending"] = pending_migrations(history)
+
+    return {
+        "access_log_summary.json": {
+            "from": since.isoformat(),
+            "to": now.isoformat(),
+            "total": sum(counts.values()),
+            "event_types": counts,
+        },
+        "key_rotation.json": key_rotation_status(await ApiKeyRepository(control_db).list_all(), policy, now),
+        "backup_verification.json": backup_verification_report(
+            await BackupVerificationRepository(control_db).list_since(since)
+        ),
+        "migration_history.json": history,
+        "audit_log_verification.json": (
+            audit_verification_report(audit_verification) if audit_verification else NOT_CONFIGURED
+        ),
+    }
+
+
+def _encode(value: Any) -> bytes:
+    return json.dumps(value, indent=2, sort_keys=True).encode()
+
+
+def _sign(key: str, manifest: bytes) -> str:
+    return f"{SIGNATURE_SCHEME}={hmac.new(key.encode(), manifest, hashlib.sha256).hexdigest()}"
+
+
+def build_bundle(artifacts: Dict[str, Any], signing_key: str, generated_at: datetime) -> bytes:
+    """Encode artifacts as a signed, gzipped tar archive."""
+    if not signing_key:
+        raise ValueError("COMPLIANCE_SIGNING_KEY is required")
+
+    files = {name: _encode(value) for name, value in sorted(artifacts.items())}
+    manifest = _encode({
+        "format": BUNDLE_FORMAT,
+        "format_version": BUNDLE_FORMAT_VERSION,
+        "generated_at": generated_at.isoformat(),
+        "artifacts": {name: hashlib.sha256(body).hexdigest() for name, body in files.items()},
+    })
+    files[MANIFEST] = manifest
+    files[SIGNATURE] = _sign(signing_key, manifest).encode()
+
+    out = io.BytesIO()
+    with tarfile.open(fileobj=out, mode="w:gz") as tar:
+        for name, body in files.items():
+            info = tarfile.TarInfo(name)
+            info.size = len(body)
+            info.mtime = int(generated_at.timestamp())
+            info.mode = 0o444
+            tar.addfile(info, io.BytesIO(body))
+    return out.getvalue()
+
+
+def verify_bundle(bundle: bytes, signing_key: str) -> List[str]:
+    """Verify a bundle's signature and artifacts; returns the problems found."""
+    if not signing_key:
+        raise ValueError("COMPLIANCE_SIGNING_KEY is required")
+
+    files: Dict[str, bytes] = {}
+    try:
+        with tarfile.open(fileobj=io.BytesIO(bundle), mode="r:gz") as tar:
+            for member in tar.getmembers():
+                if member.isfile():
+                    files[member.name] = tar.extractfile(member).read()
+    except (tarfile.TarError, OSError, EOFError) as e:
+        return [f"bundle is not a readable archive: {e}"]
+
+    manifest = files.pop(MANIFEST, None)
+    signature = files.pop(SIGNATURE, None)
+    if manifest is None or signature is None:
+        return ["bundle has no signed manifest"]
+    if not hmac.compare_digest(signature.decode(errors="replace").strip(), _sign(signing_key, manifest)):
+        return ["manifest signature is invalid"]
+
+    try:
+        expected = json.loads(manifest)["artifacts"]
+    except (ValueError, KeyError, TypeError) as e:
+        return [f"manifest is malformed: {e}"]
+    problems = []
+    for name in sorted(expected.keys() | files.keys()):
+        if name not in files:
+            problems.append(f"artifact {name} is missing")
+        elif name not in expected:
+            problems.append(f"artifact {name} is not in the manifest")
+        elif hashlib.sha256(files[name]).hexdigest() != expected[name]:
+            problems.append(f"artifact {name} was modified")
+    return problems
+
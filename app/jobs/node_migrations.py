@@ -0,0 +1,115 @@
+"""
+Background execution of node schema migrations.
+
+Every poll, the worker claims one pending migration per active tenant (or a
+running one abandoned by a stopped instance) and runs it batch by batch until
+it finishes, is cancelled, or the worker stops. Progress is saved after every
+batch; nodes migrated before a crash are no longer outdated, so a resumed
+migration simply continues with the rest. Batches run as default priority
+jobs (see app/jobs/scheduler.py), taking turns between tenants.
+"""
+
+import asyncio
+import logging
+from typing import Optional
+
+from app.config import JobSchedulerConfig, NodeMigrationConfig
+from app.db.tenant_db_manager import TenantDatabaseManager
+from app.encryption import current_kms
+from app.jobs.scheduler import DEFAULT, JobScheduler
+from app.repository import DataKeyRepository, NodeMigrationRepository, NodeRepository, NodeTypeRepository
+from app.service.encryption import FieldEncryption
+from app.service.node_migration_service import NodeMigrationService
+
+logger = logging.getLogger(__name__)
+
+# A running migration not heard from for this long is considered abandoned
+LEASE_SECONDS = 120.0
+
+
+class NodeMigrationWorker:
+    """Runs pending node migrations of all tenants."""
+
+    def __init__(
+        self,
+        tenant_db_manager: TenantDatabaseManager,
+        cfg: NodeMigrationConfig,
+        scheduler: Optional[JobScheduler] = None
+    ):
+        self.tenant_db_manager = tenant_db_manager
+        self.cfg = cfg
+        self.scheduler = scheduler or JobScheduler(JobSchedulerConfig())
+        self._task: Optional[asyncio.Task] = None
+        self._stopping = asyncio.Event()
+
+    def start(self) -> None:
+        """Start the worker loop in the background."""
+        if self._task:
+            return
+        self._stopping.clear()
+        self._task = asyncio.create_task(self._run())
+
+    async def stop(self) -> None:
+        """Stop the worker loop; a running migration is resumed later."""
+        if self._task:
+            self._stopping.set()
+            await self._task
+            self._task = None
+
+    async def _run(self) -> None:
+        while not self._stopping.is_set():
+            try:
+                await self.run_once()
+            except Exception:
+                logger.exception("Node migration poll failed")
+            try:
+                await asyncio.wait_for(self._stopping.wait(), timeout=self.cfg.poll_interval)
+            except asyncio.TimeoutError:
+                pass
+
+    async def run_once(self) -> None:
+        """Run a single poll over all active tenants."""
+        tenant_ids = await self.tenant_db_manager.list_active_tenant_ids()
+        await asyncio.gather(*(self._migrate(tenant_id) for tenant_id in tenant_ids))
+
+    async def _migrate(self, tenant_id: str) -> None:
+        try:
+            await self.run_tenant(tenant_id)
+        except Exception:
+            logger.exception(f"Node migration failed for tenant {tenant_id}")
+
+    async def run_tenant(self, tenant_id: str) -> None:
+        """Claim and run one migration of a tenant, if any is pending."""
+        tenant_db = await self.tenant_db_manager.get_tenant_db(tenant_id)
+        repo = NodeMigrationRepository(tenant_db)
+        migration = await repo.claim(LEASE_SECONDS)
+        if migration is None:
+            return
+
+        service = NodeMigrationService(
+            repo, NodeTypeRepository(tenant_db), NodeRepository(tenant_db),
+            FieldEncryption(current_kms(), DataKeyRepository(tenant_db), tenant_id)
+        )
+
+        async def run_batch() -> bool:
+            if self._stopping.is_set():
+                return False
+            try:
+                await service.run_batch(migration)
+            except Exception as e:
+                migration.status = "failed"
+                migration.error = str(e) or e.__class__.__name__
+                await repo.save_progress(migration, LEASE_SECONDS)
+                raise
+            if not await repo.save_progress(migration, LEASE_SECONDS):
+                logger.info(f"Node migration {migration.id} of tenant {tenant_id} was cancelled")
+                return False
+            if migration.status != "running":
+                logger.info(
+                    f"Node migration {migration.id} of tenant {tenant_id} {migration.status}: "
+                    f"{migration.migrated_count} migrated, {migration.failed_count} failed"
+                )
+                return False
+            return True
+
+        await self.scheduler.run(DEFAULT, tenant_id, run_batch)
@@ -0,0 +1,218 @@
+"""
+Synthetic probes: the node API exercised end to end in a canary tenant.
+
+Every PROBE_INTERVAL seconds, each server instance resolves the services of
+the tenant PROBE_TENANT_ID as a request would and runs a probe through them:
+
+    create    resolve the tenant and create a node of the FlexdbProbe node
+              type (created on first use)
+    read      read it back and compare its data
+    update    update it and check the new data and version
+    delete    delete it and check it is gone
+
+A probe fails at the first step that raises, returns something unexpected or
+takes longer than PROBE_TIMEOUT seconds; a node left behind by a failed probe
+is deleted. Health checks only show the process answers; probes catch
+regressions in the database, migrations, schema validation, encryption and
+tenant routing that requests would hit. Results are exported as flexdb_probe_*
+metrics and failures logged. Every instance probes, so a broken instance shows
+up on its own /metrics.
+"""
+
+import asyncio
+import json
+import logging
+import time
+from datetime import datetime, timezone
+from typing import Any, Awaitable, Callable, Dict, List, Optional
+
+from app.config import ProbeConfig
+from app.metrics.registry import metric_family
+from app.repository.errors import NotFoundError
+
+logger = logging.getLogger(__name__)
+
+SUCCEEDED = "succeeded"
+FAILED = "failed"
+
+CREATE = "create"
+READ = "read"
+UPDATE = "update"
+DELETE = "delete"
+STEPS = (CREATE, READ, UPDATE, DELETE)
+
+# Node type of probe nodes, created in the canary tenant on first use
+PROBE_NODE_TYPE = "FlexdbProbe"
+PROBE_SCHEMA = '{"probe": "string", "sequence": "number"}'
+
+# Resolves the services of a tenant, as resolve_tenant_services does
+ResolveServices = Callable[[str], Awaitable[Dict[str, Any]]]
+
+
+class ProbeError(Exception):
+    """A probe step returned something other than expected."""
+
+
+class CanaryProber:
+    """Periodically creates, reads, updates and deletes a node in the canary tenant."""
+
+    def __init__(self, resolve: ResolveServices, cfg: ProbeConfig):
+        self.resolve = resolve
+        self.cfg = cfg
+        self._node_type_id = ""
+        self._sequence = 0
+        self._task: Optional[asyncio.Task] = None
+        self._stopping = asyncio.Event()
+        # Metrics, kept per server instance
+        self.runs: Dict[str, int] = {SUCCEEDED: 0, FAILED: 0}
+        self.step_failures: Dict[str, int] = {step: 0 for step in STEPS}
+        self.step_seconds: Dict[str, float] = {}
+        self.last_status: Optional[str] = None
+        self.last_duration = 0.0
+        self.last_success_at: Optional[datetime] = None
+
+    def start(self) -> None:
+        """Start the probe loop in the background."""
+        if self._task:
+            return
+        self._stopping.clear()
+        self._task = asyncio.create_task(self._run())
+
+    async def stop(self) -> None:
+        """Stop the probe loop, abandoning a probe in progress."""
+        if self._task:
+            self._stopping.set()
+            self._task.cancel()
+            try:
+                await self._task
+            except asyncio.CancelledError:
+                pass
+            self._task = None
+
+    async def _run(self) -> None:
+        while not self._stopping.is_set():
+            try:
+                await self.run_once()
+            except Exception:
+                logger.exception("Probe failed")
+            try:
+                await asyncio.wait_for(self._stopping.wait(), timeout=self.cfg.interval)
+            except asyncio.TimeoutError:
+                pass
+
+    async def run_once(self) -> bool:
+        """Run one probe and record its result; returns whether it succeeded."""
+        started = time.perf_counter()
+        self._sequence += 1
+        step = CREATE
+        node_id = ""
+        self.step_seconds = {}
+        try:
+            services = await self.resolve(self.cfg.tenant_id)
+            nodes = services["node"]
+            node_type_id = await self._probe_node_type(services["node_type"])
+            data = {"probe": "flexdb", "sequence": self._sequence}
+
+            node = await self._step(CREATE, nodes.create(node_type_id, json.dumps(data)))
+            node_id = node.id
+
+            step = READ
+            node = await self._step(READ, nodes.get_by_id(node_id))
+            if json.loads(node.data) != data:
+                raise ProbeError(f"read {node.data}, expected {json.dumps(data)}")
+
+            step = UPDATE
+            data["sequence"] += 1
+            updated = await self._step(UPDATE, nodes.update(node_id, json.dumps(data), node.version))
+            if json.loads(updated.data) != data or updated.version != node.version + 1:
+                raise ProbeError(f"update returned version {updated.version} with {updated.data}")
+
+            step = DELETE
+            await self._step(DELETE, nodes.delete(node_id, updated.version))
+            node_id = ""
+            try:
+                await self._step(DELETE, nodes.get_by_id(updated.id))
+            except NotFoundError:
+                pass
+            else:
+                raise ProbeError("node still readable after delete")
+        except Exception as e:
+            self._observe(FAILED, started)
+            self.step_failures[step] += 1
+            logger.error(f"Probe of tenant {self.cfg.tenant_id} failed at {step}: {str(e) or type(e).__name__}")
+            # The node type may have been deleted, which fails every probe until it is looked up again
+            self._node_type_id = ""
+            if node_id:
+                await self._clean_up(node_id)
+            return False
+
+        self._observe(SUCCEEDED, started)
+        return True
+
+    async def _step(self, step: str, call: Awaitable[Any]) -> Any:
+        started = time.perf_counter()
+        try:
+            return await asyncio.wait_for(call, timeout=self.cfg.timeout)
+        except asyncio.TimeoutError:
+            raise ProbeError(f"timed out after {self.cfg.timeout:g} seconds") from None
+        finally:
+            self.step_seconds[step] = self.step_seconds.get(step, 0.0) + time.perf_counter() - started
+
+    async def _probe_node_type(self, node_types: Any) -> str:
+        """The ID of the probe node type, created if the tenant has none."""
+        if not self._node_type_id:
+            existing = [t for t in await node_types.describe() if t.name == PROBE_NODE_TYPE]
+            if existing:
+                self._node_type_id = existing[0].id
+            else:
+                node_type = await node_types.create(PROBE_NODE_TYPE, "Synthetic probe nodes", PROBE_SCHEMA)
+                self._node_type_id = node_type.id
+        return self._node_type_id
+
+    async def _clean_up(self, node_id: str) -> None:
+        try:
+            services = await self.resolve(self.cfg.tenant_id)
+            await asyncio.wait_for(services["node"].delete(node_id), timeout=self.cfg.timeout)
+        except NotFoundError:
+            pass
+        except Exception as e:
+            logger.warning(f"Failed to delete probe node {node_id}: {e}")
+
+    def _observe(self, status: str, started: float) -> None:
+        self.runs[status] += 1
+        self.last_status = status
+        self.last_duration = time.perf_counter() - started
+        if status == SUCCEEDED:
+            self.last_success_at = datetime.now(timezone.utc)
+
+    def metric_lines(self, openmetrics: bool = False) -> List[str]:
+        """Render the probe metrics in the Prometheus or OpenMetrics text format."""
+        def family(name: str, metric_type: str, help_text: str) -> List[str]:
+            return metric_family(name, metric_type, help_text, openmetrics)
+
+        lines = family("flexdb_probes_total", "counter", "Synthetic probes by result.")
+        for result, value in sorted(self.runs.items()):
+            lines.append(f'flexdb_probes_total{{result="{result}"}} {value}')
+
+        lines += family("flexdb_probe_step_failures_total", "counter", "Failed synthetic probes by failing step.")
+        for step in STEPS:
+            lines.append(f'flexdb_probe_step_failures_total{{step="{step}"}} {self.step_failures[step]}')
+
+        lines += family(
+            "flexdb_probe_last_success_timestamp_seconds", "gauge", "Unix time the last successful probe finished."
+        )
+        success = self.last_success_at.timestamp() if self.last_success_at else 0
+        lines.append(f"flexdb_probe_last_success_timestamp_seconds {success!r}")
+
+        if self.last_status:
+            lines += family("flexdb_probe_last_status", "gauge", "Whether the last probe succeeded (1) or failed (0).")
+            lines.append(f"flexdb_probe_last_status {int(self.last_status == SUCCEEDED)}")
+            lines += family("flexdb_probe_last_duration_seconds", "gauge", "Duration of the last probe.")
+            lines.append(f"flexdb_probe_last_duration_seconds {self.last_duration!r}")
+            lines += family(
+                "flexdb_probe_step_duration_seconds", "gauge", "Duration of each step of the last probe."
+            )
+            for step in STEPS:
+                if step in self.step_seconds:
+                    lines.append(f'flexdb_probe_step_duration_seconds{{step="{step}"}} {self.step_seconds[step]!r}')
+        return lines
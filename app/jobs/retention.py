@@ -0,0 +1,155 @@
+"""
+Retention sweeps: expiry of nodes by their node type's retention policy.
+
+Every RETENTION_POLL_INTERVAL seconds, the sweeper goes through the retention
+policies of every active tenant (see app/service/retention_service.py) and
+deletes the nodes each one expired, RETENTION_BATCH_SIZE per transaction,
+as background priority jobs (see app/jobs/scheduler.py). Deletes are
+recorded, and sent as node.deleted events, like any other; relationships of
+the deleted nodes go with them. With RETENTION_DRY_RUN, sweeps only count and
+log the nodes they would delete. Each policy records its last sweep and the
+nodes it expired; totals are exported as flexdb_retention_* metrics.
+"""
+
+import asyncio
+import logging
+from datetime import datetime, timezone
+from typing import Callable, Dict, List, Optional, Tuple
+
+from app.config import JobSchedulerConfig, RetentionConfig
+from app.db.tenant_db_manager import TenantDatabaseManager
+from app.jobs.scheduler import BACKGROUND, JobScheduler
+from app.metrics.registry import metric_family
+from app.repository import NodeRepository, RetentionPolicy, RetentionPolicyRepository
+
+logger = logging.getLogger(__name__)
+
+SUCCEEDED = "succeeded"
+FAILED = "failed"
+
+
+class RetentionSweeper:
+    """Expires the nodes of all tenants by their retention policies."""
+
+    def __init__(
+        self,
+        tenant_db_manager: TenantDatabaseManager,
+        cfg: RetentionConfig,
+        leader: Optional[Callable[[], bool]] = None,
+        scheduler: Optional[JobScheduler] = None,
+    ):
+        self.tenant_db_manager = tenant_db_manager
+        self.cfg = cfg
+        # Sweeps only run while this returns True, e.g. while holding a leader role
+        self.leader = leader
+        self.scheduler = scheduler or JobScheduler(JobSchedulerConfig())
+        self._task: Optional[asyncio.Task] = None
+        self._stopping = asyncio.Event()
+        # Nodes expired by (action, dry run), tenant sweeps by result
+        self.expired: Dict[Tuple[str, bool], int] = {}
+        self.sweeps: Dict[str, int] = {SUCCEEDED: 0, FAILED: 0}
+        self.last_sweep_at: Optional[datetime] = None
+
+    def start(self) -> None:
+        """Start the sweep loop in the background."""
+        if self._task:
+            return
+        self._stopping.clear()
+        self._task = asyncio.create_task(self._run())
+
+    async def stop(self) -> None:
+        """Stop the sweep loop; expired nodes left are deleted by the next sweep."""
+        if self._task:
+            self._stopping.set()
+            await self._task
+            self._task = None
+
+    async def _run(self) -> None:
+        while not self._stopping.is_set():
+            try:
+                if self.leader is None or self.leader():
+                    await self.run_once()
+            except Exception:
+                logger.exception("Retention sweep failed")
+            try:
+                await asyncio.wait_for(self._stopping.wait(), timeout=self.cfg.poll_interval)
+            except asyncio.TimeoutError:
+                pass
+
+    async def run_once(self) -> None:
+        """Sweep every active tenant."""
+        tenant_ids = await self.tenant_db_manager.list_active_tenant_ids()
+        await asyncio.gather(*(self._sweep(tenant_id) for tenant_id in tenant_ids))
+        self.last_sweep_at = datetime.now(timezone.utc)
+
+    async def _sweep(self, tenant_id: str) -> None:
+        try:
+            await self.sweep_tenant(tenant_id)
+        except Exception:
+            self.sweeps[FAILED] += 1
+            logger.exception(f"Retention sweep failed for tenant {tenant_id}")
+        else:
+            self.sweeps[SUCCEEDED] += 1
+
+    async def sweep_tenant(self, tenant_id: str) -> int:
+        """Expire the nodes of a tenant by its retention policies; returns the number expired."""
+        tenant_db = await self.tenant_db_manager.get_tenant_db(tenant_id)
+        repo = RetentionPolicyRepository(tenant_db)
+        node_repo = NodeRepository(tenant_db)
+        expired = 0
+        for policy in await repo.list_all():
+            if self._stopping.is_set():
+                break
+            count = await self._sweep_policy(tenant_id, node_repo, policy)
+            await repo.record_sweep(policy.node_type_id, count)
+            expired += count
+        return expired
+
+    async def _sweep_policy(self, tenant_id: str, node_repo: NodeRepository, policy: RetentionPolicy) -> int:
+        count = 0
+
+        async def expire_batch() -> bool:
+            nonlocal count
+            if self._stopping.is_set():
+                return False
+            if self.cfg.dry_run:
+                expired = await node_repo.count_expired(policy)
+            else:
+                expired = await node_repo.delete_expired(policy, self.cfg.batch_size)
+            count += expired
+            key = (policy.action, self.cfg.dry_run)
+            self.expired[key] = self.expired.get(key, 0) + expired
+            return not self.cfg.dry_run and expired == self.cfg.batch_size
+
+        await self.scheduler.run(BACKGROUND, tenant_id, expire_batch)
+        if count:
+            verb = "would expire" if self.cfg.dry_run else f"expired ({policy.action})"
+            logger.info(
+                f"Retention of node type {policy.node_type_id} of tenant {tenant_id} {verb} {count} nodes"
+            )
+        return count
+
+    def metric_lines(self, openmetrics: bool = False) -> List[str]:
+        """Render the sweep metrics in the Prometheus or OpenMetrics text format."""
+        def family(name: str, metric_type: str, help_text: str) -> List[str]:
+            return metric_family(name, metric_type, help_text, openmetrics)
+
+        lines = family(
+            "flexdb_retention_expired_nodes_total", "counter",
+            "Nodes expired by retention policies, by action and whether sweeps were dry runs."
+        )
+        for (action, dry_run), value in sorted(self.expired.items()):
+            lines.append(
+                f'flexdb_retention_expired_nodes_total{{action="{action}",dry_run="{str(dry_run).lower()}"}} {value}'
+            )
+
+        lines += family("flexdb_retention_sweeps_total", "counter", "Retention sweeps of tenants by result.")
+        for result, value in sorted(self.sweeps.items()):
+            lines.append(f'flexdb_retention_sweeps_total{{result="{result}"}} {value}')
+
+        lines += family(
+            "flexdb_retention_last_sweep_timestamp_seconds", "gauge", "Unix time the last retention sweep finished."
+        )
+        last = self.last_sweep_at.timestamp() if self.last_sweep_at else 0
+        lines.append(f"flexdb_retention_last_sweep_timestamp_seconds {last!r}")
+        return lines
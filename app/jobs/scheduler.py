@@ -0,0 +1,163 @@
+"""
+Priority classes and fair scheduling of background jobs.
+
+Background jobs run per tenant in one of three priority classes, each with
+its own pool of workers, so slow low-priority work never holds up
+latency-sensitive work:
+
+    interactive  webhook deliveries and CDC publishing
+    default      node migrations
+    background   lake exports (nightly archival), retention sweeps and
+                 tenant deletions
+
+Jobs run in slices, such as one batch of events, and within a class the
+workers take turns between tenants: a tenant's next slice is queued behind
+the next slice of every other tenant with work pending. A tenant whose
+massive import left a million outbox events gets a batch delivered per
+turn, like everyone else, rather than delivering them all first.
+
+Workers are started as jobs are queued, up to the class's pool size, and exit
+when the class has no work left.
+"""
+
+import asyncio
+from collections import deque
+from dataclasses import dataclass
+from typing import Awaitable, Callable, Deque, Dict, List, Set
+
+from app.config import JobSchedulerConfig
+from app.metrics.registry import metric_family
+
+# Priority classes
+INTERACTIVE = "interactive"
+DEFAULT = "default"
+BACKGROUND = "background"
+PRIORITIES = (INTERACTIVE, DEFAULT, BACKGROUND)
+
+# A slice of a job; returns whether the job has more to do
+Step = Callable[[], Awaitable[bool]]
+
+
+@dataclass
+class _Job:
+    tenant_id: str
+    step: Step
+    future: asyncio.Future
+
+
+class _PriorityClass:
+    """The queued jobs of a priority class, by tenant, and the workers running them."""
+
+    def __init__(self, name: str, workers: int):
+        self.name = name
+        self.workers = max(1, workers)
+        self.queues: Dict[str, Deque[_Job]] = {}
+        # Tenants with queued jobs, the next one to run first; a tenant is in
+        # the ring exactly when it has a queue
+        self.ring: Deque[str] = deque()
+        self.tasks: Set[asyncio.Task] = set()
+        self.running = 0
+        self.slices = 0
+
+    def queued(self) -> int:
+        return sum(len(queue) for queue in self.queues.values())
+
+    def put(self, job: _Job) -> None:
+        queue = self.queues.get(job.tenant_id)
+        if queue is None:
+            queue = self.queues[job.tenant_id] = deque()
+            self.ring.append(job.tenant_id)
+        queue.append(job)
+        # Finished workers stay in tasks until their done callback ran
+        if sum(not task.done() for task in self.tasks) < self.workers:
+            task = asyncio.create_task(self._work())
+            self.tasks.add(task)
+            task.add_done_callback(self.tasks.discard)
+
+    def _take(self) -> _Job:
+        tenant_id = self.ring.popleft()
+        queue = self.queues[tenant_id]
+        job = queue.popleft()
+        if queue:
+            self.ring.append(tenant_id)
+        else:
+            del self.queues[tenant_id]
+        return job
+
+    async def _work(self) -> None:
+        while self.ring:
+            job = self._take()
+            if job.future.done():
+                # The caller stopped waiting
+                continue
+            self.running += 1
+            try:
+                more = await job.step()
+            except asyncio.CancelledError:
+                job.future.cancel()
+                raise
+            except Exception as e:
+                if not job.future.done():
+                    job.future.set_exception(e)
+                continue
+            finally:
+                self.running -= 1
+                self.slices += 1
+            if job.future.done():
+                continue
+            if more:
+                self.put(job)
+            else:
+                job.future.set_result(None)
+
+
+class JobScheduler:
+    """Runs background jobs in per-class worker pools, taking turns between tenants."""
+
+    def __init__(self, cfg: JobSchedulerConfig):
+        self.classes = {
+            INTERACTIVE: _PriorityClass(INTERACTIVE, cfg.interactive_workers),
+            DEFAULT: _PriorityClass(DEFAULT, cfg.default_workers),
+            BACKGROUND: _PriorityClass(BACKGROUND, cfg.background_workers),
+        }
+
+    async def run(self, priority: str, tenant_id: str, step: Step) -> None:
+        """
+        Run a tenant's job in a priority class: step runs repeatedly, each
+        time in turn with other tenants' jobs, until it returns False. Raises
+        what step raises, after which it isn't run again.
+        """
+        if priority not in self.classes:
+            raise ValueError(f"unknown job priority: {priority}")
+        future = asyncio.get_running_loop().create_future()
+        self.classes[priority].put(_Job(tenant_id, step, future))
+        await future
+
+    async def stop(self) -> None:
+        """Cancel the running jobs and drop the queued ones."""
+        for cls in self.classes.values():
+            for queue in cls.queues.values():
+                for job in queue:
+                    job.future.cancel()
+            cls.queues.clear()
+            cls.ring.clear()
+            tasks = list(cls.tasks)
+            for task in tasks:
+                task.cancel()
+            await asyncio.gather(*tasks, return_exceptions=True)
+
+    def metric_lines(self, openmetrics: bool = False) -> List[str]:
+        """Render the worker pool metrics in the Prometheus or OpenMetrics text format."""
+        def family(name: str, metric_type: str, help_text: str) -> List[str]:
+            return metric_family(name, metric_type, help_text, openmetrics)
+
+        lines = family("flexdb_jobs_queued", "gauge", "Background job slices waiting for a worker, by priority.")
+        for name, cls in self.classes.items():
+            lines.append(f'flexdb_jobs_queued{{priority="{name}"}} {cls.queued()}')
+        lines += family("flexdb_jobs_running", "gauge", "Background job slices running, by priority.")
+        for name, cls in self.classes.items():
+            lines.append(f'flexdb_jobs_running{{priority="{name}"}} {cls.running}')
+        lines += family("flexdb_job_slices_total", "counter", "Background job slices run, by priority.")
+        for name, cls in self.classes.items():
+            lines.append(f'flexdb_job_slices_total{{priority="{name}"}} {cls.slices}')
+        return lines
@@ -0,0 +1,160 @@
+"""
+Background deletion of tenants.
+
+delete_tenant marks a tenant deleting, which rejects its data-plane calls, and
+queues its deletion (see app/service/tenant_service.py). Every poll, the
+worker claims the queued deletions (or running ones abandoned by a stopped
+instance) and runs their steps in order:
+
+    relationships, nodes, node_types   rows of the tenant database
+    databases                          the tenant database and its archive snapshot
+    memberships, api_keys              the tenant's users and API keys
+    audit_events                       the tenant's audit log
+    tenant                             the tenant itself, with its quota
+
+Rows are deleted TENANT_DELETION_BATCH_SIZE per transaction, as background
+priority jobs (see app/jobs/scheduler.py). The step and the rows deleted so
+far are saved after every batch, which get_tenant_deletion_status reports.
+Every step can run again, so a deletion resumed after a crash, or after it
+failed and delete_tenant was called again, continues with the step it was in.
+"""
+
+import asyncio
+import logging
+from typing import Optional
+
+from app.config import JobSchedulerConfig, TenantDeletionConfig
+from app.db.database import Database
+from app.db.tenant_db_manager import TenantDatabaseManager
+from app.jobs.scheduler import BACKGROUND, JobScheduler
+from app.repository import TENANT_DELETION_STEPS, TenantDeletion, TenantDeletionRepository
+from app.repository.tenant_deletion_repo import delete_tenant_rows
+
+logger = logging.getLogger(__name__)
+
+# A running deletion not heard from for this long is considered abandoned
+LEASE_SECONDS = 120.0
+
+_TENANT_DATABASE_STEPS = ("relationships", "nodes", "node_types")
+_CONTROL_STEPS = ("memberships", "api_keys", "audit_events")
+
+
+class TenantDeletionWorker:
+    """Runs queued tenant deletions."""
+
+    def __init__(
+        self,
+        repo: TenantDeletionRepository,
+        tenant_db_manager: TenantDatabaseManager,
+        cfg: TenantDeletionConfig,
+        scheduler: Optional[JobScheduler] = None
+    ):
+        self.repo = repo
+        self.tenant_db_manager = tenant_db_manager
+        self.cfg = cfg
+        self.scheduler = scheduler or JobScheduler(JobSchedulerConfig())
+        self._task: Optional[asyncio.Task] = None
+        self._stopping = asyncio.Event()
+
+    def start(self) -> None:
+        """Start the worker loop in the background."""
+        if self._task:
+            return
+        self._stopping.clear()
+        self._task = asyncio.create_task(self._run())
+
+    async def stop(self) -> None:
+        """Stop the worker loop; a running deletion is resumed later."""
+        if self._task:
+            self._stopping.set()
+            await self._task
+            self._task = None
+
+    async def _run(self) -> None:
+        while not self._stopping.is_set():
+            try:
+                await self.run_once()
+            except Exception:
+                logger.exception("Tenant deletion poll failed")
+            try:
+                await asyncio.wait_for(self._stopping.wait(), timeout=self.cfg.poll_interval)
+            except asyncio.TimeoutError:
+                pass
+
+    async def run_once(self) -> None:
+        """Claim and run every queued deletion."""
+        deletions = []
+        while not self._stopping.is_set():
+            deletion = await self.repo.claim(LEASE_SECONDS)
+            if deletion is None:
+                break
+            deletions.append(deletion)
+        await asyncio.gather(*(self._delete(deletion) for deletion in deletions))
+
+    async def _delete(self, deletion: TenantDeletion) -> None:
+        try:
+            await self.run_deletion(deletion)
+        except Exception:
+            logger.exception(f"Deletion of tenant {deletion.tenant_id} failed in step {deletion.step}")
+
+    async def run_deletion(self, deletion: TenantDeletion) -> None:
+        """Run the steps of a claimed deletion, from the one it is in, until it finishes or the worker stops."""
+        if not deletion.step:
+            deletion.step = TENANT_DELETION_STEPS[0]
+        tenant_db: Optional[Database] = None
+
+        async def run_batch() -> bool:
+            nonlocal tenant_db
+            if self._stopping.is_set():
+                return False
+            try:
+                if deletion.step in _TENANT_DATABASE_STEPS and deletion.database_name and tenant_db is None:
+                    tenant_db = await self._open_tenant_db(deletion.tenant_id)
+                if await self._run_step(deletion, tenant_db):
+                    self._next_step(deletion)
+            except Exception as e:
+                deletion.status = "failed"
+                deletion.error = str(e) or e.__class__.__name__
+                await self.repo.save_progress(deletion, LEASE_SECONDS)
+                raise
+            if not await self.repo.save_progress(deletion, LEASE_SECONDS):
+                return False
+            if deletion.status != "running":
+                self.tenant_db_manager.forget_tenant_status(deletion.tenant_id)
+                logger.info(f"Deleted tenant {deletion.tenant_id} ({deletion.slug}): {deletion.progress}")
+                return False
+            return True
+
+        await self.scheduler.run(BACKGROUND, deletion.tenant_id, run_batch)
+
+    async def _open_tenant_db(self, tenant_id: str) -> Database:
+        # Archived tenant databases are read-only
+        await self.tenant_db_manager.set_tenant_read_only(tenant_id, False)
+        return await self.tenant_db_manager.get_tenant_db(tenant_id)
+
+    async def _run_step(self, deletion: TenantDeletion, tenant_db: Optional[Database]) -> bool:
+        """Run one batch of the deletion's step; returns whether the step is done."""
+        step = deletion.step
+        if step in _TENANT_DATABASE_STEPS:
+            if tenant_db is None:
+                return True
+            deleted = await delete_tenant_rows(tenant_db, step, self.cfg.batch_size)
+        elif step == "databases":
+            await self.tenant_db_manager.drop_tenant_databases(
+                deletion.tenant_id, [deletion.database_name, deletion.archive_database]
+            )
+            return True
+        elif step in _CONTROL_STEPS:
+            deleted = await self.repo.delete_control_rows(deletion.tenant_id, step, self.cfg.batch_size)
+        else:
+            deletion.progress[step] = await self.repo.delete_tenant(deletion.tenant_id)
+            return True
+        deletion.progress[step] = deletion.progress.get(step, 0) + deleted
+        return deleted < self.cfg.batch_size
+
+    def _next_step(self, deletion: TenantDeletion) -> None:
+        index = TENANT_DELETION_STEPS.index(deletion.step) + 1
+        if index < len(TENANT_DELETION_STEPS):
+            deletion.step = TENANT_DELETION_STEPS[index]
+        else:
+            deletion.status = "succeeded"
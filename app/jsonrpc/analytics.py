@@ -0,0 +1,197 @@
+"""
+JSON-RPC handlers for the read-only analytics endpoint.
+
+The analytics methods are served at /analytics/jsonrpc, separately from the
+main API, and run exclusively against read replicas (see
+ReplicaDatabaseManager) with a much larger page size limit for BI extracts.
+Results may lag the primary by the replication delay.
+"""
+
+from typing import Any, Dict, List, Optional
+from jsonrpcserver import Result, Success
+
+from app.api.dependencies import check_tenant_available
+from app.config import AnalyticsConfig
+from app.db.replica_manager import ReplicaDatabaseManager
+from app.encryption import current_kms
+from app.repository import (
+    MAX_PAGE_SIZE,
+    DataKeyRepository,
+    NodeRepository,
+    NodeTypeRepository,
+    RelationshipRepository,
+)
+from app.service import NodeService, NodeTypeService, RelationshipService
+from app.service.encryption import FieldEncryption
+from app.service.display import parse_display
+from app.service.schema import parse_schema
+from app.jsonrpc.handlers import _any_of, _handle_error
+
+# Analytics method names are prefixed so metrics keep them apart from the main API
+ANALYTICS_METHOD_PREFIX = "analytics."
+
+# Replica routing (set by main.py when the analytics endpoint is enabled)
+_replica_manager: Optional[ReplicaDatabaseManager] = None
+_max_page_size = MAX_PAGE_SIZE
+
+
+def set_replica_manager(manager: Optional[ReplicaDatabaseManager], cfg: AnalyticsConfig) -> None:
+    """Set the replica database manager used by analytics methods (None disables them)."""
+    global _replica_manager, _max_page_size
+    _replica_manager = manager
+    _max_page_size = cfg.max_page_size
+
+
+def analytics_enabled() -> bool:
+    """Return whether the analytics endpoint is configured."""
+    return _replica_manager is not None
+
+
+async def _resolve_replica_services(tenant_id: str) -> dict:
+    """Create read-only services on the tenant's replica database."""
+    if _replica_manager is None:
+        raise ValueError("analytics endpoint is not enabled")
+    await check_tenant_available(tenant_id)
+    replica_db = await _replica_manager.get_tenant_db(tenant_id)
+
+    node_type_repo = NodeTypeRepository(replica_db, _max_page_size)
+    node_repo = NodeRepository(replica_db, _max_page_size)
+    relationship_repo = RelationshipRepository(replica_db, _max_page_size)
+    return {
+        "node_type": NodeTypeService(node_type_repo),
+        "node": NodeService(
+            node_repo, node_type_repo, FieldEncryption(current_kms(), DataKeyRepository(replica_db), tenant_id)
+        ),
+        "relationship": RelationshipService(relationship_repo, node_repo),
+    }
+
+
+def _page(pagination: Optional[Dict[str, Any]]) -> tuple:
+    if not pagination:
+        return 10, ""
+    return pagination.get("page_size", 10), pagination.get("page_token", "")
+
+
+async def list_node_types(tenant_id: str, pagination: Dict[str, Any] = None) -> Result:
+    """List node types for a tenant from the replica."""
+    try:
+        page_size, page_token = _page(pagination)
+        services = await _resolve_replica_services(tenant_id)
+        node_types, result = await services["node_type"].list(page_size, page_token)
+        return Success({
+            "node_types": [nt.to_dict() for nt in node_types],
+            "pagination": result.to_dict(),
+        })
+    except Exception as e:
+        return _handle_error(e)
+
+
+async def describe_tenant_schema(tenant_id: str) -> Result:
+    """Describe all node types of a tenant from the replica."""
+    try:
+        services = await _resolve_replica_services(tenant_id)
+        node_types = await services["node_type"].describe()
+        return Success({
+            "node_types": [
+                dict(
+                    nt.to_dict(),
+                    fields=[spec.to_dict() for spec in parse_schema(nt.schema).values()],
+                    display=parse_display(nt.display),
+                )
+                for nt in node_types
+            ],
+        })
+    except Exception as e:
+        return _handle_error(e)
+
+
+async def list_nodes(
+    tenant_id: str,
+    node_type_id: str = "",
+    pagination: Dict[str, Any] = None,
+    geo: Dict[str, Any] = None,
+    locale: str = ""
+) -> Result:
+    """List nodes for a tenant from the replica with optional filtering."""
+    try:
+        page_size, page_token = _page(pagination)
+        services = await _resolve_replica_services(tenant_id)
+        nodes, result = await services["node"].list(
+            node_type_id or None, page_size, page_token, geo, locale
+        )
+        return Success({
+            "nodes": [n.to_dict() for n in nodes],
+            "pagination": result.to_dict(),
+        })
+    except Exception as e:
+        return _handle_error(e)
+
+
+async def count_nodes(
+    tenant_id: str,
+    node_type_id: str = "",
+    filter: Dict[str, Any] = None,
+    contains: Dict[str, Any] = None
+) -> Result:
+    """Count nodes on the replica, optionally of a node type and matching filter and contains."""
+    try:
+        services = await _resolve_replica_services(tenant_id)
+        return Success({"count": await services["node"].count(node_type_id or None, filter, contains)})
+    except Exception as e:
+        return _handle_error(e)
+
+
+async def aggregate_nodes(
+    tenant_id: str,
+    aggregation: Dict[str, Any],
+    node_type_id: str = "",
+    filter: Dict[str, Any] = None,
+    contains: Dict[str, Any] = None
+) -> Result:
+    """Compute bucketed aggregations over node data fields on the replica."""
+    try:
+        services = await _resolve_replica_services(tenant_id)
+        buckets = await services["node"].aggregate(node_type_id or None, aggregation, filter, contains)
+        return Success({"buckets": [b.to_dict() for b in buckets]})
+    except Exception as e:
+        return _handle_error(e)
+
+
+async def list_relationships(
+    tenant_id: str,
+    source_node_id: str = "",
+    target_node_id: str = "",
+    relationship_type: str = "",
+    pagination: Dict[str, Any] = None,
+    source_node_ids: List[str] = None,
+    target_node_ids: List[str] = None,
+    relationship_types: List[str] = None
+) -> Result:
+    """
+    List relationships for a tenant from the replica with optional filtering,
+    by one value or lists of values as in list_relationships.
+    """
+    try:
+        page_size, page_token = _page(pagination)
+        services = await _resolve_replica_services(tenant_id)
+        rels, result = await services["relationship"].list(
+            _any_of(source_node_id, source_node_ids),
+            _any_of(target_node_id, target_node_ids),
+            _any_of(relationship_type, relationship_types),
+            page_size,
+            page_token
+        )
+        return Success({
+            "relationships": [r.to_dict() for r in rels],
+            "pagination": result.to_dict(),
+        })
+    except Exception as e:
+        return _handle_error(e)
+
+
+analytics_methods = {
+    ANALYTICS_METHOD_PREFIX + func.__name__: func
+    for func in (
+        list_node_types, describe_tenant_schema, list_nodes, count_nodes, aggregate_nodes, list_relationships
+    )
+}
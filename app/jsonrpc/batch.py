@@ -0,0 +1,95 @@
+"""
+Batched reads: several read requests of a tenant in one call.
+
+    {"method": "batch", "params": {"tenant_id": "...", "requests": [
+        {"id": "page", "method": "get_node", "params": {"id": "..."}},
+        {"id": "type", "method": "get_node_type", "params": {"id": "..."}},
+        {"id": "links", "method": "list_relationships", "params": {"source_node_id": "..."}}
+    ]}}
+
+The requests run concurrently, each through the whole method chain as if it
+were called on its own: scope authorization, rate limits, metrics and plugin
+interceptors apply to every request. Their params default to the batch's
+tenant_id. The result lists a response per request, in request order, with
+the request's id (its index if it has none) and its result or error:
+
+    {"responses": [{"id": "page", "result": {"node": {...}}},
+                   {"id": "type", "error": {"code": -32001, "message": "..."}}, ...]}
+
+A request failing does not fail the others. Only the read methods in
+BATCH_METHODS can be batched.
+"""
+
+import asyncio
+import json
+from typing import Any, Awaitable, Callable, Dict, List, Optional
+
+from jsonrpcserver import Result, Success, method
+
+from app.jsonrpc.handlers import _handle_error
+from app.repository.errors import ValidationError
+
+BATCH_METHODS = frozenset({
+    "get_node",
+    "get_node_type",
+    "get_relationship",
+    "list_node_types",
+    "list_nodes",
+    "count_nodes",
+    "list_relationships",
+})
+MAX_BATCH_REQUESTS = 50
+
+# Dispatches a JSON-RPC request through the method chain (set by app/jsonrpc/server.py)
+_dispatch: Optional[Callable[[str], Awaitable[Optional[str]]]] = None
+
+
+def set_batch_dispatcher(dispatch: Callable[[str], Awaitable[Optional[str]]]) -> None:
+    """Set the function dispatching the requests of a batch."""
+    global _dispatch
+    _dispatch = dispatch
+
+
+def _validate(tenant_id: str, requests: Any) -> List[Dict[str, Any]]:
+    """Return the JSON-RPC requests of a batch, with the batch's tenant_id in their params."""
+    if not tenant_id:
+        raise ValidationError("tenant_id", "is required")
+    if not isinstance(requests, list) or not requests:
+        raise ValidationError("requests", "must be a non-empty list")
+    if len(requests) > MAX_BATCH_REQUESTS:
+        raise ValueError(f"a batch holds at most {MAX_BATCH_REQUESTS} requests")
+
+    calls = []
+    for i, request in enumerate(requests):
+        if not isinstance(request, dict):
+            raise ValueError(f"requests[{i}] must be an object")
+        name = request.get("method")
+        if name not in BATCH_METHODS:
+            raise ValueError(f"requests[{i}].method must be one of: {', '.join(sorted(BATCH_METHODS))}")
+        params = request.get("params") or {}
+        if not isinstance(params, dict):
+            raise ValueError(f"requests[{i}].params must be an object")
+        if params.setdefault("tenant_id", tenant_id) != tenant_id:
+            raise ValueError(f"requests[{i}] names another tenant than the batch")
+        request_id = request.get("id")
+        calls.append({"jsonrpc": "2.0", "method": name, "params": params, "id": i if request_id is None else request_id})
+    return calls
+
+
+async def _run(call: Dict[str, Any]) -> Dict[str, Any]:
+    response = json.loads(await _dispatch(json.dumps(call)))
+    response.pop("jsonrpc", None)
+    return response
+
+
+@method
+async def batch(tenant_id: str, requests: List[Dict[str, Any]]) -> Result:
+    """Run read requests of a tenant concurrently and return their responses in order."""
+    try:
+        calls = _validate(tenant_id, requests)
+        if _dispatch is None:
+            raise ValueError("batching is not available")
+        responses = await asyncio.gather(*(_run(call) for call in calls))
+        return Success({"responses": list(responses)})
+    except Exception as e:
+        return _handle_error(e)
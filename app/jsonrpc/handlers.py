@@ -2,50 +2,186 @@
 JSON-RPC handlers for all services.
 """
 
+from datetime import datetime, timezone
 from typing import Any, Dict, List, Optional
+
+import asyncpg
 from jsonrpcserver import method, Result, Success, Error
 
+from app.auth.authorization import (
+    API_KEY,
+    PERMISSION_DENIED_CODE,
+    PermissionDeniedError,
+    current_principal,
+    node_type_restriction,
+    visible_relationships,
+)
+from app.db.explain import plan_capture
+from app.events import schemas as event_schemas
+from app.metrics import result_code
+from app.quotas import RESOURCE_EXHAUSTED_CODE, effective_limits
+from app.repository import BULK_DELETE, AuditEvent, BulkJob, Node, NodeRevision, Relationship, Tenant
 from app.service import (
+    ApiKeyService,
+    AuditService,
+    ClusterService,
     TenantService,
+    TenantTemplateService,
     UserService,
 )
-from app.repository.errors import NotFoundError
+from app.repository.errors import (
+    INTERNAL,
+    INVALID_ARGUMENT,
+    ConflictError,
+    FailedPreconditionError,
+    NotFoundError,
+    QuotaExceededError,
+    ValidationError,
+    error_details,
+)
+from app.service.display import parse_display
+from app.service.field_mask import FieldMask, parse_field_mask
+from app.service.webhook_service import delivery_log
+from app.service.operation_service import bulk_job_operation, migration_operation
+from app.service.schema import parse_schema
 from app.api.dependencies import resolve_tenant_services
 
+# Calls rejected by the state of a resource, such as a suspended or archived tenant
+FAILED_PRECONDITION_CODE = -32005
+
 # Global service instances (to be set by register_methods)
 _tenant_service: Optional[TenantService] = None
 _user_service: Optional[UserService] = None
+_api_key_service: Optional[ApiKeyService] = None
+_audit_service: Optional[AuditService] = None
+_cluster_service: Optional[ClusterService] = None
+_template_service = TenantTemplateService()
 
 
 def register_methods(
     tenant_svc: TenantService,
     user_svc: UserService,
+    api_key_svc: Optional[ApiKeyService] = None,
+    audit_svc: Optional[AuditService] = None,
+    cluster_svc: Optional[ClusterService] = None,
+    template_svc: Optional[TenantTemplateService] = None,
 ) -> None:
     """Register service instances for use by JSON-RPC methods."""
-    global _tenant_service, _user_service
+    global _tenant_service, _user_service, _api_key_service, _audit_service, _cluster_service, _template_service
     _tenant_service = tenant_svc
     _user_service = user_svc
+    _api_key_service = api_key_svc
+    _audit_service = audit_svc
+    _cluster_service = cluster_svc
+    _template_service = template_svc or TenantTemplateService()
+
+
+def _dry_run_result(result: Dict[str, Any], dry_run: bool) -> Dict[str, Any]:
+    """Mark the result of a dry run ("dry_run": true); other results are unchanged."""
+    return {**result, "dry_run": True} if dry_run else result
+
+
+def _bulk_delete_result(job: BulkJob) -> Dict[str, Any]:
+    """Result of a bulk delete, also if it was cancelled partway."""
+    return {
+        "deleted_count": job.processed,
+        "dry_run": False,
+        "cancelled": job.status == "cancelled",
+        "operation": bulk_job_operation(job).to_dict(),
+    }
+
+
+def _storage_export_result(job: BulkJob) -> Dict[str, Any]:
+    """Result of an export to object storage, also if it was cancelled partway."""
+    return {
+        "url": job.progress.get("url", ""),
+        "records": job.processed,
+        "bytes": job.progress.get("bytes", 0),
+        "parts": len(job.progress.get("parts", [])),
+        "cancelled": job.status == "cancelled",
+        "operation": bulk_job_operation(job).to_dict(),
+    }
+
+
+def _masked(resource: Dict[str, Any], mask: Optional[FieldMask]) -> Dict[str, Any]:
+    """A resource's dictionary with only the fields of a field mask, if one was given."""
+    return mask.apply(resource) if mask else resource
+
+
+def _any_of(value: str, values: Optional[List[str]]) -> List[str]:
+    """Return the values a list filter matches, given as one value, a list of them, or both."""
+    return ([value] if value else []) + list(values or [])
+
+
+def _revision_summary(revision: NodeRevision) -> Dict[str, Any]:
+    """A revision's fields without its data, for diffs."""
+    summary = revision.to_dict()
+    del summary["data"]
+    return summary
+
+
+# Reason of writes to the read-only database of an archived tenant
+TENANT_READ_ONLY = "TENANT_READ_ONLY"
 
 
 def _handle_error(err: Exception) -> Error:
-    """Convert exception to JSON-RPC error."""
+    """Convert exception to JSON-RPC error, with its google.rpc status details in data.details."""
     if isinstance(err, NotFoundError):
-        return Error(-32001, str(err))
+        return _detailed_error(-32001, err)
+    if isinstance(err, ConflictError):
+        return _detailed_error(-32003, err)
+    if isinstance(err, FailedPreconditionError):
+        return _detailed_error(FAILED_PRECONDITION_CODE, err)
+    if isinstance(err, PermissionDeniedError):
+        return _detailed_error(PERMISSION_DENIED_CODE, err)
+    if isinstance(err, QuotaExceededError):
+        data = {"limit": err.limit, "retry_after": round(err.retry_after, 3), "details": error_details(err)}
+        return Error(RESOURCE_EXHAUSTED_CODE, str(err), data)
+    if isinstance(err, asyncpg.exceptions.ReadOnlySQLTransactionError):
+        # Archived tenant databases are read-only
+        data = {"details": error_details(err, TENANT_READ_ONLY)}
+        return Error(FAILED_PRECONDITION_CODE, "tenant is archived and read-only", data)
     if isinstance(err, ValueError):
-        return Error(-32602, str(err))
-    return Error(-32603, str(err))
+        return _detailed_error(-32602, err, INVALID_ARGUMENT)
+    return _detailed_error(-32603, err, INTERNAL)
+
+
+def _detailed_error(code: int, err: Exception, reason: Optional[str] = None) -> Error:
+    return Error(code, str(err), {"details": error_details(err, reason)})
 
 
 # ============================================================================
 # Tenant Service Methods
 # ============================================================================
 
+async def _bootstrap(tenant_id: str, template: str) -> Dict[str, Any]:
+    """Apply a tenant template to a tenant, returning the bootstrap result."""
+    services = await resolve_tenant_services(tenant_id)
+    created, existing, relationship_types = await _template_service.bootstrap(template, services["node_type"])
+    return {
+        "template": template,
+        "created_node_types": [t.to_dict() for t in created],
+        "existing_node_types": [t.to_dict() for t in existing],
+        "relationship_types": relationship_types,
+    }
+
+
 @method
-async def create_tenant(slug: str, name: str) -> Result:
-    """Create a new tenant."""
+async def create_tenant(slug: str, name: str, template: str = "") -> Result:
+    """Create a new tenant, bootstrapped with a tenant template if one is given."""
     try:
+        if template:
+            # Unknown templates fail before the tenant is created
+            _template_service.get(template)
         tenant = await _tenant_service.create(slug, name)
-        return Success({"tenant": tenant.to_dict()})
+        if not template:
+            return Success({"tenant": tenant.to_dict()})
+        try:
+            bootstrap = await _bootstrap(tenant.id, template)
+        except Exception as e:
+            # The tenant exists: bootstrap_tenant completes the bootstrap
+            return Error(-32603, f"tenant {tenant.id} was created, but bootstrapping it failed: {e}")
+        return Success({"tenant": tenant.to_dict(), "bootstrap": bootstrap})
     except Exception as e:
         return _handle_error(e)
 
@@ -60,6 +196,16 @@ async def get_tenant(id: str) -> Result:
         return _handle_error(e)
 
 
+@method
+async def get_tenant_by_slug(slug: str) -> Result:
+    """Get a tenant by its slug, or a slug it was renamed from."""
+    try:
+        tenant, former = await _tenant_service.get_by_slug(slug)
+        return Success({"tenant": tenant.to_dict(), "former_slug": former})
+    except Exception as e:
+        return _handle_error(e)
+
+
 @method
 async def update_tenant(id: str, slug: str = "", name: str = "", status: str = "") -> Result:
     """Update an existing tenant."""
@@ -70,12 +216,134 @@ async def update_tenant(id: str, slug: str = "", name: str = "", status: str = "
         return _handle_error(e)
 
 
+@method
+async def rename_tenant_slug(id: str, slug: str) -> Result:
+    """Change a tenant's slug, recording the change."""
+    try:
+        tenant = await _tenant_service.rename_slug(id, slug)
+        return Success({"tenant": tenant.to_dict()})
+    except Exception as e:
+        return _handle_error(e)
+
+
+@method
+async def list_tenant_slug_changes(id: str) -> Result:
+    """List the slug changes of a tenant, oldest first."""
+    try:
+        changes = await _tenant_service.list_slug_changes(id)
+        return Success({"changes": [c.to_dict() for c in changes]})
+    except Exception as e:
+        return _handle_error(e)
+
+
+async def _record_lifecycle_event(event_type: str, tenant: Tenant) -> None:
+    """Record a tenant status change, with its reason, in the audit log."""
+    if _audit_service is None:
+        return
+    principal = current_principal()
+    await _audit_service.record(AuditEvent(
+        tenant_id=tenant.id,
+        event_type=event_type,
+        api_key_id=principal.api_key.id if principal.kind == API_KEY and principal.api_key else "",
+        details={"status": tenant.status, "reason": tenant.status_reason},
+    ))
+
+
+@method
+async def suspend_tenant(id: str, reason: str = "") -> Result:
+    """Suspend a tenant: its data-plane calls fail until it is reactivated."""
+    try:
+        tenant = await _tenant_service.suspend(id, reason)
+        await _record_lifecycle_event("tenant.suspended", tenant)
+        return Success({"tenant": tenant.to_dict()})
+    except Exception as e:
+        return _handle_error(e)
+
+
+@method
+async def archive_tenant(id: str, reason: str = "") -> Result:
+    """Archive a tenant: its database is snapshotted, then made read-only."""
+    try:
+        tenant = await _tenant_service.archive(id, reason)
+        await _record_lifecycle_event("tenant.archived", tenant)
+        return Success({"tenant": tenant.to_dict()})
+    except Exception as e:
+        return _handle_error(e)
+
+
+@method
+async def reactivate_tenant(id: str, reason: str = "") -> Result:
+    """Reactivate a suspended or archived tenant."""
+    try:
+        tenant = await _tenant_service.reactivate(id, reason)
+        await _record_lifecycle_event("tenant.reactivated", tenant)
+        return Success({"tenant": tenant.to_dict()})
+    except Exception as e:
+        return _handle_error(e)
+
+
+def _quota_result(quota) -> dict:
+    limits = effective_limits(quota)
+    return {"quota": quota.to_dict(), "effective": limits.to_dict() if limits else None}
+
+
+@method
+async def get_tenant_quota(id: str) -> Result:
+    """Get a tenant's request rate quota and the limits enforced for it (None while rate limiting is disabled)."""
+    try:
+        quota = await _tenant_service.get_quota(id)
+        return Success(_quota_result(quota))
+    except Exception as e:
+        return _handle_error(e)
+
+
+@method
+async def set_tenant_quota(
+    id: str,
+    requests_per_second: Optional[float] = None,
+    burst: Optional[int] = None,
+    api_key_requests_per_second: Optional[float] = None,
+    api_key_burst: Optional[int] = None,
+) -> Result:
+    """Replace a tenant's request rate quota; omitted limits fall back to the server defaults."""
+    try:
+        quota = await _tenant_service.set_quota(
+            id, requests_per_second, burst, api_key_requests_per_second, api_key_burst
+        )
+        return Success(_quota_result(quota))
+    except Exception as e:
+        return _handle_error(e)
+
+
 @method
 async def delete_tenant(id: str) -> Result:
-    """Delete a tenant."""
+    """
+    Delete a tenant. Where the deletion runs in the background, its status is
+    returned; calling this again resumes a failed deletion.
+    """
     try:
-        await _tenant_service.delete(id)
-        return Success({})
+        deletion = await _tenant_service.delete(id)
+        if deletion is None:
+            return Success({})
+        if _audit_service is not None:
+            principal = current_principal()
+            # Not attributed to the tenant, so it outlives the tenant's audit log
+            await _audit_service.record(AuditEvent(
+                event_type="tenant.deletion_started",
+                api_key_id=principal.api_key.id if principal.kind == API_KEY and principal.api_key else "",
+                details={"tenant_id": deletion.tenant_id, "slug": deletion.slug},
+            ))
+        return Success({"deletion": deletion.to_dict()})
+    except Exception as e:
+        return _handle_error(e)
+
+
+@method
+async def get_tenant_deletion_status(tenant_id: str) -> Result:
+    """Get the status of a tenant's deletion: its step and the rows deleted so far."""
+    try:
+        deletion = await _tenant_service.deletion_status(tenant_id)
+        return Success({"deletion": deletion.to_dict()})
     except Exception as e:
         return _handle_error(e)
 
@@ -99,6 +367,33 @@ async def list_tenants(pagination: Dict[str, Any] = None) -> Result:
         return _handle_error(e)
 
 
+@method
+async def list_tenant_templates() -> Result:
+    """List the tenant templates, by name."""
+    try:
+        return Success({"templates": [t.to_dict() for t in _template_service.list()]})
+    except Exception as e:
+        return _handle_error(e)
+
+
+@method
+async def get_tenant_template(name: str) -> Result:
+    """Get a tenant template with its node types and relationship types."""
+    try:
+        return Success({"template": _template_service.get(name).to_dict()})
+    except Exception as e:
+        return _handle_error(e)
+
+
+@method
+async def bootstrap_tenant(tenant_id: str, template: str) -> Result:
+    """Create the node types of a tenant template that a tenant doesn't have yet."""
+    try:
+        return Success(await _bootstrap(tenant_id, template))
+    except Exception as e:
+        return _handle_error(e)
+
+
 # ============================================================================
 # User Service Methods
 # ============================================================================
@@ -162,6 +457,35 @@ async def list_users(pagination: Dict[str, Any] = None) -> Result:
         return _handle_error(e)
 
 
+@method
+async def set_user_password(id: str, password: str) -> Result:
+    """Set a user's password, with which they can log in."""
+    try:
+        await _user_service.set_password(id, password)
+        return Success({})
+    except Exception as e:
+        return _handle_error(e)
+
+
+@method
+async def login(email: str, password: str) -> Result:
+    """
+    Log a user in with their email address and password. Returns a token to
+    send as "Authorization: Bearer <token>" until expires_at (Unix seconds),
+    with the user and the tenants they are an active member of.
+    """
+    try:
+        token, expires_at, user, memberships = await _user_service.login(email, password)
+        return Success({
+            "token": token,
+            "expires_at": expires_at,
+            "user": user.to_dict(),
+            "memberships": [m.to_dict() for m in memberships],
+        })
+    except Exception as e:
+        return _handle_error(e)
+
+
 @method
 async def add_user_to_tenant(tenant_id: str, user_id: str, role: str = "") -> Result:
     """Add a user to a tenant."""
@@ -202,124 +526,232 @@ async def list_tenant_users(tenant_id: str, pagination: Dict[str, Any] = None) -
 
 
 # ============================================================================
-# NodeType Service Methods
+# API Key Service Methods
 # ============================================================================
 
 @method
-async def create_node_type(tenant_id: str, name: str, description: str = "", schema: str = "") -> Result:
-    """Create a new node type."""
+async def create_api_key(
+    tenant_id: str,
+    name: str,
+    scopes: List[str],
+    node_type_ids: List[str] = None,
+    expires_at: str = ""
+) -> Result:
+    """
+    Create an API key for a tenant.
+
+    scopes is any of admin, read, nodes:read and nodes:write. node_type_ids
+    restricts a key with only nodes:* scopes to nodes of those types.
+    expires_at is an optional ISO 8601 expiry time. The key is returned only
+    once.
+    """
+    try:
+        api_key, key = await _api_key_service.create(tenant_id, name, scopes, node_type_ids, expires_at)
+        return Success({"api_key": api_key.to_dict(), "key": key})
+    except Exception as e:
+        return _handle_error(e)
+
+
+@method
+async def rotate_api_key(id: str, tenant_id: str, grace_period: int = 0) -> Result:
+    """
+    Replace an API key with a new one with the same scopes.
+
+    The old key is revoked, or keeps working for grace_period seconds. The
+    new key is returned only once.
+    """
     try:
-        services = await resolve_tenant_services(tenant_id)
-        node_type = await services["node_type"].create(name, description, schema)
-        return Success({"node_type": node_type.to_dict()})
+        api_key, key, previous = await _api_key_service.rotate(tenant_id, id, grace_period)
+        return Success({"api_key": api_key.to_dict(), "key": key, "previous_api_key": previous.to_dict()})
     except Exception as e:
         return _handle_error(e)
 
 
 @method
-async def get_node_type(id: str, tenant_id: str) -> Result:
-    """Get a node type by ID."""
+async def get_api_key(id: str, tenant_id: str) -> Result:
+    """Get an API key by ID; the key itself is not returned."""
     try:
-        services = await resolve_tenant_services(tenant_id)
-        node_type = await services["node_type"].get_by_id(id)
-        return Success({"node_type": node_type.to_dict()})
+        api_key = await _api_key_service.get_by_id(tenant_id, id)
+        return Success({"api_key": api_key.to_dict()})
     except Exception as e:
         return _handle_error(e)
 
 
 @method
-async def update_node_type(id: str, tenant_id: str, name: str = "", description: str = "", schema: str = "") -> Result:
-    """Update an existing node type."""
+async def list_api_keys(tenant_id: str, pagination: Dict[str, Any] = None) -> Result:
+    """List API keys of a tenant, including revoked ones."""
     try:
-        services = await resolve_tenant_services(tenant_id)
-        node_type = await services["node_type"].update(id, name, description, schema)
-        return Success({"node_type": node_type.to_dict()})
+        page_size = 10
+        page_token = ""
+        if pagination:
+            page_size = pagination.get("page_size", 10)
+            page_token = pagination.get("page_token", "")
+
+        api_keys, result = await _api_key_service.list(tenant_id, page_size, page_token)
+        return Success({
+            "api_keys": [k.to_dict() for k in api_keys],
+            "pagination": result.to_dict(),
+        })
     except Exception as e:
         return _handle_error(e)
 
 
 @method
-async def delete_node_type(id: str, tenant_id: str) -> Result:
-    """Delete a node type."""
+async def revoke_api_key(id: str, tenant_id: str) -> Result:
+    """Revoke an API key; requests using it are rejected from then on."""
     try:
-        services = await resolve_tenant_services(tenant_id)
-        await services["node_type"].delete(id)
-        return Success({})
+        api_key = await _api_key_service.revoke(tenant_id, id)
+        return Success({"api_key": api_key.to_dict()})
     except Exception as e:
         return _handle_error(e)
 
 
 @method
-async def list_node_types(tenant_id: str, pagination: Dict[str, Any] = None) -> Result:
-    """List node types for a tenant."""
+async def list_audit_events(
+    tenant_id: str = "",
+    event_type: str = "",
+    pagination: Dict[str, Any] = None
+) -> Result:
+    """
+    List security events from the audit log, newest first.
+
+    Without tenant_id, events of all tenants and those not attributable to a
+    tenant are listed (admin key only). event_type filters by type, e.g.
+    security.lockout.
+    """
     try:
         page_size = 10
         page_token = ""
         if pagination:
             page_size = pagination.get("page_size", 10)
             page_token = pagination.get("page_token", "")
-        
-        services = await resolve_tenant_services(tenant_id)
-        node_types, result = await services["node_type"].list(page_size, page_token)
+
+        events, result = await _audit_service.list(tenant_id, event_type, page_size, page_token)
         return Success({
-            "node_types": [nt.to_dict() for nt in node_types],
+            "audit_events": [e.to_dict() for e in events],
             "pagination": result.to_dict(),
         })
     except Exception as e:
         return _handle_error(e)
 
 
+@method
+async def get_cluster_status() -> Result:
+    """
+    Get the server instances sharing the control database, live or stale,
+    with the leader roles (background jobs run by one instance) each holds.
+    """
+    try:
+        if _cluster_service is None:
+            raise FailedPreconditionError("cluster status is not available")
+        return Success(await _cluster_service.status(datetime.now(timezone.utc)))
+    except Exception as e:
+        return _handle_error(e)
+
+
 # ============================================================================
-# Node Service Methods
+# NodeType Service Methods
 # ============================================================================
 
 @method
-async def create_node(tenant_id: str, node_type_id: str, data: str = "{}") -> Result:
-    """Create a new node."""
+async def create_node_type(
+    tenant_id: str,
+    name: str,
+    description: str = "",
+    schema: str = "",
+    display: str = "",
+    unique_keys: List[Any] = None,
+    dry_run: bool = False
+) -> Result:
+    """
+    Create a new node type. unique_keys lists data fields, or arrays of fields, whose
+    values must be unique among its nodes; duplicates fail with a conflict. dry_run
+    validates it and returns it without saving it.
+    """
     try:
         services = await resolve_tenant_services(tenant_id)
-        node = await services["node"].create(node_type_id, data)
-        return Success({"node": node.to_dict()})
+        node_type = await services["node_type"].create(name, description, schema, display, unique_keys, dry_run)
+        return Success(_dry_run_result({"node_type": node_type.to_dict()}, dry_run))
     except Exception as e:
         return _handle_error(e)
 
 
 @method
-async def get_node(id: str, tenant_id: str) -> Result:
-    """Get a node by ID."""
+async def get_node_type(id: str, tenant_id: str) -> Result:
+    """Get a node type by ID."""
     try:
         services = await resolve_tenant_services(tenant_id)
-        node = await services["node"].get_by_id(id)
-        return Success({"node": node.to_dict()})
+        node_type = await services["node_type"].get_by_id(id)
+        return Success({"node_type": node_type.to_dict()})
     except Exception as e:
         return _handle_error(e)
 
 
 @method
-async def update_node(id: str, tenant_id: str, data: str = "") -> Result:
-    """Update an existing node."""
+async def batch_get_node_types(tenant_id: str, ids: List[str]) -> Result:
+    """Get up to 500 node types by ID; IDs without a node type are listed as missing."""
     try:
         services = await resolve_tenant_services(tenant_id)
-        node = await services["node"].update(id, data)
-        return Success({"node": node.to_dict()})
+        node_types, missing = await services["node_type"].batch_get(ids)
+        return Success({"node_types": [node_type.to_dict() for node_type in node_types], "missing": missing})
     except Exception as e:
         return _handle_error(e)
 
 
 @method
-async def delete_node(id: str, tenant_id: str) -> Result:
-    """Delete a node."""
+async def update_node_type(
+    id: str,
+    tenant_id: str,
+    name: str = "",
+    description: str = "",
+    schema: str = "",
+    expected_version: int = 0,
+    display: str = "",
+    if_match: str = "",
+    dry_run: bool = False
+) -> Result:
+    """
+    Update an existing node type. A non-zero expected_version, or the etag of
+    a fetched node type as if_match, fails with a conflict if it is stale.
+    dry_run validates the update and returns the result without saving it.
+    """
     try:
         services = await resolve_tenant_services(tenant_id)
-        await services["node"].delete(id)
-        return Success({})
+        node_type = await services["node_type"].update(
+            id, name, description, schema, expected_version or None, display, if_match, dry_run
+        )
+        return Success(_dry_run_result({"node_type": node_type.to_dict()}, dry_run))
     except Exception as e:
         return _handle_error(e)
 
 
 @method
-async def list_nodes(tenant_id: str, node_type_id: str = "", pagination: Dict[str, Any] = None) -> Result:
-    """List nodes for a tenant with optional filtering."""
+async def delete_node_type(
+    id: str,
+    tenant_id: str,
+    expected_version: int = 0,
+    if_match: str = "",
+    dry_run: bool = False
+) -> Result:
+    """
+    Delete a node type. A non-zero expected_version, or the etag of a fetched
+    node type as if_match, fails with a conflict if it is stale. dry_run only
+    checks that it could be deleted.
+    """
+    try:
+        services = await resolve_tenant_services(tenant_id)
+        await services["node_type"].delete(id, expected_version or None, if_match, dry_run)
+        return Success(_dry_run_result({}, dry_run))
+    except Exception as e:
+        return _handle_error(e)
+
+
+@method
+async def list_node_types(tenant_id: str, pagination: Dict[str, Any] = None, order_by: Dict[str, Any] = None) -> Result:
+    """
+    List node types for a tenant, newest first unless order_by sorts them by
+    created_at, updated_at or name.
+    """
     try:
         page_size = 10
         page_token = ""
@@ -328,97 +760,1636 @@ async def list_nodes(tenant_id: str, node_type_id: str = "", pagination: Dict[st
             page_token = pagination.get("page_token", "")
         
         services = await resolve_tenant_services(tenant_id)
-        nodes, result = await services["node"].list(node_type_id or None, page_size, page_token)
+
+        async def query():
+            node_types, result = await services["node_type"].list(page_size, page_token, order_by)
+            return {
+                "node_types": [nt.to_dict() for nt in node_types],
+                "pagination": result.to_dict(),
+            }
+
+        return Success(await services["query_cache"].get_or_compute(
+            tenant_id, "list_node_types",
+            {"page_size": page_size, "page_token": page_token, "order_by": order_by},
+            query
+        ))
+    except Exception as e:
+        return _handle_error(e)
+
+
+@method
+async def describe_tenant_schema(tenant_id: str) -> Result:
+    """Describe all node types of a tenant with their parsed fields and display metadata."""
+    try:
+        services = await resolve_tenant_services(tenant_id)
+        node_types = await services["node_type"].describe()
         return Success({
-            "nodes": [n.to_dict() for n in nodes],
-            "pagination": result.to_dict(),
+            "node_types": [
+                dict(
+                    nt.to_dict(),
+                    fields=[spec.to_dict() for spec in parse_schema(nt.schema).values()],
+                    display=parse_display(nt.display),
+                )
+                for nt in node_types
+            ],
         })
     except Exception as e:
         return _handle_error(e)
 
 
-# ============================================================================
-# Relationship Service Methods
-# ============================================================================
+@method
+async def refresh_bi_views(tenant_id: str) -> Result:
+    """Regenerate the tenant's read-only BI views (bi schema) and return their columns."""
+    try:
+        services = await resolve_tenant_services(tenant_id)
+        if services["bi_views"] is None:
+            raise ValueError("BI views are not enabled")
+        views = await services["bi_views"].refresh()
+        return Success({"views": [v.to_dict() for v in views]})
+    except Exception as e:
+        return _handle_error(e)
+
 
 @method
-async def create_relationship(
+async def create_node_type_index(
     tenant_id: str,
-    source_node_id: str,
-    target_node_id: str,
-    relationship_type: str,
-    data: str = "{}"
+    node_type_id: str,
+    name: str,
+    paths: List[str],
+    method: str = "btree"
 ) -> Result:
-    """Create a new relationship."""
+    """
+    Index dot-separated data paths of a node type's nodes, with a btree index
+    (equality, ranges, sorting) or a GIN index (containment). The index is
+    built without blocking writes and returned once ready.
+    """
     try:
         services = await resolve_tenant_services(tenant_id)
-        rel = await services["relationship"].create(source_node_id, target_node_id, relationship_type, data)
-        return Success({"relationship": rel.to_dict()})
+        index = await services["node_type"].create_index(node_type_id, name, method, paths)
+        return Success({"index": index.to_dict()})
     except Exception as e:
         return _handle_error(e)
 
 
 @method
-async def get_relationship(id: str, tenant_id: str) -> Result:
-    """Get a relationship by ID."""
+async def list_node_type_indexes(tenant_id: str, node_type_id: str) -> Result:
+    """List the indexes of a node type."""
     try:
         services = await resolve_tenant_services(tenant_id)
-        rel = await services["relationship"].get_by_id(id)
-        return Success({"relationship": rel.to_dict()})
+        indexes = await services["node_type"].list_indexes(node_type_id)
+        return Success({"indexes": [i.to_dict() for i in indexes]})
     except Exception as e:
         return _handle_error(e)
 
 
 @method
-async def update_relationship(id: str, tenant_id: str, relationship_type: str = "", data: str = "") -> Result:
-    """Update an existing relationship."""
+async def drop_node_type_index(tenant_id: str, node_type_id: str, name: str) -> Result:
+    """Drop an index of a node type by name."""
     try:
         services = await resolve_tenant_services(tenant_id)
-        rel = await services["relationship"].update(id, relationship_type, data)
-        return Success({"relationship": rel.to_dict()})
+        index = await services["node_type"].drop_index(node_type_id, name)
+        return Success({"index": index.to_dict()})
     except Exception as e:
         return _handle_error(e)
 
 
+# ============================================================================
+# Node Migration Service Methods
+# ============================================================================
+
 @method
-async def delete_relationship(id: str, tenant_id: str) -> Result:
-    """Delete a relationship."""
+async def validate_existing_nodes(
+    tenant_id: str,
+    node_type_id: str,
+    schema: str = "",
+    transform: str = "",
+    max_errors: int = 100
+) -> Result:
+    """
+    Dry run: validate a node type's nodes against a schema (the current one by
+    default), optionally after applying a migration transform. Nothing is changed.
+    """
     try:
         services = await resolve_tenant_services(tenant_id)
-        await services["relationship"].delete(id)
-        return Success({})
+        report = await services["node_migration"].validate_existing(node_type_id, schema, transform, max_errors)
+        return Success(report.to_dict())
     except Exception as e:
         return _handle_error(e)
 
 
 @method
-async def list_relationships(
+async def start_node_migration(
     tenant_id: str,
-    source_node_id: str = "",
-    target_node_id: str = "",
-    relationship_type: str = "",
-    pagination: Dict[str, Any] = None
+    node_type_id: str,
+    transform: str = "",
+    batch_size: int = 500
 ) -> Result:
-    """List relationships for a tenant with optional filtering."""
+    """
+    Start a background migration of a node type's outdated nodes to its current
+    schema version. Follow it with get_node_migration or as an operation.
+    """
     try:
-        page_size = 10
-        page_token = ""
-        if pagination:
-            page_size = pagination.get("page_size", 10)
-            page_token = pagination.get("page_token", "")
-        
         services = await resolve_tenant_services(tenant_id)
-        rels, result = await services["relationship"].list(
-            source_node_id or None,
-            target_node_id or None,
-            relationship_type or None,
-            page_size,
-            page_token
-        )
-        return Success({
-            "relationships": [r.to_dict() for r in rels],
-            "pagination": result.to_dict(),
-        })
+        migration = await services["node_migration"].start(node_type_id, transform, batch_size)
+        return Success({"migration": migration.to_dict(), "operation": migration_operation(migration).to_dict()})
+    except Exception as e:
+        return _handle_error(e)
+
+
+@method
+async def get_node_migration(id: str, tenant_id: str) -> Result:
+    """Get a node migration and its progress by ID."""
+    try:
+        services = await resolve_tenant_services(tenant_id)
+        migration = await services["node_migration"].get_by_id(id)
+        return Success({"migration": migration.to_dict()})
+    except Exception as e:
+        return _handle_error(e)
+
+
+@method
+async def list_node_migrations(
+    tenant_id: str,
+    node_type_id: str = "",
+    pagination: Dict[str, Any] = None
+) -> Result:
+    """List node migrations of a tenant, newest first, optionally of one node type."""
+    try:
+        page_size = 10
+        page_token = ""
+        if pagination:
+            page_size = pagination.get("page_size", 10)
+            page_token = pagination.get("page_token", "")
+
+        services = await resolve_tenant_services(tenant_id)
+        migrations, result = await services["node_migration"].list(node_type_id or None, page_size, page_token)
+        return Success({
+            "migrations": [m.to_dict() for m in migrations],
+            "pagination": result.to_dict(),
+        })
+    except Exception as e:
+        return _handle_error(e)
+
+
+@method
+async def cancel_node_migration(id: str, tenant_id: str) -> Result:
+    """Cancel a pending or running node migration."""
+    try:
+        services = await resolve_tenant_services(tenant_id)
+        migration = await services["node_migration"].cancel(id)
+        return Success({"migration": migration.to_dict()})
+    except Exception as e:
+        return _handle_error(e)
+
+
+# ============================================================================
+# Retention Policy Methods
+# ============================================================================
+
+@method
+async def set_retention_policy(
+    tenant_id: str,
+    node_type_id: str,
+    ttl_seconds: int,
+    timestamp_field: str = "created_at",
+    action: str = "delete"
+) -> Result:
+    """
+    Expire a node type's nodes ttl_seconds after their created_at, updated_at
+    or a timestamp data field; the retention sweeper deletes or purges them.
+    """
+    try:
+        services = await resolve_tenant_services(tenant_id)
+        policy = await services["retention"].set_policy(node_type_id, ttl_seconds, timestamp_field, action)
+        return Success({"policy": policy.to_dict()})
+    except Exception as e:
+        return _handle_error(e)
+
+
+@method
+async def get_retention_policy(tenant_id: str, node_type_id: str) -> Result:
+    """Get the retention policy of a node type and the result of its last sweep."""
+    try:
+        services = await resolve_tenant_services(tenant_id)
+        policy = await services["retention"].get_policy(node_type_id)
+        return Success({"policy": policy.to_dict()})
+    except Exception as e:
+        return _handle_error(e)
+
+
+@method
+async def list_retention_policies(tenant_id: str, pagination: Dict[str, Any] = None) -> Result:
+    """List the retention policies of a tenant."""
+    try:
+        page_size = 10
+        page_token = ""
+        if pagination:
+            page_size = pagination.get("page_size", 10)
+            page_token = pagination.get("page_token", "")
+
+        services = await resolve_tenant_services(tenant_id)
+        policies, result = await services["retention"].list_policies(page_size, page_token)
+        return Success({
+            "policies": [p.to_dict() for p in policies],
+            "pagination": result.to_dict(),
+        })
+    except Exception as e:
+        return _handle_error(e)
+
+
+@method
+async def delete_retention_policy(tenant_id: str, node_type_id: str) -> Result:
+    """Remove the retention policy of a node type, so its nodes no longer expire."""
+    try:
+        services = await resolve_tenant_services(tenant_id)
+        policy = await services["retention"].delete_policy(node_type_id)
+        return Success({"policy": policy.to_dict()})
+    except Exception as e:
+        return _handle_error(e)
+
+
+@method
+async def preview_retention(tenant_id: str, node_type_id: str = "") -> Result:
+    """Count the nodes the next retention sweep would expire, per policy, without deleting anything."""
+    try:
+        services = await resolve_tenant_services(tenant_id)
+        previews = await services["retention"].preview(node_type_id)
+        return Success({"previews": previews})
+    except Exception as e:
+        return _handle_error(e)
+
+
+# ============================================================================
+# Export Methods
+# ============================================================================
+
+@method
+async def export_tenant_to_storage(
+    tenant_id: str,
+    compression: str = "gzip",
+    batch_size: int = 500,
+    resume: str = ""
+) -> Result:
+    """
+    Export the tenant, in the format of /stream/export, to the object storage
+    configured with EXPORT_STORAGE_URL, compressed with gzip, zstd or none.
+
+    The export runs as an operation of kind exports and checkpoints after
+    every uploaded part; resume, the ID of a failed, cancelled or interrupted
+    export, continues it from its last checkpoint.
+    """
+    try:
+        services = await resolve_tenant_services(tenant_id)
+        job = await services["storage_exports"].export(compression, batch_size, resume)
+        return Success(_storage_export_result(job))
+    except Exception as e:
+        return _handle_error(e)
+
+
+# ============================================================================
+# Operation Service Methods
+# ============================================================================
+
+@method
+async def get_operation(tenant_id: str, name: str) -> Result:
+    """Get a long-running operation, such as "node_migrations/<id>", with its status and progress."""
+    try:
+        services = await resolve_tenant_services(tenant_id)
+        operation = await services["operations"].get(name)
+        return Success({"operation": operation.to_dict()})
+    except Exception as e:
+        return _handle_error(e)
+
+
+@method
+async def list_operations(tenant_id: str, kind: str = "", pagination: Dict[str, Any] = None) -> Result:
+    """List a tenant's long-running operations, optionally of one kind, newest first within a kind."""
+    try:
+        page_size = 10
+        page_token = ""
+        if pagination:
+            page_size = pagination.get("page_size", 10)
+            page_token = pagination.get("page_token", "")
+
+        services = await resolve_tenant_services(tenant_id)
+        operations, result = await services["operations"].list(kind, page_size, page_token)
+        return Success({
+            "operations": [o.to_dict() for o in operations],
+            "pagination": result.to_dict(),
+        })
+    except Exception as e:
+        return _handle_error(e)
+
+
+@method
+async def cancel_operation(tenant_id: str, name: str) -> Result:
+    """Cancel a pending or running long-running operation; work done so far is kept."""
+    try:
+        services = await resolve_tenant_services(tenant_id)
+        operation = await services["operations"].cancel(name)
+        return Success({"operation": operation.to_dict()})
+    except Exception as e:
+        return _handle_error(e)
+
+
+# ============================================================================
+# Dead Letter Methods
+# ============================================================================
+
+@method
+async def list_dead_letters(
+    tenant_id: str, kind: str = "", status: str = "", pagination: Dict[str, Any] = None
+) -> Result:
+    """List a tenant's failed webhook deliveries and jobs, optionally of one kind and status, oldest first."""
+    try:
+        page_size = 10
+        page_token = ""
+        if pagination:
+            page_size = pagination.get("page_size", 10)
+            page_token = pagination.get("page_token", "")
+
+        services = await resolve_tenant_services(tenant_id)
+        dead_letters, result = await services["dead_letters"].list(kind, status, page_size, page_token)
+        return Success({
+            "dead_letters": [d.to_dict() for d in dead_letters],
+            "pagination": result.to_dict(),
+        })
+    except Exception as e:
+        return _handle_error(e)
+
+
+@method
+async def get_dead_letter(id: str, tenant_id: str) -> Result:
+    """Get a dead letter with its error and payload."""
+    try:
+        services = await resolve_tenant_services(tenant_id)
+        dead_letter = await services["dead_letters"].get_by_id(id)
+        return Success({"dead_letter": dead_letter.to_dict()})
+    except Exception as e:
+        return _handle_error(e)
+
+
+@method
+async def replay_dead_letter(id: str, tenant_id: str) -> Result:
+    """Replay a dead letter: redeliver the webhook event or rerun the job."""
+    try:
+        services = await resolve_tenant_services(tenant_id)
+        dead_letter = await services["dead_letters"].replay(id)
+        return Success({"dead_letter": dead_letter.to_dict()})
+    except Exception as e:
+        return _handle_error(e)
+
+
+@method
+async def replay_dead_letters(
+    tenant_id: str, ids: Optional[List[str]] = None, kind: str = "", limit: int = 500
+) -> Result:
+    """Replay the given dead letters, or the oldest dead ones (optionally of one kind) up to limit."""
+    try:
+        services = await resolve_tenant_services(tenant_id)
+        replayed, errors = await services["dead_letters"].replay_many(ids, kind, limit)
+        return Success({"dead_letters": [d.to_dict() for d in replayed], "errors": errors})
+    except Exception as e:
+        return _handle_error(e)
+
+
+@method
+async def discard_dead_letter(id: str, tenant_id: str) -> Result:
+    """Discard a dead letter, so it is kept for reference but not replayed."""
+    try:
+        services = await resolve_tenant_services(tenant_id)
+        dead_letter = await services["dead_letters"].discard(id)
+        return Success({"dead_letter": dead_letter.to_dict()})
+    except Exception as e:
+        return _handle_error(e)
+
+
+# ============================================================================
+# Node Service Methods
+# ============================================================================
+
+@method
+async def create_node(tenant_id: str, node_type_id: str, data: str = "{}", dry_run: bool = False) -> Result:
+    """Create a new node. dry_run validates it and returns it without saving it."""
+    try:
+        services = await resolve_tenant_services(tenant_id)
+        node = await services["node"].create(node_type_id, data, dry_run)
+        return Success(_dry_run_result({"node": node.to_dict()}, dry_run))
+    except Exception as e:
+        return _handle_error(e)
+
+
+@method
+async def get_node(id: str, tenant_id: str, locale: str = "", fields: List[str] = None) -> Result:
+    """
+    Get a node by ID. locale (e.g. "fr-CA,fr,en") resolves localized fields to
+    one string. fields, a field mask, returns only the listed fields.
+    """
+    try:
+        mask = parse_field_mask(fields, Node().to_dict())
+        services = await resolve_tenant_services(tenant_id)
+        node = await services["node"].get_by_id(id, locale, mask.data_fields() if mask else None)
+        return Success({"node": _masked(node.to_dict(), mask)})
+    except Exception as e:
+        return _handle_error(e)
+
+
+@method
+async def batch_get_nodes(tenant_id: str, ids: List[str], locale: str = "", fields: List[str] = None) -> Result:
+    """
+    Get up to 500 nodes by ID in one call, like get_node; IDs without a node
+    are listed as missing.
+    """
+    try:
+        mask = parse_field_mask(fields, Node().to_dict())
+        services = await resolve_tenant_services(tenant_id)
+        nodes, missing = await services["node"].batch_get(ids, locale, mask.data_fields() if mask else None)
+        return Success({"nodes": [_masked(node.to_dict(), mask) for node in nodes], "missing": missing})
+    except Exception as e:
+        return _handle_error(e)
+
+
+@method
+async def update_node(
+    id: str,
+    tenant_id: str,
+    data: str = "",
+    expected_version: int = 0,
+    if_match: str = "",
+    dry_run: bool = False,
+    lock_token: str = ""
+) -> Result:
+    """
+    Update an existing node. A non-zero expected_version, or the etag of a
+    fetched node as if_match, fails with a conflict if it is stale. A
+    lock_token fails the update unless it holds the node's lock (see
+    acquire_node_lock). dry_run validates the update and returns the result
+    without saving it.
+    """
+    try:
+        services = await resolve_tenant_services(tenant_id)
+        node = await services["node"].update(id, data, expected_version or None, if_match, dry_run, lock_token)
+        return Success(_dry_run_result({"node": node.to_dict()}, dry_run))
+    except Exception as e:
+        return _handle_error(e)
+
+
+@method
+async def delete_node(
+    id: str,
+    tenant_id: str,
+    expected_version: int = 0,
+    if_match: str = "",
+    dry_run: bool = False,
+    lock_token: str = ""
+) -> Result:
+    """
+    Delete a node. A non-zero expected_version, or the etag of a fetched node
+    as if_match, fails with a conflict if it is stale, and a lock_token
+    unless it holds the node's lock. dry_run only checks that it could be
+    deleted.
+    """
+    try:
+        services = await resolve_tenant_services(tenant_id)
+        await services["node"].delete(id, expected_version or None, if_match, dry_run, lock_token)
+        return Success(_dry_run_result({}, dry_run))
+    except Exception as e:
+        return _handle_error(e)
+
+
+@method
+async def acquire_node_lock(
+    node_id: str,
+    tenant_id: str,
+    holder: str = "",
+    ttl_seconds: int = 60,
+    lock_token: str = "",
+    enforce: bool = False
+) -> Result:
+    """
+    Lock a node for ttl_seconds (at most 3600) so other editors can't change
+    it, returning the lock and its lock_token. Acquiring it again with the
+    lock_token renews the lease. enforce also fails updates and deletes
+    without the token. Fails with FAILED_PRECONDITION (reason NODE_LOCKED)
+    while another token holds the lock.
+    """
+    try:
+        services = await resolve_tenant_services(tenant_id)
+        lock = await services["node_locks"].acquire(node_id, holder, ttl_seconds, lock_token, enforce)
+        return Success({"lock": lock.to_dict(), "lock_token": lock.token})
+    except Exception as e:
+        return _handle_error(e)
+
+
+@method
+async def get_node_lock(node_id: str, tenant_id: str) -> Result:
+    """Get the lock of a node, null if it isn't locked."""
+    try:
+        services = await resolve_tenant_services(tenant_id)
+        lock = await services["node_locks"].get(node_id)
+        return Success({"lock": lock.to_dict() if lock else None})
+    except Exception as e:
+        return _handle_error(e)
+
+
+@method
+async def release_node_lock(node_id: str, tenant_id: str, lock_token: str) -> Result:
+    """Release the lock of a node held by lock_token; released is false if it no longer held it."""
+    try:
+        services = await resolve_tenant_services(tenant_id)
+        released = await services["node_locks"].release(node_id, lock_token)
+        return Success({"released": released})
+    except Exception as e:
+        return _handle_error(e)
+
+
+@method
+async def delete_nodes(
+    tenant_id: str,
+    node_type_id: str = "",
+    filter: Dict[str, Any] = None,
+    dry_run: bool = False
+) -> Result:
+    """
+    Delete the nodes of a node type and/or whose data contains filter (a JSON
+    object matched like jsonb @>), in batches. dry_run only counts them.
+
+    The delete runs as an operation of kind bulk_deletes, whose progress can
+    be read and which can be cancelled while it runs; nodes deleted before it
+    was cancelled stay deleted.
+    """
+    try:
+        services = await resolve_tenant_services(tenant_id)
+        if dry_run:
+            count = await services["node"].delete_many(node_type_id or None, filter, dry_run)
+            return Success({"deleted_count": count, "dry_run": dry_run})
+        job = await services["bulk_jobs"].run(
+            BULK_DELETE,
+            {"entity": "nodes", "node_type_id": node_type_id, "filter": filter},
+            lambda on_batch: services["node"].delete_many(node_type_id or None, filter, on_batch=on_batch),
+            unit="nodes",
+        )
+        return Success(_bulk_delete_result(job))
+    except Exception as e:
+        return _handle_error(e)
+
+
+@method
+async def list_node_revisions(id: str, tenant_id: str, pagination: Dict[str, Any] = None) -> Result:
+    """List the revisions of a node, newest first; a deleted node's history remains available."""
+    try:
+        page_size = 10
+        page_token = ""
+        if pagination:
+            page_size = pagination.get("page_size", 10)
+            page_token = pagination.get("page_token", "")
+
+        services = await resolve_tenant_services(tenant_id)
+        revisions, result = await services["node"].list_revisions(id, page_size, page_token)
+        return Success({
+            "revisions": [r.to_dict() for r in revisions],
+            "pagination": result.to_dict(),
+        })
+    except Exception as e:
+        return _handle_error(e)
+
+
+@method
+async def diff_node_revisions(id: str, tenant_id: str, from_revision_id: str, to_revision_id: str = "") -> Result:
+    """
+    Diff the data of two revisions of a node (to_revision_id defaults to the
+    latest): the data paths added, removed and changed between them.
+    """
+    try:
+        services = await resolve_tenant_services(tenant_id)
+        before, after, diff = await services["node"].diff_revisions(id, from_revision_id, to_revision_id)
+        return Success({
+            "node_id": id,
+            "from_revision": _revision_summary(before),
+            "to_revision": _revision_summary(after),
+            **diff,
+        })
+    except Exception as e:
+        return _handle_error(e)
+
+
+@method
+async def get_node_field_history(id: str, tenant_id: str, path: str, pagination: Dict[str, Any] = None) -> Result:
+    """
+    List the changes of a data path of a node, newest first: each with the
+    revision that made it, who made it (actor) and the value before and after.
+    """
+    try:
+        page_size = 10
+        page_token = ""
+        if pagination:
+            page_size = pagination.get("page_size", 10)
+            page_token = pagination.get("page_token", "")
+
+        services = await resolve_tenant_services(tenant_id)
+        changes, result = await services["node"].field_history(id, path, page_size, page_token)
+        return Success({
+            "node_id": id,
+            "path": path,
+            "changes": [c.to_dict() for c in changes],
+            "pagination": result.to_dict(),
+        })
+    except Exception as e:
+        return _handle_error(e)
+
+
+@method
+async def get_node_at(id: str, tenant_id: str, timestamp: str, locale: str = "", fields: List[str] = None) -> Result:
+    """
+    Get a node as it was at an ISO 8601 timestamp (UTC unless it has an
+    offset). Fails with not found if the node didn't exist then.
+    """
+    try:
+        mask = parse_field_mask(fields, Node().to_dict())
+        services = await resolve_tenant_services(tenant_id)
+        node = await services["node"].get_at(id, timestamp, locale)
+        return Success({"node": _masked(node.to_dict(), mask)})
+    except Exception as e:
+        return _handle_error(e)
+
+
+@method
+async def list_nodes(
+    tenant_id: str,
+    node_type_id: str = "",
+    pagination: Dict[str, Any] = None,
+    geo: Dict[str, Any] = None,
+    locale: str = "",
+    filter: Dict[str, Any] = None,
+    contains: Dict[str, Any] = None,
+    fields: List[str] = None,
+    order_by: Dict[str, Any] = None,
+    as_of: str = ""
+) -> Result:
+    """
+    List nodes for a tenant with optional filtering. locale resolves localized
+    fields. filter and contains map dot-separated data paths to JSON values
+    the data at the path must equal or contain. fields, a field mask, returns
+    only the listed fields of each node. order_by sorts them by created_at,
+    updated_at or an indexed data path of the node type ("data.price"). as_of,
+    an ISO 8601 timestamp, lists the nodes as they were then.
+    """
+    try:
+        mask = parse_field_mask(fields, Node().to_dict())
+        page_size = 10
+        page_token = ""
+        if pagination:
+            page_size = pagination.get("page_size", 10)
+            page_token = pagination.get("page_token", "")
+        
+        services = await resolve_tenant_services(tenant_id)
+
+        async def query():
+            nodes, result = await services["node"].list(
+                node_type_id or None, page_size, page_token, geo, locale, filter, contains,
+                mask.data_fields() if mask else None, order_by, as_of
+            )
+            return {
+                "nodes": [_masked(n.to_dict(), mask) for n in nodes],
+                "pagination": result.to_dict(),
+            }
+
+        return Success(await services["query_cache"].get_or_compute(
+            tenant_id, "list_nodes",
+            {
+                "node_type_id": node_type_id,
+                "page_size": page_size,
+                "page_token": page_token,
+                "geo": geo,
+                "locale": locale,
+                "filter": filter,
+                "contains": contains,
+                "fields": fields,
+                "order_by": order_by,
+                "as_of": as_of,
+            },
+            query
+        ))
+    except Exception as e:
+        return _handle_error(e)
+
+
+@method
+async def count_nodes(
+    tenant_id: str,
+    node_type_id: str = "",
+    filter: Dict[str, Any] = None,
+    contains: Dict[str, Any] = None
+) -> Result:
+    """Count nodes, optionally of a node type and matching filter and contains (see list_nodes)."""
+    try:
+        services = await resolve_tenant_services(tenant_id)
+
+        async def query():
+            return {"count": await services["node"].count(node_type_id or None, filter, contains)}
+
+        return Success(await services["query_cache"].get_or_compute(
+            tenant_id, "count_nodes",
+            {"node_type_id": node_type_id, "filter": filter, "contains": contains},
+            query
+        ))
+    except Exception as e:
+        return _handle_error(e)
+
+
+@method
+async def aggregate_nodes(
+    tenant_id: str,
+    aggregation: Dict[str, Any],
+    node_type_id: str = "",
+    filter: Dict[str, Any] = None,
+    contains: Dict[str, Any] = None
+) -> Result:
+    """
+    Compute range, histogram, date histogram, terms or overall buckets, with
+    an optional sum/avg/min/max metric, over node data fields in SQL.
+    filter and contains select the nodes as in list_nodes.
+    """
+    try:
+        services = await resolve_tenant_services(tenant_id)
+
+        async def query():
+            buckets = await services["node"].aggregate(node_type_id or None, aggregation, filter, contains)
+            return {"buckets": [b.to_dict() for b in buckets]}
+
+        return Success(await services["query_cache"].get_or_compute(
+            tenant_id, "aggregate_nodes",
+            {"node_type_id": node_type_id, "aggregation": aggregation, "filter": filter, "contains": contains},
+            query
+        ))
+    except Exception as e:
+        return _handle_error(e)
+
+
+@method
+async def clone_node(id: str, tenant_id: str, patch: str = "", include_relationships: bool = False) -> Result:
+    """
+    Copy a node with a new ID, setting the top-level fields of patch (a JSON
+    object; null removes a field) on the copy. include_relationships also
+    copies its outgoing relationships, to the same targets.
+    """
+    try:
+        services = await resolve_tenant_services(tenant_id)
+        node, relationships = await services["clone"].clone_node(id, patch, include_relationships)
+        return Success({"node": node.to_dict(), "relationships": [r.to_dict() for r in relationships]})
+    except Exception as e:
+        return _handle_error(e)
+
+
+@method
+async def clone_subgraph(
+    id: str,
+    tenant_id: str,
+    depth: int = 1,
+    relationship_types: Optional[List[str]] = None,
+    patch: str = ""
+) -> Result:
+    """
+    Deep-copy a node with the nodes reachable through up to depth outgoing
+    relationships (optionally only of relationship_types) and the
+    relationships between them, remapped to the copies. patch applies to the
+    root's copy as in clone_node. id_map maps each original node ID to its copy's.
+    """
+    try:
+        services = await resolve_tenant_services(tenant_id)
+        root, nodes, relationships, id_map = await services["clone"].clone_subgraph(
+            id, depth, relationship_types, patch
+        )
+        return Success({
+            "node": root.to_dict(),
+            "nodes": [n.to_dict() for n in nodes],
+            "relationships": [r.to_dict() for r in relationships],
+            "id_map": id_map,
+        })
+    except Exception as e:
+        return _handle_error(e)
+
+
+# ============================================================================
+# Relationship Service Methods
+# ============================================================================
+
+@method
+async def create_relationship(
+    tenant_id: str,
+    source_node_id: str,
+    target_node_id: str,
+    relationship_type: str,
+    data: str = "{}",
+    dry_run: bool = False
+) -> Result:
+    """Create a new relationship. dry_run validates it and returns it without saving it."""
+    try:
+        services = await resolve_tenant_services(tenant_id)
+        rel = await services["relationship"].create(
+            source_node_id, target_node_id, relationship_type, data, dry_run
+        )
+        return Success(_dry_run_result({"relationship": rel.to_dict()}, dry_run))
+    except Exception as e:
+        return _handle_error(e)
+
+
+@method
+async def get_relationship(id: str, tenant_id: str, fields: List[str] = None) -> Result:
+    """Get a relationship by ID. fields, a field mask, returns only the listed fields."""
+    try:
+        mask = parse_field_mask(fields, Relationship().to_dict())
+        services = await resolve_tenant_services(tenant_id)
+        rel = await services["relationship"].get_by_id(id)
+        return Success({"relationship": _masked(rel.to_dict(), mask)})
+    except Exception as e:
+        return _handle_error(e)
+
+
+@method
+async def update_relationship(
+    id: str,
+    tenant_id: str,
+    relationship_type: str = "",
+    data: str = "",
+    expected_version: int = 0,
+    if_match: str = "",
+    dry_run: bool = False
+) -> Result:
+    """
+    Update an existing relationship. A non-zero expected_version, or the etag
+    of a fetched relationship as if_match, fails with a conflict if it is stale.
+    dry_run validates the update and returns the result without saving it.
+    """
+    try:
+        services = await resolve_tenant_services(tenant_id)
+        rel = await services["relationship"].update(
+            id, relationship_type, data, expected_version or None, if_match, dry_run
+        )
+        return Success(_dry_run_result({"relationship": rel.to_dict()}, dry_run))
+    except Exception as e:
+        return _handle_error(e)
+
+
+@method
+async def delete_relationship(
+    id: str,
+    tenant_id: str,
+    expected_version: int = 0,
+    if_match: str = "",
+    dry_run: bool = False
+) -> Result:
+    """
+    Delete a relationship. A non-zero expected_version, or the etag of a
+    fetched relationship as if_match, fails with a conflict if it is stale.
+    dry_run only checks that it could be deleted.
+    """
+    try:
+        services = await resolve_tenant_services(tenant_id)
+        await services["relationship"].delete(id, expected_version or None, if_match, dry_run)
+        return Success(_dry_run_result({}, dry_run))
+    except Exception as e:
+        return _handle_error(e)
+
+
+@method
+async def delete_relationships(
+    tenant_id: str,
+    relationship_type: str = "",
+    source_node_id: str = "",
+    target_node_id: str = "",
+    dry_run: bool = False
+) -> Result:
+    """
+    Delete the relationships matching all the given filters, in batches, as
+    an operation of kind bulk_deletes like delete_nodes. dry_run only counts them.
+    """
+    try:
+        services = await resolve_tenant_services(tenant_id)
+        if dry_run:
+            count = await services["relationship"].delete_many(
+                source_node_id or None, target_node_id or None, relationship_type or None, dry_run
+            )
+            return Success({"deleted_count": count, "dry_run": dry_run})
+        job = await services["bulk_jobs"].run(
+            BULK_DELETE,
+            {
+                "entity": "relationships",
+                "relationship_type": relationship_type,
+                "source_node_id": source_node_id,
+                "target_node_id": target_node_id,
+            },
+            lambda on_batch: services["relationship"].delete_many(
+                source_node_id or None, target_node_id or None, relationship_type or None, on_batch=on_batch
+            ),
+            unit="relationships",
+        )
+        return Success(_bulk_delete_result(job))
+    except Exception as e:
+        return _handle_error(e)
+
+
+@method
+async def list_relationships(
+    tenant_id: str,
+    source_node_id: str = "",
+    target_node_id: str = "",
+    relationship_type: str = "",
+    pagination: Dict[str, Any] = None,
+    fields: List[str] = None,
+    order_by: Dict[str, Any] = None,
+    source_node_ids: List[str] = None,
+    target_node_ids: List[str] = None,
+    relationship_types: List[str] = None
+) -> Result:
+    """
+    List relationships for a tenant with optional filtering. source_node_ids,
+    target_node_ids and relationship_types match any of up to 500 values each
+    (together with the single-value filters), so the edges among the nodes of
+    a subgraph come in one listing. fields, a field mask, returns only the
+    listed fields of each relationship. order_by sorts them by created_at or
+    updated_at.
+    """
+    try:
+        mask = parse_field_mask(fields, Relationship().to_dict())
+        page_size = 10
+        page_token = ""
+        if pagination:
+            page_size = pagination.get("page_size", 10)
+            page_token = pagination.get("page_token", "")
+        sources = _any_of(source_node_id, source_node_ids)
+        targets = _any_of(target_node_id, target_node_ids)
+        types = _any_of(relationship_type, relationship_types)
+
+        services = await resolve_tenant_services(tenant_id)
+
+        async def query():
+            rels, result = await services["relationship"].list(
+                sources,
+                targets,
+                types,
+                page_size,
+                page_token,
+                order_by
+            )
+            # Edges to nodes of types a restricted API key may not see are left out of the page
+            rels = await visible_relationships(tenant_id, rels)
+            return {
+                "relationships": [_masked(r.to_dict(), mask) for r in rels],
+                "pagination": result.to_dict(),
+            }
+
+        return Success(await services["query_cache"].get_or_compute(
+            tenant_id, "list_relationships",
+            {
+                "source_node_ids": sources,
+                "target_node_ids": targets,
+                "relationship_types": types,
+                "page_size": page_size,
+                "page_token": page_token,
+                "fields": fields,
+                "order_by": order_by,
+                # The page is filtered for keys restricted to node types
+                "node_type_restriction": node_type_restriction(),
+            },
+            query
+        ))
+    except Exception as e:
+        return _handle_error(e)
+
+
+# ============================================================================
+# Query Diagnostics Methods
+# ============================================================================
+
+# Methods whose queries explain_query can explain
+EXPLAINABLE_METHODS = {
+    "list_nodes": list_nodes,
+    "count_nodes": count_nodes,
+    "aggregate_nodes": aggregate_nodes,
+    "list_relationships": list_relationships,
+}
+# statement_timeout of each EXPLAIN, in seconds
+EXPLAIN_STATEMENT_TIMEOUT = 5.0
+
+
+@method
+async def explain_query(tenant_id: str, method: str, params: Dict[str, Any] = None, analyze: bool = True) -> Result:
+    """
+    Explain the PostgreSQL queries of a list, count or aggregate call: run
+    method with params for the tenant and return the EXPLAIN (ANALYZE,
+    BUFFERS) plan of each SELECT it ran (see app/db/explain.py). With analyze
+    false, plans are estimated without running the queries. Admin key only.
+    """
+    try:
+        if method not in EXPLAINABLE_METHODS:
+            raise ValidationError("method", f"must be one of {', '.join(EXPLAINABLE_METHODS)}")
+        if params is not None and not isinstance(params, dict):
+            raise ValidationError("params", "must be an object of the method's params")
+        params = {**(params or {}), "tenant_id": tenant_id}
+        # Resolved first, so the tenant lookup isn't among the plans
+        await resolve_tenant_services(tenant_id)
+
+        with plan_capture(analyze, EXPLAIN_STATEMENT_TIMEOUT) as capture:
+            try:
+                result = await EXPLAINABLE_METHODS[method](**params)
+            except TypeError as e:
+                raise ValidationError("params", f"don't match {method}: {e}") from e
+        explained: Dict[str, Any] = {
+            "method": method,
+            "analyze": analyze,
+            "plans": [plan.to_dict() for plan in capture.plans],
+            "truncated": capture.truncated,
+        }
+        if result_code(result) is not None:
+            # Plans of a failed call are still returned, with its error
+            explained["error"] = {"code": result._error.code, "message": result._error.message}
+        return Success(explained)
+    except Exception as e:
+        return _handle_error(e)
+
+
+# ============================================================================
+# Webhook Service Methods
+# ============================================================================
+
+@method
+async def create_webhook_endpoint(
+    tenant_id: str,
+    url: str,
+    event_types: List[str] = None,
+    description: str = "",
+    kind: str = "webhook",
+    template: str = "",
+    node_type_ids: List[str] = None,
+    dry_run: bool = False
+) -> Result:
+    """
+    Register a webhook endpoint for a tenant. The signing secret is only returned here.
+
+    kind "slack" or "teams" posts events to an incoming webhook URL as chat messages rendered from template.
+    dry_run validates the endpoint and returns it, without a secret, without saving it.
+    """
+    try:
+        services = await resolve_tenant_services(tenant_id)
+        endpoint = await services["webhook"].create(
+            url, event_types, description, kind, template, node_type_ids, dry_run
+        )
+        return Success(_dry_run_result({"webhook_endpoint": endpoint.to_dict(include_secret=not dry_run)}, dry_run))
+    except Exception as e:
+        return _handle_error(e)
+
+
+@method
+async def get_webhook_endpoint(id: str, tenant_id: str) -> Result:
+    """Get a webhook endpoint by ID."""
+    try:
+        services = await resolve_tenant_services(tenant_id)
+        endpoint = await services["webhook"].get_by_id(id)
+        return Success({"webhook_endpoint": endpoint.to_dict()})
+    except Exception as e:
+        return _handle_error(e)
+
+
+@method
+async def update_webhook_endpoint(
+    id: str,
+    tenant_id: str,
+    url: str = "",
+    event_types: List[str] = None,
+    description: str = "",
+    status: str = "",
+    template: str = "",
+    node_type_ids: List[str] = None,
+    dry_run: bool = False
+) -> Result:
+    """Update a webhook endpoint. dry_run validates the update and returns the result without saving it."""
+    try:
+        services = await resolve_tenant_services(tenant_id)
+        endpoint = await services["webhook"].update(
+            id, url, event_types, description, status, template, node_type_ids, dry_run
+        )
+        return Success(_dry_run_result({"webhook_endpoint": endpoint.to_dict()}, dry_run))
+    except Exception as e:
+        return _handle_error(e)
+
+
+@method
+async def delete_webhook_endpoint(id: str, tenant_id: str) -> Result:
+    """Delete a webhook endpoint."""
+    try:
+        services = await resolve_tenant_services(tenant_id)
+        await services["webhook"].delete(id)
+        return Success({})
+    except Exception as e:
+        return _handle_error(e)
+
+
+@method
+async def list_webhook_endpoints(tenant_id: str, pagination: Dict[str, Any] = None) -> Result:
+    """List webhook endpoints for a tenant."""
+    try:
+        page_size = 10
+        page_token = ""
+        if pagination:
+            page_size = pagination.get("page_size", 10)
+            page_token = pagination.get("page_token", "")
+
+        services = await resolve_tenant_services(tenant_id)
+        endpoints, result = await services["webhook"].list(page_size, page_token)
+        return Success({
+            "webhook_endpoints": [e.to_dict() for e in endpoints],
+            "pagination": result.to_dict(),
+        })
+    except Exception as e:
+        return _handle_error(e)
+
+
+@method
+async def send_test_webhook_event(id: str, tenant_id: str) -> Result:
+    """
+    Send a sample webhook.test event to a webhook endpoint, whatever its
+    filters and status. It is delivered by the dispatcher's next poll and
+    attempted once; get_webhook_delivery returns the outcome.
+    """
+    try:
+        services = await resolve_tenant_services(tenant_id)
+        delivery = await services["webhook"].send_test_event(id)
+        return Success({"webhook_delivery": delivery_log(delivery)})
+    except Exception as e:
+        return _handle_error(e)
+
+
+@method
+async def get_webhook_delivery(id: str, tenant_id: str, endpoint_id: str) -> Result:
+    """Get a delivery of a webhook endpoint by ID, with a redacted snapshot of its payload."""
+    try:
+        services = await resolve_tenant_services(tenant_id)
+        delivery = await services["webhook"].get_delivery(endpoint_id, id)
+        return Success({"webhook_delivery": delivery_log(delivery)})
+    except Exception as e:
+        return _handle_error(e)
+
+
+@method
+async def list_webhook_deliveries(
+    tenant_id: str,
+    endpoint_id: str,
+    status: str = "",
+    pagination: Dict[str, Any] = None
+) -> Result:
+    """
+    List a webhook endpoint's deliveries, newest first, optionally with one
+    status (pending, succeeded or failed): the response code, latency and
+    error of their last attempt, and a redacted snapshot of their payload.
+    """
+    try:
+        page_size = 10
+        page_token = ""
+        if pagination:
+            page_size = pagination.get("page_size", 10)
+            page_token = pagination.get("page_token", "")
+
+        services = await resolve_tenant_services(tenant_id)
+        deliveries, result = await services["webhook"].list_deliveries(endpoint_id, page_size, page_token, status)
+        return Success({
+            "webhook_deliveries": [delivery_log(d) for d in deliveries],
+            "pagination": result.to_dict(),
+        })
+    except Exception as e:
+        return _handle_error(e)
+
+
+# ============================================================================
+# Event Schema Methods
+# ============================================================================
+
+@method
+async def list_event_schemas(event_type: str = "") -> Result:
+    """List the versions of every event type's payload schema, or of one event type's."""
+    try:
+        return Success({"schemas": [schema.to_dict() for schema in event_schemas.list_event_schemas(event_type)]})
+    except Exception as e:
+        return _handle_error(e)
+
+
+@method
+async def get_event_schema(event_type: str, version: int = 0) -> Result:
+    """Get a version of an event type's payload schema, by default the one new events are written with."""
+    try:
+        return Success({"schema": event_schemas.get_event_schema(event_type, version).to_dict()})
+    except Exception as e:
+        return _handle_error(e)
+
+
+# ============================================================================
+# Event Subscription Methods
+# ============================================================================
+
+@method
+async def create_subscription(
+    tenant_id: str,
+    name: str,
+    event_types: List[str] = None,
+    node_type_ids: List[str] = None,
+    ack_deadline_seconds: int = 60,
+    dry_run: bool = False
+) -> Result:
+    """
+    Create a pull subscription, which queues the matching change events from
+    now on. dry_run validates it and returns it without saving it.
+    """
+    try:
+        services = await resolve_tenant_services(tenant_id)
+        subscription = await services["subscriptions"].create(
+            name, event_types, node_type_ids, ack_deadline_seconds, dry_run
+        )
+        return Success(_dry_run_result({"subscription": subscription.to_dict()}, dry_run))
+    except Exception as e:
+        return _handle_error(e)
+
+
+@method
+async def get_subscription(id: str, tenant_id: str) -> Result:
+    """Get a pull subscription with its backlog of unacknowledged events."""
+    try:
+        services = await resolve_tenant_services(tenant_id)
+        subscription = await services["subscriptions"].get_by_id(id)
+        return Success({"subscription": subscription.to_dict()})
+    except Exception as e:
+        return _handle_error(e)
+
+
+@method
+async def update_subscription(
+    id: str,
+    tenant_id: str,
+    event_types: List[str] = None,
+    node_type_ids: List[str] = None,
+    ack_deadline_seconds: int = 0,
+    status: str = "",
+    dry_run: bool = False
+) -> Result:
+    """
+    Update a pull subscription's filters, ack deadline or status. dry_run
+    validates the update and returns the result without saving it.
+    """
+    try:
+        services = await resolve_tenant_services(tenant_id)
+        subscription = await services["subscriptions"].update(
+            id, event_types, node_type_ids, ack_deadline_seconds, status, dry_run
+        )
+        return Success(_dry_run_result({"subscription": subscription.to_dict()}, dry_run))
+    except Exception as e:
+        return _handle_error(e)
+
+
+@method
+async def delete_subscription(id: str, tenant_id: str) -> Result:
+    """Delete a pull subscription and its backlog."""
+    try:
+        services = await resolve_tenant_services(tenant_id)
+        await services["subscriptions"].delete(id)
+        return Success({})
+    except Exception as e:
+        return _handle_error(e)
+
+
+@method
+async def list_subscriptions(tenant_id: str, pagination: Dict[str, Any] = None) -> Result:
+    """List pull subscriptions for a tenant."""
+    try:
+        page_size = 10
+        page_token = ""
+        if pagination:
+            page_size = pagination.get("page_size", 10)
+            page_token = pagination.get("page_token", "")
+
+        services = await resolve_tenant_services(tenant_id)
+        subscriptions, result = await services["subscriptions"].list(page_size, page_token)
+        return Success({
+            "subscriptions": [s.to_dict() for s in subscriptions],
+            "pagination": result.to_dict(),
+        })
+    except Exception as e:
+        return _handle_error(e)
+
+
+@method
+async def pull_events(subscription_id: str, tenant_id: str, max_events: int = 100) -> Result:
+    """
+    Pull a batch of a subscription's oldest unacknowledged events, leased for
+    its ack deadline; acknowledge each with ack_events once processed.
+    """
+    try:
+        services = await resolve_tenant_services(tenant_id)
+        messages = await services["subscriptions"].pull(subscription_id, max_events)
+        return Success({"events": [m.to_dict() for m in messages]})
+    except Exception as e:
+        return _handle_error(e)
+
+
+@method
+async def ack_events(subscription_id: str, tenant_id: str, ack_ids: List[str]) -> Result:
+    """Acknowledge pulled events by their ack_id, so they are not pulled again."""
+    try:
+        services = await resolve_tenant_services(tenant_id)
+        acked = await services["subscriptions"].ack(subscription_id, ack_ids)
+        return Success({"acked_count": acked})
+    except Exception as e:
+        return _handle_error(e)
+
+
+@method
+async def nack_events(subscription_id: str, tenant_id: str, ack_ids: List[str]) -> Result:
+    """Release pulled events that weren't processed, so they are pulled again at once."""
+    try:
+        services = await resolve_tenant_services(tenant_id)
+        released = await services["subscriptions"].nack(subscription_id, ack_ids)
+        return Success({"released_count": released})
+    except Exception as e:
+        return _handle_error(e)
+
+
+@method
+async def list_changes(tenant_id: str, after: str = "", page_size: int = 100) -> Result:
+    """
+    List the tenant's change events committed after a change token, oldest
+    first: the change_token of an export header, or the next_token of the
+    previous page. Without a token, the feed starts at the first change.
+    """
+    try:
+        services = await resolve_tenant_services(tenant_id)
+        page = await services["changes"].list_changes(after, page_size)
+        return Success(page.to_dict())
+    except Exception as e:
+        return _handle_error(e)
+
+
+@method
+async def get_change_token(tenant_id: str) -> Result:
+    """Get the change token of now, to list with list_changes only the changes committed from now on."""
+    try:
+        services = await resolve_tenant_services(tenant_id)
+        return Success({"change_token": await services["changes"].current_token()})
+    except Exception as e:
+        return _handle_error(e)
+
+
+# ============================================================================
+# Intake Form Service Methods
+# ============================================================================
+
+@method
+async def create_intake_form(
+    tenant_id: str,
+    node_type_id: str,
+    name: str,
+    fields: List[str] = None,
+    require_captcha: bool = False,
+    rate_limit_per_minute: int = 10,
+    require_signature: bool = False,
+    dry_run: bool = False
+) -> Result:
+    """
+    Create a public intake form that creates nodes of node_type_id from website submissions.
+    With require_signature, submissions must be signed with the returned signing secret.
+    dry_run validates the form and returns it, without a secret, without saving it.
+    """
+    try:
+        services = await resolve_tenant_services(tenant_id)
+        form = await services["intake"].create(
+            node_type_id, name, fields, require_captcha, rate_limit_per_minute, require_signature, dry_run
+        )
+        return Success(_dry_run_result({"intake_form": form.to_dict(include_secret=not dry_run)}, dry_run))
+    except Exception as e:
+        return _handle_error(e)
+
+
+@method
+async def get_intake_form(id: str, tenant_id: str) -> Result:
+    """Get an intake form by ID."""
+    try:
+        services = await resolve_tenant_services(tenant_id)
+        form = await services["intake"].get_by_id(id)
+        return Success({"intake_form": form.to_dict()})
+    except Exception as e:
+        return _handle_error(e)
+
+
+@method
+async def update_intake_form(
+    id: str,
+    tenant_id: str,
+    name: str = "",
+    fields: List[str] = None,
+    require_captcha: bool = None,
+    rate_limit_per_minute: int = 0,
+    status: str = "",
+    rotate_token: bool = False,
+    require_signature: bool = None,
+    rotate_signing_secret: bool = False,
+    dry_run: bool = False
+) -> Result:
+    """
+    Update an intake form. rotate_token issues a new public token and invalidates the old one.
+    A signing secret created by require_signature or rotate_signing_secret is returned once.
+    dry_run validates the update and returns the result, without a secret, without saving it.
+    """
+    try:
+        services = await resolve_tenant_services(tenant_id)
+        form = await services["intake"].update(
+            id, name, fields, require_captcha, rate_limit_per_minute, status, rotate_token,
+            require_signature, rotate_signing_secret, dry_run
+        )
+        include_secret = bool(require_signature or rotate_signing_secret) and not dry_run
+        return Success(_dry_run_result({"intake_form": form.to_dict(include_secret=include_secret)}, dry_run))
+    except Exception as e:
+        return _handle_error(e)
+
+
+@method
+async def delete_intake_form(id: str, tenant_id: str) -> Result:
+    """Delete an intake form."""
+    try:
+        services = await resolve_tenant_services(tenant_id)
+        await services["intake"].delete(id)
+        return Success({})
+    except Exception as e:
+        return _handle_error(e)
+
+
+@method
+async def list_intake_forms(tenant_id: str, pagination: Dict[str, Any] = None) -> Result:
+    """List intake forms for a tenant."""
+    try:
+        page_size = 10
+        page_token = ""
+        if pagination:
+            page_size = pagination.get("page_size", 10)
+            page_token = pagination.get("page_token", "")
+
+        services = await resolve_tenant_services(tenant_id)
+        forms, result = await services["intake"].list(page_size, page_token)
+        return Success({
+            "intake_forms": [f.to_dict() for f in forms],
+            "pagination": result.to_dict(),
+        })
+    except Exception as e:
+        return _handle_error(e)
+
+
+# ============================================================================
+# Email Inbox Service Methods
+# ============================================================================
+
+@method
+async def create_email_inbox(
+    tenant_id: str,
+    node_type_id: str,
+    name: str,
+    field_mapping: Dict[str, Any] = None,
+    require_signature: bool = False,
+    dry_run: bool = False
+) -> Result:
+    """
+    Create an inbox that turns emails posted by a mail provider into nodes of node_type_id.
+    With require_signature, deliveries must be signed with the returned signing secret.
+    dry_run validates the inbox and returns it, without a secret, without saving it.
+    """
+    try:
+        services = await resolve_tenant_services(tenant_id)
+        inbox = await services["inbox"].create(node_type_id, name, field_mapping, require_signature, dry_run)
+        return Success(_dry_run_result({"email_inbox": inbox.to_dict(include_secret=not dry_run)}, dry_run))
+    except Exception as e:
+        return _handle_error(e)
+
+
+@method
+async def get_email_inbox(id: str, tenant_id: str) -> Result:
+    """Get an email inbox by ID."""
+    try:
+        services = await resolve_tenant_services(tenant_id)
+        inbox = await services["inbox"].get_by_id(id)
+        return Success({"email_inbox": inbox.to_dict()})
+    except Exception as e:
+        return _handle_error(e)
+
+
+@method
+async def update_email_inbox(
+    id: str,
+    tenant_id: str,
+    name: str = "",
+    field_mapping: Dict[str, Any] = None,
+    status: str = "",
+    rotate_token: bool = False,
+    require_signature: bool = None,
+    rotate_signing_secret: bool = False,
+    dry_run: bool = False
+) -> Result:
+    """
+    Update an email inbox. rotate_token issues a new webhook token and invalidates the old one.
+    A signing secret created by require_signature or rotate_signing_secret is returned once.
+    dry_run validates the update and returns the result, without a secret, without saving it.
+    """
+    try:
+        services = await resolve_tenant_services(tenant_id)
+        inbox = await services["inbox"].update(
+            id, name, field_mapping, status, rotate_token, require_signature, rotate_signing_secret, dry_run
+        )
+        include_secret = bool(require_signature or rotate_signing_secret) and not dry_run
+        return Success(_dry_run_result({"email_inbox": inbox.to_dict(include_secret=include_secret)}, dry_run))
+    except Exception as e:
+        return _handle_error(e)
+
+
+@method
+async def delete_email_inbox(id: str, tenant_id: str) -> Result:
+    """Delete an email inbox."""
+    try:
+        services = await resolve_tenant_services(tenant_id)
+        await services["inbox"].delete(id)
+        return Success({})
+    except Exception as e:
+        return _handle_error(e)
+
+
+@method
+async def list_email_inboxes(tenant_id: str, pagination: Dict[str, Any] = None) -> Result:
+    """List email inboxes for a tenant."""
+    try:
+        page_size = 10
+        page_token = ""
+        if pagination:
+            page_size = pagination.get("page_size", 10)
+            page_token = pagination.get("page_token", "")
+
+        services = await resolve_tenant_services(tenant_id)
+        inboxes, result = await services["inbox"].list(page_size, page_token)
+        return Success({
+            "email_inboxes": [i.to_dict() for i in inboxes],
+            "pagination": result.to_dict(),
+        })
+    except Exception as e:
+        return _handle_error(e)
+
+
+@method
+async def list_email_attachments(tenant_id: str, node_id: str) -> Result:
+    """List the attachments stored for a node created from an email (metadata only)."""
+    try:
+        services = await resolve_tenant_services(tenant_id)
+        attachments = await services["inbox"].list_attachments(node_id)
+        return Success({"attachments": [a.to_dict() for a in attachments]})
+    except Exception as e:
+        return _handle_error(e)
+
+
+@method
+async def get_email_attachment(id: str, tenant_id: str) -> Result:
+    """Get an email attachment with its base64-encoded content."""
+    try:
+        services = await resolve_tenant_services(tenant_id)
+        attachment = await services["inbox"].get_attachment(id)
+        return Success({"attachment": attachment.to_dict(include_content=True)})
+    except Exception as e:
+        return _handle_error(e)
+
+
+# ============================================================================
+# Node Attachment Methods (bytes are uploaded and downloaded on /stream/attachments)
+# ============================================================================
+
+@method
+async def list_attachments(tenant_id: str, node_id: str) -> Result:
+    """List the attachments of a node (metadata only), oldest first."""
+    try:
+        services = await resolve_tenant_services(tenant_id)
+        attachments = await services["attachments"].list(node_id)
+        return Success({"attachments": [a.to_dict() for a in attachments]})
+    except Exception as e:
+        return _handle_error(e)
+
+
+@method
+async def get_attachment(id: str, tenant_id: str) -> Result:
+    """Get an attachment's metadata; its bytes are downloaded from /stream/attachments/{id}."""
+    try:
+        services = await resolve_tenant_services(tenant_id)
+        attachment = await services["attachments"].get(id)
+        return Success({"attachment": attachment.to_dict()})
+    except Exception as e:
+        return _handle_error(e)
+
+
+@method
+async def delete_attachment(id: str, tenant_id: str) -> Result:
+    """Delete an attachment and its bytes."""
+    try:
+        services = await resolve_tenant_services(tenant_id)
+        attachment = await services["attachments"].delete(id)
+        return Success({"attachment": attachment.to_dict()})
     except Exception as e:
         return _handle_error(e)
 
@@ -185,6 +185,9 @@ def generate_openrpc_spec() -> Dict[str, Any]:
                     },
                     {
                         "$ref": "#/components/errors/ValidationError"
+                    },
+                    {
+                        "$ref": "#/components/errors/ConflictError"
                     }
                 ]
             })
@@ -222,56 +225,90 @@ def generate_openrpc_spec() -> Dict[str, Any]:
                     "code": -32700,
                     "message": "Parse error",
                     "data": {
-                        "type": "string",
-                        "description": "Error details"
+                        "type": "object",
+                        "description": "google.rpc status details: an ErrorInfo with the reason, then "
+                                       "a BadRequest with the field violations of invalid params",
+                        "properties": {"details": {"type": "array", "items": {"type": "object"}}}
                     }
                 },
                 "InvalidRequest": {
                     "code": -32600,
                     "message": "Invalid Request",
                     "data": {
-                        "type": "string",
-                        "description": "Error details"
+                        "type": "object",
+                        "description": "google.rpc status details: an ErrorInfo with the reason, then "
+                                       "a BadRequest with the field violations of invalid params",
+                        "properties": {"details": {"type": "array", "items": {"type": "object"}}}
                     }
                 },
                 "MethodNotFound": {
                     "code": -32601,
                     "message": "Method not found",
                     "data": {
-                        "type": "string",
-                        "description": "Error details"
+                        "type": "object",
+                        "description": "google.rpc status details: an ErrorInfo with the reason, then "
+                                       "a BadRequest with the field violations of invalid params",
+                        "properties": {"details": {"type": "array", "items": {"type": "object"}}}
                     }
                 },
                 "InvalidParams": {
                     "code": -32602,
                     "message": "Invalid params",
                     "data": {
-                        "type": "string",
-                        "description": "Error details"
+                        "type": "object",
+                        "description": "google.rpc status details: an ErrorInfo with the reason, then "
+                                       "a BadRequest with the field violations of invalid params",
+                        "properties": {"details": {"type": "array", "items": {"type": "object"}}}
                     }
                 },
                 "InternalError": {
                     "code": -32603,
                     "message": "Internal error",
                     "data": {
-                        "type": "string",
-                        "description": "Error details"
+                        "type": "object",
+                        "description": "google.rpc status details: an ErrorInfo with the reason, then "
+                                       "a BadRequest with the field violations of invalid params",
+                        "properties": {"details": {"type": "array", "items": {"type": "object"}}}
                     }
                 },
                 "NotFoundError": {
                     "code": -32001,
                     "message": "Resource not found",
                     "data": {
-                        "type": "string",
-                        "description": "Error details"
+                        "type": "object",
+                        "description": "google.rpc status details: an ErrorInfo with the reason, then "
+                                       "a BadRequest with the field violations of invalid params",
+                        "properties": {"details": {"type": "array", "items": {"type": "object"}}}
                     }
                 },
                 "ValidationError": {
                     "code": -32002,
                     "message": "Validation error",
                     "data": {
-                        "type": "string",
-                        "description": "Error details"
+                        "type": "object",
+                        "description": "google.rpc status details: an ErrorInfo with the reason, then "
+                                       "a BadRequest with the field violations of invalid params",
+                        "properties": {"details": {"type": "array", "items": {"type": "object"}}}
+                    }
+                },
+                "ConflictError": {
+                    "code": -32003,
+                    "message": "Conflict",
+                    "data": {
+                        "type": "object",
+                        "description": "google.rpc status details: an ErrorInfo with the reason, then "
+                                       "a BadRequest with the field violations of invalid params",
+                        "properties": {"details": {"type": "array", "items": {"type": "object"}}}
+                    }
+                },
+                "FailedPreconditionError": {
+                    "code": -32005,
+                    "message": "Failed precondition",
+                    "data": {
+                        "type": "object",
+                        "description": "google.rpc status details: an ErrorInfo with the reason, then "
+                                       "a BadRequest with the field violations of invalid params",
+                        "properties": {"details": {"type": "array", "items": {"type": "object"}}}
                     }
                 }
             }
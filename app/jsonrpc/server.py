@@ -2,36 +2,474 @@
 JSON-RPC server implementation using FastAPI.
 """
 
+import asyncio
+import hmac
 import json
 import logging
+import math
+from typing import Any, Callable, List, Optional
+from urllib.parse import parse_qsl, quote
+
 from fastapi import APIRouter, Request, Response, status
+from fastapi.responses import StreamingResponse
 from jsonrpcserver import async_dispatch
+from jsonrpcserver.methods import global_methods
+
+from app.api.dependencies import check_tenant_available, resolve_tenant_services
+from app.jsonrpc.handlers import FAILED_PRECONDITION_CODE
+from app.jsonrpc.analytics import ANALYTICS_METHOD_PREFIX, analytics_enabled, analytics_methods
+from app.jsonrpc.batch import set_batch_dispatcher
+from app.auth import (
+    ADMIN_KEY,
+    API_KEY,
+    PERMISSION_DENIED_CODE,
+    USER,
+    PermissionDeniedError,
+    Principal,
+    authorize,
+    check_access,
+    current_principal,
+    set_principal,
+)
+from app.auth.tokens import InvalidTokenError, TokenSigner, looks_like_token
+from app.config import (
+    AuthConfig,
+    ConcurrencyLimitConfig,
+    IntakeConfig,
+    LoadShedConfig,
+    LoggingConfig,
+    MetricsConfig,
+    PluginConfig,
+    RateLimitConfig,
+)
+from app.db.replicas import CONSISTENCY_HEADER, replica_routed, start_read_session
+from app.db.rls import tenant_scoped
+from app.events.schemas import list_event_schemas
+from app.events.signing import SIGNATURE_HEADER, verify_signature
+from app.intake import (
+    CAPTCHA_FIELDS,
+    EMAIL_PROVIDERS,
+    SNS_MESSAGE_TYPE_HEADER,
+    CaptchaVerifier,
+    RateLimiter,
+    confirm_sns_subscription,
+    parse_mime,
+    parse_sendgrid,
+    parse_ses_notification,
+)
+from app.logs import current_request_id, log_calls
+from app.metrics import (
+    COST_HEADER,
+    OPENMETRICS_CONTENT_TYPE,
+    PROMETHEUS_CONTENT_TYPE,
+    RpcMetrics,
+    generate_rules,
+    instrument,
+    start_request_cost,
+    to_yaml,
+)
+from app.plugins import (
+    AFTER_AUTHORIZATION,
+    BEFORE_AUTHORIZATION,
+    INNERMOST,
+    OUTERMOST,
+    intercept,
+    intercept_stream,
+    load_plugins,
+    register_interceptor,
+    register_stream_interceptor,
+    set_request,
+)
+from app.quotas import (
+    RESOURCE_EXHAUSTED_CODE,
+    UNAVAILABLE_CODE,
+    ConcurrencyLimiter,
+    LoadShedder,
+    QuotaSource,
+    TenantRateLimiter,
+    set_rate_limiter,
+)
+from app.repository import (
+    BULK_IMPORT,
+    ConflictError,
+    FailedPreconditionError,
+    ImportProgress,
+    NotFoundError,
+    ValidationError,
+)
+from app.repository.ids import new_id
+from app.service import ApiKeyService, AuthGuard
+from app.service.operation_service import bulk_job_operation
+from app.service.transfer_service import IMPORT_STALE_SECONDS, ON_CONFLICT_FAIL
 
 logger = logging.getLogger(__name__)
 
 router = APIRouter()
 
+# Longest accepted line of a tenant import
+MAX_IMPORT_LINE_BYTES = 16 * 1024 * 1024
+# Names the operation of a tenant import
+OPERATION_HEADER = "X-FlexDB-Operation"
+# Methods whose queries may read a replica (see app/db/replicas.py)
+REPLICA_READ_METHODS = frozenset({
+    "get_node", "batch_get_nodes", "list_nodes", "count_nodes", "aggregate_nodes",
+    "get_relationship", "list_relationships",
+    "get_node_type", "batch_get_node_types", "list_node_types", "describe_tenant_schema",
+    "batch",
+})
+
+# Public intake form protection (configured by main.py)
+_intake_cfg = IntakeConfig()
+_intake_limiter = RateLimiter()
+_captcha_verifier = CaptchaVerifier(_intake_cfg)
+
+
+def configure_intake(cfg: IntakeConfig, captcha_verifier: Optional[CaptchaVerifier] = None) -> None:
+    """Set the public intake form configuration and reset rate limits."""
+    global _intake_cfg, _intake_limiter, _captcha_verifier
+    _intake_cfg = cfg
+    _intake_limiter = RateLimiter()
+    _captcha_verifier = captcha_verifier or CaptchaVerifier(cfg)
+
+
+# JSON-RPC method metrics and authentication (configured by main.py)
+_metrics = RpcMetrics()
+_logging_cfg = LoggingConfig()
+_auth_cfg = AuthConfig()
+_api_key_service: Optional[ApiKeyService] = None
+_auth_guard: Optional[AuthGuard] = None
+_token_signer: Optional[TokenSigner] = None
+_rpc_methods = global_methods
+_analytics_rpc_methods = analytics_methods
+
+
+def configure_metrics(cfg: MetricsConfig) -> None:
+    """Set the metrics configuration and instrument the registered JSON-RPC methods."""
+    global _metrics
+    _metrics = RpcMetrics(cfg)
+    _wrap_methods()
+
+
+def configure_call_logging(cfg: LoggingConfig) -> None:
+    """Set the logging configuration and log calls of the registered JSON-RPC methods if enabled."""
+    global _logging_cfg
+    _logging_cfg = cfg
+    _wrap_methods()
+
+
+def add_metrics_collector(collector: Callable[[bool], List[str]]) -> None:
+    """Export the lines collector renders at /metrics too (see RpcMetrics.add_collector)."""
+    _metrics.add_collector(collector)
+
+
+def configure_auth(
+    cfg: AuthConfig,
+    api_key_service: Optional[ApiKeyService],
+    auth_guard: Optional[AuthGuard] = None,
+) -> None:
+    """
+    Set the authentication configuration, brute-force protection and anomaly
+    detection, and authorize the registered JSON-RPC methods.
+    """
+    global _auth_cfg, _api_key_service, _auth_guard, _token_signer
+    _auth_cfg = cfg
+    _api_key_service = api_key_service
+    _auth_guard = auth_guard
+    _token_signer = TokenSigner(cfg.jwt_secret, cfg.jwt_ttl, cfg.jwt_issuer) if cfg.jwt_secret else None
+    _wrap_methods()
+
+
+def configure_plugins(cfg: PluginConfig) -> None:
+    """Import the plugin modules and insert the interceptors they registered into the method chain."""
+    load_plugins(cfg.modules)
+    _wrap_methods()
+
+
+def configure_rate_limits(cfg: RateLimitConfig, quotas: Optional[QuotaSource] = None) -> None:
+    """
+    Set the rate limits per tenant and per API key and, if enabled, insert
+    them into the method and streaming chains (see app/quotas/limiter.py).
+    """
+    limiter = TenantRateLimiter(cfg, quotas)
+    set_rate_limiter(limiter)
+    if not cfg.enabled:
+        return
+
+    async def limit_stream(call, call_next):
+        rejection = await limiter.check(call.params)
+        if rejection:
+            error = _error(RESOURCE_EXHAUSTED_CODE, rejection.message)
+            error["data"] = {**rejection.data(), **error.get("data", {})}
+            return Response(
+                content=json.dumps({"error": error}),
+                media_type="application/json",
+                status_code=status.HTTP_429_TOO_MANY_REQUESTS,
+                headers={"Retry-After": str(max(1, math.ceil(rejection.retry_after)))},
+            )
+        return await call_next()
+
+    # Ahead of plugin interceptors at the same position, so rejected calls cost as little as possible
+    register_interceptor("rate_limit", limiter.intercept, AFTER_AUTHORIZATION, order=-100)
+    register_stream_interceptor("rate_limit", limit_stream, order=-100)
+    add_metrics_collector(limiter.metric_lines)
+    _wrap_methods()
+
+
+def configure_load_shedding(cfg: LoadShedConfig) -> None:
+    """
+    If enabled, insert load shedding of low-priority calls while the database
+    is saturated into the method and streaming chains, ahead of rate limits
+    (see app/quotas/shedding.py). Uses the SLO set by configure_metrics.
+    """
+    if not cfg.enabled:
+        return
+    shedder = LoadShedder(cfg, _metrics.cfg)
+
+    async def shed_stream(call, call_next):
+        shed = shedder.check(call.method)
+        if shed:
+            error = _error(UNAVAILABLE_CODE, shed.message)
+            error["data"] = {**shed.data(), **error.get("data", {})}
+            return Response(
+                content=json.dumps({"error": error}),
+                media_type="application/json",
+                status_code=status.HTTP_503_SERVICE_UNAVAILABLE,
+                headers={"Retry-After": str(max(1, math.ceil(shed.retry_after)))},
+            )
+        return await call_next()
+
+    register_interceptor("load_shed", shedder.intercept, AFTER_AUTHORIZATION, order=-200)
+    register_stream_interceptor("load_shed", shed_stream, order=-200)
+    add_metrics_collector(shedder.metric_lines)
+    _wrap_methods()
+
+
+def configure_concurrency_limits(cfg: ConcurrencyLimitConfig) -> None:
+    """
+    If enabled, insert adaptive concurrency limits per method into the method
+    chain, after rate limits (see app/quotas/concurrency.py).
+    """
+    if not cfg.enabled:
+        return
+    limiter = ConcurrencyLimiter(cfg)
+    register_interceptor("concurrency_limit", limiter.intercept, AFTER_AUTHORIZATION, order=-50)
+    add_metrics_collector(limiter.metric_lines)
+    _wrap_methods()
+
+
+def _wrap_methods() -> None:
+    global _rpc_methods, _analytics_rpc_methods
+    rpc_methods = replica_routed(tenant_scoped(global_methods), REPLICA_READ_METHODS)
+    analytics_rpc_methods = tenant_scoped(analytics_methods)
+    # Plugin interceptors at each position (see app/plugins/hooks.py)
+    rpc_methods = intercept(rpc_methods, INNERMOST)
+    analytics_rpc_methods = intercept(analytics_rpc_methods, INNERMOST)
+    if _metrics.cfg.enabled:
+        rpc_methods = instrument(rpc_methods, _metrics)
+        analytics_rpc_methods = instrument(analytics_rpc_methods, _metrics)
+    rpc_methods = intercept(rpc_methods, AFTER_AUTHORIZATION)
+    analytics_rpc_methods = intercept(analytics_rpc_methods, AFTER_AUTHORIZATION)
+    rpc_methods = intercept(authorize(rpc_methods), BEFORE_AUTHORIZATION)
+    analytics_rpc_methods = intercept(
+        authorize(analytics_rpc_methods, prefix=ANALYTICS_METHOD_PREFIX), BEFORE_AUTHORIZATION
+    )
+    if _logging_cfg.log_calls:
+        # Outside authorization, so calls denied by it are logged too
+        rpc_methods = log_calls(rpc_methods)
+        analytics_rpc_methods = log_calls(analytics_rpc_methods)
+    _rpc_methods = intercept(rpc_methods, OUTERMOST)
+    _analytics_rpc_methods = intercept(analytics_rpc_methods, OUTERMOST)
+
+
+def _request_key(request: Request) -> str:
+    """Return the API key or login token of a request, from "Authorization: Bearer <key>" or X-API-Key."""
+    key = request.headers.get("x-api-key", "")
+    authorization = request.headers.get("authorization", "")
+    if not key and authorization[:7].lower() == "bearer ":
+        key = authorization[7:].strip()
+    return key
+
+
+async def _check_authentication(request: Request) -> Optional[Response]:
+    """
+    Authenticate a request and set its principal; returns the error response
+    if that failed. Clients locked out after failed attempts are rejected
+    before their key is checked.
+    """
+    key = _request_key(request)
+    client_ip = _client_ip(request, _auth_cfg.trust_forwarded_for)
+    set_request(request.headers, client_ip)
+    if key and _auth_guard:
+        retry_after = _auth_guard.retry_after(client_ip, key)
+        if retry_after > 0:
+            return _locked_out(retry_after)
+
+    principal = await _authenticate(key)
+    if principal is None:
+        if key and _auth_guard:
+            await _auth_guard.failed(client_ip, key)
+        return _unauthorized()
+    if key and _auth_guard:
+        await _auth_guard.succeeded(client_ip, principal.api_key)
+    return None
+
+
+async def _authenticate(key: str) -> Optional[Principal]:
+    """
+    Authenticate a request by its API key or a user's login token and set its
+    principal. Returns None if the key or token is invalid, or missing while
+    authentication is required.
+    """
+    if not key:
+        principal = None if _auth_cfg.required else Principal()
+    elif _auth_cfg.admin_key and hmac.compare_digest(key.encode("utf-8"), _auth_cfg.admin_key.encode("utf-8")):
+        principal = Principal(kind=ADMIN_KEY)
+    elif _token_signer and looks_like_token(key):
+        try:
+            claims = _token_signer.verify(key)
+        except InvalidTokenError:
+            principal = None
+        else:
+            roles = {membership["tenant_id"]: membership["role"] for membership in claims.get("tenants", [])}
+            principal = Principal(kind=USER, user_id=claims["sub"], roles=roles)
+    else:
+        api_key = await _api_key_service.authenticate(key) if _api_key_service else None
+        principal = Principal(kind=API_KEY, api_key=api_key) if api_key else None
+
+    if principal:
+        set_principal(principal)
+    return principal
+
+
+def _error(code: int, message: str) -> dict:
+    """Return a JSON-RPC error object carrying the request ID in its data."""
+    error = {"code": code, "message": message}
+    request_id = current_request_id()
+    if request_id:
+        error["data"] = {"request_id": request_id}
+    return error
+
+
+def _serialize(response: Any) -> str:
+    """
+    Serialize a dispatched JSON-RPC response, adding the request ID to the
+    data of its errors on the way, so responses are encoded only once.
+    """
+    request_id = current_request_id()
+    if request_id:
+        for item in response if isinstance(response, list) else [response]:
+            error = item.get("error") if isinstance(item, dict) else None
+            if not isinstance(error, dict):
+                continue
+            data = error.get("data")
+            if data is None:
+                error["data"] = {"request_id": request_id}
+            elif isinstance(data, dict):
+                data.setdefault("request_id", request_id)
+    return json.dumps(response)
+
+
+def _locked_out(retry_after: float) -> Response:
+    return Response(
+        content=json.dumps({"error": _error(-32000, "too many failed authentication attempts")}),
+        media_type="application/json",
+        status_code=status.HTTP_429_TOO_MANY_REQUESTS,
+        headers={"Retry-After": str(max(1, int(retry_after + 0.5)))},
+    )
+
+
+def _unauthorized() -> Response:
+    return Response(
+        content=json.dumps({"error": _error(-32000, "missing or invalid API key")}),
+        media_type="application/json",
+        status_code=status.HTTP_401_UNAUTHORIZED,
+        headers={"WWW-Authenticate": "Bearer"},
+    )
+
+
+async def _authorize_stream(request: Request, method: str, params: dict) -> Optional[Response]:
+    """
+    Authenticate and authorize a streaming endpoint and check its tenant is not
+    suspended; returns the error response if denied.
+    """
+    error = await _check_authentication(request)
+    if error:
+        return error
+    try:
+        await check_access(current_principal(), method, params)
+    except PermissionDeniedError as e:
+        return Response(
+            content=json.dumps({"error": _error(PERMISSION_DENIED_CODE, str(e))}),
+            media_type="application/json",
+            status_code=status.HTTP_403_FORBIDDEN,
+        )
+    try:
+        await check_tenant_available(params["tenant_id"])
+    except NotFoundError as e:
+        return Response(
+            content=json.dumps({"error": _error(-32001, str(e))}),
+            media_type="application/json",
+            status_code=status.HTTP_404_NOT_FOUND,
+        )
+    except FailedPreconditionError as e:
+        return Response(
+            content=json.dumps({"error": _error(FAILED_PRECONDITION_CODE, str(e))}),
+            media_type="application/json",
+            status_code=status.HTTP_409_CONFLICT,
+        )
+    return None
+
 
 @router.post("/jsonrpc")
 async def handle_jsonrpc(request: Request) -> Response:
     """Handle JSON-RPC requests."""
+    return await _dispatch_jsonrpc(request, _rpc_methods)
+
+
+@router.post("/analytics/jsonrpc")
+async def handle_analytics_jsonrpc(request: Request) -> Response:
+    """
+    Handle read-only analytics JSON-RPC requests.
+
+    Served from read replicas only, with relaxed page size and timeout
+    limits for BI extracts. Returns 404 unless the analytics endpoint is
+    enabled.
+    """
+    if not analytics_enabled():
+        return Response(status_code=status.HTTP_404_NOT_FOUND)
+    return await _dispatch_jsonrpc(request, _analytics_rpc_methods)
+
+
+async def _dispatch_jsonrpc(request: Request, methods: dict) -> Response:
+    """Dispatch a JSON-RPC request body to methods."""
+    error = await _check_authentication(request)
+    if error:
+        return error
+    cost = start_request_cost()
+    start_read_session(request.headers.get(CONSISTENCY_HEADER, ""))
     try:
         body = await request.body()
         body_str = body.decode('utf-8')
-        response = await async_dispatch(body_str)
+        response = await async_dispatch(body_str, methods=methods, serializer=_serialize)
         
         if response is None:
             # Notification (no response needed)
+            _metrics.observe_cost(cost)
             return Response(status_code=status.HTTP_204_NO_CONTENT)
         
+        content = response.encode("utf-8")
+        cost.bytes = len(content)
+        _metrics.observe_cost(cost)
+        headers = {COST_HEADER: cost.header()} if _metrics.cfg.cost_header else None
         return Response(
-            content=response,
+            content=content,
             media_type="application/json",
+            headers=headers,
         )
     except json.JSONDecodeError:
         error_response = {
             "jsonrpc": "2.0",
-            "error": {"code": -32700, "message": "Parse error"},
+            "error": _error(-32700, "Parse error"),
             "id": None,
         }
         return Response(
@@ -43,7 +481,7 @@ async def handle_jsonrpc(request: Request) -> Response:
         logger.exception("Error handling JSON-RPC request")
         error_response = {
             "jsonrpc": "2.0",
-            "error": {"code": -32603, "message": str(e)},
+            "error": _error(-32603, str(e)),
             "id": None,
         }
         return Response(
@@ -53,6 +491,60 @@ async def handle_jsonrpc(request: Request) -> Response:
         )
 
 
+async def dispatch_local(body: str, principal: Principal) -> Optional[str]:
+    """
+    Dispatch a JSON-RPC request body in-process, through the same method
+    chain as POST /jsonrpc, on behalf of principal (see app/embedded).
+    Returns the response body, or None for notifications.
+    """
+    async def dispatch() -> Optional[str]:
+        set_principal(principal)
+        set_request({}, "")
+        return await async_dispatch(body, methods=_rpc_methods)
+
+    # A task runs in a copy of the caller's context, so the principal and the
+    # tenant the call acts on don't leak into the caller
+    return await asyncio.create_task(dispatch())
+
+
+async def _dispatch_batched(body: str) -> Optional[str]:
+    """Dispatch a request of a batch (see app/jsonrpc/batch.py) on behalf of the batch's caller."""
+    return await async_dispatch(body, methods=_rpc_methods)
+
+
+set_batch_dispatcher(_dispatch_batched)
+
+
+@router.get("/metrics")
+async def get_metrics(request: Request) -> Response:
+    """
+    Expose JSON-RPC request, latency and SLI metrics in the Prometheus text format.
+
+    Scrapers accepting application/openmetrics-text get the OpenMetrics
+    format, which includes tenant exemplars on the latency histograms.
+    """
+    if not _metrics.cfg.enabled:
+        return Response(status_code=status.HTTP_404_NOT_FOUND)
+    if "application/openmetrics-text" in request.headers.get("accept", ""):
+        return Response(content=_metrics.render(openmetrics=True), media_type=OPENMETRICS_CONTENT_TYPE)
+    return Response(content=_metrics.render(), media_type=PROMETHEUS_CONTENT_TYPE)
+
+
+@router.get("/metrics/rules")
+async def get_metrics_rules() -> Response:
+    """
+    Get Prometheus recording and alerting rules for the JSON-RPC SLOs.
+
+    The rules cover every registered method and use the configured SLO
+    objectives. Save the response as a rule file and reference it from
+    rule_files in prometheus.yml.
+    """
+    if not _metrics.cfg.enabled:
+        return Response(status_code=status.HTTP_404_NOT_FOUND)
+    rules = generate_rules(global_methods.keys(), _metrics.cfg)
+    return Response(content=to_yaml(rules), media_type="application/yaml")
+
+
 @router.get("/openrpc.json")
 async def get_openrpc_spec() -> Response:
     """
@@ -83,3 +575,505 @@ async def get_openrpc_spec() -> Response:
             media_type="application/json",
             status_code=status.HTTP_500_INTERNAL_SERVER_ERROR,
         )
+
+
+@router.get("/events/schemas")
+async def get_event_schemas() -> Response:
+    """
+    Get the event schema registry: every version of the JSON Schema of each
+    event type's payload, as list_event_schemas returns it. Events carry the
+    version their payload has (see app/events/schemas.py).
+    """
+    schemas = [schema.to_dict() for schema in list_event_schemas()]
+    return Response(content=json.dumps({"schemas": schemas}), media_type="application/json")
+
+
+@router.get("/stream/nodes")
+async def stream_nodes(request: Request, tenant_id: str, node_type_id: str = "", batch_size: int = 500) -> Response:
+    """
+    Stream all nodes of a tenant as newline-delimited JSON.
+
+    Each line is a node object, newest first. Unlike list_nodes there is no
+    pagination: the server reads through a database cursor and writes nodes as
+    they are fetched. If the stream fails midway, the last line is an
+    {"error": {...}} object instead of a node.
+    """
+    params = {"tenant_id": tenant_id, "node_type_id": node_type_id}
+    denied = await _authorize_stream(request, "stream.nodes", params)
+    if denied:
+        return denied
+
+    async def respond() -> Response:
+        services = await resolve_tenant_services(tenant_id)
+        try:
+            nodes = services["node"].stream(node_type_id or None, batch_size)
+        except ValueError as e:
+            return Response(
+                content=json.dumps({"error": _error(-32602, str(e))}),
+                media_type="application/json",
+                status_code=status.HTTP_400_BAD_REQUEST,
+            )
+
+        async def body():
+            try:
+                async for node in nodes:
+                    yield json.dumps(node.to_dict()) + "\n"
+            except Exception as e:
+                logger.exception("Error streaming nodes")
+                yield json.dumps({"error": _error(-32603, str(e))}) + "\n"
+
+        return StreamingResponse(body(), media_type="application/x-ndjson")
+
+    return await intercept_stream("stream.nodes", params, respond)
+
+
+@router.get("/stream/export")
+async def export_tenant(request: Request, tenant_id: str, batch_size: int = 500) -> Response:
+    """
+    Export all node types, nodes and relationships of a tenant as newline-delimited JSON.
+
+    The first line is a header, followed by node types, nodes and
+    relationships, read from one consistent snapshot. The output can be
+    uploaded to /stream/import. If the export fails midway, the last line is
+    an {"error": {...}} object.
+    """
+    params = {"tenant_id": tenant_id}
+    denied = await _authorize_stream(request, "stream.export", params)
+    if denied:
+        return denied
+
+    async def respond() -> Response:
+        services = await resolve_tenant_services(tenant_id)
+        try:
+            records = services["transfer"].export(tenant_id, batch_size)
+        except ValueError as e:
+            return Response(
+                content=json.dumps({"error": _error(-32602, str(e))}),
+                media_type="application/json",
+                status_code=status.HTTP_400_BAD_REQUEST,
+            )
+
+        async def body():
+            try:
+                async for record in records:
+                    yield json.dumps(record) + "\n"
+            except Exception as e:
+                logger.exception("Error exporting tenant")
+                yield json.dumps({"error": _error(-32603, str(e))}) + "\n"
+
+        return StreamingResponse(body(), media_type="application/x-ndjson")
+
+    return await intercept_stream("stream.export", params, respond)
+
+
+@router.post("/stream/import")
+async def import_tenant(
+    tenant_id: str,
+    request: Request,
+    batch_size: int = 500,
+    dry_run: bool = False,
+    resume: str = "",
+    on_conflict: str = ON_CONFLICT_FAIL,
+    report: bool = False
+) -> Response:
+    """
+    Import an NDJSON export into a tenant.
+
+    The upload is read as it arrives and committed in transactions of
+    batch_size records. The response streams a {"progress": {...}} line after
+    each committed batch and ends with {"result": {...}}, or with an
+    {"error": {...}, "progress": {...}, "operation": "..."} line if a record
+    is invalid. Batches committed before an error are kept. dry_run validates
+    the upload and counts what it would create without writing, ending with
+    {"result": {...}, "dry_run": true}.
+
+    on_conflict (fail, skip, overwrite or merge_patch) handles nodes having
+    the values of an existing node for a unique key of their node type; fail
+    ends the import with a conflict error line naming the line. With report,
+    each progress line also lists the outcome of each record of the batch
+    in "rows".
+
+    The import runs as an operation of kind imports, named in the
+    X-FlexDB-Operation response header, whose progress (bytes read out of the
+    Content-Length, if given) can be read and which can be cancelled: it then
+    stops after the batch being committed and ends with a failed precondition
+    error line. A failed, cancelled or interrupted import is resumed by
+    uploading the same export again with resume=<job id>: the lines committed
+    before are checked against the checkpoint and skipped, and the import
+    continues with the batch size and on_conflict it was started with. An
+    upload not starting with those lines ends with a failed precondition
+    error line.
+    """
+    params = {"tenant_id": tenant_id}
+    denied = await _authorize_stream(request, "stream.import", params)
+    if denied:
+        return denied
+
+    async def respond() -> Response:
+        if resume and dry_run:
+            return _stream_error(ValidationError("dry_run", "can't be combined with resume"))
+        services = await resolve_tenant_services(tenant_id)
+        jobs = services["bulk_jobs"]
+        lines = _ndjson_lines(request)
+        try:
+            if resume:
+                # A dry run committed nothing, so its checkpoint can't be skipped over
+                if (await jobs.get_by_id(resume)).params.get("dry_run"):
+                    return _stream_error(FailedPreconditionError(f"import {resume} was a dry run and can't be resumed"))
+                job = await jobs.resume(resume, BULK_IMPORT, IMPORT_STALE_SECONDS)
+                checkpoint = ImportProgress.from_dict(job.progress or {})
+                batches = services["transfer"].import_lines(
+                    lines,
+                    job.params["batch_size"],
+                    key=job.params.get("key", ""),
+                    resume=checkpoint,
+                    on_conflict=job.params.get("on_conflict", ON_CONFLICT_FAIL),
+                    report=report,
+                )
+            else:
+                key = new_id()
+                batches = services["transfer"].import_lines(
+                    lines, batch_size, dry_run, key, on_conflict=on_conflict, report=report
+                )
+                job = await jobs.start(
+                    BULK_IMPORT,
+                    {"batch_size": batch_size, "dry_run": dry_run, "key": key, "on_conflict": on_conflict},
+                    _content_length(request),
+                    unit="bytes",
+                )
+        except (NotFoundError, FailedPreconditionError, ValueError) as e:
+            if resume and isinstance(e, ValueError):
+                await jobs.finish(job, str(e))
+            return _stream_error(e)
+        operation = bulk_job_operation(job).name
+
+        async def body():
+            progress = None
+            try:
+                async for progress in batches:
+                    processed = min(progress.bytes, job.total) if job.total is not None else progress.bytes
+                    if not await jobs.report(job, processed, progress=progress.to_dict()):
+                        # Cancelled: stop after the batch just committed
+                        await batches.aclose()
+                        yield json.dumps({
+                            "error": _error(FAILED_PRECONDITION_CODE, f"import {job.id} was cancelled"),
+                            "progress": progress.to_dict(),
+                            "operation": operation,
+                        }) + "\n"
+                        return
+                    line = {"progress": progress.to_dict()}
+                    if report:
+                        line["rows"] = [row.to_dict() for row in progress.rows]
+                    yield json.dumps(line) + "\n"
+            except ValueError as e:
+                await jobs.finish(job, str(e))
+                yield json.dumps({
+                    "error": _error(-32602, str(e)),
+                    "progress": progress.to_dict() if progress else None,
+                    "operation": operation,
+                }) + "\n"
+                return
+            except FailedPreconditionError as e:
+                await jobs.finish(job, str(e))
+                yield json.dumps({
+                    "error": _error(FAILED_PRECONDITION_CODE, str(e)),
+                    "progress": progress.to_dict() if progress else None,
+                    "operation": operation,
+                }) + "\n"
+                return
+            except ConflictError as e:
+                await jobs.finish(job, str(e))
+                yield json.dumps({
+                    "error": _error(-32003, str(e)),
+                    "progress": progress.to_dict() if progress else None,
+                    "operation": operation,
+                }) + "\n"
+                return
+            except Exception as e:
+                logger.exception("Error importing tenant")
+                await jobs.finish(job, str(e))
+                yield json.dumps({
+                    "error": _error(-32603, str(e)),
+                    "progress": progress.to_dict() if progress else None,
+                    "operation": operation,
+                }) + "\n"
+                return
+            except BaseException:
+                # The client went away
+                await jobs.finish(job, "import was interrupted")
+                raise
+            await jobs.finish(job)
+            result = {"result": progress.to_dict() if progress else ImportProgress().to_dict()}
+            yield json.dumps({**result, "dry_run": True} if dry_run else result) + "\n"
+
+        return StreamingResponse(
+            body(),
+            media_type="application/x-ndjson",
+            headers={OPERATION_HEADER: operation},
+        )
+
+    return await intercept_stream("stream.import", params, respond)
+
+
+@router.post("/stream/attachments")
+async def upload_attachment(request: Request, tenant_id: str, node_id: str, filename: str) -> Response:
+    """
+    Upload an attachment of a node.
+
+    The request body is the file, streamed into the blob store as it arrives,
+    and its Content-Type is recorded with it. Responds 201 with
+    {"attachment": {...}}, whose sha256 the client can check.
+    """
+    params = {"tenant_id": tenant_id, "node_id": node_id}
+    denied = await _authorize_stream(request, "stream.upload_attachment", params)
+    if denied:
+        return denied
+
+    async def respond() -> Response:
+        services = await resolve_tenant_services(tenant_id)
+        content_type = request.headers.get("content-type", "")
+        try:
+            attachment = await services["attachments"].upload(node_id, filename, content_type, request.stream())
+        except (NotFoundError, FailedPreconditionError, ValueError) as e:
+            return _stream_error(e)
+        return Response(
+            content=json.dumps({"attachment": attachment.to_dict()}),
+            media_type="application/json",
+            status_code=status.HTTP_201_CREATED,
+        )
+
+    return await intercept_stream("stream.upload_attachment", params, respond)
+
+
+@router.get("/stream/attachments/{id}")
+async def download_attachment(request: Request, id: str, tenant_id: str) -> Response:
+    """
+    Download an attachment's bytes, streamed from the blob store, with its
+    Content-Type and filename (Content-Disposition).
+    """
+    params = {"tenant_id": tenant_id, "id": id}
+    denied = await _authorize_stream(request, "stream.download_attachment", params)
+    if denied:
+        return denied
+
+    async def respond() -> Response:
+        services = await resolve_tenant_services(tenant_id)
+        try:
+            attachment, chunks = await services["attachments"].download(id)
+            # Read the first chunk before responding, so a missing blob is a 404
+            first = await anext(chunks, b"")
+        except (NotFoundError, FailedPreconditionError, ValueError) as e:
+            return _stream_error(e)
+
+        async def body():
+            yield first
+            async for chunk in chunks:
+                yield chunk
+
+        return StreamingResponse(
+            body(),
+            media_type=attachment.content_type,
+            headers={
+                "Content-Length": str(attachment.size_bytes),
+                "Content-Disposition": f"attachment; filename*=UTF-8''{quote(attachment.filename)}",
+                "X-Checksum-Sha256": attachment.sha256,
+            },
+        )
+
+    return await intercept_stream("stream.download_attachment", params, respond)
+
+
+def _stream_error(e: Exception) -> Response:
+    """The error response of a stream request refused before streaming."""
+    if isinstance(e, NotFoundError):
+        code, http_status = -32001, status.HTTP_404_NOT_FOUND
+    elif isinstance(e, FailedPreconditionError):
+        code, http_status = FAILED_PRECONDITION_CODE, status.HTTP_409_CONFLICT
+    else:
+        code, http_status = -32602, status.HTTP_400_BAD_REQUEST
+    return Response(
+        content=json.dumps({"error": _error(code, str(e))}), media_type="application/json", status_code=http_status
+    )
+
+
+def _content_length(request: Request) -> Optional[int]:
+    """The size of a request body, if the client sent it."""
+    try:
+        return int(request.headers["content-length"])
+    except (KeyError, ValueError):
+        return None
+
+
+async def _ndjson_lines(request: Request):
+    """Split a streamed request body into lines."""
+    buffer = b""
+    async for chunk in request.stream():
+        buffer += chunk
+        if len(buffer) > MAX_IMPORT_LINE_BYTES and b"\n" not in buffer:
+            raise ValueError(f"line exceeds {MAX_IMPORT_LINE_BYTES} bytes")
+        *lines, buffer = buffer.split(b"\n")
+        for line in lines:
+            yield line.decode("utf-8")
+    if buffer:
+        yield buffer.decode("utf-8")
+
+
+def _public_error(message: str, http_status: int, headers: Optional[dict] = None) -> Response:
+    return Response(
+        content=json.dumps({"error": {"message": message}}),
+        media_type="application/json",
+        status_code=http_status,
+        headers=headers,
+    )
+
+
+def _client_ip(request: Request, trust_forwarded_for: bool) -> str:
+    if trust_forwarded_for:
+        forwarded = request.headers.get("x-forwarded-for", "")
+        if forwarded:
+            return forwarded.split(",")[0].strip()
+    return request.client.host if request.client else ""
+
+
+def _signature_valid(secret: str, request: Request, body: bytes) -> bool:
+    """Check the signature of a request to an endpoint with secret; unsigned endpoints pass."""
+    if not secret:
+        return True
+    header = request.headers.get(SIGNATURE_HEADER, "")
+    return verify_signature(secret, header, body, _intake_cfg.signature_tolerance)
+
+
+def _too_many_requests(key: str) -> Response:
+    retry_after = max(1, int(_intake_limiter.retry_after(key) + 0.5))
+    return _public_error(
+        "too many submissions, try again later",
+        status.HTTP_429_TOO_MANY_REQUESTS,
+        headers={"Retry-After": str(retry_after)},
+    )
+
+
+@router.post("/public/tenants/{tenant_id}/forms/{token}")
+async def submit_intake_form(tenant_id: str, token: str, request: Request) -> Response:
+    """
+    Accept an anonymous submission to a public intake form.
+
+    The body is a JSON object or an application/x-www-form-urlencoded form
+    post. Submissions are rate limited per client IP, both overall and per
+    form, and must carry a valid captcha response when the form requires one
+    and a valid X-FlexDB-Signature header when it requires signatures.
+    On success a node of the form's node type is created and its ID returned.
+    """
+    client_ip = _client_ip(request, _intake_cfg.trust_forwarded_for)
+    ip_key = f"ip:{client_ip}"
+    if not _intake_limiter.allow(ip_key, _intake_cfg.ip_rate_limit_per_minute):
+        return _too_many_requests(ip_key)
+
+    body = await request.body()
+    if len(body) > _intake_cfg.max_body_bytes:
+        return _public_error("submission is too large", status.HTTP_413_REQUEST_ENTITY_TOO_LARGE)
+
+    url_encoded = request.headers.get("content-type", "").startswith("application/x-www-form-urlencoded")
+    try:
+        if url_encoded:
+            data = dict(parse_qsl(body.decode("utf-8"), keep_blank_values=True))
+        else:
+            data = json.loads(body or b"{}")
+            if not isinstance(data, dict):
+                raise ValueError("submission must be a JSON object")
+    except ValueError as e:
+        # json.JSONDecodeError and UnicodeDecodeError are ValueErrors
+        return _public_error(f"invalid submission: {e}", status.HTTP_400_BAD_REQUEST)
+
+    captcha_token = ""
+    for name in CAPTCHA_FIELDS:
+        value = data.pop(name, None)
+        if value and not captcha_token:
+            captcha_token = str(value)
+
+    try:
+        services = await resolve_tenant_services(tenant_id)
+        form = await services["intake"].get_active_by_token(token)
+    except (NotFoundError, FailedPreconditionError):
+        # Forms of suspended tenants are unavailable
+        return _public_error("form not found", status.HTTP_404_NOT_FOUND)
+
+    if not _signature_valid(form.signing_secret, request, body):
+        return _public_error("invalid or missing signature", status.HTTP_401_UNAUTHORIZED)
+
+    form_key = f"form:{tenant_id}:{form.id}:{client_ip}"
+    if not _intake_limiter.allow(form_key, form.rate_limit_per_minute):
+        return _too_many_requests(form_key)
+
+    if form.require_captcha and not await _captcha_verifier.verify(captcha_token, client_ip):
+        return _public_error("captcha verification failed", status.HTTP_403_FORBIDDEN)
+
+    try:
+        node = await services["intake"].submit(form, data, url_encoded)
+    except ValueError as e:
+        return _public_error(str(e), status.HTTP_400_BAD_REQUEST)
+    except Exception:
+        logger.exception("Error handling intake form submission")
+        return _public_error("submission failed", status.HTTP_500_INTERNAL_SERVER_ERROR)
+
+    return Response(
+        content=json.dumps({"id": node.id}),
+        media_type="application/json",
+        status_code=status.HTTP_201_CREATED,
+    )
+
+
+@router.post("/public/tenants/{tenant_id}/inboxes/{token}")
+async def receive_inbound_email(tenant_id: str, token: str, request: Request, provider: str = "sendgrid") -> Response:
+    """
+    Receive an email from a mail provider's inbound webhook and create a node.
+
+    provider selects the payload format: "sendgrid" (Inbound Parse), "ses"
+    (SES receipt notification delivered over SNS) or "raw" (an RFC 5322
+    message as the request body). Redeliveries of the same Message-ID return
+    the node created the first time. Inboxes that require signatures only
+    accept requests with a valid X-FlexDB-Signature header.
+    """
+    if provider not in EMAIL_PROVIDERS:
+        return _public_error(
+            f"provider must be one of: {', '.join(EMAIL_PROVIDERS)}", status.HTTP_400_BAD_REQUEST
+        )
+
+    body = await request.body()
+    if len(body) > _intake_cfg.max_email_bytes:
+        return _public_error("email is too large", status.HTTP_413_REQUEST_ENTITY_TOO_LARGE)
+
+    try:
+        services = await resolve_tenant_services(tenant_id)
+        inbox = await services["inbox"].get_active_by_token(token)
+    except (NotFoundError, FailedPreconditionError):
+        return _public_error("inbox not found", status.HTTP_404_NOT_FOUND)
+
+    if not _signature_valid(inbox.signing_secret, request, body):
+        return _public_error("invalid or missing signature", status.HTTP_401_UNAUTHORIZED)
+
+    try:
+        if provider == "sendgrid":
+            email = parse_sendgrid(request.headers.get("content-type", ""), body)
+        elif provider == "ses":
+            message_type, email = parse_ses_notification(body)
+            if message_type == "SubscriptionConfirmation":
+                await confirm_sns_subscription(body)
+                return Response(status_code=status.HTTP_200_OK)
+            if email is None:
+                # e.g. UnsubscribeConfirmation; nothing to ingest
+                return Response(status_code=status.HTTP_200_OK)
+        else:
+            email = parse_mime(body)
+
+        node, duplicate = await services["inbox"].ingest(inbox, email)
+    except ValueError as e:
+        return _public_error(str(e), status.HTTP_400_BAD_REQUEST)
+    except Exception:
+        logger.exception("Error ingesting inbound email")
+        return _public_error("email ingestion failed", status.HTTP_500_INTERNAL_SERVER_ERROR)
+
+    return Response(
+        content=json.dumps({"id": node.id, "duplicate": duplicate}),
+        media_type="application/json",
+        status_code=status.HTTP_200_OK if duplicate else status.HTTP_201_CREATED,
+    )
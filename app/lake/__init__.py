@@ -0,0 +1,14 @@
+"""
+Scheduled Parquet exports for data lake integration.
+"""
+
+from app.lake.storage import LocalObjectStore, ObjectStore, S3ObjectStore, object_store_from_config
+from app.lake.exporter import LakeExporter
+
+__all__ = [
+    "ObjectStore",
+    "LocalObjectStore",
+    "S3ObjectStore",
+    "object_store_from_config",
+    "LakeExporter",
+]
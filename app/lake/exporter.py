@@ -0,0 +1,236 @@
+"""
+Scheduled Parquet export of tenant nodes to object storage.
+
+Every poll, each active tenant whose last successful export is older than the
+configured interval gets a full snapshot of its nodes written as:
+
+    <prefix>/<tenant_id>/snapshots/<started_at>/<node_type>/dt=<YYYY-MM-DD>/part-00000.parquet
+    <prefix>/<tenant_id>/snapshots/<started_at>/_manifest.json
+    <prefix>/<tenant_id>/_latest.json
+
+<node_type> is the node type's BI view name, and nodes are partitioned by the
+UTC date they were created on. The manifest lists every table with its columns
+and files; it is written after all files, and _latest.json (a copy of the
+newest manifest) last, so readers that start from a manifest only ever see
+complete snapshots. Runs are recorded in the tenant's lake_exports table, which
+also keeps several server instances from exporting the same tenant at once.
+Exports run as background priority jobs (see app/jobs/scheduler.py), so they
+never take workers from webhook deliveries or node migrations.
+"""
+
+import asyncio
+import json
+import logging
+import posixpath
+from datetime import datetime, timezone
+from typing import Any, Awaitable, Callable, Dict, List, Optional
+
+from app.config import JobSchedulerConfig, LakeExportConfig
+from app.db.tenant_db_manager import TenantDatabaseManager
+from app.jobs.scheduler import BACKGROUND, JobScheduler
+from app.lake.parquet import encode_parquet, node_row, table_columns, utc
+from app.lake.storage import ObjectStore
+from app.repository import (
+    BiView,
+    LakeExport,
+    LakeExportRepository,
+    NodeRepository,
+    NodeTypeRepository,
+)
+from app.service.bi_views import build_views
+
+logger = logging.getLogger(__name__)
+
+MANIFEST_FORMAT = "flexdb.lake"
+MANIFEST_FORMAT_VERSION = 1
+PARTITION_COLUMN = "dt"
+
+# A running export not heard from for this long is considered abandoned
+LEASE_SECONDS = 900.0
+
+PARQUET_CONTENT_TYPE = "application/vnd.apache.parquet"
+JSON_CONTENT_TYPE = "application/json"
+
+
+class LakeExporter:
+    """Periodically exports tenant nodes as Parquet files."""
+
+    def __init__(
+        self,
+        tenant_db_manager: TenantDatabaseManager,
+        cfg: LakeExportConfig,
+        store: ObjectStore,
+        prefix: str = "",
+        leader: Optional[Callable[[], bool]] = None,
+        scheduler: Optional[JobScheduler] = None,
+    ):
+        self.tenant_db_manager = tenant_db_manager
+        self.cfg = cfg
+        self.store = store
+        self.prefix = prefix
+        # Exports only run while this returns True, e.g. while holding a leader role
+        self.leader = leader
+        self.scheduler = scheduler or JobScheduler(JobSchedulerConfig())
+        self._task: Optional[asyncio.Task] = None
+        self._stopping = asyncio.Event()
+
+    def start(self) -> None:
+        """Start the export loop in the background."""
+        if self._task:
+            return
+        self._stopping.clear()
+        self._task = asyncio.create_task(self._run())
+
+    async def stop(self) -> None:
+        """Stop the export loop and release the object store."""
+        if self._task:
+            self._stopping.set()
+            await self._task
+            self._task = None
+        await self.store.close()
+
+    async def _run(self) -> None:
+        while not self._stopping.is_set():
+            try:
+                if self.leader is None or self.leader():
+                    await self.run_once()
+            except Exception:
+                logger.exception("Lake export poll failed")
+            try:
+                await asyncio.wait_for(self._stopping.wait(), timeout=self.cfg.poll_interval)
+            except asyncio.TimeoutError:
+                pass
+
+    async def run_once(self) -> None:
+        """Export every active tenant that is due."""
+        tenant_ids = await self.tenant_db_manager.list_active_tenant_ids()
+        await asyncio.gather(*(self._export(tenant_id) for tenant_id in tenant_ids))
+
+    async def _export(self, tenant_id: str) -> None:
+        async def export() -> bool:
+            if not self._stopping.is_set():
+                await self.export_tenant_if_due(tenant_id)
+            return False
+
+        try:
+            await self.scheduler.run(BACKGROUND, tenant_id, export)
+        except Exception:
+            logger.exception(f"Lake export failed for tenant {tenant_id}")
+
+    async def export_tenant_if_due(self, tenant_id: str) -> Optional[LakeExport]:
+        """Export one tenant unless it was exported within the interval; returns the run."""
+        tenant_db = await self.tenant_db_manager.get_tenant_db(tenant_id)
+        repo = LakeExportRepository(tenant_db)
+        export = await repo.claim_run(self.cfg.interval, LEASE_SECONDS)
+        if export is None:
+            return None
+
+        try:
+            manifest = await self.export_tenant(
+                tenant_id, export,
+                NodeTypeRepository(tenant_db), NodeRepository(tenant_db),
+                heartbeat=lambda: repo.extend_lease(export.id, LEASE_SECONDS)
+            )
+            export.status = "succeeded"
+            export.file_count = manifest["file_count"]
+            export.node_count = manifest["node_count"]
+            logger.info(
+                f"Lake export for tenant {tenant_id} wrote {export.node_count} nodes "
+                f"in {export.file_count} files"
+            )
+        except Exception as e:
+            export.status = "failed"
+            export.error = str(e) or e.__class__.__name__
+            raise
+        finally:
+            await repo.finish_run(export)
+        return export
+
+    async def export_tenant(
+        self,
+        tenant_id: str,
+        export: LakeExport,
+        node_type_repo: NodeTypeRepository,
+        node_repo: NodeRepository,
+        heartbeat: Optional[Callable[[], Awaitable[None]]] = None
+    ) -> Dict[str, Any]:
+        """
+        Write a snapshot of the tenant's nodes and its manifest; returns the manifest.
+
+        Sets export.manifest_key. heartbeat is awaited after every file written.
+        """
+        started_at = utc(export.started_at)
+        base = self._key(tenant_id, "snapshots", started_at.strftime("%Y%m%dT%H%M%SZ"))
+
+        tables = []
+        for view in build_views(await node_type_repo.list_all()):
+            tables.append(await self._export_table(base, view, node_repo, heartbeat))
+
+        manifest = {
+            "format": MANIFEST_FORMAT,
+            "version": MANIFEST_FORMAT_VERSION,
+            "tenant_id": tenant_id,
+            "export_id": export.id,
+            "started_at": started_at.isoformat(),
+            "finished_at": datetime.now(timezone.utc).isoformat(),
+            "partitioning": {"column": PARTITION_COLUMN, "source": "created_at", "granularity": "day"},
+            "tables": tables,
+            "file_count": sum(len(t["files"]) for t in tables),
+            "node_count": sum(t["row_count"] for t in tables),
+        }
+        body = json.dumps(manifest, indent=2).encode()
+        export.manifest_key = posixpath.join(base, "_manifest.json")
+        await self.store.put(export.manifest_key, body, JSON_CONTENT_TYPE)
+        await self.store.put(self._key(tenant_id, "_latest.json"), body, JSON_CONTENT_TYPE)
+        return manifest
+
+    async def _export_table(
+        self,
+        base: str,
+        view: BiView,
+        node_repo: NodeRepository,
+        heartbeat: Optional[Callable[[], Awaitable[None]]]
+    ) -> Dict[str, Any]:
+        location = posixpath.join(base, view.name)
+        files: List[Dict[str, Any]] = []
+        rows: List[Dict[str, Any]] = []
+        partition = ""
+        parts = 0
+
+        async def flush() -> None:
+            key = posixpath.join(location, f"{PARTITION_COLUMN}={partition}", f"part-{parts:05d}.parquet")
+            body = await asyncio.to_thread(encode_parquet, view.columns, rows)
+            await self.store.put(key, body, PARQUET_CONTENT_TYPE)
+            files.append({
+                "url": self.store.url(key),
+                PARTITION_COLUMN: partition,
+                "row_count": len(rows),
+                "size_bytes": len(body),
+            })
+            if heartbeat:
+                await heartbeat()
+
+        # Nodes stream newest first, so each date partition arrives in one run
+        async for node in node_repo.stream(view.node_type_id, self.cfg.batch_size):
+            date = utc(node.created_at).date().isoformat()
+            if rows and (date != partition or len(rows) >= self.cfg.rows_per_file):
+                await flush()
+                parts = parts + 1 if date == partition else 0
+                rows = []
+            partition = date
+            rows.append(node_row(node, view.columns))
+        if rows:
+            await flush()
+
+        return {
+            "name": view.name,
+            "node_type_id": view.node_type_id,
+            "node_type_name": view.node_type_name,
+            "location": self.store.url(location + "/"),
+            "columns": table_columns(view.columns),
+            "row_count": sum(f["row_count"] for f in files),
+            "files": files,
+        }
+
+    def _key(self, *parts: str) -> str:
+        return posixpath.join(self.prefix, *parts) if self.prefix else posixpath.join(*parts)
@@ -0,0 +1,139 @@
+"""
+Parquet encoding of nodes.
+
+Each node type is exported as a table whose columns are derived from its
+schema the same way as the BI views (see app/service/bi_views.py): id,
+created_at, updated_at and version, one column per schema field, and the raw
+data as JSON text. Column kinds map to Parquet types as follows:
+
+    text, jsonb   string (jsonb columns hold JSON text)
+    numeric       double
+    bigint        int64
+    boolean       boolean
+
+Values that don't match the declared type are written as null.
+
+pyarrow is only required when lake exports are enabled.
+"""
+
+import io
+import json
+import re
+from datetime import datetime, timezone
+from typing import Any, Dict, List
+
+from app.repository import BiViewColumn, Node
+from app.repository.bi_view_repo import NODE_VIEW_COLUMNS
+
+try:
+    import pyarrow
+    import pyarrow.parquet
+except ImportError:  # only required for lake exports
+    pyarrow = None
+
+# Manifest type names of the fixed and schema-derived columns
+FIXED_COLUMN_TYPES = {
+    "id": "string",
+    "created_at": "timestamp[us, UTC]",
+    "updated_at": "timestamp[us, UTC]",
+    "version": "int64",
+}
+COLUMN_TYPES = {
+    "text": "string",
+    "jsonb": "string",
+    "numeric": "double",
+    "bigint": "int64",
+    "boolean": "boolean",
+}
+DATA_COLUMN = "data"
+
+_DECIMAL_STRING = re.compile(r"^[+-]?[0-9]+(\.[0-9]+)?$")
+_MAX_BIGINT = 10 ** 18
+
+
+def table_columns(columns: List[BiViewColumn]) -> List[Dict[str, str]]:
+    """Return the name and type of every column of a node type table, in order."""
+    result = [{"name": name, "type": FIXED_COLUMN_TYPES[name]} for name in NODE_VIEW_COLUMNS]
+    result += [{"name": c.name, "type": COLUMN_TYPES.get(c.kind, "string")} for c in columns]
+    result.append({"name": DATA_COLUMN, "type": "string"})
+    return result
+
+
+def column_value(data: Any, column: BiViewColumn) -> Any:
+    """Read a column's value from node data, None if missing or of another type."""
+    value = data
+    for part in column.path:
+        if not isinstance(value, dict) or part not in value:
+            return None
+        value = value[part]
+    if value is None:
+        return None
+
+    if column.kind == "jsonb":
+        return json.dumps(value)
+    if column.kind == "numeric":
+        if isinstance(value, (int, float)) and not isinstance(value, bool):
+            return float(value)
+        if isinstance(value, str) and _DECIMAL_STRING.match(value):
+            return float(value)
+        return None
+    if column.kind == "bigint":
+        if isinstance(value, int) and not isinstance(value, bool) and abs(value) < _MAX_BIGINT:
+            return value
+        return None
+    if column.kind == "boolean":
+        return value if isinstance(value, bool) else None
+    return value if isinstance(value, str) else json.dumps(value)
+
+
+def node_row(node: Node, columns: List[BiViewColumn]) -> Dict[str, Any]:
+    """Convert a node into a table row."""
+    try:
+        data = json.loads(node.data)
+    except ValueError:
+        data = {}
+    row = {
+        "id": node.id,
+        "created_at": utc(node.created_at),
+        "updated_at": utc(node.updated_at),
+        "version": node.version,
+    }
+    for column in columns:
+        row[column.name] = column_value(data, column)
+    row[DATA_COLUMN] = node.data
+    return row
+
+
+def utc(value: datetime) -> datetime:
+    """Return a timestamp in UTC; naive timestamps are taken to be UTC already."""
+    if value.tzinfo is None:
+        return value.replace(tzinfo=timezone.utc)
+    return value.astimezone(timezone.utc)
+
+
+def encode_parquet(columns: List[BiViewColumn], rows: List[Dict[str, Any]]) -> bytes:
+    """Encode table rows as a Snappy-compressed Parquet file."""
+    if pyarrow is None:
+        raise RuntimeError("lake exports require the pyarrow package")
+
+    schema = pyarrow.schema([
+        (column["name"], _arrow_type(column["type"])) for column in table_columns(columns)
+    ])
+    table = pyarrow.table(
+        {field.name: [row[field.name] for row in rows] for field in schema},
+        schema=schema,
+    )
+    buffer = io.BytesIO()
+    pyarrow.parquet.write_table(table, buffer, compression="snappy")
+    return buffer.getvalue()
+
+
+def _arrow_type(name: str) -> Any:
+    if name.startswith("timestamp"):
+        return pyarrow.timestamp("us", tz="UTC")
+    return {
+        "string": pyarrow.string(),
+        "double": pyarrow.float64(),
+        "int64": pyarrow.int64(),
+        "boolean": pyarrow.bool_(),
+    }[name]
@@ -0,0 +1,387 @@
+"""
+Object storage for lake exports.
+
+Exports are written to S3, to Google Cloud Storage through its S3-compatible
+XML API (with HMAC keys), to any other S3-compatible store such as MinIO, or
+to a local directory. Requests to S3-compatible stores are signed with AWS
+Signature Version 4.
+
+Objects put with a retention date are write-once: S3 stores them under Object
+Lock in compliance mode (the bucket must have Object Lock enabled), and the
+local store makes the file read-only and refuses to replace it with different
+content.
+
+Objects too large to hold in memory are uploaded in parts with S3 multipart
+uploads: create_upload, then upload_part for each part (at least 5 MiB except
+the last on S3), then complete_upload, which joins the parts in order. Parts
+already uploaded survive a crash, so an upload can be continued with its ID;
+abort_upload discards it. Unfinished uploads are kept by the bucket until
+aborted, so give it a lifecycle rule expiring them. The local store keeps
+parts as files next to the object.
+"""
+
+import asyncio
+import base64
+import hashlib
+import hmac
+import os
+import re
+import shutil
+import uuid
+from datetime import datetime, timezone
+from typing import Dict, List, Optional, Sequence, Tuple, Union
+from urllib.parse import quote, urlsplit
+from xml.sax.saxutils import escape
+
+import httpx
+
+from app.config import AuditExportConfig, ExportStorageConfig, LakeExportConfig
+
+GCS_ENDPOINT = "https://storage.googleapis.com"
+
+_ALGORITHM = "AWS4-HMAC-SHA256"
+
+
+class ObjectStore:
+    """Writes objects under a key prefix."""
+
+    async def put(self, key: str, body: bytes, content_type: str, retain_until: Optional[datetime] = None) -> None:
+        """
+        Store body under key, replacing any existing object. With retain_until
+        the object can't be changed or deleted before then.
+        """
+        raise NotImplementedError
+
+    async def get(self, key: str) -> Optional[bytes]:
+        """Return the object stored under key, or None if there is none."""
+        raise NotImplementedError
+
+    def url(self, key: str) -> str:
+        """Return the URL of an object, as recorded in manifests."""
+        raise NotImplementedError
+
+    async def create_upload(self, key: str, content_type: str) -> str:
+        """Start a multipart upload of an object; returns the upload ID."""
+        raise NotImplementedError
+
+    async def upload_part(self, key: str, upload_id: str, number: int, body: bytes) -> str:
+        """Upload part number (from 1) of a multipart upload, replacing it if uploaded before; returns its ETag."""
+        raise NotImplementedError
+
+    async def complete_upload(self, key: str, upload_id: str, parts: Sequence[Tuple[int, str]]) -> None:
+        """Store the parts, given as (number, ETag) in order, as the object under key."""
+        raise NotImplementedError
+
+    async def abort_upload(self, key: str, upload_id: str) -> None:
+        """Discard a multipart upload and its parts."""
+        raise NotImplementedError
+
+    async def close(self) -> None:
+        """Release resources held by the store."""
+
+
+class LocalObjectStore(ObjectStore):
+    """Stores objects as files below a root directory."""
+
+    def __init__(self, root: str):
+        self.root = root
+
+    async def put(self, key: str, body: bytes, content_type: str, retain_until: Optional[datetime] = None) -> None:
+        """Write the object, atomically replacing an existing file unless it is retained."""
+        await asyncio.to_thread(self._write, key, body, retain_until is not None)
+
+    async def get(self, key: str) -> Optional[bytes]:
+        """Read the object's file."""
+        return await asyncio.to_thread(self._read, key)
+
+    def url(self, key: str) -> str:
+        """Return the file:// URL of an object."""
+        return "file://" + os.path.join(self.root, key)
+
+    async def create_upload(self, key: str, content_type: str) -> str:
+        """Create the directory holding the upload's parts."""
+        upload_id = uuid.uuid4().hex
+        await asyncio.to_thread(os.makedirs, self._upload_dir(key, upload_id))
+        return upload_id
+
+    async def upload_part(self, key: str, upload_id: str, number: int, body: bytes) -> str:
+        """Write the part's file; its ETag is the MD5 of its content, as on S3."""
+        await asyncio.to_thread(self._write_part, key, upload_id, number, body)
+        return hashlib.md5(body).hexdigest()
+
+    async def complete_upload(self, key: str, upload_id: str, parts: Sequence[Tuple[int, str]]) -> None:
+        """Concatenate the part files into the object's file and remove them."""
+        await asyncio.to_thread(self._complete, key, upload_id, [number for number, _ in parts])
+
+    async def abort_upload(self, key: str, upload_id: str) -> None:
+        """Remove the upload's parts."""
+        await asyncio.to_thread(self._remove_upload, key, upload_id)
+
+    def _write(self, key: str, body: bytes, retain: bool) -> None:
+        path = os.path.join(self.root, key)
+        os.makedirs(os.path.dirname(path), exist_ok=True)
+        if retain and os.path.exists(path):
+            if self._read(key) != body:
+                raise RuntimeError(f"{key} is retained and can't be replaced")
+            return
+        tmp = path + ".tmp"
+        with open(tmp, "wb") as f:
+            f.write(body)
+        if retain:
+            os.chmod(tmp, 0o444)
+        os.replace(tmp, path)
+
+    def _read(self, key: str) -> Optional[bytes]:
+        try:
+            with open(os.path.join(self.root, key), "rb") as f:
+                return f.read()
+        except FileNotFoundError:
+            return None
+
+    def _upload_dir(self, key: str, upload_id: str) -> str:
+        return os.path.join(self.root, key + ".uploads", upload_id)
+
+    def _write_part(self, key: str, upload_id: str, number: int, body: bytes) -> None:
+        directory = self._upload_dir(key, upload_id)
+        if not os.path.isdir(directory):
+            raise RuntimeError(f"no upload {upload_id} of {key}")
+        tmp = os.path.join(directory, f"{number}.tmp")
+        with open(tmp, "wb") as f:
+            f.write(body)
+        os.replace(tmp, os.path.join(directory, str(number)))
+
+    def _complete(self, key: str, upload_id: str, numbers: List[int]) -> None:
+        directory = self._upload_dir(key, upload_id)
+        path = os.path.join(self.root, key)
+        tmp = path + ".tmp"
+        try:
+            with open(tmp, "wb") as out:
+                for number in numbers:
+                    with open(os.path.join(directory, str(number)), "rb") as part:
+                        shutil.copyfileobj(part, out)
+        except FileNotFoundError:
+            os.remove(tmp)
+            raise RuntimeError(f"part {number} of upload {upload_id} of {key} is missing") from None
+        os.replace(tmp, path)
+        self._remove_upload(key, upload_id)
+
+    def _remove_upload(self, key: str, upload_id: str) -> None:
+        directory = self._upload_dir(key, upload_id)
+        shutil.rmtree(directory, ignore_errors=True)
+        try:
+            os.rmdir(os.path.dirname(directory))
+        except OSError:
+            # Other uploads of the key are in progress
+            pass
+
+
+class S3ObjectStore(ObjectStore):
+    """Stores objects in an S3-compatible bucket."""
+
+    def __init__(
+        self,
+        scheme: str,
+        bucket: str,
+        endpoint: str,
+        region: str,
+        access_key_id: str,
+        secret_access_key: str,
+        client: httpx.AsyncClient
+    ):
+        self.scheme = scheme
+        self.bucket = bucket
+        self.endpoint = endpoint.rstrip("/")
+        self.region = region
+        self.access_key_id = access_key_id
+        self.secret_access_key = secret_access_key
+        self._client = client
+
+    async def put(self, key: str, body: bytes, content_type: str, retain_until: Optional[datetime] = None) -> None:
+        """Upload the object with a signed PUT request, under Object Lock if retained."""
+        url = self._request_url(key)
+        headers = {"Content-Type": content_type}
+        if retain_until is not None:
+            # Object Lock requires an integrity checksum on uploads
+            headers["Content-MD5"] = base64.b64encode(hashlib.md5(body).digest()).decode()
+            headers["x-amz-object-lock-mode"] = "COMPLIANCE"
+            headers["x-amz-object-lock-retain-until-date"] = (
+                retain_until.astimezone(timezone.utc).strftime("%Y-%m-%dT%H:%M:%SZ")
+            )
+        headers = sign_request(
+            "PUT", url, headers, hashlib.sha256(body).hexdigest(),
+            self.access_key_id, self.secret_access_key, self.region
+        )
+        response = await self._client.put(url, content=body, headers=headers)
+        if response.status_code // 100 != 2:
+            raise RuntimeError(f"upload of {key} failed with status {response.status_code}: {response.text[:200]}")
+
+    async def get(self, key: str) -> Optional[bytes]:
+        """Download the object with a signed GET request."""
+        url = self._request_url(key)
+        headers = sign_request(
+            "GET", url, {}, hashlib.sha256(b"").hexdigest(),
+            self.access_key_id, self.secret_access_key, self.region
+        )
+        response = await self._client.get(url, headers=headers)
+        if response.status_code == 404:
+            return None
+        if response.status_code // 100 != 2:
+            raise RuntimeError(f"download of {key} failed with status {response.status_code}: {response.text[:200]}")
+        return response.content
+
+    def url(self, key: str) -> str:
+        """Return the s3:// or gs:// URL of an object."""
+        return f"{self.scheme}://{self.bucket}/{key}"
+
+    async def create_upload(self, key: str, content_type: str) -> str:
+        """Start the upload with a signed POST ?uploads request."""
+        response = await self._send("POST", key, "uploads", b"", {"Content-Type": content_type}, "start of upload")
+        match = re.search(r"<UploadId>([^<]+)</UploadId>", response.text)
+        if not match:
+            raise RuntimeError(f"start of upload of {key} returned no upload ID: {response.text[:200]}")
+        return match.group(1)
+
+    async def upload_part(self, key: str, upload_id: str, number: int, body: bytes) -> str:
+        """Upload the part with a signed PUT ?partNumber&uploadId request."""
+        query = f"partNumber={number}&uploadId={quote(upload_id, safe='')}"
+        response = await self._send("PUT", key, query, body, {}, f"upload of part {number}")
+        return response.headers.get("ETag", "")
+
+    async def complete_upload(self, key: str, upload_id: str, parts: Sequence[Tuple[int, str]]) -> None:
+        """Complete the upload with a signed POST ?uploadId request listing the parts."""
+        body = "".join(
+            f"<Part><PartNumber>{number}</PartNumber><ETag>{escape(etag)}</ETag></Part>" for number, etag in parts
+        )
+        body = f"<CompleteMultipartUpload>{body}</CompleteMultipartUpload>".encode()
+        query = f"uploadId={quote(upload_id, safe='')}"
+        response = await self._send(
+            "POST", key, query, body, {"Content-Type": "application/xml"}, "completion of upload"
+        )
+        # Failures after the request was accepted are reported in a 200 response
+        if "<Error>" in response.text:
+            raise RuntimeError(f"completion of upload of {key} failed: {response.text[:200]}")
+
+    async def abort_upload(self, key: str, upload_id: str) -> None:
+        """Abort the upload with a signed DELETE ?uploadId request."""
+        await self._send("DELETE", key, f"uploadId={quote(upload_id, safe='')}", b"", {}, "abort of upload")
+
+    async def close(self) -> None:
+        """Close the HTTP client."""
+        await self._client.aclose()
+
+    async def _send(
+        self, method: str, key: str, query: str, body: bytes, headers: Dict[str, str], action: str
+    ) -> httpx.Response:
+        url = f"{self._request_url(key)}?{query}"
+        headers = sign_request(
+            method, url, headers, hashlib.sha256(body).hexdigest(),
+            self.access_key_id, self.secret_access_key, self.region
+        )
+        response = await self._client.request(method, url, content=body, headers=headers)
+        if response.status_code // 100 != 2:
+            raise RuntimeError(f"{action} of {key} failed with status {response.status_code}: {response.text[:200]}")
+        return response
+
+    def _request_url(self, key: str) -> str:
+        if self.endpoint:
+            # Path-style addressing works with GCS, MinIO and other S3-compatible stores
+            return f"{self.endpoint}/{self.bucket}/{quote(key)}"
+        return f"https://{self.bucket}.s3.{self.region}.amazonaws.com/{quote(key)}"
+
+
+def split_url(url: str) -> tuple:
+    """Split a destination URL into scheme, bucket (empty for file://) and key prefix."""
+    parts = urlsplit(url)
+    if parts.scheme == "file":
+        return "file", "", parts.path
+    if parts.scheme not in ("s3", "gs") or not parts.netloc:
+        raise ValueError(f"unsupported export destination: {url} (expected s3://, gs:// or file://)")
+    return parts.scheme, parts.netloc, parts.path.strip("/")
+
+
+def object_store_from_config(
+    cfg: Union[LakeExportConfig, AuditExportConfig, ExportStorageConfig],
+    env_prefix: str = "LAKE_EXPORT"
+) -> tuple:
+    """
+    Create the object store for the configured destination; returns (store,
+    key prefix). env_prefix names the configuration's environment variables
+    in errors.
+    """
+    scheme, bucket, prefix = split_url(cfg.url)
+    if scheme == "file":
+        return LocalObjectStore(prefix), ""
+
+    endpoint = cfg.endpoint
+    region = cfg.region
+    if scheme == "gs" and not endpoint:
+        endpoint = GCS_ENDPOINT
+        region = "auto"
+    if not cfg.access_key_id or not cfg.secret_access_key:
+        raise ValueError(f"{env_prefix}_ACCESS_KEY_ID and {env_prefix}_SECRET_ACCESS_KEY are required")
+
+    store = S3ObjectStore(
+        scheme, bucket, endpoint, region, cfg.access_key_id, cfg.secret_access_key,
+        httpx.AsyncClient(timeout=cfg.timeout)
+    )
+    return store, prefix
+
+
+def sign_request(
+    method: str,
+    url: str,
+    headers: Dict[str, str],
+    payload_hash: str,
+    access_key_id: str,
+    secret_access_key: str,
+    region: str,
+    service: str = "s3",
+    now: Optional[datetime] = None
+) -> Dict[str, str]:
+    """
+    Sign a request with AWS Signature Version 4.
+
+    Returns the headers to send: the given ones plus Host, X-Amz-Date,
+    X-Amz-Content-Sha256 and Authorization.
+    """
+    now = now or datetime.now(timezone.utc)
+    amz_date = now.strftime("%Y%m%dT%H%M%SZ")
+    date = amz_date[:8]
+    parts = urlsplit(url)
+
+    signed = {name.lower(): " ".join(value.split()) for name, value in headers.items()}
+    signed["host"] = parts.netloc
+    signed["x-amz-date"] = amz_date
+    signed["x-amz-content-sha256"] = payload_hash
+    names = sorted(signed)
+
+    # The URL is expected to be encoded already, so path and query are used as is
+    query = "&".join(sorted(item if "=" in item else item + "=" for item in parts.query.split("&") if item))
+    canonical_request = "\n".join([
+        method,
+        parts.path or "/",
+        query,
+        "".join(f"{name}:{signed[name]}\n" for name in names),
+        ";".join(names),
+        payload_hash,
+    ])
+
+    scope = f"{date}/{region}/{service}/aws4_request"
+    string_to_sign = "\n".join([
+        _ALGORITHM, amz_date, scope, hashlib.sha256(canonical_request.encode()).hexdigest()
+    ])
+
+    key = f"AWS4{secret_access_key}".encode()
+    for part in (date, region, service, "aws4_request"):
+        key = hmac.new(key, part.encode(), hashlib.sha256).digest()
+    signature = hmac.new(key, string_to_sign.encode(), hashlib.sha256).hexdigest()
+
+    result = dict(headers)
+    result["Host"] = parts.netloc
+    result["X-Amz-Date"] = amz_date
+    result["X-Amz-Content-Sha256"] = payload_hash
+    result["Authorization"] = (
+        f"{_ALGORITHM} Credential={access_key_id}/{scope}, "
+        f"SignedHeaders={';'.join(names)}, Signature={signature}"
+    )
+    return result
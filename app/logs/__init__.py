@@ -0,0 +1,30 @@
+"""
+Structured logging with request context.
+"""
+
+from app.logs.context import (
+    REQUEST_ID_HEADER,
+    accept_request_id,
+    current_context,
+    current_request_id,
+    log_context,
+    new_request_id,
+)
+from app.logs.formatting import ContextFilter, JsonFormatter, TextFormatter, configure_logging
+from app.logs.calls import log_calls
+from app.logs.middleware import RequestIdMiddleware
+
+__all__ = [
+    "REQUEST_ID_HEADER",
+    "accept_request_id",
+    "current_context",
+    "current_request_id",
+    "log_context",
+    "new_request_id",
+    "ContextFilter",
+    "JsonFormatter",
+    "TextFormatter",
+    "configure_logging",
+    "log_calls",
+    "RequestIdMiddleware",
+]
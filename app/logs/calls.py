@@ -0,0 +1,48 @@
+"""
+JSON-RPC call logging.
+"""
+
+import functools
+import logging
+import time
+from typing import Callable, Dict, Optional
+
+from app.logs.context import log_context
+from app.metrics.registry import INTERNAL_ERROR_CODE, result_code
+
+logger = logging.getLogger(__name__)
+
+
+def log_calls(methods: Dict[str, Callable]) -> Dict[str, Callable]:
+    """
+    Wrap JSON-RPC methods so every call is logged with its method, tenant,
+    latency and result code (0 on success), and records logged while it runs
+    carry the method and tenant.
+    """
+    return {name: _logged(name, func) for name, func in methods.items()}
+
+
+def _logged(name: str, func: Callable) -> Callable:
+    # functools.wraps keeps the signature visible to jsonrpcserver's params validation
+    @functools.wraps(func)
+    async def wrapper(*args, **kwargs):
+        tenant_id = kwargs.get("tenant_id") or ""
+        if not isinstance(tenant_id, str):
+            tenant_id = ""
+
+        with log_context(method=name, tenant_id=tenant_id):
+            start = time.perf_counter()
+            code: Optional[int] = INTERNAL_ERROR_CODE
+            try:
+                result = await func(*args, **kwargs)
+                code = result_code(result)
+                return result
+            finally:
+                duration_ms = round((time.perf_counter() - start) * 1000, 3)
+                logger.log(
+                    logging.ERROR if code == INTERNAL_ERROR_CODE else logging.INFO,
+                    "%s %s", name, "ok" if code is None else f"failed ({code})",
+                    extra={"duration_ms": duration_ms, "code": code or 0},
+                )
+
+    return wrapper
@@ -0,0 +1,55 @@
+"""
+Request context of log records.
+
+Fields bound with log_context (the request ID, JSON-RPC method, tenant) are
+added to every record logged by the enclosed code, including by repositories
+and services that know nothing about the request, and by tasks it starts.
+"""
+
+import re
+import uuid
+from contextlib import contextmanager
+from contextvars import ContextVar
+from typing import Any, Dict, Iterator
+
+# Header carrying the request ID, accepted from clients and echoed in responses
+REQUEST_ID_HEADER = "x-request-id"
+
+# Accepted client request IDs: UUIDs, trace IDs and similar tokens
+_REQUEST_ID_PATTERN = re.compile(r"[A-Za-z0-9._:-]{1,128}")
+
+_context: ContextVar[Dict[str, Any]] = ContextVar("flexdb_log_context", default={})
+
+
+def current_context() -> Dict[str, Any]:
+    """Return the fields bound to the current context."""
+    return dict(_context.get())
+
+
+@contextmanager
+def log_context(**fields: Any) -> Iterator[None]:
+    """Add fields to the records logged by the enclosed code; empty values are skipped."""
+    token = _context.set({**_context.get(), **{k: v for k, v in fields.items() if v not in (None, "")}})
+    try:
+        yield
+    finally:
+        _context.reset(token)
+
+
+def current_request_id() -> str:
+    """Return the ID of the request being handled, or "" outside of requests."""
+    return _context.get().get("request_id", "")
+
+
+def new_request_id() -> str:
+    """Return a new random request ID."""
+    return uuid.uuid4().hex
+
+
+def accept_request_id(value: str) -> str:
+    """
+    Return the request ID sent by a client, so its calls can be correlated
+    across services, or a new one if it sent none or one that isn't a short
+    token safe to log.
+    """
+    return value if value and _REQUEST_ID_PATTERN.fullmatch(value) else new_request_id()
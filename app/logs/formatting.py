@@ -0,0 +1,85 @@
+"""
+Log record formats.
+
+LOG_FORMAT=json writes one JSON object per line, for log pipelines:
+
+    {"time": "2026-05-14T09:00:00.123Z", "level": "INFO", "logger": "app.logs.calls",
+     "message": "get_node ok", "request_id": "...", "method": "get_node", ...}
+
+LOG_FORMAT=text (the default) keeps the human-readable format, with the same
+fields appended as key=value pairs. Fields come from the request context (see
+app.logs.context) and from extra={...} passed to the logging call.
+"""
+
+import json
+import logging
+from datetime import datetime, timezone
+from typing import Any, Dict
+
+from app.config import LoggingConfig
+from app.logs.context import current_context
+
+# Attributes every LogRecord has; anything else was passed as extra
+_RECORD_ATTRIBUTES = set(vars(logging.LogRecord("", 0, "", 0, "", None, None))) | {"message", "asctime", "context"}
+
+TEXT_FORMAT = "%(asctime)s - %(levelname)s - %(message)s"
+TEXT_DATE_FORMAT = "%Y-%m-%d %H:%M:%S"
+
+
+class ContextFilter(logging.Filter):
+    """Attach the request context to records as record.context."""
+
+    def filter(self, record: logging.LogRecord) -> bool:
+        record.context = current_context()
+        return True
+
+
+def _fields(record: logging.LogRecord) -> Dict[str, Any]:
+    fields = dict(getattr(record, "context", None) or {})
+    fields.update({k: v for k, v in vars(record).items() if k not in _RECORD_ATTRIBUTES})
+    return fields
+
+
+class JsonFormatter(logging.Formatter):
+    """Format records as single-line JSON objects."""
+
+    def format(self, record: logging.LogRecord) -> str:
+        entry = {
+            "time": datetime.fromtimestamp(record.created, timezone.utc).isoformat(timespec="milliseconds")
+                    .replace("+00:00", "Z"),
+            "level": record.levelname,
+            "logger": record.name,
+            "message": record.getMessage(),
+        }
+        entry.update(_fields(record))
+        if record.exc_info:
+            entry["exception"] = self.formatException(record.exc_info)
+        return json.dumps(entry, default=str)
+
+
+class TextFormatter(logging.Formatter):
+    """Format records for humans, followed by their fields as key=value pairs."""
+
+    def __init__(self):
+        super().__init__(TEXT_FORMAT, TEXT_DATE_FORMAT)
+
+    def formatMessage(self, record: logging.LogRecord) -> str:
+        message = super().formatMessage(record)
+        fields = " ".join(f"{k}={v}" for k, v in _fields(record).items())
+        return f"{message} {fields}" if fields else message
+
+
+def configure_logging(cfg: LoggingConfig) -> None:
+    """Configure the root logger; uvicorn's loggers propagate to it when started with log_config=None."""
+    if cfg.format not in ("json", "text"):
+        raise ValueError(f"LOG_FORMAT must be json or text, not {cfg.format}")
+
+    handler = logging.StreamHandler()
+    handler.setFormatter(JsonFormatter() if cfg.format == "json" else TextFormatter())
+    handler.addFilter(ContextFilter())
+
+    root = logging.getLogger()
+    for existing in list(root.handlers):
+        root.removeHandler(existing)
+    root.addHandler(handler)
+    root.setLevel(cfg.level.upper())
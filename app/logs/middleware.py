@@ -0,0 +1,38 @@
+"""
+Request ID middleware.
+"""
+
+from typing import Any, Callable, Dict
+
+from app.logs.context import REQUEST_ID_HEADER, accept_request_id, log_context
+
+
+class RequestIdMiddleware:
+    """
+    Bind a request ID to every HTTP request, taken from the X-Request-ID
+    header or generated, and echo it in the X-Request-ID response header.
+
+    A plain ASGI middleware, so the ID stays bound while streaming responses
+    are written.
+    """
+
+    def __init__(self, app: Callable):
+        self.app = app
+
+    async def __call__(self, scope: Dict[str, Any], receive: Callable, send: Callable) -> None:
+        if scope["type"] != "http":
+            await self.app(scope, receive, send)
+            return
+
+        header = REQUEST_ID_HEADER.encode()
+        sent = next((value for name, value in scope["headers"] if name.lower() == header), b"")
+        request_id = accept_request_id(sent.decode("latin-1"))
+
+        async def send_with_id(message: Dict[str, Any]) -> None:
+            if message["type"] == "http.response.start":
+                headers = [(name, value) for name, value in message.get("headers", []) if name.lower() != header]
+                message = {**message, "headers": headers + [(header, request_id.encode())]}
+            await send(message)
+
+        with log_context(request_id=request_id):
+            await self.app(scope, receive, send_with_id)
@@ -0,0 +1,30 @@
+"""
+Prometheus metrics and SLO alerting rules.
+"""
+
+from app.metrics.registry import (
+    OPENMETRICS_CONTENT_TYPE,
+    PROMETHEUS_CONTENT_TYPE,
+    RpcMetrics,
+    instrument,
+    result_code,
+)
+from app.metrics.costs import COST_HEADER, RequestCost, current_cost, start_request_cost
+from app.metrics.tenants import OTHER_TENANT_LABEL, TenantLabeler
+from app.metrics.rules import generate_rules, to_yaml
+
+__all__ = [
+    "OPENMETRICS_CONTENT_TYPE",
+    "PROMETHEUS_CONTENT_TYPE",
+    "RpcMetrics",
+    "instrument",
+    "result_code",
+    "COST_HEADER",
+    "RequestCost",
+    "current_cost",
+    "start_request_cost",
+    "OTHER_TENANT_LABEL",
+    "TenantLabeler",
+    "generate_rules",
+    "to_yaml",
+]
@@ -0,0 +1,55 @@
+"""
+Request cost accounting.
+
+Every POST /jsonrpc and /analytics/jsonrpc request is metered while it runs:
+
+    db_ms  milliseconds its PostgreSQL queries took
+    rows   rows its queries returned, inserted, updated or deleted
+    bytes  bytes of its response body
+
+Rows the database scanned without returning them are not visible to the
+server, so rows is a lower bound of the work a query did; db_ms covers it.
+A request's cost is returned in the X-FlexDB-Cost response header (with
+METRICS_COST_HEADER), summed over the calls of a JSON-RPC batch:
+
+    X-FlexDB-Cost: db_ms=4.213; rows=12; bytes=3456
+
+and added to the per-tenant counters flexdb_tenant_cost_*_total of the
+tenant the request's calls named (see RpcMetrics.observe_cost).
+"""
+
+from contextvars import ContextVar
+from dataclasses import dataclass
+from typing import Optional
+
+COST_HEADER = "X-FlexDB-Cost"
+
+
+@dataclass
+class RequestCost:
+    """The resources a request consumed so far."""
+    db_seconds: float = 0.0
+    rows: int = 0
+    bytes: int = 0
+    # The tenant named by the request's calls, if any
+    tenant_id: str = ""
+
+    def header(self) -> str:
+        """Return the value of the X-FlexDB-Cost header."""
+        return f"db_ms={self.db_seconds * 1000:.3f}; rows={self.rows}; bytes={self.bytes}"
+
+
+# The cost of the request being handled; queries and instrumented methods add to it
+_cost: ContextVar[Optional[RequestCost]] = ContextVar("flexdb_request_cost", default=None)
+
+
+def start_request_cost() -> RequestCost:
+    """Start metering the current request, returning its cost."""
+    cost = RequestCost()
+    _cost.set(cost)
+    return cost
+
+
+def current_cost() -> Optional[RequestCost]:
+    """Return the cost of the request being handled, or None outside of metered requests."""
+    return _cost.get()
@@ -0,0 +1,291 @@
+"""
+Prometheus metrics for JSON-RPC methods.
+
+Every registered method is wrapped to count requests by JSON-RPC result code
+and observe their latency. Besides these raw series, two SLIs are exported per
+method as good/total counter pairs:
+
+    availability  requests that did not fail with an internal error (-32603)
+    latency       requests that completed within the latency threshold
+
+Error ratios and burn rates over time windows are left to Prometheus, see
+app.metrics.rules. Counters are kept per server instance.
+
+Tenant-scoped calls are also counted per tenant, without the method label.
+The tenant label is bounded to the busiest tenants plus "other" (see
+app.metrics.tenants); the exact tenant ID of a slow call is kept as an
+exemplar on the method latency histogram, exposed in the OpenMetrics format.
+The database time, rows and response bytes of requests are summed per tenant
+too (see app.metrics.costs).
+"""
+
+import functools
+import time
+from collections import defaultdict
+from typing import Any, Callable, Dict, List, Optional, Tuple
+
+from app.config import MetricsConfig
+from app.metrics.costs import RequestCost, current_cost
+from app.metrics.tenants import TenantLabeler
+
+try:
+    from opentelemetry import trace
+except ImportError:  # tracing is optional
+    trace = None
+
+DURATION_BUCKETS = (0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1.0, 2.5, 5.0, 10.0)
+
+INTERNAL_ERROR_CODE = -32603
+
+AVAILABILITY_SLI = "availability"
+LATENCY_SLI = "latency"
+
+OPENMETRICS_CONTENT_TYPE = "application/openmetrics-text; version=1.0.0; charset=utf-8"
+PROMETHEUS_CONTENT_TYPE = "text/plain; version=0.0.4"
+
+# (tenant ID, observed value, unix time)
+Exemplar = Tuple[str, float, float]
+
+
+def metric_family(name: str, metric_type: str, help_text: str, openmetrics: bool = False) -> List[str]:
+    """Return the HELP and TYPE lines introducing a metric family."""
+    # OpenMetrics names counter families without the _total suffix
+    if openmetrics and metric_type == "counter":
+        name = name[:-len("_total")]
+    return [f"# HELP {name} {help_text}", f"# TYPE {name} {metric_type}"]
+
+
+def result_code(result: Any) -> Optional[int]:
+    """Return the JSON-RPC error code of a method result, or None on success."""
+    # jsonrpcserver results are oslash Either values; Left carries the ErrorResult
+    error = getattr(result, "_error", None)
+    return getattr(error, "code", None)
+
+
+class _Histogram:
+    """Bucket counts, sum and per-bucket exemplars of one histogram series."""
+
+    def __init__(self, buckets: Tuple[float, ...]):
+        self.buckets = buckets
+        self.counts = [0] * len(buckets)
+        self.exemplars: List[Optional[Exemplar]] = [None] * (len(buckets) + 1)
+        self.sum = 0.0
+        self.count = 0
+
+    def observe(self, value: float, tenant_id: str = "") -> None:
+        index = len(self.buckets)
+        for i, bound in enumerate(self.buckets):
+            if value <= bound:
+                self.counts[i] += 1
+                index = min(index, i)
+        self.sum += value
+        self.count += 1
+        if tenant_id:
+            self.exemplars[index] = (tenant_id, value, time.time())
+
+    def lines(self, name: str, labels: Dict[str, str], openmetrics: bool) -> List[str]:
+        bounds = [repr(bound) for bound in self.buckets] + ["+Inf"]
+        counts = self.counts + [self.count]
+        lines = []
+        for bound, count, exemplar in zip(bounds, counts, self.exemplars):
+            line = f"{name}_bucket{_labels(**labels, le=bound)} {count}"
+            if openmetrics and exemplar:
+                tenant_id, value, timestamp = exemplar
+                line += f" # {_labels(tenant_id=tenant_id)} {value!r} {timestamp:.3f}"
+            lines.append(line)
+        lines.append(f"{name}_sum{_labels(**labels)} {self.sum!r}")
+        lines.append(f"{name}_count{_labels(**labels)} {self.count}")
+        return lines
+
+
+class RpcMetrics:
+    """Request counters, latency histograms and SLI counters per JSON-RPC method and tenant."""
+
+    def __init__(self, cfg: Optional[MetricsConfig] = None):
+        self.cfg = cfg or MetricsConfig()
+        # The threshold is always a bucket boundary so latency SLIs line up with the histogram
+        self.buckets = tuple(sorted(set(DURATION_BUCKETS) | {self.cfg.latency_threshold}))
+        self.tenants = TenantLabeler(self.cfg.tenant_label_top_n)
+        self._requests: Dict[Tuple[str, str], int] = defaultdict(int)
+        self._durations: Dict[str, _Histogram] = {}
+        self._sli_total: Dict[Tuple[str, str], int] = defaultdict(int)
+        self._sli_good: Dict[Tuple[str, str], int] = defaultdict(int)
+        self._tenant_requests: Dict[Tuple[str, str], int] = defaultdict(int)
+        self._tenant_durations: Dict[str, _Histogram] = {}
+        # (tenant, resource) -> amount, resource being "db_seconds", "rows" or "bytes"
+        self._tenant_costs: Dict[Tuple[str, str], float] = defaultdict(float)
+        self._collectors: List[Callable[[bool], List[str]]] = []
+
+    def add_collector(self, collector: Callable[[bool], List[str]]) -> None:
+        """
+        Render the lines collector returns along with the request metrics;
+        it is called with whether the OpenMetrics format is used.
+        """
+        self._collectors.append(collector)
+
+    def observe(self, method: str, code: Optional[int], duration: float, tenant_id: str = "") -> None:
+        """
+        Record a finished call. code is None on success, else the JSON-RPC error code.
+
+        tenant_id is given for tenant-scoped calls.
+        """
+        code_label = "ok" if code is None else str(code)
+        self._requests[(method, code_label)] += 1
+
+        histogram = self._durations.get(method)
+        if histogram is None:
+            histogram = self._durations[method] = _Histogram(self.buckets)
+        histogram.observe(duration, tenant_id)
+
+        for sli, good in (
+            (AVAILABILITY_SLI, code != INTERNAL_ERROR_CODE),
+            (LATENCY_SLI, duration <= self.cfg.latency_threshold),
+        ):
+            self._sli_total[(method, sli)] += 1
+            if good:
+                self._sli_good[(method, sli)] += 1
+
+        if tenant_id and self.cfg.tenant_label_top_n > 0:
+            tenant = self.tenants.label(tenant_id)
+            self._tenant_requests[(tenant, code_label)] += 1
+            histogram = self._tenant_durations.get(tenant)
+            if histogram is None:
+                histogram = self._tenant_durations[tenant] = _Histogram(self.buckets)
+            histogram.observe(duration)
+
+    def observe_cost(self, cost: RequestCost) -> None:
+        """
+        Record the cost of a finished request against the tenant its calls
+        named; requests naming no tenant are not counted.
+        """
+        if not cost.tenant_id or self.cfg.tenant_label_top_n <= 0:
+            return
+        # The request was counted towards the top tenants by observe
+        tenant = self.tenants.peek(cost.tenant_id)
+        self._tenant_costs[(tenant, "db_seconds")] += cost.db_seconds
+        self._tenant_costs[(tenant, "rows")] += cost.rows
+        self._tenant_costs[(tenant, "bytes")] += cost.bytes
+
+    def render(self, openmetrics: bool = False) -> str:
+        """
+        Render all series in the Prometheus text exposition format.
+
+        With openmetrics, the OpenMetrics format is used instead, which carries
+        the tenant exemplars.
+        """
+        self._drop_demoted_tenants()
+        lines: List[str] = []
+
+        def family(name: str, metric_type: str, help_text: str) -> None:
+            lines.extend(metric_family(name, metric_type, help_text, openmetrics))
+
+        family("flexdb_rpc_requests_total", "counter", "JSON-RPC calls by method and result code.")
+        for (method, code), value in sorted(self._requests.items()):
+            lines.append(f"flexdb_rpc_requests_total{_labels(method=method, code=code)} {value}")
+
+        family("flexdb_rpc_request_duration_seconds", "histogram", "JSON-RPC call latency by method.")
+        for method, histogram in sorted(self._durations.items()):
+            lines += histogram.lines("flexdb_rpc_request_duration_seconds", {"method": method}, openmetrics)
+
+        family("flexdb_sli_requests_total", "counter", "Calls counted towards each SLI by method.")
+        for (method, sli), value in sorted(self._sli_total.items()):
+            lines.append(f"flexdb_sli_requests_total{_labels(method=method, sli=sli)} {value}")
+
+        family("flexdb_sli_good_total", "counter", "Calls meeting each SLI by method.")
+        for (method, sli) in sorted(self._sli_total):
+            lines.append(f"flexdb_sli_good_total{_labels(method=method, sli=sli)} {self._sli_good[(method, sli)]}")
+
+        family(
+            "flexdb_tenant_rpc_requests_total", "counter",
+            'Tenant-scoped JSON-RPC calls by tenant (busiest tenants, else "other") and result code.'
+        )
+        for (tenant, code), value in sorted(self._tenant_requests.items()):
+            lines.append(f"flexdb_tenant_rpc_requests_total{_labels(tenant=tenant, code=code)} {value}")
+
+        family(
+            "flexdb_tenant_rpc_request_duration_seconds", "histogram",
+            'Tenant-scoped JSON-RPC call latency by tenant (busiest tenants, else "other").'
+        )
+        for tenant, histogram in sorted(self._tenant_durations.items()):
+            lines += histogram.lines("flexdb_tenant_rpc_request_duration_seconds", {"tenant": tenant}, openmetrics)
+
+        for resource, help_text in (
+            ("db_seconds", "Time spent in database queries"),
+            ("rows", "Rows returned or written by database queries"),
+            ("bytes", "JSON-RPC response bytes"),
+        ):
+            name = f"flexdb_tenant_cost_{resource}_total"
+            family(name, "counter", f'{help_text} by tenant (busiest tenants, else "other").')
+            for (tenant, key), value in sorted(self._tenant_costs.items()):
+                if key == resource:
+                    value = value if resource == "db_seconds" else int(value)
+                    lines.append(f"{name}{_labels(tenant=tenant)} {value!r}")
+
+        family("flexdb_slo_objective", "gauge", "Target share of good calls per SLI.")
+        lines.append(f"flexdb_slo_objective{_labels(sli=AVAILABILITY_SLI)} {self.cfg.availability_objective!r}")
+        lines.append(f"flexdb_slo_objective{_labels(sli=LATENCY_SLI)} {self.cfg.latency_objective!r}")
+        family(
+            "flexdb_slo_latency_threshold_seconds", "gauge",
+            "Latency a call must stay within to count as good."
+        )
+        lines.append(f"flexdb_slo_latency_threshold_seconds {self.cfg.latency_threshold!r}")
+
+        for collector in self._collectors:
+            lines += collector(openmetrics)
+
+        if openmetrics:
+            lines.append("# EOF")
+        return "\n".join(lines) + "\n"
+
+    def _drop_demoted_tenants(self) -> None:
+        # Series of tenants that left the top set stop being exported; their
+        # later calls are counted under "other"
+        active = self.tenants.labels()
+        for key in [key for key in self._tenant_requests if key[0] not in active]:
+            del self._tenant_requests[key]
+        for tenant in [tenant for tenant in self._tenant_durations if tenant not in active]:
+            del self._tenant_durations[tenant]
+        for key in [key for key in self._tenant_costs if key[0] not in active]:
+            del self._tenant_costs[key]
+
+
+def instrument(methods: Dict[str, Callable], metrics: RpcMetrics) -> Dict[str, Callable]:
+    """Wrap JSON-RPC methods so every call is recorded in metrics."""
+    return {name: _instrumented(name, func, metrics) for name, func in methods.items()}
+
+
+def _instrumented(name: str, func: Callable, metrics: RpcMetrics) -> Callable:
+    # functools.wraps keeps the signature visible to jsonrpcserver's params validation
+    @functools.wraps(func)
+    async def wrapper(*args, **kwargs):
+        tenant_id = kwargs.get("tenant_id") or ""
+        if not isinstance(tenant_id, str):
+            tenant_id = ""
+        cost = current_cost()
+        if tenant_id and cost is not None and not cost.tenant_id:
+            # A request's cost is counted against the first tenant its calls name
+            cost.tenant_id = tenant_id
+        if tenant_id and metrics.cfg.tenant_trace_attributes and trace is not None:
+            span = trace.get_current_span()
+            span.set_attribute("flexdb.tenant_id", tenant_id)
+            span.set_attribute("rpc.method", name)
+
+        start = time.perf_counter()
+        code: Optional[int] = INTERNAL_ERROR_CODE
+        try:
+            result = await func(*args, **kwargs)
+            code = result_code(result)
+            return result
+        finally:
+            metrics.observe(name, code, time.perf_counter() - start, tenant_id)
+
+    return wrapper
+
+
+def _labels(**labels: str) -> str:
+    pairs = ",".join(f'{key}="{_escape(value)}"' for key, value in labels.items())
+    return "{" + pairs + "}"
+
+
+def _escape(value: str) -> str:
+    return value.replace("\\", "\\\\").replace('"', '\\"').replace("\n", "\\n")
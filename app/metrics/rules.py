@@ -0,0 +1,100 @@
+"""
+Prometheus recording and alerting rules for the JSON-RPC SLOs.
+
+Rules are generated from the server's registered methods and metrics
+configuration. Recording rules compute each method's SLI error ratio over
+several windows; alerts use multiwindow, multi-burn-rate conditions: burning
+the error budget 14.4x too fast over both 1h and 5m pages (2% of a 30 day
+budget in an hour), 6x over both 6h and 30m opens a ticket.
+"""
+
+import json
+from typing import Any, Dict, Iterable, Iterator, List
+
+from app.config import MetricsConfig
+from app.metrics.registry import AVAILABILITY_SLI, LATENCY_SLI
+
+ERROR_RATIO_WINDOWS = ("5m", "30m", "1h", "6h")
+
+# (alert suffix, long window, short window, burn rate, severity)
+BURN_RATE_ALERTS = (
+    ("Fast", "1h", "5m", 14.4, "page"),
+    ("Slow", "6h", "30m", 6.0, "ticket"),
+)
+
+
+def generate_rules(methods: Iterable[str], cfg: MetricsConfig) -> Dict[str, Any]:
+    """Build a Prometheus rule file covering the given JSON-RPC methods."""
+    matcher = f'method=~"{"|".join(sorted(methods))}"'
+
+    recording: List[Dict[str, Any]] = []
+    for window in ERROR_RATIO_WINDOWS:
+        recording.append({
+            "record": f"flexdb:sli_error_ratio:rate{window}",
+            "expr": (
+                f"1 - (sum by (method, sli) (rate(flexdb_sli_good_total{{{matcher}}}[{window}]))"
+                f" / sum by (method, sli) (rate(flexdb_sli_requests_total{{{matcher}}}[{window}])))"
+            ),
+        })
+
+    alerts: List[Dict[str, Any]] = []
+    for sli, objective in (
+        (AVAILABILITY_SLI, cfg.availability_objective),
+        (LATENCY_SLI, cfg.latency_objective),
+    ):
+        budget = 1 - objective
+        for suffix, long_window, short_window, burn_rate, severity in BURN_RATE_ALERTS:
+            threshold = f"{burn_rate * budget:.6g}"
+            alerts.append({
+                "alert": f"FlexDB{sli.capitalize()}BudgetBurn{suffix}",
+                "expr": (
+                    f'flexdb:sli_error_ratio:rate{long_window}{{sli="{sli}"}} > {threshold}'
+                    f' and flexdb:sli_error_ratio:rate{short_window}{{sli="{sli}"}} > {threshold}'
+                ),
+                "labels": {"severity": severity, "sli": sli},
+                "annotations": {
+                    "summary": f"{{{{ $labels.method }}}} is burning its {sli} error budget {burn_rate:g}x too fast",
+                    "description": _describe(sli, objective, cfg, long_window, short_window),
+                },
+            })
+
+    return {
+        "groups": [
+            {"name": "flexdb-slo-recording", "rules": recording},
+            {"name": "flexdb-slo-alerts", "rules": alerts},
+        ]
+    }
+
+
+def to_yaml(value: Any) -> str:
+    """Render rules as YAML. Strings are written as JSON (double-quoted YAML) scalars."""
+    return "\n".join(_yaml_lines(value, 0)) + "\n"
+
+
+def _describe(sli: str, objective: float, cfg: MetricsConfig, long_window: str, short_window: str) -> str:
+    if sli == LATENCY_SLI:
+        target = f"{objective * 100:g}% of calls within {cfg.latency_threshold:g}s"
+    else:
+        target = f"{objective * 100:g}% of calls without internal errors"
+    return f"SLO: {target}. Error ratio over {long_window} and {short_window}: {{{{ $value | humanizePercentage }}}}."
+
+
+def _yaml_lines(value: Any, indent: int) -> Iterator[str]:
+    pad = "  " * indent
+    if isinstance(value, dict):
+        for key, item in value.items():
+            if isinstance(item, (dict, list)) and item:
+                yield f"{pad}{key}:"
+                yield from _yaml_lines(item, indent + 1)
+            else:
+                yield f"{pad}{key}: {json.dumps(item)}"
+    elif isinstance(value, list):
+        for item in value:
+            if isinstance(item, (dict, list)) and item:
+                nested = list(_yaml_lines(item, indent + 1))
+                yield f"{pad}- {nested[0].lstrip()}"
+                yield from nested[1:]
+            else:
+                yield f"{pad}- {json.dumps(item)}"
+    else:
+        yield f"{pad}{json.dumps(value)}"
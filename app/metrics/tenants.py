@@ -0,0 +1,68 @@
+"""
+Bounded-cardinality tenant labels.
+
+Labelling metrics with every tenant ID would create series without bound.
+TenantLabeler keeps a decaying request count per tenant and hands out the
+tenant ID as label value only to the top N tenants by recent traffic; all
+other tenants share the label "other". The top set is recomputed every
+refresh interval, so a tenant causing a spike is promoted within one interval.
+"""
+
+import time
+from typing import Callable, Dict, Set
+
+OTHER_TENANT_LABEL = "other"
+
+# Tracked tenants per top-N slot before the least active are forgotten
+TRACKED_TENANTS_PER_SLOT = 100
+
+
+class TenantLabeler:
+    """Maps tenant IDs to metric label values: the ID for top tenants, else "other"."""
+
+    def __init__(self, top_n: int, refresh_interval: float = 60.0, clock: Callable[[], float] = time.monotonic):
+        self.top_n = top_n
+        self.refresh_interval = refresh_interval
+        self._clock = clock
+        self._counts: Dict[str, float] = {}
+        self._top: Set[str] = set()
+        self._next_refresh = clock() + refresh_interval
+
+    def label(self, tenant_id: str) -> str:
+        """Count a request for tenant_id and return its label value."""
+        if self.top_n <= 0:
+            return OTHER_TENANT_LABEL
+
+        self._counts[tenant_id] = self._counts.get(tenant_id, 0) + 1
+        if len(self._counts) > self.top_n * TRACKED_TENANTS_PER_SLOT:
+            self._forget_least_active()
+
+        if self._clock() >= self._next_refresh:
+            self.refresh()
+        elif tenant_id not in self._top and len(self._top) < self.top_n:
+            # Free slots are handed out right away instead of at the next refresh
+            self._top.add(tenant_id)
+
+        return tenant_id if tenant_id in self._top else OTHER_TENANT_LABEL
+
+    def peek(self, tenant_id: str) -> str:
+        """Return the label value of tenant_id without counting a request."""
+        if self.top_n > 0 and tenant_id in self._top:
+            return tenant_id
+        return OTHER_TENANT_LABEL
+
+    def labels(self) -> Set[str]:
+        """Return the label values currently in use."""
+        return self._top | {OTHER_TENANT_LABEL}
+
+    def refresh(self) -> None:
+        """Recompute the top tenants and halve all counts so recent traffic dominates."""
+        ranked = sorted(self._counts.items(), key=lambda item: item[1], reverse=True)
+        self._top = {tenant_id for tenant_id, _ in ranked[:self.top_n]}
+        self._counts = {tenant_id: count / 2 for tenant_id, count in ranked if count >= 1}
+        self._next_refresh = self._clock() + self.refresh_interval
+
+    def _forget_least_active(self) -> None:
+        keep = self.top_n * TRACKED_TENANTS_PER_SLOT // 2
+        ranked = sorted(self._counts.items(), key=lambda item: item[1], reverse=True)
+        self._counts = dict(ranked[:keep])
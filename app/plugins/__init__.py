@@ -0,0 +1,41 @@
+"""
+Plugins: deployment-specific interceptors registered at import time.
+"""
+
+from app.plugins.hooks import (
+    AFTER_AUTHORIZATION,
+    BEFORE_AUTHORIZATION,
+    INNERMOST,
+    OUTERMOST,
+    POSITIONS,
+    Call,
+    CallNext,
+    Interceptor,
+    intercept,
+    intercept_stream,
+    interceptor_names,
+    load_plugins,
+    register_interceptor,
+    register_stream_interceptor,
+    set_request,
+    unregister_interceptors,
+)
+
+__all__ = [
+    "AFTER_AUTHORIZATION",
+    "BEFORE_AUTHORIZATION",
+    "INNERMOST",
+    "OUTERMOST",
+    "POSITIONS",
+    "Call",
+    "CallNext",
+    "Interceptor",
+    "intercept",
+    "intercept_stream",
+    "interceptor_names",
+    "load_plugins",
+    "register_interceptor",
+    "register_stream_interceptor",
+    "set_request",
+    "unregister_interceptors",
+]
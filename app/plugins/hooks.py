@@ -0,0 +1,173 @@
+"""
+Plugin hooks: custom interceptors in the JSON-RPC and streaming call chains.
+
+Deployments add behavior such as corporate authentication or custom quotas
+without forking the server. A plugin is a module named in PLUGINS that
+registers interceptors when it is imported:
+
+    # mycompany/flexdb_quota.py
+    from jsonrpcserver import Error
+    from app.plugins import AFTER_AUTHORIZATION, register_interceptor
+
+    async def quota(call, call_next):
+        if await over_quota(call.params.get("tenant_id")):
+            return Error(-32029, "quota exceeded")
+        return await call_next()
+
+    register_interceptor("quota", quota, position=AFTER_AUTHORIZATION)
+
+A unary interceptor gets the Call and call_next, which runs the rest of the
+chain, and returns the method's result: that of call_next, or a jsonrpcserver
+Error to reject the call. JSON-RPC methods pass through, outermost first:
+
+    OUTERMOST             every call, before anything else
+    call logging          (LOG_CALLS)
+    BEFORE_AUTHORIZATION  e.g. authentication by other credentials, with
+                          set_principal() from app.auth
+    scope authorization   API key scopes
+    AFTER_AUTHORIZATION   e.g. quotas (the default); load shedding, rate
+                          limits and concurrency limits come first
+                          (SHED_ENABLED, RATE_LIMIT_ENABLED and
+                          CONCURRENCY_LIMIT_ENABLED, see app/quotas/)
+    metrics               (METRICS_ENABLED)
+    INNERMOST             around the method itself
+
+Interceptors at the same position run in ascending order, then by
+registration. A stream interceptor wraps the streaming endpoints
+(stream.nodes, stream.export, stream.import, stream.upload_attachment and
+stream.download_attachment) after their authentication and authorization:
+call_next returns the endpoint's response, and it may return another fastapi
+Response instead.
+"""
+
+import functools
+import importlib
+import inspect
+import logging
+from contextvars import ContextVar
+from dataclasses import dataclass, field
+from typing import Any, Awaitable, Callable, Dict, Iterable, List, Mapping, Tuple
+
+logger = logging.getLogger(__name__)
+
+OUTERMOST = "outermost"
+BEFORE_AUTHORIZATION = "before_authorization"
+AFTER_AUTHORIZATION = "after_authorization"
+INNERMOST = "innermost"
+POSITIONS = (OUTERMOST, BEFORE_AUTHORIZATION, AFTER_AUTHORIZATION, INNERMOST)
+
+
+@dataclass
+class Call:
+    """A JSON-RPC method or streaming endpoint call, as seen by interceptors."""
+    method: str  # e.g. get_node, analytics.list_nodes or stream.export
+    params: Dict[str, Any] = field(default_factory=dict)
+    # HTTP request headers, with lower-case names
+    headers: Mapping[str, str] = field(default_factory=dict)
+    client_ip: str = ""
+
+
+CallNext = Callable[[], Awaitable[Any]]
+Interceptor = Callable[[Call, CallNext], Awaitable[Any]]
+
+
+@dataclass
+class _Registration:
+    name: str
+    func: Interceptor
+    position: str
+    order: int
+
+
+_unary: List[_Registration] = []
+_stream: List[_Registration] = []
+
+
+def _register(registry: List[_Registration], name: str, func: Interceptor, position: str, order: int) -> None:
+    if position not in POSITIONS:
+        raise ValueError(f"unknown interceptor position: {position} (expected one of {', '.join(POSITIONS)})")
+    if any(r.name == name for r in registry):
+        raise ValueError(f"interceptor {name} is already registered")
+    registry.append(_Registration(name, func, position, order))
+
+
+def register_interceptor(name: str, func: Interceptor, position: str = AFTER_AUTHORIZATION, order: int = 0) -> None:
+    """Insert an interceptor into the JSON-RPC method chain."""
+    _register(_unary, name, func, position, order)
+
+
+def register_stream_interceptor(name: str, func: Interceptor, order: int = 0) -> None:
+    """Insert an interceptor into the streaming endpoint chain."""
+    _register(_stream, name, func, AFTER_AUTHORIZATION, order)
+
+
+def unregister_interceptors() -> None:
+    """Remove all registered interceptors."""
+    _unary.clear()
+    _stream.clear()
+
+
+def _ordered(registry: List[_Registration], position: str) -> List[_Registration]:
+    # sorted() is stable, so equal orders keep their registration order
+    return sorted((r for r in registry if r.position == position), key=lambda r: r.order)
+
+
+def interceptor_names() -> Dict[str, List[str]]:
+    """Return the names of the registered interceptors by position, outermost first, and of stream interceptors."""
+    names = {position: [r.name for r in _ordered(_unary, position)] for position in POSITIONS}
+    names["stream"] = [r.name for r in _ordered(_stream, AFTER_AUTHORIZATION)]
+    return names
+
+
+# Headers and client IP of the HTTP request being handled (set by app/jsonrpc/server.py)
+_request: ContextVar[Tuple[Mapping[str, str], str]] = ContextVar("flexdb_plugin_request", default=({}, ""))
+
+
+def set_request(headers: Mapping[str, str], client_ip: str) -> None:
+    """Make the request's headers and client IP available to interceptors."""
+    _request.set(({k.lower(): v for k, v in headers.items()}, client_ip))
+
+
+def _call(method: str, params: Dict[str, Any]) -> Call:
+    headers, client_ip = _request.get()
+    return Call(method=method, params=params, headers=headers, client_ip=client_ip)
+
+
+async def _run(chain: List[_Registration], call: Call, last: CallNext) -> Any:
+    async def invoke(index: int) -> Any:
+        if index == len(chain):
+            return await last()
+        return await chain[index].func(call, lambda: invoke(index + 1))
+    return await invoke(0)
+
+
+def intercept(methods: Dict[str, Callable], position: str) -> Dict[str, Callable]:
+    """Wrap JSON-RPC methods in the interceptors registered at a position; methods are returned as is if there are none."""
+    chain = _ordered(_unary, position)
+    if not chain:
+        return methods
+    return {name: _intercepted(name, func, chain) for name, func in methods.items()}
+
+
+def _intercepted(method: str, func: Callable, chain: List[_Registration]) -> Callable:
+    signature = inspect.signature(func)
+
+    # functools.wraps keeps the signature visible to jsonrpcserver's params validation
+    @functools.wraps(func)
+    async def wrapper(*args, **kwargs):
+        call = _call(method, dict(signature.bind(*args, **kwargs).arguments))
+        return await _run(chain, call, lambda: func(*args, **kwargs))
+
+    return wrapper
+
+
+async def intercept_stream(method: str, params: Dict[str, Any], handler: CallNext) -> Any:
+    """Run a streaming endpoint's handler through the stream interceptors; returns its response."""
+    return await _run(_ordered(_stream, AFTER_AUTHORIZATION), _call(method, params), handler)
+
+
+def load_plugins(modules: Iterable[str]) -> None:
+    """Import plugin modules, which register their interceptors."""
+    for module in modules:
+        importlib.import_module(module)
+        logger.info(f"Loaded plugin {module}")
@@ -0,0 +1,246 @@
+"""
+flexy-proxy: records JSON-RPC traffic to a FlexDB server and replays it as a
+stub server, so consumer apps can build fast, deterministic tests from real
+interactions with a staging server.
+
+    scripts/flexy-proxy record --upstream https://flexdb.staging.example.com --cassette tests/flexdb.jsonl
+    scripts/flexy-proxy replay --cassette tests/flexdb.jsonl
+
+Both modes listen on http://127.0.0.1:8086 by default and serve POST
+/jsonrpc and /analytics/jsonrpc, so the app under test only changes its
+FlexDB URL. While recording, calls are forwarded upstream with their headers
+and every call with an id is appended to the cassette, a JSONL file of
+interactions: the endpoint, the call's method and params, and the response
+without its id. Values that look like credentials are redacted first, by
+field name as in webhook delivery logs (see app/events/redaction.py), except
+page and change tokens; headers (API keys, tokens) are never written.
+Recording starts the cassette afresh.
+
+While replaying, a call is answered with the response recorded for the same
+endpoint, method and params (after redaction); a call recorded more than once
+gets its responses in recorded order, then the last one again, so a read
+before and after a write replays both. Calls that weren't recorded fail with
+REPLAY_MISS_CODE, naming the method. The upstream is never contacted.
+"""
+
+import argparse
+import json
+import os
+import sys
+import threading
+from typing import Any, Dict, List, Optional
+
+from app.events.redaction import redact_payload
+
+RECORD = "record"
+REPLAY = "replay"
+
+DEFAULT_HOST = "127.0.0.1"
+DEFAULT_PORT = 8086
+
+ENDPOINTS = ("/jsonrpc", "/analytics/jsonrpc")
+
+# JSON-RPC error of calls a replay has no recorded response for
+REPLAY_MISS_CODE = -32000
+
+# Pagination and change feed positions, which look like credentials by name
+# but are needed to tell pages apart
+_NOT_SECRET = ("page_token", "next_page_token", "next_token", "change_token")
+
+# Headers not forwarded upstream: they describe the connection to the proxy
+_HOP_HEADERS = {"host", "content-length", "connection", "transfer-encoding", "accept-encoding"}
+
+
+def _key(endpoint: str, request: Dict[str, Any]) -> str:
+    """The key matching a call to its recorded interactions."""
+    return json.dumps(
+        {"endpoint": endpoint, "method": request.get("method"), "params": _redact(request.get("params"))},
+        sort_keys=True,
+    )
+
+
+def _redact(value: Any) -> Any:
+    return redact_payload(value, _NOT_SECRET)
+
+
+def _calls(body: Any) -> List[Dict[str, Any]]:
+    """The calls of a request body, a JSON-RPC call or a batch of them, that expect a response."""
+    calls = body if isinstance(body, list) else [body]
+    return [call for call in calls if isinstance(call, dict) and call.get("id") is not None]
+
+
+class Cassette:
+    """Recorded interactions, kept in memory and appended to a JSONL file."""
+
+    def __init__(self, path: str):
+        self.path = path
+        self._interactions: Dict[str, List[Dict[str, Any]]] = {}
+        self._replayed: Dict[str, int] = {}
+        self._lock = threading.Lock()
+
+    @classmethod
+    def load(cls, path: str) -> "Cassette":
+        """Read a cassette file; raises ValueError for a malformed line."""
+        cassette = cls(path)
+        with open(path) as f:
+            for number, line in enumerate(f, 1):
+                if not line.strip():
+                    continue
+                try:
+                    interaction = json.loads(line)
+                    key = _key(interaction["endpoint"], interaction["request"])
+                    if not isinstance(interaction["response"], dict):
+                        raise ValueError
+                except (ValueError, KeyError, TypeError, AttributeError):
+                    raise ValueError(f"{path}:{number}: invalid interaction") from None
+                cassette._interactions.setdefault(key, []).append(interaction)
+        return cassette
+
+    def __len__(self) -> int:
+        return sum(len(recorded) for recorded in self._interactions.values())
+
+    def record(self, endpoint: str, request: Dict[str, Any], response: Dict[str, Any]) -> None:
+        """Redact an interaction and append it to the cassette."""
+        interaction = {
+            "endpoint": endpoint,
+            "request": {"method": request.get("method"), "params": _redact(request.get("params"))},
+            "response": _redact({k: v for k, v in response.items() if k != "id"}),
+        }
+        with self._lock:
+            self._interactions.setdefault(_key(endpoint, request), []).append(interaction)
+            with open(self.path, "a") as f:
+                f.write(json.dumps(interaction, sort_keys=True) + "\n")
+
+    def replay(self, endpoint: str, request: Dict[str, Any]) -> Dict[str, Any]:
+        """Return the next recorded response to a call, with the call's id."""
+        key = _key(endpoint, request)
+        with self._lock:
+            recorded = self._interactions.get(key)
+            if not recorded:
+                return {
+                    "jsonrpc": "2.0",
+                    "error": {
+                        "code": REPLAY_MISS_CODE,
+                        "message": f"no recorded response for {request.get('method')} on {endpoint}",
+                    },
+                    "id": request.get("id"),
+                }
+            served = self._replayed.get(key, 0)
+            self._replayed[key] = served + 1
+            response = recorded[min(served, len(recorded) - 1)]["response"]
+        return {**response, "id": request.get("id")}
+
+
+def replay_body(cassette: Cassette, endpoint: str, body: Any) -> Any:
+    """Answer a request body, a call or a batch of calls, from the cassette; None if nothing is answered."""
+    responses = [cassette.replay(endpoint, call) for call in _calls(body)]
+    if isinstance(body, list):
+        return responses or None
+    return responses[0] if responses else None
+
+
+def record_body(cassette: Cassette, endpoint: str, body: Any, response_body: Any) -> None:
+    """Record the calls of a request body with their responses from the upstream, matched by id."""
+    responses = response_body if isinstance(response_body, list) else [response_body]
+    by_id = {r.get("id"): r for r in responses if isinstance(r, dict) and r.get("id") is not None}
+    for call in _calls(body):
+        if call["id"] in by_id:
+            cassette.record(endpoint, call, by_id[call["id"]])
+
+
+def create_app(mode: str, cassette: Cassette, upstream: str = ""):
+    """The proxy's ASGI app, recording calls forwarded to upstream or replaying them."""
+    import httpx
+    from fastapi import FastAPI, Request
+    from fastapi.responses import JSONResponse, Response
+
+    app = FastAPI(title="flexy-proxy")
+    client = httpx.AsyncClient(timeout=None) if mode == RECORD else None
+
+    async def handle(request: Request) -> Response:
+        endpoint = request.url.path
+        raw = await request.body()
+        if mode == REPLAY:
+            try:
+                body = json.loads(raw)
+            except ValueError:
+                return JSONResponse(
+                    {"jsonrpc": "2.0", "error": {"code": -32700, "message": "Parse error"}, "id": None}
+                )
+            reply = replay_body(cassette, endpoint, body)
+            return Response(status_code=204) if reply is None else JSONResponse(reply)
+
+        headers = {k: v for k, v in request.headers.items() if k.lower() not in _HOP_HEADERS}
+        upstream_response = await client.post(upstream.rstrip("/") + endpoint, content=raw, headers=headers)
+        try:
+            record_body(cassette, endpoint, json.loads(raw), upstream_response.json())
+        except ValueError:
+            pass  # Not JSON: forwarded as is, nothing to record
+        return Response(
+            content=upstream_response.content,
+            status_code=upstream_response.status_code,
+            media_type=upstream_response.headers.get("content-type"),
+        )
+
+    for endpoint in ENDPOINTS:
+        app.add_api_route(endpoint, handle, methods=["POST"])
+
+    @app.get("/health")
+    async def health() -> Dict[str, str]:
+        return {"status": "ok", "mode": mode}
+
+    if client is not None:
+        app.router.on_shutdown.append(client.aclose)
+    return app
+
+
+def parse_args(argv: Optional[List[str]] = None) -> argparse.Namespace:
+    """Parse flexy-proxy's command line."""
+    parser = argparse.ArgumentParser(
+        prog="flexy-proxy", description="Record JSON-RPC traffic to a FlexDB server, or replay it as a stub server."
+    )
+    parser.add_argument("mode", choices=[RECORD, REPLAY])
+    parser.add_argument("--cassette", required=True, help="JSONL file of recorded interactions")
+    parser.add_argument("--upstream", default="", help="URL of the FlexDB server to record (record mode)")
+    parser.add_argument("--host", default=DEFAULT_HOST, help=f"address to listen on (default: {DEFAULT_HOST})")
+    parser.add_argument("--port", type=int, default=DEFAULT_PORT, help=f"port to listen on (default: {DEFAULT_PORT})")
+    args = parser.parse_args(argv)
+    if args.mode == RECORD and not args.upstream:
+        parser.error("record mode requires --upstream")
+    return args
+
+
+def open_cassette(args: argparse.Namespace) -> Cassette:
+    """Open the cassette of a run: a new one to record, or a recorded one to replay."""
+    if args.mode == RECORD:
+        # Recording starts a new cassette, so it holds only this run's traffic
+        directory = os.path.dirname(args.cassette)
+        if directory:
+            os.makedirs(directory, exist_ok=True)
+        open(args.cassette, "w").close()
+        return Cassette(args.cassette)
+    return Cassette.load(args.cassette)
+
+
+def main(argv: Optional[List[str]] = None) -> int:
+    """Run the proxy until it is stopped; returns the exit status."""
+    args = parse_args(argv)
+    try:
+        cassette = open_cassette(args)
+    except (OSError, ValueError) as e:
+        print(f"flexy-proxy: {e}", file=sys.stderr)
+        return 1
+
+    import uvicorn
+
+    if args.mode == RECORD:
+        print(f"flexy-proxy recording {args.upstream} to {args.cassette}", flush=True)
+    else:
+        print(f"flexy-proxy replaying {len(cassette)} interactions from {args.cassette}", flush=True)
+    print(f"serving http://{args.host}:{args.port}/jsonrpc", flush=True)
+    uvicorn.run(create_app(args.mode, cassette, args.upstream), host=args.host, port=args.port, log_level="warning")
+    return 0
+
+
+if __name__ == "__main__":
+    sys.exit(main())
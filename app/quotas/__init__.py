@@ -0,0 +1,44 @@
+"""
+Tenant quotas: request rate limits per tenant and per API key, load shedding
+of low-priority calls and adaptive concurrency limits per method.
+"""
+
+from app.quotas.buckets import TokenBuckets
+from app.quotas.limiter import (
+    RESOURCE_EXHAUSTED_CODE,
+    TENANT_LIMIT,
+    API_KEY_LIMIT,
+    Limits,
+    QuotaSource,
+    Rejection,
+    TenantRateLimiter,
+    apply_defaults,
+    effective_limits,
+    forget_quota,
+    set_rate_limiter,
+)
+from app.quotas.shedding import LATENCY, POOL_WAIT, UNAVAILABLE_CODE, LoadShedder, Shed
+from app.quotas.concurrency import CONCURRENCY, ConcurrencyLimiter, GradientLimit
+
+__all__ = [
+    "TokenBuckets",
+    "RESOURCE_EXHAUSTED_CODE",
+    "TENANT_LIMIT",
+    "API_KEY_LIMIT",
+    "Limits",
+    "QuotaSource",
+    "Rejection",
+    "TenantRateLimiter",
+    "apply_defaults",
+    "effective_limits",
+    "forget_quota",
+    "set_rate_limiter",
+    "UNAVAILABLE_CODE",
+    "POOL_WAIT",
+    "LATENCY",
+    "LoadShedder",
+    "Shed",
+    "CONCURRENCY",
+    "ConcurrencyLimiter",
+    "GradientLimit",
+]
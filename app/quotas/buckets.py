@@ -0,0 +1,64 @@
+"""
+In-memory token buckets.
+
+Limits are tracked per server instance; with several instances behind a load
+balancer the effective limit is multiplied by the instance count.
+"""
+
+import time
+from typing import Callable, Dict, List
+
+# Forget full (idle) buckets once this many are tracked
+MAX_TRACKED_KEYS = 100000
+
+
+class TokenBuckets:
+    """
+    A token bucket per key: a bucket holds up to `burst` tokens, refilled at
+    `rate` tokens per second, and every request takes one.
+    """
+
+    def __init__(self, clock: Callable[[], float] = time.monotonic):
+        self._clock = clock
+        # key -> [tokens, updated, rate, burst]
+        self._buckets: Dict[str, List[float]] = {}
+
+    def take(self, key: str, rate: float, burst: int) -> float:
+        """
+        Take a token from key's bucket. Returns 0 if one was taken, else the
+        seconds until one is available. A rate of 0 is unlimited.
+        """
+        if rate <= 0:
+            return 0.0
+        now = self._clock()
+        bucket = self._buckets.get(key)
+        if bucket is None:
+            if len(self._buckets) >= MAX_TRACKED_KEYS:
+                self._prune(now)
+            bucket = self._buckets[key] = [float(burst), now, rate, burst]
+        else:
+            # Limits may have changed since the last request
+            bucket[2], bucket[3] = rate, burst
+            self._refill(bucket, now)
+
+        if bucket[0] >= 1:
+            bucket[0] -= 1
+            return 0.0
+        return (1 - bucket[0]) / rate
+
+    def give_back(self, key: str) -> None:
+        """Return a token taken for a request that was rejected by another limit."""
+        bucket = self._buckets.get(key)
+        if bucket is not None:
+            bucket[0] = min(bucket[3], bucket[0] + 1)
+
+    def _refill(self, bucket: List[float], now: float) -> None:
+        bucket[0] = min(bucket[3], bucket[0] + (now - bucket[1]) * bucket[2])
+        bucket[1] = now
+
+    def _prune(self, now: float) -> None:
+        for key in list(self._buckets):
+            bucket = self._buckets[key]
+            self._refill(bucket, now)
+            if bucket[0] >= bucket[3]:
+                del self._buckets[key]
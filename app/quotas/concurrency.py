@@ -0,0 +1,137 @@
+"""
+Adaptive concurrency limits per JSON-RPC method.
+
+With CONCURRENCY_LIMIT_ENABLED, every JSON-RPC call passes the
+"concurrency_limit" interceptor, after rate limits at the AFTER_AUTHORIZATION
+position (see app/plugins/hooks.py). Each method may have a limited number of
+calls in flight at once; calls beyond it fail at once with UNAVAILABLE_CODE
+instead of queueing for connections until they time out:
+
+    {"code": -32030, "message": "too many concurrent get_node calls, retry later",
+     "data": {"reason": "concurrency", "limit": 12, "retry_after": 1.0}}
+
+The limits adapt to each method's latency, in the style of the gradient
+algorithm of TCP Vegas and Netflix's concurrency-limits. Each completed call
+updates its method's long-term latency (an average over the last
+CONCURRENCY_LIMIT_LONG_WINDOW calls) and a new estimate of the limit:
+
+    gradient  = clamp(tolerance * long-term latency / call latency, 0.5, 1)
+    estimate  = limit * gradient + sqrt(limit)
+
+While calls take no longer than CONCURRENCY_LIMIT_TOLERANCE times the
+long-term latency the gradient is 1 and the limit grows by its square root
+(the queue a method may build); once they slow down, the limit shrinks by up
+to half. Limits move CONCURRENCY_LIMIT_SMOOTHING of the way to each estimate,
+stay within CONCURRENCY_LIMIT_MIN and CONCURRENCY_LIMIT_MAX, and are left
+alone while fewer than half of them are in use. Limits are kept per server
+instance.
+"""
+
+import math
+import time
+from typing import Any, Dict, List
+
+from jsonrpcserver import Error
+
+from app.config import ConcurrencyLimitConfig
+from app.metrics.registry import metric_family
+from app.plugins import Call, CallNext
+from app.quotas.shedding import UNAVAILABLE_CODE
+
+CONCURRENCY = "concurrency"
+
+# Factor the long-term latency decays by when calls are more than twice as
+# fast, so a method recovers quickly from a latency spike
+RECOVERY_DECAY = 0.95
+
+
+class GradientLimit:
+    """The adaptive concurrency limit of one method."""
+
+    def __init__(self, cfg: ConcurrencyLimitConfig):
+        self.cfg = cfg
+        self.limit = float(cfg.initial_limit)
+        self.in_flight = 0
+        self.long_rtt = 0.0
+        self.rejected = 0
+
+    def try_acquire(self) -> bool:
+        """Start a call if the method is below its limit; returns whether it may proceed."""
+        if self.in_flight >= int(self.limit):
+            self.rejected += 1
+            return False
+        self.in_flight += 1
+        return True
+
+    def release(self, rtt: float, in_flight: int) -> None:
+        """
+        Finish a call that took rtt seconds, started with in_flight calls of
+        the method running (itself included), and update the limit.
+        """
+        self.in_flight -= 1
+        if rtt <= 0:
+            return
+        if not self.long_rtt:
+            self.long_rtt = rtt
+        else:
+            self.long_rtt += (rtt - self.long_rtt) / self.cfg.long_window
+            if self.long_rtt / rtt > 2:
+                self.long_rtt *= RECOVERY_DECAY
+
+        # An underused limit says nothing about the method's capacity
+        if in_flight < self.limit / 2:
+            return
+        gradient = max(0.5, min(1.0, self.cfg.tolerance * self.long_rtt / rtt))
+        estimate = self.limit * gradient + math.sqrt(self.limit)
+        limit = self.limit * (1 - self.cfg.smoothing) + estimate * self.cfg.smoothing
+        self.limit = max(float(self.cfg.min_limit), min(float(self.cfg.max_limit), limit))
+
+
+class ConcurrencyLimiter:
+    """Adaptive concurrency limits of the JSON-RPC methods."""
+
+    def __init__(self, cfg: ConcurrencyLimitConfig):
+        self.cfg = cfg
+        # method -> its limit, created by its first call
+        self.limits: Dict[str, GradientLimit] = {}
+
+    def limit(self, method: str) -> GradientLimit:
+        """Return the limit of a method."""
+        if method not in self.limits:
+            self.limits[method] = GradientLimit(self.cfg)
+        return self.limits[method]
+
+    async def intercept(self, call: Call, call_next: CallNext) -> Any:
+        """Unary interceptor rejecting calls over their method's limit with UNAVAILABLE_CODE."""
+        limit = self.limit(call.method)
+        if not limit.try_acquire():
+            return Error(
+                UNAVAILABLE_CODE,
+                f"too many concurrent {call.method} calls, retry later",
+                {"reason": CONCURRENCY, "limit": int(limit.limit), "retry_after": round(self.cfg.retry_after, 3)},
+            )
+        in_flight = limit.in_flight
+        started = time.perf_counter()
+        try:
+            return await call_next()
+        finally:
+            limit.release(time.perf_counter() - started, in_flight)
+
+    def metric_lines(self, openmetrics: bool = False) -> List[str]:
+        """Render the current limits, calls in flight and rejections in the Prometheus or OpenMetrics text format."""
+        def family(name: str, metric_type: str, help_text: str) -> List[str]:
+            return metric_family(name, metric_type, help_text, openmetrics)
+
+        methods = sorted(self.limits.items())
+        lines = family("flexdb_concurrency_limit", "gauge", "Current adaptive concurrency limit, by method.")
+        for method, limit in methods:
+            lines.append(f'flexdb_concurrency_limit{{method="{method}"}} {int(limit.limit)}')
+        lines += family("flexdb_concurrency_in_flight", "gauge", "Calls in flight, by method.")
+        for method, limit in methods:
+            lines.append(f'flexdb_concurrency_in_flight{{method="{method}"}} {limit.in_flight}')
+        lines += family(
+            "flexdb_concurrency_rejected_total", "counter", "Calls rejected over the concurrency limit, by method."
+        )
+        for method, limit in methods:
+            lines.append(f'flexdb_concurrency_rejected_total{{method="{method}"}} {limit.rejected}')
+        return lines
@@ -0,0 +1,220 @@
+"""
+Request rate limits per tenant and per API key.
+
+With RATE_LIMIT_ENABLED, every JSON-RPC call and streaming endpoint call
+passes the "rate_limit" interceptor, at the front of the AFTER_AUTHORIZATION
+position (see app/plugins/hooks.py), which takes a token from two buckets:
+
+    api_key:<id>        the calling API key's bucket
+    tenant:<tenant_id>  the bucket of the tenant called, shared by all its
+                        keys and anonymous callers
+
+A bucket holds up to its burst of tokens and refills at its requests per
+second. Limits come from the tenant's quota (set_tenant_quota), falling back
+to the RATE_LIMIT_* defaults for the limits it leaves unset; a rate of 0 is
+unlimited. Quotas are cached for RATE_LIMIT_QUOTA_TTL seconds. Calls with the
+admin key and calls that don't name a tenant are not limited.
+
+Rejected calls fail with RESOURCE_EXHAUSTED_CODE, and streaming endpoints with
+HTTP 429; the error data holds the limit hit and the seconds to wait before
+retrying:
+
+    {"code": -32029, "message": "rate limit exceeded for tenant ...",
+     "data": {"limit": "tenant", "retry_after": 0.25, "details": [...]}}
+
+with a google.rpc.ErrorInfo detail of reason QUOTA_EXCEEDED (see
+app/repository/errors.py).
+
+Buckets are kept per server instance, so the effective limits are multiplied
+by the number of instances behind the load balancer.
+"""
+
+import logging
+import time
+from dataclasses import dataclass
+from typing import Any, Callable, Dict, List, Optional, Protocol, Tuple
+
+from jsonrpcserver import Error
+
+from app.auth import ADMIN_KEY, API_KEY, current_principal
+from app.config import RateLimitConfig
+from app.metrics.registry import metric_family
+from app.plugins import Call, CallNext
+from app.quotas.buckets import MAX_TRACKED_KEYS, TokenBuckets
+from app.repository import QuotaExceededError, TenantQuota, error_details
+
+logger = logging.getLogger(__name__)
+
+RESOURCE_EXHAUSTED_CODE = -32029
+
+# Limits a call can exceed
+TENANT_LIMIT = "tenant"
+API_KEY_LIMIT = "api_key"
+
+
+class QuotaSource(Protocol):
+    """Where tenant quotas are read from, such as TenantQuotaRepository."""
+
+    async def get(self, tenant_id: str) -> Optional[TenantQuota]:
+        ...
+
+
+@dataclass
+class Limits:
+    """The limits enforced for a tenant, after defaults are applied."""
+    requests_per_second: float
+    burst: int
+    api_key_requests_per_second: float
+    api_key_burst: int
+
+    def to_dict(self) -> dict:
+        """Convert to dictionary."""
+        return {
+            "requests_per_second": self.requests_per_second,
+            "burst": self.burst,
+            "api_key_requests_per_second": self.api_key_requests_per_second,
+            "api_key_burst": self.api_key_burst,
+        }
+
+
+def apply_defaults(quota: Optional[TenantQuota], cfg: RateLimitConfig) -> Limits:
+    """Return the limits of a tenant's quota, with cfg's defaults for those it leaves unset."""
+    quota = quota or TenantQuota()
+
+    def pick(value, default):
+        return default if value is None else value
+
+    return Limits(
+        requests_per_second=pick(quota.requests_per_second, cfg.tenant_requests_per_second),
+        burst=pick(quota.burst, cfg.tenant_burst),
+        api_key_requests_per_second=pick(quota.api_key_requests_per_second, cfg.api_key_requests_per_second),
+        api_key_burst=pick(quota.api_key_burst, cfg.api_key_burst),
+    )
+
+
+@dataclass
+class Rejection:
+    """A call over a limit."""
+    limit: str  # TENANT_LIMIT or API_KEY_LIMIT
+    retry_after: float
+    message: str
+
+    def data(self) -> Dict[str, Any]:
+        return {"limit": self.limit, "retry_after": round(self.retry_after, 3)}
+
+    def error(self) -> QuotaExceededError:
+        return QuotaExceededError(self.message, self.limit, self.retry_after)
+
+
+class TenantRateLimiter:
+    """Token bucket rate limits per tenant and per API key, with limits from tenant quotas."""
+
+    def __init__(
+        self,
+        cfg: RateLimitConfig,
+        quotas: Optional[QuotaSource] = None,
+        clock: Callable[[], float] = time.monotonic,
+    ):
+        self.cfg = cfg
+        self.quotas = quotas
+        self._clock = clock
+        self._buckets = TokenBuckets(clock)
+        # tenant_id -> (limits, expires)
+        self._limits: Dict[str, Tuple[Limits, float]] = {}
+        # Metrics, kept per server instance
+        self.rejected: Dict[str, int] = {TENANT_LIMIT: 0, API_KEY_LIMIT: 0}
+
+    async def limits(self, tenant_id: str) -> Limits:
+        """Return the limits of a tenant, cached for the quota TTL."""
+        now = self._clock()
+        cached = self._limits.get(tenant_id)
+        if cached and cached[1] > now:
+            return cached[0]
+
+        quota = None
+        if self.quotas:
+            try:
+                quota = await self.quotas.get(tenant_id)
+            except Exception as e:
+                # Keep serving with the defaults rather than failing every call
+                logger.warning(f"Failed to read the quota of tenant {tenant_id}: {e}")
+        limits = apply_defaults(quota, self.cfg)
+
+        if len(self._limits) >= MAX_TRACKED_KEYS:
+            self._limits = {k: v for k, v in self._limits.items() if v[1] > now}
+        self._limits[tenant_id] = (limits, now + self.cfg.quota_ttl)
+        return limits
+
+    def forget(self, tenant_id: str) -> None:
+        """Drop a tenant's cached limits after its quota changed."""
+        self._limits.pop(tenant_id, None)
+
+    async def check(self, params: Dict[str, Any]) -> Optional[Rejection]:
+        """Take a token for a call by the current principal; returns the rejection if it is over a limit."""
+        principal = current_principal()
+        if principal.kind == ADMIN_KEY:
+            return None
+        api_key = principal.api_key if principal.kind == API_KEY else None
+        # API keys only reach their own tenant (see app/auth/authorization.py)
+        tenant_id = api_key.tenant_id if api_key else params.get("tenant_id")
+        if not tenant_id or not isinstance(tenant_id, str):
+            return None
+
+        limits = await self.limits(tenant_id)
+        if api_key:
+            wait = self._buckets.take(
+                f"{API_KEY_LIMIT}:{api_key.id}", limits.api_key_requests_per_second, limits.api_key_burst
+            )
+            if wait > 0:
+                return self._reject(API_KEY_LIMIT, wait, f"rate limit exceeded for API key {api_key.key_prefix}")
+
+        wait = self._buckets.take(f"{TENANT_LIMIT}:{tenant_id}", limits.requests_per_second, limits.burst)
+        if wait > 0:
+            if api_key:
+                self._buckets.give_back(f"{API_KEY_LIMIT}:{api_key.id}")
+            return self._reject(TENANT_LIMIT, wait, f"rate limit exceeded for tenant {tenant_id}")
+        return None
+
+    def _reject(self, limit: str, retry_after: float, message: str) -> Rejection:
+        self.rejected[limit] += 1
+        return Rejection(limit=limit, retry_after=retry_after, message=message)
+
+    async def intercept(self, call: Call, call_next: CallNext) -> Any:
+        """Unary interceptor rejecting calls over a limit with RESOURCE_EXHAUSTED_CODE."""
+        rejection = await self.check(call.params)
+        if rejection:
+            data = {**rejection.data(), "details": error_details(rejection.error())}
+            return Error(RESOURCE_EXHAUSTED_CODE, rejection.message, data)
+        return await call_next()
+
+    def metric_lines(self, openmetrics: bool = False) -> List[str]:
+        """Render the rejection counts in the Prometheus or OpenMetrics text format."""
+        lines = metric_family(
+            "flexdb_rate_limited_total", "counter", "Calls rejected by rate limits, by limit.", openmetrics
+        )
+        for limit, value in sorted(self.rejected.items()):
+            lines.append(f'flexdb_rate_limited_total{{limit="{limit}"}} {value}')
+        return lines
+
+
+# The limiter of this server (set by app/jsonrpc/server.py), consulted by the quota methods
+_limiter: Optional[TenantRateLimiter] = None
+
+
+def set_rate_limiter(limiter: Optional[TenantRateLimiter]) -> None:
+    """Set the limiter whose cache quota changes invalidate."""
+    global _limiter
+    _limiter = limiter
+
+
+def forget_quota(tenant_id: str) -> None:
+    """Apply a tenant's changed quota on this server instance right away; others pick it up within the quota TTL."""
+    if _limiter:
+        _limiter.forget(tenant_id)
+
+
+def effective_limits(quota: Optional[TenantQuota]) -> Optional[Limits]:
+    """Return the limits enforced for a quota, or None if rate limiting is disabled."""
+    if _limiter is None or not _limiter.cfg.enabled:
+        return None
+    return apply_defaults(quota, _limiter.cfg)
@@ -0,0 +1,163 @@
+"""
+Load shedding: low-priority calls are rejected while the database is saturated.
+
+With SHED_ENABLED, every JSON-RPC call and streaming endpoint call passes the
+"load_shed" interceptor, ahead of rate limits at the front of the
+AFTER_AUTHORIZATION position (see app/plugins/hooks.py). Calls to the methods
+in SHED_METHODS (by default analytics.*, stream.export and stream.import) are
+low priority; all others, the interactive CRUD traffic, are never shed.
+
+The database counts as saturated while, over the last SHED_WINDOW seconds,
+either of these live signals is over its threshold:
+
+    pool_wait  the 95th percentile wait for a pooled connection (all pools of
+               this server instance, see app/db/database.py) exceeds
+               SHED_POOL_WAIT_THRESHOLD seconds
+    latency    interactive calls slower than the SLO latency threshold
+               (SLO_LATENCY_THRESHOLD) burn the latency error budget
+               (1 - SLO_LATENCY_OBJECTIVE) SHED_BURN_RATE_THRESHOLD times
+               faster than sustainable, once SHED_MIN_CALLS were observed
+
+Low-priority calls arriving meanwhile fail with UNAVAILABLE_CODE, and
+streaming endpoints with HTTP 503 and a Retry-After header; the error data
+holds the signal and the seconds to wait before retrying:
+
+    {"code": -32030, "message": "server is overloaded, retry later",
+     "data": {"reason": "pool_wait", "retry_after": 5.0}}
+
+Shedding stops by itself once the signals drop, as waits and latencies leave
+the window. Signals are measured per server instance, so an instance sheds on
+its own load.
+"""
+
+import logging
+import time
+from dataclasses import dataclass
+from typing import Any, Callable, Dict, List, Optional
+
+from jsonrpcserver import Error
+
+from app.config import LoadShedConfig, MetricsConfig
+from app.db.database import Samples, pool_waits
+from app.metrics.registry import metric_family
+from app.plugins import Call, CallNext
+
+logger = logging.getLogger(__name__)
+
+UNAVAILABLE_CODE = -32030
+
+# Signals that make the database count as saturated
+POOL_WAIT = "pool_wait"
+LATENCY = "latency"
+
+
+@dataclass
+class Shed:
+    """A low-priority call rejected while the database is saturated."""
+    reason: str  # POOL_WAIT or LATENCY
+    retry_after: float
+    message: str = "server is overloaded, retry later"
+
+    def data(self) -> Dict[str, Any]:
+        return {"reason": self.reason, "retry_after": round(self.retry_after, 3)}
+
+
+class LoadShedder:
+    """Rejects low-priority calls while pool waits or interactive latencies show the database is saturated."""
+
+    def __init__(
+        self,
+        cfg: LoadShedConfig,
+        slo: MetricsConfig,
+        waits: Samples = pool_waits,
+        clock: Callable[[], float] = time.monotonic,
+    ):
+        self.cfg = cfg
+        self.slo = slo
+        self.waits = waits
+        self.waits.window = cfg.window
+        # Durations of interactive calls
+        self.latencies = Samples(cfg.window, clock=clock)
+        self._shedding: Optional[str] = None
+        # Metrics, kept per server instance
+        self.shed: Dict[str, int] = {POOL_WAIT: 0, LATENCY: 0}
+
+    def low_priority(self, method: str) -> bool:
+        """Return whether calls to a method are shed while the database is saturated."""
+        for pattern in self.cfg.methods:
+            if method == pattern or (pattern.endswith(".*") and method.startswith(pattern[:-1])):
+                return True
+        return False
+
+    def burn_rate(self) -> float:
+        """Return how many times faster than sustainable slow interactive calls burn the latency error budget."""
+        latencies = self.latencies.values()
+        budget = 1 - self.slo.latency_objective
+        if len(latencies) < self.cfg.min_calls or budget <= 0:
+            return 0.0
+        slow = sum(1 for latency in latencies if latency > self.slo.latency_threshold)
+        return slow / len(latencies) / budget
+
+    def saturation(self) -> Optional[str]:
+        """Return the signal showing the database is saturated, or None if it isn't."""
+        if self.waits.quantile(0.95) > self.cfg.pool_wait_threshold:
+            reason = POOL_WAIT
+        elif self.cfg.burn_rate_threshold > 0 and self.burn_rate() >= self.cfg.burn_rate_threshold:
+            reason = LATENCY
+        else:
+            reason = None
+
+        if reason != self._shedding:
+            if reason:
+                logger.warning(f"Database saturated ({reason}), shedding {', '.join(self.cfg.methods)}")
+            else:
+                logger.info("Database no longer saturated, stopped shedding")
+            self._shedding = reason
+        return reason
+
+    def check(self, method: str) -> Optional[Shed]:
+        """Return the rejection of a call if it is low priority and the database is saturated."""
+        if not self.low_priority(method):
+            return None
+        reason = self.saturation()
+        if not reason:
+            return None
+        self.shed[reason] += 1
+        return Shed(reason=reason, retry_after=self.cfg.retry_after)
+
+    async def intercept(self, call: Call, call_next: CallNext) -> Any:
+        """Unary interceptor shedding low-priority calls with UNAVAILABLE_CODE and timing interactive ones."""
+        if self.low_priority(call.method):
+            shed = self.check(call.method)
+            if shed:
+                return Error(UNAVAILABLE_CODE, shed.message, shed.data())
+            return await call_next()
+
+        started = time.perf_counter()
+        try:
+            return await call_next()
+        finally:
+            self.latencies.add(time.perf_counter() - started)
+
+    def metric_lines(self, openmetrics: bool = False) -> List[str]:
+        """Render the shedding metrics in the Prometheus or OpenMetrics text format."""
+        def family(name: str, metric_type: str, help_text: str) -> List[str]:
+            return metric_family(name, metric_type, help_text, openmetrics)
+
+        lines = family("flexdb_load_shed_total", "counter", "Low-priority calls shed, by saturation signal.")
+        for reason, value in sorted(self.shed.items()):
+            lines.append(f'flexdb_load_shed_total{{reason="{reason}"}} {value}')
+
+        reason = self.saturation()
+        lines += family("flexdb_load_shedding", "gauge", "Whether low-priority calls are being shed.")
+        lines.append(f"flexdb_load_shedding {int(reason is not None)}")
+        lines += family(
+            "flexdb_pool_wait_p95_seconds", "gauge", "95th percentile wait for a pooled connection in the window."
+        )
+        lines.append(f"flexdb_pool_wait_p95_seconds {self.waits.quantile(0.95)!r}")
+        lines += family(
+            "flexdb_interactive_latency_burn_rate", "gauge",
+            "Latency error budget burn rate of interactive calls in the window."
+        )
+        lines.append(f"flexdb_interactive_latency_burn_rate {self.burn_rate()!r}")
+        return lines
@@ -4,34 +4,256 @@ Repository module initialization.
 
 from app.repository.models import (
     Tenant,
+    TenantSlugChange,
     User,
     TenantUser,
+    ApiKey,
+    AuditEvent,
+    AuditExport,
+    BackupVerification,
+    ServerInstance,
+    ClusterLease,
+    TenantQuota,
+    TenantDeletion,
+    TENANT_DELETION_STEPS,
     NodeType,
+    NodeTypeIndex,
+    DataFilter,
     Node,
+    NodeRevision,
     Relationship,
+    GeoFilter,
+    Aggregation,
+    AggregationRange,
+    AggregationBucket,
+    OutboxEvent,
+    ChangeFeedPosition,
+    ChangePage,
+    WebhookEndpoint,
+    WebhookDelivery,
+    EventSubscription,
+    SubscriptionMessage,
+    IntakeForm,
+    EmailInbox,
+    EmailAttachment,
+    Attachment,
+    NodeLock,
+    ImportProgress,
+    ImportRow,
+    NodeValidationReport,
+    LakeExport,
+    NodeMigration,
+    RetentionPolicy,
+    BatchHook,
+    BulkJob,
+    BULK_IMPORT,
+    BULK_DELETE,
+    BULK_BACKFILL,
+    BULK_EXPORT,
+    Operation,
+    DeadLetter,
+    DEAD_LETTER_WEBHOOK_DELIVERY,
+    DEAD_LETTER_NODE_MIGRATION,
+    DEAD_LETTER_KINDS,
+    BiView,
+    BiViewColumn,
+    DataKey,
+    SortOrder,
+    MAX_PAGE_SIZE,
     ListOptions,
+    FilterValues,
+    filter_values,
     ListResult,
 )
 from app.repository.tenant_repo import TenantRepository
 from app.repository.user_repo import UserRepository
+from app.repository.api_key_repo import ApiKeyRepository
+from app.repository.audit_repo import AuditRepository
+from app.repository.backup_repo import BackupVerificationRepository
+from app.repository.instance_repo import ServerInstanceRepository
+from app.repository.quota_repo import TenantQuotaRepository
+from app.repository.tenant_deletion_repo import TenantDeletionRepository
 from app.repository.nodetype_repo import NodeTypeRepository
 from app.repository.node_repo import NodeRepository
 from app.repository.relationship_repo import RelationshipRepository
-from app.repository.errors import NotFoundError
+from app.repository.outbox_repo import OutboxRepository, record_event
+from app.repository.webhook_repo import WebhookRepository
+from app.repository.subscription_repo import SubscriptionRepository
+from app.repository.intake_repo import IntakeFormRepository
+from app.repository.inbox_repo import EmailInboxRepository
+from app.repository.transfer_repo import EXPORT_RECORD_TYPES, ExportPosition, TransferRepository
+from app.repository.bi_view_repo import BiViewRepository
+from app.repository.lake_export_repo import LakeExportRepository
+from app.repository.node_migration_repo import NodeMigrationRepository
+from app.repository.retention_repo import RetentionPolicyRepository
+from app.repository.attachment_repo import AttachmentRepository
+from app.repository.node_lock_repo import NodeLockRepository
+from app.repository.data_key_repo import DataKeyRepository
+from app.repository.bulk_job_repo import BulkJobRepository
+from app.repository.dead_letter_repo import DeadLetterRepository, add_dead_letter
+from app.repository.errors import (
+    AlreadyExistsError,
+    ConflictError,
+    FailedPreconditionError,
+    FieldViolation,
+    NodeLockedError,
+    NotFoundError,
+    QuotaExceededError,
+    ValidationError,
+    error_details,
+)
+from app.repository.memory import (
+    InMemoryControlStore,
+    InMemoryStore,
+    InMemoryTenantRepository,
+    InMemoryTenantQuotaRepository,
+    InMemoryUserRepository,
+    InMemoryNodeTypeRepository,
+    InMemoryNodeRepository,
+    InMemoryRelationshipRepository,
+    InMemoryOutboxRepository,
+    InMemoryDataKeyRepository,
+    InMemoryBulkJobRepository,
+    InMemoryTransferRepository,
+)
+from app.repository.sqlite import (
+    CONTROL_SCHEMA,
+    TENANT_SCHEMA,
+    SqliteDatabase,
+    SqliteTenantRepository,
+    SqliteTenantQuotaRepository,
+    SqliteUserRepository,
+    SqliteNodeTypeRepository,
+    SqliteNodeRepository,
+    SqliteRelationshipRepository,
+    SqliteOutboxRepository,
+    SqliteDataKeyRepository,
+    SqliteBulkJobRepository,
+)
 
 __all__ = [
     "Tenant",
+    "TenantSlugChange",
     "User",
     "TenantUser",
+    "ApiKey",
+    "AuditEvent",
+    "AuditExport",
+    "BackupVerification",
+    "ServerInstance",
+    "ClusterLease",
+    "TenantQuota",
+    "TenantDeletion",
+    "TENANT_DELETION_STEPS",
     "NodeType",
+    "NodeTypeIndex",
+    "DataFilter",
     "Node",
+    "NodeRevision",
     "Relationship",
+    "GeoFilter",
+    "Aggregation",
+    "AggregationRange",
+    "AggregationBucket",
+    "OutboxEvent",
+    "ChangeFeedPosition",
+    "ChangePage",
+    "WebhookEndpoint",
+    "WebhookDelivery",
+    "EventSubscription",
+    "SubscriptionMessage",
+    "IntakeForm",
+    "EmailInbox",
+    "EmailAttachment",
+    "Attachment",
+    "NodeLock",
+    "ImportProgress",
+    "ImportRow",
+    "NodeValidationReport",
+    "LakeExport",
+    "NodeMigration",
+    "RetentionPolicy",
+    "BatchHook",
+    "BulkJob",
+    "BULK_IMPORT",
+    "BULK_DELETE",
+    "BULK_BACKFILL",
+    "BULK_EXPORT",
+    "Operation",
+    "DeadLetter",
+    "DEAD_LETTER_WEBHOOK_DELIVERY",
+    "DEAD_LETTER_NODE_MIGRATION",
+    "DEAD_LETTER_KINDS",
+    "BiView",
+    "BiViewColumn",
+    "DataKey",
+    "SortOrder",
+    "MAX_PAGE_SIZE",
     "ListOptions",
+    "FilterValues",
+    "filter_values",
     "ListResult",
     "TenantRepository",
     "UserRepository",
+    "ApiKeyRepository",
+    "AuditRepository",
+    "BackupVerificationRepository",
+    "ServerInstanceRepository",
+    "TenantQuotaRepository",
+    "TenantDeletionRepository",
     "NodeTypeRepository",
     "NodeRepository",
     "RelationshipRepository",
+    "OutboxRepository",
+    "record_event",
+    "WebhookRepository",
+    "SubscriptionRepository",
+    "IntakeFormRepository",
+    "EmailInboxRepository",
+    "TransferRepository",
+    "ExportPosition",
+    "EXPORT_RECORD_TYPES",
+    "BiViewRepository",
+    "LakeExportRepository",
+    "NodeMigrationRepository",
+    "RetentionPolicyRepository",
+    "AttachmentRepository",
+    "NodeLockRepository",
+    "DataKeyRepository",
+    "BulkJobRepository",
+    "DeadLetterRepository",
+    "add_dead_letter",
     "NotFoundError",
+    "ConflictError",
+    "FailedPreconditionError",
+    "NodeLockedError",
+    "AlreadyExistsError",
+    "FieldViolation",
+    "QuotaExceededError",
+    "ValidationError",
+    "error_details",
+    "InMemoryControlStore",
+    "InMemoryStore",
+    "InMemoryTenantRepository",
+    "InMemoryTenantQuotaRepository",
+    "InMemoryUserRepository",
+    "InMemoryNodeTypeRepository",
+    "InMemoryNodeRepository",
+    "InMemoryRelationshipRepository",
+    "InMemoryOutboxRepository",
+    "InMemoryDataKeyRepository",
+    "InMemoryBulkJobRepository",
+    "InMemoryTransferRepository",
+    "CONTROL_SCHEMA",
+    "TENANT_SCHEMA",
+    "SqliteDatabase",
+    "SqliteTenantRepository",
+    "SqliteTenantQuotaRepository",
+    "SqliteUserRepository",
+    "SqliteNodeTypeRepository",
+    "SqliteNodeRepository",
+    "SqliteRelationshipRepository",
+    "SqliteOutboxRepository",
+    "SqliteDataKeyRepository",
+    "SqliteBulkJobRepository",
 ]
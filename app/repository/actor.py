@@ -0,0 +1,29 @@
+"""
+Attribution of node changes.
+
+Node revisions record the actor of the request that made the change, so a
+node's history tells who changed what. The server sets the actor of each
+request from its principal (see app/auth/authorization.py):
+
+- "api_key:<API key ID>" for API keys
+- "admin" for the admin key
+- "anonymous" for requests without a key, when authentication isn't required
+
+Changes made outside of requests, by jobs the server runs on its own, have no
+actor (""). Background work started by a request, like bulk deletes, runs in
+a copy of its context and keeps its actor.
+"""
+
+from contextvars import ContextVar
+
+_actor: ContextVar[str] = ContextVar("flexdb_actor", default="")
+
+
+def current_actor() -> str:
+    """Return the actor of the current request, or "" outside of requests."""
+    return _actor.get()
+
+
+def set_actor(actor: str) -> None:
+    """Set the actor of the current request."""
+    _actor.set(actor)
@@ -0,0 +1,285 @@
+"""
+API key repository implementation.
+"""
+
+import uuid
+from datetime import datetime
+from typing import List, Optional, Tuple
+
+import asyncpg
+
+from app.db.database import Database
+from app.repository.models import ApiKey, ListOptions, ListResult
+from app.repository.errors import ConflictError, NotFoundError
+
+_API_KEY_COLUMNS = (
+    "id, tenant_id, name, key_prefix, scopes, node_type_ids, created_at, revoked_at, "
+    "revoke_reason, expires_at, last_used_at, rotated_from_id"
+)
+
+# Keys that still authenticate
+_ACTIVE = "revoked_at IS NULL AND (expires_at IS NULL OR expires_at > NOW())"
+
+
+class ApiKeyRepository:
+    """PostgreSQL API key repository (control database)."""
+
+    def __init__(self, db: Database):
+        self.db = db
+
+    async def create(self, api_key: ApiKey, key_hash: str) -> ApiKey:
+        """Create an API key, storing only the hash of the key."""
+        api_key.id = str(uuid.uuid4())
+        api_key.created_at = datetime.now()
+
+        async with self.db.pool.acquire() as conn:
+            return await self._insert(conn, api_key, key_hash)
+
+    async def _insert(self, conn: asyncpg.Connection, api_key: ApiKey, key_hash: str) -> ApiKey:
+        query = f"""
+            INSERT INTO api_keys (
+                id, tenant_id, name, key_prefix, key_hash, scopes, node_type_ids, created_at,
+                expires_at, rotated_from_id
+            )
+            VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+            RETURNING {_API_KEY_COLUMNS}
+        """
+
+        try:
+            row = await conn.fetchrow(
+                query,
+                api_key.id, api_key.tenant_id, api_key.name, api_key.key_prefix, key_hash,
+                api_key.scopes, api_key.node_type_ids, api_key.created_at,
+                api_key.expires_at, api_key.rotated_from_id or None
+            )
+        except asyncpg.ForeignKeyViolationError:
+            raise NotFoundError(f"tenant not found: {api_key.tenant_id}") from None
+
+        return self._row_to_api_key(row)
+
+    async def get_by_id(self, tenant_id: str, id: str) -> ApiKey:
+        """Retrieve a tenant's API key by ID."""
+        query = f"SELECT {_API_KEY_COLUMNS} FROM api_keys WHERE id = $1 AND tenant_id = $2"
+
+        async with self.db.pool.acquire() as conn:
+            row = await conn.fetchrow(query, id, tenant_id)
+
+        if not row:
+            raise NotFoundError(f"api_key not found: {id}")
+
+        return self._row_to_api_key(row)
+
+    async def get_active_by_hash(self, key_hash: str) -> Optional[ApiKey]:
+        """Retrieve the unrevoked, unexpired API key with the given key hash, if any."""
+        query = f"SELECT {_API_KEY_COLUMNS} FROM api_keys WHERE key_hash = $1 AND {_ACTIVE}"
+
+        async with self.db.pool.acquire() as conn:
+            row = await conn.fetchrow(query, key_hash)
+
+        return self._row_to_api_key(row) if row else None
+
+    async def touch(self, id: str, resolution: float) -> None:
+        """
+        Record that an API key was used, unless that was recorded less than
+        resolution seconds ago. Clears any unused-key warning.
+        """
+        query = """
+            UPDATE api_keys
+            SET last_used_at = NOW(), warned_at = NULL
+            WHERE id = $1 AND (last_used_at IS NULL OR last_used_at < NOW() - make_interval(secs => $2))
+        """
+
+        async with self.db.pool.acquire() as conn:
+            await conn.execute(query, id, float(resolution))
+
+    async def record_ip(self, id: str, client_ip: str) -> bool:
+        """
+        Record that an API key was used from a client IP. Returns whether that
+        IP is new for a key previously used from other IPs.
+        """
+        query = """
+            WITH known AS (
+                SELECT EXISTS (SELECT 1 FROM api_key_ips WHERE api_key_id = $1) AS used
+            ), seen AS (
+                INSERT INTO api_key_ips (api_key_id, client_ip) VALUES ($1, $2)
+                ON CONFLICT (api_key_id, client_ip) DO UPDATE SET last_seen_at = NOW()
+                RETURNING (xmax = 0) AS inserted
+            )
+            SELECT seen.inserted AND known.used FROM seen, known
+        """
+
+        async with self.db.pool.acquire() as conn:
+            return bool(await conn.fetchval(query, id, client_ip))
+
+    async def list_by_prefix(self, key_prefix: str) -> List[ApiKey]:
+        """Retrieve the API keys of all tenants with the given key prefix, including revoked ones."""
+        query = f"SELECT {_API_KEY_COLUMNS} FROM api_keys WHERE key_prefix = $1 ORDER BY created_at"
+
+        async with self.db.pool.acquire() as conn:
+            rows = await conn.fetch(query, key_prefix)
+
+        return [self._row_to_api_key(row) for row in rows]
+
+    async def list(self, tenant_id: str, opts: ListOptions) -> Tuple[List[ApiKey], ListResult]:
+        """Retrieve a tenant's API keys with pagination, including revoked ones."""
+        page_size = max(1, min(opts.page_size or 10, 100))
+        offset = 0
+        if opts.page_token:
+            try:
+                offset = int(opts.page_token)
+            except ValueError:
+                offset = 0
+
+        async with self.db.pool.acquire() as conn:
+            total_count = await conn.fetchval("SELECT COUNT(*) FROM api_keys WHERE tenant_id = $1", tenant_id)
+
+            query = f"""
+                SELECT {_API_KEY_COLUMNS}
+                FROM api_keys
+                WHERE tenant_id = $1
+                ORDER BY created_at DESC
+                LIMIT $2 OFFSET $3
+            """
+            rows = await conn.fetch(query, tenant_id, page_size, offset)
+
+        api_keys = [self._row_to_api_key(row) for row in rows]
+
+        result = ListResult(total_count=total_count)
+        next_offset = offset + len(api_keys)
+        if next_offset < total_count:
+            result.next_page_token = str(next_offset)
+
+        return api_keys, result
+
+    async def list_all(self) -> List[ApiKey]:
+        """Retrieve the API keys of all tenants, including revoked ones."""
+        query = f"""
+            SELECT {_API_KEY_COLUMNS}
+            FROM api_keys
+            ORDER BY tenant_id, created_at
+        """
+
+        async with self.db.pool.acquire() as conn:
+            rows = await conn.fetch(query)
+
+        return [self._row_to_api_key(row) for row in rows]
+
+    async def revoke(self, tenant_id: str, id: str) -> ApiKey:
+        """Revoke a tenant's API key; revoking a revoked key keeps the original time and reason."""
+        query = f"""
+            UPDATE api_keys
+            SET revoked_at = COALESCE(revoked_at, NOW()),
+                revoke_reason = CASE WHEN revoked_at IS NULL THEN 'revoked' ELSE revoke_reason END
+            WHERE id = $1 AND tenant_id = $2
+            RETURNING {_API_KEY_COLUMNS}
+        """
+
+        async with self.db.pool.acquire() as conn:
+            row = await conn.fetchrow(query, id, tenant_id)
+
+        if not row:
+            raise NotFoundError(f"api_key not found: {id}")
+
+        return self._row_to_api_key(row)
+
+    async def rotate(self, old: ApiKey, new: ApiKey, key_hash: str, grace_period: float) -> Tuple[ApiKey, ApiKey]:
+        """
+        Replace an active API key with a new one in one transaction.
+
+        The old key is revoked, or with a grace_period in seconds expires
+        then (or at its own expiry, if sooner). Returns the new and old key.
+        """
+        query = f"""
+            UPDATE api_keys
+            SET revoked_at = CASE WHEN $3::float8 > 0 THEN revoked_at ELSE NOW() END,
+                revoke_reason = CASE WHEN $3::float8 > 0 THEN revoke_reason ELSE 'rotated' END,
+                expires_at = CASE
+                    WHEN $3::float8 > 0 THEN LEAST(COALESCE(expires_at, 'infinity'), NOW() + make_interval(secs => $3))
+                    ELSE expires_at
+                END
+            WHERE id = $1 AND tenant_id = $2 AND {_ACTIVE}
+            RETURNING {_API_KEY_COLUMNS}
+        """
+
+        new.id = str(uuid.uuid4())
+        new.created_at = datetime.now()
+        new.rotated_from_id = old.id
+
+        async with self.db.pool.acquire() as conn:
+            async with conn.transaction():
+                row = await conn.fetchrow(query, old.id, old.tenant_id, float(grace_period))
+                if not row:
+                    exists = await conn.fetchval(
+                        "SELECT 1 FROM api_keys WHERE id = $1 AND tenant_id = $2", old.id, old.tenant_id
+                    )
+                    if not exists:
+                        raise NotFoundError(f"api_key not found: {old.id}")
+                    raise ConflictError(f"api_key {old.id} is revoked or expired")
+                rotated = await self._insert(conn, new, key_hash)
+
+        return rotated, self._row_to_api_key(row)
+
+    async def list_expiring(self, within: float) -> List[ApiKey]:
+        """Retrieve active keys of all tenants expiring within the given seconds whose tenant wasn't warned yet."""
+        query = f"""
+            SELECT {_API_KEY_COLUMNS}
+            FROM api_keys
+            WHERE {_ACTIVE} AND warned_at IS NULL AND expires_at <= NOW() + make_interval(secs => $1)
+            ORDER BY expires_at
+        """
+
+        async with self.db.pool.acquire() as conn:
+            rows = await conn.fetch(query, float(within))
+
+        return [self._row_to_api_key(row) for row in rows]
+
+    async def list_unused(self, idle: float) -> List[ApiKey]:
+        """Retrieve active keys of all tenants unused for the given seconds whose tenant wasn't warned yet."""
+        query = f"""
+            SELECT {_API_KEY_COLUMNS}
+            FROM api_keys
+            WHERE {_ACTIVE} AND warned_at IS NULL
+              AND COALESCE(last_used_at, created_at) < NOW() - make_interval(secs => $1)
+            ORDER BY COALESCE(last_used_at, created_at)
+        """
+
+        async with self.db.pool.acquire() as conn:
+            rows = await conn.fetch(query, float(idle))
+
+        return [self._row_to_api_key(row) for row in rows]
+
+    async def mark_warned(self, id: str) -> None:
+        """Record that the tenant was warned about a key."""
+        async with self.db.pool.acquire() as conn:
+            await conn.execute("UPDATE api_keys SET warned_at = NOW() WHERE id = $1", id)
+
+    async def disable_unused(self, idle: float) -> List[ApiKey]:
+        """Revoke active keys of all tenants unused for the given seconds and return them."""
+        query = f"""
+            UPDATE api_keys
+            SET revoked_at = NOW(), revoke_reason = 'unused'
+            WHERE {_ACTIVE} AND COALESCE(last_used_at, created_at) < NOW() - make_interval(secs => $1)
+            RETURNING {_API_KEY_COLUMNS}
+        """
+
+        async with self.db.pool.acquire() as conn:
+            rows = await conn.fetch(query, float(idle))
+
+        return [self._row_to_api_key(row) for row in rows]
+
+    def _row_to_api_key(self, row: asyncpg.Record) -> ApiKey:
+        """Convert a database row to an ApiKey object."""
+        return ApiKey(
+            id=str(row["id"]),
+            tenant_id=str(row["tenant_id"]),
+            name=row["name"],
+            key_prefix=row["key_prefix"],
+            scopes=list(row["scopes"]),
+            node_type_ids=list(row["node_type_ids"]),
+            created_at=row["created_at"],
+            revoked_at=row["revoked_at"],
+            revoke_reason=row["revoke_reason"] or "",
+            expires_at=row["expires_at"],
+            last_used_at=row["last_used_at"],
+            rotated_from_id=str(row["rotated_from_id"]) if row["rotated_from_id"] else "",
+        )
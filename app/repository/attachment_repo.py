@@ -0,0 +1,99 @@
+"""
+Attachment repository implementation.
+"""
+
+import uuid
+from typing import List
+
+from app.db.database import Database
+from app.repository.errors import NotFoundError
+from app.repository.models import Attachment
+
+_ATTACHMENT_COLUMNS = "id, node_id, filename, content_type, size_bytes, sha256, blob_key, created_at"
+
+
+class AttachmentRepository:
+    """PostgreSQL repository of node attachment metadata; their bytes are in the blob store."""
+
+    def __init__(self, db: Database):
+        self.db = db
+
+    async def create(self, attachment: Attachment) -> Attachment:
+        """Store an attachment's metadata; raises NotFoundError if its node doesn't exist."""
+        query = f"""
+            INSERT INTO attachments (id, node_id, filename, content_type, size_bytes, sha256, blob_key)
+            SELECT $1, id, $3, $4, $5, $6, $7 FROM nodes WHERE id = $2
+            RETURNING {_ATTACHMENT_COLUMNS}
+        """
+
+        async with self.db.pool.acquire() as conn:
+            row = await conn.fetchrow(
+                query, attachment.id, attachment.node_id, attachment.filename, attachment.content_type,
+                attachment.size_bytes, attachment.sha256, attachment.blob_key
+            )
+
+        if not row:
+            raise NotFoundError(f"node not found: {attachment.node_id}")
+
+        return self._row_to_attachment(row)
+
+    async def get_by_id(self, id: str) -> Attachment:
+        """Retrieve an attachment's metadata by ID."""
+        _check_id(id)
+        query = f"SELECT {_ATTACHMENT_COLUMNS} FROM attachments WHERE id = $1"
+
+        async with self.db.pool.acquire() as conn:
+            row = await conn.fetchrow(query, id)
+
+        if not row:
+            raise NotFoundError(f"attachment not found: {id}")
+
+        return self._row_to_attachment(row)
+
+    async def list(self, node_id: str) -> List[Attachment]:
+        """Retrieve the attachments of a node, oldest first."""
+        query = f"""
+            SELECT {_ATTACHMENT_COLUMNS}
+            FROM attachments
+            WHERE node_id = $1
+            ORDER BY created_at, filename
+        """
+
+        async with self.db.pool.acquire() as conn:
+            rows = await conn.fetch(query, node_id)
+
+        return [self._row_to_attachment(row) for row in rows]
+
+    async def delete(self, id: str) -> Attachment:
+        """Remove an attachment's metadata, returning it."""
+        _check_id(id)
+        query = f"DELETE FROM attachments WHERE id = $1 RETURNING {_ATTACHMENT_COLUMNS}"
+
+        async with self.db.pool.acquire() as conn:
+            row = await conn.fetchrow(query, id)
+
+        if not row:
+            raise NotFoundError(f"attachment not found: {id}")
+
+        return self._row_to_attachment(row)
+
+    def _row_to_attachment(self, row) -> Attachment:
+        """Convert a database row to an Attachment object."""
+        return Attachment(
+            id=str(row[0]),
+            node_id=str(row[1]),
+            filename=row[2],
+            content_type=row[3],
+            size_bytes=row[4],
+            sha256=row[5],
+            blob_key=row[6],
+            created_at=row[7],
+        )
+
+
+def _check_id(id: str) -> None:
+    """Raise NotFoundError for IDs that aren't UUIDs, which no attachment has."""
+    try:
+        uuid.UUID(id)
+    except ValueError:
+        raise NotFoundError(f"attachment not found: {id}") from None
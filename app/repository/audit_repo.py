@@ -0,0 +1,202 @@
+"""
+Audit log repository implementation.
+"""
+
+import json
+from datetime import datetime
+from typing import Awaitable, Callable, Dict, List, Optional, Set, Tuple
+
+import asyncpg
+
+from app.db.database import Database
+from app.repository.models import AuditEvent, AuditExport, ListOptions, ListResult
+
+_AUDIT_EVENT_COLUMNS = "id, tenant_id, event_type, api_key_id, client_ip, details::text, created_at"
+_AUDIT_EXPORT_COLUMNS = (
+    "sequence, first_event_id, last_event_id, event_count, object_key, hash, prev_hash, exported_at"
+)
+
+
+class AuditRepository:
+    """PostgreSQL audit log repository (control database). The log is append-only."""
+
+    def __init__(self, db: Database):
+        self.db = db
+
+    async def record(self, event: AuditEvent) -> AuditEvent:
+        """Append an event to the audit log."""
+        query = f"""
+            INSERT INTO audit_events (tenant_id, event_type, api_key_id, client_ip, details)
+            VALUES ($1, $2, $3, $4, $5::jsonb)
+            RETURNING {_AUDIT_EVENT_COLUMNS}
+        """
+
+        async with self.db.pool.acquire() as conn:
+            row = await conn.fetchrow(
+                query,
+                event.tenant_id or None, event.event_type, event.api_key_id or None,
+                event.client_ip, json.dumps(event.details)
+            )
+
+        return self._row_to_audit_event(row)
+
+    async def list(self, tenant_id: str, event_type: str, opts: ListOptions) -> Tuple[List[AuditEvent], ListResult]:
+        """
+        Retrieve audit events with pagination, newest first, optionally only
+        those of a tenant or of an event type.
+        """
+        page_size = max(1, min(opts.page_size or 10, 100))
+        offset = 0
+        if opts.page_token:
+            try:
+                offset = int(opts.page_token)
+            except ValueError:
+                offset = 0
+
+        where = "WHERE ($1::uuid IS NULL OR tenant_id = $1::uuid) AND ($2 = '' OR event_type = $2)"
+
+        async with self.db.pool.acquire() as conn:
+            total_count = await conn.fetchval(
+                f"SELECT COUNT(*) FROM audit_events {where}", tenant_id or None, event_type
+            )
+
+            query = f"""
+                SELECT {_AUDIT_EVENT_COLUMNS}
+                FROM audit_events
+                {where}
+                ORDER BY id DESC
+                LIMIT $3 OFFSET $4
+            """
+            rows = await conn.fetch(query, tenant_id or None, event_type, page_size, offset)
+
+        events = [self._row_to_audit_event(row) for row in rows]
+
+        result = ListResult(total_count=total_count)
+        next_offset = offset + len(events)
+        if next_offset < total_count:
+            result.next_page_token = str(next_offset)
+
+        return events, result
+
+    async def list_range(self, first_id: int, last_id: int) -> List[AuditEvent]:
+        """Retrieve the events with IDs from first_id to last_id, in order."""
+        query = f"""
+            SELECT {_AUDIT_EVENT_COLUMNS}
+            FROM audit_events
+            WHERE id BETWEEN $1 AND $2
+            ORDER BY id
+        """
+
+        async with self.db.pool.acquire() as conn:
+            rows = await conn.fetch(query, first_id, last_id)
+
+        return [self._row_to_audit_event(row) for row in rows]
+
+    async def count_by_type(self, since: datetime, until: datetime) -> Dict[str, int]:
+        """Count the events from since until until by event type."""
+        query = """
+            SELECT event_type, COUNT(*)
+            FROM audit_events
+            WHERE created_at >= $1 AND created_at < $2
+            GROUP BY event_type
+            ORDER BY event_type
+        """
+
+        async with self.db.pool.acquire() as conn:
+            rows = await conn.fetch(query, since, until)
+
+        return {row[0]: row[1] for row in rows}
+
+    async def export_next(
+        self,
+        limit: int,
+        settle_seconds: float,
+        export: Callable[[Optional[AuditExport], List[AuditEvent]], Awaitable[AuditExport]]
+    ) -> Optional[AuditExport]:
+        """
+        Pass the oldest events not yet exported to export and record the batch.
+
+        In one transaction: take the audit export advisory lock, read up to
+        limit events after the last exported one, only those older than
+        settle_seconds, await export(last batch, events) and record the batch it
+        returns. If export raises, nothing is recorded and the same events are
+        offered again next time. Returns None when there is nothing to export
+        or another server instance holds the lock.
+        """
+        async with self.db.pool.acquire() as conn:
+            async with conn.transaction():
+                locked = await conn.fetchval("SELECT pg_try_advisory_xact_lock(hashtext('flexdb.audit_exports'))")
+                if not locked:
+                    return None
+
+                row = await conn.fetchrow(
+                    f"SELECT {_AUDIT_EXPORT_COLUMNS} FROM audit_exports ORDER BY sequence DESC LIMIT 1"
+                )
+                last = self._row_to_audit_export(row) if row else None
+
+                rows = await conn.fetch(
+                    f"""
+                    SELECT {_AUDIT_EVENT_COLUMNS}
+                    FROM audit_events
+                    WHERE id > $1 AND created_at < NOW() - make_interval(secs => $2)
+                    ORDER BY id
+                    LIMIT $3
+                    """,
+                    last.last_event_id if last else 0, settle_seconds, limit
+                )
+                if not rows:
+                    return None
+
+                batch = await export(last, [self._row_to_audit_event(row) for row in rows])
+                row = await conn.fetchrow(
+                    f"""
+                    INSERT INTO audit_exports (
+                        sequence, first_event_id, last_event_id, event_count, object_key, hash, prev_hash
+                    )
+                    VALUES ($1, $2, $3, $4, $5, $6, $7)
+                    RETURNING {_AUDIT_EXPORT_COLUMNS}
+                    """,
+                    batch.sequence, batch.first_event_id, batch.last_event_id, batch.event_count,
+                    batch.object_key, batch.hash, batch.prev_hash
+                )
+
+        return self._row_to_audit_export(row)
+
+    async def list_exports(self) -> List[AuditExport]:
+        """Retrieve all exported batches in sequence order."""
+        async with self.db.pool.acquire() as conn:
+            rows = await conn.fetch(f"SELECT {_AUDIT_EXPORT_COLUMNS} FROM audit_exports ORDER BY sequence")
+
+        return [self._row_to_audit_export(row) for row in rows]
+
+    async def list_erased_tenant_ids(self) -> Set[str]:
+        """Retrieve the IDs of tenants whose audit events are deleted with them (see tenant_deletions)."""
+        async with self.db.pool.acquire() as conn:
+            rows = await conn.fetch("SELECT tenant_id FROM tenant_deletions")
+
+        return {str(row["tenant_id"]) for row in rows}
+
+    def _row_to_audit_export(self, row: asyncpg.Record) -> AuditExport:
+        """Convert a database row to an AuditExport object."""
+        return AuditExport(
+            sequence=row["sequence"],
+            first_event_id=row["first_event_id"],
+            last_event_id=row["last_event_id"],
+            event_count=row["event_count"],
+            object_key=row["object_key"],
+            hash=row["hash"],
+            prev_hash=row["prev_hash"],
+            exported_at=row["exported_at"],
+        )
+
+    def _row_to_audit_event(self, row: asyncpg.Record) -> AuditEvent:
+        """Convert a database row to an AuditEvent object."""
+        return AuditEvent(
+            id=str(row["id"]),
+            tenant_id=str(row["tenant_id"]) if row["tenant_id"] else "",
+            event_type=row["event_type"],
+            api_key_id=str(row["api_key_id"]) if row["api_key_id"] else "",
+            client_ip=row["client_ip"],
+            details=json.loads(row["details"]),
+            created_at=row["created_at"],
+        )
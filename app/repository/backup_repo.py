@@ -0,0 +1,83 @@
+"""
+Backup verification repository implementation.
+"""
+
+import json
+from datetime import datetime
+from typing import List, Optional
+
+import asyncpg
+
+from app.db.database import Database
+from app.repository.models import BackupVerification
+
+_BACKUP_VERIFICATION_COLUMNS = (
+    "id, backup, backup_taken_at, database_kind, status, checks::text, error, duration_seconds, "
+    "started_at, finished_at"
+)
+
+
+class BackupVerificationRepository:
+    """PostgreSQL repository of restore drill results (control database)."""
+
+    def __init__(self, db: Database):
+        self.db = db
+
+    async def record(self, verification: BackupVerification) -> BackupVerification:
+        """Record the result of a restore drill."""
+        query = f"""
+            INSERT INTO backup_verifications (
+                backup, backup_taken_at, database_kind, status, checks, error, duration_seconds,
+                started_at, finished_at
+            )
+            VALUES ($1, $2, $3, $4, $5::jsonb, $6, $7, $8, $9)
+            RETURNING {_BACKUP_VERIFICATION_COLUMNS}
+        """
+
+        async with self.db.pool.acquire() as conn:
+            row = await conn.fetchrow(
+                query,
+                verification.backup, verification.backup_taken_at, verification.database_kind,
+                verification.status, json.dumps(verification.checks), verification.error,
+                verification.duration_seconds, verification.started_at, verification.finished_at
+            )
+
+        return self._row_to_backup_verification(row)
+
+    async def latest(self) -> Optional[BackupVerification]:
+        """Retrieve the most recent restore drill, or None if there was none."""
+        async with self.db.pool.acquire() as conn:
+            row = await conn.fetchrow(
+                f"SELECT {_BACKUP_VERIFICATION_COLUMNS} FROM backup_verifications ORDER BY started_at DESC, id DESC LIMIT 1"
+            )
+
+        return self._row_to_backup_verification(row) if row else None
+
+    async def list_since(self, since: datetime) -> List[BackupVerification]:
+        """Retrieve the restore drills started since the given time, oldest first."""
+        query = f"""
+            SELECT {_BACKUP_VERIFICATION_COLUMNS}
+            FROM backup_verifications
+            WHERE started_at >= $1
+            ORDER BY started_at, id
+        """
+
+        async with self.db.pool.acquire() as conn:
+            rows = await conn.fetch(query, since)
+
+        return [self._row_to_backup_verification(row) for row in rows]
+
+    def _row_to_backup_verification(self, row: asyncpg.Record) -> BackupVerification:
+        """Convert a database row to a BackupVerification object."""
+        return BackupVerification(
+            id=str(row["id"]),
+            backup=row["backup"],
+            backup_taken_at=row["backup_taken_at"],
+            database_kind=row["database_kind"],
+            status=row["status"],
+            checks=json.loads(row["checks"]),
+            error=row["error"],
+            duration_seconds=row["duration_seconds"],
+            started_at=row["started_at"],
+            finished_at=row["finished_at"],
+        )
@@ -0,0 +1,118 @@
+"""
+BI view repository implementation.
+
+Maintains the read-only views in the tenant database's "bi" schema that BI
+tools query directly: one view per node type with data fields as typed
+columns, plus a relationships view. Views are always rebuilt as a whole.
+"""
+
+from typing import List
+
+from app.db.database import Database
+from app.repository.models import BiView, BiViewColumn
+
+BI_SCHEMA = "bi"
+RELATIONSHIPS_VIEW = "relationships"
+
+# Columns every node type view starts with; data fields use other names
+NODE_VIEW_COLUMNS = ("id", "created_at", "updated_at", "version")
+
+_NUMBER = "jsonb_typeof({value}) = 'number'"
+_DECIMAL_STRING = r"jsonb_typeof({value}) = 'string' AND ({text}) ~ '^[+-]?[0-9]+(\.[0-9]+)?$'"
+
+
+def quote_ident(name: str) -> str:
+    """Quote an SQL identifier."""
+    return '"' + name.replace('"', '""') + '"'
+
+
+def quote_literal(value: str) -> str:
+    """Quote an SQL string literal (standard_conforming_strings is assumed on)."""
+    return "'" + value.replace("'", "''") + "'"
+
+
+def column_sql(column: BiViewColumn) -> str:
+    """Return the select expression for a BI view column."""
+    path = "ARRAY[" + ", ".join(quote_literal(p) for p in column.path) + "]::text[]"
+    value = f"(n.data #> {path})"
+    text = f"(n.data #>> {path})"
+
+    if column.kind == "jsonb":
+        expression = value
+    elif column.kind == "numeric":
+        expression = (
+            f"CASE WHEN {_NUMBER.format(value=value)} THEN {text}::numeric "
+            f"WHEN {_DECIMAL_STRING.format(value=value, text=text)} THEN {text}::numeric END"
+        )
+    elif column.kind == "bigint":
+        expression = (
+            f"CASE WHEN {_NUMBER.format(value=value)} AND {text} ~ '^-?[0-9]{{1,18}}$' "
+            f"THEN {text}::bigint END"
+        )
+    elif column.kind == "boolean":
+        expression = f"CASE WHEN jsonb_typeof({value}) = 'boolean' THEN {text}::boolean END"
+    else:
+        expression = text
+    return f"{expression} AS {quote_ident(column.name)}"
+
+
+def view_sql(view: BiView) -> str:
+    """Return the CREATE VIEW statement for a node type view."""
+    columns = [f"n.{name}" for name in NODE_VIEW_COLUMNS]
+    columns += [column_sql(c) for c in view.columns]
+    columns.append("n.data")
+    return (
+        f"CREATE VIEW {BI_SCHEMA}.{quote_ident(view.name)} AS\n"
+        f"SELECT {', '.join(columns)}\n"
+        f"FROM public.nodes n\n"
+        f"WHERE n.node_type_id = {quote_literal(view.node_type_id)}::uuid"
+    )
+
+
+class BiViewRepository:
+    """PostgreSQL BI view repository."""
+
+    def __init__(self, db: Database, reader_role: str = ""):
+        self.db = db
+        self.reader_role = reader_role
+
+    async def replace_views(self, views: List[BiView]) -> None:
+        """
+        Drop all views in the bi schema and create the given node type views.
+
+        Runs in one transaction under an advisory lock, so BI tools see either
+        the old or the new views and concurrent rebuilds do not interleave.
+        SELECT is granted to the reader role, if configured.
+        """
+        async with self.db.pool.acquire() as conn:
+            async with conn.transaction():
+                await conn.execute("SELECT pg_advisory_xact_lock(hashtext('flexdb.bi_views'))")
+                await conn.execute(f"CREATE SCHEMA IF NOT EXISTS {BI_SCHEMA}")
+
+                existing = await conn.fetch(
+                    "SELECT table_name FROM information_schema.views WHERE table_schema = $1",
+                    BI_SCHEMA
+                )
+                for row in existing:
+                    await conn.execute(f"DROP VIEW IF EXISTS {BI_SCHEMA}.{quote_ident(row['table_name'])}")
+
+                await conn.execute(
+                    f"CREATE VIEW {BI_SCHEMA}.{RELATIONSHIPS_VIEW} AS\n"
+                    "SELECT id, source_node_id, target_node_id, relationship_type, data, created_at, updated_at, version\n"
+                    "FROM public.relationships"
+                )
+                names = [RELATIONSHIPS_VIEW]
+
+                for view in views:
+                    await conn.execute(view_sql(view))
+                    await conn.execute(
+                        f"COMMENT ON VIEW {BI_SCHEMA}.{quote_ident(view.name)} IS "
+                        f"{quote_literal(f'Nodes of type {view.node_type_name} ({view.node_type_id})')}"
+                    )
+                    names.append(view.name)
+
+                if self.reader_role:
+                    role = quote_ident(self.reader_role)
+                    await conn.execute(f"GRANT USAGE ON SCHEMA {BI_SCHEMA} TO {role}")
+                    for name in names:
+                        await conn.execute(f"GRANT SELECT ON {BI_SCHEMA}.{quote_ident(name)} TO {role}")
@@ -0,0 +1,182 @@
+"""
+Bulk job repository implementation.
+"""
+
+import json
+import uuid
+from typing import List, Optional, Tuple
+
+import asyncpg
+
+from app.db.database import Database
+from app.repository.models import BulkJob, ListOptions, ListResult, MAX_PAGE_SIZE
+from app.repository.errors import NotFoundError
+
+_BULK_JOB_COLUMNS = """
+    id, kind, status, params::text, processed, total, unit, progress::text, error,
+    created_at, updated_at, finished_at
+"""
+
+
+class BulkJobRepository:
+    """PostgreSQL repository of bulk jobs (tenant database)."""
+
+    def __init__(self, db: Database, max_page_size: int = MAX_PAGE_SIZE):
+        self.db = db
+        self.max_page_size = max_page_size
+
+    async def create(self, job: BulkJob) -> BulkJob:
+        """Create a running job."""
+        job.id = str(uuid.uuid4())
+        query = f"""
+            INSERT INTO bulk_jobs (id, kind, params, total, unit)
+            VALUES ($1, $2, $3::jsonb, $4, $5)
+            RETURNING {_BULK_JOB_COLUMNS}
+        """
+
+        async with self.db.pool.acquire() as conn:
+            row = await conn.fetchrow(query, job.id, job.kind, json.dumps(job.params), job.total, job.unit)
+
+        return self._row_to_job(row)
+
+    async def get_by_id(self, id: str) -> BulkJob:
+        """Retrieve a job by ID."""
+        _check_id(id)
+        query = f"SELECT {_BULK_JOB_COLUMNS} FROM bulk_jobs WHERE id = $1"
+
+        async with self.db.pool.acquire() as conn:
+            row = await conn.fetchrow(query, id)
+
+        if not row:
+            raise NotFoundError(f"bulk_job not found: {id}")
+
+        return self._row_to_job(row)
+
+    async def list(self, kind: Optional[str], opts: ListOptions) -> Tuple[List[BulkJob], ListResult]:
+        """Retrieve jobs with pagination, optionally of one kind, newest first."""
+        page_size = max(1, min(opts.page_size or 10, self.max_page_size))
+        offset = 0
+        if opts.page_token:
+            try:
+                offset = int(opts.page_token)
+            except ValueError:
+                offset = 0
+
+        where = " WHERE kind = $1" if kind else ""
+        args = [kind] if kind else []
+        arg_idx = len(args) + 1
+        list_query = f"""
+            SELECT {_BULK_JOB_COLUMNS}
+            FROM bulk_jobs{where}
+            ORDER BY created_at DESC
+            LIMIT ${arg_idx} OFFSET ${arg_idx + 1}
+        """
+
+        async with self.db.pool.acquire() as conn:
+            total_count = await conn.fetchval("SELECT COUNT(*) FROM bulk_jobs" + where, *args)
+            rows = await conn.fetch(list_query, *args, page_size, offset)
+
+        jobs = [self._row_to_job(row) for row in rows]
+
+        result = ListResult(total_count=total_count)
+        next_offset = offset + len(jobs)
+        if next_offset < total_count:
+            result.next_page_token = str(next_offset)
+
+        return jobs, result
+
+    async def cancel(self, id: str) -> BulkJob:
+        """Cancel a running job; finished jobs are returned unchanged."""
+        query = f"""
+            UPDATE bulk_jobs
+            SET status = 'cancelled', updated_at = NOW(), finished_at = NOW()
+            WHERE id = $1 AND status = 'running'
+            RETURNING {_BULK_JOB_COLUMNS}
+        """
+
+        _check_id(id)
+        async with self.db.pool.acquire() as conn:
+            row = await conn.fetchrow(query, id)
+
+        if not row:
+            return await self.get_by_id(id)
+        return self._row_to_job(row)
+
+    async def restart(self, id: str, stale_seconds: float) -> Optional[BulkJob]:
+        """
+        Set a failed or cancelled job running again, or a running one without
+        progress for stale_seconds, whose runner is gone; returns None if the
+        job succeeded or is running.
+        """
+        query = f"""
+            UPDATE bulk_jobs
+            SET status = 'running', error = NULL, finished_at = NULL, updated_at = NOW()
+            WHERE id = $1 AND (
+                status IN ('failed', 'cancelled')
+                OR (status = 'running' AND updated_at < NOW() - make_interval(secs => $2))
+            )
+            RETURNING {_BULK_JOB_COLUMNS}
+        """
+
+        _check_id(id)
+        async with self.db.pool.acquire() as conn:
+            row = await conn.fetchrow(query, id, stale_seconds)
+
+        return self._row_to_job(row) if row else None
+
+    async def save_progress(self, job: BulkJob) -> bool:
+        """
+        Record a job's progress and, unless it was cancelled, its status.
+
+        Returns False if the job was cancelled, setting its status to
+        cancelled; the progress of cancelled jobs is still recorded, so they
+        show how far they got. Finished jobs aren't changed.
+        """
+        finished = job.status != "running"
+        query = """
+            UPDATE bulk_jobs
+            SET processed = $3, total = $4, progress = $5::jsonb, updated_at = NOW(),
+                status = CASE WHEN status = 'running' THEN $2 ELSE status END,
+                error = CASE WHEN status = 'running' THEN $6 ELSE error END,
+                finished_at = CASE WHEN status <> 'running' THEN finished_at WHEN $7::boolean THEN NOW() END
+            WHERE id = $1 AND status IN ('running', 'cancelled')
+            RETURNING status, updated_at, finished_at
+        """
+
+        async with self.db.pool.acquire() as conn:
+            row = await conn.fetchrow(
+                query,
+                job.id, job.status, job.processed, job.total, json.dumps(job.progress), job.error or None, finished
+            )
+
+        if not row:
+            return False
+        job.status = row["status"]
+        job.updated_at = row["updated_at"]
+        job.finished_at = row["finished_at"]
+        return job.status != "cancelled"
+
+    def _row_to_job(self, row: asyncpg.Record) -> BulkJob:
+        """Convert a database row to a BulkJob object."""
+        return BulkJob(
+            id=str(row["id"]),
+            kind=row["kind"],
+            status=row["status"],
+            params=json.loads(row["params"]),
+            processed=row["processed"],
+            total=row["total"],
+            unit=row["unit"],
+            progress=json.loads(row["progress"]),
+            error=row["error"] or "",
+            created_at=row["created_at"],
+            updated_at=row["updated_at"],
+            finished_at=row["finished_at"],
+        )
+
+
+def _check_id(id: str) -> None:
+    """Raise NotFoundError for IDs that aren't UUIDs, which no job has."""
+    try:
+        uuid.UUID(id)
+    except ValueError:
+        raise NotFoundError(f"bulk_job not found: {id}") from None
@@ -0,0 +1,57 @@
+"""
+Data key repository implementation (see app/encryption).
+"""
+
+from typing import Optional
+
+from app.db.database import Database
+from app.repository.errors import NotFoundError
+from app.repository.models import DataKey
+
+_DATA_KEY_COLUMNS = "version, kms_key_id, wrapped_key, created_at"
+
+
+class DataKeyRepository:
+    """PostgreSQL data key repository (tenant database)."""
+
+    def __init__(self, db: Database):
+        self.db = db
+
+    async def latest(self) -> Optional[DataKey]:
+        """Retrieve the data key new values are encrypted with, or None before the first one."""
+        async with self.db.pool.acquire() as conn:
+            row = await conn.fetchrow(f"SELECT {_DATA_KEY_COLUMNS} FROM data_keys ORDER BY version DESC LIMIT 1")
+        return self._row_to_data_key(row) if row else None
+
+    async def get(self, version: int) -> DataKey:
+        """Retrieve a data key by version."""
+        async with self.db.pool.acquire() as conn:
+            row = await conn.fetchrow(f"SELECT {_DATA_KEY_COLUMNS} FROM data_keys WHERE version = $1", version)
+        if not row:
+            raise NotFoundError(f"data_key not found: {version}")
+        return self._row_to_data_key(row)
+
+    async def create(self, key: DataKey) -> DataKey:
+        """
+        Store a data key, unless one with its version exists already: the key
+        created first wins when requests race, and is returned to both.
+        """
+        async with self.db.pool.acquire() as conn:
+            await conn.execute(
+                """
+                INSERT INTO data_keys (version, kms_key_id, wrapped_key, created_at)
+                VALUES ($1, $2, $3, $4)
+                ON CONFLICT (version) DO NOTHING
+                """,
+                key.version, key.kms_key_id, key.wrapped_key, key.created_at
+            )
+            row = await conn.fetchrow(f"SELECT {_DATA_KEY_COLUMNS} FROM data_keys WHERE version = $1", key.version)
+        return self._row_to_data_key(row)
+
+    def _row_to_data_key(self, row) -> DataKey:
+        return DataKey(
+            version=row[0],
+            kms_key_id=row[1],
+            wrapped_key=bytes(row[2]),
+            created_at=row[3],
+        )
@@ -0,0 +1,172 @@
+"""
+Dead letter repository implementation.
+"""
+
+import json
+import uuid
+from typing import Any, Dict, List, Optional, Tuple
+
+import asyncpg
+
+from app.db.database import Database
+from app.repository.models import DeadLetter, ListOptions, ListResult, MAX_PAGE_SIZE
+from app.repository.errors import NotFoundError
+
+_DEAD_LETTER_COLUMNS = """
+    id, kind, source_id, payload::text, error, attempts, status, replay_count, replay_result::text,
+    created_at, updated_at, replayed_at
+"""
+
+
+async def add_dead_letter(
+    conn: asyncpg.Connection,
+    kind: str,
+    source_id: str,
+    payload: Dict[str, Any],
+    error: str,
+    attempts: int
+) -> str:
+    """Add a dead letter on conn, in the transaction recording the failure; returns its ID."""
+    id = str(uuid.uuid4())
+    await conn.execute(
+        """
+        INSERT INTO dead_letters (id, kind, source_id, payload, error, attempts)
+        VALUES ($1, $2, $3, $4::jsonb, $5, $6)
+        """,
+        id, kind, source_id, json.dumps(payload), error or None, attempts
+    )
+    return id
+
+
+class DeadLetterRepository:
+    """PostgreSQL repository of dead letters (tenant database)."""
+
+    def __init__(self, db: Database, max_page_size: int = MAX_PAGE_SIZE):
+        self.db = db
+        self.max_page_size = max_page_size
+
+    async def get_by_id(self, id: str) -> DeadLetter:
+        """Retrieve a dead letter by ID."""
+        _check_id(id)
+        query = f"SELECT {_DEAD_LETTER_COLUMNS} FROM dead_letters WHERE id = $1"
+
+        async with self.db.pool.acquire() as conn:
+            row = await conn.fetchrow(query, id)
+
+        if not row:
+            raise NotFoundError(f"dead_letter not found: {id}")
+
+        return self._row_to_dead_letter(row)
+
+    async def list(
+        self,
+        kind: Optional[str],
+        status: Optional[str],
+        opts: ListOptions
+    ) -> Tuple[List[DeadLetter], ListResult]:
+        """Retrieve dead letters with pagination, optionally of one kind and status, oldest first."""
+        page_size = max(1, min(opts.page_size or 10, self.max_page_size))
+        offset = 0
+        if opts.page_token:
+            try:
+                offset = int(opts.page_token)
+            except ValueError:
+                offset = 0
+
+        conditions = []
+        args: List[Any] = []
+        for column, value in (("kind", kind), ("status", status)):
+            if value:
+                args.append(value)
+                conditions.append(f"{column} = ${len(args)}")
+        where = " WHERE " + " AND ".join(conditions) if conditions else ""
+        arg_idx = len(args) + 1
+        list_query = f"""
+            SELECT {_DEAD_LETTER_COLUMNS}
+            FROM dead_letters{where}
+            ORDER BY created_at, id
+            LIMIT ${arg_idx} OFFSET ${arg_idx + 1}
+        """
+
+        async with self.db.pool.acquire() as conn:
+            total_count = await conn.fetchval("SELECT COUNT(*) FROM dead_letters" + where, *args)
+            rows = await conn.fetch(list_query, *args, page_size, offset)
+
+        dead_letters = [self._row_to_dead_letter(row) for row in rows]
+
+        result = ListResult(total_count=total_count)
+        next_offset = offset + len(dead_letters)
+        if next_offset < total_count:
+            result.next_page_token = str(next_offset)
+
+        return dead_letters, result
+
+    async def claim_replay(self, id: str) -> Optional[DeadLetter]:
+        """
+        Mark a dead letter replayed before replaying it, so it is only replayed
+        once; returns None if it is not dead (already replayed or discarded).
+        """
+        query = f"""
+            UPDATE dead_letters
+            SET status = 'replayed', replay_count = replay_count + 1, replayed_at = NOW(), updated_at = NOW()
+            WHERE id = $1 AND status = 'dead'
+            RETURNING {_DEAD_LETTER_COLUMNS}
+        """
+
+        _check_id(id)
+        async with self.db.pool.acquire() as conn:
+            row = await conn.fetchrow(query, id)
+
+        return self._row_to_dead_letter(row) if row else None
+
+    async def finish_replay(self, dead_letter: DeadLetter, error: str = "") -> None:
+        """Record a replay's result, or put the dead letter back with error if it failed."""
+        query = """
+            UPDATE dead_letters
+            SET status = CASE WHEN $3::text IS NULL THEN 'replayed' ELSE 'dead' END,
+                error = COALESCE($3, error), replay_result = $2::jsonb, updated_at = NOW()
+            WHERE id = $1
+        """
+
+        async with self.db.pool.acquire() as conn:
+            await conn.execute(query, dead_letter.id, json.dumps(dead_letter.replay_result), error or None)
+
+    async def discard(self, id: str) -> Optional[DeadLetter]:
+        """Discard a dead letter so it is not replayed; returns None if it is not dead."""
+        query = f"""
+            UPDATE dead_letters
+            SET status = 'discarded', updated_at = NOW()
+            WHERE id = $1 AND status = 'dead'
+            RETURNING {_DEAD_LETTER_COLUMNS}
+        """
+
+        _check_id(id)
+        async with self.db.pool.acquire() as conn:
+            row = await conn.fetchrow(query, id)
+
+        return self._row_to_dead_letter(row) if row else None
+
+    def _row_to_dead_letter(self, row: asyncpg.Record) -> DeadLetter:
+        """Convert a database row to a DeadLetter object."""
+        return DeadLetter(
+            id=str(row["id"]),
+            kind=row["kind"],
+            source_id=str(row["source_id"]),
+            payload=json.loads(row["payload"]),
+            error=row["error"] or "",
+            attempts=row["attempts"],
+            status=row["status"],
+            replay_count=row["replay_count"],
+            replay_result=json.loads(row["replay_result"]),
+            created_at=row["created_at"],
+            updated_at=row["updated_at"],
+            replayed_at=row["replayed_at"],
+        )
+
+
+def _check_id(id: str) -> None:
+    """Raise NotFoundError for IDs that aren't UUIDs, which no dead letter has."""
+    try:
+        uuid.UUID(id)
+    except ValueError:
+        raise NotFoundError(f"dead_letter not found: {id}") from None
@@ -0,0 +1,29 @@
+"""
+Dry runs of writes.
+
+Creates, updates and deletes of node types, nodes and relationships take a
+dry_run flag. A dry run executes the write in its transaction as usual, so the
+database checks its constraints (unique keys, references, versions), and then
+rolls the transaction back, outbox event and revisions included.
+"""
+
+from contextlib import asynccontextmanager
+from typing import AsyncIterator
+
+import asyncpg
+
+
+@asynccontextmanager
+async def transaction(conn: asyncpg.Connection, dry_run: bool = False) -> AsyncIterator[None]:
+    """Like conn.transaction(), but rolled back at the end of a dry run."""
+    tx = conn.transaction()
+    await tx.start()
+    try:
+        yield
+    except BaseException:
+        await tx.rollback()
+        raise
+    if dry_run:
+        await tx.rollback()
+    else:
+        await tx.commit()
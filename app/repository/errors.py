@@ -1,8 +1,121 @@
 """
 Repository errors module.
+
+Every error carries a reason, the machine-readable cause that API errors
+report in their google.rpc.ErrorInfo detail (see error_details), so clients
+can handle failures without parsing messages.
 """
 
+from dataclasses import dataclass
+from datetime import datetime
+from typing import Any, Dict, List, Optional, Sequence
+
+# Domain of the ErrorInfo details of all errors
+ERROR_DOMAIN = "flexdb"
+ERROR_INFO_TYPE = "type.googleapis.com/google.rpc.ErrorInfo"
+BAD_REQUEST_TYPE = "type.googleapis.com/google.rpc.BadRequest"
+
+# Reasons of errors that aren't raised as one of the classes below
+INVALID_ARGUMENT = "INVALID_ARGUMENT"
+INTERNAL = "INTERNAL"
+
 
 class NotFoundError(Exception):
     """Raised when a resource is not found."""
-    pass
+    reason = "NOT_FOUND"
+
+
+class ConflictError(Exception):
+    """Raised when a write conflicts with the current state (e.g. a stale version)."""
+    reason = "CONFLICT"
+
+
+class AlreadyExistsError(ConflictError):
+    """Raised when a write would duplicate a resource or a unique key."""
+    reason = "ALREADY_EXISTS"
+
+
+class FailedPreconditionError(Exception):
+    """Raised when the state of a resource doesn't allow an operation (e.g. a suspended tenant)."""
+    reason = "FAILED_PRECONDITION"
+
+
+class NodeLockedError(FailedPreconditionError):
+    """Raised when a node is locked by another holder, or a lock token no longer holds the node's lock."""
+    reason = "NODE_LOCKED"
+
+    def __init__(self, message: str, holder: str = "", expires_at: Optional[datetime] = None):
+        super().__init__(message)
+        self.holder = holder
+        self.expires_at = expires_at
+
+
+@dataclass(frozen=True)
+class FieldViolation:
+    """An invalid parameter, as a google.rpc.BadRequest.FieldViolation: its path and what is wrong with it."""
+    field: str
+    description: str
+
+    def to_dict(self) -> Dict[str, str]:
+        return {"field": self.field, "description": self.description}
+
+
+class ValidationError(ValueError):
+    """
+    Raised when parameters are invalid, naming each field at fault.
+
+    The message joins the violations, e.g. ValidationError("slug", "is
+    required") reads "slug is required". It is a ValueError, so callers
+    handling invalid input in general need not tell it apart.
+    """
+    reason = INVALID_ARGUMENT
+
+    def __init__(self, field: str, description: str, *more: FieldViolation):
+        self.violations = [FieldViolation(field, description), *more]
+        super().__init__("; ".join(f"{v.field} {v.description}" for v in self.violations))
+
+    @classmethod
+    def of(cls, violations: Sequence[FieldViolation]) -> "ValidationError":
+        """Return the error of one or more violations."""
+        first, *more = violations
+        return cls(first.field, first.description, *more)
+
+    @property
+    def field(self) -> str:
+        """Path of the first invalid field."""
+        return self.violations[0].field
+
+
+class QuotaExceededError(Exception):
+    """Raised when a tenant or API key is over one of its limits; retry_after is the seconds to wait."""
+    reason = "QUOTA_EXCEEDED"
+
+    def __init__(self, message: str, limit: str, retry_after: float = 0.0):
+        super().__init__(message)
+        self.limit = limit
+        self.retry_after = retry_after
+
+
+def error_details(err: Exception, reason: Optional[str] = None, **metadata: Any) -> List[Dict[str, Any]]:
+    """
+    Return the google.rpc status details of an error, in their JSON form: an
+    ErrorInfo with the error's reason (or the given one) and metadata, then
+    for a ValidationError a BadRequest with its field violations.
+    """
+    if isinstance(err, QuotaExceededError):
+        metadata = {"limit": err.limit, "retry_after": round(err.retry_after, 3), **metadata}
+    if isinstance(err, NodeLockedError) and err.expires_at:
+        metadata = {"holder": err.holder, "expires_at": err.expires_at.isoformat(), **metadata}
+    details: List[Dict[str, Any]] = [{
+        "@type": ERROR_INFO_TYPE,
+        "reason": reason or getattr(err, "reason", INTERNAL),
+        "domain": ERROR_DOMAIN,
+        # ErrorInfo metadata maps strings to strings
+        "metadata": {key: str(value) for key, value in metadata.items()},
+    }]
+    if isinstance(err, ValidationError):
+        details.append({
+            "@type": BAD_REQUEST_TYPE,
+            "field_violations": [violation.to_dict() for violation in err.violations],
+        })
+    return details
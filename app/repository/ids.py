@@ -0,0 +1,60 @@
+"""
+IDs of the records created by the memory and sqlite storage backends, and by
+clones and imports.
+
+IDs are random UUIDs. The emulator (app/emulator.py) can make them
+deterministic instead: the same seed yields the same sequence of UUIDs, so a
+consumer app's tests that create the same records in the same order get the
+same IDs on every run, and can compare responses with recorded ones.
+
+Imported records get IDs derived from the import and their exported IDs, so
+a resumed import assigns the ones it assigned before it stopped.
+
+Record IDs are UUIDs in every backend, so batch reads skip other IDs before
+querying (PostgreSQL would reject them) and report them as missing.
+"""
+
+import random
+import threading
+import uuid
+from typing import List, Optional
+
+_lock = threading.Lock()
+_random: Optional[random.Random] = None
+
+_DERIVED_NAMESPACE = uuid.UUID("5b0a7c1e-3f6d-4a8b-9e2f-1c4d7a9b3e60")
+
+
+def new_id() -> str:
+    """Return a new record ID."""
+    with _lock:
+        if _random is None:
+            return str(uuid.uuid4())
+        return str(uuid.UUID(int=_random.getrandbits(128), version=4))
+
+
+def derived_id(key: str, name: str) -> str:
+    """
+    Return the ID derived from key and name, the same for the same arguments,
+    so a resumed import gives records the IDs it gave them before it stopped.
+    """
+    return str(uuid.uuid5(_DERIVED_NAMESPACE, f"{key}/{name}"))
+
+
+def use_deterministic_ids(seed: Optional[int]) -> None:
+    """Derive further IDs from seed, or go back to random IDs with None."""
+    global _random
+    with _lock:
+        _random = random.Random(seed) if seed is not None else None
+
+
+def uuid_ids(ids: List[str]) -> List[str]:
+    """Return the IDs that are UUIDs; no record has any other ID."""
+    valid = []
+    for id in ids:
+        try:
+            uuid.UUID(id)
+        except (TypeError, ValueError, AttributeError):
+            continue
+        valid.append(id)
+    return valid
@@ -0,0 +1,245 @@
+"""
+Email inbox repository implementation.
+"""
+
+import json
+import uuid
+from datetime import datetime
+from typing import List, Optional, Tuple
+
+import asyncpg
+
+from app.db.database import Database
+from app.repository.models import EmailInbox, EmailAttachment, ListOptions, ListResult
+from app.repository.errors import NotFoundError
+
+
+_INBOX_COLUMNS = (
+    "id, token, node_type_id, name, field_mapping::text, status, created_at, updated_at, signing_secret"
+)
+
+_ATTACHMENT_COLUMNS = "id, node_id, filename, content_type, size_bytes, created_at"
+
+
+class EmailInboxRepository:
+    """PostgreSQL email inbox, inbound message and attachment repository."""
+
+    def __init__(self, db: Database):
+        self.db = db
+
+    async def create(self, inbox: EmailInbox) -> EmailInbox:
+        """Create a new email inbox."""
+        inbox.id = str(uuid.uuid4())
+        inbox.created_at = datetime.now()
+        inbox.updated_at = datetime.now()
+        if not inbox.status:
+            inbox.status = "active"
+
+        query = f"""
+            INSERT INTO email_inboxes (
+                id, token, node_type_id, name, field_mapping, status, created_at, updated_at, signing_secret
+            )
+            VALUES ($1, $2, $3, $4, $5::jsonb, $6, $7, $8, $9)
+            RETURNING {_INBOX_COLUMNS}
+        """
+
+        async with self.db.pool.acquire() as conn:
+            row = await conn.fetchrow(
+                query,
+                inbox.id, inbox.token, inbox.node_type_id, inbox.name,
+                json.dumps(inbox.field_mapping), inbox.status,
+                inbox.created_at, inbox.updated_at, inbox.signing_secret
+            )
+
+        return self._row_to_inbox(row)
+
+    async def get_by_id(self, id: str) -> EmailInbox:
+        """Retrieve an email inbox by ID."""
+        query = f"SELECT {_INBOX_COLUMNS} FROM email_inboxes WHERE id = $1"
+
+        async with self.db.pool.acquire() as conn:
+            row = await conn.fetchrow(query, id)
+
+        if not row:
+            raise NotFoundError(f"email_inbox not found: {id}")
+
+        return self._row_to_inbox(row)
+
+    async def get_by_token(self, token: str) -> EmailInbox:
+        """Retrieve an email inbox by its webhook token."""
+        query = f"SELECT {_INBOX_COLUMNS} FROM email_inboxes WHERE token = $1"
+
+        async with self.db.pool.acquire() as conn:
+            row = await conn.fetchrow(query, token)
+
+        if not row:
+            raise NotFoundError("email_inbox not found")
+
+        return self._row_to_inbox(row)
+
+    async def update(self, inbox: EmailInbox) -> EmailInbox:
+        """Update an existing email inbox."""
+        inbox.updated_at = datetime.now()
+
+        query = f"""
+            UPDATE email_inboxes
+            SET token = $2, name = $3, field_mapping = $4::jsonb, status = $5, updated_at = $6,
+                signing_secret = $7
+            WHERE id = $1
+            RETURNING {_INBOX_COLUMNS}
+        """
+
+        async with self.db.pool.acquire() as conn:
+            row = await conn.fetchrow(
+                query,
+                inbox.id, inbox.token, inbox.name, json.dumps(inbox.field_mapping),
+                inbox.status, inbox.updated_at, inbox.signing_secret
+            )
+
+        if not row:
+            raise NotFoundError(f"email_inbox not found: {inbox.id}")
+
+        return self._row_to_inbox(row)
+
+    async def delete(self, id: str) -> None:
+        """Delete an email inbox by ID."""
+        query = "DELETE FROM email_inboxes WHERE id = $1"
+
+        async with self.db.pool.acquire() as conn:
+            result = await conn.execute(query, id)
+
+        if result == "DELETE 0":
+            raise NotFoundError(f"email_inbox not found: {id}")
+
+    async def list(self, opts: ListOptions) -> Tuple[List[EmailInbox], ListResult]:
+        """Retrieve email inboxes with pagination."""
+        page_size = max(1, min(opts.page_size or 10, 100))
+        offset = 0
+        if opts.page_token:
+            try:
+                offset = int(opts.page_token)
+            except ValueError:
+                offset = 0
+
+        async with self.db.pool.acquire() as conn:
+            total_count = await conn.fetchval("SELECT COUNT(*) FROM email_inboxes")
+
+            query = f"""
+                SELECT {_INBOX_COLUMNS}
+                FROM email_inboxes
+                ORDER BY created_at DESC
+                LIMIT $1 OFFSET $2
+            """
+            rows = await conn.fetch(query, page_size, offset)
+
+        inboxes = [self._row_to_inbox(row) for row in rows]
+
+        result = ListResult(total_count=total_count)
+        next_offset = offset + len(inboxes)
+        if next_offset < total_count:
+            result.next_page_token = str(next_offset)
+
+        return inboxes, result
+
+    async def find_message(self, inbox_id: str, message_id: str) -> Optional[str]:
+        """Return the node ID a message was already ingested into, if any."""
+        query = "SELECT node_id FROM inbound_emails WHERE inbox_id = $1 AND message_id = $2"
+
+        async with self.db.pool.acquire() as conn:
+            node_id = await conn.fetchval(query, inbox_id, message_id)
+
+        return str(node_id) if node_id else None
+
+    async def record_message(self, inbox_id: str, message_id: str, node_id: str) -> str:
+        """
+        Record that a message was ingested into node_id.
+
+        If the message was concurrently recorded with another node, that
+        node's ID is returned instead.
+        """
+        query = """
+            INSERT INTO inbound_emails (id, inbox_id, message_id, node_id, received_at)
+            VALUES ($1, $2, $3, $4, NOW())
+            ON CONFLICT (inbox_id, message_id) DO NOTHING
+        """
+
+        async with self.db.pool.acquire() as conn:
+            result = await conn.execute(query, str(uuid.uuid4()), inbox_id, message_id, node_id)
+            if result == "INSERT 0 0":
+                existing = await conn.fetchval(
+                    "SELECT node_id FROM inbound_emails WHERE inbox_id = $1 AND message_id = $2",
+                    inbox_id, message_id
+                )
+                return str(existing)
+
+        return node_id
+
+    async def add_attachments(self, attachments: List[EmailAttachment]) -> None:
+        """Store email attachments."""
+        if not attachments:
+            return
+
+        query = """
+            INSERT INTO email_attachments (id, node_id, filename, content_type, size_bytes, content, created_at)
+            VALUES ($1, $2, $3, $4, $5, $6, $7)
+        """
+
+        now = datetime.now()
+        async with self.db.pool.acquire() as conn:
+            await conn.executemany(query, [
+                (a.id or str(uuid.uuid4()), a.node_id, a.filename, a.content_type, len(a.content), a.content, now)
+                for a in attachments
+            ])
+
+    async def list_attachments(self, node_id: str) -> List[EmailAttachment]:
+        """Retrieve attachment metadata for a node, without content."""
+        query = f"""
+            SELECT {_ATTACHMENT_COLUMNS}
+            FROM email_attachments
+            WHERE node_id = $1
+            ORDER BY created_at, filename
+        """
+
+        async with self.db.pool.acquire() as conn:
+            rows = await conn.fetch(query, node_id)
+
+        return [self._row_to_attachment(row) for row in rows]
+
+    async def get_attachment(self, id: str) -> EmailAttachment:
+        """Retrieve an attachment including its content."""
+        query = f"SELECT {_ATTACHMENT_COLUMNS}, content FROM email_attachments WHERE id = $1"
+
+        async with self.db.pool.acquire() as conn:
+            row = await conn.fetchrow(query, id)
+
+        if not row:
+            raise NotFoundError(f"email_attachment not found: {id}")
+
+        attachment = self._row_to_attachment(row)
+        attachment.content = bytes(row[6])
+        return attachment
+
+    def _row_to_inbox(self, row: asyncpg.Record) -> EmailInbox:
+        """Convert a database row to an EmailInbox object."""
+        return EmailInbox(
+            id=str(row[0]),
+            token=row[1],
+            node_type_id=str(row[2]),
+            name=row[3],
+            field_mapping=json.loads(row[4] or "{}"),
+            status=row[5],
+            created_at=row[6],
+            updated_at=row[7],
+            signing_secret=row[8],
+        )
+
+    def _row_to_attachment(self, row: asyncpg.Record) -> EmailAttachment:
+        """Convert a database row to an EmailAttachment object (without content)."""
+        return EmailAttachment(
+            id=str(row[0]),
+            node_id=str(row[1]),
+            filename=row[2],
+            content_type=row[3],
+            size_bytes=row[4],
+            created_at=row[5],
+        )
@@ -0,0 +1,123 @@
+"""
+Server instance repository implementation.
+"""
+
+import json
+from typing import List
+
+import asyncpg
+
+from app.db.database import Database
+from app.repository.models import ClusterLease, ServerInstance
+
+_SERVER_INSTANCE_COLUMNS = "instance_id, release, features::text, started_at, heartbeat_at"
+_CLUSTER_LEASE_COLUMNS = "role, instance_id, acquired_at, expires_at"
+
+
+class ServerInstanceRepository:
+    """PostgreSQL repository of running server instances and their leader roles (control database)."""
+
+    def __init__(self, db: Database):
+        self.db = db
+
+    async def heartbeat(self, instance: ServerInstance) -> ServerInstance:
+        """Register an instance, or refresh its heartbeat and features."""
+        query = f"""
+            INSERT INTO server_instances (instance_id, release, features, started_at, heartbeat_at)
+            VALUES ($1, $2, $3::jsonb, $4, NOW())
+            ON CONFLICT (instance_id) DO UPDATE
+            SET release = EXCLUDED.release, features = EXCLUDED.features, heartbeat_at = NOW()
+            RETURNING {_SERVER_INSTANCE_COLUMNS}
+        """
+
+        async with self.db.pool.acquire() as conn:
+            row = await conn.fetchrow(
+                query, instance.instance_id, instance.release, json.dumps(instance.features), instance.started_at
+            )
+
+        return self._row_to_server_instance(row)
+
+    async def list_live(self, max_age: float) -> List[ServerInstance]:
+        """Retrieve the instances with a heartbeat in the last max_age seconds, oldest first."""
+        query = f"""
+            SELECT {_SERVER_INSTANCE_COLUMNS}
+            FROM server_instances
+            WHERE heartbeat_at > NOW() - make_interval(secs => $1)
+            ORDER BY started_at, instance_id
+        """
+
+        async with self.db.pool.acquire() as conn:
+            rows = await conn.fetch(query, max_age)
+
+        return [self._row_to_server_instance(row) for row in rows]
+
+    async def list_all(self) -> List[ServerInstance]:
+        """Retrieve every registered instance, including those whose heartbeat expired, oldest first."""
+        async with self.db.pool.acquire() as conn:
+            rows = await conn.fetch(
+                f"SELECT {_SERVER_INSTANCE_COLUMNS} FROM server_instances ORDER BY started_at, instance_id"
+            )
+
+        return [self._row_to_server_instance(row) for row in rows]
+
+    async def remove(self, instance_id: str) -> None:
+        """Unregister an instance and release its leader roles."""
+        async with self.db.pool.acquire() as conn:
+            async with conn.transaction():
+                await conn.execute("DELETE FROM cluster_leases WHERE instance_id = $1", instance_id)
+                await conn.execute("DELETE FROM server_instances WHERE instance_id = $1", instance_id)
+
+    async def remove_stale(self, max_age: float) -> int:
+        """Unregister instances without a heartbeat in the last max_age seconds; returns how many."""
+        async with self.db.pool.acquire() as conn:
+            result = await conn.execute(
+                "DELETE FROM server_instances WHERE heartbeat_at <= NOW() - make_interval(secs => $1)", max_age
+            )
+        return int(result.split()[-1])
+
+    async def acquire_lease(self, role: str, instance_id: str, ttl: float) -> bool:
+        """
+        Take or renew the lease of a leader role for ttl seconds; returns False
+        if another instance holds an unexpired lease.
+        """
+        query = """
+            INSERT INTO cluster_leases (role, instance_id, acquired_at, expires_at)
+            VALUES ($1, $2, NOW(), NOW() + make_interval(secs => $3))
+            ON CONFLICT (role) DO UPDATE
+            SET instance_id = EXCLUDED.instance_id,
+                acquired_at = CASE
+                    WHEN cluster_leases.instance_id = EXCLUDED.instance_id THEN cluster_leases.acquired_at
+                    ELSE NOW()
+                END,
+                expires_at = EXCLUDED.expires_at
+            WHERE cluster_leases.instance_id = EXCLUDED.instance_id OR cluster_leases.expires_at <= NOW()
+            RETURNING role
+        """
+
+        async with self.db.pool.acquire() as conn:
+            return await conn.fetchval(query, role, instance_id, ttl) is not None
+
+    async def list_leases(self) -> List[ClusterLease]:
+        """Retrieve the leases of all leader roles, including expired ones, by role."""
+        async with self.db.pool.acquire() as conn:
+            rows = await conn.fetch(f"SELECT {_CLUSTER_LEASE_COLUMNS} FROM cluster_leases ORDER BY role")
+
+        return [
+            ClusterLease(
+                role=row["role"],
+                instance_id=row["instance_id"],
+                acquired_at=row["acquired_at"],
+                expires_at=row["expires_at"],
+            )
+            for row in rows
+        ]
+
+    def _row_to_server_instance(self, row: asyncpg.Record) -> ServerInstance:
+        """Convert a database row to a ServerInstance object."""
+        return ServerInstance(
+            instance_id=row["instance_id"],
+            release=row["release"],
+            features=json.loads(row["features"]),
+            started_at=row["started_at"],
+            heartbeat_at=row["heartbeat_at"],
+        )
@@ -0,0 +1,157 @@
+"""
+Intake form repository implementation.
+"""
+
+import uuid
+from datetime import datetime
+from typing import List, Tuple
+
+import asyncpg
+
+from app.db.database import Database
+from app.repository.models import IntakeForm, ListOptions, ListResult
+from app.repository.errors import NotFoundError
+
+
+_FORM_COLUMNS = """
+    id, token, node_type_id, name, fields, require_captcha, rate_limit_per_minute,
+    status, created_at, updated_at, signing_secret
+"""
+
+
+class IntakeFormRepository:
+    """PostgreSQL intake form repository."""
+
+    def __init__(self, db: Database):
+        self.db = db
+
+    async def create(self, form: IntakeForm) -> IntakeForm:
+        """Create a new intake form."""
+        form.id = str(uuid.uuid4())
+        form.created_at = datetime.now()
+        form.updated_at = datetime.now()
+        if not form.status:
+            form.status = "active"
+
+        query = f"""
+            INSERT INTO intake_forms (
+                id, token, node_type_id, name, fields, require_captcha, rate_limit_per_minute,
+                status, created_at, updated_at, signing_secret
+            )
+            VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+            RETURNING {_FORM_COLUMNS}
+        """
+
+        async with self.db.pool.acquire() as conn:
+            row = await conn.fetchrow(
+                query,
+                form.id, form.token, form.node_type_id, form.name, form.fields,
+                form.require_captcha, form.rate_limit_per_minute, form.status,
+                form.created_at, form.updated_at, form.signing_secret
+            )
+
+        return self._row_to_form(row)
+
+    async def get_by_id(self, id: str) -> IntakeForm:
+        """Retrieve an intake form by ID."""
+        query = f"SELECT {_FORM_COLUMNS} FROM intake_forms WHERE id = $1"
+
+        async with self.db.pool.acquire() as conn:
+            row = await conn.fetchrow(query, id)
+
+        if not row:
+            raise NotFoundError(f"intake_form not found: {id}")
+
+        return self._row_to_form(row)
+
+    async def get_by_token(self, token: str) -> IntakeForm:
+        """Retrieve an intake form by its public token."""
+        query = f"SELECT {_FORM_COLUMNS} FROM intake_forms WHERE token = $1"
+
+        async with self.db.pool.acquire() as conn:
+            row = await conn.fetchrow(query, token)
+
+        if not row:
+            raise NotFoundError("intake_form not found")
+
+        return self._row_to_form(row)
+
+    async def update(self, form: IntakeForm) -> IntakeForm:
+        """Update an existing intake form."""
+        form.updated_at = datetime.now()
+
+        query = f"""
+            UPDATE intake_forms
+            SET token = $2, name = $3, fields = $4, require_captcha = $5,
+                rate_limit_per_minute = $6, status = $7, updated_at = $8, signing_secret = $9
+            WHERE id = $1
+            RETURNING {_FORM_COLUMNS}
+        """
+
+        async with self.db.pool.acquire() as conn:
+            row = await conn.fetchrow(
+                query,
+                form.id, form.token, form.name, form.fields, form.require_captcha,
+                form.rate_limit_per_minute, form.status, form.updated_at, form.signing_secret
+            )
+
+        if not row:
+            raise NotFoundError(f"intake_form not found: {form.id}")
+
+        return self._row_to_form(row)
+
+    async def delete(self, id: str) -> None:
+        """Delete an intake form by ID."""
+        query = "DELETE FROM intake_forms WHERE id = $1"
+
+        async with self.db.pool.acquire() as conn:
+            result = await conn.execute(query, id)
+
+        if result == "DELETE 0":
+            raise NotFoundError(f"intake_form not found: {id}")
+
+    async def list(self, opts: ListOptions) -> Tuple[List[IntakeForm], ListResult]:
+        """Retrieve intake forms with pagination."""
+        page_size = max(1, min(opts.page_size or 10, 100))
+        offset = 0
+        if opts.page_token:
+            try:
+                offset = int(opts.page_token)
+            except ValueError:
+                offset = 0
+
+        async with self.db.pool.acquire() as conn:
+            total_count = await conn.fetchval("SELECT COUNT(*) FROM intake_forms")
+
+            query = f"""
+                SELECT {_FORM_COLUMNS}
+                FROM intake_forms
+                ORDER BY created_at DESC
+                LIMIT $1 OFFSET $2
+            """
+            rows = await conn.fetch(query, page_size, offset)
+
+        forms = [self._row_to_form(row) for row in rows]
+
+        result = ListResult(total_count=total_count)
+        next_offset = offset + len(forms)
+        if next_offset < total_count:
+            result.next_page_token = str(next_offset)
+
+        return forms, result
+
+    def _row_to_form(self, row: asyncpg.Record) -> IntakeForm:
+        """Convert a database row to an IntakeForm object."""
+        return IntakeForm(
+            id=str(row[0]),
+            token=row[1],
+            node_type_id=str(row[2]),
+            name=row[3],
+            fields=list(row[4] or []),
+            require_captcha=row[5],
+            rate_limit_per_minute=row[6],
+            status=row[7],
+            created_at=row[8],
+            updated_at=row[9],
+            signing_secret=row[10],
+        )
@@ -0,0 +1,114 @@
+"""
+Lake export run repository implementation.
+"""
+
+import uuid
+from typing import List, Optional
+
+import asyncpg
+
+from app.db.database import Database
+from app.repository.models import LakeExport
+
+_EXPORT_COLUMNS = "id, status, started_at, finished_at, manifest_key, file_count, node_count, error"
+
+
+class LakeExportRepository:
+    """PostgreSQL repository of Parquet export runs."""
+
+    def __init__(self, db: Database):
+        self.db = db
+
+    async def claim_run(self, interval_seconds: float, lease_seconds: float) -> Optional[LakeExport]:
+        """
+        Start an export run if one is due.
+
+        A run is due when no export succeeded within the last interval_seconds
+        and no other run holds an unexpired lease. The check and insert happen
+        under an advisory lock, so only one server instance exports a tenant
+        at a time. Returns None when no run is due.
+        """
+        async with self.db.pool.acquire() as conn:
+            async with conn.transaction():
+                await conn.execute("SELECT pg_advisory_xact_lock(hashtext('flexdb.lake_exports'))")
+                busy = await conn.fetchval(
+                    """
+                    SELECT EXISTS (
+                        SELECT 1 FROM lake_exports
+                        WHERE (status = 'succeeded' AND started_at > NOW() - make_interval(secs => $1))
+                           OR (status = 'running' AND lease_until > NOW())
+                    )
+                    """,
+                    interval_seconds
+                )
+                if busy:
+                    return None
+
+                # Runs whose lease expired were abandoned by a stopped instance
+                await conn.execute(
+                    """
+                    UPDATE lake_exports
+                    SET status = 'failed', finished_at = NOW(), error = 'lease expired'
+                    WHERE status = 'running'
+                    """
+                )
+                row = await conn.fetchrow(
+                    f"""
+                    INSERT INTO lake_exports (id, lease_until)
+                    VALUES ($1, NOW() + make_interval(secs => $2))
+                    RETURNING {_EXPORT_COLUMNS}
+                    """,
+                    str(uuid.uuid4()), lease_seconds
+                )
+
+        return self._row_to_export(row)
+
+    async def extend_lease(self, id: str, lease_seconds: float) -> None:
+        """Push a running export's lease lease_seconds into the future."""
+        async with self.db.pool.acquire() as conn:
+            await conn.execute(
+                "UPDATE lake_exports SET lease_until = NOW() + make_interval(secs => $2) WHERE id = $1",
+                id, lease_seconds
+            )
+
+    async def finish_run(self, export: LakeExport) -> None:
+        """Record the outcome of an export run."""
+        query = """
+            UPDATE lake_exports
+            SET status = $2, finished_at = NOW(), manifest_key = $3, file_count = $4, node_count = $5, error = $6
+            WHERE id = $1
+        """
+
+        async with self.db.pool.acquire() as conn:
+            await conn.execute(
+                query,
+                export.id, export.status, export.manifest_key,
+                export.file_count, export.node_count, export.error or None
+            )
+
+    async def list_recent(self, limit: int) -> List[LakeExport]:
+        """Retrieve the most recent export runs, newest first."""
+        query = f"""
+            SELECT {_EXPORT_COLUMNS}
+            FROM lake_exports
+            ORDER BY started_at DESC
+            LIMIT $1
+        """
+
+        async with self.db.pool.acquire() as conn:
+            rows = await conn.fetch(query, limit)
+
+        return [self._row_to_export(row) for row in rows]
+
+    def _row_to_export(self, row: asyncpg.Record) -> LakeExport:
+        """Convert a database row to a LakeExport object."""
+        return LakeExport(
+            id=str(row["id"]),
+            status=row["status"],
+            started_at=row["started_at"],
+            finished_at=row["finished_at"],
+            manifest_key=row["manifest_key"],
+            file_count=row["file_count"],
+            node_count=row["node_count"],
+            error=row["error"] or "",
+        )
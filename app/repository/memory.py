@@ -0,0 +1,1538 @@
+"""
+In-memory repository implementations.
+
+Drop-in replacements for the PostgreSQL repositories, for unit testing the
+services (or code built on them) without a database:
+
+    store = InMemoryStore()
+    node_types = InMemoryNodeTypeRepository(store)
+    nodes = InMemoryNodeRepository(store)
+    service = NodeService(nodes, node_types)
+
+Repositories sharing a store see each other's data, like repositories on the
+same database: deleting a node type deletes its nodes, deleting a node deletes
+its relationships, every mutation records an outbox event readable through
+InMemoryOutboxRepository, and every node change records a node revision. The control plane repositories (tenants, users)
+share an InMemoryControlStore, as do tenant quotas. Node types' unique keys are enforced like the
+unique indexes; their data path indexes are only recorded, as there is
+nothing to speed up.
+
+Ordering, pagination, versioning, geo_point filters and aggregations follow
+the PostgreSQL implementations. geo_shape queries require PostGIS and are not
+supported. Stored records are copied on the way in and out, so callers cannot
+change them behind the repository's back.
+"""
+
+import json
+import math
+from dataclasses import replace
+from datetime import datetime, timedelta, timezone
+from decimal import Decimal, InvalidOperation
+from typing import Any, AsyncIterator, Awaitable, Callable, Dict, Iterable, List, Optional, Sequence, Tuple, TypeVar, Union
+from zoneinfo import ZoneInfo
+
+from app.repository.actor import current_actor
+from app.repository.errors import AlreadyExistsError, ConflictError, FailedPreconditionError, NotFoundError
+from app.repository.ids import new_id
+from app.repository.models import (
+    Tenant,
+    TenantQuota,
+    TenantSlugChange,
+    User,
+    TenantUser,
+    NodeType,
+    NodeTypeIndex,
+    Node,
+    NodeRevision,
+    Relationship,
+    OutboxEvent,
+    ChangeFeedPosition,
+    ChangePage,
+    DataKey,
+    BulkJob,
+    GeoFilter,
+    DataFilter,
+    SortOrder,
+    Aggregation,
+    AggregationBucket,
+    BatchHook,
+    FilterValues,
+    ListOptions,
+    ListResult,
+    MAX_PAGE_SIZE,
+    filter_values,
+)
+from app.repository.node_repo import NODE_SORT_COLUMNS
+from app.repository.nodetype_repo import NODE_TYPE_SORT_COLUMNS
+from app.repository.relationship_repo import RELATIONSHIP_SORT_COLUMNS
+from app.repository.transfer_repo import EXPORT_RECORD_TYPES, ExportPosition, ExportRecord
+from app.repository.unique_keys import unique_key_values
+
+T = TypeVar("T")
+
+# Mean Earth diameter in meters, as used by the SQL haversine distance
+_EARTH_DIAMETER_M = 12742017.6
+
+
+class InMemoryControlStore:
+    """
+    Control database contents: tenants, their slug changes, tenant quotas,
+    users, their password hashes and tenant memberships.
+    """
+
+    def __init__(self):
+        self.tenants: Dict[str, Tenant] = {}
+        self.tenant_slug_changes: List[TenantSlugChange] = []
+        self.tenant_quotas: Dict[str, TenantQuota] = {}
+        self.users: Dict[str, User] = {}
+        self.password_hashes: Dict[str, str] = {}
+        self.tenant_users: Dict[Tuple[str, str], TenantUser] = {}
+
+
+class InMemoryStore:
+    """Tenant database contents: node types, nodes, node revisions, relationships and outbox events."""
+
+    def __init__(self):
+        self.node_types: Dict[str, NodeType] = {}
+        self.node_type_indexes: Dict[str, NodeTypeIndex] = {}
+        self.nodes: Dict[str, Node] = {}
+        self.revisions: List[NodeRevision] = []
+        self.relationships: Dict[str, Relationship] = {}
+        self.events: List[OutboxEvent] = []
+        self.dispatched: set = set()
+        self.data_keys: Dict[int, DataKey] = {}
+        self.bulk_jobs: Dict[str, BulkJob] = {}
+
+    def record_revision(self, op: str, node: Node, revised_at: Optional[datetime] = None) -> None:
+        """Append a revision of a node, as of revised_at or else its updated_at."""
+        self.revisions.append(NodeRevision(
+            id=str(len(self.revisions) + 1),
+            node_id=node.id,
+            node_type_id=node.node_type_id,
+            version=node.version,
+            op=op,
+            data=node.data,
+            schema_version=node.schema_version,
+            node_created_at=node.created_at,
+            revised_at=revised_at or node.updated_at,
+            actor=current_actor(),
+        ))
+
+    def record_event(self, event_type: str, entity_type: str, entity_id: str, payload: Dict[str, Any]) -> None:
+        """Append a change event to the outbox."""
+        self.events.append(OutboxEvent(
+            id=len(self.events) + 1,
+            event_id=new_id(),
+            event_type=event_type,
+            entity_type=entity_type,
+            entity_id=entity_id,
+            payload=json.dumps(payload),
+            created_at=datetime.now(),
+        ))
+
+    def delete_node(self, id: str) -> None:
+        """Delete a node, recording its deleted revision, and, like ON DELETE CASCADE, its relationships."""
+        self.record_revision("deleted", self.nodes.pop(id), datetime.now())
+        for rel in list(self.relationships.values()):
+            if id in (rel.source_node_id, rel.target_node_id):
+                del self.relationships[rel.id]
+
+    def delete_node_type(self, id: str) -> None:
+        """Delete a node type and, like ON DELETE CASCADE, its nodes and indexes."""
+        del self.node_types[id]
+        for index in list(self.node_type_indexes.values()):
+            if index.node_type_id == id:
+                del self.node_type_indexes[index.id]
+        for node in list(self.nodes.values()):
+            if node.node_type_id == id:
+                self.delete_node(node.id)
+
+
+def _page(items: List[T], opts: ListOptions, max_page_size: int) -> Tuple[List[T], ListResult]:
+    """Apply offset pagination to already filtered and ordered items."""
+    page_size = max(1, min(opts.page_size or 10, max_page_size))
+    offset = 0
+    if opts.page_token:
+        try:
+            offset = int(opts.page_token)
+        except ValueError:
+            offset = 0
+
+    page = items[offset:offset + page_size] if offset >= 0 else []
+    result = ListResult(total_count=len(items))
+    next_offset = offset + len(page)
+    if next_offset < len(items):
+        result.next_page_token = str(next_offset)
+    return page, result
+
+
+def _sequence_token(token: str) -> int:
+    """Return the outbox sequence a change token of a backend that commits one change at a time holds."""
+    try:
+        last = int(token or 0)
+    except ValueError:
+        last = -1
+    if last < 0:
+        raise ValueError(f"invalid change token: {token}")
+    return last
+
+
+def _newest_first(items: List[T]) -> List[T]:
+    return sorted(items, key=lambda item: item.created_at, reverse=True)
+
+
+def _sorted_by(items: List[T], sort: Optional[SortOrder], columns: Sequence[str]) -> List[T]:
+    """Order items like order_by_clause: by a sortable column, ties by ID, or newest first."""
+    if not sort:
+        return _newest_first(items)
+    if sort.field not in columns:
+        raise ValueError(f"cannot sort by {sort.field}; expected one of: {', '.join(columns)}")
+    items = sorted(items, key=lambda item: item.id)
+    return sorted(items, key=lambda item: getattr(item, sort.field), reverse=sort.descending)
+
+
+async def _delete_batches(
+    matches: List[T], batch_size: int, delete: Callable[[List[T]], Awaitable[None]], on_batch: Optional[BatchHook]
+) -> int:
+    """Delete matches batch_size at a time, reporting to on_batch, which may stop between batches."""
+    if on_batch and not await on_batch(0, len(matches)):
+        return 0
+    count = 0
+    for start in range(0, len(matches), max(1, batch_size)):
+        batch = matches[start:start + batch_size]
+        await delete(batch)
+        count += len(batch)
+        if on_batch and not await on_batch(count, len(matches)):
+            break
+    return count
+
+
+def _check_version(entity: str, id: str, current: int, expected_version: Optional[int]) -> None:
+    if expected_version is not None and current != expected_version:
+        raise ConflictError(f"{entity} {id} has version {current}, expected {expected_version}")
+
+
+def _select_data_fields(node: Node, data_fields: Optional[List[str]]) -> Node:
+    """Copy a node, with only the given top-level data fields if data_fields isn't None."""
+    if data_fields is None:
+        return replace(node)
+    data = json.loads(node.data)
+    return replace(node, data=json.dumps({key: data[key] for key in data_fields if key in data}))
+
+
+def _check_json(value: str) -> None:
+    # PostgreSQL rejects invalid JSON for jsonb columns
+    try:
+        json.loads(value)
+    except ValueError as e:
+        raise ValueError(f"invalid JSON: {e}") from e
+
+
+def _json_value(value: str) -> Any:
+    # jsonb compares parsed values, not text
+    return json.loads(value) if value else None
+
+
+class InMemoryTenantRepository:
+    """In-memory tenant repository."""
+
+    def __init__(self, store: Optional[InMemoryControlStore] = None):
+        self.store = store or InMemoryControlStore()
+
+    async def create(self, tenant: Tenant) -> Tenant:
+        """Create a new tenant."""
+        if any(t.slug == tenant.slug for t in self.store.tenants.values()):
+            raise ConflictError(f"tenant slug already exists: {tenant.slug}")
+        tenant.id = new_id()
+        tenant.created_at = datetime.now()
+        tenant.updated_at = datetime.now()
+        if not tenant.status:
+            tenant.status = "active"
+
+        self.store.tenants[tenant.id] = replace(tenant)
+        return replace(tenant)
+
+    async def get_by_id(self, id: str) -> Tenant:
+        """Retrieve a tenant by ID."""
+        tenant = self.store.tenants.get(id)
+        if not tenant:
+            raise NotFoundError(f"tenant not found: {id}")
+        return replace(tenant)
+
+    async def get_by_slug(self, slug: str) -> Tenant:
+        """Retrieve a tenant by its slug."""
+        for tenant in self.store.tenants.values():
+            if tenant.slug == slug:
+                return replace(tenant)
+        raise NotFoundError(f"tenant not found: {slug}")
+
+    async def get_by_former_slug(self, slug: str) -> Optional[Tenant]:
+        """Retrieve the tenant most recently renamed from slug, or None if none was."""
+        for change in reversed(self.store.tenant_slug_changes):
+            if change.old_slug == slug and change.tenant_id in self.store.tenants:
+                return replace(self.store.tenants[change.tenant_id])
+        return None
+
+    async def rename_slug(self, id: str, slug: str, actor: str) -> Tenant:
+        """Change a tenant's slug and record the change; ConflictError if another tenant has the slug."""
+        stored = self.store.tenants.get(id)
+        if not stored:
+            raise NotFoundError(f"tenant not found: {id}")
+        if stored.slug == slug:
+            return replace(stored)
+        if any(t.slug == slug for t in self.store.tenants.values()):
+            raise ConflictError(f"tenant slug already exists: {slug}")
+
+        now = datetime.now()
+        self.store.tenant_slug_changes.append(TenantSlugChange(id, stored.slug, slug, actor, now))
+        updated = replace(stored, slug=slug, updated_at=now)
+        self.store.tenants[id] = updated
+        return replace(updated)
+
+    async def list_slug_changes(self, id: str) -> List[TenantSlugChange]:
+        """Retrieve the slug changes of a tenant, oldest first."""
+        return [replace(c) for c in self.store.tenant_slug_changes if c.tenant_id == id]
+
+    async def update(self, tenant: Tenant) -> Tenant:
+        """Update an existing tenant."""
+        stored = self.store.tenants.get(tenant.id)
+        if not stored:
+            raise NotFoundError(f"tenant not found: {tenant.id}")
+        if any(t.slug == tenant.slug and t.id != tenant.id for t in self.store.tenants.values()):
+            raise ConflictError(f"tenant slug already exists: {tenant.slug}")
+        tenant.updated_at = datetime.now()
+
+        updated = replace(tenant, created_at=stored.created_at)
+        self.store.tenants[tenant.id] = updated
+        return replace(updated)
+
+    async def set_status(
+        self,
+        id: str,
+        status: str,
+        from_statuses: Iterable[str],
+        reason: str,
+        archive_database: Optional[str] = None
+    ) -> Tenant:
+        """Change a tenant's status if it currently is one of from_statuses."""
+        stored = self.store.tenants.get(id)
+        if not stored:
+            raise NotFoundError(f"tenant not found: {id}")
+        from_statuses = list(from_statuses)
+        if stored.status not in from_statuses:
+            raise FailedPreconditionError(f"tenant {id} is {stored.status}, not {' or '.join(from_statuses)}")
+
+        now = datetime.now()
+        updated = replace(
+            stored, status=status, status_reason=reason, status_changed_at=now, updated_at=now,
+            archive_database=stored.archive_database if archive_database is None else archive_database,
+        )
+        self.store.tenants[id] = updated
+        return replace(updated)
+
+    async def delete(self, id: str) -> None:
+        """Delete a tenant by ID."""
+        if self.store.tenants.pop(id, None) is None:
+            raise NotFoundError(f"tenant not found: {id}")
+        self.store.tenant_quotas.pop(id, None)
+        self.store.tenant_slug_changes = [c for c in self.store.tenant_slug_changes if c.tenant_id != id]
+        for key in [k for k in self.store.tenant_users if k[0] == id]:
+            del self.store.tenant_users[key]
+
+    async def list(self, opts: ListOptions) -> Tuple[List[Tenant], ListResult]:
+        """Retrieve tenants with pagination."""
+        tenants, result = _page(_newest_first(list(self.store.tenants.values())), opts, 100)
+        return [replace(t) for t in tenants], result
+
+
+class InMemoryTenantQuotaRepository:
+    """In-memory tenant quota repository."""
+
+    def __init__(self, store: Optional[InMemoryControlStore] = None):
+        self.store = store or InMemoryControlStore()
+
+    async def get(self, tenant_id: str) -> Optional[TenantQuota]:
+        """Retrieve a tenant's quota, or None if it has none."""
+        quota = self.store.tenant_quotas.get(tenant_id)
+        return replace(quota) if quota else None
+
+    async def set(self, quota: TenantQuota) -> TenantQuota:
+        """Create or replace a tenant's quota."""
+        if quota.tenant_id not in self.store.tenants:
+            raise NotFoundError(f"tenant not found: {quota.tenant_id}")
+        stored = replace(quota, updated_at=datetime.now())
+        self.store.tenant_quotas[quota.tenant_id] = stored
+        return replace(stored)
+
+
+class InMemoryUserRepository:
+    """In-memory user repository."""
+
+    def __init__(self, store: Optional[InMemoryControlStore] = None):
+        self.store = store or InMemoryControlStore()
+
+    async def create(self, user: User) -> User:
+        """Create a new user."""
+        if any(u.email == user.email for u in self.store.users.values()):
+            raise ConflictError(f"user email already exists: {user.email}")
+        user.id = new_id()
+        user.created_at = datetime.now()
+        user.updated_at = datetime.now()
+
+        self.store.users[user.id] = replace(user)
+        return replace(user)
+
+    async def get_by_id(self, id: str) -> User:
+        """Retrieve a user by ID."""
+        user = self.store.users.get(id)
+        if not user:
+            raise NotFoundError(f"user not found: {id}")
+        return replace(user)
+
+    async def get_by_email(self, email: str) -> User:
+        """Retrieve a user by email address."""
+        for user in self.store.users.values():
+            if user.email == email:
+                return replace(user)
+        raise NotFoundError(f"user not found: {email}")
+
+    async def update(self, user: User) -> User:
+        """Update an existing user."""
+        stored = self.store.users.get(user.id)
+        if not stored:
+            raise NotFoundError(f"user not found: {user.id}")
+        if any(u.email == user.email and u.id != user.id for u in self.store.users.values()):
+            raise ConflictError(f"user email already exists: {user.email}")
+        user.updated_at = datetime.now()
+
+        updated = replace(user, created_at=stored.created_at)
+        self.store.users[user.id] = updated
+        return replace(updated)
+
+    async def delete(self, id: str) -> None:
+        """Delete a user by ID."""
+        if self.store.users.pop(id, None) is None:
+            raise NotFoundError(f"user not found: {id}")
+        self.store.password_hashes.pop(id, None)
+        for key in [k for k in self.store.tenant_users if k[1] == id]:
+            del self.store.tenant_users[key]
+
+    async def list(self, opts: ListOptions) -> Tuple[List[User], ListResult]:
+        """Retrieve users with pagination."""
+        users, result = _page(_newest_first(list(self.store.users.values())), opts, 100)
+        return [replace(u) for u in users], result
+
+    async def add_to_tenant(self, tenant_user: TenantUser) -> TenantUser:
+        """Add a user to a tenant."""
+        if tenant_user.tenant_id not in self.store.tenants:
+            raise NotFoundError(f"tenant not found: {tenant_user.tenant_id}")
+        if tenant_user.user_id not in self.store.users:
+            raise NotFoundError(f"user not found: {tenant_user.user_id}")
+        if not tenant_user.role:
+            tenant_user.role = "member"
+        if not tenant_user.status:
+            tenant_user.status = "active"
+
+        self.store.tenant_users[(tenant_user.tenant_id, tenant_user.user_id)] = replace(tenant_user)
+        return replace(tenant_user)
+
+    async def remove_from_tenant(self, tenant_id: str, user_id: str) -> None:
+        """Remove a user from a tenant."""
+        if self.store.tenant_users.pop((tenant_id, user_id), None) is None:
+            raise NotFoundError(f"tenant_user not found: tenant_id={tenant_id}, user_id={user_id}")
+
+    async def list_tenant_users(self, tenant_id: str, opts: ListOptions) -> Tuple[List[TenantUser], ListResult]:
+        """List users in a tenant."""
+        members = sorted(
+            (tu for tu in self.store.tenant_users.values() if tu.tenant_id == tenant_id),
+            key=lambda tu: tu.user_id
+        )
+        tenant_users, result = _page(members, opts, 100)
+        return [replace(tu) for tu in tenant_users], result
+
+    async def set_password_hash(self, user_id: str, password_hash: str) -> None:
+        """Store a user's password hash, replacing any previous one."""
+        if user_id not in self.store.users:
+            raise NotFoundError(f"user not found: {user_id}")
+        self.store.password_hashes[user_id] = password_hash
+
+    async def get_password_hash(self, user_id: str) -> str:
+        """Retrieve a user's password hash, or "" if they have no password."""
+        return self.store.password_hashes.get(user_id, "")
+
+    async def list_memberships(self, user_id: str) -> List[TenantUser]:
+        """List a user's memberships in every tenant."""
+        members = (tu for tu in self.store.tenant_users.values() if tu.user_id == user_id)
+        return [replace(tu) for tu in sorted(members, key=lambda tu: tu.tenant_id)]
+
+
+class InMemoryNodeTypeRepository:
+    """In-memory node type repository."""
+
+    def __init__(self, store: Optional[InMemoryStore] = None, max_page_size: int = MAX_PAGE_SIZE):
+        self.store = store or InMemoryStore()
+        self.max_page_size = max_page_size
+
+    async def create(self, node_type: NodeType, dry_run: bool = False) -> NodeType:
+        """Create a new node type; a dry run only checks it."""
+        self._check_name(node_type)
+        node_type.id = new_id()
+        node_type.created_at = datetime.now()
+        node_type.updated_at = datetime.now()
+
+        created = self._stored(node_type, version=1, schema_version=1)
+        if not dry_run:
+            self.store.node_types[created.id] = created
+            self.store.record_event("node_type.created", "node_type", created.id, {"node_type": created.to_dict()})
+        return replace(created)
+
+    async def get_by_id(self, id: str) -> NodeType:
+        """Retrieve a node type by ID."""
+        node_type = self.store.node_types.get(id)
+        if not node_type:
+            raise NotFoundError(f"node_type not found: {id}")
+        return replace(node_type)
+
+    async def get_many(self, ids: List[str]) -> List[NodeType]:
+        """Retrieve the node types with the given IDs that exist, in no particular order."""
+        return [replace(self.store.node_types[id]) for id in set(ids) if id in self.store.node_types]
+
+    async def update(
+        self, node_type: NodeType, expected_version: Optional[int] = None, dry_run: bool = False
+    ) -> NodeType:
+        """
+        Update an existing node type.
+
+        schema_version is incremented when the schema changes. If expected_version
+        is given, the update only applies when it matches the stored version;
+        otherwise ConflictError is raised. A dry run only checks the update.
+        """
+        stored = self.store.node_types.get(node_type.id)
+        if not stored:
+            raise NotFoundError(f"node_type not found: {node_type.id}")
+        _check_version("node_type", node_type.id, stored.version, expected_version)
+        self._check_name(node_type)
+        node_type.updated_at = datetime.now()
+
+        schema_changed = _json_value(node_type.schema) != _json_value(stored.schema)
+        updated = self._stored(
+            node_type, created_at=stored.created_at, version=stored.version + 1,
+            schema_version=stored.schema_version + (1 if schema_changed else 0)
+        )
+        if not dry_run:
+            self.store.node_types[updated.id] = updated
+            self.store.record_event("node_type.updated", "node_type", updated.id, {"node_type": updated.to_dict()})
+        return replace(updated)
+
+    async def delete(self, id: str, expected_version: Optional[int] = None, dry_run: bool = False) -> None:
+        """
+        Delete a node type by ID.
+
+        If expected_version is given, the node type is only deleted while it is
+        at that version; otherwise ConflictError is raised. A dry run only
+        checks the delete.
+        """
+        deleted = self.store.node_types.get(id)
+        if not deleted:
+            raise NotFoundError(f"node_type not found: {id}")
+        _check_version("node_type", id, deleted.version, expected_version)
+        if dry_run:
+            return
+        self.store.delete_node_type(id)
+        self.store.record_event("node_type.deleted", "node_type", deleted.id, {"node_type": deleted.to_dict()})
+
+    async def list(self, opts: ListOptions, sort: Optional[SortOrder] = None) -> Tuple[List[NodeType], ListResult]:
+        """Retrieve node types with pagination, newest first unless sorted otherwise."""
+        node_types, result = _page(
+            _sorted_by(list(self.store.node_types.values()), sort, NODE_TYPE_SORT_COLUMNS), opts, self.max_page_size
+        )
+        return [replace(nt) for nt in node_types], result
+
+    async def list_all(self) -> List[NodeType]:
+        """Retrieve all node types ordered by name."""
+        node_types = sorted(self.store.node_types.values(), key=lambda nt: (nt.name, nt.created_at))
+        return [replace(nt) for nt in node_types]
+
+    async def create_index(self, index: NodeTypeIndex) -> NodeTypeIndex:
+        """Declare an index on data paths of a node type's nodes; it is ready right away."""
+        if index.node_type_id not in self.store.node_types:
+            raise NotFoundError(f"node_type not found: {index.node_type_id}")
+        for other in self.store.node_type_indexes.values():
+            if other.node_type_id == index.node_type_id and other.name == index.name:
+                raise AlreadyExistsError(
+                    f"node_type {index.node_type_id} already has an index named {index.name}"
+                )
+        index.id = new_id()
+        created = replace(index, paths=[list(path) for path in index.paths], status="ready")
+        self.store.node_type_indexes[created.id] = created
+        return replace(created)
+
+    async def list_indexes(self, node_type_id: str) -> List[NodeTypeIndex]:
+        """Retrieve the indexes of a node type ordered by name."""
+        indexes = [i for i in self.store.node_type_indexes.values() if i.node_type_id == node_type_id]
+        return [replace(i) for i in sorted(indexes, key=lambda i: i.name)]
+
+    async def drop_index(self, node_type_id: str, name: str) -> NodeTypeIndex:
+        """Drop a node type's index by name."""
+        for index in self.store.node_type_indexes.values():
+            if index.node_type_id == node_type_id and index.name == name:
+                return self.store.node_type_indexes.pop(index.id)
+        raise NotFoundError(f"node_type_index not found: {name}")
+
+    def _check_name(self, node_type: NodeType) -> None:
+        # Node type names are unique per tenant database
+        for other in self.store.node_types.values():
+            if other.name == node_type.name and other.id != node_type.id:
+                raise ConflictError(f"node_type name already exists: {node_type.name}")
+
+    def _stored(self, node_type: NodeType, **changes: Any) -> NodeType:
+        if node_type.schema:
+            _check_json(node_type.schema)
+        display = node_type.display or "{}"
+        _check_json(display)
+        return replace(
+            node_type, tenant_id="", schema=node_type.schema or "", display=display,
+            unique_keys=[list(key) for key in node_type.unique_keys], **changes
+        )
+
+
+class InMemoryNodeRepository:
+    """In-memory node repository."""
+
+    def __init__(self, store: Optional[InMemoryStore] = None, max_page_size: int = MAX_PAGE_SIZE):
+        self.store = store or InMemoryStore()
+        self.max_page_size = max_page_size
+
+    async def create(self, node: Node, dry_run: bool = False) -> Node:
+        """Create a new node; a dry run only checks it."""
+        if node.node_type_id not in self.store.node_types:
+            raise NotFoundError(f"node_type not found: {node.node_type_id}")
+        node.id = new_id()
+        node.created_at = datetime.now()
+        node.updated_at = datetime.now()
+        if not node.data:
+            node.data = "{}"
+        _check_json(node.data)
+
+        created = replace(node, tenant_id="", version=1)
+        _check_unique_keys(self.store.node_types[created.node_type_id], created, self.store.nodes.values())
+        if not dry_run:
+            self.store.nodes[created.id] = created
+            self.store.record_revision("created", created)
+            self.store.record_event("node.created", "node", created.id, {"node": created.to_dict()})
+        return replace(created)
+
+    async def get_by_id(self, id: str, data_fields: Optional[List[str]] = None) -> Node:
+        """Retrieve a node by ID, with only the given top-level data fields if data_fields isn't None."""
+        node = self.store.nodes.get(id)
+        if not node:
+            raise NotFoundError(f"node not found: {id}")
+        return _select_data_fields(node, data_fields)
+
+    async def get_many(self, ids: List[str], data_fields: Optional[List[str]] = None) -> List[Node]:
+        """
+        Retrieve the nodes with the given IDs that exist, in no particular
+        order, with only the given top-level data fields if data_fields isn't None.
+        """
+        return [_select_data_fields(self.store.nodes[id], data_fields) for id in set(ids) if id in self.store.nodes]
+
+    async def update(
+        self,
+        node: Node,
+        expected_version: Optional[int] = None,
+        dry_run: bool = False,
+        lock_token: str = ""
+    ) -> Node:
+        """
+        Update an existing node.
+
+        If expected_version is given, the update only applies when it matches
+        the stored version; otherwise ConflictError is raised. A dry run only
+        checks the update. Node locks need the PostgreSQL backend, so
+        lock_token is ignored.
+        """
+        stored = self.store.nodes.get(node.id)
+        if not stored:
+            raise NotFoundError(f"node not found: {node.id}")
+        _check_version("node", node.id, stored.version, expected_version)
+        node.updated_at = datetime.now()
+        if not node.data:
+            node.data = "{}"
+        _check_json(node.data)
+
+        updated = replace(
+            stored, data=node.data, updated_at=node.updated_at, version=stored.version + 1,
+            schema_version=node.schema_version
+        )
+        node_type = self.store.node_types.get(updated.node_type_id)
+        if node_type:
+            _check_unique_keys(node_type, updated, self.store.nodes.values())
+        if not dry_run:
+            self.store.nodes[updated.id] = updated
+            self.store.record_revision("updated", updated)
+            self.store.record_event("node.updated", "node", updated.id, {"node": updated.to_dict()})
+        return replace(updated)
+
+    async def delete(
+        self,
+        id: str,
+        expected_version: Optional[int] = None,
+        dry_run: bool = False,
+        lock_token: str = ""
+    ) -> None:
+        """
+        Delete a node by ID.
+        If expected_version is given, the node is only deleted while it is at
+        that version; otherwise ConflictError is raised. A dry run only checks the delete.
+        lock_token is ignored, like by update.
+        """
+        deleted = self.store.nodes.get(id)
+        if not deleted:
+            raise NotFoundError(f"node not found: {id}")
+        _check_version("node", id, deleted.version, expected_version)
+        if dry_run:
+            return
+        self.store.delete_node(id)
+        self.store.record_event("node.deleted", "node", deleted.id, {"node": deleted.to_dict()})
+
+    async def delete_many(
+        self,
+        node_type_id: Optional[str],
+        data_filter: Optional[str],
+        batch_size: int,
+        dry_run: bool = False,
+        on_batch: Optional[BatchHook] = None
+    ) -> int:
+        """Delete the nodes of a node type and/or whose data contains data_filter, batch_size at a time."""
+        contained = _json_value(data_filter) if data_filter else None
+        matches = [
+            n for n in self.store.nodes.values()
+            if (not node_type_id or n.node_type_id == node_type_id)
+            and (contained is None or _json_contains(_json_value(n.data), contained))
+        ]
+        if dry_run:
+            return len(matches)
+
+        async def delete(batch: List[Node]) -> None:
+            for node in batch:
+                if node.id in self.store.nodes:
+                    self.store.delete_node(node.id)
+                    self.store.record_event("node.deleted", "node", node.id, {"node": node.to_dict()})
+        return await _delete_batches(matches, batch_size, delete, on_batch)
+
+    async def list_revisions(self, id: str, opts: ListOptions) -> Tuple[List[NodeRevision], ListResult]:
+        """Retrieve the revisions of a node, including a deleted node, newest first."""
+        revisions = self._revisions(id)
+        if not revisions:
+            raise NotFoundError(f"node not found: {id}")
+        revisions, result = _page(revisions, opts, self.max_page_size)
+        return [replace(r) for r in revisions], result
+
+    async def get_revision(self, id: str, revision_id: int) -> NodeRevision:
+        """Retrieve a revision of a node."""
+        for revision in self._revisions(id):
+            if revision.id == str(revision_id):
+                return replace(revision)
+        raise NotFoundError(f"node revision not found: {revision_id}")
+
+    async def get_at(self, id: str, at: datetime) -> Node:
+        """Retrieve a node as it was at the given time."""
+        revisions = [r for r in self._revisions(id) if _comparable(r.revised_at) <= _comparable(at)]
+        if not revisions or revisions[0].op == "deleted":
+            raise NotFoundError(f"node not found at {at.isoformat()}: {id}")
+        return revisions[0].to_node()
+
+    async def list_at(
+        self,
+        node_type_id: Optional[str],
+        at: datetime,
+        opts: ListOptions,
+        sort: Optional[SortOrder] = None,
+        data_filter: Optional[DataFilter] = None,
+        data_fields: Optional[List[str]] = None
+    ) -> Tuple[List[Node], ListResult]:
+        """Retrieve nodes as they were at the given time, filtered, ordered and paginated like list."""
+        store = InMemoryStore()
+        store.nodes = {node.id: node for node in _nodes_at(self.store.revisions, at)}
+        return await InMemoryNodeRepository(store, self.max_page_size).list(
+            node_type_id, opts, None, sort, data_filter, data_fields
+        )
+
+    def _revisions(self, id: str) -> List[NodeRevision]:
+        revisions = [r for r in self.store.revisions if r.node_id == id]
+        return sorted(revisions, key=lambda r: (_comparable(r.revised_at), int(r.id)), reverse=True)
+
+    async def list(
+        self,
+        node_type_id: Optional[str],
+        opts: ListOptions,
+        geo: Optional[GeoFilter] = None,
+        sort: Optional[SortOrder] = None,
+        data_filter: Optional[DataFilter] = None,
+        data_fields: Optional[List[str]] = None
+    ) -> Tuple[List[Node], ListResult]:
+        """
+        Retrieve nodes with pagination and optional filtering, with only the
+        given top-level data fields if data_fields isn't None.
+
+        Distance ordering from a geo filter takes precedence over sort; the
+        default order is newest first.
+        """
+        nodes = self._select(node_type_id, data_filter)
+
+        distances: Dict[str, float] = {}
+        if geo:
+            nodes = [n for n in nodes if _geo_match(geo, json.loads(n.data), n.id, distances)]
+
+        if geo and geo.order_by_distance and geo.has_radius():
+            nodes = sorted(_newest_first(nodes), key=lambda n: distances[n.id])
+        elif sort:
+            nodes = _sorted(nodes, sort)
+        else:
+            nodes = _newest_first(nodes)
+
+        nodes, result = _page(nodes, opts, self.max_page_size)
+        return [_select_data_fields(n, data_fields) for n in nodes], result
+
+    async def stream(self, node_type_id: Optional[str], batch_size: int) -> AsyncIterator[Node]:
+        """Stream all nodes, newest first, from a snapshot taken when iteration starts."""
+        nodes = sorted(self._select(node_type_id), key=lambda n: n.id)
+        for node in _newest_first(nodes):
+            yield replace(node)
+
+    async def list_outdated(
+        self,
+        node_type_id: str,
+        schema_version: int,
+        after_id: str,
+        limit: int
+    ) -> List[Node]:
+        """Retrieve up to limit nodes of a node type below schema_version, in ID order after after_id."""
+        nodes = sorted(
+            (n for n in self.store.nodes.values()
+             if n.node_type_id == node_type_id and n.schema_version < schema_version and n.id > after_id),
+            key=lambda n: n.id
+        )
+        return [replace(n) for n in nodes[:limit]]
+
+    async def count(self, node_type_id: Optional[str], data_filter: Optional[DataFilter] = None) -> int:
+        """Count the nodes, optionally of a node type and matching a data filter."""
+        return len(self._select(node_type_id, data_filter))
+
+    async def aggregate(
+        self, node_type_id: Optional[str], agg: Aggregation, data_filter: Optional[DataFilter] = None
+    ) -> List[AggregationBucket]:
+        """Compute a bucketed aggregation over node data."""
+        exact = agg.field_type == "decimal"
+
+        def bound(value: Optional[float]):
+            # Decimal bounds compare exactly against numeric values
+            if value is None or not exact:
+                return value
+            return Decimal(str(value))
+
+        if agg.kind == "date_histogram":
+            read_value: Callable[[Any], Any] = _timestamp_value
+        elif agg.kind == "terms":
+            read_value = _scalar_text_value
+        elif exact:
+            read_value = _decimal_value
+        else:
+            read_value = _number_value
+        read_metric = _decimal_value if agg.metric_field_type == "decimal" else _number_value
+
+        rows = []
+        for node in self._select(node_type_id, data_filter):
+            data = json.loads(node.data)
+            if not isinstance(data, dict):
+                data = {}
+            metric = read_metric(data.get(agg.metric_field)) if agg.metric else None
+            rows.append((read_value(data.get(agg.field)) if agg.field else None, metric))
+
+        def metric_value(metrics: List[Any]) -> Optional[Union[float, Decimal]]:
+            return _metric(agg.metric or "max", [m for m in metrics if m is not None])
+
+        buckets = []
+        if agg.kind == "range":
+            for r in agg.ranges:
+                lo, hi = bound(r.from_value), bound(r.to_value)
+                matched = [
+                    m for v, m in rows
+                    if v is not None and (lo is None or v >= lo) and (hi is None or v < hi)
+                ]
+                buckets.append(AggregationBucket(
+                    key=r.key,
+                    from_value=lo,
+                    to_value=hi,
+                    doc_count=len(matched),
+                    value=metric_value(matched),
+                ))
+        elif agg.kind == "histogram":
+            min_value, max_value = bound(agg.min_value), bound(agg.max_value)
+            width = (max_value - min_value) / agg.buckets
+            grouped: Dict[int, List[Any]] = {}
+            for v, m in rows:
+                if v is not None and min_value <= v < max_value:
+                    index = min(int((v - min_value) / (max_value - min_value) * agg.buckets), agg.buckets - 1)
+                    grouped.setdefault(index, []).append(m)
+            for index in sorted(grouped):
+                lower = min_value + index * width
+                buckets.append(AggregationBucket(
+                    key=str(lower),
+                    from_value=lower,
+                    to_value=lower + width,
+                    doc_count=len(grouped[index]),
+                    value=metric_value(grouped[index]),
+                ))
+        elif agg.kind == "date_histogram":
+            zone = ZoneInfo(agg.time_zone)
+            grouped_dates: Dict[datetime, List[Any]] = {}
+            for v, m in rows:
+                if v is not None:
+                    grouped_dates.setdefault(_truncate(v, agg.interval, zone), []).append(m)
+            for start in sorted(grouped_dates):
+                buckets.append(AggregationBucket(
+                    key=start.isoformat(),
+                    doc_count=len(grouped_dates[start]),
+                    value=metric_value(grouped_dates[start]),
+                ))
+        elif agg.kind == "terms":
+            grouped_terms: Dict[str, List[Any]] = {}
+            for v, m in rows:
+                if v is not None:
+                    grouped_terms.setdefault(v, []).append(m)
+            for key in sorted(grouped_terms, key=lambda k: (-len(grouped_terms[k]), k))[:agg.size]:
+                buckets.append(AggregationBucket(
+                    key=key,
+                    doc_count=len(grouped_terms[key]),
+                    value=metric_value(grouped_terms[key]),
+                ))
+        elif agg.kind == "all":
+            buckets.append(AggregationBucket(
+                key="all",
+                doc_count=len(rows),
+                value=metric_value([m for _, m in rows]),
+            ))
+        else:
+            raise ValueError(f"unsupported aggregation kind: {agg.kind}")
+
+        return buckets
+
+    def _select(self, node_type_id: Optional[str], data_filter: Optional[DataFilter] = None) -> List[Node]:
+        nodes = [n for n in self.store.nodes.values() if not node_type_id or n.node_type_id == node_type_id]
+        if data_filter:
+            nodes = [n for n in nodes if _data_match(data_filter, json.loads(n.data))]
+        return nodes
+
+
+class InMemoryRelationshipRepository:
+    """In-memory relationship repository."""
+
+    def __init__(self, store: Optional[InMemoryStore] = None, max_page_size: int = MAX_PAGE_SIZE):
+        self.store = store or InMemoryStore()
+        self.max_page_size = max_page_size
+
+    async def create(self, rel: Relationship, dry_run: bool = False) -> Relationship:
+        """Create a new relationship; a dry run only checks it."""
+        for node_id in (rel.source_node_id, rel.target_node_id):
+            if node_id not in self.store.nodes:
+                raise NotFoundError(f"node not found: {node_id}")
+        rel.id = new_id()
+        rel.created_at = datetime.now()
+        rel.updated_at = datetime.now()
+        if not rel.data:
+            rel.data = "{}"
+        _check_json(rel.data)
+
+        created = replace(rel, tenant_id="", version=1)
+        if not dry_run:
+            self.store.relationships[created.id] = created
+            self.store.record_event(
+                "relationship.created", "relationship", created.id, {"relationship": created.to_dict()}
+            )
+        return replace(created)
+
+    async def get_by_id(self, id: str) -> Relationship:
+        """Retrieve a relationship by ID."""
+        rel = self.store.relationships.get(id)
+        if not rel:
+            raise NotFoundError(f"relationship not found: {id}")
+        return replace(rel)
+
+    async def update(
+        self, rel: Relationship, expected_version: Optional[int] = None, dry_run: bool = False
+    ) -> Relationship:
+        """
+        Update an existing relationship.
+
+        If expected_version is given, the update only applies when it matches
+        the stored version; otherwise ConflictError is raised. A dry run only
+        checks the update.
+        """
+        stored = self.store.relationships.get(rel.id)
+        if not stored:
+            raise NotFoundError(f"relationship not found: {rel.id}")
+        _check_version("relationship", rel.id, stored.version, expected_version)
+        rel.updated_at = datetime.now()
+        if not rel.data:
+            rel.data = "{}"
+        _check_json(rel.data)
+
+        updated = replace(
+            stored,
+            relationship_type=rel.relationship_type,
+            data=rel.data,
+            updated_at=rel.updated_at,
+            version=stored.version + 1,
+        )
+        if not dry_run:
+            self.store.relationships[updated.id] = updated
+            self.store.record_event(
+                "relationship.updated", "relationship", updated.id, {"relationship": updated.to_dict()}
+            )
+        return replace(updated)
+
+    async def delete(self, id: str, expected_version: Optional[int] = None, dry_run: bool = False) -> None:
+        """
+        Delete a relationship by ID.
+        If expected_version is given, the relationship is only deleted while it is at
+        that version; otherwise ConflictError is raised. A dry run only checks the delete.
+        """
+        deleted = self.store.relationships.get(id)
+        if not deleted:
+            raise NotFoundError(f"relationship not found: {id}")
+        _check_version("relationship", id, deleted.version, expected_version)
+        if dry_run:
+            return
+        del self.store.relationships[id]
+        self.store.record_event(
+            "relationship.deleted", "relationship", deleted.id, {"relationship": deleted.to_dict()}
+        )
+
+    async def delete_many(
+        self,
+        source_node_id: Optional[str],
+        target_node_id: Optional[str],
+        rel_type: Optional[str],
+        batch_size: int,
+        dry_run: bool = False,
+        on_batch: Optional[BatchHook] = None
+    ) -> int:
+        """Delete the relationships matching the given filters, batch_size at a time."""
+        matches = [
+            r for r in self.store.relationships.values()
+            if (not source_node_id or r.source_node_id == source_node_id)
+            and (not target_node_id or r.target_node_id == target_node_id)
+            and (not rel_type or r.relationship_type == rel_type)
+        ]
+        if dry_run:
+            return len(matches)
+
+        async def delete(batch: List[Relationship]) -> None:
+            for rel in batch:
+                # Unless deleted meanwhile, e.g. with its node
+                if self.store.relationships.pop(rel.id, None):
+                    self.store.record_event(
+                        "relationship.deleted", "relationship", rel.id, {"relationship": rel.to_dict()}
+                    )
+        return await _delete_batches(matches, batch_size, delete, on_batch)
+
+    async def list(
+        self,
+        source_node_id: FilterValues,
+        target_node_id: FilterValues,
+        rel_type: FilterValues,
+        opts: ListOptions,
+        sort: Optional[SortOrder] = None
+    ) -> Tuple[List[Relationship], ListResult]:
+        """Retrieve relationships with pagination and optional filtering, newest first unless sorted otherwise."""
+        sources, targets, types = filter_values(source_node_id), filter_values(target_node_id), filter_values(rel_type)
+        rels = [
+            r for r in self.store.relationships.values()
+            if (not sources or r.source_node_id in sources)
+            and (not targets or r.target_node_id in targets)
+            and (not types or r.relationship_type in types)
+        ]
+        rels, result = _page(_sorted_by(rels, sort, RELATIONSHIP_SORT_COLUMNS), opts, self.max_page_size)
+        return [replace(r) for r in rels], result
+
+
+class InMemoryOutboxRepository:
+    """In-memory outbox repository, for inspecting the events mutations recorded."""
+
+    def __init__(self, store: Optional[InMemoryStore] = None):
+        self.store = store or InMemoryStore()
+
+    async def list_pending(self, limit: int) -> List[OutboxEvent]:
+        """Retrieve events that have not been dispatched yet, oldest first."""
+        pending = [e for e in self.store.events if e.id not in self.store.dispatched]
+        return [replace(e) for e in pending[:limit]]
+
+    async def latest_sequence(self) -> int:
+        """Return the ID of the newest outbox event, or 0 if there is none."""
+        return self.store.events[-1].id if self.store.events else 0
+
+    async def mark_dispatched(self, ids: List[int]) -> None:
+        """Mark events as dispatched, as fan-out to webhooks would."""
+        self.store.dispatched.update(ids)
+
+    async def current_change_token(self) -> str:
+        """Return the change token of now, the sequence of the newest event."""
+        return str(await self.latest_sequence())
+
+    async def list_changes(self, after: str, limit: int) -> ChangePage:
+        """Retrieve up to limit events after the change token, the sequence of the last one seen."""
+        last = _sequence_token(after)
+        events = [replace(e) for e in self.store.events if e.id > last]
+        if len(events) > limit:
+            return ChangePage(events[:limit], str(events[limit - 1].id), caught_up=False)
+        return ChangePage(events, str(events[-1].id) if events else str(last))
+
+
+class InMemoryDataKeyRepository:
+    """In-memory data key repository (see app/encryption)."""
+
+    def __init__(self, store: Optional[InMemoryStore] = None):
+        self.store = store or InMemoryStore()
+
+    async def latest(self) -> Optional[DataKey]:
+        """Retrieve the data key new values are encrypted with, or None before the first one."""
+        if not self.store.data_keys:
+            return None
+        return replace(self.store.data_keys[max(self.store.data_keys)])
+
+    async def get(self, version: int) -> DataKey:
+        """Retrieve a data key by version."""
+        if version not in self.store.data_keys:
+            raise NotFoundError(f"data_key not found: {version}")
+        return replace(self.store.data_keys[version])
+
+    async def create(self, key: DataKey) -> DataKey:
+        """Store a data key, unless one with its version exists already, and return the stored one."""
+        stored = self.store.data_keys.setdefault(key.version, replace(key))
+        return replace(stored)
+
+
+class InMemoryBulkJobRepository:
+    """In-memory bulk job repository."""
+
+    def __init__(self, store: Optional[InMemoryStore] = None, max_page_size: int = MAX_PAGE_SIZE):
+        self.store = store or InMemoryStore()
+        self.max_page_size = max_page_size
+
+    async def create(self, job: BulkJob) -> BulkJob:
+        """Create a running job."""
+        now = datetime.now()
+        job = replace(job, id=new_id(), status="running", created_at=now, updated_at=now)
+        self.store.bulk_jobs[job.id] = job
+        return replace(job)
+
+    async def get_by_id(self, id: str) -> BulkJob:
+        """Retrieve a job by ID."""
+        if id not in self.store.bulk_jobs:
+            raise NotFoundError(f"bulk_job not found: {id}")
+        return replace(self.store.bulk_jobs[id])
+
+    async def list(self, kind: Optional[str], opts: ListOptions) -> Tuple[List[BulkJob], ListResult]:
+        """Retrieve jobs with pagination, optionally of one kind, newest first."""
+        jobs = [j for j in self.store.bulk_jobs.values() if not kind or j.kind == kind]
+        page, result = _page(_newest_first(jobs), opts, self.max_page_size)
+        return [replace(j) for j in page], result
+
+    async def cancel(self, id: str) -> BulkJob:
+        """Cancel a running job; finished jobs are returned unchanged."""
+        job = await self.get_by_id(id)
+        if job.status == "running":
+            job.status = "cancelled"
+            job.updated_at = job.finished_at = datetime.now()
+            self.store.bulk_jobs[id] = job
+        return replace(job)
+
+    async def restart(self, id: str, stale_seconds: float) -> Optional[BulkJob]:
+        """Set a failed, cancelled or stale running job running again; None if it succeeded or is running."""
+        job = await self.get_by_id(id)
+        now = datetime.now()
+        stale = job.status == "running" and job.updated_at < now - timedelta(seconds=stale_seconds)
+        if job.status not in ("failed", "cancelled") and not stale:
+            return None
+        job.status, job.error, job.finished_at, job.updated_at = "running", "", None, now
+        self.store.bulk_jobs[id] = job
+        return replace(job)
+
+    async def save_progress(self, job: BulkJob) -> bool:
+        """Record a job's progress and, unless it was cancelled, its status; False if it was cancelled."""
+        stored = self.store.bulk_jobs.get(job.id)
+        if stored is None or stored.status not in ("running", "cancelled"):
+            return False
+        job.updated_at = datetime.now()
+        if stored.status == "cancelled":
+            job.status, job.error, job.finished_at = stored.status, stored.error, stored.finished_at
+        elif job.status != "running":
+            job.finished_at = job.updated_at
+        self.store.bulk_jobs[job.id] = replace(job)
+        return job.status != "cancelled"
+
+
+class InMemoryTransferRepository:
+    """In-memory bulk export and import of node types, nodes and relationships."""
+
+    def __init__(self, store: Optional[InMemoryStore] = None):
+        self.store = store or InMemoryStore()
+
+    async def stream_export(
+        self,
+        batch_size: int,
+        after: Optional[ExportPosition] = None
+    ) -> AsyncIterator[ExportRecord]:
+        """
+        Stream the change feed position, then all node types, then nodes, then
+        relationships, oldest first; with after, only those after that position.
+        """
+        yield ChangeFeedPosition(token=str(self.store.events[-1].id if self.store.events else 0))
+        snapshot = (
+            list(self.store.node_types.values()),
+            list(self.store.nodes.values()),
+            list(self.store.relationships.values()),
+        )
+        skip = EXPORT_RECORD_TYPES.index(after.record_type) if after else 0
+        for i, records in enumerate(snapshot):
+            if i < skip:
+                continue
+            for record in sorted(records, key=lambda r: (r.created_at, r.id)):
+                if after and i == skip and (record.created_at, record.id) <= (after.created_at, after.id):
+                    continue
+                yield replace(record)
+
+    async def find_by_unique_keys(
+        self,
+        nodes: List[Node],
+        unique_keys: Dict[str, List[List[str]]]
+    ) -> Dict[str, Node]:
+        """
+        Return the existing nodes having the values of nodes for a unique key
+        of their node type (unique_keys by node type ID), by the ID of the node
+        they match.
+        """
+        matches: Dict[str, Node] = {}
+        for node in nodes:
+            for fields in unique_keys.get(node.node_type_id, []):
+                key = _unique_key(node, fields)
+                if key is None:
+                    continue
+                match = next((
+                    other for other in self.store.nodes.values()
+                    if other.node_type_id == node.node_type_id and _unique_key(other, fields) == key
+                ), None)
+                if match:
+                    matches[node.id] = replace(match)
+                    break
+        return matches
+
+    async def import_batch(
+        self,
+        node_types: List[NodeType],
+        nodes: List[Node],
+        relationships: List[Relationship],
+        skip_existing: bool = False,
+        updated_nodes: Optional[List[Node]] = None
+    ) -> int:
+        """
+        Insert a batch of records with their IDs already assigned, all or nothing.
+
+        A created event is recorded for every record, as for individual creates.
+        With skip_existing, records whose ID exists already are skipped; returns
+        how many were. updated_nodes replace the data of existing nodes first,
+        each recorded as an update.
+        """
+        count = len(node_types) + len(nodes) + len(relationships)
+        if skip_existing:
+            node_types = [nt for nt in node_types if nt.id not in self.store.node_types]
+            nodes = [n for n in nodes if n.id not in self.store.nodes]
+            relationships = [r for r in relationships if r.id not in self.store.relationships]
+        updated = []
+        for node in updated_nodes or []:
+            stored = self.store.nodes.get(node.id)
+            if not stored:
+                raise NotFoundError(f"node not found: {node.id}")
+            updated.append(replace(
+                stored, data=node.data or "{}", updated_at=node.updated_at, version=stored.version + 1,
+                schema_version=node.schema_version
+            ))
+        stored_nodes = {**self.store.nodes, **{n.id: n for n in updated}}
+        names = {nt.name for nt in self.store.node_types.values()}
+        node_type_ids = set(self.store.node_types) | {nt.id for nt in node_types}
+        node_ids = set(self.store.nodes) | {n.id for n in nodes}
+        for node_type in node_types:
+            if node_type.name in names:
+                raise ConflictError(f"node_type name already exists: {node_type.name}")
+            names.add(node_type.name)
+        node_types_by_id = {**self.store.node_types, **{nt.id: nt for nt in node_types}}
+        for node in updated:
+            _check_unique_keys(node_types_by_id[node.node_type_id], node, stored_nodes.values())
+        for i, node in enumerate(nodes):
+            if node.node_type_id not in node_type_ids:
+                raise NotFoundError(f"node_type not found: {node.node_type_id}")
+            _check_unique_keys(
+                node_types_by_id[node.node_type_id], node, [*stored_nodes.values(), *nodes[:i]]
+            )
+        for rel in relationships:
+            for node_id in (rel.source_node_id, rel.target_node_id):
+                if node_id not in node_ids:
+                    raise NotFoundError(f"node not found: {node_id}")
+
+        for node in updated:
+            self.store.nodes[node.id] = node
+            self.store.record_revision("updated", node)
+            self.store.record_event("node.updated", "node", node.id, {"node": node.to_dict()})
+        for entity_type, records, table in (
+            ("node_type", node_types, self.store.node_types),
+            ("node", nodes, self.store.nodes),
+            ("relationship", relationships, self.store.relationships),
+        ):
+            for record in records:
+                stored = replace(record, tenant_id="", version=1)
+                if isinstance(stored, NodeType):
+                    stored.display = stored.display or "{}"
+                else:
+                    stored.data = stored.data or "{}"
+                table[stored.id] = stored
+                if isinstance(stored, Node):
+                    self.store.record_revision("created", stored)
+                self.store.record_event(
+                    f"{entity_type}.created", entity_type, stored.id, {entity_type: stored.to_dict()}
+                )
+        return count - len(node_types) - len(nodes) - len(relationships)
+
+
+def _check_unique_keys(node_type: NodeType, node: Node, nodes: Iterable[Node]) -> None:
+    """Raise AlreadyExistsError if node has the same values as another node for a unique key of its type."""
+    if not node_type.unique_keys:
+        return
+    data = json.loads(node.data or "{}")
+    others = [json.loads(other.data or "{}") for other in nodes
+              if other.node_type_id == node.node_type_id and other.id != node.id]
+    for fields in node_type.unique_keys:
+        # Like a unique index, a node missing any field doesn't conflict
+        if any(name not in data for name in fields):
+            continue
+        key = [_json_sort_key(data[name]) for name in fields]
+        for other in others:
+            if all(name in other for name in fields) and [_json_sort_key(other[name]) for name in fields] == key:
+                raise AlreadyExistsError(
+                    f"node with the same {', '.join(fields)} already exists in node_type {node.node_type_id}"
+                )
+
+
+def _unique_key(node: Node, fields: List[str]) -> Optional[List[Tuple[int, Any]]]:
+    """Return node's comparable values for a unique key, or None if it misses a field."""
+    values = unique_key_values(json.loads(node.data or "{}"), fields)
+    return None if values is None else [_json_sort_key(value) for value in values]
+
+
+def _json_contains(value: Any, contained: Any) -> bool:
+    """Whether value contains contained, like jsonb @>."""
+    if isinstance(contained, dict):
+        return isinstance(value, dict) and all(
+            key in value and _json_contains(value[key], item) for key, item in contained.items()
+        )
+    if isinstance(contained, list):
+        if not isinstance(value, list):
+            return False
+        return all(any(_json_contains(v, item) for v in value) for item in contained)
+    return not isinstance(value, (dict, list)) and _json_sort_key(value) == _json_sort_key(contained)
+
+
+def _nodes_at(revisions: Iterable[NodeRevision], at: datetime) -> List[Node]:
+    """Return the nodes as of their last revision at or before at, leaving out deleted ones."""
+    latest: Dict[str, NodeRevision] = {}
+    for revision in sorted(revisions, key=lambda r: (_comparable(r.revised_at), int(r.id))):
+        if _comparable(revision.revised_at) <= _comparable(at):
+            latest[revision.node_id] = revision
+    return [revision.to_node() for revision in latest.values() if revision.op != "deleted"]
+
+
+def _comparable(value: datetime) -> datetime:
+    # Naive times are local, as asyncpg writes them to TIMESTAMPTZ columns
+    return value if value.tzinfo else value.astimezone()
+
+
+def _json_sort_key(value: Any) -> Tuple[int, Any]:
+    """Order JSON values like jsonb: null < string < number < boolean < array < object."""
+    if value is None:
+        return 0, 0
+    if isinstance(value, str):
+        return 1, value
+    if isinstance(value, bool):
+        return 3, value
+    if isinstance(value, (int, float)):
+        return 2, value
+    if isinstance(value, list):
+        return 4, json.dumps(value, sort_keys=True)
+    return 5, json.dumps(value, sort_keys=True)
+
+
+def _sorted(nodes: List[Node], sort: SortOrder) -> List[Node]:
+    """Order nodes by a column or data path; missing data values sort last."""
+    nodes = sorted(nodes, key=lambda n: n.id)
+    if sort.field in NODE_SORT_COLUMNS:
+        return sorted(nodes, key=lambda n: getattr(n, sort.field), reverse=sort.descending)
+
+    nodes = _newest_first(nodes)
+    path = tuple(sort.field.split("."))
+    present, missing = [], []
+    for node in nodes:
+        value = _at_path(json.loads(node.data), path)
+        if value is not _MISSING:
+            present.append((_json_sort_key(value), node))
+        else:
+            missing.append(node)
+    # Sorting is stable, also when reversed, so ties stay newest first
+    present.sort(key=lambda item: item[0], reverse=sort.descending)
+    return [node for _, node in present] + missing
+
+
+_MISSING = object()
+
+
+def _at_path(data: Any, path: Tuple[str, ...]) -> Any:
+    """Return the value at a data path like jsonb #>, or _MISSING."""
+    for key in path:
+        if isinstance(data, dict) and key in data:
+            data = data[key]
+        elif isinstance(data, list) and key.lstrip("-").isdigit() and -len(data) <= int(key) < len(data):
+            data = data[int(key)]
+        else:
+            return _MISSING
+    return data
+
+
+def _json_equal(a: Any, b: Any) -> bool:
+    """Compare JSON values like jsonb =, where true is not 1."""
+    if isinstance(a, dict) and isinstance(b, dict):
+        return a.keys() == b.keys() and all(_json_equal(a[k], b[k]) for k in a)
+    if isinstance(a, list) and isinstance(b, list):
+        return len(a) == len(b) and all(_json_equal(x, y) for x, y in zip(a, b))
+    if isinstance(a, (dict, list)) or isinstance(b, (dict, list)):
+        return False
+    return _json_sort_key(a) == _json_sort_key(b)
+
+
+def _data_match(data_filter: DataFilter, data: Any) -> bool:
+    """Apply the conditions of a data filter to node data."""
+    for path, value in data_filter.equals.items():
+        found = _at_path(data, path)
+        if found is _MISSING or not _json_equal(found, value):
+            return False
+    for path, value in data_filter.contains.items():
+        found = _at_path(data, path)
+        if found is _MISSING or not _json_contains(found, value):
+            return False
+    return True
+
+
+def _geo_match(geo: GeoFilter, data: Any, node_id: str, distances: Dict[str, float]) -> bool:
+    """Apply a geo_point filter to node data, recording the distance for ordering."""
+    if geo.field_type == "geo_shape":
+        raise ValueError("geo_shape queries require the PostGIS extension")
+    if not isinstance(data, dict) or geo.field not in data:
+        return False
+
+    point = data[geo.field]
+    try:
+        lat, lng = float(point["lat"]), float(point["lng"])
+    except (TypeError, KeyError, ValueError):
+        return not (geo.has_radius() or geo.has_bbox())
+
+    if geo.has_radius():
+        distance = _haversine(geo.near_lat, geo.near_lng, lat, lng)
+        if distance > geo.radius_m:
+            return False
+        distances[node_id] = distance
+
+    if geo.has_bbox():
+        if not (geo.min_lat <= lat <= geo.max_lat and geo.min_lng <= lng <= geo.max_lng):
+            return False
+    return True
+
+
+def _haversine(ref_lat: float, ref_lng: float, lat: float, lng: float) -> float:
+    """Great-circle distance in meters."""
+    h = (
+        math.sin(math.radians(lat - ref_lat) / 2) ** 2
+        + math.cos(math.radians(ref_lat)) * math.cos(math.radians(lat))
+        * math.sin(math.radians(lng - ref_lng) / 2) ** 2
+    )
+    return _EARTH_DIAMETER_M * math.asin(math.sqrt(min(1.0, h)))
+
+
+def _number_value(value: Any) -> Optional[float]:
+    """Read a numeric data field, None if missing or not a number."""
+    if isinstance(value, bool) or not isinstance(value, (int, float)):
+        return None
+    return float(value)
+
+
+def _scalar_text_value(value: Any) -> Optional[str]:
+    """Read a string, number or boolean data field as text, like PostgreSQL's ->> operator."""
+    if isinstance(value, str):
+        return value
+    if isinstance(value, (bool, int, float)):
+        return json.dumps(value)
+    return None
+
+
+def _decimal_value(value: Any) -> Optional[Decimal]:
+    """Read a decimal data field (canonical string or number) exactly."""
+    if isinstance(value, bool):
+        return None
+    if isinstance(value, (int, float)):
+        return Decimal(str(value))
+    if isinstance(value, str):
+        text = value[1:] if value[:1] in "+-" else value
+        whole, _, fraction = text.partition(".")
+        if whole.isdigit() and (fraction.isdigit() or "." not in text):
+            try:
+                return Decimal(value)
+            except InvalidOperation:
+                return None
+    return None
+
+
+def _timestamp_value(value: Any) -> Optional[datetime]:
+    """Read an ISO-8601 timestamp data field; timestamps without an offset are UTC."""
+    if not isinstance(value, str) or len(value) < 10 or not value[:4].isdigit():
+        return None
+    try:
+        parsed = datetime.fromisoformat(value.replace("Z", "+00:00"))
+    except ValueError:
+        return None
+    if parsed.tzinfo is None:
+        parsed = parsed.replace(tzinfo=timezone.utc)
+    return parsed
+
+
+def _truncate(value: datetime, interval: str, zone: ZoneInfo) -> datetime:
+    """Truncate a timestamp to the start of its day/week/month in a time zone, as UTC."""
+    local = value.astimezone(zone).replace(hour=0, minute=0, second=0, microsecond=0, tzinfo=None)
+    if interval == "week":
+        local -= timedelta(days=local.weekday())
+    elif interval == "month":
+        local = local.replace(day=1)
+    elif interval != "day":
+        raise ValueError(f"unsupported interval: {interval}")
+    return local.replace(tzinfo=zone).astimezone(timezone.utc)
+
+
+def _metric(metric: str, values: List[Any]) -> Optional[Union[float, Decimal]]:
+    """Compute sum/avg/min/max over non-null values, None when there are none."""
+    if not values:
+        return None
+    if metric == "sum":
+        return sum(values)
+    if metric == "avg":
+        return sum(values) / len(values)
+    if metric == "min":
+        return min(values)
+    if metric == "max":
+        return max(values)
+    raise ValueError(f"unsupported metric: {metric}")
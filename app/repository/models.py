@@ -2,9 +2,12 @@
 Repository models module.
 """
 
+import base64
+import json
 from dataclasses import dataclass, field
 from datetime import datetime
-from typing import Optional
+from decimal import Decimal
+from typing import Any, Awaitable, Callable, Dict, List, Optional, Sequence, Tuple, Union
 
 
 @dataclass
@@ -13,9 +16,13 @@ class Tenant:
     id: str = ""
     slug: str = ""
     name: str = ""
-    status: str = "active"
+    status: str = "active"  # active, suspended or archived (see app/service/tenant_service.py)
     created_at: datetime = field(default_factory=datetime.now)
     updated_at: datetime = field(default_factory=datetime.now)
+    status_reason: str = ""
+    status_changed_at: Optional[datetime] = None
+    # Snapshot of the tenant database taken when the tenant was last archived
+    archive_database: str = ""
 
     def to_dict(self) -> dict:
         """Convert to dictionary."""
@@ -24,11 +31,34 @@ class Tenant:
             "slug": self.slug,
             "name": self.name,
             "status": self.status,
+            "status_reason": self.status_reason,
+            "status_changed_at": self.status_changed_at.isoformat() if self.status_changed_at else None,
+            "archive_database": self.archive_database or None,
             "created_at": self.created_at.isoformat(),
             "updated_at": self.updated_at.isoformat(),
         }
 
 
+@dataclass
+class TenantSlugChange:
+    """A rename of a tenant's slug."""
+    tenant_id: str = ""
+    old_slug: str = ""
+    new_slug: str = ""
+    actor: str = ""
+    changed_at: datetime = field(default_factory=datetime.now)
+
+    def to_dict(self) -> dict:
+        """Convert to dictionary."""
+        return {
+            "tenant_id": self.tenant_id,
+            "old_slug": self.old_slug,
+            "new_slug": self.new_slug,
+            "actor": self.actor,
+            "changed_at": self.changed_at.isoformat(),
+        }
+
+
 @dataclass
 class User:
     """User entity."""
@@ -67,6 +97,220 @@ class TenantUser:
         }
 
 
+@dataclass
+class ApiKey:
+    """API key granting scoped access to one tenant."""
+    id: str = ""
+    tenant_id: str = ""
+    name: str = ""
+    key_prefix: str = ""  # first characters of the key, for identification
+    scopes: List[str] = field(default_factory=list)  # see app/auth/scopes.py
+    node_type_ids: List[str] = field(default_factory=list)  # empty for all node types
+    created_at: datetime = field(default_factory=datetime.now)
+    revoked_at: Optional[datetime] = None
+    revoke_reason: str = ""  # revoked, rotated or unused
+    expires_at: Optional[datetime] = None
+    last_used_at: Optional[datetime] = None
+    rotated_from_id: str = ""  # the key this one replaced
+
+    def to_dict(self) -> dict:
+        """Convert to dictionary. The key itself is never stored."""
+        return {
+            "id": self.id,
+            "tenant_id": self.tenant_id,
+            "name": self.name,
+            "key_prefix": self.key_prefix,
+            "scopes": list(self.scopes),
+            "node_type_ids": list(self.node_type_ids),
+            "created_at": self.created_at.isoformat(),
+            "revoked_at": self.revoked_at.isoformat() if self.revoked_at else None,
+            "revoke_reason": self.revoke_reason or None,
+            "expires_at": self.expires_at.isoformat() if self.expires_at else None,
+            "last_used_at": self.last_used_at.isoformat() if self.last_used_at else None,
+            "rotated_from_id": self.rotated_from_id or None,
+        }
+
+
+@dataclass
+class AuditEvent:
+    """A security event in the control database's audit log."""
+    id: str = ""
+    tenant_id: str = ""  # empty for events not attributable to a tenant
+    event_type: str = ""  # see app/service/auth_guard.py
+    api_key_id: str = ""
+    client_ip: str = ""
+    details: Dict[str, Any] = field(default_factory=dict)
+    created_at: datetime = field(default_factory=datetime.now)
+
+    def to_dict(self) -> dict:
+        """Convert to dictionary."""
+        return {
+            "id": self.id,
+            "tenant_id": self.tenant_id or None,
+            "event_type": self.event_type,
+            "api_key_id": self.api_key_id or None,
+            "client_ip": self.client_ip,
+            "details": dict(self.details),
+            "created_at": self.created_at.isoformat(),
+        }
+
+
+@dataclass
+class AuditExport:
+    """A batch of the audit log exported to write-once storage."""
+    sequence: int = 0
+    first_event_id: int = 0
+    last_event_id: int = 0
+    event_count: int = 0
+    object_key: str = ""
+    hash: str = ""  # hex SHA-256 of the batch object
+    prev_hash: str = ""  # hash of the previous batch, see app/jobs/audit_export.py
+    exported_at: datetime = field(default_factory=datetime.now)
+
+    def to_dict(self) -> dict:
+        """Convert to dictionary."""
+        return {
+            "sequence": self.sequence,
+            "first_event_id": self.first_event_id,
+            "last_event_id": self.last_event_id,
+            "event_count": self.event_count,
+            "object_key": self.object_key,
+            "hash": self.hash,
+            "prev_hash": self.prev_hash,
+            "exported_at": self.exported_at.isoformat(),
+        }
+
+
+@dataclass
+class ServerInstance:
+    """A running server instance, as last reported by its heartbeat."""
+    instance_id: str = ""
+    release: str = ""  # app.__version__ of the instance
+    features: Dict[str, int] = field(default_factory=dict)  # feature versions it supports
+    started_at: datetime = field(default_factory=datetime.now)
+    heartbeat_at: datetime = field(default_factory=datetime.now)
+
+    def to_dict(self) -> dict:
+        """Convert to dictionary."""
+        return {
+            "instance_id": self.instance_id,
+            "release": self.release,
+            "features": dict(self.features),
+            "started_at": self.started_at.isoformat(),
+            "heartbeat_at": self.heartbeat_at.isoformat(),
+        }
+
+
+@dataclass
+class ClusterLease:
+    """A leader role held by a server instance until the lease expires."""
+    role: str = ""  # see ROLES in app/cluster/membership.py
+    instance_id: str = ""
+    acquired_at: datetime = field(default_factory=datetime.now)
+    expires_at: datetime = field(default_factory=datetime.now)
+
+    def to_dict(self) -> dict:
+        """Convert to dictionary."""
+        return {
+            "role": self.role,
+            "instance_id": self.instance_id,
+            "acquired_at": self.acquired_at.isoformat(),
+            "expires_at": self.expires_at.isoformat(),
+        }
+
+
+@dataclass
+class TenantQuota:
+    """Request rate limits of a tenant; None falls back to the server defaults (see app/quotas/)."""
+    tenant_id: str = ""
+    # Requests per second and bucket size of the tenant as a whole; 0 requests per second is unlimited
+    requests_per_second: Optional[float] = None
+    burst: Optional[int] = None
+    # The same for each of the tenant's API keys
+    api_key_requests_per_second: Optional[float] = None
+    api_key_burst: Optional[int] = None
+    updated_at: Optional[datetime] = None
+
+    def to_dict(self) -> dict:
+        """Convert to dictionary."""
+        return {
+            "tenant_id": self.tenant_id,
+            "requests_per_second": self.requests_per_second,
+            "burst": self.burst,
+            "api_key_requests_per_second": self.api_key_requests_per_second,
+            "api_key_burst": self.api_key_burst,
+            "updated_at": self.updated_at.isoformat() if self.updated_at else None,
+        }
+
+
+@dataclass
+class TenantDeletion:
+    """A tenant being deleted in the background, step by step (see app/jobs/tenant_deletions.py)."""
+    tenant_id: str = ""
+    slug: str = ""
+    # Tenant database and archive snapshot dropped by the databases step; empty if none
+    database_name: str = ""
+    archive_database: str = ""
+    status: str = "pending"  # pending | running | succeeded | failed
+    step: str = ""  # the step being run, see TENANT_DELETION_STEPS
+    progress: Dict[str, int] = field(default_factory=dict)  # rows deleted so far by step
+    error: str = ""
+    created_at: datetime = field(default_factory=datetime.now)
+    updated_at: datetime = field(default_factory=datetime.now)
+    finished_at: Optional[datetime] = None
+
+    def to_dict(self) -> dict:
+        """Convert to dictionary."""
+        return {
+            "tenant_id": self.tenant_id,
+            "slug": self.slug,
+            "status": self.status,
+            "step": self.step,
+            "progress": dict(self.progress),
+            "error": self.error or None,
+            "done": self.status in ("succeeded", "failed"),
+            "created_at": self.created_at.isoformat(),
+            "updated_at": self.updated_at.isoformat(),
+            "finished_at": self.finished_at.isoformat() if self.finished_at else None,
+        }
+
+
+# Steps of a tenant deletion, in order
+TENANT_DELETION_STEPS = (
+    "relationships", "nodes", "node_types", "databases", "memberships", "api_keys", "audit_events", "tenant"
+)
+
+
+@dataclass
+class BackupVerification:
+    """A restore drill: a backup restored into a scratch database and checked."""
+    id: str = ""
+    backup: str = ""  # path of the backup file
+    backup_taken_at: Optional[datetime] = None  # modification time of the file
+    database_kind: str = ""  # control or tenant; empty if the restore failed
+    status: str = ""  # succeeded or failed
+    checks: List[Dict[str, Any]] = field(default_factory=list)  # name, ok and detail of each check
+    error: str = ""
+    duration_seconds: float = 0.0
+    started_at: datetime = field(default_factory=datetime.now)
+    finished_at: datetime = field(default_factory=datetime.now)
+
+    def to_dict(self) -> dict:
+        """Convert to dictionary."""
+        return {
+            "id": self.id,
+            "backup": self.backup,
+            "backup_taken_at": self.backup_taken_at.isoformat() if self.backup_taken_at else None,
+            "database_kind": self.database_kind or None,
+            "status": self.status,
+            "checks": [dict(check) for check in self.checks],
+            "error": self.error or None,
+            "duration_seconds": self.duration_seconds,
+            "started_at": self.started_at.isoformat(),
+            "finished_at": self.finished_at.isoformat(),
+        }
+
+
 @dataclass
 class NodeType:
     """Node type entity."""
@@ -75,8 +319,18 @@ class NodeType:
     name: str = ""
     description: str = ""
     schema: str = ""  # JSON string
+    display: str = "{}"  # JSON string, UI metadata (see app/service/display.py)
     created_at: datetime = field(default_factory=datetime.now)
     updated_at: datetime = field(default_factory=datetime.now)
+    version: int = 1  # incremented on every update
+    schema_version: int = 1  # incremented whenever the schema changes
+    # Lists of data fields whose values are unique among the node type's nodes
+    unique_keys: List[List[str]] = field(default_factory=list)
+
+    @property
+    def etag(self) -> str:
+        """Entity tag of this version, passed back as if_match to update or delete only this version."""
+        return f'"{self.version}"'
 
     def to_dict(self) -> dict:
         """Convert to dictionary."""
@@ -86,11 +340,67 @@ class NodeType:
             "name": self.name,
             "description": self.description,
             "schema": self.schema,
+            "display": self.display,
             "created_at": self.created_at.isoformat(),
             "updated_at": self.updated_at.isoformat(),
+            "version": self.version,
+            "etag": self.etag,
+            "schema_version": self.schema_version,
+            "unique_keys": [list(key) for key in self.unique_keys],
+        }
+
+
+@dataclass
+class NodeTypeIndex:
+    """A secondary index on data paths of a node type's nodes (see app/repository/node_indexes.py)."""
+    id: str = ""
+    node_type_id: str = ""
+    name: str = ""
+    method: str = "btree"  # btree (equality, ranges, sorting) or gin (containment)
+    # Data paths, each a list of keys, e.g. [["address", "city"]]
+    paths: List[List[str]] = field(default_factory=list)
+    status: str = "building"  # building or ready
+    created_at: datetime = field(default_factory=datetime.now)
+
+    def to_dict(self) -> dict:
+        """Convert to dictionary."""
+        return {
+            "id": self.id,
+            "node_type_id": self.node_type_id,
+            "name": self.name,
+            "method": self.method,
+            "paths": [".".join(path) for path in self.paths],
+            "status": self.status,
+            "created_at": self.created_at.isoformat(),
+        }
+
+
+@dataclass
+class DataKey:
+    """A tenant's key encrypting sensitive data fields, stored wrapped by the KMS (see app/encryption)."""
+    version: int = 1  # Encrypted values name the version of their key
+    kms_key_id: str = ""  # The KMS key encryption key that wrapped it
+    wrapped_key: bytes = b""
+    created_at: datetime = field(default_factory=datetime.now)
+
+    def to_dict(self) -> dict:
+        """Convert to dictionary, without the key."""
+        return {
+            "version": self.version,
+            "kms_key_id": self.kms_key_id,
+            "created_at": self.created_at.isoformat(),
         }
 
 
+@dataclass
+class DataFilter:
+    """Conditions on node data paths, e.g. {("address", "city"): "Paris"}."""
+    # The value at the path equals the given JSON value
+    equals: Dict[Tuple[str, ...], Any] = field(default_factory=dict)
+    # The value at the path contains the given JSON value, like jsonb @>
+    contains: Dict[Tuple[str, ...], Any] = field(default_factory=dict)
+
+
 @dataclass
 class Node:
     """Node entity."""
@@ -100,6 +410,13 @@ class Node:
     data: str = "{}"  # JSON string
     created_at: datetime = field(default_factory=datetime.now)
     updated_at: datetime = field(default_factory=datetime.now)
+    version: int = 1  # incremented on every update
+    schema_version: int = 1  # node type schema version the data was last validated against
+
+    @property
+    def etag(self) -> str:
+        """Entity tag of this version, passed back as if_match to update or delete only this version."""
+        return f'"{self.version}"'
 
     def to_dict(self) -> dict:
         """Convert to dictionary."""
@@ -110,6 +427,50 @@ class Node:
             "data": self.data,
             "created_at": self.created_at.isoformat(),
             "updated_at": self.updated_at.isoformat(),
+            "version": self.version,
+            "etag": self.etag,
+            "schema_version": self.schema_version,
+        }
+
+
+@dataclass
+class NodeRevision:
+    """An immutable state of a node, current from revised_at until the node's next revision."""
+    id: str = ""
+    node_id: str = ""
+    node_type_id: str = ""
+    version: int = 1
+    op: str = "created"  # created | updated | deleted
+    data: str = "{}"  # JSON string
+    schema_version: int = 1
+    node_created_at: datetime = field(default_factory=datetime.now)
+    revised_at: datetime = field(default_factory=datetime.now)
+    actor: str = ""  # who made the change, see app/repository/actor.py
+
+    def to_node(self) -> Node:
+        """Return the node as of this revision."""
+        return Node(
+            id=self.node_id,
+            node_type_id=self.node_type_id,
+            data=self.data,
+            created_at=self.node_created_at,
+            updated_at=self.revised_at,
+            version=self.version,
+            schema_version=self.schema_version,
+        )
+
+    def to_dict(self) -> dict:
+        """Convert to dictionary."""
+        return {
+            "id": self.id,
+            "node_id": self.node_id,
+            "node_type_id": self.node_type_id,
+            "version": self.version,
+            "op": self.op,
+            "data": self.data,
+            "schema_version": self.schema_version,
+            "revised_at": self.revised_at.isoformat(),
+            "actor": self.actor or None,
         }
 
 
@@ -124,6 +485,12 @@ class Relationship:
     data: str = "{}"  # JSON string
     created_at: datetime = field(default_factory=datetime.now)
     updated_at: datetime = field(default_factory=datetime.now)
+    version: int = 1  # incremented on every update
+
+    @property
+    def etag(self) -> str:
+        """Entity tag of this version, passed back as if_match to update or delete only this version."""
+        return f'"{self.version}"'
 
     def to_dict(self) -> dict:
         """Convert to dictionary."""
@@ -136,9 +503,691 @@ class Relationship:
             "data": self.data,
             "created_at": self.created_at.isoformat(),
             "updated_at": self.updated_at.isoformat(),
+            "version": self.version,
+            "etag": self.etag,
         }
 
 
+@dataclass
+class OutboxEvent:
+    """Change event recorded in the transactional outbox."""
+    id: int = 0
+    event_id: str = ""
+    event_type: str = ""  # e.g. node.created
+    entity_type: str = ""  # node | node_type | relationship
+    entity_id: str = ""
+    payload: str = "{}"  # JSON string
+    created_at: datetime = field(default_factory=datetime.now)
+    schema_version: int = 1  # version of the event type's schema the payload has (see app/events/schemas.py)
+
+    def to_dict(self) -> dict:
+        """Convert to dictionary."""
+        return {
+            "id": self.id,
+            "event_id": self.event_id,
+            "event_type": self.event_type,
+            "entity_type": self.entity_type,
+            "entity_id": self.entity_id,
+            "payload": self.payload,
+            "created_at": self.created_at.isoformat(),
+            "schema_version": self.schema_version,
+        }
+
+    def to_change(self) -> dict:
+        """Convert to a change feed entry: the envelope webhooks receive, with the outbox sequence."""
+        return {
+            "sequence": self.id,
+            "id": self.event_id,
+            "type": self.event_type,
+            "schema_version": self.schema_version,
+            "created_at": self.created_at.isoformat(),
+            "data": json.loads(self.payload or "{}"),
+        }
+
+
+@dataclass
+class ChangeFeedPosition:
+    """
+    Where a tenant's change feed stood when a snapshot was taken: the changes
+    committed before it are in the snapshot, the others follow the token.
+    """
+    token: str = ""  # list_changes resumes after the snapshot from here
+    lsn: str = ""  # WAL position of the snapshot (PostgreSQL only), e.g. 0/16B3748
+    snapshot: str = ""  # the pg_snapshot itself (PostgreSQL only), xmin:xmax:xip_list
+
+
+@dataclass
+class ChangePage:
+    """A page of a tenant's change feed."""
+    events: List[OutboxEvent] = field(default_factory=list)
+    next_token: str = ""  # position after the page, to list the next changes from
+    caught_up: bool = True  # no more changes were committed yet
+
+    def to_dict(self) -> dict:
+        """Convert to dictionary."""
+        return {
+            "events": [event.to_change() for event in self.events],
+            "next_token": self.next_token,
+            "caught_up": self.caught_up,
+        }
+
+
+@dataclass
+class WebhookEndpoint:
+    """Tenant-configured webhook endpoint or chat sink."""
+    id: str = ""
+    url: str = ""
+    secret: str = ""
+    event_types: List[str] = field(default_factory=list)  # empty = all events
+    description: str = ""
+    status: str = "active"
+    kind: str = "webhook"  # webhook | slack | teams
+    template: str = ""  # chat message template (slack/teams), see app/events/sinks.py
+    node_type_ids: List[str] = field(default_factory=list)  # empty = all node types
+    created_at: datetime = field(default_factory=datetime.now)
+    updated_at: datetime = field(default_factory=datetime.now)
+
+    def to_dict(self, include_secret: bool = False) -> dict:
+        """Convert to dictionary. The signing secret is only included on request."""
+        result = {
+            "id": self.id,
+            "url": self.url,
+            "event_types": list(self.event_types),
+            "description": self.description,
+            "status": self.status,
+            "kind": self.kind,
+            "template": self.template,
+            "node_type_ids": list(self.node_type_ids),
+            "created_at": self.created_at.isoformat(),
+            "updated_at": self.updated_at.isoformat(),
+        }
+        if include_secret:
+            result["secret"] = self.secret
+        return result
+
+
+@dataclass
+class WebhookDelivery:
+    """Delivery of one outbox event to one webhook endpoint."""
+    id: str = ""
+    endpoint_id: str = ""
+    event_id: str = ""
+    event_type: str = ""
+    payload: str = "{}"  # JSON string
+    status: str = "pending"  # pending | succeeded | failed
+    attempts: int = 0
+    next_attempt_at: datetime = field(default_factory=datetime.now)
+    last_status_code: Optional[int] = None
+    last_error: str = ""
+    created_at: datetime = field(default_factory=datetime.now)
+    updated_at: datetime = field(default_factory=datetime.now)
+    schema_version: int = 1  # of the event's payload
+    last_attempt_at: Optional[datetime] = None
+    last_latency_ms: Optional[int] = None  # response time of the last attempt
+    test: bool = False  # a test event sent on request
+
+    def to_dict(self) -> dict:
+        """Convert to dictionary."""
+        return {
+            "id": self.id,
+            "endpoint_id": self.endpoint_id,
+            "event_id": self.event_id,
+            "event_type": self.event_type,
+            "schema_version": self.schema_version,
+            "status": self.status,
+            "attempts": self.attempts,
+            "next_attempt_at": self.next_attempt_at.isoformat(),
+            "last_status_code": self.last_status_code,
+            "last_error": self.last_error,
+            "last_attempt_at": self.last_attempt_at.isoformat() if self.last_attempt_at else None,
+            "last_latency_ms": self.last_latency_ms,
+            "test": self.test,
+            "created_at": self.created_at.isoformat(),
+            "updated_at": self.updated_at.isoformat(),
+        }
+
+
+@dataclass
+class EventSubscription:
+    """Pull subscription: a consumer fetches its events in batches and acknowledges them."""
+    id: str = ""
+    name: str = ""
+    event_types: List[str] = field(default_factory=list)  # empty = all events
+    node_type_ids: List[str] = field(default_factory=list)  # empty = all node types
+    ack_deadline_seconds: int = 60  # how long pulled events are leased before they are offered again
+    status: str = "active"  # active | disabled
+    backlog: int = 0  # events not acknowledged yet
+    created_at: datetime = field(default_factory=datetime.now)
+    updated_at: datetime = field(default_factory=datetime.now)
+
+    def to_dict(self) -> dict:
+        """Convert to dictionary."""
+        return {
+            "id": self.id,
+            "name": self.name,
+            "event_types": list(self.event_types),
+            "node_type_ids": list(self.node_type_ids),
+            "ack_deadline_seconds": self.ack_deadline_seconds,
+            "status": self.status,
+            "backlog": self.backlog,
+            "created_at": self.created_at.isoformat(),
+            "updated_at": self.updated_at.isoformat(),
+        }
+
+
+@dataclass
+class SubscriptionMessage:
+    """An event pulled from a subscription, acknowledged by its ack_id once processed."""
+    ack_id: str = ""
+    event_id: str = ""  # the same on every delivery of the event: consumers dedupe on it
+    event_type: str = ""
+    payload: Dict[str, Any] = field(default_factory=dict)
+    delivery_count: int = 0
+    created_at: datetime = field(default_factory=datetime.now)
+    schema_version: int = 1  # of the event's payload
+
+    def to_dict(self) -> dict:
+        """Convert to dictionary, with the event in the envelope webhooks receive."""
+        return {
+            "ack_id": self.ack_id,
+            "delivery_count": self.delivery_count,
+            "event": {
+                "id": self.event_id,
+                "type": self.event_type,
+                "schema_version": self.schema_version,
+                "created_at": self.created_at.isoformat(),
+                "data": self.payload,
+            },
+        }
+
+
+@dataclass
+class IntakeForm:
+    """Public form that creates nodes of one node type from anonymous submissions."""
+    id: str = ""
+    token: str = ""  # secret path segment of the public submission URL
+    node_type_id: str = ""
+    name: str = ""
+    fields: List[str] = field(default_factory=list)  # accepted data fields; empty = any
+    require_captcha: bool = False
+    rate_limit_per_minute: int = 10  # per client IP
+    status: str = "active"
+    signing_secret: str = ""  # submissions must be signed with it, if set
+    created_at: datetime = field(default_factory=datetime.now)
+    updated_at: datetime = field(default_factory=datetime.now)
+
+    def to_dict(self, include_secret: bool = False) -> dict:
+        """Convert to dictionary. The signing secret is only included on request."""
+        result = {
+            "id": self.id,
+            "token": self.token,
+            "node_type_id": self.node_type_id,
+            "name": self.name,
+            "fields": list(self.fields),
+            "require_captcha": self.require_captcha,
+            "rate_limit_per_minute": self.rate_limit_per_minute,
+            "require_signature": bool(self.signing_secret),
+            "status": self.status,
+            "created_at": self.created_at.isoformat(),
+            "updated_at": self.updated_at.isoformat(),
+        }
+        if include_secret and self.signing_secret:
+            result["signing_secret"] = self.signing_secret
+        return result
+
+
+@dataclass
+class EmailInbox:
+    """Inbound email address that creates nodes of one node type from received emails."""
+    id: str = ""
+    token: str = ""  # secret path segment of the provider webhook URL
+    node_type_id: str = ""
+    name: str = ""
+    field_mapping: Dict[str, str] = field(default_factory=dict)  # email part -> data field
+    status: str = "active"
+    signing_secret: str = ""  # deliveries must be signed with it, if set
+    created_at: datetime = field(default_factory=datetime.now)
+    updated_at: datetime = field(default_factory=datetime.now)
+
+    def to_dict(self, include_secret: bool = False) -> dict:
+        """Convert to dictionary. The signing secret is only included on request."""
+        result = {
+            "id": self.id,
+            "token": self.token,
+            "node_type_id": self.node_type_id,
+            "name": self.name,
+            "field_mapping": dict(self.field_mapping),
+            "require_signature": bool(self.signing_secret),
+            "status": self.status,
+            "created_at": self.created_at.isoformat(),
+            "updated_at": self.updated_at.isoformat(),
+        }
+        if include_secret and self.signing_secret:
+            result["signing_secret"] = self.signing_secret
+        return result
+
+
+@dataclass
+class EmailAttachment:
+    """File attached to an ingested email."""
+    id: str = ""
+    node_id: str = ""
+    filename: str = ""
+    content_type: str = ""
+    size_bytes: int = 0
+    content: bytes = b""
+    created_at: datetime = field(default_factory=datetime.now)
+
+    def to_dict(self, include_content: bool = False) -> dict:
+        """Convert to dictionary. Content is only included (base64) on request."""
+        result = {
+            "id": self.id,
+            "node_id": self.node_id,
+            "filename": self.filename,
+            "content_type": self.content_type,
+            "size_bytes": self.size_bytes,
+            "created_at": self.created_at.isoformat(),
+        }
+        if include_content:
+            result["content"] = base64.b64encode(self.content).decode("ascii")
+        return result
+
+
+@dataclass
+class Attachment:
+    """A file attached to a node; its bytes are kept in the blob store under blob_key."""
+    id: str = ""
+    node_id: str = ""
+    filename: str = ""
+    content_type: str = ""
+    size_bytes: int = 0
+    # Hex SHA-256 of the content, to verify downloads
+    sha256: str = ""
+    blob_key: str = ""
+    created_at: datetime = field(default_factory=datetime.now)
+
+    def to_dict(self) -> dict:
+        """Convert to dictionary, without the blob key."""
+        return {
+            "id": self.id,
+            "node_id": self.node_id,
+            "filename": self.filename,
+            "content_type": self.content_type,
+            "size_bytes": self.size_bytes,
+            "sha256": self.sha256,
+            "created_at": self.created_at.isoformat(),
+        }
+
+
+@dataclass
+class NodeLock:
+    """
+    A lease on a node held by an editor until expires_at, proven by its token.
+    enforced locks make node updates and deletes without the token fail.
+    """
+    node_id: str = ""
+    holder: str = ""
+    token: str = ""
+    enforced: bool = False
+    acquired_at: datetime = field(default_factory=datetime.now)
+    expires_at: datetime = field(default_factory=datetime.now)
+
+    def to_dict(self) -> dict:
+        """Convert to dictionary, without the token, which only its holder is given."""
+        return {
+            "node_id": self.node_id,
+            "holder": self.holder,
+            "enforced": self.enforced,
+            "acquired_at": self.acquired_at.isoformat(),
+            "expires_at": self.expires_at.isoformat(),
+        }
+
+
+@dataclass
+class ImportProgress:
+    """Progress of a tenant data import."""
+    lines: int = 0
+    batches: int = 0
+    node_types_created: int = 0
+    # Node types mapped onto an existing node type with the same name
+    node_types_matched: int = 0
+    nodes_created: int = 0
+    relationships_created: int = 0
+    bytes: int = 0  # of the lines read
+    # Records a resumed import found already imported, by the batch committed before it stopped
+    records_skipped: int = 0
+    # SHA-256 of the lines read, checked when a resumed import reads them again
+    checksum: str = ""
+    # Nodes matching an existing node by a unique key, by how the import handled them (its on_conflict)
+    nodes_skipped: int = 0
+    nodes_overwritten: int = 0
+    nodes_merged: int = 0
+    # Outcomes of the records of the last batch, if the import reports them; not checkpointed
+    rows: List["ImportRow"] = field(default_factory=list)
+
+    def to_dict(self) -> dict:
+        """Convert to dictionary."""
+        return {
+            "lines": self.lines,
+            "bytes": self.bytes,
+            "batches": self.batches,
+            "node_types_created": self.node_types_created,
+            "node_types_matched": self.node_types_matched,
+            "nodes_created": self.nodes_created,
+            "relationships_created": self.relationships_created,
+            "records_skipped": self.records_skipped,
+            "checksum": self.checksum,
+            "nodes_skipped": self.nodes_skipped,
+            "nodes_overwritten": self.nodes_overwritten,
+            "nodes_merged": self.nodes_merged,
+        }
+
+    @classmethod
+    def from_dict(cls, data: dict) -> "ImportProgress":
+        """Restore the progress saved by to_dict."""
+        return cls(**{name: data[name] for name in cls.__dataclass_fields__ if name in data})
+
+
+@dataclass
+class ImportRow:
+    """What an import did with one record."""
+    line: int
+    record_type: str  # node_type | node | relationship
+    # The record's ID in the tenant: the existing record's if it matched one
+    id: str
+    outcome: str  # created | matched | skipped | overwritten | merged
+
+    def to_dict(self) -> dict:
+        """Convert to dictionary."""
+        return {"line": self.line, "type": self.record_type, "id": self.id, "outcome": self.outcome}
+
+
+@dataclass
+class NodeValidationReport:
+    """Result of validating a node type's existing nodes against a schema."""
+    checked: int = 0
+    invalid_count: int = 0
+    # Nodes below the node type's current schema version
+    outdated_count: int = 0
+    errors: List[dict] = field(default_factory=list)  # sample of {"node_id", "schema_version", "error"}
+
+    def to_dict(self) -> dict:
+        """Convert to dictionary."""
+        return {
+            "checked": self.checked,
+            "invalid_count": self.invalid_count,
+            "outdated_count": self.outdated_count,
+            "errors": list(self.errors),
+        }
+
+
+@dataclass
+class LakeExport:
+    """A run of the scheduled Parquet export to object storage."""
+    id: str = ""
+    status: str = "running"  # running | succeeded | failed
+    started_at: datetime = field(default_factory=datetime.now)
+    finished_at: Optional[datetime] = None
+    manifest_key: str = ""
+    file_count: int = 0
+    node_count: int = 0
+    error: str = ""
+
+    def to_dict(self) -> dict:
+        """Convert to dictionary."""
+        return {
+            "id": self.id,
+            "status": self.status,
+            "started_at": self.started_at.isoformat(),
+            "finished_at": self.finished_at.isoformat() if self.finished_at else None,
+            "manifest_key": self.manifest_key,
+            "file_count": self.file_count,
+            "node_count": self.node_count,
+            "error": self.error,
+        }
+
+
+@dataclass
+class NodeMigration:
+    """A background job migrating a node type's nodes to its current schema version."""
+    id: str = ""
+    node_type_id: str = ""
+    target_schema_version: int = 1
+    transform: str = "[]"  # JSON string, see app/service/transform.py
+    status: str = "pending"  # pending | running | succeeded | failed | cancelled
+    batch_size: int = 500
+    last_node_id: str = ""
+    migrated_count: int = 0
+    failed_count: int = 0
+    failures: List[dict] = field(default_factory=list)  # sample of {"node_id", "error"}
+    error: str = ""
+    created_at: datetime = field(default_factory=datetime.now)
+    updated_at: datetime = field(default_factory=datetime.now)
+    finished_at: Optional[datetime] = None
+
+    def to_dict(self) -> dict:
+        """Convert to dictionary."""
+        return {
+            "id": self.id,
+            "node_type_id": self.node_type_id,
+            "target_schema_version": self.target_schema_version,
+            "transform": self.transform,
+            "status": self.status,
+            "batch_size": self.batch_size,
+            "migrated_count": self.migrated_count,
+            "failed_count": self.failed_count,
+            "failures": list(self.failures),
+            "error": self.error,
+            "created_at": self.created_at.isoformat(),
+            "updated_at": self.updated_at.isoformat(),
+            "finished_at": self.finished_at.isoformat() if self.finished_at else None,
+        }
+
+
+@dataclass
+class RetentionPolicy:
+    """How long the nodes of a node type are kept, and what happens to them then."""
+    node_type_id: str = ""
+    timestamp_field: str = "created_at"  # created_at | updated_at | data.<path>
+    ttl_seconds: int = 0
+    action: str = "delete"  # delete | purge
+    created_at: datetime = field(default_factory=datetime.now)
+    updated_at: datetime = field(default_factory=datetime.now)
+    last_swept_at: Optional[datetime] = None
+    last_expired_count: int = 0
+
+    def to_dict(self) -> dict:
+        """Convert to dictionary."""
+        return {
+            "node_type_id": self.node_type_id,
+            "timestamp_field": self.timestamp_field,
+            "ttl_seconds": self.ttl_seconds,
+            "action": self.action,
+            "created_at": self.created_at.isoformat(),
+            "updated_at": self.updated_at.isoformat(),
+            "last_swept_at": self.last_swept_at.isoformat() if self.last_swept_at else None,
+            "last_expired_count": self.last_expired_count,
+        }
+
+
+# Called by bulk operations with the records processed so far and their total,
+# before the first batch and after each committed one; returning False stops
+# the operation there (see app/service/bulk_job_service.py)
+BatchHook = Callable[[int, Optional[int]], Awaitable[bool]]
+
+# Kinds of bulk jobs
+BULK_IMPORT = "import"
+BULK_DELETE = "bulk_delete"
+BULK_BACKFILL = "backfill"
+BULK_EXPORT = "export"
+
+
+@dataclass
+class BulkJob:
+    """
+    A bulk operation (an import, an export, a bulk delete or a backfill) run
+    by a request or the CLI, recorded so its progress can be followed and it
+    can be cancelled. Cancelled jobs stop after the batch they are in.
+    """
+    id: str = ""
+    kind: str = ""  # import | export | bulk_delete | backfill
+    status: str = "running"  # running | succeeded | failed | cancelled
+    params: Dict[str, Any] = field(default_factory=dict)
+    processed: int = 0
+    total: Optional[int] = None  # None while unknown
+    unit: str = "records"  # what processed and total count, e.g. "nodes" or "bytes"
+    progress: Dict[str, Any] = field(default_factory=dict)  # details, e.g. an import's ImportProgress
+    error: str = ""
+    created_at: datetime = field(default_factory=datetime.now)
+    updated_at: datetime = field(default_factory=datetime.now)
+    finished_at: Optional[datetime] = None
+
+    def eta_seconds(self) -> Optional[float]:
+        """Estimate the seconds left of a running job from its rate so far, None if unknown."""
+        if self.status != "running" or self.total is None or self.processed <= 0:
+            return None
+        elapsed = (self.updated_at - self.created_at).total_seconds()
+        return round(elapsed * max(0, self.total - self.processed) / self.processed, 1)
+
+    def to_dict(self) -> dict:
+        """Convert to dictionary."""
+        return {
+            "id": self.id,
+            "kind": self.kind,
+            "status": self.status,
+            "params": dict(self.params),
+            "processed": self.processed,
+            "total": self.total,
+            "unit": self.unit,
+            "eta_seconds": self.eta_seconds(),
+            "progress": dict(self.progress),
+            "error": self.error,
+            "created_at": self.created_at.isoformat(),
+            "updated_at": self.updated_at.isoformat(),
+            "finished_at": self.finished_at.isoformat() if self.finished_at else None,
+        }
+
+
+# Kinds of dead letters
+DEAD_LETTER_WEBHOOK_DELIVERY = "webhook_delivery"
+DEAD_LETTER_NODE_MIGRATION = "node_migration"
+DEAD_LETTER_KINDS = (DEAD_LETTER_WEBHOOK_DELIVERY, DEAD_LETTER_NODE_MIGRATION)
+
+
+@dataclass
+class DeadLetter:
+    """
+    A webhook delivery that ran out of attempts or a background job that
+    failed, kept with its error and payload until it is replayed or discarded
+    (see app/service/dead_letter_service.py).
+    """
+    id: str = ""
+    kind: str = ""  # webhook_delivery | node_migration
+    source_id: str = ""  # ID of the failed delivery or job
+    payload: Dict[str, Any] = field(default_factory=dict)  # what replaying needs, e.g. the event
+    error: str = ""
+    attempts: int = 0
+    status: str = "dead"  # dead | replayed | discarded
+    replay_count: int = 0
+    replay_result: Dict[str, Any] = field(default_factory=dict)  # e.g. the ID of the new job
+    created_at: datetime = field(default_factory=datetime.now)
+    updated_at: datetime = field(default_factory=datetime.now)
+    replayed_at: Optional[datetime] = None
+
+    def to_dict(self) -> dict:
+        """Convert to dictionary."""
+        return {
+            "id": self.id,
+            "kind": self.kind,
+            "source_id": self.source_id,
+            "payload": dict(self.payload),
+            "error": self.error,
+            "attempts": self.attempts,
+            "status": self.status,
+            "replay_count": self.replay_count,
+            "replay_result": dict(self.replay_result),
+            "created_at": self.created_at.isoformat(),
+            "updated_at": self.updated_at.isoformat(),
+            "replayed_at": self.replayed_at.isoformat() if self.replayed_at else None,
+        }
+
+
+# Statuses of operations that are finished
+OPERATION_DONE_STATUSES = ("succeeded", "failed", "cancelled")
+
+
+@dataclass
+class Operation:
+    """
+    A long-running operation: the common view of an asynchronous job such as
+    a node migration (see app/service/operation_service.py).
+    """
+    name: str = ""  # "<kind>/<id>", e.g. "node_migrations/<id>"
+    kind: str = ""
+    status: str = "pending"  # pending | running | succeeded | failed | cancelled
+    metadata: Dict[str, Any] = field(default_factory=dict)  # progress and parameters of the job
+    response: Optional[Dict[str, Any]] = None  # result, once succeeded
+    error: str = ""  # once failed or cancelled
+    created_at: datetime = field(default_factory=datetime.now)
+    updated_at: datetime = field(default_factory=datetime.now)
+
+    @property
+    def done(self) -> bool:
+        """Whether the operation finished, successfully or not."""
+        return self.status in OPERATION_DONE_STATUSES
+
+    def to_dict(self) -> dict:
+        """Convert to dictionary."""
+        result = {
+            "name": self.name,
+            "kind": self.kind,
+            "status": self.status,
+            "done": self.done,
+            "metadata": dict(self.metadata),
+            "created_at": self.created_at.isoformat(),
+            "updated_at": self.updated_at.isoformat(),
+        }
+        if self.response is not None:
+            result["response"] = dict(self.response)
+        if self.error:
+            result["error"] = {"message": self.error}
+        return result
+
+
+@dataclass
+class BiViewColumn:
+    """A column of a BI view, read from a path in node data."""
+    name: str = ""
+    path: List[str] = field(default_factory=list)  # e.g. ["location", "lat"]
+    kind: str = "text"  # text, numeric, bigint, boolean or jsonb
+
+    def to_dict(self) -> dict:
+        """Convert to dictionary."""
+        return {"name": self.name, "path": list(self.path), "kind": self.kind}
+
+
+@dataclass
+class BiView:
+    """A read-only SQL view flattening the nodes of one node type into columns."""
+    name: str = ""
+    node_type_id: str = ""
+    node_type_name: str = ""
+    columns: List[BiViewColumn] = field(default_factory=list)
+
+    def to_dict(self) -> dict:
+        """Convert to dictionary."""
+        return {
+            "name": self.name,
+            "node_type_id": self.node_type_id,
+            "node_type_name": self.node_type_name,
+            "columns": [c.to_dict() for c in self.columns],
+        }
+
+
+# Largest page returned by list methods (repositories can be created with a larger limit)
+MAX_PAGE_SIZE = 100
+
+
 @dataclass
 class ListOptions:
     """Common pagination options."""
@@ -146,6 +1195,117 @@ class ListOptions:
     page_token: str = ""
 
 
+# A list filter: one value, or a sequence of values any of which matches;
+# None or empty matches everything
+FilterValues = Union[str, Sequence[str], None]
+
+
+def filter_values(values: FilterValues) -> List[str]:
+    """Return the values a list filter matches, empty if it matches everything."""
+    if not values:
+        return []
+    return [values] if isinstance(values, str) else list(values)
+
+
+@dataclass
+class GeoFilter:
+    """Geospatial filter over a geo_point or geo_shape data field.
+
+    Set near_lat/near_lng/radius_m for a within-radius query, or the
+    min_*/max_* bounds for a bounding-box query. Distance ordering is
+    relative to the within-radius reference point.
+    """
+    field: str = ""
+    field_type: str = "geo_point"
+    near_lat: Optional[float] = None
+    near_lng: Optional[float] = None
+    radius_m: Optional[float] = None
+    min_lat: Optional[float] = None
+    min_lng: Optional[float] = None
+    max_lat: Optional[float] = None
+    max_lng: Optional[float] = None
+    order_by_distance: bool = False
+
+    def has_radius(self) -> bool:
+        """Whether a within-radius query was requested."""
+        return None not in (self.near_lat, self.near_lng, self.radius_m)
+
+    def has_bbox(self) -> bool:
+        """Whether a bounding-box query was requested."""
+        return None not in (self.min_lat, self.min_lng, self.max_lat, self.max_lng)
+
+
+@dataclass
+class AggregationRange:
+    """A single bucket definition for a range aggregation (from inclusive, to exclusive)."""
+    key: str = ""
+    from_value: Optional[float] = None
+    to_value: Optional[float] = None
+
+
+@dataclass
+class Aggregation:
+    """Bucketed aggregation over node data fields.
+
+    kind is one of:
+    - "range": explicit numeric ranges over field
+    - "histogram": fixed-width numeric buckets between min_value and max_value
+    - "date_histogram": calendar buckets (day/week/month) over a timestamp field
+    - "terms": a bucket per distinct scalar value of field, the size largest first
+    - "all": a single bucket of every node (field is not used)
+
+    Each bucket reports its document count and, when metric is set, the
+    metric (sum/avg/min/max) over metric_field.
+
+    field_type / metric_field_type carry the declared schema type when known;
+    "decimal" fields are read and aggregated as exact numeric values.
+    """
+    kind: str = ""
+    ranges: List[AggregationRange] = field(default_factory=list)
+    field: str = ""
+    min_value: Optional[float] = None
+    max_value: Optional[float] = None
+    buckets: int = 0
+    interval: str = ""
+    time_zone: str = "UTC"
+    size: int = 0
+    metric: str = ""
+    metric_field: str = ""
+    field_type: str = ""
+    metric_field_type: str = ""
+
+
+@dataclass
+class AggregationBucket:
+    """A single aggregation result bucket. Decimal values are reported as strings."""
+    key: str = ""
+    from_value: Optional[Union[float, Decimal]] = None
+    to_value: Optional[Union[float, Decimal]] = None
+    doc_count: int = 0
+    value: Optional[Union[float, Decimal]] = None
+
+    def to_dict(self) -> dict:
+        """Convert to dictionary."""
+        result = {
+            "key": self.key,
+            "doc_count": self.doc_count,
+        }
+        for name, value in (("from", self.from_value), ("to", self.to_value), ("value", self.value)):
+            if value is not None:
+                result[name] = str(value) if isinstance(value, Decimal) else value
+        return result
+
+
+@dataclass
+class SortOrder:
+    """
+    Sort order of a listing: a column of the listed resource or, for nodes, a
+    dot-separated data path ("address.city").
+    """
+    field: str = ""
+    descending: bool = False
+
+
 @dataclass
 class ListResult:
     """Common pagination result metadata."""
@@ -0,0 +1,77 @@
+"""
+Secondary indexes on node data paths.
+
+A node type may declare indexes on paths into its nodes' data, so queries
+filtering or sorting on them don't scan every node. Each is a partial
+expression index on nodes, built without blocking writes:
+
+    CREATE INDEX CONCURRENTLY nodes_idx_<index ID>
+        ON nodes ((data #> '{"address","city"}')) WHERE node_type_id = '<node type ID>'
+
+btree indexes serve equality and range comparisons of the values at their
+paths, and sorting by them; GIN indexes (jsonb_path_ops) serve containment,
+such as tags containing a value. Queries use them when they filter on the
+node type and compare path_expression(path) like list_nodes filters do.
+"""
+
+import json
+from typing import Any, List, Sequence, Tuple
+
+import asyncpg
+
+from app.repository.models import DataFilter
+
+INDEX_PREFIX = "nodes_idx_"
+BTREE = "btree"
+GIN = "gin"
+
+
+def index_name(index_id: str) -> str:
+    """Return the name of a node type index in the database."""
+    return f"{INDEX_PREFIX}{index_id.replace('-', '')}"
+
+
+def _literal(value: str) -> str:
+    return "'" + value.replace("'", "''") + "'"
+
+
+def path_expression(path: Sequence[str]) -> str:
+    """Return the SQL expression of the JSON value at a data path, as indexes and filters spell it."""
+    elements = ",".join('"' + key.replace("\\", "\\\\").replace('"', '\\"') + '"' for key in path)
+    return f"(data #> {_literal('{' + elements + '}')})"
+
+
+async def create_node_type_index(
+    conn: asyncpg.Connection,
+    index_id: str,
+    node_type_id: str,
+    method: str,
+    paths: List[List[str]]
+) -> None:
+    """Build a node type index concurrently; conn must not be in a transaction."""
+    if method == GIN:
+        columns = ", ".join(f"{path_expression(path)} jsonb_path_ops" for path in paths)
+        using = " USING GIN"
+    else:
+        columns = ", ".join(path_expression(path) for path in paths)
+        using = ""
+    await conn.execute(
+        f"CREATE INDEX CONCURRENTLY IF NOT EXISTS {index_name(index_id)} ON nodes{using} ({columns}) "
+        f"WHERE node_type_id = {_literal(node_type_id)}"
+    )
+
+
+async def drop_node_type_index(conn: asyncpg.Connection, index_id: str, concurrently: bool = True) -> None:
+    """Drop a node type index, concurrently unless conn is in a transaction."""
+    await conn.execute(f"DROP INDEX {'CONCURRENTLY ' if concurrently else ''}IF EXISTS {index_name(index_id)}")
+
+
+def data_filter_clause(data_filter: DataFilter, first_arg: int) -> Tuple[str, List[Any]]:
+    """Return the " AND ..." conditions of a data filter and their arguments, numbered from first_arg."""
+    where = ""
+    args: List[Any] = []
+    for op, conditions in (("=", data_filter.equals), ("@>", data_filter.contains)):
+        for path, value in conditions.items():
+            args.append(json.dumps(value))
+            where += f" AND {path_expression(path)} {op} ${first_arg + len(args) - 1}::jsonb"
+    return where, args
@@ -0,0 +1,145 @@
+"""
+Node lock repository implementation.
+"""
+
+import uuid
+from typing import List, Optional
+
+import asyncpg
+
+from app.db.database import Database
+from app.repository.errors import ConflictError, NodeLockedError, NotFoundError
+from app.repository.ids import uuid_ids
+from app.repository.models import NodeLock
+
+_LOCK_COLUMNS = "node_id, holder, token, enforced, acquired_at, expires_at"
+
+
+class NodeLockRepository:
+    """PostgreSQL repository of node locks; leases expire by the database clock."""
+
+    def __init__(self, db: Database):
+        self.db = db
+
+    async def acquire(self, lock: NodeLock, ttl_seconds: float) -> NodeLock:
+        """
+        Take the lock of a node for ttl_seconds, unless another token holds
+        it; the lock's own token renews it, keeping its acquired_at. Raises
+        NodeLockedError if the node is locked, NotFoundError if it doesn't
+        exist.
+        """
+        _check_id(lock.node_id)
+        query = f"""
+            INSERT INTO node_locks (node_id, holder, token, enforced, expires_at)
+            SELECT id, $2, $3, $4, NOW() + make_interval(secs => $5) FROM nodes WHERE id = $1
+            ON CONFLICT (node_id) DO UPDATE SET
+                holder = EXCLUDED.holder,
+                token = EXCLUDED.token,
+                enforced = EXCLUDED.enforced,
+                acquired_at = CASE
+                    WHEN node_locks.token = EXCLUDED.token THEN node_locks.acquired_at ELSE NOW()
+                END,
+                expires_at = EXCLUDED.expires_at
+            WHERE node_locks.token = EXCLUDED.token OR node_locks.expires_at <= NOW()
+            RETURNING {_LOCK_COLUMNS}
+        """
+
+        async with self.db.pool.acquire() as conn:
+            row = await conn.fetchrow(query, lock.node_id, lock.holder, lock.token, lock.enforced, ttl_seconds)
+            if row:
+                return _row_to_lock(row)
+
+            held = await conn.fetchrow(
+                """
+                SELECT n.id, l.holder, l.expires_at
+                FROM nodes n LEFT JOIN node_locks l ON l.node_id = n.id AND l.expires_at > NOW()
+                WHERE n.id = $1
+                """,
+                lock.node_id
+            )
+
+        if not held:
+            raise NotFoundError(f"node not found: {lock.node_id}")
+        if held[1] is None:
+            # The lock was released between the two queries
+            raise ConflictError(f"lock of node {lock.node_id} changed concurrently, retry")
+        raise NodeLockedError(f"node {lock.node_id} is locked by {held[1]}", held[1], held[2])
+
+    async def get(self, node_id: str) -> Optional[NodeLock]:
+        """Retrieve the unexpired lock of a node, or None if it isn't locked."""
+        try:
+            uuid.UUID(node_id)
+        except ValueError:
+            return None
+        query = f"SELECT {_LOCK_COLUMNS} FROM node_locks WHERE node_id = $1 AND expires_at > NOW()"
+
+        async with self.db.pool.acquire() as conn:
+            row = await conn.fetchrow(query, node_id)
+
+        return _row_to_lock(row) if row else None
+
+    async def release(self, node_id: str, token: str) -> bool:
+        """Remove the lock of a node held by token; returns whether there was one."""
+        try:
+            uuid.UUID(node_id)
+        except ValueError:
+            return False
+        query = "DELETE FROM node_locks WHERE node_id = $1 AND token = $2"
+
+        async with self.db.pool.acquire() as conn:
+            result = await conn.execute(query, node_id, token)
+
+        return result != "DELETE 0"
+
+
+def _check_lock(node_id: str, lock: Optional[NodeLock], lock_token: str = "") -> None:
+    """
+    Raise NodeLockedError unless a change of a node with the given unexpired
+    lock may go ahead: with a lock token, if it holds the lock, without, if
+    the lock isn't enforced.
+    """
+    if lock and lock_token == lock.token:
+        return
+    if lock and (lock_token or lock.enforced):
+        raise NodeLockedError(f"node {node_id} is locked by {lock.holder}", lock.holder, lock.expires_at)
+    if lock_token:
+        raise NodeLockedError(f"lock of node {node_id} expired or was released")
+
+
+async def check_node_locks(conn: asyncpg.Connection, node_ids: List[str], lock_token: str = "") -> None:
+    """
+    Raise NodeLockedError unless nodes may be changed in the transaction of
+    conn (see _check_lock). Their locks are locked FOR SHARE, so they can't
+    be taken over or released before it ends.
+    """
+    rows = await conn.fetch(
+        f"""
+        SELECT {_LOCK_COLUMNS} FROM node_locks
+        WHERE node_id = ANY($1::uuid[]) AND expires_at > NOW()
+        FOR SHARE
+        """,
+        uuid_ids(node_ids)
+    )
+    locks = {lock.node_id: lock for lock in map(_row_to_lock, rows)}
+    for node_id in node_ids:
+        _check_lock(node_id, locks.get(node_id), lock_token)
+
+
+def _row_to_lock(row) -> NodeLock:
+    """Convert a database row to a NodeLock object."""
+    return NodeLock(
+        node_id=str(row[0]),
+        holder=row[1],
+        token=row[2],
+        enforced=row[3],
+        acquired_at=row[4],
+        expires_at=row[5],
+    )
+
+
+def _check_id(id: str) -> None:
+    """Raise NotFoundError for IDs that aren't UUIDs, which no node has."""
+    try:
+        uuid.UUID(id)
+    except ValueError:
+        raise NotFoundError(f"node not found: {id}") from None
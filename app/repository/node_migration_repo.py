@@ -0,0 +1,212 @@
+"""
+Node migration job repository implementation.
+"""
+
+import json
+import uuid
+from typing import List, Optional, Tuple
+
+import asyncpg
+
+from app.db.database import Database
+from app.repository.dead_letter_repo import add_dead_letter
+from app.repository.models import (
+    DEAD_LETTER_NODE_MIGRATION,
+    NodeMigration,
+    ListOptions,
+    ListResult,
+    MAX_PAGE_SIZE,
+)
+from app.repository.errors import ConflictError, NotFoundError
+
+_MIGRATION_COLUMNS = """
+    id, node_type_id, target_schema_version, transform::text, status, batch_size, last_node_id,
+    migrated_count, failed_count, failures::text, error, created_at, updated_at, finished_at
+"""
+
+
+class NodeMigrationRepository:
+    """PostgreSQL repository of node schema migration jobs."""
+
+    def __init__(self, db: Database, max_page_size: int = MAX_PAGE_SIZE):
+        self.db = db
+        self.max_page_size = max_page_size
+
+    async def create(self, migration: NodeMigration) -> NodeMigration:
+        """
+        Create a pending migration.
+
+        Raises ConflictError if the node type already has a pending or running migration.
+        """
+        migration.id = str(uuid.uuid4())
+        query = f"""
+            INSERT INTO node_migrations (id, node_type_id, target_schema_version, transform, batch_size)
+            VALUES ($1, $2, $3, $4::jsonb, $5)
+            RETURNING {_MIGRATION_COLUMNS}
+        """
+
+        async with self.db.pool.acquire() as conn:
+            try:
+                row = await conn.fetchrow(
+                    query,
+                    migration.id, migration.node_type_id, migration.target_schema_version,
+                    migration.transform or "[]", migration.batch_size
+                )
+            except asyncpg.UniqueViolationError:
+                raise ConflictError(
+                    f"node_type {migration.node_type_id} already has an active migration"
+                ) from None
+            except asyncpg.ForeignKeyViolationError:
+                raise NotFoundError(f"node_type not found: {migration.node_type_id}") from None
+
+        return self._row_to_migration(row)
+
+    async def get_by_id(self, id: str) -> NodeMigration:
+        """Retrieve a migration by ID."""
+        query = f"SELECT {_MIGRATION_COLUMNS} FROM node_migrations WHERE id = $1"
+
+        async with self.db.pool.acquire() as conn:
+            row = await conn.fetchrow(query, id)
+
+        if not row:
+            raise NotFoundError(f"node_migration not found: {id}")
+
+        return self._row_to_migration(row)
+
+    async def list(self, node_type_id: Optional[str], opts: ListOptions) -> Tuple[List[NodeMigration], ListResult]:
+        """Retrieve migrations with pagination, optionally of one node type."""
+        page_size = max(1, min(opts.page_size or 10, self.max_page_size))
+        offset = 0
+        if opts.page_token:
+            try:
+                offset = int(opts.page_token)
+            except ValueError:
+                offset = 0
+
+        where = " WHERE node_type_id = $1" if node_type_id else ""
+        args = [node_type_id] if node_type_id else []
+        arg_idx = len(args) + 1
+        list_query = f"""
+            SELECT {_MIGRATION_COLUMNS}
+            FROM node_migrations{where}
+            ORDER BY created_at DESC
+            LIMIT ${arg_idx} OFFSET ${arg_idx + 1}
+        """
+
+        async with self.db.pool.acquire() as conn:
+            total_count = await conn.fetchval("SELECT COUNT(*) FROM node_migrations" + where, *args)
+            rows = await conn.fetch(list_query, *args, page_size, offset)
+
+        migrations = [self._row_to_migration(row) for row in rows]
+
+        result = ListResult(total_count=total_count)
+        next_offset = offset + len(migrations)
+        if next_offset < total_count:
+            result.next_page_token = str(next_offset)
+
+        return migrations, result
+
+    async def cancel(self, id: str) -> NodeMigration:
+        """Cancel a pending or running migration; finished migrations are returned unchanged."""
+        query = f"""
+            UPDATE node_migrations
+            SET status = 'cancelled', lease_until = NULL, updated_at = NOW(), finished_at = NOW()
+            WHERE id = $1 AND status IN ('pending', 'running')
+            RETURNING {_MIGRATION_COLUMNS}
+        """
+
+        async with self.db.pool.acquire() as conn:
+            row = await conn.fetchrow(query, id)
+
+        if not row:
+            return await self.get_by_id(id)
+        return self._row_to_migration(row)
+
+    async def claim(self, lease_seconds: float) -> Optional[NodeMigration]:
+        """
+        Claim the oldest pending migration, or a running one whose lease expired.
+
+        The claimed migration is marked running with a lease of lease_seconds,
+        so only one server instance works on it at a time. Returns None when
+        there is nothing to do.
+        """
+        query = f"""
+            UPDATE node_migrations
+            SET status = 'running', lease_until = NOW() + make_interval(secs => $1), updated_at = NOW()
+            WHERE id = (
+                SELECT id FROM node_migrations
+                WHERE status = 'pending' OR (status = 'running' AND lease_until < NOW())
+                ORDER BY created_at
+                LIMIT 1
+                FOR UPDATE SKIP LOCKED
+            )
+            RETURNING {_MIGRATION_COLUMNS}
+        """
+
+        async with self.db.pool.acquire() as conn:
+            row = await conn.fetchrow(query, lease_seconds)
+
+        return self._row_to_migration(row) if row else None
+
+    async def save_progress(self, migration: NodeMigration, lease_seconds: float) -> bool:
+        """
+        Record a running migration's progress and status, extending its lease.
+
+        Returns False, without saving anything, if the migration is no longer
+        running, e.g. because it was cancelled. Failed migrations are added to
+        the dead letters.
+        """
+        finished = migration.status != "running"
+        query = """
+            UPDATE node_migrations
+            SET status = $2, last_node_id = $3, migrated_count = $4, failed_count = $5,
+                failures = $6::jsonb, error = $7, updated_at = NOW(),
+                lease_until = CASE WHEN $8::boolean THEN NULL ELSE NOW() + make_interval(secs => $9) END,
+                finished_at = CASE WHEN $8::boolean THEN NOW() END
+            WHERE id = $1 AND status = 'running'
+            RETURNING updated_at, finished_at
+        """
+
+        async with self.db.pool.acquire() as conn:
+            async with conn.transaction():
+                row = await conn.fetchrow(
+                    query,
+                    migration.id, migration.status, migration.last_node_id or None,
+                    migration.migrated_count, migration.failed_count, json.dumps(migration.failures),
+                    migration.error or None, finished, lease_seconds
+                )
+                if row and migration.status == "failed":
+                    payload = {
+                        "node_type_id": migration.node_type_id,
+                        "target_schema_version": migration.target_schema_version,
+                        "transform": migration.transform,
+                        "batch_size": migration.batch_size,
+                        "migrated_count": migration.migrated_count,
+                        "failed_count": migration.failed_count,
+                    }
+                    await add_dead_letter(conn, DEAD_LETTER_NODE_MIGRATION, migration.id, payload, migration.error, 1)
+
+        if not row:
+            return False
+        migration.updated_at = row["updated_at"]
+        migration.finished_at = row["finished_at"]
+        return True
+
+    def _row_to_migration(self, row: asyncpg.Record) -> NodeMigration:
+        """Convert a database row to a NodeMigration object."""
+        return NodeMigration(
+            id=str(row["id"]),
+            node_type_id=str(row["node_type_id"]),
+            target_schema_version=row["target_schema_version"],
+            transform=row["transform"],
+            status=row["status"],
+            batch_size=row["batch_size"],
+            last_node_id=str(row["last_node_id"]) if row["last_node_id"] else "",
+            migrated_count=row["migrated_count"],
+            failed_count=row["failed_count"],
+            failures=json.loads(row["failures"]),
+            error=row["error"] or "",
+            created_at=row["created_at"],
+            updated_at=row["updated_at"],
+            finished_at=row["finished_at"],
+        )
@@ -5,23 +5,82 @@ Node repository implementation.
 import json
 import uuid
 from datetime import datetime
-from typing import List, Optional, Tuple
+from decimal import Decimal
+from typing import Any, AsyncIterator, List, Optional, Tuple
 
 import asyncpg
 
 from app.db.database import Database
-from app.repository.models import Node, ListOptions, ListResult
+from app.repository.models import (
+    Node,
+    NodeRevision,
+    GeoFilter,
+    SortOrder,
+    DataFilter,
+    Aggregation,
+    AggregationBucket,
+    BatchHook,
+    ListOptions,
+    MAX_PAGE_SIZE,
+    ListResult,
+    RetentionPolicy,
+)
+from app.repository.actor import current_actor
+from app.repository.dry_run import transaction
 from app.repository.errors import NotFoundError
+from app.repository.ids import uuid_ids
+from app.repository.node_indexes import data_filter_clause, path_expression
+from app.repository.node_lock_repo import check_node_locks
+from app.repository.outbox_repo import record_event
+from app.repository.unique_keys import unique_key_violation
+from app.repository.versioning import raise_update_failure
+
+
+# Node columns that can be sorted on directly; any other sort field is a data field
+NODE_SORT_COLUMNS = ("created_at", "updated_at")
+
+_REVISION_COLUMNS = (
+    "id, node_id, node_type_id, version, op, data::text, schema_version, node_created_at, revised_at, actor"
+)
+
+
+async def record_revisions(
+    conn: asyncpg.Connection,
+    op: str,
+    nodes: List[Node],
+    revised_at: Optional[datetime] = None
+) -> None:
+    """
+    Write a revision of each node using the caller's connection/transaction,
+    as of revised_at or else the node's updated_at, by the current actor.
+    """
+    actor = current_actor()
+    await conn.executemany(
+        """
+        INSERT INTO node_revisions
+            (node_id, node_type_id, version, op, data, schema_version, node_created_at, revised_at, actor)
+        VALUES ($1, $2, $3, $4, $5::jsonb, $6, $7, $8, $9)
+        """,
+        [
+            (n.id, n.node_type_id, n.version, op, n.data or "{}", n.schema_version, n.created_at,
+             revised_at or n.updated_at, actor)
+            for n in nodes
+        ]
+    )
 
 
 class NodeRepository:
     """PostgreSQL node repository."""
 
-    def __init__(self, db: Database):
+    def __init__(self, db: Database, max_page_size: int = MAX_PAGE_SIZE):
         self.db = db
+        self.max_page_size = max_page_size
 
-    async def create(self, node: Node) -> Node:
-        """Create a new node."""
+    async def create(self, node: Node, dry_run: bool = False) -> Node:
+        """
+        Create a new node. Raises AlreadyExistsError if it violates a unique key
+        of its node type. A dry run rolls it back (see dry_run.py).
+        """
         node.id = str(uuid.uuid4())
         node.created_at = datetime.now()
         node.updated_at = datetime.now()
@@ -30,38 +89,80 @@ class NodeRepository:
             node.data = "{}"
 
         query = """
-            INSERT INTO nodes (id, node_type_id, data, created_at, updated_at)
-            VALUES ($1, $2, $3::jsonb, $4, $5)
-            RETURNING id, node_type_id, data::text, created_at, updated_at
+            INSERT INTO nodes (id, node_type_id, data, created_at, updated_at, schema_version)
+            VALUES ($1, $2, $3::jsonb, $4, $5, $6)
+            RETURNING id, node_type_id, data::text, created_at, updated_at, version, schema_version
         """
 
         async with self.db.pool.acquire() as conn:
-            row = await conn.fetchrow(
-                query,
-                node.id, node.node_type_id, node.data,
-                node.created_at, node.updated_at
-            )
+            try:
+                async with transaction(conn, dry_run):
+                    row = await conn.fetchrow(
+                        query,
+                        node.id, node.node_type_id, node.data,
+                        node.created_at, node.updated_at, node.schema_version
+                    )
+                    created = self._row_to_node(row)
+                    await record_revisions(conn, "created", [created])
+                    await record_event(conn, "node.created", "node", created.id, {"node": created.to_dict()})
+            except asyncpg.UniqueViolationError as e:
+                raise await unique_key_violation(conn, e) or e
 
-        return self._row_to_node(row)
+        return created
 
-    async def get_by_id(self, id: str) -> Node:
-        """Retrieve a node by ID."""
-        query = """
-            SELECT id, node_type_id, data::text, created_at, updated_at 
+    async def get_by_id(self, id: str, data_fields: Optional[List[str]] = None) -> Node:
+        """Retrieve a node by ID, with only the given top-level data fields if data_fields isn't None."""
+        args: List[Any] = [id]
+        query = f"""
+            SELECT id, node_type_id, {_data_column(data_fields, args)}, created_at, updated_at, version, schema_version
             FROM nodes 
             WHERE id = $1
         """
 
-        async with self.db.pool.acquire() as conn:
-            row = await conn.fetchrow(query, id)
+        async with self.db.read_pool.acquire() as conn:
+            row = await conn.fetchrow(query, *args)
 
         if not row:
             raise NotFoundError(f"node not found: {id}")
 
         return self._row_to_node(row)
 
-    async def update(self, node: Node) -> Node:
-        """Update an existing node."""
+    async def get_many(self, ids: List[str], data_fields: Optional[List[str]] = None) -> List[Node]:
+        """
+        Retrieve the nodes with the given IDs that exist, in no particular
+        order, with only the given top-level data fields if data_fields isn't None.
+        """
+        ids = uuid_ids(ids)
+        if not ids:
+            return []
+        args: List[Any] = [ids]
+        query = f"""
+            SELECT id, node_type_id, {_data_column(data_fields, args)}, created_at, updated_at, version, schema_version
+            FROM nodes
+            WHERE id = ANY($1::uuid[])
+        """
+
+        async with self.db.read_pool.acquire() as conn:
+            rows = await conn.fetch(query, *args)
+
+        return [self._row_to_node(row) for row in rows]
+
+    async def update(
+        self,
+        node: Node,
+        expected_version: Optional[int] = None,
+        dry_run: bool = False,
+        lock_token: str = ""
+    ) -> Node:
+        """
+        Update an existing node.
+
+        If expected_version is given, the update only applies when it matches
+        the stored version; otherwise ConflictError is raised. Raises
+        AlreadyExistsError if the update violates a unique key of its node type,
+        NodeLockedError unless the node's lock lets lock_token change it (see
+        app/repository/node_lock_repo.py). A dry run rolls the update back.
+        """
         node.updated_at = datetime.now()
 
         if not node.data:
@@ -69,35 +170,315 @@ class NodeRepository:
 
         query = """
             UPDATE nodes 
-            SET data = $2::jsonb, updated_at = $3
-            WHERE id = $1
-            RETURNING id, node_type_id, data::text, created_at, updated_at
+            SET data = $2::jsonb, updated_at = $3, version = version + 1, schema_version = $5
+            WHERE id = $1 AND ($4::bigint IS NULL OR version = $4)
+            RETURNING id, node_type_id, data::text, created_at, updated_at, version, schema_version
+        """
+
+        async with self.db.pool.acquire() as conn:
+            try:
+                async with transaction(conn, dry_run):
+                    await check_node_locks(conn, [node.id], lock_token)
+                    row = await conn.fetchrow(
+                        query,
+                        node.id, node.data, node.updated_at, expected_version, node.schema_version
+                    )
+                    if not row:
+                        await raise_update_failure(conn, "nodes", "node", node.id, expected_version)
+                    updated = self._row_to_node(row)
+                    await record_revisions(conn, "updated", [updated])
+                    await record_event(conn, "node.updated", "node", updated.id, {"node": updated.to_dict()})
+            except asyncpg.UniqueViolationError as e:
+                raise await unique_key_violation(conn, e) or e
+
+        return updated
+
+    async def delete(
+        self,
+        id: str,
+        expected_version: Optional[int] = None,
+        dry_run: bool = False,
+        lock_token: str = ""
+    ) -> None:
+        """
+        Delete a node by ID.
+        If expected_version is given, the node is only deleted while it is at
+        that version; otherwise ConflictError is raised. Raises NodeLockedError
+        unless the node's lock lets lock_token delete it. A dry run rolls the delete back.
+        """
+        query = """
+            DELETE FROM nodes
+            WHERE id = $1 AND ($2::integer IS NULL OR version = $2)
+            RETURNING id, node_type_id, data::text, created_at, updated_at, version, schema_version
+        """
+
+        async with self.db.pool.acquire() as conn:
+            async with transaction(conn, dry_run):
+                await check_node_locks(conn, [id], lock_token)
+                row = await conn.fetchrow(query, id, expected_version)
+                if not row:
+                    await raise_update_failure(conn, "nodes", "node", id, expected_version)
+                deleted = self._row_to_node(row)
+                await record_revisions(conn, "deleted", [deleted], datetime.now())
+                await record_event(conn, "node.deleted", "node", deleted.id, {"node": deleted.to_dict()})
+
+    async def delete_many(
+        self,
+        node_type_id: Optional[str],
+        data_filter: Optional[str],
+        batch_size: int,
+        dry_run: bool = False,
+        on_batch: Optional[BatchHook] = None
+    ) -> int:
         """
+        Delete the nodes of a node type and/or whose data contains data_filter
+        (a JSON object, matched with @>), batch_size nodes per transaction.
+        Returns the number of nodes deleted, or with dry_run, that would be.
+        on_batch follows the progress and may stop the delete between batches.
+        Raises NodeLockedError if one of the nodes has an enforced lock; the
+        batches deleted before a lock is taken on one of them stay deleted.
+        """
+        where = "1=1"
+        args = []
+        if node_type_id:
+            args.append(node_type_id)
+            where += f" AND node_type_id = ${len(args)}"
+        if data_filter:
+            args.append(data_filter)
+            where += f" AND data @> ${len(args)}::jsonb"
 
+        locked_query = f"""
+            SELECT nodes.id FROM nodes JOIN node_locks ON node_locks.node_id = nodes.id
+            WHERE {where} AND node_locks.enforced AND node_locks.expires_at > NOW()
+            LIMIT 1
+        """
+        # Short transactions keep locks and outbox batches small while deleting
+        # many nodes
+        select_query = f"SELECT id FROM nodes WHERE {where} LIMIT ${len(args) + 1} FOR UPDATE"
+        delete_query = """
+            DELETE FROM nodes
+            WHERE id = ANY($1::uuid[])
+            RETURNING id, node_type_id, data::text, created_at, updated_at, version, schema_version
+        """
+
+        count = 0
+        async with self.db.pool.acquire() as conn:
+            # Fail before deleting anything if a node was locked beforehand; each
+            # batch checks the locks of its nodes again in its transaction
+            locked = await conn.fetchval(locked_query, *args)
+            if locked:
+                await check_node_locks(conn, [str(locked)])
+            if dry_run:
+                return await conn.fetchval(f"SELECT COUNT(*) FROM nodes WHERE {where}", *args)
+            if on_batch:
+                total = await conn.fetchval(f"SELECT COUNT(*) FROM nodes WHERE {where}", *args)
+                if not await on_batch(0, total):
+                    return 0
+            while True:
+                async with conn.transaction():
+                    ids = [str(row[0]) for row in await conn.fetch(select_query, *args, batch_size)]
+                    await check_node_locks(conn, ids)
+                    rows = await conn.fetch(delete_query, ids)
+                    deleted = [self._row_to_node(row) for row in rows]
+                    if deleted:
+                        await record_revisions(conn, "deleted", deleted, datetime.now())
+                    for node in deleted:
+                        await record_event(conn, "node.deleted", "node", node.id, {"node": node.to_dict()})
+                count += len(deleted)
+                if len(deleted) < batch_size:
+                    if on_batch:
+                        await on_batch(count, max(total, count))
+                    return count
+                if on_batch and not await on_batch(count, max(total, count)):
+                    return count
+
+    async def count_expired(self, policy: RetentionPolicy) -> int:
+        """Count the nodes a retention policy expired."""
+        where = _expired_clause(policy)
         async with self.db.pool.acquire() as conn:
-            row = await conn.fetchrow(
-                query,
-                node.id, node.data, node.updated_at
+            return await conn.fetchval(
+                f"SELECT COUNT(*) FROM nodes WHERE {where}", policy.node_type_id, policy.ttl_seconds
             )
 
+    async def delete_expired(self, policy: RetentionPolicy, batch_size: int) -> int:
+        """
+        Delete up to batch_size nodes a retention policy expired, in one
+        transaction, and return how many were. Their relationships go with
+        them. Deletes are recorded as usual, unless the policy purges: then
+        the revisions of the deleted nodes are removed as well.
+        """
+        query = f"""
+            DELETE FROM nodes
+            WHERE id IN (
+                SELECT id FROM nodes WHERE {_expired_clause(policy)}
+                LIMIT $3
+                FOR UPDATE SKIP LOCKED
+            )
+            RETURNING id, node_type_id, data::text, created_at, updated_at, version, schema_version
+        """
+
+        async with self.db.pool.acquire() as conn:
+            async with conn.transaction():
+                rows = await conn.fetch(query, policy.node_type_id, policy.ttl_seconds, batch_size)
+                deleted = [self._row_to_node(row) for row in rows]
+                if deleted and policy.action == "purge":
+                    await conn.execute(
+                        "DELETE FROM node_revisions WHERE node_id = ANY($1::uuid[])", [node.id for node in deleted]
+                    )
+                elif deleted:
+                    await record_revisions(conn, "deleted", deleted, datetime.now())
+                for node in deleted:
+                    await record_event(conn, "node.deleted", "node", node.id, {"node": node.to_dict()})
+        return len(deleted)
+
+    async def list_revisions(self, id: str, opts: ListOptions) -> Tuple[List[NodeRevision], ListResult]:
+        """Retrieve the revisions of a node, including a deleted node, newest first."""
+        page_size = max(1, min(opts.page_size or 10, self.max_page_size))
+        offset = 0
+        if opts.page_token:
+            try:
+                offset = int(opts.page_token)
+            except ValueError:
+                offset = 0
+
+        async with self.db.pool.acquire() as conn:
+            total_count = await conn.fetchval("SELECT COUNT(*) FROM node_revisions WHERE node_id = $1", id)
+            if not total_count:
+                raise NotFoundError(f"node not found: {id}")
+
+            query = f"""
+                SELECT {_REVISION_COLUMNS}
+                FROM node_revisions
+                WHERE node_id = $1
+                ORDER BY revised_at DESC, id DESC
+                LIMIT $2 OFFSET $3
+            """
+            rows = await conn.fetch(query, id, page_size, offset)
+
+        revisions = [self._row_to_revision(row) for row in rows]
+
+        result = ListResult(total_count=total_count)
+        next_offset = offset + len(revisions)
+        if next_offset < total_count:
+            result.next_page_token = str(next_offset)
+
+        return revisions, result
+
+    async def get_revision(self, id: str, revision_id: int) -> NodeRevision:
+        """Retrieve a revision of a node."""
+        query = f"""
+            SELECT {_REVISION_COLUMNS}
+            FROM node_revisions
+            WHERE node_id = $1 AND id = $2
+        """
+
+        async with self.db.pool.acquire() as conn:
+            row = await conn.fetchrow(query, id, revision_id)
+
         if not row:
-            raise NotFoundError(f"node not found: {node.id}")
+            raise NotFoundError(f"node revision not found: {revision_id}")
 
-        return self._row_to_node(row)
+        return self._row_to_revision(row)
 
-    async def delete(self, id: str) -> None:
-        """Delete a node by ID."""
-        query = "DELETE FROM nodes WHERE id = $1"
+    async def get_at(self, id: str, at: datetime) -> Node:
+        """Retrieve a node as it was at the given time."""
+        query = f"""
+            SELECT {_REVISION_COLUMNS}
+            FROM node_revisions
+            WHERE node_id = $1 AND revised_at <= $2
+            ORDER BY revised_at DESC, id DESC
+            LIMIT 1
+        """
 
         async with self.db.pool.acquire() as conn:
-            result = await conn.execute(query, id)
+            row = await conn.fetchrow(query, id, at)
 
-        if result == "DELETE 0":
-            raise NotFoundError(f"node not found: {id}")
+        if not row or row["op"] == "deleted":
+            raise NotFoundError(f"node not found at {at.isoformat()}: {id}")
+
+        return self._row_to_revision(row).to_node()
+
+    async def list(
+        self,
+        node_type_id: Optional[str],
+        opts: ListOptions,
+        geo: Optional[GeoFilter] = None,
+        sort: Optional[SortOrder] = None,
+        data_filter: Optional[DataFilter] = None,
+        data_fields: Optional[List[str]] = None
+    ) -> Tuple[List[Node], ListResult]:
+        """
+        Retrieve nodes with pagination and optional filtering, with only the
+        given top-level data fields if data_fields isn't None.
+
+        Distance ordering from a geo filter takes precedence over sort; the
+        default order is newest first.
+        """
+        page_size = max(1, min(opts.page_size or 10, self.max_page_size))
+        offset = 0
+        if opts.page_token:
+            try:
+                offset = int(opts.page_token)
+            except ValueError:
+                offset = 0
+
+        # Build dynamic query with filters
+        where, args = self._filter_clauses(node_type_id, data_filter)
+        arg_idx = len(args) + 1
+
+        order_by = "created_at DESC"
+
+        if geo:
+            has_postgis = await self.db.has_extension("postgis")
+            geo_where, geo_order, geo_args = self._geo_clauses(geo, has_postgis, arg_idx)
+            where += geo_where
+            args.extend(geo_args)
+            arg_idx += len(geo_args)
+            if geo_order:
+                order_by = f"{geo_order} ASC, created_at DESC"
+
+        list_args = list(args)
+        if sort and not (geo and geo.order_by_distance):
+            order_by = _sort_clause(sort)
 
-    async def list(self, node_type_id: Optional[str], opts: ListOptions) -> Tuple[List[Node], ListResult]:
-        """Retrieve nodes with pagination and optional filtering."""
-        page_size = max(1, min(opts.page_size or 10, 100))
+        count_query = "SELECT COUNT(*) FROM nodes" + where
+        data_column = _data_column(data_fields, list_args)
+        list_query = f"""
+            SELECT id, node_type_id, {data_column}, created_at, updated_at, version, schema_version
+            FROM nodes{where}
+            ORDER BY {order_by} 
+            LIMIT ${len(list_args) + 1} OFFSET ${len(list_args) + 2}
+        """
+        list_args += [page_size, offset]
+
+        async with self.db.read_pool.acquire() as conn:
+            total_count = await conn.fetchval(count_query, *args)
+            rows = await conn.fetch(list_query, *list_args)
+
+        nodes = [self._row_to_node(row) for row in rows]
+
+        result = ListResult(total_count=total_count)
+        next_offset = offset + len(nodes)
+        if next_offset < total_count:
+            result.next_page_token = str(next_offset)
+
+        return nodes, result
+
+    async def list_at(
+        self,
+        node_type_id: Optional[str],
+        at: datetime,
+        opts: ListOptions,
+        sort: Optional[SortOrder] = None,
+        data_filter: Optional[DataFilter] = None,
+        data_fields: Optional[List[str]] = None
+    ) -> Tuple[List[Node], ListResult]:
+        """
+        Retrieve nodes as they were at the given time, filtered, ordered and
+        paginated like list: each node as of its last revision at or before
+        then, leaving out nodes deleted by then. Purged nodes are gone.
+        """
+        page_size = max(1, min(opts.page_size or 10, self.max_page_size))
         offset = 0
         if opts.page_token:
             try:
@@ -105,32 +486,40 @@ class NodeRepository:
             except ValueError:
                 offset = 0
 
+        where, args = self._filter_clauses(node_type_id, data_filter)
+        args.append(at)
+        # The node type of a node never changes, so its revisions can be selected by it too
+        revision_where = f"revised_at <= ${len(args)}"
+        if node_type_id:
+            revision_where += " AND node_type_id = $1"
+        snapshot = f"""
+            WITH snapshot AS (
+                SELECT DISTINCT ON (node_id)
+                    node_id AS id, node_type_id, data, node_created_at AS created_at,
+                    revised_at AS updated_at, version, schema_version, op
+                FROM node_revisions
+                WHERE {revision_where}
+                ORDER BY node_id, revised_at DESC, id DESC
+            )
+        """
+        where += " AND op <> 'deleted'"
+        order_by = _sort_clause(sort) if sort else "created_at DESC"
+
+        list_args = list(args)
+        data_column = _data_column(data_fields, list_args)
+        list_query = f"""
+            {snapshot}
+            SELECT id, node_type_id, {data_column}, created_at, updated_at, version, schema_version
+            FROM snapshot{where}
+            ORDER BY {order_by}
+            LIMIT ${len(list_args) + 1} OFFSET ${len(list_args) + 2}
+        """
+        list_args += [page_size, offset]
+
         async with self.db.pool.acquire() as conn:
-            # Build count query
-            if node_type_id:
-                total_count = await conn.fetchval(
-                    "SELECT COUNT(*) FROM nodes WHERE node_type_id = $1",
-                    node_type_id
-                )
-                query = """
-                    SELECT id, node_type_id, data::text, created_at, updated_at 
-                    FROM nodes 
-                    WHERE node_type_id = $1
-                    ORDER BY created_at DESC 
-                    LIMIT $2 OFFSET $3
-                """
-                rows = await conn.fetch(query, node_type_id, page_size, offset)
-            else:
-                total_count = await conn.fetchval(
-                    "SELECT COUNT(*) FROM nodes"
-                )
-                query = """
-                    SELECT id, node_type_id, data::text, created_at, updated_at 
-                    FROM nodes 
-                    ORDER BY created_at DESC 
-                    LIMIT $1 OFFSET $2
-                """
-                rows = await conn.fetch(query, page_size, offset)
+            async with conn.transaction(isolation="repeatable_read", readonly=True):
+                total_count = await conn.fetchval(f"{snapshot} SELECT COUNT(*) FROM snapshot{where}", *args)
+                rows = await conn.fetch(list_query, *list_args)
 
         nodes = [self._row_to_node(row) for row in rows]
 
@@ -141,6 +530,277 @@ class NodeRepository:
 
         return nodes, result
 
+    async def stream(self, node_type_id: Optional[str], batch_size: int) -> AsyncIterator[Node]:
+        """
+        Stream all nodes, newest first, through a server-side cursor.
+
+        Rows are fetched batch_size at a time inside a read-only repeatable-read
+        transaction, so memory use is bounded and the result is a consistent
+        snapshot. The connection is held until the iterator is exhausted or closed.
+        """
+        where = ""
+        args = []
+        if node_type_id:
+            where = " WHERE node_type_id = $1"
+            args.append(node_type_id)
+
+        query = f"""
+            SELECT id, node_type_id, data::text, created_at, updated_at, version, schema_version
+            FROM nodes{where}
+            ORDER BY created_at DESC, id
+        """
+
+        async with self.db.pool.acquire() as conn:
+            async with conn.transaction(isolation="repeatable_read", readonly=True):
+                async for row in conn.cursor(query, *args, prefetch=batch_size):
+                    yield self._row_to_node(row)
+
+    async def list_outdated(
+        self,
+        node_type_id: str,
+        schema_version: int,
+        after_id: str,
+        limit: int
+    ) -> List[Node]:
+        """Retrieve up to limit nodes of a node type below schema_version, in ID order after after_id."""
+        query = """
+            SELECT id, node_type_id, data::text, created_at, updated_at, version, schema_version
+            FROM nodes
+            WHERE node_type_id = $1 AND schema_version < $2 AND ($3::uuid IS NULL OR id > $3::uuid)
+            ORDER BY id
+            LIMIT $4
+        """
+
+        async with self.db.pool.acquire() as conn:
+            rows = await conn.fetch(query, node_type_id, schema_version, after_id or None, limit)
+
+        return [self._row_to_node(row) for row in rows]
+
+    async def count(self, node_type_id: Optional[str], data_filter: Optional[DataFilter] = None) -> int:
+        """Count the nodes, optionally of a node type and matching a data filter."""
+        where, args = self._filter_clauses(node_type_id, data_filter)
+
+        async with self.db.read_pool.acquire() as conn:
+            return await conn.fetchval(f"SELECT COUNT(*) FROM nodes{where}", *args)
+
+    def _filter_clauses(self, node_type_id: Optional[str], data_filter: Optional[DataFilter]) -> Tuple[str, list]:
+        """Return the WHERE clause selecting nodes of a node type and matching a data filter, and its arguments."""
+        where = " WHERE 1=1"
+        args: list = []
+        if node_type_id:
+            args.append(node_type_id)
+            where += " AND node_type_id = $1"
+        if data_filter:
+            # Spelled like the expressions of node type indexes, so they can serve it
+            filter_where, filter_args = data_filter_clause(data_filter, len(args) + 1)
+            where += filter_where
+            args.extend(filter_args)
+        return where, args
+
+    async def aggregate(
+        self, node_type_id: Optional[str], agg: Aggregation, data_filter: Optional[DataFilter] = None
+    ) -> List[AggregationBucket]:
+        """Compute a bucketed aggregation over node data in SQL."""
+        where, args = self._filter_clauses(node_type_id, data_filter)
+        arg_idx = len(args) + 1
+
+        # Bucketing value
+        exact = agg.field_type == "decimal"
+        bound_type = "numeric" if exact else "float8"
+        value_expr = "NULL"
+        if agg.kind != "all":
+            field = f"${arg_idx}::text"
+            args.append(agg.field)
+            arg_idx += 1
+            if agg.kind == "date_histogram":
+                value_expr = _timestamp_expr(field)
+            elif agg.kind == "terms":
+                value_expr = _scalar_text_expr(field)
+            elif exact:
+                value_expr = _decimal_expr(field)
+            else:
+                value_expr = _number_expr(field)
+
+        def bound(value: Optional[float]):
+            # Decimal bounds compare exactly against numeric values
+            if value is None or not exact:
+                return value
+            return Decimal(str(value))
+
+        # Optional metric value
+        metric_expr = "NULL::float8"
+        metric_fn = "MAX"
+        if agg.metric:
+            metric_field = f"${arg_idx}::text"
+            args.append(agg.metric_field)
+            arg_idx += 1
+            if agg.metric_field_type == "decimal":
+                metric_expr = _decimal_expr(metric_field)
+            else:
+                metric_expr = _number_expr(metric_field)
+            metric_fn = agg.metric.upper()
+
+        source = f"SELECT {value_expr} AS v, {metric_expr} AS m FROM nodes{where}"
+
+        if agg.kind == "range":
+            query = f"""
+                SELECT b.key, b.lo, b.hi, COUNT(n.v) AS doc_count, {metric_fn}(n.m) AS value
+                FROM unnest(${arg_idx}::text[], ${arg_idx + 1}::{bound_type}[], ${arg_idx + 2}::{bound_type}[])
+                    WITH ORDINALITY AS b(key, lo, hi, ord)
+                LEFT JOIN ({source}) n
+                    ON n.v IS NOT NULL
+                    AND (b.lo IS NULL OR n.v >= b.lo)
+                    AND (b.hi IS NULL OR n.v < b.hi)
+                GROUP BY b.ord, b.key, b.lo, b.hi
+                ORDER BY b.ord
+            """
+            args.extend([
+                [r.key for r in agg.ranges],
+                [bound(r.from_value) for r in agg.ranges],
+                [bound(r.to_value) for r in agg.ranges],
+            ])
+        elif agg.kind == "histogram":
+            lo, hi = f"${arg_idx}::{bound_type}", f"${arg_idx + 1}::{bound_type}"
+            count = f"${arg_idx + 2}::int"
+            query = f"""
+                SELECT width_bucket(n.v, {lo}, {hi}, {count}) AS bucket,
+                       COUNT(*) AS doc_count, {metric_fn}(n.m) AS value
+                FROM ({source}) n
+                WHERE n.v >= {lo} AND n.v < {hi}
+                GROUP BY bucket
+                ORDER BY bucket
+            """
+            args.extend([bound(agg.min_value), bound(agg.max_value), agg.buckets])
+        elif agg.kind == "date_histogram":
+            query = f"""
+                SELECT date_trunc(${arg_idx}::text, n.v, ${arg_idx + 1}::text) AS bucket,
+                       COUNT(*) AS doc_count, {metric_fn}(n.m) AS value
+                FROM ({source}) n
+                WHERE n.v IS NOT NULL
+                GROUP BY bucket
+                ORDER BY bucket
+            """
+            args.extend([agg.interval, agg.time_zone])
+        elif agg.kind == "terms":
+            query = f"""
+                SELECT n.v AS key, COUNT(*) AS doc_count, {metric_fn}(n.m) AS value
+                FROM ({source}) n
+                WHERE n.v IS NOT NULL
+                GROUP BY n.v
+                ORDER BY doc_count DESC, n.v
+                LIMIT ${arg_idx}::int
+            """
+            args.append(agg.size)
+        elif agg.kind == "all":
+            query = f"SELECT COUNT(*) AS doc_count, {metric_fn}(n.m) AS value FROM ({source}) n"
+        else:
+            raise ValueError(f"unsupported aggregation kind: {agg.kind}")
+
+        async with self.db.read_pool.acquire() as conn:
+            rows = await conn.fetch(query, *args)
+
+        buckets = []
+        for row in rows:
+            value = row["value"]
+            if value is not None and not isinstance(value, Decimal):
+                value = float(value)
+            if agg.kind == "range":
+                bucket = AggregationBucket(
+                    key=row["key"],
+                    from_value=row["lo"],
+                    to_value=row["hi"],
+                    doc_count=row["doc_count"],
+                    value=value,
+                )
+            elif agg.kind == "histogram":
+                min_value, max_value = bound(agg.min_value), bound(agg.max_value)
+                width = (max_value - min_value) / agg.buckets
+                lower = min_value + (row["bucket"] - 1) * width
+                bucket = AggregationBucket(
+                    key=str(lower),
+                    from_value=lower,
+                    to_value=lower + width,
+                    doc_count=row["doc_count"],
+                    value=value,
+                )
+            elif agg.kind == "date_histogram":
+                bucket = AggregationBucket(
+                    key=row["bucket"].isoformat(),
+                    doc_count=row["doc_count"],
+                    value=value,
+                )
+            else:
+                bucket = AggregationBucket(
+                    key=row["key"] if agg.kind == "terms" else "all",
+                    doc_count=row["doc_count"],
+                    value=value,
+                )
+            buckets.append(bucket)
+
+        return buckets
+
+    def _geo_clauses(self, geo: GeoFilter, has_postgis: bool, arg_idx: int) -> Tuple[str, str, list]:
+        """
+        Build WHERE and ORDER BY fragments for a geospatial filter.
+
+        geo_point fields are stored as {"lat": .., "lng": ..} and can be queried
+        with or without PostGIS. geo_shape fields are GeoJSON geometries and
+        require PostGIS.
+        """
+        if geo.field_type == "geo_shape" and not has_postgis:
+            raise ValueError("geo_shape queries require the PostGIS extension")
+
+        args = [geo.field]
+        field = f"${arg_idx}::text"
+        arg_idx += 1
+        where = f" AND data ? {field}"
+
+        lat = f"(data -> {field} ->> 'lat')::float8"
+        lng = f"(data -> {field} ->> 'lng')::float8"
+
+        if has_postgis:
+            if geo.field_type == "geo_shape":
+                geometry = f"ST_SetSRID(ST_GeomFromGeoJSON(data ->> {field}), 4326)"
+            else:
+                geometry = f"ST_SetSRID(ST_MakePoint({lng}, {lat}), 4326)"
+
+        distance = ""
+        if geo.has_radius():
+            ref_lat, ref_lng = f"${arg_idx}::float8", f"${arg_idx + 1}::float8"
+            radius = f"${arg_idx + 2}::float8"
+            args.extend([geo.near_lat, geo.near_lng, geo.radius_m])
+            arg_idx += 3
+            if has_postgis:
+                ref = f"ST_SetSRID(ST_MakePoint({ref_lng}, {ref_lat}), 4326)::geography"
+                distance = f"ST_Distance({geometry}::geography, {ref})"
+                where += f" AND ST_DWithin({geometry}::geography, {ref}, {radius})"
+            else:
+                # Haversine great-circle distance in meters
+                distance = (
+                    f"(12742017.6 * asin(sqrt(least(1.0, "
+                    f"power(sin(radians({lat} - {ref_lat}) / 2), 2) + "
+                    f"cos(radians({ref_lat})) * cos(radians({lat})) * "
+                    f"power(sin(radians({lng} - {ref_lng}) / 2), 2)))))"
+                )
+                where += f" AND {distance} <= {radius}"
+
+        if geo.has_bbox():
+            min_lat, min_lng = f"${arg_idx}::float8", f"${arg_idx + 1}::float8"
+            max_lat, max_lng = f"${arg_idx + 2}::float8", f"${arg_idx + 3}::float8"
+            args.extend([geo.min_lat, geo.min_lng, geo.max_lat, geo.max_lng])
+            arg_idx += 4
+            if has_postgis:
+                envelope = f"ST_MakeEnvelope({min_lng}, {min_lat}, {max_lng}, {max_lat}, 4326)"
+                where += f" AND ST_Intersects({geometry}, {envelope})"
+            else:
+                where += (
+                    f" AND {lat} BETWEEN {min_lat} AND {max_lat}"
+                    f" AND {lng} BETWEEN {min_lng} AND {max_lng}"
+                )
+
+        order = distance if geo.order_by_distance and distance else ""
+        return where, order, args
+
     def _row_to_node(self, row: asyncpg.Record) -> Node:
         """Convert a database row to a Node object."""
         return Node(
@@ -150,4 +810,90 @@ class NodeRepository:
             data=row[2] or "{}",
             created_at=row[3],
             updated_at=row[4],
+            version=row[5],
+            schema_version=row[6],
+        )
+
+    def _row_to_revision(self, row: asyncpg.Record) -> NodeRevision:
+        """Convert a database row to a NodeRevision object."""
+        return NodeRevision(
+            id=str(row["id"]),
+            node_id=str(row["node_id"]),
+            node_type_id=str(row["node_type_id"]),
+            version=row["version"],
+            op=row["op"],
+            data=row["data"] or "{}",
+            schema_version=row["schema_version"],
+            node_created_at=row["node_created_at"],
+            revised_at=row["revised_at"],
+            actor=row["actor"],
         )
+
+
+def _expired_clause(policy: RetentionPolicy) -> str:
+    """
+    SQL condition of the nodes a retention policy expired, with the node type
+    ID as $1 and the TTL in seconds as $2. Nodes whose data field is missing
+    or not a timestamp never expire.
+    """
+    if policy.timestamp_field.startswith("data."):
+        value = path_expression(policy.timestamp_field[len("data."):].split("."))
+        expires = (
+            f"CASE WHEN jsonb_typeof({value}) = 'string' AND {value} #>> '{{}}' ~ '^\\d{{4}}-\\d{{2}}-\\d{{2}}' "
+            f"THEN ({value} #>> '{{}}')::timestamptz END"
+        )
+    else:
+        expires = policy.timestamp_field
+    return f"node_type_id = $1 AND {expires} < NOW() - make_interval(secs => $2)"
+
+
+def _number_expr(field: str) -> str:
+    """SQL expression reading a numeric data field, NULL if missing or not a number."""
+    return f"CASE WHEN jsonb_typeof(data -> {field}) = 'number' THEN (data ->> {field})::float8 END"
+
+
+def _scalar_text_expr(field: str) -> str:
+    """SQL expression reading a string, number or boolean data field as text, NULL otherwise."""
+    return f"CASE WHEN jsonb_typeof(data -> {field}) IN ('string', 'number', 'boolean') THEN data ->> {field} END"
+
+
+def _sort_clause(sort: SortOrder) -> str:
+    """ORDER BY clause of a sort by a node column or data path."""
+    direction = "DESC" if sort.descending else "ASC"
+    if sort.field in NODE_SORT_COLUMNS:
+        return f"{sort.field} {direction}, id"
+    # Spelled like node type indexes, so a btree index on the path serves it
+    return f"{path_expression(sort.field.split('.'))} {direction} NULLS LAST, created_at DESC, id"
+
+
+def _data_column(data_fields: Optional[List[str]], args: List[Any]) -> str:
+    """
+    SQL expression selecting node data as text: all of it, or with
+    data_fields only the top-level fields listed, appended to args.
+    """
+    if data_fields is None:
+        return "data::text"
+    args.append(data_fields)
+    return (
+        f"COALESCE((SELECT jsonb_object_agg(key, value) FROM jsonb_each(data) WHERE key = ANY(${len(args)}::text[])), "
+        "'{}')::text"
+    )
+
+
+def _decimal_expr(field: str) -> str:
+    """SQL expression reading a decimal data field (canonical string or number) as numeric."""
+    return (
+        f"CASE WHEN jsonb_typeof(data -> {field}) = 'number' THEN (data ->> {field})::numeric "
+        f"WHEN jsonb_typeof(data -> {field}) = 'string' "
+        f"AND data ->> {field} ~ '^[+-]?\\d+(\\.\\d+)?$' "
+        f"THEN (data ->> {field})::numeric END"
+    )
+
+
+def _timestamp_expr(field: str) -> str:
+    """SQL expression reading an ISO-8601 timestamp data field, NULL if missing or malformed."""
+    return (
+        f"CASE WHEN jsonb_typeof(data -> {field}) = 'string' "
+        f"AND data ->> {field} ~ '^\\d{{4}}-\\d{{2}}-\\d{{2}}' "
+        f"THEN flexdb_try_timestamptz(data ->> {field}) END"
+    )
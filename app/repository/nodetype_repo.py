@@ -2,25 +2,43 @@
 NodeType repository implementation.
 """
 
+import json
 import uuid
 from datetime import datetime
-from typing import List, Tuple
+from typing import List, Optional, Tuple
 
 import asyncpg
 
 from app.db.database import Database
-from app.repository.models import NodeType, ListOptions, ListResult
-from app.repository.errors import NotFoundError
+from app.repository.models import NodeType, NodeTypeIndex, ListOptions, ListResult, SortOrder, MAX_PAGE_SIZE
+from app.repository.actor import current_actor
+from app.repository.dry_run import transaction
+from app.repository.errors import AlreadyExistsError, NotFoundError
+from app.repository.ids import uuid_ids
+from app.repository.node_indexes import create_node_type_index, drop_node_type_index
+from app.repository.outbox_repo import record_event
+from app.repository.sorting import order_by_clause
+from app.repository.unique_keys import create_unique_indexes, drop_unique_indexes
+from app.repository.versioning import raise_update_failure
+
+# Node type columns listings can be sorted by
+NODE_TYPE_SORT_COLUMNS = ("created_at", "updated_at", "name")
+
+_NODE_TYPE_INDEX_COLUMNS = "id, node_type_id, name, method, paths::text, status, created_at"
 
 
 class NodeTypeRepository:
     """PostgreSQL node type repository."""
 
-    def __init__(self, db: Database):
+    def __init__(self, db: Database, max_page_size: int = MAX_PAGE_SIZE):
         self.db = db
+        self.max_page_size = max_page_size
 
-    async def create(self, node_type: NodeType) -> NodeType:
-        """Create a new node type."""
+    async def create(self, node_type: NodeType, dry_run: bool = False) -> NodeType:
+        """
+        Create a new node type, with the indexes enforcing its unique keys. A
+        dry run rolls it back (see dry_run.py).
+        """
         node_type.id = str(uuid.uuid4())
         node_type.created_at = datetime.now()
         node_type.updated_at = datetime.now()
@@ -31,30 +49,37 @@ class NodeTypeRepository:
             schema_value = node_type.schema
 
         query = """
-            INSERT INTO node_types (id, name, description, schema, created_at, updated_at)
-            VALUES ($1, $2, $3, $4::jsonb, $5, $6)
-            RETURNING id, name, description, COALESCE(schema::text, ''), created_at, updated_at
+            INSERT INTO node_types (id, name, description, schema, display, created_at, updated_at, unique_keys)
+            VALUES ($1, $2, $3, $4::jsonb, $5::jsonb, $6, $7, $8::jsonb)
+            RETURNING id, name, description, COALESCE(schema::text, ''), created_at, updated_at, version, display::text, schema_version, unique_keys::text
         """
 
         async with self.db.pool.acquire() as conn:
-            row = await conn.fetchrow(
-                query,
-                node_type.id, node_type.name, node_type.description,
-                schema_value,
-                node_type.created_at, node_type.updated_at
-            )
+            async with transaction(conn, dry_run):
+                row = await conn.fetchrow(
+                    query,
+                    node_type.id, node_type.name, node_type.description,
+                    schema_value, node_type.display or "{}",
+                    node_type.created_at, node_type.updated_at, json.dumps(node_type.unique_keys)
+                )
+                created = self._row_to_node_type(row)
+                await create_unique_indexes(conn, created.id, created.unique_keys)
+                await record_event(
+                    conn, "node_type.created", "node_type", created.id,
+                    {"node_type": created.to_dict()}
+                )
 
-        return self._row_to_node_type(row)
+        return created
 
     async def get_by_id(self, id: str) -> NodeType:
         """Retrieve a node type by ID."""
         query = """
-            SELECT id, name, description, COALESCE(schema::text, ''), created_at, updated_at 
+            SELECT id, name, description, COALESCE(schema::text, ''), created_at, updated_at, version, display::text, schema_version, unique_keys::text
             FROM node_types 
             WHERE id = $1
         """
 
-        async with self.db.pool.acquire() as conn:
+        async with self.db.read_pool.acquire() as conn:
             row = await conn.fetchrow(query, id)
 
         if not row:
@@ -62,8 +87,32 @@ class NodeTypeRepository:
 
         return self._row_to_node_type(row)
 
-    async def update(self, node_type: NodeType) -> NodeType:
-        """Update an existing node type."""
+    async def get_many(self, ids: List[str]) -> List[NodeType]:
+        """Retrieve the node types with the given IDs that exist, in no particular order."""
+        ids = uuid_ids(ids)
+        if not ids:
+            return []
+        query = """
+            SELECT id, name, description, COALESCE(schema::text, ''), created_at, updated_at, version, display::text, schema_version, unique_keys::text
+            FROM node_types
+            WHERE id = ANY($1::uuid[])
+        """
+
+        async with self.db.read_pool.acquire() as conn:
+            rows = await conn.fetch(query, ids)
+
+        return [self._row_to_node_type(row) for row in rows]
+
+    async def update(
+        self, node_type: NodeType, expected_version: Optional[int] = None, dry_run: bool = False
+    ) -> NodeType:
+        """
+        Update an existing node type.
+
+        schema_version is incremented when the schema changes. If expected_version is given, the update only applies when it matches
+        the stored version; otherwise ConflictError is raised. A dry run rolls
+        the update back.
+        """
         node_type.updated_at = datetime.now()
 
         # Preserve empty/falsy JSON schemas like '{}' or '[]'
@@ -73,37 +122,75 @@ class NodeTypeRepository:
 
         query = """
             UPDATE node_types 
-            SET name = $2, description = $3, schema = $4::jsonb, updated_at = $5
-            WHERE id = $1
-            RETURNING id, name, description, COALESCE(schema::text, ''), created_at, updated_at
+            SET name = $2, description = $3, schema = $4::jsonb, display = $5::jsonb, updated_at = $6,
+                version = version + 1,
+                schema_version = schema_version + CASE WHEN schema IS DISTINCT FROM $4::jsonb THEN 1 ELSE 0 END
+            WHERE id = $1 AND ($7::bigint IS NULL OR version = $7)
+            RETURNING id, name, description, COALESCE(schema::text, ''), created_at, updated_at, version, display::text, schema_version, unique_keys::text
         """
 
         async with self.db.pool.acquire() as conn:
-            row = await conn.fetchrow(
-                query,
-                node_type.id, node_type.name, node_type.description,
-                schema_value,
-                node_type.updated_at
-            )
+            async with transaction(conn, dry_run):
+                row = await conn.fetchrow(
+                    query,
+                    node_type.id, node_type.name, node_type.description,
+                    schema_value, node_type.display or "{}",
+                    node_type.updated_at, expected_version
+                )
+                if not row:
+                    await raise_update_failure(conn, "node_types", "node_type", node_type.id, expected_version)
+                updated = self._row_to_node_type(row)
+                await record_event(
+                    conn, "node_type.updated", "node_type", updated.id,
+                    {"node_type": updated.to_dict()}
+                )
 
-        if not row:
-            raise NotFoundError(f"node_type not found: {node_type.id}")
+        return updated
 
-        return self._row_to_node_type(row)
+    async def delete(self, id: str, expected_version: Optional[int] = None, dry_run: bool = False) -> None:
+        """
+        Delete a node type by ID.
 
-    async def delete(self, id: str) -> None:
-        """Delete a node type by ID."""
-        query = "DELETE FROM node_types WHERE id = $1"
+        If expected_version is given, the node type is only deleted while it is
+        at that version; otherwise ConflictError is raised. A dry run rolls the
+        delete back.
+        """
+        query = """
+            DELETE FROM node_types
+            WHERE id = $1 AND ($2::integer IS NULL OR version = $2)
+            RETURNING id, name, description, COALESCE(schema::text, ''), created_at, updated_at, version, display::text, schema_version, unique_keys::text
+        """
 
         async with self.db.pool.acquire() as conn:
-            result = await conn.execute(query, id)
-
-        if result == "DELETE 0":
-            raise NotFoundError(f"node_type not found: {id}")
+            async with transaction(conn, dry_run):
+                # The node type's nodes are deleted with it (ON DELETE CASCADE)
+                await conn.execute(
+                    """
+                    INSERT INTO node_revisions
+                        (node_id, node_type_id, version, op, data, schema_version, node_created_at, revised_at, actor)
+                    SELECT id, node_type_id, version, 'deleted', data, schema_version, created_at, $2, $3
+                    FROM nodes
+                    WHERE node_type_id = $1
+                    """,
+                    id, datetime.now(), current_actor()
+                )
+                # Its index declarations are deleted with it (ON DELETE CASCADE), not their indexes
+                index_ids = await conn.fetch("SELECT id FROM node_type_indexes WHERE node_type_id = $1", id)
+                row = await conn.fetchrow(query, id, expected_version)
+                if not row:
+                    await raise_update_failure(conn, "node_types", "node_type", id, expected_version)
+                deleted = self._row_to_node_type(row)
+                await drop_unique_indexes(conn, deleted.id, deleted.unique_keys)
+                for index_row in index_ids:
+                    await drop_node_type_index(conn, str(index_row["id"]), concurrently=False)
+                await record_event(
+                    conn, "node_type.deleted", "node_type", deleted.id,
+                    {"node_type": deleted.to_dict()}
+                )
 
-    async def list(self, opts: ListOptions) -> Tuple[List[NodeType], ListResult]:
-        """Retrieve node types with pagination."""
-        page_size = max(1, min(opts.page_size or 10, 100))
+    async def list(self, opts: ListOptions, sort: Optional[SortOrder] = None) -> Tuple[List[NodeType], ListResult]:
+        """Retrieve node types with pagination, newest first unless sorted otherwise."""
+        page_size = max(1, min(opts.page_size or 10, self.max_page_size))
         offset = 0
         if opts.page_token:
             try:
@@ -111,15 +198,15 @@ class NodeTypeRepository:
             except ValueError:
                 offset = 0
 
-        async with self.db.pool.acquire() as conn:
+        async with self.db.read_pool.acquire() as conn:
             total_count = await conn.fetchval(
                 "SELECT COUNT(*) FROM node_types"
             )
 
-            query = """
-                SELECT id, name, description, COALESCE(schema::text, ''), created_at, updated_at 
+            query = f"""
+                SELECT id, name, description, COALESCE(schema::text, ''), created_at, updated_at, version, display::text, schema_version, unique_keys::text
                 FROM node_types 
-                ORDER BY created_at DESC 
+                ORDER BY {order_by_clause(sort, NODE_TYPE_SORT_COLUMNS)} 
                 LIMIT $1 OFFSET $2
             """
             rows = await conn.fetch(query, page_size, offset)
@@ -133,6 +220,116 @@ class NodeTypeRepository:
 
         return node_types, result
 
+    async def list_all(self) -> List[NodeType]:
+        """Retrieve all node types ordered by name."""
+        query = """
+            SELECT id, name, description, COALESCE(schema::text, ''), created_at, updated_at, version, display::text, schema_version, unique_keys::text
+            FROM node_types
+            ORDER BY name, created_at
+        """
+
+        async with self.db.read_pool.acquire() as conn:
+            rows = await conn.fetch(query)
+
+        return [self._row_to_node_type(row) for row in rows]
+
+    async def catalog_generation(self) -> int:
+        """
+        Return the generation of the tenant's node types: the sequence of the
+        newest node type event in the change feed, or 0 if there is none. It
+        moves with every node type create, update and delete.
+        """
+        query = "SELECT COALESCE(MAX(id), 0) FROM outbox_events WHERE entity_type = 'node_type'"
+
+        async with self.db.pool.acquire() as conn:
+            return await conn.fetchval(query)
+
+    async def create_index(self, index: NodeTypeIndex) -> NodeTypeIndex:
+        """
+        Declare an index on data paths of a node type's nodes and build it
+        without blocking writes; returns it once ready. Raises
+        AlreadyExistsError if the node type has an index of the same name.
+        """
+        index.id = str(uuid.uuid4())
+        query = f"""
+            INSERT INTO node_type_indexes (id, node_type_id, name, method, paths, created_at)
+            VALUES ($1, $2, $3, $4, $5::jsonb, $6)
+            RETURNING {_NODE_TYPE_INDEX_COLUMNS}
+        """
+
+        async with self.db.pool.acquire() as conn:
+            try:
+                await conn.fetchrow(
+                    query,
+                    index.id, index.node_type_id, index.name, index.method,
+                    json.dumps(index.paths), index.created_at
+                )
+            except asyncpg.UniqueViolationError:
+                raise AlreadyExistsError(
+                    f"node_type {index.node_type_id} already has an index named {index.name}"
+                ) from None
+            except asyncpg.ForeignKeyViolationError:
+                raise NotFoundError(f"node_type not found: {index.node_type_id}") from None
+
+            # CREATE INDEX CONCURRENTLY can't run in a transaction, and leaves an
+            # invalid index behind when it fails
+            try:
+                await create_node_type_index(conn, index.id, index.node_type_id, index.method, index.paths)
+            except BaseException:
+                await drop_node_type_index(conn, index.id)
+                await conn.execute("DELETE FROM node_type_indexes WHERE id = $1", index.id)
+                raise
+            row = await conn.fetchrow(
+                f"UPDATE node_type_indexes SET status = 'ready' WHERE id = $1 RETURNING {_NODE_TYPE_INDEX_COLUMNS}",
+                index.id
+            )
+
+        return self._row_to_index(row)
+
+    async def list_indexes(self, node_type_id: str) -> List[NodeTypeIndex]:
+        """Retrieve the indexes of a node type ordered by name."""
+        query = f"""
+            SELECT {_NODE_TYPE_INDEX_COLUMNS}
+            FROM node_type_indexes
+            WHERE node_type_id = $1
+            ORDER BY name
+        """
+
+        async with self.db.pool.acquire() as conn:
+            rows = await conn.fetch(query, node_type_id)
+
+        return [self._row_to_index(row) for row in rows]
+
+    async def drop_index(self, node_type_id: str, name: str) -> NodeTypeIndex:
+        """Drop a node type's index by name, without blocking writes."""
+        query = f"""
+            SELECT {_NODE_TYPE_INDEX_COLUMNS}
+            FROM node_type_indexes
+            WHERE node_type_id = $1 AND name = $2
+        """
+
+        async with self.db.pool.acquire() as conn:
+            row = await conn.fetchrow(query, node_type_id, name)
+            if not row:
+                raise NotFoundError(f"node_type_index not found: {name}")
+            index = self._row_to_index(row)
+            await drop_node_type_index(conn, index.id)
+            await conn.execute("DELETE FROM node_type_indexes WHERE id = $1", index.id)
+
+        return index
+
+    def _row_to_index(self, row: asyncpg.Record) -> NodeTypeIndex:
+        """Convert a database row to a NodeTypeIndex object."""
+        return NodeTypeIndex(
+            id=str(row["id"]),
+            node_type_id=str(row["node_type_id"]),
+            name=row["name"],
+            method=row["method"],
+            paths=json.loads(row["paths"]),
+            status=row["status"],
+            created_at=row["created_at"],
+        )
+
     def _row_to_node_type(self, row: asyncpg.Record) -> NodeType:
         """Convert a database row to a NodeType object."""
         return NodeType(
@@ -143,4 +340,8 @@ class NodeTypeRepository:
             schema=row[3] or "",
             created_at=row[4],
             updated_at=row[5],
+            version=row[6],
+            display=row[7] or "{}",
+            schema_version=row[8],
+            unique_keys=json.loads(row[9] or "[]"),
         )
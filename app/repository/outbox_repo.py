@@ -0,0 +1,294 @@
+"""
+Outbox repository implementation.
+
+Mutating repository methods call record_event() on the connection they are
+already using, inside the same transaction as the change, so an event is
+written if and only if the change commits.
+
+Every event also records the ID of the transaction that wrote it. The change
+feed (list_changes) is read between two snapshots: a page holds the events
+visible in the newer one but not in the older one, so an event is listed once
+its transaction committed, whatever order the sequence was handed out in.
+Change tokens are "<from snapshot>", or "<from snapshot>/<to snapshot>/<last
+sequence>" while a window between two snapshots is read in pages; an empty
+from snapshot means from the first event.
+"""
+
+import json
+import re
+import uuid
+from typing import Any, Awaitable, Callable, Dict, List, Optional, Tuple
+
+import asyncpg
+
+from app.db.database import Database
+from app.repository.models import ChangeFeedPosition, ChangePage, OutboxEvent
+
+_SNAPSHOT = re.compile(r"^\d+:\d+:[\d,]*$")
+
+
+def event_schema_version(event_type: str) -> int:
+    """Return the version of the event schema new events of a type are written with."""
+    # Imported here: app.events imports the repositories
+    from app.events.schemas import event_schema_version
+    return event_schema_version(event_type)
+
+
+async def record_event(
+    conn: asyncpg.Connection,
+    event_type: str,
+    entity_type: str,
+    entity_id: str,
+    payload: Dict[str, Any]
+) -> None:
+    """Write a change event to the outbox using the caller's connection/transaction."""
+    await conn.execute(
+        """
+        INSERT INTO outbox_events (event_id, event_type, entity_type, entity_id, payload, schema_version)
+        VALUES ($1, $2, $3, $4, $5::jsonb, $6)
+        """,
+        str(uuid.uuid4()), event_type, entity_type, entity_id, json.dumps(payload),
+        event_schema_version(event_type)
+    )
+
+
+async def change_feed_position(conn: asyncpg.Connection) -> ChangeFeedPosition:
+    """
+    Return the change feed position of the caller's snapshot. Called first in
+    a repeatable-read transaction, it is the snapshot the transaction reads.
+    """
+    row = await conn.fetchrow("SELECT pg_current_wal_lsn()::text, pg_current_snapshot()::text")
+    return ChangeFeedPosition(token=row[1], lsn=row[0], snapshot=row[1])
+
+
+def _parse_change_token(token: str) -> Tuple[Optional[str], Optional[str], int]:
+    """Split a change token into its from snapshot, to snapshot and last sequence."""
+    parts = token.split("/") if token else [""]
+    try:
+        if len(parts) == 1:
+            from_snapshot, to_snapshot, last = parts[0], "", 0
+        elif len(parts) == 3:
+            from_snapshot, to_snapshot, last = parts[0], parts[1], int(parts[2])
+            if not _SNAPSHOT.match(to_snapshot):
+                raise ValueError
+        else:
+            raise ValueError
+        if from_snapshot and not _SNAPSHOT.match(from_snapshot):
+            raise ValueError
+    except ValueError:
+        raise ValueError(f"invalid change token: {token}") from None
+    return from_snapshot or None, to_snapshot or None, last
+
+
+def _event_node_type_id(event_type: str, payload: Dict[str, Any]) -> Optional[str]:
+    """Return the node type an event concerns, or None for relationship events."""
+    if event_type.startswith("node_type."):
+        return (payload.get("node_type") or {}).get("id")
+    if event_type.startswith("node."):
+        return (payload.get("node") or {}).get("node_type_id")
+    return None
+
+
+def _matches(target: asyncpg.Record, event_type: str, node_type_id: Optional[str]) -> bool:
+    """Return whether a webhook endpoint or subscription takes an event, by its filters."""
+    event_types = target["event_types"] or []
+    if event_types and event_type not in event_types:
+        return False
+    node_type_ids = target["node_type_ids"] or []
+    return not node_type_ids or node_type_id in node_type_ids
+
+
+class OutboxRepository:
+    """PostgreSQL outbox repository."""
+
+    def __init__(self, db: Database):
+        self.db = db
+
+    async def record(self, event_type: str, entity_type: str, entity_id: str, payload: Dict[str, Any]) -> None:
+        """Write an event that is not part of a change, such as a notification."""
+        async with self.db.pool.acquire() as conn:
+            await record_event(conn, event_type, entity_type, entity_id, payload)
+
+    async def list_pending(self, limit: int) -> List[OutboxEvent]:
+        """Retrieve events that have not been dispatched yet, oldest first."""
+        query = """
+            SELECT id, event_id, event_type, entity_type, entity_id, payload::text, created_at, schema_version
+            FROM outbox_events
+            WHERE dispatched_at IS NULL
+            ORDER BY id
+            LIMIT $1
+        """
+
+        async with self.db.pool.acquire() as conn:
+            rows = await conn.fetch(query, limit)
+
+        return [self._row_to_event(row) for row in rows]
+
+    async def latest_sequence(self) -> int:
+        """Return the ID of the newest outbox event, or 0 if there is none."""
+        async with self.db.pool.acquire() as conn:
+            return await conn.fetchval("SELECT COALESCE(MAX(id), 0) FROM outbox_events")
+
+    async def current_change_token(self) -> str:
+        """Return the change token of now: list_changes from it lists the changes committed from now on."""
+        async with self.db.pool.acquire() as conn:
+            return await conn.fetchval("SELECT pg_current_snapshot()::text")
+
+    async def list_changes(self, after: str, limit: int) -> ChangePage:
+        """
+        Retrieve up to limit events committed after the change token, in sequence order.
+
+        Raises ValueError if the token is not one returned by an export or list_changes.
+        """
+        from_snapshot, to_snapshot, last = _parse_change_token(after)
+        query = """
+            SELECT id, event_id, event_type, entity_type, entity_id, payload::text, created_at, schema_version
+            FROM outbox_events
+            WHERE ($1::text IS NULL
+                   OR (xid >= pg_snapshot_xmin($1::text::pg_snapshot)
+                       AND NOT pg_visible_in_snapshot(xid, $1::text::pg_snapshot)))
+              AND pg_visible_in_snapshot(xid, $2::text::pg_snapshot)
+              AND id > $3
+            ORDER BY id
+            LIMIT $4
+        """
+
+        async with self.db.pool.acquire() as conn:
+            async with conn.transaction(isolation="repeatable_read", readonly=True):
+                if to_snapshot is None:
+                    to_snapshot = await conn.fetchval("SELECT pg_current_snapshot()::text")
+                try:
+                    rows = await conn.fetch(query, from_snapshot, to_snapshot, last, limit + 1)
+                except asyncpg.DataError:
+                    raise ValueError(f"invalid change token: {after}") from None
+
+        events = [self._row_to_event(row) for row in rows[:limit]]
+        if len(rows) > limit:
+            return ChangePage(events, f"{from_snapshot or ''}/{to_snapshot}/{events[-1].id}", caught_up=False)
+        return ChangePage(events, to_snapshot)
+
+    async def fan_out_to_webhooks(self, limit: int) -> int:
+        """
+        Turn pending outbox events into webhook deliveries and subscription messages.
+
+        In one transaction: lock a batch of undispatched events, create a
+        delivery for every active endpoint subscribed to each event, queue each
+        event for every active pull subscription matching it, and mark the
+        events dispatched. Returns the number of events processed.
+        """
+        async with self.db.pool.acquire() as conn:
+            async with conn.transaction():
+                events = await conn.fetch(
+                    """
+                    SELECT id, event_id, event_type, payload::text, schema_version
+                    FROM outbox_events
+                    WHERE dispatched_at IS NULL
+                    ORDER BY id
+                    LIMIT $1
+                    FOR UPDATE SKIP LOCKED
+                    """,
+                    limit
+                )
+                if not events:
+                    return 0
+
+                endpoints = await conn.fetch(
+                    "SELECT id, event_types, node_type_ids FROM webhook_endpoints WHERE status = 'active'"
+                )
+                subscriptions = await conn.fetch(
+                    "SELECT id, event_types, node_type_ids FROM event_subscriptions WHERE status = 'active'"
+                )
+
+                for event in events:
+                    node_type_id = None
+                    if any(target["node_type_ids"] for target in [*endpoints, *subscriptions]):
+                        node_type_id = _event_node_type_id(event["event_type"], json.loads(event["payload"]))
+                    for endpoint in endpoints:
+                        if not _matches(endpoint, event["event_type"], node_type_id):
+                            continue
+                        await conn.execute(
+                            """
+                            INSERT INTO webhook_deliveries
+                                (id, endpoint_id, event_id, event_type, payload, schema_version)
+                            VALUES ($1, $2, $3, $4, $5::jsonb, $6)
+                            ON CONFLICT (endpoint_id, event_id) DO NOTHING
+                            """,
+                            str(uuid.uuid4()), endpoint["id"], event["event_id"],
+                            event["event_type"], event["payload"], event["schema_version"]
+                        )
+                    for subscription in subscriptions:
+                        if not _matches(subscription, event["event_type"], node_type_id):
+                            continue
+                        await conn.execute(
+                            """
+                            INSERT INTO subscription_messages
+                                (subscription_id, event_id, event_type, payload, schema_version)
+                            VALUES ($1, $2, $3, $4::jsonb, $5)
+                            ON CONFLICT (subscription_id, event_id) DO NOTHING
+                            """,
+                            subscription["id"], event["event_id"], event["event_type"], event["payload"],
+                            event["schema_version"]
+                        )
+
+                await conn.execute(
+                    "UPDATE outbox_events SET dispatched_at = NOW() WHERE id = ANY($1::bigint[])",
+                    [event["id"] for event in events]
+                )
+
+        return len(events)
+
+    async def publish_pending_cdc(
+        self,
+        limit: int,
+        publish: Callable[[List[OutboxEvent]], Awaitable[None]]
+    ) -> int:
+        """
+        Pass the oldest events not yet published to CDC topics to publish.
+
+        In one transaction: take the tenant's CDC advisory lock, read up to
+        limit unpublished events in order, await publish(events) and mark them
+        published. If publish raises, nothing is marked and the same events are
+        offered again next time. The lock keeps several server instances from
+        publishing a tenant's events concurrently and out of order; when another
+        instance holds it, 0 is returned. Returns the number of events published.
+        """
+        async with self.db.pool.acquire() as conn:
+            async with conn.transaction():
+                locked = await conn.fetchval("SELECT pg_try_advisory_xact_lock(hashtext('flexdb.cdc'))")
+                if not locked:
+                    return 0
+
+                rows = await conn.fetch(
+                    """
+                    SELECT id, event_id, event_type, entity_type, entity_id, payload::text, created_at, schema_version
+                    FROM outbox_events
+                    WHERE cdc_published_at IS NULL
+                    ORDER BY id
+                    LIMIT $1
+                    """,
+                    limit
+                )
+                if not rows:
+                    return 0
+
+                events = [self._row_to_event(row) for row in rows]
+                await publish(events)
+                await conn.execute(
+                    "UPDATE outbox_events SET cdc_published_at = NOW() WHERE id = ANY($1::bigint[])",
+                    [event.id for event in events]
+                )
+
+        return len(events)
+
+    def _row_to_event(self, row: asyncpg.Record) -> OutboxEvent:
+        """Convert a database row to an OutboxEvent object."""
+        return OutboxEvent(
+            id=row[0],
+            event_id=str(row[1]),
+            event_type=row[2],
+            entity_type=row[3],
+            entity_id=str(row[4]),
+            payload=row[5] or "{}",
+            created_at=row[6],
+            schema_version=row[7],
+        )
@@ -0,0 +1,70 @@
+"""
+Tenant quota repository implementation.
+"""
+
+from typing import Optional
+
+import asyncpg
+
+from app.db.database import Database
+from app.repository.errors import NotFoundError
+from app.repository.models import TenantQuota
+
+_TENANT_QUOTA_COLUMNS = (
+    "tenant_id, requests_per_second, burst, api_key_requests_per_second, api_key_burst, updated_at"
+)
+
+
+class TenantQuotaRepository:
+    """PostgreSQL repository of tenant request rate quotas (control database)."""
+
+    def __init__(self, db: Database):
+        self.db = db
+
+    async def get(self, tenant_id: str) -> Optional[TenantQuota]:
+        """Retrieve a tenant's quota, or None if it has none."""
+        async with self.db.pool.acquire() as conn:
+            row = await conn.fetchrow(
+                f"SELECT {_TENANT_QUOTA_COLUMNS} FROM tenant_quotas WHERE tenant_id = $1", tenant_id
+            )
+
+        return self._row_to_tenant_quota(row) if row else None
+
+    async def set(self, quota: TenantQuota) -> TenantQuota:
+        """Create or replace a tenant's quota."""
+        query = f"""
+            INSERT INTO tenant_quotas (
+                tenant_id, requests_per_second, burst, api_key_requests_per_second, api_key_burst, updated_at
+            )
+            VALUES ($1, $2, $3, $4, $5, NOW())
+            ON CONFLICT (tenant_id) DO UPDATE
+            SET requests_per_second = EXCLUDED.requests_per_second,
+                burst = EXCLUDED.burst,
+                api_key_requests_per_second = EXCLUDED.api_key_requests_per_second,
+                api_key_burst = EXCLUDED.api_key_burst,
+                updated_at = NOW()
+            RETURNING {_TENANT_QUOTA_COLUMNS}
+        """
+
+        try:
+            async with self.db.pool.acquire() as conn:
+                row = await conn.fetchrow(
+                    query,
+                    quota.tenant_id, quota.requests_per_second, quota.burst,
+                    quota.api_key_requests_per_second, quota.api_key_burst
+                )
+        except asyncpg.ForeignKeyViolationError:
+            raise NotFoundError(f"tenant not found: {quota.tenant_id}")
+
+        return self._row_to_tenant_quota(row)
+
+    def _row_to_tenant_quota(self, row: asyncpg.Record) -> TenantQuota:
+        """Convert a database row to a TenantQuota object."""
+        return TenantQuota(
+            tenant_id=str(row["tenant_id"]),
+            requests_per_second=row["requests_per_second"],
+            burst=row["burst"],
+            api_key_requests_per_second=row["api_key_requests_per_second"],
+            api_key_burst=row["api_key_burst"],
+            updated_at=row["updated_at"],
+        )
@@ -9,18 +9,35 @@ from typing import List, Optional, Tuple
 import asyncpg
 
 from app.db.database import Database
-from app.repository.models import Relationship, ListOptions, ListResult
+from app.repository.models import (
+    BatchHook,
+    FilterValues,
+    ListOptions,
+    ListResult,
+    MAX_PAGE_SIZE,
+    Relationship,
+    SortOrder,
+    filter_values,
+)
+from app.repository.dry_run import transaction
 from app.repository.errors import NotFoundError
+from app.repository.outbox_repo import record_event
+from app.repository.sorting import order_by_clause
+from app.repository.versioning import raise_update_failure
+
+# Relationship columns listings can be sorted by
+RELATIONSHIP_SORT_COLUMNS = ("created_at", "updated_at")
 
 
 class RelationshipRepository:
     """PostgreSQL relationship repository."""
 
-    def __init__(self, db: Database):
+    def __init__(self, db: Database, max_page_size: int = MAX_PAGE_SIZE):
         self.db = db
+        self.max_page_size = max_page_size
 
-    async def create(self, rel: Relationship) -> Relationship:
-        """Create a new relationship."""
+    async def create(self, rel: Relationship, dry_run: bool = False) -> Relationship:
+        """Create a new relationship; a dry run rolls it back (see dry_run.py)."""
         rel.id = str(uuid.uuid4())
         rel.created_at = datetime.now()
         rel.updated_at = datetime.now()
@@ -31,27 +48,33 @@ class RelationshipRepository:
         query = """
             INSERT INTO relationships (id, source_node_id, target_node_id, relationship_type, data, created_at, updated_at)
             VALUES ($1, $2, $3, $4, $5::jsonb, $6, $7)
-            RETURNING id, source_node_id, target_node_id, relationship_type, data::text, created_at, updated_at
+            RETURNING id, source_node_id, target_node_id, relationship_type, data::text, created_at, updated_at, version
         """
 
         async with self.db.pool.acquire() as conn:
-            row = await conn.fetchrow(
-                query,
-                rel.id, rel.source_node_id, rel.target_node_id,
-                rel.relationship_type, rel.data, rel.created_at, rel.updated_at
-            )
-
-        return self._row_to_relationship(row)
+            async with transaction(conn, dry_run):
+                row = await conn.fetchrow(
+                    query,
+                    rel.id, rel.source_node_id, rel.target_node_id,
+                    rel.relationship_type, rel.data, rel.created_at, rel.updated_at
+                )
+                created = self._row_to_relationship(row)
+                await record_event(
+                    conn, "relationship.created", "relationship", created.id,
+                    {"relationship": created.to_dict()}
+                )
+
+        return created
 
     async def get_by_id(self, id: str) -> Relationship:
         """Retrieve a relationship by ID."""
         query = """
-            SELECT id, source_node_id, target_node_id, relationship_type, data::text, created_at, updated_at 
+            SELECT id, source_node_id, target_node_id, relationship_type, data::text, created_at, updated_at, version 
             FROM relationships 
             WHERE id = $1
         """
 
-        async with self.db.pool.acquire() as conn:
+        async with self.db.read_pool.acquire() as conn:
             row = await conn.fetchrow(query, id)
 
         if not row:
@@ -59,8 +82,16 @@ class RelationshipRepository:
 
         return self._row_to_relationship(row)
 
-    async def update(self, rel: Relationship) -> Relationship:
-        """Update an existing relationship."""
+    async def update(
+        self, rel: Relationship, expected_version: Optional[int] = None, dry_run: bool = False
+    ) -> Relationship:
+        """
+        Update an existing relationship.
+
+        If expected_version is given, the update only applies when it matches
+        the stored version; otherwise ConflictError is raised. A dry run rolls
+        the update back.
+        """
         rel.updated_at = datetime.now()
 
         if not rel.data:
@@ -68,41 +99,127 @@ class RelationshipRepository:
 
         query = """
             UPDATE relationships 
-            SET relationship_type = $2, data = $3::jsonb, updated_at = $4
-            WHERE id = $1
-            RETURNING id, source_node_id, target_node_id, relationship_type, data::text, created_at, updated_at
+            SET relationship_type = $2, data = $3::jsonb, updated_at = $4, version = version + 1
+            WHERE id = $1 AND ($5::bigint IS NULL OR version = $5)
+            RETURNING id, source_node_id, target_node_id, relationship_type, data::text, created_at, updated_at, version
         """
 
         async with self.db.pool.acquire() as conn:
-            row = await conn.fetchrow(
-                query,
-                rel.id, rel.relationship_type, rel.data, rel.updated_at
-            )
-
-        if not row:
-            raise NotFoundError(f"relationship not found: {rel.id}")
-
-        return self._row_to_relationship(row)
-
-    async def delete(self, id: str) -> None:
-        """Delete a relationship by ID."""
-        query = "DELETE FROM relationships WHERE id = $1"
+            async with transaction(conn, dry_run):
+                row = await conn.fetchrow(
+                    query,
+                    rel.id, rel.relationship_type, rel.data, rel.updated_at, expected_version
+                )
+                if not row:
+                    await raise_update_failure(conn, "relationships", "relationship", rel.id, expected_version)
+                updated = self._row_to_relationship(row)
+                await record_event(
+                    conn, "relationship.updated", "relationship", updated.id,
+                    {"relationship": updated.to_dict()}
+                )
+
+        return updated
+
+    async def delete(self, id: str, expected_version: Optional[int] = None, dry_run: bool = False) -> None:
+        """
+        Delete a relationship by ID.
+        If expected_version is given, the relationship is only deleted while it is at
+        that version; otherwise ConflictError is raised. A dry run rolls the delete back.
+        """
+        query = """
+            DELETE FROM relationships
+            WHERE id = $1 AND ($2::integer IS NULL OR version = $2)
+            RETURNING id, source_node_id, target_node_id, relationship_type, data::text, created_at, updated_at, version
+        """
 
         async with self.db.pool.acquire() as conn:
-            result = await conn.execute(query, id)
-
-        if result == "DELETE 0":
-            raise NotFoundError(f"relationship not found: {id}")
-
-    async def list(
+            async with transaction(conn, dry_run):
+                row = await conn.fetchrow(query, id, expected_version)
+                if not row:
+                    await raise_update_failure(conn, "relationships", "relationship", id, expected_version)
+                deleted = self._row_to_relationship(row)
+                await record_event(
+                    conn, "relationship.deleted", "relationship", deleted.id,
+                    {"relationship": deleted.to_dict()}
+                )
+
+    async def delete_many(
         self,
         source_node_id: Optional[str],
         target_node_id: Optional[str],
         rel_type: Optional[str],
-        opts: ListOptions
+        batch_size: int,
+        dry_run: bool = False,
+        on_batch: Optional[BatchHook] = None
+    ) -> int:
+        """
+        Delete the relationships matching the given filters, batch_size per
+        transaction. Returns the number deleted, or with dry_run, that would be.
+        on_batch follows the progress and may stop the delete between batches.
+        """
+        where = "1=1"
+        args = []
+        if source_node_id:
+            args.append(source_node_id)
+            where += f" AND source_node_id = ${len(args)}"
+        if target_node_id:
+            args.append(target_node_id)
+            where += f" AND target_node_id = ${len(args)}"
+        if rel_type:
+            args.append(rel_type)
+            where += f" AND relationship_type = ${len(args)}"
+
+        if dry_run:
+            async with self.db.pool.acquire() as conn:
+                return await conn.fetchval(f"SELECT COUNT(*) FROM relationships WHERE {where}", *args)
+
+        query = f"""
+            DELETE FROM relationships
+            WHERE id IN (
+                SELECT id FROM relationships WHERE {where}
+                LIMIT ${len(args) + 1}
+                FOR UPDATE
+            )
+            RETURNING id, source_node_id, target_node_id, relationship_type, data::text, created_at, updated_at, version
+        """
+
+        count = 0
+        async with self.db.pool.acquire() as conn:
+            if on_batch:
+                total = await conn.fetchval(f"SELECT COUNT(*) FROM relationships WHERE {where}", *args)
+                if not await on_batch(0, total):
+                    return 0
+            while True:
+                async with conn.transaction():
+                    rows = await conn.fetch(query, *args, batch_size)
+                    for row in rows:
+                        deleted = self._row_to_relationship(row)
+                        await record_event(
+                            conn, "relationship.deleted", "relationship", deleted.id,
+                            {"relationship": deleted.to_dict()}
+                        )
+                count += len(rows)
+                if len(rows) < batch_size:
+                    if on_batch:
+                        await on_batch(count, max(total, count))
+                    return count
+                if on_batch and not await on_batch(count, max(total, count)):
+                    return count
+
+    async def list(
+        self,
+        source_node_id: FilterValues,
+        target_node_id: FilterValues,
+        rel_type: FilterValues,
+        opts: ListOptions,
+        sort: Optional[SortOrder] = None
     ) -> Tuple[List[Relationship], ListResult]:
-        """Retrieve relationships with pagination and optional filtering."""
-        page_size = max(1, min(opts.page_size or 10, 100))
+        """
+        Retrieve relationships with pagination and optional filtering, newest
+        first unless sorted otherwise. Each filter takes one value or several,
+        any of which matches.
+        """
+        page_size = max(1, min(opts.page_size or 10, self.max_page_size))
         offset = 0
         if opts.page_token:
             try:
@@ -113,35 +230,29 @@ class RelationshipRepository:
         # Build dynamic query with filters
         count_query = "SELECT COUNT(*) FROM relationships WHERE 1=1"
         list_query = """
-            SELECT id, source_node_id, target_node_id, relationship_type, data::text, created_at, updated_at 
+            SELECT id, source_node_id, target_node_id, relationship_type, data::text, created_at, updated_at, version 
             FROM relationships 
             WHERE 1=1
         """
         args = []
         arg_idx = 1
 
-        if source_node_id:
-            count_query += f" AND source_node_id = ${arg_idx}"
-            list_query += f" AND source_node_id = ${arg_idx}"
-            args.append(source_node_id)
-            arg_idx += 1
-
-        if target_node_id:
-            count_query += f" AND target_node_id = ${arg_idx}"
-            list_query += f" AND target_node_id = ${arg_idx}"
-            args.append(target_node_id)
-            arg_idx += 1
-
-        if rel_type:
-            count_query += f" AND relationship_type = ${arg_idx}"
-            list_query += f" AND relationship_type = ${arg_idx}"
-            args.append(rel_type)
-            arg_idx += 1
-
-        list_query += f" ORDER BY created_at DESC LIMIT ${arg_idx} OFFSET ${arg_idx + 1}"
+        for column, values, array_type in (
+            ("source_node_id", source_node_id, "uuid[]"),
+            ("target_node_id", target_node_id, "uuid[]"),
+            ("relationship_type", rel_type, "text[]"),
+        ):
+            values = filter_values(values)
+            if values:
+                count_query += f" AND {column} = ANY(${arg_idx}::{array_type})"
+                list_query += f" AND {column} = ANY(${arg_idx}::{array_type})"
+                args.append(values)
+                arg_idx += 1
+
+        list_query += f" ORDER BY {order_by_clause(sort, RELATIONSHIP_SORT_COLUMNS)} LIMIT ${arg_idx} OFFSET ${arg_idx + 1}"
         list_args = args + [page_size, offset]
 
-        async with self.db.pool.acquire() as conn:
+        async with self.db.read_pool.acquire() as conn:
             total_count = await conn.fetchval(count_query, *args)
             rows = await conn.fetch(list_query, *list_args)
 
@@ -165,4 +276,5 @@ class RelationshipRepository:
             data=row[4] or "{}",
             created_at=row[5],
             updated_at=row[6],
+            version=row[7],
         )
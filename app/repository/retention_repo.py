@@ -0,0 +1,131 @@
+"""
+Retention policy repository implementation.
+"""
+
+from typing import List, Tuple
+
+import asyncpg
+
+from app.db.database import Database
+from app.repository.models import ListOptions, ListResult, MAX_PAGE_SIZE, RetentionPolicy
+from app.repository.errors import NotFoundError
+
+_POLICY_COLUMNS = """
+    node_type_id, timestamp_field, ttl_seconds, action, created_at, updated_at, last_swept_at, last_expired_count
+"""
+
+
+class RetentionPolicyRepository:
+    """PostgreSQL repository of node type retention policies."""
+
+    def __init__(self, db: Database, max_page_size: int = MAX_PAGE_SIZE):
+        self.db = db
+        self.max_page_size = max_page_size
+
+    async def upsert(self, policy: RetentionPolicy) -> RetentionPolicy:
+        """Set the retention policy of a node type, replacing its current one."""
+        query = f"""
+            INSERT INTO retention_policies (node_type_id, timestamp_field, ttl_seconds, action)
+            VALUES ($1, $2, $3, $4)
+            ON CONFLICT (node_type_id) DO UPDATE
+            SET timestamp_field = EXCLUDED.timestamp_field, ttl_seconds = EXCLUDED.ttl_seconds,
+                action = EXCLUDED.action, updated_at = NOW()
+            RETURNING {_POLICY_COLUMNS}
+        """
+
+        async with self.db.pool.acquire() as conn:
+            try:
+                row = await conn.fetchrow(
+                    query, policy.node_type_id, policy.timestamp_field, policy.ttl_seconds, policy.action
+                )
+            except asyncpg.ForeignKeyViolationError:
+                raise NotFoundError(f"node_type not found: {policy.node_type_id}") from None
+
+        return self._row_to_policy(row)
+
+    async def get(self, node_type_id: str) -> RetentionPolicy:
+        """Retrieve the retention policy of a node type."""
+        query = f"SELECT {_POLICY_COLUMNS} FROM retention_policies WHERE node_type_id = $1"
+
+        async with self.db.pool.acquire() as conn:
+            row = await conn.fetchrow(query, node_type_id)
+
+        if not row:
+            raise NotFoundError(f"retention policy not found: {node_type_id}")
+
+        return self._row_to_policy(row)
+
+    async def delete(self, node_type_id: str) -> RetentionPolicy:
+        """Remove the retention policy of a node type, returning it."""
+        query = f"DELETE FROM retention_policies WHERE node_type_id = $1 RETURNING {_POLICY_COLUMNS}"
+
+        async with self.db.pool.acquire() as conn:
+            row = await conn.fetchrow(query, node_type_id)
+
+        if not row:
+            raise NotFoundError(f"retention policy not found: {node_type_id}")
+
+        return self._row_to_policy(row)
+
+    async def list(self, opts: ListOptions) -> Tuple[List[RetentionPolicy], ListResult]:
+        """Retrieve retention policies with pagination, oldest first."""
+        page_size = max(1, min(opts.page_size or 10, self.max_page_size))
+        offset = 0
+        if opts.page_token:
+            try:
+                offset = int(opts.page_token)
+            except ValueError:
+                offset = 0
+
+        list_query = f"""
+            SELECT {_POLICY_COLUMNS}
+            FROM retention_policies
+            ORDER BY created_at, node_type_id
+            LIMIT $1 OFFSET $2
+        """
+
+        async with self.db.pool.acquire() as conn:
+            total_count = await conn.fetchval("SELECT COUNT(*) FROM retention_policies")
+            rows = await conn.fetch(list_query, page_size, offset)
+
+        policies = [self._row_to_policy(row) for row in rows]
+
+        result = ListResult(total_count=total_count)
+        next_offset = offset + len(policies)
+        if next_offset < total_count:
+            result.next_page_token = str(next_offset)
+
+        return policies, result
+
+    async def list_all(self) -> List[RetentionPolicy]:
+        """Retrieve every retention policy, for the retention sweeper."""
+        query = f"SELECT {_POLICY_COLUMNS} FROM retention_policies ORDER BY created_at, node_type_id"
+
+        async with self.db.pool.acquire() as conn:
+            rows = await conn.fetch(query)
+
+        return [self._row_to_policy(row) for row in rows]
+
+    async def record_sweep(self, node_type_id: str, expired_count: int) -> None:
+        """Record a sweep of a node type and the number of nodes it expired."""
+        query = """
+            UPDATE retention_policies
+            SET last_swept_at = NOW(), last_expired_count = $2
+            WHERE node_type_id = $1
+        """
+
+        async with self.db.pool.acquire() as conn:
+            await conn.execute(query, node_type_id, expired_count)
+
+    def _row_to_policy(self, row: asyncpg.Record) -> RetentionPolicy:
+        """Convert a database row to a RetentionPolicy object."""
+        return RetentionPolicy(
+            node_type_id=str(row["node_type_id"]),
+            timestamp_field=row["timestamp_field"],
+            ttl_seconds=row["ttl_seconds"],
+            action=row["action"],
+            created_at=row["created_at"],
+            updated_at=row["updated_at"],
+            last_swept_at=row["last_swept_at"],
+            last_expired_count=row["last_expired_count"],
+        )
@@ -0,0 +1,21 @@
+"""
+Sort orders of node type and relationship listings.
+
+Listings are newest first by default; a SortOrder picks one of the listed
+resource's sortable columns instead, with ties broken by ID. The services
+validate sort orders; repositories only check the column is sortable, as it
+is spelled into the query.
+"""
+
+from typing import Optional, Sequence
+
+from app.repository.models import SortOrder
+
+
+def order_by_clause(sort: Optional[SortOrder], columns: Sequence[str]) -> str:
+    """Return the ORDER BY expressions of a listing sorted by one of columns, or newest first."""
+    if not sort:
+        return "created_at DESC"
+    if sort.field not in columns:
+        raise ValueError(f"cannot sort by {sort.field}; expected one of: {', '.join(columns)}")
+    return f"{sort.field} {'DESC' if sort.descending else 'ASC'}, id"
@@ -0,0 +1,1684 @@
+"""
+SQLite repository implementations.
+
+A second storage driver next to PostgreSQL, for local development and edge
+deployments without a PostgreSQL server (see app/storage). Like the control
+and tenant databases of PostgreSQL, the control plane (tenants, tenant quotas,
+users and tenant memberships) lives in one file and every tenant's node types,
+nodes, node revisions, relationships, outbox events, data keys and bulk jobs in a
+file of its own:
+
+    control = SqliteDatabase("data/control.db", CONTROL_SCHEMA)
+    tenants = SqliteTenantRepository(control)
+    tenant_db = SqliteDatabase("data/tenant_<id>.db", TENANT_SCHEMA)
+    service = NodeService(SqliteNodeRepository(tenant_db), SqliteNodeTypeRepository(tenant_db))
+
+Tables are created when a file is first opened. Key lookups, listings and
+cascading deletes run in SQL. Queries over node data (data filters, geo_point
+filters, sorting and aggregations) and unique keys are evaluated on the node
+type's nodes like the in-memory repositories, which suits the data sizes of
+these deployments; node type data path indexes are only recorded. geo_shape
+queries require PostGIS and are not supported.
+
+Each file has a single connection, and statements run on the event loop
+thread one transaction at a time.
+"""
+
+import asyncio
+import json
+import sqlite3
+from contextlib import asynccontextmanager
+from dataclasses import replace
+from datetime import datetime, timedelta
+from typing import Any, AsyncIterator, Dict, Iterable, List, Optional, Sequence, Tuple
+
+from app.repository.actor import current_actor
+from app.repository.errors import AlreadyExistsError, ConflictError, FailedPreconditionError, NotFoundError
+from app.repository.ids import new_id
+from app.repository.memory import (
+    InMemoryNodeRepository,
+    _delete_batches,
+    InMemoryStore,
+    _check_json,
+    _check_unique_keys,
+    _check_version,
+    _comparable,
+    _json_contains,
+    _json_value,
+    _nodes_at,
+    _select_data_fields,
+    _sequence_token,
+)
+from app.repository.models import (
+    Aggregation,
+    AggregationBucket,
+    BatchHook,
+    BulkJob,
+    ChangePage,
+    DataFilter,
+    DataKey,
+    FilterValues,
+    GeoFilter,
+    ListOptions,
+    ListResult,
+    MAX_PAGE_SIZE,
+    Node,
+    NodeRevision,
+    NodeType,
+    NodeTypeIndex,
+    OutboxEvent,
+    Relationship,
+    SortOrder,
+    Tenant,
+    TenantQuota,
+    TenantSlugChange,
+    TenantUser,
+    User,
+    filter_values,
+)
+from app.repository.nodetype_repo import NODE_TYPE_SORT_COLUMNS
+from app.repository.relationship_repo import RELATIONSHIP_SORT_COLUMNS
+from app.repository.sorting import order_by_clause
+
+CONTROL_SCHEMA = """
+CREATE TABLE IF NOT EXISTS tenants (
+    id TEXT PRIMARY KEY,
+    slug TEXT NOT NULL UNIQUE,
+    name TEXT NOT NULL,
+    status TEXT NOT NULL DEFAULT 'active',
+    created_at TEXT NOT NULL,
+    updated_at TEXT NOT NULL,
+    status_reason TEXT NOT NULL DEFAULT '',
+    status_changed_at TEXT,
+    archive_database TEXT NOT NULL DEFAULT ''
+);
+CREATE TABLE IF NOT EXISTS tenant_quotas (
+    tenant_id TEXT PRIMARY KEY REFERENCES tenants(id) ON DELETE CASCADE,
+    requests_per_second REAL,
+    burst INTEGER,
+    api_key_requests_per_second REAL,
+    api_key_burst INTEGER,
+    updated_at TEXT NOT NULL
+);
+CREATE TABLE IF NOT EXISTS users (
+    id TEXT PRIMARY KEY,
+    email TEXT NOT NULL UNIQUE,
+    display_name TEXT NOT NULL DEFAULT '',
+    created_at TEXT NOT NULL,
+    updated_at TEXT NOT NULL
+);
+CREATE TABLE IF NOT EXISTS tenant_users (
+    tenant_id TEXT NOT NULL REFERENCES tenants(id) ON DELETE CASCADE,
+    user_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    role TEXT NOT NULL DEFAULT 'member',
+    status TEXT NOT NULL DEFAULT 'active',
+    PRIMARY KEY (tenant_id, user_id)
+);
+CREATE TABLE IF NOT EXISTS user_credentials (
+    user_id TEXT PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    password_hash TEXT NOT NULL,
+    updated_at TEXT NOT NULL
+);
+CREATE TABLE IF NOT EXISTS tenant_slug_changes (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    tenant_id TEXT NOT NULL REFERENCES tenants(id) ON DELETE CASCADE,
+    old_slug TEXT NOT NULL,
+    new_slug TEXT NOT NULL,
+    actor TEXT NOT NULL DEFAULT '',
+    changed_at TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_tenant_slug_changes_old_slug ON tenant_slug_changes(old_slug, changed_at);
+"""
+
+TENANT_SCHEMA = """
+CREATE TABLE IF NOT EXISTS node_types (
+    id TEXT PRIMARY KEY,
+    name TEXT NOT NULL UNIQUE,
+    description TEXT NOT NULL DEFAULT '',
+    schema TEXT NOT NULL DEFAULT '',
+    display TEXT NOT NULL DEFAULT '{}',
+    created_at TEXT NOT NULL,
+    updated_at TEXT NOT NULL,
+    version INTEGER NOT NULL DEFAULT 1,
+    schema_version INTEGER NOT NULL DEFAULT 1,
+    unique_keys TEXT NOT NULL DEFAULT '[]'
+);
+CREATE TABLE IF NOT EXISTS node_type_indexes (
+    id TEXT PRIMARY KEY,
+    node_type_id TEXT NOT NULL REFERENCES node_types(id) ON DELETE CASCADE,
+    name TEXT NOT NULL,
+    method TEXT NOT NULL,
+    paths TEXT NOT NULL,
+    status TEXT NOT NULL,
+    created_at TEXT NOT NULL,
+    UNIQUE (node_type_id, name)
+);
+CREATE TABLE IF NOT EXISTS nodes (
+    id TEXT PRIMARY KEY,
+    node_type_id TEXT NOT NULL REFERENCES node_types(id) ON DELETE CASCADE,
+    data TEXT NOT NULL DEFAULT '{}',
+    created_at TEXT NOT NULL,
+    updated_at TEXT NOT NULL,
+    version INTEGER NOT NULL DEFAULT 1,
+    schema_version INTEGER NOT NULL DEFAULT 1
+);
+CREATE INDEX IF NOT EXISTS idx_nodes_node_type_id ON nodes (node_type_id, created_at);
+CREATE TABLE IF NOT EXISTS node_revisions (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    node_id TEXT NOT NULL,
+    node_type_id TEXT NOT NULL,
+    version INTEGER NOT NULL,
+    op TEXT NOT NULL,
+    data TEXT NOT NULL,
+    schema_version INTEGER NOT NULL,
+    node_created_at TEXT NOT NULL,
+    revised_at TEXT NOT NULL,
+    actor TEXT NOT NULL DEFAULT ''
+);
+CREATE INDEX IF NOT EXISTS idx_node_revisions_node_id ON node_revisions (node_id, revised_at);
+CREATE TABLE IF NOT EXISTS relationships (
+    id TEXT PRIMARY KEY,
+    source_node_id TEXT NOT NULL REFERENCES nodes(id) ON DELETE CASCADE,
+    target_node_id TEXT NOT NULL REFERENCES nodes(id) ON DELETE CASCADE,
+    relationship_type TEXT NOT NULL,
+    data TEXT NOT NULL DEFAULT '{}',
+    created_at TEXT NOT NULL,
+    updated_at TEXT NOT NULL,
+    version INTEGER NOT NULL DEFAULT 1
+);
+CREATE INDEX IF NOT EXISTS idx_relationships_source ON relationships (source_node_id);
+CREATE INDEX IF NOT EXISTS idx_relationships_target ON relationships (target_node_id);
+CREATE TABLE IF NOT EXISTS outbox_events (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    event_id TEXT NOT NULL,
+    event_type TEXT NOT NULL,
+    entity_type TEXT NOT NULL,
+    entity_id TEXT NOT NULL,
+    payload TEXT NOT NULL,
+    created_at TEXT NOT NULL,
+    dispatched_at TEXT
+);
+CREATE TABLE IF NOT EXISTS data_keys (
+    version INTEGER PRIMARY KEY,
+    kms_key_id TEXT NOT NULL,
+    wrapped_key BLOB NOT NULL,
+    created_at TEXT NOT NULL
+);
+CREATE TABLE IF NOT EXISTS bulk_jobs (
+    id TEXT PRIMARY KEY,
+    kind TEXT NOT NULL,
+    status TEXT NOT NULL DEFAULT 'running',
+    params TEXT NOT NULL DEFAULT '{}',
+    processed INTEGER NOT NULL DEFAULT 0,
+    total INTEGER,
+    unit TEXT NOT NULL,
+    progress TEXT NOT NULL DEFAULT '{}',
+    error TEXT NOT NULL DEFAULT '',
+    created_at TEXT NOT NULL,
+    updated_at TEXT NOT NULL,
+    finished_at TEXT
+);
+"""
+
+_TENANT_COLUMNS = "id, slug, name, status, created_at, updated_at, status_reason, status_changed_at, archive_database"
+_USER_COLUMNS = "id, email, display_name, created_at, updated_at"
+_NODE_TYPE_COLUMNS = (
+    "id, name, description, schema, display, created_at, updated_at, version, schema_version, unique_keys"
+)
+_NODE_COLUMNS = "id, node_type_id, data, created_at, updated_at, version, schema_version"
+_DATA_KEY_COLUMNS = "version, kms_key_id, wrapped_key, created_at"
+_BULK_JOB_COLUMNS = (
+    "id, kind, status, params, processed, total, unit, progress, error, created_at, updated_at, finished_at"
+)
+_RELATIONSHIP_COLUMNS = (
+    "id, source_node_id, target_node_id, relationship_type, data, created_at, updated_at, version"
+)
+
+
+class SqliteDatabase:
+    """A SQLite database file, with its tables created from schema when first opened."""
+
+    def __init__(self, path: str, schema: str):
+        self.path = path
+        self.schema = schema
+        self._conn: Optional[sqlite3.Connection] = None
+        self._lock = asyncio.Lock()
+
+    @asynccontextmanager
+    async def transaction(self, dry_run: bool = False) -> AsyncIterator[sqlite3.Connection]:
+        """
+        Run the enclosed statements in a transaction, committed unless they
+        raise or it is a dry run.
+        """
+        async with self._lock:
+            conn = self._connect()
+            conn.execute("BEGIN IMMEDIATE")
+            try:
+                yield conn
+            except BaseException:
+                conn.execute("ROLLBACK")
+                raise
+            conn.execute("ROLLBACK" if dry_run else "COMMIT")
+
+    def close(self) -> None:
+        """Close the connection."""
+        if self._conn is not None:
+            self._conn.close()
+            self._conn = None
+
+    def _connect(self) -> sqlite3.Connection:
+        if self._conn is None:
+            # Transactions are managed by transaction(), not the sqlite3 module
+            conn = sqlite3.connect(self.path, isolation_level=None, check_same_thread=False)
+            conn.row_factory = sqlite3.Row
+            conn.execute("PRAGMA foreign_keys = ON")
+            conn.execute("PRAGMA journal_mode = WAL")
+            conn.executescript(self.schema)
+            self._conn = conn
+        return self._conn
+
+
+def _ts(value: datetime) -> str:
+    # Fixed-width ISO timestamps order correctly as text
+    return value.isoformat(timespec="microseconds")
+
+
+def _dt(value: Optional[str]) -> Optional[datetime]:
+    return datetime.fromisoformat(value) if value else None
+
+
+def _page(
+    conn: sqlite3.Connection,
+    select: str,
+    count: str,
+    params: Sequence[Any],
+    opts: ListOptions,
+    max_page_size: int
+) -> Tuple[List[sqlite3.Row], ListResult]:
+    """Run an ordered SELECT with offset pagination; count is the matching COUNT(*) query."""
+    page_size = max(1, min(opts.page_size or 10, max_page_size))
+    offset = 0
+    if opts.page_token:
+        try:
+            offset = int(opts.page_token)
+        except ValueError:
+            offset = 0
+
+    total_count = conn.execute(count, params).fetchone()[0]
+    rows = []
+    if offset >= 0:
+        rows = conn.execute(f"{select} LIMIT ? OFFSET ?", (*params, page_size, offset)).fetchall()
+    result = ListResult(total_count=total_count)
+    if offset + len(rows) < total_count:
+        result.next_page_token = str(offset + len(rows))
+    return rows, result
+
+
+def _where(conditions: Dict[str, FilterValues]) -> Tuple[str, List[Any]]:
+    """Return a WHERE clause matching the columns whose values are set (any of them, if several), and its parameters."""
+    clauses, params = [], []
+    for column, value in conditions.items():
+        values = filter_values(value)
+        if len(values) == 1:
+            clauses.append(f"{column} = ?")
+        elif values:
+            clauses.append(f"{column} IN ({', '.join('?' * len(values))})")
+        params.extend(values)
+    return (f"WHERE {' AND '.join(clauses)}" if clauses else ""), params
+
+
+def _record_event(
+    conn: sqlite3.Connection, event_type: str, entity_type: str, entity_id: str, payload: Dict[str, Any]
+) -> None:
+    """Append a change event to the outbox, in the caller's transaction."""
+    conn.execute(
+        """
+        INSERT INTO outbox_events (event_id, event_type, entity_type, entity_id, payload, created_at)
+        VALUES (?, ?, ?, ?, ?, ?)
+        """,
+        (new_id(), event_type, entity_type, entity_id, json.dumps(payload), _ts(datetime.now()))
+    )
+
+
+def _record_revision(conn: sqlite3.Connection, op: str, node: Node, revised_at: Optional[datetime] = None) -> None:
+    """Append a revision of a node, as of revised_at or else its updated_at, by the current actor."""
+    conn.execute(
+        """
+        INSERT INTO node_revisions
+            (node_id, node_type_id, version, op, data, schema_version, node_created_at, revised_at, actor)
+        VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+        """,
+        (
+            node.id, node.node_type_id, node.version, op, node.data, node.schema_version,
+            _ts(node.created_at), _ts(revised_at or node.updated_at), current_actor()
+        )
+    )
+
+
+class SqliteTenantRepository:
+    """SQLite tenant repository (control database)."""
+
+    def __init__(self, db: SqliteDatabase):
+        self.db = db
+
+    async def create(self, tenant: Tenant) -> Tenant:
+        """Create a new tenant."""
+        tenant.id = new_id()
+        tenant.created_at = datetime.now()
+        tenant.updated_at = datetime.now()
+        if not tenant.status:
+            tenant.status = "active"
+
+        try:
+            async with self.db.transaction() as conn:
+                conn.execute(
+                    "INSERT INTO tenants (id, slug, name, status, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?)",
+                    (tenant.id, tenant.slug, tenant.name, tenant.status, _ts(tenant.created_at), _ts(tenant.updated_at))
+                )
+                row = self._fetch(conn, tenant.id)
+        except sqlite3.IntegrityError:
+            raise ConflictError(f"tenant slug already exists: {tenant.slug}")
+
+        return self._row_to_tenant(row)
+
+    async def get_by_id(self, id: str) -> Tenant:
+        """Retrieve a tenant by ID."""
+        async with self.db.transaction() as conn:
+            row = self._fetch(conn, id)
+
+        if not row:
+            raise NotFoundError(f"tenant not found: {id}")
+        return self._row_to_tenant(row)
+
+    async def get_by_slug(self, slug: str) -> Tenant:
+        """Retrieve a tenant by its slug."""
+        async with self.db.transaction() as conn:
+            row = conn.execute(f"SELECT {_TENANT_COLUMNS} FROM tenants WHERE slug = ?", (slug,)).fetchone()
+
+        if not row:
+            raise NotFoundError(f"tenant not found: {slug}")
+        return self._row_to_tenant(row)
+
+    async def get_by_former_slug(self, slug: str) -> Optional[Tenant]:
+        """Retrieve the tenant most recently renamed from slug, or None if none was."""
+        async with self.db.transaction() as conn:
+            row = conn.execute(
+                f"""
+                SELECT {_TENANT_COLUMNS} FROM tenants WHERE id = (
+                    SELECT tenant_id FROM tenant_slug_changes
+                    WHERE old_slug = ?
+                    ORDER BY changed_at DESC, id DESC
+                    LIMIT 1
+                )
+                """,
+                (slug,)
+            ).fetchone()
+
+        return self._row_to_tenant(row) if row else None
+
+    async def rename_slug(self, id: str, slug: str, actor: str) -> Tenant:
+        """Change a tenant's slug and record the change; ConflictError if another tenant has the slug."""
+        now = _ts(datetime.now())
+        try:
+            async with self.db.transaction() as conn:
+                row = self._fetch(conn, id)
+                if not row:
+                    raise NotFoundError(f"tenant not found: {id}")
+                if row["slug"] != slug:
+                    conn.execute("UPDATE tenants SET slug = ?, updated_at = ? WHERE id = ?", (slug, now, id))
+                    conn.execute(
+                        "INSERT INTO tenant_slug_changes (tenant_id, old_slug, new_slug, actor, changed_at) "
+                        "VALUES (?, ?, ?, ?, ?)",
+                        (id, row["slug"], slug, actor, now)
+                    )
+                    row = self._fetch(conn, id)
+        except sqlite3.IntegrityError:
+            raise ConflictError(f"tenant slug already exists: {slug}")
+
+        return self._row_to_tenant(row)
+
+    async def list_slug_changes(self, id: str) -> List[TenantSlugChange]:
+        """Retrieve the slug changes of a tenant, oldest first."""
+        async with self.db.transaction() as conn:
+            rows = conn.execute(
+                "SELECT tenant_id, old_slug, new_slug, actor, changed_at FROM tenant_slug_changes "
+                "WHERE tenant_id = ? ORDER BY changed_at, id",
+                (id,)
+            ).fetchall()
+
+        return [
+            TenantSlugChange(
+                tenant_id=row["tenant_id"],
+                old_slug=row["old_slug"],
+                new_slug=row["new_slug"],
+                actor=row["actor"],
+                changed_at=_dt(row["changed_at"]),
+            )
+            for row in rows
+        ]
+
+    async def update(self, tenant: Tenant) -> Tenant:
+        """Update an existing tenant."""
+        tenant.updated_at = datetime.now()
+
+        try:
+            async with self.db.transaction() as conn:
+                conn.execute(
+                    "UPDATE tenants SET slug = ?, name = ?, status = ?, updated_at = ? WHERE id = ?",
+                    (tenant.slug, tenant.name, tenant.status, _ts(tenant.updated_at), tenant.id)
+                )
+                row = self._fetch(conn, tenant.id)
+        except sqlite3.IntegrityError:
+            raise ConflictError(f"tenant slug already exists: {tenant.slug}")
+
+        if not row:
+            raise NotFoundError(f"tenant not found: {tenant.id}")
+        return self._row_to_tenant(row)
+
+    async def set_status(
+        self,
+        id: str,
+        status: str,
+        from_statuses: Iterable[str],
+        reason: str,
+        archive_database: Optional[str] = None
+    ) -> Tenant:
+        """
+        Change a tenant's status if it currently is one of from_statuses;
+        otherwise FailedPreconditionError is raised. archive_database is kept unless given.
+        """
+        from_statuses = list(from_statuses)
+        now = _ts(datetime.now())
+
+        async with self.db.transaction() as conn:
+            row = self._fetch(conn, id)
+            if not row:
+                raise NotFoundError(f"tenant not found: {id}")
+            if row["status"] not in from_statuses:
+                raise FailedPreconditionError(f"tenant {id} is {row['status']}, not {' or '.join(from_statuses)}")
+            conn.execute(
+                """
+                UPDATE tenants
+                SET status = ?, status_reason = ?, status_changed_at = ?, updated_at = ?,
+                    archive_database = COALESCE(?, archive_database)
+                WHERE id = ?
+                """,
+                (status, reason, now, now, archive_database, id)
+            )
+            row = self._fetch(conn, id)
+
+        return self._row_to_tenant(row)
+
+    async def delete(self, id: str) -> None:
+        """Delete a tenant by ID, with its quota and memberships."""
+        async with self.db.transaction() as conn:
+            deleted = conn.execute("DELETE FROM tenants WHERE id = ?", (id,)).rowcount
+
+        if not deleted:
+            raise NotFoundError(f"tenant not found: {id}")
+
+    async def list(self, opts: ListOptions) -> Tuple[List[Tenant], ListResult]:
+        """Retrieve tenants with pagination."""
+        async with self.db.transaction() as conn:
+            rows, result = _page(
+                conn,
+                f"SELECT {_TENANT_COLUMNS} FROM tenants ORDER BY created_at DESC",
+                "SELECT COUNT(*) FROM tenants",
+                (), opts, 100
+            )
+        return [self._row_to_tenant(row) for row in rows], result
+
+    def _fetch(self, conn: sqlite3.Connection, id: str) -> Optional[sqlite3.Row]:
+        return conn.execute(f"SELECT {_TENANT_COLUMNS} FROM tenants WHERE id = ?", (id,)).fetchone()
+
+    def _row_to_tenant(self, row: sqlite3.Row) -> Tenant:
+        """Convert a database row to a Tenant object."""
+        return Tenant(
+            id=row["id"],
+            slug=row["slug"],
+            name=row["name"],
+            status=row["status"],
+            created_at=_dt(row["created_at"]),
+            updated_at=_dt(row["updated_at"]),
+            status_reason=row["status_reason"],
+            status_changed_at=_dt(row["status_changed_at"]),
+            archive_database=row["archive_database"],
+        )
+
+
+class SqliteTenantQuotaRepository:
+    """SQLite repository of tenant request rate quotas (control database)."""
+
+    def __init__(self, db: SqliteDatabase):
+        self.db = db
+
+    async def get(self, tenant_id: str) -> Optional[TenantQuota]:
+        """Retrieve a tenant's quota, or None if it has none."""
+        async with self.db.transaction() as conn:
+            row = conn.execute("SELECT * FROM tenant_quotas WHERE tenant_id = ?", (tenant_id,)).fetchone()
+        return self._row_to_tenant_quota(row) if row else None
+
+    async def set(self, quota: TenantQuota) -> TenantQuota:
+        """Create or replace a tenant's quota."""
+        try:
+            async with self.db.transaction() as conn:
+                conn.execute(
+                    """
+                    INSERT INTO tenant_quotas (
+                        tenant_id, requests_per_second, burst, api_key_requests_per_second, api_key_burst, updated_at
+                    )
+                    VALUES (?, ?, ?, ?, ?, ?)
+                    ON CONFLICT (tenant_id) DO UPDATE
+                    SET requests_per_second = excluded.requests_per_second,
+                        burst = excluded.burst,
+                        api_key_requests_per_second = excluded.api_key_requests_per_second,
+                        api_key_burst = excluded.api_key_burst,
+                        updated_at = excluded.updated_at
+                    """,
+                    (
+                        quota.tenant_id, quota.requests_per_second, quota.burst,
+                        quota.api_key_requests_per_second, quota.api_key_burst, _ts(datetime.now())
+                    )
+                )
+                row = conn.execute("SELECT * FROM tenant_quotas WHERE tenant_id = ?", (quota.tenant_id,)).fetchone()
+        except sqlite3.IntegrityError:
+            raise NotFoundError(f"tenant not found: {quota.tenant_id}")
+
+        return self._row_to_tenant_quota(row)
+
+    def _row_to_tenant_quota(self, row: sqlite3.Row) -> TenantQuota:
+        """Convert a database row to a TenantQuota object."""
+        return TenantQuota(
+            tenant_id=row["tenant_id"],
+            requests_per_second=row["requests_per_second"],
+            burst=row["burst"],
+            api_key_requests_per_second=row["api_key_requests_per_second"],
+            api_key_burst=row["api_key_burst"],
+            updated_at=_dt(row["updated_at"]),
+        )
+
+
+class SqliteUserRepository:
+    """SQLite user repository (control database)."""
+
+    def __init__(self, db: SqliteDatabase):
+        self.db = db
+
+    async def create(self, user: User) -> User:
+        """Create a new user."""
+        user.id = new_id()
+        user.created_at = datetime.now()
+        user.updated_at = datetime.now()
+
+        try:
+            async with self.db.transaction() as conn:
+                conn.execute(
+                    "INSERT INTO users (id, email, display_name, created_at, updated_at) VALUES (?, ?, ?, ?, ?)",
+                    (user.id, user.email, user.display_name, _ts(user.created_at), _ts(user.updated_at))
+                )
+                row = self._fetch(conn, user.id)
+        except sqlite3.IntegrityError:
+            raise ConflictError(f"user email already exists: {user.email}")
+
+        return self._row_to_user(row)
+
+    async def get_by_id(self, id: str) -> User:
+        """Retrieve a user by ID."""
+        async with self.db.transaction() as conn:
+            row = self._fetch(conn, id)
+
+        if not row:
+            raise NotFoundError(f"user not found: {id}")
+        return self._row_to_user(row)
+
+    async def get_by_email(self, email: str) -> User:
+        """Retrieve a user by email address."""
+        async with self.db.transaction() as conn:
+            row = conn.execute(f"SELECT {_USER_COLUMNS} FROM users WHERE email = ?", (email,)).fetchone()
+
+        if not row:
+            raise NotFoundError(f"user not found: {email}")
+        return self._row_to_user(row)
+
+    async def update(self, user: User) -> User:
+        """Update an existing user."""
+        user.updated_at = datetime.now()
+
+        try:
+            async with self.db.transaction() as conn:
+                conn.execute(
+                    "UPDATE users SET email = ?, display_name = ?, updated_at = ? WHERE id = ?",
+                    (user.email, user.display_name, _ts(user.updated_at), user.id)
+                )
+                row = self._fetch(conn, user.id)
+        except sqlite3.IntegrityError:
+            raise ConflictError(f"user email already exists: {user.email}")
+
+        if not row:
+            raise NotFoundError(f"user not found: {user.id}")
+        return self._row_to_user(row)
+
+    async def delete(self, id: str) -> None:
+        """Delete a user by ID, with their memberships."""
+        async with self.db.transaction() as conn:
+            deleted = conn.execute("DELETE FROM users WHERE id = ?", (id,)).rowcount
+
+        if not deleted:
+            raise NotFoundError(f"user not found: {id}")
+
+    async def list(self, opts: ListOptions) -> Tuple[List[User], ListResult]:
+        """Retrieve users with pagination."""
+        async with self.db.transaction() as conn:
+            rows, result = _page(
+                conn,
+                f"SELECT {_USER_COLUMNS} FROM users ORDER BY created_at DESC",
+                "SELECT COUNT(*) FROM users",
+                (), opts, 100
+            )
+        return [self._row_to_user(row) for row in rows], result
+
+    async def add_to_tenant(self, tenant_user: TenantUser) -> TenantUser:
+        """Add a user to a tenant, or change their role and status in it."""
+        if not tenant_user.role:
+            tenant_user.role = "member"
+        if not tenant_user.status:
+            tenant_user.status = "active"
+
+        async with self.db.transaction() as conn:
+            if not conn.execute("SELECT 1 FROM tenants WHERE id = ?", (tenant_user.tenant_id,)).fetchone():
+                raise NotFoundError(f"tenant not found: {tenant_user.tenant_id}")
+            if not self._fetch(conn, tenant_user.user_id):
+                raise NotFoundError(f"user not found: {tenant_user.user_id}")
+            conn.execute(
+                """
+                INSERT INTO tenant_users (tenant_id, user_id, role, status)
+                VALUES (?, ?, ?, ?)
+                ON CONFLICT (tenant_id, user_id) DO UPDATE SET role = excluded.role, status = excluded.status
+                """,
+                (tenant_user.tenant_id, tenant_user.user_id, tenant_user.role, tenant_user.status)
+            )
+
+        return replace(tenant_user)
+
+    async def remove_from_tenant(self, tenant_id: str, user_id: str) -> None:
+        """Remove a user from a tenant."""
+        async with self.db.transaction() as conn:
+            deleted = conn.execute(
+                "DELETE FROM tenant_users WHERE tenant_id = ? AND user_id = ?", (tenant_id, user_id)
+            ).rowcount
+
+        if not deleted:
+            raise NotFoundError(f"tenant_user not found: tenant_id={tenant_id}, user_id={user_id}")
+
+    async def list_tenant_users(self, tenant_id: str, opts: ListOptions) -> Tuple[List[TenantUser], ListResult]:
+        """List users in a tenant."""
+        async with self.db.transaction() as conn:
+            rows, result = _page(
+                conn,
+                "SELECT tenant_id, user_id, role, status FROM tenant_users WHERE tenant_id = ? ORDER BY user_id",
+                "SELECT COUNT(*) FROM tenant_users WHERE tenant_id = ?",
+                (tenant_id,), opts, 100
+            )
+        return [
+            TenantUser(tenant_id=row["tenant_id"], user_id=row["user_id"], role=row["role"], status=row["status"])
+            for row in rows
+        ], result
+
+    async def set_password_hash(self, user_id: str, password_hash: str) -> None:
+        """Store a user's password hash, replacing any previous one."""
+        async with self.db.transaction() as conn:
+            if not self._fetch(conn, user_id):
+                raise NotFoundError(f"user not found: {user_id}")
+            conn.execute(
+                """
+                INSERT INTO user_credentials (user_id, password_hash, updated_at) VALUES (?, ?, ?)
+                ON CONFLICT (user_id) DO UPDATE SET password_hash = excluded.password_hash,
+                    updated_at = excluded.updated_at
+                """,
+                (user_id, password_hash, _ts(datetime.now()))
+            )
+
+    async def get_password_hash(self, user_id: str) -> str:
+        """Retrieve a user's password hash, or "" if they have no password."""
+        async with self.db.transaction() as conn:
+            row = conn.execute("SELECT password_hash FROM user_credentials WHERE user_id = ?", (user_id,)).fetchone()
+        return row["password_hash"] if row else ""
+
+    async def list_memberships(self, user_id: str) -> List[TenantUser]:
+        """List a user's memberships in every tenant."""
+        async with self.db.transaction() as conn:
+            rows = conn.execute(
+                "SELECT tenant_id, user_id, role, status FROM tenant_users WHERE user_id = ? ORDER BY tenant_id",
+                (user_id,)
+            ).fetchall()
+        return [
+            TenantUser(tenant_id=row["tenant_id"], user_id=row["user_id"], role=row["role"], status=row["status"])
+            for row in rows
+        ]
+
+    def _fetch(self, conn: sqlite3.Connection, id: str) -> Optional[sqlite3.Row]:
+        return conn.execute(f"SELECT {_USER_COLUMNS} FROM users WHERE id = ?", (id,)).fetchone()
+
+    def _row_to_user(self, row: sqlite3.Row) -> User:
+        """Convert a database row to a User object."""
+        return User(
+            id=row["id"],
+            email=row["email"],
+            display_name=row["display_name"],
+            created_at=_dt(row["created_at"]),
+            updated_at=_dt(row["updated_at"]),
+        )
+
+
+def _fetch_node_type(conn: sqlite3.Connection, id: str) -> Optional[NodeType]:
+    row = conn.execute(f"SELECT {_NODE_TYPE_COLUMNS} FROM node_types WHERE id = ?", (id,)).fetchone()
+    return _row_to_node_type(row) if row else None
+
+
+def _row_to_node_type(row: sqlite3.Row) -> NodeType:
+    """Convert a database row to a NodeType object."""
+    return NodeType(
+        id=row["id"],
+        tenant_id="",  # Not stored in tenant database (each tenant has own file)
+        name=row["name"],
+        description=row["description"],
+        schema=row["schema"],
+        display=row["display"],
+        created_at=_dt(row["created_at"]),
+        updated_at=_dt(row["updated_at"]),
+        version=row["version"],
+        schema_version=row["schema_version"],
+        unique_keys=json.loads(row["unique_keys"]),
+    )
+
+
+def _fetch_nodes(conn: sqlite3.Connection, where: str = "", params: Sequence[Any] = ()) -> List[Node]:
+    rows = conn.execute(f"SELECT {_NODE_COLUMNS} FROM nodes {where}", params).fetchall()
+    return [_row_to_node(row) for row in rows]
+
+
+def _row_to_node(row: sqlite3.Row) -> Node:
+    """Convert a database row to a Node object."""
+    return Node(
+        id=row["id"],
+        tenant_id="",
+        node_type_id=row["node_type_id"],
+        data=row["data"],
+        created_at=_dt(row["created_at"]),
+        updated_at=_dt(row["updated_at"]),
+        version=row["version"],
+        schema_version=row["schema_version"],
+    )
+
+
+def _check_node_unique_keys(conn: sqlite3.Connection, node: Node) -> None:
+    """Raise AlreadyExistsError if node has the same values as another node for a unique key of its type."""
+    node_type = _fetch_node_type(conn, node.node_type_id)
+    if node_type and node_type.unique_keys:
+        _check_unique_keys(node_type, node, _fetch_nodes(conn, "WHERE node_type_id = ?", (node.node_type_id,)))
+
+
+class SqliteNodeTypeRepository:
+    """SQLite node type repository (tenant database)."""
+
+    def __init__(self, db: SqliteDatabase, max_page_size: int = MAX_PAGE_SIZE):
+        self.db = db
+        self.max_page_size = max_page_size
+
+    async def create(self, node_type: NodeType, dry_run: bool = False) -> NodeType:
+        """Create a new node type; a dry run rolls it back."""
+        node_type.id = new_id()
+        node_type.created_at = datetime.now()
+        node_type.updated_at = datetime.now()
+        self._check_json(node_type)
+
+        try:
+            async with self.db.transaction(dry_run) as conn:
+                conn.execute(
+                    """
+                    INSERT INTO node_types (id, name, description, schema, display, created_at, updated_at, unique_keys)
+                    VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+                    """,
+                    (
+                        node_type.id, node_type.name, node_type.description, node_type.schema or "",
+                        node_type.display or "{}", _ts(node_type.created_at), _ts(node_type.updated_at),
+                        json.dumps(node_type.unique_keys)
+                    )
+                )
+                created = _fetch_node_type(conn, node_type.id)
+                _record_event(conn, "node_type.created", "node_type", created.id, {"node_type": created.to_dict()})
+        except sqlite3.IntegrityError:
+            raise ConflictError(f"node_type name already exists: {node_type.name}")
+
+        return created
+
+    async def get_by_id(self, id: str) -> NodeType:
+        """Retrieve a node type by ID."""
+        async with self.db.transaction() as conn:
+            node_type = _fetch_node_type(conn, id)
+
+        if not node_type:
+            raise NotFoundError(f"node_type not found: {id}")
+        return node_type
+
+    async def get_many(self, ids: List[str]) -> List[NodeType]:
+        """Retrieve the node types with the given IDs that exist, in no particular order."""
+        ids = list(set(ids))
+        if not ids:
+            return []
+        async with self.db.transaction() as conn:
+            rows = conn.execute(
+                f"SELECT {_NODE_TYPE_COLUMNS} FROM node_types WHERE id IN ({', '.join('?' * len(ids))})", ids
+            ).fetchall()
+        return [_row_to_node_type(row) for row in rows]
+
+    async def update(
+        self, node_type: NodeType, expected_version: Optional[int] = None, dry_run: bool = False
+    ) -> NodeType:
+        """
+        Update an existing node type.
+
+        schema_version is incremented when the schema changes. If expected_version
+        is given, the update only applies when it matches the stored version;
+        otherwise ConflictError is raised. A dry run rolls the update back.
+        """
+        node_type.updated_at = datetime.now()
+        self._check_json(node_type)
+
+        try:
+            async with self.db.transaction(dry_run) as conn:
+                stored = _fetch_node_type(conn, node_type.id)
+                if not stored:
+                    raise NotFoundError(f"node_type not found: {node_type.id}")
+                _check_version("node_type", node_type.id, stored.version, expected_version)
+                schema_changed = _json_value(node_type.schema) != _json_value(stored.schema)
+                conn.execute(
+                    """
+                    UPDATE node_types
+                    SET name = ?, description = ?, schema = ?, display = ?, updated_at = ?,
+                        version = version + 1, schema_version = schema_version + ?
+                    WHERE id = ?
+                    """,
+                    (
+                        node_type.name, node_type.description, node_type.schema or "", node_type.display or "{}",
+                        _ts(node_type.updated_at), 1 if schema_changed else 0, node_type.id
+                    )
+                )
+                updated = _fetch_node_type(conn, node_type.id)
+                _record_event(conn, "node_type.updated", "node_type", updated.id, {"node_type": updated.to_dict()})
+        except sqlite3.IntegrityError:
+            raise ConflictError(f"node_type name already exists: {node_type.name}")
+
+        return updated
+
+    async def delete(self, id: str, expected_version: Optional[int] = None, dry_run: bool = False) -> None:
+        """
+        Delete a node type by ID, with its nodes and their relationships.
+
+        If expected_version is given, the node type is only deleted while it is
+        at that version; otherwise ConflictError is raised. A dry run rolls the
+        delete back.
+        """
+        async with self.db.transaction(dry_run) as conn:
+            deleted = _fetch_node_type(conn, id)
+            if not deleted:
+                raise NotFoundError(f"node_type not found: {id}")
+            _check_version("node_type", id, deleted.version, expected_version)
+            now = datetime.now()
+            for node in _fetch_nodes(conn, "WHERE node_type_id = ?", (id,)):
+                _record_revision(conn, "deleted", node, now)
+            # Its nodes, their relationships and its index declarations are deleted with it (ON DELETE CASCADE)
+            conn.execute("DELETE FROM node_types WHERE id = ?", (id,))
+            _record_event(conn, "node_type.deleted", "node_type", deleted.id, {"node_type": deleted.to_dict()})
+
+    async def list(self, opts: ListOptions, sort: Optional[SortOrder] = None) -> Tuple[List[NodeType], ListResult]:
+        """Retrieve node types with pagination, newest first unless sorted otherwise."""
+        async with self.db.transaction() as conn:
+            rows, result = _page(
+                conn,
+                f"SELECT {_NODE_TYPE_COLUMNS} FROM node_types ORDER BY {order_by_clause(sort, NODE_TYPE_SORT_COLUMNS)}",
+                "SELECT COUNT(*) FROM node_types",
+                (), opts, self.max_page_size
+            )
+        return [_row_to_node_type(row) for row in rows], result
+
+    async def list_all(self) -> List[NodeType]:
+        """Retrieve all node types ordered by name."""
+        async with self.db.transaction() as conn:
+            rows = conn.execute(
+                f"SELECT {_NODE_TYPE_COLUMNS} FROM node_types ORDER BY name, created_at"
+            ).fetchall()
+        return [_row_to_node_type(row) for row in rows]
+
+    async def create_index(self, index: NodeTypeIndex) -> NodeTypeIndex:
+        """Declare an index on data paths of a node type's nodes; it is only recorded."""
+        index.id = new_id()
+        index.created_at = datetime.now()
+        created = replace(index, paths=[list(path) for path in index.paths], status="ready")
+
+        async with self.db.transaction() as conn:
+            if not _fetch_node_type(conn, index.node_type_id):
+                raise NotFoundError(f"node_type not found: {index.node_type_id}")
+            try:
+                conn.execute(
+                    """
+                    INSERT INTO node_type_indexes (id, node_type_id, name, method, paths, status, created_at)
+                    VALUES (?, ?, ?, ?, ?, ?, ?)
+                    """,
+                    (
+                        created.id, created.node_type_id, created.name, created.method,
+                        json.dumps(created.paths), created.status, _ts(created.created_at)
+                    )
+                )
+            except sqlite3.IntegrityError:
+                raise AlreadyExistsError(f"node_type {index.node_type_id} already has an index named {index.name}")
+
+        return created
+
+    async def list_indexes(self, node_type_id: str) -> List[NodeTypeIndex]:
+        """Retrieve the indexes of a node type ordered by name."""
+        async with self.db.transaction() as conn:
+            rows = conn.execute(
+                "SELECT * FROM node_type_indexes WHERE node_type_id = ? ORDER BY name", (node_type_id,)
+            ).fetchall()
+        return [self._row_to_index(row) for row in rows]
+
+    async def drop_index(self, node_type_id: str, name: str) -> NodeTypeIndex:
+        """Drop a node type's index by name."""
+        async with self.db.transaction() as conn:
+            row = conn.execute(
+                "SELECT * FROM node_type_indexes WHERE node_type_id = ? AND name = ?", (node_type_id, name)
+            ).fetchone()
+            if not row:
+                raise NotFoundError(f"node_type_index not found: {name}")
+            conn.execute("DELETE FROM node_type_indexes WHERE id = ?", (row["id"],))
+        return self._row_to_index(row)
+
+    def _check_json(self, node_type: NodeType) -> None:
+        if node_type.schema:
+            _check_json(node_type.schema)
+        _check_json(node_type.display or "{}")
+
+    def _row_to_index(self, row: sqlite3.Row) -> NodeTypeIndex:
+        """Convert a database row to a NodeTypeIndex object."""
+        return NodeTypeIndex(
+            id=row["id"],
+            node_type_id=row["node_type_id"],
+            name=row["name"],
+            method=row["method"],
+            paths=json.loads(row["paths"]),
+            status=row["status"],
+            created_at=_dt(row["created_at"]),
+        )
+
+
+class SqliteNodeRepository:
+    """SQLite node repository (tenant database)."""
+
+    def __init__(self, db: SqliteDatabase, max_page_size: int = MAX_PAGE_SIZE):
+        self.db = db
+        self.max_page_size = max_page_size
+
+    async def create(self, node: Node, dry_run: bool = False) -> Node:
+        """Create a new node; a dry run rolls it back."""
+        node.id = new_id()
+        node.created_at = datetime.now()
+        node.updated_at = datetime.now()
+        if not node.data:
+            node.data = "{}"
+        _check_json(node.data)
+        created = replace(node, tenant_id="", version=1)
+
+        async with self.db.transaction(dry_run) as conn:
+            if not _fetch_node_type(conn, created.node_type_id):
+                raise NotFoundError(f"node_type not found: {created.node_type_id}")
+            _check_node_unique_keys(conn, created)
+            conn.execute(
+                f"INSERT INTO nodes ({_NODE_COLUMNS}) VALUES (?, ?, ?, ?, ?, ?, ?)",
+                (
+                    created.id, created.node_type_id, created.data, _ts(created.created_at),
+                    _ts(created.updated_at), created.version, created.schema_version
+                )
+            )
+            _record_revision(conn, "created", created)
+            _record_event(conn, "node.created", "node", created.id, {"node": created.to_dict()})
+
+        return replace(created)
+
+    async def get_by_id(self, id: str, data_fields: Optional[List[str]] = None) -> Node:
+        """Retrieve a node by ID, with only the given top-level data fields if data_fields isn't None."""
+        async with self.db.transaction() as conn:
+            nodes = _fetch_nodes(conn, "WHERE id = ?", (id,))
+
+        if not nodes:
+            raise NotFoundError(f"node not found: {id}")
+        return _select_data_fields(nodes[0], data_fields)
+
+    async def get_many(self, ids: List[str], data_fields: Optional[List[str]] = None) -> List[Node]:
+        """
+        Retrieve the nodes with the given IDs that exist, in no particular
+        order, with only the given top-level data fields if data_fields isn't None.
+        """
+        ids = list(set(ids))
+        if not ids:
+            return []
+        async with self.db.transaction() as conn:
+            nodes = _fetch_nodes(conn, f"WHERE id IN ({', '.join('?' * len(ids))})", ids)
+        return [_select_data_fields(node, data_fields) for node in nodes]
+
+    async def update(
+        self,
+        node: Node,
+        expected_version: Optional[int] = None,
+        dry_run: bool = False,
+        lock_token: str = ""
+    ) -> Node:
+        """
+        Update an existing node.
+
+        If expected_version is given, the update only applies when it matches
+        the stored version; otherwise ConflictError is raised. A dry run rolls
+        the update back. Node locks need the PostgreSQL backend, so lock_token
+        is ignored.
+        """
+        node.updated_at = datetime.now()
+        if not node.data:
+            node.data = "{}"
+        _check_json(node.data)
+
+        async with self.db.transaction(dry_run) as conn:
+            stored = _fetch_nodes(conn, "WHERE id = ?", (node.id,))
+            if not stored:
+                raise NotFoundError(f"node not found: {node.id}")
+            _check_version("node", node.id, stored[0].version, expected_version)
+            updated = replace(
+                stored[0], data=node.data, updated_at=node.updated_at, version=stored[0].version + 1,
+                schema_version=node.schema_version
+            )
+            _check_node_unique_keys(conn, updated)
+            conn.execute(
+                "UPDATE nodes SET data = ?, updated_at = ?, version = ?, schema_version = ? WHERE id = ?",
+                (updated.data, _ts(updated.updated_at), updated.version, updated.schema_version, updated.id)
+            )
+            _record_revision(conn, "updated", updated)
+            _record_event(conn, "node.updated", "node", updated.id, {"node": updated.to_dict()})
+
+        return replace(updated)
+
+    async def delete(
+        self,
+        id: str,
+        expected_version: Optional[int] = None,
+        dry_run: bool = False,
+        lock_token: str = ""
+    ) -> None:
+        """
+        Delete a node by ID, with its relationships.
+        If expected_version is given, the node is only deleted while it is at
+        that version; otherwise ConflictError is raised. A dry run rolls the delete back.
+        lock_token is ignored, like by update.
+        """
+        async with self.db.transaction(dry_run) as conn:
+            deleted = _fetch_nodes(conn, "WHERE id = ?", (id,))
+            if not deleted:
+                raise NotFoundError(f"node not found: {id}")
+            _check_version("node", id, deleted[0].version, expected_version)
+            self._delete(conn, deleted)
+
+    async def delete_many(
+        self,
+        node_type_id: Optional[str],
+        data_filter: Optional[str],
+        batch_size: int,
+        dry_run: bool = False,
+        on_batch: Optional[BatchHook] = None
+    ) -> int:
+        """Delete the nodes of a node type and/or whose data contains data_filter, batch_size per transaction."""
+        contained = _json_value(data_filter) if data_filter else None
+        where, params = _where({"node_type_id": node_type_id})
+
+        async with self.db.transaction() as conn:
+            matches = [
+                n for n in _fetch_nodes(conn, where, params)
+                if contained is None or _json_contains(_json_value(n.data), contained)
+            ]
+        if dry_run:
+            return len(matches)
+
+        async def delete(batch: List[Node]) -> None:
+            ids = [n.id for n in batch]
+            async with self.db.transaction() as conn:
+                # As they are now, without those deleted meanwhile
+                self._delete(conn, _fetch_nodes(conn, f"WHERE id IN ({', '.join('?' * len(ids))})", ids))
+        return await _delete_batches(matches, batch_size, delete, on_batch)
+
+    async def list_revisions(self, id: str, opts: ListOptions) -> Tuple[List[NodeRevision], ListResult]:
+        """Retrieve the revisions of a node, including a deleted node, newest first."""
+        async with self.db.transaction() as conn:
+            rows, result = _page(
+                conn,
+                "SELECT * FROM node_revisions WHERE node_id = ? ORDER BY revised_at DESC, id DESC",
+                "SELECT COUNT(*) FROM node_revisions WHERE node_id = ?",
+                (id,), opts, self.max_page_size
+            )
+
+        if not result.total_count:
+            raise NotFoundError(f"node not found: {id}")
+        return [self._row_to_revision(row) for row in rows], result
+
+    async def get_revision(self, id: str, revision_id: int) -> NodeRevision:
+        """Retrieve a revision of a node."""
+        async with self.db.transaction() as conn:
+            row = conn.execute(
+                "SELECT * FROM node_revisions WHERE node_id = ? AND id = ?", (id, revision_id)
+            ).fetchone()
+
+        if not row:
+            raise NotFoundError(f"node revision not found: {revision_id}")
+        return self._row_to_revision(row)
+
+    async def get_at(self, id: str, at: datetime) -> Node:
+        """Retrieve a node as it was at the given time."""
+        async with self.db.transaction() as conn:
+            rows = conn.execute(
+                "SELECT * FROM node_revisions WHERE node_id = ? ORDER BY revised_at DESC, id DESC", (id,)
+            ).fetchall()
+
+        revisions = [
+            r for r in map(self._row_to_revision, rows) if _comparable(r.revised_at) <= _comparable(at)
+        ]
+        if not revisions or revisions[0].op == "deleted":
+            raise NotFoundError(f"node not found at {at.isoformat()}: {id}")
+        return revisions[0].to_node()
+
+    async def list_at(
+        self,
+        node_type_id: Optional[str],
+        at: datetime,
+        opts: ListOptions,
+        sort: Optional[SortOrder] = None,
+        data_filter: Optional[DataFilter] = None,
+        data_fields: Optional[List[str]] = None
+    ) -> Tuple[List[Node], ListResult]:
+        """Retrieve nodes as they were at the given time, filtered, ordered and paginated like list."""
+        where, params = _where({"node_type_id": node_type_id})
+        async with self.db.transaction() as conn:
+            rows = conn.execute(f"SELECT * FROM node_revisions {where}", params).fetchall()
+
+        store = InMemoryStore()
+        store.nodes = {node.id: node for node in _nodes_at(map(self._row_to_revision, rows), at)}
+        return await InMemoryNodeRepository(store, self.max_page_size).list(
+            node_type_id, opts, None, sort, data_filter, data_fields
+        )
+
+    async def list(
+        self,
+        node_type_id: Optional[str],
+        opts: ListOptions,
+        geo: Optional[GeoFilter] = None,
+        sort: Optional[SortOrder] = None,
+        data_filter: Optional[DataFilter] = None,
+        data_fields: Optional[List[str]] = None
+    ) -> Tuple[List[Node], ListResult]:
+        """
+        Retrieve nodes with pagination and optional filtering, with only the
+        given top-level data fields if data_fields isn't None.
+
+        Distance ordering from a geo filter takes precedence over sort; the
+        default order is newest first.
+        """
+        nodes = await self._in_memory(node_type_id)
+        return await nodes.list(node_type_id, opts, geo, sort, data_filter, data_fields)
+
+    async def stream(self, node_type_id: Optional[str], batch_size: int) -> AsyncIterator[Node]:
+        """Stream all nodes, newest first, from a snapshot taken when iteration starts."""
+        where, params = _where({"node_type_id": node_type_id})
+        async with self.db.transaction() as conn:
+            nodes = _fetch_nodes(conn, f"{where} ORDER BY created_at DESC, id", params)
+        for node in nodes:
+            yield node
+
+    async def list_outdated(
+        self,
+        node_type_id: str,
+        schema_version: int,
+        after_id: str,
+        limit: int
+    ) -> List[Node]:
+        """Retrieve up to limit nodes of a node type below schema_version, in ID order after after_id."""
+        async with self.db.transaction() as conn:
+            return _fetch_nodes(
+                conn,
+                "WHERE node_type_id = ? AND schema_version < ? AND id > ? ORDER BY id LIMIT ?",
+                (node_type_id, schema_version, after_id, limit)
+            )
+
+    async def count(self, node_type_id: Optional[str], data_filter: Optional[DataFilter] = None) -> int:
+        """Count the nodes, optionally of a node type and matching a data filter."""
+        if not data_filter:
+            where, params = _where({"node_type_id": node_type_id})
+            async with self.db.transaction() as conn:
+                return conn.execute(f"SELECT COUNT(*) FROM nodes {where}", params).fetchone()[0]
+        return await (await self._in_memory(node_type_id)).count(node_type_id, data_filter)
+
+    async def aggregate(
+        self, node_type_id: Optional[str], agg: Aggregation, data_filter: Optional[DataFilter] = None
+    ) -> List[AggregationBucket]:
+        """Compute a bucketed aggregation over node data."""
+        return await (await self._in_memory(node_type_id)).aggregate(node_type_id, agg, data_filter)
+
+    async def _in_memory(self, node_type_id: Optional[str]) -> InMemoryNodeRepository:
+        """Return an in-memory repository holding the nodes (of a node type), to query their data."""
+        where, params = _where({"node_type_id": node_type_id})
+        async with self.db.transaction() as conn:
+            nodes = _fetch_nodes(conn, f"{where} ORDER BY id", params)
+
+        store = InMemoryStore()
+        store.nodes = {node.id: node for node in nodes}
+        return InMemoryNodeRepository(store, self.max_page_size)
+
+    def _delete(self, conn: sqlite3.Connection, nodes: List[Node]) -> None:
+        now = datetime.now()
+        for node in nodes:
+            _record_revision(conn, "deleted", node, now)
+            # Its relationships are deleted with it (ON DELETE CASCADE)
+            conn.execute("DELETE FROM nodes WHERE id = ?", (node.id,))
+            _record_event(conn, "node.deleted", "node", node.id, {"node": node.to_dict()})
+
+    def _row_to_revision(self, row: sqlite3.Row) -> NodeRevision:
+        """Convert a database row to a NodeRevision object."""
+        return NodeRevision(
+            id=str(row["id"]),
+            node_id=row["node_id"],
+            node_type_id=row["node_type_id"],
+            version=row["version"],
+            op=row["op"],
+            data=row["data"],
+            schema_version=row["schema_version"],
+            node_created_at=_dt(row["node_created_at"]),
+            revised_at=_dt(row["revised_at"]),
+            actor=row["actor"],
+        )
+
+
+class SqliteRelationshipRepository:
+    """SQLite relationship repository (tenant database)."""
+
+    def __init__(self, db: SqliteDatabase, max_page_size: int = MAX_PAGE_SIZE):
+        self.db = db
+        self.max_page_size = max_page_size
+
+    async def create(self, rel: Relationship, dry_run: bool = False) -> Relationship:
+        """Create a new relationship; a dry run rolls it back."""
+        rel.id = new_id()
+        rel.created_at = datetime.now()
+        rel.updated_at = datetime.now()
+        if not rel.data:
+            rel.data = "{}"
+        _check_json(rel.data)
+        created = replace(rel, tenant_id="", version=1)
+
+        async with self.db.transaction(dry_run) as conn:
+            for node_id in (created.source_node_id, created.target_node_id):
+                if not conn.execute("SELECT 1 FROM nodes WHERE id = ?", (node_id,)).fetchone():
+                    raise NotFoundError(f"node not found: {node_id}")
+            conn.execute(
+                f"INSERT INTO relationships ({_RELATIONSHIP_COLUMNS}) VALUES (?, ?, ?, ?, ?, ?, ?, ?)",
+                (
+                    created.id, created.source_node_id, created.target_node_id, created.relationship_type,
+                    created.data, _ts(created.created_at), _ts(created.updated_at), created.version
+                )
+            )
+            _record_event(
+                conn, "relationship.created", "relationship", created.id, {"relationship": created.to_dict()}
+            )
+
+        return replace(created)
+
+    async def get_by_id(self, id: str) -> Relationship:
+        """Retrieve a relationship by ID."""
+        async with self.db.transaction() as conn:
+            rel = self._fetch(conn, id)
+
+        if not rel:
+            raise NotFoundError(f"relationship not found: {id}")
+        return rel
+
+    async def update(
+        self, rel: Relationship, expected_version: Optional[int] = None, dry_run: bool = False
+    ) -> Relationship:
+        """
+        Update an existing relationship.
+
+        If expected_version is given, the update only applies when it matches
+        the stored version; otherwise ConflictError is raised. A dry run rolls
+        the update back.
+        """
+        rel.updated_at = datetime.now()
+        if not rel.data:
+            rel.data = "{}"
+        _check_json(rel.data)
+
+        async with self.db.transaction(dry_run) as conn:
+            stored = self._fetch(conn, rel.id)
+            if not stored:
+                raise NotFoundError(f"relationship not found: {rel.id}")
+            _check_version("relationship", rel.id, stored.version, expected_version)
+            updated = replace(
+                stored,
+                relationship_type=rel.relationship_type,
+                data=rel.data,
+                updated_at=rel.updated_at,
+                version=stored.version + 1,
+            )
+            conn.execute(
+                "UPDATE relationships SET relationship_type = ?, data = ?, updated_at = ?, version = ? WHERE id = ?",
+                (updated.relationship_type, updated.data, _ts(updated.updated_at), updated.version, updated.id)
+            )
+            _record_event(
+                conn, "relationship.updated", "relationship", updated.id, {"relationship": updated.to_dict()}
+            )
+
+        return replace(updated)
+
+    async def delete(self, id: str, expected_version: Optional[int] = None, dry_run: bool = False) -> None:
+        """
+        Delete a relationship by ID.
+        If expected_version is given, the relationship is only deleted while it is at
+        that version; otherwise ConflictError is raised. A dry run rolls the delete back.
+        """
+        async with self.db.transaction(dry_run) as conn:
+            deleted = self._fetch(conn, id)
+            if not deleted:
+                raise NotFoundError(f"relationship not found: {id}")
+            _check_version("relationship", id, deleted.version, expected_version)
+            self._delete(conn, [deleted])
+
+    async def delete_many(
+        self,
+        source_node_id: Optional[str],
+        target_node_id: Optional[str],
+        rel_type: Optional[str],
+        batch_size: int,
+        dry_run: bool = False,
+        on_batch: Optional[BatchHook] = None
+    ) -> int:
+        """Delete the relationships matching the given filters, batch_size per transaction."""
+        where, params = self._filter(source_node_id, target_node_id, rel_type)
+
+        async with self.db.transaction() as conn:
+            rows = conn.execute(f"SELECT {_RELATIONSHIP_COLUMNS} FROM relationships {where}", params).fetchall()
+            matches = [self._row_to_relationship(row) for row in rows]
+        if dry_run:
+            return len(matches)
+
+        async def delete(batch: List[Relationship]) -> None:
+            ids = [r.id for r in batch]
+            async with self.db.transaction() as conn:
+                # As they are now, without those deleted meanwhile, e.g. with their nodes
+                rows = conn.execute(
+                    f"SELECT {_RELATIONSHIP_COLUMNS} FROM relationships WHERE id IN ({', '.join('?' * len(ids))})", ids
+                ).fetchall()
+                self._delete(conn, [self._row_to_relationship(row) for row in rows])
+        return await _delete_batches(matches, batch_size, delete, on_batch)
+
+    async def list(
+        self,
+        source_node_id: FilterValues,
+        target_node_id: FilterValues,
+        rel_type: FilterValues,
+        opts: ListOptions,
+        sort: Optional[SortOrder] = None
+    ) -> Tuple[List[Relationship], ListResult]:
+        """Retrieve relationships with pagination and optional filtering, newest first unless sorted otherwise."""
+        where, params = self._filter(source_node_id, target_node_id, rel_type)
+        order_by = order_by_clause(sort, RELATIONSHIP_SORT_COLUMNS)
+
+        async with self.db.transaction() as conn:
+            rows, result = _page(
+                conn,
+                f"SELECT {_RELATIONSHIP_COLUMNS} FROM relationships {where} ORDER BY {order_by}",
+                f"SELECT COUNT(*) FROM relationships {where}",
+                params, opts, self.max_page_size
+            )
+        return [self._row_to_relationship(row) for row in rows], result
+
+    def _filter(
+        self, source_node_id: FilterValues, target_node_id: FilterValues, rel_type: FilterValues
+    ) -> Tuple[str, List[Any]]:
+        return _where({
+            "source_node_id": source_node_id,
+            "target_node_id": target_node_id,
+            "relationship_type": rel_type,
+        })
+
+    def _delete(self, conn: sqlite3.Connection, rels: List[Relationship]) -> None:
+        for rel in rels:
+            conn.execute("DELETE FROM relationships WHERE id = ?", (rel.id,))
+            _record_event(conn, "relationship.deleted", "relationship", rel.id, {"relationship": rel.to_dict()})
+
+    def _fetch(self, conn: sqlite3.Connection, id: str) -> Optional[Relationship]:
+        row = conn.execute(f"SELECT {_RELATIONSHIP_COLUMNS} FROM relationships WHERE id = ?", (id,)).fetchone()
+        return self._row_to_relationship(row) if row else None
+
+    def _row_to_relationship(self, row: sqlite3.Row) -> Relationship:
+        """Convert a database row to a Relationship object."""
+        return Relationship(
+            id=row["id"],
+            tenant_id="",
+            source_node_id=row["source_node_id"],
+            target_node_id=row["target_node_id"],
+            relationship_type=row["relationship_type"],
+            data=row["data"],
+            created_at=_dt(row["created_at"]),
+            updated_at=_dt(row["updated_at"]),
+            version=row["version"],
+        )
+
+
+class SqliteOutboxRepository:
+    """SQLite outbox repository; the query cache reads the newest event of a tenant through it."""
+
+    def __init__(self, db: SqliteDatabase):
+        self.db = db
+
+    async def list_pending(self, limit: int) -> List[OutboxEvent]:
+        """Retrieve events that have not been dispatched yet, oldest first."""
+        async with self.db.transaction() as conn:
+            rows = conn.execute(
+                "SELECT * FROM outbox_events WHERE dispatched_at IS NULL ORDER BY id LIMIT ?", (limit,)
+            ).fetchall()
+        return [self._row_to_event(row) for row in rows]
+
+    async def latest_sequence(self) -> int:
+        """Return the ID of the newest outbox event, or 0 if there is none."""
+        async with self.db.transaction() as conn:
+            return conn.execute("SELECT COALESCE(MAX(id), 0) FROM outbox_events").fetchone()[0]
+
+    async def mark_dispatched(self, ids: List[int]) -> None:
+        """Mark events as dispatched."""
+        async with self.db.transaction() as conn:
+            conn.executemany(
+                "UPDATE outbox_events SET dispatched_at = ? WHERE id = ?",
+                [(_ts(datetime.now()), id) for id in ids]
+            )
+
+    async def current_change_token(self) -> str:
+        """Return the change token of now, the sequence of the newest event."""
+        return str(await self.latest_sequence())
+
+    async def list_changes(self, after: str, limit: int) -> ChangePage:
+        """Retrieve up to limit events after the change token, the sequence of the last one seen."""
+        last = _sequence_token(after)
+        async with self.db.transaction() as conn:
+            rows = conn.execute(
+                "SELECT * FROM outbox_events WHERE id > ? ORDER BY id LIMIT ?", (last, limit + 1)
+            ).fetchall()
+        events = [self._row_to_event(row) for row in rows[:limit]]
+        if len(rows) > limit:
+            return ChangePage(events, str(events[-1].id), caught_up=False)
+        return ChangePage(events, str(events[-1].id) if events else str(last))
+
+    def _row_to_event(self, row: sqlite3.Row) -> OutboxEvent:
+        """Convert a database row to an OutboxEvent object."""
+        return OutboxEvent(
+            id=row["id"],
+            event_id=row["event_id"],
+            event_type=row["event_type"],
+            entity_type=row["entity_type"],
+            entity_id=row["entity_id"],
+            payload=row["payload"],
+            created_at=_dt(row["created_at"]),
+        )
+
+
+class SqliteDataKeyRepository:
+    """SQLite data key repository (see app/encryption)."""
+
+    def __init__(self, db: SqliteDatabase):
+        self.db = db
+
+    async def latest(self) -> Optional[DataKey]:
+        """Retrieve the data key new values are encrypted with, or None before the first one."""
+        async with self.db.transaction() as conn:
+            row = conn.execute(
+                f"SELECT {_DATA_KEY_COLUMNS} FROM data_keys ORDER BY version DESC LIMIT 1"
+            ).fetchone()
+        return self._row_to_data_key(row) if row else None
+
+    async def get(self, version: int) -> DataKey:
+        """Retrieve a data key by version."""
+        async with self.db.transaction() as conn:
+            row = conn.execute(f"SELECT {_DATA_KEY_COLUMNS} FROM data_keys WHERE version = ?", (version,)).fetchone()
+        if not row:
+            raise NotFoundError(f"data_key not found: {version}")
+        return self._row_to_data_key(row)
+
+    async def create(self, key: DataKey) -> DataKey:
+        """Store a data key, unless one with its version exists already, and return the stored one."""
+        async with self.db.transaction() as conn:
+            conn.execute(
+                "INSERT OR IGNORE INTO data_keys (version, kms_key_id, wrapped_key, created_at) VALUES (?, ?, ?, ?)",
+                (key.version, key.kms_key_id, key.wrapped_key, _ts(key.created_at))
+            )
+            row = conn.execute(
+                f"SELECT {_DATA_KEY_COLUMNS} FROM data_keys WHERE version = ?", (key.version,)
+            ).fetchone()
+        return self._row_to_data_key(row)
+
+    def _row_to_data_key(self, row: sqlite3.Row) -> DataKey:
+        return DataKey(
+            version=row["version"],
+            kms_key_id=row["kms_key_id"],
+            wrapped_key=bytes(row["wrapped_key"]),
+            created_at=_dt(row["created_at"]),
+        )
+
+
+class SqliteBulkJobRepository:
+    """SQLite bulk job repository."""
+
+    def __init__(self, db: SqliteDatabase, max_page_size: int = MAX_PAGE_SIZE):
+        self.db = db
+        self.max_page_size = max_page_size
+
+    async def create(self, job: BulkJob) -> BulkJob:
+        """Create a running job."""
+        now = datetime.now()
+        job = replace(job, id=new_id(), status="running", created_at=now, updated_at=now)
+        async with self.db.transaction() as conn:
+            conn.execute(
+                """
+                INSERT INTO bulk_jobs (id, kind, params, total, unit, created_at, updated_at)
+                VALUES (?, ?, ?, ?, ?, ?, ?)
+                """,
+                (job.id, job.kind, json.dumps(job.params), job.total, job.unit, _ts(now), _ts(now))
+            )
+        return job
+
+    async def get_by_id(self, id: str) -> BulkJob:
+        """Retrieve a job by ID."""
+        async with self.db.transaction() as conn:
+            row = conn.execute(f"SELECT {_BULK_JOB_COLUMNS} FROM bulk_jobs WHERE id = ?", (id,)).fetchone()
+        if not row:
+            raise NotFoundError(f"bulk_job not found: {id}")
+        return self._row_to_job(row)
+
+    async def list(self, kind: Optional[str], opts: ListOptions) -> Tuple[List[BulkJob], ListResult]:
+        """Retrieve jobs with pagination, optionally of one kind, newest first."""
+        where, params = _where({"kind": kind})
+
+        async with self.db.transaction() as conn:
+            rows, result = _page(
+                conn,
+                f"SELECT {_BULK_JOB_COLUMNS} FROM bulk_jobs {where} ORDER BY created_at DESC",
+                f"SELECT COUNT(*) FROM bulk_jobs {where}",
+                params, opts, self.max_page_size
+            )
+        return [self._row_to_job(row) for row in rows], result
+
+    async def cancel(self, id: str) -> BulkJob:
+        """Cancel a running job; finished jobs are returned unchanged."""
+        now = _ts(datetime.now())
+        async with self.db.transaction() as conn:
+            conn.execute(
+                "UPDATE bulk_jobs SET status = 'cancelled', updated_at = ?, finished_at = ? "
+                "WHERE id = ? AND status = 'running'",
+                (now, now, id)
+            )
+        return await self.get_by_id(id)
+
+    async def restart(self, id: str, stale_seconds: float) -> Optional[BulkJob]:
+        """Set a failed, cancelled or stale running job running again; None if it succeeded or is running."""
+        now = datetime.now()
+        async with self.db.transaction() as conn:
+            cursor = conn.execute(
+                """
+                UPDATE bulk_jobs SET status = 'running', error = '', finished_at = NULL, updated_at = ?
+                WHERE id = ? AND (status IN ('failed', 'cancelled') OR (status = 'running' AND updated_at < ?))
+                """,
+                (_ts(now), id, _ts(now - timedelta(seconds=stale_seconds)))
+            )
+        return await self.get_by_id(id) if cursor.rowcount else None
+
+    async def save_progress(self, job: BulkJob) -> bool:
+        """Record a job's progress and, unless it was cancelled, its status; False if it was cancelled."""
+        now = _ts(datetime.now())
+        async with self.db.transaction() as conn:
+            cursor = conn.execute(
+                """
+                UPDATE bulk_jobs
+                SET processed = ?, total = ?, progress = ?, updated_at = ?,
+                    status = CASE WHEN status = 'running' THEN ? ELSE status END,
+                    error = CASE WHEN status = 'running' THEN ? ELSE error END,
+                    finished_at = CASE WHEN status <> 'running' THEN finished_at WHEN ? THEN ? END
+                WHERE id = ? AND status IN ('running', 'cancelled')
+                """,
+                (
+                    job.processed, job.total, json.dumps(job.progress), now, job.status, job.error,
+                    job.status != "running", now, job.id
+                )
+            )
+            if not cursor.rowcount:
+                return False
+            row = conn.execute(f"SELECT {_BULK_JOB_COLUMNS} FROM bulk_jobs WHERE id = ?", (job.id,)).fetchone()
+        job.status = row["status"]
+        job.updated_at = _dt(row["updated_at"])
+        job.finished_at = _dt(row["finished_at"])
+        return job.status != "cancelled"
+
+    def _row_to_job(self, row: sqlite3.Row) -> BulkJob:
+        return BulkJob(
+            id=row["id"],
+            kind=row["kind"],
+            status=row["status"],
+            params=json.loads(row["params"]),
+            processed=row["processed"],
+            total=row["total"],
+            unit=row["unit"],
+            progress=json.loads(row["progress"]),
+            error=row["error"],
+            created_at=_dt(row["created_at"]),
+            updated_at=_dt(row["updated_at"]),
+            finished_at=_dt(row["finished_at"]),
+        )
@@ -0,0 +1,223 @@
+"""
+Pull subscription repository implementation.
+"""
+
+import json
+import uuid
+from datetime import datetime
+from typing import List, Tuple
+
+import asyncpg
+
+from app.db.database import Database
+from app.repository.models import EventSubscription, SubscriptionMessage, ListOptions, ListResult
+from app.repository.dry_run import transaction
+from app.repository.errors import AlreadyExistsError, NotFoundError
+
+_SUBSCRIPTION_COLUMNS = """
+    s.id, s.name, s.event_types, s.node_type_ids, s.ack_deadline_seconds, s.status, s.created_at, s.updated_at,
+    (SELECT COUNT(*) FROM subscription_messages m WHERE m.subscription_id = s.id) AS backlog
+"""
+
+_MESSAGE_COLUMNS = "id, event_id, event_type, payload::text, delivery_count, created_at, schema_version"
+
+
+class SubscriptionRepository:
+    """PostgreSQL pull subscription and subscription message repository."""
+
+    def __init__(self, db: Database):
+        self.db = db
+
+    async def create(self, subscription: EventSubscription, dry_run: bool = False) -> EventSubscription:
+        """
+        Create a new subscription; it receives the events fanned out from now
+        on. A dry run rolls it back (see dry_run.py).
+        """
+        subscription.id = str(uuid.uuid4())
+        subscription.created_at = datetime.now()
+        subscription.updated_at = datetime.now()
+
+        query = """
+            INSERT INTO event_subscriptions (
+                id, name, event_types, node_type_ids, ack_deadline_seconds, status, created_at, updated_at
+            )
+            VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+        """
+
+        async with self.db.pool.acquire() as conn:
+            try:
+                async with transaction(conn, dry_run):
+                    await conn.execute(
+                        query,
+                        subscription.id, subscription.name, subscription.event_types, subscription.node_type_ids,
+                        subscription.ack_deadline_seconds, subscription.status or "active",
+                        subscription.created_at, subscription.updated_at
+                    )
+            except asyncpg.UniqueViolationError:
+                raise AlreadyExistsError(f"subscription name already exists: {subscription.name}") from None
+
+        if dry_run:
+            return subscription
+        return await self.get_by_id(subscription.id)
+
+    async def get_by_id(self, id: str) -> EventSubscription:
+        """Retrieve a subscription by ID, with its backlog."""
+        _check_id(id)
+        query = f"SELECT {_SUBSCRIPTION_COLUMNS} FROM event_subscriptions s WHERE s.id = $1"
+
+        async with self.db.pool.acquire() as conn:
+            row = await conn.fetchrow(query, id)
+
+        if not row:
+            raise NotFoundError(f"subscription not found: {id}")
+
+        return self._row_to_subscription(row)
+
+    async def update(self, subscription: EventSubscription) -> EventSubscription:
+        """Update an existing subscription."""
+        subscription.updated_at = datetime.now()
+
+        query = """
+            UPDATE event_subscriptions
+            SET event_types = $2, node_type_ids = $3, ack_deadline_seconds = $4, status = $5, updated_at = $6
+            WHERE id = $1
+        """
+
+        async with self.db.pool.acquire() as conn:
+            result = await conn.execute(
+                query,
+                subscription.id, subscription.event_types, subscription.node_type_ids,
+                subscription.ack_deadline_seconds, subscription.status, subscription.updated_at
+            )
+
+        if result == "UPDATE 0":
+            raise NotFoundError(f"subscription not found: {subscription.id}")
+
+        return await self.get_by_id(subscription.id)
+
+    async def delete(self, id: str) -> None:
+        """Delete a subscription and its unacknowledged events."""
+        _check_id(id)
+        query = "DELETE FROM event_subscriptions WHERE id = $1"
+
+        async with self.db.pool.acquire() as conn:
+            result = await conn.execute(query, id)
+
+        if result == "DELETE 0":
+            raise NotFoundError(f"subscription not found: {id}")
+
+    async def list(self, opts: ListOptions) -> Tuple[List[EventSubscription], ListResult]:
+        """Retrieve subscriptions with pagination, by name."""
+        page_size = max(1, min(opts.page_size or 10, 100))
+        offset = 0
+        if opts.page_token:
+            try:
+                offset = int(opts.page_token)
+            except ValueError:
+                offset = 0
+
+        async with self.db.pool.acquire() as conn:
+            total_count = await conn.fetchval("SELECT COUNT(*) FROM event_subscriptions")
+
+            query = f"""
+                SELECT {_SUBSCRIPTION_COLUMNS}
+                FROM event_subscriptions s
+                ORDER BY s.name
+                LIMIT $1 OFFSET $2
+            """
+            rows = await conn.fetch(query, page_size, offset)
+
+        subscriptions = [self._row_to_subscription(row) for row in rows]
+
+        result = ListResult(total_count=total_count)
+        next_offset = offset + len(subscriptions)
+        if next_offset < total_count:
+            result.next_page_token = str(next_offset)
+
+        return subscriptions, result
+
+    async def pull(self, subscription_id: str, limit: int, lease_seconds: int) -> List[SubscriptionMessage]:
+        """
+        Lease up to limit of a subscription's oldest events that are not
+        leased, for lease_seconds. Events not acknowledged before their lease
+        ends are pulled again, with a higher delivery count.
+        """
+        query = f"""
+            WITH batch AS (
+                SELECT id FROM subscription_messages
+                WHERE subscription_id = $1 AND (leased_until IS NULL OR leased_until <= NOW())
+                ORDER BY id
+                LIMIT $2
+                FOR UPDATE SKIP LOCKED
+            )
+            UPDATE subscription_messages m
+            SET leased_until = NOW() + make_interval(secs => $3), delivery_count = m.delivery_count + 1
+            FROM batch
+            WHERE m.id = batch.id
+            RETURNING {", ".join("m." + column for column in _MESSAGE_COLUMNS.split(", "))}
+        """
+
+        _check_id(subscription_id)
+        async with self.db.pool.acquire() as conn:
+            rows = await conn.fetch(query, subscription_id, limit, lease_seconds)
+
+        messages = [self._row_to_message(row) for row in rows]
+        messages.sort(key=lambda m: int(m.ack_id))
+        return messages
+
+    async def ack(self, subscription_id: str, ack_ids: List[int]) -> int:
+        """Remove acknowledged events from a subscription; returns the number removed."""
+        query = "DELETE FROM subscription_messages WHERE subscription_id = $1 AND id = ANY($2::bigint[])"
+
+        _check_id(subscription_id)
+        async with self.db.pool.acquire() as conn:
+            result = await conn.execute(query, subscription_id, ack_ids)
+
+        return int(result.split()[-1])
+
+    async def nack(self, subscription_id: str, ack_ids: List[int]) -> int:
+        """End the lease of pulled events so they are pulled again at once; returns the number released."""
+        query = """
+            UPDATE subscription_messages SET leased_until = NULL
+            WHERE subscription_id = $1 AND id = ANY($2::bigint[]) AND leased_until > NOW()
+        """
+
+        _check_id(subscription_id)
+        async with self.db.pool.acquire() as conn:
+            result = await conn.execute(query, subscription_id, ack_ids)
+
+        return int(result.split()[-1])
+
+    def _row_to_subscription(self, row: asyncpg.Record) -> EventSubscription:
+        """Convert a database row to an EventSubscription object."""
+        return EventSubscription(
+            id=str(row[0]),
+            name=row[1],
+            event_types=list(row[2] or []),
+            node_type_ids=list(row[3] or []),
+            ack_deadline_seconds=row[4],
+            status=row[5],
+            created_at=row[6],
+            updated_at=row[7],
+            backlog=row[8],
+        )
+
+    def _row_to_message(self, row: asyncpg.Record) -> SubscriptionMessage:
+        """Convert a database row to a SubscriptionMessage object."""
+        return SubscriptionMessage(
+            ack_id=str(row[0]),
+            event_id=str(row[1]),
+            event_type=row[2],
+            payload=json.loads(row[3] or "{}"),
+            delivery_count=row[4],
+            created_at=row[5],
+            schema_version=row[6],
+        )
+
+
+def _check_id(id: str) -> None:
+    """Raise NotFoundError for IDs that aren't UUIDs, which no subscription has."""
+    try:
+        uuid.UUID(id)
+    except ValueError:
+        raise NotFoundError(f"subscription not found: {id}") from None
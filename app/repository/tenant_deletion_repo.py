@@ -0,0 +1,210 @@
+"""
+Tenant deletion repository implementation.
+"""
+
+import json
+from typing import Optional
+
+import asyncpg
+
+from app.db.database import Database
+from app.repository.models import TenantDeletion
+from app.repository.errors import NotFoundError
+
+_DELETION_COLUMNS = """
+    tenant_id, slug, database_name, archive_database, status, step, progress::text, error,
+    created_at, updated_at, finished_at
+"""
+
+# Control database tables emptied by the steps of the same name
+_CONTROL_TABLES = {
+    "memberships": "tenant_users",
+    "api_keys": "api_keys",
+    "audit_events": "audit_events",
+}
+
+# Tenant database tables emptied by the steps of the same name; children first
+_TENANT_TABLES = {
+    "relationships": "relationships",
+    "nodes": "nodes",
+    "node_types": "node_types",
+}
+
+
+async def delete_tenant_rows(db: Database, step: str, batch_size: int) -> int:
+    """Delete up to batch_size rows of a tenant database table by its deletion step; returns the number deleted."""
+    table = _TENANT_TABLES[step]
+    query = f"DELETE FROM {table} WHERE id IN (SELECT id FROM {table} LIMIT $1 FOR UPDATE SKIP LOCKED)"
+
+    async with db.pool.acquire() as conn:
+        result = await conn.execute(query, batch_size)
+
+    return int(result.split()[-1])
+
+
+class TenantDeletionRepository:
+    """PostgreSQL repository of tenant deletions (control database)."""
+
+    def __init__(self, db: Database):
+        self.db = db
+
+    async def start(self, tenant_id: str) -> TenantDeletion:
+        """
+        Mark a tenant deleting and queue its deletion.
+
+        A deletion already queued or running is returned unchanged; a failed
+        one is queued again and resumes with the step it failed in.
+        """
+        async with self.db.pool.acquire() as conn:
+            async with conn.transaction():
+                tenant = await conn.fetchrow(
+                    "SELECT slug, archive_database FROM tenants WHERE id = $1 FOR UPDATE", tenant_id
+                )
+                if not tenant:
+                    raise NotFoundError(f"tenant not found: {tenant_id}")
+
+                row = await conn.fetchrow(
+                    f"""
+                    UPDATE tenant_deletions
+                    SET status = 'pending', error = NULL, lease_until = NULL, updated_at = NOW(), finished_at = NULL
+                    WHERE tenant_id = $1 AND status = 'failed'
+                    RETURNING {_DELETION_COLUMNS}
+                    """,
+                    tenant_id
+                )
+                if not row:
+                    row = await conn.fetchrow(
+                        f"SELECT {_DELETION_COLUMNS} FROM tenant_deletions WHERE tenant_id = $1", tenant_id
+                    )
+                if row:
+                    return self._row_to_deletion(row)
+
+                database_name = await conn.fetchval(
+                    "SELECT database_name FROM tenant_databases WHERE tenant_id = $1", tenant_id
+                )
+                await conn.execute(
+                    """
+                    UPDATE tenants
+                    SET status = 'deleting', status_reason = 'deleted', status_changed_at = NOW(), updated_at = NOW()
+                    WHERE id = $1
+                    """,
+                    tenant_id
+                )
+                row = await conn.fetchrow(
+                    f"""
+                    INSERT INTO tenant_deletions (tenant_id, slug, database_name, archive_database)
+                    VALUES ($1, $2, $3, $4)
+                    RETURNING {_DELETION_COLUMNS}
+                    """,
+                    tenant_id, tenant["slug"], database_name or "", tenant["archive_database"]
+                )
+
+        return self._row_to_deletion(row)
+
+    async def get(self, tenant_id: str) -> TenantDeletion:
+        """Retrieve the deletion of a tenant."""
+        query = f"SELECT {_DELETION_COLUMNS} FROM tenant_deletions WHERE tenant_id = $1"
+
+        async with self.db.pool.acquire() as conn:
+            row = await conn.fetchrow(query, tenant_id)
+
+        if not row:
+            raise NotFoundError(f"tenant deletion not found: {tenant_id}")
+
+        return self._row_to_deletion(row)
+
+    async def claim(self, lease_seconds: float) -> Optional[TenantDeletion]:
+        """
+        Claim the oldest pending deletion, or a running one whose lease expired.
+
+        The claimed deletion is marked running with a lease of lease_seconds,
+        so only one server instance works on it at a time. Returns None when
+        there is nothing to do.
+        """
+        query = f"""
+            UPDATE tenant_deletions
+            SET status = 'running', lease_until = NOW() + make_interval(secs => $1), updated_at = NOW()
+            WHERE tenant_id = (
+                SELECT tenant_id FROM tenant_deletions
+                WHERE status = 'pending' OR (status = 'running' AND lease_until < NOW())
+                ORDER BY created_at
+                LIMIT 1
+                FOR UPDATE SKIP LOCKED
+            )
+            RETURNING {_DELETION_COLUMNS}
+        """
+
+        async with self.db.pool.acquire() as conn:
+            row = await conn.fetchrow(query, lease_seconds)
+
+        return self._row_to_deletion(row) if row else None
+
+    async def save_progress(self, deletion: TenantDeletion, lease_seconds: float) -> bool:
+        """
+        Record a running deletion's step, progress and status, extending its lease.
+
+        Returns False, without saving anything, if the deletion is no longer running.
+        """
+        finished = deletion.status != "running"
+        query = """
+            UPDATE tenant_deletions
+            SET status = $2, step = $3, progress = $4::jsonb, error = $5, updated_at = NOW(),
+                lease_until = CASE WHEN $6::boolean THEN NULL ELSE NOW() + make_interval(secs => $7) END,
+                finished_at = CASE WHEN $6::boolean THEN NOW() END
+            WHERE tenant_id = $1 AND status = 'running'
+            RETURNING updated_at, finished_at
+        """
+
+        async with self.db.pool.acquire() as conn:
+            row = await conn.fetchrow(
+                query,
+                deletion.tenant_id, deletion.status, deletion.step, json.dumps(deletion.progress),
+                deletion.error or None, finished, lease_seconds
+            )
+
+        if not row:
+            return False
+        deletion.updated_at = row["updated_at"]
+        deletion.finished_at = row["finished_at"]
+        return True
+
+    async def delete_control_rows(self, tenant_id: str, step: str, batch_size: int) -> int:
+        """Delete up to batch_size of a tenant's rows of a control table by its deletion step; returns the number."""
+        table = _CONTROL_TABLES[step]
+        query = f"""
+            DELETE FROM {table}
+            WHERE ctid IN (SELECT ctid FROM {table} WHERE tenant_id = $1 LIMIT $2 FOR UPDATE SKIP LOCKED)
+        """
+
+        async with self.db.pool.acquire() as conn:
+            result = await conn.execute(query, tenant_id, batch_size)
+
+        return int(result.split()[-1])
+
+    async def delete_tenant(self, tenant_id: str) -> int:
+        """
+        Delete a tenant with its database mapping, migration records and
+        quota, once its databases are dropped; returns 1, or 0 if it was already deleted.
+        """
+        async with self.db.pool.acquire() as conn:
+            async with conn.transaction():
+                await conn.execute("DELETE FROM tenant_migrations WHERE tenant_id = $1", tenant_id)
+                result = await conn.execute("DELETE FROM tenants WHERE id = $1", tenant_id)
+
+        return int(result.split()[-1])
+
+    def _row_to_deletion(self, row: asyncpg.Record) -> TenantDeletion:
+        """Convert a database row to a TenantDeletion object."""
+        return TenantDeletion(
+            tenant_id=str(row["tenant_id"]),
+            slug=row["slug"],
+            database_name=row["database_name"],
+            archive_database=row["archive_database"],
+            status=row["status"],
+            step=row["step"],
+            progress=json.loads(row["progress"]) if row["progress"] else {},
+            error=row["error"] or "",
+            created_at=row["created_at"],
+            updated_at=row["updated_at"],
+            finished_at=row["finished_at"],
+        )
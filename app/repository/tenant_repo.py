@@ -4,13 +4,16 @@ Tenant repository implementation.
 
 import uuid
 from datetime import datetime
-from typing import List, Tuple
+from typing import Iterable, List, Optional, Tuple
 
 import asyncpg
 
 from app.db.database import Database
-from app.repository.models import Tenant, ListOptions, ListResult
-from app.repository.errors import NotFoundError
+from app.repository.models import Tenant, TenantSlugChange, ListOptions, ListResult
+from app.repository.errors import ConflictError, FailedPreconditionError, NotFoundError
+
+_TENANT_COLUMNS = "id, slug, name, status, created_at, updated_at, status_reason, status_changed_at, archive_database"
+_SLUG_CHANGE_COLUMNS = "tenant_id, old_slug, new_slug, actor, changed_at"
 
 
 class TenantRepository:
@@ -27,10 +30,10 @@ class TenantRepository:
         if not tenant.status:
             tenant.status = "active"
 
-        query = """
+        query = f"""
             INSERT INTO tenants (id, slug, name, status, created_at, updated_at)
             VALUES ($1, $2, $3, $4, $5, $6)
-            RETURNING id, slug, name, status, created_at, updated_at
+            RETURNING {_TENANT_COLUMNS}
         """
 
         async with self.db.pool.acquire() as conn:
@@ -44,7 +47,7 @@ class TenantRepository:
 
     async def get_by_id(self, id: str) -> Tenant:
         """Retrieve a tenant by ID."""
-        query = "SELECT id, slug, name, status, created_at, updated_at FROM tenants WHERE id = $1"
+        query = f"SELECT {_TENANT_COLUMNS} FROM tenants WHERE id = $1"
 
         async with self.db.pool.acquire() as conn:
             row = await conn.fetchrow(query, id)
@@ -54,15 +57,96 @@ class TenantRepository:
 
         return self._row_to_tenant(row)
 
+    async def get_by_slug(self, slug: str) -> Tenant:
+        """Retrieve a tenant by its slug."""
+        query = f"SELECT {_TENANT_COLUMNS} FROM tenants WHERE slug = $1"
+
+        async with self.db.pool.acquire() as conn:
+            row = await conn.fetchrow(query, slug)
+
+        if not row:
+            raise NotFoundError(f"tenant not found: {slug}")
+
+        return self._row_to_tenant(row)
+
+    async def get_by_former_slug(self, slug: str) -> Optional[Tenant]:
+        """Retrieve the tenant most recently renamed from slug, or None if none was."""
+        query = f"""
+            SELECT {_TENANT_COLUMNS} FROM tenants WHERE id = (
+                SELECT tenant_id FROM tenant_slug_changes
+                WHERE old_slug = $1
+                ORDER BY changed_at DESC, id DESC
+                LIMIT 1
+            )
+        """
+
+        async with self.db.pool.acquire() as conn:
+            row = await conn.fetchrow(query, slug)
+
+        return self._row_to_tenant(row) if row else None
+
+    async def rename_slug(self, id: str, slug: str, actor: str) -> Tenant:
+        """
+        Change a tenant's slug and record the change; renaming it to its
+        current slug changes nothing. Raises ConflictError if another tenant
+        has the slug.
+        """
+        query = f"""
+            UPDATE tenants SET slug = $2, updated_at = $3
+            WHERE id = $1
+            RETURNING {_TENANT_COLUMNS}
+        """
+
+        async with self.db.pool.acquire() as conn:
+            async with conn.transaction():
+                old_slug = await conn.fetchval("SELECT slug FROM tenants WHERE id = $1 FOR UPDATE", id)
+                if old_slug is None:
+                    raise NotFoundError(f"tenant not found: {id}")
+                if old_slug == slug:
+                    row = await conn.fetchrow(f"SELECT {_TENANT_COLUMNS} FROM tenants WHERE id = $1", id)
+                    return self._row_to_tenant(row)
+                try:
+                    row = await conn.fetchrow(query, id, slug, datetime.now())
+                except asyncpg.UniqueViolationError:
+                    raise ConflictError(f"tenant slug already exists: {slug}") from None
+                await conn.execute(
+                    "INSERT INTO tenant_slug_changes (tenant_id, old_slug, new_slug, actor) VALUES ($1, $2, $3, $4)",
+                    id, old_slug, slug, actor
+                )
+
+        return self._row_to_tenant(row)
+
+    async def list_slug_changes(self, id: str) -> List[TenantSlugChange]:
+        """Retrieve the slug changes of a tenant, oldest first."""
+        query = f"""
+            SELECT {_SLUG_CHANGE_COLUMNS} FROM tenant_slug_changes
+            WHERE tenant_id = $1
+            ORDER BY changed_at, id
+        """
+
+        async with self.db.pool.acquire() as conn:
+            rows = await conn.fetch(query, id)
+
+        return [
+            TenantSlugChange(
+                tenant_id=str(row["tenant_id"]),
+                old_slug=row["old_slug"],
+                new_slug=row["new_slug"],
+                actor=row["actor"],
+                changed_at=row["changed_at"],
+            )
+            for row in rows
+        ]
+
     async def update(self, tenant: Tenant) -> Tenant:
         """Update an existing tenant."""
         tenant.updated_at = datetime.now()
 
-        query = """
+        query = f"""
             UPDATE tenants 
             SET slug = $2, name = $3, status = $4, updated_at = $5
             WHERE id = $1
-            RETURNING id, slug, name, status, created_at, updated_at
+            RETURNING {_TENANT_COLUMNS}
         """
 
         async with self.db.pool.acquire() as conn:
@@ -76,6 +160,37 @@ class TenantRepository:
 
         return self._row_to_tenant(row)
 
+    async def set_status(
+        self,
+        id: str,
+        status: str,
+        from_statuses: Iterable[str],
+        reason: str,
+        archive_database: Optional[str] = None
+    ) -> Tenant:
+        """
+        Change a tenant's status if it currently is one of from_statuses;
+        otherwise FailedPreconditionError is raised. archive_database is kept unless given.
+        """
+        now = datetime.now()
+        query = f"""
+            UPDATE tenants
+            SET status = $2, status_reason = $3, status_changed_at = $4, updated_at = $4,
+                archive_database = COALESCE($5, archive_database)
+            WHERE id = $1 AND status = ANY($6::text[])
+            RETURNING {_TENANT_COLUMNS}
+        """
+
+        async with self.db.pool.acquire() as conn:
+            row = await conn.fetchrow(query, id, status, reason, now, archive_database, list(from_statuses))
+            if not row:
+                current = await conn.fetchval("SELECT status FROM tenants WHERE id = $1", id)
+                if current is None:
+                    raise NotFoundError(f"tenant not found: {id}")
+                raise FailedPreconditionError(f"tenant {id} is {current}, not {' or '.join(from_statuses)}")
+
+        return self._row_to_tenant(row)
+
     async def delete(self, id: str) -> None:
         """Delete a tenant by ID."""
         query = "DELETE FROM tenants WHERE id = $1"
@@ -102,8 +217,8 @@ class TenantRepository:
             total_count = await conn.fetchval("SELECT COUNT(*) FROM tenants")
 
             # Get tenants
-            query = """
-                SELECT id, slug, name, status, created_at, updated_at 
+            query = f"""
+                SELECT {_TENANT_COLUMNS}
                 FROM tenants 
                 ORDER BY created_at DESC 
                 LIMIT $1 OFFSET $2
@@ -128,4 +243,7 @@ class TenantRepository:
             status=row["status"],
             created_at=row["created_at"],
             updated_at=row["updated_at"],
+            status_reason=row["status_reason"],
+            status_changed_at=row["status_changed_at"],
+            archive_database=row["archive_database"],
         )
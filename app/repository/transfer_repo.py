@@ -0,0 +1,264 @@
+"""
+Tenant data export/import repository implementation.
+"""
+
+import json
+import uuid
+from dataclasses import dataclass, replace
+from datetime import datetime
+from typing import AsyncIterator, Dict, List, Optional, Tuple, TypeVar, Union
+
+import asyncpg
+
+from app.db.database import Database
+from app.repository.errors import NotFoundError
+from app.repository.models import ChangeFeedPosition, NodeType, Node, Relationship
+from app.repository.nodetype_repo import NodeTypeRepository
+from app.repository.node_lock_repo import check_node_locks
+from app.repository.node_repo import NodeRepository, record_revisions
+from app.repository.outbox_repo import change_feed_position, event_schema_version
+from app.repository.relationship_repo import RelationshipRepository
+from app.repository.unique_keys import (
+    create_unique_indexes,
+    find_by_unique_key,
+    unique_key_values,
+    unique_key_violation,
+)
+
+ExportRecord = Union[ChangeFeedPosition, NodeType, Node, Relationship]
+R = TypeVar("R", NodeType, Node, Relationship)
+
+# Record types of exports, in the order they are streamed
+EXPORT_RECORD_TYPES = ("node_type", "node", "relationship")
+
+
+@dataclass
+class ExportPosition:
+    """The last record an export streamed; an export resumed from it continues with the next."""
+    record_type: str  # node_type | node | relationship
+    created_at: datetime
+    id: str
+
+_EVENT_QUERY = """
+    INSERT INTO outbox_events (event_id, event_type, entity_type, entity_id, payload, schema_version)
+    VALUES ($1, $2, $3, $4, $5::jsonb, $6)
+"""
+
+
+class TransferRepository:
+    """PostgreSQL bulk export and import of a tenant's node types, nodes and relationships."""
+
+    def __init__(self, db: Database):
+        self.db = db
+        # Reuse the entity repositories' row mappers
+        self._node_types = NodeTypeRepository(db)
+        self._nodes = NodeRepository(db)
+        self._relationships = RelationshipRepository(db)
+
+    async def stream_export(
+        self,
+        batch_size: int,
+        after: Optional[ExportPosition] = None
+    ) -> AsyncIterator[ExportRecord]:
+        """
+        Stream the change feed position of the export, then all node types,
+        then nodes, then relationships; with after, only the records streamed
+        after that position.
+
+        Everything is read inside one read-only repeatable-read transaction, so
+        the export is a consistent snapshot and every reference points at a
+        record streamed earlier; list_changes from the position lists exactly
+        the changes it misses. The connection is held until the iterator is
+        exhausted or closed.
+        """
+        queries = (
+            ("""
+                SELECT id, name, description, COALESCE(schema::text, ''), created_at, updated_at, version, display::text, schema_version, unique_keys::text
+                FROM node_types {where} ORDER BY created_at, id
+            """, self._node_types._row_to_node_type),
+            ("""
+                SELECT id, node_type_id, data::text, created_at, updated_at, version, schema_version
+                FROM nodes {where} ORDER BY created_at, id
+            """, self._nodes._row_to_node),
+            ("""
+                SELECT id, source_node_id, target_node_id, relationship_type, data::text, created_at, updated_at, version
+                FROM relationships {where} ORDER BY created_at, id
+            """, self._relationships._row_to_relationship),
+        )
+        skip = EXPORT_RECORD_TYPES.index(after.record_type) if after else 0
+
+        async with self.db.pool.acquire() as conn:
+            async with conn.transaction(isolation="repeatable_read", readonly=True):
+                yield await change_feed_position(conn)
+                for i, (query, mapper) in enumerate(queries):
+                    if i < skip:
+                        continue
+                    args = []
+                    where = ""
+                    if after and i == skip:
+                        where = "WHERE (created_at, id) > ($1, $2::uuid)"
+                        args = [after.created_at, after.id]
+                    async for row in conn.cursor(query.format(where=where), *args, prefetch=batch_size):
+                        yield mapper(row)
+
+    async def find_by_unique_keys(
+        self,
+        nodes: List[Node],
+        unique_keys: Dict[str, List[List[str]]]
+    ) -> Dict[str, Node]:
+        """
+        Return the existing nodes having the values of nodes for a unique key
+        of their node type (unique_keys by node type ID), by the ID of the node
+        they match.
+        """
+        matches: Dict[str, str] = {}
+        async with self.db.pool.acquire() as conn:
+            for node_type_id, keys in unique_keys.items():
+                data = {n.id: json.loads(n.data or "{}") for n in nodes if n.node_type_id == node_type_id}
+                for fields in keys:
+                    values = {}
+                    for id, doc in data.items():
+                        key = unique_key_values(doc, fields) if id not in matches else None
+                        if key is not None:
+                            values[id] = key
+                    matches.update(await find_by_unique_key(conn, node_type_id, fields, values))
+            if not matches:
+                return {}
+            rows = await conn.fetch(
+                """
+                SELECT id, node_type_id, data::text, created_at, updated_at, version, schema_version
+                FROM nodes WHERE id = ANY($1::uuid[])
+                """,
+                list(set(matches.values()))
+            )
+        existing = {node.id: node for node in map(self._nodes._row_to_node, rows)}
+        return {id: existing[match] for id, match in matches.items() if match in existing}
+
+    async def import_batch(
+        self,
+        node_types: List[NodeType],
+        nodes: List[Node],
+        relationships: List[Relationship],
+        skip_existing: bool = False,
+        updated_nodes: Optional[List[Node]] = None
+    ) -> int:
+        """
+        Insert a batch of records with their IDs already assigned, in one transaction.
+
+        A created event is recorded for every record, as for individual creates,
+        and the unique keys of node types are enforced from the start. Raises
+        AlreadyExistsError if nodes violate a unique key. With skip_existing,
+        records whose ID exists already are skipped; returns how many were.
+        updated_nodes replace the data of existing nodes first, each recorded
+        as an update; NodeLockedError is raised if one of them has an enforced
+        lock.
+        """
+        count = len(node_types) + len(nodes) + len(relationships)
+        async with self.db.pool.acquire() as conn:
+            try:
+                async with conn.transaction():
+                    if skip_existing:
+                        node_types = await _without_existing(conn, "node_types", node_types)
+                        nodes = await _without_existing(conn, "nodes", nodes)
+                        relationships = await _without_existing(conn, "relationships", relationships)
+                    updated = await self._update_nodes(conn, updated_nodes or [])
+                    if node_types:
+                        await conn.executemany(
+                            """
+                            INSERT INTO node_types
+                                (id, name, description, schema, display, created_at, updated_at, unique_keys)
+                            VALUES ($1, $2, $3, $4::jsonb, $5::jsonb, $6, $7, $8::jsonb)
+                            """,
+                            [
+                                (t.id, t.name, t.description, t.schema or None, t.display or "{}",
+                                 t.created_at, t.updated_at, json.dumps(t.unique_keys))
+                                for t in node_types
+                            ]
+                        )
+                        for t in node_types:
+                            await create_unique_indexes(conn, t.id, t.unique_keys)
+                    if nodes:
+                        await conn.executemany(
+                            """
+                            INSERT INTO nodes (id, node_type_id, data, created_at, updated_at, schema_version)
+                            VALUES ($1, $2, $3::jsonb, $4, $5, $6)
+                            """,
+                            [
+                                (n.id, n.node_type_id, n.data or "{}", n.created_at, n.updated_at, n.schema_version)
+                                for n in nodes
+                            ]
+                        )
+                        # Imported nodes start over at version 1, as of their last update
+                        await record_revisions(conn, "created", [replace(n, version=1) for n in nodes])
+                    if relationships:
+                        await conn.executemany(
+                            """
+                            INSERT INTO relationships
+                                (id, source_node_id, target_node_id, relationship_type, data, created_at, updated_at)
+                            VALUES ($1, $2, $3, $4, $5::jsonb, $6, $7)
+                            """,
+                            [
+                                (r.id, r.source_node_id, r.target_node_id, r.relationship_type, r.data or "{}",
+                                 r.created_at, r.updated_at)
+                                for r in relationships
+                            ]
+                        )
+                    await self._record_events(conn, node_types, nodes, relationships, updated)
+            except asyncpg.UniqueViolationError as e:
+                raise await unique_key_violation(conn, e) or e
+
+        return count - len(node_types) - len(nodes) - len(relationships)
+
+    async def _update_nodes(self, conn: asyncpg.Connection, nodes: List[Node]) -> List[Node]:
+        if nodes:
+            await check_node_locks(conn, [node.id for node in nodes])
+        updated = []
+        for node in nodes:
+            row = await conn.fetchrow(
+                """
+                UPDATE nodes
+                SET data = $2::jsonb, updated_at = $3, version = version + 1, schema_version = $4
+                WHERE id = $1
+                RETURNING id, node_type_id, data::text, created_at, updated_at, version, schema_version
+                """,
+                node.id, node.data or "{}", node.updated_at, node.schema_version
+            )
+            if not row:
+                raise NotFoundError(f"node not found: {node.id}")
+            updated.append(self._nodes._row_to_node(row))
+        if updated:
+            await record_revisions(conn, "updated", updated)
+        return updated
+
+    async def _record_events(
+        self,
+        conn: asyncpg.Connection,
+        node_types: List[NodeType],
+        nodes: List[Node],
+        relationships: List[Relationship],
+        updated_nodes: List[Node]
+    ) -> None:
+        events: List[Tuple[str, str, str, str, str, int]] = []
+        for entity_type, action, records in (
+            ("node", "updated", updated_nodes),
+            ("node_type", "created", node_types),
+            ("node", "created", nodes),
+            ("relationship", "created", relationships),
+        ):
+            for record in records:
+                event_type = f"{entity_type}.{action}"
+                events.append((
+                    str(uuid.uuid4()), event_type, entity_type, record.id,
+                    json.dumps({entity_type: record.to_dict()}), event_schema_version(event_type),
+                ))
+        if events:
+            await conn.executemany(_EVENT_QUERY, events)
+
+
+async def _without_existing(conn: asyncpg.Connection, table: str, records: List[R]) -> List[R]:
+    """Return the records of table whose ID doesn't exist yet."""
+    if not records:
+        return records
+    rows = await conn.fetch(f"SELECT id FROM {table} WHERE id = ANY($1::uuid[])", [r.id for r in records])
+    existing = {str(row["id"]) for row in rows}
+    return [r for r in records if r.id not in existing]
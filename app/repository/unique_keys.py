@@ -0,0 +1,105 @@
+"""
+Unique keys of node types.
+
+A node type may declare unique keys, each a list of data fields whose values
+must be unique among the node type's nodes (within the tenant, as each tenant
+has its own database). Every key is enforced by a partial unique expression
+index on nodes, created with the node type:
+
+    CREATE UNIQUE INDEX nodes_unique_<node type ID>_<n>
+        ON nodes ((data -> 'email')) WHERE node_type_id = '<node type ID>'
+
+Values are compared as JSON, so 1 and "1" differ. Like SQL unique
+constraints, a node missing any field of a key never conflicts on it.
+"""
+
+import json
+import re
+import uuid
+from typing import Any, Dict, List, Optional
+
+import asyncpg
+
+from app.repository.errors import AlreadyExistsError
+
+UNIQUE_INDEX_PREFIX = "nodes_unique_"
+
+_INDEX_NAME = re.compile(rf"^{UNIQUE_INDEX_PREFIX}([0-9a-f]{{32}})_(\d+)$")
+
+
+def unique_index_name(node_type_id: str, key: int) -> str:
+    """Return the name of the index enforcing a node type's key-th unique key."""
+    return f"{UNIQUE_INDEX_PREFIX}{node_type_id.replace('-', '')}_{key}"
+
+
+def _literal(value: str) -> str:
+    return "'" + value.replace("'", "''") + "'"
+
+
+async def create_unique_indexes(conn: asyncpg.Connection, node_type_id: str, unique_keys: List[List[str]]) -> None:
+    """Create the indexes enforcing a node type's unique keys, using the caller's transaction."""
+    for i, fields in enumerate(unique_keys):
+        columns = ", ".join(f"(data -> {_literal(field)})" for field in fields)
+        await conn.execute(
+            f"CREATE UNIQUE INDEX {unique_index_name(node_type_id, i)} ON nodes ({columns}) "
+            f"WHERE node_type_id = {_literal(node_type_id)}"
+        )
+
+
+def unique_key_values(data: Dict[str, Any], fields: List[str]) -> Optional[List[Any]]:
+    """Return node data's values for a unique key, or None if it misses a field, so never conflicts on it."""
+    if any(name not in data for name in fields):
+        return None
+    return [data[name] for name in fields]
+
+
+async def find_by_unique_key(
+    conn: asyncpg.Connection,
+    node_type_id: str,
+    fields: List[str],
+    values: Dict[str, List[Any]]
+) -> Dict[str, str]:
+    """
+    Return the IDs of the node type's nodes having the values for the unique
+    key of fields of a node in values (values by node ID), by that node's ID.
+    The node type ID is inlined so the key's partial index is used.
+    """
+    if not values:
+        return {}
+    matches = " AND ".join(f"n.data -> {_literal(field)} = v.value -> {i}" for i, field in enumerate(fields))
+    rows = await conn.fetch(
+        f"""
+        SELECT v.key, n.id FROM unnest($1::text[], $2::jsonb[]) AS v(key, value)
+        JOIN nodes n ON n.node_type_id = {_literal(node_type_id)} AND {matches}
+        """,
+        list(values), [json.dumps(v) for v in values.values()]
+    )
+    return {row["key"]: str(row["id"]) for row in rows}
+
+
+async def drop_unique_indexes(conn: asyncpg.Connection, node_type_id: str, unique_keys: List[List[str]]) -> None:
+    """Drop the indexes enforcing a node type's unique keys, using the caller's transaction."""
+    for i in range(len(unique_keys)):
+        await conn.execute(f"DROP INDEX IF EXISTS {unique_index_name(node_type_id, i)}")
+
+
+async def unique_key_violation(
+    conn: asyncpg.Connection,
+    err: asyncpg.UniqueViolationError
+) -> Optional[AlreadyExistsError]:
+    """
+    Return an AlreadyExistsError naming the fields of the unique key a write
+    violated, or None if err isn't about a unique key. conn must not be in the
+    failed transaction.
+    """
+    match = _INDEX_NAME.match(err.constraint_name or "")
+    if not match:
+        return None
+    node_type_id = str(uuid.UUID(match.group(1)))
+    key = int(match.group(2))
+
+    unique_keys = json.loads(
+        await conn.fetchval("SELECT unique_keys::text FROM node_types WHERE id = $1", node_type_id) or "[]"
+    )
+    fields = ", ".join(unique_keys[key]) if key < len(unique_keys) else "unique key"
+    return AlreadyExistsError(f"node with the same {fields} already exists in node_type {node_type_id}")
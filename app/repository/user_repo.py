@@ -51,6 +51,18 @@ class UserRepository:
 
         return self._row_to_user(row)
 
+    async def get_by_email(self, email: str) -> User:
+        """Retrieve a user by email address."""
+        query = "SELECT id, email, display_name, created_at, updated_at FROM users WHERE email = $1"
+
+        async with self.db.pool.acquire() as conn:
+            row = await conn.fetchrow(query, email)
+
+        if not row:
+            raise NotFoundError(f"user not found: {email}")
+
+        return self._row_to_user(row)
+
     async def update(self, user: User) -> User:
         """Update an existing user."""
         user.updated_at = datetime.now()
@@ -179,6 +191,42 @@ class UserRepository:
 
         return tenant_users, result
 
+    async def set_password_hash(self, user_id: str, password_hash: str) -> None:
+        """Store a user's password hash, replacing any previous one."""
+        query = """
+            INSERT INTO user_credentials (user_id, password_hash, updated_at)
+            SELECT id, $2, NOW() FROM users WHERE id = $1
+            ON CONFLICT (user_id) DO UPDATE SET password_hash = $2, updated_at = NOW()
+        """
+
+        async with self.db.pool.acquire() as conn:
+            result = await conn.execute(query, user_id, password_hash)
+
+        if result == "INSERT 0 0":
+            raise NotFoundError(f"user not found: {user_id}")
+
+    async def get_password_hash(self, user_id: str) -> str:
+        """Retrieve a user's password hash, or "" if they have no password."""
+        async with self.db.pool.acquire() as conn:
+            password_hash = await conn.fetchval(
+                "SELECT password_hash FROM user_credentials WHERE user_id = $1", user_id
+            )
+        return password_hash or ""
+
+    async def list_memberships(self, user_id: str) -> List[TenantUser]:
+        """List a user's memberships in every tenant."""
+        query = """
+            SELECT tenant_id, user_id, role, status
+            FROM tenant_users
+            WHERE user_id = $1
+            ORDER BY tenant_id
+        """
+
+        async with self.db.pool.acquire() as conn:
+            rows = await conn.fetch(query, user_id)
+
+        return [self._row_to_tenant_user(row) for row in rows]
+
     def _row_to_user(self, row: asyncpg.Record) -> User:
         """Convert a database row to a User object."""
         return User(
@@ -0,0 +1,56 @@
+"""
+Optimistic concurrency helpers.
+
+Versioned entities (node types, nodes, relationships) carry a version that is
+incremented on every update. Updates may pass an expected version; the UPDATE
+only matches when it equals the stored version.
+
+Each also exposes its version as an entity tag ('"3"'), which callers holding
+a fetched entity pass back as if_match, like HTTP If-Match.
+"""
+
+import re
+from typing import Optional
+
+import asyncpg
+
+from app.repository.errors import ConflictError, NotFoundError, ValidationError
+
+# '"3"', optionally weak (W/"3"); quotes are optional for hand-written tags
+_ETAG = re.compile(r'^(?:W/)?"?(\d+)"?$')
+
+
+def expected_version_from(expected_version: Optional[int], if_match: str) -> Optional[int]:
+    """
+    Return the version a conditional write expects, from expected_version or
+    an entity tag; "*" and an empty tag match any version. Raises
+    ValidationError if the tag is malformed or names another version than
+    expected_version.
+    """
+    if expected_version is not None and expected_version < 1:
+        raise ValidationError("expected_version", "must be a positive integer")
+    if_match = (if_match or "").strip()
+    if not if_match or if_match == "*":
+        return expected_version
+
+    match = _ETAG.match(if_match)
+    if not match or int(match.group(1)) < 1:
+        raise ValidationError("if_match", f"is not a valid entity tag: {if_match}")
+    version = int(match.group(1))
+    if expected_version is not None and expected_version != version:
+        raise ValidationError("if_match", "names another version than expected_version")
+    return version
+
+
+async def raise_update_failure(
+    conn: asyncpg.Connection,
+    table: str,
+    entity: str,
+    id: str,
+    expected_version: Optional[int]
+) -> None:
+    """Raise NotFoundError or ConflictError after a versioned UPDATE matched no row."""
+    current = await conn.fetchval(f"SELECT version FROM {table} WHERE id = $1", id)
+    if current is None:
+        raise NotFoundError(f"{entity} not found: {id}")
+    raise ConflictError(f"{entity} {id} has version {current}, expected {expected_version}")
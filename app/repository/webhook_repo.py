@@ -0,0 +1,329 @@
+"""
+Webhook repository implementation.
+"""
+
+import json
+import uuid
+from datetime import datetime
+from typing import List, Optional, Tuple
+
+import asyncpg
+
+from app.db.database import Database
+from app.repository.dead_letter_repo import add_dead_letter
+from app.repository.models import (
+    DEAD_LETTER_WEBHOOK_DELIVERY,
+    WebhookEndpoint,
+    WebhookDelivery,
+    ListOptions,
+    ListResult,
+)
+from app.repository.errors import NotFoundError
+
+
+_ENDPOINT_COLUMNS = """
+    id, url, secret, event_types, COALESCE(description, ''), status, created_at, updated_at,
+    kind, template, node_type_ids
+"""
+
+_DELIVERY_COLUMNS = """
+    id, endpoint_id, event_id, event_type, payload::text, status, attempts,
+    next_attempt_at, last_status_code, COALESCE(last_error, ''), created_at, updated_at, schema_version,
+    last_attempt_at, last_latency_ms, test
+"""
+
+
+class WebhookRepository:
+    """PostgreSQL webhook endpoint and delivery repository."""
+
+    def __init__(self, db: Database):
+        self.db = db
+
+    async def create(self, endpoint: WebhookEndpoint) -> WebhookEndpoint:
+        """Create a new webhook endpoint."""
+        endpoint.id = str(uuid.uuid4())
+        endpoint.created_at = datetime.now()
+        endpoint.updated_at = datetime.now()
+        if not endpoint.status:
+            endpoint.status = "active"
+
+        query = f"""
+            INSERT INTO webhook_endpoints (
+                id, url, secret, event_types, description, status, created_at, updated_at,
+                kind, template, node_type_ids
+            )
+            VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+            RETURNING {_ENDPOINT_COLUMNS}
+        """
+
+        async with self.db.pool.acquire() as conn:
+            row = await conn.fetchrow(
+                query,
+                endpoint.id, endpoint.url, endpoint.secret, endpoint.event_types,
+                endpoint.description, endpoint.status,
+                endpoint.created_at, endpoint.updated_at,
+                endpoint.kind or "webhook", endpoint.template, endpoint.node_type_ids
+            )
+
+        return self._row_to_endpoint(row)
+
+    async def get_by_id(self, id: str) -> WebhookEndpoint:
+        """Retrieve a webhook endpoint by ID."""
+        query = f"SELECT {_ENDPOINT_COLUMNS} FROM webhook_endpoints WHERE id = $1"
+
+        async with self.db.pool.acquire() as conn:
+            row = await conn.fetchrow(query, id)
+
+        if not row:
+            raise NotFoundError(f"webhook_endpoint not found: {id}")
+
+        return self._row_to_endpoint(row)
+
+    async def update(self, endpoint: WebhookEndpoint) -> WebhookEndpoint:
+        """Update an existing webhook endpoint."""
+        endpoint.updated_at = datetime.now()
+
+        query = f"""
+            UPDATE webhook_endpoints
+            SET url = $2, secret = $3, event_types = $4, description = $5, status = $6, updated_at = $7,
+                kind = $8, template = $9, node_type_ids = $10
+            WHERE id = $1
+            RETURNING {_ENDPOINT_COLUMNS}
+        """
+
+        async with self.db.pool.acquire() as conn:
+            row = await conn.fetchrow(
+                query,
+                endpoint.id, endpoint.url, endpoint.secret, endpoint.event_types,
+                endpoint.description, endpoint.status, endpoint.updated_at,
+                endpoint.kind or "webhook", endpoint.template, endpoint.node_type_ids
+            )
+
+        if not row:
+            raise NotFoundError(f"webhook_endpoint not found: {endpoint.id}")
+
+        return self._row_to_endpoint(row)
+
+    async def delete(self, id: str) -> None:
+        """Delete a webhook endpoint by ID."""
+        query = "DELETE FROM webhook_endpoints WHERE id = $1"
+
+        async with self.db.pool.acquire() as conn:
+            result = await conn.execute(query, id)
+
+        if result == "DELETE 0":
+            raise NotFoundError(f"webhook_endpoint not found: {id}")
+
+    async def list(self, opts: ListOptions) -> Tuple[List[WebhookEndpoint], ListResult]:
+        """Retrieve webhook endpoints with pagination."""
+        page_size = max(1, min(opts.page_size or 10, 100))
+        offset = 0
+        if opts.page_token:
+            try:
+                offset = int(opts.page_token)
+            except ValueError:
+                offset = 0
+
+        async with self.db.pool.acquire() as conn:
+            total_count = await conn.fetchval("SELECT COUNT(*) FROM webhook_endpoints")
+
+            query = f"""
+                SELECT {_ENDPOINT_COLUMNS}
+                FROM webhook_endpoints
+                ORDER BY created_at DESC
+                LIMIT $1 OFFSET $2
+            """
+            rows = await conn.fetch(query, page_size, offset)
+
+        endpoints = [self._row_to_endpoint(row) for row in rows]
+
+        result = ListResult(total_count=total_count)
+        next_offset = offset + len(endpoints)
+        if next_offset < total_count:
+            result.next_page_token = str(next_offset)
+
+        return endpoints, result
+
+    async def create_test_delivery(self, endpoint_id: str, event_type: str, payload: dict) -> WebhookDelivery:
+        """Queue a test event for one endpoint, due at once, outside the outbox."""
+        query = f"""
+            INSERT INTO webhook_deliveries (id, endpoint_id, event_id, event_type, payload, test)
+            VALUES ($1, $2, $3, $4, $5::jsonb, TRUE)
+            RETURNING {_DELIVERY_COLUMNS}
+        """
+
+        async with self.db.pool.acquire() as conn:
+            try:
+                row = await conn.fetchrow(
+                    query, str(uuid.uuid4()), endpoint_id, str(uuid.uuid4()), event_type, json.dumps(payload)
+                )
+            except asyncpg.ForeignKeyViolationError:
+                raise NotFoundError(f"webhook_endpoint not found: {endpoint_id}") from None
+
+        return self._row_to_delivery(row)
+
+    async def get_delivery(self, id: str) -> WebhookDelivery:
+        """Retrieve a webhook delivery by ID."""
+        query = f"SELECT {_DELIVERY_COLUMNS} FROM webhook_deliveries WHERE id = $1"
+
+        async with self.db.pool.acquire() as conn:
+            row = await conn.fetchrow(query, id)
+
+        if not row:
+            raise NotFoundError(f"webhook delivery not found: {id}")
+        return self._row_to_delivery(row)
+
+    async def list_deliveries(
+        self, endpoint_id: str, opts: ListOptions, status: str = ""
+    ) -> Tuple[List[WebhookDelivery], ListResult]:
+        """Retrieve an endpoint's deliveries, newest first, optionally with one status."""
+        page_size = max(1, min(opts.page_size or 10, 100))
+        offset = 0
+        if opts.page_token:
+            try:
+                offset = int(opts.page_token)
+            except ValueError:
+                offset = 0
+
+        where = "WHERE endpoint_id = $1 AND ($2 = '' OR status = $2)"
+        async with self.db.pool.acquire() as conn:
+            total_count = await conn.fetchval(f"SELECT COUNT(*) FROM webhook_deliveries {where}", endpoint_id, status)
+
+            query = f"""
+                SELECT {_DELIVERY_COLUMNS}
+                FROM webhook_deliveries
+                {where}
+                ORDER BY created_at DESC, id
+                LIMIT $3 OFFSET $4
+            """
+            rows = await conn.fetch(query, endpoint_id, status, page_size, offset)
+
+        deliveries = [self._row_to_delivery(row) for row in rows]
+
+        result = ListResult(total_count=total_count)
+        next_offset = offset + len(deliveries)
+        if next_offset < total_count:
+            result.next_page_token = str(next_offset)
+
+        return deliveries, result
+
+    async def claim_due_deliveries(self, limit: int, lease_seconds: float) -> List[WebhookDelivery]:
+        """
+        Claim pending deliveries that are due for an attempt.
+
+        Claimed deliveries have next_attempt_at pushed lease_seconds into the
+        future so other dispatcher instances skip them while this attempt is
+        in flight.
+        """
+        query = f"""
+            UPDATE webhook_deliveries
+            SET next_attempt_at = NOW() + make_interval(secs => $2), updated_at = NOW()
+            WHERE id IN (
+                SELECT id FROM webhook_deliveries
+                WHERE status = 'pending' AND next_attempt_at <= NOW()
+                ORDER BY next_attempt_at
+                LIMIT $1
+                FOR UPDATE SKIP LOCKED
+            )
+            RETURNING {_DELIVERY_COLUMNS}
+        """
+
+        async with self.db.pool.acquire() as conn:
+            rows = await conn.fetch(query, limit, lease_seconds)
+
+        return [self._row_to_delivery(row) for row in rows]
+
+    async def record_attempt(
+        self,
+        id: str,
+        status: str,
+        status_code: Optional[int],
+        error: str,
+        retry_in_seconds: Optional[float] = None,
+        latency_ms: Optional[int] = None
+    ) -> None:
+        """
+        Record the outcome of a delivery attempt and the endpoint's response
+        time, optionally scheduling a retry. Failed deliveries of change
+        events are added to the dead letters.
+        """
+        query = f"""
+            UPDATE webhook_deliveries
+            SET status = $2, attempts = attempts + 1, last_status_code = $3, last_error = $4,
+                next_attempt_at = COALESCE(NOW() + make_interval(secs => $5), next_attempt_at),
+                last_attempt_at = NOW(), last_latency_ms = $6, updated_at = NOW()
+            WHERE id = $1
+            RETURNING {_DELIVERY_COLUMNS}
+        """
+
+        async with self.db.pool.acquire() as conn:
+            async with conn.transaction():
+                row = await conn.fetchrow(
+                    query, id, status, status_code, error or None, retry_in_seconds, latency_ms
+                )
+                delivery = self._row_to_delivery(row) if row else None
+                # Test events aren't replayed
+                if delivery and status == "failed" and not delivery.test:
+                    payload = {
+                        "endpoint_id": delivery.endpoint_id,
+                        "event_id": delivery.event_id,
+                        "event_type": delivery.event_type,
+                        "payload": json.loads(delivery.payload),
+                        "last_status_code": delivery.last_status_code,
+                    }
+                    await add_dead_letter(
+                        conn, DEAD_LETTER_WEBHOOK_DELIVERY, delivery.id, payload, error, delivery.attempts
+                    )
+
+    async def requeue_delivery(self, id: str) -> WebhookDelivery:
+        """Make a failed delivery pending again, with its attempts reset, to be retried at once."""
+        query = f"""
+            UPDATE webhook_deliveries
+            SET status = 'pending', attempts = 0, next_attempt_at = NOW(), updated_at = NOW()
+            WHERE id = $1
+            RETURNING {_DELIVERY_COLUMNS}
+        """
+
+        async with self.db.pool.acquire() as conn:
+            row = await conn.fetchrow(query, id)
+
+        if not row:
+            raise NotFoundError(f"webhook delivery not found: {id}")
+        return self._row_to_delivery(row)
+
+    def _row_to_endpoint(self, row: asyncpg.Record) -> WebhookEndpoint:
+        """Convert a database row to a WebhookEndpoint object."""
+        return WebhookEndpoint(
+            id=str(row[0]),
+            url=row[1],
+            secret=row[2],
+            event_types=list(row[3] or []),
+            description=row[4] or "",
+            status=row[5],
+            created_at=row[6],
+            updated_at=row[7],
+            kind=row[8],
+            template=row[9] or "",
+            node_type_ids=list(row[10] or []),
+        )
+
+    def _row_to_delivery(self, row: asyncpg.Record) -> WebhookDelivery:
+        """Convert a database row to a WebhookDelivery object."""
+        return WebhookDelivery(
+            id=str(row[0]),
+            endpoint_id=str(row[1]),
+            event_id=str(row[2]),
+            event_type=row[3],
+            payload=row[4] or "{}",
+            status=row[5],
+            attempts=row[6],
+            next_attempt_at=row[7],
+            last_status_code=row[8],
+            last_error=row[9] or "",
+            created_at=row[10],
+            updated_at=row[11],
+            schema_version=row[12],
+            last_attempt_at=row[13],
+            last_latency_ms=row[14],
+            test=row[15],
+        )
@@ -3,15 +3,68 @@ Service module initialization.
 """
 
 from app.service.tenant_service import TenantService
+from app.service.tenant_template_service import (
+    TenantTemplate,
+    TenantTemplateService,
+    load_tenant_templates,
+)
 from app.service.user_service import UserService
 from app.service.nodetype_service import NodeTypeService
 from app.service.node_service import NodeService
 from app.service.relationship_service import RelationshipService
+from app.service.webhook_service import WebhookService
+from app.service.clone_service import CloneService
+from app.service.subscription_service import SubscriptionService
+from app.service.change_feed_service import ChangeFeedService
+from app.service.intake_service import IntakeFormService
+from app.service.inbox_service import EmailInboxService
+from app.service.attachment_service import AttachmentService
+from app.service.node_lock_service import NodeLockService
+from app.service.transfer_service import TransferService
+from app.service.query_cache import QueryCache, QueryCacheService
+from app.service.bi_views import BiViewService
+from app.service.node_migration_service import NodeMigrationService
+from app.service.retention_service import RetentionService
+from app.service.bulk_job_service import BulkJobService
+from app.service.storage_export_service import StorageExportService
+from app.service.operation_service import BulkJobOperations, NodeMigrationOperations, OperationService
+from app.service.dead_letter_service import DeadLetterService
+from app.service.api_key_service import ApiKeyService
+from app.service.audit_service import AuditService
+from app.service.auth_guard import AuthGuard
+from app.service.cluster_service import ClusterService
 
 __all__ = [
     "TenantService",
+    "TenantTemplate",
+    "TenantTemplateService",
+    "load_tenant_templates",
     "UserService",
     "NodeTypeService",
     "NodeService",
     "RelationshipService",
+    "WebhookService",
+    "CloneService",
+    "SubscriptionService",
+    "ChangeFeedService",
+    "IntakeFormService",
+    "EmailInboxService",
+    "AttachmentService",
+    "NodeLockService",
+    "TransferService",
+    "QueryCache",
+    "QueryCacheService",
+    "BiViewService",
+    "NodeMigrationService",
+    "RetentionService",
+    "BulkJobService",
+    "StorageExportService",
+    "BulkJobOperations",
+    "NodeMigrationOperations",
+    "OperationService",
+    "DeadLetterService",
+    "ApiKeyService",
+    "AuditService",
+    "AuthGuard",
+    "ClusterService",
 ]
@@ -0,0 +1,155 @@
+"""
+API key service implementation.
+"""
+
+import hashlib
+import secrets
+from datetime import datetime, timedelta, timezone
+from typing import List, Optional, Tuple
+
+from app.auth.scopes import validate_scopes
+from app.config import ApiKeyPolicyConfig
+from app.repository import ApiKey, ApiKeyRepository, ListOptions, ListResult, ValidationError
+
+# Keys look like fdb_<43 URL-safe characters>
+KEY_PREFIX = "fdb_"
+# Characters of the key kept in key_prefix for identification
+PREFIX_LENGTH = 12
+# Seconds between updates of a key's last_used_at
+LAST_USED_RESOLUTION = 60.0
+# Longest grace period of a rotated key
+MAX_GRACE_PERIOD = 7 * 24 * 3600
+
+
+def hash_key(key: str) -> str:
+    """Return the hash stored for an API key."""
+    return hashlib.sha256(key.encode("utf-8")).hexdigest()
+
+
+class ApiKeyService:
+    """API key business logic service."""
+
+    def __init__(self, repo: ApiKeyRepository, policy: Optional[ApiKeyPolicyConfig] = None):
+        self.repo = repo
+        self.policy = policy or ApiKeyPolicyConfig()
+
+    async def create(
+        self,
+        tenant_id: str,
+        name: str,
+        scopes: List[str],
+        node_type_ids: Optional[List[str]] = None,
+        expires_at: str = ""
+    ) -> Tuple[ApiKey, str]:
+        """
+        Create an API key for a tenant.
+
+        expires_at is an ISO 8601 time (UTC unless it has an offset); keys
+        without one expire after the maximum lifetime, if configured. Returns
+        the key record and the key itself, which is only stored hashed and
+        cannot be retrieved again.
+        """
+        if not tenant_id:
+            raise ValidationError("tenant_id", "is required")
+        if not name:
+            raise ValidationError("name", "is required")
+        scopes = list(dict.fromkeys(scopes or []))
+        node_type_ids = list(dict.fromkeys(node_type_ids or []))
+        validate_scopes(scopes, node_type_ids)
+
+        api_key, key = self._new_key(ApiKey(
+            tenant_id=tenant_id,
+            name=name,
+            scopes=scopes,
+            node_type_ids=node_type_ids,
+            expires_at=self._expiry(_parse_time(expires_at) if expires_at else None),
+        ))
+        return await self.repo.create(api_key, hash_key(key)), key
+
+    async def rotate(self, tenant_id: str, id: str, grace_period: int = 0) -> Tuple[ApiKey, str, ApiKey]:
+        """
+        Replace an API key with a new one with the same name, scopes and node types.
+
+        The old key is revoked, or keeps working for grace_period seconds so
+        clients can switch over. The new key expires after the old key's
+        lifetime, if it had one. Returns the new key record, the new key and
+        the old key record.
+        """
+        old = await self.get_by_id(tenant_id, id)
+        if grace_period < 0 or grace_period > MAX_GRACE_PERIOD:
+            raise ValidationError("grace_period", f"must be between 0 and {MAX_GRACE_PERIOD} seconds")
+
+        expires_at = None
+        if old.expires_at:
+            expires_at = datetime.now(timezone.utc) + (old.expires_at - old.created_at.astimezone(timezone.utc))
+        api_key, key = self._new_key(ApiKey(
+            tenant_id=old.tenant_id,
+            name=old.name,
+            scopes=list(old.scopes),
+            node_type_ids=list(old.node_type_ids),
+            expires_at=self._expiry(expires_at),
+        ))
+        api_key, old = await self.repo.rotate(old, api_key, hash_key(key), grace_period)
+        return api_key, key, old
+
+    def _new_key(self, api_key: ApiKey) -> Tuple[ApiKey, str]:
+        key = KEY_PREFIX + secrets.token_urlsafe(32)
+        api_key.key_prefix = key[:PREFIX_LENGTH]
+        return api_key, key
+
+    def _expiry(self, expires_at: Optional[datetime]) -> Optional[datetime]:
+        """Apply the maximum lifetime policy to a requested expiry time."""
+        now = datetime.now(timezone.utc)
+        if expires_at is not None and expires_at <= now:
+            raise ValidationError("expires_at", "must be in the future")
+        if self.policy.max_lifetime_days <= 0:
+            return expires_at
+        latest = now + timedelta(days=self.policy.max_lifetime_days)
+        if expires_at is None:
+            return latest
+        if expires_at > latest:
+            raise ValidationError("expires_at", f"must be within {self.policy.max_lifetime_days} days")
+        return expires_at
+
+    async def get_by_id(self, tenant_id: str, id: str) -> ApiKey:
+        """Retrieve a tenant's API key by ID."""
+        if not tenant_id:
+            raise ValidationError("tenant_id", "is required")
+        if not id:
+            raise ValidationError("id", "is required")
+        return await self.repo.get_by_id(tenant_id, id)
+
+    async def list(self, tenant_id: str, page_size: int, page_token: str) -> Tuple[List[ApiKey], ListResult]:
+        """Retrieve a tenant's API keys with pagination."""
+        if not tenant_id:
+            raise ValidationError("tenant_id", "is required")
+        opts = ListOptions(page_size=page_size, page_token=page_token)
+        return await self.repo.list(tenant_id, opts)
+
+    async def revoke(self, tenant_id: str, id: str) -> ApiKey:
+        """Revoke a tenant's API key; it stops working immediately."""
+        if not tenant_id:
+            raise ValidationError("tenant_id", "is required")
+        if not id:
+            raise ValidationError("id", "is required")
+        return await self.repo.revoke(tenant_id, id)
+
+    async def authenticate(self, key: str) -> Optional[ApiKey]:
+        """Return the active API key matching key, or None, and record its use."""
+        if not key.startswith(KEY_PREFIX):
+            return None
+        api_key = await self.repo.get_active_by_hash(hash_key(key))
+        if api_key is None:
+            return None
+        now = datetime.now(timezone.utc)
+        if api_key.last_used_at is None or now - api_key.last_used_at > timedelta(seconds=LAST_USED_RESOLUTION):
+            await self.repo.touch(api_key.id, LAST_USED_RESOLUTION)
+        return api_key
+
+
+def _parse_time(value: str) -> datetime:
+    try:
+        parsed = datetime.fromisoformat(value)
+    except ValueError:
+        raise ValueError(f"invalid expires_at: {value} (expected an ISO 8601 time)") from None
+    return parsed if parsed.tzinfo else parsed.replace(tzinfo=timezone.utc)
@@ -0,0 +1,132 @@
+"""
+Node attachment service implementation.
+
+Attachments are files linked to a node: their metadata is stored in the
+tenant database and their bytes in the blob store configured with
+ATTACHMENTS_URL (see app/blobs), under <prefix>/<tenant_id>/attachments/<id>,
+so blobs of different tenants never share a key. Uploads and downloads are
+streamed; uploads are hashed (SHA-256) and sized as they are written, and
+fail with ValueError once larger than the configured maximum.
+
+Deleting an attachment deletes its blob. Deleting its node deletes the
+metadata with it (ON DELETE CASCADE) but leaves the blob in the store.
+"""
+
+import hashlib
+import posixpath
+from typing import TYPE_CHECKING, AsyncIterator, List, Optional, Tuple
+
+from app.repository import Attachment, AttachmentRepository, FailedPreconditionError, NodeRepository, ValidationError
+from app.repository.ids import new_id
+from app.service.tenant_check import TenantCheck
+
+if TYPE_CHECKING:
+    # app.blobs reuses the lake's S3 signing, and app.lake imports the services
+    from app.blobs import BlobStore
+
+MAX_FILENAME_LENGTH = 255
+
+DEFAULT_CONTENT_TYPE = "application/octet-stream"
+
+
+class AttachmentService:
+    """Node attachment business logic service."""
+
+    def __init__(
+        self,
+        repo: AttachmentRepository,
+        node_repo: NodeRepository,
+        tenant_id: str,
+        blobs: Optional["BlobStore"] = None,
+        prefix: str = "",
+        max_bytes: int = 100 * 1024 * 1024,
+        tenant_check: Optional[TenantCheck] = None
+    ):
+        self.repo = repo
+        self.node_repo = node_repo
+        self.tenant_id = tenant_id
+        # Holds attachment bytes; None disables attachments
+        self.blobs = blobs
+        self.prefix = prefix
+        self.max_bytes = max_bytes
+        # Verifies the tenant accepts writes; None skips the check
+        self.tenant_check = tenant_check
+
+    async def upload(
+        self, node_id: str, filename: str, content_type: str, chunks: AsyncIterator[bytes]
+    ) -> Attachment:
+        """Stream an attachment's bytes into the blob store and record it on its node."""
+        if not node_id:
+            raise ValidationError("node_id", "is required")
+        if not filename:
+            raise ValidationError("filename", "is required")
+        if len(filename) > MAX_FILENAME_LENGTH:
+            raise ValidationError("filename", f"must be at most {MAX_FILENAME_LENGTH} characters")
+        blobs = self._blobs()
+        if self.tenant_check:
+            await self.tenant_check.require_writable()
+        await self.node_repo.get_by_id(node_id, [])
+
+        attachment = Attachment(
+            id=new_id(),
+            node_id=node_id,
+            filename=filename,
+            content_type=content_type or DEFAULT_CONTENT_TYPE,
+        )
+        attachment.blob_key = self._key(attachment.id)
+        digest = hashlib.sha256()
+
+        async def measured() -> AsyncIterator[bytes]:
+            async for chunk in chunks:
+                attachment.size_bytes += len(chunk)
+                if attachment.size_bytes > self.max_bytes:
+                    raise ValueError(f"attachment exceeds {self.max_bytes} bytes")
+                digest.update(chunk)
+                yield chunk
+
+        await blobs.write(attachment.blob_key, measured(), attachment.content_type)
+        attachment.sha256 = digest.hexdigest()
+        try:
+            return await self.repo.create(attachment)
+        except BaseException:
+            # The node was deleted meanwhile, or the metadata couldn't be stored
+            await blobs.delete(attachment.blob_key)
+            raise
+
+    async def get(self, id: str) -> Attachment:
+        """Retrieve an attachment's metadata."""
+        if not id:
+            raise ValidationError("id", "is required")
+        return await self.repo.get_by_id(id)
+
+    async def download(self, id: str) -> Tuple[Attachment, AsyncIterator[bytes]]:
+        """Retrieve an attachment's metadata and the chunks of its bytes."""
+        blobs = self._blobs()
+        attachment = await self.get(id)
+        return attachment, blobs.read(attachment.blob_key)
+
+    async def list(self, node_id: str) -> List[Attachment]:
+        """Retrieve the attachments of a node, oldest first."""
+        if not node_id:
+            raise ValidationError("node_id", "is required")
+        return await self.repo.list(node_id)
+
+    async def delete(self, id: str) -> Attachment:
+        """Delete an attachment and its bytes, returning its metadata."""
+        if not id:
+            raise ValidationError("id", "is required")
+        blobs = self._blobs()
+        if self.tenant_check:
+            await self.tenant_check.require_writable()
+        attachment = await self.repo.delete(id)
+        await blobs.delete(attachment.blob_key)
+        return attachment
+
+    def _blobs(self) -> "BlobStore":
+        if self.blobs is None:
+            raise FailedPreconditionError("attachments are not enabled on this server (set ATTACHMENTS_URL)")
+        return self.blobs
+
+    def _key(self, id: str) -> str:
+        parts = (self.tenant_id, "attachments", id)
+        return posixpath.join(self.prefix, *parts) if self.prefix else posixpath.join(*parts)
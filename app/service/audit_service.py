@@ -0,0 +1,35 @@
+"""
+Audit log service implementation.
+"""
+
+from typing import List, Tuple
+
+from app.logs import current_request_id
+from app.repository import AuditEvent, AuditRepository, ListOptions, ListResult, ValidationError
+
+
+class AuditService:
+    """Audit log business logic service."""
+
+    def __init__(self, repo: AuditRepository):
+        self.repo = repo
+
+    async def record(self, event: AuditEvent) -> AuditEvent:
+        """Append an event to the audit log, with the ID of the request being handled in its details."""
+        if not event.event_type:
+            raise ValidationError("event_type", "is required")
+        request_id = current_request_id()
+        if request_id and "request_id" not in event.details:
+            event.details = {**event.details, "request_id": request_id}
+        return await self.repo.record(event)
+
+    async def list(
+        self,
+        tenant_id: str,
+        event_type: str,
+        page_size: int,
+        page_token: str
+    ) -> Tuple[List[AuditEvent], ListResult]:
+        """Retrieve audit events with pagination, of all tenants if tenant_id is empty."""
+        opts = ListOptions(page_size=page_size, page_token=page_token)
+        return await self.repo.list(tenant_id or "", event_type or "", opts)
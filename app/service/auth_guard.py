@@ -0,0 +1,309 @@
+"""
+Brute-force protection and anomaly detection for API authentication.
+
+Failed authentications are counted per client IP and per key prefix (the
+first characters of the presented key, see app/service/api_key_service.py).
+AUTH_LOCKOUT_MAX_FAILURES failures within AUTH_LOCKOUT_WINDOW seconds lock the
+IP or key prefix out for AUTH_LOCKOUT_SECONDS, doubling with each further
+lockout up to AUTH_LOCKOUT_MAX_SECONDS; the backoff starts over once a lockout
+is that long past. Locked out requests are rejected before their key is
+checked, including requests with the valid key of a locked out prefix.
+
+Successful authentications with tenant API keys are watched for anomalies:
+
+- security.new_ip: a key used from a client IP it wasn't used from before
+  (not reported for a key's first IP)
+- security.unusual_volume: a key's requests in a minute exceeding
+  AUTH_VOLUME_ALERT_FACTOR times its average per minute, and at least
+  AUTH_VOLUME_ALERT_MIN; reported at most once an hour per key
+
+Lockouts (security.lockout) and anomalies are appended to the audit log, and
+those concerning a tenant's API key are also written to the tenant's outbox so
+they reach its webhooks. Counters are kept per server instance, like the
+intake rate limits.
+"""
+
+import logging
+import time
+from collections import OrderedDict, deque
+from dataclasses import dataclass, field
+from typing import Any, Callable, Deque, Dict, Optional, Tuple
+
+from app.config import AuthConfig
+from app.db.tenant_db_manager import TenantDatabaseManager
+from app.repository import ApiKey, ApiKeyRepository, AuditEvent, OutboxRepository
+from app.service.api_key_service import KEY_PREFIX, PREFIX_LENGTH
+from app.service.audit_service import AuditService
+
+logger = logging.getLogger(__name__)
+
+LOCKOUT = "security.lockout"
+NEW_IP = "security.new_ip"
+UNUSUAL_VOLUME = "security.unusual_volume"
+
+# Forget idle counters once this many are tracked
+MAX_TRACKED_KEYS = 100000
+# Seconds between updates of the time a key was last seen from an IP
+IP_RESOLUTION = 3600.0
+# Weight of the latest minute in a key's average requests per minute
+VOLUME_SMOOTHING = 0.1
+# Minutes a key must be known before its volume is judged
+VOLUME_WARMUP_MINUTES = 10
+VOLUME_ALERT_COOLDOWN_MINUTES = 60
+
+
+@dataclass
+class _Failures:
+    times: Deque[float] = field(default_factory=deque)
+    locked_until: float = 0.0
+    lockouts: int = 0  # consecutive lockouts, for the backoff
+
+
+class Lockouts:
+    """Counts failures per key and locks keys out with exponential backoff."""
+
+    def __init__(
+        self,
+        max_failures: int,
+        window: float,
+        lockout: float,
+        max_lockout: float,
+        clock: Callable[[], float] = time.monotonic
+    ):
+        self.max_failures = max_failures
+        self.window = window
+        self.lockout = lockout
+        self.max_lockout = max_lockout
+        self._clock = clock
+        self._failures: Dict[str, _Failures] = {}
+
+    def retry_after(self, key: str) -> float:
+        """Seconds until key is no longer locked out; 0 if it isn't."""
+        failures = self._failures.get(key)
+        if failures is None:
+            return 0.0
+        return max(0.0, failures.locked_until - self._clock())
+
+    def failure(self, key: str) -> float:
+        """Record a failure for key; returns the lockout in seconds if it locks key out, else 0."""
+        if self.max_failures <= 0:
+            return 0.0
+        now = self._clock()
+        failures = self._failures.get(key)
+        if failures is None:
+            if len(self._failures) >= MAX_TRACKED_KEYS:
+                self._prune(now)
+            failures = self._failures[key] = _Failures()
+
+        self._expire(failures, now)
+        failures.times.append(now)
+        if len(failures.times) < self.max_failures:
+            return 0.0
+
+        if failures.lockouts and now - failures.locked_until > self.max_lockout:
+            failures.lockouts = 0
+        duration = min(self.lockout * 2 ** failures.lockouts, self.max_lockout)
+        failures.lockouts += 1
+        failures.locked_until = now + duration
+        failures.times.clear()
+        return duration
+
+    def success(self, key: str) -> None:
+        """Forget key's failures; its backoff is kept until it expires."""
+        failures = self._failures.get(key)
+        if failures is not None:
+            failures.times.clear()
+
+    def _expire(self, failures: _Failures, now: float) -> None:
+        while failures.times and failures.times[0] <= now - self.window:
+            failures.times.popleft()
+
+    def _prune(self, now: float) -> None:
+        for key in list(self._failures):
+            failures = self._failures[key]
+            self._expire(failures, now)
+            if not failures.times and now - failures.locked_until > self.max_lockout:
+                del self._failures[key]
+
+
+@dataclass
+class _Volume:
+    minute: int
+    first_minute: int
+    count: int = 0
+    average: float = 0.0
+    alerted_until: int = 0
+
+
+class VolumeMonitor:
+    """Detects keys whose requests in a minute far exceed their average per minute."""
+
+    def __init__(self, factor: float, minimum: int, clock: Callable[[], float] = time.monotonic):
+        self.factor = factor
+        self.minimum = minimum
+        self._clock = clock
+        self._volumes: Dict[str, _Volume] = {}
+
+    def hit(self, key: str) -> Optional[Tuple[int, float]]:
+        """
+        Record a request for key. Returns the requests this minute and the
+        average per minute when the volume becomes unusual, else None.
+        """
+        if self.factor <= 0:
+            return None
+        minute = int(self._clock() // 60)
+        volume = self._volumes.get(key)
+        if volume is None:
+            if len(self._volumes) >= MAX_TRACKED_KEYS:
+                self._prune(minute)
+            volume = self._volumes[key] = _Volume(minute=minute, first_minute=minute)
+
+        if minute != volume.minute:
+            # Fold the finished minute, then any idle minutes, into the average
+            volume.average += (volume.count - volume.average) * VOLUME_SMOOTHING
+            volume.average *= (1 - VOLUME_SMOOTHING) ** (minute - volume.minute - 1)
+            volume.minute = minute
+            volume.count = 0
+        volume.count += 1
+
+        if (
+            minute - volume.first_minute >= VOLUME_WARMUP_MINUTES
+            and minute >= volume.alerted_until
+            and volume.count >= self.minimum
+            and volume.count > self.factor * volume.average
+        ):
+            volume.alerted_until = minute + VOLUME_ALERT_COOLDOWN_MINUTES
+            return volume.count, volume.average
+        return None
+
+    def _prune(self, minute: int) -> None:
+        for key in list(self._volumes):
+            if minute - self._volumes[key].minute > VOLUME_ALERT_COOLDOWN_MINUTES:
+                del self._volumes[key]
+
+
+def key_prefix(key: str) -> str:
+    """Return the key prefix failures of a presented key count against, or "" for other keys."""
+    return key[:PREFIX_LENGTH] if key.startswith(KEY_PREFIX) else ""
+
+
+class AuthGuard:
+    """Applies lockouts to authentication and reports security events."""
+
+    def __init__(
+        self,
+        cfg: AuthConfig,
+        audit_service: AuditService,
+        api_key_repo: ApiKeyRepository,
+        tenant_db_manager: Optional[TenantDatabaseManager] = None,
+        clock: Callable[[], float] = time.monotonic
+    ):
+        self.cfg = cfg
+        self.audit_service = audit_service
+        self.api_key_repo = api_key_repo
+        self.tenant_db_manager = tenant_db_manager
+        self.lockouts = Lockouts(
+            cfg.lockout_max_failures, cfg.lockout_window, cfg.lockout_seconds, cfg.lockout_max, clock
+        )
+        self.volume = VolumeMonitor(cfg.volume_alert_factor, cfg.volume_alert_min, clock)
+        self._clock = clock
+        # (key ID, client IP) pairs recently recorded, least recently seen first
+        self._seen_ips: "OrderedDict[Tuple[str, str], float]" = OrderedDict()
+
+    def retry_after(self, client_ip: str, key: str) -> float:
+        """Seconds until a request from client_ip with key may authenticate; 0 if now."""
+        retry_after = self.lockouts.retry_after(f"ip:{client_ip}")
+        prefix = key_prefix(key)
+        if prefix:
+            retry_after = max(retry_after, self.lockouts.retry_after(f"key:{prefix}"))
+        return retry_after
+
+    async def failed(self, client_ip: str, key: str) -> None:
+        """Record a failed authentication, locking out the IP or key prefix if due."""
+        duration = self.lockouts.failure(f"ip:{client_ip}")
+        if duration:
+            await self._report(LOCKOUT, client_ip, {"scope": "ip", "duration": duration})
+
+        prefix = key_prefix(key)
+        if not prefix:
+            return
+        duration = self.lockouts.failure(f"key:{prefix}")
+        if not duration:
+            return
+        details = {"scope": "key_prefix", "key_prefix": prefix, "duration": duration}
+        try:
+            api_keys = await self.api_key_repo.list_by_prefix(prefix)
+        except Exception:
+            logger.exception(f"Failed to look up API keys with prefix {prefix}")
+            api_keys = []
+        for api_key in api_keys or [None]:
+            await self._report(LOCKOUT, client_ip, details, api_key)
+
+    async def succeeded(self, client_ip: str, api_key: Optional[ApiKey]) -> None:
+        """Record a successful authentication, with a tenant API key or else the admin key."""
+        self.lockouts.success(f"ip:{client_ip}")
+        if api_key is None:
+            return
+        self.lockouts.success(f"key:{api_key.key_prefix}")
+
+        if self.cfg.new_ip_alerts and client_ip and await self._new_ip(api_key, client_ip):
+            await self._report(NEW_IP, client_ip, {}, api_key)
+
+        volume = self.volume.hit(api_key.id)
+        if volume:
+            count, average = volume
+            details = {"requests_per_minute": count, "average_per_minute": round(average, 1)}
+            await self._report(UNUSUAL_VOLUME, client_ip, details, api_key)
+
+    async def _new_ip(self, api_key: ApiKey, client_ip: str) -> bool:
+        pair = (api_key.id, client_ip)
+        now = self._clock()
+        seen_at = self._seen_ips.get(pair)
+        if seen_at is not None and now - seen_at < IP_RESOLUTION:
+            self._seen_ips.move_to_end(pair)
+            return False
+
+        try:
+            new = await self.api_key_repo.record_ip(api_key.id, client_ip)
+        except Exception:
+            logger.exception(f"Failed to record client IP of API key {api_key.id}")
+            return False
+        self._seen_ips[pair] = now
+        self._seen_ips.move_to_end(pair)
+        while len(self._seen_ips) > MAX_TRACKED_KEYS:
+            self._seen_ips.popitem(last=False)
+        return new
+
+    async def _report(
+        self,
+        event_type: str,
+        client_ip: str,
+        details: Dict[str, Any],
+        api_key: Optional[ApiKey] = None
+    ) -> None:
+        """Append a security event to the audit log and notify the key's tenant."""
+        subject = f"API key {api_key.id} of tenant {api_key.tenant_id}" if api_key else "authentication"
+        logger.warning(f"Security event {event_type} for {subject} from {client_ip or 'unknown IP'}: {details}")
+
+        event = AuditEvent(
+            tenant_id=api_key.tenant_id if api_key else "",
+            event_type=event_type,
+            api_key_id=api_key.id if api_key else "",
+            client_ip=client_ip,
+            details=details,
+        )
+        try:
+            await self.audit_service.record(event)
+        except Exception:
+            logger.exception(f"Failed to record {event_type} in the audit log")
+
+        if api_key is None or self.tenant_db_manager is None:
+            return
+        try:
+            tenant_db = await self.tenant_db_manager.get_tenant_db(api_key.tenant_id)
+            await OutboxRepository(tenant_db).record(
+                event_type, "api_key", api_key.id,
+                {"api_key": api_key.to_dict(), "client_ip": client_ip, **details}
+            )
+        except Exception:
+            logger.exception(f"Failed to notify tenant {api_key.tenant_id} of {event_type}")
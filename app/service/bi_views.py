@@ -0,0 +1,135 @@
+"""
+BI view generation.
+
+BI tools expect tables with typed columns rather than JSONB documents. For
+every node type a read-only view bi.<node_type_name> is generated with one
+column per declared schema field:
+
+    string                 text
+    number, decimal        numeric
+    integer                bigint
+    boolean                boolean
+    localized_string       text in the field's default_locale (jsonb without one)
+    geo_point              <field>_lat and <field>_lng numeric columns
+    object, array, geo_shape  jsonb
+    other types            text
+
+Values that don't match the declared type read as NULL. Each view also has
+the id, created_at, updated_at, version and raw data columns; bi.relationships
+exposes all relationships. Views are regenerated whenever a node type is
+created, changed or deleted.
+"""
+
+import logging
+import re
+from typing import List
+
+from app.repository import BiView, BiViewColumn, BiViewRepository, NodeType, NodeTypeRepository
+from app.repository.bi_view_repo import NODE_VIEW_COLUMNS, RELATIONSHIPS_VIEW
+from app.service.schema import DECIMAL_FIELD_TYPE, LOCALIZED_STRING_FIELD_TYPE, parse_schema
+
+logger = logging.getLogger(__name__)
+
+# PostgreSQL truncates identifiers longer than 63 bytes
+MAX_IDENTIFIER_LENGTH = 63
+
+_COLUMN_KINDS = {
+    "string": "text",
+    "number": "numeric",
+    DECIMAL_FIELD_TYPE: "numeric",
+    "integer": "bigint",
+    "boolean": "boolean",
+    "object": "jsonb",
+    "array": "jsonb",
+    "geo_shape": "jsonb",
+}
+
+
+def view_name(name: str) -> str:
+    """Turn a node type name into a lowercase snake_case view name."""
+    snake = re.sub(r"[^a-z0-9]+", "_", name.lower()).strip("_") or "node_type"
+    if snake[0].isdigit():
+        snake = "t_" + snake
+    return snake[:MAX_IDENTIFIER_LENGTH - 9]
+
+
+def build_views(node_types: List[NodeType]) -> List[BiView]:
+    """Build the view definitions for node types, giving each a unique view name."""
+    views = []
+    taken = {RELATIONSHIPS_VIEW}
+    for node_type in sorted(node_types, key=lambda nt: (nt.created_at, nt.id)):
+        name = view_name(node_type.name)
+        if name in taken:
+            # Node type names need not be unique; later ones get an ID suffix
+            name = f"{name}_{node_type.id.replace('-', '')[:8]}"
+        taken.add(name)
+        views.append(BiView(
+            name=name,
+            node_type_id=node_type.id,
+            node_type_name=node_type.name,
+            columns=build_columns(node_type.schema),
+        ))
+    return views
+
+
+def build_columns(schema: str) -> List[BiViewColumn]:
+    """Build the typed columns for a node type schema."""
+    try:
+        fields = parse_schema(schema)
+    except ValueError:
+        return []
+
+    columns = []
+    taken = set(NODE_VIEW_COLUMNS) | {"data"}
+
+    def add(name: str, path: List[str], kind: str) -> None:
+        column = name[:MAX_IDENTIFIER_LENGTH]
+        if column in taken:
+            column = ("data_" + name)[:MAX_IDENTIFIER_LENGTH]
+        suffix = 2
+        while column in taken:
+            column = f"{name[:MAX_IDENTIFIER_LENGTH - 4]}_{suffix}"
+            suffix += 1
+        taken.add(column)
+        columns.append(BiViewColumn(name=column, path=path, kind=kind))
+
+    for name, spec in fields.items():
+        if spec.sensitive:
+            continue  # Only ciphertext is stored (see app/service/encryption.py)
+        if spec.type == "geo_point":
+            add(f"{name}_lat", [name, "lat"], "numeric")
+            add(f"{name}_lng", [name, "lng"], "numeric")
+        elif spec.type == LOCALIZED_STRING_FIELD_TYPE:
+            if spec.default_locale:
+                add(name, [name, spec.default_locale], "text")
+            else:
+                add(name, [name], "jsonb")
+        else:
+            add(name, [name], _COLUMN_KINDS.get(spec.type, "text"))
+    return columns
+
+
+class BiViewService:
+    """Regenerates a tenant's BI views from its node types."""
+
+    def __init__(self, repo: BiViewRepository, node_type_repo: NodeTypeRepository):
+        self.repo = repo
+        self.node_type_repo = node_type_repo
+
+    async def refresh(self) -> List[BiView]:
+        """Regenerate all BI views and return their definitions."""
+        views = build_views(await self.node_type_repo.list_all())
+        await self.repo.replace_views(views)
+        return views
+
+    async def sync(self) -> None:
+        """
+        Regenerate BI views after a node type change.
+
+        The change has already been committed, so failures are logged rather
+        than raised; the next change or refresh_bi_views retries.
+        """
+        try:
+            await self.refresh()
+        except Exception as e:
+            logger.warning(f"Failed to regenerate BI views: {e}")
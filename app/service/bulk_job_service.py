@@ -0,0 +1,136 @@
+"""
+Bulk job service implementation.
+
+Imports, exports to object storage, bulk deletes and backfills run in
+batches for as long as their request or command does. While they run they
+are recorded as bulk jobs, so their progress (records processed out of the
+total, and an estimate of the time left) can be read as an operation (see
+app/service/operation_service.py) from anywhere, and they can be cancelled.
+Cancellation is cooperative: the job reports its progress after every
+committed batch and stops there once it learns it was cancelled, so it never
+leaves a batch half done. Jobs that checkpoint their progress, imports and
+exports to object storage, can be resumed once they failed, were cancelled or
+were interrupted.
+"""
+
+from typing import Any, Awaitable, Callable, Dict, List, Optional, Tuple
+
+from app.repository import (
+    BatchHook,
+    BulkJob,
+    BulkJobRepository,
+    FailedPreconditionError,
+    ListOptions,
+    ListResult,
+    NotFoundError,
+    ValidationError,
+)
+
+
+class BulkJobService:
+    """Bulk job progress and cancellation business logic service."""
+
+    def __init__(self, repo: BulkJobRepository):
+        self.repo = repo
+
+    async def start(
+        self,
+        kind: str,
+        params: Dict[str, Any],
+        total: Optional[int] = None,
+        unit: str = "records"
+    ) -> BulkJob:
+        """Record a running job; total is None while unknown."""
+        return await self.repo.create(BulkJob(kind=kind, params=params, total=total, unit=unit))
+
+    async def report(
+        self,
+        job: BulkJob,
+        processed: int,
+        total: Optional[int] = None,
+        progress: Optional[Dict[str, Any]] = None
+    ) -> bool:
+        """Record a job's progress after a batch; returns False if it was cancelled and must stop."""
+        job.processed = processed
+        if total is not None:
+            job.total = total
+        if progress is not None:
+            job.progress = progress
+        return await self.repo.save_progress(job)
+
+    def hook(self, job: BulkJob) -> BatchHook:
+        """Return a BatchHook reporting a job's progress, for repositories running it in batches."""
+        async def on_batch(processed: int, total: Optional[int]) -> bool:
+            return await self.report(job, processed, total)
+        return on_batch
+
+    async def finish(self, job: BulkJob, error: str = "") -> BulkJob:
+        """Mark a job succeeded, or failed with error, unless it was cancelled."""
+        job.status = "failed" if error else "succeeded"
+        job.error = error
+        await self.repo.save_progress(job)
+        return job
+
+    async def run(
+        self,
+        kind: str,
+        params: Dict[str, Any],
+        work: Callable[[BatchHook], Awaitable[Any]],
+        unit: str = "records"
+    ) -> BulkJob:
+        """
+        Run work, which processes its records in batches reporting to the
+        BatchHook it is given, as a job. Returns the finished job; if work
+        raises, the job fails and the error is raised again.
+        """
+        job = await self.start(kind, params, unit=unit)
+        try:
+            await work(self.hook(job))
+        except Exception as e:
+            await self.finish(job, str(e))
+            raise
+        return await self.finish(job)
+
+    async def get_by_id(self, id: str) -> BulkJob:
+        """Retrieve a job by ID."""
+        if not id:
+            raise ValidationError("id", "is required")
+        return await self.repo.get_by_id(id)
+
+    async def list(self, kind: Optional[str], page_size: int, page_token: str) -> Tuple[List[BulkJob], ListResult]:
+        """Retrieve jobs, optionally of one kind, with pagination, newest first."""
+        opts = ListOptions(page_size=page_size, page_token=page_token)
+        return await self.repo.list(kind, opts)
+
+    async def cancel(self, id: str) -> BulkJob:
+        """Cancel a running job; it stops after its current batch, and batches done so far are kept."""
+        if not id:
+            raise ValidationError("id", "is required")
+        job = await self.repo.cancel(id)
+        if job.status != "cancelled":
+            raise FailedPreconditionError(f"bulk_job {id} already {job.status}")
+        return job
+
+    async def restart(self, id: str, stale_seconds: float) -> Optional[BulkJob]:
+        """
+        Set a failed or cancelled job, or a running one without progress for
+        stale_seconds, running again, to resume it from its progress; returns
+        None if it succeeded or is still running.
+        """
+        if not id:
+            raise ValidationError("id", "is required")
+        return await self.repo.restart(id, stale_seconds)
+
+    async def resume(self, id: str, kind: str, stale_seconds: float) -> BulkJob:
+        """
+        Restart a job of kind to resume it (see restart); fails with
+        FailedPreconditionError if it succeeded or is still running.
+        """
+        job = await self.get_by_id(id)
+        if job.kind != kind:
+            raise NotFoundError(f"{kind} not found: {id}")
+        restarted = await self.repo.restart(id, stale_seconds)
+        if restarted is None:
+            job = await self.get_by_id(id)
+            raise FailedPreconditionError(f"{kind} {id} is {job.status} and can't be resumed")
+        return restarted
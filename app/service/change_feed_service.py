@@ -0,0 +1,37 @@
+"""
+Change feed.
+
+The events of a tenant's outbox, in the order their changes committed, read
+from a change token onwards. Tokens come from the header of a tenant export,
+from get_change_token or from the previous page: a consumer bootstraps a replica from an export,
+then applies the changes listed from the export's change_token and keeps
+polling with each page's next_token. No change is listed twice from the same
+token, and none is skipped, also when concurrent transactions commit out of
+sequence order.
+
+Unlike pull subscriptions, the feed keeps no state per consumer: consumers
+store the token of the last page they applied, and events stay readable for
+as long as the outbox keeps them.
+"""
+
+from app.repository import ChangePage, OutboxRepository, ValidationError
+
+DEFAULT_CHANGE_PAGE_SIZE = 100
+MAX_CHANGE_PAGE_SIZE = 1000
+
+
+class ChangeFeedService:
+    """Change feed business logic service."""
+
+    def __init__(self, repo: OutboxRepository):
+        self.repo = repo
+
+    async def list_changes(self, after: str = "", page_size: int = DEFAULT_CHANGE_PAGE_SIZE) -> ChangePage:
+        """List up to page_size changes committed after a change token, or from the first change without one."""
+        if not 1 <= page_size <= MAX_CHANGE_PAGE_SIZE:
+            raise ValidationError("page_size", f"must be between 1 and {MAX_CHANGE_PAGE_SIZE}")
+        return await self.repo.list_changes(after, page_size)
+
+    async def current_token(self) -> str:
+        """Return the change token of now, to list only the changes from now on."""
+        return await self.repo.current_change_token()
@@ -0,0 +1,213 @@
+"""
+Node cloning.
+
+clone_node copies a node, and optionally its outgoing relationships, which
+keep pointing at the original targets. clone_subgraph deep-copies a node with
+the nodes it reaches through outgoing relationships, up to a depth: every
+reached node is copied once, also when several paths lead to it, and the
+relationships between them are copied with their endpoints remapped to the
+copies, so the copy has the same shape as the original.
+
+A patch, a JSON object of top-level fields, is applied to the copied root
+node: fields are set to the given values, or removed when null, and the result
+must match the node type's schema. Unique keys apply to copies as to any other
+node, so nodes with unique keys can only be cloned with a patch changing them.
+Copies are created in one transaction, with created events and revisions as
+for individual creates.
+"""
+
+import json
+from datetime import datetime
+from typing import Dict, List, Optional, Tuple
+
+from app.repository import (
+    ListOptions,
+    Node,
+    NodeRepository,
+    NodeTypeRepository,
+    Relationship,
+    RelationshipRepository,
+    TransferRepository,
+    ValidationError,
+)
+from app.repository.ids import new_id
+from app.service.encryption import FieldEncryption
+from app.service.schema import parse_data, prepare_data
+
+DEFAULT_CLONE_DEPTH = 1
+MAX_CLONE_DEPTH = 10
+# Nodes and relationships copied by one clone
+MAX_CLONE_RECORDS = 1000
+
+_PAGE_SIZE = 100
+
+
+class CloneService:
+    """Node cloning business logic service."""
+
+    def __init__(
+        self,
+        node_repo: NodeRepository,
+        node_type_repo: NodeTypeRepository,
+        relationship_repo: RelationshipRepository,
+        transfer_repo: TransferRepository,
+        encryption: Optional[FieldEncryption] = None
+    ):
+        self.node_repo = node_repo
+        self.node_type_repo = node_type_repo
+        self.relationship_repo = relationship_repo
+        # Inserts records with their IDs assigned, in one transaction
+        self.transfer_repo = transfer_repo
+        self.encryption = encryption
+
+    async def clone_node(
+        self, id: str, patch: str = "", include_relationships: bool = False
+    ) -> Tuple[Node, List[Relationship]]:
+        """
+        Copy a node, applying patch to its data, and with
+        include_relationships its outgoing relationships to the same targets.
+        Returns the copy and its relationships.
+        """
+        if not id:
+            raise ValidationError("id", "is required")
+        original = await self.node_repo.get_by_id(id)
+        relationships = []
+        if include_relationships:
+            relationships = await self._outgoing(original.id, None)
+            _check_size(1 + len(relationships))
+
+        node = await self._copy_node(original, patch)
+        copies = [_copy_relationship(rel, node.id, rel.target_node_id) for rel in relationships]
+        await self.transfer_repo.import_batch([], [node], copies)
+        await self._read([node])
+        return node, copies
+
+    async def clone_subgraph(
+        self,
+        id: str,
+        depth: int = DEFAULT_CLONE_DEPTH,
+        relationship_types: Optional[List[str]] = None,
+        patch: str = ""
+    ) -> Tuple[Node, List[Node], List[Relationship], Dict[str, str]]:
+        """
+        Copy a node with the nodes reachable through at most depth outgoing
+        relationships (only of relationship_types, if given) and the
+        relationships between them, applying patch to the root's data.
+        Returns the root's copy, all copied nodes and relationships, and the
+        ID of each original node's copy.
+        """
+        if not id:
+            raise ValidationError("id", "is required")
+        if not 0 <= depth <= MAX_CLONE_DEPTH:
+            raise ValidationError("depth", f"must be between 0 and {MAX_CLONE_DEPTH}")
+        types = set(relationship_types or [])
+
+        root = await self.node_repo.get_by_id(id)
+        originals: Dict[str, Node] = {root.id: root}
+        relationships: List[Relationship] = []
+        frontier = [root.id]
+        for level in range(depth + 1):
+            next_frontier = []
+            for node_id in frontier:
+                for rel in await self._outgoing(node_id, types):
+                    if rel.target_node_id not in originals:
+                        if level == depth:
+                            # Beyond the depth: the target isn't copied, nor the relationship
+                            continue
+                        originals[rel.target_node_id] = await self.node_repo.get_by_id(rel.target_node_id)
+                        next_frontier.append(rel.target_node_id)
+                    relationships.append(rel)
+                    _check_size(len(originals) + len(relationships))
+            frontier = next_frontier
+
+        id_map: Dict[str, str] = {}
+        nodes = []
+        for original in originals.values():
+            node = await self._copy_node(original, patch if original.id == root.id else "")
+            id_map[original.id] = node.id
+            nodes.append(node)
+        copies = [
+            _copy_relationship(rel, id_map[rel.source_node_id], id_map[rel.target_node_id])
+            for rel in relationships
+        ]
+        await self.transfer_repo.import_batch([], nodes, copies)
+        await self._read(nodes)
+        return nodes[0], nodes, copies, id_map
+
+    async def _outgoing(self, node_id: str, types: Optional[set]) -> List[Relationship]:
+        """Retrieve all relationships from a node, only of types if any are given."""
+        relationships = []
+        page_token = ""
+        while True:
+            page, result = await self.relationship_repo.list(
+                node_id, None, None, ListOptions(page_size=_PAGE_SIZE, page_token=page_token)
+            )
+            relationships += [rel for rel in page if not types or rel.relationship_type in types]
+            page_token = result.next_page_token
+            if not page_token:
+                return relationships
+
+    async def _copy_node(self, original: Node, patch: str) -> Node:
+        """Build the copy of a node, with a new ID, patching and re-encrypting its data if patch is given."""
+        now = datetime.now()
+        node = Node(
+            id=new_id(),
+            node_type_id=original.node_type_id,
+            data=original.data,
+            created_at=now,
+            updated_at=now,
+            schema_version=original.schema_version,
+        )
+        if not patch:
+            # The data is copied as stored: sensitive fields stay encrypted with the tenant's data key
+            return node
+
+        fields = parse_data(patch)
+        node_type = await self.node_type_repo.get_by_id(original.node_type_id)
+        data = parse_data(await self._decrypt(node_type.schema, original.data))
+        for name, value in fields.items():
+            if value is None:
+                data.pop(name, None)
+            else:
+                data[name] = value
+        data_text = json.dumps(data)
+        data_text = prepare_data(node_type.schema, data_text)
+        node.data = await self.encryption.encrypt(node_type.schema, data_text) if self.encryption else data_text
+        node.schema_version = node_type.schema_version
+        return node
+
+    async def _read(self, nodes: List[Node]) -> None:
+        """Decrypt the sensitive fields of created copies in place, as reads return them."""
+        if not self.encryption:
+            return
+        schemas: Dict[str, str] = {}
+        for node in nodes:
+            if not self.encryption.may_be_encrypted(node.data):
+                continue
+            if node.node_type_id not in schemas:
+                schemas[node.node_type_id] = (await self.node_type_repo.get_by_id(node.node_type_id)).schema
+            node.data = await self.encryption.decrypt(schemas[node.node_type_id], node.data)
+
+    async def _decrypt(self, schema: str, data: str) -> str:
+        return await self.encryption.decrypt(schema, data) if self.encryption else data
+
+
+def _copy_relationship(rel: Relationship, source_node_id: str, target_node_id: str) -> Relationship:
+    now = datetime.now()
+    return Relationship(
+        id=new_id(),
+        source_node_id=source_node_id,
+        target_node_id=target_node_id,
+        relationship_type=rel.relationship_type,
+        data=rel.data,
+        created_at=now,
+        updated_at=now,
+    )
+
+
+def _check_size(records: int) -> None:
+    if records > MAX_CLONE_RECORDS:
+        raise ValueError(
+            f"clone would copy more than {MAX_CLONE_RECORDS} nodes and relationships; "
+            "lower the depth or limit the relationship types"
+        )
@@ -0,0 +1,54 @@
+"""
+Cluster status service implementation.
+"""
+
+from datetime import datetime
+from typing import Any, Dict
+
+from app.cluster import ROLES, negotiate
+from app.config import ClusterConfig
+from app.repository import ServerInstanceRepository
+
+LIVE = "live"
+STALE = "stale"
+
+
+class ClusterService:
+    """Reports the server instances sharing the control database and the leader roles they hold."""
+
+    def __init__(self, repo: ServerInstanceRepository, cfg: ClusterConfig):
+        self.repo = repo
+        self.cfg = cfg
+
+    async def status(self, now: datetime) -> Dict[str, Any]:
+        """
+        Return every registered instance, live or stale (no heartbeat for
+        CLUSTER_INSTANCE_TTL seconds), with the leader roles it holds, the
+        holder of each role (None if no instance holds it) and the features
+        and releases of the live instances.
+        """
+        instances = await self.repo.list_all()
+        leases = [lease for lease in await self.repo.list_leases() if lease.expires_at > now]
+
+        live = []
+        entries = []
+        for instance in instances:
+            age = (now - instance.heartbeat_at).total_seconds()
+            status = LIVE if age < self.cfg.instance_ttl else STALE
+            if status == LIVE:
+                live.append(instance)
+            entry = instance.to_dict()
+            entry["status"] = status
+            entry["heartbeat_age_seconds"] = round(max(age, 0.0), 3)
+            entry["leader_roles"] = [lease.role for lease in leases if lease.instance_id == instance.instance_id]
+            entries.append(entry)
+
+        held = {lease.role: lease.to_dict() for lease in leases}
+        return {
+            "instances": entries,
+            "live_instances": len(live),
+            "stale_instances": len(entries) - len(live),
+            "leader_roles": {role: held.get(role) for role in sorted(set(ROLES) | held.keys())},
+            "features": negotiate(live),
+            "releases": sorted({instance.release for instance in live}),
+        }
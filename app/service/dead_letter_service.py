@@ -0,0 +1,149 @@
+"""
+Dead letter queue.
+
+Webhook deliveries that run out of attempts and node migrations that fail are
+added to the tenant's dead letters, with the error and the payload needed to
+replay them, in the transaction recording the failure. Nothing is retried
+forever or dropped silently: an admin browses the dead letters and replays or
+discards them, one at a time or in bulk.
+
+Replaying a webhook delivery makes it pending again with its attempts reset,
+so the dispatcher delivers the original event once more. Replaying a node
+migration starts a new migration of the node type, with the same transform
+and batch size, to its current schema version. A dead letter is replayed at
+most once at a time; one whose replay fails again is added anew by the
+failure, and one whose replay could not be started is dead again with the
+replay's error.
+"""
+
+from typing import Dict, List, Optional, Tuple
+
+from app.repository import (
+    DEAD_LETTER_KINDS,
+    DEAD_LETTER_NODE_MIGRATION,
+    DEAD_LETTER_WEBHOOK_DELIVERY,
+    DeadLetter,
+    DeadLetterRepository,
+    FailedPreconditionError,
+    ListOptions,
+    ListResult,
+    NotFoundError,
+    WebhookRepository,
+    ValidationError,
+)
+from app.service.node_migration_service import NodeMigrationService
+
+DEAD_LETTER_STATUSES = ("dead", "replayed", "discarded")
+# Dead letters replayed by one bulk replay
+MAX_BULK_REPLAY = 500
+
+
+class DeadLetterService:
+    """Service for browsing, replaying and discarding dead letters."""
+
+    def __init__(
+        self,
+        repo: DeadLetterRepository,
+        webhook_repo: WebhookRepository,
+        node_migration_service: NodeMigrationService
+    ):
+        self.repo = repo
+        self.webhook_repo = webhook_repo
+        self.node_migration_service = node_migration_service
+
+    async def get_by_id(self, id: str) -> DeadLetter:
+        """Retrieve a dead letter by ID."""
+        if not id:
+            raise ValidationError("id", "is required")
+        return await self.repo.get_by_id(id)
+
+    async def list(
+        self,
+        kind: str,
+        status: str,
+        page_size: int,
+        page_token: str
+    ) -> Tuple[List[DeadLetter], ListResult]:
+        """Retrieve dead letters with pagination, optionally of one kind and status, oldest first."""
+        if kind and kind not in DEAD_LETTER_KINDS:
+            raise ValidationError("kind", f"must be one of: {', '.join(DEAD_LETTER_KINDS)}")
+        if status and status not in DEAD_LETTER_STATUSES:
+            raise ValidationError("status", f"must be one of: {', '.join(DEAD_LETTER_STATUSES)}")
+        opts = ListOptions(page_size=page_size, page_token=page_token)
+        return await self.repo.list(kind or None, status or None, opts)
+
+    async def replay(self, id: str) -> DeadLetter:
+        """Replay a dead letter; raises FailedPreconditionError if it was replayed or discarded."""
+        if not id:
+            raise ValidationError("id", "is required")
+        dead_letter = await self.repo.claim_replay(id)
+        if dead_letter is None:
+            current = await self.repo.get_by_id(id)
+            raise FailedPreconditionError(f"dead_letter {id} already {current.status}")
+
+        try:
+            dead_letter.replay_result = await self._replay(dead_letter)
+        except Exception as e:
+            dead_letter.status = "dead"
+            dead_letter.error = f"replay failed: {e}"
+            await self.repo.finish_replay(dead_letter, dead_letter.error)
+            raise
+        await self.repo.finish_replay(dead_letter)
+        return dead_letter
+
+    async def replay_many(
+        self,
+        ids: Optional[List[str]] = None,
+        kind: str = "",
+        limit: int = MAX_BULK_REPLAY
+    ) -> Tuple[List[DeadLetter], List[Dict[str, str]]]:
+        """
+        Replay the given dead letters, or without ids up to limit dead ones
+        (of kind, if given), oldest first. Returns the replayed dead letters
+        and an {"id", "error"} per dead letter that wasn't replayed.
+        """
+        if not 1 <= limit <= MAX_BULK_REPLAY:
+            raise ValidationError("limit", f"must be between 1 and {MAX_BULK_REPLAY}")
+        if ids:
+            if len(ids) > limit:
+                raise ValueError(f"at most {limit} ids can be replayed at once")
+        else:
+            dead, _ = await self.list(kind, "dead", limit, "")
+            ids = [d.id for d in dead]
+
+        replayed, errors = [], []
+        for id in ids:
+            try:
+                replayed.append(await self.replay(id))
+            except (NotFoundError, FailedPreconditionError, ValueError) as e:
+                errors.append({"id": id, "error": str(e)})
+        return replayed, errors
+
+    async def discard(self, id: str) -> DeadLetter:
+        """Discard a dead letter; raises FailedPreconditionError if it was replayed or discarded."""
+        if not id:
+            raise ValidationError("id", "is required")
+        dead_letter = await self.repo.discard(id)
+        if dead_letter is None:
+            current = await self.repo.get_by_id(id)
+            raise FailedPreconditionError(f"dead_letter {id} already {current.status}")
+        return dead_letter
+
+    async def _replay(self, dead_letter: DeadLetter) -> dict:
+        """Replay a claimed dead letter; returns the replay's result."""
+        if dead_letter.kind == DEAD_LETTER_WEBHOOK_DELIVERY:
+            try:
+                delivery = await self.webhook_repo.requeue_delivery(dead_letter.source_id)
+            except NotFoundError:
+                raise FailedPreconditionError("the webhook endpoint was deleted") from None
+            return {"delivery_id": delivery.id}
+        if dead_letter.kind == DEAD_LETTER_NODE_MIGRATION:
+            payload = dead_letter.payload
+            try:
+                migration = await self.node_migration_service.start(
+                    payload["node_type_id"], payload.get("transform", ""), payload["batch_size"]
+                )
+            except NotFoundError:
+                raise FailedPreconditionError("the node type was deleted") from None
+            return {"node_migration_id": migration.id}
+        raise FailedPreconditionError(f"dead letters of kind {dead_letter.kind} can't be replayed")
@@ -0,0 +1,38 @@
+"""
+Structured diffs of node data.
+
+Two JSON documents are compared field by field, descending into objects:
+fields only in the second are added, fields only in the first removed, and
+fields whose values differ changed. Paths are dot-separated, as in data
+filters ("address.city"). Arrays are compared as whole values, since their
+elements have no identity to match them by.
+"""
+
+import json
+from typing import Any, Dict, List
+
+
+def diff_data(before: str, after: str) -> Dict[str, List[Dict[str, Any]]]:
+    """Return the added, removed and changed paths between two data documents (JSON text), by path."""
+    diff: Dict[str, List[Dict[str, Any]]] = {"added": [], "removed": [], "changed": []}
+    _diff(json.loads(before or "{}"), json.loads(after or "{}"), [], diff)
+    for entries in diff.values():
+        entries.sort(key=lambda entry: entry["path"])
+    return diff
+
+
+def _diff(before: Any, after: Any, path: List[str], diff: Dict[str, List[Dict[str, Any]]]) -> None:
+    if isinstance(before, dict) and isinstance(after, dict):
+        for key in before.keys() - after.keys():
+            diff["removed"].append({"path": _path(path + [key]), "value": before[key]})
+        for key in after.keys() - before.keys():
+            diff["added"].append({"path": _path(path + [key]), "value": after[key]})
+        for key in before.keys() & after.keys():
+            _diff(before[key], after[key], path + [key], diff)
+    elif before != after or type(before) is not type(after):
+        # 1 and 1.0, or true and 1, compare equal in Python but not in JSON
+        diff["changed"].append({"path": _path(path), "from": before, "to": after})
+
+
+def _path(keys: List[str]) -> str:
+    return ".".join(keys)
@@ -0,0 +1,110 @@
+"""
+NodeType display metadata.
+
+Display metadata is a JSON object stored alongside a node type's schema so
+that every frontend renders nodes of that type the same way:
+
+    {
+      "label": "Blog Article",
+      "display_name_template": "{title} by {author}",
+      "default_sort": {"field": "published_at", "direction": "desc"},
+      "column_order": ["title", "author", "published_at"],
+      "field_labels": {"published_at": "Published"}
+    }
+
+All keys are optional. When the schema declares fields, field references
+(template placeholders, sort field, columns, labels) must name a declared
+field or one of the node columns in NODE_COLUMNS.
+"""
+
+import json
+import re
+from typing import Any, Dict, Optional, Set
+
+from app.repository import SortOrder, ValidationError
+from app.repository.node_repo import NODE_SORT_COLUMNS
+from app.service.schema import parse_schema
+
+DISPLAY_KEYS = ("label", "display_name_template", "default_sort", "column_order", "field_labels")
+SORT_DIRECTIONS = ("asc", "desc")
+NODE_COLUMNS = ("id",) + NODE_SORT_COLUMNS
+
+_PLACEHOLDER = re.compile(r"\{([^{}]+)\}")
+
+
+def parse_display(display: str) -> Dict[str, Any]:
+    """Parse display metadata into a JSON object."""
+    if not display:
+        return {}
+
+    try:
+        doc = json.loads(display)
+    except json.JSONDecodeError as e:
+        raise ValidationError("display", f"must be valid JSON: {e}") from e
+
+    if not isinstance(doc, dict):
+        raise ValidationError("display", "must be a JSON object")
+
+    return doc
+
+
+def validate_display(display: str, schema: str) -> None:
+    """Validate display metadata against the node type schema."""
+    doc = parse_display(display)
+
+    for key in doc:
+        if key not in DISPLAY_KEYS:
+            raise ValueError(f"display.{key} is not supported; expected one of: {', '.join(DISPLAY_KEYS)}")
+
+    declared = set(parse_schema(schema))
+
+    label = doc.get("label")
+    if label is not None and not isinstance(label, str):
+        raise ValidationError("display.label", "must be a string")
+
+    template = doc.get("display_name_template")
+    if template is not None:
+        if not isinstance(template, str):
+            raise ValidationError("display.display_name_template", "must be a string")
+        for name in _PLACEHOLDER.findall(template):
+            _check_field(declared, name, "display.display_name_template")
+
+    sort = doc.get("default_sort")
+    if sort is not None:
+        if not isinstance(sort, dict) or not isinstance(sort.get("field"), str) or not sort["field"]:
+            raise ValueError('display.default_sort must be an object like {"field": "name", "direction": "asc"}')
+        if sort.get("direction", "asc") not in SORT_DIRECTIONS:
+            raise ValidationError("display.default_sort.direction", f"must be one of: {', '.join(SORT_DIRECTIONS)}")
+        field = sort["field"]
+        if field not in NODE_SORT_COLUMNS and (field == "id" or (declared and field not in declared)):
+            raise ValueError(f"display.default_sort references unknown field: {field}")
+
+    columns = doc.get("column_order")
+    if columns is not None:
+        if not isinstance(columns, list) or not all(isinstance(c, str) for c in columns):
+            raise ValidationError("display.column_order", "must be an array of field names")
+        if len(set(columns)) != len(columns):
+            raise ValidationError("display.column_order", "must not contain duplicates")
+        for name in columns:
+            _check_field(declared, name, "display.column_order")
+
+    labels = doc.get("field_labels")
+    if labels is not None:
+        if not isinstance(labels, dict) or not all(isinstance(v, str) for v in labels.values()):
+            raise ValidationError("display.field_labels", "must map field names to strings")
+        for name in labels:
+            _check_field(declared, name, "display.field_labels")
+
+
+def default_sort(display: str) -> Optional[SortOrder]:
+    """Return the default sort order declared in display metadata, if any."""
+    sort = parse_display(display).get("default_sort")
+    if not sort:
+        return None
+    return SortOrder(field=sort["field"], descending=sort.get("direction") == "desc")
+
+
+def _check_field(declared: Set[str], name: str, where: str) -> None:
+    # Free-form schemas declare no fields, so any name is allowed
+    if declared and name not in declared and name not in NODE_COLUMNS:
+        raise ValueError(f"{where} references unknown field: {name}")
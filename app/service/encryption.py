@@ -0,0 +1,142 @@
+"""
+Encryption at rest of sensitive node data fields (envelope encryption).
+
+Values of fields a NodeType schema marks sensitive are encrypted before nodes
+are stored and decrypted when they are read, so the database, its backups,
+change events and exports only hold ciphertext:
+
+- each tenant has a random 256-bit data key, created on its first sensitive
+  write and stored in the tenant's data_keys table wrapped by the KMS with
+  the tenant's key encryption key (see app/encryption/kms.py);
+- a value is encrypted as its JSON text with AES-256-GCM under the data key,
+  bound to its field name, and stored as the string
+  "enc:<data key version>:<base64 of nonce and ciphertext>".
+
+Unwrapped data keys are cached in the process. Values stored before a field
+was marked sensitive stay readable and are encrypted when the node is next
+written. Sensitive values can't be filtered, sorted or aggregated on.
+"""
+
+import base64
+import binascii
+import json
+import os
+from typing import Any, Dict, Optional, Tuple
+
+from cryptography.exceptions import InvalidTag
+from cryptography.hazmat.primitives.ciphers.aead import AESGCM
+
+from app.encryption import KeyManagementService
+from app.repository import DataKey, FailedPreconditionError, NotFoundError
+from app.service.schema import sensitive_fields
+
+DATA_KEY_BYTES = 32
+NONCE_BYTES = 12
+ENCRYPTED_PREFIX = "enc:"
+
+# Unwrapped data keys by tenant ID and data key version
+_data_keys: Dict[Tuple[str, int], bytes] = {}
+
+
+class FieldEncryption:
+    """Encrypts and decrypts the sensitive fields of a tenant's node data."""
+
+    def __init__(self, kms: Optional[KeyManagementService], data_key_repo: Any, tenant_id: str):
+        self.kms = kms
+        self.data_key_repo = data_key_repo
+        self.tenant_id = tenant_id
+
+    async def encrypt(self, schema: str, data: str) -> str:
+        """Return node data (JSON text) with its sensitive field values encrypted."""
+        fields = sensitive_fields(schema)
+        if not fields:
+            return data
+        doc = json.loads(data)
+        present = [name for name in fields if name in doc and doc[name] is not None]
+        if not present:
+            return data
+
+        version, key = await self._current_key()
+        aead = AESGCM(key)
+        for name in present:
+            nonce = os.urandom(NONCE_BYTES)
+            ciphertext = aead.encrypt(nonce, json.dumps(doc[name]).encode(), name.encode())
+            doc[name] = f"{ENCRYPTED_PREFIX}{version}:{base64.b64encode(nonce + ciphertext).decode()}"
+        return json.dumps(doc)
+
+    async def decrypt(self, schema: str, data: str) -> str:
+        """Return node data (JSON text) with its sensitive field values decrypted."""
+        fields = sensitive_fields(schema)
+        if not fields:
+            return data
+        doc = json.loads(data)
+        encrypted = [name for name in fields if _is_encrypted(doc.get(name))]
+        if not encrypted:
+            return data
+
+        for name in encrypted:
+            version, payload = _parse_encrypted(name, doc[name])
+            key = await self._key(version)
+            try:
+                plaintext = AESGCM(key).decrypt(payload[:NONCE_BYTES], payload[NONCE_BYTES:], name.encode())
+            except InvalidTag:
+                raise ValueError(f"encrypted value of field {name} does not decrypt") from None
+            doc[name] = json.loads(plaintext)
+        return json.dumps(doc)
+
+    def may_be_encrypted(self, data: str) -> bool:
+        """Cheaply tell whether node data (JSON text) may hold encrypted values, before parsing its schema."""
+        return f'"{ENCRYPTED_PREFIX}' in data
+
+    async def _current_key(self) -> Tuple[int, bytes]:
+        """Return the version and key new values are encrypted with, creating the tenant's first key."""
+        kms = self._require_kms()
+        data_key = await self.data_key_repo.latest()
+        if data_key is None:
+            key = os.urandom(DATA_KEY_BYTES)
+            # Requests racing to create the first key all use the one stored first
+            data_key = await self.data_key_repo.create(DataKey(
+                version=1,
+                kms_key_id=kms.key_id,
+                wrapped_key=await kms.wrap_key(self.tenant_id, key),
+            ))
+        return data_key.version, await self._unwrap(data_key)
+
+    async def _key(self, version: int) -> bytes:
+        """Return the data key of a version."""
+        cached = _data_keys.get((self.tenant_id, version))
+        if cached:
+            return cached
+        self._require_kms()
+        try:
+            data_key = await self.data_key_repo.get(version)
+        except NotFoundError:
+            raise ValueError(f"data key version {version} of tenant {self.tenant_id} does not exist") from None
+        return await self._unwrap(data_key)
+
+    async def _unwrap(self, data_key: DataKey) -> bytes:
+        cache_key = (self.tenant_id, data_key.version)
+        if cache_key not in _data_keys:
+            _data_keys[cache_key] = await self._require_kms().unwrap_key(
+                self.tenant_id, data_key.kms_key_id, data_key.wrapped_key
+            )
+        return _data_keys[cache_key]
+
+    def _require_kms(self) -> KeyManagementService:
+        if self.kms is None:
+            raise FailedPreconditionError(
+                "sensitive fields require a KMS; set ENCRYPTION_MASTER_KEY or install one with configure_kms"
+            )
+        return self.kms
+
+
+def _is_encrypted(value: Any) -> bool:
+    return isinstance(value, str) and value.startswith(ENCRYPTED_PREFIX)
+
+
+def _parse_encrypted(name: str, value: str) -> Tuple[int, bytes]:
+    version, _, payload = value[len(ENCRYPTED_PREFIX):].partition(":")
+    try:
+        return int(version), base64.b64decode(payload, validate=True)
+    except (binascii.Error, ValueError):
+        raise ValueError(f"encrypted value of field {name} is malformed") from None
@@ -0,0 +1,71 @@
+"""
+Field history: who changed a field of a node, and when.
+
+A node's revisions are replayed oldest first, and every revision whose value
+at a data path ("address.city") differs from the previous revision's is a
+change of the field: added when the path gets a value, removed when it loses
+it, changed otherwise. Values are compared as JSON, so 1 and 1.0 differ.
+Deleting a node doesn't change its fields, so deletes aren't changes.
+"""
+
+import json
+from dataclasses import dataclass
+from typing import Any, Dict, List
+
+from app.repository import NodeRevision
+
+ADDED = "added"
+CHANGED = "changed"
+REMOVED = "removed"
+
+_MISSING = object()
+
+
+@dataclass
+class FieldChange:
+    """A change of the value at a data path, made by a node revision."""
+    revision: NodeRevision
+    change: str  # added | changed | removed
+    value: Any = None  # None once removed
+    previous_value: Any = None  # None when added
+
+    def to_dict(self) -> Dict[str, Any]:
+        return {
+            "revision_id": self.revision.id,
+            "version": self.revision.version,
+            "op": self.revision.op,
+            "actor": self.revision.actor or None,
+            "revised_at": self.revision.revised_at.isoformat(),
+            "change": self.change,
+            "value": self.value,
+            "previous_value": self.previous_value,
+        }
+
+
+def field_changes(revisions: List[NodeRevision], path: List[str]) -> List[FieldChange]:
+    """Return the changes of the value at a data path over revisions (oldest first), newest first."""
+    changes: List[FieldChange] = []
+    previous: Any = _MISSING
+    for revision in revisions:
+        value = _value_at(json.loads(revision.data or "{}"), path)
+        if value is _MISSING and previous is not _MISSING:
+            changes.append(FieldChange(revision, REMOVED, previous_value=previous))
+        elif value is not _MISSING and previous is _MISSING:
+            changes.append(FieldChange(revision, ADDED, value=value))
+        elif value is not _MISSING and _json(value) != _json(previous):
+            changes.append(FieldChange(revision, CHANGED, value=value, previous_value=previous))
+        previous = value
+    changes.reverse()
+    return changes
+
+
+def _value_at(data: Any, path: List[str]) -> Any:
+    for key in path:
+        if not isinstance(data, dict) or key not in data:
+            return _MISSING
+        data = data[key]
+    return data
+
+
+def _json(value: Any) -> str:
+    return json.dumps(value, sort_keys=True)
@@ -0,0 +1,98 @@
+"""
+Field masks: partial responses of get and list methods.
+
+A field mask lists the fields of a resource to return, as top-level field
+names ("version", "updated_at") and dot-separated paths into its data
+("data.title", "data.address.city"). "data" returns all of the data. The id
+is always returned. Other fields, and data values not on a listed path, are
+left out of the response.
+
+Node reads select only the top-level data fields the mask reaches in the
+database (see NodeRepository), so large documents aren't read in full to
+return a few fields.
+"""
+
+import json
+from dataclasses import dataclass
+from typing import Any, Dict, Iterable, List, Optional, Set
+
+from app.repository.errors import ValidationError
+from app.service.schema import parse_data_path
+
+MAX_FIELD_MASK_PATHS = 100
+
+
+@dataclass
+class FieldMask:
+    """The fields of a resource to return."""
+    fields: Set[str]
+    # Paths into data to return, or None for all of it
+    data_paths: Optional[List[List[str]]] = None
+
+    def data_fields(self) -> Optional[List[str]]:
+        """Return the top-level data fields the mask reaches, or None if it returns all data."""
+        if "data" not in self.fields:
+            return []
+        if self.data_paths is None:
+            return None
+        return sorted({path[0] for path in self.data_paths})
+
+    def apply(self, resource: Dict[str, Any]) -> Dict[str, Any]:
+        """Return the masked fields of a resource's dictionary."""
+        masked = {name: value for name, value in resource.items() if name in self.fields}
+        if self.data_paths is not None and "data" in masked:
+            masked["data"] = project_data(masked["data"], self.data_paths)
+        return masked
+
+
+def parse_field_mask(paths: Any, resource_fields: Iterable[str]) -> Optional[FieldMask]:
+    """
+    Validate a field mask against the top-level fields of a resource. Returns
+    None for no mask (all fields).
+    """
+    if paths is None:
+        return None
+    if not isinstance(paths, list) or not all(isinstance(path, str) for path in paths):
+        raise ValidationError("fields", "must be an array of field paths")
+    if not paths:
+        return None
+    if len(paths) > MAX_FIELD_MASK_PATHS:
+        raise ValidationError("fields", f"can have at most {MAX_FIELD_MASK_PATHS} paths")
+
+    allowed = set(resource_fields)
+    mask = FieldMask(fields={"id"}, data_paths=[])
+    all_data = False
+    for path in paths:
+        name, _, rest = path.partition(".")
+        if name not in allowed:
+            raise ValueError(f"fields: unknown field {name!r}; expected one of: {', '.join(sorted(allowed))}")
+        mask.fields.add(name)
+        if name != "data":
+            if rest:
+                raise ValueError(f"fields: {name} has no subfields: {path}")
+        elif rest:
+            mask.data_paths.append(parse_data_path(rest))
+        else:
+            all_data = True
+
+    if all_data or "data" not in mask.fields:
+        mask.data_paths = None
+    return mask
+
+
+def project_data(data: str, paths: List[List[str]]) -> str:
+    """Return the values of data (JSON text) at the given paths, keeping their nesting."""
+    doc = json.loads(data) if data else {}
+    projected: Dict[str, Any] = {}
+    for path in paths:
+        value: Any = doc
+        for key in path:
+            if not isinstance(value, dict) or key not in value:
+                break
+            value = value[key]
+        else:
+            target = projected
+            for key in path[:-1]:
+                target = target.setdefault(key, {})
+            target[path[-1]] = value
+    return json.dumps(projected)
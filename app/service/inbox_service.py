@@ -0,0 +1,255 @@
+"""
+Email inbox service implementation.
+"""
+
+import json
+import secrets
+import uuid
+from datetime import datetime, timezone
+from typing import Any, Dict, List, Optional, Tuple
+
+from app.events.signing import new_secret, updated_secret
+from app.intake.mail import InboundEmail
+from app.repository import (
+    EmailAttachment,
+    EmailInbox,
+    EmailInboxRepository,
+    Node,
+    NodeTypeRepository,
+    ListOptions,
+    ListResult,
+    NotFoundError,
+    ValidationError,
+)
+from app.service.node_service import NodeService
+from app.service.schema import parse_schema
+
+EMAIL_INBOX_STATUSES = ("active", "disabled")
+
+# Parts of an email that can be mapped to node data fields
+EMAIL_SOURCE_FIELDS = (
+    "from", "from_name", "to", "cc", "subject", "text", "html",
+    "message_id", "received_at", "attachments",
+)
+
+DEFAULT_EMAIL_FIELD_MAPPING = {"from": "from", "subject": "subject", "text": "body"}
+
+
+class EmailInboxService:
+    """Email inbox business logic service."""
+
+    def __init__(self, repo: EmailInboxRepository, node_type_repo: NodeTypeRepository, node_service: NodeService):
+        self.repo = repo
+        self.node_type_repo = node_type_repo
+        self.node_service = node_service
+
+    async def create(
+        self,
+        node_type_id: str,
+        name: str,
+        field_mapping: Optional[Dict[str, str]],
+        require_signature: bool = False,
+        dry_run: bool = False
+    ) -> EmailInbox:
+        """
+        Create a new email inbox with a freshly generated webhook token, and
+        signing secret if deliveries must be signed. A dry run validates the
+        inbox and returns it without saving it.
+        """
+        if not node_type_id:
+            raise ValidationError("node_type_id", "is required")
+        if not name:
+            raise ValidationError("name", "is required")
+
+        node_type = await self.node_type_repo.get_by_id(node_type_id)
+        if field_mapping is None:
+            field_mapping = dict(DEFAULT_EMAIL_FIELD_MAPPING)
+        self._validate_field_mapping(node_type.schema, field_mapping)
+
+        inbox = EmailInbox(
+            token=secrets.token_urlsafe(24),
+            node_type_id=node_type_id,
+            name=name,
+            field_mapping=field_mapping,
+            signing_secret=new_secret() if require_signature else "",
+        )
+        if dry_run:
+            return inbox
+        return await self.repo.create(inbox)
+
+    async def get_by_id(self, id: str) -> EmailInbox:
+        """Retrieve an email inbox by ID."""
+        if not id:
+            raise ValidationError("id", "is required")
+        return await self.repo.get_by_id(id)
+
+    async def get_active_by_token(self, token: str) -> EmailInbox:
+        """Retrieve an active email inbox by its webhook token. Disabled inboxes are not found."""
+        if not token:
+            raise NotFoundError("email_inbox not found")
+        inbox = await self.repo.get_by_token(token)
+        if inbox.status != "active":
+            raise NotFoundError("email_inbox not found")
+        return inbox
+
+    async def update(
+        self,
+        id: str,
+        name: str,
+        field_mapping: Optional[Dict[str, str]],
+        status: str,
+        rotate_token: bool = False,
+        require_signature: Optional[bool] = None,
+        rotate_signing_secret: bool = False,
+        dry_run: bool = False
+    ) -> EmailInbox:
+        """
+        Update an existing email inbox. rotate_token invalidates the old
+        webhook URL; rotate_signing_secret replaces the signing secret of an
+        inbox requiring signatures. A dry run validates the update and returns
+        the result without saving it.
+        """
+        if not id:
+            raise ValidationError("id", "is required")
+
+        inbox = await self.repo.get_by_id(id)
+
+        if name:
+            inbox.name = name
+        if field_mapping is not None:
+            node_type = await self.node_type_repo.get_by_id(inbox.node_type_id)
+            self._validate_field_mapping(node_type.schema, field_mapping)
+            inbox.field_mapping = field_mapping
+        if status:
+            if status not in EMAIL_INBOX_STATUSES:
+                raise ValidationError("status", f"must be one of: {', '.join(EMAIL_INBOX_STATUSES)}")
+            inbox.status = status
+        if rotate_token:
+            inbox.token = secrets.token_urlsafe(24)
+        inbox.signing_secret = updated_secret(inbox.signing_secret, require_signature, rotate_signing_secret)
+
+        if dry_run:
+            return inbox
+        return await self.repo.update(inbox)
+
+    async def delete(self, id: str) -> None:
+        """Delete an email inbox. Nodes created from its emails are kept."""
+        if not id:
+            raise ValidationError("id", "is required")
+        await self.repo.delete(id)
+
+    async def list(self, page_size: int, page_token: str) -> Tuple[List[EmailInbox], ListResult]:
+        """Retrieve email inboxes with pagination."""
+        opts = ListOptions(page_size=page_size, page_token=page_token)
+        return await self.repo.list(opts)
+
+    async def ingest(self, inbox: EmailInbox, email: InboundEmail) -> Tuple[Node, bool]:
+        """
+        Create a node from a received email and store its attachments.
+
+        Emails are deduplicated by Message-ID, so a provider redelivering a
+        message returns the node created the first time. Returns the node and
+        whether the email was a duplicate.
+        """
+        if email.message_id:
+            existing = await self.repo.find_message(inbox.id, email.message_id)
+            if existing:
+                return await self.node_service.get_by_id(existing), True
+
+        attachments = [
+            EmailAttachment(
+                id=str(uuid.uuid4()),
+                filename=a.filename,
+                content_type=a.content_type,
+                size_bytes=len(a.content),
+                content=a.content,
+            )
+            for a in email.attachments
+        ]
+
+        node_type = await self.node_type_repo.get_by_id(inbox.node_type_id)
+        data = self._map_fields(node_type.schema, inbox.field_mapping, email, attachments)
+        node = await self.node_service.create(inbox.node_type_id, json.dumps(data))
+
+        if email.message_id:
+            winner = await self.repo.record_message(inbox.id, email.message_id, node.id)
+            if winner != node.id:
+                # Lost a race with a concurrent delivery of the same message
+                await self.node_service.delete(node.id)
+                return await self.node_service.get_by_id(winner), True
+
+        for attachment in attachments:
+            attachment.node_id = node.id
+        await self.repo.add_attachments(attachments)
+
+        return node, False
+
+    async def list_attachments(self, node_id: str) -> List[EmailAttachment]:
+        """Retrieve attachment metadata of a node created from an email."""
+        if not node_id:
+            raise ValidationError("node_id", "is required")
+        return await self.repo.list_attachments(node_id)
+
+    async def get_attachment(self, id: str) -> EmailAttachment:
+        """Retrieve an email attachment including its content."""
+        if not id:
+            raise ValidationError("id", "is required")
+        return await self.repo.get_attachment(id)
+
+    def _map_fields(
+        self,
+        schema: str,
+        field_mapping: Dict[str, str],
+        email: InboundEmail,
+        attachments: List[EmailAttachment]
+    ) -> Dict[str, Any]:
+        values: Dict[str, Any] = {
+            "from": email.from_address,
+            "from_name": email.from_name,
+            "to": email.to,
+            "cc": email.cc,
+            "subject": email.subject,
+            "text": email.text,
+            "html": email.html,
+            "message_id": email.message_id,
+            "received_at": datetime.now(timezone.utc).isoformat(),
+            "attachments": [
+                {"id": a.id, "filename": a.filename, "content_type": a.content_type, "size_bytes": a.size_bytes}
+                for a in attachments
+            ],
+        }
+        specs = parse_schema(schema)
+
+        data: Dict[str, Any] = {}
+        for source, target in field_mapping.items():
+            value = values[source]
+            # Address lists go into string fields as a comma-separated list
+            if isinstance(value, list) and source in ("to", "cc") and target in specs \
+                    and specs[target].type == "string":
+                value = ", ".join(value)
+            data[target] = value
+        return data
+
+    def _validate_field_mapping(self, schema: str, field_mapping: Dict[str, str]) -> None:
+        if not isinstance(field_mapping, dict) or not field_mapping:
+            raise ValidationError("field_mapping", "must map email parts to data fields")
+
+        declared = parse_schema(schema)
+        targets = set()
+        for source, target in field_mapping.items():
+            if source not in EMAIL_SOURCE_FIELDS:
+                raise ValueError(
+                    f"field_mapping.{source} is not an email part; expected one of: {', '.join(EMAIL_SOURCE_FIELDS)}"
+                )
+            if not isinstance(target, str) or not target:
+                raise ValueError(f"field_mapping.{source} must be a field name")
+            if declared and target not in declared:
+                raise ValueError(f"field_mapping.{source} references unknown field: {target}")
+            if target in targets:
+                raise ValueError(f"field_mapping maps more than one email part to {target}")
+            targets.add(target)
+
+        # A required field nothing maps to would reject every email
+        for name, spec in declared.items():
+            if spec.required and name not in targets:
+                raise ValidationError("field_mapping", f"must map required field: {name}")
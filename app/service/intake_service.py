@@ -0,0 +1,204 @@
+"""
+Intake form service implementation.
+"""
+
+import json
+import secrets
+from typing import Any, Dict, List, Optional, Tuple
+
+from app.events.signing import new_secret, updated_secret
+from app.repository import (
+    IntakeForm,
+    IntakeFormRepository,
+    Node,
+    NodeTypeRepository,
+    ListOptions,
+    ListResult,
+    NotFoundError,
+    ValidationError,
+)
+from app.service.node_service import NodeService
+from app.service.schema import parse_schema
+
+INTAKE_FORM_STATUSES = ("active", "disabled")
+DEFAULT_INTAKE_RATE_LIMIT = 10
+MAX_INTAKE_RATE_LIMIT = 600
+
+
+def _validate_rate_limit(rate_limit_per_minute: int) -> None:
+    if not 1 <= rate_limit_per_minute <= MAX_INTAKE_RATE_LIMIT:
+        raise ValidationError("rate_limit_per_minute", f"must be between 1 and {MAX_INTAKE_RATE_LIMIT}")
+
+
+def _coerce_form_value(field_type: str, value: str) -> Any:
+    """Convert a url-encoded form value to the declared field type where unambiguous."""
+    if field_type == "integer":
+        try:
+            return int(value)
+        except ValueError:
+            return value
+    if field_type == "number":
+        try:
+            return float(value)
+        except ValueError:
+            return value
+    if field_type == "boolean" and value.lower() in ("true", "false", "on"):
+        return value.lower() != "false"
+    return value
+
+
+class IntakeFormService:
+    """Intake form business logic service."""
+
+    def __init__(self, repo: IntakeFormRepository, node_type_repo: NodeTypeRepository, node_service: NodeService):
+        self.repo = repo
+        self.node_type_repo = node_type_repo
+        self.node_service = node_service
+
+    async def create(
+        self,
+        node_type_id: str,
+        name: str,
+        fields: Optional[List[str]],
+        require_captcha: bool,
+        rate_limit_per_minute: int = DEFAULT_INTAKE_RATE_LIMIT,
+        require_signature: bool = False,
+        dry_run: bool = False
+    ) -> IntakeForm:
+        """
+        Create a new intake form with a freshly generated public token, and
+        signing secret if submissions must be signed. A dry run validates the
+        form and returns it without saving it.
+        """
+        if not node_type_id:
+            raise ValidationError("node_type_id", "is required")
+        if not name:
+            raise ValidationError("name", "is required")
+        _validate_rate_limit(rate_limit_per_minute)
+
+        node_type = await self.node_type_repo.get_by_id(node_type_id)
+        fields = list(fields or [])
+        self._validate_fields(node_type.schema, fields)
+
+        form = IntakeForm(
+            token=secrets.token_urlsafe(24),
+            node_type_id=node_type_id,
+            name=name,
+            fields=fields,
+            require_captcha=require_captcha,
+            rate_limit_per_minute=rate_limit_per_minute,
+            signing_secret=new_secret() if require_signature else "",
+        )
+        if dry_run:
+            return form
+        return await self.repo.create(form)
+
+    async def get_by_id(self, id: str) -> IntakeForm:
+        """Retrieve an intake form by ID."""
+        if not id:
+            raise ValidationError("id", "is required")
+        return await self.repo.get_by_id(id)
+
+    async def get_active_by_token(self, token: str) -> IntakeForm:
+        """Retrieve an active intake form by its public token. Disabled forms are not found."""
+        if not token:
+            raise NotFoundError("intake_form not found")
+        form = await self.repo.get_by_token(token)
+        if form.status != "active":
+            raise NotFoundError("intake_form not found")
+        return form
+
+    async def update(
+        self,
+        id: str,
+        name: str,
+        fields: Optional[List[str]],
+        require_captcha: Optional[bool],
+        rate_limit_per_minute: int,
+        status: str,
+        rotate_token: bool = False,
+        require_signature: Optional[bool] = None,
+        rotate_signing_secret: bool = False,
+        dry_run: bool = False
+    ) -> IntakeForm:
+        """
+        Update an existing intake form. rotate_token invalidates the old public
+        URL; rotate_signing_secret replaces the signing secret of a form
+        requiring signatures. A dry run validates the update and returns the
+        result without saving it.
+        """
+        if not id:
+            raise ValidationError("id", "is required")
+
+        form = await self.repo.get_by_id(id)
+
+        if name:
+            form.name = name
+        if fields is not None:
+            node_type = await self.node_type_repo.get_by_id(form.node_type_id)
+            self._validate_fields(node_type.schema, fields)
+            form.fields = list(fields)
+        if require_captcha is not None:
+            form.require_captcha = require_captcha
+        if rate_limit_per_minute:
+            _validate_rate_limit(rate_limit_per_minute)
+            form.rate_limit_per_minute = rate_limit_per_minute
+        if status:
+            if status not in INTAKE_FORM_STATUSES:
+                raise ValidationError("status", f"must be one of: {', '.join(INTAKE_FORM_STATUSES)}")
+            form.status = status
+        if rotate_token:
+            form.token = secrets.token_urlsafe(24)
+        form.signing_secret = updated_secret(form.signing_secret, require_signature, rotate_signing_secret)
+
+        if dry_run:
+            return form
+        return await self.repo.update(form)
+
+    async def delete(self, id: str) -> None:
+        """Delete an intake form."""
+        if not id:
+            raise ValidationError("id", "is required")
+        await self.repo.delete(id)
+
+    async def list(self, page_size: int, page_token: str) -> Tuple[List[IntakeForm], ListResult]:
+        """Retrieve intake forms with pagination."""
+        opts = ListOptions(page_size=page_size, page_token=page_token)
+        return await self.repo.list(opts)
+
+    async def submit(self, form: IntakeForm, data: Dict[str, Any], url_encoded: bool = False) -> Node:
+        """
+        Create a node from a public submission.
+
+        Only the form's fields are accepted. url_encoded submissions carry
+        every value as a string, so values of integer, number and boolean
+        fields are converted before schema validation.
+        """
+        for key in data:
+            if form.fields and key not in form.fields:
+                raise ValueError(f"data.{key} is not accepted by this form")
+
+        if url_encoded:
+            node_type = await self.node_type_repo.get_by_id(form.node_type_id)
+            specs = parse_schema(node_type.schema)
+            data = {
+                key: _coerce_form_value(specs[key].type, value) if key in specs else value
+                for key, value in data.items()
+            }
+
+        return await self.node_service.create(form.node_type_id, json.dumps(data))
+
+    def _validate_fields(self, schema: str, fields: List[str]) -> None:
+        declared = parse_schema(schema)
+        if len(set(fields)) != len(fields):
+            raise ValidationError("fields", "must not contain duplicates")
+        for name in fields:
+            if not isinstance(name, str) or not name:
+                raise ValidationError("fields", "must be an array of field names")
+            if declared and name not in declared:
+                raise ValueError(f"fields references unknown field: {name}")
+        # A required field the form does not accept could never be submitted
+        if fields:
+            for name, spec in declared.items():
+                if spec.required and name not in fields:
+                    raise ValidationError("fields", f"must include required field: {name}")
@@ -0,0 +1,90 @@
+"""
+Locale resolution for localized_string node data fields.
+
+Readers pass a preferred locale list such as "fr-CA,fr,en" (an
+Accept-Language style list without weights). For each localized_string
+field, the first available value is picked from:
+
+1. each preferred locale in order, each followed by its base language
+   (fr-CA falls back to fr),
+2. the field's default_locale from the schema,
+3. the alphabetically first locale present,
+
+and the locale map is replaced by that string. Matching ignores case.
+"""
+
+import json
+from typing import Dict, List, Optional
+
+from app.service.schema import LOCALIZED_STRING_FIELD_TYPE, FieldSpec, is_locale_tag, parse_data, parse_schema
+
+MAX_PREFERRED_LOCALES = 10
+
+
+def parse_locales(locale: str) -> List[str]:
+    """Parse a comma-separated preferred locale list, raising ValueError on bad tags."""
+    if not locale:
+        return []
+
+    tags = [tag.strip() for tag in locale.split(",") if tag.strip()]
+    if len(tags) > MAX_PREFERRED_LOCALES:
+        raise ValueError(f"locale accepts at most {MAX_PREFERRED_LOCALES} locales")
+    for tag in tags:
+        if not is_locale_tag(tag):
+            raise ValueError(f'locale has invalid locale tag: {tag}; expected e.g. "fr-CA,fr,en"')
+    return tags
+
+
+def resolve_locale(values: Dict[str, str], preferred: List[str], default_locale: Optional[str] = None) -> Optional[str]:
+    """Pick the best value from a locale map for the preferred locales."""
+    if not values:
+        return None
+
+    by_locale = {locale.lower(): text for locale, text in values.items()}
+
+    candidates: List[str] = []
+    for tag in preferred:
+        tag = tag.lower()
+        candidates.append(tag)
+        base = tag.split("-", 1)[0]
+        if base != tag:
+            candidates.append(base)
+    if default_locale:
+        candidates.append(default_locale.lower())
+
+    for candidate in candidates:
+        if candidate in by_locale:
+            return by_locale[candidate]
+
+    return by_locale[min(by_locale)]
+
+
+def localize_data(schema: str, data: str, preferred: List[str]) -> str:
+    """
+    Resolve localized_string fields in node data to a single string.
+
+    Data is returned unchanged when no locales are preferred or the schema
+    declares no localized_string fields.
+    """
+    if not preferred or not data:
+        return data
+
+    fields = _localized_fields(schema)
+    if not fields:
+        return data
+
+    doc = parse_data(data)
+    changed = False
+    for name, spec in fields.items():
+        if isinstance(doc.get(name), dict):
+            doc[name] = resolve_locale(doc[name], preferred, spec.default_locale)
+            changed = True
+
+    return json.dumps(doc) if changed else data
+
+
+def _localized_fields(schema: str) -> Dict[str, FieldSpec]:
+    return {
+        name: spec for name, spec in parse_schema(schema).items()
+        if spec.type == LOCALIZED_STRING_FIELD_TYPE
+    }
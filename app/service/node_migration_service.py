@@ -0,0 +1,216 @@
+"""
+Node schema migration service implementation.
+
+Every NodeType has a schema_version that is incremented whenever its schema
+changes, and every node records the version its data was last validated
+against. Nodes below their node type's version may no longer match the schema.
+validate_existing checks them without changing anything; a node migration
+rewrites them in the background with a transform (see app/service/transform.py)
+and validates the result against the current schema. Sensitive fields are
+decrypted before transforms and validation and encrypted again when nodes are
+rewritten (see app/service/encryption.py).
+"""
+
+import json
+from typing import List, Optional, Tuple
+
+from app.repository import (
+    ConflictError,
+    FailedPreconditionError,
+    ListOptions,
+    ListResult,
+    NodeMigration,
+    NodeMigrationRepository,
+    NodeRepository,
+    NodeTypeRepository,
+    NodeValidationReport,
+    NotFoundError,
+    ValidationError,
+)
+from app.service.encryption import FieldEncryption
+from app.service.schema import SchemaValidator, parse_data, validate_schema
+from app.service.transform import apply_transform, parse_transform
+
+DEFAULT_MIGRATION_BATCH_SIZE = 500
+MAX_MIGRATION_BATCH_SIZE = 5000
+DEFAULT_MAX_ERRORS = 100
+MAX_ERRORS = 1000
+# Failed nodes recorded on a migration; all of them are counted
+MAX_RECORDED_FAILURES = 100
+
+_VALIDATION_BATCH_SIZE = 500
+
+
+class NodeMigrationService:
+    """Node schema validation and migration business logic service."""
+
+    def __init__(
+        self,
+        repo: NodeMigrationRepository,
+        node_type_repo: NodeTypeRepository,
+        node_repo: NodeRepository,
+        encryption: Optional[FieldEncryption] = None
+    ):
+        self.repo = repo
+        self.node_type_repo = node_type_repo
+        self.node_repo = node_repo
+        self.encryption = encryption
+
+    async def validate_existing(
+        self,
+        node_type_id: str,
+        schema: str = "",
+        transform: str = "",
+        max_errors: int = DEFAULT_MAX_ERRORS
+    ) -> NodeValidationReport:
+        """
+        Validate a node type's nodes without changing them.
+
+        Nodes are checked against schema if given (e.g. a schema about to be
+        set with UpdateNodeType), otherwise against the current schema. If a
+        transform is given, it is first applied to the nodes a migration would
+        rewrite: those below the current schema version, or all of them when
+        schema differs from the current one.
+        """
+        if not node_type_id:
+            raise ValidationError("node_type_id", "is required")
+        if not 1 <= max_errors <= MAX_ERRORS:
+            raise ValidationError("max_errors", f"must be between 1 and {MAX_ERRORS}")
+        ops = parse_transform(transform)
+        node_type = await self.node_type_repo.get_by_id(node_type_id)
+
+        target_version = node_type.schema_version
+        if schema:
+            validate_schema(schema)
+            if _json_value(schema) != _json_value(node_type.schema):
+                target_version += 1
+        else:
+            schema = node_type.schema
+
+        validator = SchemaValidator(schema)
+        report = NodeValidationReport()
+        async for node in self.node_repo.stream(node_type_id, _VALIDATION_BATCH_SIZE):
+            report.checked += 1
+            if node.schema_version < node_type.schema_version:
+                report.outdated_count += 1
+            try:
+                data = await self._decrypt(node_type.schema, node.data)
+                if ops and node.schema_version < target_version:
+                    data = json.dumps(apply_transform(ops, parse_data(data)))
+                validator.validate(data)
+            except ValueError as e:
+                report.invalid_count += 1
+                if len(report.errors) < max_errors:
+                    report.errors.append({
+                        "node_id": node.id,
+                        "schema_version": node.schema_version,
+                        "error": str(e),
+                    })
+        return report
+
+    async def start(
+        self,
+        node_type_id: str,
+        transform: str = "",
+        batch_size: int = DEFAULT_MIGRATION_BATCH_SIZE
+    ) -> NodeMigration:
+        """Start migrating a node type's outdated nodes to its current schema version."""
+        if not node_type_id:
+            raise ValidationError("node_type_id", "is required")
+        if not 1 <= batch_size <= MAX_MIGRATION_BATCH_SIZE:
+            raise ValidationError("batch_size", f"must be between 1 and {MAX_MIGRATION_BATCH_SIZE}")
+        ops = parse_transform(transform)
+        node_type = await self.node_type_repo.get_by_id(node_type_id)
+
+        migration = NodeMigration(
+            node_type_id=node_type.id,
+            target_schema_version=node_type.schema_version,
+            transform=transform if ops else "[]",
+            batch_size=batch_size,
+        )
+        return await self.repo.create(migration)
+
+    async def get_by_id(self, id: str) -> NodeMigration:
+        """Retrieve a migration by ID."""
+        if not id:
+            raise ValidationError("id", "is required")
+        return await self.repo.get_by_id(id)
+
+    async def list(
+        self,
+        node_type_id: Optional[str],
+        page_size: int,
+        page_token: str
+    ) -> Tuple[List[NodeMigration], ListResult]:
+        """Retrieve migrations with pagination, newest first."""
+        opts = ListOptions(page_size=page_size, page_token=page_token)
+        return await self.repo.list(node_type_id, opts)
+
+    async def cancel(self, id: str) -> NodeMigration:
+        """Cancel a pending or running migration; nodes migrated so far keep their new data."""
+        if not id:
+            raise ValidationError("id", "is required")
+        migration = await self.repo.cancel(id)
+        if migration.status != "cancelled":
+            raise FailedPreconditionError(f"node_migration {id} already {migration.status}")
+        return migration
+
+    async def run_batch(self, migration: NodeMigration) -> None:
+        """
+        Migrate the next batch of a running migration's nodes, updating its progress.
+
+        Sets the status to succeeded once no outdated nodes are left, or to
+        failed if the node type's schema changed again since the migration
+        started. Nodes are updated with their version as expected version, so
+        concurrent edits win; nodes changed or deleted concurrently are skipped.
+        Nodes whose transformed data is invalid keep their data and are counted
+        as failed.
+        """
+        try:
+            node_type = await self.node_type_repo.get_by_id(migration.node_type_id)
+        except NotFoundError:
+            migration.status = "failed"
+            migration.error = "node type was deleted"
+            return
+        if node_type.schema_version != migration.target_schema_version:
+            migration.status = "failed"
+            migration.error = (
+                f"node type schema changed to version {node_type.schema_version}; start a new migration"
+            )
+            return
+
+        ops = parse_transform(migration.transform)
+        validator = SchemaValidator(node_type.schema)
+        nodes = await self.node_repo.list_outdated(
+            node_type.id, migration.target_schema_version, migration.last_node_id, migration.batch_size
+        )
+        for node in nodes:
+            migration.last_node_id = node.id
+            try:
+                data = await self._decrypt(node_type.schema, node.data)
+                data = json.dumps(apply_transform(ops, parse_data(data)))
+                node.data = validator.prepare(data)
+            except ValueError as e:
+                migration.failed_count += 1
+                if len(migration.failures) < MAX_RECORDED_FAILURES:
+                    migration.failures.append({"node_id": node.id, "error": str(e)})
+                continue
+
+            if self.encryption:
+                node.data = await self.encryption.encrypt(node_type.schema, node.data)
+            node.schema_version = migration.target_schema_version
+            try:
+                await self.node_repo.update(node, node.version)
+            except (ConflictError, NotFoundError):
+                continue
+            migration.migrated_count += 1
+
+        if len(nodes) < migration.batch_size:
+            migration.status = "succeeded"
+
+    async def _decrypt(self, schema: str, data: str) -> str:
+        return await self.encryption.decrypt(schema, data) if self.encryption else data
+
+
+def _json_value(value: str):
+    return json.loads(value) if value else None
@@ -2,63 +2,643 @@
 Node service implementation.
 """
 
-from typing import List, Optional, Tuple
+import json
+from datetime import datetime, timezone
+from typing import Any, AsyncIterator, Dict, List, Optional, Tuple
+from zoneinfo import ZoneInfo, ZoneInfoNotFoundError
 
-from app.repository import Node, NodeRepository, NodeTypeRepository, ListOptions, ListResult
+from app.repository import (
+    Node,
+    NodeRevision,
+    NodeRepository,
+    NodeType,
+    NodeTypeRepository,
+    GeoFilter,
+    DataFilter,
+    Aggregation,
+    AggregationRange,
+    AggregationBucket,
+    BatchHook,
+    ListOptions,
+    ListResult,
+    NotFoundError,
+    MAX_PAGE_SIZE,
+    ValidationError,
+)
+from app.repository.node_repo import NODE_SORT_COLUMNS
+from app.repository.versioning import expected_version_from
+from app.service.diff import diff_data
+from app.service.display import default_sort
+from app.service.encryption import FieldEncryption
+from app.service.field_history import FieldChange, field_changes
+from app.service.node_lock_service import NodeLockService
+from app.service.localization import localize_data, parse_locales
+from app.service.ordering import data_sort_path, parse_order_by, require_sort_index
+from app.service.schema import GEO_FIELD_TYPES, SchemaValidator, field_type, parse_data_path
+from app.service.tenant_check import TenantCheck
+from app.service.validator_cache import ValidatorCache
+
+DEFAULT_STREAM_BATCH_SIZE = 500
+MAX_STREAM_BATCH_SIZE = 5000
+
+DELETE_BATCH_SIZE = 1000
+
+MAX_BATCH_GET_IDS = 500
+
+
+def batch_get_ids(ids: List[str]) -> List[str]:
+    """Check the IDs of a batch get and return them without repeats; raises ValueError if invalid."""
+    if not isinstance(ids, list) or not all(isinstance(id, str) and id for id in ids):
+        raise ValidationError("ids", "must be a list of IDs")
+    if not 1 <= len(ids) <= MAX_BATCH_GET_IDS:
+        raise ValidationError("ids", f"must list between 1 and {MAX_BATCH_GET_IDS} IDs")
+    return list(dict.fromkeys(ids))
 
 
 class NodeService:
     """Node business logic service."""
 
-    def __init__(self, repo: NodeRepository, node_type_repo: NodeTypeRepository):
+    def __init__(
+        self,
+        repo: NodeRepository,
+        node_type_repo: NodeTypeRepository,
+        encryption: Optional[FieldEncryption] = None,
+        tenant_check: Optional[TenantCheck] = None,
+        validators: Optional[ValidatorCache] = None,
+        locks: Optional[NodeLockService] = None
+    ):
         self.repo = repo
         self.node_type_repo = node_type_repo
+        # Encrypts sensitive fields (see app/service/encryption.py); None stores them as given
+        self.encryption = encryption
+        # Verifies the tenant accepts writes; None skips the check
+        self.tenant_check = tenant_check
+        # Compiled schema validators of node types; None compiles them per write
+        self.validators = validators
+        # Node locks, which the repository checks in the transaction of
+        # updates and deletes; None has no locks and rejects lock tokens
+        self.locks = locks
 
-    async def create(self, node_type_id: str, data: str) -> Node:
-        """Create a new node."""
+    async def create(self, node_type_id: str, data: str, dry_run: bool = False) -> Node:
+        """Create a new node; a dry run validates it and returns it without saving it."""
         if not node_type_id:
-            raise ValueError("node_type_id is required")
+            raise ValidationError("node_type_id", "is required")
+        await self._check_tenant()
 
         # Validate that the node type exists (repository is already scoped to tenant database)
         node_type = await self.node_type_repo.get_by_id(node_type_id)
+        data = self._validator(node_type).prepare(data)
 
         node = Node(
             tenant_id="",  # Not stored in tenant database
             node_type_id=node_type_id,
-            data=data,
+            data=await self._encrypt(node_type.schema, data),
+            schema_version=node_type.schema_version,
         )
-        return await self.repo.create(node)
+        node = await self.repo.create(node, dry_run)
+        node.data = data
+        return node
 
-    async def get_by_id(self, id: str) -> Node:
-        """Retrieve a node by ID."""
+    async def get_by_id(self, id: str, locale: str = "", data_fields: Optional[List[str]] = None) -> Node:
+        """
+        Retrieve a node by ID, resolving localized fields to the preferred
+        locales if given, with only the given top-level data fields if
+        data_fields isn't None.
+        """
         if not id:
-            raise ValueError("id is required")
-        return await self.repo.get_by_id(id)
+            raise ValidationError("id", "is required")
+        preferred = parse_locales(locale)
+        node = await self.repo.get_by_id(id, data_fields)
+        await self._read([node], preferred)
+        return node
+
+    async def batch_get(
+        self, ids: List[str], locale: str = "", data_fields: Optional[List[str]] = None
+    ) -> Tuple[List[Node], List[str]]:
+        """
+        Retrieve up to MAX_BATCH_GET_IDS nodes by ID in one query, like
+        get_by_id; returns the nodes found, in the order of ids, and the IDs
+        of those that don't exist. Repeated IDs are fetched once.
+        """
+        ids = batch_get_ids(ids)
+        preferred = parse_locales(locale)
+        found = {node.id: node for node in await self.repo.get_many(ids, data_fields)}
+        nodes = [found[id] for id in ids if id in found]
+        await self._read(nodes, preferred)
+        return nodes, [id for id in ids if id not in found]
 
-    async def update(self, id: str, data: str) -> Node:
-        """Update an existing node."""
+    async def update(
+        self,
+        id: str,
+        data: str,
+        expected_version: Optional[int] = None,
+        if_match: str = "",
+        dry_run: bool = False,
+        lock_token: str = ""
+    ) -> Node:
+        """
+        Update an existing node, optionally only if it is still at
+        expected_version or the version of the if_match entity tag, and only
+        if lock_token holds its lock (see app/service/node_lock_service.py).
+        A dry run validates the update without saving it.
+        """
         if not id:
-            raise ValueError("id is required")
+            raise ValidationError("id", "is required")
+        expected_version = expected_version_from(expected_version, if_match)
+        await self._check_tenant()
+        self._check_lock_token(lock_token)
 
         node = await self.repo.get_by_id(id)
 
+        if data:
+            node_type = await self.node_type_repo.get_by_id(node.node_type_id)
+            data = self._validator(node_type).prepare(data)
+            node.data = await self._encrypt(node_type.schema, data)
+            node.schema_version = node_type.schema_version
+
+        node = await self.repo.update(node, expected_version, dry_run, lock_token)
         if data:
             node.data = data
+        else:
+            await self._read([node], [])
+        return node
 
-        return await self.repo.update(node)
+    async def delete(
+        self,
+        id: str,
+        expected_version: Optional[int] = None,
+        if_match: str = "",
+        dry_run: bool = False,
+        lock_token: str = ""
+    ) -> None:
+        """
+        Delete a node, optionally only if it is still at expected_version or
+        the version of the if_match entity tag, and only if lock_token holds
+        its lock. A dry run only checks that it could be.
+        """
+        if not id:
+            raise ValidationError("id", "is required")
+        await self._check_tenant()
+        self._check_lock_token(lock_token)
+        await self.repo.delete(id, expected_version_from(expected_version, if_match), dry_run, lock_token)
+
+    async def delete_many(
+        self,
+        node_type_id: Optional[str],
+        data_filter: Any,
+        dry_run: bool = False,
+        on_batch: Optional[BatchHook] = None
+    ) -> int:
+        """
+        Delete the nodes of a node type and/or whose data contains data_filter,
+        a JSON object (or its JSON text). Returns the number of nodes deleted,
+        or with dry_run, the number that would be. on_batch follows the
+        progress and may stop the delete between batches.
+        """
+        if isinstance(data_filter, str) and data_filter:
+            try:
+                data_filter = json.loads(data_filter)
+            except ValueError as e:
+                raise ValidationError("filter", f"is not valid JSON: {e}") from None
+        if data_filter is not None and not isinstance(data_filter, dict):
+            raise ValidationError("filter", "must be a JSON object")
+        if not node_type_id and not data_filter:
+            raise ValidationError("node_type_id", "or filter is required")
+        await self._check_tenant()
+
+        if node_type_id:
+            await self.node_type_repo.get_by_id(node_type_id)
+        return await self.repo.delete_many(
+            node_type_id, json.dumps(data_filter) if data_filter else None, DELETE_BATCH_SIZE, dry_run, on_batch
+        )
+
+    async def list_revisions(self, id: str, page_size: int, page_token: str) -> Tuple[List[NodeRevision], ListResult]:
+        """Retrieve the revisions of a node, also after it was deleted, newest first."""
+        if not id:
+            raise ValidationError("id", "is required")
+        opts = ListOptions(page_size=page_size, page_token=page_token)
+        revisions, result = await self.repo.list_revisions(id, opts)
+        await self._read(revisions, [])
+        return revisions, result
 
-    async def delete(self, id: str) -> None:
-        """Delete a node."""
+    async def diff_revisions(
+        self, id: str, from_revision_id: str, to_revision_id: str = ""
+    ) -> Tuple[NodeRevision, NodeRevision, Dict[str, List[Dict[str, Any]]]]:
+        """
+        Compare the data of two revisions of a node, to_revision_id defaulting
+        to the latest. Returns both revisions and the added, removed and
+        changed data paths (see diff_data).
+        """
         if not id:
-            raise ValueError("id is required")
-        await self.repo.delete(id)
+            raise ValidationError("id", "is required")
+        if not from_revision_id:
+            raise ValidationError("from_revision_id", "is required")
+
+        before = await self.repo.get_revision(id, _revision_id("from_revision_id", from_revision_id))
+        if to_revision_id:
+            after = await self.repo.get_revision(id, _revision_id("to_revision_id", to_revision_id))
+        else:
+            revisions, _ = await self.repo.list_revisions(id, ListOptions(page_size=1))
+            after = revisions[0]
+
+        # Both are decrypted: encrypted values differ on every write
+        await self._read([before, after], [])
+        return before, after, diff_data(before.data, after.data)
+
+    async def field_history(
+        self, id: str, path: str, page_size: int, page_token: str
+    ) -> Tuple[List[FieldChange], ListResult]:
+        """
+        Retrieve the changes of the value at a data path of a node, newest
+        first, with the revision and actor that made each (see field_history.py).
+        """
+        if not id:
+            raise ValidationError("id", "is required")
+        if not path:
+            raise ValidationError("path", "is required")
+        try:
+            keys = parse_data_path(path)
+        except ValueError as e:
+            raise ValidationError("path", f"is invalid: {e}") from None
+
+        # Changes are found by replaying the whole history, which is paged newest first
+        revisions: Dict[str, NodeRevision] = {}
+        opts = ListOptions(page_size=MAX_PAGE_SIZE)
+        while True:
+            page, result = await self.repo.list_revisions(id, opts)
+            revisions.update((r.id, r) for r in page)
+            if not result.next_page_token:
+                break
+            opts.page_token = result.next_page_token
+        history = list(reversed(revisions.values()))
+        # Decrypted, as encrypted values differ on every write
+        await self._read(history, [])
+        changes = field_changes(history, keys)
+
+        page_size = max(1, min(page_size or 10, MAX_PAGE_SIZE))
+        try:
+            offset = max(0, int(page_token)) if page_token else 0
+        except ValueError:
+            offset = 0
+        page = changes[offset:offset + page_size]
+        result = ListResult(total_count=len(changes))
+        if offset + len(page) < len(changes):
+            result.next_page_token = str(offset + len(page))
+        return page, result
+
+    async def get_at(self, id: str, timestamp: str, locale: str = "") -> Node:
+        """
+        Retrieve a node as it was at an ISO 8601 time (UTC unless it has an
+        offset), resolving localized fields to the preferred locales if given.
+        """
+        if not id:
+            raise ValidationError("id", "is required")
+        if not timestamp:
+            raise ValidationError("timestamp", "is required")
+        at = _parse_time("timestamp", timestamp)
+
+        preferred = parse_locales(locale)
+        node = await self.repo.get_at(id, at)
+        await self._read([node], preferred)
+        return node
 
     async def list(
         self,
         node_type_id: Optional[str],
         page_size: int,
-        page_token: str
+        page_token: str,
+        geo: Optional[Dict[str, Any]] = None,
+        locale: str = "",
+        data_filter: Any = None,
+        contains: Any = None,
+        data_fields: Optional[List[str]] = None,
+        order_by: Any = None,
+        as_of: str = ""
     ) -> Tuple[List[Node], ListResult]:
-        """Retrieve nodes with pagination and optional filtering."""
+        """
+        Retrieve nodes with pagination and optional filtering. data_filter and
+        contains map data paths ("address.city") to JSON values the value at
+        the path must equal or contain; indexes of the node type on those
+        paths serve them. With data_fields, only those top-level data fields
+        are read. order_by sorts by a column or an indexed data path (see
+        app/service/ordering.py). With as_of, an ISO 8601 time, nodes are
+        listed as they were then, from their revisions.
+        """
+        preferred = parse_locales(locale)
         opts = ListOptions(page_size=page_size, page_token=page_token)
-        return await self.repo.list(node_type_id, opts)
+        at = _parse_time("as_of", as_of) if as_of else None
+        if at and geo:
+            raise ValidationError("as_of", "can't be combined with geo")
+        geo_filter = await self._build_geo_filter(node_type_id, geo) if geo else None
+        conditions = _build_data_filter(data_filter, contains)
+        requested_sort = parse_order_by(order_by, NODE_SORT_COLUMNS, data_paths=True)
+
+        # Listings of a single node type use its display default sort. An unknown
+        # node type simply matches no nodes, as before.
+        sort = None
+        if node_type_id:
+            try:
+                node_type = await self.node_type_repo.get_by_id(node_type_id)
+                sort = default_sort(node_type.display)
+            except NotFoundError:
+                pass
+
+        if requested_sort:
+            if geo_filter and geo_filter.order_by_distance:
+                raise ValidationError("order_by", "can't be combined with geo.order_by_distance")
+            path = data_sort_path(requested_sort)
+            if path is not None:
+                if not node_type_id:
+                    raise ValidationError("order_by.field", "requires node_type_id to sort by a data path")
+                require_sort_index(path, await self.node_type_repo.list_indexes(node_type_id))
+                requested_sort.field = ".".join(path)
+            sort = requested_sort
+
+        if at:
+            nodes, result = await self.repo.list_at(node_type_id, at, opts, sort, conditions, data_fields)
+        else:
+            nodes, result = await self.repo.list(node_type_id, opts, geo_filter, sort, conditions, data_fields)
+        await self._read(nodes, preferred)
+        return nodes, result
+
+    def stream(self, node_type_id: Optional[str], batch_size: int = DEFAULT_STREAM_BATCH_SIZE) -> AsyncIterator[Node]:
+        """Stream all nodes without pagination, optionally filtered by node type."""
+        if not 1 <= batch_size <= MAX_STREAM_BATCH_SIZE:
+            raise ValidationError("batch_size", f"must be between 1 and {MAX_STREAM_BATCH_SIZE}")
+        if not self.encryption:
+            return self.repo.stream(node_type_id, batch_size)
+        return self._decrypted_stream(node_type_id, batch_size)
+
+    async def _decrypted_stream(self, node_type_id: Optional[str], batch_size: int) -> AsyncIterator[Node]:
+        schemas: Dict[str, str] = {}
+        async for node in self.repo.stream(node_type_id, batch_size):
+            await self._read([node], [], schemas)
+            yield node
+
+    async def count(self, node_type_id: Optional[str], data_filter: Any = None, contains: Any = None) -> int:
+        """Count nodes, optionally of a node type and matching data_filter and contains (see list)."""
+        return await self.repo.count(node_type_id, _build_data_filter(data_filter, contains))
+
+    async def aggregate(
+        self,
+        node_type_id: Optional[str],
+        aggregation: Dict[str, Any],
+        data_filter: Any = None,
+        contains: Any = None
+    ) -> List[AggregationBucket]:
+        """
+        Compute a bucketed aggregation over the data fields of nodes,
+        optionally matching data_filter and contains (see list).
+        """
+        if not aggregation:
+            raise ValidationError("aggregation", "is required")
+        agg = _build_aggregation(aggregation)
+        conditions = _build_data_filter(data_filter, contains)
+
+        # Declared field types decide how values are read (e.g. decimal as exact numeric)
+        if node_type_id:
+            node_type = await self.node_type_repo.get_by_id(node_type_id)
+            if agg.field:
+                agg.field_type = field_type(node_type.schema, agg.field) or ""
+            if agg.metric_field:
+                agg.metric_field_type = field_type(node_type.schema, agg.metric_field) or ""
+
+        return await self.repo.aggregate(node_type_id, agg, conditions)
+
+    def _validator(self, node_type: NodeType) -> SchemaValidator:
+        if self.validators:
+            return self.validators.get(node_type)
+        return SchemaValidator(node_type.schema)
+
+    async def _check_tenant(self) -> None:
+        if self.tenant_check:
+            await self.tenant_check.require_writable()
+
+    def _check_lock_token(self, lock_token: str) -> None:
+        if lock_token and not self.locks:
+            raise ValidationError("lock_token", "is not supported: node locks are not available")
+
+    async def _encrypt(self, schema: str, data: str) -> str:
+        return await self.encryption.encrypt(schema, data) if self.encryption else data
+
+    async def _read(self, nodes: List[Any], preferred: List[str], schemas: Optional[Dict[str, str]] = None) -> None:
+        """
+        Decrypt sensitive fields of nodes (or node revisions) in place and
+        resolve their localized_string fields to the preferred locales.
+        """
+        schemas = {} if schemas is None else schemas
+        for node in nodes:
+            decrypt = self.encryption and self.encryption.may_be_encrypted(node.data)
+            if not decrypt and not preferred:
+                continue
+            if node.node_type_id not in schemas:
+                try:
+                    schemas[node.node_type_id] = (await self.node_type_repo.get_by_id(node.node_type_id)).schema
+                except NotFoundError:
+                    if preferred:
+                        raise
+                    # Revisions outlive their node type, whose schema named the sensitive fields
+                    schemas[node.node_type_id] = ""
+            schema = schemas[node.node_type_id]
+            if decrypt:
+                node.data = await self.encryption.decrypt(schema, node.data)
+            if preferred:
+                node.data = localize_data(schema, node.data, preferred)
+
+    async def _build_geo_filter(self, node_type_id: Optional[str], geo: Dict[str, Any]) -> GeoFilter:
+        """
+        Build a GeoFilter from request parameters.
+
+        Expected shape:
+            {"field": "location",
+             "within": {"lat": 52.5, "lng": 13.4, "radius_m": 1000},
+             "bbox": {"min_lat": 52.3, "min_lng": 13.0, "max_lat": 52.7, "max_lng": 13.8},
+             "order_by_distance": true}
+        """
+        field = geo.get("field", "")
+        if not field:
+            raise ValidationError("geo.field", "is required")
+
+        geo_filter = GeoFilter(field=field, order_by_distance=bool(geo.get("order_by_distance", False)))
+
+        # Use the declared field type when the node type is known
+        if node_type_id:
+            node_type = await self.node_type_repo.get_by_id(node_type_id)
+            declared = field_type(node_type.schema, field)
+            if declared is not None and declared not in GEO_FIELD_TYPES:
+                raise ValidationError("geo.field", f"{field} is not a geo field")
+            if declared:
+                geo_filter.field_type = declared
+
+        within = geo.get("within")
+        if within:
+            try:
+                geo_filter.near_lat = float(within["lat"])
+                geo_filter.near_lng = float(within["lng"])
+                geo_filter.radius_m = float(within["radius_m"])
+            except (KeyError, TypeError, ValueError):
+                raise ValidationError("geo.within", "requires numeric lat, lng and radius_m")
+            if geo_filter.radius_m < 0:
+                raise ValidationError("geo.within.radius_m", "must not be negative")
+
+        bbox = geo.get("bbox")
+        if bbox:
+            try:
+                geo_filter.min_lat = float(bbox["min_lat"])
+                geo_filter.min_lng = float(bbox["min_lng"])
+                geo_filter.max_lat = float(bbox["max_lat"])
+                geo_filter.max_lng = float(bbox["max_lng"])
+            except (KeyError, TypeError, ValueError):
+                raise ValidationError("geo.bbox", "requires numeric min_lat, min_lng, max_lat and max_lng")
+            if geo_filter.min_lat > geo_filter.max_lat or geo_filter.min_lng > geo_filter.max_lng:
+                raise ValidationError("geo.bbox", "min values must not exceed max values")
+
+        if not geo_filter.has_radius() and not geo_filter.has_bbox():
+            raise ValidationError("geo", "requires within or bbox")
+        if geo_filter.order_by_distance and not geo_filter.has_radius():
+            raise ValidationError("geo.order_by_distance", "requires within")
+
+        return geo_filter
+
+
+AGGREGATION_KINDS = ("range", "histogram", "date_histogram", "terms", "all")
+AGGREGATION_METRICS = ("sum", "avg", "min", "max")
+DATE_HISTOGRAM_INTERVALS = ("day", "week", "month")
+MAX_HISTOGRAM_BUCKETS = 1000
+DEFAULT_TERMS_SIZE = 10
+MAX_TERMS_SIZE = 1000
+
+
+def _optional_float(value: Any, name: str) -> Optional[float]:
+    if value is None:
+        return None
+    try:
+        return float(value)
+    except (TypeError, ValueError):
+        raise ValidationError(name, "must be a number")
+
+
+def _data_conditions(value: Any, name: str) -> Dict[Tuple[str, ...], Any]:
+    if value is None or value == "":
+        return {}
+    if isinstance(value, str):
+        try:
+            value = json.loads(value)
+        except ValueError as e:
+            raise ValidationError(name, f"is not valid JSON: {e}") from None
+    if not isinstance(value, dict):
+        raise ValidationError(name, "must be a JSON object of data paths and values")
+    return {tuple(parse_data_path(path)): expected for path, expected in value.items()}
+
+
+def _build_data_filter(data_filter: Any, contains: Any) -> Optional[DataFilter]:
+    """Build a DataFilter from the filter and contains request parameters (objects or their JSON text)."""
+    conditions = DataFilter(
+        equals=_data_conditions(data_filter, "filter"),
+        contains=_data_conditions(contains, "contains"),
+    )
+    return conditions if conditions.equals or conditions.contains else None
+
+
+def _build_aggregation(params: Dict[str, Any]) -> Aggregation:
+    """
+    Build an Aggregation from request parameters.
+
+    Expected shapes:
+        {"kind": "range", "field": "price",
+         "ranges": [{"to": 10}, {"from": 10, "to": 100}, {"from": 100, "key": "expensive"}]}
+        {"kind": "histogram", "field": "price", "min": 0, "max": 100, "buckets": 10}
+        {"kind": "date_histogram", "field": "closed_at", "interval": "week", "time_zone": "UTC"}
+        {"kind": "terms", "field": "status", "size": 10}
+        {"kind": "all", "metric": "sum", "metric_field": "amount"}
+
+    Any kind may add {"metric": "sum", "metric_field": "amount"}.
+    """
+    kind = params.get("kind", "")
+    if kind not in AGGREGATION_KINDS:
+        raise ValidationError("aggregation.kind", f"must be one of: {', '.join(AGGREGATION_KINDS)}")
+
+    field = params.get("field", "")
+    if not field and kind != "all":
+        raise ValidationError("aggregation.field", "is required")
+
+    agg = Aggregation(kind=kind, field=field)
+
+    metric = params.get("metric", "")
+    if metric:
+        if metric not in AGGREGATION_METRICS:
+            raise ValidationError("aggregation.metric", f"must be one of: {', '.join(AGGREGATION_METRICS)}")
+        if not params.get("metric_field"):
+            raise ValidationError("aggregation.metric_field", "is required with metric")
+        agg.metric = metric
+        agg.metric_field = params["metric_field"]
+
+    if kind == "range":
+        ranges = params.get("ranges") or []
+        if not ranges:
+            raise ValidationError("aggregation.ranges", "is required for range aggregations")
+        for i, r in enumerate(ranges):
+            lo = _optional_float(r.get("from"), f"aggregation.ranges[{i}].from")
+            hi = _optional_float(r.get("to"), f"aggregation.ranges[{i}].to")
+            if lo is None and hi is None:
+                raise ValidationError(f"aggregation.ranges[{i}]", "requires from or to")
+            if lo is not None and hi is not None and lo >= hi:
+                raise ValidationError(f"aggregation.ranges[{i}].from", "must be less than to")
+            key = r.get("key") or f"{'*' if lo is None else format(lo, 'g')}-{'*' if hi is None else format(hi, 'g')}"
+            agg.ranges.append(AggregationRange(key=key, from_value=lo, to_value=hi))
+
+    elif kind == "histogram":
+        agg.min_value = _optional_float(params.get("min"), "aggregation.min")
+        agg.max_value = _optional_float(params.get("max"), "aggregation.max")
+        if agg.min_value is None or agg.max_value is None:
+            raise ValidationError(
+                "aggregation.min", "and aggregation.max are required for histogram aggregations"
+            )
+        if agg.min_value >= agg.max_value:
+            raise ValidationError("aggregation.min", "must be less than aggregation.max")
+        try:
+            agg.buckets = int(params.get("buckets", 10))
+        except (TypeError, ValueError):
+            raise ValidationError("aggregation.buckets", "must be an integer")
+        if not 1 <= agg.buckets <= MAX_HISTOGRAM_BUCKETS:
+            raise ValidationError("aggregation.buckets", f"must be between 1 and {MAX_HISTOGRAM_BUCKETS}")
+
+    elif kind == "terms":
+        try:
+            agg.size = int(params.get("size", DEFAULT_TERMS_SIZE))
+        except (TypeError, ValueError):
+            raise ValidationError("aggregation.size", "must be an integer")
+        if not 1 <= agg.size <= MAX_TERMS_SIZE:
+            raise ValidationError("aggregation.size", f"must be between 1 and {MAX_TERMS_SIZE}")
+
+    elif kind == "date_histogram":
+        agg.interval = params.get("interval", "")
+        if agg.interval not in DATE_HISTOGRAM_INTERVALS:
+            raise ValidationError(
+                "aggregation.interval", f"must be one of: {', '.join(DATE_HISTOGRAM_INTERVALS)}"
+            )
+        agg.time_zone = params.get("time_zone") or "UTC"
+        try:
+            ZoneInfo(agg.time_zone)
+        except (ZoneInfoNotFoundError, ValueError):
+            raise ValidationError("aggregation.time_zone", f"is not a known time zone: {agg.time_zone}")
+
+    return agg
+
+
+def _parse_time(name: str, value: str) -> datetime:
+    """Parse an ISO 8601 time, UTC unless it has an offset."""
+    try:
+        at = datetime.fromisoformat(value)
+    except (TypeError, ValueError):
+        raise ValidationError(name, f"is not an ISO 8601 time: {value}") from None
+    if not at.tzinfo:
+        at = at.replace(tzinfo=timezone.utc)
+    return at
+
+
+def _revision_id(name: str, value: str) -> int:
+    try:
+        return int(value)
+    except ValueError:
+        raise ValidationError(name, f"is not a revision ID: {value}") from None
@@ -0,0 +1,108 @@
+"""
+Node type catalog.
+
+Every node write validates its data against its node type's schema, which
+used to cost a node type lookup per write. The catalog keeps all node types
+of recently used tenants in memory, shared by the requests of this server
+instance, so node writes find their node type without a query.
+
+A tenant's catalog is stamped with its node type generation: the sequence of
+the newest node_type.* event in the tenant's change feed (outbox), which
+every node type create, update and delete writes in its own transaction. At
+most every refresh_interval seconds a lookup reads the generation (one index
+lookup) and reloads the tenant's node types if it moved; writes through this
+server instance drop the tenant's catalog at once. Catalogs are reloaded
+after ttl seconds regardless, bounding how long a change committed out of
+sequence order goes unnoticed. Node types missing from a catalog are looked
+up in the database, so ones just created elsewhere are found.
+
+Schemas are parsed once per schema text (see parse_schema), so node writes
+don't recompile them either.
+"""
+
+import copy
+import time
+from collections import OrderedDict
+from dataclasses import dataclass, field
+from typing import Callable, Dict
+
+from app.repository import NodeType, NodeTypeRepository
+
+
+@dataclass
+class _TenantCatalog:
+    generation: int
+    loaded_at: float
+    checked_at: float
+    node_types: Dict[str, NodeType] = field(default_factory=dict)
+
+
+class NodeTypeCatalog:
+    """Node types of recently used tenants, refreshed by their node type generation."""
+
+    def __init__(
+        self,
+        refresh_interval: float = 1.0,
+        ttl: float = 60.0,
+        max_tenants: int = 1000,
+        clock: Callable[[], float] = time.monotonic,
+    ):
+        self.refresh_interval = refresh_interval
+        self.ttl = ttl
+        self.max_tenants = max_tenants
+        self._clock = clock
+        # Least recently used first
+        self._tenants: "OrderedDict[str, _TenantCatalog]" = OrderedDict()
+        self.hits = 0
+        self.misses = 0
+
+    async def get(self, tenant_id: str, repo: NodeTypeRepository, id: str) -> NodeType:
+        """Return a copy of a tenant's node type; raises NotFoundError like repo.get_by_id if it doesn't exist."""
+        catalog = await self._current(tenant_id, repo)
+        node_type = catalog.node_types.get(id)
+        if node_type is None:
+            self.misses += 1
+            return await repo.get_by_id(id)
+        self.hits += 1
+        # Callers may modify what they are given
+        return copy.deepcopy(node_type)
+
+    def invalidate(self, tenant_id: str) -> None:
+        """Drop a tenant's catalog, after its node types changed."""
+        self._tenants.pop(tenant_id, None)
+
+    async def _current(self, tenant_id: str, repo: NodeTypeRepository) -> _TenantCatalog:
+        now = self._clock()
+        catalog = self._tenants.get(tenant_id)
+        if catalog is not None:
+            self._tenants.move_to_end(tenant_id)
+            if now - catalog.checked_at < self.refresh_interval:
+                return catalog
+
+        generation = await repo.catalog_generation()
+        if catalog is not None and catalog.generation == generation and now - catalog.loaded_at < self.ttl:
+            catalog.checked_at = now
+            return catalog
+
+        node_types = await repo.list_all()
+        catalog = _TenantCatalog(generation, now, now, {node_type.id: node_type for node_type in node_types})
+        self._tenants[tenant_id] = catalog
+        self._tenants.move_to_end(tenant_id)
+        while len(self._tenants) > self.max_tenants:
+            self._tenants.popitem(last=False)
+        return catalog
+
+
+class CatalogNodeTypeRepository:
+    """A tenant's node type repository whose get_by_id is served from the node type catalog."""
+
+    def __init__(self, repo: NodeTypeRepository, catalog: NodeTypeCatalog, tenant_id: str):
+        self.repo = repo
+        self.catalog = catalog
+        self.tenant_id = tenant_id
+
+    async def get_by_id(self, id: str) -> NodeType:
+        return await self.catalog.get(self.tenant_id, self.repo, id)
+
+    def __getattr__(self, name: str):
+        return getattr(self.repo, name)
@@ -2,40 +2,108 @@
 NodeType service implementation.
 """
 
-from typing import List, Tuple
+from typing import Any, Callable, List, Optional, Tuple
 
-from app.repository import NodeType, NodeTypeRepository, ListOptions, ListResult
+from app.repository import NodeType, NodeTypeIndex, NodeTypeRepository, ListOptions, ListResult, ValidationError
+from app.repository.nodetype_repo import NODE_TYPE_SORT_COLUMNS
+from app.repository.versioning import expected_version_from
+from app.service.bi_views import BiViewService
+from app.service.display import validate_display
+from app.service.node_service import batch_get_ids
+from app.service.ordering import parse_order_by
+from app.service.schema import MAX_NODE_TYPE_INDEXES, normalize_index, normalize_unique_keys, validate_schema
+from app.service.tenant_check import TenantCheck
 
 
 class NodeTypeService:
     """NodeType business logic service."""
 
-    def __init__(self, repo: NodeTypeRepository):
+    def __init__(
+        self,
+        repo: NodeTypeRepository,
+        bi_views: Optional[BiViewService] = None,
+        tenant_check: Optional[TenantCheck] = None,
+        on_change: Optional[Callable[[], None]] = None
+    ):
         self.repo = repo
+        # Regenerates the tenant's BI views after schema changes, if enabled
+        self.bi_views = bi_views
+        # Verifies the tenant accepts writes; None skips the check
+        self.tenant_check = tenant_check
+        # Called after node types change, e.g. to drop the tenant's node type catalog
+        self.on_change = on_change
 
-    async def create(self, name: str, description: str, schema: str) -> NodeType:
-        """Create a new node type."""
+    async def create(
+        self,
+        name: str,
+        description: str,
+        schema: str,
+        display: str = "",
+        unique_keys: Optional[List[Any]] = None,
+        dry_run: bool = False
+    ) -> NodeType:
+        """
+        Create a new node type. unique_keys lists fields, or lists of fields,
+        whose values must be unique among its nodes. A dry run validates it
+        and returns it without saving it.
+        """
         if not name:
-            raise ValueError("name is required")
+            raise ValidationError("name", "is required")
+        validate_schema(schema)
+        validate_display(display, schema)
+        keys = normalize_unique_keys(unique_keys, schema)
+        await self._check_tenant()
 
         node_type = NodeType(
             tenant_id="",  # Not stored in tenant database
             name=name,
             description=description,
             schema=schema,
+            display=display or "{}",
+            unique_keys=keys,
         )
-        return await self.repo.create(node_type)
+        created = await self.repo.create(node_type, dry_run)
+        if not dry_run:
+            self._changed()
+            await self._sync_bi_views()
+        return created
 
     async def get_by_id(self, id: str) -> NodeType:
         """Retrieve a node type by ID."""
         if not id:
-            raise ValueError("id is required")
+            raise ValidationError("id", "is required")
         return await self.repo.get_by_id(id)
 
-    async def update(self, id: str, name: str, description: str, schema: str) -> NodeType:
-        """Update an existing node type."""
+    async def batch_get(self, ids: List[str]) -> Tuple[List[NodeType], List[str]]:
+        """
+        Retrieve up to MAX_BATCH_GET_IDS node types by ID in one query;
+        returns the node types found, in the order of ids, and the IDs of
+        those that don't exist.
+        """
+        ids = batch_get_ids(ids)
+        found = {node_type.id: node_type for node_type in await self.repo.get_many(ids)}
+        return [found[id] for id in ids if id in found], [id for id in ids if id not in found]
+
+    async def update(
+        self,
+        id: str,
+        name: str,
+        description: str,
+        schema: str,
+        expected_version: Optional[int] = None,
+        display: str = "",
+        if_match: str = "",
+        dry_run: bool = False
+    ) -> NodeType:
+        """
+        Update an existing node type, optionally only if it is still at
+        expected_version or the version of the if_match entity tag. A dry run
+        validates the update without saving it.
+        """
         if not id:
-            raise ValueError("id is required")
+            raise ValidationError("id", "is required")
+        expected_version = expected_version_from(expected_version, if_match)
+        await self._check_tenant()
 
         node_type = await self.repo.get_by_id(id)
 
@@ -44,17 +112,88 @@ class NodeTypeService:
         if description:
             node_type.description = description
         if schema:
+            validate_schema(schema)
             node_type.schema = schema
+        if display:
+            node_type.display = display
+        if schema or display:
+            # Display metadata references schema fields, so check it against the result
+            validate_display(node_type.display, node_type.schema)
 
-        return await self.repo.update(node_type)
+        updated = await self.repo.update(node_type, expected_version, dry_run)
+        if not dry_run:
+            self._changed()
+        if (name or schema) and not dry_run:
+            await self._sync_bi_views()
+        return updated
 
-    async def delete(self, id: str) -> None:
-        """Delete a node type."""
+    async def delete(
+        self, id: str, expected_version: Optional[int] = None, if_match: str = "", dry_run: bool = False
+    ) -> None:
+        """
+        Delete a node type, optionally only if it is still at expected_version
+        or the version of the if_match entity tag. A dry run only checks that
+        it could be.
+        """
         if not id:
-            raise ValueError("id is required")
-        await self.repo.delete(id)
+            raise ValidationError("id", "is required")
+        await self._check_tenant()
+        await self.repo.delete(id, expected_version_from(expected_version, if_match), dry_run)
+        if not dry_run:
+            self._changed()
+            await self._sync_bi_views()
 
-    async def list(self, page_size: int, page_token: str) -> Tuple[List[NodeType], ListResult]:
-        """Retrieve node types with pagination."""
+    async def list(self, page_size: int, page_token: str, order_by: Any = None) -> Tuple[List[NodeType], ListResult]:
+        """Retrieve node types with pagination, newest first unless order_by sorts them otherwise."""
+        sort = parse_order_by(order_by, NODE_TYPE_SORT_COLUMNS)
         opts = ListOptions(page_size=page_size, page_token=page_token)
-        return await self.repo.list(opts)
+        return await self.repo.list(opts, sort)
+
+    async def describe(self) -> List[NodeType]:
+        """Retrieve every node type of the tenant, with schema and display metadata."""
+        return await self.repo.list_all()
+
+    async def create_index(self, node_type_id: str, name: str, method: str, paths: Any) -> NodeTypeIndex:
+        """
+        Index data paths of a node type's nodes, with a btree index (equality,
+        ranges, sorting) or a GIN index (containment). Returns once it is built.
+        """
+        if not node_type_id:
+            raise ValidationError("node_type_id", "is required")
+        await self._check_tenant()
+        node_type = await self.repo.get_by_id(node_type_id)
+        method = method or "btree"
+        index_paths = normalize_index(name, method, paths, node_type.schema)
+        if len(await self.repo.list_indexes(node_type_id)) >= MAX_NODE_TYPE_INDEXES:
+            raise ValueError(f"a node type can have at most {MAX_NODE_TYPE_INDEXES} indexes")
+
+        index = NodeTypeIndex(node_type_id=node_type_id, name=name, method=method, paths=index_paths)
+        return await self.repo.create_index(index)
+
+    async def list_indexes(self, node_type_id: str) -> List[NodeTypeIndex]:
+        """Retrieve the indexes of a node type."""
+        if not node_type_id:
+            raise ValidationError("node_type_id", "is required")
+        await self.repo.get_by_id(node_type_id)
+        return await self.repo.list_indexes(node_type_id)
+
+    async def drop_index(self, node_type_id: str, name: str) -> NodeTypeIndex:
+        """Drop an index of a node type by name."""
+        if not node_type_id:
+            raise ValidationError("node_type_id", "is required")
+        if not name:
+            raise ValidationError("name", "is required")
+        await self._check_tenant()
+        return await self.repo.drop_index(node_type_id, name)
+
+    async def _check_tenant(self) -> None:
+        if self.tenant_check:
+            await self.tenant_check.require_writable()
+
+    def _changed(self) -> None:
+        if self.on_change:
+            self.on_change()
+
+    async def _sync_bi_views(self) -> None:
+        if self.bi_views:
+            await self.bi_views.sync()
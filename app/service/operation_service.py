@@ -0,0 +1,214 @@
+"""
+Long-running operations.
+
+Asynchronous jobs are exposed as operations, in the style of
+google.longrunning, so clients poll and cancel every kind of job the same way
+with get_operation, list_operations and cancel_operation instead of a status
+method per feature. An operation is named "<kind>/<id>" and carries:
+
+- status: pending, running, succeeded, failed or cancelled; done once it is
+  one of the last three,
+- metadata: the job's parameters and progress,
+- response: its result once it succeeded, or error once it failed or was
+  cancelled.
+
+Each kind of job is served by an OperationKind that reads and cancels its own
+records, so features keep their storage and their specific methods. Imports,
+exports to object storage, bulk deletes and backfills are bulk jobs (see
+app/service/bulk_job_service.py) of the kinds imports, exports, bulk_deletes
+and backfills.
+"""
+
+from typing import Dict, List, Optional, Protocol, Tuple
+
+from app.repository import (
+    BULK_BACKFILL,
+    BULK_DELETE,
+    BULK_EXPORT,
+    BULK_IMPORT,
+    BulkJob,
+    ListResult,
+    NodeMigration,
+    NotFoundError,
+    Operation,
+    ValidationError,
+)
+from app.service.bulk_job_service import BulkJobService
+from app.service.node_migration_service import NodeMigrationService
+
+NODE_MIGRATIONS = "node_migrations"
+IMPORTS = "imports"
+EXPORTS = "exports"
+BULK_DELETES = "bulk_deletes"
+BACKFILLS = "backfills"
+
+# Operation kinds of bulk jobs, by job kind
+BULK_JOB_OPERATIONS = {
+    BULK_IMPORT: IMPORTS, BULK_EXPORT: EXPORTS, BULK_DELETE: BULK_DELETES, BULK_BACKFILL: BACKFILLS
+}
+DEFAULT_PAGE_SIZE = 10
+
+
+class OperationKind(Protocol):
+    """Reads and cancels the operations of one kind of job."""
+
+    async def get(self, id: str) -> Operation:
+        """Retrieve an operation by job ID; raises NotFoundError if there is none."""
+        ...
+
+    async def list(self, page_size: int, page_token: str) -> Tuple[List[Operation], ListResult]:
+        """Retrieve operations with pagination, newest first."""
+        ...
+
+    async def cancel(self, id: str) -> Operation:
+        """Cancel a pending or running operation; raises FailedPreconditionError if it is done."""
+        ...
+
+
+class OperationService:
+    """Operations of a tenant's jobs, by kind."""
+
+    def __init__(self, kinds: Optional[Dict[str, OperationKind]] = None):
+        self.kinds = kinds or {}
+
+    async def get(self, name: str) -> Operation:
+        """Retrieve an operation by name."""
+        kind, id = self._parse_name(name)
+        return await kind.get(id)
+
+    async def list(self, kind: str, page_size: int, page_token: str) -> Tuple[List[Operation], ListResult]:
+        """
+        Retrieve operations of one kind, or of all kinds one after the other,
+        newest first within a kind.
+        """
+        if kind:
+            if kind not in self.kinds:
+                raise ValueError(f"unknown operation kind: {kind} (expected one of {', '.join(self.kinds)})")
+            return await self.kinds[kind].list(page_size, page_token)
+
+        # The page token of all kinds names the kind to continue with: "<kind>:<its page token>"
+        page_size = max(1, page_size or DEFAULT_PAGE_SIZE)
+        names = list(self.kinds)
+        current, _, token = page_token.partition(":")
+        if page_token and current not in self.kinds:
+            raise ValueError(f"invalid page_token: {page_token}")
+        start = names.index(current) if page_token else 0
+
+        operations: List[Operation] = []
+        total = 0
+        next_token = ""
+        for i, name in enumerate(names):
+            if i < start or len(operations) >= page_size:
+                # Kinds outside of this page are only counted
+                total += (await self.kinds[name].list(1, ""))[1].total_count
+                if i > start and not next_token:
+                    next_token = f"{name}:"
+                continue
+            page, result = await self.kinds[name].list(page_size - len(operations), token if i == start else "")
+            operations.extend(page)
+            total += result.total_count
+            if result.next_page_token:
+                next_token = f"{name}:{result.next_page_token}"
+        return operations, ListResult(next_page_token=next_token, total_count=total)
+
+    async def cancel(self, name: str) -> Operation:
+        """Cancel a pending or running operation by name."""
+        kind, id = self._parse_name(name)
+        return await kind.cancel(id)
+
+    def _parse_name(self, name: str) -> Tuple[OperationKind, str]:
+        if not name:
+            raise ValidationError("name", "is required")
+        kind, _, id = name.partition("/")
+        if kind not in self.kinds or not id:
+            raise NotFoundError(f"operation not found: {name}")
+        return self.kinds[kind], id
+
+
+class NodeMigrationOperations:
+    """Node migrations (see app/service/node_migration_service.py) as operations."""
+
+    def __init__(self, service: NodeMigrationService):
+        self.service = service
+
+    async def get(self, id: str) -> Operation:
+        return migration_operation(await self.service.get_by_id(id))
+
+    async def list(self, page_size: int, page_token: str) -> Tuple[List[Operation], ListResult]:
+        migrations, result = await self.service.list(None, page_size, page_token)
+        return [migration_operation(m) for m in migrations], result
+
+    async def cancel(self, id: str) -> Operation:
+        return migration_operation(await self.service.cancel(id))
+
+
+class BulkJobOperations:
+    """The bulk jobs of one kind (see app/service/bulk_job_service.py) as operations."""
+
+    def __init__(self, service: BulkJobService, job_kind: str):
+        self.service = service
+        self.job_kind = job_kind
+
+    async def get(self, id: str) -> Operation:
+        return bulk_job_operation(await self._get(id))
+
+    async def list(self, page_size: int, page_token: str) -> Tuple[List[Operation], ListResult]:
+        jobs, result = await self.service.list(self.job_kind, page_size, page_token)
+        return [bulk_job_operation(j) for j in jobs], result
+
+    async def cancel(self, id: str) -> Operation:
+        await self._get(id)
+        return bulk_job_operation(await self.service.cancel(id))
+
+    async def _get(self, id: str) -> BulkJob:
+        job = await self.service.get_by_id(id)
+        if job.kind != self.job_kind:
+            raise NotFoundError(f"bulk_job not found: {id}")
+        return job
+
+
+def bulk_job_operations(service: BulkJobService) -> Dict[str, OperationKind]:
+    """Return the operation kinds of bulk jobs, for an OperationService."""
+    return {kind: BulkJobOperations(service, job_kind) for job_kind, kind in BULK_JOB_OPERATIONS.items()}
+
+
+def migration_operation(migration: NodeMigration) -> Operation:
+    """Return the operation of a node migration."""
+    return Operation(
+        name=f"{NODE_MIGRATIONS}/{migration.id}",
+        kind=NODE_MIGRATIONS,
+        status=migration.status,
+        metadata={
+            "node_type_id": migration.node_type_id,
+            "target_schema_version": migration.target_schema_version,
+            "batch_size": migration.batch_size,
+            "migrated_count": migration.migrated_count,
+            "failed_count": migration.failed_count,
+            "failures": list(migration.failures),
+        },
+        response={"migration": migration.to_dict()} if migration.status == "succeeded" else None,
+        error=migration.error or ("cancelled" if migration.status == "cancelled" else ""),
+        created_at=migration.created_at,
+        updated_at=migration.updated_at,
+    )
+
+
+def bulk_job_operation(job: BulkJob) -> Operation:
+    """Return the operation of a bulk job."""
+    return Operation(
+        name=f"{BULK_JOB_OPERATIONS[job.kind]}/{job.id}",
+        kind=BULK_JOB_OPERATIONS[job.kind],
+        status=job.status,
+        metadata={
+            "params": dict(job.params),
+            "processed": job.processed,
+            "total": job.total,
+            "unit": job.unit,
+            "eta_seconds": job.eta_seconds(),
+            "progress": dict(job.progress),
+        },
+        response={"bulk_job": job.to_dict()} if job.status == "succeeded" else None,
+        error=job.error or ("cancelled" if job.status == "cancelled" else ""),
+        created_at=job.created_at,
+        updated_at=job.updated_at,
+    )
@@ -0,0 +1,65 @@
+"""
+Sort orders of list methods.
+
+Listings are newest first unless order_by names another order:
+
+    {"field": "updated_at", "direction": "desc"}
+
+field is one of the sortable columns of the listed resource (see
+NODE_SORT_COLUMNS, NODE_TYPE_SORT_COLUMNS and RELATIONSHIP_SORT_COLUMNS) or,
+for nodes of one node type, a data path ("data.price") a btree index of the
+node type starts with, so sorted listings are served by the index rather than
+sorting every node. direction is asc (the default) or desc. Ties are broken by
+ID, so pages don't overlap.
+"""
+
+from typing import Any, Iterable, List, Optional
+
+from app.repository import NodeTypeIndex, SortOrder, ValidationError
+from app.service.display import SORT_DIRECTIONS
+from app.service.schema import parse_data_path
+
+DATA_PREFIX = "data."
+
+
+def parse_order_by(order_by: Any, columns: Iterable[str], data_paths: bool = False) -> Optional[SortOrder]:
+    """
+    Validate an order_by against the sortable columns of a resource, and data
+    paths ("data.price") if data_paths. Returns None for the default order.
+    """
+    if order_by is None:
+        return None
+    if not isinstance(order_by, dict) or not isinstance(order_by.get("field"), str) or not order_by["field"]:
+        raise ValueError('order_by must be an object like {"field": "updated_at", "direction": "desc"}')
+    unknown = set(order_by) - {"field", "direction"}
+    if unknown:
+        raise ValueError(f"order_by: unknown keys: {', '.join(sorted(unknown))}")
+    direction = order_by.get("direction", "asc")
+    if direction not in SORT_DIRECTIONS:
+        raise ValidationError("order_by.direction", f"must be one of: {', '.join(SORT_DIRECTIONS)}")
+
+    field = order_by["field"]
+    columns = tuple(columns)
+    if field not in columns and not (data_paths and field.startswith(DATA_PREFIX)):
+        allowed = ", ".join(columns) + (", data.<path>" if data_paths else "")
+        raise ValidationError("order_by.field", f"must be one of: {allowed}")
+    return SortOrder(field=field, descending=direction == "desc")
+
+
+def data_sort_path(sort: SortOrder) -> Optional[List[str]]:
+    """Return the data path a sort order sorts by, or None if it sorts by a column."""
+    if not sort.field.startswith(DATA_PREFIX):
+        return None
+    try:
+        return parse_data_path(sort.field[len(DATA_PREFIX):])
+    except ValueError as e:
+        raise ValueError(f"order_by.field: {e}") from None
+
+
+def require_sort_index(path: List[str], indexes: List[NodeTypeIndex]) -> None:
+    """Check a btree index of the node type starts with the data path a listing sorts by."""
+    if not any(index.method == "btree" and index.paths and index.paths[0] == path for index in indexes):
+        raise ValueError(
+            f"order_by.field: data.{'.'.join(path)} is not indexed; "
+            "create a btree index of the node type starting with it (create_node_type_index)"
+        )
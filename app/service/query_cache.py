@@ -0,0 +1,124 @@
+"""
+Query result cache.
+
+Dashboards re-issue the same list and aggregate queries every few seconds
+while the underlying data rarely changes. Results are cached per tenant and
+normalized query, stamped with the tenant's change feed sequence (the newest
+outbox event ID). Every mutation writes an outbox event in its own
+transaction, so a cached result is reused only while the sequence is
+unchanged. Checking the sequence is a single index lookup instead of the
+query itself.
+
+Transactions can commit out of ID order, so a result may rarely miss a
+change committed with an older event ID; the TTL bounds how long such a
+result is served.
+"""
+
+import json
+import time
+from collections import OrderedDict
+from typing import Any, Awaitable, Callable, Dict, Optional, Tuple
+
+from app.db.explain import current_plan_capture
+from app.db.replicas import primary_reads
+from app.repository import OutboxRepository
+
+
+def query_key(method: str, params: Dict[str, Any]) -> str:
+    """Return a normalized cache key for a query: key order and unset parameters don't matter."""
+    normalized = {k: v for k, v in params.items() if v not in (None, "", {}, [])}
+    return method + ":" + json.dumps(normalized, sort_keys=True, separators=(",", ":"), default=str)
+
+
+class QueryCache:
+    """Bounded LRU cache of query results per tenant, invalidated by change feed sequence."""
+
+    def __init__(self, max_entries: int = 1000, ttl: float = 30.0, clock: Callable[[], float] = time.monotonic):
+        self.max_entries = max_entries
+        self.ttl = ttl
+        self._clock = clock
+        # (tenant_id, key) -> (sequence, expires_at, value)
+        self._entries: "OrderedDict[Tuple[str, str], Tuple[int, float, Any]]" = OrderedDict()
+        # Newest sequence seen per tenant, so results computed before a change are not stored
+        self._sequences: Dict[str, int] = {}
+        self.hits = 0
+        self.misses = 0
+
+    def get(self, tenant_id: str, key: str, sequence: int) -> Optional[Any]:
+        """Return the cached result if it was computed at sequence and has not expired."""
+        self._observe(tenant_id, sequence)
+        entry = self._entries.get((tenant_id, key))
+        if entry is None:
+            self.misses += 1
+            return None
+
+        cached_sequence, expires_at, value = entry
+        if cached_sequence != sequence or self._clock() >= expires_at:
+            del self._entries[(tenant_id, key)]
+            self.misses += 1
+            return None
+
+        self._entries.move_to_end((tenant_id, key))
+        self.hits += 1
+        return value
+
+    def put(self, tenant_id: str, key: str, sequence: int, value: Any) -> None:
+        """Store a result computed at sequence, evicting the least recently used entries."""
+        if self.max_entries <= 0 or sequence < self._sequences.get(tenant_id, sequence):
+            return
+        self._sequences[tenant_id] = sequence
+        self._entries[(tenant_id, key)] = (sequence, self._clock() + self.ttl, value)
+        self._entries.move_to_end((tenant_id, key))
+        while len(self._entries) > self.max_entries:
+            self._entries.popitem(last=False)
+
+    def invalidate(self, tenant_id: str) -> None:
+        """Drop all cached results of a tenant."""
+        for entry_key in [k for k in self._entries if k[0] == tenant_id]:
+            del self._entries[entry_key]
+        self._sequences.pop(tenant_id, None)
+
+    def __len__(self) -> int:
+        return len(self._entries)
+
+    def _observe(self, tenant_id: str, sequence: int) -> None:
+        latest = self._sequences.get(tenant_id)
+        if latest is not None and sequence < latest:
+            # The change feed went backwards (tenant database restored or recreated)
+            self.invalidate(tenant_id)
+        if latest is None or sequence != latest:
+            self._sequences[tenant_id] = sequence
+
+
+class QueryCacheService:
+    """Serves tenant queries from a shared QueryCache; computes every query if cache is None."""
+
+    def __init__(self, cache: Optional[QueryCache], outbox_repo: OutboxRepository):
+        self.cache = cache
+        self.outbox_repo = outbox_repo
+
+    async def get_or_compute(
+        self,
+        tenant_id: str,
+        method: str,
+        params: Dict[str, Any],
+        compute: Callable[[], Awaitable[Any]]
+    ) -> Any:
+        """
+        Return the cached result of a query or compute and cache it.
+
+        Results are shared between callers and must not be modified.
+        """
+        # Plan captures must see the query run (see explain_query)
+        if self.cache is None or current_plan_capture():
+            return await compute()
+
+        key = query_key(method, params)
+        sequence = await self.outbox_repo.latest_sequence()
+        value = self.cache.get(tenant_id, key, sequence)
+        if value is None:
+            # A replica may not have caught up with the sequence read from the primary yet
+            with primary_reads():
+                value = await compute()
+            self.cache.put(tenant_id, key, sequence, value)
+        return value
@@ -2,32 +2,66 @@
 Relationship service implementation.
 """
 
-from typing import List, Optional, Tuple
-
-from app.repository import Relationship, RelationshipRepository, NodeRepository, ListOptions, ListResult
+from typing import Any, List, Optional, Tuple
+
+from app.repository import (
+    BatchHook,
+    FilterValues,
+    ListOptions,
+    ListResult,
+    NodeRepository,
+    Relationship,
+    RelationshipRepository,
+    ValidationError,
+    filter_values,
+)
+from app.repository.relationship_repo import RELATIONSHIP_SORT_COLUMNS
+from app.repository.versioning import expected_version_from
+from app.service.ordering import parse_order_by
+from app.service.tenant_check import TenantCheck
+
+DELETE_BATCH_SIZE = 1000
+
+# Values one list filter may match, e.g. the node IDs of a displayed subgraph
+MAX_FILTER_VALUES = 500
+
+
+def _checked_filter(name: str, values: FilterValues) -> List[str]:
+    values = filter_values(values)
+    if len(values) > MAX_FILTER_VALUES:
+        raise ValidationError(name, f"must list at most {MAX_FILTER_VALUES} values")
+    if not all(isinstance(value, str) and value for value in values):
+        raise ValidationError(name, "must list non-empty strings")
+    return values
 
 
 class RelationshipService:
     """Relationship business logic service."""
 
-    def __init__(self, repo: RelationshipRepository, node_repo: NodeRepository):
+    def __init__(
+        self, repo: RelationshipRepository, node_repo: NodeRepository, tenant_check: Optional[TenantCheck] = None
+    ):
         self.repo = repo
         self.node_repo = node_repo
+        # Verifies the tenant accepts writes; None skips the check
+        self.tenant_check = tenant_check
 
     async def create(
         self,
         source_node_id: str,
         target_node_id: str,
         rel_type: str,
-        data: str
+        data: str,
+        dry_run: bool = False
     ) -> Relationship:
-        """Create a new relationship."""
+        """Create a new relationship; a dry run validates it and returns it without saving it."""
         if not source_node_id:
-            raise ValueError("source_node_id is required")
+            raise ValidationError("source_node_id", "is required")
         if not target_node_id:
-            raise ValueError("target_node_id is required")
+            raise ValidationError("target_node_id", "is required")
         if not rel_type:
-            raise ValueError("relationship_type is required")
+            raise ValidationError("relationship_type", "is required")
+        await self._check_tenant()
 
         # Validate that the source node exists (repository is already scoped to tenant database)
         source_node = await self.node_repo.get_by_id(source_node_id)
@@ -42,18 +76,32 @@ class RelationshipService:
             relationship_type=rel_type,
             data=data,
         )
-        return await self.repo.create(rel)
+        return await self.repo.create(rel, dry_run)
 
     async def get_by_id(self, id: str) -> Relationship:
         """Retrieve a relationship by ID."""
         if not id:
-            raise ValueError("id is required")
+            raise ValidationError("id", "is required")
         return await self.repo.get_by_id(id)
 
-    async def update(self, id: str, rel_type: str, data: str) -> Relationship:
-        """Update an existing relationship."""
+    async def update(
+        self,
+        id: str,
+        rel_type: str,
+        data: str,
+        expected_version: Optional[int] = None,
+        if_match: str = "",
+        dry_run: bool = False
+    ) -> Relationship:
+        """
+        Update an existing relationship, optionally only if it is still at
+        expected_version or the version of the if_match entity tag. A dry run
+        validates the update without saving it.
+        """
         if not id:
-            raise ValueError("id is required")
+            raise ValidationError("id", "is required")
+        expected_version = expected_version_from(expected_version, if_match)
+        await self._check_tenant()
 
         rel = await self.repo.get_by_id(id)
 
@@ -62,22 +110,63 @@ class RelationshipService:
         if data:
             rel.data = data
 
-        return await self.repo.update(rel)
+        return await self.repo.update(rel, expected_version, dry_run)
 
-    async def delete(self, id: str) -> None:
-        """Delete a relationship."""
+    async def delete(
+        self, id: str, expected_version: Optional[int] = None, if_match: str = "", dry_run: bool = False
+    ) -> None:
+        """
+        Delete a relationship, optionally only if it is still at
+        expected_version or the version of the if_match entity tag. A dry run
+        only checks that it could be.
+        """
         if not id:
-            raise ValueError("id is required")
-        await self.repo.delete(id)
+            raise ValidationError("id", "is required")
+        await self._check_tenant()
+        await self.repo.delete(id, expected_version_from(expected_version, if_match), dry_run)
 
-    async def list(
+    async def delete_many(
         self,
         source_node_id: Optional[str],
         target_node_id: Optional[str],
         rel_type: Optional[str],
+        dry_run: bool = False,
+        on_batch: Optional[BatchHook] = None
+    ) -> int:
+        """
+        Delete the relationships matching all the given filters. Returns the
+        number deleted, or with dry_run, the number that would be. on_batch
+        follows the progress and may stop the delete between batches.
+        """
+        if not (source_node_id or target_node_id or rel_type):
+            raise ValueError("source_node_id, target_node_id or relationship_type is required")
+        await self._check_tenant()
+        return await self.repo.delete_many(
+            source_node_id, target_node_id, rel_type, DELETE_BATCH_SIZE, dry_run, on_batch
+        )
+
+    async def list(
+        self,
+        source_node_id: FilterValues,
+        target_node_id: FilterValues,
+        rel_type: FilterValues,
         page_size: int,
-        page_token: str
+        page_token: str,
+        order_by: Any = None
     ) -> Tuple[List[Relationship], ListResult]:
-        """Retrieve relationships with pagination and optional filtering."""
+        """
+        Retrieve relationships with pagination and optional filtering, newest
+        first unless order_by sorts them. Each filter takes one value or a list
+        of up to MAX_FILTER_VALUES, any of which matches, so the relationships
+        among a set of nodes come in one listing.
+        """
+        sources = _checked_filter("source_node_ids", source_node_id)
+        targets = _checked_filter("target_node_ids", target_node_id)
+        types = _checked_filter("relationship_types", rel_type)
+        sort = parse_order_by(order_by, RELATIONSHIP_SORT_COLUMNS)
         opts = ListOptions(page_size=page_size, page_token=page_token)
-        return await self.repo.list(source_node_id, target_node_id, rel_type, opts)
+        return await self.repo.list(sources, targets, types, opts, sort)
+
+    async def _check_tenant(self) -> None:
+        if self.tenant_check:
+            await self.tenant_check.require_writable()
@@ -0,0 +1,128 @@
+"""
+Retention policy service implementation.
+
+A node type's retention policy expires its nodes ttl_seconds after their
+created_at, updated_at or a timestamp data field ("data.expires_on", an
+ISO-8601 string; nodes without one never expire). The retention sweeper (see
+app/jobs/retention.py) deletes expired nodes with their relationships in the
+background: the delete action records them as deleted, so their revisions
+still tell what they were, while purge removes their revisions too.
+"""
+
+from typing import Any, Dict, List, Optional, Tuple
+
+from app.repository import (
+    ListOptions,
+    ListResult,
+    NodeRepository,
+    NodeTypeRepository,
+    RetentionPolicy,
+    RetentionPolicyRepository,
+    ValidationError,
+)
+from app.service.schema import parse_data_path, parse_schema
+from app.service.tenant_check import TenantCheck
+
+RETENTION_TIMESTAMP_FIELDS = ("created_at", "updated_at")
+RETENTION_ACTIONS = ("delete", "purge")
+# Sweeps run every RETENTION_POLL_INTERVAL seconds, so shorter TTLs aren't kept anyway
+MIN_TTL_SECONDS = 60
+
+_DATA_PREFIX = "data."
+
+
+def normalize_timestamp_field(timestamp_field: Any, schema: str) -> str:
+    """
+    Validate the field a retention policy counts from: created_at, updated_at
+    or a data path whose first key is declared in the schema, if it declares
+    any fields, and not sensitive.
+    """
+    if timestamp_field in RETENTION_TIMESTAMP_FIELDS:
+        return timestamp_field
+    if not isinstance(timestamp_field, str) or not timestamp_field.startswith(_DATA_PREFIX):
+        raise ValidationError(
+            "timestamp_field", f"must be one of: {', '.join(RETENTION_TIMESTAMP_FIELDS)}, data.<path>"
+        )
+    try:
+        keys = parse_data_path(timestamp_field[len(_DATA_PREFIX):])
+    except ValueError as e:
+        raise ValueError(f"timestamp_field: {e}") from None
+    declared = parse_schema(schema)
+    if declared and keys[0] not in declared:
+        raise ValueError(f"timestamp_field is not in the schema: {keys[0]}")
+    if keys[0] in declared and declared[keys[0]].sensitive:
+        raise ValueError(f"timestamp_field is sensitive: {keys[0]}")
+    return _DATA_PREFIX + ".".join(keys)
+
+
+class RetentionService:
+    """Retention policy business logic service."""
+
+    def __init__(
+        self,
+        repo: RetentionPolicyRepository,
+        node_type_repo: NodeTypeRepository,
+        node_repo: NodeRepository,
+        tenant_check: Optional[TenantCheck] = None
+    ):
+        self.repo = repo
+        self.node_type_repo = node_type_repo
+        self.node_repo = node_repo
+        self.tenant_check = tenant_check
+
+    async def set_policy(
+        self,
+        node_type_id: str,
+        ttl_seconds: Any,
+        timestamp_field: str = "created_at",
+        action: str = "delete"
+    ) -> RetentionPolicy:
+        """Set the retention policy of a node type, replacing its current one."""
+        if not node_type_id:
+            raise ValidationError("node_type_id", "is required")
+        if not isinstance(ttl_seconds, int) or isinstance(ttl_seconds, bool) or ttl_seconds < MIN_TTL_SECONDS:
+            raise ValidationError("ttl_seconds", f"must be an integer of at least {MIN_TTL_SECONDS}")
+        if action not in RETENTION_ACTIONS:
+            raise ValidationError("action", f"must be one of: {', '.join(RETENTION_ACTIONS)}")
+        if self.tenant_check:
+            await self.tenant_check.require_writable()
+        node_type = await self.node_type_repo.get_by_id(node_type_id)
+        policy = RetentionPolicy(
+            node_type_id=node_type_id,
+            timestamp_field=normalize_timestamp_field(timestamp_field or "created_at", node_type.schema),
+            ttl_seconds=ttl_seconds,
+            action=action,
+        )
+        return await self.repo.upsert(policy)
+
+    async def get_policy(self, node_type_id: str) -> RetentionPolicy:
+        """Retrieve the retention policy of a node type."""
+        if not node_type_id:
+            raise ValidationError("node_type_id", "is required")
+        return await self.repo.get(node_type_id)
+
+    async def delete_policy(self, node_type_id: str) -> RetentionPolicy:
+        """Remove the retention policy of a node type; its nodes are kept from then on."""
+        if not node_type_id:
+            raise ValidationError("node_type_id", "is required")
+        if self.tenant_check:
+            await self.tenant_check.require_writable()
+        return await self.repo.delete(node_type_id)
+
+    async def list_policies(self, page_size: int, page_token: str) -> Tuple[List[RetentionPolicy], ListResult]:
+        """Retrieve retention policies with pagination."""
+        return await self.repo.list(ListOptions(page_size=page_size, page_token=page_token))
+
+    async def preview(self, node_type_id: str = "") -> List[Dict[str, Any]]:
+        """
+        Count the nodes the next sweep would expire, for one node type's policy
+        or all of them, without changing anything.
+        """
+        if node_type_id:
+            policies = [await self.repo.get(node_type_id)]
+        else:
+            policies = await self.repo.list_all()
+        return [
+            {"policy": policy.to_dict(), "expired_count": await self.node_repo.count_expired(policy)}
+            for policy in policies
+        ]
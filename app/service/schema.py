@@ -0,0 +1,525 @@
+"""
+NodeType schema parsing and node data validation.
+
+A NodeType schema is a JSON object describing the fields of a node's data.
+Two forms are accepted:
+
+- Simple map: {"title": "string", "location": {"type": "geo_point", "required": true}}
+- JSON Schema style: {"type": "object", "properties": {...}, "required": [...]}
+
+Only geo_point, geo_shape, decimal and localized_string fields are
+validated, "required" included; other types, such as "string", document the
+data and are accepted as-is, so existing free-form schemas keep working.
+
+decimal fields ({"type": "decimal", "scale": 2}) hold exact values such as
+money. They accept a numeric string or JSON number and are stored as a string
+with exactly `scale` fractional digits, so they never pass through float64.
+
+localized_string fields ({"type": "localized_string", "locales": ["en", "fr"],
+"default_locale": "en"}) hold one string per locale, e.g.
+{"en": "Hello", "fr": "Bonjour"}. "locales" optionally restricts the accepted
+locale tags and "default_locale", when set, must always be present. Reads can
+resolve them to a single string, see app/service/localization.py.
+
+Fields of any type can be marked sensitive ({"type": "string", "sensitive":
+true}): their values are encrypted before they are stored, see
+app/service/encryption.py. Sensitive fields can't be part of unique keys or
+indexes.
+"""
+
+import functools
+import json
+import re
+from dataclasses import dataclass
+from functools import lru_cache
+from decimal import Decimal, InvalidOperation, localcontext
+from typing import Any, Callable, Dict, List, Optional, Tuple
+
+from app.repository.errors import FieldViolation, ValidationError
+
+DECIMAL_FIELD_TYPE = "decimal"
+LOCALIZED_STRING_FIELD_TYPE = "localized_string"
+DEFAULT_DECIMAL_SCALE = 2
+MAX_DECIMAL_SCALE = 18
+MAX_DECIMAL_DIGITS = 38
+MAX_UNIQUE_KEYS = 16
+# Postgres indexes have at most 32 columns
+MAX_UNIQUE_KEY_FIELDS = 32
+MAX_NODE_TYPE_INDEXES = 10
+MAX_INDEX_PATHS = 4
+MAX_DATA_PATH_DEPTH = 16
+INDEX_METHODS = ("btree", "gin")
+
+_INDEX_NAME_PATTERN = re.compile(r"^[a-z][a-z0-9_]{0,62}$")
+
+
+# Parsed schemas kept per server instance, shared by node types with the same schema
+SCHEMA_CACHE_SIZE = 1024
+
+
+@dataclass(frozen=True)
+class FieldSpec:
+    """Declared type information for a single data field; parsed specs are shared, so it is immutable."""
+    name: str = ""
+    type: str = ""
+    required: bool = False
+    scale: Optional[int] = None  # decimal fields only
+    locales: Optional[List[str]] = None  # localized_string fields only
+    default_locale: Optional[str] = None  # localized_string fields only
+    sensitive: Any = False  # encrypted at rest
+
+    def to_dict(self) -> dict:
+        """Convert to dictionary."""
+        result = {"name": self.name, "type": self.type, "required": self.required}
+        if self.type == DECIMAL_FIELD_TYPE:
+            result["scale"] = DEFAULT_DECIMAL_SCALE if self.scale is None else self.scale
+        if self.locales is not None:
+            result["locales"] = list(self.locales)
+        if self.default_locale is not None:
+            result["default_locale"] = self.default_locale
+        if self.sensitive:
+            result["sensitive"] = True
+        return result
+
+
+def parse_schema(schema: str) -> Dict[str, FieldSpec]:
+    """
+    Parse a NodeType schema string into field specs keyed by field name.
+    Each schema is parsed once, then served from a cache.
+    """
+    return dict(_parse_schema(schema))
+
+
+@lru_cache(maxsize=SCHEMA_CACHE_SIZE)
+def _parse_schema(schema: str) -> Dict[str, FieldSpec]:
+    if not schema:
+        return {}
+
+    try:
+        doc = json.loads(schema)
+    except json.JSONDecodeError as e:
+        raise ValidationError("schema", f"must be valid JSON: {e}") from e
+
+    if not isinstance(doc, dict):
+        return {}
+
+    fields: Dict[str, FieldSpec] = {}
+
+    if isinstance(doc.get("properties"), dict):
+        required = set(doc.get("required") or [])
+        for name, prop in doc["properties"].items():
+            prop = prop if isinstance(prop, dict) else {}
+            field_type = prop.get("type", "")
+            fields[name] = FieldSpec(
+                name=name,
+                type=field_type if isinstance(field_type, str) else "",
+                required=name in required,
+                scale=prop.get("scale"),
+                locales=prop.get("locales"),
+                default_locale=prop.get("default_locale"),
+                sensitive=prop.get("sensitive", False),
+            )
+        return fields
+
+    for name, spec in doc.items():
+        if isinstance(spec, str):
+            fields[name] = FieldSpec(name=name, type=spec)
+        elif isinstance(spec, dict):
+            field_type = spec.get("type", "")
+            fields[name] = FieldSpec(
+                name=name,
+                type=field_type if isinstance(field_type, str) else "",
+                required=bool(spec.get("required", False)),
+                scale=spec.get("scale"),
+                locales=spec.get("locales"),
+                default_locale=spec.get("default_locale"),
+                sensitive=spec.get("sensitive", False),
+            )
+
+    return fields
+
+
+def sensitive_fields(schema: str) -> List[str]:
+    """Return the names of the sensitive fields of a NodeType schema."""
+    return [name for name, spec in parse_schema(schema).items() if spec.sensitive is True]
+
+
+def validate_schema(schema: str) -> None:
+    """Validate that a NodeType schema is well-formed."""
+    for name, spec in parse_schema(schema).items():
+        _validate_localized_spec(name, spec)
+        if not isinstance(spec.sensitive, bool):
+            raise ValueError(f"schema.{name}.sensitive must be a boolean")
+        if spec.scale is None:
+            continue
+        if spec.type != DECIMAL_FIELD_TYPE:
+            raise ValueError(f"schema.{name}.scale is only supported for decimal fields")
+        if not isinstance(spec.scale, int) or isinstance(spec.scale, bool) \
+                or not 0 <= spec.scale <= MAX_DECIMAL_SCALE:
+            raise ValueError(f"schema.{name}.scale must be an integer between 0 and {MAX_DECIMAL_SCALE}")
+
+
+def normalize_unique_keys(unique_keys: Optional[List[Any]], schema: str) -> List[List[str]]:
+    """
+    Validate a node type's unique keys and return them as lists of field
+    names. A key is a field name or a list of field names; fields must be
+    declared in the schema, if it declares any.
+    """
+    if not unique_keys:
+        return []
+    if not isinstance(unique_keys, list):
+        raise ValidationError("unique_keys", "must be an array")
+    if len(unique_keys) > MAX_UNIQUE_KEYS:
+        raise ValidationError("unique_keys", f"can have at most {MAX_UNIQUE_KEYS} keys")
+
+    declared = parse_schema(schema)
+    keys: List[List[str]] = []
+    for i, key in enumerate(unique_keys):
+        fields = [key] if isinstance(key, str) else key
+        if not isinstance(fields, list) or not fields \
+                or not all(isinstance(name, str) and name for name in fields):
+            raise ValueError(f"unique_keys[{i}] must be a field name or a non-empty array of field names")
+        if len(fields) > MAX_UNIQUE_KEY_FIELDS:
+            raise ValueError(f"unique_keys[{i}] can have at most {MAX_UNIQUE_KEY_FIELDS} fields")
+        if len(set(fields)) != len(fields):
+            raise ValueError(f"unique_keys[{i}] has duplicate fields")
+        for name in fields:
+            if declared and name not in declared:
+                raise ValueError(f"unique_keys[{i}] field is not in the schema: {name}")
+            if name in declared and declared[name].sensitive:
+                raise ValueError(f"unique_keys[{i}] field is sensitive: {name}")
+        if fields in keys:
+            raise ValueError(f"unique_keys[{i}] is a duplicate key")
+        keys.append(list(fields))
+    return keys
+
+
+def parse_data_path(path: Any) -> List[str]:
+    """Split a dot-separated data path such as "address.city" into its keys."""
+    if not isinstance(path, str) or not path:
+        raise ValueError("data path must be a non-empty string")
+    keys = path.split(".")
+    if not all(keys):
+        raise ValueError(f"invalid data path: {path}")
+    if len(keys) > MAX_DATA_PATH_DEPTH:
+        raise ValueError(f"data path can have at most {MAX_DATA_PATH_DEPTH} keys: {path}")
+    return keys
+
+
+def normalize_index(name: str, method: str, paths: Any, schema: str) -> List[List[str]]:
+    """
+    Validate a node type index and return its paths as lists of keys. Paths
+    are dot-separated; their first key must be declared in the schema, if it
+    declares any fields.
+    """
+    if not isinstance(name, str) or not _INDEX_NAME_PATTERN.match(name):
+        raise ValueError(
+            "index name must start with a lowercase letter and contain only lowercase letters, digits and _ "
+            "(at most 63 characters)"
+        )
+    if method not in INDEX_METHODS:
+        raise ValueError(f"index method must be one of {', '.join(INDEX_METHODS)}: {method}")
+    if not isinstance(paths, list) or not paths:
+        raise ValidationError("paths", "must be a non-empty array of data paths")
+    if len(paths) > MAX_INDEX_PATHS:
+        raise ValueError(f"an index can have at most {MAX_INDEX_PATHS} paths")
+
+    declared = parse_schema(schema)
+    keys: List[List[str]] = []
+    for path in paths:
+        path_keys = parse_data_path(path)
+        if declared and path_keys[0] not in declared:
+            raise ValueError(f"index path field is not in the schema: {path_keys[0]}")
+        if path_keys[0] in declared and declared[path_keys[0]].sensitive:
+            raise ValueError(f"index path field is sensitive: {path_keys[0]}")
+        if path_keys in keys:
+            raise ValueError(f"duplicate index path: {path}")
+        keys.append(path_keys)
+    return keys
+
+
+def _validate_localized_spec(name: str, spec: FieldSpec) -> None:
+    if spec.locales is None and spec.default_locale is None:
+        return
+    if spec.type != LOCALIZED_STRING_FIELD_TYPE:
+        raise ValueError(f"schema.{name}.locales and default_locale are only supported for localized_string fields")
+    if spec.locales is not None:
+        if not isinstance(spec.locales, list) or not spec.locales \
+                or not all(is_locale_tag(tag) for tag in spec.locales):
+            raise ValueError(f"schema.{name}.locales must be a non-empty array of locale tags like \"en\" or \"pt-BR\"")
+    if spec.default_locale is not None:
+        if not is_locale_tag(spec.default_locale):
+            raise ValueError(f"schema.{name}.default_locale must be a locale tag like \"en\" or \"pt-BR\"")
+        if spec.locales is not None and not _has_locale(spec.locales, spec.default_locale):
+            raise ValueError(f"schema.{name}.default_locale must be one of schema.{name}.locales")
+
+
+def parse_data(data: str, exact: bool = False) -> Dict[str, Any]:
+    """
+    Parse node data into a JSON object.
+
+    With exact=True, non-integer numbers are parsed as Decimal instead of float.
+    """
+    if not data:
+        return {}
+
+    try:
+        doc = json.loads(data, parse_float=Decimal) if exact else json.loads(data)
+    except json.JSONDecodeError as e:
+        raise ValidationError("data", f"must be valid JSON: {e}") from e
+
+    if not isinstance(doc, dict):
+        raise ValidationError("data", "must be a JSON object")
+
+    return doc
+
+
+class SchemaValidator:
+    """
+    A NodeType schema compiled for validating node data: each declared
+    field's check is resolved once, so validating data only runs the checks.
+    """
+
+    def __init__(self, schema: str):
+        self.schema = schema
+        fields = parse_schema(schema)
+        # (field name, required, check returning an error message or "") of the fields of validated types
+        self._checks: List[Tuple[str, bool, Callable[[Any], str]]] = [
+            (name, spec.required, check) for name, spec in fields.items() if (check := _field_check(spec))
+        ]
+        self._decimal_scales = {
+            name: spec.scale for name, spec in fields.items() if spec.type == DECIMAL_FIELD_TYPE
+        }
+
+    def validate(self, data: str) -> None:
+        """Validate node data, raising a ValidationError naming every invalid field."""
+        self._check(parse_data(data, exact=True))
+
+    def normalize(self, data: str) -> str:
+        """
+        Rewrite decimal fields in node data to their canonical string form.
+
+        Data is returned unchanged when the schema declares no decimal fields
+        or none are present. Call after validate.
+        """
+        if not self._decimal_scales or not data:
+            return data
+        return self._normalized(data, parse_data(data, exact=True))
+
+    def prepare(self, data: str) -> str:
+        """
+        Validate node data and return it normalized, like validate then
+        normalize but parsing it once. The data itself is returned, not a
+        copy, unless a decimal field is rewritten.
+        """
+        doc = parse_data(data, exact=True)
+        self._check(doc)
+        return self._normalized(data, doc) if self._decimal_scales else data
+
+    def _check(self, doc: Dict[str, Any]) -> None:
+        violations: List[FieldViolation] = []
+
+        for name, required, check in self._checks:
+            value = doc.get(name)
+            if value is None:
+                if required:
+                    violations.append(FieldViolation(f"data.{name}", "is required"))
+                continue
+            error = check(value)
+            if error:
+                violations.append(FieldViolation(f"data.{name}", error))
+
+        if violations:
+            raise ValidationError.of(violations)
+
+    def _normalized(self, data: str, exact: Dict[str, Any]) -> str:
+        """Return data with the decimal fields of its exact parse rewritten, or data itself if there are none."""
+        present = [name for name in self._decimal_scales if exact.get(name) is not None]
+        if not present:
+            return data
+
+        for name in present:
+            exact[name] = canonical_decimal(exact[name], self._decimal_scales[name])
+        # Other non-integer numbers were parsed as Decimal; float writes them as json.loads would have read them
+        return json.dumps(exact, default=float)
+
+
+def _field_check(spec: FieldSpec) -> Optional[Callable[[Any], str]]:
+    if spec.type == DECIMAL_FIELD_TYPE:
+        return functools.partial(_validate_decimal, scale=spec.scale)
+    if spec.type == LOCALIZED_STRING_FIELD_TYPE:
+        return functools.partial(_validate_localized_string, spec=spec)
+    return FIELD_TYPES.get(spec.type)
+
+
+def validate_data(schema: str, data: str) -> None:
+    """Validate node data against a NodeType schema, raising a ValidationError naming every invalid field."""
+    SchemaValidator(schema).validate(data)
+
+
+def prepare_data(schema: str, data: str) -> str:
+    """Validate node data against a NodeType schema and return it normalized, parsing it once."""
+    return SchemaValidator(schema).prepare(data)
+
+
+def normalize_data(schema: str, data: str) -> str:
+    """
+    Rewrite decimal fields in node data to their canonical string form.
+
+    Data is returned unchanged when the schema declares no decimal fields or
+    none are present. Call after validate_data.
+    """
+    return SchemaValidator(schema).normalize(data)
+
+
+def field_type(schema: str, name: str) -> Optional[str]:
+    """Return the declared type of a field, or None if it is not declared."""
+    spec = parse_schema(schema).get(name)
+    return spec.type if spec else None
+
+
+_DECIMAL_PATTERN = re.compile(r"^[+-]?\d+(\.\d+)?$")
+
+
+def canonical_decimal(value: Any, scale: Optional[int] = None) -> str:
+    """
+    Return the canonical string form of a decimal value at the given scale.
+
+    Accepts integers, Decimals (exactly parsed JSON numbers) and plain numeric
+    strings. Values with more fractional digits than the scale are rejected
+    rather than rounded.
+    """
+    if scale is None:
+        scale = DEFAULT_DECIMAL_SCALE
+
+    if isinstance(value, bool):
+        raise ValueError("must be a decimal string or number")
+    if isinstance(value, (int, Decimal)):
+        number = Decimal(value)
+    elif isinstance(value, str) and _DECIMAL_PATTERN.match(value):
+        number = Decimal(value)
+    else:
+        raise ValueError('must be a decimal string like "12.34" or a number')
+
+    if not number.is_finite():
+        raise ValueError("must be a finite number")
+
+    with localcontext() as ctx:
+        ctx.prec = MAX_DECIMAL_DIGITS
+        try:
+            quantized = number.quantize(Decimal(1).scaleb(-scale))
+        except InvalidOperation:
+            raise ValueError(f"must have at most {MAX_DECIMAL_DIGITS} digits") from None
+
+    if quantized != number:
+        raise ValueError(f"must have at most {scale} decimal places")
+    if quantized == 0:
+        quantized = abs(quantized)
+
+    return str(quantized)
+
+
+# ============================================================================
+# Field type validators
+#
+# Each validator returns an error message, or an empty string if the value is
+# valid for the type.
+# ============================================================================
+
+def _is_number(value: Any) -> bool:
+    return isinstance(value, (int, float, Decimal)) and not isinstance(value, bool)
+
+
+def _validate_decimal(value: Any, scale: Optional[int]) -> str:
+    try:
+        canonical_decimal(value, scale)
+    except ValueError as e:
+        return str(e)
+    return ""
+
+
+_LOCALE_PATTERN = re.compile(r"^[A-Za-z]{2,3}(-[A-Za-z0-9]{2,8})*$")
+
+
+def is_locale_tag(value: Any) -> bool:
+    """Whether value is a BCP 47 style locale tag such as "en" or "pt-BR"."""
+    return isinstance(value, str) and bool(_LOCALE_PATTERN.match(value))
+
+
+def _has_locale(locales: List[str], locale: str) -> bool:
+    return locale.lower() in (tag.lower() for tag in locales)
+
+
+def _validate_localized_string(value: Any, spec: FieldSpec) -> str:
+    if not isinstance(value, dict) or not value:
+        return 'must be an object mapping locales to strings, like {"en": "Hello"}'
+    for locale, text in value.items():
+        if not is_locale_tag(locale):
+            return f"has invalid locale tag: {locale}"
+        if spec.locales is not None and not _has_locale(spec.locales, locale):
+            return f"has unsupported locale: {locale}"
+        if not isinstance(text, str):
+            return f"value for locale {locale} must be a string"
+    if spec.default_locale and not _has_locale(list(value), spec.default_locale):
+        return f"must include the default locale: {spec.default_locale}"
+    return ""
+
+
+def _validate_position(position: Any) -> bool:
+    if not isinstance(position, list) or len(position) < 2:
+        return False
+    lng, lat = position[0], position[1]
+    if not _is_number(lng) or not _is_number(lat):
+        return False
+    return -180 <= lng <= 180 and -90 <= lat <= 90
+
+
+def _validate_geo_point(value: Any) -> str:
+    if not isinstance(value, dict):
+        return 'must be an object like {"lat": 0.0, "lng": 0.0}'
+    lat, lng = value.get("lat"), value.get("lng")
+    if not _is_number(lat) or not _is_number(lng):
+        return "must have numeric lat and lng"
+    if not -90 <= lat <= 90:
+        return "lat must be between -90 and 90"
+    if not -180 <= lng <= 180:
+        return "lng must be between -180 and 180"
+    return ""
+
+
+_GEOJSON_DEPTH = {
+    "Point": 0,
+    "MultiPoint": 1,
+    "LineString": 1,
+    "MultiLineString": 2,
+    "Polygon": 2,
+    "MultiPolygon": 3,
+}
+
+
+def _validate_coordinates(coords: Any, depth: int) -> bool:
+    if depth == 0:
+        return _validate_position(coords)
+    if not isinstance(coords, list) or not coords:
+        return False
+    return all(_validate_coordinates(c, depth - 1) for c in coords)
+
+
+def _validate_geo_shape(value: Any) -> str:
+    if not isinstance(value, dict):
+        return "must be a GeoJSON geometry object"
+    geometry_type = value.get("type")
+    if geometry_type not in _GEOJSON_DEPTH:
+        return f"has unsupported GeoJSON type: {geometry_type}"
+    if not _validate_coordinates(value.get("coordinates"), _GEOJSON_DEPTH[geometry_type]):
+        return "has invalid GeoJSON coordinates"
+    return ""
+
+
+# Validated field types besides decimal and localized_string, whose checks take their spec
+FIELD_TYPES: Dict[str, Callable[[Any], str]] = {
+    "geo_point": _validate_geo_point,
+    "geo_shape": _validate_geo_shape,
+}
+
+GEO_FIELD_TYPES = ("geo_point", "geo_shape")
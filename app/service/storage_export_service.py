@@ -0,0 +1,215 @@
+"""
+Tenant exports to object storage.
+
+export_tenant_to_storage writes a tenant export (see
+app/service/transfer_service.py) straight to the object storage configured
+with EXPORT_STORAGE_URL, under <prefix>/<tenant_id>/exports/<job id> with the
+extension .ndjson.gz, .ndjson.zst or .ndjson. Records are compressed as the
+repository cursor reads them and uploaded with a multipart upload in parts of
+EXPORT_STORAGE_PART_SIZE compressed bytes, so at most one part is held in
+memory whatever the size of the tenant. Each part is a complete gzip member
+or zstd frame ending at a record boundary; concatenated they decompress as
+one stream. The object appears once the last part is uploaded.
+
+An export runs as a bulk job of kind export. After each part it checkpoints
+the upload ID, the ETags of the parts and the last record written in the
+job's progress, so a failed, cancelled or interrupted export (one running
+without progress for EXPORT_STORAGE_STALE_SECONDS) is resumed with
+resume=<job id>: the same upload continues after the last part uploaded. The
+records after the checkpoint are read from a new snapshot, so they may hold
+changes made after the header's change_token; list_changes from it still
+lists every change the export could miss.
+"""
+
+import json
+import posixpath
+import zlib
+from datetime import datetime
+from typing import TYPE_CHECKING, Any, List, Optional
+
+from app.repository import BULK_EXPORT, BulkJob, ExportPosition, FailedPreconditionError, ValidationError
+from app.service.bulk_job_service import BulkJobService
+from app.service.transfer_service import DEFAULT_TRANSFER_BATCH_SIZE, MAX_TRANSFER_BATCH_SIZE, TransferService
+
+if TYPE_CHECKING:
+    # app.lake imports the services
+    from app.lake.storage import ObjectStore
+
+try:
+    import zstandard
+except ImportError:  # only required for zstd compressed exports
+    zstandard = None
+
+# Object name extensions by compression
+COMPRESSIONS = {"gzip": ".ndjson.gz", "zstd": ".ndjson.zst", "none": ".ndjson"}
+
+DEFAULT_PART_SIZE = 8 * 1024 * 1024
+DEFAULT_STALE_SECONDS = 900.0
+
+
+class StorageExportService:
+    """Tenant exports to object storage business logic service."""
+
+    def __init__(
+        self,
+        transfer: TransferService,
+        jobs: BulkJobService,
+        tenant_id: str,
+        store: Optional["ObjectStore"] = None,
+        prefix: str = "",
+        part_size: int = DEFAULT_PART_SIZE,
+        stale_seconds: float = DEFAULT_STALE_SECONDS
+    ):
+        self.transfer = transfer
+        self.jobs = jobs
+        self.tenant_id = tenant_id
+        # Holds the exports; None disables them
+        self.store = store
+        self.prefix = prefix
+        self.part_size = part_size
+        self.stale_seconds = stale_seconds
+
+    async def export(
+        self,
+        compression: str = "gzip",
+        batch_size: int = DEFAULT_TRANSFER_BATCH_SIZE,
+        resume: str = ""
+    ) -> BulkJob:
+        """
+        Export the tenant to object storage, or resume the export with job ID
+        resume, with the compression and batch size it was started with.
+        Returns the job: succeeded, or cancelled if it was cancelled; if the
+        export fails, the job fails and the error is raised.
+        """
+        store = self._store()
+        if resume:
+            job = await self.jobs.resume(resume, BULK_EXPORT, self.stale_seconds)
+        else:
+            if compression not in COMPRESSIONS:
+                raise ValidationError("compression", f"must be one of {', '.join(COMPRESSIONS)}")
+            if not 1 <= batch_size <= MAX_TRANSFER_BATCH_SIZE:
+                raise ValidationError("batch_size", f"must be between 1 and {MAX_TRANSFER_BATCH_SIZE}")
+            _compressor(compression)
+            job = await self.jobs.start(BULK_EXPORT, {"compression": compression, "batch_size": batch_size})
+            key = self._key(job.id, compression)
+            job.progress = {"key": key, "url": store.url(key), "upload_id": "", "parts": [], "bytes": 0}
+
+        try:
+            await self._run(store, job)
+        except Exception as e:
+            await self.jobs.finish(job, str(e))
+            raise
+        except BaseException:
+            # The request went away; resume the export later
+            await self.jobs.finish(job, "export was interrupted")
+            raise
+        if job.status == "cancelled":
+            return job
+        return await self.jobs.finish(job)
+
+    async def _run(self, store: "ObjectStore", job: BulkJob) -> None:
+        compression = job.params["compression"]
+        progress = job.progress
+        key = progress["key"]
+        after = None
+        if progress.get("position"):
+            position = progress["position"]
+            after = ExportPosition(position["type"], datetime.fromisoformat(position["created_at"]), position["id"])
+
+        if not progress["upload_id"]:
+            progress["upload_id"] = await store.create_upload(key, "application/x-ndjson")
+            if not await self.jobs.report(job, job.processed, progress=progress):
+                return
+
+        records = self.transfer.export(self.tenant_id, job.params["batch_size"], after)
+        part = _Part(compression)
+        processed = job.processed
+        position = progress.get("position")
+        try:
+            async for record in records:
+                if record["type"] == "header":
+                    if after:
+                        continue
+                    progress["change_token"] = record["change_token"]
+                else:
+                    fields = record[record["type"]]
+                    position = {"type": record["type"], "created_at": fields["created_at"], "id": fields["id"]}
+                    processed += 1
+                part.write(json.dumps(record).encode() + b"\n")
+                if part.size >= self.part_size and not await self._upload(store, job, part, processed, position):
+                    return
+            if part.records and not await self._upload(store, job, part, processed, position):
+                return
+        finally:
+            await records.aclose()
+
+        await store.complete_upload(key, progress["upload_id"], [(n, etag) for n, etag in progress["parts"]])
+
+    async def _upload(
+        self, store: "ObjectStore", job: BulkJob, part: "_Part", processed: int, position: Optional[dict]
+    ) -> bool:
+        """
+        Upload a part ending with the record at position and checkpoint after
+        it; returns False if the job was cancelled.
+        """
+        progress = job.progress
+        body = part.finish()
+        number = len(progress["parts"]) + 1
+        etag = await store.upload_part(progress["key"], progress["upload_id"], number, body)
+        progress["parts"].append([number, etag])
+        progress["bytes"] += len(body)
+        progress["position"] = position
+        return await self.jobs.report(job, processed, progress=progress)
+
+    def _store(self) -> "ObjectStore":
+        if self.store is None:
+            raise FailedPreconditionError(
+                "exports to object storage are not enabled on this server (set EXPORT_STORAGE_URL)"
+            )
+        return self.store
+
+    def _key(self, id: str, compression: str) -> str:
+        parts = (self.tenant_id, "exports", id + COMPRESSIONS[compression])
+        return posixpath.join(self.prefix, *parts) if self.prefix else posixpath.join(*parts)
+
+
+class _Part:
+    """A part being compressed: one gzip member or zstd frame of whole records."""
+
+    def __init__(self, compression: str):
+        self.compression = compression
+        self._start()
+
+    def _start(self) -> None:
+        self._compressor = _compressor(self.compression)
+        self._chunks: List[bytes] = []
+        # Compressed bytes so far, not counting those the compressor still buffers
+        self.size = 0
+        self.records = 0
+
+    def write(self, data: bytes) -> None:
+        chunk = self._compressor.compress(data) if self._compressor else data
+        if chunk:
+            self._chunks.append(chunk)
+            self.size += len(chunk)
+        self.records += 1
+
+    def finish(self) -> bytes:
+        """Return the part's bytes and start the next part."""
+        if self._compressor:
+            self._chunks.append(self._compressor.flush())
+        body = b"".join(self._chunks)
+        self._start()
+        return body
+
+
+def _compressor(compression: str) -> Any:
+    """Return a compressor of one gzip member or zstd frame, None without compression."""
+    if compression == "gzip":
+        return zlib.compressobj(6, zlib.DEFLATED, 31)
+    if compression == "zstd":
+        if zstandard is None:
+            raise FailedPreconditionError("zstd compression requires the zstandard package")
+        return zstandard.ZstdCompressor().compressobj()
+    return None
+
@@ -0,0 +1,168 @@
+"""
+Pull subscriptions.
+
+An alternative to webhooks for consumers that can't expose an endpoint or
+need to control their own pace: a subscription queues the change events
+matching its filters, and the consumer pulls them in batches and
+acknowledges each one once processed. Pulled events are leased for the
+subscription's ack deadline; events not acknowledged by then are pulled again.
+
+Delivery is at least once: an event is only removed when it is acknowledged,
+so a consumer that crashes between processing and acknowledging gets the
+event again. Every delivery of an event carries the same event ID, which
+consumers record with the effects of processing it to skip duplicates,
+giving exactly-once processing.
+"""
+
+from typing import List, Optional, Tuple
+
+from app.events.types import EVENT_TYPES
+from app.repository import (
+    EventSubscription,
+    ListOptions,
+    ListResult,
+    SubscriptionMessage,
+    SubscriptionRepository,
+    ValidationError,
+)
+
+SUBSCRIPTION_STATUSES = ("active", "disabled")
+DEFAULT_ACK_DEADLINE = 60
+MAX_ACK_DEADLINE = 600
+DEFAULT_MAX_EVENTS = 100
+MAX_EVENTS = 1000
+
+
+def _validate_filters(event_types: List[str], node_type_ids: List[str]) -> None:
+    for event_type in event_types:
+        if event_type not in EVENT_TYPES:
+            raise ValueError(f"unknown event type: {event_type}")
+    for node_type_id in node_type_ids:
+        if not isinstance(node_type_id, str) or not node_type_id:
+            raise ValidationError("node_type_ids", "must be an array of node type IDs")
+
+
+def _validate_ack_deadline(ack_deadline_seconds: int) -> None:
+    if not 1 <= ack_deadline_seconds <= MAX_ACK_DEADLINE:
+        raise ValidationError("ack_deadline_seconds", f"must be between 1 and {MAX_ACK_DEADLINE}")
+
+
+def _ack_ids(ack_ids: List[str]) -> List[int]:
+    if not ack_ids:
+        raise ValidationError("ack_ids", "is required")
+    try:
+        return [int(ack_id) for ack_id in ack_ids]
+    except (TypeError, ValueError):
+        raise ValueError("ack_ids must be ack_id values of pulled events") from None
+
+
+class SubscriptionService:
+    """Pull subscription business logic service."""
+
+    def __init__(self, repo: SubscriptionRepository):
+        self.repo = repo
+
+    async def create(
+        self,
+        name: str,
+        event_types: Optional[List[str]] = None,
+        node_type_ids: Optional[List[str]] = None,
+        ack_deadline_seconds: int = DEFAULT_ACK_DEADLINE,
+        dry_run: bool = False
+    ) -> EventSubscription:
+        """
+        Create a subscription, which queues the matching events from now on.
+        A dry run validates it and returns it without saving it.
+        """
+        if not name:
+            raise ValidationError("name", "is required")
+        event_types = list(event_types or [])
+        node_type_ids = list(node_type_ids or [])
+        _validate_filters(event_types, node_type_ids)
+        _validate_ack_deadline(ack_deadline_seconds)
+
+        return await self.repo.create(EventSubscription(
+            name=name,
+            event_types=event_types,
+            node_type_ids=node_type_ids,
+            ack_deadline_seconds=ack_deadline_seconds,
+        ), dry_run)
+
+    async def get_by_id(self, id: str) -> EventSubscription:
+        """Retrieve a subscription by ID."""
+        if not id:
+            raise ValidationError("id", "is required")
+        return await self.repo.get_by_id(id)
+
+    async def update(
+        self,
+        id: str,
+        event_types: Optional[List[str]] = None,
+        node_type_ids: Optional[List[str]] = None,
+        ack_deadline_seconds: int = 0,
+        status: str = "",
+        dry_run: bool = False
+    ) -> EventSubscription:
+        """
+        Update a subscription; disabled subscriptions queue no events but keep
+        their backlog. A dry run validates the update and returns the result
+        without saving it.
+        """
+        if not id:
+            raise ValidationError("id", "is required")
+
+        subscription = await self.repo.get_by_id(id)
+
+        if event_types is not None:
+            _validate_filters(event_types, [])
+            subscription.event_types = list(event_types)
+        if node_type_ids is not None:
+            _validate_filters([], node_type_ids)
+            subscription.node_type_ids = list(node_type_ids)
+        if ack_deadline_seconds:
+            _validate_ack_deadline(ack_deadline_seconds)
+            subscription.ack_deadline_seconds = ack_deadline_seconds
+        if status:
+            if status not in SUBSCRIPTION_STATUSES:
+                raise ValidationError("status", f"must be one of: {', '.join(SUBSCRIPTION_STATUSES)}")
+            subscription.status = status
+
+        if dry_run:
+            return subscription
+        return await self.repo.update(subscription)
+
+    async def delete(self, id: str) -> None:
+        """Delete a subscription with its backlog."""
+        if not id:
+            raise ValidationError("id", "is required")
+        await self.repo.delete(id)
+
+    async def list(self, page_size: int, page_token: str) -> Tuple[List[EventSubscription], ListResult]:
+        """Retrieve subscriptions with pagination."""
+        opts = ListOptions(page_size=page_size, page_token=page_token)
+        return await self.repo.list(opts)
+
+    async def pull(self, id: str, max_events: int = DEFAULT_MAX_EVENTS) -> List[SubscriptionMessage]:
+        """
+        Pull up to max_events of a subscription's oldest events, leasing them
+        for its ack deadline. Returns no events when none are available.
+        """
+        if not 1 <= max_events <= MAX_EVENTS:
+            raise ValidationError("max_events", f"must be between 1 and {MAX_EVENTS}")
+        subscription = await self.get_by_id(id)
+        return await self.repo.pull(subscription.id, max_events, subscription.ack_deadline_seconds)
+
+    async def ack(self, id: str, ack_ids: List[str]) -> int:
+        """
+        Acknowledge pulled events, so they are not pulled again. Returns the
+        number acknowledged; events acknowledged before are ignored.
+        """
+        ids = _ack_ids(ack_ids)
+        subscription = await self.get_by_id(id)
+        return await self.repo.ack(subscription.id, ids)
+
+    async def nack(self, id: str, ack_ids: List[str]) -> int:
+        """Release pulled events that weren't processed, so they are pulled again before their lease ends."""
+        ids = _ack_ids(ack_ids)
+        subscription = await self.get_by_id(id)
+        return await self.repo.nack(subscription.id, ids)
@@ -0,0 +1,33 @@
+"""
+Tenant checks of tenant-scoped services.
+
+Tenant-scoped services act on a tenant's database, which outlives neither the
+tenant nor its lifecycle changes: a tenant can be deleted, suspended or
+archived while its connection pool stays cached. Services given a TenantCheck
+verify the tenant in the control database before they write, so writes for
+such tenants fail with NotFoundError or FailedPreconditionError rather than
+database errors.
+"""
+
+from typing import Optional
+
+from app.repository import FailedPreconditionError, Tenant, TenantRepository
+from app.service.tenant_service import ACTIVE
+
+
+class TenantCheck:
+    """Verifies the tenant a service acts for exists and accepts writes."""
+
+    def __init__(self, repo: TenantRepository, tenant_id: str):
+        self.repo = repo
+        self.tenant_id = tenant_id
+        # Services are built per request, so the tenant is looked up once per request
+        self._tenant: Optional[Tenant] = None
+
+    async def require_writable(self) -> Tenant:
+        """Return the tenant if it is active; raise NotFoundError or FailedPreconditionError otherwise."""
+        if self._tenant is None:
+            self._tenant = await self.repo.get_by_id(self.tenant_id)
+        if self._tenant.status != ACTIVE:
+            raise FailedPreconditionError(f"tenant {self.tenant_id} is {self._tenant.status}")
+        return self._tenant
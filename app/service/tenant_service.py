@@ -1,26 +1,91 @@
 """
 Tenant service implementation.
+
+Tenants move through lifecycle states with suspend, archive and reactivate:
+
+    active     ->  suspended   (suspend)     every data-plane call is rejected
+    active     ->  archived    (archive)     the tenant database is snapshotted,
+    suspended  ->  archived                  then made read-only
+    suspended  ->  active      (reactivate)
+    archived   ->  active      (reactivate)  writable again; the snapshot is kept
+
+Rejected calls fail with FailedPreconditionError, as do suspend and archive
+while server instances of a release without lifecycle states still run.
+
+Deleting a tenant in any state makes it deleting: every data-plane call is
+rejected while a background worker deletes its data, databases, members, API
+keys and audit log, then the tenant (see app/jobs/tenant_deletions.py).
+
+A tenant's quota sets its request rate limits (see app/quotas/limiter.py).
+
+Clients build URLs from tenant slugs, so TENANT_SLUG_POLICY sets whether they
+change after creation: mutable lets update_tenant and rename_tenant_slug
+change them, rename only rename_tenant_slug, immutable neither. Every change
+is recorded, and get_tenant_by_slug resolves a former slug to the tenant most
+recently renamed from it, unless another tenant has taken it since.
 """
 
+from datetime import datetime, timezone
 from typing import List, Tuple, Optional
 
-from app.repository import Tenant, TenantRepository, ListOptions, ListResult
+from app.cluster import require_feature
+from app.quotas import forget_quota
+from app.repository import (
+    FailedPreconditionError,
+    Tenant,
+    TenantDeletion,
+    TenantDeletionRepository,
+    TenantQuota,
+    TenantQuotaRepository,
+    TenantRepository,
+    TenantSlugChange,
+    ListOptions,
+    ListResult,
+    NotFoundError,
+    ValidationError,
+)
+from app.repository.actor import current_actor
 from app.db.tenant_db_manager import TenantDatabaseManager
 
+ACTIVE = "active"
+SUSPENDED = "suspended"
+ARCHIVED = "archived"
+DELETING = "deleting"
+TENANT_STATUSES = (ACTIVE, SUSPENDED, ARCHIVED, DELETING)
+
+# Slug policies
+SLUG_MUTABLE = "mutable"
+SLUG_RENAME = "rename"
+SLUG_IMMUTABLE = "immutable"
+SLUG_POLICIES = (SLUG_MUTABLE, SLUG_RENAME, SLUG_IMMUTABLE)
+
 
 class TenantService:
     """Tenant business logic service."""
 
-    def __init__(self, repo: TenantRepository, tenant_db_manager: Optional[TenantDatabaseManager] = None):
+    def __init__(
+        self,
+        repo: TenantRepository,
+        tenant_db_manager: Optional[TenantDatabaseManager] = None,
+        quota_repo: Optional[TenantQuotaRepository] = None,
+        deletion_repo: Optional[TenantDeletionRepository] = None,
+        slug_policy: str = SLUG_MUTABLE,
+    ):
+        if slug_policy not in SLUG_POLICIES:
+            raise ValidationError("slug_policy", f"must be one of {', '.join(SLUG_POLICIES)}, not {slug_policy!r}")
         self.repo = repo
         self.tenant_db_manager = tenant_db_manager
+        self.quota_repo = quota_repo
+        # Without one, tenants are deleted at once, leaving their databases
+        self.deletion_repo = deletion_repo
+        self.slug_policy = slug_policy
 
     async def create(self, slug: str, name: str) -> Tenant:
         """Create a new tenant and its associated tenant database."""
         if not slug:
-            raise ValueError("slug is required")
+            raise ValidationError("slug", "is required")
         if not name:
-            raise ValueError("name is required")
+            raise ValidationError("name", "is required")
 
         # Create tenant record in control database
         tenant = Tenant(slug=slug, name=name)
@@ -38,30 +103,178 @@ class TenantService:
     async def get_by_id(self, id: str) -> Tenant:
         """Retrieve a tenant by ID."""
         if not id:
-            raise ValueError("id is required")
+            raise ValidationError("id", "is required")
         return await self.repo.get_by_id(id)
 
+    async def get_by_slug(self, slug: str) -> Tuple[Tenant, bool]:
+        """
+        Retrieve a tenant by its slug, or else the tenant most recently renamed
+        from it. Returns the tenant and whether slug is a former slug of it.
+        """
+        if not slug:
+            raise ValidationError("slug", "is required")
+        try:
+            return await self.repo.get_by_slug(slug), False
+        except NotFoundError:
+            tenant = await self.repo.get_by_former_slug(slug)
+            if tenant is None:
+                raise
+            return tenant, True
+
+    async def rename_slug(self, id: str, slug: str) -> Tenant:
+        """Change a tenant's slug, recording the change, unless slugs are immutable."""
+        if not id:
+            raise ValidationError("id", "is required")
+        if not slug:
+            raise ValidationError("slug", "is required")
+        if self.slug_policy == SLUG_IMMUTABLE:
+            raise FailedPreconditionError("tenant slugs are immutable on this server")
+        return await self.repo.rename_slug(id, slug, current_actor())
+
+    async def list_slug_changes(self, id: str) -> List[TenantSlugChange]:
+        """Retrieve the slug changes of a tenant, oldest first."""
+        if not id:
+            raise ValidationError("id", "is required")
+        await self.repo.get_by_id(id)
+        return await self.repo.list_slug_changes(id)
+
     async def update(self, id: str, slug: str, name: str, status: str) -> Tenant:
-        """Update an existing tenant."""
+        """Update an existing tenant; its slug only changes if slugs are mutable."""
         if not id:
-            raise ValueError("id is required")
+            raise ValidationError("id", "is required")
 
         tenant = await self.repo.get_by_id(id)
+        if status and status != tenant.status:
+            raise ValidationError("status", "is changed with suspend_tenant, archive_tenant and reactivate_tenant")
 
-        if slug:
-            tenant.slug = slug
+        if slug and slug != tenant.slug:
+            if self.slug_policy == SLUG_IMMUTABLE:
+                raise FailedPreconditionError("tenant slugs are immutable on this server")
+            if self.slug_policy == SLUG_RENAME:
+                raise FailedPreconditionError("tenant slugs are changed with rename_tenant_slug")
+            tenant = await self.repo.rename_slug(id, slug, current_actor())
         if name:
             tenant.name = name
-        if status:
-            tenant.status = status
 
         return await self.repo.update(tenant)
 
-    async def delete(self, id: str) -> None:
-        """Delete a tenant."""
+    async def suspend(self, id: str, reason: str = "") -> Tenant:
+        """Suspend an active tenant: data-plane calls are rejected until it is reactivated."""
+        if not id:
+            raise ValidationError("id", "is required")
+        require_feature("tenant_lifecycle")
+        tenant = await self.repo.set_status(id, SUSPENDED, [ACTIVE], reason)
+        self._forget_status(id)
+        return tenant
+
+    async def archive(self, id: str, reason: str = "") -> Tenant:
+        """
+        Archive an active or suspended tenant: its database is snapshotted,
+        then made read-only.
+        """
+        if not id:
+            raise ValidationError("id", "is required")
+        require_feature("tenant_lifecycle")
+        tenant = await self.repo.get_by_id(id)
+        if tenant.status not in (ACTIVE, SUSPENDED):
+            raise FailedPreconditionError(f"tenant {id} is {tenant.status}, not {ACTIVE} or {SUSPENDED}")
+
+        snapshot = None
+        if self.tenant_db_manager:
+            suffix = datetime.now(timezone.utc).strftime("%Y%m%d%H%M%S")
+            snapshot = await self.tenant_db_manager.archive_tenant_database(id, suffix)
+        try:
+            tenant = await self.repo.set_status(id, ARCHIVED, [ACTIVE, SUSPENDED], reason, snapshot)
+        except Exception:
+            # Keep the tenant writable if its status didn't change; the snapshot stays
+            if self.tenant_db_manager:
+                await self.tenant_db_manager.set_tenant_read_only(id, False)
+            raise
+        self._forget_status(id)
+        return tenant
+
+    async def reactivate(self, id: str, reason: str = "") -> Tenant:
+        """Reactivate a suspended or archived tenant, making an archived tenant's database writable again."""
+        if not id:
+            raise ValidationError("id", "is required")
+        tenant = await self.repo.get_by_id(id)
+        if tenant.status == ARCHIVED and self.tenant_db_manager:
+            await self.tenant_db_manager.set_tenant_read_only(id, False)
+        tenant = await self.repo.set_status(id, ACTIVE, [SUSPENDED, ARCHIVED], reason)
+        self._forget_status(id)
+        return tenant
+
+    def _forget_status(self, id: str) -> None:
+        if self.tenant_db_manager:
+            self.tenant_db_manager.forget_tenant_status(id)
+
+    async def get_quota(self, id: str) -> TenantQuota:
+        """Retrieve a tenant's quota; limits it leaves unset are None."""
+        if not id:
+            raise ValidationError("id", "is required")
+        if not self.quota_repo:
+            raise FailedPreconditionError("tenant quotas are not available")
+        await self.repo.get_by_id(id)
+        return await self.quota_repo.get(id) or TenantQuota(tenant_id=id)
+
+    async def set_quota(
+        self,
+        id: str,
+        requests_per_second: Optional[float] = None,
+        burst: Optional[int] = None,
+        api_key_requests_per_second: Optional[float] = None,
+        api_key_burst: Optional[int] = None,
+    ) -> TenantQuota:
+        """Replace a tenant's quota; limits left unset (None) fall back to the server defaults."""
+        if not id:
+            raise ValidationError("id", "is required")
+        if not self.quota_repo:
+            raise FailedPreconditionError("tenant quotas are not available")
+        for name, value in (
+            ("requests_per_second", requests_per_second),
+            ("api_key_requests_per_second", api_key_requests_per_second),
+        ):
+            if value is not None and (isinstance(value, bool) or not isinstance(value, (int, float)) or value < 0):
+                raise ValidationError(name, "must be a non-negative number")
+        for name, value in (("burst", burst), ("api_key_burst", api_key_burst)):
+            if value is not None and (isinstance(value, bool) or not isinstance(value, int) or value < 1):
+                raise ValidationError(name, "must be a positive integer")
+
+        quota = await self.quota_repo.set(TenantQuota(
+            tenant_id=id,
+            requests_per_second=None if requests_per_second is None else float(requests_per_second),
+            burst=burst,
+            api_key_requests_per_second=(
+                None if api_key_requests_per_second is None else float(api_key_requests_per_second)
+            ),
+            api_key_burst=api_key_burst,
+        ))
+        forget_quota(id)
+        return quota
+
+    async def delete(self, id: str) -> Optional[TenantDeletion]:
+        """
+        Delete a tenant: make it deleting and queue its deletion, returned.
+        Deleting a tenant again resumes a failed deletion. Without a deletion
+        repository, the tenant is deleted at once and None is returned.
+        """
+        if not id:
+            raise ValidationError("id", "is required")
+        if not self.deletion_repo:
+            await self.repo.delete(id)
+            return None
+        require_feature("tenant_deletion")
+        deletion = await self.deletion_repo.start(id)
+        self._forget_status(id)
+        return deletion
+
+    async def deletion_status(self, id: str) -> TenantDeletion:
+        """Retrieve the deletion of a tenant, also once the tenant is gone."""
         if not id:
-            raise ValueError("id is required")
-        await self.repo.delete(id)
+            raise ValidationError("id", "is required")
+        if not self.deletion_repo:
+            raise FailedPreconditionError("tenant deletions are not available")
+        return await self.deletion_repo.get(id)
 
     async def list(self, page_size: int, page_token: str) -> Tuple[List[Tenant], ListResult]:
         """Retrieve tenants with pagination."""
@@ -0,0 +1,262 @@
+"""
+Tenant templates.
+
+A template is a reusable bundle of node types and relationship type
+definitions, read from a file <name>.json (or <name>.yaml, with PyYAML) in
+the TENANT_TEMPLATES_DIR directory when the server starts. Node types use the
+format of flexyctl node type files, with schema and display as objects:
+
+    description: CRM starter
+    node_types:
+      - name: Company
+        schema:
+          name: {type: string, required: true}
+        unique_keys: [name]
+      - name: Person
+        schema: {name: string, email: string}
+    relationship_types:
+      - name: works_at
+        source: Person
+        target: Company
+        description: Employment
+
+Bootstrapping a tenant with a template creates the template's node types
+that the tenant doesn't have yet, by name; node types it already has are left
+unchanged, so bootstrapping again is safe, and completes a bootstrap that
+failed partway. Relationship types aren't enforced on relationships: they
+document the relationships the node types are meant to have, and are
+returned with the IDs of their source and target node types.
+"""
+
+import json
+import logging
+import os
+from dataclasses import dataclass, field
+from typing import Any, Dict, List, Optional, Tuple
+
+from app.repository import NodeType, NotFoundError, ValidationError
+from app.service.display import validate_display
+from app.service.nodetype_service import NodeTypeService
+from app.service.schema import normalize_unique_keys, validate_schema
+
+logger = logging.getLogger(__name__)
+
+_TEMPLATE_FIELDS = ("description", "node_types", "relationship_types")
+_NODE_TYPE_FIELDS = ("name", "description", "schema", "display", "unique_keys")
+_RELATIONSHIP_TYPE_FIELDS = ("name", "source", "target", "description")
+
+
+@dataclass
+class TemplateNodeType:
+    """A node type of a template, with schema and display as JSON text."""
+    name: str
+    description: str = ""
+    schema: str = "{}"
+    display: str = ""
+    unique_keys: List[Any] = field(default_factory=list)
+
+    def to_dict(self) -> Dict[str, Any]:
+        return {
+            "name": self.name,
+            "description": self.description,
+            "schema": self.schema,
+            "display": self.display or "{}",
+            "unique_keys": self.unique_keys,
+        }
+
+
+@dataclass
+class TemplateRelationshipType:
+    """A relationship type of a template, between two of its node types."""
+    name: str
+    source: str
+    target: str
+    description: str = ""
+
+    def to_dict(self) -> Dict[str, Any]:
+        return {
+            "name": self.name,
+            "source": self.source,
+            "target": self.target,
+            "description": self.description,
+        }
+
+
+@dataclass
+class TenantTemplate:
+    """A named bundle of node types and relationship types."""
+    name: str
+    description: str = ""
+    node_types: List[TemplateNodeType] = field(default_factory=list)
+    relationship_types: List[TemplateRelationshipType] = field(default_factory=list)
+
+    def to_dict(self) -> Dict[str, Any]:
+        return {
+            "name": self.name,
+            "description": self.description,
+            "node_types": [t.to_dict() for t in self.node_types],
+            "relationship_types": [t.to_dict() for t in self.relationship_types],
+        }
+
+
+def parse_template(name: str, doc: Any) -> TenantTemplate:
+    """Validate a parsed template file, so invalid node types fail at startup rather than at bootstrap."""
+    if not isinstance(doc, dict):
+        raise ValueError(f"template {name} must be an object")
+    _check_fields(f"template {name}", doc, _TEMPLATE_FIELDS)
+    template = TenantTemplate(name=name, description=_text(doc, "description", f"template {name}"))
+
+    items = doc.get("node_types") or []
+    if not isinstance(items, list) or not items:
+        raise ValueError(f"template {name} must have a node_types list")
+    for i, item in enumerate(items):
+        where = f"template {name} node_types[{i}]"
+        if not isinstance(item, dict) or not isinstance(item.get("name"), str) or not item["name"]:
+            raise ValidationError(where, "must be an object with a name")
+        _check_fields(where, item, _NODE_TYPE_FIELDS)
+        node_type = TemplateNodeType(
+            name=item["name"],
+            description=_text(item, "description", where),
+            schema=_json_text(item.get("schema")) or "{}",
+            display=_json_text(item.get("display")),
+            unique_keys=item.get("unique_keys") or [],
+        )
+        try:
+            validate_schema(node_type.schema)
+            validate_display(node_type.display, node_type.schema)
+            normalize_unique_keys(node_type.unique_keys, node_type.schema)
+        except ValueError as e:
+            raise ValueError(f"{where}: {e}") from None
+        if any(t.name == node_type.name for t in template.node_types):
+            raise ValueError(f"{where} is a duplicate node type: {node_type.name}")
+        template.node_types.append(node_type)
+
+    names = {t.name for t in template.node_types}
+    items = doc.get("relationship_types") or []
+    if not isinstance(items, list):
+        raise ValueError(f"template {name} relationship_types must be a list")
+    for i, item in enumerate(items):
+        where = f"template {name} relationship_types[{i}]"
+        if not isinstance(item, dict) or not isinstance(item.get("name"), str) or not item["name"]:
+            raise ValidationError(where, "must be an object with a name")
+        _check_fields(where, item, _RELATIONSHIP_TYPE_FIELDS)
+        for end in ("source", "target"):
+            if item.get(end) not in names:
+                raise ValueError(f"{where} {end} must be a node type of the template")
+        template.relationship_types.append(TemplateRelationshipType(
+            name=item["name"],
+            source=item["source"],
+            target=item["target"],
+            description=_text(item, "description", where),
+        ))
+
+    return template
+
+
+def load_tenant_templates(directory: str) -> Dict[str, TenantTemplate]:
+    """Load the templates of a directory, named after their files; an empty directory setting loads none."""
+    if not directory:
+        return {}
+
+    templates: Dict[str, TenantTemplate] = {}
+    for filename in sorted(os.listdir(directory)):
+        name, ext = os.path.splitext(filename)
+        if ext not in (".json", ".yaml", ".yml"):
+            continue
+        if name in templates:
+            raise ValueError(f"template {name} is defined by more than one file")
+        with open(os.path.join(directory, filename), encoding="utf-8") as f:
+            text = f.read()
+        if ext == ".json":
+            try:
+                doc = json.loads(text)
+            except ValueError as e:
+                raise ValueError(f"invalid JSON in {filename}: {e}") from None
+        else:
+            try:
+                import yaml
+            except ImportError:
+                raise ValueError(f"YAML template {filename} needs PyYAML (pip install pyyaml)") from None
+            try:
+                doc = yaml.safe_load(text)
+            except yaml.YAMLError as e:
+                raise ValueError(f"invalid YAML in {filename}: {e}") from None
+        templates[name] = parse_template(name, doc)
+
+    logger.info(f"Loaded {len(templates)} tenant templates from {directory}")
+    return templates
+
+
+class TenantTemplateService:
+    """Tenant template business logic service."""
+
+    def __init__(self, templates: Optional[Dict[str, TenantTemplate]] = None):
+        self.templates = templates or {}
+
+    def list(self) -> List[TenantTemplate]:
+        """Retrieve the templates, by name."""
+        return [self.templates[name] for name in sorted(self.templates)]
+
+    def get(self, name: str) -> TenantTemplate:
+        """Retrieve a template by name."""
+        if not name:
+            raise ValidationError("template", "is required")
+        template = self.templates.get(name)
+        if template is None:
+            raise NotFoundError(f"tenant template not found: {name}")
+        return template
+
+    async def bootstrap(
+        self, name: str, node_type_service: NodeTypeService
+    ) -> Tuple[List[NodeType], List[NodeType], List[Dict[str, Any]]]:
+        """
+        Apply a template to a tenant, through its node type service. Returns
+        the node types created, the template's node types the tenant already
+        had, and the template's relationship types with the IDs of their
+        source and target node types.
+        """
+        template = self.get(name)
+        existing = {node_type.name: node_type for node_type in await node_type_service.describe()}
+
+        created: List[NodeType] = []
+        kept: List[NodeType] = []
+        for node_type in template.node_types:
+            if node_type.name in existing:
+                kept.append(existing[node_type.name])
+                continue
+            new = await node_type_service.create(
+                node_type.name, node_type.description, node_type.schema,
+                node_type.display, node_type.unique_keys
+            )
+            existing[new.name] = new
+            created.append(new)
+
+        relationship_types = [
+            {
+                **relationship_type.to_dict(),
+                "source_node_type_id": existing[relationship_type.source].id,
+                "target_node_type_id": existing[relationship_type.target].id,
+            }
+            for relationship_type in template.relationship_types
+        ]
+        return created, kept, relationship_types
+
+
+def _check_fields(where: str, item: Dict[str, Any], allowed: Tuple[str, ...]) -> None:
+    unknown = set(item) - set(allowed)
+    if unknown:
+        raise ValueError(f"{where} has unknown fields: {', '.join(sorted(unknown))}")
+
+
+def _text(item: Dict[str, Any], key: str, where: str) -> str:
+    value = item.get(key) or ""
+    if not isinstance(value, str):
+        raise ValueError(f"{where} {key} must be a string")
+    return value
+
+
+def _json_text(value: Any) -> str:
+    """Schema and display are objects in template files, or JSON text."""
+    if value is None or value == "":
+        return ""
+    return value if isinstance(value, str) else json.dumps(value)
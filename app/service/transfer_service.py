@@ -0,0 +1,544 @@
+"""
+Tenant data export/import service implementation.
+
+Exports are newline-delimited JSON: a header line followed by one line per
+node type, node and relationship, in that order:
+
+    {"type": "header", "format": "flexdb.tenant", "version": 1, "change_token": "...", ...}
+    {"type": "node_type", "node_type": {...}}
+    {"type": "node", "node": {...}}
+    {"type": "relationship", "relationship": {...}}
+
+Imports read the same format. Every record gets a new ID and references are
+remapped, so an export can be imported into any tenant, including the one it
+came from. Node types whose name already exists in the target tenant are
+mapped onto the existing node type instead of being created.
+
+An export is read from one snapshot, whose change feed position the header
+records: list_changes from its change_token lists every change the export
+doesn't have, and none it has, so a replica bootstrapped from the export and
+then fed the changes misses nothing.
+
+An import given a key, kept with its job, derives the new IDs from the key
+and the exported IDs, and checkpoints after every batch the lines it committed and
+their SHA-256. Resumed with the same key and the same upload, it reads the
+committed lines again to restore the ID mappings, checks their checksum and
+continues after them; the records of a batch committed after the last
+checkpoint already exist under their IDs and are skipped, so nothing is
+imported twice.
+
+Imported nodes having the values of an existing node for a unique key of
+their node type (see app/repository/unique_keys.py), such as an external ID
+a sync source keys its records by, are handled as the import's on_conflict
+says: fail, the default, ends the import naming the line; skip keeps the
+existing node; overwrite replaces its data with the imported data; and
+merge_patch applies the imported data to it as a JSON merge patch (RFC 7396).
+References to a skipped, overwritten or merged node point at the existing
+node. Nodes repeating the key of an earlier node of the same batch are
+handled likewise. With report, each batch's progress lists the outcome of
+each of its records.
+"""
+
+import hashlib
+import json
+from dataclasses import replace
+from datetime import datetime
+from typing import Any, AsyncIterable, AsyncIterator, Dict, List, Optional, Tuple
+
+from app.repository import (
+    AlreadyExistsError,
+    ChangeFeedPosition,
+    FailedPreconditionError,
+    ExportPosition,
+    ImportProgress,
+    ImportRow,
+    NodeType,
+    Node,
+    NodeTypeRepository,
+    Relationship,
+    TransferRepository,
+    ValidationError,
+)
+from app.repository.ids import derived_id, new_id
+from app.repository.unique_keys import unique_key_values
+from app.service.bi_views import BiViewService
+from app.service.display import validate_display
+from app.service.schema import SchemaValidator, normalize_unique_keys, validate_schema
+
+EXPORT_FORMAT = "flexdb.tenant"
+EXPORT_FORMAT_VERSION = 1
+
+DEFAULT_TRANSFER_BATCH_SIZE = 500
+MAX_TRANSFER_BATCH_SIZE = 5000
+
+# Seconds a running import goes without committing a batch before it can be
+# resumed, as the server running it presumably went away
+IMPORT_STALE_SECONDS = 900.0
+
+# How an import handles nodes matching an existing node by a unique key
+ON_CONFLICT_FAIL = "fail"
+ON_CONFLICT_SKIP = "skip"
+ON_CONFLICT_OVERWRITE = "overwrite"
+ON_CONFLICT_MERGE_PATCH = "merge_patch"
+ON_CONFLICT_STRATEGIES = (ON_CONFLICT_FAIL, ON_CONFLICT_SKIP, ON_CONFLICT_OVERWRITE, ON_CONFLICT_MERGE_PATCH)
+
+
+def _validate_batch_size(batch_size: int) -> None:
+    if not 1 <= batch_size <= MAX_TRANSFER_BATCH_SIZE:
+        raise ValidationError("batch_size", f"must be between 1 and {MAX_TRANSFER_BATCH_SIZE}")
+
+
+class TransferService:
+    """Tenant data export and import business logic service."""
+
+    def __init__(
+        self,
+        repo: TransferRepository,
+        node_type_repo: NodeTypeRepository,
+        bi_views: Optional[BiViewService] = None
+    ):
+        self.repo = repo
+        self.node_type_repo = node_type_repo
+        self.bi_views = bi_views
+
+    def export(
+        self,
+        tenant_id: str,
+        batch_size: int = DEFAULT_TRANSFER_BATCH_SIZE,
+        after: Optional[ExportPosition] = None
+    ) -> AsyncIterator[Dict[str, Any]]:
+        """
+        Stream the tenant's node types, nodes and relationships as export
+        records; with after, only the records after that position, following
+        the header.
+        """
+        _validate_batch_size(batch_size)
+        return self._export(tenant_id, batch_size, after)
+
+    async def _export(
+        self, tenant_id: str, batch_size: int, after: Optional[ExportPosition]
+    ) -> AsyncIterator[Dict[str, Any]]:
+        async for record in self.repo.stream_export(batch_size, after):
+            if isinstance(record, ChangeFeedPosition):
+                yield {
+                    "type": "header",
+                    "format": EXPORT_FORMAT,
+                    "version": EXPORT_FORMAT_VERSION,
+                    "tenant_id": tenant_id,
+                    "exported_at": datetime.now().isoformat(),
+                    "change_token": record.token,
+                    "lsn": record.lsn,
+                    "snapshot": record.snapshot,
+                }
+                continue
+            if isinstance(record, NodeType):
+                record_type = "node_type"
+            elif isinstance(record, Node):
+                record_type = "node"
+            else:
+                record_type = "relationship"
+            yield {"type": record_type, record_type: record.to_dict()}
+
+    def import_lines(
+        self,
+        lines: AsyncIterable[str],
+        batch_size: int = DEFAULT_TRANSFER_BATCH_SIZE,
+        dry_run: bool = False,
+        key: str = "",
+        resume: Optional[ImportProgress] = None,
+        on_conflict: str = ON_CONFLICT_FAIL,
+        report: bool = False
+    ) -> AsyncIterator[ImportProgress]:
+        """
+        Import export records, committing every batch_size records in one transaction.
+
+        Yields the progress after each committed batch. An invalid record raises
+        ValidationError naming its line; batches committed before it are kept. A dry
+        run validates every record and counts what it would create, without
+        writing; nodes are checked against the unique keys of existing nodes,
+        but not of those of earlier batches of the upload.
+
+        key derives the IDs of the imported records, which are random without
+        one. resume, the last progress of an import with the same key,
+        continues that import after the lines it committed; it must be given
+        the same on_conflict, and raises FailedPreconditionError if the upload
+        doesn't start with those lines. on_conflict handles nodes matching an existing
+        node by a unique key: fail raises AlreadyExistsError. With report,
+        each progress lists the outcomes of the batch's records in rows.
+        """
+        _validate_batch_size(batch_size)
+        if on_conflict not in ON_CONFLICT_STRATEGIES:
+            raise ValidationError("on_conflict", f"must be one of {', '.join(ON_CONFLICT_STRATEGIES)}")
+        if resume and not key:
+            raise ValidationError("key", "is required to resume an import")
+        if resume and dry_run:
+            raise ValidationError("dry_run", "can't be combined with resume")
+        state = _Import(self.repo, self.node_type_repo, batch_size, dry_run, key, resume, on_conflict, report)
+        return self._import(state, lines)
+
+    async def _import(self, state: "_Import", lines: AsyncIterable[str]) -> AsyncIterator[ImportProgress]:
+        try:
+            async for progress in state.run(lines):
+                yield progress
+        finally:
+            # Imported node types need BI views, also if a later line failed
+            if self.bi_views and state.progress.node_types_created and not state.dry_run:
+                await self.bi_views.sync()
+
+
+class _Import:
+    """State of one import: ID mappings and the batch being built."""
+
+    def __init__(
+        self,
+        repo: TransferRepository,
+        node_type_repo: NodeTypeRepository,
+        batch_size: int,
+        dry_run: bool = False,
+        key: str = "",
+        resume: Optional[ImportProgress] = None,
+        on_conflict: str = ON_CONFLICT_FAIL,
+        report: bool = False
+    ):
+        self.repo = repo
+        self.node_type_repo = node_type_repo
+        self.batch_size = batch_size
+        self.dry_run = dry_run
+        self.key = key
+        self.on_conflict = on_conflict
+        self.report = report
+        # The lines and bytes are counted again as they are read
+        self.progress = replace(resume, lines=0, bytes=0) if resume else ImportProgress()
+        self.resume = resume
+        self.digest = hashlib.sha256()
+        # Old ID -> new ID
+        self.node_type_ids: Dict[str, str] = {}
+        self.node_ids: Dict[str, str] = {}
+        # New node type ID -> validator of its schema and the schema's version, for validating node data
+        self.validators: Dict[str, SchemaValidator] = {}
+        self.schema_versions: Dict[str, int] = {}
+        # New node type ID -> its unique keys, for node types having any
+        self.unique_keys: Dict[str, List[List[str]]] = {}
+        self.existing: Dict[str, NodeType] = {}
+        self.imported_names: set = set()
+        self.node_types: List[NodeType] = []
+        self.nodes: List[Node] = []
+        self.relationships: List[Relationship] = []
+        # New ID -> line and old ID of the batch's nodes
+        self.node_lines: Dict[str, Tuple[int, str]] = {}
+        self.rows: List[ImportRow] = []
+        # Old ID and node of the committed lines read again by a resumed
+        # import, whose references may have to point at an existing node
+        self.replay: List[Tuple[str, Node]] = []
+
+    async def run(self, lines: AsyncIterable[str]) -> AsyncIterator[ImportProgress]:
+        self.existing = {t.name: t for t in await self.node_type_repo.list_all()}
+
+        committed = self.resume.lines if self.resume else 0
+        async for line in lines:
+            data = line.encode("utf-8") + b"\n"
+            self.progress.lines += 1
+            self.progress.bytes += len(data)
+            self.digest.update(data)
+            if self.progress.lines == committed and self.digest.hexdigest() != self.resume.checksum:
+                raise FailedPreconditionError(f"lines 1-{committed} differ from those of the import being resumed")
+            if not line.strip():
+                continue
+            try:
+                if self.progress.lines <= committed:
+                    self._skip(json.loads(line))
+                else:
+                    if self.replay:
+                        await self._replay()
+                    self._add(json.loads(line))
+            except (ValueError, KeyError, TypeError) as e:
+                message = f"missing field {e}" if isinstance(e, KeyError) else str(e)
+                raise ValidationError(f"line {self.progress.lines}", f"is invalid: {message}") from e
+            if len(self.replay) >= self.batch_size:
+                await self._replay()
+
+            if len(self.node_types) + len(self.nodes) + len(self.relationships) >= self.batch_size:
+                await self._flush()
+                yield self.progress
+
+        if self.node_types or self.nodes or self.relationships:
+            await self._flush()
+            yield self.progress
+        if self.progress.lines < committed:
+            raise FailedPreconditionError(
+                f"the upload ends at line {self.progress.lines}, before line {committed}, "
+                "where the import being resumed stopped"
+            )
+
+    def _add(self, record: Any) -> None:
+        if not isinstance(record, dict):
+            raise ValidationError("record", "must be a JSON object")
+
+        record_type = record.get("type")
+        if record_type == "header":
+            if record.get("format") != EXPORT_FORMAT:
+                raise ValidationError("format", f"must be {EXPORT_FORMAT}")
+            if not isinstance(record.get("version"), int) or record["version"] > EXPORT_FORMAT_VERSION:
+                raise ValidationError("version", f"is not supported: {record.get('version')}")
+        elif record_type == "node_type":
+            self._add_node_type(record["node_type"])
+        elif record_type == "node":
+            self._add_node(record["node"])
+        elif record_type == "relationship":
+            self._add_relationship(record["relationship"])
+        else:
+            raise ValidationError("type", f"is not a known record type: {record_type}")
+
+    def _skip(self, record: Any) -> None:
+        """Map the IDs of a record the import being resumed committed."""
+        if record.get("type") == "node_type":
+            data = record["node_type"]
+            node_type = self.existing.get(data["name"])
+            if not node_type:
+                raise FailedPreconditionError(f"node type {data['name']} of the import being resumed no longer exists")
+            self.imported_names.add(node_type.name)
+            self._map_node_type(data["id"], node_type)
+        elif record.get("type") == "node":
+            data = record["node"]
+            node_id = self._id("node", data["id"])
+            self.node_ids[data["id"]] = node_id
+            node_type_id = self.node_type_ids.get(data["node_type_id"], "")
+            if self.on_conflict != ON_CONFLICT_FAIL and node_type_id in self.unique_keys:
+                # It may have matched an existing node
+                prepared = self.validators[node_type_id].prepare(_json_text(data.get("data")))
+                self.replay.append((data["id"], Node(id=node_id, node_type_id=node_type_id, data=prepared)))
+
+    async def _replay(self) -> None:
+        """Map the nodes read again that matched an existing node onto it."""
+        nodes = [node for _, node in self.replay]
+        matches = await self.repo.find_by_unique_keys(nodes, self._unique_keys_of(nodes))
+        for old_id, node in self.replay:
+            if node.id in matches:
+                self.node_ids[old_id] = matches[node.id].id
+        self.replay = []
+
+    def _map_node_type(self, old_id: str, node_type: NodeType) -> None:
+        self.node_type_ids[old_id] = node_type.id
+        self.validators[node_type.id] = SchemaValidator(node_type.schema)
+        self.schema_versions[node_type.id] = node_type.schema_version
+        if node_type.unique_keys:
+            self.unique_keys[node_type.id] = node_type.unique_keys
+
+    def _report(self, record_type: str, id: str, outcome: str = "created") -> None:
+        if self.report:
+            self.rows.append(ImportRow(self.progress.lines, record_type, id, outcome))
+
+    def _id(self, record_type: str, old_id: Optional[str]) -> str:
+        return derived_id(self.key, f"{record_type}/{old_id}") if self.key and old_id else new_id()
+
+    def _add_node_type(self, data: Dict[str, Any]) -> None:
+        old_id, name = data["id"], data["name"]
+        if not name:
+            raise ValidationError("name", "is required")
+        if old_id in self.node_type_ids:
+            raise ValidationError("id", f"duplicates an earlier node type: {old_id}")
+        if name in self.imported_names:
+            raise ValidationError("name", f"duplicates an earlier node type: {name}")
+        self.imported_names.add(name)
+
+        existing = self.existing.get(name)
+        if existing:
+            self._map_node_type(old_id, existing)
+            self.progress.node_types_matched += 1
+            self._report("node_type", existing.id, "matched")
+            return
+
+        schema = data.get("schema") or ""
+        display = data.get("display") or "{}"
+        validate_schema(schema)
+        validate_display(display, schema)
+
+        node_type = NodeType(
+            id=self._id("node_type", old_id),
+            name=name,
+            description=data.get("description") or "",
+            schema=schema,
+            display=display,
+            unique_keys=normalize_unique_keys(data.get("unique_keys"), schema),
+            created_at=_timestamp(data.get("created_at")),
+            updated_at=_timestamp(data.get("updated_at")),
+        )
+        self._map_node_type(old_id, node_type)
+        self.node_types.append(node_type)
+        self._report("node_type", node_type.id)
+
+    def _add_node(self, data: Dict[str, Any]) -> None:
+        old_id = data["id"]
+        if old_id in self.node_ids:
+            raise ValidationError("id", f"duplicates an earlier node: {old_id}")
+        node_type_id = self.node_type_ids.get(data["node_type_id"])
+        if not node_type_id:
+            raise ValidationError("node_type_id", f"references an unknown node type: {data['node_type_id']}")
+
+        node = Node(
+            id=self._id("node", old_id),
+            node_type_id=node_type_id,
+            data=self.validators[node_type_id].prepare(_json_text(data.get("data"))),
+            schema_version=self.schema_versions[node_type_id],
+            created_at=_timestamp(data.get("created_at")),
+            updated_at=_timestamp(data.get("updated_at")),
+        )
+        self.node_ids[old_id] = node.id
+        self.node_lines[node.id] = (self.progress.lines, old_id)
+        self.nodes.append(node)
+        self._report("node", node.id)
+
+    def _add_relationship(self, data: Dict[str, Any]) -> None:
+        source = self.node_ids.get(data["source_node_id"])
+        target = self.node_ids.get(data["target_node_id"])
+        if not source:
+            raise ValidationError("source_node_id", f"references an unknown node: {data['source_node_id']}")
+        if not target:
+            raise ValidationError("target_node_id", f"references an unknown node: {data['target_node_id']}")
+        if not data["relationship_type"]:
+            raise ValidationError("relationship_type", "is required")
+
+        rel_data = _json_text(data.get("data"))
+        json.loads(rel_data)
+
+        relationship = Relationship(
+            id=self._id("relationship", data.get("id")),
+            source_node_id=source,
+            target_node_id=target,
+            relationship_type=data["relationship_type"],
+            data=rel_data,
+            created_at=_timestamp(data.get("created_at")),
+            updated_at=_timestamp(data.get("updated_at")),
+        )
+        self.relationships.append(relationship)
+        self._report("relationship", relationship.id)
+
+    async def _flush(self) -> None:
+        updated_nodes = await self._resolve()
+        if not self.dry_run:
+            self.progress.records_skipped += await self.repo.import_batch(
+                self.node_types,
+                self.nodes,
+                self.relationships,
+                skip_existing=self.resume is not None,
+                updated_nodes=updated_nodes,
+            )
+        self.progress.batches += 1
+        self.progress.node_types_created += len(self.node_types)
+        self.progress.nodes_created += len(self.nodes)
+        self.progress.relationships_created += len(self.relationships)
+        self.progress.checksum = self.digest.hexdigest()
+        self.progress.rows = self.rows
+        self.node_types, self.nodes, self.relationships = [], [], []
+        self.node_lines, self.rows = {}, []
+
+    async def _resolve(self) -> List[Node]:
+        """
+        Handle the batch's nodes having the values of an existing or earlier
+        node for a unique key as on_conflict says, leaving the nodes to create
+        in self.nodes; returns the existing nodes to update.
+        """
+        keyed = [node for node in self.nodes if node.node_type_id in self.unique_keys]
+        if not keyed:
+            return []
+        existing = await self.repo.find_by_unique_keys(keyed, self._unique_keys_of(keyed))
+
+        # Node type ID, unique key and values -> the node taking them
+        taken: Dict[Tuple[str, int, str], Node] = {}
+        created: List[Node] = []
+        updated: Dict[str, Node] = {}
+        # New ID -> the ID of the node it matched, and what was done with it
+        targets: Dict[str, str] = {}
+        outcomes: Dict[str, str] = {}
+        for node in self.nodes:
+            keys = self._keys(node)
+            target = next((taken[key] for key in keys if key in taken), None)
+            match = existing.get(node.id)
+            # Unless it is the node itself, imported by a batch committed after the last checkpoint
+            if not target and match and match.id != node.id:
+                target = updated.get(match.id, match)
+            if not target:
+                created.append(node)
+                taken.update((key, node) for key in keys)
+                continue
+
+            line, old_id = self.node_lines[node.id]
+            if self.on_conflict == ON_CONFLICT_FAIL:
+                index = next((key[1] for key in keys if key in self._keys(target)), keys[0][1])
+                fields = ", ".join(self.unique_keys[node.node_type_id][index])
+                raise AlreadyExistsError(
+                    f"line {line}: node with the same {fields} already exists in node_type {node.node_type_id}"
+                )
+            if self.on_conflict == ON_CONFLICT_SKIP:
+                outcome = "skipped"
+                self.progress.nodes_skipped += 1
+            else:
+                if self.on_conflict == ON_CONFLICT_OVERWRITE:
+                    outcome, target.data = "overwritten", node.data
+                    self.progress.nodes_overwritten += 1
+                else:
+                    merged = _merge_patch(json.loads(target.data or "{}"), json.loads(node.data or "{}"))
+                    try:
+                        data = self.validators[node.node_type_id].prepare(json.dumps(merged))
+                    except ValueError as e:
+                        raise ValidationError(f"line {line}", f"is invalid: {e}") from e
+                    outcome, target.data = "merged", data
+                    self.progress.nodes_merged += 1
+                if target.id not in self.node_lines:
+                    target.schema_version = node.schema_version
+                    target.updated_at = datetime.now()
+                    updated[target.id] = target
+            taken.update((key, target) for key in keys if key not in taken)
+            self.node_ids[old_id] = targets[node.id] = target.id
+            outcomes[node.id] = outcome
+
+        for relationship in self.relationships:
+            relationship.source_node_id = targets.get(relationship.source_node_id, relationship.source_node_id)
+            relationship.target_node_id = targets.get(relationship.target_node_id, relationship.target_node_id)
+        for row in self.rows:
+            if row.record_type == "node" and row.id in targets:
+                row.id, row.outcome = targets[row.id], outcomes[row.id]
+        self.nodes = created
+        return list(updated.values())
+
+    def _unique_keys_of(self, nodes: List[Node]) -> Dict[str, List[List[str]]]:
+        return {node.node_type_id: self.unique_keys[node.node_type_id] for node in nodes}
+
+    def _keys(self, node: Node) -> List[Tuple[str, int, str]]:
+        """Return the node type ID, unique key and values of each unique key the node has values for."""
+        doc = json.loads(node.data or "{}")
+        keys = []
+        for i, fields in enumerate(self.unique_keys.get(node.node_type_id, [])):
+            values = unique_key_values(doc, fields)
+            if values is not None:
+                keys.append((node.node_type_id, i, json.dumps(values, sort_keys=True)))
+        return keys
+
+
+def _merge_patch(target: Any, patch: Any) -> Any:
+    """Apply a JSON merge patch (RFC 7396): objects merge, null removes a field, anything else replaces."""
+    if not isinstance(patch, dict):
+        return patch
+    merged = dict(target) if isinstance(target, dict) else {}
+    for name, value in patch.items():
+        if value is None:
+            merged.pop(name, None)
+        else:
+            merged[name] = _merge_patch(merged.get(name), value)
+    return merged
+
+
+def _json_text(value: Any) -> str:
+    """Entity data is exported as a JSON string; also accept it as an object."""
+    if value is None or value == "":
+        return "{}"
+    if isinstance(value, str):
+        return value
+    return json.dumps(value)
+
+
+def _timestamp(value: Optional[str]) -> datetime:
+    """Keep exported timestamps; records without one get the current time."""
+    if not value:
+        return datetime.now()
+    return datetime.fromisoformat(value)
@@ -0,0 +1,157 @@
+"""
+Declarative transformations of node data, used to migrate nodes to a new
+NodeType schema version.
+
+A transform is a JSON array of operations applied in order to the top-level
+fields of a node's data:
+
+    {"op": "rename", "from": "title", "to": "name"}
+    {"op": "copy", "from": "name", "to": "label"}
+    {"op": "remove", "field": "legacy"}
+    {"op": "set", "field": "status", "value": "active"}
+    {"op": "default", "field": "priority", "value": 3}
+    {"op": "convert", "field": "count", "to": "integer"}
+
+"default" only sets fields that are missing or null. "convert" changes a
+value's JSON type to string, number, integer or boolean and fails for values
+that cannot be converted, e.g. "abc" to number; missing and null values are
+left alone. Operations on missing fields are no-ops.
+"""
+
+import json
+import math
+import re
+from dataclasses import dataclass
+from typing import Any, Dict, List
+
+from app.repository.errors import ValidationError
+
+CONVERT_TYPES = ("string", "number", "integer", "boolean")
+
+# Required keys of each operation
+_OPS = {
+    "rename": ("from", "to"),
+    "copy": ("from", "to"),
+    "remove": ("field",),
+    "set": ("field", "value"),
+    "default": ("field", "value"),
+    "convert": ("field", "to"),
+}
+
+_INTEGER_STRING = re.compile(r"^[+-]?[0-9]+$")
+
+
+@dataclass
+class Operation:
+    """A single transform operation."""
+    op: str = ""
+    field: str = ""  # target field; "to" for rename and copy
+    source: str = ""  # rename and copy only
+    value: Any = None  # set and default only
+    type: str = ""  # convert only
+
+
+def parse_transform(transform: str) -> List[Operation]:
+    """Parse and validate a transform; an empty string is the empty transform."""
+    if not transform:
+        return []
+
+    try:
+        doc = json.loads(transform)
+    except json.JSONDecodeError as e:
+        raise ValidationError("transform", f"must be valid JSON: {e}") from e
+    if not isinstance(doc, list):
+        raise ValidationError("transform", "must be a JSON array of operations")
+
+    ops = []
+    for i, item in enumerate(doc):
+        if not isinstance(item, dict):
+            raise ValueError(f"transform[{i}] must be an object")
+        op = item.get("op")
+        if op not in _OPS:
+            raise ValueError(f"transform[{i}].op must be one of {', '.join(_OPS)}")
+        for key in _OPS[op]:
+            if key not in item:
+                raise ValueError(f"transform[{i}].{key} is required")
+        field_keys = ("field",) if op == "convert" else ("from", "to", "field")
+        for key in field_keys:
+            if key in item and (not isinstance(item[key], str) or not item[key]):
+                raise ValueError(f"transform[{i}].{key} must be a field name")
+
+        if op in ("rename", "copy"):
+            ops.append(Operation(op=op, field=item["to"], source=item["from"]))
+        elif op == "convert":
+            if item["to"] not in CONVERT_TYPES:
+                raise ValueError(f"transform[{i}].to must be one of {', '.join(CONVERT_TYPES)}")
+            ops.append(Operation(op=op, field=item["field"], type=item["to"]))
+        else:
+            ops.append(Operation(op=op, field=item["field"], value=item.get("value")))
+    return ops
+
+
+def apply_transform(ops: List[Operation], data: Dict[str, Any]) -> Dict[str, Any]:
+    """Apply operations to node data, returning new data; raises ValueError if a conversion fails."""
+    result = dict(data)
+    for op in ops:
+        if op.op == "rename":
+            if op.source in result:
+                result[op.field] = result.pop(op.source)
+        elif op.op == "copy":
+            if op.source in result:
+                result[op.field] = _clone(result[op.source])
+        elif op.op == "remove":
+            result.pop(op.field, None)
+        elif op.op == "set":
+            result[op.field] = _clone(op.value)
+        elif op.op == "default":
+            if result.get(op.field) is None:
+                result[op.field] = _clone(op.value)
+        elif op.op == "convert":
+            if result.get(op.field) is not None:
+                try:
+                    result[op.field] = _convert(result[op.field], op.type)
+                except ValueError:
+                    raise ValueError(f"data.{op.field} cannot be converted to {op.type}") from None
+    return result
+
+
+def _clone(value: Any) -> Any:
+    # Values from the transform are shared by every node
+    return json.loads(json.dumps(value))
+
+
+def _convert(value: Any, to: str) -> Any:
+    if to == "string":
+        if isinstance(value, str):
+            return value
+        return json.dumps(value)
+
+    if to == "boolean":
+        if isinstance(value, bool):
+            return value
+        if isinstance(value, str) and value.lower() in ("true", "false"):
+            return value.lower() == "true"
+        if isinstance(value, (int, float)) and value in (0, 1):
+            return value == 1
+        raise ValueError(to)
+
+    if isinstance(value, bool):
+        raise ValueError(to)
+    if isinstance(value, str):
+        value = value.strip()
+        if to == "integer" and _INTEGER_STRING.match(value):
+            return int(value)
+        try:
+            value = float(value)
+        except ValueError:
+            raise ValueError(to) from None
+    if not isinstance(value, (int, float)) or (isinstance(value, float) and not math.isfinite(value)):
+        raise ValueError(to)
+
+    if to == "integer":
+        if isinstance(value, float):
+            if not value.is_integer():
+                raise ValueError(to)
+            return int(value)
+        return value
+    return value
@@ -1,24 +1,53 @@
 """
 User service implementation.
+
+Users with a password log in with their email address and password and get
+a signed token (see app/auth/tokens.py) listing their active tenant
+memberships, which authenticates their requests like an API key. Failed
+logins are counted per email address and lock it out like failed API key
+authentications (AUTH_LOCKOUT_*); unknown addresses and wrong passwords fail
+alike. Passwords are hashed and verified in worker threads, as argon2id
+takes tens of milliseconds that would hold up the event loop.
 """
 
-from typing import List, Tuple
+import asyncio
+import math
+from typing import List, Optional, Tuple
+
+from app.auth import PermissionDeniedError
+from app.auth.passwords import hash_password, needs_rehash, validate_password, verify_password
+from app.auth.tokens import TokenSigner
+from app.config import AuthConfig
+from app.repository import (
+    FailedPreconditionError, NotFoundError, User, TenantUser, UserRepository, ListOptions, ListResult, ValidationError
+)
+from app.service.auth_guard import Lockouts
 
-from app.repository import User, TenantUser, UserRepository, ListOptions, ListResult
+LOGIN_FAILED = "invalid email or password"
 
 
 class UserService:
     """User business logic service."""
 
-    def __init__(self, repo: UserRepository):
+    def __init__(self, repo: UserRepository, auth_cfg: Optional[AuthConfig] = None):
         self.repo = repo
+        self.auth_cfg = auth_cfg or AuthConfig()
+        # Issues login tokens; None disables login
+        self.signer = (
+            TokenSigner(self.auth_cfg.jwt_secret, self.auth_cfg.jwt_ttl, self.auth_cfg.jwt_issuer)
+            if self.auth_cfg.jwt_secret else None
+        )
+        self.lockouts = Lockouts(
+            self.auth_cfg.lockout_max_failures, self.auth_cfg.lockout_window,
+            self.auth_cfg.lockout_seconds, self.auth_cfg.lockout_max
+        )
 
     async def create(self, email: str, display_name: str) -> User:
         """Create a new user."""
         if not email:
-            raise ValueError("email is required")
+            raise ValidationError("email", "is required")
         if not display_name:
-            raise ValueError("display_name is required")
+            raise ValidationError("display_name", "is required")
 
         user = User(email=email, display_name=display_name)
         return await self.repo.create(user)
@@ -26,13 +55,13 @@ class UserService:
     async def get_by_id(self, id: str) -> User:
         """Retrieve a user by ID."""
         if not id:
-            raise ValueError("id is required")
+            raise ValidationError("id", "is required")
         return await self.repo.get_by_id(id)
 
     async def update(self, id: str, email: str, display_name: str) -> User:
         """Update an existing user."""
         if not id:
-            raise ValueError("id is required")
+            raise ValidationError("id", "is required")
 
         user = await self.repo.get_by_id(id)
 
@@ -46,7 +75,7 @@ class UserService:
     async def delete(self, id: str) -> None:
         """Delete a user."""
         if not id:
-            raise ValueError("id is required")
+            raise ValidationError("id", "is required")
         await self.repo.delete(id)
 
     async def list(self, page_size: int, page_token: str) -> Tuple[List[User], ListResult]:
@@ -57,9 +86,9 @@ class UserService:
     async def add_to_tenant(self, tenant_id: str, user_id: str, role: str) -> TenantUser:
         """Add a user to a tenant."""
         if not tenant_id:
-            raise ValueError("tenant_id is required")
+            raise ValidationError("tenant_id", "is required")
         if not user_id:
-            raise ValueError("user_id is required")
+            raise ValidationError("user_id", "is required")
 
         tenant_user = TenantUser(tenant_id=tenant_id, user_id=user_id, role=role)
         return await self.repo.add_to_tenant(tenant_user)
@@ -67,15 +96,55 @@ class UserService:
     async def remove_from_tenant(self, tenant_id: str, user_id: str) -> None:
         """Remove a user from a tenant."""
         if not tenant_id:
-            raise ValueError("tenant_id is required")
+            raise ValidationError("tenant_id", "is required")
         if not user_id:
-            raise ValueError("user_id is required")
+            raise ValidationError("user_id", "is required")
         await self.repo.remove_from_tenant(tenant_id, user_id)
 
     async def list_tenant_users(self, tenant_id: str, page_size: int, page_token: str) -> Tuple[List[TenantUser], ListResult]:
         """List users in a tenant."""
         if not tenant_id:
-            raise ValueError("tenant_id is required")
+            raise ValidationError("tenant_id", "is required")
 
         opts = ListOptions(page_size=page_size, page_token=page_token)
         return await self.repo.list_tenant_users(tenant_id, opts)
+
+    async def set_password(self, id: str, password: str) -> None:
+        """Set a user's password, replacing any previous one."""
+        if not id:
+            raise ValidationError("id", "is required")
+        validate_password(password or "", self.auth_cfg.password_min_length)
+        await self.repo.set_password_hash(id, await asyncio.to_thread(hash_password, password))
+
+    async def login(self, email: str, password: str) -> Tuple[str, int, User, List[TenantUser]]:
+        """
+        Check a user's email and password; returns a login token, its expiry
+        time (Unix seconds), the user and their active memberships. Raises
+        PermissionDeniedError if they don't match.
+        """
+        if self.signer is None:
+            raise FailedPreconditionError("login is not enabled on this server (set AUTH_JWT_SECRET)")
+        if not email:
+            raise ValidationError("email", "is required")
+        if not password:
+            raise ValidationError("password", "is required")
+        retry_after = self.lockouts.retry_after(f"email:{email}")
+        if retry_after > 0:
+            raise PermissionDeniedError(f"too many failed logins, retry in {math.ceil(retry_after)} seconds")
+
+        try:
+            user = await self.repo.get_by_email(email)
+            password_hash = await self.repo.get_password_hash(user.id)
+        except NotFoundError:
+            user, password_hash = None, ""
+        # Verified even without a user, so unknown addresses take as long as wrong passwords
+        if not await asyncio.to_thread(verify_password, password_hash, password) or user is None:
+            self.lockouts.failure(f"email:{email}")
+            raise PermissionDeniedError(LOGIN_FAILED)
+        self.lockouts.success(f"email:{email}")
+        if needs_rehash(password_hash):
+            await self.repo.set_password_hash(user.id, await asyncio.to_thread(hash_password, password))
+
+        memberships = [m for m in await self.repo.list_memberships(user.id) if m.status == "active"]
+        token, expires_at = self.signer.issue(user, memberships)
+        return token, expires_at, user, memberships
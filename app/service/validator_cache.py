@@ -0,0 +1,77 @@
+"""
+Compiled schema validators of node types.
+
+Node writes check their data with the SchemaValidator of their node type's
+schema. Compiling one resolves the check of every declared field, which for
+large schemas costs more than validating the data, so each server instance
+keeps the validators of recently written node types. They are keyed by node
+type ID and schema version, which every schema change increments, so a new
+schema gets a new validator and the old one ages out; the least recently used
+are evicted beyond max_entries.
+"""
+
+import time
+from collections import OrderedDict
+from typing import List, Tuple
+
+from app.metrics.registry import metric_family
+from app.repository import NodeType
+from app.service.schema import SchemaValidator
+
+
+class ValidatorCache:
+    """SchemaValidators by (node type ID, schema version), least recently used evicted first."""
+
+    def __init__(self, max_entries: int = 1000):
+        self.max_entries = max_entries
+        self._validators: "OrderedDict[Tuple[str, int], SchemaValidator]" = OrderedDict()
+        self.hits = 0
+        self.misses = 0
+        self.evictions = 0
+        self.compile_seconds = 0.0
+
+    def get(self, node_type: NodeType) -> SchemaValidator:
+        """Return the validator of a node type's schema, compiling it if it isn't cached."""
+        key = (node_type.id, node_type.schema_version)
+        validator = self._validators.get(key)
+        # A tenant database restored from a backup can reuse a schema version for another schema
+        if validator is not None and validator.schema == node_type.schema:
+            self.hits += 1
+            self._validators.move_to_end(key)
+            return validator
+
+        self.misses += 1
+        started = time.perf_counter()
+        validator = SchemaValidator(node_type.schema)
+        self.compile_seconds += time.perf_counter() - started
+        self._validators[key] = validator
+        self._validators.move_to_end(key)
+        while len(self._validators) > self.max_entries:
+            self._validators.popitem(last=False)
+            self.evictions += 1
+        return validator
+
+    def __len__(self) -> int:
+        return len(self._validators)
+
+    def metric_lines(self, openmetrics: bool = False) -> List[str]:
+        """Render the cache metrics in the Prometheus or OpenMetrics text format."""
+        def family(name: str, metric_type: str, help_text: str) -> List[str]:
+            return metric_family(name, metric_type, help_text, openmetrics)
+
+        lines = family("flexdb_schema_validators", "gauge", "Compiled schema validators cached.")
+        lines.append(f"flexdb_schema_validators {len(self)}")
+        lines += family(
+            "flexdb_schema_validator_lookups_total", "counter", "Schema validator lookups by whether they were cached."
+        )
+        lines.append(f'flexdb_schema_validator_lookups_total{{result="hit"}} {self.hits}')
+        lines.append(f'flexdb_schema_validator_lookups_total{{result="miss"}} {self.misses}')
+        lines += family(
+            "flexdb_schema_validator_evictions_total", "counter", "Schema validators evicted as least recently used."
+        )
+        lines.append(f"flexdb_schema_validator_evictions_total {self.evictions}")
+        lines += family(
+            "flexdb_schema_validator_compile_seconds_total", "counter", "Seconds spent compiling schema validators."
+        )
+        lines.append(f"flexdb_schema_validator_compile_seconds_total {self.compile_seconds!r}")
+        return lines
@@ -0,0 +1,193 @@
+"""
+Webhook service implementation.
+"""
+
+import json
+import secrets
+from typing import Any, Dict, List, Optional, Tuple
+from urllib.parse import urlparse
+
+from app.events.redaction import redact_payload
+from app.events.sinks import WEBHOOK_KIND, WEBHOOK_KINDS, validate_template
+from app.events.types import EVENT_TYPES, TEST_EVENT_TYPE
+from app.repository import (
+    ListOptions,
+    ListResult,
+    NotFoundError,
+    WebhookDelivery,
+    WebhookEndpoint,
+    WebhookRepository,
+    ValidationError,
+)
+
+WEBHOOK_STATUSES = ("active", "disabled")
+DELIVERY_STATUSES = ("pending", "succeeded", "failed")
+
+
+def _validate_url(url: str) -> None:
+    parsed = urlparse(url)
+    if parsed.scheme not in ("http", "https") or not parsed.netloc:
+        raise ValidationError("url", "must be an absolute http or https URL")
+
+
+def _validate_event_types(event_types: List[str]) -> None:
+    for event_type in event_types:
+        if event_type not in EVENT_TYPES:
+            raise ValueError(f"unknown event type: {event_type}")
+
+
+def _validate_node_type_ids(node_type_ids: List[str]) -> None:
+    for node_type_id in node_type_ids:
+        if not isinstance(node_type_id, str) or not node_type_id:
+            raise ValidationError("node_type_ids", "must be an array of node type IDs")
+
+
+def delivery_log(delivery: WebhookDelivery) -> Dict[str, Any]:
+    """A delivery's dictionary with a snapshot of its payload, secret-looking values redacted."""
+    return {**delivery.to_dict(), "payload": redact_payload(json.loads(delivery.payload))}
+
+
+class WebhookService:
+    """Webhook endpoint business logic service."""
+
+    def __init__(self, repo: WebhookRepository):
+        self.repo = repo
+
+    async def create(
+        self,
+        url: str,
+        event_types: Optional[List[str]],
+        description: str,
+        kind: str = WEBHOOK_KIND,
+        template: str = "",
+        node_type_ids: Optional[List[str]] = None,
+        dry_run: bool = False
+    ) -> WebhookEndpoint:
+        """
+        Register a new webhook endpoint with a freshly generated signing secret.
+
+        kind "slack" or "teams" posts events as chat messages rendered from
+        template instead of signed JSON. A dry run validates the endpoint and
+        returns it without saving it.
+        """
+        if not url:
+            raise ValidationError("url", "is required")
+        _validate_url(url)
+        event_types = list(event_types or [])
+        _validate_event_types(event_types)
+        kind = kind or WEBHOOK_KIND
+        if kind not in WEBHOOK_KINDS:
+            raise ValidationError("kind", f"must be one of: {', '.join(WEBHOOK_KINDS)}")
+        if template and kind == WEBHOOK_KIND:
+            raise ValueError("template is only supported for slack and teams endpoints")
+        validate_template(template)
+        node_type_ids = list(node_type_ids or [])
+        _validate_node_type_ids(node_type_ids)
+
+        endpoint = WebhookEndpoint(
+            url=url,
+            secret=secrets.token_hex(32),
+            event_types=event_types,
+            description=description,
+            kind=kind,
+            template=template,
+            node_type_ids=node_type_ids,
+        )
+        if dry_run:
+            return endpoint
+        return await self.repo.create(endpoint)
+
+    async def get_by_id(self, id: str) -> WebhookEndpoint:
+        """Retrieve a webhook endpoint by ID."""
+        if not id:
+            raise ValidationError("id", "is required")
+        return await self.repo.get_by_id(id)
+
+    async def update(
+        self,
+        id: str,
+        url: str,
+        event_types: Optional[List[str]],
+        description: str,
+        status: str,
+        template: str = "",
+        node_type_ids: Optional[List[str]] = None,
+        dry_run: bool = False
+    ) -> WebhookEndpoint:
+        """
+        Update an existing webhook endpoint. The kind cannot be changed. A dry
+        run validates the update and returns the result without saving it.
+        """
+        if not id:
+            raise ValidationError("id", "is required")
+
+        endpoint = await self.repo.get_by_id(id)
+
+        if url:
+            _validate_url(url)
+            endpoint.url = url
+        if event_types is not None:
+            _validate_event_types(event_types)
+            endpoint.event_types = list(event_types)
+        if description:
+            endpoint.description = description
+        if status:
+            if status not in WEBHOOK_STATUSES:
+                raise ValidationError("status", f"must be one of: {', '.join(WEBHOOK_STATUSES)}")
+            endpoint.status = status
+        if template:
+            if endpoint.kind == WEBHOOK_KIND:
+                raise ValueError("template is only supported for slack and teams endpoints")
+            validate_template(template)
+            endpoint.template = template
+        if node_type_ids is not None:
+            _validate_node_type_ids(node_type_ids)
+            endpoint.node_type_ids = list(node_type_ids)
+
+        if dry_run:
+            return endpoint
+        return await self.repo.update(endpoint)
+
+    async def delete(self, id: str) -> None:
+        """Delete a webhook endpoint and its pending deliveries."""
+        if not id:
+            raise ValidationError("id", "is required")
+        await self.repo.delete(id)
+
+    async def list(self, page_size: int, page_token: str) -> Tuple[List[WebhookEndpoint], ListResult]:
+        """Retrieve webhook endpoints with pagination."""
+        opts = ListOptions(page_size=page_size, page_token=page_token)
+        return await self.repo.list(opts)
+
+    async def send_test_event(self, id: str) -> WebhookDelivery:
+        """
+        Queue a sample webhook.test event for an endpoint, delivered by the
+        dispatcher's next poll whatever the endpoint's filters and status, and
+        attempted once. Its outcome is in the endpoint's deliveries.
+        """
+        endpoint = await self.get_by_id(id)
+        payload = {
+            "webhook_endpoint_id": endpoint.id,
+            "message": "This is a test event sent on request.",
+        }
+        return await self.repo.create_test_delivery(endpoint.id, TEST_EVENT_TYPE, payload)
+
+    async def get_delivery(self, endpoint_id: str, id: str) -> WebhookDelivery:
+        """Retrieve a delivery of an endpoint by ID."""
+        if not id:
+            raise ValidationError("id", "is required")
+        endpoint = await self.get_by_id(endpoint_id)
+        delivery = await self.repo.get_delivery(id)
+        if delivery.endpoint_id != endpoint.id:
+            raise NotFoundError(f"webhook delivery not found: {id}")
+        return delivery
+
+    async def list_deliveries(
+        self, endpoint_id: str, page_size: int, page_token: str, status: str = ""
+    ) -> Tuple[List[WebhookDelivery], ListResult]:
+        """Retrieve an endpoint's deliveries, newest first, optionally with one status."""
+        if status and status not in DELIVERY_STATUSES:
+            raise ValidationError("status", f"must be one of: {', '.join(DELIVERY_STATUSES)}")
+        endpoint = await self.get_by_id(endpoint_id)
+        opts = ListOptions(page_size=page_size, page_token=page_token)
+        return await self.repo.list_deliveries(endpoint.id, opts, status)
@@ -0,0 +1,31 @@
+"""
+Storage backends: PostgreSQL, SQLite files or memory.
+"""
+
+from app.storage.backends import (
+    MEMORY,
+    POSTGRES,
+    SQLITE,
+    STORAGE_BACKENDS,
+    ControlRepositories,
+    MemoryStorage,
+    PostgresStorage,
+    SqliteStorage,
+    Storage,
+    TenantRepositories,
+)
+from app.storage.services import LocalTenantServices
+
+__all__ = [
+    "MEMORY",
+    "POSTGRES",
+    "SQLITE",
+    "STORAGE_BACKENDS",
+    "ControlRepositories",
+    "MemoryStorage",
+    "PostgresStorage",
+    "SqliteStorage",
+    "Storage",
+    "TenantRepositories",
+    "LocalTenantServices",
+]
@@ -0,0 +1,237 @@
+"""
+Storage backends: the repositories of the control plane and of each tenant,
+built by one factory per backend.
+
+    postgres  the control and tenant databases of a PostgreSQL server
+    sqlite    SQLite files in a directory (see app/repository/sqlite.py):
+              control.db, and a tenant_<tenant_id>.db per tenant created
+              when the tenant is first used
+    memory    the in-memory repositories of app/repository/memory.py
+
+STORAGE_BACKEND selects the server's backend (see main.py) and open_embedded
+the embedded one (see app/embedded). Every backend has the control plane
+repositories (tenants, tenant quotas, users) and the tenant repositories of
+node types, nodes and relationships; the other features need PostgreSQL.
+"""
+
+import os
+import re
+from dataclasses import dataclass
+from typing import Any, Dict, Optional, Protocol
+
+from app.db import Database, TenantDatabaseManager
+from app.repository import (
+    CONTROL_SCHEMA,
+    TENANT_SCHEMA,
+    BulkJobRepository,
+    DataKeyRepository,
+    InMemoryBulkJobRepository,
+    InMemoryControlStore,
+    InMemoryDataKeyRepository,
+    InMemoryNodeRepository,
+    InMemoryNodeTypeRepository,
+    InMemoryOutboxRepository,
+    InMemoryRelationshipRepository,
+    InMemoryStore,
+    InMemoryTenantQuotaRepository,
+    InMemoryTenantRepository,
+    InMemoryTransferRepository,
+    InMemoryUserRepository,
+    NodeRepository,
+    NodeTypeRepository,
+    NotFoundError,
+    OutboxRepository,
+    RelationshipRepository,
+    SqliteBulkJobRepository,
+    SqliteDataKeyRepository,
+    SqliteDatabase,
+    SqliteNodeRepository,
+    SqliteNodeTypeRepository,
+    SqliteOutboxRepository,
+    SqliteRelationshipRepository,
+    SqliteTenantQuotaRepository,
+    SqliteTenantRepository,
+    SqliteUserRepository,
+    TenantDeletionRepository,
+    TenantQuotaRepository,
+    TenantRepository,
+    TransferRepository,
+    UserRepository,
+)
+
+POSTGRES = "postgres"
+SQLITE = "sqlite"
+MEMORY = "memory"
+STORAGE_BACKENDS = (POSTGRES, SQLITE, MEMORY)
+
+# Tenant IDs are UUIDs; anything else never names a tenant file
+_TENANT_ID = re.compile(r"^[0-9A-Za-z-]+$")
+
+
+@dataclass
+class ControlRepositories:
+    """The control plane repositories of a backend."""
+    tenants: Any
+    tenant_quotas: Any
+    users: Any
+    tenant_deletions: Any = None  # None if the backend deletes tenants at once
+
+
+@dataclass
+class TenantRepositories:
+    """The repositories of a tenant."""
+    node_types: Any
+    nodes: Any
+    relationships: Any
+    outbox: Any
+    data_keys: Any
+    bulk_jobs: Any
+    transfer: Any = None  # None if the backend has no bulk export and import
+
+
+class Storage(Protocol):
+    """A storage backend."""
+    backend: str
+
+    def control(self) -> ControlRepositories:
+        """Return the control plane repositories."""
+        ...
+
+    async def tenant(self, tenant_id: str) -> TenantRepositories:
+        """Return the repositories of a tenant; raises NotFoundError if it has no storage."""
+        ...
+
+    async def drop_tenant(self, tenant_id: str) -> None:
+        """Release the storage of a deleted tenant."""
+        ...
+
+    async def close(self) -> None:
+        """Close the connections."""
+        ...
+
+
+class PostgresStorage:
+    """The control and tenant databases of a PostgreSQL server."""
+    backend = POSTGRES
+
+    def __init__(self, control_db: Database, tenant_db_manager: TenantDatabaseManager):
+        self.control_db = control_db
+        self.tenant_db_manager = tenant_db_manager
+
+    def control(self) -> ControlRepositories:
+        return ControlRepositories(
+            tenants=TenantRepository(self.control_db),
+            tenant_quotas=TenantQuotaRepository(self.control_db),
+            users=UserRepository(self.control_db),
+            tenant_deletions=TenantDeletionRepository(self.control_db),
+        )
+
+    async def tenant(self, tenant_id: str) -> TenantRepositories:
+        try:
+            tenant_db = await self.tenant_db_manager.get_tenant_db(tenant_id)
+        except ValueError:
+            raise NotFoundError(f"tenant not found: {tenant_id}") from None
+        return TenantRepositories(
+            node_types=NodeTypeRepository(tenant_db),
+            nodes=NodeRepository(tenant_db),
+            relationships=RelationshipRepository(tenant_db),
+            outbox=OutboxRepository(tenant_db),
+            data_keys=DataKeyRepository(tenant_db),
+            bulk_jobs=BulkJobRepository(tenant_db),
+            transfer=TransferRepository(tenant_db),
+        )
+
+    async def drop_tenant(self, tenant_id: str) -> None:
+        # TenantService drops tenant databases through the tenant database manager
+        pass
+
+    async def close(self) -> None:
+        await self.tenant_db_manager.close_all_pools()
+        await self.control_db.close()
+
+
+class SqliteStorage:
+    """SQLite files in a directory: control.db and tenant_<tenant_id>.db."""
+    backend = SQLITE
+
+    def __init__(self, directory: str):
+        os.makedirs(directory, exist_ok=True)
+        self.directory = directory
+        self._control = SqliteDatabase(os.path.join(directory, "control.db"), CONTROL_SCHEMA)
+        self._tenants: Dict[str, SqliteDatabase] = {}
+
+    def control(self) -> ControlRepositories:
+        return ControlRepositories(
+            tenants=SqliteTenantRepository(self._control),
+            tenant_quotas=SqliteTenantQuotaRepository(self._control),
+            users=SqliteUserRepository(self._control),
+        )
+
+    async def tenant(self, tenant_id: str) -> TenantRepositories:
+        tenant_db = self._tenants.get(tenant_id)
+        if tenant_db is None:
+            tenant_db = self._tenants[tenant_id] = SqliteDatabase(self._tenant_path(tenant_id), TENANT_SCHEMA)
+        return TenantRepositories(
+            node_types=SqliteNodeTypeRepository(tenant_db),
+            nodes=SqliteNodeRepository(tenant_db),
+            relationships=SqliteRelationshipRepository(tenant_db),
+            outbox=SqliteOutboxRepository(tenant_db),
+            data_keys=SqliteDataKeyRepository(tenant_db),
+            bulk_jobs=SqliteBulkJobRepository(tenant_db),
+        )
+
+    async def drop_tenant(self, tenant_id: str) -> None:
+        tenant_db = self._tenants.pop(tenant_id, None)
+        if tenant_db:
+            tenant_db.close()
+        if not _TENANT_ID.match(tenant_id):
+            return
+        path = self._tenant_path(tenant_id)
+        for name in (path, f"{path}-wal", f"{path}-shm"):
+            if os.path.exists(name):
+                os.remove(name)
+
+    async def close(self) -> None:
+        for tenant_db in self._tenants.values():
+            tenant_db.close()
+        self._tenants.clear()
+        self._control.close()
+
+    def _tenant_path(self, tenant_id: str) -> str:
+        if not _TENANT_ID.match(tenant_id):
+            raise NotFoundError(f"tenant not found: {tenant_id}")
+        return os.path.join(self.directory, f"tenant_{tenant_id}.db")
+
+
+class MemoryStorage:
+    """In-memory repositories: an InMemoryControlStore and an InMemoryStore per tenant."""
+    backend = MEMORY
+
+    def __init__(self, control: Optional[InMemoryControlStore] = None):
+        self.control_store = control or InMemoryControlStore()
+        self.stores: Dict[str, InMemoryStore] = {}
+
+    def control(self) -> ControlRepositories:
+        return ControlRepositories(
+            tenants=InMemoryTenantRepository(self.control_store),
+            tenant_quotas=InMemoryTenantQuotaRepository(self.control_store),
+            users=InMemoryUserRepository(self.control_store),
+        )
+
+    async def tenant(self, tenant_id: str) -> TenantRepositories:
+        store = self.stores.setdefault(tenant_id, InMemoryStore())
+        return TenantRepositories(
+            node_types=InMemoryNodeTypeRepository(store),
+            nodes=InMemoryNodeRepository(store),
+            relationships=InMemoryRelationshipRepository(store),
+            outbox=InMemoryOutboxRepository(store),
+            data_keys=InMemoryDataKeyRepository(store),
+            bulk_jobs=InMemoryBulkJobRepository(store),
+            transfer=InMemoryTransferRepository(store),
+        )
+
+    async def drop_tenant(self, tenant_id: str) -> None:
+        self.stores.pop(tenant_id, None)
+
+    async def close(self) -> None:
+        pass
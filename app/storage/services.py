@@ -0,0 +1,103 @@
+"""
+Tenant services on the sqlite and memory backends, in place of
+create_tenant_services (see app/api/dependencies.py), which builds them on the
+tenant databases of PostgreSQL.
+"""
+
+from typing import Any
+
+from app.api.dependencies import create_storage_export_service, current_query_cache, current_validator_cache
+from app.encryption import current_kms
+from app.repository import FailedPreconditionError, NotFoundError
+from app.service import (
+    BulkJobService,
+    ChangeFeedService,
+    CloneService,
+    NodeService,
+    NodeTypeService,
+    OperationService,
+    QueryCacheService,
+    RelationshipService,
+    TransferService,
+)
+from app.service.encryption import FieldEncryption
+from app.service.operation_service import bulk_job_operations
+from app.service.tenant_check import TenantCheck
+from app.service.tenant_service import SUSPENDED
+from app.storage.backends import Storage
+
+
+class _Unavailable:
+    """Stands in for a tenant service the backend doesn't have."""
+
+    def __init__(self, name: str, backend: str):
+        self.name = name
+        self.backend = backend
+
+    def __getattr__(self, attr: str):
+        async def unavailable(*args: Any, **kwargs: Any) -> Any:
+            raise ValueError(f"{self.name} are not available with the {self.backend} backend")
+        return unavailable
+
+
+class LocalTenantServices:
+    """Builds the services of the tenants of a storage backend, for set_tenant_services_factory."""
+
+    def __init__(self, storage: Storage):
+        self.storage = storage
+        self.tenants = storage.control().tenants
+
+    async def services(self, tenant_id: str) -> dict:
+        """
+        Return the services of a tenant by name, like create_tenant_services.
+        Webhooks, intake forms, email inboxes, node locks and node migrations,
+        which need PostgreSQL, fail with invalid params (-32602).
+        """
+        try:
+            tenant = await self.tenants.get_by_id(tenant_id)
+        except NotFoundError:
+            # The tenant was deleted: release its storage
+            await self.storage.drop_tenant(tenant_id)
+            raise
+        if tenant.status == SUSPENDED:
+            raise FailedPreconditionError(f"tenant {tenant_id} is suspended")
+
+        repos = await self.storage.tenant(tenant_id)
+        backend = self.storage.backend
+        bulk_jobs = BulkJobService(repos.bulk_jobs)
+        transfer = (
+            TransferService(repos.transfer, repos.node_types) if repos.transfer
+            else _Unavailable("exports and imports", backend)
+        )
+        encryption = FieldEncryption(current_kms(), repos.data_keys, tenant_id)
+        tenant_check = TenantCheck(self.tenants, tenant_id)
+        return {
+            "node_type": NodeTypeService(repos.node_types, tenant_check=tenant_check),
+            "node": NodeService(
+                repos.nodes, repos.node_types, encryption, tenant_check, current_validator_cache()
+            ),
+            "node_locks": _Unavailable("node locks", backend),
+            "relationship": RelationshipService(repos.relationships, repos.nodes, tenant_check),
+            "clone": (
+                CloneService(repos.nodes, repos.node_types, repos.relationships, repos.transfer, encryption)
+                if repos.transfer else _Unavailable("cloning", backend)
+            ),
+            "webhook": _Unavailable("webhooks", backend),
+            "subscriptions": _Unavailable("event subscriptions", backend),
+            "changes": ChangeFeedService(repos.outbox),
+            "intake": _Unavailable("intake forms", backend),
+            "inbox": _Unavailable("email inboxes", backend),
+            "attachments": _Unavailable("attachments", backend),
+            "transfer": transfer,
+            "storage_exports": (
+                create_storage_export_service(transfer, bulk_jobs, tenant_id) if repos.transfer
+                else _Unavailable("exports and imports", backend)
+            ),
+            "query_cache": QueryCacheService(current_query_cache(), repos.outbox),
+            "bi_views": None,
+            "node_migration": _Unavailable("node migrations", backend),
+            "retention": _Unavailable("retention policies", backend),
+            "bulk_jobs": bulk_jobs,
+            "operations": OperationService(bulk_job_operations(bulk_jobs)),
+            "dead_letters": _Unavailable("dead letters", backend),
+        }
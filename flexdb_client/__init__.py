@@ -0,0 +1,70 @@
+"""
+Client SDK and helpers for FlexDB (flexdb_client/client.py), its per-method
+timeouts, retries and hedging (flexdb_client/service_config.py, configured by
+the published flexdb_client/service_config.json), a client-side cache kept
+fresh by the change feed (flexdb_client/cache.py), and the flexyctl admin CLI
+(flexdb_client/flexyctl.py).
+
+This package has no dependencies on the server (app) and can be vendored into
+applications that call FlexDB or receive its webhooks.
+"""
+
+from flexdb_client.cache import TenantCache
+from flexdb_client.client import (
+    ConflictError,
+    DeadlineExceededError,
+    FailedPreconditionError,
+    FlexDBClient,
+    FlexDBError,
+    InternalError,
+    InvalidParamsError,
+    NotFoundError,
+    PageIterator,
+    PermissionDeniedError,
+    RateLimitedError,
+    TenantClient,
+    UnauthenticatedError,
+    UnavailableError,
+    ValidationError,
+)
+from flexdb_client.service_config import (
+    DEFAULT_SERVICE_CONFIG_PATH,
+    HedgingPolicy,
+    MethodConfig,
+    RetryPolicy,
+    ServiceConfig,
+)
+from flexdb_client.signing import (
+    SIGNATURE_HEADER,
+    SignatureError,
+    sign_request,
+    verify_webhook,
+)
+
+__all__ = [
+    "ConflictError",
+    "DeadlineExceededError",
+    "FailedPreconditionError",
+    "FlexDBClient",
+    "FlexDBError",
+    "HedgingPolicy",
+    "InternalError",
+    "InvalidParamsError",
+    "MethodConfig",
+    "NotFoundError",
+    "PageIterator",
+    "PermissionDeniedError",
+    "RateLimitedError",
+    "RetryPolicy",
+    "ServiceConfig",
+    "TenantCache",
+    "TenantClient",
+    "UnauthenticatedError",
+    "UnavailableError",
+    "ValidationError",
+    "DEFAULT_SERVICE_CONFIG_PATH",
+    "SIGNATURE_HEADER",
+    "SignatureError",
+    "sign_request",
+    "verify_webhook",
+]
@@ -0,0 +1,226 @@
+"""
+Client-side cache of nodes and node types, kept fresh by the change feed.
+
+TenantCache answers get_node and get_node_type from memory once fetched, and
+follows the tenant's change feed (list_changes) in a background thread to
+drop every entry whose node or node type changed, so the next read fetches
+it again:
+
+    cache = TenantCache(client.tenant(tenant_id))
+    cache.start()
+    article = cache.get_node(node_id)  # fetched once, then served from memory
+    ...
+    cache.stop()
+
+Entries are only dropped once the feed lists the change, so a read can
+return data up to one poll_interval old; a service's own writes through
+the cache (update_node, delete_node) drop their entries at once. When the
+feed can't be read for max_staleness seconds, reads go to the server until
+it can again. Create a TenantCache for every tenant to watch.
+
+Like the rest of flexdb_client, this only uses the standard library.
+"""
+
+import copy
+import threading
+import time
+from collections import OrderedDict
+from typing import Any, Callable, Dict, List, Optional, Tuple
+
+from flexdb_client.client import FlexDBError, InvalidParamsError, TenantClient
+
+DEFAULT_MAX_ENTRIES = 10000
+
+_NODE = "node"
+_NODE_TYPE = "node_type"
+
+# (entity type, ID, locale)
+_Key = Tuple[str, str, str]
+
+
+class _Fetch:
+    """A read of an entry in flight; marked stale if the entry changed meanwhile."""
+
+    def __init__(self):
+        self.stale = False
+
+
+class TenantCache:
+    """Caches a tenant's nodes and node types, dropping them when the change feed lists a change."""
+
+    def __init__(
+        self,
+        tenant: TenantClient,
+        max_entries: int = DEFAULT_MAX_ENTRIES,
+        poll_interval: float = 1.0,
+        max_staleness: float = 30.0,
+        clock: Callable[[], float] = time.monotonic
+    ):
+        self.tenant = tenant
+        self.max_entries = max_entries
+        self.poll_interval = poll_interval
+        self.max_staleness = max_staleness
+        self.clock = clock
+        self.hits = 0
+        self.misses = 0
+        self._entries: "OrderedDict[_Key, Dict[str, Any]]" = OrderedDict()
+        self._fetches: Dict[_Key, List[_Fetch]] = {}
+        self._lock = threading.Lock()
+        self._token: Optional[str] = None
+        self._synced_at: Optional[float] = None
+        self._thread: Optional[threading.Thread] = None
+        self._stopping = threading.Event()
+
+    def start(self) -> None:
+        """Start following the change feed in a daemon thread."""
+        if self._thread:
+            return
+        self._stopping.clear()
+        self._thread = threading.Thread(target=self._run, name="flexdb-cache", daemon=True)
+        self._thread.start()
+
+    def stop(self) -> None:
+        """Stop following the change feed; reads then go to the server."""
+        if self._thread:
+            self._stopping.set()
+            self._thread.join()
+            self._thread = None
+
+    def _run(self) -> None:
+        while not self._stopping.is_set():
+            try:
+                self.sync()
+            except FlexDBError:
+                # Retried at the next poll; reads bypass the cache once it is stale
+                pass
+            self._stopping.wait(self.poll_interval)
+
+    def sync(self) -> int:
+        """
+        Read the change feed up to now and drop the entries that changed;
+        returns the number of changes read. start() calls this every
+        poll_interval; call it directly to drive the cache without a thread.
+        """
+        if self._token is None:
+            token = self.tenant.call("get_change_token")["change_token"]
+            with self._lock:
+                self._token = token
+                self._synced_at = self.clock()
+            return 0
+
+        read = 0
+        while True:
+            try:
+                page = self.tenant.call("list_changes", after=self._token)
+            except InvalidParamsError:
+                # The token is no longer valid, e.g. the tenant database was restored
+                self.clear()
+                return read
+            with self._lock:
+                for event in page["events"]:
+                    self._apply(event)
+                self._token = page["next_token"]
+                read += len(page["events"])
+                if page["caught_up"]:
+                    self._synced_at = self.clock()
+                    return read
+
+    def clear(self) -> None:
+        """Drop every entry, and start over at the change feed's position of the next sync."""
+        with self._lock:
+            self._entries.clear()
+            for fetches in self._fetches.values():
+                for fetch in fetches:
+                    fetch.stale = True
+            self._token = None
+            self._synced_at = None
+
+    @property
+    def fresh(self) -> bool:
+        """Whether the change feed was read up to now within max_staleness, so entries can be served."""
+        synced_at = self._synced_at
+        return synced_at is not None and self.clock() - synced_at <= self.max_staleness
+
+    def get_node(self, id: str, *, locale: str = "") -> Dict[str, Any]:
+        """Return a node like TenantClient.get_node, from the cache if it hasn't changed since it was fetched."""
+        return self._get((_NODE, id, locale), lambda: self.tenant.get_node(id, locale=locale))
+
+    def get_node_type(self, id: str) -> Dict[str, Any]:
+        """Return a node type like TenantClient.get_node_type, from the cache if it hasn't changed since."""
+        return self._get((_NODE_TYPE, id, ""), lambda: self.tenant.get_node_type(id))
+
+    def update_node(
+        self, id: str, data: Dict[str, Any], *, expected_version: int = 0, lock_token: str = ""
+    ) -> Dict[str, Any]:
+        """Update a node through TenantClient.update_node and drop its cached entries."""
+        try:
+            return self.tenant.update_node(id, data, expected_version=expected_version, lock_token=lock_token)
+        finally:
+            self.invalidate(_NODE, id)
+
+    def delete_node(self, id: str, *, lock_token: str = "") -> None:
+        """Delete a node through TenantClient.delete_node and drop its cached entries."""
+        try:
+            self.tenant.delete_node(id, lock_token=lock_token)
+        finally:
+            self.invalidate(_NODE, id)
+
+    def invalidate(self, entity_type: str, id: str) -> None:
+        """Drop the entries of a node ("node") or node type ("node_type"), in every locale."""
+        with self._lock:
+            self._drop(lambda key: key[0] == entity_type and key[1] == id)
+
+    def _get(self, key: _Key, fetch_entity: Callable[[], Dict[str, Any]]) -> Dict[str, Any]:
+        with self._lock:
+            entry = self._entries.get(key) if self.fresh else None
+            if entry is not None:
+                self._entries.move_to_end(key)
+                self.hits += 1
+                return copy.deepcopy(entry)
+            self.misses += 1
+            fetch = _Fetch()
+            self._fetches.setdefault(key, []).append(fetch)
+
+        entity = None
+        try:
+            entity = fetch_entity()
+        finally:
+            with self._lock:
+                fetches = self._fetches[key]
+                fetches.remove(fetch)
+                if not fetches:
+                    del self._fetches[key]
+                # Not cached if it changed while it was fetched, or nothing tells when it changes
+                if entity is not None and not fetch.stale and self.fresh:
+                    self._entries[key] = copy.deepcopy(entity)
+                    self._entries.move_to_end(key)
+                    while len(self._entries) > self.max_entries:
+                        self._entries.popitem(last=False)
+        return entity
+
+    def _apply(self, event: Dict[str, Any]) -> None:
+        """Drop the entries a change event makes outdated; called with the lock held."""
+        entity_type, _, op = event["type"].partition(".")
+        entity = (event.get("data") or {}).get(entity_type) or {}
+        id = entity.get("id")
+        if entity_type == _NODE:
+            self._drop(lambda key: key[0] == _NODE and key[1] == id)
+        elif entity_type == _NODE_TYPE:
+            self._drop(lambda key: key[0] == _NODE_TYPE and key[1] == id)
+            if op == "deleted":
+                # Deleting a node type deletes its nodes, without events of their own; the
+                # type of nodes being read isn't known yet, so all of those are stale
+                nodes = {
+                    key for key, entry in self._entries.items()
+                    if key[0] == _NODE and entry.get("node_type_id") == id
+                }
+                self._drop(lambda key: key in nodes or (key[0] == _NODE and key in self._fetches))
+
+    def _drop(self, matches: Callable[[_Key], bool]) -> None:
+        """Drop the matching entries and mark their reads in flight stale; called with the lock held."""
+        for key in [key for key in self._entries if matches(key)]:
+            del self._entries[key]
+        for key, fetches in self._fetches.items():
+            if matches(key):
+                for fetch in fetches:
+                    fetch.stale = True
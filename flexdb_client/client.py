@@ -0,0 +1,614 @@
+"""
+Python SDK for the FlexDB JSON-RPC API.
+
+FlexDBClient wraps the API with methods taking keyword arguments instead of
+params objects, iterators that follow page tokens, typed exceptions for
+JSON-RPC errors, and retries with exponential backoff:
+
+    client = FlexDBClient("https://flexdb.example.com", api_key=os.environ["FLEXDB_API_KEY"])
+    acme = client.tenant(tenant_id)
+
+    article = acme.create_node(article_type_id, {"title": "Hello", "slug": "hello"})
+    for node in acme.list_nodes(article_type_id, filter={"status": "draft"}):
+        acme.update_node(node["id"], {**node["data"], "status": "published"}, expected_version=node["version"])
+
+    try:
+        acme.get_node(node_id)
+    except NotFoundError:
+        ...
+
+client.tenant() returns a TenantClient bound to one tenant, so its methods
+don't take tenant_id. Node and relationship data is passed and returned as
+dicts rather than JSON text.
+
+Failed calls raise the FlexDBError subclass of their error code. Every
+method has the timeout and retry or hedging policy of the client's service
+config (see flexdb_client/service_config.py). By default, calls rejected by
+rate limits (RateLimitedError), and calls that didn't reach the server
+(UnavailableError), are retried with exponential backoff; reads are also
+hedged, sent again when the server is slow to answer, and retried on other
+unavailability (timeouts, HTTP 502, 503 and 504), which writes are not since
+they may have been applied. Passing a RetryPolicy instead retries every
+method with it, without hedging.
+
+Like the rest of flexdb_client, this only uses the standard library.
+"""
+
+import errno
+import inspect
+import json
+import queue
+import threading
+import time
+import urllib.error
+import urllib.request
+from typing import Any, Callable, Dict, Iterator, List, Optional, Type
+
+from flexdb_client.service_config import HedgingPolicy, RetryPolicy, ServiceConfig
+
+DEFAULT_URL = "http://localhost:5000"
+DEFAULT_PAGE_SIZE = 100
+
+# Methods without side effects, retried whenever the server was unavailable
+_READ_PREFIXES = ("get_", "batch_get_", "list_", "count_", "aggregate_", "describe_")
+_RETRIED_HTTP_STATUSES = (502, 503, 504)
+# google.rpc status details the server puts in error data
+_ERROR_INFO_TYPE = "type.googleapis.com/google.rpc.ErrorInfo"
+_BAD_REQUEST_TYPE = "type.googleapis.com/google.rpc.BadRequest"
+
+
+class FlexDBError(Exception):
+    """A failed call, with its JSON-RPC error code, message and data."""
+
+    code = 0
+    # gRPC status name, which service configs use to name the errors retried
+    status = "UNKNOWN"
+
+    def __init__(self, message: str, code: Optional[int] = None, data: Any = None, method: str = ""):
+        if code is not None:
+            self.code = code
+        super().__init__(f"{method} failed ({self.code}): {message}" if method else message)
+        self.message = message
+        self.data = data
+        self.method = method
+
+    @property
+    def reason(self) -> str:
+        """The machine-readable cause of the error, e.g. "ALREADY_EXISTS", or "" if the server gave none."""
+        return self._detail(_ERROR_INFO_TYPE).get("reason", "")
+
+    @property
+    def field_violations(self) -> Dict[str, str]:
+        """The invalid params, as field path -> description, e.g. {"data.title": "is required"}."""
+        violations = self._detail(_BAD_REQUEST_TYPE).get("field_violations") or []
+        return {violation.get("field", ""): violation.get("description", "") for violation in violations}
+
+    def _detail(self, detail_type: str) -> Dict[str, Any]:
+        details = self.data.get("details") if isinstance(self.data, dict) else None
+        for detail in details or []:
+            if isinstance(detail, dict) and detail.get("@type") == detail_type:
+                return detail
+        return {}
+
+
+class UnauthenticatedError(FlexDBError):
+    """The API key is missing or invalid, or authentication is locked out."""
+
+    code = -32000
+    status = "UNAUTHENTICATED"
+
+
+class NotFoundError(FlexDBError):
+    """The resource doesn't exist."""
+
+    code = -32001
+    status = "NOT_FOUND"
+
+
+class ValidationError(FlexDBError):
+    """The data doesn't match the node type's schema."""
+
+    code = -32002
+    status = "INVALID_ARGUMENT"
+
+
+class ConflictError(FlexDBError):
+    """The write conflicts with the current state, e.g. a unique key or an outdated expected_version."""
+
+    code = -32003
+    status = "ABORTED"
+
+
+class PermissionDeniedError(FlexDBError):
+    """The API key's scopes don't allow the call."""
+
+    code = -32004
+    status = "PERMISSION_DENIED"
+
+
+class FailedPreconditionError(FlexDBError):
+    """The call isn't possible in the resource's current state, e.g. on an archived tenant."""
+
+    code = -32005
+    status = "FAILED_PRECONDITION"
+
+
+class RateLimitedError(FlexDBError):
+    """The call was rejected by a rate limit; retry_after is the seconds to wait."""
+
+    code = -32029
+    status = "RESOURCE_EXHAUSTED"
+
+    @property
+    def retry_after(self) -> float:
+        return float(self.data.get("retry_after", 0)) if isinstance(self.data, dict) else 0.0
+
+
+class InvalidParamsError(FlexDBError):
+    """The params are invalid."""
+
+    code = -32602
+    status = "INVALID_ARGUMENT"
+
+
+class InternalError(FlexDBError):
+    """The server failed to run the call."""
+
+    code = -32603
+    status = "INTERNAL"
+
+
+class UnavailableError(FlexDBError):
+    """
+    The server couldn't be reached or didn't answer. sent is False if the
+    request was certainly not received, so retrying a write is safe.
+    """
+
+    code = 0
+    status = "UNAVAILABLE"
+
+    def __init__(self, message: str, sent: bool = True, method: str = ""):
+        super().__init__(message, method=method)
+        self.sent = sent
+
+
+class DeadlineExceededError(UnavailableError):
+    """The call didn't succeed within the timeout of its method config."""
+
+    status = "DEADLINE_EXCEEDED"
+
+
+ERRORS: Dict[int, Type[FlexDBError]] = {
+    cls.code: cls
+    for cls in (
+        UnauthenticatedError, NotFoundError, ValidationError, ConflictError, PermissionDeniedError,
+        FailedPreconditionError, RateLimitedError, InvalidParamsError, InternalError,
+    )
+}
+
+
+def error_from_reply(method: str, error: Dict[str, Any]) -> FlexDBError:
+    """Return the FlexDBError subclass of a JSON-RPC error object."""
+    code = error.get("code", 0)
+    cls = ERRORS.get(code, FlexDBError)
+    return cls(error.get("message", ""), code=code, data=error.get("data"), method=method)
+
+
+def retryable(method: str, error: FlexDBError, policy: Optional[RetryPolicy] = None) -> bool:
+    """Return whether a failed call may be retried, by default or following policy's status codes."""
+    if _unsent(error):
+        return True
+    if policy is not None and policy.retryable_status_codes is not None:
+        return error.status in policy.retryable_status_codes
+    if isinstance(error, RateLimitedError):
+        return True
+    if isinstance(error, UnavailableError) and not isinstance(error, DeadlineExceededError):
+        return method.startswith(_READ_PREFIXES)
+    return False
+
+
+def _unsent(error: FlexDBError) -> bool:
+    """Return whether a call certainly didn't reach the server, so it can be sent again whatever it does."""
+    return isinstance(error, UnavailableError) and not error.sent and not isinstance(error, DeadlineExceededError)
+
+
+# Sends a JSON-RPC request object and returns the reply object; raises
+# FlexDBError subclasses for HTTP and connection failures. Transports taking a
+# timeout keyword are passed the seconds left until the call's deadline.
+Transport = Callable[..., Dict[str, Any]]
+
+
+class HttpTransport:
+    """Sends JSON-RPC requests to a server's /jsonrpc endpoint."""
+
+    def __init__(self, url: str, api_key: str = "", timeout: float = 60.0):
+        self.url = url.rstrip("/")
+        self.api_key = api_key
+        self.timeout = timeout
+
+    def __call__(self, request: Dict[str, Any], timeout: Optional[float] = None) -> Dict[str, Any]:
+        headers = {"Content-Type": "application/json"}
+        if self.api_key:
+            headers["X-API-Key"] = self.api_key
+        http_request = urllib.request.Request(
+            self.url + "/jsonrpc", data=json.dumps(request).encode(), headers=headers, method="POST"
+        )
+        method = request.get("method", "")
+        try:
+            timeout = self.timeout if timeout is None else min(timeout, self.timeout)
+            with urllib.request.urlopen(http_request, timeout=timeout) as response:
+                return json.load(response)
+        except urllib.error.HTTPError as e:
+            body = e.read()
+            try:
+                reply = json.loads(body)
+            except ValueError:
+                reply = None
+            # Authentication failures and lockouts answer with a JSON-RPC error
+            if isinstance(reply, dict) and isinstance(reply.get("error"), dict):
+                return reply
+            message = f"HTTP {e.code}: {body.decode(errors='replace')}"
+            if e.code in _RETRIED_HTTP_STATUSES:
+                raise UnavailableError(message, method=method) from None
+            raise FlexDBError(message, code=e.code, method=method) from None
+        except urllib.error.URLError as e:
+            refused = isinstance(e.reason, OSError) and e.reason.errno == errno.ECONNREFUSED
+            raise UnavailableError(f"cannot reach {self.url}: {e.reason}", sent=not refused, method=method) from None
+        except OSError as e:
+            raise UnavailableError(f"no answer from {self.url}: {e}", method=method) from None
+
+
+def _takes_timeout(transport: Transport) -> bool:
+    """Return whether a transport takes a timeout keyword."""
+    try:
+        return "timeout" in inspect.signature(transport).parameters
+    except (TypeError, ValueError):
+        return False
+
+
+class PageIterator:
+    """
+    Iterates over the items of a list method, fetching pages as needed.
+    total_count is known once the first page was fetched.
+    """
+
+    def __init__(self, client: "FlexDBClient", method: str, key: str, page_size: int, params: Dict[str, Any]):
+        self.client = client
+        self.method = method
+        self.key = key
+        self.page_size = page_size
+        self.params = params
+        self.total_count: Optional[int] = None
+
+    def pages(self) -> Iterator[List[Dict[str, Any]]]:
+        """Yield the items a page at a time."""
+        token = ""
+        while True:
+            result = self.client.call(
+                self.method, pagination={"page_size": self.page_size, "page_token": token}, **self.params
+            )
+            pagination = result.get("pagination") or {}
+            self.total_count = pagination.get("total_count", self.total_count)
+            yield result[self.key]
+            token = pagination.get("next_page_token", "")
+            if not token:
+                return
+
+    def __iter__(self) -> Iterator[Dict[str, Any]]:
+        for page in self.pages():
+            yield from page
+
+    def all(self) -> List[Dict[str, Any]]:
+        """Fetch all pages and return their items."""
+        return list(self)
+
+
+class FlexDBClient:
+    """
+    Calls a FlexDB server's JSON-RPC API, with the timeouts and retry or
+    hedging policies of service_config (by default the published one), or
+    retrying every method following retry if given.
+    """
+
+    def __init__(
+        self,
+        url: str = DEFAULT_URL,
+        api_key: str = "",
+        timeout: float = 60.0,
+        retry: Optional[RetryPolicy] = None,
+        transport: Optional[Transport] = None,
+        sleep: Callable[[float], None] = time.sleep,
+        service_config: Optional[ServiceConfig] = None,
+        clock: Callable[[], float] = time.monotonic
+    ):
+        self.transport = transport or HttpTransport(url, api_key, timeout)
+        self.retry = retry
+        self.service_config = service_config or ServiceConfig.load()
+        self.sleep = sleep
+        self.clock = clock
+        self._next_id = 0
+        self._id_lock = threading.Lock()
+        self._transport_timeouts = _takes_timeout(self.transport)
+
+    def call(self, method: str, **params: Any) -> Dict[str, Any]:
+        """Call a JSON-RPC method, omitting None params, and return its result; raises FlexDBError."""
+        params = {k: v for k, v in params.items() if v is not None}
+        config = self.service_config.for_method(method)
+        deadline = self.clock() + config.timeout if config.timeout else None
+        if self.retry is None and config.hedging and config.hedging.max_attempts > 1:
+            return self._call_hedged(method, params, config.hedging, deadline)
+
+        policy = self.retry or config.retry or RetryPolicy(max_attempts=1)
+        attempt = 1
+        while True:
+            try:
+                return self._send(method, params, deadline)
+            except FlexDBError as e:
+                if attempt >= policy.max_attempts or not retryable(method, e, policy):
+                    raise
+                retry_after = e.retry_after if isinstance(e, RateLimitedError) else 0.0
+                delay = policy.backoff(attempt, retry_after)
+                if deadline is not None and self.clock() + delay >= deadline:
+                    raise
+                self.sleep(delay)
+                attempt += 1
+
+    def _call_hedged(
+        self, method: str, params: Dict[str, Any], hedging: HedgingPolicy, deadline: Optional[float]
+    ) -> Dict[str, Any]:
+        """Send a call every hedging delay without a reply, up to max_attempts at once, and return the first reply."""
+        replies: "queue.Queue[Any]" = queue.Queue()
+
+        def attempt() -> None:
+            try:
+                replies.put(self._send(method, params, deadline))
+            except FlexDBError as e:
+                replies.put(e)
+
+        started = running = 0
+        next_at = self.clock()
+        while True:
+            now = self.clock()
+            if started < hedging.max_attempts and now >= next_at:
+                threading.Thread(target=attempt, name="flexdb-hedge", daemon=True).start()
+                started += 1
+                running += 1
+                next_at = now + hedging.delay
+            # Wait for a reply until the next attempt is due or the deadline passes
+            due = next_at if started < hedging.max_attempts else None
+            waits = [at - now for at in (due, deadline) if at is not None]
+            try:
+                reply = replies.get(timeout=max(0.0, min(waits)) if waits else None)
+            except queue.Empty:
+                if deadline is not None and self.clock() >= deadline:
+                    raise DeadlineExceededError("no reply before the deadline", method=method) from None
+                continue
+            running -= 1
+            if not isinstance(reply, FlexDBError):
+                return reply
+            fatal = reply.status not in hedging.non_fatal_status_codes and not _unsent(reply)
+            if fatal or (running == 0 and started >= hedging.max_attempts):
+                raise reply
+            # A failed attempt is replaced at once, or once a rate limit allows
+            retry_after = reply.retry_after if isinstance(reply, RateLimitedError) else 0.0
+            next_at = min(next_at, self.clock() + retry_after)
+
+    def _send(self, method: str, params: Dict[str, Any], deadline: Optional[float]) -> Dict[str, Any]:
+        """Send one attempt of a call and return its result; raises FlexDBError."""
+        with self._id_lock:
+            self._next_id += 1
+            request = {"jsonrpc": "2.0", "method": method, "params": params, "id": self._next_id}
+        if deadline is not None and self._transport_timeouts:
+            remaining = deadline - self.clock()
+            if remaining <= 0:
+                raise DeadlineExceededError("deadline exceeded before the call was sent", sent=False, method=method)
+            reply = self.transport(request, timeout=remaining)
+        else:
+            reply = self.transport(request)
+        if "error" in reply:
+            raise error_from_reply(method, reply["error"])
+        return reply["result"]
+
+    def paginate(self, method: str, key: str, page_size: int = DEFAULT_PAGE_SIZE, **params: Any) -> PageIterator:
+        """Return an iterator over the items, under key, of all pages of a list method."""
+        return PageIterator(self, method, key, page_size, {k: v for k, v in params.items() if v is not None})
+
+    def tenant(self, tenant_id: str) -> "TenantClient":
+        """Return a client bound to a tenant."""
+        return TenantClient(self, tenant_id)
+
+    # Tenants (admin key)
+
+    def create_tenant(self, slug: str, name: str) -> Dict[str, Any]:
+        return self.call("create_tenant", slug=slug, name=name)["tenant"]
+
+    def get_tenant(self, id: str) -> Dict[str, Any]:
+        return self.call("get_tenant", id=id)["tenant"]
+
+    def list_tenants(self, *, page_size: int = DEFAULT_PAGE_SIZE) -> PageIterator:
+        return self.paginate("list_tenants", "tenants", page_size)
+
+
+class TenantClient:
+    """Calls the API for one tenant, passing its tenant_id."""
+
+    def __init__(self, client: FlexDBClient, tenant_id: str):
+        self.client = client
+        self.tenant_id = tenant_id
+
+    def call(self, method: str, **params: Any) -> Dict[str, Any]:
+        """Call a JSON-RPC method with the tenant's ID."""
+        return self.client.call(method, tenant_id=self.tenant_id, **params)
+
+    def paginate(self, method: str, key: str, page_size: int = DEFAULT_PAGE_SIZE, **params: Any) -> PageIterator:
+        """Return an iterator over all pages of a list method of the tenant."""
+        return self.client.paginate(method, key, page_size, tenant_id=self.tenant_id, **params)
+
+    # Node types
+
+    def create_node_type(
+        self,
+        name: str,
+        *,
+        description: str = "",
+        schema: Optional[Dict[str, Any]] = None,
+        display: Optional[Dict[str, Any]] = None,
+        unique_keys: Optional[List[Any]] = None
+    ) -> Dict[str, Any]:
+        return self.call(
+            "create_node_type",
+            name=name,
+            description=description,
+            schema=_json_text(schema),
+            display=_json_text(display),
+            unique_keys=unique_keys,
+        )["node_type"]
+
+    def get_node_type(self, id: str) -> Dict[str, Any]:
+        return self.call("get_node_type", id=id)["node_type"]
+
+    def batch_get_node_types(self, ids: List[str]) -> Dict[str, Any]:
+        """Get up to 500 node types at once; returns {"node_types": [...], "missing": [IDs not found]}."""
+        return self.call("batch_get_node_types", ids=ids)
+
+    def list_node_types(self, *, page_size: int = DEFAULT_PAGE_SIZE) -> PageIterator:
+        return self.paginate("list_node_types", "node_types", page_size)
+
+    # Nodes
+
+    def create_node(self, node_type_id: str, data: Dict[str, Any]) -> Dict[str, Any]:
+        return _decoded(self.call("create_node", node_type_id=node_type_id, data=json.dumps(data))["node"])
+
+    def get_node(self, id: str, *, locale: str = "") -> Dict[str, Any]:
+        return _decoded(self.call("get_node", id=id, locale=locale or None)["node"])
+
+    def batch_get_nodes(self, ids: List[str], *, locale: str = "") -> Dict[str, Any]:
+        """Get up to 500 nodes at once; returns {"nodes": [...], "missing": [IDs not found]}."""
+        result = self.call("batch_get_nodes", ids=ids, locale=locale or None)
+        return {"nodes": [_decoded(node) for node in result["nodes"]], "missing": result["missing"]}
+
+    def update_node(
+        self, id: str, data: Dict[str, Any], *, expected_version: int = 0, lock_token: str = ""
+    ) -> Dict[str, Any]:
+        """
+        Replace a node's data; with expected_version, fail with ConflictError if
+        it changed since, with lock_token, FailedPreconditionError unless it
+        holds the node's lock.
+        """
+        return _decoded(self.call(
+            "update_node", id=id, data=json.dumps(data), expected_version=expected_version or None,
+            lock_token=lock_token or None,
+        )["node"])
+
+    def delete_node(self, id: str, *, lock_token: str = "") -> None:
+        self.call("delete_node", id=id, lock_token=lock_token or None)
+
+    def acquire_node_lock(
+        self, node_id: str, *, holder: str = "", ttl_seconds: int = 60, lock_token: str = "", enforce: bool = False
+    ) -> Dict[str, Any]:
+        """
+        Lock a node for ttl_seconds, or renew the lock of lock_token; returns
+        {"lock": {...}, "lock_token": ...}. Raises FailedPreconditionError
+        (reason NODE_LOCKED) while someone else holds it.
+        """
+        return self.call(
+            "acquire_node_lock", node_id=node_id, holder=holder or None, ttl_seconds=ttl_seconds,
+            lock_token=lock_token or None, enforce=enforce or None,
+        )
+
+    def get_node_lock(self, node_id: str) -> Optional[Dict[str, Any]]:
+        return self.call("get_node_lock", node_id=node_id)["lock"]
+
+    def release_node_lock(self, node_id: str, lock_token: str) -> bool:
+        return self.call("release_node_lock", node_id=node_id, lock_token=lock_token)["released"]
+
+    def list_nodes(
+        self,
+        node_type_id: str = "",
+        *,
+        filter: Optional[Dict[str, Any]] = None,
+        contains: Optional[Dict[str, Any]] = None,
+        locale: str = "",
+        page_size: int = DEFAULT_PAGE_SIZE
+    ) -> Iterator[Dict[str, Any]]:
+        """Iterate over the nodes, optionally of a node type and matching filter and contains."""
+        pages = self.paginate(
+            "list_nodes", "nodes", page_size,
+            node_type_id=node_type_id or None, filter=filter, contains=contains, locale=locale or None,
+        )
+        return (_decoded(node) for node in pages)
+
+    def count_nodes(
+        self,
+        node_type_id: str = "",
+        *,
+        filter: Optional[Dict[str, Any]] = None,
+        contains: Optional[Dict[str, Any]] = None
+    ) -> int:
+        return self.call(
+            "count_nodes", node_type_id=node_type_id or None, filter=filter, contains=contains
+        )["count"]
+
+    # Relationships
+
+    def create_relationship(
+        self,
+        source_node_id: str,
+        target_node_id: str,
+        relationship_type: str,
+        data: Optional[Dict[str, Any]] = None
+    ) -> Dict[str, Any]:
+        return _decoded(self.call(
+            "create_relationship",
+            source_node_id=source_node_id,
+            target_node_id=target_node_id,
+            relationship_type=relationship_type,
+            data=json.dumps(data or {}),
+        )["relationship"])
+
+    def get_relationship(self, id: str) -> Dict[str, Any]:
+        return _decoded(self.call("get_relationship", id=id)["relationship"])
+
+    def delete_relationship(self, id: str) -> None:
+        self.call("delete_relationship", id=id)
+
+    def list_relationships(
+        self,
+        *,
+        source_node_id: str = "",
+        target_node_id: str = "",
+        relationship_type: str = "",
+        source_node_ids: Optional[List[str]] = None,
+        target_node_ids: Optional[List[str]] = None,
+        relationship_types: Optional[List[str]] = None,
+        page_size: int = DEFAULT_PAGE_SIZE
+    ) -> Iterator[Dict[str, Any]]:
+        """
+        Iterate over the relationships, optionally from or to a node and of a
+        type, or from and to any of several nodes and of any of several types.
+        """
+        pages = self.paginate(
+            "list_relationships", "relationships", page_size,
+            source_node_id=source_node_id or None,
+            target_node_id=target_node_id or None,
+            relationship_type=relationship_type or None,
+            source_node_ids=source_node_ids or None,
+            target_node_ids=target_node_ids or None,
+            relationship_types=relationship_types or None,
+        )
+        return (_decoded(relationship) for relationship in pages)
+
+
+def _json_text(value: Optional[Dict[str, Any]]) -> str:
+    return json.dumps(value) if value else ""
+
+
+def _decoded(entity: Dict[str, Any]) -> Dict[str, Any]:
+    """Return a node or relationship with its data as a dict rather than JSON text."""
+    data = entity.get("data")
+    if isinstance(data, str):
+        try:
+            entity = {**entity, "data": json.loads(data) if data else {}}
+        except ValueError:
+            pass
+    return entity
@@ -0,0 +1,430 @@
+"""
+flexyctl: command line administration of a FlexDB server over its JSON-RPC API.
+
+    python -m flexdb_client.flexyctl tenant create acme "Acme Corp"
+    python -m flexdb_client.flexyctl user add ada@example.com "Ada" --tenant <tenant_id> --role admin
+    python -m flexdb_client.flexyctl node-types apply <tenant_id> node_types.yaml
+    python -m flexdb_client.flexyctl export <tenant_id> -o acme.ndjson
+    python -m flexdb_client.flexyctl import <tenant_id> acme.ndjson
+    python -m flexdb_client.flexyctl migrate <tenant_id> <node_type_id> --transform transform.json --wait
+    python -m flexdb_client.flexyctl quota get <tenant_id>
+
+The server is FLEXDB_URL (or --url, default http://localhost:5000), called
+with the API key FLEXDB_API_KEY (or --api-key). Results are printed as JSON;
+failed calls print the JSON-RPC error and exit with status 1.
+
+A node type file lists node types in YAML (or JSON), with schema and display
+as objects rather than JSON text:
+
+    node_types:
+      - name: Article
+        description: Blog article
+        schema:
+          title: {type: string, required: true}
+          slug: string
+        unique_keys: [slug]
+
+`node-types apply` creates the node types that don't exist yet, by name, and
+updates the description, schema and display of the others. Unique keys are
+fixed when a node type is created, so changing them fails. YAML files need
+PyYAML.
+
+Like the rest of flexdb_client, this only uses the standard library (and
+PyYAML for YAML files), so it runs without the server's dependencies.
+"""
+
+import argparse
+import json
+import os
+import sys
+import time
+import urllib.error
+import urllib.parse
+import urllib.request
+from typing import Any, Callable, Dict, Iterable, Iterator, List, Optional, TextIO
+
+DEFAULT_URL = "http://localhost:5000"
+# Seconds between polls of a migration with --wait
+MIGRATION_POLL_INTERVAL = 2.0
+_NODE_TYPE_FIELDS = ("name", "description", "schema", "display", "unique_keys")
+
+
+class CommandError(Exception):
+    """A failed call or invalid input; the message is printed and flexyctl exits with status 1."""
+
+
+class Client:
+    """Calls the JSON-RPC and streaming endpoints of a FlexDB server."""
+
+    def __init__(self, url: str, api_key: str = "", timeout: float = 60.0):
+        self.url = url.rstrip("/")
+        self.api_key = api_key
+        self.timeout = timeout
+        self._next_id = 0
+
+    def call(self, method: str, **params: Any) -> Dict[str, Any]:
+        """Call a JSON-RPC method, omitting None params; raises CommandError with its error."""
+        self._next_id += 1
+        body = json.dumps({
+            "jsonrpc": "2.0",
+            "method": method,
+            "params": {k: v for k, v in params.items() if v is not None},
+            "id": self._next_id,
+        }).encode()
+        with self._open("POST", "/jsonrpc", body, "application/json") as response:
+            reply = json.load(response)
+        if "error" in reply:
+            error = reply["error"]
+            raise CommandError(f"{method} failed ({error.get('code')}): {error.get('message')}")
+        return reply["result"]
+
+    def stream(
+        self, method: str, path: str, params: Dict[str, Any], body: Optional[Iterable[bytes]] = None
+    ) -> Iterator[str]:
+        """Call a streaming endpoint and yield the lines of its NDJSON response."""
+        with self._open(method, f"{path}?{urllib.parse.urlencode(params)}", body, "application/x-ndjson") as response:
+            for line in response:
+                if line.strip():
+                    yield line.decode("utf-8").rstrip("\n")
+
+    def _open(self, method: str, path: str, body: Any, content_type: str):
+        headers = {"Content-Type": content_type}
+        if self.api_key:
+            headers["X-API-Key"] = self.api_key
+        request = urllib.request.Request(self.url + path, data=body, headers=headers, method=method)
+        try:
+            return urllib.request.urlopen(request, timeout=self.timeout)
+        except urllib.error.HTTPError as e:
+            detail = e.read().decode(errors="replace")
+            raise CommandError(f"{method} {path.split('?')[0]} failed: HTTP {e.code}: {detail}")
+        except urllib.error.URLError as e:
+            raise CommandError(f"cannot reach {self.url}: {e.reason}")
+
+
+def load_node_types(text: str, filename: str = "") -> List[Dict[str, Any]]:
+    """Parse a node type file into create_node_type params."""
+    if filename.endswith((".yaml", ".yml")):
+        try:
+            import yaml
+        except ImportError:
+            raise CommandError("YAML node type files need PyYAML (pip install pyyaml)") from None
+        try:
+            doc = yaml.safe_load(text)
+        except yaml.YAMLError as e:
+            raise CommandError(f"invalid YAML in {filename}: {e}") from None
+    else:
+        try:
+            doc = json.loads(text)
+        except ValueError as e:
+            raise CommandError(f"invalid JSON in {filename or 'node type file'}: {e}") from None
+
+    items = doc.get("node_types") if isinstance(doc, dict) else doc
+    if not isinstance(items, list):
+        raise CommandError("node type file must have a node_types list")
+
+    node_types = []
+    for i, item in enumerate(items):
+        if not isinstance(item, dict) or not isinstance(item.get("name"), str) or not item["name"]:
+            raise CommandError(f"node_types[{i}] must be an object with a name")
+        unknown = set(item) - set(_NODE_TYPE_FIELDS)
+        if unknown:
+            raise CommandError(f"node_types[{i}] has unknown fields: {', '.join(sorted(unknown))}")
+        params = {
+            "name": item["name"],
+            "description": item.get("description") or "",
+            "schema": _json_text(item.get("schema")),
+            "display": _json_text(item.get("display")),
+        }
+        if item.get("unique_keys"):
+            params["unique_keys"] = item["unique_keys"]
+        node_types.append(params)
+    return node_types
+
+
+def apply_node_types(client: Client, tenant_id: str, node_types: List[Dict[str, Any]]) -> List[Dict[str, str]]:
+    """Create or update node types by name; returns the action taken for each."""
+    existing = {nt["name"]: nt for nt in _list_all(client, "list_node_types", "node_types", tenant_id=tenant_id)}
+    actions = []
+    for params in node_types:
+        current = existing.get(params["name"])
+        if current is None:
+            result = client.call("create_node_type", tenant_id=tenant_id, **params)
+            actions.append({"name": params["name"], "id": result["node_type"]["id"], "action": "created"})
+            continue
+
+        keys = [[k] if isinstance(k, str) else k for k in params.get("unique_keys", [])]
+        if keys != current["unique_keys"]:
+            raise CommandError(f"node type {params['name']}: unique keys can't be changed after it is created")
+        if _same_node_type(current, params):
+            actions.append({"name": params["name"], "id": current["id"], "action": "unchanged"})
+            continue
+        client.call(
+            "update_node_type",
+            id=current["id"],
+            tenant_id=tenant_id,
+            description=params["description"],
+            schema=params["schema"],
+            display=params["display"],
+            expected_version=current["version"],
+        )
+        actions.append({"name": params["name"], "id": current["id"], "action": "updated"})
+    return actions
+
+
+def wait_for_migration(
+    client: Client,
+    tenant_id: str,
+    migration: Dict[str, Any],
+    out: TextIO,
+    sleep: Callable[[float], None] = time.sleep
+) -> Dict[str, Any]:
+    """Poll a node migration until it is no longer pending or running, printing its progress."""
+    while migration["status"] in ("pending", "running"):
+        out.write(
+            f"{migration['status']}: {migration['migrated_count']} migrated, {migration['failed_count']} failed\n"
+        )
+        sleep(MIGRATION_POLL_INTERVAL)
+        migration = client.call("get_node_migration", id=migration["id"], tenant_id=tenant_id)["migration"]
+    return migration
+
+
+def _list_all(client: Client, method: str, key: str, **params: Any) -> Iterator[Dict[str, Any]]:
+    token = ""
+    while True:
+        result = client.call(method, pagination={"page_size": 100, "page_token": token}, **params)
+        yield from result[key]
+        token = result["pagination"]["next_page_token"]
+        if not token:
+            return
+
+
+def _same_node_type(current: Dict[str, Any], params: Dict[str, Any]) -> bool:
+    return (
+        current["description"] == params["description"]
+        and _json_value(current["schema"]) == _json_value(params["schema"])
+        and _json_value(current["display"]) == _json_value(params["display"])
+    )
+
+
+def _json_text(value: Any) -> str:
+    if value is None or value == "":
+        return ""
+    return value if isinstance(value, str) else json.dumps(value)
+
+
+def _json_value(text: str) -> Any:
+    try:
+        return json.loads(text) if text else None
+    except ValueError:
+        return text
+
+
+def _read_file(path: str) -> str:
+    try:
+        with open(path, encoding="utf-8") as f:
+            return f.read()
+    except OSError as e:
+        raise CommandError(f"cannot read {path}: {e.strerror}") from None
+
+
+def _print(out: TextIO, value: Any) -> None:
+    out.write(json.dumps(value, indent=2) + "\n")
+
+
+def _file_chunks(path: str, size: int = 64 * 1024) -> Iterator[bytes]:
+    with open(path, "rb") as f:
+        while True:
+            chunk = f.read(size)
+            if not chunk:
+                return
+            yield chunk
+
+
+def run(args: argparse.Namespace, client: Client, out: TextIO = sys.stdout) -> None:
+    """Run a parsed command."""
+    if args.command == "tenant":
+        if args.action == "create":
+            _print(out, client.call("create_tenant", slug=args.slug, name=args.name)["tenant"])
+        elif args.action == "get":
+            _print(out, client.call("get_tenant", id=args.tenant_id)["tenant"])
+        else:
+            _print(out, list(_list_all(client, "list_tenants", "tenants")))
+
+    elif args.command == "user":
+        user = client.call("create_user", email=args.email, display_name=args.display_name)["user"]
+        if args.tenant:
+            client.call("add_user_to_tenant", tenant_id=args.tenant, user_id=user["id"], role=args.role)
+        _print(out, user)
+
+    elif args.command == "node-types":
+        if args.action == "apply":
+            node_types = load_node_types(_read_file(args.file), args.file)
+            _print(out, apply_node_types(client, args.tenant_id, node_types))
+        else:
+            _print(out, list(_list_all(client, "list_node_types", "node_types", tenant_id=args.tenant_id)))
+
+    elif args.command == "export":
+        target = open(args.output, "w", encoding="utf-8") if args.output else out
+        try:
+            for line in client.stream("GET", "/stream/export", {"tenant_id": args.tenant_id}):
+                # Records have a type; a failed export ends with an {"error": {...}} line
+                if line.startswith('{"error"'):
+                    raise CommandError(f"export failed: {json.loads(line)['error'].get('message')}")
+                target.write(line + "\n")
+        finally:
+            if args.output:
+                target.close()
+
+    elif args.command == "import":
+        result = None
+        params = {"tenant_id": args.tenant_id, "on_conflict": args.on_conflict}
+        if args.dry_run:
+            params["dry_run"] = "true"
+        if args.resume:
+            params["resume"] = args.resume
+        if args.report:
+            params["report"] = "true"
+        verb = "would be created" if args.dry_run else "created"
+        report = open(args.report, "w", encoding="utf-8") if args.report else None
+        try:
+            for line in client.stream("POST", "/stream/import", params, _file_chunks(args.file)):
+                reply = json.loads(line)
+                if "error" in reply:
+                    resume = ""
+                    if reply.get("operation") and not args.dry_run:
+                        resume = f"; resume with --resume {reply['operation'].rsplit('/', 1)[-1]}"
+                    raise CommandError(
+                        f"import failed: {reply['error'].get('message')} (progress: {reply.get('progress')}){resume}"
+                    )
+                if "progress" in reply:
+                    progress = reply["progress"]
+                    message = (
+                        f"{progress['lines']} lines: {progress['node_types_created']} node types, "
+                        f"{progress['nodes_created']} nodes, {progress['relationships_created']} relationships {verb}"
+                    )
+                    if args.on_conflict != "fail":
+                        message += (
+                            f"; existing nodes: {progress['nodes_skipped']} skipped, "
+                            f"{progress['nodes_overwritten']} overwritten, {progress['nodes_merged']} merged"
+                        )
+                    out.write(message + "\n")
+                if report:
+                    for row in reply.get("rows", []):
+                        report.write(json.dumps(row) + "\n")
+                result = reply.get("result", result)
+        finally:
+            if report:
+                report.close()
+        _print(out, result)
+
+    elif args.command == "migrate":
+        transform = ""
+        if args.transform:
+            transform = _read_file(args.transform) if os.path.exists(args.transform) else args.transform
+        migration = client.call(
+            "start_node_migration",
+            tenant_id=args.tenant_id,
+            node_type_id=args.node_type_id,
+            transform=transform,
+            batch_size=args.batch_size,
+        )["migration"]
+        if args.wait:
+            migration = wait_for_migration(client, args.tenant_id, migration, out)
+        _print(out, migration)
+        if migration["status"] == "failed":
+            raise CommandError(f"migration failed: {migration.get('error')}")
+
+    elif args.command == "quota":
+        if args.action == "get":
+            _print(out, client.call("get_tenant_quota", id=args.tenant_id))
+        else:
+            _print(out, client.call(
+                "set_tenant_quota",
+                id=args.tenant_id,
+                requests_per_second=args.rps,
+                burst=args.burst,
+                api_key_requests_per_second=args.api_key_rps,
+                api_key_burst=args.api_key_burst,
+            ))
+
+
+def parse_args(argv: Optional[List[str]] = None) -> argparse.Namespace:
+    """Parse flexyctl's command line."""
+    parser = argparse.ArgumentParser(prog="flexyctl", description="Administer a FlexDB server.")
+    parser.add_argument("--url", default=os.getenv("FLEXDB_URL", DEFAULT_URL), help="server URL (FLEXDB_URL)")
+    parser.add_argument("--api-key", default=os.getenv("FLEXDB_API_KEY", ""), help="API key (FLEXDB_API_KEY)")
+    commands = parser.add_subparsers(dest="command", required=True)
+
+    tenant = commands.add_parser("tenant", help="create, get and list tenants")
+    tenant = tenant.add_subparsers(dest="action", required=True)
+    create = tenant.add_parser("create", help="create a tenant")
+    create.add_argument("slug")
+    create.add_argument("name")
+    tenant.add_parser("get", help="get a tenant").add_argument("tenant_id")
+    tenant.add_parser("list", help="list all tenants")
+
+    user = commands.add_parser("user", help="add users")
+    user = user.add_subparsers(dest="action", required=True)
+    add = user.add_parser("add", help="create a user, optionally adding it to a tenant")
+    add.add_argument("email")
+    add.add_argument("display_name")
+    add.add_argument("--tenant", help="tenant to add the user to")
+    add.add_argument("--role", default="", help="role in the tenant")
+
+    node_types = commands.add_parser("node-types", help="define node types")
+    node_types = node_types.add_subparsers(dest="action", required=True)
+    apply = node_types.add_parser("apply", help="create or update node types from a YAML or JSON file")
+    apply.add_argument("tenant_id")
+    apply.add_argument("file")
+    node_types.add_parser("list", help="list a tenant's node types").add_argument("tenant_id")
+
+    export = commands.add_parser("export", help="export a tenant's data as NDJSON")
+    export.add_argument("tenant_id")
+    export.add_argument("-o", "--output", help="file to write (default: standard output)")
+
+    imp = commands.add_parser("import", help="import an NDJSON export into a tenant")
+    imp.add_argument("tenant_id")
+    imp.add_argument("file")
+    imp.add_argument("--dry-run", action="store_true", help="validate the file without importing it")
+    imp.add_argument("--resume", metavar="JOB_ID", help="resume a failed import of the same file")
+    imp.add_argument(
+        "--on-conflict",
+        choices=["fail", "skip", "overwrite", "merge_patch"],
+        default="fail",
+        help="how to handle nodes matching an existing node by a unique key (default: fail)",
+    )
+    imp.add_argument("--report", metavar="FILE", help="write the outcome of every record to FILE as NDJSON")
+
+    migrate = commands.add_parser("migrate", help="migrate a node type's outdated nodes to its current schema")
+    migrate.add_argument("tenant_id")
+    migrate.add_argument("node_type_id")
+    migrate.add_argument("--transform", help="transform operations: a JSON array or a file holding one")
+    migrate.add_argument("--batch-size", type=int, default=500)
+    migrate.add_argument("--wait", action="store_true", help="wait until the migration finishes")
+
+    quota = commands.add_parser("quota", help="inspect and set tenant quotas")
+    quota = quota.add_subparsers(dest="action", required=True)
+    quota.add_parser("get", help="show a tenant's quota and effective limits").add_argument("tenant_id")
+    set_quota = quota.add_parser("set", help="replace a tenant's quota; omitted limits use the server defaults")
+    set_quota.add_argument("tenant_id")
+    set_quota.add_argument("--rps", type=float, help="requests per second of the tenant")
+    set_quota.add_argument("--burst", type=int, help="requests the tenant may make at once")
+    set_quota.add_argument("--api-key-rps", type=float, help="requests per second of each API key")
+    set_quota.add_argument("--api-key-burst", type=int, help="requests each API key may make at once")
+
+    return parser.parse_args(argv)
+
+
+def main(argv: Optional[List[str]] = None) -> int:
+    """Run flexyctl; returns the exit status."""
+    args = parse_args(argv)
+    try:
+        run(args, Client(args.url, args.api_key))
+    except CommandError as e:
+        sys.stderr.write(f"flexyctl: {e}\n")
+        return 1
+    return 0
+
+
+if __name__ == "__main__":
+    sys.exit(main())
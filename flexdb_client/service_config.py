@@ -0,0 +1,175 @@
+"""
+Per-method timeouts, retries and hedging of the SDK, read from a service config.
+
+The config follows the layout of a gRPC service config, so clients in other
+languages can read the same file: a list of methodConfig entries, each naming
+the JSON-RPC methods it applies to and giving their timeout and either a
+retryPolicy or a hedgingPolicy:
+
+    {"methodConfig": [
+        {"name": [{}], "timeout": "60s",
+         "retryPolicy": {"maxAttempts": 4, "initialBackoff": "0.2s", "maxBackoff": "5s",
+                         "backoffMultiplier": 2, "retryableStatusCodes": ["RESOURCE_EXHAUSTED"]}},
+        {"name": [{"prefix": "get_"}, {"method": "list_nodes"}], "timeout": "30s",
+         "hedgingPolicy": {"maxAttempts": 3, "hedgingDelay": "0.5s",
+                           "nonFatalStatusCodes": ["UNAVAILABLE", "RESOURCE_EXHAUSTED"]}}
+    ]}
+
+A name is a method ({"method": "get_node"}), a method prefix ({"prefix":
+"get_"}) or, when empty, every other method; an exact method takes precedence
+over the longest matching prefix, which takes precedence over the default.
+Durations are seconds with an "s" suffix. Status codes are the gRPC names of
+the FlexDBError subclasses (their status attribute), e.g. UNAVAILABLE for
+UnavailableError and RESOURCE_EXHAUSTED for RateLimitedError.
+
+Hedging sends the call again whenever hedgingDelay passes without a reply,
+up to maxAttempts calls at once, and returns the first reply; it is only
+configured for reads, which may safely run more than once. A call that
+certainly didn't reach the server is always retried, whatever its policy.
+
+DEFAULT_SERVICE_CONFIG_PATH is the config used by default, published next to
+this module (flexdb_client/service_config.json).
+"""
+
+import json
+import os
+import random
+import re
+from dataclasses import dataclass, field
+from typing import Any, Dict, List, Optional, Tuple
+
+DEFAULT_SERVICE_CONFIG_PATH = os.path.join(os.path.dirname(os.path.abspath(__file__)), "service_config.json")
+
+_DURATION = re.compile(r"^(\d+(?:\.\d+)?)s$")
+
+
+def parse_duration(value: Any) -> float:
+    """Return the seconds of a duration like "0.5s"; raises ValueError if it is malformed."""
+    match = _DURATION.match(value) if isinstance(value, str) else None
+    if not match:
+        raise ValueError(f"invalid duration: {value!r} (expected seconds like \"0.5s\")")
+    return float(match.group(1))
+
+
+@dataclass
+class RetryPolicy:
+    """Exponential backoff between attempts of a call; max_attempts=1 disables retries."""
+    max_attempts: int = 4
+    # Seconds before the first retry, multiplied by multiplier for each further one
+    initial_backoff: float = 0.2
+    max_backoff: float = 5.0
+    multiplier: float = 2.0
+    # Wait a random fraction of the backoff, so clients don't retry in lockstep
+    jitter: bool = True
+    # Status codes of the errors retried; None retries rate limited calls, and
+    # reads whenever the server was unavailable (see client.retryable)
+    retryable_status_codes: Optional[Tuple[str, ...]] = None
+
+    def backoff(self, retry: int, retry_after: float = 0.0) -> float:
+        """Return the seconds to wait before the retry-th retry (1 for the first), at least retry_after."""
+        delay = min(self.max_backoff, self.initial_backoff * self.multiplier ** (retry - 1))
+        if self.jitter:
+            delay = random.uniform(delay / 2, delay)
+        return max(delay, retry_after)
+
+
+@dataclass
+class HedgingPolicy:
+    """Sends a call again every delay seconds without a reply, up to max_attempts calls at once."""
+    max_attempts: int = 3
+    delay: float = 0.5
+    # Status codes of the failed calls that don't fail the call while others may still succeed
+    non_fatal_status_codes: Tuple[str, ...] = ("UNAVAILABLE", "RESOURCE_EXHAUSTED")
+
+
+@dataclass
+class MethodConfig:
+    """The timeout and retry or hedging policy of methods; None timeout waits as long as the transport."""
+    timeout: Optional[float] = None
+    retry: Optional[RetryPolicy] = None
+    hedging: Optional[HedgingPolicy] = None
+
+
+@dataclass
+class ServiceConfig:
+    """Method configs by method, by method prefix and for every other method."""
+    methods: Dict[str, MethodConfig] = field(default_factory=dict)
+    prefixes: Dict[str, MethodConfig] = field(default_factory=dict)
+    default: MethodConfig = field(default_factory=MethodConfig)
+
+    def for_method(self, method: str) -> MethodConfig:
+        """Return the config of a method."""
+        config = self.methods.get(method)
+        if config is not None:
+            return config
+        matching = [prefix for prefix in self.prefixes if method.startswith(prefix)]
+        if matching:
+            return self.prefixes[max(matching, key=len)]
+        return self.default
+
+    @classmethod
+    def from_dict(cls, raw: Dict[str, Any]) -> "ServiceConfig":
+        """Parse a service config object; raises ValueError if it is invalid."""
+        config = cls()
+        seen = set()
+        for entry in raw.get("methodConfig") or []:
+            method_config = _method_config(entry)
+            for name in entry.get("name") or []:
+                if "method" in name:
+                    key, target = ("method", name["method"]), config.methods
+                elif "prefix" in name:
+                    key, target = ("prefix", name["prefix"]), config.prefixes
+                elif not name:
+                    key, target = ("default", ""), None
+                else:
+                    raise ValueError(f"invalid method config name: {name}")
+                if key in seen:
+                    raise ValueError(f"duplicate method config name: {name}")
+                seen.add(key)
+                if target is None:
+                    config.default = method_config
+                else:
+                    target[key[1]] = method_config
+        return config
+
+    @classmethod
+    def load(cls, path: str = DEFAULT_SERVICE_CONFIG_PATH) -> "ServiceConfig":
+        """Read a service config file, by default the one published with the SDK."""
+        with open(path) as f:
+            return cls.from_dict(json.load(f))
+
+
+def _method_config(entry: Dict[str, Any]) -> MethodConfig:
+    if "retryPolicy" in entry and "hedgingPolicy" in entry:
+        raise ValueError("a method config has a retryPolicy or a hedgingPolicy, not both")
+    config = MethodConfig()
+    if "timeout" in entry:
+        config.timeout = parse_duration(entry["timeout"])
+    if "retryPolicy" in entry:
+        raw = entry["retryPolicy"]
+        config.retry = RetryPolicy(
+            max_attempts=_attempts(raw),
+            initial_backoff=parse_duration(raw.get("initialBackoff", "0.2s")),
+            max_backoff=parse_duration(raw.get("maxBackoff", "5s")),
+            multiplier=float(raw.get("backoffMultiplier", 2)),
+            retryable_status_codes=_status_codes(raw.get("retryableStatusCodes")),
+        )
+    if "hedgingPolicy" in entry:
+        raw = entry["hedgingPolicy"]
+        config.hedging = HedgingPolicy(
+            max_attempts=_attempts(raw),
+            delay=parse_duration(raw.get("hedgingDelay", "0s")),
+            non_fatal_status_codes=_status_codes(raw.get("nonFatalStatusCodes")),
+        )
+    return config
+
+
+def _attempts(raw: Dict[str, Any]) -> int:
+    attempts = raw.get("maxAttempts")
+    if not isinstance(attempts, int) or attempts < 1:
+        raise ValueError(f"maxAttempts must be a positive integer, got {attempts!r}")
+    return attempts
+
+
+def _status_codes(codes: Optional[List[str]]) -> Tuple[str, ...]:
+    return tuple(code.upper() for code in codes or [])
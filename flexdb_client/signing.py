@@ -0,0 +1,80 @@
+"""
+Signing requests to FlexDB public endpoints and verifying FlexDB webhooks.
+
+Both use the X-FlexDB-Signature header, "t=<unix timestamp>,v1=<hex
+HMAC-SHA256>", with the HMAC computed over "<timestamp>.<body>" (see
+app/events/signing.py on the server).
+
+Signing a submission to an intake form that requires signatures:
+
+    body = json.dumps(data).encode()
+    headers = {"Content-Type": "application/json", **sign_request(secret, body)}
+    requests.post(form_url, data=body, headers=headers)
+
+Verifying a webhook delivery, on the raw request body:
+
+    verify_webhook(endpoint_secret, request.headers["X-FlexDB-Signature"], request.body)
+"""
+
+import hashlib
+import hmac
+import time
+from typing import Dict, List, Optional
+
+SIGNATURE_HEADER = "X-FlexDB-Signature"
+
+# Seconds a signature's timestamp may differ from the local clock
+DEFAULT_TOLERANCE = 300
+
+
+class SignatureError(Exception):
+    """Raised when a webhook signature is missing, invalid or too old."""
+
+
+def _signature(secret: str, timestamp: int, body: bytes) -> str:
+    message = f"{timestamp}.".encode() + body
+    return hmac.new(secret.encode(), message, hashlib.sha256).hexdigest()
+
+
+def sign_request(secret: str, body: bytes, timestamp: Optional[int] = None) -> Dict[str, str]:
+    """Return the headers signing body with secret, at timestamp (default now)."""
+    if timestamp is None:
+        timestamp = int(time.time())
+    return {SIGNATURE_HEADER: f"t={timestamp},v1={_signature(secret, timestamp, body)}"}
+
+
+def verify_webhook(
+    secret: str,
+    header: str,
+    body: bytes,
+    tolerance: float = DEFAULT_TOLERANCE,
+    now: Optional[float] = None
+) -> int:
+    """
+    Verify the signature header of a webhook delivery against its body.
+    Returns the signature's timestamp; raises SignatureError if it is invalid
+    or more than tolerance seconds from now (a tolerance of 0 accepts any).
+    """
+    timestamp: Optional[int] = None
+    signatures: List[str] = []
+    for item in (header or "").split(","):
+        key, sep, value = item.strip().partition("=")
+        if not sep:
+            continue
+        if key == "t":
+            try:
+                timestamp = int(value)
+            except ValueError:
+                raise SignatureError("invalid signature timestamp")
+        elif key == "v1":
+            signatures.append(value)
+
+    if timestamp is None or not signatures:
+        raise SignatureError("missing signature")
+    if tolerance > 0 and abs((time.time() if now is None else now) - timestamp) > tolerance:
+        raise SignatureError("signature timestamp is outside the tolerance")
+
+    expected = _signature(secret, timestamp, body)
+    if not any(hmac.compare_digest(expected, signature) for signature in signatures):
+        raise SignatureError("signature does not match")
+    return timestamp
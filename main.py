@@ -5,63 +5,221 @@ flex-db Python Backend - Main Entry Point
 A Database-as-a-Service (DBaaS) implemented in Python with JSON-RPC API.
 """
 
+import argparse
+import asyncio
+import getpass
 import logging
 import os
 import sys
+from dataclasses import replace
+from datetime import datetime, timezone
+from typing import Optional
 
 from contextlib import asynccontextmanager
 from dotenv import load_dotenv
 from fastapi import FastAPI
 from fastapi.middleware.cors import CORSMiddleware
+from fastapi.responses import JSONResponse
 import uvicorn
 
-from app.config import config_from_env
+from app.config import (
+    analytics_config_from_env,
+    api_key_policy_config_from_env,
+    attachment_config_from_env,
+    audit_export_config_from_env,
+    auth_config_from_env,
+    backup_verify_config_from_env,
+    bi_views_config_from_env,
+    cdc_config_from_env,
+    cluster_config_from_env,
+    compliance_config_from_env,
+    concurrency_limit_config_from_env,
+    config_from_env,
+    encryption_config_from_env,
+    export_storage_config_from_env,
+    failover_config_from_env,
+    intake_config_from_env,
+    job_scheduler_config_from_env,
+    lake_export_config_from_env,
+    load_shed_config_from_env,
+    logging_config_from_env,
+    metrics_config_from_env,
+    node_migration_config_from_env,
+    node_type_catalog_config_from_env,
+    plugin_config_from_env,
+    probe_config_from_env,
+    query_cache_config_from_env,
+    rate_limit_config_from_env,
+    retention_config_from_env,
+    tenant_deletion_config_from_env,
+    tenant_slug_config_from_env,
+    validator_cache_config_from_env,
+    shutdown_config_from_env,
+    tenant_template_config_from_env,
+    tls_config_from_env,
+    webhook_config_from_env,
+)
 from app.db import (
+    BACKFILLS,
+    end_dual_write,
+    run_backfill,
+    apply_routing,
+    promote_standby,
     connect_control_db,
     run_control_migrations,
+    migrate_control_down,
     ensure_control_database_exists,
+    check_role,
+    version_number,
     TenantDatabaseManager,
+    ReplicaDatabaseManager,
+    pool_metric_lines,
 )
 from app.repository import (
-    TenantRepository,
-    UserRepository,
+    BULK_BACKFILL,
+    ApiKeyRepository,
+    AuditEvent,
+    AuditRepository,
+    BackupVerificationRepository,
+    BulkJob,
+    BulkJobRepository,
+    ServerInstanceRepository,
 )
 from app.service import (
+    ApiKeyService,
+    AuditService,
+    AuthGuard,
+    BulkJobService,
+    ClusterService,
     TenantService,
+    TenantTemplateService,
     UserService,
+    load_tenant_templates,
+)
+from app.cluster import (
+    API_KEY_POLICY,
+    AUDIT_EXPORT,
+    BACKUP_VERIFY,
+    LAKE_EXPORT,
+    RETENTION,
+    ClusterMembership,
+    configure_cluster,
+)
+from app.encryption import configure_kms, local_kms_from_config
+from app.events import CdcPublisher, WebhookDispatcher, broker_from_config
+from app.jobs import (
+    ApiKeyPolicyWorker,
+    AuditExporter,
+    BackupVerifier,
+    CanaryProber,
+    JobScheduler,
+    NodeMigrationWorker,
+    RetentionSweeper,
+    TenantDeletionWorker,
+    build_bundle,
+    collect_evidence,
+    verify_audit_exports,
+    verify_bundle,
 )
+from app.lake import LakeExporter, object_store_from_config
+from app.blobs import blob_store_from_config
 from app.jsonrpc import register_methods, jsonrpc_router
-from app.api.dependencies import set_tenant_db_manager
+from app.jsonrpc.analytics import set_replica_manager
+from app.jsonrpc.server import (
+    add_metrics_collector,
+    configure_auth,
+    configure_call_logging,
+    configure_concurrency_limits,
+    configure_intake,
+    configure_load_shedding,
+    configure_metrics,
+    configure_plugins,
+    configure_rate_limits,
+)
+from app.logs import REQUEST_ID_HEADER, RequestIdMiddleware, configure_logging
+from app.api.dependencies import (
+    configure_attachments,
+    configure_bi_views,
+    configure_export_storage,
+    configure_node_type_catalog,
+    configure_query_cache,
+    configure_validator_cache,
+    resolve_tenant_services,
+    set_tenant_db_manager,
+    set_tenant_services_factory,
+)
+from app.storage import (
+    POSTGRES,
+    SQLITE,
+    STORAGE_BACKENDS,
+    LocalTenantServices,
+    MemoryStorage,
+    PostgresStorage,
+    SqliteStorage,
+)
+from app.api.shutdown import NOT_SERVING, GracefulServer, configure_shutdown, shutdown_coordinator
+from app.api.tls import uvicorn_options
 
 # Configure logging
-logging.basicConfig(
-    level=logging.INFO,
-    format="%(asctime)s - %(levelname)s - %(message)s",
-    datefmt="%Y-%m-%d %H:%M:%S",
-)
+configure_logging(logging_config_from_env())
 logger = logging.getLogger(__name__)
 
 # Global database instances
 _control_db = None
 _tenant_db_manager = None
+_replica_db_manager = None
+_webhook_dispatcher = None
+_lake_exporter = None
+_blob_store = None
+_export_store = None
+_cdc_publisher = None
+_node_migration_worker = None
+_api_key_policy_worker = None
+_audit_exporter = None
+_backup_verifier = None
+_canary_prober = None
+_retention_sweeper = None
+_tenant_deletion_worker = None
+_cluster_membership = None
+_job_scheduler = None
+
+
+def load_env_file() -> None:
+    """Load environment variables from .env.local if it exists."""
+    env_file = os.path.join(os.path.dirname(__file__), ".env.local")
+    if os.path.exists(env_file):
+        load_dotenv(env_file)
+        logger.info(f"Loaded environment from {env_file}")
+
+
+def database_config():
+    """Load the database configuration, pointed at the primary named by FAILOVER_ROUTING_FILE if set."""
+    return apply_routing(config_from_env(), failover_config_from_env())
 
 
 @asynccontextmanager
 async def lifespan(app: FastAPI):
     """Lifespan context manager for FastAPI app."""
-    global _control_db, _tenant_db_manager
+    global _control_db, _tenant_db_manager, _replica_db_manager, _webhook_dispatcher, _lake_exporter, _cdc_publisher
+    global _node_migration_worker, _api_key_policy_worker, _audit_exporter, _backup_verifier, _cluster_membership
+    global _job_scheduler, _retention_sweeper, _tenant_deletion_worker, _blob_store, _canary_prober, _export_store
     
     # Startup
     logger.info("Starting up...")
     
     # Load environment variables from .env.local if it exists
-    env_file = os.path.join(os.path.dirname(__file__), ".env.local")
-    if os.path.exists(env_file):
-        load_dotenv(env_file)
-        logger.info(f"Loaded environment from {env_file}")
+    load_env_file()
 
     # Load configuration from environment variables
-    cfg = config_from_env()
+    cfg = database_config()
+
+    if cfg.storage_backend not in STORAGE_BACKENDS:
+        logger.error(f"STORAGE_BACKEND must be one of {', '.join(STORAGE_BACKENDS)}: {cfg.storage_backend}")
+        sys.exit(1)
+    if cfg.storage_backend != POSTGRES:
+        async with local_storage_lifespan(cfg):
+            yield
+        return
 
     # Ensure control database exists
     logger.info("Ensuring control database exists...")
@@ -90,6 +248,17 @@ async def lifespan(app: FastAPI):
         await _control_db.close()
         sys.exit(1)
 
+    # Row-level security policies only apply to ordinary roles
+    if cfg.rls_enabled:
+        try:
+            async with _control_db.pool.acquire() as conn:
+                await check_role(conn)
+            logger.info("Row-level security tenant isolation enabled")
+        except Exception as e:
+            logger.error(f"Failed to enable row-level security: {e}")
+            await _control_db.close()
+            sys.exit(1)
+
     # Initialize tenant database manager
     logger.info("Initializing tenant database manager...")
     try:
@@ -101,30 +270,377 @@ async def lifespan(app: FastAPI):
         await _control_db.close()
         sys.exit(1)
 
+    # Route the analytics endpoint to the read replica
+    analytics_cfg = analytics_config_from_env()
+    if analytics_cfg.enabled:
+        try:
+            _replica_db_manager = ReplicaDatabaseManager(cfg, analytics_cfg, _control_db)
+            set_replica_manager(_replica_db_manager, analytics_cfg)
+            logger.info(f"Analytics endpoint enabled (replica: {analytics_cfg.host}:{analytics_cfg.port})")
+        except Exception as e:
+            logger.error(f"Failed to initialize analytics replica: {e}")
+            await _control_db.close()
+            sys.exit(1)
+
     # Initialize control database repositories
-    tenant_repo = TenantRepository(_control_db)
-    user_repo = UserRepository(_control_db)
+    control = PostgresStorage(_control_db, _tenant_db_manager).control()
+    quota_repo = control.tenant_quotas
+    api_key_repo = ApiKeyRepository(_control_db)
 
     # Initialize control database services (tenant and user services work with control DB)
-    tenant_svc = TenantService(tenant_repo, _tenant_db_manager)
-    user_svc = UserService(user_repo)
+    tenant_svc = TenantService(
+        control.tenants, _tenant_db_manager, quota_repo, control.tenant_deletions,
+        slug_policy=tenant_slug_config_from_env().policy,
+    )
+    auth_cfg = auth_config_from_env()
+    user_svc = UserService(control.users, auth_cfg)
+    api_key_policy_cfg = api_key_policy_config_from_env()
+    api_key_svc = ApiKeyService(api_key_repo, api_key_policy_cfg)
+    audit_svc = AuditService(AuditRepository(_control_db))
+
+    cluster_cfg = cluster_config_from_env()
+    cluster_svc = ClusterService(ServerInstanceRepository(_control_db), cluster_cfg)
+
+    # Bundles of node types that new tenants are bootstrapped with
+    try:
+        template_svc = TenantTemplateService(load_tenant_templates(tenant_template_config_from_env().directory))
+    except (OSError, ValueError) as e:
+        logger.error(f"Failed to load tenant templates: {e}")
+        await _control_db.close()
+        sys.exit(1)
 
     # Register JSON-RPC methods (tenant-scoped services are resolved per-request)
-    register_methods(tenant_svc, user_svc)
+    register_methods(tenant_svc, user_svc, api_key_svc, audit_svc, cluster_svc, template_svc)
+
+    # Public intake form rate limits and captcha
+    configure_intake(intake_config_from_env())
+
+    # Read-only BI views per node type, regenerated on schema changes
+    configure_bi_views(bi_views_config_from_env())
+
+    # Cache for list and aggregate results, invalidated by each tenant's change feed
+    configure_query_cache(query_cache_config_from_env())
+
+    # Node types of recently used tenants, refreshed by their node type generation
+    configure_node_type_catalog(node_type_catalog_config_from_env())
+    # Compiled schema validators of recently written node types
+    validator_cache = configure_validator_cache(validator_cache_config_from_env())
+
+    # Blob store of node attachments (disabled unless ATTACHMENTS_URL is set)
+    attachment_cfg = attachment_config_from_env()
+    if attachment_cfg.url:
+        try:
+            _blob_store, blob_prefix = blob_store_from_config(attachment_cfg)
+        except ValueError as e:
+            logger.error(f"Invalid attachment configuration: {e}")
+            await _control_db.close()
+            sys.exit(1)
+        configure_attachments(attachment_cfg, _blob_store, blob_prefix)
+        logger.info(f"Attachments enabled (blob store: {attachment_cfg.url})")
+
+    # Object store of tenant exports (disabled unless EXPORT_STORAGE_URL is set)
+    export_storage_cfg = export_storage_config_from_env()
+    if export_storage_cfg.url:
+        try:
+            _export_store, export_prefix = object_store_from_config(export_storage_cfg, "EXPORT_STORAGE")
+        except ValueError as e:
+            logger.error(f"Invalid export storage configuration: {e}")
+            await _control_db.close()
+            sys.exit(1)
+        configure_export_storage(export_storage_cfg, _export_store, export_prefix)
+        logger.info(f"Exports to object storage enabled ({export_storage_cfg.url})")
+
+    # Per-method request metrics and SLIs (instruments the registered methods)
+    configure_metrics(metrics_config_from_env())
+    # Connections of the control, tenant and replica pools
+    add_metrics_collector(pool_metric_lines)
+    if validator_cache:
+        add_metrics_collector(validator_cache.metric_lines)
+
+    # One log line per JSON-RPC call (wraps the authorized methods)
+    configure_call_logging(logging_config_from_env())
+
+    # API key authentication and scope checks (wraps the instrumented methods), with
+    # lockouts after failed attempts and security events for unusual key use
+    configure_auth(auth_cfg, api_key_svc, AuthGuard(auth_cfg, audit_svc, api_key_repo, _tenant_db_manager))
+
+    # Token bucket rate limits per tenant and API key, from tenant quotas (after the metrics, which export rejections)
+    configure_rate_limits(rate_limit_config_from_env(), quota_repo)
+
+    # Shedding of analytics and exports while the database is saturated (ahead of the rate limits)
+    configure_load_shedding(load_shed_config_from_env())
+
+    # Adaptive concurrency limits per method (after the rate limits)
+    configure_concurrency_limits(concurrency_limit_config_from_env())
+
+    # Local KMS wrapping the data keys of sensitive fields (plugins may install another one)
+    try:
+        configure_kms(local_kms_from_config(encryption_config_from_env()))
+    except ValueError as e:
+        logger.error(f"Invalid encryption configuration: {e}")
+        await _control_db.close()
+        sys.exit(1)
+
+    # Interceptors of deployment plugins, inserted at their positions in the chain
+    try:
+        configure_plugins(plugin_config_from_env())
+    except Exception as e:
+        logger.error(f"Failed to load plugins: {e}")
+        await _control_db.close()
+        sys.exit(1)
 
     logger.info("Services initialized successfully")
+
+    # Background jobs run by one instance at a time, holding a leader role
+    lake_cfg = lake_export_config_from_env()
+    audit_export_cfg = audit_export_config_from_env()
+    backup_verify_cfg = backup_verify_config_from_env()
+    retention_cfg = retention_config_from_env()
+    roles = [
+        role
+        for role, enabled in (
+            (API_KEY_POLICY, api_key_policy_cfg.enabled),
+            (AUDIT_EXPORT, audit_export_cfg.enabled),
+            (BACKUP_VERIFY, backup_verify_cfg.enabled),
+            (LAKE_EXPORT, lake_cfg.enabled),
+            (RETENTION, retention_cfg.enabled),
+        )
+        if enabled
+    ]
+
+    # Register this instance, negotiate the features usable by every instance and take free leader roles
+    _cluster_membership = ClusterMembership(ServerInstanceRepository(_control_db), cluster_cfg, roles=roles)
+    try:
+        await _cluster_membership.start()
+    except Exception as e:
+        logger.error(f"Failed to register server instance: {e}")
+        await _control_db.close()
+        sys.exit(1)
+    configure_cluster(_cluster_membership)
+    logger.info(
+        f"Registered as server instance {_cluster_membership.instance.instance_id}, "
+        f"leading: {', '.join(sorted(_cluster_membership.held)) or 'nothing'}"
+    )
+
+    # Worker pools running the background jobs below by priority class, fairly across tenants
+    _job_scheduler = JobScheduler(job_scheduler_config_from_env())
+    add_metrics_collector(_job_scheduler.metric_lines)
+
+    # Start webhook dispatcher (delivers outbox events to tenant webhooks)
+    webhook_cfg = webhook_config_from_env()
+    if webhook_cfg.enabled:
+        _webhook_dispatcher = WebhookDispatcher(_tenant_db_manager, webhook_cfg, scheduler=_job_scheduler)
+        _webhook_dispatcher.start()
+        logger.info("Webhook dispatcher started")
+
+    # Start publishing change events to Kafka or NATS in the Debezium or protobuf format
+    cdc_cfg = cdc_config_from_env()
+    if cdc_cfg.enabled:
+        try:
+            _cdc_publisher = CdcPublisher(
+                _tenant_db_manager, cdc_cfg, broker_from_config(cdc_cfg), scheduler=_job_scheduler
+            )
+            await _cdc_publisher.start()
+        except Exception as e:
+            logger.error(f"Failed to start CDC publisher: {e}")
+            await _control_db.close()
+            sys.exit(1)
+        logger.info(
+            f"CDC publisher started ({cdc_cfg.broker}, {cdc_cfg.format}, "
+            f"topics: {cdc_cfg.topic_prefix}.<tenant_id>.<table>)"
+        )
+
+    # Start scheduled Parquet exports to object storage
+    if lake_cfg.enabled:
+        try:
+            store, prefix = object_store_from_config(lake_cfg)
+        except ValueError as e:
+            logger.error(f"Invalid lake export configuration: {e}")
+            await _control_db.close()
+            sys.exit(1)
+        _lake_exporter = LakeExporter(
+            _tenant_db_manager, lake_cfg, store, prefix, lambda: _cluster_membership.leads(LAKE_EXPORT),
+            scheduler=_job_scheduler
+        )
+        _lake_exporter.start()
+        logger.info(f"Lake exporter started (destination: {lake_cfg.url})")
+
+    # Start running node migrations to new node type schema versions
+    node_migration_cfg = node_migration_config_from_env()
+    if node_migration_cfg.enabled:
+        _node_migration_worker = NodeMigrationWorker(_tenant_db_manager, node_migration_cfg, _job_scheduler)
+        _node_migration_worker.start()
+        logger.info("Node migration worker started")
+
+    # Start expiring nodes by their node type's retention policy
+    if retention_cfg.enabled:
+        _retention_sweeper = RetentionSweeper(
+            _tenant_db_manager, retention_cfg, lambda: _cluster_membership.leads(RETENTION), _job_scheduler
+        )
+        add_metrics_collector(_retention_sweeper.metric_lines)
+        _retention_sweeper.start()
+        logger.info(f"Retention sweeper started{' (dry run)' if retention_cfg.dry_run else ''}")
+
+    # Start deleting the tenants delete_tenant queued
+    tenant_deletion_cfg = tenant_deletion_config_from_env()
+    if tenant_deletion_cfg.enabled:
+        _tenant_deletion_worker = TenantDeletionWorker(
+            control.tenant_deletions, _tenant_db_manager, tenant_deletion_cfg, _job_scheduler
+        )
+        _tenant_deletion_worker.start()
+        logger.info("Tenant deletion worker started")
+
+    # Start warning about expiring API keys and revoking unused ones
+    if api_key_policy_cfg.enabled:
+        _api_key_policy_worker = ApiKeyPolicyWorker(
+            api_key_repo, _tenant_db_manager, api_key_policy_cfg, lambda: _cluster_membership.leads(API_KEY_POLICY)
+        )
+        _api_key_policy_worker.start()
+        logger.info("API key policy worker started")
+
+    # Start exporting the audit log to write-once storage
+    if audit_export_cfg.enabled:
+        try:
+            store, prefix = object_store_from_config(audit_export_cfg, "AUDIT_EXPORT")
+        except ValueError as e:
+            logger.error(f"Invalid audit export configuration: {e}")
+            await _control_db.close()
+            sys.exit(1)
+        _audit_exporter = AuditExporter(
+            AuditRepository(_control_db), audit_export_cfg, store, prefix,
+            lambda: _cluster_membership.leads(AUDIT_EXPORT)
+        )
+        _audit_exporter.start()
+        logger.info(f"Audit log exporter started (destination: {audit_export_cfg.url})")
+
+    # Start restore drills of the latest backup
+    if backup_verify_cfg.enabled:
+        if not backup_verify_cfg.path:
+            logger.error("BACKUP_VERIFY_PATH is required when BACKUP_VERIFY_ENABLED=true")
+            await _control_db.close()
+            sys.exit(1)
+        _backup_verifier = BackupVerifier(
+            BackupVerificationRepository(_control_db), backup_verify_cfg, cfg,
+            lambda: _cluster_membership.leads(BACKUP_VERIFY)
+        )
+        add_metrics_collector(_backup_verifier.metric_lines)
+        _backup_verifier.start()
+        logger.info(f"Backup verifier started (backups: {backup_verify_cfg.path})")
+
+    # Start synthetic probes of the node API in the canary tenant (on every instance)
+    probe_cfg = probe_config_from_env()
+    if probe_cfg.enabled:
+        if not probe_cfg.tenant_id:
+            logger.error("PROBE_TENANT_ID is required when PROBE_ENABLED=true")
+            await _control_db.close()
+            sys.exit(1)
+        _canary_prober = CanaryProber(resolve_tenant_services, probe_cfg)
+        add_metrics_collector(_canary_prober.metric_lines)
+        _canary_prober.start()
+        logger.info(f"Canary prober started (tenant: {probe_cfg.tenant_id})")
     
     yield
     
-    # Shutdown
+    # Shutdown: drain the outbox, then stop the background jobs, cancelling
+    # whatever is left once the shutdown timeout is reached
     logger.info("Shutting down...")
+    shutdown = shutdown_coordinator()
+    if _webhook_dispatcher:
+        await shutdown.stop("webhook dispatcher", _webhook_dispatcher.drain)
+    if _cdc_publisher:
+        await shutdown.stop("CDC publisher", _cdc_publisher.drain)
+    if _lake_exporter:
+        await shutdown.stop("lake exporter", _lake_exporter.stop)
+    if _node_migration_worker:
+        await shutdown.stop("node migration worker", _node_migration_worker.stop)
+    if _retention_sweeper:
+        await shutdown.stop("retention sweeper", _retention_sweeper.stop)
+    if _tenant_deletion_worker:
+        await shutdown.stop("tenant deletion worker", _tenant_deletion_worker.stop)
+    if _api_key_policy_worker:
+        await shutdown.stop("API key policy worker", _api_key_policy_worker.stop)
+    if _audit_exporter:
+        await shutdown.stop("audit exporter", _audit_exporter.stop)
+    if _backup_verifier:
+        await shutdown.stop("backup verifier", _backup_verifier.stop)
+    if _canary_prober:
+        await shutdown.stop("canary prober", _canary_prober.stop)
+    if _job_scheduler:
+        await shutdown.stop("job scheduler", _job_scheduler.stop)
+    if _cluster_membership:
+        configure_cluster(None)
+        await shutdown.stop("cluster membership", _cluster_membership.stop)
+    if _blob_store:
+        await _blob_store.close()
+    if _export_store:
+        await _export_store.close()
     if _tenant_db_manager:
         await _tenant_db_manager.close_all_pools()
+    if _replica_db_manager:
+        await _replica_db_manager.close_all_pools()
     if _control_db:
         await _control_db.close()
     logger.info("Shutdown complete")
 
 
+@asynccontextmanager
+async def local_storage_lifespan(cfg):
+    """
+    Serve from the sqlite or memory storage backend: the control plane, node
+    types, nodes and relationships, without API keys, audit log, cluster
+    membership or background jobs, which need PostgreSQL.
+    """
+    storage = SqliteStorage(cfg.sqlite_dir) if cfg.storage_backend == SQLITE else MemoryStorage()
+    control = storage.control()
+    try:
+        template_svc = TenantTemplateService(load_tenant_templates(tenant_template_config_from_env().directory))
+    except (OSError, ValueError) as e:
+        logger.error(f"Failed to load tenant templates: {e}")
+        await storage.close()
+        sys.exit(1)
+    auth_cfg = auth_config_from_env()
+    register_methods(
+        TenantService(
+            control.tenants, quota_repo=control.tenant_quotas, slug_policy=tenant_slug_config_from_env().policy
+        ),
+        UserService(control.users, auth_cfg),
+        template_svc=template_svc,
+    )
+    set_tenant_services_factory(LocalTenantServices(storage).services)
+
+    configure_query_cache(query_cache_config_from_env())
+    validator_cache = configure_validator_cache(validator_cache_config_from_env())
+    configure_metrics(metrics_config_from_env())
+    if validator_cache:
+        add_metrics_collector(validator_cache.metric_lines)
+    configure_call_logging(logging_config_from_env())
+    configure_auth(auth_cfg, None)
+    configure_rate_limits(rate_limit_config_from_env(), control.tenant_quotas)
+    configure_load_shedding(load_shed_config_from_env())
+    configure_concurrency_limits(concurrency_limit_config_from_env())
+    try:
+        configure_kms(local_kms_from_config(encryption_config_from_env()))
+    except ValueError as e:
+        logger.error(f"Invalid encryption configuration: {e}")
+        await storage.close()
+        sys.exit(1)
+    try:
+        configure_plugins(plugin_config_from_env())
+    except Exception as e:
+        logger.error(f"Failed to load plugins: {e}")
+        await storage.close()
+        sys.exit(1)
+    logger.info(f"Services initialized successfully ({cfg.storage_backend} storage backend)")
+
+    try:
+        yield
+    finally:
+        logger.info("Shutting down...")
+        set_tenant_services_factory(None)
+        await storage.close()
+        logger.info("Shutdown complete")
+
+
 def create_app() -> FastAPI:
     """Create and configure the FastAPI application."""
     app = FastAPI(
@@ -146,15 +662,21 @@ def create_app() -> FastAPI:
         allow_credentials=False,  # Set to False when using allow_origins=["*"]
         allow_methods=["*"],
         allow_headers=["*"],
+        expose_headers=[REQUEST_ID_HEADER],
     )
+
+    # Request IDs for logs, error data and audit events, echoed in X-Request-ID
+    app.add_middleware(RequestIdMiddleware)
     
     # Register JSON-RPC router
     app.include_router(jsonrpc_router)
     
-    # Health check endpoint
+    # Health check endpoint; NOT_SERVING (503) once the server is shutting down
     @app.get("/health")
     async def health_check():
         """Health check endpoint."""
+        if not shutdown_coordinator().serving:
+            return JSONResponse({"status": NOT_SERVING}, status_code=503)
         return {"status": "ok"}
     
     return app
@@ -164,19 +686,403 @@ def create_app() -> FastAPI:
 app = create_app()
 
 
+async def migrate_to(target_version: int, tenant_id: str = None) -> None:
+    """
+    Migrate the control database and tenant databases to target_version.
+
+    Migrations newer than the target are rolled back with their down scripts,
+    missing ones up to the target are applied. Tenant databases are migrated
+    first so the control schema they are tracked in stays in place.
+    """
+    load_env_file()
+    cfg = database_config()
+
+    control_db = await connect_control_db(cfg)
+    manager = TenantDatabaseManager(cfg, control_db)
+    try:
+        tenant_ids = [tenant_id] if tenant_id else await manager.list_active_tenant_ids()
+        for tid in tenant_ids:
+            reverted = await manager.migrate_tenant_to(tid, target_version)
+            logger.info(f"Tenant {tid} migrated to {target_version:03d}, reverted: {', '.join(reverted) or 'none'}")
+
+        if not tenant_id:
+            await run_control_migrations(control_db, target_version)
+            reverted = await migrate_control_down(control_db, target_version)
+            logger.info(f"Control database migrated to {target_version:03d}, reverted: {', '.join(reverted) or 'none'}")
+    finally:
+        await manager.close_all_pools()
+        await control_db.close()
+
+
+async def contract() -> None:
+    """
+    Apply pending migrations including contract migrations, which remove the
+    old structure of expand/contract changes (see app/db/expand_contract.py),
+    to all tenant databases and the control database.
+    """
+    load_env_file()
+    cfg = database_config()
+
+    control_db = await connect_control_db(cfg)
+    manager = TenantDatabaseManager(cfg, control_db)
+    try:
+        for tid in await manager.list_active_tenant_ids():
+            await manager.apply_contract_migrations(tid)
+        await run_control_migrations(control_db, contract=True)
+    finally:
+        await manager.close_all_pools()
+        await control_db.close()
+
+
+async def _change_databases(database: str, control_db, manager: TenantDatabaseManager):
+    """Yield (label, Database) for the databases an expand/contract change applies to."""
+    if database == "control":
+        yield "control database", control_db
+        return
+    for tid in await manager.list_active_tenant_ids():
+        yield f"tenant {tid}", await manager.get_tenant_db(tid)
+
+
+async def backfill(name: str) -> None:
+    """
+    Run the backfill of an expand/contract change in every database holding its table.
+
+    In a tenant database the backfill is a bulk job, an operation of kind
+    backfills showing its progress, which can be cancelled: it then stops
+    after its current batch, and running the backfill again resumes it.
+    """
+    if name not in BACKFILLS:
+        raise ValueError(f"no backfill registered for change {name}")
+    load_env_file()
+    cfg = database_config()
+
+    change = BACKFILLS[name]
+    control_db = await connect_control_db(cfg)
+    manager = TenantDatabaseManager(cfg, control_db)
+    try:
+        async for label, db in _change_databases(change.database, control_db, manager):
+            jobs = None
+            job = BulkJob(kind=BULK_BACKFILL, params={"change": name}, unit="rows")
+            if change.database != "control":
+                jobs = BulkJobService(BulkJobRepository(db))
+                job = await jobs.start(job.kind, job.params, unit=job.unit)
+            try:
+                async with db.pool.acquire() as conn:
+                    rows = await run_backfill(conn, change, on_batch=_backfill_progress(label, jobs, job))
+            except Exception as e:
+                if jobs:
+                    await jobs.finish(job, str(e))
+                raise
+            if jobs:
+                await jobs.finish(job)
+            if job.status == "cancelled":
+                logger.info(f"Backfill of change {name} in {label} was cancelled after {rows} rows")
+            else:
+                logger.info(f"Backfilled {rows} rows for change {name} in {label}")
+    finally:
+        await manager.close_all_pools()
+        await control_db.close()
+
+
+def _backfill_progress(label: str, jobs: Optional[BulkJobService], job: BulkJob):
+    """Return the BatchHook of a backfill, logging its progress and reporting it to its job, if recorded."""
+    async def on_batch(rows: int, total: Optional[int]) -> bool:
+        running = True
+        if jobs:
+            running = await jobs.report(job, rows, total)
+        else:
+            job.processed, job.total, job.updated_at = rows, total, datetime.now()
+        eta = job.eta_seconds()
+        logger.info(
+            f"Backfill of change {job.params['change']} in {label}: {rows} of {job.total} rows"
+            + (f", about {eta:.0f}s left" if eta is not None else "")
+        )
+        return running
+    return on_batch
+
+
+async def end_dual_write_window(name: str) -> None:
+    """
+    Close the dual-write window of an expand/contract change in the control
+    and all tenant databases. Refused while server instances of several
+    releases run, as older ones may still read the old structure.
+    """
+    load_env_file()
+    cfg = database_config()
+
+    control_db = await connect_control_db(cfg)
+    manager = TenantDatabaseManager(cfg, control_db)
+    try:
+        instances = await ServerInstanceRepository(control_db).list_live(cluster_config_from_env().instance_ttl)
+        releases = sorted({instance.release for instance in instances})
+        if len(releases) > 1:
+            raise ValueError(f"server instances of releases {', '.join(releases)} are running")
+        ended = []
+        for database in ("control", "tenant"):
+            async for label, db in _change_databases(database, control_db, manager):
+                async with db.pool.acquire() as conn:
+                    if await end_dual_write(conn, name):
+                        ended.append(label)
+        logger.info(f"Ended dual writes of change {name} in {', '.join(ended) or 'no database'}")
+    finally:
+        await manager.close_all_pools()
+        await control_db.close()
+
+
+async def verify_audit_log() -> bool:
+    """
+    Verify the audit log exported to AUDIT_EXPORT_URL against its hash chain
+    and the control database; returns whether it is intact.
+    """
+    load_env_file()
+    cfg = database_config()
+    export_cfg = audit_export_config_from_env()
+    if not export_cfg.url:
+        raise ValueError("AUDIT_EXPORT_URL is required")
+
+    store, prefix = object_store_from_config(export_cfg, "AUDIT_EXPORT")
+    control_db = await connect_control_db(cfg)
+    try:
+        result = await verify_audit_exports(store, prefix, AuditRepository(control_db))
+    finally:
+        await control_db.close()
+        await store.close()
+
+    for problem in result.problems:
+        logger.error(f"Audit log verification: {problem}")
+    logger.info(
+        f"Verified {result.batches} audit log batches with {result.events} events, "
+        f"head sha256 {result.head_hash}: {'intact' if result.ok else f'{len(result.problems)} problems'}"
+    )
+    return result.ok
+
+
+async def compliance_report(path: str) -> None:
+    """
+    Write a signed bundle of compliance evidence collected from the control
+    database to path (see app/jobs/compliance.py).
+    """
+    load_env_file()
+    cfg = database_config()
+    compliance_cfg = compliance_config_from_env()
+    if not compliance_cfg.signing_key:
+        raise ValueError("COMPLIANCE_SIGNING_KEY is required")
+    export_cfg = audit_export_config_from_env()
+
+    control_db = await connect_control_db(cfg)
+    try:
+        audit_verification = None
+        if export_cfg.url:
+            store, prefix = object_store_from_config(export_cfg, "AUDIT_EXPORT")
+            try:
+                audit_verification = await verify_audit_exports(store, prefix, AuditRepository(control_db))
+            finally:
+                await store.close()
+
+        now = datetime.now(timezone.utc)
+        artifacts = await collect_evidence(
+            control_db, api_key_policy_config_from_env(), compliance_cfg.period_days, now, audit_verification
+        )
+    finally:
+        await control_db.close()
+
+    with open(path, "wb") as f:
+        f.write(build_bundle(artifacts, compliance_cfg.signing_key, now))
+    logger.info(f"Wrote compliance evidence bundle to {path} ({', '.join(sorted(artifacts))})")
+
+
+async def promote_standby_command(reason: str) -> None:
+    """
+    Promote FAILOVER_STANDBY_HOST to primary, fence the current primary and
+    route servers to the standby, recording the failover in the audit log
+    (see app/db/failover.py).
+    """
+    load_env_file()
+    cfg = config_from_env()
+    result = await promote_standby(cfg, failover_config_from_env(), reason, datetime.now(timezone.utc))
+
+    primary = result["primary"]
+    control_db = await connect_control_db(replace(cfg, host=primary["host"], port=primary["port"]))
+    try:
+        await AuditRepository(control_db).record(AuditEvent(
+            event_type="cluster.failover",
+            details={**result, "operator": getpass.getuser()},
+        ))
+    finally:
+        await control_db.close()
+    logger.info(f"Failover to {primary['host']}:{primary['port']} complete; restart servers to pick up the routing")
+
+
+def verify_compliance_report(path: str) -> bool:
+    """Verify a compliance evidence bundle's signature and artifacts; returns whether it is intact."""
+    load_env_file()
+    with open(path, "rb") as f:
+        problems = verify_bundle(f.read(), compliance_config_from_env().signing_key)
+    for problem in problems:
+        logger.error(f"Compliance bundle verification: {problem}")
+    logger.info(f"Verified compliance evidence bundle {path}: {'intact' if not problems else f'{len(problems)} problems'}")
+    return not problems
+
+
+def parse_args() -> argparse.Namespace:
+    """Parse command line arguments."""
+    parser = argparse.ArgumentParser(description="flex-db server")
+    parser.add_argument(
+        "--migrate-to",
+        metavar="VERSION",
+        help="migrate databases to VERSION (e.g. 009 or 009_create_email_inboxes; 0 reverts all) and exit",
+    )
+    parser.add_argument(
+        "--tenant",
+        metavar="TENANT_ID",
+        help="with --migrate-to, only migrate this tenant's database",
+    )
+    parser.add_argument(
+        "--contract",
+        action="store_true",
+        help="apply pending migrations including contract migrations of expand/contract changes and exit",
+    )
+    parser.add_argument(
+        "--backfill",
+        metavar="CHANGE",
+        help="run the backfill of an expand/contract change and exit",
+    )
+    parser.add_argument(
+        "--end-dual-write",
+        metavar="CHANGE",
+        help="stop writing the old structure of an expand/contract change and exit",
+    )
+    parser.add_argument(
+        "--verify-audit-log",
+        action="store_true",
+        help="verify the audit log exported to AUDIT_EXPORT_URL and exit (status 1 if tampered with)",
+    )
+    parser.add_argument(
+        "--compliance-report",
+        metavar="PATH",
+        help="write a signed bundle of compliance evidence to PATH and exit",
+    )
+    parser.add_argument(
+        "--verify-compliance-report",
+        metavar="PATH",
+        help="verify the compliance evidence bundle at PATH and exit (status 1 if tampered with)",
+    )
+    parser.add_argument(
+        "--promote-standby",
+        action="store_true",
+        help="promote FAILOVER_STANDBY_HOST to primary, fence the current primary and exit",
+    )
+    parser.add_argument(
+        "--reason",
+        help="with --promote-standby, why the failover happened (recorded in the audit log)",
+    )
+    args = parser.parse_args()
+    if args.promote_standby and not args.reason:
+        parser.error("--promote-standby requires --reason")
+    if args.tenant and args.migrate_to is None:
+        parser.error("--tenant requires --migrate-to")
+    if args.migrate_to is not None:
+        try:
+            args.migrate_to = version_number(args.migrate_to)
+        except ValueError as e:
+            parser.error(str(e))
+    return args
+
+
 if __name__ == "__main__":
+    args = parse_args()
+    if args.migrate_to is not None:
+        try:
+            asyncio.run(migrate_to(args.migrate_to, args.tenant))
+        except Exception as e:
+            logger.error(f"Migration failed: {e}")
+            sys.exit(1)
+        sys.exit(0)
+    if args.contract:
+        try:
+            asyncio.run(contract())
+        except Exception as e:
+            logger.error(f"Contract migrations failed: {e}")
+            sys.exit(1)
+        sys.exit(0)
+    if args.backfill:
+        try:
+            asyncio.run(backfill(args.backfill))
+        except Exception as e:
+            logger.error(f"Backfill failed: {e}")
+            sys.exit(1)
+        sys.exit(0)
+    if args.end_dual_write:
+        try:
+            asyncio.run(end_dual_write_window(args.end_dual_write))
+        except Exception as e:
+            logger.error(f"Ending dual writes failed: {e}")
+            sys.exit(1)
+        sys.exit(0)
+    if args.verify_audit_log:
+        try:
+            intact = asyncio.run(verify_audit_log())
+        except Exception as e:
+            logger.error(f"Audit log verification failed: {e}")
+            sys.exit(2)
+        sys.exit(0 if intact else 1)
+    if args.compliance_report:
+        try:
+            asyncio.run(compliance_report(args.compliance_report))
+        except Exception as e:
+            logger.error(f"Compliance report failed: {e}")
+            sys.exit(1)
+        sys.exit(0)
+    if args.verify_compliance_report:
+        try:
+            intact = verify_compliance_report(args.verify_compliance_report)
+        except Exception as e:
+            logger.error(f"Compliance bundle verification failed: {e}")
+            sys.exit(2)
+        sys.exit(0 if intact else 1)
+    if args.promote_standby:
+        try:
+            asyncio.run(promote_standby_command(args.reason))
+        except Exception as e:
+            logger.error(f"Failover failed: {e}")
+            sys.exit(1)
+        sys.exit(0)
+
     # Get server configuration
     host = os.getenv("JSONRPC_HOST", "0.0.0.0")
     port = int(os.getenv("JSONRPC_PORT", "5000"))
+
+    # HTTPS, and client certificates with a client CA
+    tls_cfg = tls_config_from_env()
+    try:
+        tls_options = uvicorn_options(tls_cfg)
+    except Exception as e:
+        logger.error(f"Invalid TLS configuration: {e}")
+        sys.exit(1)
+    scheme = "https" if tls_options else "http"
     
     logger.info(f"Starting flex-db server on {host}:{port}...")
-    logger.info(f"JSON-RPC endpoint: http://{host}:{port}/jsonrpc")
-    logger.info(f"OpenRPC spec: http://{host}:{port}/openrpc.json")
-    logger.info(f"Health check: http://{host}:{port}/health")
+    if tls_cfg.client_ca_file:
+        logger.info(f"Client certificates signed by {tls_cfg.client_ca_file} are required")
+    logger.info(f"JSON-RPC endpoint: {scheme}://{host}:{port}/jsonrpc")
+    logger.info(f"OpenRPC spec: {scheme}://{host}:{port}/openrpc.json")
+    logger.info(f"Health check: {scheme}://{host}:{port}/health")
+    logger.info(f"Prometheus metrics: {scheme}://{host}:{port}/metrics")
+    logger.info(f"Analytics endpoint (if enabled): {scheme}://{host}:{port}/analytics/jsonrpc")
+    logger.info(f"Public intake forms: {scheme}://{host}:{port}/public/tenants/{{tenant_id}}/forms/{{token}}")
     
-    uvicorn.run(
-        "main:app",
+    shutdown_cfg = shutdown_config_from_env()
+    options = dict(
         host=host,
         port=port,
-        reload=os.getenv("RELOAD", "false").lower() == "true",
+        # Keep uvicorn's loggers on the handler set up by configure_logging
+        log_config=None,
+        # In-flight requests get the shutdown timeout, after the drain delay
+        timeout_graceful_shutdown=int(shutdown_cfg.timeout),
+        **tls_options,
     )
+    if os.getenv("RELOAD", "false").lower() == "true":
+        # The reloader runs the server in a subprocess, without the drain delay
+        uvicorn.run("main:app", reload=True, **options)
+    else:
+        GracefulServer(uvicorn.Config("main:app", **options), configure_shutdown(shutdown_cfg)).run()
@@ -0,0 +1,78 @@
+#!/usr/bin/env python3
+"""
+Benchmark of the node data hot path: validating, normalizing and serializing
+the data of node writes, with the time and the peak memory allocated per
+operation (tracemalloc), for node data of --fields fields.
+
+    python3 scripts/bench_node_data.py [--fields 50] [--runs 2000]
+
+Run it before and after changes to the write path and compare the numbers.
+"""
+
+import argparse
+import json
+import os
+import sys
+import time
+import tracemalloc
+from typing import Callable, Tuple
+
+sys.path.insert(0, os.path.dirname(os.path.dirname(os.path.abspath(__file__))))
+
+from app.repository import Node  # noqa: E402
+from app.service.schema import SchemaValidator  # noqa: E402
+
+
+def payload(fields: int, decimals: bool) -> Tuple[str, str]:
+    """Return a schema of fields fields, a quarter of them decimals if decimals, and data for it."""
+    schema, data = {}, {}
+    for i in range(fields):
+        if decimals and i % 4 == 0:
+            schema[f"amount_{i}"] = {"type": "decimal", "scale": 2}
+            data[f"amount_{i}"] = 1234.5 + i
+        else:
+            schema[f"title_{i}"] = {"type": "string", "required": True}
+            data[f"title_{i}"] = f"value {i} " * 4
+    return json.dumps(schema), json.dumps(data)
+
+
+def measure(runs: int, op: Callable[[], object]) -> Tuple[float, int]:
+    """Return the mean microseconds and peak bytes allocated of one run of op."""
+    started = time.perf_counter()
+    for _ in range(runs):
+        op()
+    micros = (time.perf_counter() - started) / runs * 1e6
+
+    tracemalloc.start()
+    tracemalloc.reset_peak()
+    base = tracemalloc.get_traced_memory()[0]
+    op()
+    peak = tracemalloc.get_traced_memory()[1] - base
+    tracemalloc.stop()
+    return micros, peak
+
+
+def main() -> None:
+    parser = argparse.ArgumentParser(description=__doc__, formatter_class=argparse.RawDescriptionHelpFormatter)
+    parser.add_argument("--fields", type=int, default=50)
+    parser.add_argument("--runs", type=int, default=2000)
+    args = parser.parse_args()
+
+    print(f"{'operation':<40} {'us/op':>10} {'peak bytes/op':>15}")
+    for decimals in (False, True):
+        schema, data = payload(args.fields, decimals)
+        validator = SchemaValidator(schema)
+        node = Node(id="n1", node_type_id="nt1", data=validator.prepare(data))
+        label = "decimals" if decimals else "no decimals"
+        ops = {
+            f"validate + normalize ({label})": lambda: validator.normalize(validator.validate(data) or data),
+            f"prepare ({label})": lambda: validator.prepare(data),
+            f"serialize response ({label})": lambda: json.dumps({"result": {"node": node.to_dict()}}),
+        }
+        for name, op in ops.items():
+            micros, peak = measure(args.runs, op)
+            print(f"{name:<40} {micros:>10.1f} {peak:>15}")
+
+
+if __name__ == "__main__":
+    main()
@@ -160,6 +160,21 @@ async def test_health_check(async_client: AsyncClient):
     assert data["status"] == "ok"
 
 
+@pytest.mark.asyncio
+async def test_request_id_in_error_and_response(async_client: AsyncClient):
+    """Test the client's request ID is echoed and included in error data."""
+    request = {"jsonrpc": "2.0", "method": "get_tenant", "params": {"id": "no-such-tenant"}, "id": 1}
+    response = await async_client.post("/jsonrpc", json=request, headers={"X-Request-ID": "req-123"})
+
+    assert response.headers["x-request-id"] == "req-123"
+    error = response.json()["error"]
+    assert error["code"] == -32001
+    assert error["data"] == {"request_id": "req-123"}
+
+    response = await async_client.get("/health")
+    assert len(response.headers["x-request-id"]) == 32
+
+
 @pytest.mark.asyncio
 async def test_openrpc_spec(async_client: AsyncClient):
     """Test OpenRPC specification endpoint."""
@@ -192,7 +207,6 @@ async def test_update_tenant_via_api(
             "id": tenant_id,
             "slug": "updated-tenant",
             "name": "Updated Tenant",
-            "status": "inactive"
         },
         "id": 1
     }
@@ -203,7 +217,7 @@ async def test_update_tenant_via_api(
     
     assert data["result"]["tenant"]["slug"] == "updated-tenant"
     assert data["result"]["tenant"]["name"] == "Updated Tenant"
-    assert data["result"]["tenant"]["status"] == "inactive"
+    assert data["result"]["tenant"]["status"] == "active"
 
 
 @pytest.mark.asyncio
@@ -279,3 +293,398 @@ async def test_list_nodes_with_filter(
     for node in data["result"]["nodes"]:
         assert node["node_type_id"] == node_type_id
 
+
+@pytest.mark.asyncio
+async def test_list_nodes_cache_invalidated_by_changes(
+    async_client: AsyncClient,
+    tenant_service,
+    user_service,
+    test_tenant
+):
+    """Test cached list results are refreshed after a node is created."""
+    from app.api.dependencies import configure_query_cache
+    from app.config import QueryCacheConfig
+
+    register_methods(tenant_service, user_service)
+    configure_query_cache(QueryCacheConfig(enabled=True))
+    try:
+        tenant_id = test_tenant["id"]
+        request = {
+            "jsonrpc": "2.0",
+            "method": "create_node_type",
+            "params": {"tenant_id": tenant_id, "name": "Article"},
+            "id": 1
+        }
+        response = await async_client.post("/jsonrpc", json=request)
+        node_type_id = response.json()["result"]["node_type"]["id"]
+
+        list_request = {
+            "jsonrpc": "2.0",
+            "method": "list_nodes",
+            "params": {"tenant_id": tenant_id, "node_type_id": node_type_id},
+            "id": 2
+        }
+
+        response = await async_client.post("/jsonrpc", json=list_request)
+        before = response.json()["result"]["nodes"]
+        response = await async_client.post("/jsonrpc", json=list_request)
+        assert response.json()["result"]["nodes"] == before
+
+        request = {
+            "jsonrpc": "2.0",
+            "method": "create_node",
+            "params": {"tenant_id": tenant_id, "node_type_id": node_type_id, "data": '{"title": "New"}'},
+            "id": 3
+        }
+        response = await async_client.post("/jsonrpc", json=request)
+        node_id = response.json()["result"]["node"]["id"]
+
+        response = await async_client.post("/jsonrpc", json=list_request)
+        nodes = response.json()["result"]["nodes"]
+        assert len(nodes) == len(before) + 1
+        assert node_id in [n["id"] for n in nodes]
+    finally:
+        configure_query_cache(QueryCacheConfig())
+
+
+@pytest.mark.asyncio
+async def test_analytics_endpoint_reads_replica(
+    async_client: AsyncClient,
+    tenant_service,
+    user_service,
+    test_config,
+    clean_control_db,
+    test_tenant
+):
+    """Test analytics methods read from the replica with relaxed page sizes and cannot write."""
+    from app.config import AnalyticsConfig
+    from app.db import ReplicaDatabaseManager
+    from app.jsonrpc.analytics import set_replica_manager
+
+    register_methods(tenant_service, user_service)
+    # The test server stands in for the replica
+    analytics_cfg = AnalyticsConfig(enabled=True, host=test_config.host, port=test_config.port, max_page_size=500)
+    manager = ReplicaDatabaseManager(test_config, analytics_cfg, clean_control_db)
+    set_replica_manager(manager, analytics_cfg)
+    try:
+        tenant_id = test_tenant["id"]
+        request = {
+            "jsonrpc": "2.0",
+            "method": "create_node_type",
+            "params": {"tenant_id": tenant_id, "name": "Article"},
+            "id": 1
+        }
+        response = await async_client.post("/jsonrpc", json=request)
+        node_type_id = response.json()["result"]["node_type"]["id"]
+
+        for i in range(3):
+            request = {
+                "jsonrpc": "2.0",
+                "method": "create_node",
+                "params": {"tenant_id": tenant_id, "node_type_id": node_type_id, "data": f'{{"title": "Node {i}"}}'},
+                "id": 2
+            }
+            await async_client.post("/jsonrpc", json=request)
+
+        request = {
+            "jsonrpc": "2.0",
+            "method": "analytics.list_nodes",
+            "params": {"tenant_id": tenant_id, "pagination": {"page_size": 250}},
+            "id": 3
+        }
+        response = await async_client.post("/analytics/jsonrpc", json=request)
+        assert response.status_code == 200
+        assert len(response.json()["result"]["nodes"]) == 3
+
+        request = {
+            "jsonrpc": "2.0",
+            "method": "create_node",
+            "params": {"tenant_id": tenant_id, "node_type_id": node_type_id},
+            "id": 4
+        }
+        response = await async_client.post("/analytics/jsonrpc", json=request)
+        assert response.json()["error"]["code"] == -32601
+
+        replica_db = await manager.get_tenant_db(tenant_id)
+        async with replica_db.pool.acquire() as conn:
+            assert await conn.fetchval("SHOW default_transaction_read_only") == "on"
+    finally:
+        set_replica_manager(None, AnalyticsConfig())
+        await manager.close_all_pools()
+
+
+@pytest.mark.asyncio
+async def test_stream_nodes_ndjson(
+    async_client: AsyncClient,
+    tenant_service,
+    user_service,
+    test_tenant
+):
+    """Test streaming nodes as newline-delimited JSON."""
+    import json
+
+    register_methods(tenant_service, user_service)
+    tenant_id = test_tenant["id"]
+
+    request = {
+        "jsonrpc": "2.0",
+        "method": "create_node_type",
+        "params": {"tenant_id": tenant_id, "name": "Article"},
+        "id": 1
+    }
+    response = await async_client.post("/jsonrpc", json=request)
+    node_type_id = response.json()["result"]["node_type"]["id"]
+
+    for i in range(3):
+        request = {
+            "jsonrpc": "2.0",
+            "method": "create_node",
+            "params": {"tenant_id": tenant_id, "node_type_id": node_type_id, "data": f'{{"n": {i}}}'},
+            "id": 2 + i
+        }
+        await async_client.post("/jsonrpc", json=request)
+
+    response = await async_client.get(
+        "/stream/nodes",
+        params={"tenant_id": tenant_id, "node_type_id": node_type_id, "batch_size": 2}
+    )
+    assert response.status_code == 200
+    assert response.headers["content-type"].startswith("application/x-ndjson")
+
+    nodes = [json.loads(line) for line in response.text.splitlines()]
+    assert len(nodes) == 3
+    assert all(node["node_type_id"] == node_type_id for node in nodes)
+
+    response = await async_client.get("/stream/nodes", params={"tenant_id": tenant_id, "batch_size": 0})
+    assert response.status_code == 400
+
+
+
+@pytest.mark.asyncio
+async def test_describe_tenant_schema(
+    async_client: AsyncClient,
+    tenant_service,
+    user_service,
+    test_tenant
+):
+    """Test describing node type schemas and display metadata in one call."""
+    register_methods(tenant_service, user_service)
+    tenant_id = test_tenant["id"]
+
+    request = {
+        "jsonrpc": "2.0",
+        "method": "create_node_type",
+        "params": {
+            "tenant_id": tenant_id,
+            "name": "Invoice",
+            "schema": '{"number": {"type": "string", "required": true}, "amount": "decimal"}',
+            "display": '{"label": "Invoices", "default_sort": {"field": "number"}}'
+        },
+        "id": 1
+    }
+    response = await async_client.post("/jsonrpc", json=request)
+    assert "result" in response.json()
+
+    request = {
+        "jsonrpc": "2.0",
+        "method": "describe_tenant_schema",
+        "params": {"tenant_id": tenant_id},
+        "id": 2
+    }
+    response = await async_client.post("/jsonrpc", json=request)
+    assert response.status_code == 200
+    node_types = response.json()["result"]["node_types"]
+
+    assert len(node_types) == 1
+    assert node_types[0]["display"]["label"] == "Invoices"
+    assert node_types[0]["fields"] == [
+        {"name": "number", "type": "string", "required": True},
+        {"name": "amount", "type": "decimal", "required": False, "scale": 2},
+    ]
+
+
+@pytest.mark.asyncio
+async def test_public_intake_form_submission(
+    async_client: AsyncClient,
+    tenant_service,
+    user_service,
+    test_tenant
+):
+    """Test anonymous form submissions create nodes and are rate limited."""
+    from app.config import IntakeConfig
+    from app.jsonrpc.server import configure_intake
+
+    register_methods(tenant_service, user_service)
+    configure_intake(IntakeConfig(ip_rate_limit_per_minute=100))
+    tenant_id = test_tenant["id"]
+
+    request = {
+        "jsonrpc": "2.0",
+        "method": "create_node_type",
+        "params": {"tenant_id": tenant_id, "name": "Ticket", "schema": '{"email": {"type": "string", "required": true}}'},
+        "id": 1
+    }
+    response = await async_client.post("/jsonrpc", json=request)
+    node_type_id = response.json()["result"]["node_type"]["id"]
+
+    request = {
+        "jsonrpc": "2.0",
+        "method": "create_intake_form",
+        "params": {"tenant_id": tenant_id, "node_type_id": node_type_id, "name": "Contact", "rate_limit_per_minute": 1},
+        "id": 2
+    }
+    response = await async_client.post("/jsonrpc", json=request)
+    token = response.json()["result"]["intake_form"]["token"]
+    url = f"/public/tenants/{tenant_id}/forms/{token}"
+
+    response = await async_client.post(
+        url,
+        content="email=visitor%40example.com",
+        headers={"Content-Type": "application/x-www-form-urlencoded"},
+    )
+    assert response.status_code == 201
+    node_id = response.json()["id"]
+
+    request = {"jsonrpc": "2.0", "method": "get_node", "params": {"id": node_id, "tenant_id": tenant_id}, "id": 3}
+    response = await async_client.post("/jsonrpc", json=request)
+    assert response.json()["result"]["node"]["node_type_id"] == node_type_id
+
+    response = await async_client.post(url, json={"email": "again@example.com"})
+    assert response.status_code == 429
+    assert "Retry-After" in response.headers
+
+    response = await async_client.post(f"/public/tenants/{tenant_id}/forms/not-a-token", json={})
+    assert response.status_code == 404
+
+
+@pytest.mark.asyncio
+async def test_inbound_email_raw(
+    async_client: AsyncClient,
+    tenant_service,
+    user_service,
+    test_tenant
+):
+    """Test posting a raw email to an inbox creates a node once."""
+    import json
+
+    register_methods(tenant_service, user_service)
+    tenant_id = test_tenant["id"]
+
+    request = {
+        "jsonrpc": "2.0",
+        "method": "create_node_type",
+        "params": {"tenant_id": tenant_id, "name": "Ticket"},
+        "id": 1
+    }
+    response = await async_client.post("/jsonrpc", json=request)
+    node_type_id = response.json()["result"]["node_type"]["id"]
+
+    request = {
+        "jsonrpc": "2.0",
+        "method": "create_email_inbox",
+        "params": {"tenant_id": tenant_id, "node_type_id": node_type_id, "name": "Support"},
+        "id": 2
+    }
+    response = await async_client.post("/jsonrpc", json=request)
+    token = response.json()["result"]["email_inbox"]["token"]
+    url = f"/public/tenants/{tenant_id}/inboxes/{token}?provider=raw"
+
+    raw = b"From: jane@example.com\r\nSubject: Help\r\nMessage-ID: <x1@example.com>\r\n\r\nPlease help.\r\n"
+    response = await async_client.post(url, content=raw, headers={"Content-Type": "message/rfc822"})
+    assert response.status_code == 201
+    node_id = response.json()["id"]
+
+    response = await async_client.post(url, content=raw, headers={"Content-Type": "message/rfc822"})
+    assert response.status_code == 200
+    assert response.json() == {"id": node_id, "duplicate": True}
+
+    request = {"jsonrpc": "2.0", "method": "get_node", "params": {"id": node_id, "tenant_id": tenant_id}, "id": 3}
+    response = await async_client.post("/jsonrpc", json=request)
+    data = json.loads(response.json()["result"]["node"]["data"])
+    assert data["from"] == "jane@example.com"
+    assert data["subject"] == "Help"
+    assert data["body"].strip() == "Please help."
+
+
+@pytest.mark.asyncio
+async def test_export_import_tenant(
+    async_client: AsyncClient,
+    tenant_service,
+    user_service,
+    test_tenant
+):
+    """Test exporting a tenant as NDJSON and importing it back with progress lines."""
+    import json
+
+    register_methods(tenant_service, user_service)
+    tenant_id = test_tenant["id"]
+
+    request = {
+        "jsonrpc": "2.0",
+        "method": "create_node_type",
+        "params": {"tenant_id": tenant_id, "name": "Article"},
+        "id": 1
+    }
+    response = await async_client.post("/jsonrpc", json=request)
+    node_type_id = response.json()["result"]["node_type"]["id"]
+    request = {
+        "jsonrpc": "2.0",
+        "method": "create_node",
+        "params": {"tenant_id": tenant_id, "node_type_id": node_type_id, "data": '{"title": "a"}'},
+        "id": 2
+    }
+    await async_client.post("/jsonrpc", json=request)
+
+    response = await async_client.get("/stream/export", params={"tenant_id": tenant_id})
+    assert response.status_code == 200
+    records = [json.loads(line) for line in response.text.splitlines()]
+    assert [r["type"] for r in records] == ["header", "node_type", "node"]
+
+    response = await async_client.post(
+        "/stream/import",
+        params={"tenant_id": tenant_id, "batch_size": 1},
+        content=response.content,
+        headers={"Content-Type": "application/x-ndjson"},
+    )
+    assert response.status_code == 200
+    lines = [json.loads(line) for line in response.text.splitlines()]
+    assert [list(line) for line in lines] == [["progress"], ["result"]]
+    assert lines[-1]["result"]["node_types_matched"] == 1
+    assert lines[-1]["result"]["nodes_created"] == 1
+
+    response = await async_client.post(
+        "/stream/import",
+        params={"tenant_id": tenant_id},
+        content=b'{"type": "node", "node": {"id": "n", "node_type_id": "missing"}}\n',
+    )
+    error = json.loads(response.text.splitlines()[-1])
+    assert error["error"]["code"] == -32602
+    assert "line 1" in error["error"]["message"]
+
+
+@pytest.mark.asyncio
+async def test_dry_run_import_cannot_be_resumed(async_client: AsyncClient, tenant_service, user_service, test_tenant):
+    """Test resuming a dry run import is rejected, as it committed none of the lines it read."""
+    import json
+
+    register_methods(tenant_service, user_service)
+    tenant_id = test_tenant["id"]
+    upload = (
+        b'{"type": "node_type", "node_type": {"id": "t1", "name": "Article"}}\n'
+        b'{"type": "node", "node": {"id": "n1", "node_type_id": "t1"}}\n'
+        b'{"type": "node", "node": {"id": "n2", "node_type_id": "missing"}}\n'
+    )
+
+    response = await async_client.post(
+        "/stream/import", params={"tenant_id": tenant_id, "batch_size": 1, "dry_run": "true"}, content=upload
+    )
+    error = json.loads(response.text.splitlines()[-1])
+    assert error["error"]["code"] == -32602 and error["progress"]["lines"] == 2
+    job_id = error["operation"].rsplit("/", 1)[-1]
+
+    response = await async_client.post(
+        "/stream/import", params={"tenant_id": tenant_id, "resume": job_id}, content=upload
+    )
+    assert response.status_code == 409
+    assert response.json()["error"]["code"] == -32005
+    assert "dry run" in response.json()["error"]["message"]
@@ -0,0 +1,84 @@
+"""
+Tests for the graceful shutdown coordinator.
+"""
+
+import asyncio
+
+import pytest
+
+from app.api.shutdown import ShutdownCoordinator
+from app.config import ShutdownConfig
+
+
+class FakeWorker:
+    """A background job loop in the style of app/jobs, stopping after its current poll."""
+
+    def __init__(self, poll_seconds):
+        self.poll_seconds = poll_seconds
+        self.cancelled = False
+        self._stopping = asyncio.Event()
+        self._task = asyncio.create_task(self._run())
+
+    async def stop(self):
+        self._stopping.set()
+        await self._task
+
+    async def _run(self):
+        try:
+            while not self._stopping.is_set():
+                await asyncio.sleep(self.poll_seconds)
+        except asyncio.CancelledError:
+            self.cancelled = True
+            raise
+
+
+def test_deadline_starts_when_serving_stops():
+    """Test the deadline covers the drain delay and the timeout, from the first begin()."""
+    now = [100.0]
+    coordinator = ShutdownCoordinator(ShutdownConfig(drain_delay=5.0, timeout=30.0), clock=lambda: now[0])
+    assert coordinator.serving
+    assert coordinator.remaining() == 30.0
+
+    coordinator.begin()
+    now[0] = 110.0
+    coordinator.begin()
+
+    assert not coordinator.serving
+    assert coordinator.remaining() == 25.0
+    now[0] = 200.0
+    assert coordinator.remaining() == 0.0
+
+
+@pytest.mark.asyncio
+async def test_stop_waits_for_jobs_within_the_timeout():
+    """Test a job finishing its poll within the timeout stops normally."""
+    coordinator = ShutdownCoordinator(ShutdownConfig(drain_delay=0.0, timeout=1.0))
+    worker = FakeWorker(0.01)
+
+    assert await coordinator.stop("worker", worker.stop)
+    assert worker._task.done() and not worker.cancelled
+    assert not coordinator.serving
+
+
+@pytest.mark.asyncio
+async def test_stop_cancels_jobs_after_the_timeout():
+    """Test jobs still running at the deadline are cancelled, including those stopped after it."""
+    coordinator = ShutdownCoordinator(ShutdownConfig(drain_delay=0.0, timeout=0.05))
+    slow = FakeWorker(60.0)
+    late = FakeWorker(60.0)
+
+    assert not await coordinator.stop("slow", slow.stop)
+    assert slow.cancelled
+    assert not await coordinator.stop("late", late.stop)
+    assert late.cancelled
+
+
+@pytest.mark.asyncio
+async def test_failing_step_does_not_stop_shutdown():
+    """Test a step that raises is logged and counts as finished."""
+    coordinator = ShutdownCoordinator(ShutdownConfig(drain_delay=0.0, timeout=1.0))
+
+    async def fail():
+        raise RuntimeError("broker unreachable")
+
+    assert await coordinator.stop("publisher", fail)
@@ -0,0 +1,201 @@
+"""
+Tests for API key scopes and method authorization.
+"""
+
+import inspect
+
+import pytest
+from jsonrpcserver import Success
+from jsonrpcserver.methods import global_methods
+
+import app.jsonrpc.handlers  # noqa: F401 (registers the JSON-RPC methods)
+from app.auth import (
+    ADMIN_KEY,
+    API_KEY,
+    METHOD_PERMISSIONS,
+    PERMISSION_DENIED_CODE,
+    USER,
+    PermissionDeniedError,
+    Principal,
+    authorize,
+    check_access,
+    grants,
+    set_principal,
+    validate_scopes,
+    visible_relationships,
+)
+from app.auth import authorization
+from app.jsonrpc.analytics import ANALYTICS_METHOD_PREFIX, analytics_methods
+from app.metrics import result_code
+from app.repository import ApiKey, Node, Relationship
+from app.repository.actor import current_actor
+
+
+def _key_principal(scopes, node_type_ids=None):
+    return Principal(kind=API_KEY, api_key=ApiKey(
+        id="k-1", tenant_id="t-1", name="ci", scopes=scopes, node_type_ids=node_type_ids or [],
+    ))
+
+
+def test_every_method_has_a_permission():
+    """Test every registered method is classified, so none falls back to admin-key-only by accident."""
+    missing = [name for name in global_methods if name not in METHOD_PERMISSIONS]
+    assert missing == []
+    missing = [name[len(ANALYTICS_METHOD_PREFIX):] for name in analytics_methods]
+    assert [name for name in missing if name not in METHOD_PERMISSIONS] == []
+
+
+def test_grants():
+    """Test the scopes granting each permission."""
+    assert grants(["read"], "nodes:read")
+    assert grants(["read"], "config:read")
+    assert not grants(["read"], "nodes:write")
+    assert grants(["nodes:write"], "nodes:read")
+    assert not grants(["nodes:write"], "schema:write")
+    assert not grants(["nodes:read"], "config:read")
+    assert grants(["nodes:read", "admin"], "admin")
+    assert not grants([], "schema:read")
+
+
+def test_validate_scopes():
+    """Test scope and node type restriction validation."""
+    validate_scopes(["read"], [])
+    validate_scopes(["nodes:read", "nodes:write"], ["nt-1"])
+    with pytest.raises(ValueError, match="scopes is required"):
+        validate_scopes([], [])
+    with pytest.raises(ValueError, match="unknown scope"):
+        validate_scopes(["write"], [])
+    with pytest.raises(ValueError, match="node_type_ids can only restrict"):
+        validate_scopes(["read"], ["nt-1"])
+    with pytest.raises(ValueError, match="empty IDs"):
+        validate_scopes(["nodes:read"], [""])
+
+
+@pytest.mark.asyncio
+async def test_check_access_scopes_and_tenant():
+    """Test API keys are limited to their tenant and the permissions of their scopes."""
+    reader = _key_principal(["read"])
+
+    await check_access(reader, "list_nodes", {"tenant_id": "t-1"})
+    await check_access(reader, "rpc_discover", {})
+    with pytest.raises(PermissionDeniedError, match="tenant"):
+        await check_access(reader, "list_nodes", {"tenant_id": "t-2"})
+    with pytest.raises(PermissionDeniedError, match="nodes:write"):
+        await check_access(reader, "create_node", {"tenant_id": "t-1"})
+    with pytest.raises(PermissionDeniedError, match="admin key"):
+        await check_access(_key_principal(["admin"]), "create_tenant", {})
+    with pytest.raises(PermissionDeniedError, match="admin key"):
+        await check_access(_key_principal(["admin"]), "no_such_method", {"tenant_id": "t-1"})
+
+    # Callers without an API key are not restricted
+    await check_access(Principal(), "create_tenant", {})
+
+
+@pytest.mark.asyncio
+async def test_check_access_user_roles():
+    """Test logged-in users only reach their tenants, with the scopes of their role in each."""
+    user = Principal(kind=USER, user_id="u-1", roles={"t-1": "member", "t-2": "viewer", "t-3": "guest"})
+
+    await check_access(user, "create_node", {"tenant_id": "t-1"})
+    await check_access(user, "list_nodes", {"tenant_id": "t-2"})
+    await check_access(user, "login", {})
+    with pytest.raises(PermissionDeniedError, match="role viewer does not grant nodes:write"):
+        await check_access(user, "create_node", {"tenant_id": "t-2"})
+    with pytest.raises(PermissionDeniedError, match="schema:write"):
+        await check_access(user, "create_node_type", {"tenant_id": "t-1"})
+    with pytest.raises(PermissionDeniedError, match="role guest"):
+        await check_access(user, "list_nodes", {"tenant_id": "t-3"})
+    with pytest.raises(PermissionDeniedError, match="not a member"):
+        await check_access(user, "list_nodes", {"tenant_id": "t-4"})
+    with pytest.raises(PermissionDeniedError, match="admin key"):
+        await check_access(Principal(kind=USER, user_id="u-1", roles={"t-1": "owner"}), "list_users", {})
+
+
+@pytest.mark.asyncio
+async def test_check_access_node_types():
+    """Test keys restricted to node types only reach those node types."""
+    principal = _key_principal(["nodes:write"], ["nt-1"])
+
+    await check_access(principal, "create_node", {"tenant_id": "t-1", "node_type_id": "nt-1"})
+    await check_access(principal, "get_node_type", {"tenant_id": "t-1", "id": "nt-1"})
+    with pytest.raises(PermissionDeniedError, match="nt-2"):
+        await check_access(principal, "batch_get_node_types", {"tenant_id": "t-1", "ids": ["nt-1", "nt-2"]})
+    with pytest.raises(PermissionDeniedError, match="nt-2"):
+        await check_access(principal, "list_nodes", {"tenant_id": "t-1", "node_type_id": "nt-2"})
+    with pytest.raises(PermissionDeniedError, match="node_type_id is required"):
+        await check_access(principal, "list_nodes", {"tenant_id": "t-1", "node_type_id": ""})
+    with pytest.raises(PermissionDeniedError, match="restricted to node types"):
+        await check_access(principal, "list_node_types", {"tenant_id": "t-1"})
+    with pytest.raises(PermissionDeniedError, match="restricted to node types"):
+        await check_access(principal, "stream.export", {"tenant_id": "t-1"})
+
+
+@pytest.mark.asyncio
+async def test_restricted_keys_only_see_edges_among_their_node_types(monkeypatch):
+    """Test a key restricted to node types doesn't see the edges of its nodes leading to nodes of other types."""
+    nodes = {
+        "a-1": Node(id="a-1", node_type_id="nt-1"),
+        "a-2": Node(id="a-2", node_type_id="nt-1"),
+        "b-1": Node(id="b-1", node_type_id="nt-2"),
+    }
+
+    class NodeService:
+        async def batch_get(self, ids):
+            return [nodes[id] for id in ids if id in nodes], [id for id in ids if id not in nodes]
+
+    async def services(tenant_id):
+        return {"node": NodeService()}
+
+    monkeypatch.setattr(authorization, "_services", services)
+    principal = _key_principal(["nodes:read"], ["nt-1"])
+    edges = [
+        Relationship(id="r-1", source_node_id="a-1", target_node_id="a-2"),
+        Relationship(id="r-2", source_node_id="a-1", target_node_id="b-1"),
+        Relationship(id="r-3", source_node_id="b-1", target_node_id="a-1"),
+    ]
+
+    # Listing the edges of an allowed node is allowed...
+    await check_access(principal, "list_relationships", {"tenant_id": "t-1", "source_node_id": "a-1"})
+    set_principal(principal)
+    try:
+        # ...but those leading to a node of another type are left out
+        assert [r.id for r in await visible_relationships("t-1", edges)] == ["r-1"]
+    finally:
+        set_principal(Principal())
+    assert await visible_relationships("t-1", edges) == edges
+
+
+@pytest.mark.asyncio
+async def test_authorize_wraps_methods():
+    """Test authorized methods keep their signature and return a permission error when denied."""
+    async def create_node(tenant_id: str, node_type_id: str, data: str = "{}"):
+        return Success({"created": True})
+
+    methods = authorize({"create_node": create_node})
+    assert inspect.signature(methods["create_node"]) == inspect.signature(create_node)
+
+    set_principal(_key_principal(["read"]))
+    try:
+        result = await methods["create_node"]("t-1", node_type_id="nt-1")
+        assert result_code(result) == PERMISSION_DENIED_CODE
+
+        set_principal(_key_principal(["nodes:write"]))
+        result = await methods["create_node"]("t-1", node_type_id="nt-1")
+        assert result_code(result) is None
+    finally:
+        set_principal(Principal())
+
+
+@pytest.mark.asyncio
+async def test_set_principal_sets_actor():
+    """Test node changes are attributed to the principal of the request."""
+    set_principal(_key_principal(["nodes:write"]))
+    try:
+        assert current_actor() == "api_key:k-1"
+        set_principal(Principal(kind=ADMIN_KEY))
+        assert current_actor() == "admin"
+        set_principal(Principal(kind=USER, user_id="u-1"))
+        assert current_actor() == "user:u-1"
+    finally:
+        set_principal(Principal())
+    assert current_actor() == "anonymous"
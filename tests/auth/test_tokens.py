@@ -0,0 +1,76 @@
+"""
+Tests for login tokens and password hashing.
+"""
+
+import base64
+import json
+
+import pytest
+
+from app.auth.passwords import hash_password, needs_rehash, validate_password, verify_password
+from app.auth.tokens import LEEWAY, InvalidTokenError, TokenSigner, looks_like_token
+from app.repository import TenantUser, User
+
+NOW = 1_790_000_000
+
+
+def _issue(signer, now=NOW):
+    user = User(id="u-1", email="ada@example.com")
+    return signer.issue(user, [TenantUser(tenant_id="t-1", user_id="u-1", role="admin")], now=now)
+
+
+def test_tokens_round_trip():
+    """Test a token carries the user and memberships and expires after the TTL."""
+    signer = TokenSigner("s3cret", 600, "flexdb")
+    token, expires_at = _issue(signer)
+
+    assert looks_like_token(token)
+    assert not looks_like_token("fdb_live_abc.def.ghi")
+    assert expires_at == NOW + 600
+    claims = signer.verify(token, now=NOW + 1)
+    assert (claims["sub"], claims["email"], claims["iss"]) == ("u-1", "ada@example.com", "flexdb")
+    assert claims["tenants"] == [{"tenant_id": "t-1", "role": "admin"}]
+
+    signer.verify(token, now=expires_at + LEEWAY)
+    with pytest.raises(InvalidTokenError, match="expired"):
+        signer.verify(token, now=expires_at + LEEWAY + 1)
+
+
+def test_tampered_and_foreign_tokens_are_rejected():
+    """Test tokens with changed claims, another secret or issuer, or another algorithm are rejected."""
+    signer = TokenSigner("s3cret", 600, "flexdb")
+    token, _ = _issue(signer)
+    header, payload, signature = token.split(".")
+
+    claims = json.loads(base64.urlsafe_b64decode(payload + "=="))
+    claims["tenants"][0]["role"] = "owner"
+    forged = base64.urlsafe_b64encode(json.dumps(claims).encode()).rstrip(b"=").decode()
+    with pytest.raises(InvalidTokenError, match="signature"):
+        signer.verify(f"{header}.{forged}.{signature}", now=NOW)
+
+    unsigned = base64.urlsafe_b64encode(b'{"alg":"none","typ":"JWT"}').rstrip(b"=").decode()
+    with pytest.raises(InvalidTokenError, match="signature"):
+        signer.verify(f"{unsigned}.{payload}.", now=NOW)
+    with pytest.raises(InvalidTokenError, match="signature"):
+        TokenSigner("other", 600, "flexdb").verify(token, now=NOW)
+    with pytest.raises(InvalidTokenError, match="not issued"):
+        TokenSigner("s3cret", 600, "staging").verify(token, now=NOW)
+    with pytest.raises(InvalidTokenError, match="malformed"):
+        signer.verify("eyJ.not.json", now=NOW)
+
+
+def test_passwords():
+    """Test password hashes verify only their password and passwords are length-checked."""
+    password_hash = hash_password("correct horse battery")
+
+    assert password_hash.startswith("$argon2id$")
+    assert verify_password(password_hash, "correct horse battery")
+    assert not verify_password(password_hash, "wrong horse battery")
+    assert not verify_password("", "correct horse battery")
+    assert not needs_rehash(password_hash)
+
+    validate_password("correct horse battery", 12)
+    with pytest.raises(ValueError, match="at least 12"):
+        validate_password("short", 12)
+    with pytest.raises(ValueError, match="at most"):
+        validate_password("x" * 2000, 12)
@@ -0,0 +1,3 @@
+"""
+Attachment blob store tests.
+"""
@@ -0,0 +1,76 @@
+"""
+Tests for attachment blob stores.
+"""
+
+import os
+
+import pytest
+
+from app.blobs import FilesystemBlobStore, S3BlobStore, blob_store_from_config
+from app.config import AttachmentConfig
+from app.lake.storage import GCS_ENDPOINT
+from app.repository import NotFoundError
+
+
+async def _chunks(*chunks):
+    for chunk in chunks:
+        yield chunk
+
+
+async def _read(store, key):
+    return b"".join([chunk async for chunk in store.read(key)])
+
+
+def test_blob_store_from_config():
+    """Test URLs map to S3, GCS interoperability and filesystem stores."""
+    keys = dict(access_key_id="key", secret_access_key="secret")
+
+    store, prefix = blob_store_from_config(AttachmentConfig(url="s3://files/flexdb/", region="eu-west-1", **keys))
+    assert isinstance(store, S3BlobStore)
+    assert prefix == "flexdb"
+    assert store._request_url("t/a b") == "https://files.s3.eu-west-1.amazonaws.com/t/a%20b"
+
+    store, prefix = blob_store_from_config(AttachmentConfig(url="gs://files", **keys))
+    assert store.endpoint == GCS_ENDPOINT
+    assert store._request_url("t/a") == f"{GCS_ENDPOINT}/files/t/a"
+    assert prefix == ""
+
+    store, prefix = blob_store_from_config(AttachmentConfig(url="file:///var/flexdb/files"))
+    assert isinstance(store, FilesystemBlobStore)
+    assert store.root == "/var/flexdb/files"
+
+    with pytest.raises(ValueError, match="ATTACHMENTS_ACCESS_KEY_ID"):
+        blob_store_from_config(AttachmentConfig(url="s3://files"))
+
+
+@pytest.mark.asyncio
+async def test_filesystem_blob_store_round_trip(tmp_path):
+    """Test blobs are written, read back in chunks, replaced and deleted."""
+    store = FilesystemBlobStore(str(tmp_path))
+
+    await store.write("t-1/attachments/a", _chunks(b"hello ", b"world"), "text/plain")
+    assert await _read(store, "t-1/attachments/a") == b"hello world"
+
+    await store.write("t-1/attachments/a", _chunks(b"bye"), "text/plain")
+    assert await _read(store, "t-1/attachments/a") == b"bye"
+
+    await store.delete("t-1/attachments/a")
+    await store.delete("t-1/attachments/a")
+    with pytest.raises(NotFoundError):
+        await _read(store, "t-1/attachments/a")
+
+
+@pytest.mark.asyncio
+async def test_filesystem_blob_store_keeps_blob_when_write_fails(tmp_path):
+    """Test a failed write leaves the existing blob and no partial file."""
+    store = FilesystemBlobStore(str(tmp_path))
+    await store.write("a", _chunks(b"kept"), "text/plain")
+
+    async def failing():
+        yield b"partial"
+        raise ValueError("too large")
+
+    with pytest.raises(ValueError, match="too large"):
+        await store.write("a", failing(), "text/plain")
+    assert await _read(store, "a") == b"kept"
+    assert os.listdir(tmp_path) == ["a"]
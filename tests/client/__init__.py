@@ -0,0 +1,3 @@
+"""
+Client helper tests.
+"""
@@ -0,0 +1,138 @@
+"""
+Tests for the client-side cache, with a fake transport in place of the server.
+"""
+
+import pytest
+
+from flexdb_client import FlexDBClient, RetryPolicy, TenantCache
+
+
+class FakeServer:
+    """Answers get_node, get_node_type and the change feed from dicts, counting the reads."""
+
+    def __init__(self):
+        self.nodes = {"n1": {"id": "n1", "node_type_id": "t1", "data": "{}", "version": 1}}
+        self.node_types = {"t1": {"id": "t1", "name": "Article"}}
+        self.events = []
+        self.reads = 0
+        self.reject_tokens = False
+
+    def change(self, event_type, entity):
+        entity_type = event_type.split(".")[0]
+        self.events.append({"type": event_type, "data": {entity_type: entity}})
+
+    def __call__(self, request):
+        method, params = request["method"], request["params"]
+        if method == "get_change_token":
+            return {"result": {"change_token": str(len(self.events))}}
+        if method == "list_changes":
+            if self.reject_tokens:
+                return {"error": {"code": -32602, "message": f"invalid change token: {params['after']}"}}
+            after = int(params["after"])
+            page = self.events[after:after + 2]
+            return {"result": {
+                "events": page,
+                "next_token": str(after + len(page)),
+                "caught_up": after + len(page) == len(self.events),
+            }}
+        self.reads += 1
+        if method == "get_node":
+            return {"result": {"node": dict(self.nodes[params["id"]])}}
+        return {"result": {"node_type": dict(self.node_types[params["id"]])}}
+
+
+@pytest.fixture
+def server():
+    return FakeServer()
+
+
+@pytest.fixture
+def now():
+    return [0.0]
+
+
+@pytest.fixture
+def cache(server, now):
+    client = FlexDBClient(transport=server, retry=RetryPolicy(max_attempts=1))
+    cache = TenantCache(client.tenant("t1"), max_staleness=30.0, clock=lambda: now[0])
+    cache.sync()
+    return cache
+
+
+def test_reads_are_cached_until_the_feed_lists_a_change(cache, server):
+    """Test nodes and node types are read once, and again after the change feed lists a change to them."""
+    assert cache.get_node("n1")["version"] == 1
+    cache.get_node("n1")["data"] = {"changed": "locally"}
+    assert cache.get_node("n1")["data"] == {}
+    assert cache.get_node_type("t1")["name"] == "Article"
+    assert (server.reads, cache.hits) == (2, 2)
+
+    server.nodes["n1"]["version"] = 2
+    server.change("node.updated", server.nodes["n1"])
+    server.change("relationship.created", {"id": "r1"})
+    server.change("node_type.updated", {"id": "t2"})
+    assert cache.sync() == 3
+
+    assert cache.get_node("n1")["version"] == 2
+    assert cache.get_node_type("t1")["name"] == "Article"
+    assert server.reads == 3
+
+
+def test_deleting_a_node_type_drops_its_nodes(cache, server):
+    """Test a node type delete drops the node type and its nodes, which have no delete events."""
+    cache.get_node("n1")
+    cache.get_node_type("t1")
+    server.change("node_type.deleted", {"id": "t1"})
+    cache.sync()
+
+    cache.get_node("n1")
+    cache.get_node_type("t1")
+    assert server.reads == 4
+
+
+def test_stale_cache_reads_through(cache, server, now):
+    """Test reads go to the server while the feed wasn't read within max_staleness."""
+    cache.get_node("n1")
+    now[0] = 31.0
+    cache.get_node("n1")
+    cache.get_node("n1")
+    assert server.reads == 3
+
+    cache.sync()
+    cache.get_node("n1")
+    assert server.reads == 3
+
+
+def test_writes_and_changes_during_a_read_are_not_cached(cache, server):
+    """Test an entry that changed while it was read isn't cached."""
+    def read_while_changing(request):
+        if request["method"] == "get_node":
+            server.change("node.deleted", {"id": "n1"})
+            cache.sync()
+        return server(request)
+
+    cache.tenant.client.transport = read_while_changing
+    cache.get_node("n1")
+    cache.tenant.client.transport = server
+    cache.get_node("n1")
+    assert server.reads == 2
+
+    cache.invalidate("node", "n1")
+    cache.get_node("n1")
+    assert server.reads == 3
+
+
+def test_invalid_token_clears_the_cache(cache, server):
+    """Test a change token the server rejects drops every entry and starts over at the current position."""
+    cache.get_node("n1")
+    server.reject_tokens = True
+    assert cache.sync() == 0
+    assert not cache.fresh
+    cache.get_node("n1")
+    assert server.reads == 2
+
+    server.reject_tokens = False
+    cache.sync()
+    cache.get_node("n1")
+    cache.get_node("n1")
+    assert (cache.fresh, server.reads) == (True, 3)
@@ -0,0 +1,213 @@
+"""
+Tests for the client SDK, with a fake transport in place of the server.
+"""
+
+import json
+import time
+
+import pytest
+
+from flexdb_client import (
+    ConflictError,
+    FlexDBClient,
+    InvalidParamsError,
+    NotFoundError,
+    RateLimitedError,
+    RetryPolicy,
+    ServiceConfig,
+    UnavailableError,
+)
+
+
+class FakeTransport:
+    """Records requests and answers them with the next reply (or raises it) from a list per method."""
+
+    def __init__(self, replies):
+        self.replies = replies
+        self.requests = []
+
+    def __call__(self, request):
+        self.requests.append(request)
+        reply = self.replies[request["method"]].pop(0)
+        if isinstance(reply, Exception):
+            raise reply
+        return reply
+
+
+def _client(replies, max_attempts=3):
+    sleeps = []
+    transport = FakeTransport(replies)
+    client = FlexDBClient(
+        transport=transport, retry=RetryPolicy(max_attempts=max_attempts, jitter=False), sleep=sleeps.append
+    )
+    return client, transport, sleeps
+
+
+def _page(nodes, token, total=3):
+    return {"result": {"nodes": nodes, "pagination": {"next_page_token": token, "total_count": total}}}
+
+
+def test_tenant_client_lists_all_pages():
+    """Test list iterators follow page tokens, passing the bound tenant and decoding node data."""
+    client, transport, _ = _client({"list_nodes": [
+        _page([{"id": "n1", "data": '{"a": 1}'}, {"id": "n2", "data": "{}"}], "2"),
+        _page([{"id": "n3", "data": '{"a": 3}'}], ""),
+    ]})
+
+    nodes = list(client.tenant("t1").list_nodes("type-1", filter={"a": 1}, page_size=2))
+
+    assert [n["id"] for n in nodes] == ["n1", "n2", "n3"]
+    assert nodes[0]["data"] == {"a": 1}
+    params = {"tenant_id": "t1", "node_type_id": "type-1", "filter": {"a": 1}}
+    assert [r["params"] for r in transport.requests] == [
+        {**params, "pagination": {"page_size": 2, "page_token": ""}},
+        {**params, "pagination": {"page_size": 2, "page_token": "2"}},
+    ]
+
+
+def test_errors_map_to_exceptions():
+    """Test JSON-RPC errors raise the exception of their code, with the message and data."""
+    client, _, sleeps = _client({
+        "get_node": [{"error": {"code": -32001, "message": "node not found: n9"}}],
+        "update_node": [{"error": {"code": -32003, "message": "version conflict"}}],
+    })
+    acme = client.tenant("t1")
+
+    with pytest.raises(NotFoundError, match=r"get_node failed \(-32001\): node not found: n9") as raised:
+        acme.get_node("n9")
+    assert raised.value.message == "node not found: n9"
+    with pytest.raises(ConflictError):
+        acme.update_node("n1", {"a": 2}, expected_version=3)
+    assert sleeps == []
+
+
+def test_errors_expose_reason_and_field_violations():
+    """Test the ErrorInfo reason and BadRequest field violations of error data are exposed."""
+    details = [
+        {"@type": "type.googleapis.com/google.rpc.ErrorInfo", "reason": "INVALID_ARGUMENT", "domain": "flexdb"},
+        {
+            "@type": "type.googleapis.com/google.rpc.BadRequest",
+            "field_violations": [{"field": "data.title", "description": "is required"}],
+        },
+    ]
+    client, _, _ = _client({
+        "get_node": [{"error": {"code": -32602, "message": "data.title is required", "data": {"details": details}}}],
+        "update_node": [{"error": {"code": -32003, "message": "version conflict"}}],
+    })
+    acme = client.tenant("t1")
+
+    with pytest.raises(InvalidParamsError) as raised:
+        acme.get_node("n1")
+    assert raised.value.reason == "INVALID_ARGUMENT"
+    assert raised.value.field_violations == {"data.title": "is required"}
+    # Errors without details
+    with pytest.raises(ConflictError) as raised:
+        acme.update_node("n1", {"a": 2}, expected_version=3)
+    assert raised.value.reason == "" and raised.value.field_violations == {}
+
+
+def test_rate_limited_calls_are_retried_after_the_delay():
+    """Test rate limited calls are retried with backoff, waiting at least retry_after."""
+    limited = {"error": {"code": -32029, "message": "rate limit exceeded", "data": {"retry_after": 0.5}}}
+    created = {"result": {"node": {"id": "n1", "data": "{}"}}}
+    client, transport, sleeps = _client({"create_node": [limited, limited, created]})
+
+    node = client.tenant("t1").create_node("type-1", {"title": "Hello"})
+
+    assert node == {"id": "n1", "data": {}}
+    assert sleeps == [0.5, 0.5]
+    assert json.loads(transport.requests[0]["params"]["data"]) == {"title": "Hello"}
+    assert len({r["id"] for r in transport.requests}) == 3
+
+
+def test_unavailable_writes_are_only_retried_when_not_sent():
+    """Test reads are retried whenever the server was unavailable, writes only if it never got the request."""
+    client, _, sleeps = _client({
+        "get_node": [UnavailableError("HTTP 503"), {"result": {"node": {"id": "n1", "data": "{}"}}}],
+        "delete_node": [UnavailableError("HTTP 503")],
+        "create_tenant": [UnavailableError("refused", sent=False), {"result": {"tenant": {"id": "t2"}}}],
+    })
+
+    assert client.tenant("t1").get_node("n1")["id"] == "n1"
+    with pytest.raises(UnavailableError):
+        client.tenant("t1").delete_node("n1")
+    assert client.create_tenant("acme", "Acme")["id"] == "t2"
+    assert sleeps == [0.2, 0.2]
+
+
+def test_retries_stop_after_max_attempts():
+    """Test the last error is raised once max_attempts calls failed, with growing backoff."""
+    limited = {"error": {"code": -32029, "message": "rate limit exceeded"}}
+    client, transport, sleeps = _client({"get_tenant": [limited] * 3})
+
+    with pytest.raises(RateLimitedError):
+        client.get_tenant("t1")
+    assert len(transport.requests) == 3
+    assert sleeps == [0.2, 0.4]
+
+
+class SlowTransport:
+    """Answers each request after the delay of its attempt, recording when it was sent."""
+
+    def __init__(self, delays, reply):
+        self.delays = list(delays)
+        self.reply = reply
+        self.sent = []
+
+    def __call__(self, request):
+        self.sent.append(request["id"])
+        time.sleep(self.delays.pop(0))
+        return {**self.reply, "id": request["id"]}
+
+
+def test_slow_reads_are_hedged():
+    """Test a read without a reply within the hedging delay is sent again, and the first reply returned."""
+    config = ServiceConfig.from_dict({"methodConfig": [
+        {"name": [{"prefix": "get_"}], "hedgingPolicy": {"maxAttempts": 3, "hedgingDelay": "0.05s"}},
+    ]})
+    transport = SlowTransport([1.0, 0.0], {"result": {"node": {"id": "n1", "data": "{}"}}})
+    client = FlexDBClient(transport=transport, service_config=config)
+
+    started = time.monotonic()
+    assert client.tenant("t1").get_node("n1")["id"] == "n1"
+    assert time.monotonic() - started < 0.5
+    assert transport.sent == [1, 2]
+
+
+def test_hedged_reads_fail_on_fatal_errors():
+    """Test a hedged read fails at once with an error that isn't non-fatal, and with the last one otherwise."""
+    config = ServiceConfig.from_dict({"methodConfig": [
+        {"name": [{}], "hedgingPolicy": {"maxAttempts": 2, "hedgingDelay": "1s",
+                                         "nonFatalStatusCodes": ["UNAVAILABLE"]}},
+    ]})
+    client = FlexDBClient(transport=FakeTransport({
+        "get_node": [{"error": {"code": -32001, "message": "node not found: n9"}}],
+        "get_tenant": [UnavailableError("HTTP 503"), UnavailableError("HTTP 502")],
+    }), service_config=config)
+
+    with pytest.raises(NotFoundError):
+        client.tenant("t1").get_node("n9")
+    with pytest.raises(UnavailableError, match="HTTP 502"):
+        client.get_tenant("t1")
+
+
+def test_retries_stop_at_the_method_timeout():
+    """Test a call isn't retried past its timeout, and transports taking a timeout get the time left."""
+    now = [0.0]
+    timeouts = []
+
+    def transport(request, timeout=None):
+        timeouts.append(timeout)
+        now[0] += 3.0
+        return {"error": {"code": -32029, "message": "rate limit exceeded", "data": {"retry_after": 1.0}}}
+
+    config = ServiceConfig.from_dict({"methodConfig": [
+        {"name": [{}], "timeout": "5s", "retryPolicy": {"maxAttempts": 5, "initialBackoff": "0.1s",
+                                                       "retryableStatusCodes": ["RESOURCE_EXHAUSTED"]}},
+    ]})
+    client = FlexDBClient(transport=transport, service_config=config, sleep=lambda s: now.__setitem__(0, now[0] + s),
+                          clock=lambda: now[0])
+
+    with pytest.raises(RateLimitedError):
+        client.create_tenant("acme", "Acme")
+    assert timeouts == [5.0, 1.0]
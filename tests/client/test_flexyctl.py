@@ -0,0 +1,98 @@
+"""
+Tests for flexyctl, with a fake client in place of the server.
+"""
+
+import io
+import json
+
+import pytest
+
+from flexdb_client.flexyctl import CommandError, apply_node_types, load_node_types, parse_args, run, wait_for_migration
+
+
+class FakeClient:
+    """Records calls and answers them from a dict of method results."""
+
+    def __init__(self, results):
+        self.results = results
+        self.calls = []
+
+    def call(self, method, **params):
+        self.calls.append((method, params))
+        result = self.results[method]
+        return result(params) if callable(result) else result
+
+
+def _node_type(name, schema="", unique_keys=()):
+    return {
+        "id": f"id-{name}", "name": name, "description": "", "schema": schema, "display": "",
+        "version": 3, "unique_keys": [list(k) for k in unique_keys],
+    }
+
+
+def test_load_node_types():
+    """Test node type files turn schema and display objects into JSON text."""
+    text = json.dumps({"node_types": [
+        {"name": "Article", "schema": {"title": "string"}, "unique_keys": ["slug"]},
+        {"name": "Tag", "description": "A tag"},
+    ]})
+
+    assert load_node_types(text, "types.json") == [
+        {"name": "Article", "description": "", "schema": '{"title": "string"}', "display": "", "unique_keys": ["slug"]},
+        {"name": "Tag", "description": "A tag", "schema": "", "display": ""},
+    ]
+    with pytest.raises(CommandError, match=r"node_types\[0\] has unknown fields: colour"):
+        load_node_types('[{"name": "A", "colour": "red"}]')
+    with pytest.raises(CommandError, match="must have a node_types list"):
+        load_node_types('{"types": []}')
+
+
+def test_apply_node_types():
+    """Test new node types are created, changed ones updated and unchanged ones left alone."""
+    client = FakeClient({
+        "list_node_types": {
+            "node_types": [_node_type("Article", '{"title": "string"}'), _node_type("Tag", '{"label": "string"}')],
+            "pagination": {"next_page_token": ""},
+        },
+        "create_node_type": {"node_type": {"id": "id-Author"}},
+        "update_node_type": {"node_type": {}},
+    })
+    node_types = [
+        {"name": "Article", "description": "", "schema": '{"title":"string"}', "display": ""},
+        {"name": "Tag", "description": "", "schema": '{"label": "string", "color": "string"}', "display": ""},
+        {"name": "Author", "description": "", "schema": "", "display": ""},
+    ]
+
+    actions = apply_node_types(client, "t1", node_types)
+
+    assert [a["action"] for a in actions] == ["unchanged", "updated", "created"]
+    update = dict(client.calls)["update_node_type"]
+    assert update["id"] == "id-Tag" and update["expected_version"] == 3
+
+    with pytest.raises(CommandError, match="unique keys can't be changed"):
+        apply_node_types(client, "t1", [{**node_types[0], "unique_keys": ["title"]}])
+
+
+def test_user_add_to_tenant():
+    """Test user add creates the user and adds it to the tenant with the role."""
+    client = FakeClient({"create_user": {"user": {"id": "u1"}}, "add_user_to_tenant": {"tenant_user": {}}})
+    out = io.StringIO()
+
+    run(parse_args(["user", "add", "a@example.com", "A", "--tenant", "t1", "--role", "admin"]), client, out)
+
+    assert client.calls[1] == ("add_user_to_tenant", {"tenant_id": "t1", "user_id": "u1", "role": "admin"})
+    assert json.loads(out.getvalue()) == {"id": "u1"}
+
+
+def test_wait_for_migration():
+    """Test waiting polls a migration until it finishes."""
+    states = iter(["running", "succeeded"])
+    client = FakeClient({"get_node_migration": lambda params: {"migration": {
+        "id": params["id"], "status": next(states), "migrated_count": 5, "failed_count": 0,
+    }}})
+    migration = {"id": "m1", "status": "pending", "migrated_count": 0, "failed_count": 0}
+
+    result = wait_for_migration(client, "t1", migration, io.StringIO(), sleep=lambda s: None)
+
+    assert result["status"] == "succeeded"
+    assert len(client.calls) == 2
@@ -0,0 +1,48 @@
+"""
+Tests for the SDK's service config.
+"""
+
+import pytest
+
+from flexdb_client import HedgingPolicy, RetryPolicy, ServiceConfig
+
+
+def test_published_config_hedges_reads_and_retries_writes():
+    """Test the published config hedges reads, retries rate limited writes and gives long calls more time."""
+    config = ServiceConfig.load()
+
+    read = config.for_method("get_node")
+    assert (read.timeout, read.retry) == (30.0, None)
+    assert read.hedging == HedgingPolicy(max_attempts=3, delay=0.5)
+    assert config.for_method("list_changes") is read
+
+    write = config.for_method("create_node")
+    assert write.timeout == 60.0
+    assert write.retry == RetryPolicy(retryable_status_codes=("RESOURCE_EXHAUSTED",))
+    assert config.for_method("create_node_type_index").timeout == 300.0
+
+
+def test_exact_methods_take_precedence_over_prefixes():
+    """Test a method's own config wins over the longest matching prefix, which wins over the default."""
+    config = ServiceConfig.from_dict({"methodConfig": [
+        {"name": [{}], "timeout": "10s"},
+        {"name": [{"prefix": "get_"}], "timeout": "5s"},
+        {"name": [{"prefix": "get_node"}], "timeout": "2s"},
+        {"name": [{"method": "get_node_at"}], "timeout": "20s"},
+    ]})
+
+    assert [config.for_method(m).timeout for m in ("get_node_at", "get_node", "get_tenant", "create_node")] == [
+        20.0, 2.0, 5.0, 10.0
+    ]
+
+
+@pytest.mark.parametrize("entry, message", [
+    ({"name": [{}], "timeout": "10"}, "invalid duration"),
+    ({"name": [{}], "retryPolicy": {"maxAttempts": 0}}, "maxAttempts"),
+    ({"name": [{}], "retryPolicy": {"maxAttempts": 2}, "hedgingPolicy": {"maxAttempts": 2}}, "not both"),
+    ({"name": [{"service": "flexdb"}]}, "invalid method config name"),
+])
+def test_invalid_configs_are_rejected(entry, message):
+    """Test malformed durations, attempts, policies and names raise ValueError."""
+    with pytest.raises(ValueError, match=message):
+        ServiceConfig.from_dict({"methodConfig": [entry]})
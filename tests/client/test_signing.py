@@ -0,0 +1,34 @@
+"""
+Tests for the client signing helpers.
+"""
+
+import pytest
+
+from app.events.signing import sign_payload, verify_signature
+from flexdb_client.signing import SIGNATURE_HEADER, SignatureError, sign_request, verify_webhook
+
+NOW = 1700000000
+
+
+def test_sign_request_verifies_on_server():
+    """Test requests signed by the client pass the server's verification."""
+    body = b'{"email": "a@example.com"}'
+    headers = sign_request("secret", body, timestamp=NOW)
+
+    assert verify_signature("secret", headers[SIGNATURE_HEADER], body, now=NOW)
+    assert not verify_signature("other", headers[SIGNATURE_HEADER], body, now=NOW)
+
+
+def test_verify_webhook():
+    """Test webhooks signed by the server verify on the client."""
+    body = b'{"type": "node.created"}'
+    header = sign_payload("secret", NOW, body)
+
+    assert verify_webhook("secret", header, body, now=NOW + 10) == NOW
+
+    with pytest.raises(SignatureError, match="does not match"):
+        verify_webhook("secret", header, b"{}", now=NOW)
+    with pytest.raises(SignatureError, match="tolerance"):
+        verify_webhook("secret", header, body, now=NOW + 301)
+    with pytest.raises(SignatureError, match="missing"):
+        verify_webhook("secret", "", body, now=NOW)
@@ -0,0 +1,84 @@
+"""
+Tests for feature negotiation between server instances.
+"""
+
+import pytest
+
+from app.cluster import ClusterMembership, configure_cluster, feature_enabled, negotiate, require_feature
+from app.config import ClusterConfig
+from app.repository import FailedPreconditionError, InMemoryTenantRepository, ServerInstance, Tenant
+from app.service import TenantService
+
+
+class FakeInstanceRepository:
+    """Keeps server instances in memory; all of them are live."""
+
+    def __init__(self, *instances):
+        self.instances = {i.instance_id: i for i in instances}
+
+    async def heartbeat(self, instance):
+        self.instances[instance.instance_id] = instance
+        return instance
+
+    async def list_live(self, max_age):
+        return list(self.instances.values())
+
+    async def remove_stale(self, max_age):
+        return 0
+
+    async def remove(self, instance_id):
+        self.instances.pop(instance_id, None)
+
+
+@pytest.fixture(autouse=True)
+def reset_cluster():
+    yield
+    configure_cluster(None)
+
+
+def test_negotiate_takes_lowest_version_of_shared_features():
+    """Test a feature is usable at the lowest version every instance supports."""
+    instances = [
+        ServerInstance(instance_id="a", features={"tenant_lifecycle": 2, "relabel": 1}),
+        ServerInstance(instance_id="b", features={"tenant_lifecycle": 1}),
+    ]
+
+    assert negotiate(instances) == {"tenant_lifecycle": 1}
+    assert negotiate([]) == {}
+
+
+@pytest.mark.asyncio
+async def test_features_enabled_once_old_instances_leave():
+    """Test features are held back while an instance of an older release runs."""
+    old = ServerInstance(instance_id="old", release="0.9.0", features={})
+    repo = FakeInstanceRepository(old)
+    membership = ClusterMembership(repo, ClusterConfig(instance_id="new"), "1.0.0", {"tenant_lifecycle": 1})
+
+    await membership.refresh()
+    configure_cluster(membership)
+    assert not feature_enabled("tenant_lifecycle")
+    with pytest.raises(FailedPreconditionError, match="tenant_lifecycle is not supported"):
+        require_feature("tenant_lifecycle")
+
+    await repo.remove("old")
+    await membership.refresh()
+    assert feature_enabled("tenant_lifecycle")
+    assert not feature_enabled("tenant_lifecycle", 2)
+
+    await membership.stop()
+    assert repo.instances == {}
+
+
+@pytest.mark.asyncio
+async def test_suspend_tenant_waits_for_rolling_upgrade():
+    """Test tenants can't be suspended until every instance enforces suspensions."""
+    repo = FakeInstanceRepository(ServerInstance(instance_id="old", release="0.9.0"))
+    membership = ClusterMembership(repo, ClusterConfig(instance_id="new"))
+    await membership.refresh()
+    configure_cluster(membership)
+
+    service = TenantService(InMemoryTenantRepository())
+    tenant = await service.repo.create(Tenant(slug="acme", name="Acme"))
+    with pytest.raises(FailedPreconditionError):
+        await service.suspend(tenant.id)
+    assert (await service.repo.get_by_id(tenant.id)).status == "active"
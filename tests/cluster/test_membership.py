@@ -0,0 +1,110 @@
+"""
+Tests for leader roles and the cluster status.
+"""
+
+from datetime import datetime, timedelta, timezone
+
+import pytest
+
+from app.cluster import BACKUP_VERIFY, FEATURES, ROLES, ClusterMembership
+from app.config import ClusterConfig
+from app.repository import ClusterLease, ServerInstance
+from app.service import ClusterService
+
+NOW = datetime(2026, 5, 14, 9, 0, tzinfo=timezone.utc)
+
+
+class FakeInstanceRepository:
+    """Keeps server instances and leases in memory, at a clock the tests advance."""
+
+    def __init__(self):
+        self.now = NOW
+        self.instances = {}
+        self.leases = {}
+
+    async def heartbeat(self, instance):
+        instance.heartbeat_at = self.now
+        self.instances[instance.instance_id] = instance
+        return instance
+
+    async def list_live(self, max_age):
+        return [i for i in self.instances.values() if (self.now - i.heartbeat_at).total_seconds() < max_age]
+
+    async def list_all(self):
+        return list(self.instances.values())
+
+    async def remove(self, instance_id):
+        self.instances.pop(instance_id, None)
+        self.leases = {role: lease for role, lease in self.leases.items() if lease.instance_id != instance_id}
+
+    async def remove_stale(self, max_age):
+        return 0
+
+    async def acquire_lease(self, role, instance_id, ttl):
+        lease = self.leases.get(role)
+        if lease and lease.instance_id != instance_id and lease.expires_at > self.now:
+            return False
+        if not lease or lease.instance_id != instance_id:
+            lease = ClusterLease(role=role, instance_id=instance_id, acquired_at=self.now)
+        lease.expires_at = self.now + timedelta(seconds=ttl)
+        self.leases[role] = lease
+        return True
+
+    async def list_leases(self):
+        return sorted(self.leases.values(), key=lambda lease: lease.role)
+
+
+def member(repo, instance_id):
+    return ClusterMembership(repo, ClusterConfig(instance_id=instance_id, instance_ttl=60.0), roles=[BACKUP_VERIFY])
+
+
+@pytest.mark.asyncio
+async def test_leader_role_moves_when_lease_expires():
+    """Test one instance leads a role until it stops renewing its lease."""
+    repo = FakeInstanceRepository()
+    a, b = member(repo, "a"), member(repo, "b")
+
+    await a.refresh()
+    await b.refresh()
+    assert a.leads(BACKUP_VERIFY)
+    assert not b.leads(BACKUP_VERIFY)
+
+    # a stops sending heartbeats; b takes over once the lease expired
+    repo.now += timedelta(seconds=30)
+    await b.refresh()
+    assert not b.leads(BACKUP_VERIFY)
+    repo.now += timedelta(seconds=31)
+    await b.refresh()
+    assert b.leads(BACKUP_VERIFY)
+    await a.refresh()
+    assert not a.leads(BACKUP_VERIFY)
+
+    # Stopping releases the role at once
+    await b.stop()
+    await a.refresh()
+    assert a.leads(BACKUP_VERIFY)
+
+
+@pytest.mark.asyncio
+async def test_cluster_status_lists_instances_and_role_holders():
+    """Test the cluster status shows live and stale instances and who leads each role."""
+    repo = FakeInstanceRepository()
+    old = ClusterMembership(repo, ClusterConfig(instance_id="old"), "0.9.0", {})
+    await old.refresh()
+    repo.now += timedelta(seconds=120)
+    await member(repo, "new").refresh()
+
+    status = await ClusterService(repo, ClusterConfig(instance_ttl=60.0)).status(repo.now)
+
+    by_id = {instance["instance_id"]: instance for instance in status["instances"]}
+    assert by_id["old"]["status"] == "stale"
+    assert by_id["old"]["heartbeat_age_seconds"] == 120.0
+    assert by_id["new"]["status"] == "live"
+    assert by_id["new"]["leader_roles"] == [BACKUP_VERIFY]
+    assert (status["live_instances"], status["stale_instances"]) == (1, 1)
+    assert status["leader_roles"][BACKUP_VERIFY]["instance_id"] == "new"
+    assert set(status["leader_roles"]) == set(ROLES)
+    assert all(status["leader_roles"][role] is None for role in ROLES if role != BACKUP_VERIFY)
+    # The stale instance no longer holds features back
+    assert status["features"] == FEATURES
+    assert status["releases"] == ["1.0.0"]
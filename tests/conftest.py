@@ -17,17 +17,33 @@ from app.db.tenant_db_manager import TenantDatabaseManager
 from app.repository import (
     TenantRepository,
     UserRepository,
+    ApiKeyRepository,
     NodeTypeRepository,
     NodeRepository,
     RelationshipRepository,
+    OutboxRepository,
+    WebhookRepository,
+    IntakeFormRepository,
+    EmailInboxRepository,
+    TransferRepository,
+    AttachmentRepository,
+    NodeLockRepository,
 )
 from app.service import (
     TenantService,
     UserService,
+    ApiKeyService,
     NodeTypeService,
     NodeService,
     RelationshipService,
+    WebhookService,
+    IntakeFormService,
+    EmailInboxService,
+    TransferService,
+    AttachmentService,
+    NodeLockService,
 )
+from app.blobs import FilesystemBlobStore
 from main import create_app
 
 
@@ -90,9 +106,16 @@ async def clean_control_db(test_config: Config) -> AsyncGenerator[Database, None
         await conn.execute("SET session_replication_role = 'replica';")
         
         # Delete all data (in reverse order of dependencies)
+        await conn.execute("DELETE FROM tenant_deletions")
+        await conn.execute("DELETE FROM tenant_slug_changes")
+        await conn.execute("DELETE FROM audit_exports")
+        await conn.execute("DELETE FROM backup_verifications")
+        await conn.execute("DELETE FROM audit_events")
+        await conn.execute("DELETE FROM api_keys")
         await conn.execute("DELETE FROM tenant_users")
         await conn.execute("DELETE FROM tenant_migrations")
         await conn.execute("DELETE FROM tenant_databases")
+        await conn.execute("DELETE FROM user_credentials")
         await conn.execute("DELETE FROM users")
         await conn.execute("DELETE FROM tenants")
         
@@ -123,6 +146,12 @@ async def user_repo(clean_control_db: Database) -> UserRepository:
     return UserRepository(clean_control_db)
 
 
+@pytest.fixture
+async def api_key_repo(clean_control_db: Database) -> ApiKeyRepository:
+    """Create API key repository."""
+    return ApiKeyRepository(clean_control_db)
+
+
 @pytest.fixture
 async def tenant_service(tenant_repo: TenantRepository, tenant_db_manager: TenantDatabaseManager) -> TenantService:
     """Create tenant service."""
@@ -135,6 +164,12 @@ async def user_service(user_repo: UserRepository) -> UserService:
     return UserService(user_repo)
 
 
+@pytest.fixture
+async def api_key_service(api_key_repo: ApiKeyRepository) -> ApiKeyService:
+    """Create API key service."""
+    return ApiKeyService(api_key_repo)
+
+
 @pytest.fixture
 async def tenant_db(
     test_config: Config,
@@ -157,9 +192,28 @@ async def tenant_db(
     # Cleanup tenant database after test
     async with tenant_db.pool.acquire() as conn:
         await conn.execute("SET session_replication_role = 'replica';")
+        await conn.execute("DELETE FROM attachments")
+        await conn.execute("DELETE FROM node_locks")
+        await conn.execute("DELETE FROM email_attachments")
+        await conn.execute("DELETE FROM inbound_emails")
+        await conn.execute("DELETE FROM email_inboxes")
+        await conn.execute("DELETE FROM intake_forms")
+        await conn.execute("DELETE FROM dead_letters")
+        await conn.execute("DELETE FROM webhook_deliveries")
+        await conn.execute("DELETE FROM webhook_endpoints")
+        await conn.execute("DELETE FROM subscription_messages")
+        await conn.execute("DELETE FROM event_subscriptions")
+        await conn.execute("DELETE FROM outbox_events")
+        await conn.execute("DELETE FROM lake_exports")
+        await conn.execute("DELETE FROM retention_policies")
+        await conn.execute("DELETE FROM bulk_jobs")
         await conn.execute("DELETE FROM relationships")
+        await conn.execute("DELETE FROM node_revisions")
         await conn.execute("DELETE FROM nodes")
+        await conn.execute("DELETE FROM node_migrations")
+        await conn.execute("DELETE FROM node_type_indexes")
         await conn.execute("DELETE FROM node_types")
+        await conn.execute("DELETE FROM data_keys")
         await conn.execute("DELETE FROM schema_migrations")  # Clean migrations table too
         await conn.execute("SET session_replication_role = 'origin';")
     
@@ -187,6 +241,30 @@ async def relationship_repo(tenant_db: Database) -> RelationshipRepository:
     return RelationshipRepository(tenant_db)
 
 
+@pytest.fixture
+async def outbox_repo(tenant_db: Database) -> OutboxRepository:
+    """Create outbox repository for tenant database."""
+    return OutboxRepository(tenant_db)
+
+
+@pytest.fixture
+async def webhook_repo(tenant_db: Database) -> WebhookRepository:
+    """Create webhook repository for tenant database."""
+    return WebhookRepository(tenant_db)
+
+
+@pytest.fixture
+async def intake_repo(tenant_db: Database) -> IntakeFormRepository:
+    """Create intake form repository for tenant database."""
+    return IntakeFormRepository(tenant_db)
+
+
+@pytest.fixture
+async def inbox_repo(tenant_db: Database) -> EmailInboxRepository:
+    """Create email inbox repository for tenant database."""
+    return EmailInboxRepository(tenant_db)
+
+
 @pytest.fixture
 async def nodetype_service(nodetype_repo: NodeTypeRepository) -> NodeTypeService:
     """Create node type service."""
@@ -205,6 +283,52 @@ async def relationship_service(relationship_repo: RelationshipRepository, node_r
     return RelationshipService(relationship_repo, node_repo)
 
 
+@pytest.fixture
+async def webhook_service(webhook_repo: WebhookRepository) -> WebhookService:
+    """Create webhook service."""
+    return WebhookService(webhook_repo)
+
+
+@pytest.fixture
+async def intake_service(
+    intake_repo: IntakeFormRepository,
+    nodetype_repo: NodeTypeRepository,
+    node_service: NodeService
+) -> IntakeFormService:
+    """Create intake form service."""
+    return IntakeFormService(intake_repo, nodetype_repo, node_service)
+
+
+@pytest.fixture
+async def inbox_service(
+    inbox_repo: EmailInboxRepository,
+    nodetype_repo: NodeTypeRepository,
+    node_service: NodeService
+) -> EmailInboxService:
+    """Create email inbox service."""
+    return EmailInboxService(inbox_repo, nodetype_repo, node_service)
+
+
+@pytest.fixture
+async def transfer_service(tenant_db: Database, nodetype_repo: NodeTypeRepository) -> TransferService:
+    """Create tenant data transfer service."""
+    return TransferService(TransferRepository(tenant_db), nodetype_repo)
+
+
+@pytest.fixture
+async def attachment_service(tenant_db: Database, node_repo: NodeRepository, tmp_path) -> AttachmentService:
+    """Create attachment service storing blobs in a temporary directory."""
+    return AttachmentService(
+        AttachmentRepository(tenant_db), node_repo, "test-tenant", FilesystemBlobStore(str(tmp_path)), max_bytes=1024
+    )
+
+
+@pytest.fixture
+async def node_lock_service(tenant_db: Database) -> NodeLockService:
+    """Create node lock service."""
+    return NodeLockService(NodeLockRepository(tenant_db))
+
+
 @pytest.fixture
 async def test_tenant(tenant_service: TenantService) -> dict:
     """Create and return a test tenant."""
@@ -271,6 +395,7 @@ async def async_client(
     from app.api.dependencies import set_tenant_db_manager
     from app.jsonrpc.handlers import register_methods
     from app.jsonrpc.server import router as jsonrpc_router
+    from app.logs import RequestIdMiddleware
     
     # Initialize app dependencies before creating app
     set_tenant_db_manager(tenant_db_manager)
@@ -283,6 +408,7 @@ async def async_client(
         version="1.0.0",
     )
     app.include_router(jsonrpc_router)
+    app.add_middleware(RequestIdMiddleware)
     
     @app.get("/health")
     async def health_check():
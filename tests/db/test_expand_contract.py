@@ -0,0 +1,92 @@
+"""
+Tests for expand/contract migrations.
+"""
+
+from contextlib import asynccontextmanager
+
+import pytest
+
+from app.db.expand_contract import parse_directives
+from app.db.migrator import list_migrations, migrate_up
+
+
+class FakeConn:
+    """Records executed statements; schema_changes rows are given by change name."""
+
+    def __init__(self, changes=None):
+        self.changes = changes or {}
+        self.executed = []
+
+    @asynccontextmanager
+    async def transaction(self):
+        yield
+
+    async def execute(self, query, *args):
+        self.executed.append((query.strip(), args))
+
+    async def fetchrow(self, query, *args):
+        return self.changes.get(args[0])
+
+
+def _write_migrations(tmp_path):
+    (tmp_path / "001_create_nodes.up.sql").write_text("CREATE TABLE nodes (id INT);\n")
+    (tmp_path / "002_add_nodes_title.up.sql").write_text(
+        "-- Migration: 002_add_nodes_title.up.sql\n"
+        "-- flexdb:expand nodes_title\n"
+        "\n"
+        "ALTER TABLE nodes ADD COLUMN title TEXT;\n"
+    )
+    (tmp_path / "003_drop_nodes_name.up.sql").write_text(
+        "-- flexdb:contract nodes_title\n"
+        "ALTER TABLE nodes DROP COLUMN name;\n"
+    )
+    (tmp_path / "004_add_nodes_rank.up.sql").write_text("ALTER TABLE nodes ADD COLUMN rank INT;\n")
+
+
+def _applied(conn):
+    return [args[0] for query, args in conn.executed if query.startswith("INSERT INTO schema_migrations")]
+
+
+def test_parse_directives(tmp_path):
+    """Test directives are read from the leading comments of an up file only."""
+    _write_migrations(tmp_path)
+    later = tmp_path / "005_later.up.sql"
+    later.write_text("SELECT 1;\n-- flexdb:expand ignored\n")
+    invalid = tmp_path / "006_invalid.up.sql"
+    invalid.write_text("-- flexdb:rename nodes_title\n")
+
+    assert parse_directives(tmp_path / "002_add_nodes_title.up.sql") == ("nodes_title", "")
+    assert parse_directives(tmp_path / "003_drop_nodes_name.up.sql") == ("", "nodes_title")
+    assert parse_directives(later) == ("", "")
+    with pytest.raises(ValueError, match="invalid migration directive"):
+        parse_directives(invalid)
+
+
+@pytest.mark.asyncio
+async def test_contract_migrations_are_deferred(tmp_path):
+    """Test contract migrations are skipped at startup while later migrations still apply."""
+    _write_migrations(tmp_path)
+    conn = FakeConn()
+
+    applied = await migrate_up(conn, tmp_path, [])
+
+    assert applied == ["001_create_nodes", "002_add_nodes_title", "004_add_nodes_rank"]
+    assert _applied(conn) == applied
+    assert any(q.startswith("INSERT INTO schema_changes") and a == ("nodes_title",) for q, a in conn.executed)
+    assert [m.contracts for m in list_migrations(tmp_path)] == ["", "", "nodes_title", ""]
+
+
+@pytest.mark.asyncio
+async def test_contract_requires_closed_dual_write_window(tmp_path):
+    """Test a contract migration is refused while its change is still dual-writing."""
+    _write_migrations(tmp_path)
+    done = ["001_create_nodes", "002_add_nodes_title", "004_add_nodes_rank"]
+
+    conn = FakeConn({"nodes_title": {"dual_write": True, "backfilled_at": None}})
+    with pytest.raises(ValueError, match="still dual-writing"):
+        await migrate_up(conn, tmp_path, done, contract=True)
+    assert _applied(conn) == []
+
+    conn = FakeConn({"nodes_title": {"dual_write": False, "backfilled_at": None}})
+    assert await migrate_up(conn, tmp_path, done, contract=True) == ["003_drop_nodes_name"]
+    assert any(q.startswith("UPDATE schema_changes SET contracted_at") for q, _ in conn.executed)
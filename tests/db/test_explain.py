@@ -0,0 +1,110 @@
+"""
+Tests for query plan captures.
+"""
+
+import json
+
+import asyncpg
+import pytest
+
+from app.db.database import TimedPool
+from app.db.explain import MAX_PLANS, plan_capture
+
+
+class FakeSavepoint:
+    def __init__(self, conn):
+        self.conn = conn
+
+    async def start(self):
+        self.conn.log.append("savepoint")
+
+    async def rollback(self):
+        self.conn.log.append("rollback")
+
+
+class FakeConnection:
+    """Connection logging the statements it runs."""
+
+    def __init__(self):
+        self.log = []
+
+    def transaction(self):
+        return FakeSavepoint(self)
+
+    async def execute(self, query, *args):
+        self.log.append(query)
+        return "SET"
+
+    async def fetchval(self, query, *args):
+        self.log.append(query)
+        if query.startswith("EXPLAIN") and "broken" in query:
+            raise asyncpg.PostgresError("canceling statement due to statement timeout")
+        if query.startswith("EXPLAIN"):
+            return json.dumps([{"Plan": {"Node Type": "Seq Scan"}}])
+        return 3
+
+
+class FakeAcquire:
+    def __init__(self, conn):
+        self.conn = conn
+
+    async def __aenter__(self):
+        return self.conn
+
+    async def __aexit__(self, *exc_info):
+        return None
+
+
+class FakePool:
+    def __init__(self, conn):
+        self.conn = conn
+
+    def acquire(self, timeout=None):
+        return FakeAcquire(self.conn)
+
+
+@pytest.mark.asyncio
+async def test_selects_are_explained_in_a_rolled_back_savepoint():
+    """Test SELECTs run in a capture are explained with a timeout and still run, and other statements aren't."""
+    conn = FakeConnection()
+    pool = TimedPool(FakePool(conn))
+
+    with plan_capture(analyze=True, timeout=2.0) as capture:
+        async with pool.acquire() as c:
+            assert await c.fetchval("SELECT count(*)\n  FROM nodes WHERE tenant_id = $1", "t1") == 3
+            await c.execute("UPDATE nodes SET data = '{}'")
+            await c.fetchval("SELECT broken")
+
+    assert conn.log[:5] == [
+        "savepoint",
+        "SET LOCAL statement_timeout = 2000",
+        "EXPLAIN (ANALYZE, BUFFERS, FORMAT JSON) SELECT count(*)\n  FROM nodes WHERE tenant_id = $1",
+        "rollback",
+        "SELECT count(*)\n  FROM nodes WHERE tenant_id = $1",
+    ]
+    assert "EXPLAIN (ANALYZE, BUFFERS, FORMAT JSON) UPDATE nodes SET data = '{}'" not in conn.log
+    assert [plan.to_dict() for plan in capture.plans] == [
+        {"query": "SELECT count(*) FROM nodes WHERE tenant_id = $1", "plan": [{"Plan": {"Node Type": "Seq Scan"}}]},
+        {"query": "SELECT broken", "plan": None, "error": "canceling statement due to statement timeout"},
+    ]
+
+    # Outside the capture, nothing is explained
+    conn.log.clear()
+    async with pool.acquire() as c:
+        await c.fetchval("SELECT 1")
+    assert conn.log == ["SELECT 1"]
+
+
+@pytest.mark.asyncio
+async def test_plans_are_limited_per_capture():
+    """Test statements beyond MAX_PLANS are run but not explained, and estimates skip ANALYZE."""
+    conn = FakeConnection()
+    pool = TimedPool(FakePool(conn))
+
+    with plan_capture(analyze=False) as capture:
+        async with pool.acquire() as c:
+            for _ in range(MAX_PLANS + 1):
+                await c.fetchval("SELECT 1")
+
+    assert len(capture.plans) == MAX_PLANS and capture.truncated
+    assert "EXPLAIN (FORMAT JSON) SELECT 1" in conn.log
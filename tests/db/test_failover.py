@@ -0,0 +1,61 @@
+"""
+Tests for failover routing.
+"""
+
+import json
+from datetime import datetime, timezone
+
+import pytest
+
+from app.config import Config, FailoverConfig
+from app.db.failover import apply_routing, next_routing, read_routing, write_routing
+
+PRIMARY = {"host": "db-a", "port": 5432}
+STANDBY = {"host": "db-b", "port": 5432}
+NOW = datetime(2026, 5, 14, 9, 0, tzinfo=timezone.utc)
+
+
+def test_apply_routing_without_file(tmp_path):
+    """Test the configured primary is used until a failover wrote the routing file."""
+    cfg = Config(host="db-a")
+
+    assert apply_routing(cfg, FailoverConfig()) is cfg
+    assert apply_routing(cfg, FailoverConfig(routing_file=str(tmp_path / "routing.json"))) is cfg
+
+
+def test_failover_routes_to_standby_and_fences_primary(tmp_path):
+    """Test servers are routed to the promoted standby and refuse the fenced primary."""
+    path = str(tmp_path / "routing.json")
+    write_routing(path, next_routing(None, PRIMARY, STANDBY, "db-a disk failure", NOW))
+
+    routed = apply_routing(Config(host="db-a", user="flexdb"), FailoverConfig(routing_file=path))
+    assert (routed.host, routed.port, routed.user) == ("db-b", 5432, "flexdb")
+
+    with open(path) as f:
+        routing = json.load(f)
+    assert routing["fenced"] == [PRIMARY]
+    assert routing["reason"] == "db-a disk failure"
+
+    with open(path, "w") as f:
+        json.dump({**routing, "primary": PRIMARY}, f)
+    with pytest.raises(ValueError, match="fenced"):
+        apply_routing(Config(), FailoverConfig(routing_file=path))
+
+
+def test_failing_back_unfences_the_old_primary(tmp_path):
+    """Test promoting a fenced server again removes it from the fenced servers."""
+    first = next_routing(None, PRIMARY, STANDBY, "failover", NOW)
+    back = next_routing(first, STANDBY, PRIMARY, "failback", NOW)
+
+    assert back["primary"] == PRIMARY
+    assert back["fenced"] == [STANDBY]
+    assert back["previous_primary"] == STANDBY
+
+
+def test_read_routing_rejects_malformed_file(tmp_path):
+    """Test a routing file without a primary is rejected rather than ignored."""
+    path = tmp_path / "routing.json"
+    path.write_text('{"fenced": []}')
+
+    with pytest.raises(ValueError, match="primary"):
+        read_routing(str(path))
@@ -0,0 +1,31 @@
+"""
+Tests for migration file discovery.
+"""
+
+from pathlib import Path
+
+import pytest
+
+from app.db.migrator import list_migrations, version_number
+
+DB_DIR = Path(__file__).resolve().parents[2] / "app" / "db"
+
+
+@pytest.mark.parametrize("name", ["migrations", "control_migrations", "tenant_migrations"])
+def test_every_migration_has_down_script(name):
+    """Test each up migration has a matching down migration."""
+    migrations = list_migrations(DB_DIR / name)
+
+    assert migrations
+    assert [m.version for m in migrations if m.down_path is None] == []
+    assert [m.number for m in migrations] == sorted(m.number for m in migrations)
+
+
+def test_version_number():
+    """Test parsing the numeric prefix of a migration version."""
+    assert version_number("007_add_node_type_display") == 7
+    assert version_number("009") == 9
+    assert version_number("0") == 0
+
+    with pytest.raises(ValueError):
+        version_number("latest")
@@ -0,0 +1,141 @@
+"""
+Tests for connection pool lifecycles and statistics.
+"""
+
+import pytest
+
+from app.db.database import TimedPool, _pools, pool_metric_lines
+
+
+class FakeClock:
+    def __init__(self):
+        self.now = 0.0
+
+    def __call__(self) -> float:
+        return self.now
+
+
+class FakeConnection:
+    def __init__(self, pid):
+        self.pid = pid
+        self.closed = False
+        self.broken = False
+        self.queries = []
+
+    def get_server_pid(self):
+        return self.pid
+
+    def is_closed(self):
+        return self.closed
+
+    async def execute(self, query, *args, timeout=None):
+        if self.broken:
+            raise ConnectionResetError("connection reset by peer")
+        self.queries.append(query)
+        return "SELECT 1"
+
+    async def close(self, timeout=None):
+        self.closed = True
+
+    def terminate(self):
+        self.closed = True
+
+
+class FakeAcquire:
+    def __init__(self, pool):
+        self.pool = pool
+
+    async def __aenter__(self):
+        # Closed connections are replaced, like asyncpg does
+        if self.pool.conn.closed:
+            self.pool.conn = FakeConnection(self.pool.conn.pid + 1)
+        return self.pool.conn
+
+    async def __aexit__(self, *exc_info):
+        return None
+
+
+class FakePool:
+    """Pool of a single connection."""
+
+    def __init__(self):
+        self.conn = FakeConnection(100)
+
+    def acquire(self, timeout=None):
+        return FakeAcquire(self)
+
+    def is_closing(self):
+        return False
+
+    def get_size(self):
+        return 4
+
+    def get_idle_size(self):
+        return 3
+
+    def get_max_size(self):
+        return 10
+
+
+@pytest.mark.asyncio
+async def test_connections_are_retired_after_their_lifetime():
+    """Test connections are closed on release once they lived max_lifetime, less at most the jitter."""
+    clock = FakeClock()
+    pool = TimedPool(FakePool(), "tenant", max_lifetime=100.0, clock=clock)
+
+    async with pool.acquire() as conn:
+        assert conn.pid == 100
+    clock.now = 89.0
+    async with pool.acquire() as conn:
+        assert conn.pid == 100
+    assert not conn.closed
+
+    clock.now = 100.0
+    async with pool.acquire() as conn:
+        pass
+    assert conn.closed
+    async with pool.acquire() as conn:
+        assert conn.pid == 101
+    assert pool.retired == {"lifetime": 1, "health_check": 0}
+
+
+@pytest.mark.asyncio
+async def test_idle_connections_are_health_checked():
+    """Test connections idle for the health check period are checked when acquired, and broken ones replaced."""
+    clock = FakeClock()
+    pool = TimedPool(FakePool(), "tenant", health_check_period=60.0, clock=clock)
+
+    async with pool.acquire() as conn:
+        pass
+    clock.now = 30.0
+    async with pool.acquire() as conn:
+        assert conn.queries == []
+
+    clock.now = 100.0
+    async with pool.acquire() as conn:
+        assert conn.queries == ["SELECT 1"]
+
+    clock.now = 200.0
+    conn.broken = True
+    async with pool.acquire() as replacement:
+        assert replacement.pid == 101
+    assert conn.closed
+    assert pool.retired == {"lifetime": 0, "health_check": 1}
+    assert pool.acquires == 4
+
+
+def test_pool_statistics_are_summed_per_role():
+    """Test pool metrics sum the connections and counters of the open pools of each role."""
+    pools = [TimedPool(FakePool(), "tenant"), TimedPool(FakePool(), "tenant"), TimedPool(FakePool(), "control")]
+    pools[0].acquires, pools[1].acquires = 5, 7
+    for pool in pools:
+        _pools.add(pool)
+
+    text = "\n".join(pool_metric_lines())
+    assert 'flexdb_db_pools{role="tenant"} 2' in text
+    assert 'flexdb_db_pool_connections{role="tenant",state="idle"} 6' in text
+    assert 'flexdb_db_pool_connections{role="tenant",state="in_use"} 2' in text
+    assert 'flexdb_db_pool_max_connections{role="control"} 10' in text
+    assert 'flexdb_db_pool_acquires_total{role="tenant"} 12' in text
+    assert 'flexdb_db_pool_connections_retired_total{role="tenant",reason="lifetime"} 0' in text
+    assert "# TYPE flexdb_db_pool_acquires counter" in "\n".join(pool_metric_lines(openmetrics=True))
@@ -0,0 +1,83 @@
+"""
+Tests for read replica routing.
+"""
+
+import asyncio
+
+import pytest
+
+from app.db.database import Database
+from app.db.replicas import replica_reads, replica_routed, start_read_session
+
+
+class FakeAcquire:
+    def __init__(self, pool):
+        self.pool = pool
+
+    async def __aenter__(self):
+        if self.pool.down:
+            raise ConnectionRefusedError(f"{self.pool.name} is down")
+        return self.pool.name
+
+    async def __aexit__(self, *exc_info):
+        return None
+
+
+class FakePool:
+    """Pool whose connections are its name."""
+
+    def __init__(self, name, down=False):
+        self.name = name
+        self.down = down
+
+    def acquire(self, timeout=None):
+        return FakeAcquire(self)
+
+
+async def read(db: Database) -> str:
+    async with db.read_pool.acquire() as conn:
+        return conn
+
+
+@pytest.mark.asyncio
+async def test_reads_use_replicas_only_within_replica_reads():
+    """Test read_pool takes turns among the replicas within replica reads, and is the primary otherwise."""
+    db = Database(FakePool("primary"), [FakePool("replica-1"), FakePool("replica-2")])
+
+    assert await read(db) == "primary"
+    with replica_reads():
+        assert [await read(db) for _ in range(3)] == ["replica-1", "replica-2", "replica-1"]
+
+    # Replicas that can't be reached fall back to the primary
+    db.replicas[1]._pool.down = True
+    with replica_reads():
+        assert [await read(db) for _ in range(2)] == ["primary", "replica-1"]
+
+    # Without replicas everything reads the primary
+    with replica_reads():
+        assert await read(Database(FakePool("primary"))) == "primary"
+
+
+@pytest.mark.asyncio
+async def test_requests_read_their_own_writes():
+    """Test strong consistency and writes earlier in a request make its reads use the primary."""
+    db = Database(FakePool("primary"), [FakePool("replica")])
+
+    async def get_node():
+        return await read(db)
+
+    async def update_node():
+        return await read(db)
+
+    methods = replica_routed({"get_node": get_node, "update_node": update_node}, {"get_node"})
+
+    async def request(consistency: str, *names: str):
+        start_read_session(consistency)
+        return [await methods[name]() for name in names]
+
+    # Each request runs in its own context, like the requests of the ASGI server
+    assert await asyncio.create_task(request("", "get_node", "update_node", "get_node")) == [
+        "replica", "primary", "primary"
+    ]
+    assert await asyncio.create_task(request("strong", "get_node")) == ["primary"]
+    assert await asyncio.create_task(request("eventual", "get_node")) == ["replica"]
@@ -0,0 +1,61 @@
+"""
+Tests for row-level security tenant scoping.
+"""
+
+import pytest
+
+from app.config import Config
+from app.db.rls import current_tenant, enter_tenant, pool_setup, tenant_scope, tenant_scoped
+
+
+def test_tenant_scope():
+    """Test the current tenant is set within a scope and restored after it."""
+    assert current_tenant() == ""
+
+    with tenant_scope("tenant-1"):
+        assert current_tenant() == "tenant-1"
+        with tenant_scope("tenant-2"):
+            assert current_tenant() == "tenant-2"
+        assert current_tenant() == "tenant-1"
+
+    assert current_tenant() == ""
+
+
+def test_enter_tenant_never_switches_tenants():
+    """Test entering a tenant only takes effect outside of another tenant's scope."""
+    with tenant_scope("tenant-1"):
+        enter_tenant("tenant-2")
+        assert current_tenant() == "tenant-1"
+
+    with tenant_scope(""):
+        enter_tenant("tenant-2")
+        assert current_tenant() == "tenant-2"
+
+
+@pytest.mark.asyncio
+async def test_tenant_scoped_methods():
+    """Test methods with a tenant_id parameter run in that tenant's scope."""
+    seen = []
+
+    async def get_node(tenant_id: str, id: str):
+        seen.append(current_tenant())
+        return id
+
+    async def list_tenants(page_size: int = 10):
+        seen.append(current_tenant())
+        return page_size
+
+    methods = tenant_scoped({"get_node": get_node, "list_tenants": list_tenants})
+
+    assert methods["list_tenants"] is list_tenants
+    assert await methods["get_node"]("tenant-1", id="node-1") == "node-1"
+    assert await methods["get_node"](id="node-2", tenant_id="tenant-2") == "node-2"
+    assert await methods["list_tenants"](page_size=5) == 5
+    assert seen == ["tenant-1", "tenant-2", ""]
+    assert current_tenant() == ""
+
+
+def test_pool_setup_only_when_enabled():
+    """Test pools only set the current tenant on connections when RLS is enabled."""
+    assert pool_setup(Config(rls_enabled=False)) is None
+    assert pool_setup(Config(rls_enabled=True)) is not None
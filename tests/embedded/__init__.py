@@ -0,0 +1,3 @@
+"""
+Embedded mode tests.
+"""
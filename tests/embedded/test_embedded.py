@@ -0,0 +1,103 @@
+"""
+Tests for embedded mode on the in-memory and sqlite backends.
+"""
+
+import pytest
+
+from app.config import Config
+from app.embedded import MEMORY, SQLITE, EmbeddedError, NodeTypes, Nodes, Relationships, Tenants, Users, open_embedded
+from app.repository import FailedPreconditionError, NotFoundError
+
+
+@pytest.mark.asyncio
+async def test_embedded_calls():
+    """Test JSON-RPC methods called in-process return the server's results and error codes."""
+    db = await open_embedded(MEMORY)
+    try:
+        with pytest.raises(RuntimeError, match="already open"):
+            await open_embedded(MEMORY)
+
+        tenant = (await db.call("create_tenant", {"slug": "acme", "name": "Acme"}))["tenant"]
+        node_type = (await db.call(
+            "create_node_type", {"tenant_id": tenant["id"], "name": "Task", "schema": '{"title": "string"}'}
+        ))["node_type"]
+        node = (await db.call(
+            "create_node", {"tenant_id": tenant["id"], "node_type_id": node_type["id"], "data": '{"title": "A"}'}
+        ))["node"]
+
+        listed = await db.call("list_nodes", {"tenant_id": tenant["id"], "filter": {"title": "A"}})
+        assert [n["id"] for n in listed["nodes"]] == [node["id"]]
+        # The services are at hand too
+        services = await db.tenant_services(tenant["id"])
+        assert (await services["node"].get_by_id(node["id"])).data == '{"title": "A"}'
+
+        with pytest.raises(EmbeddedError) as err:
+            await db.call("get_node", {"tenant_id": tenant["id"], "id": "missing"})
+        assert err.value.code == -32001
+        with pytest.raises(EmbeddedError) as err:
+            await db.call("list_webhook_endpoints", {"tenant_id": tenant["id"]})
+        assert err.value.code == -32602
+
+        await db.call("suspend_tenant", {"id": tenant["id"]})
+        with pytest.raises(EmbeddedError, match="suspended"):
+            await db.call("get_node", {"tenant_id": tenant["id"], "id": node["id"]})
+    finally:
+        await db.close()
+
+    # Closing releases the process-wide services for another instance
+    db = await open_embedded(MEMORY)
+    await db.close()
+
+
+@pytest.mark.asyncio
+async def test_embedded_direct_service_calls():
+    """Test tenant services called directly satisfy the stable interfaces and see the same data as calls."""
+    db = await open_embedded(MEMORY)
+    try:
+        assert isinstance(db.tenants, Tenants) and isinstance(db.users, Users)
+        tenant = await db.tenants.create("acme", "Acme")
+
+        async with db.tenant(tenant.id) as t:
+            assert isinstance(t.node_types, NodeTypes)
+            assert isinstance(t.nodes, Nodes)
+            assert isinstance(t.relationships, Relationships)
+            node_type = await t.node_types.create("Task", "", "")
+            a = await t.nodes.create(node_type.id, '{"title": "A"}')
+            b = await t.nodes.create(node_type.id, '{"title": "B"}')
+            await t.relationships.create(a.id, b.id, "blocks", "")
+
+        listed = await db.call("list_relationships", {"tenant_id": tenant.id, "source_node_id": a.id})
+        assert [r["target_node_id"] for r in listed["relationships"]] == [b.id]
+
+        with pytest.raises(NotFoundError):
+            async with db.tenant("missing"):
+                pass
+        await db.tenants.suspend(tenant.id)
+        with pytest.raises(FailedPreconditionError):
+            async with db.tenant(tenant.id):
+                pass
+    finally:
+        await db.close()
+
+
+@pytest.mark.asyncio
+async def test_embedded_sqlite(tmp_path):
+    """Test the sqlite backend keeps tenants and their data across instances."""
+    cfg = Config(sqlite_dir=str(tmp_path))
+    db = await open_embedded(SQLITE, cfg)
+    try:
+        tenant = (await db.call("create_tenant", {"slug": "acme", "name": "Acme"}))["tenant"]
+        node_type = (await db.call("create_node_type", {"tenant_id": tenant["id"], "name": "Task"}))["node_type"]
+        await db.call("create_node", {"tenant_id": tenant["id"], "node_type_id": node_type["id"], "data": "{}"})
+        with pytest.raises(EmbeddedError) as err:
+            await db.call("list_webhook_endpoints", {"tenant_id": tenant["id"]})
+        assert err.value.code == -32602
+    finally:
+        await db.close()
+
+    db = await open_embedded(SQLITE, cfg)
+    try:
+        counted = await db.call("count_nodes", {"tenant_id": tenant["id"], "node_type_id": node_type["id"]})
+        assert counted["count"] == 1
+    finally:
+        await db.close()
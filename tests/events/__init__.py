@@ -0,0 +1,3 @@
+"""
+Event and webhook delivery tests.
+"""
@@ -0,0 +1,106 @@
+"""
+Tests for Debezium and protobuf change data capture.
+"""
+
+import json
+from datetime import datetime, timezone
+
+import pytest
+
+from app.events.cdc import debezium_messages, protobuf_messages, topic_name
+from app.events.protobuf import OP_DELETE, OP_UPDATE, ChangeEvent, decode_change_event, encode_change_event
+from app.repository import Node, OutboxEvent
+
+
+def _event(event_type, node):
+    return OutboxEvent(
+        id=42,
+        event_id="e-1",
+        event_type=event_type,
+        entity_type="node",
+        entity_id=node.id,
+        payload=json.dumps({"node": node.to_dict()}),
+        created_at=datetime(2024, 1, 2, tzinfo=timezone.utc),
+    )
+
+
+def test_create_event_envelope():
+    """Test a created event becomes a Debezium "c" message keyed by ID."""
+    node = Node(id="n1", node_type_id="t1", data='{"title": "a"}')
+
+    [message] = debezium_messages("tenant-1", _event("node.created", node), "flexdb", now_ms=1000)
+
+    assert message.topic == "flexdb.tenant-1.nodes"
+    assert json.loads(message.key) == {"id": "n1"}
+    value = json.loads(message.value)
+    assert value["op"] == "c"
+    assert value["before"] is None
+    assert value["after"]["data"] == '{"title": "a"}'
+    assert "tenant_id" not in value["after"]
+    assert value["ts_ms"] == 1000
+    assert value["source"]["db"] == "tenant-1"
+    assert value["source"]["table"] == "nodes"
+    assert value["source"]["ts_ms"] == 1704153600000
+    assert value["source"]["sequence"] == "42"
+
+
+def test_delete_event_has_before_and_tombstone():
+    """Test a deleted event carries the old row and is followed by a tombstone."""
+    node = Node(id="n1", node_type_id="t1")
+
+    messages = debezium_messages("tenant-1", _event("node.deleted", node), "flexdb")
+
+    value = json.loads(messages[0].value)
+    assert value["op"] == "d"
+    assert value["before"]["id"] == "n1"
+    assert value["after"] is None
+    assert messages[1].value is None
+    assert messages[1].key == messages[0].key
+
+    assert len(debezium_messages("tenant-1", _event("node.deleted", node), "flexdb", tombstones=False)) == 1
+
+
+def test_topics_per_table():
+    """Test each entity type has its own topic."""
+    assert topic_name("cdc", "t", "node_type") == "cdc.t.node_types"
+    assert topic_name("cdc", "t", "relationship") == "cdc.t.relationships"
+    with pytest.raises(ValueError):
+        debezium_messages("t", OutboxEvent(entity_type="webhook", event_type="webhook.created"), "cdc")
+
+
+def test_protobuf_event_round_trip():
+    """Test a change becomes a protobuf ChangeEvent keyed by entity ID."""
+    node = Node(id="n1", node_type_id="t1", data='{"title": "a"}')
+
+    [message] = protobuf_messages("tenant-1", _event("node.updated", node), "flexdb")
+
+    assert message.topic == "flexdb.tenant-1.nodes"
+    assert message.key == b"n1"
+    assert message.id == "e-1"
+    event = decode_change_event(message.value)
+    assert event.event_id == "e-1"
+    assert event.sequence == 42
+    assert event.tenant_id == "tenant-1"
+    assert event.entity_type == "node"
+    assert event.entity_id == "n1"
+    assert event.op == OP_UPDATE
+    assert event.ts_ms == 1704153600000
+    assert event.node_type_id == "t1"
+    assert event.schema_version == 1
+    assert event.entity()["data"] == '{"title": "a"}'
+    assert "tenant_id" not in event.entity()
+
+
+def test_protobuf_delete_and_unknown_fields():
+    """Test deletes carry the old entity and decoding skips fields added later."""
+    node = Node(id="n1", node_type_id="t1")
+
+    messages = protobuf_messages("tenant-1", _event("node.deleted", node), "flexdb")
+
+    assert decode_change_event(messages[0].value).op == OP_DELETE
+    assert messages[1].value is None
+    # Field 15 (varint) and field 16 (string) are unknown to this decoder
+    extended = messages[0].value + b"\x78\x01" + b"\x82\x01\x02hi"
+    assert decode_change_event(extended) == decode_change_event(messages[0].value)
+    assert encode_change_event(ChangeEvent(ts_ms=-1)) == b"\x40" + b"\xff" * 9 + b"\x01"
+    assert decode_change_event(encode_change_event(ChangeEvent(ts_ms=-1))).ts_ms == -1
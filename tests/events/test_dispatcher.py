@@ -0,0 +1,114 @@
+"""
+Tests for WebhookDispatcher.
+"""
+
+import json
+
+import httpx
+import pytest
+
+from app.config import WebhookConfig
+from app.events import WebhookDispatcher, SIGNATURE_HEADER, verify_signature
+from app.repository.models import NodeType, WebhookEndpoint
+
+
+class FakeClient:
+    """Records requests and replies with a fixed status code."""
+
+    def __init__(self, status_code: int):
+        self.status_code = status_code
+        self.requests = []
+
+    async def post(self, url, content=None, headers=None):
+        self.requests.append((url, content, headers))
+        return httpx.Response(self.status_code)
+
+
+@pytest.mark.asyncio
+async def test_dispatch_delivers_signed_event(tenant_db, webhook_repo, nodetype_repo):
+    """Test a change event is POSTed with a valid signature and marked succeeded."""
+    endpoint = await webhook_repo.create(WebhookEndpoint(url="https://example.com/hooks", secret="s3cret"))
+    await nodetype_repo.create(NodeType(name="Article", schema="{}"))
+
+    client = FakeClient(204)
+    dispatcher = WebhookDispatcher(None, WebhookConfig(), client=client)
+    await dispatcher.dispatch_tenant("tenant-1", tenant_db)
+
+    assert len(client.requests) == 1
+    url, body, headers = client.requests[0]
+    assert url == endpoint.url
+    assert headers["X-FlexDB-Event"] == "node_type.created"
+    assert headers["X-FlexDB-Event-Schema"] == "node_type.created/v1"
+    assert verify_signature("s3cret", headers[SIGNATURE_HEADER], body)
+    envelope = json.loads(body)
+    assert envelope["tenant_id"] == "tenant-1"
+    assert envelope["schema_version"] == 1
+    assert envelope["data"]["node_type"]["name"] == "Article"
+
+    async with tenant_db.pool.acquire() as conn:
+        status = await conn.fetchval("SELECT status FROM webhook_deliveries")
+    assert status == "succeeded"
+
+
+@pytest.mark.asyncio
+async def test_dispatch_retries_then_fails(tenant_db, webhook_repo, nodetype_repo):
+    """Test failed deliveries are retried with backoff and fail after max attempts."""
+    await webhook_repo.create(WebhookEndpoint(url="https://example.com/hooks", secret="s"))
+    await nodetype_repo.create(NodeType(name="Article", schema="{}"))
+
+    client = FakeClient(500)
+    dispatcher = WebhookDispatcher(None, WebhookConfig(max_attempts=2, backoff_base=0), client=client)
+
+    await dispatcher.dispatch_tenant("tenant-1", tenant_db)
+    async with tenant_db.pool.acquire() as conn:
+        row = await conn.fetchrow("SELECT status, attempts FROM webhook_deliveries")
+    assert (row["status"], row["attempts"]) == ("pending", 1)
+
+    await dispatcher.dispatch_tenant("tenant-1", tenant_db)
+    async with tenant_db.pool.acquire() as conn:
+        row = await conn.fetchrow("SELECT status, attempts, last_status_code FROM webhook_deliveries")
+    assert (row["status"], row["attempts"], row["last_status_code"]) == ("failed", 2, 500)
+
+
+@pytest.mark.asyncio
+async def test_dispatch_posts_slack_message(tenant_db, webhook_repo, nodetype_repo):
+    """Test Slack endpoints receive a rendered chat message instead of the signed envelope."""
+    await webhook_repo.create(WebhookEndpoint(
+        url="https://hooks.slack.com/services/T/B/X", secret="s", kind="slack",
+        template="New type {{entity.name}}",
+    ))
+    await nodetype_repo.create(NodeType(name="Article", schema="{}"))
+
+    client = FakeClient(200)
+    dispatcher = WebhookDispatcher(None, WebhookConfig(), client=client)
+    await dispatcher.dispatch_tenant("tenant-1", tenant_db)
+
+    assert len(client.requests) == 1
+    _, body, headers = client.requests[0]
+    assert json.loads(body) == {"text": "New type Article"}
+    assert SIGNATURE_HEADER not in headers
+
+
+@pytest.mark.asyncio
+async def test_dispatch_test_event_once(tenant_db, webhook_repo):
+    """Test test events reach disabled endpoints, signed, and fail after one attempt."""
+    endpoint = await webhook_repo.create(WebhookEndpoint(url="https://example.com/hooks", secret="s", status="disabled"))
+    delivery = await webhook_repo.create_test_delivery(endpoint.id, "webhook.test", {"message": "hi"})
+
+    client = FakeClient(500)
+    dispatcher = WebhookDispatcher(None, WebhookConfig(), client=client)
+    await dispatcher.dispatch_tenant("tenant-1", tenant_db)
+
+    [(_, body, headers)] = client.requests
+    assert headers["X-FlexDB-Event"] == "webhook.test"
+    assert verify_signature("s", headers[SIGNATURE_HEADER], body)
+    delivery = await webhook_repo.get_delivery(delivery.id)
+    assert (delivery.status, delivery.attempts, delivery.last_status_code) == ("failed", 1, 500)
+    assert delivery.last_latency_ms is not None
+
+
+def test_backoff_is_capped():
+    """Test exponential backoff doubles per attempt up to the maximum."""
+    dispatcher = WebhookDispatcher(None, WebhookConfig(backoff_base=5, backoff_max=30), client=FakeClient(200))
+
+    assert [dispatcher.backoff(n) for n in (1, 2, 3, 4)] == [5, 10, 20, 30]
@@ -0,0 +1,33 @@
+"""
+Tests for redaction of event payloads in webhook delivery logs.
+"""
+
+import json
+
+from app.events.redaction import REDACTED, redact_payload
+
+
+def test_redact_payload():
+    """Test credential-like fields and encrypted values are redacted, inside node data too."""
+    payload = {
+        "node": {
+            "id": "n-1",
+            "data": json.dumps({"title": "Hello", "api_token": "abc", "ssn": "enc:1:AAAA", "tags": ["a"]}),
+        },
+        "Authorization": "Bearer x",
+        "items": [{"password": "p", "name": "n"}],
+    }
+
+    redacted = redact_payload(payload)
+
+    assert json.loads(redacted["node"]["data"]) == {"title": "Hello", "api_token": REDACTED, "ssn": REDACTED, "tags": ["a"]}
+    assert redacted["Authorization"] == REDACTED
+    assert redacted["items"] == [{"password": REDACTED, "name": "n"}]
+    assert redacted["node"]["id"] == "n-1"
+    assert json.loads(payload["node"]["data"])["api_token"] == "abc"
+
+
+def test_redact_payload_keeps_non_object_data():
+    """Test data that isn't a JSON object is left as it is."""
+    assert redact_payload({"data": "not json"}) == {"data": "not json"}
+    assert redact_payload({"data": "[1, 2]"}) == {"data": "[1, 2]"}
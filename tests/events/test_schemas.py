@@ -0,0 +1,34 @@
+"""
+Tests for the event schema registry.
+"""
+
+import pytest
+
+from app.events import EVENT_TYPES, event_schema_version, get_event_schema, list_event_schemas
+from app.repository import ApiKey, Node, NodeType, NotFoundError, Relationship
+
+
+def test_every_event_type_has_a_schema():
+    """Test every event type has a current schema, listed with the registry."""
+    ids = {schema.id for schema in list_event_schemas()}
+    for event_type in EVENT_TYPES:
+        assert event_schema_version(event_type) == 1
+        assert f"{event_type}/v1" in ids
+    assert get_event_schema("node.created").to_dict()["schema"]["required"] == ["node"]
+
+    with pytest.raises(ValueError, match="unknown event type"):
+        get_event_schema("node.renamed")
+    with pytest.raises(NotFoundError):
+        get_event_schema("node.created", 2)
+
+
+@pytest.mark.parametrize("event_type, entity, record", [
+    ("node_type.created", "node_type", NodeType(id="t1", name="Article")),
+    ("node.updated", "node", Node(id="n1", node_type_id="t1")),
+    ("relationship.deleted", "relationship", Relationship(id="r1", source_node_id="a", target_node_id="b")),
+    ("api_key.expiring", "api_key", ApiKey(id="k1", name="ci")),
+])
+def test_schemas_describe_every_field(event_type, entity, record):
+    """Test the schemas declare every field of the entities in event payloads."""
+    properties = get_event_schema(event_type).schema["properties"][entity]["properties"]
+    assert set(record.to_dict()) <= set(properties)
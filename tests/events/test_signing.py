@@ -0,0 +1,71 @@
+"""
+Tests for webhook payload signing.
+"""
+
+import pytest
+
+from app.events.signing import compute_signature, sign_payload, updated_secret, verify_signature
+
+NOW = 1700000000
+
+
+def test_sign_payload_format():
+    """Test the signature header carries timestamp and v1 HMAC."""
+    body = b'{"id": "1"}'
+    header = sign_payload("secret", 1700000000, body)
+
+    assert header == "t=1700000000,v1=" + compute_signature("secret", 1700000000, body)
+
+
+def test_verify_signature_roundtrip():
+    """Test a signed payload verifies with the same secret."""
+    body = b'{"type": "node.created"}'
+    header = sign_payload("secret", 1700000000, body)
+
+    assert verify_signature("secret", header, body, now=NOW)
+
+
+def test_verify_signature_rejects_tampering():
+    """Test verification fails for a different body, secret or malformed header."""
+    body = b'{"type": "node.created"}'
+    header = sign_payload("secret", 1700000000, body)
+
+    assert not verify_signature("secret", header, b'{"type": "node.deleted"}', now=NOW)
+    assert not verify_signature("other", header, body, now=NOW)
+    assert not verify_signature("secret", "v1=abc", body, now=NOW)
+    assert not verify_signature("secret", "t=soon," + header, body, now=NOW)
+
+
+def test_verify_signature_replay_window():
+    """Test signatures outside the tolerance are rejected as replays, unless it is 0."""
+    body = b'{"type": "node.created"}'
+    header = sign_payload("secret", NOW, body)
+
+    assert verify_signature("secret", header, body, tolerance=300, now=NOW + 300)
+    assert verify_signature("secret", header, body, tolerance=300, now=NOW - 300)
+    assert not verify_signature("secret", header, body, tolerance=300, now=NOW + 301)
+    assert verify_signature("secret", header, body, tolerance=0, now=NOW + 86400)
+
+
+def test_verify_signature_any_of_several():
+    """Test a header signed with an old and a new secret verifies with either."""
+    body = b"{}"
+    header = sign_payload("old", NOW, body) + ",v1=" + compute_signature("new", NOW, body)
+
+    assert verify_signature("old", header, body, now=NOW)
+    assert verify_signature("new", header, body, now=NOW)
+    assert not verify_signature("other", header, body, now=NOW)
+
+
+def test_updated_secret():
+    """Test signing secrets are created, kept, rotated and removed on update."""
+    assert updated_secret("", None, False) == ""
+    assert updated_secret("s", None, False) == "s"
+    assert updated_secret("s", True, False) == "s"
+    assert updated_secret("s", False, False) == ""
+    assert len(updated_secret("", True, False)) == 64
+    rotated = updated_secret("s", None, True)
+    assert rotated not in ("", "s")
+
+    with pytest.raises(ValueError, match="require_signature"):
+        updated_secret("", None, True)
@@ -0,0 +1,61 @@
+"""
+Tests for Slack and Teams notification sinks.
+"""
+
+import json
+
+import pytest
+
+from app.events.sinks import build_message, render_template, template_context, validate_template
+
+
+def _envelope():
+    return {
+        "id": "evt-1",
+        "type": "node.created",
+        "tenant_id": "tenant-1",
+        "created_at": "2026-01-01T00:00:00+00:00",
+        "data": {"node": {"id": "n-1", "node_type_id": "t-1", "data": json.dumps({"title": "Hello"})}},
+    }
+
+
+def test_render_template_paths():
+    """Test placeholders resolve envelope paths, including into JSON node data."""
+    context = template_context(_envelope())
+
+    text = render_template("{{action}} {{entity_type}} {{entity.id}}: {{ entity.data.title }}{{missing}}", context)
+
+    assert text == "created node n-1: Hello"
+
+
+def test_render_default_template():
+    """Test an empty template falls back to the default message."""
+    assert render_template("", template_context(_envelope())) == "node.created: node n-1 (tenant tenant-1)"
+
+
+def test_slack_message_escapes_values():
+    """Test Slack messages escape control characters in substituted values only."""
+    envelope = _envelope()
+    envelope["data"]["node"]["data"] = json.dumps({"title": "<b>&"})
+
+    message = build_message("slack", "*New:* {{entity.data.title}} <https://example.com|open>", envelope)
+
+    assert message == {"text": "*New:* &lt;b&gt;&amp; <https://example.com|open>"}
+
+
+def test_teams_message_is_adaptive_card():
+    """Test Teams messages wrap the text in an Adaptive Card."""
+    message = build_message("teams", "{{type}}", _envelope())
+
+    card = message["attachments"][0]
+    assert card["contentType"] == "application/vnd.microsoft.card.adaptive"
+    assert card["content"]["body"][0]["text"] == "node.created"
+
+
+def test_validate_template():
+    """Test template validation rejects malformed placeholders."""
+    validate_template("{{entity.data.title}} by {{tenant_id}}")
+    with pytest.raises(ValueError, match="invalid placeholder"):
+        validate_template("{{entity data}}")
+    with pytest.raises(ValueError, match="at most"):
+        validate_template("x" * 2001)
@@ -0,0 +1,3 @@
+"""
+Public form intake tests.
+"""
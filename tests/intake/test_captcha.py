@@ -0,0 +1,51 @@
+"""
+Tests for CaptchaVerifier.
+"""
+
+import httpx
+import pytest
+
+from app.config import IntakeConfig
+from app.intake import CaptchaVerifier
+
+
+class FakeClient:
+    """Records siteverify requests and replies with a fixed JSON body."""
+
+    def __init__(self, status_code: int, body: dict):
+        self.status_code = status_code
+        self.body = body
+        self.requests = []
+
+    async def post(self, url, data=None):
+        self.requests.append((url, data))
+        return httpx.Response(self.status_code, json=self.body)
+
+
+@pytest.mark.asyncio
+async def test_verify_posts_secret_and_response():
+    """Test a successful siteverify answer passes verification."""
+    cfg = IntakeConfig(captcha_verify_url="https://captcha.example.com/siteverify", captcha_secret="s3cret")
+    client = FakeClient(200, {"success": True})
+
+    assert await CaptchaVerifier(cfg, client=client).verify("token-1", "203.0.113.7")
+
+    url, form = client.requests[0]
+    assert url == "https://captcha.example.com/siteverify"
+    assert form == {"secret": "s3cret", "response": "token-1", "remoteip": "203.0.113.7"}
+
+
+@pytest.mark.asyncio
+async def test_verify_fails_closed():
+    """Test missing tokens, missing secrets and provider errors fail verification."""
+    client = FakeClient(200, {"success": True})
+
+    assert not await CaptchaVerifier(IntakeConfig(captcha_secret="s"), client=client).verify("")
+    assert not await CaptchaVerifier(IntakeConfig(), client=client).verify("token")
+    assert client.requests == []
+
+    rejected = FakeClient(200, {"success": False, "error-codes": ["invalid-input-response"]})
+    assert not await CaptchaVerifier(IntakeConfig(captcha_secret="s"), client=rejected).verify("token")
+
+    unavailable = FakeClient(503, {})
+    assert not await CaptchaVerifier(IntakeConfig(captcha_secret="s"), client=unavailable).verify("token")
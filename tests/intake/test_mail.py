@@ -0,0 +1,115 @@
+"""
+Tests for inbound email parsing.
+"""
+
+import base64
+import json
+
+import pytest
+
+from app.intake import confirm_sns_subscription, parse_mime, parse_sendgrid, parse_ses_notification
+
+RAW_EMAIL = b"""From: Jane Doe <jane@example.com>
+To: support@acme.test, Bob <bob@acme.test>
+Subject: Printer broken
+Message-ID: <abc@mail.example.com>
+MIME-Version: 1.0
+Content-Type: multipart/mixed; boundary="outer"
+
+--outer
+Content-Type: multipart/alternative; boundary="inner"
+
+--inner
+Content-Type: text/plain
+
+It is on fire.
+--inner
+Content-Type: text/html
+
+<p>It is on fire.</p>
+--inner--
+--outer
+Content-Type: image/png
+Content-Disposition: attachment; filename="fire.png"
+Content-Transfer-Encoding: base64
+
+aGVsbG8=
+--outer--
+"""
+
+
+def test_parse_mime():
+    """Test parsing addresses, bodies and attachments of a raw message."""
+    email = parse_mime(RAW_EMAIL)
+
+    assert email.from_address == "jane@example.com"
+    assert email.from_name == "Jane Doe"
+    assert email.to == ["support@acme.test", "bob@acme.test"]
+    assert email.subject == "Printer broken"
+    assert email.message_id == "<abc@mail.example.com>"
+    assert email.text.strip() == "It is on fire."
+    assert email.html.strip() == "<p>It is on fire.</p>"
+    assert len(email.attachments) == 1
+    assert email.attachments[0].filename == "fire.png"
+    assert email.attachments[0].content_type == "image/png"
+    assert email.attachments[0].content == b"hello"
+
+
+def test_parse_sendgrid():
+    """Test parsing a SendGrid Inbound Parse multipart post."""
+    parts = [
+        ('name="from"', "Jane <jane@example.com>"),
+        ('name="to"', "support@acme.test"),
+        ('name="subject"', "Hi there"),
+        ('name="text"', "Body text"),
+        ('name="headers"', "Message-ID: <m1@example.com>\nSubject: Hi there\n"),
+        ('name="attachment-info"', json.dumps({"attachment1": {"filename": "notes.txt", "type": "text/plain"}})),
+    ]
+    body = b""
+    for disposition, value in parts:
+        body += f"--XX\r\nContent-Disposition: form-data; {disposition}\r\n\r\n{value}\r\n".encode()
+    body += b'--XX\r\nContent-Disposition: form-data; name="attachment1"; filename="notes.txt"\r\n'
+    body += b"Content-Type: text/plain\r\n\r\nremember the milk\r\n--XX--\r\n"
+
+    email = parse_sendgrid("multipart/form-data; boundary=XX", body)
+
+    assert email.from_address == "jane@example.com"
+    assert email.to == ["support@acme.test"]
+    assert email.subject == "Hi there"
+    assert email.text == "Body text"
+    assert email.message_id == "<m1@example.com>"
+    assert [(a.filename, a.content) for a in email.attachments] == [("notes.txt", b"remember the milk")]
+
+    with pytest.raises(ValueError, match="multipart/form-data"):
+        parse_sendgrid("application/json", b"{}")
+
+
+def test_parse_ses_notification():
+    """Test parsing SES receipt notifications delivered over SNS."""
+    notification = {
+        "notificationType": "Received",
+        "receipt": {"action": {"type": "SNS", "encoding": "BASE64"}},
+        "content": base64.b64encode(RAW_EMAIL).decode(),
+    }
+    body = json.dumps({"Type": "Notification", "Message": json.dumps(notification)}).encode()
+
+    message_type, email = parse_ses_notification(body)
+    assert message_type == "Notification"
+    assert email.subject == "Printer broken"
+
+    message_type, email = parse_ses_notification(b'{"Type": "SubscriptionConfirmation"}')
+    assert message_type == "SubscriptionConfirmation"
+    assert email is None
+
+    no_content = json.dumps({"Type": "Notification", "Message": json.dumps({"mail": {}})}).encode()
+    with pytest.raises(ValueError, match="no message content"):
+        parse_ses_notification(no_content)
+
+
+@pytest.mark.asyncio
+async def test_confirm_sns_subscription_only_calls_sns():
+    """Test subscription confirmation refuses URLs outside amazonaws.com."""
+    body = json.dumps({"Type": "SubscriptionConfirmation", "SubscribeURL": "https://evil.example.com/confirm"})
+
+    with pytest.raises(ValueError, match="amazonaws.com"):
+        await confirm_sns_subscription(body.encode())
@@ -0,0 +1,48 @@
+"""
+Tests for RateLimiter.
+"""
+
+from app.intake import RateLimiter
+
+
+class FakeClock:
+    """Manually advanced monotonic clock."""
+
+    def __init__(self):
+        self.now = 1000.0
+
+    def __call__(self) -> float:
+        return self.now
+
+
+def test_allows_up_to_limit_within_window():
+    """Test hits beyond the limit are rejected until the window slides."""
+    clock = FakeClock()
+    limiter = RateLimiter(window=60.0, clock=clock)
+
+    assert limiter.allow("ip:1", 2)
+    clock.now += 10
+    assert limiter.allow("ip:1", 2)
+    assert not limiter.allow("ip:1", 2)
+    assert limiter.retry_after("ip:1") == 50.0
+
+    # Other keys are counted separately
+    assert limiter.allow("ip:2", 2)
+
+    clock.now += 50
+    assert limiter.allow("ip:1", 2)
+    assert not limiter.allow("ip:1", 2)
+
+
+def test_rejected_hits_are_not_counted():
+    """Test that rejected hits do not extend the window."""
+    clock = FakeClock()
+    limiter = RateLimiter(window=60.0, clock=clock)
+
+    assert limiter.allow("k", 1)
+    for _ in range(5):
+        clock.now += 10
+        assert not limiter.allow("k", 1)
+
+    clock.now += 10
+    assert limiter.allow("k", 1)
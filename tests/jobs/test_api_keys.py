@@ -0,0 +1,101 @@
+"""
+Tests for the API key policy worker.
+"""
+
+from datetime import datetime, timezone
+
+import pytest
+
+import app.jobs.api_keys as api_keys_module
+from app.config import ApiKeyPolicyConfig
+from app.jobs.api_keys import DAY, ApiKeyPolicyWorker
+from app.repository import ApiKey
+
+
+class FakeApiKeyRepository:
+    def __init__(self):
+        self.disabled = []
+        self.expiring = []
+        self.unused = []
+        self.calls = []
+        self.warned = []
+
+    async def disable_unused(self, idle):
+        self.calls.append(("disable_unused", idle))
+        return self.disabled
+
+    async def list_expiring(self, within):
+        self.calls.append(("list_expiring", within))
+        return self.expiring
+
+    async def list_unused(self, idle):
+        self.calls.append(("list_unused", idle))
+        return self.unused
+
+    async def mark_warned(self, id):
+        self.warned.append(id)
+
+
+class FakeTenantDatabaseManager:
+    def __init__(self, failing=()):
+        self.failing = failing
+
+    async def get_tenant_db(self, tenant_id):
+        if tenant_id in self.failing:
+            raise RuntimeError("tenant database unavailable")
+        return tenant_id
+
+
+def _key(id, tenant_id="t-1", **kwargs):
+    created_at = datetime(2024, 1, 1, tzinfo=timezone.utc)
+    return ApiKey(id=id, tenant_id=tenant_id, name=id, scopes=["read"], created_at=created_at, **kwargs)
+
+
+@pytest.mark.asyncio
+async def test_policy_notifies_tenants(monkeypatch):
+    """Test unused keys are revoked and tenants are warned through their outbox."""
+    repo = FakeApiKeyRepository()
+    repo.disabled = [_key("k-disabled")]
+    repo.expiring = [_key("k-expiring", expires_at=datetime(2024, 2, 1, tzinfo=timezone.utc))]
+    repo.unused = [_key("k-unused"), _key("k-broken", tenant_id="t-2")]
+    manager = FakeTenantDatabaseManager(failing=("t-2",))
+    worker = ApiKeyPolicyWorker(repo, manager, ApiKeyPolicyConfig(disable_unused_days=90, warning_days=7))
+
+    events = []
+
+    class FakeOutboxRepository:
+        def __init__(self, db):
+            self.db = db
+
+        async def record(self, event_type, entity_type, entity_id, payload):
+            events.append((self.db, event_type, entity_id, payload))
+
+    monkeypatch.setattr(api_keys_module, "OutboxRepository", FakeOutboxRepository)
+    await worker.run_once()
+
+    assert repo.calls == [
+        ("disable_unused", 90 * DAY),
+        ("list_expiring", 7 * DAY),
+        ("list_unused", 83 * DAY),
+    ]
+    assert [(db, event_type, id) for db, event_type, id, _ in events] == [
+        ("t-1", "api_key.disabled", "k-disabled"),
+        ("t-1", "api_key.expiring", "k-expiring"),
+        ("t-1", "api_key.unused", "k-unused"),
+    ]
+    assert events[1][3]["expires_at"] == "2024-02-01T00:00:00+00:00"
+    assert events[2][3]["disables_at"] == "2024-03-31T00:00:00+00:00"
+    assert events[2][3]["api_key"]["name"] == "k-unused"
+    # The failed notification is retried on the next poll
+    assert repo.warned == ["k-expiring", "k-unused"]
+
+
+@pytest.mark.asyncio
+async def test_policy_disabled_by_default():
+    """Test nothing is revoked or warned about unless configured."""
+    repo = FakeApiKeyRepository()
+    worker = ApiKeyPolicyWorker(repo, FakeTenantDatabaseManager(), ApiKeyPolicyConfig(warning_days=0))
+
+    await worker.run_once()
+
+    assert repo.calls == []
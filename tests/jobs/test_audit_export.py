@@ -0,0 +1,151 @@
+"""
+Tests for the audit log export and its verification.
+"""
+
+import json
+import os
+from datetime import datetime, timezone
+
+import pytest
+
+from app.config import AuditExportConfig
+from app.jobs.audit_export import GENESIS_HASH, AuditExporter, batch_key, verify_audit_exports
+from app.lake.storage import LocalObjectStore
+from app.repository import AuditEvent, AuditExport
+
+
+class FakeAuditRepository:
+    """Keeps the audit log and its exports in memory, like AuditRepository."""
+
+    def __init__(self):
+        self.events = []
+        self.exports = []
+        self.erased = set()
+
+    def add(self, event_type, tenant_id=""):
+        event = AuditEvent(
+            id=str(len(self.events) + 1),
+            tenant_id=tenant_id,
+            event_type=event_type,
+            client_ip="10.0.0.1",
+            details={"scope": "ip"},
+            created_at=datetime(2026, 1, 1, tzinfo=timezone.utc),
+        )
+        self.events.append(event)
+        return event
+
+    async def export_next(self, limit, settle_seconds, export):
+        last = self.exports[-1] if self.exports else None
+        after = last.last_event_id if last else 0
+        events = [e for e in self.events if int(e.id) > after][:limit]
+        if not events:
+            return None
+        batch = await export(last, events)
+        self.exports.append(batch)
+        return batch
+
+    async def list_exports(self):
+        return list(self.exports)
+
+    async def list_range(self, first_id, last_id):
+        return [e for e in self.events if first_id <= int(e.id) <= last_id]
+
+    async def list_erased_tenant_ids(self):
+        return set(self.erased)
+
+
+@pytest.fixture
+def repo():
+    repo = FakeAuditRepository()
+    for i in range(5):
+        repo.add(f"security.event_{i}")
+    return repo
+
+
+async def _export(repo, root, batch_size=2):
+    exporter = AuditExporter(repo, AuditExportConfig(batch_size=batch_size), LocalObjectStore(str(root)), "flexdb")
+    return await exporter.run_once()
+
+
+def _rewrite(root, sequence, change):
+    path = os.path.join(root, batch_key("flexdb", sequence))
+    with open(path, "rb") as f:
+        batch = json.loads(f.read())
+    change(batch)
+    os.chmod(path, 0o644)
+    with open(path, "wb") as f:
+        f.write(json.dumps(batch, sort_keys=True, separators=(",", ":")).encode())
+
+
+@pytest.mark.asyncio
+async def test_export_chains_batches(repo, tmp_path):
+    """Test events are exported in batches that each include the previous batch's hash."""
+    assert await _export(repo, tmp_path) == 3
+
+    assert [(b.sequence, b.first_event_id, b.last_event_id) for b in repo.exports] == [(1, 1, 2), (2, 3, 4), (3, 5, 5)]
+    assert repo.exports[0].prev_hash == GENESIS_HASH
+    assert repo.exports[1].prev_hash == repo.exports[0].hash
+    assert repo.exports[2].prev_hash == repo.exports[1].hash
+
+    with open(os.path.join(tmp_path, "flexdb", "audit", "000000000001.json"), "rb") as f:
+        batch = json.loads(f.read())
+    assert [e["event_type"] for e in batch["events"]] == ["security.event_0", "security.event_1"]
+
+    repo.add("security.lockout")
+    assert await _export(repo, tmp_path) == 1
+    assert repo.exports[-1].sequence == 4
+
+    result = await verify_audit_exports(LocalObjectStore(str(tmp_path)), "flexdb", repo)
+    assert result.ok, result.problems
+    assert (result.batches, result.events, result.head_hash) == (4, 6, repo.exports[-1].hash)
+
+
+@pytest.mark.asyncio
+async def test_verify_detects_rewritten_batch(repo, tmp_path):
+    """Test rewriting an exported batch breaks the chain at the next batch."""
+    await _export(repo, tmp_path)
+
+    def change(batch):
+        batch["events"][0]["client_ip"] = "10.0.0.2"
+    _rewrite(tmp_path, 2, change)
+
+    result = await verify_audit_exports(LocalObjectStore(str(tmp_path)), "flexdb")
+    assert result.problems == ["batch 3 does not chain to the previous batch"]
+
+    result = await verify_audit_exports(LocalObjectStore(str(tmp_path)), "flexdb", repo)
+    assert "batch 2 differs from the batch exported" in result.problems[0]
+    assert "event 3 was modified in the audit log" in result.problems
+
+
+@pytest.mark.asyncio
+async def test_verify_detects_database_changes(repo, tmp_path):
+    """Test events changed or deleted in the database after their export are reported."""
+    await _export(repo, tmp_path)
+
+    repo.events[0].details = {"scope": "key_prefix"}
+    del repo.events[3]
+    repo.exports.append(AuditExport(sequence=4, hash="f" * 64))
+
+    result = await verify_audit_exports(LocalObjectStore(str(tmp_path)), "flexdb", repo)
+    assert result.problems == [
+        "event 1 was modified in the audit log",
+        "event 4 was deleted from the audit log",
+        "batch 4 is missing from storage",
+    ]
+
+
+
+@pytest.mark.asyncio
+async def test_verify_ignores_events_of_deleted_tenants(repo, tmp_path):
+    """Test exported events deleted with their tenant aren't reported missing."""
+    tenant_id = "7c4a8d09-ca37-4b1f-9e5a-3c2d1e0f9a8b"
+    repo.add("tenant.api_key_created", tenant_id)
+    await _export(repo, tmp_path)
+
+    del repo.events[5]
+    result = await verify_audit_exports(LocalObjectStore(str(tmp_path)), "flexdb", repo)
+    assert result.problems == ["event 6 was deleted from the audit log"]
+
+    repo.erased.add(tenant_id)
+    result = await verify_audit_exports(LocalObjectStore(str(tmp_path)), "flexdb", repo)
+    assert result.ok, result.problems
@@ -0,0 +1,131 @@
+"""
+Tests for restore drills of backups.
+"""
+
+import os
+from datetime import datetime, timedelta, timezone
+
+import pytest
+
+from app.config import BackupVerifyConfig, Config
+from app.jobs.backups import FAILED, SUCCEEDED, BackupVerifier, latest_backup, restore_command
+
+
+class FakeBackupVerificationRepository:
+    """Keeps recorded drills in memory."""
+
+    def __init__(self):
+        self.recorded = []
+
+    async def record(self, verification):
+        verification.id = str(len(self.recorded) + 1)
+        self.recorded.append(verification)
+        return verification
+
+
+class FakeVerifier(BackupVerifier):
+    """Restores nothing and returns canned check results."""
+
+    def __init__(self, cfg, checks=None, restore_error=None):
+        super().__init__(FakeBackupVerificationRepository(), cfg, Config())
+        self.checks = checks if checks is not None else [{"name": "schema_migrations", "ok": True, "detail": ""}]
+        self.restore_error = restore_error
+        self.statements = []
+        self.restored = []
+
+    async def _admin_execute(self, statement):
+        self.statements.append(statement)
+
+    async def _restore(self, path):
+        if self.restore_error:
+            raise self.restore_error
+        self.restored.append(path)
+
+    async def _check(self):
+        return "tenant", list(self.checks)
+
+
+def _backup(directory, name, age_hours):
+    path = directory / name
+    path.write_bytes(b"dump")
+    mtime = (datetime.now(timezone.utc) - timedelta(hours=age_hours)).timestamp()
+    os.utime(path, (mtime, mtime))
+    return str(path)
+
+
+def test_latest_backup(tmp_path):
+    """Test the newest matching file is picked by modification time."""
+    assert latest_backup(str(tmp_path / "*.dump")) is None
+    _backup(tmp_path, "b.dump", 30)
+    newest = _backup(tmp_path, "a.dump", 2)
+    _backup(tmp_path, "c.sql", 1)
+
+    path, taken_at = latest_backup(str(tmp_path / "*.dump"))
+    assert path == newest
+    assert abs((datetime.now(timezone.utc) - taken_at) - timedelta(hours=2)) < timedelta(minutes=1)
+
+
+def test_restore_command():
+    """Test archives are restored with pg_restore and SQL scripts with psql."""
+    assert restore_command("/b/x.dump", "scratch")[0] == "pg_restore"
+    assert restore_command("/b/x.dump", "scratch")[-1] == "/b/x.dump"
+    assert restore_command("/b/x.sql", "scratch")[0] == "psql"
+    assert "ON_ERROR_STOP=1" in restore_command("/b/x.sql", "scratch")
+
+
+@pytest.mark.asyncio
+async def test_successful_drill(tmp_path):
+    """Test a drill restores the newest backup into a fresh scratch database and records success."""
+    path = _backup(tmp_path, "control.dump", 1)
+    verifier = FakeVerifier(BackupVerifyConfig(path=str(tmp_path / "*.dump"), scratch_database="drill"))
+
+    result = await verifier.run_once()
+
+    assert result.status == SUCCEEDED
+    assert result.backup == path
+    assert result.database_kind == "tenant"
+    assert verifier.restored == [path]
+    assert verifier.statements == [
+        'DROP DATABASE IF EXISTS "drill" WITH (FORCE)',
+        'CREATE DATABASE "drill"',
+        'DROP DATABASE IF EXISTS "drill" WITH (FORCE)',
+    ]
+    assert verifier.repo.recorded == [result]
+
+    metrics = "\n".join(verifier.metric_lines())
+    assert 'flexdb_backup_verifications_total{result="succeeded"} 1' in metrics
+    assert "flexdb_backup_verification_last_status 1" in metrics
+
+
+@pytest.mark.asyncio
+async def test_failed_drills(tmp_path):
+    """Test failed restores, failed checks, old backups and missing backups fail the drill."""
+    pattern = str(tmp_path / "*.dump")
+
+    verifier = FakeVerifier(BackupVerifyConfig(path=pattern))
+    result = await verifier.run_once()
+    assert result.status == FAILED
+    assert result.error == f"no backup matches {pattern}"
+
+    _backup(tmp_path, "tenant.dump", 30)
+    verifier = FakeVerifier(BackupVerifyConfig(path=pattern), restore_error=RuntimeError("pg_restore exited"))
+    result = await verifier.run_once()
+    assert result.status == FAILED
+    assert result.error == "pg_restore exited"
+    # The scratch database is dropped after a failed restore too
+    assert verifier.statements[-1].startswith("DROP DATABASE")
+
+    verifier = FakeVerifier(
+        BackupVerifyConfig(path=pattern, max_age_hours=24),
+        checks=[{"name": "nodes_have_node_types", "ok": False, "detail": "3 nodes without a node type"}],
+    )
+    result = await verifier.run_once()
+    assert result.status == FAILED
+    assert result.error == "checks failed: backup_age, nodes_have_node_types"
+    assert result.checks[0]["name"] == "backup_age"
+
+    metrics = "\n".join(verifier.metric_lines(openmetrics=True))
+    assert "# TYPE flexdb_backup_verifications counter" in metrics
+    assert 'flexdb_backup_verifications_total{result="failed"} 1' in metrics
+    assert "flexdb_backup_verification_last_status 0" in metrics
+    assert "flexdb_backup_verification_last_success_timestamp_seconds 0" in metrics
@@ -0,0 +1,99 @@
+"""
+Tests for compliance evidence bundles.
+"""
+
+import io
+import tarfile
+from datetime import datetime, timedelta, timezone
+
+from app.config import ApiKeyPolicyConfig
+from app.jobs.compliance import (
+    MANIFEST,
+    NOT_CONFIGURED,
+    SIGNATURE,
+    backup_verification_report,
+    build_bundle,
+    key_rotation_status,
+    verify_bundle,
+)
+from app.repository import ApiKey, BackupVerification
+
+NOW = datetime(2026, 6, 1, tzinfo=timezone.utc)
+KEY = "compliance-signing-key"
+
+
+def _key(id, days_old, **kwargs):
+    return ApiKey(id=id, tenant_id="t1", name=id, created_at=NOW - timedelta(days=days_old), **kwargs)
+
+
+def _rewrite(bundle, name, body):
+    """Return the bundle with one file replaced."""
+    out = io.BytesIO()
+    with tarfile.open(fileobj=io.BytesIO(bundle), mode="r:gz") as src, tarfile.open(fileobj=out, mode="w:gz") as dst:
+        for member in src.getmembers():
+            data = body if member.name == name else src.extractfile(member).read()
+            member.size = len(data)
+            dst.addfile(member, io.BytesIO(data))
+    return out.getvalue()
+
+
+def test_key_rotation_status():
+    """Test keys are classified under the key policy."""
+    policy = ApiKeyPolicyConfig(max_lifetime_days=90, warning_days=7)
+    report = key_rotation_status([
+        _key("revoked", 10, revoked_at=NOW - timedelta(days=1), revoke_reason="rotated"),
+        _key("expired", 100, expires_at=NOW - timedelta(days=10)),
+        _key("expiring", 85, expires_at=NOW + timedelta(days=5)),
+        _key("overdue", 400),
+        _key("active", 30, expires_at=NOW + timedelta(days=60)),
+    ], policy, NOW)
+
+    assert {k["id"]: k["status"] for k in report["keys"]} == {
+        "revoked": "revoked", "expired": "expired", "expiring": "expiring", "overdue": "overdue", "active": "active",
+    }
+    assert report["counts"] == {"revoked": 1, "expired": 1, "expiring": 1, "overdue": 1, "active": 1}
+    assert report["keys"][3]["age_days"] == 400
+    assert report["policy"]["max_lifetime_days"] == 90
+
+    # Without a maximum lifetime, old keys are fine
+    report = key_rotation_status([_key("old", 400)], ApiKeyPolicyConfig(), NOW)
+    assert report["counts"] == {"active": 1}
+
+
+def test_backup_verification_report():
+    """Test restore drills of the period are summarized with the latest one."""
+    assert backup_verification_report([]) == NOT_CONFIGURED
+
+    drills = [
+        BackupVerification(id="1", backup="/b/1.dump", status="failed", error="pg_restore exited"),
+        BackupVerification(id="2", backup="/b/2.dump", status="succeeded", database_kind="control"),
+    ]
+    report = backup_verification_report(drills)
+    assert report["status"] == "succeeded"
+    assert (report["drills"], report["succeeded"], report["failed"]) == (2, 1, 1)
+    assert report["latest"]["backup"] == "/b/2.dump"
+    assert [d["id"] for d in report["history"]] == ["1", "2"]
+
+
+def test_bundle_round_trip():
+    """Test a bundle verifies with its signing key only."""
+    artifacts = {"access_log_summary.json": {"total": 3}, "backup_verification.json": {"status": "not_configured"}}
+    bundle = build_bundle(artifacts, KEY, NOW)
+
+    with tarfile.open(fileobj=io.BytesIO(bundle), mode="r:gz") as tar:
+        assert sorted(tar.getnames()) == sorted(list(artifacts) + [MANIFEST, SIGNATURE])
+
+    assert verify_bundle(bundle, KEY) == []
+    assert verify_bundle(bundle, "other-key") == ["manifest signature is invalid"]
+    assert verify_bundle(b"not a bundle", KEY)[0].startswith("bundle is not a readable archive")
+
+
+def test_bundle_tampering_is_detected():
+    """Test modified artifacts and manifests fail verification."""
+    bundle = build_bundle({"access_log_summary.json": {"total": 3}}, KEY, NOW)
+
+    modified = _rewrite(bundle, "access_log_summary.json", b'{"total": 0}')
+    assert verify_bundle(modified, KEY) == ["artifact access_log_summary.json was modified"]
+
+    forged = _rewrite(bundle, MANIFEST, b'{"artifacts": {}}')
+    assert verify_bundle(forged, KEY) == ["manifest signature is invalid"]
@@ -0,0 +1,69 @@
+"""
+Tests for synthetic probes of the node API.
+"""
+
+import pytest
+
+from app.config import ProbeConfig
+from app.jobs.probes import PROBE_NODE_TYPE, CanaryProber
+from app.repository import Tenant
+from app.storage import LocalTenantServices, MemoryStorage
+
+
+async def _canary():
+    """A memory backend with a canary tenant; returns its services resolver and the tenant ID."""
+    storage = MemoryStorage()
+    tenant = await storage.control().tenants.create(Tenant(slug="canary", name="Canary"))
+    return LocalTenantServices(storage).services, tenant.id
+
+
+@pytest.mark.asyncio
+async def test_probe_creates_reads_updates_and_deletes_a_node():
+    """Test a probe round-trips a node of the probe node type, leaves nothing behind and exports success."""
+    resolve, tenant_id = await _canary()
+    prober = CanaryProber(resolve, ProbeConfig(enabled=True, tenant_id=tenant_id))
+
+    assert await prober.run_once()
+    assert await prober.run_once()
+
+    services = await resolve(tenant_id)
+    node_types = await services["node_type"].describe()
+    assert [t.name for t in node_types] == [PROBE_NODE_TYPE]
+    assert await services["node"].count(node_types[0].id) == 0
+    assert set(prober.step_seconds) == {"create", "read", "update", "delete"}
+
+    metrics = "\n".join(prober.metric_lines())
+    assert 'flexdb_probes_total{result="succeeded"} 2' in metrics
+    assert "flexdb_probe_last_status 1" in metrics
+    assert 'flexdb_probe_step_failures_total{step="read"} 0' in metrics
+
+
+@pytest.mark.asyncio
+async def test_failed_probe_reports_its_step_and_cleans_up():
+    """Test a failing step fails the probe, is counted by step and the probe node is deleted."""
+    resolve, tenant_id = await _canary()
+
+    async def broken_reads(id):
+        raise RuntimeError("connection reset")
+
+    async def resolve_broken(tenant_id):
+        services = await resolve(tenant_id)
+        services["node"].get_by_id = broken_reads
+        return services
+
+    prober = CanaryProber(resolve_broken, ProbeConfig(enabled=True, tenant_id=tenant_id))
+    assert not await prober.run_once()
+
+    services = await resolve(tenant_id)
+    node_type = (await services["node_type"].describe())[0]
+    assert await services["node"].count(node_type.id) == 0
+
+    unknown = CanaryProber(resolve, ProbeConfig(enabled=True, tenant_id="missing"))
+    assert not await unknown.run_once()
+
+    metrics = "\n".join(prober.metric_lines(openmetrics=True))
+    assert 'flexdb_probes_total{result="failed"} 1' in metrics
+    assert 'flexdb_probe_step_failures_total{step="read"} 1' in metrics
+    assert "flexdb_probe_last_status 0" in metrics
+    assert "flexdb_probe_last_success_timestamp_seconds 0" in metrics
+    assert unknown.step_failures["create"] == 1
@@ -0,0 +1,96 @@
+"""
+Tests for the retention sweeper.
+"""
+
+import pytest
+
+import app.jobs.retention as retention_module
+from app.config import RetentionConfig
+from app.jobs.retention import RetentionSweeper
+from app.repository import RetentionPolicy
+
+
+class FakeTenantDatabaseManager:
+    def __init__(self, tenant_ids, failing=()):
+        self.tenant_ids = tenant_ids
+        self.failing = failing
+
+    async def list_active_tenant_ids(self):
+        return self.tenant_ids
+
+    async def get_tenant_db(self, tenant_id):
+        if tenant_id in self.failing:
+            raise RuntimeError("tenant database unavailable")
+        return tenant_id
+
+
+def _fakes(monkeypatch, expired):
+    """Patch the repositories: expired maps node type IDs to their expired node counts."""
+    sweeps = {}
+    calls = []
+
+    class FakeRetentionPolicyRepository:
+        def __init__(self, db):
+            self.db = db
+
+        async def list_all(self):
+            return [
+                RetentionPolicy(node_type_id="nt-sessions", ttl_seconds=60),
+                RetentionPolicy(node_type_id="nt-logs", ttl_seconds=60, action="purge"),
+            ]
+
+        async def record_sweep(self, node_type_id, expired_count):
+            sweeps[(self.db, node_type_id)] = expired_count
+
+    class FakeNodeRepository:
+        def __init__(self, db):
+            self.db = db
+
+        async def count_expired(self, policy):
+            calls.append(("count", policy.node_type_id))
+            return expired[policy.node_type_id]
+
+        async def delete_expired(self, policy, batch_size):
+            calls.append(("delete", policy.node_type_id))
+            deleted = min(expired[policy.node_type_id], batch_size)
+            expired[policy.node_type_id] -= deleted
+            return deleted
+
+    monkeypatch.setattr(retention_module, "RetentionPolicyRepository", FakeRetentionPolicyRepository)
+    monkeypatch.setattr(retention_module, "NodeRepository", FakeNodeRepository)
+    return sweeps, calls
+
+
+@pytest.mark.asyncio
+async def test_sweep_deletes_in_batches(monkeypatch):
+    """Test expired nodes are deleted a batch at a time and sweeps are recorded per policy and tenant."""
+    expired = {"nt-sessions": 5, "nt-logs": 0}
+    sweeps, calls = _fakes(monkeypatch, expired)
+    manager = FakeTenantDatabaseManager(["t-1", "t-2"], failing=("t-2",))
+    sweeper = RetentionSweeper(manager, RetentionConfig(batch_size=2))
+
+    await sweeper.run_once()
+
+    assert calls == [("delete", "nt-sessions")] * 3 + [("delete", "nt-logs")]
+    assert sweeps == {("t-1", "nt-sessions"): 5, ("t-1", "nt-logs"): 0}
+    assert sweeper.expired == {("delete", False): 5, ("purge", False): 0}
+    assert sweeper.sweeps == {"succeeded": 1, "failed": 1}
+    lines = sweeper.metric_lines()
+    assert 'flexdb_retention_expired_nodes_total{action="delete",dry_run="false"} 5' in lines
+    assert 'flexdb_retention_sweeps_total{result="failed"} 1' in lines
+    assert sweeper.last_sweep_at is not None
+
+
+@pytest.mark.asyncio
+async def test_dry_run_only_counts(monkeypatch):
+    """Test a dry run counts expired nodes without deleting any."""
+    expired = {"nt-sessions": 5, "nt-logs": 3}
+    sweeps, calls = _fakes(monkeypatch, expired)
+    sweeper = RetentionSweeper(FakeTenantDatabaseManager(["t-1"]), RetentionConfig(batch_size=2, dry_run=True))
+
+    assert await sweeper.sweep_tenant("t-1") == 8
+
+    assert calls == [("count", "nt-sessions"), ("count", "nt-logs")]
+    assert expired == {"nt-sessions": 5, "nt-logs": 3}
+    assert sweeps == {("t-1", "nt-sessions"): 5, ("t-1", "nt-logs"): 3}
+    assert 'flexdb_retention_expired_nodes_total{action="purge",dry_run="true"} 3' in sweeper.metric_lines()
@@ -0,0 +1,101 @@
+"""
+Tests for JobScheduler priority classes and fairness across tenants.
+"""
+
+import asyncio
+
+import pytest
+
+from app.config import JobSchedulerConfig
+from app.jobs import BACKGROUND, DEFAULT, INTERACTIVE, JobScheduler
+
+
+def _job(log, tenant_id, slices, started=None, release=None):
+    """A job running slices slices, logging each; with release set, they wait for it."""
+    left = [slices]
+
+    async def step():
+        if started is not None:
+            started.append(tenant_id)
+        if release is not None:
+            await release.wait()
+        log.append(tenant_id)
+        left[0] -= 1
+        return left[0] > 0
+    return step
+
+
+@pytest.mark.asyncio
+async def test_tenants_take_turns():
+    """Test a tenant with a long job gets one slice per turn, not all of its slices first."""
+    scheduler = JobScheduler(JobSchedulerConfig(interactive_workers=1))
+    log = []
+
+    await asyncio.gather(
+        scheduler.run(INTERACTIVE, "big", _job(log, "big", 4)),
+        scheduler.run(INTERACTIVE, "a", _job(log, "a", 1)),
+        scheduler.run(INTERACTIVE, "b", _job(log, "b", 2)),
+    )
+
+    assert log == ["big", "a", "b", "big", "b", "big", "big"]
+
+
+@pytest.mark.asyncio
+async def test_classes_have_their_own_workers():
+    """Test busy background workers don't hold up interactive jobs, and pools are bounded."""
+    scheduler = JobScheduler(JobSchedulerConfig(interactive_workers=2, background_workers=1))
+    release = asyncio.Event()
+    log, started = [], []
+
+    archival = asyncio.gather(
+        scheduler.run(BACKGROUND, "t1", _job(log, "t1", 1, started, release)),
+        scheduler.run(BACKGROUND, "t2", _job(log, "t2", 1, started, release)),
+    )
+    await scheduler.run(INTERACTIVE, "t3", _job(log, "t3", 2))
+
+    assert log == ["t3", "t3"]
+    assert started == ["t1"]
+    assert 'flexdb_jobs_queued{priority="background"} 1' in scheduler.metric_lines()
+    release.set()
+    await archival
+    assert log == ["t3", "t3", "t1", "t2"]
+
+
+@pytest.mark.asyncio
+async def test_failed_job_raises_and_others_continue():
+    """Test a failing slice fails its own job only."""
+    scheduler = JobScheduler(JobSchedulerConfig(default_workers=1))
+    log = []
+
+    async def fail():
+        raise RuntimeError("batch failed")
+
+    results = await asyncio.gather(
+        scheduler.run(DEFAULT, "t1", fail),
+        scheduler.run(DEFAULT, "t2", _job(log, "t2", 2)),
+        return_exceptions=True,
+    )
+
+    assert isinstance(results[0], RuntimeError)
+    assert log == ["t2", "t2"]
+    with pytest.raises(ValueError, match="unknown job priority: urgent"):
+        await scheduler.run("urgent", "t1", fail)
+
+
+@pytest.mark.asyncio
+async def test_stop_cancels_running_and_queued_jobs():
+    """Test stopping cancels the running slices and drops the queued jobs."""
+    scheduler = JobScheduler(JobSchedulerConfig(background_workers=1))
+    release = asyncio.Event()
+    log, started = [], []
+    running = asyncio.ensure_future(scheduler.run(BACKGROUND, "t1", _job(log, "t1", 1, started, release)))
+    queued = asyncio.ensure_future(scheduler.run(BACKGROUND, "t2", _job(log, "t2", 1)))
+    while not started:
+        await asyncio.sleep(0)
+
+    await scheduler.stop()
+
+    for job in (running, queued):
+        with pytest.raises(asyncio.CancelledError):
+            await job
+    assert started == ["t1"] and log == []
@@ -0,0 +1,142 @@
+"""
+Tests for the tenant deletion worker.
+"""
+
+import pytest
+
+import app.jobs.tenant_deletions as tenant_deletions_module
+from app.config import TenantDeletionConfig
+from app.jobs.tenant_deletions import TenantDeletionWorker
+from app.repository import TenantDeletion
+
+
+class FakeTenantDatabaseManager:
+    def __init__(self):
+        self.calls = []
+
+    async def set_tenant_read_only(self, tenant_id, read_only):
+        self.calls.append(("read_only", tenant_id, read_only))
+
+    async def get_tenant_db(self, tenant_id):
+        return f"db-{tenant_id}"
+
+    async def drop_tenant_databases(self, tenant_id, db_names):
+        self.calls.append(("drop", tenant_id, list(db_names)))
+
+    def forget_tenant_status(self, tenant_id):
+        self.calls.append(("forget", tenant_id))
+
+
+class FakeTenantDeletionRepository:
+    """Keeps deletions and a tenant's control rows in memory, like TenantDeletionRepository."""
+
+    def __init__(self, deletions, rows, failing_step=""):
+        self.deletions = list(deletions)
+        self.rows = rows
+        self.failing_step = failing_step
+        self.saved = []
+
+    async def claim(self, lease_seconds):
+        for deletion in self.deletions:
+            if deletion.status == "pending":
+                deletion.status = "running"
+                return deletion
+        return None
+
+    async def save_progress(self, deletion, lease_seconds):
+        self.saved.append((deletion.status, deletion.step, dict(deletion.progress)))
+        return True
+
+    async def delete_control_rows(self, tenant_id, step, batch_size):
+        if step == self.failing_step:
+            raise RuntimeError("connection lost")
+        deleted = min(self.rows.get(step, 0), batch_size)
+        self.rows[step] = self.rows.get(step, 0) - deleted
+        return deleted
+
+    async def delete_tenant(self, tenant_id):
+        return 1
+
+
+@pytest.fixture
+def tenant_rows(monkeypatch):
+    """Rows of the tenant database by step, deleted by the patched delete_tenant_rows."""
+    rows = {"relationships": 5, "nodes": 3, "node_types": 1}
+
+    async def delete_tenant_rows(db, step, batch_size):
+        deleted = min(rows[step], batch_size)
+        rows[step] -= deleted
+        return deleted
+
+    monkeypatch.setattr(tenant_deletions_module, "delete_tenant_rows", delete_tenant_rows)
+    return rows
+
+
+def _deletion(**kwargs):
+    return TenantDeletion(tenant_id="t1", slug="acme", database_name="flexdb_tenant_acme", **kwargs)
+
+
+@pytest.mark.asyncio
+async def test_deletion_runs_every_step_in_batches(tenant_rows):
+    """Test a deletion empties the tenant database, drops it, then deletes the control rows and the tenant."""
+    deletion = _deletion(archive_database="flexdb_tenant_acme_archive_20260101000000")
+    repo = FakeTenantDeletionRepository([deletion], {"memberships": 2, "api_keys": 1, "audit_events": 4})
+    manager = FakeTenantDatabaseManager()
+
+    await TenantDeletionWorker(repo, manager, TenantDeletionConfig(batch_size=2)).run_once()
+
+    assert deletion.status == "succeeded"
+    assert deletion.progress == {
+        "relationships": 5, "nodes": 3, "node_types": 1,
+        "memberships": 2, "api_keys": 1, "audit_events": 4, "tenant": 1,
+    }
+    assert tenant_rows == {"relationships": 0, "nodes": 0, "node_types": 0}
+    assert manager.calls == [
+        ("read_only", "t1", False),
+        ("drop", "t1", ["flexdb_tenant_acme", "flexdb_tenant_acme_archive_20260101000000"]),
+        ("forget", "t1"),
+    ]
+    # Progress is saved after every batch; a short batch ends its step
+    assert [(step, progress.get("relationships")) for _, step, progress in repo.saved[:3]] == [
+        ("relationships", 2), ("relationships", 4), ("nodes", 5),
+    ]
+    assert repo.saved[-1][0] == "succeeded"
+
+
+@pytest.mark.asyncio
+async def test_failed_deletion_resumes_with_its_step(tenant_rows):
+    """Test a failing step fails the deletion, and running it again continues with that step."""
+    deletion = _deletion()
+    repo = FakeTenantDeletionRepository([deletion], {"memberships": 1, "api_keys": 2}, failing_step="api_keys")
+    manager = FakeTenantDatabaseManager()
+    worker = TenantDeletionWorker(repo, manager, TenantDeletionConfig())
+
+    await worker.run_once()
+
+    assert (deletion.status, deletion.step, deletion.error) == ("failed", "api_keys", "connection lost")
+    assert deletion.progress["memberships"] == 1
+    assert ("forget", "t1") not in manager.calls
+
+    # delete_tenant queues it again
+    deletion.status = "pending"
+    repo.failing_step = ""
+    await worker.run_once()
+
+    assert deletion.status == "succeeded"
+    assert deletion.progress["api_keys"] == 2
+    assert [call for call in manager.calls if call[0] == "drop"] == [("drop", "t1", ["flexdb_tenant_acme", ""])]
+
+
+@pytest.mark.asyncio
+async def test_deletion_without_tenant_database_skips_its_steps(tenant_rows):
+    """Test a tenant without a tenant database only has its control rows deleted."""
+    deletion = TenantDeletion(tenant_id="t1", slug="acme")
+    repo = FakeTenantDeletionRepository([deletion], {})
+    manager = FakeTenantDatabaseManager()
+
+    await TenantDeletionWorker(repo, manager, TenantDeletionConfig()).run_once()
+
+    assert deletion.status == "succeeded"
+    assert tenant_rows == {"relationships": 5, "nodes": 3, "node_types": 1}
+    assert "relationships" not in deletion.progress
+    assert not any(call[0] == "read_only" for call in manager.calls)
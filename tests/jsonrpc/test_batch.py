@@ -0,0 +1,67 @@
+"""
+Tests for the batch JSON-RPC method.
+"""
+
+import asyncio
+import json
+
+import pytest
+
+from app.jsonrpc import batch as batch_module
+from app.jsonrpc.batch import MAX_BATCH_REQUESTS, batch, set_batch_dispatcher
+
+
+@pytest.fixture
+def dispatched():
+    """Dispatch batched requests to a fake answering get_node and failing everything else."""
+    requests = []
+
+    async def dispatch(body: str):
+        request = json.loads(body)
+        requests.append(request)
+        # Later requests answer first: responses must still come back in order
+        await asyncio.sleep(0.01 * (5 - len(requests)))
+        if request["method"] == "get_node":
+            response = {"result": {"node": {"id": request["params"]["id"]}}}
+        else:
+            response = {"error": {"code": -32001, "message": "node type not found"}}
+        return json.dumps({"jsonrpc": "2.0", "id": request["id"], **response})
+
+    previous = batch_module._dispatch
+    set_batch_dispatcher(dispatch)
+    yield requests
+    set_batch_dispatcher(previous)
+
+
+@pytest.mark.asyncio
+async def test_batch_returns_responses_in_order(dispatched):
+    """Test batch runs every request and keeps failures to their own response."""
+    result = await batch("t1", [
+        {"id": "a", "method": "get_node", "params": {"id": "n1"}},
+        {"method": "get_node_type", "params": {"id": "missing"}},
+        {"id": "c", "method": "get_node", "params": {"id": "n2", "tenant_id": "t1"}},
+    ])
+
+    assert result.value["responses"] == [
+        {"id": "a", "result": {"node": {"id": "n1"}}},
+        {"id": 1, "error": {"code": -32001, "message": "node type not found"}},
+        {"id": "c", "result": {"node": {"id": "n2"}}},
+    ]
+    assert all(request["params"]["tenant_id"] == "t1" for request in dispatched)
+
+
+@pytest.mark.asyncio
+async def test_batch_rejects_invalid_requests(dispatched):
+    """Test batch rejects writes, other tenants and oversized batches without running anything."""
+    invalid = [
+        [],
+        [{"method": "delete_node", "params": {"id": "n1"}}],
+        [{"method": "get_node", "params": {"id": "n1", "tenant_id": "t2"}}],
+        [{"method": "get_node", "params": "n1"}],
+        [{"method": "get_node", "params": {"id": "n1"}}] * (MAX_BATCH_REQUESTS + 1),
+    ]
+    for requests in invalid:
+        result = await batch("t1", requests)
+        assert result._error.code == -32602
+
+    assert dispatched == []
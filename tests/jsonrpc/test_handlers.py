@@ -136,6 +136,7 @@ async def test_jsonrpc_error_not_found(async_client: AsyncClient, tenant_service
     assert data["jsonrpc"] == "2.0"
     assert "error" in data
     assert data["error"]["code"] == -32001  # NotFoundError code
+    assert data["error"]["data"]["details"][0]["reason"] == "NOT_FOUND"
 
 
 @pytest.mark.asyncio
@@ -158,6 +159,10 @@ async def test_jsonrpc_error_invalid_params(async_client: AsyncClient, tenant_se
     assert data["jsonrpc"] == "2.0"
     assert "error" in data
     assert data["error"]["code"] == -32602  # Invalid params
+    info, bad_request = data["error"]["data"]["details"]
+    assert info["@type"] == "type.googleapis.com/google.rpc.ErrorInfo"
+    assert info["reason"] == "INVALID_ARGUMENT" and info["domain"] == "flexdb"
+    assert bad_request["field_violations"] == [{"field": "slug", "description": "is required"}]
 
 
 @pytest.mark.asyncio
@@ -202,3 +207,18 @@ async def test_jsonrpc_method_not_found(async_client: AsyncClient):
     assert "error" in data
     assert data["error"]["code"] == -32601  # Method not found
 
+
+
+@pytest.mark.asyncio
+async def test_analytics_endpoint_disabled(async_client: AsyncClient):
+    """Test the analytics endpoint is not served unless a replica is configured."""
+    request = {
+        "jsonrpc": "2.0",
+        "method": "analytics.list_nodes",
+        "params": {"tenant_id": "00000000-0000-0000-0000-000000000000"},
+        "id": 8
+    }
+
+    response = await async_client.post("/analytics/jsonrpc", json=request)
+
+    assert response.status_code == 404
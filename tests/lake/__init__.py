@@ -0,0 +1,3 @@
+"""
+Lake export tests.
+"""
@@ -0,0 +1,85 @@
+"""
+Tests for the scheduled Parquet exporter.
+"""
+
+import json
+from datetime import datetime, timezone
+
+import pytest
+
+from app.config import LakeExportConfig
+from app.lake import exporter as exporter_module
+from app.lake.exporter import LakeExporter
+from app.lake.storage import ObjectStore
+from app.repository import (
+    InMemoryNodeRepository,
+    InMemoryNodeTypeRepository,
+    InMemoryStore,
+    LakeExport,
+    Node,
+    NodeType,
+)
+
+
+class FakeObjectStore(ObjectStore):
+    def __init__(self):
+        self.objects = {}
+
+    async def put(self, key, body, content_type):
+        self.objects[key] = body
+
+    def url(self, key):
+        return f"mem://{key}"
+
+
+@pytest.fixture
+def fake_encoder(monkeypatch):
+    # Encode rows as JSON so the test does not need pyarrow
+    def encode(columns, rows):
+        return json.dumps([row["id"] for row in rows]).encode()
+    monkeypatch.setattr(exporter_module, "encode_parquet", encode)
+
+
+def _add_nodes(store, node_type_id, created):
+    for i, at in enumerate(created):
+        node = Node(id=f"n{i}", node_type_id=node_type_id, data=json.dumps({"i": i}), created_at=at)
+        store.nodes[node.id] = node
+
+
+@pytest.mark.asyncio
+async def test_export_partitions_by_date_and_writes_manifest(fake_encoder):
+    """Test nodes are split into date partitions and files, listed in the manifest."""
+    data = InMemoryStore()
+    node_types = InMemoryNodeTypeRepository(data)
+    article = await node_types.create(NodeType(name="Blog Article", schema='{"i": "integer"}'))
+    _add_nodes(data, article.id, [
+        datetime(2024, 1, 1, 10), datetime(2024, 1, 2, 9), datetime(2024, 1, 2, 10), datetime(2024, 1, 2, 11),
+    ])
+
+    store = FakeObjectStore()
+    exporter = LakeExporter(None, LakeExportConfig(rows_per_file=2), store, prefix="lake")
+    export = LakeExport(id="e1", started_at=datetime(2024, 1, 3, 0, 0, tzinfo=timezone.utc))
+
+    manifest = await exporter.export_tenant("t1", export, node_types, InMemoryNodeRepository(data))
+
+    base = "lake/t1/snapshots/20240103T000000Z"
+    assert export.manifest_key == f"{base}/_manifest.json"
+    assert sorted(store.objects) == sorted([
+        f"{base}/blog_article/dt=2024-01-01/part-00000.parquet",
+        f"{base}/blog_article/dt=2024-01-02/part-00000.parquet",
+        f"{base}/blog_article/dt=2024-01-02/part-00001.parquet",
+        f"{base}/_manifest.json",
+        "lake/t1/_latest.json",
+    ])
+    assert json.loads(store.objects[f"{base}/blog_article/dt=2024-01-02/part-00000.parquet"]) == ["n3", "n2"]
+
+    assert manifest["node_count"] == 4
+    assert manifest["file_count"] == 3
+    table = manifest["tables"][0]
+    assert table["name"] == "blog_article"
+    assert table["location"] == f"mem://{base}/blog_article/"
+    assert {"name": "i", "type": "int64"} in table["columns"]
+    assert [(f["dt"], f["row_count"]) for f in table["files"]] == [
+        ("2024-01-02", 2), ("2024-01-02", 1), ("2024-01-01", 1)
+    ]
+    assert json.loads(store.objects["lake/t1/_latest.json"]) == manifest
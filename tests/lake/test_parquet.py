@@ -0,0 +1,55 @@
+"""
+Tests for Parquet encoding of nodes.
+"""
+
+import io
+import json
+from datetime import datetime, timezone
+
+import pytest
+
+from app.lake.parquet import column_value, encode_parquet, node_row, table_columns
+from app.repository import BiViewColumn, Node
+
+
+def test_column_value_reads_typed_values():
+    """Test values are read by path and mismatching types become null."""
+    data = {"price": "12.50", "qty": 3, "big": 10 ** 20, "ok": True, "tags": ["a"], "loc": {"lat": 52.5}}
+
+    assert column_value(data, BiViewColumn("price", ["price"], "numeric")) == 12.5
+    assert column_value(data, BiViewColumn("qty", ["qty"], "bigint")) == 3
+    assert column_value(data, BiViewColumn("big", ["big"], "bigint")) is None
+    assert column_value(data, BiViewColumn("ok", ["ok"], "boolean")) is True
+    assert column_value(data, BiViewColumn("qty", ["qty"], "boolean")) is None
+    assert column_value(data, BiViewColumn("tags", ["tags"], "jsonb")) == '["a"]'
+    assert column_value(data, BiViewColumn("qty", ["qty"], "text")) == "3"
+    assert column_value(data, BiViewColumn("loc_lat", ["loc", "lat"], "numeric")) == 52.5
+    assert column_value(data, BiViewColumn("loc_lng", ["loc", "lng"], "numeric")) is None
+
+
+def test_node_row_and_columns():
+    """Test rows carry the fixed columns, schema columns and raw data."""
+    columns = [BiViewColumn("title", ["title"], "text")]
+    node = Node(id="n1", data='{"title": "Hello"}', created_at=datetime(2024, 1, 2, 3, 4), version=2)
+
+    row = node_row(node, columns)
+
+    assert row["title"] == "Hello"
+    assert row["created_at"] == datetime(2024, 1, 2, 3, 4, tzinfo=timezone.utc)
+    assert row["version"] == 2
+    assert json.loads(row["data"]) == {"title": "Hello"}
+    assert [c["name"] for c in table_columns(columns)] == [
+        "id", "created_at", "updated_at", "version", "title", "data"
+    ]
+
+
+def test_encode_parquet_round_trip():
+    """Test encoded rows read back with the declared types."""
+    pq = pytest.importorskip("pyarrow.parquet")
+    columns = [BiViewColumn("qty", ["qty"], "bigint")]
+    rows = [node_row(Node(id="n1", data='{"qty": 3}'), columns), node_row(Node(id="n2", data="{}"), columns)]
+
+    table = pq.read_table(io.BytesIO(encode_parquet(columns, rows)))
+
+    assert table.column("qty").to_pylist() == [3, None]
+    assert str(table.schema.field("qty").type) == "int64"
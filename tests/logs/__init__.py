@@ -0,0 +1,3 @@
+"""
+Structured logging tests.
+"""
@@ -0,0 +1,148 @@
+"""
+Tests for structured logging.
+"""
+
+import inspect
+import json
+import logging
+
+import pytest
+from jsonrpcserver import Error, Success
+
+from app.logs import (
+    ContextFilter,
+    JsonFormatter,
+    RequestIdMiddleware,
+    TextFormatter,
+    accept_request_id,
+    current_request_id,
+    log_calls,
+    log_context,
+)
+
+
+class _Records(logging.Handler):
+    def __init__(self):
+        super().__init__()
+        self.addFilter(ContextFilter())
+        self.records = []
+
+    def emit(self, record):
+        self.records.append(record)
+
+
+def _record(message="hello", **extra):
+    record = logging.LogRecord("app.test", logging.WARNING, __file__, 1, message, None, None)
+    record.__dict__.update(extra)
+    ContextFilter().filter(record)
+    return record
+
+
+def test_json_formatter_includes_context_and_extra():
+    """Test JSON lines carry the bound context fields and extra fields."""
+    with log_context(request_id="r1", tenant_id="t1", method=""):
+        record = _record(duration_ms=1.5)
+
+    entry = json.loads(JsonFormatter().format(record))
+
+    assert entry["level"] == "WARNING"
+    assert entry["logger"] == "app.test"
+    assert entry["message"] == "hello"
+    assert entry["request_id"] == "r1"
+    assert entry["tenant_id"] == "t1"
+    assert entry["duration_ms"] == 1.5
+    # Empty values are not bound
+    assert "method" not in entry
+    assert entry["time"].endswith("Z")
+
+
+def test_text_formatter_appends_fields():
+    """Test text lines keep the message format and append key=value fields."""
+    with log_context(request_id="r1"):
+        record = _record(code=0)
+
+    line = TextFormatter().format(record)
+
+    assert line.endswith(" - WARNING - hello request_id=r1 code=0")
+
+
+def test_log_context_is_restored():
+    """Test nested contexts add fields and leaving them restores the outer fields."""
+    with log_context(request_id="r1"):
+        with log_context(tenant_id="t1"):
+            assert _record().context == {"request_id": "r1", "tenant_id": "t1"}
+        assert _record().context == {"request_id": "r1"}
+    assert _record().context == {}
+
+
+@pytest.mark.asyncio
+async def test_log_calls_logs_method_tenant_and_code():
+    """Test calls are logged with their method, tenant, latency and code."""
+    async def get_node(tenant_id: str, id: str):
+        logging.getLogger("app.test").info("inside")
+        return Error(-32001, "node not found")
+
+    async def list_nodes(tenant_id: str):
+        return Success([])
+
+    handler = _Records()
+    logger = logging.getLogger("app.logs.calls")
+    inner = logging.getLogger("app.test")
+    logger.addHandler(handler)
+    inner.addHandler(handler)
+    level, inner_level = logger.level, inner.level
+    logger.setLevel(logging.INFO)
+    inner.setLevel(logging.INFO)
+    try:
+        methods = log_calls({"get_node": get_node, "list_nodes": list_nodes})
+        with log_context(request_id="r1"):
+            await methods["get_node"](tenant_id="t1", id="n1")
+            await methods["list_nodes"](tenant_id="t2")
+    finally:
+        logger.removeHandler(handler)
+        inner.removeHandler(handler)
+        logger.setLevel(level)
+        inner.setLevel(inner_level)
+
+    inside, failed, ok = handler.records
+    # Records logged during the call carry its context
+    assert inside.context == {"request_id": "r1", "method": "get_node", "tenant_id": "t1"}
+    assert failed.getMessage() == "get_node failed (-32001)"
+    assert failed.code == -32001
+    assert failed.duration_ms >= 0
+    assert ok.getMessage() == "list_nodes ok"
+    assert ok.code == 0
+    assert ok.context["tenant_id"] == "t2"
+    # The signature stays visible to params validation
+    assert list(inspect.signature(methods["get_node"]).parameters) == ["tenant_id", "id"]
+
+
+def test_accept_request_id():
+    """Test client request IDs are kept if they are short tokens, replaced otherwise."""
+    assert accept_request_id("3f2a9c1e-7d4b-4e8a-9f00-1c2d3e4f5a6b") == "3f2a9c1e-7d4b-4e8a-9f00-1c2d3e4f5a6b"
+    assert len(accept_request_id("")) == 32
+    assert accept_request_id("a b\nforged=1") != "a b\nforged=1"
+    assert len(accept_request_id("x" * 129)) == 32
+
+
+@pytest.mark.asyncio
+async def test_request_id_middleware_binds_and_echoes_id():
+    """Test the middleware binds the request ID while the app runs and echoes it."""
+    seen = []
+
+    async def app(scope, receive, send):
+        seen.append(current_request_id())
+        await send({"type": "http.response.start", "status": 200, "headers": [(b"x-request-id", b"stale")]})
+        await send({"type": "http.response.body", "body": b""})
+
+    sent = []
+
+    async def send(message):
+        sent.append(message)
+
+    scope = {"type": "http", "headers": [(b"x-request-id", b"req-1")]}
+    await RequestIdMiddleware(app)(scope, None, send)
+
+    assert seen == ["req-1"]
+    assert sent[0]["headers"] == [(b"x-request-id", b"req-1")]
+    assert current_request_id() == ""
@@ -0,0 +1,109 @@
+"""
+Tests for request cost accounting.
+"""
+
+import asyncio
+
+import pytest
+from jsonrpcserver import Success
+
+from app.config import MetricsConfig
+from app.db.database import TimedPool
+from app.metrics import RequestCost, RpcMetrics, current_cost, instrument, start_request_cost
+
+
+class FakeConnection:
+    """Connection answering queries with canned results."""
+
+    async def fetch(self, query, *args):
+        return [{"id": 1}, {"id": 2}, {"id": 3}]
+
+    async def fetchrow(self, query, *args):
+        return None
+
+    async def fetchval(self, query, *args):
+        return 7
+
+    async def execute(self, query, *args):
+        return "SET" if query.startswith("SET") else "UPDATE 4"
+
+    def transaction(self):
+        return "transaction"
+
+
+class FakeAcquire:
+    async def __aenter__(self):
+        return FakeConnection()
+
+    async def __aexit__(self, *exc_info):
+        return None
+
+
+class FakePool:
+    def acquire(self, timeout=None):
+        return FakeAcquire()
+
+
+def test_header():
+    """Test the cost header renders milliseconds, rows and bytes."""
+    cost = RequestCost(db_seconds=0.0042134, rows=12, bytes=3456)
+    assert cost.header() == "db_ms=4.213; rows=12; bytes=3456"
+
+
+@pytest.mark.asyncio
+async def test_queries_of_metered_requests_add_to_their_cost():
+    """Test pooled connections count rows returned and written only while a request is metered."""
+    pool = TimedPool(FakePool())
+
+    async def handle():
+        async with pool.acquire() as conn:
+            await conn.fetch("SELECT id FROM nodes")
+            await conn.fetchrow("SELECT * FROM nodes WHERE id = $1", "missing")
+            await conn.fetchval("SELECT count(*) FROM nodes")
+            await conn.execute("UPDATE nodes SET data = '{}'")
+            await conn.execute("SET LOCAL app.tenant_id = 'tenant'")
+            assert conn.transaction() == "transaction"
+
+    # Each request runs in its own context, like the requests of the ASGI server
+    async def metered() -> RequestCost:
+        cost = start_request_cost()
+        await handle()
+        return cost
+
+    cost = await asyncio.create_task(metered())
+    assert cost.rows == 3 + 0 + 1 + 4
+    assert cost.db_seconds > 0
+
+    # The request's context didn't leak into this one, which isn't metered
+    assert current_cost() is None
+    await handle()
+
+
+@pytest.mark.asyncio
+async def test_costs_are_summed_per_tenant():
+    """Test request costs are exported against the first tenant their calls name."""
+    metrics = RpcMetrics(MetricsConfig(tenant_label_top_n=1))
+
+    async def get_node(tenant_id: str, id: str):
+        current_cost().rows += 1
+        return Success({"id": id})
+
+    methods = instrument({"get_node": get_node}, metrics)
+
+    async def request(tenant_id: str) -> None:
+        cost = start_request_cost()
+        await methods["get_node"](tenant_id=tenant_id, id="n1")
+        cost.bytes = 100
+        metrics.observe_cost(cost)
+
+    for tenant_id in ("tenant-a", "tenant-a", "tenant-b"):
+        await asyncio.create_task(request(tenant_id))
+
+    text = metrics.render()
+    assert 'flexdb_tenant_cost_rows_total{tenant="tenant-a"} 2' in text
+    assert 'flexdb_tenant_cost_bytes_total{tenant="tenant-a"} 200' in text
+    assert 'flexdb_tenant_cost_bytes_total{tenant="other"} 100' in text
+
+    # Requests naming no tenant are not counted
+    metrics.observe_cost(RequestCost(rows=5))
+    assert 'flexdb_tenant_cost_rows_total{tenant="other"} 1' in metrics.render()
@@ -0,0 +1,104 @@
+"""
+Tests for JSON-RPC method metrics.
+"""
+
+import inspect
+
+import pytest
+from jsonrpcserver import Error, Success
+
+from app.config import MetricsConfig
+from app.metrics import RpcMetrics, instrument
+
+
+def test_render_counts_and_slis():
+    """Test calls are counted by code and towards the availability and latency SLIs."""
+    metrics = RpcMetrics(MetricsConfig(latency_threshold=0.3))
+    metrics.observe("get_node", None, 0.01)
+    metrics.observe("get_node", -32001, 0.02)
+    metrics.observe("get_node", -32603, 0.4)
+
+    text = metrics.render()
+
+    assert 'flexdb_rpc_requests_total{method="get_node",code="ok"} 1' in text
+    assert 'flexdb_rpc_requests_total{method="get_node",code="-32001"} 1' in text
+    assert 'flexdb_sli_requests_total{method="get_node",sli="availability"} 3' in text
+    # Client errors do not count against availability
+    assert 'flexdb_sli_good_total{method="get_node",sli="availability"} 2' in text
+    assert 'flexdb_sli_good_total{method="get_node",sli="latency"} 2' in text
+    # The latency threshold is added as a histogram bucket
+    assert 'flexdb_rpc_request_duration_seconds_bucket{method="get_node",le="0.3"} 2' in text
+    assert 'flexdb_rpc_request_duration_seconds_bucket{method="get_node",le="+Inf"} 3' in text
+
+
+def test_collectors_are_rendered():
+    """Test lines of added collectors are rendered before the OpenMetrics EOF."""
+    metrics = RpcMetrics()
+    metrics.add_collector(lambda openmetrics: [f"flexdb_example {int(openmetrics)}"])
+
+    assert "flexdb_example 0\n" in metrics.render()
+    assert metrics.render(openmetrics=True).endswith("flexdb_example 1\n# EOF\n")
+
+
+def test_tenant_series_are_bounded():
+    """Test per-tenant series cover the top tenants plus "other" and demoted tenants are dropped."""
+    metrics = RpcMetrics(MetricsConfig(tenant_label_top_n=1))
+    metrics.observe("get_node", None, 0.01, "t1")
+    metrics.observe("get_node", None, 0.01, "t2")
+    metrics.observe("create_tenant", None, 0.01)
+
+    text = metrics.render()
+
+    assert 'flexdb_tenant_rpc_requests_total{tenant="t1",code="ok"} 1' in text
+    assert 'flexdb_tenant_rpc_requests_total{tenant="other",code="ok"} 1' in text
+    assert 'tenant="t2"' not in text
+
+    for _ in range(5):
+        metrics.observe("get_node", None, 0.01, "t2")
+    metrics.tenants.refresh()
+    text = metrics.render()
+    assert 'tenant="t1"' not in text
+    assert 'flexdb_tenant_rpc_requests_total{tenant="other",code="ok"} 6' in text
+
+
+def test_openmetrics_exemplars():
+    """Test the OpenMetrics format carries the exact tenant as exemplar."""
+    metrics = RpcMetrics(MetricsConfig(tenant_label_top_n=0))
+    metrics.observe("get_node", None, 0.02, "t-slow")
+
+    text = metrics.render(openmetrics=True)
+
+    assert "# TYPE flexdb_rpc_requests counter" in text
+    assert 'flexdb_rpc_request_duration_seconds_bucket{method="get_node",le="0.025"} 1 # {tenant_id="t-slow"} 0.02 ' in text
+    # top_n 0 disables the per-tenant series but keeps exemplars
+    assert "flexdb_tenant_rpc_requests_total{" not in text
+    assert text.endswith("# EOF\n")
+    assert 'tenant_id="t-slow"' not in metrics.render()
+
+
+@pytest.mark.asyncio
+async def test_instrument_records_results():
+    """Test instrumented methods record success, error results and exceptions."""
+    async def ok(id: str):
+        return Success({"id": id})
+
+    async def not_found(id: str):
+        return Error(-32001, "node not found")
+
+    async def crash():
+        raise RuntimeError("boom")
+
+    metrics = RpcMetrics()
+    methods = instrument({"ok": ok, "not_found": not_found, "crash": crash}, metrics)
+
+    assert list(inspect.signature(methods["ok"]).parameters) == ["id"]
+    await methods["ok"](id="1")
+    await methods["not_found"]("1")
+    with pytest.raises(RuntimeError):
+        await methods["crash"]()
+
+    text = metrics.render()
+    assert 'flexdb_rpc_requests_total{method="ok",code="ok"} 1' in text
+    assert 'flexdb_rpc_requests_total{method="not_found",code="-32001"} 1' in text
+    assert 'flexdb_rpc_requests_total{method="crash",code="-32603"} 1' in text
+    assert 'flexdb_sli_good_total{method="crash",sli="availability"} 0' in text
@@ -0,0 +1,54 @@
+"""
+Tests for generated Prometheus SLO rules.
+"""
+
+from app.config import MetricsConfig
+from app.metrics import generate_rules, to_yaml
+
+
+def test_rules_cover_registered_methods():
+    """Test recording rules select the registered methods."""
+    rules = generate_rules(["list_nodes", "create_node"], MetricsConfig())
+
+    recording = rules["groups"][0]["rules"]
+    assert [r["record"] for r in recording] == [
+        "flexdb:sli_error_ratio:rate5m",
+        "flexdb:sli_error_ratio:rate30m",
+        "flexdb:sli_error_ratio:rate1h",
+        "flexdb:sli_error_ratio:rate6h",
+    ]
+    assert 'method=~"create_node|list_nodes"' in recording[0]["expr"]
+
+
+def test_burn_rate_thresholds_follow_objectives():
+    """Test alert thresholds are the burn rate times the error budget."""
+    rules = generate_rules(["get_node"], MetricsConfig(availability_objective=0.999, latency_objective=0.95))
+
+    alerts = {r["alert"]: r for r in rules["groups"][1]["rules"]}
+    assert set(alerts) == {
+        "FlexDBAvailabilityBudgetBurnFast",
+        "FlexDBAvailabilityBudgetBurnSlow",
+        "FlexDBLatencyBudgetBurnFast",
+        "FlexDBLatencyBudgetBurnSlow",
+    }
+    fast = alerts["FlexDBAvailabilityBudgetBurnFast"]
+    assert fast["expr"] == (
+        'flexdb:sli_error_ratio:rate1h{sli="availability"} > 0.0144'
+        ' and flexdb:sli_error_ratio:rate5m{sli="availability"} > 0.0144'
+    )
+    assert fast["labels"]["severity"] == "page"
+    assert "> 0.3" in alerts["FlexDBLatencyBudgetBurnSlow"]["expr"]
+
+
+def test_to_yaml():
+    """Test rules render as YAML with quoted scalars."""
+    text = to_yaml({"groups": [{"name": "g", "rules": [{"record": "r", "labels": {"a": "b"}}]}]})
+
+    assert text == (
+        "groups:\n"
+        '  - name: "g"\n'
+        "    rules:\n"
+        '      - record: "r"\n'
+        "        labels:\n"
+        '          a: "b"\n'
+    )
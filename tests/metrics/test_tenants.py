@@ -0,0 +1,46 @@
+"""
+Tests for bounded-cardinality tenant labels.
+"""
+
+from app.metrics import OTHER_TENANT_LABEL, TenantLabeler
+
+
+class FakeClock:
+    """Manually advanced monotonic clock."""
+
+    def __init__(self):
+        self.now = 0.0
+
+    def __call__(self) -> float:
+        return self.now
+
+
+def test_free_slots_are_filled_first():
+    """Test the first top_n tenants get their own label until the first refresh."""
+    labeler = TenantLabeler(2, clock=FakeClock())
+
+    assert labeler.label("a") == "a"
+    assert labeler.label("b") == "b"
+    assert labeler.label("c") == OTHER_TENANT_LABEL
+    assert labeler.labels() == {"a", "b", OTHER_TENANT_LABEL}
+
+
+def test_refresh_promotes_busiest_tenants():
+    """Test a tenant with a traffic spike replaces a quiet one after a refresh."""
+    clock = FakeClock()
+    labeler = TenantLabeler(2, refresh_interval=60, clock=clock)
+    labeler.label("a")
+    labeler.label("b")
+    for _ in range(10):
+        labeler.label("c")
+
+    clock.now = 60
+    assert labeler.label("a") == "a"
+    assert labeler.labels() == {"a", "c", OTHER_TENANT_LABEL}
+    assert labeler.label("b") == OTHER_TENANT_LABEL
+    assert labeler.label("c") == "c"
+
+
+def test_disabled_labels_everything_other():
+    """Test top_n 0 puts every tenant under "other"."""
+    assert TenantLabeler(0).label("a") == OTHER_TENANT_LABEL
@@ -0,0 +1,3 @@
+"""
+Plugin hook tests.
+"""
@@ -0,0 +1,123 @@
+"""
+Tests for plugin interceptors.
+"""
+
+import inspect
+
+import pytest
+from jsonrpcserver import Error, Success
+
+from app.metrics import result_code
+from app.plugins import (
+    AFTER_AUTHORIZATION,
+    BEFORE_AUTHORIZATION,
+    intercept,
+    intercept_stream,
+    interceptor_names,
+    register_interceptor,
+    register_stream_interceptor,
+    set_request,
+    unregister_interceptors,
+)
+
+
+@pytest.fixture(autouse=True)
+def no_interceptors():
+    unregister_interceptors()
+    yield
+    unregister_interceptors()
+
+
+def recorder(name, calls):
+    async def interceptor(call, call_next):
+        calls.append((name, call.method, dict(call.params)))
+        return await call_next()
+    return interceptor
+
+
+@pytest.mark.asyncio
+async def test_interceptors_run_in_order_and_see_params_and_headers():
+    """Test interceptors at a position run by order, then registration, around the method."""
+    calls = []
+
+    found = Success({"id": "n1"})
+
+    async def get_node(tenant_id: str, id: str):
+        calls.append(("method", tenant_id, id))
+        return found
+
+    register_interceptor("second", recorder("second", calls), order=10)
+    register_interceptor("first", recorder("first", calls))
+    register_interceptor("third", recorder("third", calls), order=10)
+    register_interceptor("auth", recorder("auth", calls), position=BEFORE_AUTHORIZATION)
+    assert interceptor_names()[AFTER_AUTHORIZATION] == ["first", "second", "third"]
+    assert interceptor_names()[BEFORE_AUTHORIZATION] == ["auth"]
+
+    methods = intercept({"get_node": get_node}, AFTER_AUTHORIZATION)
+    # The signature stays visible to jsonrpcserver's params validation
+    assert list(inspect.signature(methods["get_node"]).parameters) == ["tenant_id", "id"]
+
+    assert await methods["get_node"]("t1", id="n1") is found
+    params = {"tenant_id": "t1", "id": "n1"}
+    assert calls == [
+        ("first", "get_node", params),
+        ("second", "get_node", params),
+        ("third", "get_node", params),
+        ("method", "t1", "n1"),
+    ]
+
+
+@pytest.mark.asyncio
+async def test_interceptor_rejects_call():
+    """Test an interceptor can reject a call without running the method."""
+    ran = []
+
+    async def list_nodes(tenant_id: str):
+        ran.append(tenant_id)
+        return Success([])
+
+    async def corporate_auth(call, call_next):
+        if call.headers.get("x-corp-user") != "alice":
+            return Error(-32004, f"{call.method} requires a corporate login from {call.client_ip}")
+        return await call_next()
+
+    register_interceptor("corp_auth", corporate_auth, position=BEFORE_AUTHORIZATION)
+    methods = intercept({"list_nodes": list_nodes}, BEFORE_AUTHORIZATION)
+
+    set_request({"X-Corp-User": "mallory"}, "10.0.0.7")
+    assert result_code(await methods["list_nodes"](tenant_id="t1")) == -32004
+    assert ran == []
+    set_request({"X-Corp-User": "alice"}, "10.0.0.7")
+    assert result_code(await methods["list_nodes"](tenant_id="t1")) is None
+    assert ran == ["t1"]
+
+
+@pytest.mark.asyncio
+async def test_stream_interceptors_wrap_handler():
+    """Test stream interceptors get the endpoint's params and may replace its response."""
+    calls = []
+    register_stream_interceptor("audit", recorder("audit", calls))
+
+    async def handler():
+        return "response"
+
+    assert await intercept_stream("stream.export", {"tenant_id": "t1"}, handler) == "response"
+    assert calls == [("audit", "stream.export", {"tenant_id": "t1"})]
+
+
+def test_register_rejects_duplicates_and_unknown_positions():
+    """Test interceptor names are unique and positions are checked."""
+    async def noop(call, call_next):
+        return await call_next()
+
+    register_interceptor("quota", noop)
+    with pytest.raises(ValueError, match="already registered"):
+        register_interceptor("quota", noop)
+    with pytest.raises(ValueError, match="unknown interceptor position"):
+        register_interceptor("other", noop, position="middle")
+
+
+def test_no_interceptors_leaves_methods_unwrapped():
+    """Test the chain is unchanged without plugins."""
+    methods = {"get_node": object()}
+    assert intercept(methods, AFTER_AUTHORIZATION) is methods
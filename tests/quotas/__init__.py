@@ -0,0 +1,3 @@
+"""
+Tenant quota tests.
+"""
@@ -0,0 +1,70 @@
+"""
+Tests for adaptive concurrency limits.
+"""
+
+import asyncio
+
+import pytest
+from jsonrpcserver import Success
+
+from app.config import ConcurrencyLimitConfig
+from app.metrics import result_code
+from app.plugins import Call
+from app.quotas import CONCURRENCY, UNAVAILABLE_CODE, ConcurrencyLimiter, GradientLimit
+
+
+def _saturate(limit: GradientLimit, rtt: float, calls: int) -> None:
+    """Complete calls taking rtt seconds, each with the limit fully in use."""
+    for _ in range(calls):
+        limit.in_flight += 1
+        limit.release(rtt, int(limit.limit))
+
+
+def test_limit_grows_while_latency_holds_and_shrinks_when_it_rises():
+    """Test a limit grows while calls stay near the long-term latency, shrinks when they slow, within bounds."""
+    cfg = ConcurrencyLimitConfig(initial_limit=10, min_limit=5, max_limit=50)
+    limit = GradientLimit(cfg)
+
+    _saturate(limit, 0.01, 10)
+    assert limit.limit > 10
+    _saturate(limit, 0.01, 200)
+    assert limit.limit == 50
+
+    _saturate(limit, 0.1, 10)
+    assert limit.limit < 50
+    _saturate(limit, 1.0, 200)
+    assert limit.limit == 5
+
+    # Underused limits are left alone
+    limit.in_flight += 1
+    limit.release(0.001, 1)
+    assert limit.limit == 5 and limit.in_flight == 0
+
+
+@pytest.mark.asyncio
+async def test_interceptor_rejects_calls_over_the_limit():
+    """Test calls of a method beyond its limit fail with UNAVAILABLE_CODE, and other methods are unaffected."""
+    limiter = ConcurrencyLimiter(ConcurrencyLimitConfig(enabled=True, initial_limit=2, min_limit=1))
+    release = asyncio.Event()
+
+    async def slow():
+        await release.wait()
+        return Success({})
+
+    async def fast():
+        return Success({})
+
+    running = [asyncio.create_task(limiter.intercept(Call(method="list_nodes"), slow)) for _ in range(2)]
+    await asyncio.sleep(0)
+
+    rejected = await limiter.intercept(Call(method="list_nodes"), fast)
+    assert result_code(rejected) == UNAVAILABLE_CODE
+    assert rejected._error.data == {"reason": CONCURRENCY, "limit": 2, "retry_after": 1.0}
+    assert result_code(await limiter.intercept(Call(method="get_node"), fast)) is None
+
+    release.set()
+    await asyncio.gather(*running)
+    assert limiter.limits["list_nodes"].in_flight == 0
+    lines = limiter.metric_lines()
+    assert 'flexdb_concurrency_rejected_total{method="list_nodes"} 1' in lines
+    assert 'flexdb_concurrency_in_flight{method="get_node"} 0' in lines
@@ -0,0 +1,184 @@
+"""
+Tests for token buckets and the rate limiting interceptor.
+"""
+
+import pytest
+from jsonrpcserver import Success
+
+from app.auth import ADMIN_KEY, API_KEY, Principal, set_principal
+from app.config import RateLimitConfig
+from app.metrics import result_code
+from app.plugins import Call
+from app.quotas import API_KEY_LIMIT, RESOURCE_EXHAUSTED_CODE, TENANT_LIMIT, TenantRateLimiter, TokenBuckets
+from app.repository import ApiKey, TenantQuota
+
+
+class FakeClock:
+    """Manually advanced monotonic clock."""
+
+    def __init__(self):
+        self.now = 1000.0
+
+    def __call__(self) -> float:
+        return self.now
+
+
+class FakeQuotas:
+    """Quota source counting its reads."""
+
+    def __init__(self, quotas=None):
+        self.quotas = quotas or {}
+        self.reads = 0
+
+    async def get(self, tenant_id):
+        self.reads += 1
+        return self.quotas.get(tenant_id)
+
+
+@pytest.fixture(autouse=True)
+def anonymous():
+    set_principal(Principal())
+    yield
+    set_principal(Principal())
+
+
+def test_token_bucket_allows_bursts_then_refills():
+    """Test a bucket allows its burst at once, then one request per refilled token."""
+    clock = FakeClock()
+    buckets = TokenBuckets(clock)
+
+    assert buckets.take("k", 2.0, 3) == 0
+    assert buckets.take("k", 2.0, 3) == 0
+    assert buckets.take("k", 2.0, 3) == 0
+    assert buckets.take("k", 2.0, 3) == 0.5
+
+    clock.now += 0.25
+    assert buckets.take("k", 2.0, 3) == 0.25
+    clock.now += 0.25
+    assert buckets.take("k", 2.0, 3) == 0
+
+    # Other keys have their own bucket, and a rate of 0 is unlimited
+    assert buckets.take("other", 2.0, 1) == 0
+    for _ in range(10):
+        assert buckets.take("free", 0, 1) == 0
+
+    # Idle buckets never hold more than their burst
+    clock.now += 100
+    for _ in range(3):
+        assert buckets.take("k", 2.0, 3) == 0
+    assert buckets.take("k", 2.0, 3) > 0
+
+
+@pytest.mark.asyncio
+async def test_tenant_limit_applies_to_anonymous_callers():
+    """Test calls naming a tenant share its bucket and are rejected with retry details."""
+    clock = FakeClock()
+    limiter = TenantRateLimiter(RateLimitConfig(tenant_requests_per_second=1.0, tenant_burst=2), clock=clock)
+
+    assert await limiter.check({"tenant_id": "t1"}) is None
+    assert await limiter.check({"tenant_id": "t1"}) is None
+    rejection = await limiter.check({"tenant_id": "t1"})
+    assert rejection.limit == TENANT_LIMIT
+    assert rejection.data() == {"limit": TENANT_LIMIT, "retry_after": 1.0}
+    assert "t1" in rejection.message
+
+    # Other tenants and calls without a tenant are not affected
+    assert await limiter.check({"tenant_id": "t2"}) is None
+    assert await limiter.check({}) is None
+
+    clock.now += 1
+    assert await limiter.check({"tenant_id": "t1"}) is None
+    assert limiter.rejected == {TENANT_LIMIT: 1, API_KEY_LIMIT: 0}
+
+
+@pytest.mark.asyncio
+async def test_api_key_limit_and_admin_exemption():
+    """Test each API key has its own bucket within its tenant's, and the admin key is not limited."""
+    clock = FakeClock()
+    cfg = RateLimitConfig(
+        tenant_requests_per_second=1.0, tenant_burst=3, api_key_requests_per_second=1.0, api_key_burst=2
+    )
+    limiter = TenantRateLimiter(cfg, clock=clock)
+    first = ApiKey(id="k1", tenant_id="t1", key_prefix="fdb_k1")
+    second = ApiKey(id="k2", tenant_id="t1", key_prefix="fdb_k2")
+
+    set_principal(Principal(kind=API_KEY, api_key=first))
+    assert await limiter.check({"tenant_id": "t1"}) is None
+    assert await limiter.check({"tenant_id": "t1"}) is None
+    rejection = await limiter.check({"tenant_id": "t1"})
+    assert rejection.limit == API_KEY_LIMIT
+    assert "fdb_k1" in rejection.message
+
+    # The second key has tokens left, but the tenant only one
+    set_principal(Principal(kind=API_KEY, api_key=second))
+    assert await limiter.check({"tenant_id": "t1"}) is None
+    assert (await limiter.check({"tenant_id": "t1"})).limit == TENANT_LIMIT
+
+    # The tenant rejection gave the key's token back
+    clock.now += 1
+    assert await limiter.check({"tenant_id": "t1"}) is None
+
+    set_principal(Principal(kind=ADMIN_KEY))
+    for _ in range(10):
+        assert await limiter.check({"tenant_id": "t1"}) is None
+
+
+@pytest.mark.asyncio
+async def test_quotas_override_defaults_and_are_cached():
+    """Test tenant quotas replace the defaults they set, and are read again after the TTL or forget()."""
+    clock = FakeClock()
+    quotas = FakeQuotas({"t1": TenantQuota(tenant_id="t1", requests_per_second=0)})
+    cfg = RateLimitConfig(tenant_requests_per_second=1.0, tenant_burst=1, quota_ttl=30.0)
+    limiter = TenantRateLimiter(cfg, quotas, clock=clock)
+
+    limits = await limiter.limits("t1")
+    assert limits.requests_per_second == 0
+    assert limits.burst == 1
+    assert limits.api_key_requests_per_second == cfg.api_key_requests_per_second
+
+    # Unlimited
+    for _ in range(10):
+        assert await limiter.check({"tenant_id": "t1"}) is None
+    assert quotas.reads == 1
+
+    quotas.quotas["t1"] = TenantQuota(tenant_id="t1", requests_per_second=5.0, burst=1)
+    clock.now += 29
+    assert (await limiter.limits("t1")).requests_per_second == 0
+    clock.now += 1
+    assert (await limiter.limits("t1")).requests_per_second == 5.0
+    assert quotas.reads == 2
+
+    quotas.quotas["t1"] = TenantQuota(tenant_id="t1", requests_per_second=7.0)
+    limiter.forget("t1")
+    assert (await limiter.limits("t1")).requests_per_second == 7.0
+
+
+@pytest.mark.asyncio
+async def test_defaults_are_used_when_quotas_cannot_be_read():
+    """Test a failing quota source does not fail calls."""
+    class Failing:
+        async def get(self, tenant_id):
+            raise OSError("connection refused")
+
+    limiter = TenantRateLimiter(RateLimitConfig(tenant_burst=4), Failing(), clock=FakeClock())
+    assert (await limiter.limits("t1")).burst == 4
+
+
+@pytest.mark.asyncio
+async def test_interceptor_returns_resource_exhausted():
+    """Test the interceptor rejects calls over a limit without calling the method."""
+    limiter = TenantRateLimiter(RateLimitConfig(tenant_requests_per_second=1.0, tenant_burst=1), clock=FakeClock())
+    calls = []
+
+    async def call_next():
+        calls.append(1)
+        return Success({})
+
+    call = Call(method="get_node", params={"tenant_id": "t1", "id": "n1"})
+    assert result_code(await limiter.intercept(call, call_next)) is None
+    assert result_code(await limiter.intercept(call, call_next)) == RESOURCE_EXHAUSTED_CODE
+    assert calls == [1]
+
+    lines = limiter.metric_lines()
+    assert 'flexdb_rate_limited_total{limit="tenant"} 1' in lines
+    assert 'flexdb_rate_limited_total{limit="api_key"} 0' in lines
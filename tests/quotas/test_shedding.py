@@ -0,0 +1,77 @@
+"""
+Tests for load shedding of low-priority calls.
+"""
+
+import pytest
+from jsonrpcserver import Success
+
+from app.config import LoadShedConfig, MetricsConfig
+from app.db.database import Samples
+from app.metrics import result_code
+from app.plugins import Call
+from app.quotas import LATENCY, POOL_WAIT, UNAVAILABLE_CODE, LoadShedder
+
+
+class FakeClock:
+    """Manually advanced monotonic clock."""
+
+    def __init__(self):
+        self.now = 1000.0
+
+    def __call__(self) -> float:
+        return self.now
+
+
+def test_pool_waits_shed_low_priority_calls_until_they_recover():
+    """Test slow pool waits shed analytics and exports but never interactive calls, until they leave the window."""
+    clock = FakeClock()
+    waits = Samples(clock=clock)
+    shedder = LoadShedder(LoadShedConfig(enabled=True, window=10.0), MetricsConfig(), waits, clock)
+
+    for _ in range(10):
+        waits.add(0.01)
+    assert shedder.check("analytics.list_nodes") is None
+
+    for _ in range(10):
+        waits.add(0.5)
+    shed = shedder.check("analytics.list_nodes")
+    assert shed.data() == {"reason": POOL_WAIT, "retry_after": 5.0}
+    assert shedder.check("stream.export").reason == POOL_WAIT
+    assert shedder.check("get_node") is None
+    assert shedder.check("stream.nodes") is None
+    assert 'flexdb_load_shed_total{reason="pool_wait"} 2' in shedder.metric_lines()
+    assert "flexdb_load_shedding 1" in shedder.metric_lines()
+
+    clock.now += 11
+    assert shedder.check("analytics.list_nodes") is None
+    assert "flexdb_load_shedding 0" in shedder.metric_lines()
+
+
+@pytest.mark.asyncio
+async def test_slow_interactive_calls_burning_the_error_budget_shed_analytics():
+    """Test interactive calls slower than the SLO threshold shed low-priority calls once enough are observed."""
+    clock = FakeClock()
+    cfg = LoadShedConfig(enabled=True, burn_rate_threshold=10.0, min_calls=20)
+    slo = MetricsConfig(latency_objective=0.99, latency_threshold=0.5)
+    shedder = LoadShedder(cfg, slo, Samples(clock=clock), clock)
+
+    async def ok():
+        return Success({})
+
+    # Every interactive call is timed; 3 slow ones out of 20 burn the 1% budget 15x too fast
+    for _ in range(17):
+        await shedder.intercept(Call(method="get_node"), ok)
+    shedder.latencies.add(1.0)
+    shedder.latencies.add(1.0)
+    assert shedder.check("analytics.count_nodes") is None
+    shedder.latencies.add(1.0)
+    assert round(shedder.burn_rate(), 6) == 15.0
+
+    result = await shedder.intercept(Call(method="analytics.count_nodes"), ok)
+    assert result_code(result) == UNAVAILABLE_CODE
+    assert result._error.data["reason"] == LATENCY
+    assert result_code(await shedder.intercept(Call(method="create_node"), ok)) is None
+
+    # Disabled, latency never sheds
+    shedder.cfg.burn_rate_threshold = 0
+    assert shedder.check("analytics.count_nodes") is None
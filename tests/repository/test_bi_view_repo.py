@@ -0,0 +1,58 @@
+"""
+Tests for BiViewRepository.
+"""
+
+import pytest
+
+from app.repository import BiViewRepository
+from app.repository.models import Node, NodeType
+from app.service.bi_views import build_views
+
+
+@pytest.mark.asyncio
+async def test_replace_views_flattens_node_data(tenant_db, nodetype_repo, node_repo):
+    """Test node type views expose schema fields as typed columns."""
+    node_type = await nodetype_repo.create(NodeType(
+        name="Blog Post",
+        schema='{"title": "string", "views": "integer", "price": {"type": "decimal", "scale": 2},'
+               ' "published": "boolean", "location": "geo_point"}',
+    ))
+    await node_repo.create(Node(
+        node_type_id=node_type.id,
+        data='{"title": "Hello", "views": 42, "price": "9.99", "published": true,'
+             ' "location": {"lat": 52.5, "lng": 13.4}}',
+    ))
+    await node_repo.create(Node(node_type_id=node_type.id, data='{"title": "Draft", "views": "many"}'))
+
+    repo = BiViewRepository(tenant_db)
+    await repo.replace_views(build_views(await nodetype_repo.list_all()))
+
+    async with tenant_db.pool.acquire() as conn:
+        rows = await conn.fetch(
+            "SELECT title, views, price, published, location_lat, location_lng FROM bi.blog_post ORDER BY title"
+        )
+        relationships = await conn.fetchval("SELECT count(*) FROM bi.relationships")
+
+    assert [r["title"] for r in rows] == ["Draft", "Hello"]
+    assert rows[0]["views"] is None  # not an integer
+    assert rows[1]["views"] == 42
+    assert str(rows[1]["price"]) == "9.99"
+    assert rows[1]["published"] is True
+    assert float(rows[1]["location_lat"]) == 52.5
+    assert relationships == 0
+
+
+@pytest.mark.asyncio
+async def test_replace_views_drops_removed_node_types(tenant_db, nodetype_repo):
+    """Test views of deleted node types are dropped on the next rebuild."""
+    node_type = await nodetype_repo.create(NodeType(name="Article", schema="{}"))
+    repo = BiViewRepository(tenant_db)
+    await repo.replace_views(build_views(await nodetype_repo.list_all()))
+
+    await nodetype_repo.delete(node_type.id)
+    await repo.replace_views(build_views(await nodetype_repo.list_all()))
+
+    async with tenant_db.pool.acquire() as conn:
+        views = await conn.fetch("SELECT table_name FROM information_schema.views WHERE table_schema = 'bi'")
+
+    assert [v["table_name"] for v in views] == ["relationships"]
@@ -0,0 +1,48 @@
+"""
+Tests for LakeExportRepository.
+"""
+
+import pytest
+
+from app.repository import LakeExportRepository
+
+
+@pytest.mark.asyncio
+async def test_claim_run_once_per_interval(tenant_db):
+    """Test a run is claimed only when none is running or succeeded within the interval."""
+    repo = LakeExportRepository(tenant_db)
+
+    export = await repo.claim_run(3600, 60)
+    assert export is not None
+    assert export.status == "running"
+    assert await repo.claim_run(3600, 60) is None
+
+    export.status = "failed"
+    export.error = "upload failed"
+    await repo.finish_run(export)
+    retry = await repo.claim_run(3600, 60)
+    assert retry is not None
+
+    retry.status = "succeeded"
+    retry.node_count = 3
+    await repo.finish_run(retry)
+    assert await repo.claim_run(3600, 60) is None
+    assert await repo.claim_run(0, 60) is not None
+
+    runs = await repo.list_recent(10)
+    assert [r.status for r in runs][1:] == ["succeeded", "failed"]
+    assert runs[1].node_count == 3
+
+
+@pytest.mark.asyncio
+async def test_claim_run_takes_over_expired_lease(tenant_db):
+    """Test a running export whose lease expired is marked failed and replaced."""
+    repo = LakeExportRepository(tenant_db)
+    abandoned = await repo.claim_run(3600, 0)
+
+    export = await repo.claim_run(3600, 60)
+
+    assert export is not None
+    runs = {r.id: r for r in await repo.list_recent(10)}
+    assert runs[abandoned.id].status == "failed"
+    assert runs[abandoned.id].error == "lease expired"
@@ -0,0 +1,647 @@
+"""
+Tests for the in-memory repositories.
+
+These run without a database, with the services on top as downstream users
+would use them.
+"""
+
+import json
+import threading
+from datetime import datetime
+
+import pytest
+
+from app.auth import PermissionDeniedError
+from app.config import AuthConfig
+from app.repository import (
+    Aggregation,
+    AggregationRange,
+    DataFilter,
+    GeoFilter,
+    InMemoryControlStore,
+    InMemoryNodeRepository,
+    InMemoryNodeTypeRepository,
+    InMemoryOutboxRepository,
+    InMemoryRelationshipRepository,
+    InMemoryStore,
+    InMemoryTenantRepository,
+    InMemoryTransferRepository,
+    InMemoryUserRepository,
+    ListOptions,
+    SortOrder,
+    TenantUser,
+)
+from app.repository.actor import set_actor
+from app.repository.errors import AlreadyExistsError, ConflictError, FailedPreconditionError, NotFoundError
+from app.service import ChangeFeedService, NodeService, NodeTypeService, RelationshipService, TenantService, UserService
+from app.service import user_service
+from app.service.transfer_service import TransferService
+
+
+@pytest.fixture
+def store():
+    return InMemoryStore()
+
+
+@pytest.fixture
+def services(store):
+    node_type_repo = InMemoryNodeTypeRepository(store)
+    node_repo = InMemoryNodeRepository(store)
+    return {
+        "node_type": NodeTypeService(node_type_repo),
+        "node": NodeService(node_repo, node_type_repo),
+        "relationship": RelationshipService(InMemoryRelationshipRepository(store), node_repo),
+        "transfer": TransferService(InMemoryTransferRepository(store), node_type_repo),
+    }
+
+
+@pytest.mark.asyncio
+async def test_tenant_and_user_services():
+    """Test tenants, users and memberships in a shared control store."""
+    control = InMemoryControlStore()
+    tenants = TenantService(InMemoryTenantRepository(control))
+    users = UserService(InMemoryUserRepository(control))
+
+    tenant = await tenants.create("acme", "Acme")
+    user = await users.create("a@example.com", "A")
+    await users.add_to_tenant(tenant.id, user.id, "admin")
+
+    members, result = await users.list_tenant_users(tenant.id, 10, "")
+    assert [(m.user_id, m.role) for m in members] == [(user.id, "admin")]
+    assert result.total_count == 1
+
+    with pytest.raises(ConflictError):
+        await tenants.create("acme", "Other")
+
+    await tenants.delete(tenant.id)
+    assert control.tenant_users == {}
+    with pytest.raises(NotFoundError, match=f"tenant not found: {tenant.id}"):
+        await tenants.get_by_id(tenant.id)
+
+
+@pytest.mark.asyncio
+async def test_user_login():
+    """Test users with a password log in with a token of their active memberships, and wrong passwords fail."""
+    control = InMemoryControlStore()
+    tenants = TenantService(InMemoryTenantRepository(control))
+    users = UserService(InMemoryUserRepository(control), AuthConfig(jwt_secret="s3cret", lockout_max_failures=2))
+    tenant = await tenants.create("acme", "Acme")
+    other = await tenants.create("globex", "Globex")
+    user = await users.create("a@example.com", "A")
+    await users.add_to_tenant(tenant.id, user.id, "viewer")
+    control.tenant_users[(other.id, user.id)] = TenantUser(tenant_id=other.id, user_id=user.id, status="invited")
+
+    with pytest.raises(PermissionDeniedError, match="invalid email or password"):
+        await users.login("a@example.com", "correct horse battery")
+    with pytest.raises(ValueError, match="at least 12"):
+        await users.set_password(user.id, "short")
+    await users.set_password(user.id, "correct horse battery")
+
+    token, expires_at, logged_in, memberships = await users.login("a@example.com", "correct horse battery")
+    assert logged_in.id == user.id
+    assert [(m.tenant_id, m.role) for m in memberships] == [(tenant.id, "viewer")]
+    assert users.signer.verify(token)["tenants"] == [{"tenant_id": tenant.id, "role": "viewer"}]
+    assert expires_at > datetime.now().timestamp()
+
+    with pytest.raises(PermissionDeniedError, match="invalid email or password"):
+        await users.login("b@example.com", "correct horse battery")
+    with pytest.raises(PermissionDeniedError, match="invalid email or password"):
+        await users.login("a@example.com", "wrong horse battery")
+    with pytest.raises(PermissionDeniedError, match="invalid email or password"):
+        await users.login("a@example.com", "wrong horse battery")
+    with pytest.raises(PermissionDeniedError, match="too many failed logins"):
+        await users.login("a@example.com", "correct horse battery")
+
+    with pytest.raises(FailedPreconditionError, match="AUTH_JWT_SECRET"):
+        await UserService(InMemoryUserRepository(control)).login("a@example.com", "correct horse battery")
+
+
+@pytest.mark.asyncio
+async def test_user_passwords_are_hashed_off_the_event_loop(monkeypatch):
+    """Test password hashes are made and verified in worker threads, also for unknown email addresses."""
+    users = UserService(InMemoryUserRepository(InMemoryControlStore()), AuthConfig(jwt_secret="s3cret"))
+    user = await users.create("a@example.com", "A")
+    threads = []
+
+    def hash_password(password):
+        threads.append(threading.get_ident())
+        return "hash"
+
+    def verify_password(password_hash, password):
+        threads.append(threading.get_ident())
+        return False
+
+    monkeypatch.setattr(user_service, "hash_password", hash_password)
+    monkeypatch.setattr(user_service, "verify_password", verify_password)
+    await users.set_password(user.id, "correct horse battery")
+    for email in ("a@example.com", "b@example.com"):
+        with pytest.raises(PermissionDeniedError):
+            await users.login(email, "correct horse battery")
+    assert len(threads) == 3 and threading.get_ident() not in threads
+
+
+@pytest.mark.asyncio
+async def test_crud_versions_and_events(services, store):
+    """Test updates bump versions, stale versions conflict and mutations record events."""
+    node_type = await services["node_type"].create("Article", "", '{"title": "string"}')
+    node = await services["node"].create(node_type.id, '{"title": "a"}')
+
+    updated = await services["node"].update(node.id, '{"title": "b"}', expected_version=1)
+    assert updated.version == 2
+    with pytest.raises(ConflictError, match=f"node {node.id} has version 2, expected 1"):
+        await services["node"].update(node.id, '{"title": "c"}', expected_version=1)
+
+    outbox = InMemoryOutboxRepository(store)
+    events = await outbox.list_pending(10)
+    assert [e.event_type for e in events] == ["node_type.created", "node.created", "node.updated"]
+    assert await outbox.latest_sequence() == 3
+
+    await outbox.mark_dispatched([events[0].id])
+    assert len(await outbox.list_pending(10)) == 2
+
+
+@pytest.mark.asyncio
+async def test_conditional_deletes(services):
+    """Test deletes with a stale version or etag conflict and leave the entity alone."""
+    node_type = await services["node_type"].create("Article", "", "")
+    node = await services["node"].create(node_type.id, "{}")
+    other = await services["node"].create(node_type.id, "{}")
+    rel = await services["relationship"].create(node.id, other.id, "cites", "{}")
+    rel = await services["relationship"].update(rel.id, "links_to", "", if_match=rel.etag)
+    assert rel.to_dict()["etag"] == '"2"'
+
+    with pytest.raises(ConflictError, match=f"relationship {rel.id} has version 2, expected 1"):
+        await services["relationship"].delete(rel.id, if_match='"1"')
+    await services["relationship"].delete(rel.id, expected_version=2)
+
+    with pytest.raises(ConflictError):
+        await services["node"].delete(node.id, expected_version=2, dry_run=True)
+    await services["node"].delete(node.id, if_match=node.etag)
+    with pytest.raises(NotFoundError):
+        await services["node"].get_by_id(node.id)
+
+
+@pytest.mark.asyncio
+async def test_batch_get(services):
+    """Test batch gets return the entities found in request order and list the missing IDs once."""
+    node_type = await services["node_type"].create("Article", "", "")
+    first = await services["node"].create(node_type.id, '{"title": "a", "body": "x"}')
+    second = await services["node"].create(node_type.id, '{"title": "b"}')
+    missing = "00000000-0000-0000-0000-000000000000"
+
+    nodes, absent = await services["node"].batch_get([second.id, missing, first.id, second.id], data_fields=["title"])
+    assert [(n.id, n.data) for n in nodes] == [(second.id, '{"title": "b"}'), (first.id, '{"title": "a"}')]
+    assert absent == [missing]
+
+    node_types, absent = await services["node_type"].batch_get([node_type.id, "not-a-uuid"])
+    assert ([t.name for t in node_types], absent) == (["Article"], ["not-a-uuid"])
+
+    with pytest.raises(ValueError, match="between 1 and 500"):
+        await services["node"].batch_get([missing] * 501)
+
+
+@pytest.mark.asyncio
+async def test_returned_records_are_copies(services):
+    """Test changing a returned record does not change the stored one."""
+    node_type = await services["node_type"].create("Article", "", "")
+    node = await services["node"].create(node_type.id, '{"title": "a"}')
+
+    node.data = '{"title": "changed"}'
+
+    assert (await services["node"].get_by_id(node.id)).data == '{"title": "a"}'
+
+
+@pytest.mark.asyncio
+async def test_select_data_fields(services):
+    """Test reads can select top-level data fields without changing the stored node."""
+    node_type = await services["node_type"].create("Article", "", "")
+    node = await services["node"].create(node_type.id, '{"title": "a", "body": "b", "tags": ["x"]}')
+
+    got = await services["node"].get_by_id(node.id, data_fields=["title", "missing"])
+    assert json.loads(got.data) == {"title": "a"}
+    nodes, _ = await services["node"].list(node_type.id, 10, "", data_fields=[])
+    assert [n.data for n in nodes] == ["{}"]
+    assert json.loads((await services["node"].get_by_id(node.id)).data)["body"] == "b"
+
+
+@pytest.mark.asyncio
+async def test_deletes_cascade(services, store):
+    """Test deleting a node type deletes its nodes and their relationships."""
+    node_type = await services["node_type"].create("Article", "", "")
+    a = await services["node"].create(node_type.id, "{}")
+    b = await services["node"].create(node_type.id, "{}")
+    await services["relationship"].create(a.id, b.id, "links", "{}")
+
+    await services["node_type"].delete(node_type.id)
+
+    assert store.nodes == {}
+    assert store.relationships == {}
+
+
+@pytest.mark.asyncio
+async def test_list_pagination_and_sort(services):
+    """Test listing pages through nodes and sorts by data field with missing values last."""
+    node_type = await services["node_type"].create("Item", "", "")
+    for data in ({"rank": 2}, {"rank": 1}, {}, {"rank": 3}):
+        await services["node"].create(node_type.id, json.dumps(data))
+
+    repo = services["node"].repo
+    nodes, result = await repo.list(node_type.id, ListOptions(page_size=2), sort=SortOrder(field="rank"))
+    assert [json.loads(n.data) for n in nodes] == [{"rank": 1}, {"rank": 2}]
+    assert result.total_count == 4
+    assert result.next_page_token == "2"
+
+    nodes, result = await repo.list(node_type.id, ListOptions(page_size=2, page_token="2"), sort=SortOrder(field="rank"))
+    assert [json.loads(n.data) for n in nodes] == [{"rank": 3}, {}]
+    assert result.next_page_token == ""
+
+
+@pytest.mark.asyncio
+async def test_geo_radius_ordered_by_distance(services):
+    """Test geo_point radius filters order by distance without PostGIS."""
+    node_type = await services["node_type"].create("Place", "", "")
+    repo = services["node"].repo
+    for name, lat in (("far", 53.0), ("near", 52.53), ("here", 52.52)):
+        await services["node"].create(node_type.id, json.dumps({"name": name, "loc": {"lat": lat, "lng": 13.4}}))
+
+    geo = GeoFilter(field="loc", near_lat=52.52, near_lng=13.4, radius_m=5000, order_by_distance=True)
+    nodes, _ = await repo.list(node_type.id, ListOptions(), geo=geo)
+
+    assert [json.loads(n.data)["name"] for n in nodes] == ["here", "near"]
+
+    with pytest.raises(ValueError, match="PostGIS"):
+        await repo.list(node_type.id, ListOptions(), geo=GeoFilter(field="loc", field_type="geo_shape"))
+
+
+@pytest.mark.asyncio
+async def test_aggregate_range_and_date_histogram(services):
+    """Test range buckets are from-inclusive/to-exclusive and dates bucket in the time zone."""
+    node_type = await services["node_type"].create("Order", "", "")
+    repo = services["node"].repo
+    for price, at in ((5, "2024-01-01T01:00:00+00:00"), (10, "2024-01-01T12:00:00+00:00"), (20, "2024-01-02T12:00:00Z")):
+        await services["node"].create(node_type.id, json.dumps({"price": price, "at": at}))
+
+    buckets = await repo.aggregate(node_type.id, Aggregation(
+        kind="range", field="price", metric="sum", metric_field="price",
+        ranges=[AggregationRange(key="low", to_value=10), AggregationRange(key="high", from_value=10)],
+    ))
+    assert [(b.key, b.doc_count, b.value) for b in buckets] == [("low", 1, 5.0), ("high", 2, 30.0)]
+
+    for at in ("2024-02-30", "2024-13-01T99:00"):
+        await services["node"].create(node_type.id, json.dumps({"at": at}))
+    buckets = await repo.aggregate(node_type.id, Aggregation(
+        kind="date_histogram", field="at", interval="day", time_zone="America/New_York",
+    ))
+    assert [(b.key, b.doc_count) for b in buckets] == [
+        ("2023-12-31T05:00:00+00:00", 1),
+        ("2024-01-01T05:00:00+00:00", 1),
+        ("2024-01-02T05:00:00+00:00", 1),
+    ]
+
+
+@pytest.mark.asyncio
+async def test_count_and_terms_aggregation(services):
+    """Test counts and terms buckets honor data filters and order by count, then key."""
+    node_type = await services["node_type"].create("Ticket", "", "")
+    for status, urgent in (("open", True), ("open", False), ("closed", True), ("new", True), (3, True)):
+        await services["node"].create(node_type.id, json.dumps({"status": status, "urgent": urgent}))
+    await services["node"].create(node_type.id, '{"status": {"nested": true}}')
+    repo = services["node"].repo
+
+    assert await repo.count(node_type.id) == 6
+    assert await repo.count(None, DataFilter(equals={("urgent",): True})) == 4
+
+    buckets = await repo.aggregate(node_type.id, Aggregation(kind="terms", field="status", size=10))
+    assert [(b.key, b.doc_count) for b in buckets] == [("open", 2), ("3", 1), ("closed", 1), ("new", 1)]
+
+    buckets = await repo.aggregate(
+        node_type.id, Aggregation(kind="terms", field="urgent", size=1), DataFilter(equals={("status",): "open"})
+    )
+    assert [(b.key, b.doc_count) for b in buckets] == [("false", 1)]
+
+    buckets = await repo.aggregate(node_type.id, Aggregation(kind="all"))
+    assert [(b.key, b.doc_count, b.value) for b in buckets] == [("all", 6, None)]
+
+
+@pytest.mark.asyncio
+async def test_export_import_round_trip(services, store):
+    """Test an export imports into another in-memory store."""
+    node_type = await services["node_type"].create("Article", "", '{"title": "string"}')
+    a = await services["node"].create(node_type.id, '{"title": "a"}')
+    b = await services["node"].create(node_type.id, '{"title": "b"}')
+    await services["relationship"].create(a.id, b.id, "links", "{}")
+
+    lines = [json.dumps(r) async for r in services["transfer"].export("t1")]
+
+    target = InMemoryStore()
+    transfer = TransferService(InMemoryTransferRepository(target), InMemoryNodeTypeRepository(target))
+
+    async def read():
+        for line in lines:
+            yield line
+
+    progress = [p async for p in transfer.import_lines(read())]
+
+    assert progress[-1].nodes_created == 2
+    assert len(target.node_types) == 1
+    assert len(target.relationships) == 1
+
+
+@pytest.mark.asyncio
+async def test_change_feed_resumes_after_export(services, store):
+    """Test the change feed from an export's change token lists the changes made after the export."""
+    node_type = await services["node_type"].create("Article", "", '{"title": "string"}')
+    node = await services["node"].create(node_type.id, '{"title": "a"}')
+    header = [r async for r in services["transfer"].export("t1")][0]
+    await services["node"].update(node.id, '{"title": "b"}')
+    await services["node"].delete(node.id)
+    changes = ChangeFeedService(InMemoryOutboxRepository(store))
+
+    page = await changes.list_changes(header["change_token"], page_size=1)
+    assert ([e.event_type for e in page.events], page.caught_up) == (["node.updated"], False)
+    page = await changes.list_changes(page.next_token, page_size=1)
+    assert [e.to_change()["type"] for e in page.events] == ["node.deleted"]
+    page = await changes.list_changes(page.next_token)
+    assert (page.events, page.next_token, page.caught_up) == ([], "4", True)
+    assert await changes.current_token() == "4"
+
+    assert len((await changes.list_changes()).events) == 4
+    with pytest.raises(ValueError, match="invalid change token: 748:752:749"):
+        await changes.list_changes("748:752:749")
+
+
+@pytest.mark.asyncio
+async def test_node_revisions(services, store):
+    """Test node changes, including cascading deletes, record revisions readable as of a time."""
+    node_type = await services["node_type"].create("Article", "", '{"title": "string"}')
+    node = await services["node"].create(node_type.id, '{"title": "a"}')
+    await services["node"].update(node.id, '{"title": "b"}')
+
+    revisions, result = await services["node"].list_revisions(node.id, 10, "")
+    assert result.total_count == 2
+    assert [(r.op, r.version) for r in revisions] == [("updated", 2), ("created", 1)]
+
+    as_created = await services["node"].get_at(node.id, revisions[1].revised_at.astimezone().isoformat())
+    assert json.loads(as_created.data) == {"title": "a"}
+    assert as_created.created_at == node.created_at
+    with pytest.raises(NotFoundError):
+        await services["node"].get_at(node.id, "2000-01-01T00:00:00Z")
+    with pytest.raises(ValueError, match="ISO 8601"):
+        await services["node"].get_at(node.id, "last tuesday")
+
+    await services["node_type"].delete(node_type.id)
+    revisions, _ = await services["node"].list_revisions(node.id, 10, "")
+    assert revisions[0].op == "deleted"
+    with pytest.raises(NotFoundError):
+        await services["node"].get_at(node.id, revisions[0].revised_at.astimezone().isoformat())
+
+
+@pytest.mark.asyncio
+async def test_list_nodes_as_of(services, store):
+    """Test nodes are listed as they were at a time, leaving out nodes not created yet or deleted."""
+    node_type = await services["node_type"].create("Article", "", '{"title": "string"}')
+    first = await services["node"].create(node_type.id, '{"title": "a"}')
+    second = await services["node"].create(node_type.id, '{"title": "b"}')
+    before_changes = (await services["node"].list_revisions(second.id, 10, ""))[0][0].revised_at
+    await services["node"].update(first.id, '{"title": "a2"}')
+    await services["node"].delete(second.id)
+    third = await services["node"].create(node_type.id, '{"title": "c"}')
+
+    nodes, result = await services["node"].list(node_type.id, 10, "", as_of=before_changes.astimezone().isoformat())
+    assert result.total_count == 2
+    assert {n.id: json.loads(n.data)["title"] for n in nodes} == {first.id: "a", second.id: "b"}
+
+    nodes, _ = await services["node"].list(node_type.id, 10, "", as_of=datetime.now().astimezone().isoformat())
+    assert {n.id: json.loads(n.data)["title"] for n in nodes} == {first.id: "a2", third.id: "c"}
+
+    nodes, _ = await services["node"].list(
+        None, 10, "", data_filter={"title": "b"}, as_of=before_changes.astimezone().isoformat()
+    )
+    assert [n.id for n in nodes] == [second.id]
+    with pytest.raises(ValueError, match="ISO 8601"):
+        await services["node"].list(None, 10, "", as_of="month-end")
+    with pytest.raises(ValueError, match="geo"):
+        await services["node"].list(None, 10, "", geo={"field": "location"}, as_of="2026-01-31T23:59:59Z")
+
+
+@pytest.mark.asyncio
+async def test_diff_node_revisions(services, store):
+    """Test two revisions of a node are diffed, by default against the latest."""
+    node_type = await services["node_type"].create("Article", "", '{"title": "string", "tags": "array"}')
+    node = await services["node"].create(node_type.id, '{"title": "a"}')
+    await services["node"].update(node.id, '{"title": "b", "tags": ["x"]}')
+    revisions, _ = await services["node"].list_revisions(node.id, 10, "")
+
+    before, after, diff = await services["node"].diff_revisions(node.id, revisions[1].id)
+    assert (before.version, after.version) == (1, 2)
+    assert diff == {
+        "added": [{"path": "tags", "value": ["x"]}],
+        "removed": [],
+        "changed": [{"path": "title", "from": "a", "to": "b"}],
+    }
+
+    _, _, diff = await services["node"].diff_revisions(node.id, revisions[0].id, revisions[1].id)
+    assert diff["removed"] == [{"path": "tags", "value": ["x"]}]
+
+    other = await services["node"].create(node_type.id, '{"title": "c"}')
+    with pytest.raises(NotFoundError):
+        await services["node"].diff_revisions(other.id, revisions[1].id)
+    with pytest.raises(ValueError, match="from_revision_id is not a revision ID"):
+        await services["node"].diff_revisions(node.id, "first")
+
+
+@pytest.mark.asyncio
+async def test_node_field_history(services, store):
+    """Test a field's history lists who changed it, newest first, across pages."""
+    node_type = await services["node_type"].create("Article", "", '{"title": "string", "body": "string"}')
+    set_actor("api_key:alice")
+    node = await services["node"].create(node_type.id, '{"title": "a"}')
+    set_actor("api_key:bob")
+    await services["node"].update(node.id, '{"title": "a", "body": "x"}')
+    await services["node"].update(node.id, '{"title": "b", "body": "x"}')
+    set_actor("")
+    await services["node"].delete(node.id)
+
+    changes, result = await services["node"].field_history(node.id, "title", 1, "")
+    assert result.total_count == 2 and result.next_page_token == "1"
+    assert [(c.change, c.value, c.revision.actor) for c in changes] == [("changed", "b", "api_key:bob")]
+    changes, result = await services["node"].field_history(node.id, "title", 1, result.next_page_token)
+    assert [(c.change, c.value, c.revision.actor) for c in changes] == [("added", "a", "api_key:alice")]
+    assert not result.next_page_token
+
+    revisions, _ = await services["node"].list_revisions(node.id, 10, "")
+    assert [r.to_dict()["actor"] for r in revisions] == [None, "api_key:bob", "api_key:bob", "api_key:alice"]
+    with pytest.raises(ValueError, match="path is invalid: invalid data path"):
+        await services["node"].field_history(node.id, "title.", 10, "")
+    with pytest.raises(NotFoundError):
+        await services["node"].field_history("missing", "title", 10, "")
+
+
+@pytest.mark.asyncio
+async def test_order_by(services, store):
+    """Test listings sort by columns and indexed data paths, ties by ID."""
+    node_type = await services["node_type"].create("Product", "", '{"name": "string", "price": "number"}')
+    await services["node_type"].create("Category", "", "{}")
+    node_types, _ = await services["node_type"].list(10, "", {"field": "name"})
+    assert [nt.name for nt in node_types] == ["Category", "Product"]
+
+    cheap = await services["node"].create(node_type.id, '{"name": "a", "price": 1}')
+    dear = await services["node"].create(node_type.id, '{"name": "b", "price": 5}')
+    unpriced = await services["node"].create(node_type.id, '{"name": "c"}')
+    await services["node"].update(cheap.id, '{"name": "a", "price": 2}')
+
+    nodes, _ = await services["node"].list(None, 10, "", order_by={"field": "updated_at", "direction": "desc"})
+    assert nodes[0].id == cheap.id
+    with pytest.raises(ValueError, match="data.price is not indexed"):
+        await services["node"].list(node_type.id, 10, "", order_by={"field": "data.price"})
+
+    await services["node_type"].create_index(node_type.id, "by_price", "btree", ["price"])
+    nodes, _ = await services["node"].list(node_type.id, 10, "", order_by={"field": "data.price", "direction": "desc"})
+    assert [n.id for n in nodes] == [dear.id, cheap.id, unpriced.id]
+    with pytest.raises(ValueError, match="requires node_type_id"):
+        await services["node"].list(None, 10, "", order_by={"field": "data.price"})
+
+    first = await services["relationship"].create(cheap.id, dear.id, "related", "{}")
+    second = await services["relationship"].create(dear.id, cheap.id, "related", "{}")
+    await services["relationship"].update(first.id, "related", '{"weight": 1}')
+    rels, _ = await services["relationship"].list(None, None, None, 10, "", {"field": "updated_at"})
+    assert [r.id for r in rels] == [second.id, first.id]
+    with pytest.raises(ValueError, match="must be one of: created_at, updated_at"):
+        await services["relationship"].list(None, None, None, 10, "", {"field": "relationship_type"})
+
+
+@pytest.mark.asyncio
+async def test_relationship_list_filters(services):
+    """Test relationship listings filter by lists of node IDs and types, any of which matches."""
+    node_type = await services["node_type"].create("Person", "", "{}")
+    a, b, c = [await services["node"].create(node_type.id, "{}") for _ in range(3)]
+    await services["relationship"].create(a.id, b.id, "follows", "{}")
+    await services["relationship"].create(b.id, c.id, "follows", "{}")
+    await services["relationship"].create(c.id, a.id, "blocks", "{}")
+    await services["relationship"].create(a.id, c.id, "owns", "{}")
+
+    # The edges among a and b's subgraph, and a single value still works
+    rels, _ = await services["relationship"].list([a.id, b.id], [a.id, b.id], None, 10, "")
+    assert [(r.source_node_id, r.target_node_id) for r in rels] == [(a.id, b.id)]
+    rels, _ = await services["relationship"].list(a.id, None, ["follows", "owns"], 10, "")
+    assert sorted(r.relationship_type for r in rels) == ["follows", "owns"]
+
+    with pytest.raises(ValueError, match="source_node_ids must list at most 500 values"):
+        await services["relationship"].list([a.id] * 501, None, None, 10, "")
+    with pytest.raises(ValueError, match="relationship_types must list non-empty strings"):
+        await services["relationship"].list(None, None, ["follows", ""], 10, "")
+
+
+@pytest.mark.asyncio
+async def test_unique_keys(services, store):
+    """Test nodes can't share the values of a unique key of their node type."""
+    schema = '{"email": "string", "first": "string", "last": "string"}'
+    person = await services["node_type"].create("Person", "", schema, unique_keys=["email", ["first", "last"]])
+    other = await services["node_type"].create("Contact", "", schema, unique_keys=["email"])
+    assert person.unique_keys == [["email"], ["first", "last"]]
+
+    a = await services["node"].create(person.id, '{"email": "a@example.com", "first": "A", "last": "Z"}')
+    await services["node"].create(other.id, '{"email": "a@example.com"}')
+    await services["node"].create(person.id, '{"first": "A"}')
+    await services["node"].create(person.id, '{"first": "A"}')
+
+    with pytest.raises(AlreadyExistsError, match="same email already exists"):
+        await services["node"].create(person.id, '{"email": "a@example.com"}')
+    with pytest.raises(AlreadyExistsError, match="same first, last already exists"):
+        await services["node"].create(person.id, '{"first": "A", "last": "Z"}')
+
+    b = await services["node"].create(person.id, '{"email": "b@example.com"}')
+    with pytest.raises(AlreadyExistsError):
+        await services["node"].update(b.id, '{"email": "a@example.com"}')
+    await services["node"].update(a.id, '{"email": "a@example.com", "first": "B", "last": "Z"}')
+
+
+@pytest.mark.asyncio
+async def test_node_type_indexes_and_data_filters(services, store):
+    """Test declaring node type indexes and listing nodes filtered on data paths."""
+    node_type = await services["node_type"].create("Place", "", '{"address": "object", "tags": "array"}')
+    index = await services["node_type"].create_index(node_type.id, "by_city", "", ["address.city"])
+    assert (index.method, index.paths, index.status) == ("btree", [["address", "city"]], "ready")
+    await services["node_type"].create_index(node_type.id, "by_tags", "gin", ["tags"])
+
+    with pytest.raises(AlreadyExistsError):
+        await services["node_type"].create_index(node_type.id, "by_city", "btree", ["address.zip"])
+    with pytest.raises(ValueError, match="not in the schema: name"):
+        await services["node_type"].create_index(node_type.id, "by_name", "btree", ["name"])
+    assert [i.name for i in await services["node_type"].list_indexes(node_type.id)] == ["by_city", "by_tags"]
+
+    paris = await services["node"].create(node_type.id, '{"address": {"city": "Paris"}, "tags": ["a", "b"]}')
+    await services["node"].create(node_type.id, '{"address": {"city": "Lyon"}, "tags": ["b"], "open": 1}')
+    await services["node"].create(node_type.id, '{"open": true}')
+
+    nodes, result = await services["node"].list(node_type.id, 10, "", data_filter={"address.city": "Paris"})
+    assert [n.id for n in nodes] == [paris.id] and result.total_count == 1
+    nodes, _ = await services["node"].list(node_type.id, 10, "", contains='{"tags": ["b"]}')
+    assert len(nodes) == 2
+    nodes, _ = await services["node"].list(node_type.id, 10, "", data_filter={"open": True})
+    assert len(nodes) == 1
+    with pytest.raises(ValueError, match="invalid data path"):
+        await services["node"].list(node_type.id, 10, "", data_filter={"address.": "Paris"})
+
+    await services["node_type"].drop_index(node_type.id, "by_city")
+    with pytest.raises(NotFoundError, match="node_type_index not found: by_city"):
+        await services["node_type"].drop_index(node_type.id, "by_city")
+    await services["node_type"].delete(node_type.id)
+    assert store.node_type_indexes == {}
+
+
+@pytest.mark.asyncio
+async def test_bulk_delete(services, store):
+    """Test deleting nodes and relationships by filter, with and without dry_run."""
+    node_type = await services["node_type"].create("Article", "", "")
+    a = await services["node"].create(node_type.id, '{"status": "draft", "tags": ["x", "y"]}')
+    b = await services["node"].create(node_type.id, '{"status": "draft", "tags": ["y"]}')
+    c = await services["node"].create(node_type.id, '{"status": "published"}')
+    await services["relationship"].create(a.id, c.id, "cites", "")
+    await services["relationship"].create(b.id, c.id, "cites", "")
+    await services["relationship"].create(c.id, a.id, "links", "")
+
+    with pytest.raises(ValueError, match="node_type_id or filter is required"):
+        await services["node"].delete_many(None, None)
+    with pytest.raises(ValueError, match="JSON object"):
+        await services["node"].delete_many(node_type.id, '["draft"]')
+    with pytest.raises(ValueError, match="is required"):
+        await services["relationship"].delete_many(None, None, None)
+
+    assert await services["relationship"].delete_many(None, c.id, "cites", dry_run=True) == 2
+    assert await services["relationship"].delete_many(a.id, None, None) == 1
+    assert len(store.relationships) == 2
+
+    assert await services["node"].delete_many(None, {"tags": ["x"]}, dry_run=True) == 1
+    assert await services["node"].delete_many(node_type.id, {"status": "draft"}, dry_run=True) == 2
+    assert len(store.nodes) == 3
+
+    assert await services["node"].delete_many(node_type.id, '{"status": "draft"}') == 2
+    assert list(store.nodes) == [c.id]
+    # Relationships of the deleted nodes went with them
+    assert len(store.relationships) == 0
+    assert [e.event_type for e in store.events[-2:]] == ["node.deleted", "node.deleted"]
+    assert [r.op for r in store.revisions if r.node_id == a.id] == ["created", "deleted"]
+
+
+@pytest.mark.asyncio
+async def test_dry_runs_check_without_saving(services, store):
+    """Test dry runs return would-be results and fail like real writes, without changing anything."""
+    node_type = await services["node_type"].create("Article", "", '{"title": "string"}', unique_keys=["title"])
+    node = await services["node"].create(node_type.id, '{"title": "a"}')
+    events = len(store.events)
+
+    would_be = await services["node"].create(node_type.id, '{"title": "b"}', dry_run=True)
+    assert json.loads(would_be.data) == {"title": "b"}
+    with pytest.raises(AlreadyExistsError):
+        await services["node"].create(node_type.id, '{"title": "a"}', dry_run=True)
+    updated = await services["node"].update(node.id, '{"title": "c"}', expected_version=1, dry_run=True)
+    assert updated.version == 2
+    with pytest.raises(ConflictError):
+        await services["node"].update(node.id, '{"title": "c"}', expected_version=2, dry_run=True)
+    await services["node_type"].delete(node_type.id, dry_run=True)
+
+    assert list(store.nodes) == [node.id]
+    assert (await services["node"].get_by_id(node.id)).version == 1
+    assert node_type.id in store.node_types
+    assert len(store.events) == events
@@ -0,0 +1,29 @@
+"""
+Tests for the SQL of node type indexes and data filters.
+"""
+
+from app.repository import DataFilter
+from app.repository.node_indexes import data_filter_clause, index_name, path_expression
+
+
+def test_path_expression_quotes_keys():
+    """Test data paths are quoted as text array literals, also with quotes in keys."""
+    assert path_expression(["address", "city"]) == "(data #> '{\"address\",\"city\"}')"
+    assert path_expression(["it's", 'say "hi"']) == "(data #> '{\"it''s\",\"say \\\"hi\\\"\"}')"
+
+
+def test_index_name():
+    """Test index names are derived from the index ID."""
+    assert index_name("0b7e6d4c-1f2a-4b3c-8d9e-0f1a2b3c4d5e") == "nodes_idx_0b7e6d4c1f2a4b3c8d9e0f1a2b3c4d5e"
+
+
+def test_data_filter_clause():
+    """Test equality and containment conditions are numbered after the caller's arguments."""
+    where, args = data_filter_clause(
+        DataFilter(equals={("address", "city"): "Paris"}, contains={("tags",): ["a"]}), 2
+    )
+    assert where == (
+        " AND (data #> '{\"address\",\"city\"}') = $2::jsonb"
+        " AND (data #> '{\"tags\"}') @> $3::jsonb"
+    )
+    assert args == ['"Paris"', '["a"]']
@@ -0,0 +1,56 @@
+"""
+Tests for NodeMigrationRepository.
+"""
+
+import pytest
+
+from app.repository import ConflictError, ListOptions, NodeMigration, NodeMigrationRepository, NodeType
+
+
+@pytest.mark.asyncio
+async def test_create_claim_and_finish(tenant_db, nodetype_repo):
+    """Test a migration is claimed once, saves progress and allows a new one after finishing."""
+    repo = NodeMigrationRepository(tenant_db)
+    node_type = await nodetype_repo.create(NodeType(name="Task", schema='{"title": "string"}'))
+
+    migration = await repo.create(NodeMigration(node_type_id=node_type.id, target_schema_version=1, batch_size=10))
+    assert migration.status == "pending"
+    with pytest.raises(ConflictError):
+        await repo.create(NodeMigration(node_type_id=node_type.id, target_schema_version=1, batch_size=10))
+
+    claimed = await repo.claim(60)
+    assert claimed.id == migration.id
+    assert claimed.status == "running"
+    assert await repo.claim(60) is None
+
+    claimed.migrated_count = 5
+    claimed.failures = [{"node_id": "n1", "error": "data.title is required"}]
+    claimed.failed_count = 1
+    assert await repo.save_progress(claimed, 60)
+    claimed.status = "succeeded"
+    assert await repo.save_progress(claimed, 60)
+
+    stored = await repo.get_by_id(migration.id)
+    assert (stored.status, stored.migrated_count, stored.failed_count) == ("succeeded", 5, 1)
+    assert stored.failures == claimed.failures
+    assert stored.finished_at is not None
+    await repo.create(NodeMigration(node_type_id=node_type.id, target_schema_version=1, batch_size=10))
+
+
+@pytest.mark.asyncio
+async def test_cancel_stops_progress(tenant_db, nodetype_repo):
+    """Test a cancelled migration no longer accepts progress and expired leases are reclaimed."""
+    repo = NodeMigrationRepository(tenant_db)
+    node_type = await nodetype_repo.create(NodeType(name="Task"))
+    await repo.create(NodeMigration(node_type_id=node_type.id, target_schema_version=1, batch_size=10))
+
+    abandoned = await repo.claim(0)
+    reclaimed = await repo.claim(60)
+    assert reclaimed.id == abandoned.id
+
+    cancelled = await repo.cancel(reclaimed.id)
+    assert cancelled.status == "cancelled"
+    assert not await repo.save_progress(reclaimed, 60)
+    migrations, result = await repo.list(node_type.id, ListOptions())
+    assert result.total_count == 1
+    assert migrations[0].status == "cancelled"
@@ -2,10 +2,13 @@
 Tests for NodeRepository.
 """
 
+import json
+from datetime import datetime, timezone
+
 import pytest
 
-from app.repository.errors import NotFoundError
-from app.repository.models import Node, NodeType, ListOptions
+from app.repository.errors import AlreadyExistsError, ConflictError, NotFoundError
+from app.repository.models import DataFilter, Node, NodeType, ListOptions, SortOrder
 
 
 @pytest.mark.asyncio
@@ -82,6 +85,25 @@ async def test_update_node(node_repo, nodetype_repo):
     assert updated.updated_at.timestamp() >= created.updated_at.timestamp()
 
 
+@pytest.mark.asyncio
+async def test_update_node_version(node_repo, nodetype_repo):
+    """Test that updates increment the version and stale expected versions conflict."""
+    node_type = await nodetype_repo.create(NodeType(name="Article", schema='{}'))
+    created = await node_repo.create(Node(node_type_id=node_type.id, data='{}'))
+    assert created.version == 1
+
+    created.data = '{"title": "First"}'
+    updated = await node_repo.update(created, expected_version=1)
+    assert updated.version == 2
+
+    created.data = '{"title": "Stale"}'
+    with pytest.raises(ConflictError):
+        await node_repo.update(created, expected_version=1)
+
+    # Without an expected version the update is unconditional
+    assert (await node_repo.update(created)).version == 3
+
+
 @pytest.mark.asyncio
 async def test_delete_node(node_repo, nodetype_repo):
     """Test deleting a node."""
@@ -97,6 +119,29 @@ async def test_delete_node(node_repo, nodetype_repo):
         await node_repo.get_by_id(created.id)
 
 
+@pytest.mark.asyncio
+async def test_delete_many_nodes(node_repo, nodetype_repo):
+    """Test deleting nodes by node type and data filter, in batches."""
+    article = await nodetype_repo.create(NodeType(name="Article", schema='{}'))
+    page = await nodetype_repo.create(NodeType(name="Page", schema='{}'))
+    for i in range(5):
+        status = "draft" if i % 2 == 0 else "published"
+        await node_repo.create(Node(node_type_id=article.id, data=f'{{"status": "{status}", "n": {i}}}'))
+    kept = await node_repo.create(Node(node_type_id=page.id, data='{"status": "draft"}'))
+
+    assert await node_repo.delete_many(article.id, '{"status": "draft"}', 2, dry_run=True) == 3
+    _, result = await node_repo.list(article.id, ListOptions(page_size=10))
+    assert result.total_count == 5
+
+    assert await node_repo.delete_many(article.id, '{"status": "draft"}', 2) == 3
+    nodes, _ = await node_repo.list(article.id, ListOptions(page_size=10))
+    assert sorted(n.data for n in nodes) == sorted(['{"n": 1, "status": "published"}', '{"n": 3, "status": "published"}'])
+    assert (await node_repo.get_by_id(kept.id)).id == kept.id
+
+    assert await node_repo.delete_many(article.id, None, 2) == 2
+    assert await node_repo.delete_many(article.id, None, 2) == 0
+
+
 @pytest.mark.asyncio
 async def test_list_nodes(node_repo, nodetype_repo):
     """Test listing nodes with pagination."""
@@ -139,3 +184,75 @@ async def test_list_nodes_filtered_by_type(node_repo, nodetype_repo):
     assert len(nodes) == 3
     assert all(n.node_type_id == node_type1.id for n in nodes)
 
+
+
+@pytest.mark.asyncio
+async def test_node_revisions_and_get_at(node_repo, nodetype_repo):
+    """Test every change records a revision and nodes can be read as of a time."""
+    node_type = await nodetype_repo.create(NodeType(name="Article", schema='{}'))
+    created = await node_repo.create(Node(node_type_id=node_type.id, data='{"title": "a"}'))
+    created.data = '{"title": "b"}'
+    updated = await node_repo.update(created)
+    await node_repo.delete(created.id)
+
+    revisions, result = await node_repo.list_revisions(created.id, ListOptions(page_size=10))
+    assert result.total_count == 3
+    assert [(r.op, r.version) for r in revisions] == [("deleted", 2), ("updated", 2), ("created", 1)]
+    assert '"b"' in revisions[1].data
+
+    first = await node_repo.get_at(created.id, revisions[2].revised_at)
+    assert (first.version, '"a"' in first.data) == (1, True)
+    assert (await node_repo.get_at(created.id, updated.updated_at)).version == 2
+    with pytest.raises(NotFoundError):
+        await node_repo.get_at(created.id, revisions[0].revised_at)
+    with pytest.raises(NotFoundError):
+        await node_repo.list_revisions("00000000-0000-0000-0000-000000000000", ListOptions())
+
+
+@pytest.mark.asyncio
+async def test_list_at(node_repo, nodetype_repo):
+    """Test nodes are listed as of their last revision at a time, without the ones deleted by then."""
+    node_type = await nodetype_repo.create(NodeType(name="Invoice", schema='{}'))
+    first = await node_repo.create(Node(node_type_id=node_type.id, data='{"total": 10}'))
+    second = await node_repo.create(Node(node_type_id=node_type.id, data='{"total": 20}'))
+    month_end = second.updated_at
+    first.data = '{"total": 15}'
+    await node_repo.update(first)
+    await node_repo.delete(second.id)
+
+    nodes, result = await node_repo.list_at(node_type.id, month_end, ListOptions(page_size=1))
+    assert (result.total_count, result.next_page_token) == (2, "1")
+    assert [n.id for n in nodes] == [second.id]
+
+    nodes, _ = await node_repo.list_at(
+        node_type.id, month_end, ListOptions(), SortOrder(field="created_at"), DataFilter(equals={("total",): 10})
+    )
+    assert [(n.id, n.version, json.loads(n.data)) for n in nodes] == [(first.id, 1, {"total": 10})]
+
+    nodes, result = await node_repo.list_at(None, datetime.now(timezone.utc), ListOptions())
+    assert result.total_count == 1
+    assert (nodes[0].id, json.loads(nodes[0].data)) == (first.id, {"total": 15})
+
+
+@pytest.mark.asyncio
+async def test_unique_keys(node_repo, nodetype_repo):
+    """Test unique keys are enforced per node type by the indexes created with it."""
+    person = await nodetype_repo.create(NodeType(name="Person", schema='{}', unique_keys=[["email"]]))
+    contact = await nodetype_repo.create(NodeType(name="Contact", schema='{}', unique_keys=[["email"]]))
+    assert (await nodetype_repo.get_by_id(person.id)).unique_keys == [["email"]]
+
+    await node_repo.create(Node(node_type_id=person.id, data='{"email": "a@example.com"}'))
+    await node_repo.create(Node(node_type_id=contact.id, data='{"email": "a@example.com"}'))
+    await node_repo.create(Node(node_type_id=person.id, data='{"name": "no email"}'))
+    await node_repo.create(Node(node_type_id=person.id, data='{"name": "no email"}'))
+
+    with pytest.raises(AlreadyExistsError, match="same email already exists"):
+        await node_repo.create(Node(node_type_id=person.id, data='{"email": "a@example.com"}'))
+
+    b = await node_repo.create(Node(node_type_id=person.id, data='{"email": "b@example.com"}'))
+    b.data = '{"email": "a@example.com"}'
+    with pytest.raises(AlreadyExistsError):
+        await node_repo.update(b)
+
+    await nodetype_repo.delete(person.id)
+    await node_repo.create(Node(node_type_id=contact.id, data='{"email": "b@example.com"}'))
@@ -0,0 +1,136 @@
+"""
+Tests for OutboxRepository.
+"""
+
+import json
+import uuid
+
+import pytest
+
+from app.repository.models import NodeType, Node, WebhookEndpoint
+from app.repository.outbox_repo import record_event
+
+
+@pytest.mark.asyncio
+async def test_changes_record_outbox_events(outbox_repo, nodetype_repo, node_repo):
+    """Test that create, update and delete write outbox events."""
+    node_type = await nodetype_repo.create(NodeType(name="Article", schema="{}"))
+    node = await node_repo.create(Node(node_type_id=node_type.id, data='{"title": "a"}'))
+    node.data = '{"title": "b"}'
+    await node_repo.update(node)
+    await node_repo.delete(node.id)
+
+    events = await outbox_repo.list_pending(10)
+
+    assert [e.event_type for e in events] == [
+        "node_type.created",
+        "node.created",
+        "node.updated",
+        "node.deleted",
+    ]
+    assert events[1].entity_type == "node"
+    assert events[1].entity_id == node.id
+    assert json.loads(events[2].payload)["node"]["data"] == '{"title": "b"}'
+
+
+@pytest.mark.asyncio
+async def test_fan_out_to_webhooks(outbox_repo, webhook_repo, nodetype_repo, tenant_db):
+    """Test fan-out creates deliveries for subscribed endpoints and marks events dispatched."""
+    await webhook_repo.create(WebhookEndpoint(url="https://example.com/all", secret="s"))
+    await webhook_repo.create(WebhookEndpoint(
+        url="https://example.com/nodes", secret="s", event_types=["node.created"]
+    ))
+    await nodetype_repo.create(NodeType(name="Article", schema="{}"))
+
+    processed = await outbox_repo.fan_out_to_webhooks(10)
+
+    assert processed == 1
+    assert await outbox_repo.list_pending(10) == []
+    async with tenant_db.pool.acquire() as conn:
+        count = await conn.fetchval("SELECT COUNT(*) FROM webhook_deliveries")
+    assert count == 1
+
+
+@pytest.mark.asyncio
+async def test_fan_out_filters_by_node_type(outbox_repo, webhook_repo, nodetype_repo, node_repo, tenant_db):
+    """Test endpoints with node_type_ids only receive events for those node types."""
+    article = await nodetype_repo.create(NodeType(name="Article", schema="{}"))
+    other = await nodetype_repo.create(NodeType(name="Other", schema="{}"))
+    await outbox_repo.fan_out_to_webhooks(10)
+
+    await webhook_repo.create(WebhookEndpoint(
+        url="https://example.com/articles", secret="s", node_type_ids=[article.id]
+    ))
+    await node_repo.create(Node(node_type_id=article.id, data="{}"))
+    await node_repo.create(Node(node_type_id=other.id, data="{}"))
+
+    assert await outbox_repo.fan_out_to_webhooks(10) == 2
+    async with tenant_db.pool.acquire() as conn:
+        count = await conn.fetchval("SELECT COUNT(*) FROM webhook_deliveries")
+    assert count == 1
+
+
+@pytest.mark.asyncio
+async def test_publish_pending_cdc_marks_events_after_publish(outbox_repo, nodetype_repo):
+    """Test CDC publishing hands over events in order and retries them if publishing fails."""
+    await nodetype_repo.create(NodeType(name="Article", schema="{}"))
+    await nodetype_repo.create(NodeType(name="Comment", schema="{}"))
+
+    async def fail(events):
+        raise RuntimeError("broker unavailable")
+
+    with pytest.raises(RuntimeError):
+        await outbox_repo.publish_pending_cdc(10, fail)
+
+    published = []
+
+    async def publish(events):
+        published.extend(events)
+
+    assert await outbox_repo.publish_pending_cdc(10, publish) == 2
+    assert [e.event_type for e in published] == ["node_type.created", "node_type.created"]
+    assert published[0].id < published[1].id
+    assert await outbox_repo.publish_pending_cdc(10, publish) == 0
+
+
+@pytest.mark.asyncio
+async def test_list_changes_lists_late_commits_once(outbox_repo, nodetype_repo, tenant_db):
+    """Test the change feed lists an event when its transaction commits, also after later sequences."""
+    await nodetype_repo.create(NodeType(name="Article", schema="{}"))
+    first = await outbox_repo.list_changes("", 10)
+    assert [e.event_type for e in first.events] == ["node_type.created"]
+
+    slow_id = str(uuid.uuid4())
+    async with tenant_db.pool.acquire() as conn:
+        transaction = conn.transaction()
+        await transaction.start()
+        await record_event(conn, "node_type.created", "node_type", slow_id, {})
+        comment = await nodetype_repo.create(NodeType(name="Comment", schema="{}"))
+
+        page = await outbox_repo.list_changes(first.next_token, 10)
+        assert [e.entity_id for e in page.events] == [comment.id]
+        await transaction.commit()
+
+    page = await outbox_repo.list_changes(page.next_token, 10)
+    assert ([e.entity_id for e in page.events], page.caught_up) == ([slow_id], True)
+    assert (await outbox_repo.list_changes(page.next_token, 10)).events == []
+
+
+@pytest.mark.asyncio
+async def test_list_changes_pages(outbox_repo, nodetype_repo):
+    """Test a window of changes is read in pages, and invalid tokens are rejected."""
+    for name in ("A", "B", "C"):
+        await nodetype_repo.create(NodeType(name=name, schema="{}"))
+
+    page = await outbox_repo.list_changes("", 2)
+    assert (len(page.events), page.caught_up) == (2, False)
+    await nodetype_repo.create(NodeType(name="D", schema="{}"))
+    page = await outbox_repo.list_changes(page.next_token, 2)
+    # The page finishes the window the first page was read in
+    assert [json.loads(e.payload)["node_type"]["name"] for e in page.events] == ["C"]
+    page = await outbox_repo.list_changes(page.next_token, 2)
+    assert [json.loads(e.payload)["node_type"]["name"] for e in page.events] == ["D"]
+
+    for token in ("12", "5:3:", "1:2:/x"):
+        with pytest.raises(ValueError, match="invalid change token"):
+            await outbox_repo.list_changes(token, 2)
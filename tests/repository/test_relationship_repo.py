@@ -134,6 +134,27 @@ async def test_delete_relationship(relationship_repo, node_repo, nodetype_repo):
         await relationship_repo.get_by_id(created.id)
 
 
+@pytest.mark.asyncio
+async def test_delete_many_relationships(relationship_repo, node_repo, nodetype_repo):
+    """Test deleting relationships by type and source, in batches."""
+    node_type = await nodetype_repo.create(NodeType(name="Article", schema='{}'))
+    source = await node_repo.create(Node(node_type_id=node_type.id, data='{}'))
+    other = await node_repo.create(Node(node_type_id=node_type.id, data='{}'))
+    for _ in range(3):
+        target = await node_repo.create(Node(node_type_id=node_type.id, data='{}'))
+        await relationship_repo.create(Relationship(
+            source_node_id=source.id, target_node_id=target.id, relationship_type="references", data='{}'
+        ))
+    await relationship_repo.create(Relationship(
+        source_node_id=other.id, target_node_id=source.id, relationship_type="references", data='{}'
+    ))
+
+    assert await relationship_repo.delete_many(source.id, None, "references", 2, dry_run=True) == 3
+    assert await relationship_repo.delete_many(source.id, None, "references", 2) == 3
+    rels, _ = await relationship_repo.list(None, None, "references", ListOptions(page_size=10))
+    assert [r.source_node_id for r in rels] == [other.id]
+
+
 @pytest.mark.asyncio
 async def test_list_relationships(relationship_repo, node_repo, nodetype_repo):
     """Test listing relationships with pagination."""
@@ -204,3 +225,25 @@ async def test_list_relationships_filtered(relationship_repo, node_repo, nodetyp
     assert len(rels) == 1
     assert rels[0].relationship_type == "references"
 
+
+
+@pytest.mark.asyncio
+async def test_list_relationships_filtered_by_lists(relationship_repo, node_repo, nodetype_repo):
+    """Test list filters match any of several node IDs and types."""
+    node_type = await nodetype_repo.create(NodeType(name="Article", schema='{}'))
+    a, b, c = [await node_repo.create(Node(node_type_id=node_type.id, data='{}')) for _ in range(3)]
+    for source, target, rel_type in ((a, b, "references"), (b, c, "links_to"), (c, a, "cites"), (a, c, "cites")):
+        await relationship_repo.create(Relationship(
+            source_node_id=source.id, target_node_id=target.id, relationship_type=rel_type, data='{}'
+        ))
+
+    rels, result = await relationship_repo.list(
+        [a.id, b.id], [b.id, c.id], None, ListOptions(page_size=10)
+    )
+    assert result.total_count == 3
+    assert {(r.source_node_id, r.target_node_id) for r in rels} == {(a.id, b.id), (b.id, c.id), (a.id, c.id)}
+
+    rels, _ = await relationship_repo.list(None, None, ["references", "links_to"], ListOptions(page_size=10))
+    assert sorted(r.relationship_type for r in rels) == ["links_to", "references"]
+    rels, _ = await relationship_repo.list([], [], [], ListOptions(page_size=10))
+    assert len(rels) == 4
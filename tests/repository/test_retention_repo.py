@@ -0,0 +1,94 @@
+"""
+Tests for RetentionPolicyRepository and the expiry of nodes by retention policies.
+"""
+
+import pytest
+
+from app.repository import (
+    ListOptions,
+    Node,
+    NodeType,
+    NotFoundError,
+    Relationship,
+    RetentionPolicy,
+    RetentionPolicyRepository,
+)
+
+
+async def _age(tenant_db, node_id, seconds):
+    async with tenant_db.pool.acquire() as conn:
+        await conn.execute(
+            "UPDATE nodes SET created_at = NOW() - make_interval(secs => $2) WHERE id = $1", node_id, seconds
+        )
+
+
+@pytest.mark.asyncio
+async def test_upsert_get_and_delete(tenant_db, nodetype_repo):
+    """Test a node type has at most one policy, replaced by upserts and recording sweeps."""
+    repo = RetentionPolicyRepository(tenant_db)
+    node_type = await nodetype_repo.create(NodeType(name="Session"))
+
+    await repo.upsert(RetentionPolicy(node_type_id=node_type.id, ttl_seconds=3600))
+    policy = await repo.upsert(RetentionPolicy(node_type_id=node_type.id, ttl_seconds=60, action="purge"))
+    assert (policy.timestamp_field, policy.ttl_seconds, policy.action) == ("created_at", 60, "purge")
+
+    await repo.record_sweep(node_type.id, 3)
+    stored = await repo.get(node_type.id)
+    assert stored.last_expired_count == 3
+    assert stored.last_swept_at is not None
+    policies, result = await repo.list(ListOptions())
+    assert result.total_count == 1
+    assert [p.node_type_id for p in policies] == [node_type.id]
+
+    await repo.delete(node_type.id)
+    with pytest.raises(NotFoundError):
+        await repo.get(node_type.id)
+    with pytest.raises(NotFoundError):
+        await repo.upsert(RetentionPolicy(node_type_id="00000000-0000-0000-0000-000000000000", ttl_seconds=60))
+
+
+@pytest.mark.asyncio
+async def test_delete_expired_by_created_at(tenant_db, nodetype_repo, node_repo, relationship_repo):
+    """Test expired nodes are deleted in batches with their relationships, and their deletes recorded."""
+    node_type = await nodetype_repo.create(NodeType(name="Session"))
+    old = [await node_repo.create(Node(node_type_id=node_type.id, data="{}")) for _ in range(3)]
+    fresh = await node_repo.create(Node(node_type_id=node_type.id, data="{}"))
+    for node in old:
+        await _age(tenant_db, node.id, 7200)
+    await relationship_repo.create(
+        Relationship(source_node_id=old[0].id, target_node_id=fresh.id, relationship_type="next")
+    )
+
+    policy = RetentionPolicy(node_type_id=node_type.id, ttl_seconds=3600)
+    assert await node_repo.count_expired(policy) == 3
+    assert await node_repo.delete_expired(policy, 2) == 2
+    assert await node_repo.delete_expired(policy, 2) == 1
+    assert await node_repo.delete_expired(policy, 2) == 0
+
+    await node_repo.get_by_id(fresh.id)
+    async with tenant_db.pool.acquire() as conn:
+        assert await conn.fetchval("SELECT COUNT(*) FROM relationships") == 0
+        assert await conn.fetchval("SELECT COUNT(*) FROM node_revisions WHERE op = 'deleted'") == 3
+
+
+@pytest.mark.asyncio
+async def test_delete_expired_by_data_field_and_purge(tenant_db, nodetype_repo, node_repo):
+    """Test data field expiry skips nodes without a timestamp, and purges remove revisions."""
+    node_type = await nodetype_repo.create(NodeType(name="Offer"))
+    expired = await node_repo.create(
+        Node(node_type_id=node_type.id, data='{"ends": {"at": "2020-01-01T00:00:00Z"}}')
+    )
+    await node_repo.create(Node(node_type_id=node_type.id, data='{"ends": {"at": "2999-01-01T00:00:00Z"}}'))
+    await node_repo.create(Node(node_type_id=node_type.id, data='{"ends": {"at": "someday"}}'))
+    await node_repo.create(Node(node_type_id=node_type.id, data='{"ends": {"at": 5}}'))
+    await node_repo.create(Node(node_type_id=node_type.id, data="{}"))
+
+    policy = RetentionPolicy(
+        node_type_id=node_type.id, timestamp_field="data.ends.at", ttl_seconds=60, action="purge"
+    )
+    assert await node_repo.count_expired(policy) == 1
+    assert await node_repo.delete_expired(policy, 10) == 1
+
+    async with tenant_db.pool.acquire() as conn:
+        assert await conn.fetchval("SELECT COUNT(*) FROM node_revisions WHERE node_id = $1", expired.id) == 0
+        assert await conn.fetchval("SELECT COUNT(*) FROM nodes") == 4
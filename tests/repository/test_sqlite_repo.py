@@ -0,0 +1,215 @@
+"""
+Tests for the SQLite repositories and storage backend.
+
+These run on files in a temporary directory, with the services on top.
+"""
+
+import json
+import os
+
+import pytest
+
+from app.repository import Aggregation, DataFilter, ListOptions, SortOrder
+from app.repository.errors import ConflictError, NotFoundError
+from app.service import TenantService, UserService
+from app.storage import LocalTenantServices, SqliteStorage
+
+
+@pytest.fixture
+def storage(tmp_path):
+    return SqliteStorage(str(tmp_path))
+
+
+@pytest.fixture
+def services(storage):
+    return LocalTenantServices(storage)
+
+
+async def _tenant_services(storage, services):
+    tenant = await TenantService(storage.control().tenants).create("acme", "Acme")
+    return tenant, await services.services(tenant.id)
+
+
+@pytest.mark.asyncio
+async def test_tenant_and_user_services(storage):
+    """Test tenants, users and memberships in control.db."""
+    control = storage.control()
+    tenants = TenantService(control.tenants, quota_repo=control.tenant_quotas)
+    users = UserService(control.users)
+
+    tenant = await tenants.create("acme", "Acme")
+    user = await users.create("a@example.com", "A")
+    await users.add_to_tenant(tenant.id, user.id, "admin")
+
+    members, result = await users.list_tenant_users(tenant.id, 10, "")
+    assert [(m.user_id, m.role) for m in members] == [(user.id, "admin")]
+    assert result.total_count == 1
+
+    with pytest.raises(ConflictError):
+        await tenants.create("acme", "Other")
+
+    await tenants.delete(tenant.id)
+    members, _ = await users.list_tenant_users(tenant.id, 10, "")
+    assert members == []
+    with pytest.raises(NotFoundError, match=f"tenant not found: {tenant.id}"):
+        await tenants.get_by_id(tenant.id)
+
+
+@pytest.mark.asyncio
+async def test_crud_versions_and_events(storage, services):
+    """Test updates bump versions, stale versions conflict and mutations record events."""
+    tenant, svc = await _tenant_services(storage, services)
+    node_type = await svc["node_type"].create("Article", "", '{"title": "string"}')
+    node = await svc["node"].create(node_type.id, '{"title": "a"}')
+
+    updated = await svc["node"].update(node.id, '{"title": "b"}', expected_version=1)
+    assert updated.version == 2
+    assert json.loads((await svc["node"].get_by_id(node.id)).data) == {"title": "b"}
+    with pytest.raises(ConflictError, match=f"node {node.id} has version 2, expected 1"):
+        await svc["node"].update(node.id, '{"title": "c"}', expected_version=1)
+
+    revisions, _ = await svc["node"].repo.list_revisions(node.id, ListOptions())
+    assert sorted(r.version for r in revisions) == [1, 2]
+
+    outbox = (await storage.tenant(tenant.id)).outbox
+    events = await outbox.list_pending(10)
+    assert [e.event_type for e in events] == ["node_type.created", "node.created", "node.updated"]
+    assert await outbox.latest_sequence() == 3
+
+    await outbox.mark_dispatched([events[0].id])
+    assert len(await outbox.list_pending(10)) == 2
+
+
+@pytest.mark.asyncio
+async def test_conditional_deletes(storage, services):
+    """Test deletes with a stale version or etag conflict and leave the entity alone."""
+    _, svc = await _tenant_services(storage, services)
+    node_type = await svc["node_type"].create("Article", "", "")
+    node = await svc["node"].create(node_type.id, "{}")
+    other = await svc["node"].create(node_type.id, "{}")
+    rel = await svc["relationship"].create(node.id, other.id, "cites", "{}")
+    node = await svc["node"].update(node.id, '{"title": "a"}', if_match=node.etag)
+
+    with pytest.raises(ConflictError, match=f"node {node.id} has version 2, expected 1"):
+        await svc["node"].delete(node.id, if_match='"1"')
+    with pytest.raises(ConflictError):
+        await svc["relationship"].delete(rel.id, expected_version=2)
+    await svc["relationship"].delete(rel.id, if_match=rel.etag)
+    await svc["node"].delete(node.id, expected_version=2)
+    with pytest.raises(NotFoundError):
+        await svc["node"].get_by_id(node.id)
+
+
+@pytest.mark.asyncio
+async def test_batch_get(storage, services):
+    """Test batch gets read the entities found in one query and list the missing IDs."""
+    _, svc = await _tenant_services(storage, services)
+    node_type = await svc["node_type"].create("Article", "", "")
+    first = await svc["node"].create(node_type.id, '{"title": "a"}')
+    second = await svc["node"].create(node_type.id, '{"title": "b"}')
+    await svc["node"].delete(first.id)
+
+    nodes, missing = await svc["node"].batch_get([first.id, second.id])
+    assert ([n.id for n in nodes], missing) == ([second.id], [first.id])
+
+    node_types, missing = await svc["node_type"].batch_get([node_type.id, second.id])
+    assert ([t.id for t in node_types], missing) == ([node_type.id], [second.id])
+
+
+@pytest.mark.asyncio
+async def test_deletes_cascade(storage, services):
+    """Test deleting a node type deletes its nodes and their relationships."""
+    _, svc = await _tenant_services(storage, services)
+    node_type = await svc["node_type"].create("Article", "", "")
+    a = await svc["node"].create(node_type.id, "{}")
+    b = await svc["node"].create(node_type.id, "{}")
+    rel = await svc["relationship"].create(a.id, b.id, "links", "{}")
+
+    await svc["node_type"].delete(node_type.id)
+
+    with pytest.raises(NotFoundError):
+        await svc["node"].get_by_id(a.id)
+    with pytest.raises(NotFoundError):
+        await svc["relationship"].get_by_id(rel.id)
+
+
+@pytest.mark.asyncio
+async def test_list_count_and_aggregate(storage, services):
+    """Test nodes list, count and aggregate with data filters like the other backends."""
+    _, svc = await _tenant_services(storage, services)
+    node_type = await svc["node_type"].create("Ticket", "", "")
+    for rank, status in ((2, "open"), (1, "open"), (3, "closed")):
+        await svc["node"].create(node_type.id, json.dumps({"rank": rank, "status": status}))
+    repo = svc["node"].repo
+
+    nodes, result = await repo.list(node_type.id, ListOptions(page_size=2), sort=SortOrder(field="rank"))
+    assert [json.loads(n.data)["rank"] for n in nodes] == [1, 2]
+    assert result.total_count == 3
+    assert result.next_page_token == "2"
+
+    assert await repo.count(node_type.id) == 3
+    assert await repo.count(None, DataFilter(equals={("status",): "open"})) == 2
+
+    buckets = await repo.aggregate(node_type.id, Aggregation(kind="terms", field="status", size=10))
+    assert [(b.key, b.doc_count) for b in buckets] == [("open", 2), ("closed", 1)]
+
+
+@pytest.mark.asyncio
+async def test_data_persists_and_deleted_tenants_are_dropped(tmp_path):
+    """Test a reopened directory keeps its data and a deleted tenant's file is removed."""
+    storage = SqliteStorage(str(tmp_path))
+    tenant, svc = await _tenant_services(storage, LocalTenantServices(storage))
+    node_type = await svc["node_type"].create("Article", "", "")
+    await storage.close()
+
+    storage = SqliteStorage(str(tmp_path))
+    services = LocalTenantServices(storage)
+    svc = await services.services(tenant.id)
+    assert (await svc["node_type"].get_by_id(node_type.id)).name == "Article"
+    assert os.path.exists(tmp_path / f"tenant_{tenant.id}.db")
+
+    await TenantService(storage.control().tenants).delete(tenant.id)
+    with pytest.raises(NotFoundError):
+        await services.services(tenant.id)
+    assert not os.path.exists(tmp_path / f"tenant_{tenant.id}.db")
+    await storage.close()
+
+
+@pytest.mark.asyncio
+async def test_dry_runs_roll_back(storage, services):
+    """Test dry runs check constraints in a transaction that is rolled back."""
+    tenant, svc = await _tenant_services(storage, services)
+    node_type = await svc["node_type"].create("Article", "", "", unique_keys=["title"])
+    node = await svc["node"].create(node_type.id, '{"title": "a"}')
+
+    with pytest.raises(ConflictError):
+        await svc["node"].create(node_type.id, '{"title": "a"}', dry_run=True)
+    await svc["node"].update(node.id, '{"title": "b"}', dry_run=True)
+    await svc["node_type"].delete(node_type.id, dry_run=True)
+
+    assert json.loads((await svc["node"].get_by_id(node.id)).data) == {"title": "a"}
+    outbox = (await storage.tenant(tenant.id)).outbox
+    assert await outbox.latest_sequence() == 2
+
+
+@pytest.mark.asyncio
+async def test_bulk_jobs_record_progress_and_cancellation(storage, services):
+    """Test a cancelled bulk delete stops after its batch and its job keeps the progress."""
+    tenant, svc = await _tenant_services(storage, services)
+    node_type = await svc["node_type"].create("Article", "", "")
+    for _ in range(3):
+        await svc["node"].create(node_type.id, "{}")
+    jobs = svc["bulk_jobs"]
+    job = await jobs.start("bulk_delete", {"node_type_id": node_type.id}, unit="nodes")
+
+    async def on_batch(processed, total):
+        if processed:
+            await svc["operations"].cancel(f"bulk_deletes/{job.id}")
+        return await jobs.report(job, processed, total)
+
+    repo = (await storage.tenant(tenant.id)).nodes
+    assert await repo.delete_many(node_type.id, None, 2, on_batch=on_batch) == 2
+
+    operation = await svc["operations"].get(f"bulk_deletes/{job.id}")
+    assert (operation.status, operation.metadata["processed"], operation.metadata["total"]) == ("cancelled", 2, 3)
+    assert (await svc["node"].list(node_type.id, 10, ""))[1].total_count == 1
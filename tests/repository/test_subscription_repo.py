@@ -0,0 +1,59 @@
+"""
+Tests for SubscriptionRepository and fan-out to pull subscriptions.
+"""
+
+import pytest
+
+from app.repository import AlreadyExistsError, EventSubscription, Node, NodeType, SubscriptionRepository
+
+
+@pytest.fixture
+async def subscription_repo(tenant_db):
+    return SubscriptionRepository(tenant_db)
+
+
+@pytest.mark.asyncio
+async def test_fan_out_queues_matching_events(subscription_repo, outbox_repo, nodetype_repo, node_repo):
+    """Test subscriptions queue the events matching their filters, with their event IDs."""
+    article = await nodetype_repo.create(NodeType(name="Article", schema="{}"))
+    await outbox_repo.fan_out_to_webhooks(10)
+    everything = await subscription_repo.create(EventSubscription(name="everything"))
+    nodes = await subscription_repo.create(EventSubscription(name="nodes", event_types=["node.created"]))
+    with pytest.raises(AlreadyExistsError):
+        await subscription_repo.create(EventSubscription(name="nodes"))
+
+    node = await node_repo.create(Node(node_type_id=article.id, data='{"title": "a"}'))
+    await nodetype_repo.create(NodeType(name="Other", schema="{}"))
+    assert await outbox_repo.fan_out_to_webhooks(10) == 2
+
+    assert (await subscription_repo.get_by_id(everything.id)).backlog == 2
+    [message] = await subscription_repo.pull(nodes.id, 10, 60)
+    assert message.event_type == "node.created"
+    assert message.payload["node"]["id"] == node.id
+    assert message.delivery_count == 1
+
+
+@pytest.mark.asyncio
+async def test_pull_leases_until_acked(subscription_repo, outbox_repo, nodetype_repo, tenant_db):
+    """Test pulled events are leased, offered again once released, and gone once acknowledged."""
+    subscription = await subscription_repo.create(EventSubscription(name="consumer"))
+    for name in ("A", "B", "C"):
+        await nodetype_repo.create(NodeType(name=name, schema="{}"))
+    await outbox_repo.fan_out_to_webhooks(10)
+
+    first = await subscription_repo.pull(subscription.id, 2, 60)
+    assert [m.payload["node_type"]["name"] for m in first] == ["A", "B"]
+    [third] = await subscription_repo.pull(subscription.id, 10, 60)
+    assert third.payload["node_type"]["name"] == "C"
+    assert await subscription_repo.pull(subscription.id, 10, 60) == []
+
+    assert await subscription_repo.ack(subscription.id, [int(first[0].ack_id), int(third.ack_id)]) == 2
+    assert await subscription_repo.nack(subscription.id, [int(first[1].ack_id)]) == 1
+    [again] = await subscription_repo.pull(subscription.id, 10, 60)
+    assert again.event_id == first[1].event_id
+    assert again.delivery_count == 2
+
+    # Leases that ended are pulled again without a nack
+    async with tenant_db.pool.acquire() as conn:
+        await conn.execute("UPDATE subscription_messages SET leased_until = NOW() - INTERVAL '1 second'")
+    assert [m.ack_id for m in await subscription_repo.pull(subscription.id, 10, 60)] == [again.ack_id]
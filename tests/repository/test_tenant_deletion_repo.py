@@ -0,0 +1,84 @@
+"""
+Tests for TenantDeletionRepository.
+"""
+
+import uuid
+
+import pytest
+
+from app.repository import AuditEvent, AuditRepository, Tenant, TenantDeletionRepository
+from app.repository.errors import NotFoundError
+
+
+@pytest.fixture
+def deletion_repo(clean_control_db):
+    return TenantDeletionRepository(clean_control_db)
+
+
+@pytest.mark.asyncio
+async def test_start_marks_tenant_deleting(deletion_repo, tenant_repo):
+    """Test starting a deletion makes the tenant deleting and queues the deletion once."""
+    tenant = await tenant_repo.create(Tenant(slug="doomed", name="Doomed"))
+
+    deletion = await deletion_repo.start(tenant.id)
+
+    assert (deletion.tenant_id, deletion.slug, deletion.status, deletion.step) == (tenant.id, "doomed", "pending", "")
+    assert (await tenant_repo.get_by_id(tenant.id)).status == "deleting"
+    assert (await deletion_repo.start(tenant.id)).created_at == deletion.created_at
+    assert (await deletion_repo.get(tenant.id)).status == "pending"
+
+
+@pytest.mark.asyncio
+async def test_start_unknown_tenant(deletion_repo):
+    """Test deleting a tenant that doesn't exist raises NotFoundError."""
+    with pytest.raises(NotFoundError):
+        await deletion_repo.start(str(uuid.uuid4()))
+    with pytest.raises(NotFoundError):
+        await deletion_repo.get(str(uuid.uuid4()))
+
+
+@pytest.mark.asyncio
+async def test_claim_save_progress_and_resume(deletion_repo, tenant_repo):
+    """Test a claimed deletion saves its progress, and a failed one is queued again by start."""
+    tenant = await tenant_repo.create(Tenant(slug="doomed", name="Doomed"))
+    await deletion_repo.start(tenant.id)
+
+    deletion = await deletion_repo.claim(60)
+    assert deletion.status == "running"
+    assert await deletion_repo.claim(60) is None
+
+    deletion.step = "nodes"
+    deletion.progress = {"relationships": 12, "nodes": 3}
+    deletion.status = "failed"
+    deletion.error = "connection lost"
+    assert await deletion_repo.save_progress(deletion, 60)
+    assert deletion.finished_at is not None
+    assert not await deletion_repo.save_progress(deletion, 60)
+
+    resumed = await deletion_repo.start(tenant.id)
+    assert (resumed.status, resumed.step, resumed.progress, resumed.error) == (
+        "pending", "nodes", {"relationships": 12, "nodes": 3}, ""
+    )
+
+
+@pytest.mark.asyncio
+async def test_delete_control_rows_and_tenant(deletion_repo, tenant_repo, clean_control_db):
+    """Test the control steps delete the tenant's rows in batches, then the tenant, keeping the deletion."""
+    tenant = await tenant_repo.create(Tenant(slug="doomed", name="Doomed"))
+    other = await tenant_repo.create(Tenant(slug="kept", name="Kept"))
+    audit_repo = AuditRepository(clean_control_db)
+    for tenant_id in (tenant.id, tenant.id, tenant.id, other.id):
+        await audit_repo.record(AuditEvent(tenant_id=tenant_id, event_type="security.lockout"))
+    await deletion_repo.start(tenant.id)
+
+    assert await deletion_repo.delete_control_rows(tenant.id, "audit_events", 2) == 2
+    assert await deletion_repo.delete_control_rows(tenant.id, "audit_events", 2) == 1
+    assert await deletion_repo.delete_control_rows(tenant.id, "audit_events", 2) == 0
+    assert await audit_repo.list_erased_tenant_ids() == {tenant.id}
+
+    assert await deletion_repo.delete_tenant(tenant.id) == 1
+    assert await deletion_repo.delete_tenant(tenant.id) == 0
+    with pytest.raises(NotFoundError):
+        await tenant_repo.get_by_id(tenant.id)
+    assert (await tenant_repo.get_by_id(other.id)).status == "active"
+    assert (await deletion_repo.get(tenant.id)).slug == "doomed"
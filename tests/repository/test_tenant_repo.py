@@ -4,7 +4,7 @@ Tests for TenantRepository.
 
 import pytest
 
-from app.repository.errors import NotFoundError
+from app.repository.errors import ConflictError, NotFoundError
 from app.repository.models import Tenant, ListOptions
 
 
@@ -95,6 +95,27 @@ async def test_delete_tenant_not_found(tenant_repo):
         await tenant_repo.delete(non_existent_id)
 
 
+@pytest.mark.asyncio
+async def test_rename_tenant_slug(tenant_repo):
+    """Test renaming a tenant's slug records the change, and finds it by slug and former slug."""
+    created = await tenant_repo.create(Tenant(slug="test-tenant", name="Test Tenant"))
+    await tenant_repo.create(Tenant(slug="other-tenant", name="Other Tenant"))
+
+    renamed = await tenant_repo.rename_slug(created.id, "renamed-tenant", "alice")
+    assert renamed.slug == "renamed-tenant"
+    assert (await tenant_repo.get_by_slug("renamed-tenant")).id == created.id
+    assert (await tenant_repo.get_by_former_slug("test-tenant")).id == created.id
+    assert await tenant_repo.get_by_former_slug("other-tenant") is None
+
+    await tenant_repo.rename_slug(created.id, "renamed-tenant", "alice")
+    with pytest.raises(ConflictError):
+        await tenant_repo.rename_slug(created.id, "other-tenant", "alice")
+    changes = await tenant_repo.list_slug_changes(created.id)
+    assert [(c.old_slug, c.new_slug, c.actor) for c in changes] == [("test-tenant", "renamed-tenant", "alice")]
+    with pytest.raises(NotFoundError):
+        await tenant_repo.get_by_slug("test-tenant")
+
+
 @pytest.mark.asyncio
 async def test_list_tenants(tenant_repo):
     """Test listing tenants with pagination."""
@@ -0,0 +1,143 @@
+"""
+Tests for WebhookRepository.
+"""
+
+import pytest
+
+from app.repository.errors import NotFoundError
+from app.repository.models import WebhookEndpoint, ListOptions
+
+
+@pytest.mark.asyncio
+async def test_create_webhook_endpoint(webhook_repo):
+    """Test creating a webhook endpoint."""
+    endpoint = WebhookEndpoint(
+        url="https://example.com/hooks",
+        secret="s3cret",
+        event_types=["node.created"],
+        description="Example",
+    )
+    created = await webhook_repo.create(endpoint)
+
+    assert created.id is not None
+    assert created.url == "https://example.com/hooks"
+    assert created.secret == "s3cret"
+    assert created.event_types == ["node.created"]
+    assert created.status == "active"
+
+
+@pytest.mark.asyncio
+async def test_update_webhook_endpoint(webhook_repo):
+    """Test updating a webhook endpoint."""
+    created = await webhook_repo.create(WebhookEndpoint(url="https://example.com/a", secret="s"))
+
+    created.url = "https://example.com/b"
+    created.status = "disabled"
+    updated = await webhook_repo.update(created)
+
+    assert updated.url == "https://example.com/b"
+    assert updated.status == "disabled"
+
+
+@pytest.mark.asyncio
+async def test_delete_webhook_endpoint(webhook_repo):
+    """Test deleting a webhook endpoint."""
+    created = await webhook_repo.create(WebhookEndpoint(url="https://example.com/a", secret="s"))
+
+    await webhook_repo.delete(created.id)
+
+    with pytest.raises(NotFoundError):
+        await webhook_repo.get_by_id(created.id)
+    with pytest.raises(NotFoundError):
+        await webhook_repo.delete(created.id)
+
+
+@pytest.mark.asyncio
+async def test_list_webhook_endpoints(webhook_repo):
+    """Test listing webhook endpoints with pagination."""
+    for i in range(3):
+        await webhook_repo.create(WebhookEndpoint(url=f"https://example.com/{i}", secret="s"))
+
+    endpoints, result = await webhook_repo.list(ListOptions(page_size=2))
+
+    assert len(endpoints) == 2
+    assert result.total_count == 3
+    assert result.next_page_token == "2"
+
+
+@pytest.mark.asyncio
+async def test_claim_and_record_attempt(webhook_repo, outbox_repo, nodetype_repo):
+    """Test claiming due deliveries and scheduling a retry."""
+    from app.repository.models import NodeType
+
+    await webhook_repo.create(WebhookEndpoint(url="https://example.com/a", secret="s"))
+    await nodetype_repo.create(NodeType(name="Article", schema="{}"))
+    await outbox_repo.fan_out_to_webhooks(10)
+
+    claimed = await webhook_repo.claim_due_deliveries(10, 30)
+    assert len(claimed) == 1
+    assert claimed[0].event_type == "node_type.created"
+
+    # Leased deliveries are not claimed again
+    assert await webhook_repo.claim_due_deliveries(10, 30) == []
+
+    await webhook_repo.record_attempt(claimed[0].id, "pending", 500, "boom", retry_in_seconds=0)
+    retried = await webhook_repo.claim_due_deliveries(10, 30)
+    assert len(retried) == 1
+    assert retried[0].attempts == 1
+    assert retried[0].last_status_code == 500
+    assert retried[0].last_error == "boom"
+
+
+@pytest.mark.asyncio
+async def test_failed_delivery_is_dead_lettered_and_requeued(tenant_db, webhook_repo, outbox_repo, nodetype_repo):
+    """Test a failed delivery becomes a dead letter with its event, and requeueing makes it due again."""
+    from app.repository import DEAD_LETTER_WEBHOOK_DELIVERY, DeadLetterRepository
+    from app.repository.models import NodeType
+
+    await webhook_repo.create(WebhookEndpoint(url="https://example.com/a", secret="s"))
+    await nodetype_repo.create(NodeType(name="Article", schema="{}"))
+    await outbox_repo.fan_out_to_webhooks(10)
+    [delivery] = await webhook_repo.claim_due_deliveries(10, 30)
+
+    await webhook_repo.record_attempt(delivery.id, "failed", 500, "HTTP 500")
+
+    dead_letters, result = await DeadLetterRepository(tenant_db).list(None, "dead", ListOptions())
+    assert result.total_count == 1
+    assert dead_letters[0].kind == DEAD_LETTER_WEBHOOK_DELIVERY
+    assert dead_letters[0].source_id == delivery.id
+    assert dead_letters[0].payload["event_type"] == "node_type.created"
+    assert dead_letters[0].error == "HTTP 500"
+
+    requeued = await webhook_repo.requeue_delivery(delivery.id)
+    assert requeued.status == "pending" and requeued.attempts == 0
+    assert [d.id for d in await webhook_repo.claim_due_deliveries(10, 30)] == [delivery.id]
+
+
+@pytest.mark.asyncio
+async def test_delivery_log(tenant_db, webhook_repo, outbox_repo, nodetype_repo):
+    """Test listing an endpoint's deliveries newest first, with latency, and that test events aren't dead-lettered."""
+    from app.repository import DeadLetterRepository
+    from app.repository.models import NodeType
+
+    endpoint = await webhook_repo.create(WebhookEndpoint(url="https://example.com/a", secret="s"))
+    await nodetype_repo.create(NodeType(name="Article", schema="{}"))
+    await outbox_repo.fan_out_to_webhooks(10)
+    test = await webhook_repo.create_test_delivery(endpoint.id, "webhook.test", {"message": "hi"})
+    assert test.test and test.status == "pending"
+    with pytest.raises(NotFoundError):
+        await webhook_repo.create_test_delivery("00000000-0000-0000-0000-000000000000", "webhook.test", {})
+
+    await webhook_repo.record_attempt(test.id, "failed", 401, "unexpected status 401", latency_ms=42)
+
+    deliveries, result = await webhook_repo.list_deliveries(endpoint.id, ListOptions())
+    assert result.total_count == 2
+    assert [d.event_type for d in deliveries] == ["webhook.test", "node_type.created"]
+    assert deliveries[0].last_latency_ms == 42
+    assert deliveries[0].last_attempt_at is not None
+    failed, _ = await webhook_repo.list_deliveries(endpoint.id, ListOptions(), "failed")
+    assert [d.id for d in failed] == [test.id]
+    assert (await webhook_repo.get_delivery(test.id)).last_status_code == 401
+
+    _, dead = await DeadLetterRepository(tenant_db).list(None, "dead", ListOptions())
+    assert dead.total_count == 0
@@ -0,0 +1,112 @@
+"""
+Tests for ApiKeyService.
+"""
+
+from datetime import datetime, timedelta, timezone
+
+import pytest
+
+from app.repository.errors import ConflictError, NotFoundError
+
+
+@pytest.mark.asyncio
+async def test_create_and_authenticate_api_key(api_key_service, test_tenant):
+    """Test a created key authenticates until it is revoked."""
+    api_key, key = await api_key_service.create(test_tenant["id"], "ci", ["nodes:read"])
+
+    assert key.startswith("fdb_")
+    assert api_key.key_prefix == key[:12]
+    assert "key" not in api_key.to_dict()
+
+    authenticated = await api_key_service.authenticate(key)
+    assert authenticated.id == api_key.id
+    assert authenticated.scopes == ["nodes:read"]
+    assert await api_key_service.authenticate(key + "x") is None
+
+    revoked = await api_key_service.revoke(test_tenant["id"], api_key.id)
+    assert revoked.revoked_at is not None
+    assert await api_key_service.authenticate(key) is None
+
+
+@pytest.mark.asyncio
+async def test_create_api_key_validation(api_key_service, test_tenant):
+    """Test API key scopes and node type restrictions are validated."""
+    with pytest.raises(ValueError, match="name is required"):
+        await api_key_service.create(test_tenant["id"], "", ["read"])
+    with pytest.raises(ValueError, match="unknown scope"):
+        await api_key_service.create(test_tenant["id"], "ci", ["everything"])
+    with pytest.raises(ValueError, match="node_type_ids can only restrict"):
+        await api_key_service.create(test_tenant["id"], "ci", ["admin"], ["nt-1"])
+
+    api_key, _ = await api_key_service.create(test_tenant["id"], "ci", ["nodes:write"], ["nt-1", "nt-1"])
+    assert api_key.node_type_ids == ["nt-1"]
+
+
+@pytest.mark.asyncio
+async def test_api_keys_are_scoped_to_tenant(api_key_service, test_tenant):
+    """Test API keys are listed and retrieved per tenant."""
+    api_key, _ = await api_key_service.create(test_tenant["id"], "ci", ["read"])
+
+    keys, result = await api_key_service.list(test_tenant["id"], 10, "")
+    assert [k.id for k in keys] == [api_key.id]
+    assert result.total_count == 1
+
+    with pytest.raises(NotFoundError):
+        await api_key_service.get_by_id("00000000-0000-0000-0000-000000000000", api_key.id)
+    with pytest.raises(NotFoundError):
+        await api_key_service.create("00000000-0000-0000-0000-000000000000", "ci", ["read"])
+
+
+@pytest.mark.asyncio
+async def test_expired_api_key_does_not_authenticate(api_key_service, api_key_repo, test_tenant):
+    """Test keys stop authenticating at expires_at and record when they were last used."""
+    soon = (datetime.now(timezone.utc) + timedelta(hours=1)).isoformat()
+    api_key, key = await api_key_service.create(test_tenant["id"], "ci", ["read"], expires_at=soon)
+    assert api_key.expires_at is not None
+
+    await api_key_service.authenticate(key)
+    assert (await api_key_service.get_by_id(test_tenant["id"], api_key.id)).last_used_at is not None
+
+    async with api_key_repo.db.pool.acquire() as conn:
+        await conn.execute("UPDATE api_keys SET expires_at = NOW() - INTERVAL '1 second' WHERE id = $1", api_key.id)
+    assert await api_key_service.authenticate(key) is None
+
+    with pytest.raises(ValueError, match="in the future"):
+        await api_key_service.create(test_tenant["id"], "ci", ["read"], expires_at="2000-01-01T00:00:00Z")
+    with pytest.raises(ValueError, match="ISO 8601"):
+        await api_key_service.create(test_tenant["id"], "ci", ["read"], expires_at="tomorrow")
+
+
+@pytest.mark.asyncio
+async def test_rotate_api_key(api_key_service, test_tenant):
+    """Test rotation replaces a key, immediately or after a grace period."""
+    api_key, key = await api_key_service.create(test_tenant["id"], "ci", ["nodes:read"], ["nt-1"])
+
+    rotated, new_key, previous = await api_key_service.rotate(test_tenant["id"], api_key.id)
+    assert rotated.rotated_from_id == api_key.id
+    assert rotated.scopes == ["nodes:read"] and rotated.node_type_ids == ["nt-1"]
+    assert previous.revoke_reason == "rotated"
+    assert await api_key_service.authenticate(key) is None
+    assert (await api_key_service.authenticate(new_key)).id == rotated.id
+
+    with pytest.raises(ConflictError):
+        await api_key_service.rotate(test_tenant["id"], api_key.id)
+
+    _, newest_key, previous = await api_key_service.rotate(test_tenant["id"], rotated.id, grace_period=3600)
+    assert previous.revoked_at is None
+    assert previous.expires_at is not None
+    assert (await api_key_service.authenticate(new_key)).id == rotated.id
+    assert await api_key_service.authenticate(newest_key) is not None
+
+
+@pytest.mark.asyncio
+async def test_record_api_key_ips(api_key_service, api_key_repo, test_tenant):
+    """Test a key's first IP is known, and later IPs are new only once."""
+    api_key, _ = await api_key_service.create(test_tenant["id"], "ci", ["read"])
+
+    assert await api_key_repo.record_ip(api_key.id, "10.0.0.1") is False
+    assert await api_key_repo.record_ip(api_key.id, "10.0.0.1") is False
+    assert await api_key_repo.record_ip(api_key.id, "10.0.0.2") is True
+    assert await api_key_repo.record_ip(api_key.id, "10.0.0.2") is False
+
+    assert [k.id for k in await api_key_repo.list_by_prefix(api_key.key_prefix)] == [api_key.id]
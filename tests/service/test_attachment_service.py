@@ -0,0 +1,68 @@
+"""
+Tests for AttachmentService.
+"""
+
+import hashlib
+
+import pytest
+
+from app.repository.errors import FailedPreconditionError, NotFoundError
+from app.service import AttachmentService
+
+
+async def _chunks(*chunks):
+    for chunk in chunks:
+        yield chunk
+
+
+@pytest.mark.asyncio
+async def test_upload_download_and_delete_attachment(attachment_service, node_service, nodetype_service):
+    """Test an attachment is sized, hashed, listed on its node, streamed back and deleted with its blob."""
+    node_type = await nodetype_service.create("Ticket", "", '{}')
+    node = await node_service.create(node_type.id, '{}')
+
+    attachment = await attachment_service.upload(node.id, "notes.txt", "", _chunks(b"hello ", b"world"))
+    assert attachment.size_bytes == 11
+    assert attachment.sha256 == hashlib.sha256(b"hello world").hexdigest()
+    assert attachment.content_type == "application/octet-stream"
+    assert attachment.blob_key == f"test-tenant/attachments/{attachment.id}"
+    assert "blob_key" not in attachment.to_dict()
+
+    assert [a.id for a in await attachment_service.list(node.id)] == [attachment.id]
+    fetched, chunks = await attachment_service.download(attachment.id)
+    assert fetched.filename == "notes.txt"
+    assert b"".join([chunk async for chunk in chunks]) == b"hello world"
+
+    await attachment_service.delete(attachment.id)
+    assert await attachment_service.list(node.id) == []
+    with pytest.raises(NotFoundError):
+        await attachment_service.get(attachment.id)
+    with pytest.raises(NotFoundError):
+        await attachment_service.blobs.read(attachment.blob_key).__anext__()
+
+
+@pytest.mark.asyncio
+async def test_upload_attachment_rejects_invalid_uploads(attachment_service, node_service, nodetype_service):
+    """Test uploads need an existing node and a filename, and stay within the maximum size."""
+    node_type = await nodetype_service.create("Ticket", "", '{}')
+    node = await node_service.create(node_type.id, '{}')
+
+    with pytest.raises(ValueError, match="filename is required"):
+        await attachment_service.upload(node.id, "", "text/plain", _chunks(b"x"))
+    with pytest.raises(NotFoundError):
+        await attachment_service.upload("00000000-0000-0000-0000-000000000000", "a.txt", "", _chunks(b"x"))
+    with pytest.raises(ValueError, match="exceeds 1024 bytes"):
+        await attachment_service.upload(node.id, "big.bin", "", _chunks(b"x" * 1000, b"x" * 1000))
+    assert await attachment_service.list(node.id) == []
+
+
+@pytest.mark.asyncio
+async def test_attachments_require_a_blob_store(attachment_service, node_service, nodetype_service):
+    """Test attachments fail with FailedPreconditionError when no blob store is configured."""
+    node_type = await nodetype_service.create("Ticket", "", '{}')
+    node = await node_service.create(node_type.id, '{}')
+    disabled = AttachmentService(attachment_service.repo, attachment_service.node_repo, "test-tenant")
+
+    with pytest.raises(FailedPreconditionError, match="ATTACHMENTS_URL"):
+        await disabled.upload(node.id, "a.txt", "", _chunks(b"x"))
+    assert await disabled.list(node.id) == []
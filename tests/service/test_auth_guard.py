@@ -0,0 +1,154 @@
+"""
+Tests for brute-force protection and anomaly detection on authentication.
+"""
+
+import pytest
+
+from app.config import AuthConfig
+from app.repository import ApiKey
+from app.service.auth_guard import LOCKOUT, NEW_IP, UNUSUAL_VOLUME, AuthGuard, Lockouts, VolumeMonitor, key_prefix
+
+
+class Clock:
+    def __init__(self):
+        self.now = 1000.0
+
+    def __call__(self):
+        return self.now
+
+
+class FakeAuditService:
+    def __init__(self):
+        self.events = []
+
+    async def record(self, event):
+        self.events.append(event)
+        return event
+
+
+class FakeApiKeyRepository:
+    def __init__(self, api_keys=()):
+        self.api_keys = list(api_keys)
+        self.ips = {}
+
+    async def list_by_prefix(self, prefix):
+        return [k for k in self.api_keys if k.key_prefix == prefix]
+
+    async def record_ip(self, id, client_ip):
+        ips = self.ips.setdefault(id, set())
+        new = bool(ips) and client_ip not in ips
+        ips.add(client_ip)
+        return new
+
+
+def test_lockout_backoff():
+    """Test lockouts start after max failures and double up to the maximum."""
+    clock = Clock()
+    lockouts = Lockouts(max_failures=3, window=60, lockout=10, max_lockout=25, clock=clock)
+
+    assert lockouts.failure("ip:1") == 0
+    assert lockouts.failure("ip:1") == 0
+    assert lockouts.failure("ip:1") == 10
+    assert lockouts.retry_after("ip:1") == 10
+    assert lockouts.retry_after("ip:2") == 0
+
+    clock.now += 10
+    assert lockouts.retry_after("ip:1") == 0
+    for _ in range(2):
+        lockouts.failure("ip:1")
+    assert lockouts.failure("ip:1") == 20
+
+    clock.now += 20
+    for _ in range(2):
+        lockouts.failure("ip:1")
+    assert lockouts.failure("ip:1") == 25
+
+    # The backoff starts over once a lockout is the maximum lockout past
+    clock.now += 25 + 26
+    for _ in range(2):
+        lockouts.failure("ip:1")
+    assert lockouts.failure("ip:1") == 10
+
+
+def test_lockout_failures_expire_and_reset():
+    """Test failures outside the window or before a success don't count."""
+    clock = Clock()
+    lockouts = Lockouts(max_failures=2, window=60, lockout=10, max_lockout=100, clock=clock)
+
+    lockouts.failure("ip:1")
+    clock.now += 61
+    assert lockouts.failure("ip:1") == 0
+
+    lockouts.success("ip:1")
+    assert lockouts.failure("ip:1") == 0
+    assert lockouts.failure("ip:1") == 10
+
+    assert Lockouts(0, 60, 10, 100, clock).failure("ip:1") == 0
+
+
+def test_volume_monitor():
+    """Test volume far above a key's average is reported once per cooldown."""
+    clock = Clock()
+    clock.now = 0.0
+    volume = VolumeMonitor(factor=5, minimum=20, clock=clock)
+
+    for minute in range(10):
+        clock.now = minute * 60.0
+        for _ in range(5):
+            assert volume.hit("key-1") is None
+
+    clock.now = 10 * 60.0
+    results = [volume.hit("key-1") for _ in range(40)]
+    alerts = [r for r in results if r]
+    assert len(alerts) == 1
+    count, average = alerts[0]
+    assert count == 20 and average < 5
+
+    clock.now = 11 * 60.0
+    assert all(volume.hit("key-1") is None for _ in range(100))
+    assert VolumeMonitor(factor=0, minimum=1, clock=clock).hit("key-1") is None
+
+
+def test_key_prefix():
+    """Test only API key shaped keys have a prefix to lock out."""
+    assert key_prefix("fdb_abcdefgh12345") == "fdb_abcdefgh"
+    assert key_prefix("admin-secret") == ""
+
+
+@pytest.mark.asyncio
+async def test_guard_locks_out_and_reports():
+    """Test failed attempts lock out the IP and key prefix and are audited."""
+    clock = Clock()
+    api_key = ApiKey(id="key-1", tenant_id="tenant-1", key_prefix="fdb_abcdefgh")
+    audit = FakeAuditService()
+    cfg = AuthConfig(lockout_max_failures=2, lockout_seconds=30)
+    guard = AuthGuard(cfg, audit, FakeApiKeyRepository([api_key]), clock=clock)
+
+    await guard.failed("10.0.0.1", "fdb_abcdefgh-wrong")
+    assert guard.retry_after("10.0.0.1", "fdb_abcdefgh-wrong") == 0
+    await guard.failed("10.0.0.1", "fdb_abcdefgh-wrong")
+
+    assert guard.retry_after("10.0.0.1", "other") == 30
+    assert guard.retry_after("10.0.0.2", "fdb_abcdefgh-right") == 30
+    assert guard.retry_after("10.0.0.2", "fdb_zzzzzzzz") == 0
+    assert [(e.event_type, e.tenant_id, e.details["scope"]) for e in audit.events] == [
+        (LOCKOUT, "", "ip"),
+        (LOCKOUT, "tenant-1", "key_prefix"),
+    ]
+    assert audit.events[1].api_key_id == "key-1"
+
+
+@pytest.mark.asyncio
+async def test_guard_reports_new_ips():
+    """Test use of a key from a new IP is reported, but not its first IP."""
+    api_key = ApiKey(id="key-1", tenant_id="tenant-1", key_prefix="fdb_abcdefgh")
+    audit = FakeAuditService()
+    guard = AuthGuard(AuthConfig(), audit, FakeApiKeyRepository([api_key]), clock=Clock())
+
+    await guard.succeeded("10.0.0.1", api_key)
+    await guard.succeeded("10.0.0.1", api_key)
+    await guard.succeeded("10.0.0.2", api_key)
+    await guard.succeeded("10.0.0.2", None)
+
+    assert [(e.event_type, e.client_ip) for e in audit.events] == [(NEW_IP, "10.0.0.2")]
+    assert UNUSUAL_VOLUME not in [e.event_type for e in audit.events]
@@ -0,0 +1,71 @@
+"""
+Tests for BI view generation.
+"""
+
+from datetime import datetime
+
+from app.repository.bi_view_repo import column_sql, view_sql
+from app.repository.models import BiViewColumn, NodeType
+from app.service.bi_views import build_columns, build_views, view_name
+
+
+def test_view_name():
+    """Test node type names become lowercase snake_case identifiers."""
+    assert view_name("Blog Post") == "blog_post"
+    assert view_name("  Café-Orders!! ") == "caf_orders"
+    assert view_name("2024 Sales") == "t_2024_sales"
+    assert view_name("***") == "node_type"
+
+
+def test_build_views_unique_names():
+    """Test duplicate node type names and the relationships view get distinct view names."""
+    node_types = [
+        NodeType(id="22222222-0000-0000-0000-000000000000", name="article", created_at=datetime(2024, 1, 2)),
+        NodeType(id="11111111-0000-0000-0000-000000000000", name="Article", created_at=datetime(2024, 1, 1)),
+        NodeType(id="33333333-0000-0000-0000-000000000000", name="Relationships", created_at=datetime(2024, 1, 3)),
+    ]
+
+    views = build_views(node_types)
+
+    assert [v.name for v in views] == ["article", "article_22222222", "relationships_33333333"]
+    assert views[0].node_type_id == "11111111-0000-0000-0000-000000000000"
+
+
+def test_build_columns_by_field_type():
+    """Test declared field types map to typed columns."""
+    schema = (
+        '{"title": "string", "count": "integer", "score": "number", "done": "boolean",'
+        ' "price": {"type": "decimal"}, "tags": "array", "where": "geo_point",'
+        ' "name": {"type": "localized_string", "default_locale": "en"}, "notes": "custom",'
+        ' "id": "string"}'
+    )
+
+    columns = {c.name: c for c in build_columns(schema)}
+
+    assert {name: c.kind for name, c in columns.items()} == {
+        "title": "text",
+        "count": "bigint",
+        "score": "numeric",
+        "done": "boolean",
+        "price": "numeric",
+        "tags": "jsonb",
+        "where_lat": "numeric",
+        "where_lng": "numeric",
+        "name": "text",
+        "notes": "text",
+        "data_id": "text",
+    }
+    assert columns["name"].path == ["name", "en"]
+    assert columns["where_lng"].path == ["where", "lng"]
+
+
+def test_view_sql_quotes_identifiers_and_literals():
+    """Test generated SQL quotes field names and node type IDs."""
+    column = BiViewColumn(name='say "hi"', path=["it's"], kind="text")
+
+    assert column_sql(column) == '(n.data #>> ARRAY[\'it\'\'s\']::text[]) AS "say ""hi"""'
+
+    view = build_views([NodeType(id="11111111-0000-0000-0000-000000000000", name="Article")])[0]
+    sql = view_sql(view)
+    assert sql.startswith('CREATE VIEW bi."article" AS\nSELECT n.id, n.created_at, n.updated_at, n.version, n.data')
+    assert sql.endswith("WHERE n.node_type_id = '11111111-0000-0000-0000-000000000000'::uuid")
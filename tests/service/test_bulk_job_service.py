@@ -0,0 +1,88 @@
+"""
+Tests for BulkJobService, with bulk deletes on the in-memory repositories.
+"""
+
+from datetime import timedelta
+
+import pytest
+
+from app.repository import (
+    BULK_DELETE,
+    BulkJob,
+    FailedPreconditionError,
+    InMemoryBulkJobRepository,
+    InMemoryNodeRepository,
+    InMemoryNodeTypeRepository,
+    InMemoryStore,
+)
+from app.service import BulkJobService, NodeService, NodeTypeService, OperationService
+from app.service.operation_service import bulk_job_operations
+
+
+async def _nodes(store, count):
+    node_type = await NodeTypeService(InMemoryNodeTypeRepository(store)).create("Article", "", "")
+    nodes = NodeService(InMemoryNodeRepository(store), InMemoryNodeTypeRepository(store))
+    for i in range(count):
+        await nodes.create(node_type.id, f'{{"n": {i}}}')
+    return node_type
+
+
+@pytest.mark.asyncio
+async def test_bulk_delete_reports_progress():
+    """Test a bulk delete records its progress after every batch and succeeds."""
+    store = InMemoryStore()
+    node_type = await _nodes(store, 5)
+    jobs = BulkJobService(InMemoryBulkJobRepository(store))
+    reported = []
+
+    async def delete(on_batch):
+        async def hook(processed, total):
+            reported.append((processed, total))
+            return await on_batch(processed, total)
+        return await InMemoryNodeRepository(store).delete_many(node_type.id, None, 2, on_batch=hook)
+
+    job = await jobs.run(BULK_DELETE, {"node_type_id": node_type.id}, delete, unit="nodes")
+
+    assert reported == [(0, 5), (2, 5), (4, 5), (5, 5)]
+    assert (job.status, job.processed, job.total) == ("succeeded", 5, 5)
+    assert store.nodes == {}
+    stored = await jobs.get_by_id(job.id)
+    assert stored.finished_at is not None and stored.eta_seconds() is None
+    with pytest.raises(FailedPreconditionError, match="already succeeded"):
+        await OperationService(bulk_job_operations(jobs)).cancel(f"bulk_deletes/{job.id}")
+
+
+@pytest.mark.asyncio
+async def test_cancelled_bulk_delete_stops_after_its_batch():
+    """Test cancelling a bulk delete stops it at the next batch boundary and keeps its progress."""
+    store = InMemoryStore()
+    node_type = await _nodes(store, 5)
+    jobs = BulkJobService(InMemoryBulkJobRepository(store))
+    operations = OperationService(bulk_job_operations(jobs))
+
+    async def delete(on_batch):
+        async def hook(processed, total):
+            if processed == 2:
+                # Cancelled from another request while the first batch ran
+                page, _ = await operations.list("bulk_deletes", 10, "")
+                await operations.cancel(page[0].name)
+            return await on_batch(processed, total)
+        return await InMemoryNodeRepository(store).delete_many(node_type.id, None, 2, on_batch=hook)
+
+    job = await jobs.run(BULK_DELETE, {"node_type_id": node_type.id}, delete, unit="nodes")
+
+    assert (job.status, job.processed) == ("cancelled", 2)
+    assert len(store.nodes) == 3
+    operation = (await operations.get(f"bulk_deletes/{job.id}")).to_dict()
+    assert operation["done"] is True
+    assert operation["metadata"]["processed"] == 2
+    assert operation["error"] == {"message": "cancelled"}
+
+
+def test_eta_from_rate_so_far():
+    """Test the time left is estimated from the records processed so far."""
+    job = BulkJob(processed=25, total=100)
+    job.updated_at = job.created_at + timedelta(seconds=10)
+
+    assert job.eta_seconds() == 30.0
+    assert BulkJob(processed=25).eta_seconds() is None
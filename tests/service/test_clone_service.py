@@ -0,0 +1,108 @@
+"""
+Tests for CloneService, using the in-memory repositories.
+"""
+
+import json
+
+import pytest
+
+from app.repository import (
+    AlreadyExistsError,
+    InMemoryNodeRepository,
+    InMemoryNodeTypeRepository,
+    InMemoryRelationshipRepository,
+    InMemoryStore,
+    InMemoryTransferRepository,
+)
+from app.service import CloneService, NodeService, NodeTypeService, RelationshipService
+
+
+@pytest.fixture
+def store():
+    return InMemoryStore()
+
+
+@pytest.fixture
+def nodetype_service(store):
+    return NodeTypeService(InMemoryNodeTypeRepository(store))
+
+
+@pytest.fixture
+def node_service(store):
+    return NodeService(InMemoryNodeRepository(store), InMemoryNodeTypeRepository(store))
+
+
+@pytest.fixture
+def relationship_service(store):
+    return RelationshipService(InMemoryRelationshipRepository(store), InMemoryNodeRepository(store))
+
+
+@pytest.fixture
+def clone_service(store):
+    return CloneService(
+        InMemoryNodeRepository(store), InMemoryNodeTypeRepository(store),
+        InMemoryRelationshipRepository(store), InMemoryTransferRepository(store),
+    )
+
+
+@pytest.mark.asyncio
+async def test_clone_node_patches_data_and_keeps_targets(
+    store, nodetype_service, node_service, relationship_service, clone_service
+):
+    """Test a clone gets a new ID and patched data, and its relationships point at the original targets."""
+    node_type = await nodetype_service.create("Task", "", '{"title": "string", "done": "boolean", "site": "geo_point"}')
+    template = await node_service.create(node_type.id, '{"title": "Template", "done": true}')
+    owner = await node_service.create(node_type.id, '{"title": "Owner"}')
+    await relationship_service.create(template.id, owner.id, "owned_by", "{}")
+
+    copy, relationships = await clone_service.clone_node(
+        template.id, '{"title": "Copy", "done": null}', include_relationships=True
+    )
+
+    assert copy.id != template.id
+    assert json.loads(copy.data) == {"title": "Copy"}
+    assert [(r.source_node_id, r.target_node_id) for r in relationships] == [(copy.id, owner.id)]
+    assert json.loads((await node_service.get_by_id(template.id)).data) == {"title": "Template", "done": True}
+    assert [e.event_type for e in store.events[-2:]] == ["node.created", "relationship.created"]
+
+    with pytest.raises(ValueError):
+        await clone_service.clone_node(template.id, '{"site": "here"}')
+
+
+@pytest.mark.asyncio
+async def test_clone_subgraph_remaps_ids_to_depth(nodetype_service, node_service, relationship_service, clone_service):
+    """Test a subgraph clone copies reachable nodes once, remaps relationships and stops at the depth."""
+    node_type = await nodetype_service.create("Step", "", '{"name": "string"}')
+    a, b, c, d = [await node_service.create(node_type.id, json.dumps({"name": n})) for n in "abcd"]
+    await relationship_service.create(a.id, b.id, "next", "{}")
+    await relationship_service.create(a.id, c.id, "next", "{}")
+    await relationship_service.create(b.id, c.id, "next", "{}")
+    await relationship_service.create(c.id, d.id, "next", "{}")
+    await relationship_service.create(a.id, d.id, "see_also", "{}")
+
+    root, nodes, relationships, id_map = await clone_service.clone_subgraph(
+        a.id, depth=1, relationship_types=["next"], patch='{"name": "a2"}'
+    )
+
+    assert set(id_map) == {a.id, b.id, c.id}
+    assert root.id == id_map[a.id] and json.loads(root.data) == {"name": "a2"}
+    assert sorted(json.loads(n.data)["name"] for n in nodes) == ["a2", "b", "c"]
+    copied = {(r.source_node_id, r.target_node_id) for r in relationships}
+    assert copied == {(id_map[a.id], id_map[b.id]), (id_map[a.id], id_map[c.id]), (id_map[b.id], id_map[c.id])}
+
+    _, nodes, relationships, _ = await clone_service.clone_subgraph(a.id, depth=2)
+    assert len(nodes) == 4 and len(relationships) == 5
+    with pytest.raises(ValueError, match="depth must be between 0 and 10"):
+        await clone_service.clone_subgraph(a.id, depth=11)
+
+
+@pytest.mark.asyncio
+async def test_clone_respects_unique_keys(nodetype_service, node_service, clone_service):
+    """Test a node with a unique key can only be cloned with a patch changing it."""
+    node_type = await nodetype_service.create("Page", "", '{"slug": "string"}', unique_keys=["slug"])
+    page = await node_service.create(node_type.id, '{"slug": "home"}')
+
+    with pytest.raises(AlreadyExistsError):
+        await clone_service.clone_node(page.id)
+    copy, _ = await clone_service.clone_node(page.id, '{"slug": "home-2"}')
+    assert json.loads(copy.data) == {"slug": "home-2"}
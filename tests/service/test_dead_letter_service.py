@@ -0,0 +1,147 @@
+"""
+Tests for DeadLetterService, with dead letters, deliveries and migrations kept in memory.
+"""
+
+import pytest
+
+from app.repository import (
+    DEAD_LETTER_NODE_MIGRATION,
+    DEAD_LETTER_WEBHOOK_DELIVERY,
+    DeadLetter,
+    FailedPreconditionError,
+    NodeMigration,
+    NotFoundError,
+    WebhookDelivery,
+)
+from app.service.dead_letter_service import DeadLetterService
+
+
+class FakeDeadLetterRepo:
+    """The DeadLetterRepository methods the service uses, on a dict of dead letters."""
+
+    def __init__(self, dead_letters):
+        self.dead_letters = {d.id: d for d in dead_letters}
+
+    async def get_by_id(self, id):
+        if id not in self.dead_letters:
+            raise NotFoundError(f"dead_letter not found: {id}")
+        return self.dead_letters[id]
+
+    async def list(self, kind, status, opts):
+        dead_letters = [
+            d for d in self.dead_letters.values()
+            if (not kind or d.kind == kind) and (not status or d.status == status)
+        ]
+        return dead_letters[:opts.page_size], None
+
+    async def claim_replay(self, id):
+        dead_letter = await self.get_by_id(id)
+        if dead_letter.status != "dead":
+            return None
+        dead_letter.status = "replayed"
+        dead_letter.replay_count += 1
+        return dead_letter
+
+    async def finish_replay(self, dead_letter, error=""):
+        dead_letter.status = "dead" if error else "replayed"
+
+    async def discard(self, id):
+        dead_letter = await self.get_by_id(id)
+        if dead_letter.status != "dead":
+            return None
+        dead_letter.status = "discarded"
+        return dead_letter
+
+
+class FakeWebhookRepo:
+    def __init__(self, delivery_ids):
+        self.delivery_ids = delivery_ids
+        self.requeued = []
+
+    async def requeue_delivery(self, id):
+        if id not in self.delivery_ids:
+            raise NotFoundError(f"webhook delivery not found: {id}")
+        self.requeued.append(id)
+        return WebhookDelivery(id=id, status="pending")
+
+
+class FakeMigrationService:
+    def __init__(self):
+        self.started = []
+
+    async def start(self, node_type_id, transform="", batch_size=500):
+        self.started.append((node_type_id, transform, batch_size))
+        return NodeMigration(id="m2", node_type_id=node_type_id, batch_size=batch_size)
+
+
+def _service(*dead_letters, delivery_ids=("d1",)):
+    repo = FakeDeadLetterRepo(dead_letters)
+    webhooks = FakeWebhookRepo(delivery_ids)
+    migrations = FakeMigrationService()
+    return DeadLetterService(repo, webhooks, migrations), repo, webhooks, migrations
+
+
+def _delivery(id, source_id="d1"):
+    return DeadLetter(id=id, kind=DEAD_LETTER_WEBHOOK_DELIVERY, source_id=source_id, error="HTTP 500", attempts=8)
+
+
+@pytest.mark.asyncio
+async def test_replay_requeues_delivery_once():
+    """Test replaying a failed delivery requeues it, and a replayed dead letter isn't replayed again."""
+    service, _, webhooks, _ = _service(_delivery("x1"))
+
+    replayed = await service.replay("x1")
+
+    assert replayed.status == "replayed"
+    assert replayed.replay_result == {"delivery_id": "d1"}
+    assert webhooks.requeued == ["d1"]
+    with pytest.raises(FailedPreconditionError, match="dead_letter x1 already replayed"):
+        await service.replay("x1")
+
+
+@pytest.mark.asyncio
+async def test_replay_starts_new_migration():
+    """Test replaying a failed migration starts one with the same transform and batch size."""
+    failed = DeadLetter(
+        id="x1", kind=DEAD_LETTER_NODE_MIGRATION, source_id="m1",
+        payload={"node_type_id": "t1", "transform": '[{"op": "drop", "field": "a"}]', "batch_size": 50},
+    )
+    service, _, _, migrations = _service(failed)
+
+    replayed = await service.replay("x1")
+
+    assert replayed.replay_result == {"node_migration_id": "m2"}
+    assert migrations.started == [("t1", '[{"op": "drop", "field": "a"}]', 50)]
+
+
+@pytest.mark.asyncio
+async def test_failed_replay_leaves_dead_letter_dead():
+    """Test a replay that can't be started puts the dead letter back with the reason."""
+    service, repo, _, _ = _service(_delivery("x1", source_id="gone"))
+
+    with pytest.raises(FailedPreconditionError, match="webhook endpoint was deleted"):
+        await service.replay("x1")
+
+    assert repo.dead_letters["x1"].status == "dead"
+    assert repo.dead_letters["x1"].error == "replay failed: the webhook endpoint was deleted"
+
+
+@pytest.mark.asyncio
+async def test_replay_many_and_discard():
+    """Test bulk replays report each dead letter that wasn't replayed, and discarding."""
+    service, _, webhooks, _ = _service(_delivery("x1"), _delivery("x2"), _delivery("x3"), delivery_ids=("d1",))
+    await service.discard("x3")
+
+    replayed, errors = await service.replay_many(["x1", "x3", "x9"])
+
+    assert [d.id for d in replayed] == ["x1"]
+    assert errors == [
+        {"id": "x3", "error": "dead_letter x3 already discarded"},
+        {"id": "x9", "error": "dead_letter not found: x9"},
+    ]
+
+    replayed, errors = await service.replay_many(kind=DEAD_LETTER_WEBHOOK_DELIVERY)
+    assert [d.id for d in replayed] == ["x2"]
+    assert webhooks.requeued == ["d1", "d1"]
+    with pytest.raises(ValueError, match="kind must be one of"):
+        await service.list("jobs", "", 10, "")
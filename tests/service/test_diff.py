@@ -0,0 +1,30 @@
+"""
+Tests for node data diffs.
+"""
+
+from app.service.diff import diff_data
+
+
+def test_diff_data():
+    """Test fields are diffed by dot-separated path, descending into objects but not arrays."""
+    before = '{"title": "a", "nickname": "Al", "address": {"city": "Bonn"}, "tags": ["x"], "count": 1}'
+    after = '{"title": "a", "address": {"city": "Berlin", "zip": "10115"}, "tags": ["x", "y"], "count": 1}'
+
+    assert diff_data(before, after) == {
+        "added": [{"path": "address.zip", "value": "10115"}],
+        "removed": [{"path": "nickname", "value": "Al"}],
+        "changed": [
+            {"path": "address.city", "from": "Bonn", "to": "Berlin"},
+            {"path": "tags", "from": ["x"], "to": ["x", "y"]},
+        ],
+    }
+
+
+def test_diff_data_types():
+    """Test values of different JSON types differ even if Python compares them equal."""
+    assert diff_data('{"a": 1, "b": true}', '{"a": 1.0, "b": 1}')["changed"] == [
+        {"path": "a", "from": 1, "to": 1.0},
+        {"path": "b", "from": True, "to": 1},
+    ]
+    assert diff_data('{"a": {"b": 1}}', '{"a": 2}')["changed"] == [{"path": "a", "from": {"b": 1}, "to": 2}]
+    assert diff_data("{}", "{}") == {"added": [], "removed": [], "changed": []}
@@ -0,0 +1,58 @@
+"""
+Tests for NodeType display metadata validation.
+"""
+
+import pytest
+
+from app.service.display import default_sort, validate_display
+
+SCHEMA = '{"title": "string", "author": "string", "published_at": "string"}'
+
+
+def test_validate_display():
+    """Test a complete display document is accepted."""
+    display = """{
+        "label": "Blog Article",
+        "display_name_template": "{title} by {author}",
+        "default_sort": {"field": "published_at", "direction": "desc"},
+        "column_order": ["title", "author", "created_at"],
+        "field_labels": {"published_at": "Published"}
+    }"""
+
+    validate_display(display, SCHEMA)
+
+
+def test_validate_display_unknown_fields():
+    """Test display references must name declared fields."""
+    with pytest.raises(ValueError, match="display_name_template references unknown field: subtitle"):
+        validate_display('{"display_name_template": "{subtitle}"}', SCHEMA)
+    with pytest.raises(ValueError, match="column_order references unknown field: body"):
+        validate_display('{"column_order": ["title", "body"]}', SCHEMA)
+    with pytest.raises(ValueError, match="default_sort references unknown field: id"):
+        validate_display('{"default_sort": {"field": "id"}}', SCHEMA)
+
+    # Free-form schemas allow any field
+    validate_display('{"column_order": ["anything"]}', "")
+
+
+def test_validate_display_invalid_shape():
+    """Test malformed display documents are rejected."""
+    with pytest.raises(ValueError, match="must be a JSON object"):
+        validate_display("[]", SCHEMA)
+    with pytest.raises(ValueError, match="display.colors is not supported"):
+        validate_display('{"colors": {}}', SCHEMA)
+    with pytest.raises(ValueError, match="direction must be one of"):
+        validate_display('{"default_sort": {"field": "title", "direction": "up"}}', SCHEMA)
+    with pytest.raises(ValueError, match="must not contain duplicates"):
+        validate_display('{"column_order": ["title", "title"]}', SCHEMA)
+
+
+def test_default_sort():
+    """Test the default sort order is read from display metadata."""
+    sort = default_sort('{"default_sort": {"field": "title", "direction": "desc"}}')
+
+    assert sort.field == "title"
+    assert sort.descending
+
+    assert not default_sort('{"default_sort": {"field": "title"}}').descending
+    assert default_sort("{}") is None
@@ -0,0 +1,83 @@
+"""
+Tests for the encryption of sensitive node data fields.
+
+These run on the in-memory repositories with a local KMS.
+"""
+
+import json
+import os
+
+import pytest
+
+from app.encryption import LocalKms
+from app.repository import (
+    FailedPreconditionError,
+    InMemoryDataKeyRepository,
+    InMemoryNodeRepository,
+    InMemoryNodeTypeRepository,
+    InMemoryStore,
+)
+from app.service import NodeService, NodeTypeService
+from app.service.encryption import FieldEncryption
+from app.service.schema import normalize_unique_keys, validate_schema
+
+SCHEMA = '{"name": "string", "ssn": {"type": "string", "sensitive": true}, "salary": {"type": "number", "sensitive": true}}'
+
+
+def _services(store, kms, tenant_id):
+    encryption = FieldEncryption(kms, InMemoryDataKeyRepository(store), tenant_id)
+    node_types = InMemoryNodeTypeRepository(store)
+    return NodeTypeService(node_types), NodeService(InMemoryNodeRepository(store), node_types, encryption)
+
+
+@pytest.mark.asyncio
+async def test_sensitive_fields_are_stored_encrypted():
+    """Test sensitive values are ciphertext in storage and events, and plaintext to readers."""
+    store = InMemoryStore()
+    node_types, nodes = _services(store, LocalKms(os.urandom(32)), "tenant-a")
+    node_type = await node_types.create("Employee", "", SCHEMA)
+
+    node = await nodes.create(node_type.id, '{"name": "Ada", "ssn": "123-45-6789", "salary": 100}')
+    assert json.loads(node.data) == {"name": "Ada", "ssn": "123-45-6789", "salary": 100}
+
+    stored = json.loads(store.nodes[node.id].data)
+    assert stored["name"] == "Ada"
+    assert stored["ssn"].startswith("enc:1:") and stored["salary"].startswith("enc:1:")
+    assert "123-45-6789" not in store.events[-1].payload
+    assert len(store.data_keys) == 1
+
+    assert json.loads((await nodes.get_by_id(node.id)).data)["ssn"] == "123-45-6789"
+    await nodes.update(node.id, '{"name": "Ada", "ssn": "987-65-4321", "salary": 120}')
+    listed, _ = await nodes.list(node_type.id, 10, "")
+    assert json.loads(listed[0].data) == {"name": "Ada", "ssn": "987-65-4321", "salary": 120}
+    revisions, _ = await nodes.list_revisions(node.id, 10, "")
+    assert sorted(json.loads(r.data)["salary"] for r in revisions) == [100, 120]
+
+
+@pytest.mark.asyncio
+async def test_data_keys_are_bound_to_tenant_and_kms():
+    """Test another tenant's KEK or a missing KMS can't decrypt a tenant's values."""
+    store = InMemoryStore()
+    kms = LocalKms(os.urandom(32))
+    node_types, nodes = _services(store, kms, "tenant-b")
+    node_type = await node_types.create("Employee", "", SCHEMA)
+    node = await nodes.create(node_type.id, '{"ssn": "123-45-6789"}')
+
+    _, other_tenant = _services(store, kms, "tenant-c")
+    with pytest.raises(ValueError, match="does not unwrap"):
+        await other_tenant.get_by_id(node.id)
+
+    _, no_kms = _services(store, None, "tenant-d")
+    with pytest.raises(FailedPreconditionError, match="sensitive fields require a KMS"):
+        await no_kms.create(node_type.id, '{"ssn": "123-45-6789"}')
+    # Nodes without sensitive values need no KMS
+    await no_kms.create(node_type.id, '{"name": "Bob"}')
+
+
+def test_sensitive_schema_fields():
+    """Test sensitive must be a boolean and sensitive fields can't be keys or indexed."""
+    validate_schema(SCHEMA)
+    with pytest.raises(ValueError, match="schema.ssn.sensitive must be a boolean"):
+        validate_schema('{"ssn": {"type": "string", "sensitive": "yes"}}')
+    with pytest.raises(ValueError, match=r"unique_keys\[0\] field is sensitive: ssn"):
+        normalize_unique_keys(["ssn"], SCHEMA)
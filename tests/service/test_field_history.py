@@ -0,0 +1,41 @@
+"""
+Tests for field histories.
+"""
+
+from app.repository import NodeRevision
+from app.service.field_history import field_changes
+
+
+def _revisions(*data):
+    return [
+        NodeRevision(id=str(i), version=i, op="updated", data=d, actor=f"api_key:{i}")
+        for i, d in enumerate(data, start=1)
+    ]
+
+
+def test_field_changes():
+    """Test revisions changing the value at a path are changes, newest first."""
+    revisions = _revisions(
+        '{"title": "a"}',
+        '{"title": "a", "address": {"city": "Bonn"}}',
+        '{"title": "b", "address": {"city": "Bonn"}}',
+        '{"title": "b", "address": {"city": "Berlin"}}',
+        '{"title": "b"}',
+    )
+
+    changes = field_changes(revisions, ["address", "city"])
+    assert [(c.revision.id, c.change, c.previous_value, c.value) for c in changes] == [
+        ("5", "removed", "Berlin", None),
+        ("4", "changed", "Bonn", "Berlin"),
+        ("2", "added", None, "Bonn"),
+    ]
+    assert changes[0].to_dict()["actor"] == "api_key:5"
+    assert [c.revision.id for c in field_changes(revisions, ["title"])] == ["3", "1"]
+    assert field_changes(revisions, ["missing"]) == []
+
+
+def test_field_changes_compare_json():
+    """Test values are compared as JSON, including nested values."""
+    revisions = _revisions('{"n": 1, "o": {"b": 1, "a": 2}}', '{"n": 1.0, "o": {"a": 2, "b": 1}}')
+    assert [c.value for c in field_changes(revisions, ["n"])] == [1.0, 1]
+    assert len(field_changes(revisions, ["o"])) == 1
@@ -0,0 +1,55 @@
+"""
+Tests for field masks.
+"""
+
+import json
+
+import pytest
+
+from app.repository import Node
+from app.service.field_mask import parse_field_mask, project_data
+
+NODE_FIELDS = list(Node().to_dict())
+
+
+def test_parse_field_mask():
+    """Test masks always include the id and reach the top-level data fields of their paths."""
+    assert parse_field_mask(None, NODE_FIELDS) is None
+    assert parse_field_mask([], NODE_FIELDS) is None
+
+    mask = parse_field_mask(["version", "data.address.city", "data.title"], NODE_FIELDS)
+    assert mask.fields == {"id", "version", "data"}
+    assert mask.data_fields() == ["address", "title"]
+
+    assert parse_field_mask(["data", "data.title"], NODE_FIELDS).data_fields() is None
+    assert parse_field_mask(["updated_at"], NODE_FIELDS).data_fields() == []
+
+    with pytest.raises(ValueError, match="unknown field 'title'"):
+        parse_field_mask(["title"], NODE_FIELDS)
+    with pytest.raises(ValueError, match="version has no subfields"):
+        parse_field_mask(["version.major"], NODE_FIELDS)
+    with pytest.raises(ValueError, match="array of field paths"):
+        parse_field_mask("data", NODE_FIELDS)
+
+
+def test_apply_field_mask():
+    """Test applying a mask keeps only the listed fields and data paths."""
+    node = Node(
+        id="n1", node_type_id="t1", version=3,
+        data='{"title": "Hello", "address": {"city": "Paris", "zip": "75001"}, "body": "..."}',
+    ).to_dict()
+
+    masked = parse_field_mask(["version", "data.address.city", "data.missing"], NODE_FIELDS).apply(node)
+    assert set(masked) == {"id", "version", "data"}
+    assert json.loads(masked["data"]) == {"address": {"city": "Paris"}}
+
+    assert parse_field_mask(["data"], NODE_FIELDS).apply(node)["data"] == node["data"]
+    assert parse_field_mask(["version"], NODE_FIELDS).apply(node) == {"id": "n1", "version": 3}
+
+
+def test_project_data():
+    """Test projecting data keeps the nesting of paths and skips paths through non-objects."""
+    data = '{"a": {"b": 1, "c": 2}, "d": [1, 2], "e": null}'
+    assert json.loads(project_data(data, [["a", "b"], ["d"], ["e"]])) == {"a": {"b": 1}, "d": [1, 2], "e": None}
+    assert json.loads(project_data(data, [["d", "0"]])) == {}
+    assert json.loads(project_data("", [["a"]])) == {}
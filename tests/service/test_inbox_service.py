@@ -0,0 +1,77 @@
+"""
+Tests for EmailInboxService.
+"""
+
+import json
+
+import pytest
+
+from app.intake import InboundAttachment, InboundEmail
+
+TICKET_SCHEMA = '{"requester": {"type": "string", "required": true}, "title": "string", "body": "string", "files": "array"}'
+
+
+@pytest.mark.asyncio
+async def test_create_email_inbox_validates_mapping(inbox_service, nodetype_service):
+    """Test field mappings must use known email parts and declared fields."""
+    node_type = await nodetype_service.create("Ticket", "", TICKET_SCHEMA)
+
+    inbox = await inbox_service.create(node_type.id, "Support", {"from": "requester", "subject": "title"})
+    assert inbox.token
+    assert inbox.field_mapping == {"from": "requester", "subject": "title"}
+
+    with pytest.raises(ValueError, match="not an email part"):
+        await inbox_service.create(node_type.id, "Support", {"sender": "requester"})
+    with pytest.raises(ValueError, match="unknown field: summary"):
+        await inbox_service.create(node_type.id, "Support", {"from": "requester", "subject": "summary"})
+    with pytest.raises(ValueError, match="required field: requester"):
+        await inbox_service.create(node_type.id, "Support", {"subject": "title"})
+
+
+@pytest.mark.asyncio
+async def test_ingest_creates_node_with_attachments(inbox_service, nodetype_service, node_service):
+    """Test an email becomes a node with mapped fields and stored attachments."""
+    node_type = await nodetype_service.create("Ticket", "", TICKET_SCHEMA)
+    inbox = await inbox_service.create(
+        node_type.id, "Support",
+        {"from": "requester", "subject": "title", "text": "body", "attachments": "files"}
+    )
+    email = InboundEmail(
+        from_address="jane@example.com",
+        subject="Printer broken",
+        text="It is on fire.",
+        message_id="<abc@example.com>",
+        attachments=[InboundAttachment(filename="fire.png", content_type="image/png", content=b"png-bytes")],
+    )
+
+    node, duplicate = await inbox_service.ingest(inbox, email)
+    assert duplicate is False
+
+    data = json.loads((await node_service.get_by_id(node.id)).data)
+    assert data["requester"] == "jane@example.com"
+    assert data["title"] == "Printer broken"
+    assert data["body"] == "It is on fire."
+    assert data["files"][0]["filename"] == "fire.png"
+
+    attachments = await inbox_service.list_attachments(node.id)
+    assert [a.filename for a in attachments] == ["fire.png"]
+    assert attachments[0].id == data["files"][0]["id"]
+    stored = await inbox_service.get_attachment(attachments[0].id)
+    assert stored.content == b"png-bytes"
+    assert stored.size_bytes == len(b"png-bytes")
+
+
+@pytest.mark.asyncio
+async def test_ingest_deduplicates_by_message_id(inbox_service, nodetype_service, node_service):
+    """Test provider redeliveries of the same message do not create another node."""
+    node_type = await nodetype_service.create("Ticket", "", "{}")
+    inbox = await inbox_service.create(node_type.id, "Support", None)
+    email = InboundEmail(from_address="jane@example.com", subject="Hi", message_id="<dup@example.com>")
+
+    first, _ = await inbox_service.ingest(inbox, email)
+    second, duplicate = await inbox_service.ingest(inbox, email)
+
+    assert duplicate is True
+    assert second.id == first.id
+    nodes, _ = await node_service.list(node_type.id, page_size=10, page_token="")
+    assert len(nodes) == 1
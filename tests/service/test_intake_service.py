@@ -0,0 +1,75 @@
+"""
+Tests for IntakeFormService.
+"""
+
+import json
+
+import pytest
+
+from app.repository.errors import NotFoundError
+
+
+@pytest.mark.asyncio
+async def test_create_intake_form(intake_service, nodetype_service):
+    """Test creating an intake form generates a public token."""
+    node_type = await nodetype_service.create("Ticket", "", '{"email": {"type": "string", "required": true}, "subject": "string"}')
+
+    form = await intake_service.create(node_type.id, "Contact us", ["email", "subject"], True, 5)
+
+    assert form.id
+    assert len(form.token) >= 32
+    assert form.fields == ["email", "subject"]
+    assert form.require_captcha is True
+    assert form.rate_limit_per_minute == 5
+
+    fetched = await intake_service.get_active_by_token(form.token)
+    assert fetched.id == form.id
+
+
+@pytest.mark.asyncio
+async def test_create_intake_form_validation(intake_service, nodetype_service):
+    """Test form fields must match the node type schema."""
+    node_type = await nodetype_service.create("Ticket", "", '{"email": {"type": "string", "required": true}, "subject": "string"}')
+
+    with pytest.raises(ValueError, match="unknown field: phone"):
+        await intake_service.create(node_type.id, "Contact us", ["email", "phone"], False)
+    with pytest.raises(ValueError, match="required field: email"):
+        await intake_service.create(node_type.id, "Contact us", ["subject"], False)
+    with pytest.raises(ValueError, match="rate_limit_per_minute"):
+        await intake_service.create(node_type.id, "Contact us", [], False, 0)
+    with pytest.raises(NotFoundError):
+        await intake_service.create("00000000-0000-0000-0000-000000000000", "Contact us", [], False)
+
+
+@pytest.mark.asyncio
+async def test_submit_creates_node(intake_service, nodetype_service, node_service):
+    """Test a submission creates a validated node and rejects fields outside the form."""
+    schema = '{"email": {"type": "string", "required": true}, "priority": "integer", "location": "geo_point"}'
+    node_type = await nodetype_service.create("Ticket", "", schema)
+    form = await intake_service.create(node_type.id, "Contact us", ["email", "priority", "location"], False)
+
+    node = await intake_service.submit(form, {"email": "a@example.com", "priority": "2"}, url_encoded=True)
+    stored = await node_service.get_by_id(node.id)
+    assert stored.node_type_id == node_type.id
+    assert json.loads(stored.data) == {"email": "a@example.com", "priority": 2}
+
+    with pytest.raises(ValueError, match="not accepted by this form"):
+        await intake_service.submit(form, {"email": "a@example.com", "admin": True})
+    with pytest.raises(ValueError, match="data.location"):
+        await intake_service.submit(form, {"email": "a@example.com", "location": "here"})
+
+
+@pytest.mark.asyncio
+async def test_disable_and_rotate_token(intake_service, nodetype_service):
+    """Test disabled forms and rotated tokens are no longer reachable."""
+    node_type = await nodetype_service.create("Ticket", "", "{}")
+    form = await intake_service.create(node_type.id, "Contact us", [], False)
+
+    rotated = await intake_service.update(form.id, "", None, None, 0, "", rotate_token=True)
+    assert rotated.token != form.token
+    with pytest.raises(NotFoundError):
+        await intake_service.get_active_by_token(form.token)
+
+    await intake_service.update(form.id, "", None, None, 0, "disabled")
+    with pytest.raises(NotFoundError):
+        await intake_service.get_active_by_token(rotated.token)
@@ -0,0 +1,39 @@
+"""
+Tests for localized field resolution.
+"""
+
+import json
+
+import pytest
+
+from app.service.localization import localize_data, parse_locales, resolve_locale
+
+
+def test_parse_locales():
+    """Test parsing a preferred locale list."""
+    assert parse_locales("") == []
+    assert parse_locales("fr-CA, fr ,en") == ["fr-CA", "fr", "en"]
+
+    with pytest.raises(ValueError, match="invalid locale tag"):
+        parse_locales("fr;q=0.9")
+
+
+def test_resolve_locale_fallbacks():
+    """Test preferred locales fall back to base language, default locale, then any value."""
+    values = {"en": "Hello", "fr": "Bonjour", "de": "Hallo"}
+
+    assert resolve_locale(values, ["fr-CA", "en"]) == "Bonjour"
+    assert resolve_locale(values, ["EN"]) == "Hello"
+    assert resolve_locale(values, ["es"], default_locale="en") == "Hello"
+    assert resolve_locale(values, ["es"]) == "Hallo"
+    assert resolve_locale({}, ["en"]) is None
+
+
+def test_localize_data():
+    """Test only localized_string fields are resolved."""
+    schema = '{"title": {"type": "localized_string", "default_locale": "en"}, "code": "string"}'
+    data = '{"title": {"en": "Hello", "fr": "Bonjour"}, "code": "greeting"}'
+
+    assert json.loads(localize_data(schema, data, ["fr"])) == {"title": "Bonjour", "code": "greeting"}
+    assert localize_data(schema, data, []) == data
+    assert localize_data('{"code": "string"}', data, ["fr"]) == data
@@ -0,0 +1,104 @@
+"""
+Tests for NodeLockService.
+"""
+
+import pytest
+
+from app.repository.errors import NodeLockedError, NotFoundError, error_details
+from app.service import NodeService
+
+
+async def _expire(node_lock_service, node_id):
+    async with node_lock_service.repo.db.pool.acquire() as conn:
+        await conn.execute("UPDATE node_locks SET expires_at = NOW() - INTERVAL '1 second' WHERE node_id = $1", node_id)
+
+
+@pytest.mark.asyncio
+async def test_acquire_renew_and_release_lock(node_lock_service, node_service, nodetype_service):
+    """Test a lock excludes other holders until released, and its token renews it."""
+    node_type = await nodetype_service.create("Doc", "", '{}')
+    node = await node_service.create(node_type.id, '{}')
+
+    lock = await node_lock_service.acquire(node.id, "alice", ttl_seconds=30)
+    assert lock.holder == "alice" and lock.token
+    assert "token" not in lock.to_dict()
+    assert (await node_lock_service.get(node.id)).holder == "alice"
+
+    with pytest.raises(NodeLockedError) as e:
+        await node_lock_service.acquire(node.id, "bob")
+    assert e.value.holder == "alice"
+    assert error_details(e.value)[0]["metadata"]["holder"] == "alice"
+
+    renewed = await node_lock_service.acquire(node.id, "alice", ttl_seconds=600, lock_token=lock.token)
+    assert renewed.token == lock.token
+    assert renewed.acquired_at == lock.acquired_at
+    assert renewed.expires_at > lock.expires_at
+
+    assert await node_lock_service.release(node.id, "not-the-token") is False
+    assert await node_lock_service.release(node.id, lock.token) is True
+    assert await node_lock_service.get(node.id) is None
+    assert (await node_lock_service.acquire(node.id, "bob")).holder == "bob"
+
+
+@pytest.mark.asyncio
+async def test_expired_locks_can_be_taken_over(node_lock_service, node_service, nodetype_service):
+    """Test an expired lock is gone, and another holder can acquire it."""
+    node_type = await nodetype_service.create("Doc", "", '{}')
+    node = await node_service.create(node_type.id, '{}')
+
+    lock = await node_lock_service.acquire(node.id, "alice")
+    await _expire(node_lock_service, node.id)
+    assert await node_lock_service.get(node.id) is None
+
+    taken = await node_lock_service.acquire(node.id, "bob")
+    assert taken.holder == "bob" and taken.token != lock.token
+    with pytest.raises(NotFoundError):
+        await node_lock_service.acquire("00000000-0000-0000-0000-000000000000", "alice")
+    with pytest.raises(ValueError, match="ttl_seconds"):
+        await node_lock_service.acquire(node.id, "alice", ttl_seconds=0)
+
+
+@pytest.mark.asyncio
+async def test_node_updates_check_locks(node_lock_service, node_repo, nodetype_repo, nodetype_service):
+    """Test updates need the lock token if given or the lock is enforced, and deletes likewise."""
+    node_svc = NodeService(node_repo, nodetype_repo, locks=node_lock_service)
+    node_type = await nodetype_service.create("Doc", "", '{}')
+    node = await node_svc.create(node_type.id, '{"v": 1}')
+
+    advisory = await node_lock_service.acquire(node.id, "alice")
+    await node_svc.update(node.id, '{"v": 2}')
+    await node_svc.update(node.id, '{"v": 3}', lock_token=advisory.token)
+    with pytest.raises(NodeLockedError):
+        await node_svc.update(node.id, '{"v": 4}', lock_token="stale-token")
+    await node_lock_service.release(node.id, advisory.token)
+    with pytest.raises(NodeLockedError, match="expired or was released"):
+        await node_svc.update(node.id, '{"v": 4}', lock_token=advisory.token)
+
+    enforced = await node_lock_service.acquire(node.id, "alice", enforce=True)
+    with pytest.raises(NodeLockedError):
+        await node_svc.update(node.id, '{"v": 4}')
+    with pytest.raises(NodeLockedError):
+        await node_svc.delete(node.id)
+    assert (await node_svc.update(node.id, '{"v": 4}', lock_token=enforced.token)).version == 4
+    await node_svc.delete(node.id, lock_token=enforced.token)
+
+
+@pytest.mark.asyncio
+async def test_bulk_deletes_check_enforced_locks(node_lock_service, node_service, nodetype_service):
+    """Test bulk deletes fail while one of their nodes has an enforced lock, and ignore advisory locks."""
+    node_type = await nodetype_service.create("Doc", "", '{}')
+    locked = await node_service.create(node_type.id, '{"v": 1}')
+    other = await node_service.create(node_type.id, '{"v": 2}')
+
+    lock = await node_lock_service.acquire(locked.id, "alice", enforce=True)
+    with pytest.raises(NodeLockedError) as e:
+        await node_service.delete_many(node_type.id, None, dry_run=True)
+    assert e.value.holder == "alice"
+    with pytest.raises(NodeLockedError):
+        await node_service.delete_many(node_type.id, None)
+    assert len((await node_service.batch_get([locked.id, other.id]))[0]) == 2
+    assert await node_service.delete_many(node_type.id, '{"v": 2}') == 1
+
+    await node_lock_service.release(locked.id, lock.token)
+    await node_lock_service.acquire(locked.id, "alice")
+    assert await node_service.delete_many(node_type.id, None) == 1
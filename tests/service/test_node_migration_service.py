@@ -0,0 +1,127 @@
+"""
+Tests for NodeMigrationService, using the in-memory repositories.
+"""
+
+import json
+
+import pytest
+
+from app.repository import (
+    InMemoryNodeRepository,
+    InMemoryNodeTypeRepository,
+    InMemoryStore,
+    NodeMigration,
+)
+from app.service import NodeMigrationService, NodeService, NodeTypeService
+
+
+@pytest.fixture
+def store():
+    return InMemoryStore()
+
+
+@pytest.fixture
+def nodetype_service(store):
+    return NodeTypeService(InMemoryNodeTypeRepository(store))
+
+
+@pytest.fixture
+def node_service(store):
+    return NodeService(InMemoryNodeRepository(store), InMemoryNodeTypeRepository(store))
+
+
+@pytest.fixture
+def migration_service(store):
+    # run_batch and validate_existing don't use the migration job repository
+    return NodeMigrationService(None, InMemoryNodeTypeRepository(store), InMemoryNodeRepository(store))
+
+
+@pytest.mark.asyncio
+async def test_schema_version_tracks_schema_changes(nodetype_service, node_service):
+    """Test the schema version only changes with the schema and is stamped on written nodes."""
+    node_type = await nodetype_service.create("Task", "", '{"title": "string"}')
+    node = await node_service.create(node_type.id, '{"title": "Write"}')
+    assert (node_type.schema_version, node.schema_version) == (1, 1)
+
+    renamed = await nodetype_service.update(node_type.id, "Todo", "", "")
+    assert renamed.schema_version == 1
+    same = await nodetype_service.update(node_type.id, "", "", '{ "title" : "string" }')
+    assert same.schema_version == 1
+    changed = await nodetype_service.update(node_type.id, "", "", '{"name": "string"}')
+    assert changed.schema_version == 2
+
+    untouched = await node_service.update(node.id, "")
+    assert untouched.schema_version == 1
+    rewritten = await node_service.update(node.id, '{"name": "Write"}')
+    assert rewritten.schema_version == 2
+
+
+@pytest.mark.asyncio
+async def test_validate_existing_nodes(nodetype_service, node_service, migration_service):
+    """Test a dry run reports nodes invalid under a candidate schema, with and without a transform."""
+    node_type = await nodetype_service.create("Task", "", '{"title": "string", "points": "string"}')
+    await node_service.create(node_type.id, '{"title": "A", "points": "3"}')
+    await node_service.create(node_type.id, '{"title": "B"}')
+    candidate = '{"name": "string", "points": "integer", "site": {"type": "geo_point", "required": true}}'
+
+    report = await migration_service.validate_existing(node_type.id, candidate)
+    assert (report.checked, report.invalid_count, report.outdated_count) == (2, 2, 0)
+    assert report.errors[0]["error"] == "data.site is required"
+
+    transform = json.dumps([
+        {"op": "rename", "from": "title", "to": "name"},
+        {"op": "convert", "field": "points", "to": "integer"},
+        {"op": "default", "field": "site", "value": {"lat": 52.52, "lng": 13.405}},
+    ])
+    report = await migration_service.validate_existing(node_type.id, candidate, transform)
+    assert (report.checked, report.invalid_count) == (2, 0)
+
+    # The current schema is used by default; the stored nodes are unchanged
+    report = await migration_service.validate_existing(node_type.id)
+    assert report.invalid_count == 0
+
+
+@pytest.mark.asyncio
+async def test_run_batch_migrates_outdated_nodes(store, nodetype_service, node_service, migration_service):
+    """Test a migration rewrites outdated nodes in batches and records nodes it cannot migrate."""
+    node_type = await nodetype_service.create("Task", "", '{"title": "string"}')
+    for title, points in (("A", "1"), ("B", "x"), ("C", 2)):
+        await node_service.create(node_type.id, json.dumps({"title": title, "points": points}))
+    schema = '{"name": {"type": "string", "required": true}, "points": "integer"}'
+    node_type = await nodetype_service.update(node_type.id, "", "", schema)
+    assert (await migration_service.validate_existing(node_type.id)).outdated_count == 3
+
+    migration = NodeMigration(
+        node_type_id=node_type.id,
+        target_schema_version=node_type.schema_version,
+        transform=json.dumps([
+            {"op": "rename", "from": "title", "to": "name"},
+            {"op": "convert", "field": "points", "to": "integer"},
+        ]),
+        status="running",
+        batch_size=2,
+    )
+    await migration_service.run_batch(migration)
+    assert migration.status == "running"
+    await migration_service.run_batch(migration)
+    assert migration.status == "succeeded"
+
+    assert (migration.migrated_count, migration.failed_count) == (2, 1)
+    assert migration.failures[0]["error"] == "data.points cannot be converted to integer"
+    nodes = sorted(store.nodes.values(), key=lambda n: json.loads(n.data).get("name") or "")
+    assert [json.loads(n.data) for n in nodes[1:]] == [{"name": "A", "points": 1}, {"name": "C", "points": 2}]
+    assert [n.schema_version for n in nodes] == [1, 2, 2]
+    assert (await migration_service.validate_existing(node_type.id)).outdated_count == 1
+
+
+@pytest.mark.asyncio
+async def test_run_batch_fails_when_schema_changed_again(nodetype_service, migration_service):
+    """Test a migration stops when the node type's schema moved past its target version."""
+    node_type = await nodetype_service.create("Task", "", '{"title": "string"}')
+    await nodetype_service.update(node_type.id, "", "", '{"name": "string"}')
+
+    migration = NodeMigration(node_type_id=node_type.id, target_schema_version=1, status="running")
+    await migration_service.run_batch(migration)
+
+    assert migration.status == "failed"
+    assert "schema changed to version 2" in migration.error
@@ -2,9 +2,11 @@
 Tests for NodeService.
 """
 
+import json
+
 import pytest
 
-from app.repository.errors import NotFoundError
+from app.repository.errors import ConflictError, NotFoundError
 
 
 @pytest.mark.asyncio
@@ -48,6 +50,23 @@ async def test_get_node_by_id(node_service, nodetype_service):
     assert retrieved.node_type_id == created.node_type_id
 
 
+@pytest.mark.asyncio
+async def test_batch_get_nodes(node_service, nodetype_service):
+    """Test batch gets return the nodes found in request order and list the missing and malformed IDs."""
+    node_type = await nodetype_service.create("Article", "Blog article", '{}')
+    first = await node_service.create(node_type.id, '{"title": "a", "body": "x"}')
+    second = await node_service.create(node_type.id, '{"title": "b"}')
+    missing = "00000000-0000-0000-0000-000000000000"
+
+    nodes, absent = await node_service.batch_get([second.id, missing, first.id, "bad"], data_fields=["title"])
+
+    assert [(n.id, json.loads(n.data)) for n in nodes] == [(second.id, {"title": "b"}), (first.id, {"title": "a"})]
+    assert absent == [missing, "bad"]
+
+    node_types, absent = await nodetype_service.batch_get([node_type.id, missing])
+    assert ([t.id for t in node_types], absent) == ([node_type.id], [missing])
+
+
 @pytest.mark.asyncio
 async def test_update_node(node_service, nodetype_service):
     """Test updating a node."""
@@ -60,6 +79,46 @@ async def test_update_node(node_service, nodetype_service):
     assert updated.data == updated_data
 
 
+@pytest.mark.asyncio
+async def test_update_node_expected_version(node_service, nodetype_service):
+    """Test that a stale expected_version is rejected and a missing node is still NotFound."""
+    import uuid
+
+    node_type = await nodetype_service.create("Article", "Blog article", '{}')
+    created = await node_service.create(node_type.id, '{"title": "Original"}')
+
+    first = await node_service.update(created.id, '{"title": "First"}', expected_version=created.version)
+    assert first.version == created.version + 1
+
+    with pytest.raises(ConflictError):
+        await node_service.update(created.id, '{"title": "Second"}', expected_version=created.version)
+    with pytest.raises(NotFoundError):
+        await node_service.update(str(uuid.uuid4()), '{}', expected_version=1)
+    with pytest.raises(ValueError, match="expected_version"):
+        await node_service.update(created.id, '{}', expected_version=0)
+
+
+@pytest.mark.asyncio
+async def test_node_if_match(node_service, nodetype_service):
+    """Test that updates and deletes with a stale etag fail and leave the node alone."""
+    node_type = await nodetype_service.create("Article", "Blog article", '{}')
+    created = await node_service.create(node_type.id, '{"title": "Original"}')
+    assert created.to_dict()["etag"] == '"1"'
+
+    updated = await node_service.update(created.id, '{"title": "First"}', if_match=created.etag)
+    assert updated.etag == '"2"'
+
+    with pytest.raises(ConflictError):
+        await node_service.update(created.id, '{"title": "Second"}', if_match=created.etag)
+    with pytest.raises(ConflictError):
+        await node_service.delete(created.id, if_match=created.etag)
+    assert (await node_service.get_by_id(created.id)).data == '{"title": "First"}'
+
+    await node_service.delete(created.id, if_match=updated.etag)
+    with pytest.raises(NotFoundError):
+        await node_service.get_by_id(created.id)
+
+
 @pytest.mark.asyncio
 async def test_delete_node(node_service, nodetype_service):
     """Test deleting a node."""
@@ -107,3 +166,236 @@ async def test_list_nodes_filtered_by_type(node_service, nodetype_service):
     assert len(nodes) == 3
     assert all(n.node_type_id == node_type1.id for n in nodes)
 
+
+
+@pytest.mark.asyncio
+async def test_create_node_invalid_geo_point(node_service, nodetype_service):
+    """Test creating a node with an invalid geo_point raises ValueError."""
+    node_type = await nodetype_service.create("Place", "A place", '{"location": "geo_point"}')
+
+    with pytest.raises(ValueError, match="data.location"):
+        await node_service.create(node_type.id, '{"location": {"lat": 120, "lng": 0}}')
+
+
+@pytest.mark.asyncio
+async def test_list_nodes_geo_within_radius(node_service, nodetype_service):
+    """Test listing nodes within a radius, ordered by distance."""
+    node_type = await nodetype_service.create("Place", "A place", '{"location": "geo_point"}')
+
+    berlin = await node_service.create(node_type.id, '{"location": {"lat": 52.5200, "lng": 13.4050}}')
+    potsdam = await node_service.create(node_type.id, '{"location": {"lat": 52.3906, "lng": 13.0645}}')
+    await node_service.create(node_type.id, '{"location": {"lat": 48.8566, "lng": 2.3522}}')
+
+    geo = {
+        "field": "location",
+        "within": {"lat": 52.52, "lng": 13.40, "radius_m": 50000},
+        "order_by_distance": True,
+    }
+    nodes, result = await node_service.list(node_type.id, page_size=10, page_token="", geo=geo)
+
+    assert result.total_count == 2
+    assert [n.id for n in nodes] == [berlin.id, potsdam.id]
+
+
+@pytest.mark.asyncio
+async def test_list_nodes_geo_bounding_box(node_service, nodetype_service):
+    """Test listing nodes inside a bounding box."""
+    node_type = await nodetype_service.create("Place", "A place", '{"location": "geo_point"}')
+
+    paris = await node_service.create(node_type.id, '{"location": {"lat": 48.8566, "lng": 2.3522}}')
+    await node_service.create(node_type.id, '{"location": {"lat": 52.5200, "lng": 13.4050}}')
+
+    geo = {
+        "field": "location",
+        "bbox": {"min_lat": 48.0, "min_lng": 2.0, "max_lat": 49.0, "max_lng": 3.0},
+    }
+    nodes, result = await node_service.list(node_type.id, page_size=10, page_token="", geo=geo)
+
+    assert result.total_count == 1
+    assert nodes[0].id == paris.id
+
+
+@pytest.mark.asyncio
+async def test_list_nodes_geo_requires_query(node_service, nodetype_service):
+    """Test that a geo filter without within or bbox raises ValueError."""
+    node_type = await nodetype_service.create("Place", "A place", '{"location": "geo_point"}')
+
+    with pytest.raises(ValueError, match="geo requires within or bbox"):
+        await node_service.list(node_type.id, page_size=10, page_token="", geo={"field": "location"})
+
+
+@pytest.mark.asyncio
+async def test_get_node_resolves_locale(node_service, nodetype_service):
+    """Test reading a node with preferred locales resolves localized fields."""
+    schema = '{"title": {"type": "localized_string", "default_locale": "en"}}'
+    node_type = await nodetype_service.create("Page", "", schema)
+    created = await node_service.create(node_type.id, '{"title": {"en": "Hello", "fr": "Bonjour"}}')
+
+    stored = await node_service.get_by_id(created.id)
+    assert json.loads(stored.data)["title"] == {"en": "Hello", "fr": "Bonjour"}
+
+    localized = await node_service.get_by_id(created.id, "fr-CA,en")
+    assert json.loads(localized.data)["title"] == "Bonjour"
+
+    nodes, _ = await node_service.list(node_type.id, page_size=10, page_token="", locale="de")
+    assert json.loads(nodes[0].data)["title"] == "Hello"
+
+
+@pytest.mark.asyncio
+async def test_list_nodes_uses_display_default_sort(node_service, nodetype_service):
+    """Test that listing a node type orders by its display default sort."""
+    display = '{"default_sort": {"field": "title", "direction": "asc"}}'
+    node_type = await nodetype_service.create("Article", "", '{"title": "string"}', display)
+
+    for title in ("b", "c", "a"):
+        await node_service.create(node_type.id, f'{{"title": "{title}"}}')
+
+    nodes, _ = await node_service.list(node_type.id, page_size=10, page_token="")
+
+    assert [json.loads(n.data)["title"] for n in nodes] == ["a", "b", "c"]
+
+
+@pytest.mark.asyncio
+async def test_stream_nodes(node_service, nodetype_service):
+    """Test streaming returns every node across cursor batches."""
+    article = await nodetype_service.create("Article", "Blog article", "{}")
+    comment = await nodetype_service.create("Comment", "A comment", "{}")
+
+    for i in range(7):
+        await node_service.create(article.id, f'{{"n": {i}}}')
+    await node_service.create(comment.id, "{}")
+
+    streamed = [node async for node in node_service.stream(article.id, batch_size=3)]
+
+    assert len(streamed) == 7
+    assert all(node.node_type_id == article.id for node in streamed)
+    assert len([node async for node in node_service.stream(None, batch_size=3)]) == 8
+
+
+@pytest.mark.asyncio
+async def test_stream_nodes_invalid_batch_size(node_service):
+    """Test that an out-of-range batch size raises ValueError."""
+    with pytest.raises(ValueError, match="batch_size"):
+        node_service.stream(None, batch_size=0)
+
+
+@pytest.mark.asyncio
+async def test_aggregate_nodes_range(node_service, nodetype_service):
+    """Test range aggregation with a sum metric."""
+    node_type = await nodetype_service.create("Order", "An order", '{"total": "number"}')
+
+    for total in (5, 15, 25, 150):
+        await node_service.create(node_type.id, f'{{"total": {total}}}')
+
+    aggregation = {
+        "kind": "range",
+        "field": "total",
+        "ranges": [{"to": 10}, {"from": 10, "to": 100}, {"from": 100, "key": "large"}],
+        "metric": "sum",
+        "metric_field": "total",
+    }
+    buckets = await node_service.aggregate(node_type.id, aggregation)
+
+    assert [b.key for b in buckets] == ["*-10", "10-100", "large"]
+    assert [b.doc_count for b in buckets] == [1, 2, 1]
+    assert [b.value for b in buckets] == [5, 40, 150]
+
+
+@pytest.mark.asyncio
+async def test_aggregate_nodes_histogram(node_service, nodetype_service):
+    """Test fixed-width histogram aggregation."""
+    node_type = await nodetype_service.create("Order", "An order", '{"total": "number"}')
+
+    for total in (1, 2, 12, 99, 100):
+        await node_service.create(node_type.id, f'{{"total": {total}}}')
+
+    aggregation = {"kind": "histogram", "field": "total", "min": 0, "max": 100, "buckets": 10}
+    buckets = await node_service.aggregate(node_type.id, aggregation)
+
+    assert [(b.from_value, b.doc_count) for b in buckets] == [(0, 2), (10, 1), (90, 1)]
+
+
+@pytest.mark.asyncio
+async def test_aggregate_nodes_date_histogram(node_service, nodetype_service):
+    """Test date histogram aggregation by month."""
+    node_type = await nodetype_service.create("Event", "An event", '{"at": "string"}')
+
+    for at in ("2024-01-05T10:00:00Z", "2024-01-20T10:00:00Z", "2024-03-01T00:00:00Z"):
+        await node_service.create(node_type.id, f'{{"at": "{at}"}}')
+    for at in ("not a date", "2024-02-30", "2024-13-01T99:00"):
+        await node_service.create(node_type.id, f'{{"at": "{at}"}}')
+
+    aggregation = {"kind": "date_histogram", "field": "at", "interval": "month"}
+    buckets = await node_service.aggregate(node_type.id, aggregation)
+
+    assert [b.doc_count for b in buckets] == [2, 1]
+    assert buckets[0].key.startswith("2024-01-01")
+    assert buckets[1].key.startswith("2024-03-01")
+
+
+@pytest.mark.asyncio
+async def test_create_node_decimal_field(node_service, nodetype_service):
+    """Test decimal fields are stored as canonical strings."""
+    schema = '{"amount": {"type": "decimal", "scale": 2}}'
+    node_type = await nodetype_service.create("Invoice", "An invoice", schema)
+
+    node = await node_service.create(node_type.id, '{"amount": "19.9"}')
+    assert json.loads(node.data)["amount"] == "19.90"
+
+    with pytest.raises(ValueError, match="data.amount must have at most 2 decimal places"):
+        await node_service.create(node_type.id, '{"amount": "19.999"}')
+
+
+@pytest.mark.asyncio
+async def test_aggregate_nodes_decimal_sum(node_service, nodetype_service):
+    """Test decimal metrics are summed exactly."""
+    schema = '{"amount": {"type": "decimal", "scale": 2}}'
+    node_type = await nodetype_service.create("Invoice", "An invoice", schema)
+
+    for amount in ("0.10", "0.20", "0.30", "100.00"):
+        await node_service.create(node_type.id, f'{{"amount": "{amount}"}}')
+
+    aggregation = {
+        "kind": "range",
+        "field": "amount",
+        "ranges": [{"to": 1}, {"from": 1}],
+        "metric": "sum",
+        "metric_field": "amount",
+    }
+    buckets = await node_service.aggregate(node_type.id, aggregation)
+
+    assert [b.doc_count for b in buckets] == [3, 1]
+    assert buckets[0].to_dict()["value"] == "0.60"
+    assert buckets[1].to_dict()["value"] == "100.00"
+
+
+@pytest.mark.asyncio
+async def test_aggregate_nodes_terms_and_all(node_service, nodetype_service):
+    """Test grouping by a field's values and aggregating every matching node."""
+    node_type = await nodetype_service.create("Order", "An order", '{"status": "string", "total": "number"}')
+
+    for status, total in (("open", 5), ("open", 15), ("closed", 25), ("void", 1)):
+        await node_service.create(node_type.id, json.dumps({"status": status, "total": total}))
+    await node_service.create(node_type.id, '{"total": 100}')
+
+    aggregation = {"kind": "terms", "field": "status", "size": 2, "metric": "avg", "metric_field": "total"}
+    buckets = await node_service.aggregate(node_type.id, aggregation)
+    assert [(b.key, b.doc_count, b.value) for b in buckets] == [("open", 2, 10), ("closed", 1, 25)]
+
+    aggregation = {"kind": "all", "metric": "sum", "metric_field": "total"}
+    buckets = await node_service.aggregate(node_type.id, aggregation, {"status": "open"})
+    assert [(b.key, b.doc_count, b.value) for b in buckets] == [("all", 2, 20)]
+
+    assert await node_service.count(node_type.id) == 5
+    assert await node_service.count(node_type.id, {"status": "open"}) == 2
+    assert await node_service.count(node_type.id, None, {"status": "void"}) == 1
+
+    with pytest.raises(ValueError, match="aggregation.size"):
+        await node_service.aggregate(node_type.id, {"kind": "terms", "field": "status", "size": 0})
+
+
+@pytest.mark.asyncio
+async def test_aggregate_nodes_invalid_kind(node_service):
+    """Test that an unknown aggregation kind raises ValueError."""
+    with pytest.raises(ValueError, match="aggregation.kind"):
+        await node_service.aggregate(None, {"kind": "cardinality", "field": "status"})
@@ -0,0 +1,131 @@
+"""
+Tests for the node type catalog.
+"""
+
+import pytest
+
+from app.repository import NodeType
+from app.repository.errors import NotFoundError
+from app.service.node_type_catalog import CatalogNodeTypeRepository, NodeTypeCatalog
+from app.service.nodetype_service import NodeTypeService
+from app.service.schema import parse_schema
+
+
+class FakeClock:
+    def __init__(self):
+        self.now = 0.0
+
+    def __call__(self) -> float:
+        return self.now
+
+
+class FakeNodeTypeRepository:
+    """Node type repository counting its queries."""
+
+    def __init__(self):
+        self.node_types = {}
+        self.generation = 1
+        self.queries = []
+
+    async def catalog_generation(self) -> int:
+        self.queries.append("generation")
+        return self.generation
+
+    async def list_all(self):
+        self.queries.append("list_all")
+        return [NodeType(**vars(node_type)) for node_type in self.node_types.values()]
+
+    async def get_by_id(self, id: str) -> NodeType:
+        self.queries.append("get_by_id")
+        if id not in self.node_types:
+            raise NotFoundError(f"node type not found: {id}")
+        return self.node_types[id]
+
+    async def create(self, node_type: NodeType, dry_run: bool = False) -> NodeType:
+        node_type.id = node_type.name
+        if not dry_run:
+            self.node_types[node_type.id] = node_type
+            self.generation += 1
+        return node_type
+
+
+@pytest.mark.asyncio
+async def test_node_types_are_served_until_their_generation_moves():
+    """Test lookups read the generation at most once per refresh interval and reload node types when it moved."""
+    clock = FakeClock()
+    repo = FakeNodeTypeRepository()
+    repo.node_types["task"] = NodeType(id="task", name="task", schema='{"title": "string"}')
+    catalog = NodeTypeCatalog(refresh_interval=1.0, ttl=60.0, clock=clock)
+
+    assert (await catalog.get("t1", repo, "task")).schema == '{"title": "string"}'
+    (await catalog.get("t1", repo, "task")).schema = "modified by a caller"
+    assert repo.queries == ["generation", "list_all"]
+    assert (await catalog.get("t1", repo, "task")).schema == '{"title": "string"}'
+
+    # Unchanged after the refresh interval: one generation check
+    clock.now = 1.5
+    await catalog.get("t1", repo, "task")
+    assert repo.queries == ["generation", "list_all", "generation"]
+
+    # Changed elsewhere: reloaded at the next check
+    repo.node_types["task"] = NodeType(id="task", name="task", schema='{"title": "number"}')
+    repo.generation = 2
+    assert (await catalog.get("t1", repo, "task")).schema == '{"title": "string"}'
+    clock.now = 3.0
+    assert (await catalog.get("t1", repo, "task")).schema == '{"title": "number"}'
+
+    # Node types missing from the catalog are looked up
+    repo.queries.clear()
+    with pytest.raises(NotFoundError):
+        await catalog.get("t1", repo, "missing")
+    assert repo.queries == ["get_by_id"]
+    assert (catalog.hits, catalog.misses) == (6, 1)
+
+
+@pytest.mark.asyncio
+async def test_ttl_and_eviction():
+    """Test catalogs are reloaded after the TTL and the least recently used tenants are evicted."""
+    clock = FakeClock()
+    repo = FakeNodeTypeRepository()
+    repo.node_types["task"] = NodeType(id="task", name="task")
+    catalog = NodeTypeCatalog(refresh_interval=1.0, ttl=10.0, max_tenants=1, clock=clock)
+
+    await catalog.get("t1", repo, "task")
+    clock.now = 11.0
+    await catalog.get("t1", repo, "task")
+    assert repo.queries == ["generation", "list_all", "generation", "list_all"]
+
+    await catalog.get("t2", repo, "task")
+    repo.queries.clear()
+    await catalog.get("t1", repo, "task")
+    assert repo.queries == ["generation", "list_all"]
+
+
+@pytest.mark.asyncio
+async def test_node_type_writes_drop_the_tenant_catalog():
+    """Test node types created through the service are found by node writes at once."""
+    repo = FakeNodeTypeRepository()
+    catalog = NodeTypeCatalog(refresh_interval=60.0)
+    node_types = CatalogNodeTypeRepository(repo, catalog, "t1")
+    service = NodeTypeService(repo, on_change=lambda: catalog.invalidate("t1"))
+
+    await service.create("task", "", '{"title": "string"}')
+    assert (await node_types.get_by_id("task")).name == "task"
+    await service.create("note", "", '{"body": "string"}', dry_run=True)
+    await service.create("project", "", '{"name": "string"}')
+
+    repo.queries.clear()
+    assert (await node_types.get_by_id("project")).name == "project"
+    assert repo.queries == ["generation", "list_all"]
+    # Everything else is the repository's
+    assert await node_types.list_all() == await repo.list_all()
+
+
+def test_schemas_are_parsed_once():
+    """Test parsed schemas are shared, and callers can't change them for each other."""
+    schema = '{"title": {"type": "string", "required": true}}'
+    first = parse_schema(schema)
+    first.pop("title")
+    second = parse_schema(schema)
+    assert second["title"].required
+    assert second["title"] is parse_schema(schema)["title"]
@@ -2,9 +2,11 @@
 Tests for NodeTypeService.
 """
 
+import json
+
 import pytest
 
-from app.repository.errors import NotFoundError
+from app.repository.errors import ConflictError, NotFoundError
 
 
 @pytest.mark.asyncio
@@ -72,6 +74,43 @@ async def test_update_node_type_partial(nodetype_service):
     assert updated.schema == schema  # Unchanged
 
 
+@pytest.mark.asyncio
+async def test_update_node_type_version_conflict(nodetype_service):
+    """Test that updating a node type with a stale expected_version fails."""
+    created = await nodetype_service.create("Article", "Blog article", '{}')
+
+    updated = await nodetype_service.update(created.id, "Post", "", "", expected_version=1)
+    assert updated.version == 2
+
+    with pytest.raises(ConflictError):
+        await nodetype_service.update(created.id, "Page", "", "", expected_version=1)
+
+
+@pytest.mark.asyncio
+async def test_node_type_if_match(nodetype_service):
+    """Test that updates and deletes with a stale etag fail and leave the node type alone."""
+    created = await nodetype_service.create("Article", "Blog article", '{}')
+    assert created.etag == '"1"'
+
+    updated = await nodetype_service.update(created.id, "Post", "", "", if_match=created.etag)
+    assert updated.to_dict()["etag"] == '"2"'
+
+    with pytest.raises(ConflictError):
+        await nodetype_service.update(created.id, "Page", "", "", if_match=created.etag)
+    with pytest.raises(ConflictError):
+        await nodetype_service.delete(created.id, if_match=created.etag)
+    assert (await nodetype_service.get_by_id(created.id)).name == "Post"
+
+    with pytest.raises(ValueError):
+        await nodetype_service.delete(created.id, if_match="not-a-tag")
+    with pytest.raises(ValueError):
+        await nodetype_service.delete(created.id, expected_version=1, if_match=updated.etag)
+
+    await nodetype_service.delete(created.id, if_match=f"W/{updated.etag}")
+    with pytest.raises(NotFoundError):
+        await nodetype_service.get_by_id(created.id)
+
+
 @pytest.mark.asyncio
 async def test_delete_node_type(nodetype_service):
     """Test deleting a node type."""
@@ -95,3 +134,40 @@ async def test_list_node_types(nodetype_service):
     assert len(node_types) == 5
     assert result.total_count == 5
 
+
+@pytest.mark.asyncio
+async def test_create_node_type_with_display(nodetype_service):
+    """Test node types store display metadata validated against the schema."""
+    schema = '{"title": "string", "author": "string"}'
+    display = '{"display_name_template": "{title} by {author}", "column_order": ["title", "author"]}'
+
+    created = await nodetype_service.create("Article", "Blog article", schema, display)
+    fetched = await nodetype_service.get_by_id(created.id)
+
+    assert json.loads(fetched.display) == json.loads(display)
+
+    with pytest.raises(ValueError, match="unknown field: body"):
+        await nodetype_service.create("Post", "", schema, '{"column_order": ["body"]}')
+
+
+@pytest.mark.asyncio
+async def test_update_node_type_schema_checks_display(nodetype_service):
+    """Test that a schema change may not orphan fields referenced by display metadata."""
+    schema = '{"title": "string", "author": "string"}'
+    created = await nodetype_service.create("Article", "", schema, '{"column_order": ["author"]}')
+
+    with pytest.raises(ValueError, match="unknown field: author"):
+        await nodetype_service.update(created.id, "", "", '{"title": "string"}')
+
+
+@pytest.mark.asyncio
+async def test_describe_node_types(nodetype_service):
+    """Test describing returns every node type ordered by name."""
+    await nodetype_service.create("Comment", "", "{}")
+    await nodetype_service.create("Article", "", "{}", '{"label": "Blog Article"}')
+
+    node_types = await nodetype_service.describe()
+
+    assert [nt.name for nt in node_types] == ["Article", "Comment"]
+    assert json.loads(node_types[0].display) == {"label": "Blog Article"}
+
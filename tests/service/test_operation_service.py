@@ -0,0 +1,97 @@
+"""
+Tests for OperationService, with node migrations kept in memory.
+"""
+
+import pytest
+
+from app.repository import FailedPreconditionError, ListResult, NodeMigration, NotFoundError, Operation
+from app.service.operation_service import NODE_MIGRATIONS, NodeMigrationOperations, OperationService
+
+
+class FakeMigrationService:
+    """The NodeMigrationService methods operations use, on a list of migrations."""
+
+    def __init__(self, migrations):
+        self.migrations = {m.id: m for m in migrations}
+
+    async def get_by_id(self, id):
+        if id not in self.migrations:
+            raise NotFoundError(f"node_migration not found: {id}")
+        return self.migrations[id]
+
+    async def list(self, node_type_id, page_size, page_token):
+        migrations = list(self.migrations.values())
+        offset = int(page_token or 0)
+        page = migrations[offset:offset + page_size]
+        next_token = str(offset + page_size) if offset + page_size < len(migrations) else ""
+        return page, ListResult(next_page_token=next_token, total_count=len(migrations))
+
+    async def cancel(self, id):
+        migration = await self.get_by_id(id)
+        if migration.status not in ("pending", "running"):
+            raise FailedPreconditionError(f"node_migration {id} already {migration.status}")
+        migration.status = "cancelled"
+        return migration
+
+
+class FakeKind:
+    """An operation kind listing count operations."""
+
+    def __init__(self, kind, count):
+        self.operations = [Operation(name=f"{kind}/{i}", kind=kind) for i in range(count)]
+
+    async def list(self, page_size, page_token):
+        offset = int(page_token or 0)
+        next_token = str(offset + page_size) if offset + page_size < len(self.operations) else ""
+        return self.operations[offset:offset + page_size], ListResult(next_token, len(self.operations))
+
+
+def _service(*migrations):
+    return OperationService({NODE_MIGRATIONS: NodeMigrationOperations(FakeMigrationService(migrations))})
+
+
+@pytest.mark.asyncio
+async def test_get_and_cancel_operation():
+    """Test migrations are operations named by kind and ID, and done ones can't be cancelled."""
+    service = _service(
+        NodeMigration(id="m1", status="running", migrated_count=5),
+        NodeMigration(id="m2", status="succeeded", migrated_count=9),
+    )
+
+    running = await service.get("node_migrations/m1")
+    assert running.to_dict()["done"] is False
+    assert running.metadata["migrated_count"] == 5
+    assert "response" not in running.to_dict()
+
+    succeeded = (await service.get("node_migrations/m2")).to_dict()
+    assert succeeded["done"] is True
+    assert succeeded["response"]["migration"]["migrated_count"] == 9
+
+    cancelled = await service.cancel("node_migrations/m1")
+    assert cancelled.status == "cancelled"
+    assert cancelled.to_dict()["error"] == {"message": "cancelled"}
+    with pytest.raises(FailedPreconditionError, match="already succeeded"):
+        await service.cancel("node_migrations/m2")
+
+    with pytest.raises(NotFoundError, match="operation not found: exports/m1"):
+        await service.get("exports/m1")
+
+
+@pytest.mark.asyncio
+async def test_list_operations_pages_through_kinds():
+    """Test listing all kinds continues with the next kind once one is exhausted."""
+    service = OperationService({"a": FakeKind("a", 3), "b": FakeKind("b", 3)})
+
+    page, result = await service.list("", 2, "")
+    assert [op.name for op in page] == ["a/0", "a/1"]
+    assert result.total_count == 6
+
+    page, result = await service.list("", 2, result.next_page_token)
+    assert [op.name for op in page] == ["a/2", "b/0"]
+
+    page, result = await service.list("", 2, result.next_page_token)
+    assert [op.name for op in page] == ["b/1", "b/2"]
+    assert result.next_page_token == ""
+
+    with pytest.raises(ValueError, match="unknown operation kind: c"):
+        await service.list("c", 2, "")
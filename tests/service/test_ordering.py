@@ -0,0 +1,46 @@
+"""
+Tests for sort orders of list methods.
+"""
+
+import pytest
+
+from app.repository import NodeTypeIndex
+from app.repository.node_repo import NODE_SORT_COLUMNS
+from app.service.ordering import data_sort_path, parse_order_by, require_sort_index
+
+
+def test_parse_order_by():
+    """Test order_by names a sortable column, or a data path where allowed, and a direction."""
+    assert parse_order_by(None, NODE_SORT_COLUMNS) is None
+
+    sort = parse_order_by({"field": "updated_at", "direction": "desc"}, NODE_SORT_COLUMNS)
+    assert (sort.field, sort.descending) == ("updated_at", True)
+    assert not parse_order_by({"field": "created_at"}, NODE_SORT_COLUMNS).descending
+    assert data_sort_path(sort) is None
+
+    sort = parse_order_by({"field": "data.address.city"}, NODE_SORT_COLUMNS, data_paths=True)
+    assert data_sort_path(sort) == ["address", "city"]
+
+    with pytest.raises(ValueError, match="must be one of: created_at, updated_at$"):
+        parse_order_by({"field": "data.price"}, NODE_SORT_COLUMNS)
+    with pytest.raises(ValueError, match="direction must be one of: asc, desc"):
+        parse_order_by({"field": "created_at", "direction": "down"}, NODE_SORT_COLUMNS)
+    with pytest.raises(ValueError, match="unknown keys: nulls"):
+        parse_order_by({"field": "created_at", "nulls": "last"}, NODE_SORT_COLUMNS)
+    with pytest.raises(ValueError, match="must be an object"):
+        parse_order_by("created_at", NODE_SORT_COLUMNS)
+    with pytest.raises(ValueError, match="invalid data path"):
+        data_sort_path(parse_order_by({"field": "data.address."}, NODE_SORT_COLUMNS, data_paths=True))
+
+
+def test_require_sort_index():
+    """Test data paths sort only when a btree index starts with them."""
+    indexes = [
+        NodeTypeIndex(name="by_city", method="btree", paths=[["address", "city"], ["name"]]),
+        NodeTypeIndex(name="by_tags", method="gin", paths=[["tags"]]),
+    ]
+    require_sort_index(["address", "city"], indexes)
+    with pytest.raises(ValueError, match="data.name is not indexed"):
+        require_sort_index(["name"], indexes)
+    with pytest.raises(ValueError, match="data.tags is not indexed"):
+        require_sort_index(["tags"], indexes)
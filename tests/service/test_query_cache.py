@@ -0,0 +1,95 @@
+"""
+Tests for the query result cache.
+"""
+
+import pytest
+
+from app.service.query_cache import QueryCache, QueryCacheService, query_key
+
+
+class FakeClock:
+    def __init__(self):
+        self.now = 0.0
+
+    def __call__(self) -> float:
+        return self.now
+
+
+class FakeOutboxRepository:
+    def __init__(self):
+        self.sequence = 0
+
+    async def latest_sequence(self) -> int:
+        return self.sequence
+
+
+def test_query_key_is_normalized():
+    """Test parameter order and unset parameters don't change the key."""
+    assert query_key("list_nodes", {"a": 1, "b": {"y": 2, "x": 1}}) == query_key(
+        "list_nodes", {"b": {"x": 1, "y": 2}, "a": 1, "geo": None, "locale": ""}
+    )
+    assert query_key("list_nodes", {"a": 1}) != query_key("aggregate_nodes", {"a": 1})
+    assert query_key("list_nodes", {"a": 1}) != query_key("list_nodes", {"a": 2})
+
+
+def test_cache_invalidated_by_sequence():
+    """Test a result is reused only at the sequence it was computed at."""
+    cache = QueryCache()
+    cache.put("t1", "k", 5, {"nodes": []})
+
+    assert cache.get("t1", "k", 5) == {"nodes": []}
+    assert cache.get("t2", "k", 5) is None
+    assert cache.get("t1", "k", 6) is None
+    assert len(cache) == 0
+
+    # A result computed before the newest change seen is not stored
+    cache.put("t1", "k", 5, {"nodes": []})
+    assert len(cache) == 0
+
+
+def test_cache_ttl_and_eviction():
+    """Test results expire after the TTL and the least recently used are evicted."""
+    clock = FakeClock()
+    cache = QueryCache(max_entries=2, ttl=10, clock=clock)
+    cache.put("t1", "a", 1, "a")
+    cache.put("t1", "b", 1, "b")
+    assert cache.get("t1", "a", 1) == "a"
+
+    cache.put("t1", "c", 1, "c")
+    assert cache.get("t1", "b", 1) is None
+    assert cache.get("t1", "a", 1) == "a"
+
+    clock.now = 10
+    assert cache.get("t1", "a", 1) is None
+
+
+def test_cache_cleared_when_sequence_goes_backwards():
+    """Test a restored tenant database does not serve results cached before."""
+    cache = QueryCache()
+    cache.put("t1", "a", 7, "old")
+    cache.put("t1", "b", 7, "old")
+
+    assert cache.get("t1", "a", 3) is None
+    assert len(cache) == 0
+
+
+@pytest.mark.asyncio
+async def test_service_recomputes_after_change():
+    """Test the service computes a query once per change feed sequence."""
+    repo = FakeOutboxRepository()
+    service = QueryCacheService(QueryCache(), repo)
+    calls = []
+
+    async def compute():
+        calls.append(repo.sequence)
+        return {"count": len(calls)}
+
+    assert await service.get_or_compute("t1", "list_nodes", {}, compute) == {"count": 1}
+    assert await service.get_or_compute("t1", "list_nodes", {}, compute) == {"count": 1}
+
+    repo.sequence = 1
+    assert await service.get_or_compute("t1", "list_nodes", {}, compute) == {"count": 2}
+    assert calls == [0, 1]
+
+    uncached = QueryCacheService(None, repo)
+    assert await uncached.get_or_compute("t1", "list_nodes", {}, compute) == {"count": 3}
@@ -4,7 +4,7 @@ Tests for RelationshipService.
 
 import pytest
 
-from app.repository.errors import NotFoundError
+from app.repository.errors import ConflictError, NotFoundError
 
 
 @pytest.mark.asyncio
@@ -102,6 +102,41 @@ async def test_update_relationship(relationship_service, node_service, nodetype_
     assert updated.data == '{"note": "updated"}'
 
 
+@pytest.mark.asyncio
+async def test_update_relationship_version_conflict(relationship_service, node_service, nodetype_service):
+    """Test that updating a relationship with a stale expected_version fails."""
+    node_type = await nodetype_service.create("Article", "Blog article", '{}')
+    source_node = await node_service.create(node_type.id, '{}')
+    target_node = await node_service.create(node_type.id, '{}')
+    created = await relationship_service.create(source_node.id, target_node.id, "references", '{}')
+
+    updated = await relationship_service.update(created.id, "links_to", "", expected_version=1)
+    assert updated.version == 2
+
+    with pytest.raises(ConflictError):
+        await relationship_service.update(created.id, "cites", "", expected_version=1)
+
+
+@pytest.mark.asyncio
+async def test_relationship_if_match(relationship_service, node_service, nodetype_service):
+    """Test that a delete with a stale etag fails and leaves the relationship alone."""
+    node_type = await nodetype_service.create("Article", "Blog article", '{}')
+    source_node = await node_service.create(node_type.id, '{}')
+    target_node = await node_service.create(node_type.id, '{}')
+    created = await relationship_service.create(source_node.id, target_node.id, "references", '{}')
+
+    updated = await relationship_service.update(created.id, "links_to", "", if_match=created.etag)
+    assert updated.etag == '"2"'
+
+    with pytest.raises(ConflictError):
+        await relationship_service.delete(created.id, if_match=created.etag)
+    assert (await relationship_service.get_by_id(created.id)).relationship_type == "links_to"
+
+    await relationship_service.delete(created.id, if_match=updated.etag)
+    with pytest.raises(NotFoundError):
+        await relationship_service.get_by_id(created.id)
+
+
 @pytest.mark.asyncio
 async def test_delete_relationship(relationship_service, node_service, nodetype_service):
     """Test deleting a relationship."""
@@ -0,0 +1,60 @@
+"""
+Tests for RetentionService validation, using the in-memory node type repository.
+"""
+
+import pytest
+
+from app.repository import InMemoryNodeTypeRepository, InMemoryStore, NodeType
+from app.service import RetentionService
+from app.service.retention_service import normalize_timestamp_field
+
+
+class FakeRetentionPolicyRepository:
+    async def upsert(self, policy):
+        return policy
+
+
+@pytest.mark.parametrize("timestamp_field, expected", [
+    ("created_at", "created_at"),
+    ("updated_at", "updated_at"),
+    ("data.ends_at", "data.ends_at"),
+    ("data.offer.ends_at", "data.offer.ends_at"),
+])
+def test_timestamp_field(timestamp_field, expected):
+    """Test timestamp fields are columns or data paths of declared fields."""
+    assert normalize_timestamp_field(timestamp_field, '{"ends_at": "string", "offer": "object"}') == expected
+
+
+@pytest.mark.parametrize("timestamp_field, error", [
+    ("deleted_at", "timestamp_field must be one of"),
+    ("ends_at", "timestamp_field must be one of"),
+    ("data.", "timestamp_field: data path must be a non-empty string"),
+    ("data.a..b", "timestamp_field: invalid data path"),
+    ("data.starts_at", "timestamp_field is not in the schema: starts_at"),
+    ("data.token_expiry", "timestamp_field is sensitive: token_expiry"),
+])
+def test_invalid_timestamp_field(timestamp_field, error):
+    """Test unknown columns, malformed paths, undeclared and sensitive fields are rejected."""
+    schema = '{"ends_at": "string", "token_expiry": {"type": "string", "sensitive": true}}'
+    with pytest.raises(ValueError, match=error):
+        normalize_timestamp_field(timestamp_field, schema)
+
+
+@pytest.mark.asyncio
+async def test_set_policy():
+    """Test policies are validated before they are stored."""
+    node_types = InMemoryNodeTypeRepository(InMemoryStore())
+    node_type = await node_types.create(NodeType(name="Session"))
+    service = RetentionService(FakeRetentionPolicyRepository(), node_types, None)
+
+    policy = await service.set_policy(node_type.id, 86400, "", "purge")
+    assert (policy.timestamp_field, policy.ttl_seconds, policy.action) == ("created_at", 86400, "purge")
+
+    with pytest.raises(ValueError, match="ttl_seconds must be an integer of at least 60"):
+        await service.set_policy(node_type.id, 59)
+    with pytest.raises(ValueError, match="ttl_seconds"):
+        await service.set_policy(node_type.id, "3600")
+    with pytest.raises(ValueError, match="action must be one of: delete, purge"):
+        await service.set_policy(node_type.id, 3600, action="archive")
+    with pytest.raises(ValueError, match="node_type_id is required"):
+        await service.set_policy("", 3600)
@@ -0,0 +1,226 @@
+"""
+Tests for NodeType schema parsing and node data validation.
+"""
+
+import json
+
+import pytest
+
+from app.repository import ValidationError
+from app.service.schema import (
+    canonical_decimal,
+    normalize_data,
+    normalize_index,
+    normalize_unique_keys,
+    parse_schema,
+    prepare_data,
+    validate_data,
+    validate_schema,
+)
+
+
+def test_parse_simple_schema():
+    """Test parsing the simple field map form."""
+    fields = parse_schema('{"title": "string", "location": {"type": "geo_point", "required": true}}')
+
+    assert fields["title"].type == "string"
+    assert fields["title"].required is False
+    assert fields["location"].type == "geo_point"
+    assert fields["location"].required is True
+
+
+def test_parse_json_schema_style():
+    """Test parsing the JSON Schema style form."""
+    schema = '{"type": "object", "properties": {"title": {"type": "string"}}, "required": ["title"]}'
+    fields = parse_schema(schema)
+
+    assert list(fields) == ["title"]
+    assert fields["title"].required is True
+
+
+def test_validate_schema_invalid_json():
+    """Test that a malformed schema raises ValueError."""
+    with pytest.raises(ValueError, match="schema must be valid JSON"):
+        validate_schema("{not json")
+
+
+def test_validate_data_unknown_types_are_accepted():
+    """Test that fields with unknown types are not validated."""
+    validate_data('{"title": "custom-type"}', '{"title": 42}')
+
+
+def test_validate_data_untyped_fields_are_accepted():
+    """Test that plain JSON types document the data without being enforced."""
+    schema = '{"title": {"type": "string", "required": true}, "count": "integer"}'
+    validate_data(schema, '{"count": "many"}')
+
+
+def test_validate_data_required_field():
+    """Test that a missing required field raises ValueError."""
+    with pytest.raises(ValueError, match="data.location is required"):
+        validate_data('{"location": {"type": "geo_point", "required": true}}', '{}')
+
+
+def test_validate_data_names_every_invalid_field():
+    """Test that all invalid fields are reported as field violations, not just the first."""
+    schema = '{"area": {"type": "geo_shape", "required": true}, "location": "geo_point"}'
+    with pytest.raises(ValidationError) as raised:
+        validate_data(schema, '{"location": [13.405, 52.52]}')
+
+    assert [v.field for v in raised.value.violations] == ["data.area", "data.location"]
+    assert raised.value.field == "data.area"
+    assert str(raised.value).startswith("data.area is required; data.location ")
+
+
+def test_validate_data_not_an_object():
+    """Test that non-object data raises ValueError."""
+    with pytest.raises(ValueError, match="data must be a JSON object"):
+        validate_data("", "[1, 2]")
+
+
+def test_validate_geo_point():
+    """Test geo_point validation."""
+    schema = '{"location": "geo_point"}'
+    validate_data(schema, '{"location": {"lat": 52.52, "lng": 13.405}}')
+
+    with pytest.raises(ValueError, match="lat must be between -90 and 90"):
+        validate_data(schema, '{"location": {"lat": 91, "lng": 0}}')
+
+    with pytest.raises(ValueError, match="data.location"):
+        validate_data(schema, '{"location": [13.405, 52.52]}')
+
+
+def test_validate_geo_shape():
+    """Test geo_shape validation."""
+    schema = '{"area": "geo_shape"}'
+    polygon = '{"area": {"type": "Polygon", "coordinates": [[[0, 0], [1, 0], [1, 1], [0, 0]]]}}'
+    validate_data(schema, polygon)
+
+    with pytest.raises(ValueError, match="unsupported GeoJSON type"):
+        validate_data(schema, '{"area": {"type": "Circle", "coordinates": [0, 0]}}')
+
+    with pytest.raises(ValueError, match="invalid GeoJSON coordinates"):
+        validate_data(schema, '{"area": {"type": "Polygon", "coordinates": [[0, 0]]}}')
+
+
+def test_canonical_decimal():
+    """Test decimal values are canonicalized to the field scale without rounding."""
+    assert canonical_decimal("12.3", 2) == "12.30"
+    assert canonical_decimal(5, 2) == "5.00"
+    assert canonical_decimal("-0.00", 2) == "0.00"
+    assert canonical_decimal("+7.1", 1) == "7.1"
+
+    with pytest.raises(ValueError, match="at most 2 decimal places"):
+        canonical_decimal("12.345", 2)
+    with pytest.raises(ValueError, match="decimal string"):
+        canonical_decimal("1e3", 2)
+    with pytest.raises(ValueError, match="decimal string"):
+        canonical_decimal(True, 2)
+
+
+def test_validate_decimal_scale_in_schema():
+    """Test decimal scale is validated on the schema."""
+    validate_schema('{"amount": {"type": "decimal", "scale": 4}}')
+
+    with pytest.raises(ValueError, match="scale must be an integer"):
+        validate_schema('{"amount": {"type": "decimal", "scale": 40}}')
+    with pytest.raises(ValueError, match="only supported for decimal"):
+        validate_schema('{"amount": {"type": "number", "scale": 2}}')
+
+
+def test_normalize_data_keeps_decimal_precision():
+    """Test decimal fields are stored as canonical strings without float rounding."""
+    schema = '{"amount": {"type": "decimal", "scale": 2}, "qty": "number"}'
+    data = '{"amount": 12345678901234567.10, "qty": 1.5}'
+
+    validate_data(schema, data)
+    assert json.loads(normalize_data(schema, data)) == {"amount": "12345678901234567.10", "qty": 1.5}
+
+    # Data without decimal fields is returned untouched
+    assert normalize_data('{"qty": "number"}', '{"qty": 1.5}') == '{"qty": 1.5}'
+
+
+def test_prepare_data_parses_once_and_passes_data_through():
+    """Test prepare_data validates and normalizes like the two steps, returning data itself when unchanged."""
+    schema = (
+        '{"amount": {"type": "decimal", "scale": 2}, "qty": "number", '
+        '"location": {"type": "geo_point", "required": true}}'
+    )
+    data = '{"location": {"lat": 0, "lng": 0}, "amount": 12345678901234567.10, "qty": 1.5, "dims": [0.1, 1e400]}'
+
+    assert prepare_data(schema, data) == normalize_data(schema, data)
+    assert json.loads(prepare_data(schema, data))["amount"] == "12345678901234567.10"
+
+    unchanged = '{"location": {"lat": 0, "lng": 0}, "qty": 0.1}'
+    assert prepare_data(schema, unchanged) is unchanged
+    assert prepare_data('{"qty": "number"}', unchanged) is unchanged
+
+    with pytest.raises(ValidationError) as e:
+        prepare_data(schema, '{"amount": 1.234}')
+    assert [v.field for v in e.value.violations] == ["data.amount", "data.location"]
+
+
+def test_validate_localized_string():
+    """Test localized_string fields accept locale maps restricted by the schema."""
+    schema = '{"title": {"type": "localized_string", "locales": ["en", "fr", "fr-CA"], "default_locale": "en"}}'
+    validate_schema(schema)
+    validate_data(schema, '{"title": {"en": "Hello", "fr-ca": "Allo"}}')
+
+    with pytest.raises(ValueError, match="must be an object mapping locales"):
+        validate_data(schema, '{"title": "Hello"}')
+    with pytest.raises(ValueError, match="unsupported locale: de"):
+        validate_data(schema, '{"title": {"en": "Hello", "de": "Hallo"}}')
+    with pytest.raises(ValueError, match="must include the default locale: en"):
+        validate_data(schema, '{"title": {"fr": "Bonjour"}}')
+    with pytest.raises(ValueError, match="value for locale en must be a string"):
+        validate_data(schema, '{"title": {"en": 1}}')
+
+
+def test_validate_localized_string_schema():
+    """Test locales and default_locale are validated on the schema."""
+    with pytest.raises(ValueError, match="only supported for localized_string"):
+        validate_schema('{"title": {"type": "string", "locales": ["en"]}}')
+    with pytest.raises(ValueError, match="locales must be a non-empty array"):
+        validate_schema('{"title": {"type": "localized_string", "locales": ["english!"]}}')
+    with pytest.raises(ValueError, match="default_locale must be one of"):
+        validate_schema('{"title": {"type": "localized_string", "locales": ["fr"], "default_locale": "en"}}')
+
+
+
+def test_normalize_unique_keys():
+    """Test unique keys are field names or arrays of them, declared in the schema if it has fields."""
+    schema = '{"email": "string", "first": "string", "last": "string"}'
+    assert normalize_unique_keys(None, schema) == []
+    assert normalize_unique_keys(["email", ["first", "last"]], schema) == [["email"], ["first", "last"]]
+    assert normalize_unique_keys(["anything"], "") == [["anything"]]
+
+    with pytest.raises(ValueError, match="must be an array"):
+        normalize_unique_keys("email", schema)
+    with pytest.raises(ValueError, match=r"unique_keys\[0\] must be a field name"):
+        normalize_unique_keys([[]], schema)
+    with pytest.raises(ValueError, match="not in the schema: phone"):
+        normalize_unique_keys(["phone"], schema)
+    with pytest.raises(ValueError, match="duplicate fields"):
+        normalize_unique_keys([["first", "first"]], schema)
+    with pytest.raises(ValueError, match="duplicate key"):
+        normalize_unique_keys(["email", ["email"]], schema)
+
+
+def test_normalize_index():
+    """Test node type index names, methods and dot-separated paths are validated."""
+    schema = '{"address": "object", "tags": "array"}'
+    assert normalize_index("by_city", "btree", ["address.city", "tags"], schema) == [["address", "city"], ["tags"]]
+    assert normalize_index("anything", "gin", ["a.b"], "") == [["a", "b"]]
+
+    with pytest.raises(ValueError, match="index name"):
+        normalize_index("By City", "btree", ["tags"], schema)
+    with pytest.raises(ValueError, match="index method"):
+        normalize_index("by_tags", "hash", ["tags"], schema)
+    with pytest.raises(ValueError, match="non-empty array"):
+        normalize_index("by_tags", "gin", [], schema)
+    with pytest.raises(ValueError, match="invalid data path"):
+        normalize_index("by_tags", "gin", ["tags..x"], schema)
+    with pytest.raises(ValueError, match="not in the schema: name"):
+        normalize_index("by_name", "btree", ["name"], schema)
+    with pytest.raises(ValueError, match="duplicate index path"):
+        normalize_index("by_tags", "gin", ["tags", "tags"], schema)
@@ -0,0 +1,99 @@
+"""
+Tests for StorageExportService, with the in-memory repositories and a local object store.
+"""
+
+import gzip
+import json
+
+import pytest
+
+from app.lake.storage import LocalObjectStore
+from app.repository import (
+    FailedPreconditionError,
+    InMemoryBulkJobRepository,
+    InMemoryNodeRepository,
+    InMemoryNodeTypeRepository,
+    InMemoryStore,
+    InMemoryTransferRepository,
+)
+from app.service import BulkJobService, NodeService, NodeTypeService, StorageExportService, TransferService
+
+
+class FlakyObjectStore(LocalObjectStore):
+    """Fails the upload of one part number once."""
+
+    def __init__(self, root, fail_part):
+        super().__init__(root)
+        self.fail_part = fail_part
+
+    async def upload_part(self, key, upload_id, number, body):
+        if number == self.fail_part:
+            self.fail_part = 0
+            raise RuntimeError("connection reset")
+        return await super().upload_part(key, upload_id, number, body)
+
+
+async def _tenant(store, count):
+    node_type = await NodeTypeService(InMemoryNodeTypeRepository(store)).create("Article", "", "")
+    nodes = NodeService(InMemoryNodeRepository(store), InMemoryNodeTypeRepository(store))
+    for i in range(count):
+        await nodes.create(node_type.id, f'{{"n": {i}}}')
+
+
+def _exports(store, objects, part_size):
+    transfer = TransferService(InMemoryTransferRepository(store), InMemoryNodeTypeRepository(store))
+    jobs = BulkJobService(InMemoryBulkJobRepository(store))
+    return StorageExportService(transfer, jobs, "t1", objects, "flexdb", part_size)
+
+
+@pytest.mark.asyncio
+async def test_export_uploads_compressed_parts(tmp_path):
+    """Test an export is uploaded in parts of whole gzip members that decompress as one stream."""
+    store = InMemoryStore()
+    await _tenant(store, 5)
+    objects = LocalObjectStore(str(tmp_path))
+
+    job = await _exports(store, objects, part_size=1).export(batch_size=2)
+
+    assert job.status == "succeeded" and job.processed == 6
+    assert job.progress["key"] == f"flexdb/t1/exports/{job.id}.ndjson.gz"
+    assert len(job.progress["parts"]) == 7
+    body = await objects.get(job.progress["key"])
+    assert len(body) == job.progress["bytes"]
+    records = [json.loads(line) for line in gzip.decompress(body).splitlines()]
+    assert [r["type"] for r in records] == ["header", "node_type"] + ["node"] * 5
+    assert records[0]["change_token"] == job.progress["change_token"]
+
+
+@pytest.mark.asyncio
+async def test_failed_export_resumes_after_its_last_part(tmp_path):
+    """Test a failed export continues its upload after the last part, without repeating records."""
+    store = InMemoryStore()
+    await _tenant(store, 5)
+    objects = FlakyObjectStore(str(tmp_path), fail_part=4)
+    exports = _exports(store, objects, part_size=1)
+
+    with pytest.raises(RuntimeError, match="connection reset"):
+        await exports.export(compression="none")
+    failed = (await exports.jobs.list(None, 10, ""))[0][0]
+    assert (failed.status, failed.processed, len(failed.progress["parts"])) == ("failed", 2, 3)
+    assert await objects.get(failed.progress["key"]) is None
+
+    job = await exports.export(resume=failed.id)
+    assert job.id == failed.id and job.status == "succeeded" and job.processed == 6
+    records = [json.loads(line) for line in (await objects.get(job.progress["key"])).splitlines()]
+    ids = [r[r["type"]]["id"] for r in records[1:]]
+    assert records[0]["type"] == "header" and len(ids) == len(set(ids)) == 6
+
+    with pytest.raises(FailedPreconditionError, match="succeeded and can't be resumed"):
+        await exports.export(resume=job.id)
+
+
+@pytest.mark.asyncio
+async def test_exports_need_object_storage():
+    """Test exports fail as a failed precondition when no object store is configured."""
+    exports = _exports(InMemoryStore(), None, part_size=1)
+    with pytest.raises(FailedPreconditionError, match="EXPORT_STORAGE_URL"):
+        await exports.export()
+    with pytest.raises(ValueError, match="compression"):
+        await _exports(InMemoryStore(), LocalObjectStore("/nonexistent"), 1).export(compression="brotli")
@@ -0,0 +1,79 @@
+"""
+Tests for tenant checks of tenant-scoped services.
+"""
+
+import pytest
+
+from app.repository import (
+    FailedPreconditionError,
+    InMemoryNodeRepository,
+    InMemoryNodeTypeRepository,
+    InMemoryRelationshipRepository,
+    InMemoryStore,
+    InMemoryTenantRepository,
+    NotFoundError,
+    Tenant,
+)
+from app.service import NodeService, NodeTypeService, RelationshipService
+from app.service.tenant_check import TenantCheck
+from app.service.tenant_service import ACTIVE, ARCHIVED, SUSPENDED
+
+
+@pytest.fixture
+def tenant_repo():
+    return InMemoryTenantRepository()
+
+
+def _services(tenant_repo, tenant_id, store=None):
+    store = store or InMemoryStore()
+    node_types = InMemoryNodeTypeRepository(store)
+    nodes = InMemoryNodeRepository(store)
+    check = TenantCheck(tenant_repo, tenant_id)
+    return (
+        NodeTypeService(node_types, tenant_check=check),
+        NodeService(nodes, node_types, tenant_check=check),
+        RelationshipService(InMemoryRelationshipRepository(store), nodes, check),
+    )
+
+
+@pytest.mark.asyncio
+async def test_writes_for_unknown_tenant_are_not_found(tenant_repo):
+    """Test writes for a tenant that doesn't exist fail with NotFoundError."""
+    node_types, nodes, relationships = _services(tenant_repo, "missing")
+
+    with pytest.raises(NotFoundError, match="tenant not found: missing"):
+        await node_types.create("Article", "", "{}")
+    with pytest.raises(NotFoundError):
+        await nodes.create("t-1", "{}")
+    with pytest.raises(NotFoundError):
+        await relationships.create("a", "b", "links", "{}")
+
+
+@pytest.mark.asyncio
+async def test_writes_need_an_active_tenant(tenant_repo):
+    """Test writes for suspended and archived tenants fail with FailedPreconditionError, reads don't."""
+    tenant = await tenant_repo.create(Tenant(slug="acme", name="Acme"))
+    store = InMemoryStore()
+    node_types, nodes, _ = _services(tenant_repo, tenant.id, store)
+    node_type = await node_types.create("Article", "", "{}")
+
+    for status in (SUSPENDED, ARCHIVED):
+        await tenant_repo.set_status(tenant.id, status, [ACTIVE], "")
+        node_types, nodes, _ = _services(tenant_repo, tenant.id, store)
+        with pytest.raises(FailedPreconditionError, match=f"tenant {tenant.id} is {status}"):
+            await nodes.create(node_type.id, "{}")
+        with pytest.raises(FailedPreconditionError):
+            await node_types.delete(node_type.id)
+        assert (await node_types.get_by_id(node_type.id)).name == "Article"
+        await tenant_repo.set_status(tenant.id, ACTIVE, [status], "")
+
+
+@pytest.mark.asyncio
+async def test_tenant_is_looked_up_once(tenant_repo):
+    """Test a check looks its tenant up once, as services are built per request."""
+    tenant = await tenant_repo.create(Tenant(slug="acme", name="Acme"))
+    check = TenantCheck(tenant_repo, tenant.id)
+
+    assert (await check.require_writable()).id == tenant.id
+    await tenant_repo.delete(tenant.id)
+    assert (await check.require_writable()).id == tenant.id
@@ -4,7 +4,43 @@ Tests for TenantService.
 
 import pytest
 
-from app.repository.errors import NotFoundError
+from app.repository import (
+    InMemoryControlStore,
+    InMemoryTenantQuotaRepository,
+    InMemoryTenantRepository,
+    Tenant,
+    TenantDeletion,
+)
+from app.repository.errors import ConflictError, FailedPreconditionError, NotFoundError
+from app.service import TenantService
+
+
+class FakeTenantDatabaseManager:
+    """Records archive and read-only changes of tenant databases."""
+
+    def __init__(self):
+        self.read_only = {}
+        self.forgotten = []
+
+    async def archive_tenant_database(self, tenant_id, suffix):
+        self.read_only[tenant_id] = True
+        return f"dbaas_tenant_acme_archive_{suffix}"
+
+    async def set_tenant_read_only(self, tenant_id, read_only):
+        self.read_only[tenant_id] = read_only
+
+    def forget_tenant_status(self, tenant_id):
+        self.forgotten.append(tenant_id)
+
+
+@pytest.fixture
+def lifecycle_manager():
+    return FakeTenantDatabaseManager()
+
+
+@pytest.fixture
+def lifecycle_service(lifecycle_manager):
+    return TenantService(InMemoryTenantRepository(), lifecycle_manager)
 
 
 @pytest.mark.asyncio
@@ -67,12 +103,15 @@ async def test_update_tenant(tenant_service):
         created.id,
         slug="updated-tenant",
         name="Updated Tenant",
-        status="inactive"
+        status="active"
     )
     
     assert updated.slug == "updated-tenant"
     assert updated.name == "Updated Tenant"
-    assert updated.status == "inactive"
+    assert updated.status == "active"
+
+    with pytest.raises(ValueError, match="suspend_tenant"):
+        await tenant_service.update(created.id, slug="", name="", status="suspended")
 
 
 @pytest.mark.asyncio
@@ -138,3 +177,168 @@ async def test_list_tenants_pagination(tenant_service):
     assert result1.total_count == 15
     assert result1.next_page_token == "5"
 
+
+
+@pytest.mark.asyncio
+async def test_suspend_and_reactivate_tenant(lifecycle_service, lifecycle_manager):
+    """Test suspending and reactivating a tenant records the reason and drops its cached status."""
+    tenant = await lifecycle_service.repo.create(Tenant(slug="acme", name="Acme"))
+
+    suspended = await lifecycle_service.suspend(tenant.id, "unpaid invoice")
+    assert suspended.status == "suspended"
+    assert suspended.status_reason == "unpaid invoice"
+    assert suspended.status_changed_at is not None
+
+    with pytest.raises(FailedPreconditionError, match="is suspended, not active"):
+        await lifecycle_service.suspend(tenant.id)
+
+    reactivated = await lifecycle_service.reactivate(tenant.id, "paid")
+    assert reactivated.status == "active"
+    assert lifecycle_manager.forgotten == [tenant.id, tenant.id]
+    # Only archived tenants' databases are made writable again
+    assert lifecycle_manager.read_only == {}
+
+    with pytest.raises(FailedPreconditionError, match="is active"):
+        await lifecycle_service.reactivate(tenant.id)
+
+
+@pytest.mark.asyncio
+async def test_archive_tenant(lifecycle_service, lifecycle_manager):
+    """Test archiving snapshots the tenant database and makes it read-only until reactivated."""
+    tenant = await lifecycle_service.repo.create(Tenant(slug="acme", name="Acme"))
+    await lifecycle_service.suspend(tenant.id)
+
+    archived = await lifecycle_service.archive(tenant.id, "contract ended")
+    assert archived.status == "archived"
+    assert archived.archive_database.startswith("dbaas_tenant_acme_archive_")
+    assert lifecycle_manager.read_only == {tenant.id: True}
+
+    with pytest.raises(FailedPreconditionError, match="is archived"):
+        await lifecycle_service.archive(tenant.id)
+    with pytest.raises(FailedPreconditionError, match="is archived"):
+        await lifecycle_service.suspend(tenant.id)
+
+    reactivated = await lifecycle_service.reactivate(tenant.id)
+    assert reactivated.status == "active"
+    # The snapshot is kept
+    assert reactivated.archive_database == archived.archive_database
+    assert lifecycle_manager.read_only == {tenant.id: False}
+
+
+@pytest.mark.asyncio
+async def test_delete_tenant_in_background(lifecycle_manager):
+    """Test deleting a tenant with a deletion repository queues its deletion instead."""
+    class FakeTenantDeletionRepository:
+        def __init__(self, repo):
+            self.repo = repo
+            self.deletions = {}
+
+        async def start(self, tenant_id):
+            tenant = await self.repo.set_status(tenant_id, "deleting", ["active", "suspended", "archived"], "deleted")
+            return self.deletions.setdefault(tenant_id, TenantDeletion(tenant_id=tenant_id, slug=tenant.slug))
+
+        async def get(self, tenant_id):
+            if tenant_id not in self.deletions:
+                raise NotFoundError(f"tenant deletion not found: {tenant_id}")
+            return self.deletions[tenant_id]
+
+    repo = InMemoryTenantRepository()
+    service = TenantService(repo, lifecycle_manager, deletion_repo=FakeTenantDeletionRepository(repo))
+    tenant = await repo.create(Tenant(slug="acme", name="Acme"))
+
+    deletion = await service.delete(tenant.id)
+    assert (deletion.slug, deletion.status) == ("acme", "pending")
+    assert (await service.get_by_id(tenant.id)).status == "deleting"
+    assert lifecycle_manager.forgotten == [tenant.id]
+    assert await service.deletion_status(tenant.id) is deletion
+
+    with pytest.raises(FailedPreconditionError, match="is deleting"):
+        await service.suspend(tenant.id)
+    with pytest.raises(NotFoundError):
+        await service.deletion_status("missing")
+    with pytest.raises(FailedPreconditionError, match="not available"):
+        await TenantService(repo).deletion_status(tenant.id)
+
+
+@pytest.mark.asyncio
+async def test_tenant_quota():
+    """Test setting, replacing and validating a tenant's quota."""
+    control = InMemoryControlStore()
+    service = TenantService(InMemoryTenantRepository(control), quota_repo=InMemoryTenantQuotaRepository(control))
+    tenant = await service.repo.create(Tenant(slug="acme", name="Acme"))
+
+    quota = await service.get_quota(tenant.id)
+    assert quota.requests_per_second is None and quota.burst is None
+
+    quota = await service.set_quota(tenant.id, requests_per_second=20, burst=40)
+    assert quota.requests_per_second == 20.0
+    assert quota.burst == 40
+    assert quota.updated_at is not None
+
+    # Setting replaces the whole quota
+    await service.set_quota(tenant.id, api_key_requests_per_second=0)
+    quota = await service.get_quota(tenant.id)
+    assert quota.requests_per_second is None
+    assert quota.api_key_requests_per_second == 0
+
+    with pytest.raises(ValueError, match="non-negative"):
+        await service.set_quota(tenant.id, requests_per_second=-1)
+    with pytest.raises(ValueError, match="positive integer"):
+        await service.set_quota(tenant.id, burst=0)
+    with pytest.raises(ValueError, match="positive integer"):
+        await service.set_quota(tenant.id, api_key_burst=1.5)
+    with pytest.raises(NotFoundError):
+        await service.get_quota("missing")
+    with pytest.raises(NotFoundError):
+        await service.set_quota("missing", burst=1)
+
+    with pytest.raises(FailedPreconditionError, match="not available"):
+        await TenantService(service.repo).get_quota(tenant.id)
+
+
+@pytest.mark.asyncio
+async def test_rename_tenant_slug():
+    """Test renames are recorded, and former slugs resolve to the tenant renamed from them."""
+    service = TenantService(InMemoryTenantRepository(), slug_policy="rename")
+    acme = await service.repo.create(Tenant(slug="acme", name="Acme"))
+    other = await service.repo.create(Tenant(slug="other", name="Other"))
+
+    with pytest.raises(FailedPreconditionError, match="rename_tenant_slug"):
+        await service.update(acme.id, "acme-corp", "", "")
+    assert (await service.update(acme.id, "acme", "Acme Inc", "")).name == "Acme Inc"
+
+    renamed = await service.rename_slug(acme.id, "acme-corp")
+    assert renamed.slug == "acme-corp" and renamed.name == "Acme Inc"
+    assert await service.get_by_slug("acme-corp") == (renamed, False)
+    tenant, former = await service.get_by_slug("acme")
+    assert tenant.id == acme.id and former
+
+    await service.rename_slug(acme.id, "acme-corp")
+    with pytest.raises(ConflictError, match="already exists"):
+        await service.rename_slug(other.id, "acme-corp")
+    changes = await service.list_slug_changes(acme.id)
+    assert [(c.old_slug, c.new_slug) for c in changes] == [("acme", "acme-corp")]
+
+    # A former slug taken by another tenant resolves to that tenant
+    await service.rename_slug(other.id, "acme")
+    assert await service.get_by_slug("acme") == (await service.get_by_id(other.id), False)
+    with pytest.raises(NotFoundError):
+        await service.get_by_slug("missing")
+
+
+@pytest.mark.asyncio
+async def test_tenant_slug_policies():
+    """Test mutable slugs change with update_tenant too, and immutable ones don't change."""
+    repo = InMemoryTenantRepository()
+    tenant = await repo.create(Tenant(slug="acme", name="Acme"))
+
+    updated = await TenantService(repo).update(tenant.id, "acme-corp", "Acme Inc", "")
+    assert (updated.slug, updated.name) == ("acme-corp", "Acme Inc")
+    assert [c.old_slug for c in await repo.list_slug_changes(tenant.id)] == ["acme"]
+
+    immutable = TenantService(repo, slug_policy="immutable")
+    for change in (immutable.update(tenant.id, "acme", "", ""), immutable.rename_slug(tenant.id, "acme")):
+        with pytest.raises(FailedPreconditionError, match="immutable"):
+            await change
+    with pytest.raises(ValueError, match="slug_policy must be one of"):
+        TenantService(repo, slug_policy="frozen")
@@ -0,0 +1,73 @@
+"""
+Tests for tenant templates, using the in-memory repositories.
+"""
+
+import json
+
+import pytest
+
+from app.repository import InMemoryNodeTypeRepository, InMemoryStore, NotFoundError
+from app.service import NodeTypeService, TenantTemplateService, load_tenant_templates
+from app.service.tenant_template_service import parse_template
+
+CRM = {
+    "description": "CRM starter",
+    "node_types": [
+        {"name": "Company", "schema": {"name": {"type": "string", "required": True}}, "unique_keys": ["name"]},
+        {"name": "Person", "schema": {"name": "string", "email": "string"}},
+    ],
+    "relationship_types": [
+        {"name": "works_at", "source": "Person", "target": "Company", "description": "Employment"},
+    ],
+}
+
+
+@pytest.fixture
+def nodetype_service():
+    return NodeTypeService(InMemoryNodeTypeRepository(InMemoryStore()))
+
+
+@pytest.mark.asyncio
+async def test_bootstrap_creates_missing_node_types(nodetype_service):
+    """Test bootstrapping creates the template's node types once, and maps relationship types to their IDs."""
+    service = TenantTemplateService({"crm": parse_template("crm", CRM)})
+    await nodetype_service.create("Person", "Kept as is", '{"name": "string"}')
+
+    created, existing, relationship_types = await service.bootstrap("crm", nodetype_service)
+
+    assert [t.name for t in created] == ["Company"]
+    assert created[0].unique_keys == [["name"]]
+    assert [(t.name, t.description) for t in existing] == [("Person", "Kept as is")]
+    [works_at] = relationship_types
+    assert works_at["source_node_type_id"] == existing[0].id
+    assert works_at["target_node_type_id"] == created[0].id
+
+    created, existing, _ = await service.bootstrap("crm", nodetype_service)
+    assert created == [] and len(existing) == 2
+    with pytest.raises(NotFoundError):
+        await service.bootstrap("erp", nodetype_service)
+
+
+def test_parse_template_rejects_invalid_templates():
+    """Test templates with invalid node types or dangling relationship types are rejected."""
+    with pytest.raises(ValueError, match="must have a node_types list"):
+        parse_template("empty", {"description": "nothing"})
+    with pytest.raises(ValueError, match="unique_keys\\[0\\] field is not in the schema"):
+        parse_template("bad", {"node_types": [{"name": "A", "schema": {"x": "string"}, "unique_keys": ["y"]}]})
+    with pytest.raises(ValueError, match="target must be a node type of the template"):
+        parse_template("bad", {
+            "node_types": [{"name": "A"}],
+            "relationship_types": [{"name": "r", "source": "A", "target": "B"}],
+        })
+
+
+def test_load_tenant_templates(tmp_path):
+    """Test templates are loaded from the directory's JSON files, named after them."""
+    (tmp_path / "crm.json").write_text(json.dumps(CRM))
+    (tmp_path / "README.md").write_text("not a template")
+
+    templates = load_tenant_templates(str(tmp_path))
+
+    assert list(templates) == ["crm"]
+    assert templates["crm"].to_dict()["relationship_types"][0]["target"] == "Company"
+    assert load_tenant_templates("") == {}
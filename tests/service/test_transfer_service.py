@@ -0,0 +1,285 @@
+"""
+Tests for TransferService.
+"""
+
+import json
+
+import pytest
+
+from app.repository import (
+    AlreadyExistsError,
+    FailedPreconditionError,
+    ImportProgress,
+    InMemoryNodeTypeRepository,
+    InMemoryStore,
+    InMemoryTransferRepository,
+    NodeLockedError,
+    OutboxRepository,
+)
+from app.service import TransferService
+
+
+async def _lines(records):
+    for record in records:
+        yield json.dumps(record) if isinstance(record, dict) else record
+
+
+async def _import(transfer_service, records, batch_size=500, dry_run=False, key="", resume=None, **options):
+    progress = []
+    async for p in transfer_service.import_lines(_lines(records), batch_size, dry_run, key, resume, **options):
+        progress.append({**p.to_dict(), "rows": [row.to_dict() for row in p.rows]})
+    return progress
+
+
+@pytest.mark.asyncio
+async def test_export_streams_header_then_records(transfer_service, nodetype_service, node_service, relationship_service):
+    """Test an export lists node types, nodes and relationships after a header."""
+    node_type = await nodetype_service.create("Article", "", '{"title": "string"}')
+    a = await node_service.create(node_type.id, '{"title": "a"}')
+    b = await node_service.create(node_type.id, '{"title": "b"}')
+    await relationship_service.create(a.id, b.id, "links", "{}")
+
+    records = [r async for r in transfer_service.export("tenant-1")]
+
+    assert records[0]["type"] == "header"
+    assert records[0]["format"] == "flexdb.tenant"
+    assert records[0]["tenant_id"] == "tenant-1"
+    assert [r["type"] for r in records[1:]] == ["node_type", "node", "node", "relationship"]
+    assert records[1]["node_type"]["name"] == "Article"
+
+
+@pytest.mark.asyncio
+async def test_export_header_resumes_change_feed(transfer_service, nodetype_service, node_service, tenant_db):
+    """Test the change feed from an export header's change token lists the changes after the export."""
+    node_type = await nodetype_service.create("Article", "", '{"title": "string"}')
+    records = transfer_service.export("tenant-1")
+    header = await records.__anext__()
+    # Written while the export streams, so not in its snapshot
+    node = await node_service.create(node_type.id, '{"title": "a"}')
+    assert [r["type"] async for r in records] == ["node_type"]
+
+    assert header["lsn"] and header["change_token"] == header["snapshot"]
+    page = await OutboxRepository(tenant_db).list_changes(header["change_token"], 10)
+    assert [(e.event_type, e.entity_id) for e in page.events] == [("node.created", node.id)]
+
+
+@pytest.mark.asyncio
+async def test_import_remaps_ids_in_batches(transfer_service, node_service, relationship_service, nodetype_repo):
+    """Test imported records get new IDs, references are remapped and batches are reported."""
+    records = [
+        {"type": "header", "format": "flexdb.tenant", "version": 1},
+        {"type": "node_type", "node_type": {"id": "t1", "name": "Article", "schema": '{"title": "string"}'}},
+        {"type": "node", "node": {"id": "n1", "node_type_id": "t1", "data": '{"title": "a"}'}},
+        {"type": "node", "node": {"id": "n2", "node_type_id": "t1", "data": {"title": "b"}}},
+        "",
+        {"type": "relationship", "relationship": {
+            "id": "r1", "source_node_id": "n1", "target_node_id": "n2", "relationship_type": "links",
+        }},
+    ]
+
+    progress = await _import(transfer_service, records, batch_size=2)
+
+    assert [p["batches"] for p in progress] == [1, 2]
+    assert progress[-1]["node_types_created"] == 1
+    assert progress[-1]["nodes_created"] == 2
+    assert progress[-1]["relationships_created"] == 1
+
+    node_type = (await nodetype_repo.list_all())[0]
+    assert node_type.name == "Article" and node_type.id != "t1"
+    nodes, _ = await node_service.list(node_type.id, 10, "")
+    rels, _ = await relationship_service.list(None, None, None, 10, "")
+    assert {n.id for n in nodes} == {rels[0].source_node_id, rels[0].target_node_id}
+
+
+@pytest.mark.asyncio
+async def test_import_export_roundtrip_matches_node_types(transfer_service, nodetype_service, node_service):
+    """Test re-importing an export maps node types by name and copies nodes."""
+    node_type = await nodetype_service.create("Article", "", '{"title": "string"}')
+    await node_service.create(node_type.id, '{"title": "a"}')
+    exported = [r async for r in transfer_service.export("tenant-1")]
+
+    progress = await _import(transfer_service, exported)
+
+    assert progress[-1]["node_types_matched"] == 1
+    assert progress[-1]["node_types_created"] == 0
+    nodes, _ = await node_service.list(node_type.id, 10, "")
+    assert len(nodes) == 2
+
+
+@pytest.mark.asyncio
+async def test_import_reports_invalid_line(transfer_service, node_service, nodetype_repo):
+    """Test an invalid record fails with its line number, keeping committed batches."""
+    records = [
+        {"type": "node_type", "node_type": {
+            "id": "t1", "name": "Article", "schema": '{"title": "string", "site": "geo_point"}',
+        }},
+        {"type": "node", "node": {"id": "n1", "node_type_id": "t1", "data": '{"title": "a"}'}},
+        {"type": "node", "node": {"id": "n2", "node_type_id": "t1", "data": '{"site": 5}'}},
+    ]
+
+    with pytest.raises(ValueError, match="line 3 is invalid: .*site"):
+        await _import(transfer_service, records, batch_size=2)
+
+    node_type = (await nodetype_repo.list_all())[0]
+    nodes, _ = await node_service.list(node_type.id, 10, "")
+    assert len(nodes) == 1
+
+    with pytest.raises(ValueError, match="line 1 is invalid: node_type_id references an unknown node type: t9"):
+        await _import(transfer_service, [{"type": "node", "node": {"id": "n", "node_type_id": "t9"}}])
+    with pytest.raises(ValueError, match="batch_size"):
+        transfer_service.import_lines(_lines([]), 0)
+
+
+@pytest.mark.asyncio
+async def test_import_merges_nodes_by_unique_key(transfer_service, nodetype_service, node_service):
+    """Test an import merge patches the existing nodes sharing a unique key and creates the others."""
+    node_type = await nodetype_service.create(
+        "Contact", "", '{"external_id": "string", "name": "string", "email": "string"}', unique_keys=["external_id"]
+    )
+    ada = await node_service.create(node_type.id, '{"external_id": "a", "name": "Ada"}')
+    records = _contacts({"external_id": "a", "email": "ada@example.com"}, {"external_id": "b", "name": "Bob"})
+
+    progress = (await _import(transfer_service, records, on_conflict="merge_patch", report=True))[-1]
+
+    assert (progress["nodes_created"], progress["nodes_merged"]) == (1, 1)
+    assert progress["rows"][1] == {"line": 2, "type": "node", "id": ada.id, "outcome": "merged"}
+    merged = await node_service.get_by_id(ada.id)
+    assert json.loads(merged.data) == {"external_id": "a", "name": "Ada", "email": "ada@example.com"}
+    assert merged.version == 2
+    nodes, _ = await node_service.list(node_type.id, 10, "")
+    assert len(nodes) == 2
+
+
+@pytest.mark.asyncio
+async def test_dry_run_import_validates_without_writing():
+    """Test a dry run import counts what it would create and reports invalid lines, writing nothing."""
+    store = InMemoryStore()
+    transfer_service = TransferService(InMemoryTransferRepository(store), InMemoryNodeTypeRepository(store))
+    records = [
+        {"type": "node_type", "node_type": {
+            "id": "t1", "name": "Article", "schema": '{"title": "string", "site": "geo_point"}',
+        }},
+        {"type": "node", "node": {"id": "n1", "node_type_id": "t1", "data": '{"title": "a"}'}},
+        {"type": "node", "node": {"id": "n2", "node_type_id": "t1", "data": '{"title": "b"}'}},
+        {"type": "relationship", "relationship": {
+            "id": "r1", "source_node_id": "n1", "target_node_id": "n2", "relationship_type": "links",
+        }},
+    ]
+
+    progress = await _import(transfer_service, records, batch_size=2, dry_run=True)
+    assert [p["batches"] for p in progress] == [1, 2]
+    assert (progress[-1]["nodes_created"], progress[-1]["relationships_created"]) == (2, 1)
+    assert await InMemoryNodeTypeRepository(store).list_all() == []
+
+    records[2]["node"]["data"] = '{"site": 5}'
+    with pytest.raises(ValueError, match="line 3 is invalid: .*site"):
+        await _import(transfer_service, records, dry_run=True)
+
+
+@pytest.mark.asyncio
+async def test_resumed_import_skips_committed_records():
+    """Test a resumed import restores its ID mappings and skips records committed after its checkpoint."""
+    store = InMemoryStore()
+    transfer_service = TransferService(InMemoryTransferRepository(store), InMemoryNodeTypeRepository(store))
+    records = [
+        {"type": "node_type", "node_type": {
+            "id": "t1", "name": "Article", "schema": '{"title": "string", "site": "geo_point"}',
+        }},
+    ] + [
+        {"type": "node", "node": {"id": f"n{i}", "node_type_id": "t1", "data": f'{{"title": "{i}"}}'}}
+        for i in range(1, 5)
+    ] + [
+        {"type": "relationship", "relationship": {
+            "id": "r1", "source_node_id": "n1", "target_node_id": "n4", "relationship_type": "links",
+        }},
+    ]
+    records[4]["node"]["data"] = '{"site": 4}'
+
+    progress = []
+    with pytest.raises(ValueError, match="line 5 is invalid: .*site"):
+        async for p in transfer_service.import_lines(_lines(records), 2, key="job-1"):
+            progress.append(p.to_dict())
+    assert [p["lines"] for p in progress] == [2, 4] and len(store.nodes) == 3
+
+    # The second batch was committed, but its checkpoint was lost
+    records[4]["node"]["data"] = '{"title": "4"}'
+    checkpoint = ImportProgress.from_dict(progress[0])
+    result = (await _import(transfer_service, records, 2, key="job-1", resume=checkpoint))[-1]
+    assert (result["lines"], result["nodes_created"], result["records_skipped"]) == (6, 4, 2)
+    assert len(store.node_types) == 1 and len(store.nodes) == 4
+    relationship = next(iter(store.relationships.values()))
+    assert {relationship.source_node_id, relationship.target_node_id} <= set(store.nodes)
+
+    records[1]["node"]["data"] = '{"title": "changed"}'
+    with pytest.raises(FailedPreconditionError, match="lines 1-2 differ"):
+        await _import(transfer_service, records, 2, key="job-1", resume=checkpoint)
+
+
+def _contacts(*nodes):
+    """Export records of a Contact node type keyed by external_id, nodes and a relationship between the first two."""
+    records = [{"type": "node_type", "node_type": {
+        "id": "t1", "name": "Contact", "schema": '{"external_id": "string", "name": "string", "email": "string"}',
+        "unique_keys": ["external_id"],
+    }}]
+    records += [{"type": "node", "node": {"id": f"n{i}", "node_type_id": "t1", "data": json.dumps(data)}}
+                for i, data in enumerate(nodes)]
+    records.append({"type": "relationship", "relationship": {
+        "id": "r1", "source_node_id": "n0", "target_node_id": "n1", "relationship_type": "knows",
+    }})
+    return records
+
+
+@pytest.mark.asyncio
+async def test_import_conflict_strategies():
+    """Test nodes matching existing nodes by a unique key are skipped, overwritten, merged or fail the import."""
+    store = InMemoryStore()
+    transfer_service = TransferService(InMemoryTransferRepository(store), InMemoryNodeTypeRepository(store))
+    await _import(transfer_service, _contacts(
+        {"external_id": "a", "name": "Ada", "email": "ada@example.com"}, {"external_id": "b", "name": "Bob"},
+    ))
+    ada, bob = sorted(store.nodes.values(), key=lambda n: json.loads(n.data)["external_id"])
+    update = _contacts({"external_id": "a", "name": "Ada L."}, {"external_id": "c", "name": "Cy"})
+
+    with pytest.raises(AlreadyExistsError, match="line 2: node with the same external_id already exists"):
+        await _import(transfer_service, update)
+
+    skipped = (await _import(transfer_service, update, on_conflict="skip", report=True))[-1]
+    assert (skipped["nodes_created"], skipped["nodes_skipped"]) == (1, 1)
+    assert skipped["rows"][1] == {"line": 2, "type": "node", "id": ada.id, "outcome": "skipped"}
+    assert [row["outcome"] for row in skipped["rows"]] == ["matched", "skipped", "created", "created"]
+    assert json.loads(store.nodes[ada.id].data)["name"] == "Ada"
+    relationship = store.relationships[skipped["rows"][3]["id"]]
+    assert relationship.source_node_id == ada.id and relationship.target_node_id == skipped["rows"][2]["id"]
+
+    update = _contacts({"external_id": "a", "name": "Ada L."}, {"external_id": "b", "name": "Bob"})
+    await _import(transfer_service, update, on_conflict="overwrite")
+    assert json.loads(store.nodes[ada.id].data) == {"external_id": "a", "name": "Ada L."}
+    assert store.nodes[ada.id].version == 2
+
+    update = _contacts({"external_id": "a", "email": None}, {"external_id": "b", "email": "bob@example.com"})
+    merged = (await _import(transfer_service, update, on_conflict="merge_patch"))[-1]
+    assert (merged["nodes_created"], merged["nodes_merged"]) == (0, 2)
+    assert json.loads(store.nodes[bob.id].data) == {"external_id": "b", "name": "Bob", "email": "bob@example.com"}
+    assert len(store.nodes) == 3
+
+    update = _contacts({"external_id": "d", "name": "Di"}, {"external_id": "d", "name": "Dee"})
+    repeated = (await _import(transfer_service, update, on_conflict="overwrite", report=True))[-1]
+    assert [row["outcome"] for row in repeated["rows"][1:3]] == ["created", "overwritten"]
+    assert json.loads(store.nodes[repeated["rows"][1]["id"]].data)["name"] == "Dee"
+    with pytest.raises(ValueError, match="on_conflict"):
+        await _import(transfer_service, update, on_conflict="upsert")
+
+
+@pytest.mark.asyncio
+async def test_import_overwrites_check_enforced_locks(transfer_service, node_lock_service):
+    """Test an import fails rather than overwrite or merge into a node with an enforced lock."""
+    contacts = _contacts({"external_id": "a", "name": "Ada"}, {"external_id": "b", "name": "Bob"})
+    ada_id = (await _import(transfer_service, contacts, report=True))[-1]["rows"][1]["id"]
+    await node_lock_service.acquire(ada_id, "alice", enforce=True)
+
+    update = _contacts({"external_id": "a", "name": "Ada L."}, {"external_id": "c", "name": "Cy"})
+    with pytest.raises(NodeLockedError, match="locked by alice"):
+        await _import(transfer_service, update, on_conflict="overwrite")
+    with pytest.raises(NodeLockedError):
+        await _import(transfer_service, update, on_conflict="merge_patch")
+    assert (await _import(transfer_service, update, on_conflict="skip"))[-1]["nodes_skipped"] == 1
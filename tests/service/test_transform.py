@@ -0,0 +1,75 @@
+"""
+Tests for node data transforms used by node migrations.
+"""
+
+import json
+
+import pytest
+
+from app.service.transform import apply_transform, parse_transform
+
+
+def test_apply_transform_operations_in_order():
+    """Test every operation, applied in order to top-level fields."""
+    ops = parse_transform(json.dumps([
+        {"op": "rename", "from": "title", "to": "name"},
+        {"op": "copy", "from": "name", "to": "label"},
+        {"op": "remove", "field": "legacy"},
+        {"op": "set", "field": "status", "value": "active"},
+        {"op": "default", "field": "priority", "value": 3},
+        {"op": "default", "field": "owner", "value": "nobody"},
+        {"op": "convert", "field": "count", "to": "integer"},
+        {"op": "rename", "from": "missing", "to": "ignored"},
+    ]))
+    data = {"title": "Hello", "legacy": True, "owner": "ann", "priority": None, "count": "42"}
+
+    result = apply_transform(ops, data)
+
+    assert result == {
+        "name": "Hello",
+        "label": "Hello",
+        "status": "active",
+        "priority": 3,
+        "owner": "ann",
+        "count": 42,
+    }
+    assert "title" in data  # the input is not modified
+
+
+def test_convert():
+    """Test converting values between JSON types."""
+    cases = [
+        (12, "string", "12"),
+        ({"a": 1}, "string", '{"a": 1}'),
+        ("1.5", "number", 1.5),
+        ("7", "integer", 7),
+        (3.0, "integer", 3),
+        ("TRUE", "boolean", True),
+        (0, "boolean", False),
+    ]
+    for value, to, expected in cases:
+        ops = parse_transform(json.dumps([{"op": "convert", "field": "f", "to": to}]))
+        assert apply_transform(ops, {"f": value}) == {"f": expected}
+
+
+def test_convert_failure():
+    """Test values that cannot be converted raise ValueError naming the field."""
+    for value, to in [("abc", "number"), (1.5, "integer"), ("yes", "boolean"), (True, "number")]:
+        ops = parse_transform(json.dumps([{"op": "convert", "field": "f", "to": to}]))
+        with pytest.raises(ValueError, match=f"data.f cannot be converted to {to}"):
+            apply_transform(ops, {"f": value})
+
+
+def test_parse_transform_invalid():
+    """Test malformed transforms are rejected."""
+    cases = [
+        ("{", "transform must be valid JSON"),
+        ('{"op": "remove"}', "must be a JSON array"),
+        ('[{"op": "drop", "field": "a"}]', r"transform\[0\]\.op must be one of"),
+        ('[{"op": "set", "field": "a"}]', r"transform\[0\]\.value is required"),
+        ('[{"op": "rename", "from": "a", "to": ""}]', r"transform\[0\]\.to must be a field name"),
+        ('[{"op": "convert", "field": "a", "to": "date"}]', r"transform\[0\]\.to must be one of"),
+    ]
+    for transform, message in cases:
+        with pytest.raises(ValueError, match=message):
+            parse_transform(transform)
@@ -4,7 +4,10 @@ Tests for UserService.
 
 import pytest
 
+from app.auth import PermissionDeniedError
+from app.config import AuthConfig
 from app.repository.errors import NotFoundError
+from app.service import UserService
 
 
 @pytest.mark.asyncio
@@ -131,3 +134,28 @@ async def test_list_tenant_users(user_service, tenant_service):
     assert len(tenant_users) == 3
     assert result.total_count == 3
 
+
+
+@pytest.mark.asyncio
+async def test_login_with_password(user_repo, tenant_service):
+    """Test a user with a password logs in with a token of their memberships."""
+    import uuid
+    users = UserService(user_repo, AuthConfig(jwt_secret="s3cret"))
+    tenant = await tenant_service.create(f"test-tenant-{uuid.uuid4().hex[:8]}", "Test Tenant")
+    user = await users.create("test@example.com", "Test User")
+    await users.add_to_tenant(tenant.id, user.id, "admin")
+    await users.set_password(user.id, "correct horse battery")
+
+    token, _, logged_in, memberships = await users.login("test@example.com", "correct horse battery")
+    assert logged_in.id == user.id
+    assert [(m.tenant_id, m.role) for m in memberships] == [(tenant.id, "admin")]
+    assert users.signer.verify(token)["sub"] == user.id
+
+    with pytest.raises(PermissionDeniedError):
+        await users.login("test@example.com", "wrong horse battery")
+    with pytest.raises(NotFoundError):
+        await users.set_password(str(uuid.uuid4()), "correct horse battery")
+
+    # Deleting the user deletes their password
+    await users.delete(user.id)
+    assert await user_repo.get_password_hash(user.id) == ""
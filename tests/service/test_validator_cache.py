@@ -0,0 +1,55 @@
+"""
+Tests for the schema validator cache.
+"""
+
+import pytest
+
+from app.repository import NodeType
+from app.repository.errors import ValidationError
+from app.service.validator_cache import ValidatorCache
+
+SCHEMA = '{"location": {"type": "geo_point", "required": true}, "price": {"type": "decimal", "scale": 2}}'
+
+
+def test_validators_are_compiled_once_per_schema_version():
+    """Test a node type's validator is reused until its schema version changes."""
+    cache = ValidatorCache()
+    node_type = NodeType(id="nt1", schema=SCHEMA, schema_version=1)
+
+    validator = cache.get(node_type)
+    assert cache.get(node_type) is validator
+    point = '"location": {"lat": 0, "lng": 0}'
+    assert validator.normalize(f'{{{point}, "price": 12.5}}') == f'{{{point}, "price": "12.50"}}'
+    with pytest.raises(ValidationError) as e:
+        validator.validate('{"price": 1.234}')
+    assert [v.field for v in e.value.violations] == ["data.location", "data.price"]
+
+    node_type.schema = '{"title": "string"}'
+    node_type.schema_version = 2
+    assert cache.get(node_type) is not validator
+    cache.get(node_type).validate('{"price": 1.234}')
+    assert (cache.hits, cache.misses) == (2, 2)
+
+    # A schema seen under a version before is compiled again if it differs
+    restored = NodeType(id="nt1", schema='{"title": "geo_point"}', schema_version=2)
+    with pytest.raises(ValidationError):
+        cache.get(restored).validate('{"title": "Lamp"}')
+
+
+def test_least_recently_used_validators_are_evicted():
+    """Test the cache keeps at most max_entries validators and exports its counters."""
+    cache = ValidatorCache(max_entries=2)
+    types = [NodeType(id=f"nt{i}", schema=SCHEMA) for i in range(3)]
+
+    cache.get(types[0])
+    cache.get(types[1])
+    cache.get(types[0])
+    cache.get(types[2])
+    assert len(cache) == 2 and cache.evictions == 1
+    cache.get(types[0])
+    assert cache.hits == 2
+
+    text = "\n".join(cache.metric_lines())
+    assert "flexdb_schema_validators 2" in text
+    assert 'flexdb_schema_validator_lookups_total{result="miss"} 3' in text
+    assert "flexdb_schema_validator_evictions_total 1" in text
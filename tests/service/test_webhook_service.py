@@ -0,0 +1,110 @@
+"""
+Tests for WebhookService.
+"""
+
+import pytest
+
+from app.repository.errors import NotFoundError
+
+
+@pytest.mark.asyncio
+async def test_create_webhook_endpoint(webhook_service):
+    """Test registering a webhook endpoint generates a secret."""
+    endpoint = await webhook_service.create("https://example.com/hooks", ["node.created"], "Example")
+
+    assert endpoint.id is not None
+    assert len(endpoint.secret) == 64
+    assert endpoint.event_types == ["node.created"]
+    assert "secret" not in endpoint.to_dict()
+    assert endpoint.to_dict(include_secret=True)["secret"] == endpoint.secret
+
+
+@pytest.mark.asyncio
+async def test_create_webhook_endpoint_validation(webhook_service):
+    """Test webhook endpoint validation."""
+    with pytest.raises(ValueError, match="url is required"):
+        await webhook_service.create("", None, "")
+    with pytest.raises(ValueError, match="http or https"):
+        await webhook_service.create("ftp://example.com", None, "")
+    with pytest.raises(ValueError, match="unknown event type"):
+        await webhook_service.create("https://example.com", ["node.exploded"], "")
+
+
+@pytest.mark.asyncio
+async def test_create_chat_sink_validation(webhook_service):
+    """Test Slack/Teams sink options are validated."""
+    endpoint = await webhook_service.create(
+        "https://hooks.slack.com/services/T/B/X", ["node.created"], "", kind="slack",
+        template="{{entity.id}} created", node_type_ids=["t-1"],
+    )
+    assert endpoint.kind == "slack"
+    assert endpoint.node_type_ids == ["t-1"]
+
+    with pytest.raises(ValueError, match="kind must be one of"):
+        await webhook_service.create("https://example.com", None, "", kind="email")
+    with pytest.raises(ValueError, match="only supported for slack and teams"):
+        await webhook_service.create("https://example.com", None, "", template="{{type}}")
+    with pytest.raises(ValueError, match="invalid placeholder"):
+        await webhook_service.create("https://example.com", None, "", kind="teams", template="{{a b}}")
+
+
+@pytest.mark.asyncio
+async def test_update_webhook_endpoint(webhook_service):
+    """Test updating a webhook endpoint."""
+    endpoint = await webhook_service.create("https://example.com/hooks", None, "")
+
+    updated = await webhook_service.update(endpoint.id, "", ["node.deleted"], "", "disabled")
+
+    assert updated.url == "https://example.com/hooks"
+    assert updated.event_types == ["node.deleted"]
+    assert updated.status == "disabled"
+
+    with pytest.raises(ValueError, match="status must be one of"):
+        await webhook_service.update(endpoint.id, "", None, "", "paused")
+
+
+@pytest.mark.asyncio
+async def test_delete_webhook_endpoint(webhook_service):
+    """Test deleting a webhook endpoint."""
+    endpoint = await webhook_service.create("https://example.com/hooks", None, "")
+
+    await webhook_service.delete(endpoint.id)
+
+    with pytest.raises(NotFoundError):
+        await webhook_service.get_by_id(endpoint.id)
+
+
+@pytest.mark.asyncio
+async def test_send_test_event_and_list_deliveries(webhook_service):
+    """Test a test event is queued for the endpoint and listed in its delivery log."""
+    from app.service.webhook_service import delivery_log
+
+    endpoint = await webhook_service.create("https://example.com/hooks", ["node.created"], "")
+    other = await webhook_service.create("https://example.com/other", None, "")
+
+    delivery = await webhook_service.send_test_event(endpoint.id)
+    assert delivery.event_type == "webhook.test"
+    assert delivery_log(delivery)["payload"]["webhook_endpoint_id"] == endpoint.id
+
+    deliveries, _ = await webhook_service.list_deliveries(endpoint.id, 10, "")
+    assert [d.id for d in deliveries] == [delivery.id]
+    assert (await webhook_service.get_delivery(endpoint.id, delivery.id)).test
+    with pytest.raises(NotFoundError):
+        await webhook_service.get_delivery(other.id, delivery.id)
+    with pytest.raises(ValueError, match="status must be one of"):
+        await webhook_service.list_deliveries(endpoint.id, 10, "", status="dead")
+
+
+@pytest.mark.asyncio
+async def test_dry_run_webhook_endpoint(webhook_service):
+    """Test dry runs validate creates and updates without saving them."""
+    endpoint = await webhook_service.create("https://example.com/hooks", ["node.created"], "", dry_run=True)
+    assert endpoint.id == "" and endpoint.url == "https://example.com/hooks"
+    assert (await webhook_service.list(10, ""))[0] == []
+    with pytest.raises(ValueError, match="unknown event type"):
+        await webhook_service.create("https://example.com", ["node.exploded"], "", dry_run=True)
+
+    endpoint = await webhook_service.create("https://example.com/hooks", None, "")
+    updated = await webhook_service.update(endpoint.id, "", None, "", "disabled", dry_run=True)
+    assert updated.status == "disabled"
+    assert (await webhook_service.get_by_id(endpoint.id)).status == "active"
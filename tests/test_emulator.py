@@ -0,0 +1,54 @@
+"""
+Tests for the flexy-emulator.
+"""
+
+import os
+
+import pytest
+
+from app.emulator import configure, parse_args
+from app.repository import Tenant
+from app.repository.ids import use_deterministic_ids
+from app.storage import LocalTenantServices, MemoryStorage
+
+
+@pytest.fixture
+def environ(monkeypatch):
+    for name in ("STORAGE_BACKEND", "SQLITE_DIR", "AUTH_REQUIRED"):
+        monkeypatch.delenv(name, raising=False)
+    yield
+    use_deterministic_ids(None)
+
+
+async def _create_records():
+    """Create a tenant with a node type and a node in a fresh memory backend; returns their IDs."""
+    storage = MemoryStorage()
+    tenant = await storage.control().tenants.create(Tenant(slug="acme", name="Acme"))
+    services = await LocalTenantServices(storage).services(tenant.id)
+    node_type = await services["node_type"].create("Article", "", "")
+    node = await services["node"].create(node_type.id, "{}")
+    return [tenant.id, node_type.id, node.id]
+
+
+def test_configure_selects_the_backend(environ):
+    """Test the emulator points the server at its storage backend, without authentication."""
+    configure(parse_args(["--backend", "sqlite", "--data-dir", "/tmp/flexdb"]))
+
+    assert (os.environ["STORAGE_BACKEND"], os.environ["SQLITE_DIR"], os.environ["AUTH_REQUIRED"]) == (
+        "sqlite", "/tmp/flexdb", "false"
+    )
+
+
+@pytest.mark.asyncio
+async def test_deterministic_ids_repeat_per_seed(environ):
+    """Test the same seed yields the same IDs on every run, another seed other IDs, and no seed random ones."""
+    configure(parse_args(["--deterministic-ids", "--seed", "42"]))
+    first = await _create_records()
+    configure(parse_args(["--deterministic-ids", "--seed", "42"]))
+    assert await _create_records() == first
+
+    configure(parse_args(["--deterministic-ids", "--seed", "7"]))
+    assert not set(await _create_records()) & set(first)
+
+    configure(parse_args([]))
+    assert await _create_records() != await _create_records()
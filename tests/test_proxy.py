@@ -0,0 +1,74 @@
+"""
+Tests for flexy-proxy's recording and replay.
+"""
+
+import json
+
+import pytest
+
+from app.events.redaction import REDACTED
+from app.proxy import REPLAY_MISS_CODE, Cassette, parse_args, record_body, replay_body
+
+
+def _call(call_id, method, **params):
+    return {"jsonrpc": "2.0", "method": method, "params": params, "id": call_id}
+
+
+def test_recorded_calls_replay_in_order(tmp_path):
+    """Test a recording replays its responses with the caller's ids, in recorded order for repeated calls."""
+    path = str(tmp_path / "flexdb.jsonl")
+    cassette = Cassette(path)
+    get = _call(1, "get_node", tenant_id="t-1", id="n-1")
+    update = _call(2, "update_node", tenant_id="t-1", id="n-1", data='{"title": "b"}')
+    record_body(cassette, "/jsonrpc", get, {"jsonrpc": "2.0", "result": {"node": {"version": 1}}, "id": 1})
+    record_body(cassette, "/jsonrpc", [update, _call(3, "get_node", tenant_id="t-1", id="n-1")], [
+        {"jsonrpc": "2.0", "result": {"node": {"version": 2}}, "id": 2},
+        {"jsonrpc": "2.0", "result": {"node": {"version": 2}}, "id": 3},
+    ])
+
+    replayed = Cassette.load(path)
+    assert len(replayed) == 3
+    assert replay_body(replayed, "/jsonrpc", {**get, "id": "a"}) == {
+        "jsonrpc": "2.0", "result": {"node": {"version": 1}}, "id": "a"
+    }
+    assert [r["result"]["node"]["version"] for r in replay_body(replayed, "/jsonrpc", [get, get, get])] == [2, 2, 2]
+    assert replay_body(replayed, "/jsonrpc", {**update, "id": None}) is None
+
+    miss = replay_body(replayed, "/analytics/jsonrpc", get)
+    assert (miss["error"]["code"], miss["id"]) == (REPLAY_MISS_CODE, 1)
+
+
+def test_recordings_are_redacted(tmp_path):
+    """Test credential-like fields are redacted in the cassette but page tokens are kept, and calls still match."""
+    path = str(tmp_path / "flexdb.jsonl")
+    cassette = Cassette(path)
+    create = _call(1, "create_webhook", tenant_id="t-1", url="https://example.com", secret="s3cret")
+    listing = _call(2, "list_nodes", tenant_id="t-1", pagination={"page_size": 10, "page_token": "p2"})
+    record_body(cassette, "/jsonrpc", create, {"jsonrpc": "2.0", "result": {"webhook": {"secret": "s3cret"}}, "id": 1})
+    record_body(cassette, "/jsonrpc", listing, {
+        "jsonrpc": "2.0", "result": {"nodes": [], "pagination": {"next_page_token": "p3"}}, "id": 2
+    })
+
+    with open(path) as f:
+        recorded = f.read()
+    assert "s3cret" not in recorded
+    assert json.loads(recorded.splitlines()[0])["request"]["params"]["secret"] == REDACTED
+
+    replayed = Cassette.load(path)
+    assert replay_body(replayed, "/jsonrpc", {**create, "params": {**create["params"], "secret": "other"}})[
+        "result"
+    ] == {"webhook": {"secret": REDACTED}}
+    assert replay_body(replayed, "/jsonrpc", listing)["result"]["pagination"]["next_page_token"] == "p3"
+    other_page = _call(3, "list_nodes", tenant_id="t-1", pagination={"page_size": 10, "page_token": "p3"})
+    assert replay_body(replayed, "/jsonrpc", other_page)["error"]["code"] == REPLAY_MISS_CODE
+
+
+def test_malformed_cassettes_and_arguments_are_rejected(tmp_path):
+    """Test a malformed cassette line names its position, and recording requires an upstream."""
+    path = tmp_path / "flexdb.jsonl"
+    path.write_text('{"endpoint": "/jsonrpc", "request": {"method": "get_node"}}\n')
+
+    with pytest.raises(ValueError, match="flexdb.jsonl:1: invalid interaction"):
+        Cassette.load(str(path))
+    with pytest.raises(SystemExit):
+        parse_args(["record", "--cassette", str(path)])